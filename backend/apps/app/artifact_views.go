@@ -0,0 +1,180 @@
+package app
+
+import (
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/spectrumwebco/agent_runtime/backend/core/artifacts"
+	"github.com/spectrumwebco/agent_runtime/backend/core/audit"
+	pb "github.com/spectrumwebco/agent_runtime/backend/protos/gen/go/agent_runs"
+	"github.com/spectrumwebco/agent_runtime/pkg/djangogo/core"
+)
+
+// artifactResponse is an artifact with a signed URL to download it.
+type artifactResponse struct {
+	*artifacts.Artifact
+	DownloadURL string `json:"download_url"`
+	// DownloadURLExpiresAt is when the download URL stops working; list the
+	// artifacts again for a new one.
+	DownloadURLExpiresAt time.Time `json:"download_url_expires_at"`
+}
+
+func signArtifact(artifact *artifacts.Artifact) (*artifactResponse, error) {
+	query, expires, err := artifacts.DefaultManager().Sign(artifact.ID)
+	if err != nil {
+		return nil, err
+	}
+	return &artifactResponse{
+		Artifact:             artifact,
+		DownloadURL:          fmt.Sprintf("/api/artifacts/%s/download/?%s", artifact.ID, query.Encode()),
+		DownloadURLExpiresAt: expires,
+	}, nil
+}
+
+// RunArtifacts lists the artifacts of a run with signed download URLs, or
+// registers the request body as an artifact of the run. The name, metadata
+// and retention of a new artifact are query parameters, its content type is
+// the one of the request.
+func RunArtifacts(w http.ResponseWriter, r *http.Request) {
+	client, ctx, tenant, ok := runCall(w, r)
+	if !ok {
+		return
+	}
+	msg, err := client.GetRun(ctx, &pb.RunRequest{ProjectId: tenant.ProjectID, RunId: mux.Vars(r)["run_id"]})
+	if err != nil {
+		runError(w, err)
+		return
+	}
+	manager := artifacts.DefaultManager()
+
+	if r.Method == http.MethodGet {
+		list, err := manager.List(r.Context(), tenant.OrganizationID, msg.Id)
+		if err != nil {
+			core.JSONResponse(w, map[string]interface{}{"status": "error", "message": err.Error()}, http.StatusInternalServerError)
+			return
+		}
+		responses := make([]*artifactResponse, 0, len(list))
+		for _, artifact := range list {
+			if artifact.ProjectID != tenant.ProjectID {
+				continue
+			}
+			response, err := signArtifact(artifact)
+			if err != nil {
+				core.JSONResponse(w, map[string]interface{}{"status": "error", "message": err.Error()}, http.StatusInternalServerError)
+				return
+			}
+			responses = append(responses, response)
+		}
+		core.JSONResponse(w, map[string]interface{}{"status": "success", "artifacts": responses}, http.StatusOK)
+		return
+	}
+
+	query := r.URL.Query()
+	artifact := &artifacts.Artifact{
+		OrganizationID: tenant.OrganizationID,
+		ProjectID:      tenant.ProjectID,
+		RunID:          msg.Id,
+		WorkspaceID:    msg.WorkspaceId,
+		Name:           query.Get("name"),
+		ContentType:    r.Header.Get("Content-Type"),
+	}
+	if err := artifacts.ValidateName(artifact.Name); err != nil {
+		core.JSONResponse(w, map[string]interface{}{"status": "error", "message": err.Error()}, http.StatusBadRequest)
+		return
+	}
+	if artifact.ContentType != "" {
+		if _, _, err := mime.ParseMediaType(artifact.ContentType); err != nil {
+			core.JSONResponse(w, map[string]interface{}{"status": "error", "message": fmt.Sprintf("invalid content type %q", artifact.ContentType)}, http.StatusBadRequest)
+			return
+		}
+	}
+	for _, pair := range query["metadata"] {
+		key, value, found := strings.Cut(pair, "=")
+		if !found || key == "" {
+			core.JSONResponse(w, map[string]interface{}{"status": "error", "message": fmt.Sprintf("invalid metadata %q, must be key=value", pair)}, http.StatusBadRequest)
+			return
+		}
+		if artifact.Metadata == nil {
+			artifact.Metadata = map[string]string{}
+		}
+		artifact.Metadata[key] = value
+	}
+	if value := query.Get("retention_days"); value != "" {
+		days, err := strconv.Atoi(value)
+		if err != nil || days < 1 {
+			core.JSONResponse(w, map[string]interface{}{"status": "error", "message": fmt.Sprintf("invalid retention_days %q", value)}, http.StatusBadRequest)
+			return
+		}
+		expiresAt := time.Now().Add(time.Duration(days) * 24 * time.Hour).UTC()
+		artifact.ExpiresAt = &expiresAt
+	}
+	if user := core.GetUserFromRequest(r); user != nil && user.IsAuthenticated() {
+		artifact.CreatedBy = fmt.Sprint(user.GetID())
+	}
+
+	registered, err := manager.Register(r.Context(), artifact, r.Body)
+	if errors.Is(err, artifacts.ErrTooLarge) {
+		core.JSONResponse(w, map[string]interface{}{"status": "error", "message": err.Error()}, http.StatusRequestEntityTooLarge)
+		return
+	} else if err != nil {
+		core.JSONResponse(w, map[string]interface{}{"status": "error", "message": err.Error()}, http.StatusInternalServerError)
+		return
+	}
+	audit.FromContext(r.Context()).SetResource("artifact", registered.ID)
+
+	response, err := signArtifact(registered)
+	if err != nil {
+		core.JSONResponse(w, map[string]interface{}{"status": "error", "message": err.Error()}, http.StatusInternalServerError)
+		return
+	}
+	core.JSONResponse(w, map[string]interface{}{"status": "success", "artifact": response}, http.StatusCreated)
+}
+
+// DownloadArtifact serves the content of an artifact to anyone with a
+// signed URL of it, after checking it against the recorded hash.
+func DownloadArtifact(w http.ResponseWriter, r *http.Request) {
+	artifactID := mux.Vars(r)["artifact_id"]
+	manager := artifacts.DefaultManager()
+	if err := manager.Verify(artifactID, r.URL.Query()); err != nil {
+		core.JSONResponse(w, map[string]interface{}{"status": "error", "message": err.Error()}, http.StatusForbidden)
+		return
+	}
+
+	artifact, err := manager.Get(r.Context(), artifactID)
+	if errors.Is(err, artifacts.ErrNotFound) {
+		core.JSONResponse(w, map[string]interface{}{"status": "error", "message": fmt.Sprintf("artifact %s not found", artifactID)}, http.StatusNotFound)
+		return
+	} else if err != nil {
+		core.JSONResponse(w, map[string]interface{}{"status": "error", "message": err.Error()}, http.StatusInternalServerError)
+		return
+	}
+	audit.FromContext(r.Context()).SetResource("artifact", artifact.ID)
+
+	data, err := manager.Content(r.Context(), artifact)
+	switch {
+	case errors.Is(err, artifacts.ErrNotFound):
+		core.JSONResponse(w, map[string]interface{}{"status": "error", "message": fmt.Sprintf("content of artifact %s not found", artifactID)}, http.StatusNotFound)
+		return
+	case err != nil:
+		core.JSONResponse(w, map[string]interface{}{"status": "error", "message": err.Error()}, http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", artifact.ContentType)
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": artifact.Name}))
+	w.Header().Set("ETag", `"`+artifact.SHA256+`"`)
+	w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+	w.WriteHeader(http.StatusOK)
+	w.Write(data)
+}
+
+func init() {
+	registerAPIView("run_artifacts", RunArtifacts, []string{"GET", "POST"}, []string{"HasAPIKey"})
+	registerAPIView("download_artifact", DownloadArtifact, []string{"GET"}, []string{"AllowAny"})
+}
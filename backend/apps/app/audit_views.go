@@ -0,0 +1,159 @@
+package app
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/spectrumwebco/agent_runtime/backend/core/audit"
+	"github.com/spectrumwebco/agent_runtime/backend/db/integrations"
+	"github.com/spectrumwebco/agent_runtime/pkg/djangogo/core"
+)
+
+func auditFilterFromRequest(r *http.Request) (audit.Filter, error) {
+	query := r.URL.Query()
+	filter := audit.Filter{
+		ActorID:      query.Get("actor_id"),
+		Action:       query.Get("action"),
+		ResourceType: query.Get("resource_type"),
+		ResourceID:   query.Get("resource_id"),
+	}
+
+	for name, target := range map[string]*time.Time{"since": &filter.Since, "until": &filter.Until} {
+		if value := query.Get(name); value != "" {
+			parsed, err := time.Parse(time.RFC3339, value)
+			if err != nil {
+				return filter, fmt.Errorf("%s must be an RFC 3339 timestamp", name)
+			}
+			*target = parsed
+		}
+	}
+
+	if value := query.Get("after"); value != "" {
+		after, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return filter, fmt.Errorf("after must be a sequence number")
+		}
+		filter.AfterSequence = after
+	}
+	if value := query.Get("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil {
+			return filter, fmt.Errorf("limit must be a number")
+		}
+		filter.Limit = limit
+	}
+
+	return filter, nil
+}
+
+func ListAuditLog(w http.ResponseWriter, r *http.Request) {
+	filter, err := auditFilterFromRequest(r)
+	if err != nil {
+		core.JSONResponse(w, map[string]interface{}{"status": "error", "message": err.Error()}, http.StatusBadRequest)
+		return
+	}
+
+	entries, err := audit.DefaultStore().Query(r.Context(), filter)
+	if err != nil {
+		core.JSONResponse(w, map[string]interface{}{"status": "error", "message": err.Error()}, http.StatusInternalServerError)
+		return
+	}
+
+	response := map[string]interface{}{
+		"status":  "success",
+		"entries": entries,
+	}
+	if len(entries) > 0 {
+		response["next_after"] = entries[len(entries)-1].Sequence
+	}
+	core.JSONResponse(w, response, http.StatusOK)
+}
+
+func ExportAuditLog(w http.ResponseWriter, r *http.Request) {
+	filter, err := auditFilterFromRequest(r)
+	if err != nil {
+		core.JSONResponse(w, map[string]interface{}{"status": "error", "message": err.Error()}, http.StatusBadRequest)
+		return
+	}
+	if filter.Limit == 0 {
+		filter.Limit = audit.MaxQueryLimit
+	}
+
+	entries, err := audit.DefaultStore().Query(r.Context(), filter)
+	if err != nil {
+		core.JSONResponse(w, map[string]interface{}{"status": "error", "message": err.Error()}, http.StatusInternalServerError)
+		return
+	}
+
+	filename := "audit-" + time.Now().UTC().Format("20060102T150405Z")
+	switch format := r.URL.Query().Get("format"); format {
+	case "", "jsonl":
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename+".jsonl"))
+		err = audit.WriteJSONLines(w, entries)
+	case "csv":
+		w.Header().Set("Content-Type", "text/csv")
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename+".csv"))
+		err = audit.WriteCSV(w, entries)
+	default:
+		core.JSONResponse(w, map[string]interface{}{"status": "error", "message": "format must be jsonl or csv"}, http.StatusBadRequest)
+		return
+	}
+
+	if err != nil {
+		logger.Printf("Error exporting audit log: %v", err)
+	}
+}
+
+// VerifyAuditLog walks the whole chain and reports the first broken entry.
+func VerifyAuditLog(w http.ResponseWriter, r *http.Request) {
+	store := audit.DefaultStore()
+	prevHash := audit.GenesisHash
+	filter := audit.Filter{Limit: audit.MaxQueryLimit}
+	verified := 0
+
+	for {
+		entries, err := store.Query(r.Context(), filter)
+		if err != nil {
+			core.JSONResponse(w, map[string]interface{}{"status": "error", "message": err.Error()}, http.StatusInternalServerError)
+			return
+		}
+
+		if sequence, err := audit.Verify(entries, prevHash); err != nil {
+			core.JSONResponse(w, map[string]interface{}{
+				"status":         "tampered",
+				"message":        err.Error(),
+				"first_invalid":  sequence,
+				"verified_count": verified,
+			}, http.StatusConflict)
+			return
+		}
+
+		verified += len(entries)
+		if len(entries) < audit.MaxQueryLimit {
+			break
+		}
+		prevHash = entries[len(entries)-1].Hash
+		filter.AfterSequence = entries[len(entries)-1].Sequence
+	}
+
+	core.JSONResponse(w, map[string]interface{}{
+		"status":         "valid",
+		"verified_count": verified,
+	}, http.StatusOK)
+}
+
+func init() {
+	store := audit.NewPostgresStore(integrations.GetPostgresStore("default"))
+	if err := store.EnsureSchema(); err != nil {
+		logger.Printf("Audit log falling back to in-memory store: %v", err)
+	} else {
+		audit.SetDefaultStore(store)
+	}
+
+	registerAPIView("list_audit_log", ListAuditLog, []string{"GET"}, []string{"IsAdminUser"})
+	registerAPIView("export_audit_log", ExportAuditLog, []string{"GET"}, []string{"IsAdminUser"})
+	registerAPIView("verify_audit_log", VerifyAuditLog, []string{"GET"}, []string{"IsAdminUser"})
+}
@@ -0,0 +1,59 @@
+package app
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/spectrumwebco/agent_runtime/backend/core/autoscale"
+	"github.com/spectrumwebco/agent_runtime/backend/core/reconcile"
+	"github.com/spectrumwebco/agent_runtime/backend/core/runs"
+	"github.com/spectrumwebco/agent_runtime/backend/db/integrations"
+	"github.com/spectrumwebco/agent_runtime/pkg/djangogo/core"
+)
+
+var autoscaleSampler *autoscale.Sampler
+
+// AutoscalingSignals returns the latest value of every load signal, for the
+// metrics-api scaler of KEDA, e.g. with valueLocation signals.queue_depth.
+func AutoscalingSignals(w http.ResponseWriter, r *http.Request) {
+	core.JSONResponse(w, map[string]interface{}{
+		"status":  "success",
+		"signals": autoscaleSampler.Current(),
+	}, http.StatusOK)
+}
+
+type autoscalingAdviceResponse struct {
+	Status string             `json:"status"`
+	Advice []autoscale.Advice `json:"advice"`
+	// Replicas is the highest replicas suggested by a signal.
+	Replicas int     `json:"replicas"`
+	Window   float64 `json:"window"`
+}
+
+// AutoscalingAdvice suggests replica counts from the peak load of the
+// recent window.
+func AutoscalingAdvice(w http.ResponseWriter, r *http.Request) {
+	advice, replicas := autoscaleSampler.Advise()
+	core.JSONResponse(w, map[string]interface{}{
+		"status":   "success",
+		"advice":   advice,
+		"replicas": replicas,
+		"window":   autoscale.Default().Window.Seconds(),
+	}, http.StatusOK)
+}
+
+func init() {
+	autoscaleSampler = autoscale.NewSampler(autoscale.Default())
+	postgres := integrations.GetPostgresStore("default")
+	autoscaleSampler.Add(autoscale.SignalQueueDepth, autoscale.RunsInState(postgres, runs.StatePending))
+	autoscaleSampler.Add(autoscale.SignalInterpreterSessions, autoscale.RunsInState(postgres, runs.StateRunning))
+	// pending workspaces are only measured where the workspace pods are
+	// reachable
+	if driver, err := reconcile.NewKubernetesDriver(reconcile.FromEnv().Namespace); err == nil {
+		autoscaleSampler.Add(autoscale.SignalPendingWorkspaces, autoscale.PendingContainers(driver))
+	}
+	go autoscaleSampler.Run(context.Background())
+
+	registerAPIView("autoscaling_signals", AutoscalingSignals, []string{"GET"}, []string{"HasAPIKey"})
+	registerAPIView("autoscaling_advice", AutoscalingAdvice, []string{"GET"}, []string{"HasAPIKey"})
+}
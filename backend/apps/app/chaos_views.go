@@ -0,0 +1,74 @@
+package app
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/spectrumwebco/agent_runtime/backend/core/audit"
+	"github.com/spectrumwebco/agent_runtime/backend/core/chaos"
+	"github.com/spectrumwebco/agent_runtime/pkg/djangogo/core"
+)
+
+// chaosEnabled answers 404 unless fault injection is enabled, so the API
+// doesn't exist outside staging.
+func chaosEnabled(w http.ResponseWriter, r *http.Request) bool {
+	if !chaos.Default().Enabled() {
+		audit.FromContext(r.Context()).Skip()
+		core.JSONResponse(w, map[string]interface{}{"status": "error", "message": "fault injection is disabled, set AGENT_CHAOS_ENABLED"}, http.StatusNotFound)
+		return false
+	}
+	return true
+}
+
+// ChaosFaults lists the active faults with what they did, adds or replaces
+// a fault, or removes all of them.
+func ChaosFaults(w http.ResponseWriter, r *http.Request) {
+	if !chaosEnabled(w, r) {
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		audit.FromContext(r.Context()).Skip()
+		core.JSONResponse(w, map[string]interface{}{"status": "success", "faults": chaos.Default().List()}, http.StatusOK)
+
+	case http.MethodPut:
+		fault := chaos.Fault{}
+		if err := json.NewDecoder(r.Body).Decode(&fault); err != nil {
+			core.JSONResponse(w, map[string]interface{}{"status": "error", "message": err.Error()}, http.StatusBadRequest)
+			return
+		}
+		if err := chaos.Default().Set(fault); err != nil {
+			core.JSONResponse(w, map[string]interface{}{"status": "error", "message": err.Error()}, http.StatusBadRequest)
+			return
+		}
+		recorder := audit.FromContext(r.Context())
+		recorder.SetResource("chaos_fault", fault.Name)
+		recorder.AddMetadata("target", fault.Target)
+		core.JSONResponse(w, map[string]interface{}{"status": "success", "fault": fault}, http.StatusOK)
+
+	case http.MethodDelete:
+		chaos.Default().Clear()
+		core.JSONResponse(w, map[string]interface{}{"status": "success"}, http.StatusOK)
+	}
+}
+
+// DeleteChaosFault removes a fault.
+func DeleteChaosFault(w http.ResponseWriter, r *http.Request) {
+	if !chaosEnabled(w, r) {
+		return
+	}
+	name := mux.Vars(r)["name"]
+	audit.FromContext(r.Context()).SetResource("chaos_fault", name)
+	if !chaos.Default().Remove(name) {
+		core.JSONResponse(w, map[string]interface{}{"status": "error", "message": "fault not found"}, http.StatusNotFound)
+		return
+	}
+	core.JSONResponse(w, map[string]interface{}{"status": "success"}, http.StatusOK)
+}
+
+func init() {
+	registerAPIView("chaos_faults", ChaosFaults, []string{"GET", "PUT", "DELETE"}, []string{"IsAdminUser"})
+	registerAPIView("delete_chaos_fault", DeleteChaosFault, []string{"DELETE"}, []string{"IsAdminUser"})
+}
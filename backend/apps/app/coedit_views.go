@@ -0,0 +1,132 @@
+package app
+
+import (
+	"context"
+	"net/http"
+	"sync"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"github.com/gorilla/websocket"
+	"github.com/spectrumwebco/agent_runtime/backend/apps/app/middleware"
+	"github.com/spectrumwebco/agent_runtime/backend/core/coedit"
+	"github.com/spectrumwebco/agent_runtime/backend/core/jwtauth"
+	"github.com/spectrumwebco/agent_runtime/backend/core/rbac"
+	"github.com/spectrumwebco/agent_runtime/pkg/djangogo/core"
+)
+
+var (
+	coeditHub     *coedit.Hub
+	coeditHubErr  error
+	coeditHubOnce sync.Once
+)
+
+func getCoeditHub() (*coedit.Hub, error) {
+	coeditHubOnce.Do(func() {
+		executor, err := getTerminalExecutor()
+		if err != nil {
+			coeditHubErr = err
+			return
+		}
+
+		scrollback, _ := core.GetSetting("COEDIT_SCROLLBACK_BYTES", coedit.DefaultScrollbackSize)
+		maxSessions, _ := core.GetSetting("COEDIT_MAX_SESSIONS", coedit.DefaultMaxSessions)
+		coeditHub = coedit.NewHub(executor, coedit.Options{
+			ScrollbackSize: scrollback.(int),
+			MaxSessions:    maxSessions.(int),
+		})
+		coeditHub.OnPresence = publishCoeditPresence
+	})
+	return coeditHub, coeditHubErr
+}
+
+// publishCoeditPresence tells the workspace owner's other connections, e.g.
+// the dashboard, who is working in the workspace.
+func publishCoeditPresence(workspaceID string, participants []coedit.Participant) {
+	workspace, err := middleware.LookupWorkspace(context.Background(), "workspace", workspaceID)
+	if err != nil || workspace.OwnerID == "" {
+		return
+	}
+	if participants == nil {
+		participants = []coedit.Participant{}
+	}
+
+	err = GetManager().SendToGroup("user_"+workspace.OwnerID, map[string]interface{}{
+		"type":         "coedit_presence",
+		"workspace_id": workspaceID,
+		"participants": participants,
+	})
+	if err != nil {
+		terminalLogger.Printf("Error publishing co-editing presence of workspace %s: %v", workspaceID, err)
+	}
+}
+
+// WorkspaceCoedit joins the caller to the co-editing relay of a workspace,
+// where the members of its organization share terminal sessions. Joining
+// needs interpreter.execute on the workspace, which the RBAC middleware
+// checks before the view runs. Callers holding only the viewer role join
+// read-only. Agents connect with ?kind=agent, ?mode=view joins read-only and
+// ?name= sets the name shown to the others.
+func WorkspaceCoedit(w http.ResponseWriter, r *http.Request) {
+	workspaceID := mux.Vars(r)["workspace_id"]
+	subject, ok := rbac.SubjectFromContext(r.Context())
+	if !ok || subject.ID == "" {
+		core.JSONResponse(w, map[string]interface{}{"status": "error", "message": "joining the co-editing session was not authorized"}, http.StatusForbidden)
+		return
+	}
+	if err := checkWorkspace(r.Context(), workspaceID); err != nil {
+		core.JSONResponse(w, map[string]interface{}{"status": "error", "message": err.Error()}, http.StatusNotFound)
+		return
+	}
+	if !websocket.IsWebSocketUpgrade(r) {
+		core.JSONResponse(w, map[string]interface{}{"status": "error", "message": "expected a WebSocket upgrade"}, http.StatusBadRequest)
+		return
+	}
+
+	query := r.URL.Query()
+	kind := query.Get("kind")
+	if kind == "" {
+		kind = coedit.KindHuman
+	} else if kind != coedit.KindHuman && kind != coedit.KindAgent {
+		core.JSONResponse(w, map[string]interface{}{"status": "error", "message": "kind must be human or agent"}, http.StatusBadRequest)
+		return
+	}
+
+	hub, err := getCoeditHub()
+	if err != nil {
+		core.JSONResponse(w, map[string]interface{}{"status": "error", "message": err.Error()}, http.StatusServiceUnavailable)
+		return
+	}
+
+	// the query string can only give up control, the roles decide whether
+	// the caller may take it
+	canControl := subject.HasRole(rbac.RoleDeveloper) || subject.HasRole(rbac.RoleAdmin)
+	participant := coedit.Participant{
+		ID:       uuid.NewString(),
+		UserID:   subject.ID,
+		Name:     query.Get("name"),
+		Kind:     kind,
+		ReadOnly: !canControl || query.Get("mode") == "view",
+	}
+	if participant.Name == "" {
+		if claims := jwtauth.FromContext(r.Context()); claims != nil && claims.Email != "" {
+			participant.Name = claims.Email
+		} else {
+			participant.Name = participant.UserID
+		}
+	}
+
+	conn, err := terminalUpgrader.Upgrade(w, r, nil)
+	if err != nil {
+		terminalLogger.Printf("Error upgrading co-editing connection for workspace %s: %v", workspaceID, err)
+		return
+	}
+
+	if err := coedit.Serve(conn, hub, workspaceID, participant); err != nil {
+		terminalLogger.Printf("Co-editing connection %s of workspace %s closed: %v", participant.ID, workspaceID, err)
+	}
+}
+
+func init() {
+	registerAPIView("workspace_coedit", WorkspaceCoedit, []string{"GET"}, []string{"IsAuthenticated"})
+}
@@ -1,12 +1,21 @@
 package app
 
 import (
+	"context"
 	"encoding/json"
 	"log"
 	"sync"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/gorilla/websocket"
+	"github.com/spectrumwebco/agent_runtime/backend/apps/app/middleware"
+	"github.com/spectrumwebco/agent_runtime/backend/core/agentcmd"
+	"github.com/spectrumwebco/agent_runtime/backend/core/jwtauth"
+	"github.com/spectrumwebco/agent_runtime/backend/core/outputs"
+	"github.com/spectrumwebco/agent_runtime/backend/core/rbac"
+	"github.com/spectrumwebco/agent_runtime/backend/core/webhooks"
+	"github.com/spectrumwebco/agent_runtime/backend/core/wsproto"
 	"github.com/spectrumwebco/agent_runtime/pkg/djangogo/core"
 )
 
@@ -21,9 +30,31 @@ type BaseWebSocketConsumer struct {
 	Closed bool
 	ClosedMutex sync.Mutex
 	EventHandlers map[string]func(map[string]interface{}) error
+
+	endpoint wsproto.Endpoint
+	// claims are set for end users authenticated with a Supabase access
+	// token instead of a session.
+	claims *jwtauth.Claims
+	// handle lets embedding consumers handle their own message types. It
+	// returns false for messages left to the base consumer.
+	handle func(wsproto.Message) bool
 }
 
+var (
+	baseEndpoint  = wsproto.NewEndpoint(wsproto.FeaturePing, wsproto.FeatureEvents)
+	agentEndpoint = wsproto.NewEndpoint(wsproto.FeaturePing, wsproto.FeatureEvents, wsproto.FeatureAgentCommands, wsproto.FeatureCommandApprovals)
+	mlEndpoint    = wsproto.NewEndpoint(wsproto.FeaturePing, wsproto.FeatureEvents, wsproto.FeatureMLCommands)
+)
+
 func NewBaseWebSocketConsumer(conn *websocket.Conn) *BaseWebSocketConsumer {
+	consumer := newBaseWebSocketConsumer(conn, baseEndpoint)
+	consumer.start()
+	return consumer
+}
+
+// newBaseWebSocketConsumer registers a consumer without starting it, so
+// embedding consumers can set their handler before the first frame is read.
+func newBaseWebSocketConsumer(conn *websocket.Conn, endpoint wsproto.Endpoint) *BaseWebSocketConsumer {
 	consumerID := uuid.New().String()
 	consumer := &BaseWebSocketConsumer{
 		Connection:    conn,
@@ -32,6 +63,7 @@ func NewBaseWebSocketConsumer(conn *websocket.Conn) *BaseWebSocketConsumer {
 		Send:          make(chan []byte, 256),
 		Closed:        false,
 		EventHandlers: make(map[string]func(map[string]interface{}) error),
+		endpoint:      endpoint,
 	}
 
 	user := core.GetUserFromContext(conn.Context())
@@ -40,25 +72,28 @@ func NewBaseWebSocketConsumer(conn *websocket.Conn) *BaseWebSocketConsumer {
 	if user != nil && core.IsUserAuthenticated(user) {
 		userID := core.GetUserID(user)
 		consumer.Groups = append(consumer.Groups, "user_"+userID)
+	} else if claims := jwtauth.FromContext(conn.Context()); claims != nil {
+		consumer.claims = claims
+		consumer.Groups = append(consumer.Groups, "user_"+claims.Subject)
 	}
 
 	manager := GetManager()
 	manager.RegisterConsumer(consumer.ConsumerID, consumer, consumer.Groups)
 
-	go consumer.writePump()
-	go consumer.readPump()
+	return consumer
+}
+
+func (c *BaseWebSocketConsumer) start() {
+	go c.writePump()
+	go c.readPump()
 
-	connectionMsg := map[string]interface{}{
+	c.send(map[string]interface{}{
 		"type":        "connection_established",
-		"consumer_id": consumer.ConsumerID,
-	}
-	msgBytes, err := json.Marshal(connectionMsg)
-	if err == nil {
-		consumer.Send <- msgBytes
-	}
+		"consumer_id": c.ConsumerID,
+		"protocol":    c.endpoint.Info(),
+	})
 
-	consumerLogger.Printf("WebSocket connection established for consumer %s", consumer.ConsumerID)
-	return consumer
+	consumerLogger.Printf("WebSocket connection established for consumer %s", c.ConsumerID)
 }
 
 func (c *BaseWebSocketConsumer) Close() {
@@ -68,9 +103,8 @@ func (c *BaseWebSocketConsumer) Close() {
 		return
 	}
 	c.Closed = true
-	c.ClosedMutex.Unlock()
-
 	close(c.Send)
+	c.ClosedMutex.Unlock()
 
 	manager := GetManager()
 	manager.UnregisterConsumer(c.ConsumerID)
@@ -128,127 +162,83 @@ func (c *BaseWebSocketConsumer) writePump() {
 	}
 }
 
-func (c *BaseWebSocketConsumer) handleMessage(message []byte) {
-	var data map[string]interface{}
-	if err := json.Unmarshal(message, &data); err != nil {
-		consumerLogger.Printf("Failed to decode JSON message: %v", err)
-		c.sendError("Invalid JSON")
+func (c *BaseWebSocketConsumer) handleMessage(frame []byte) {
+	message, protocolErr := c.endpoint.Decode(frame)
+	if protocolErr != nil {
+		consumerLogger.Printf("Rejected frame from consumer %s: %v", c.ConsumerID, protocolErr)
+		c.sendError(protocolErr)
 		return
 	}
 
-	messageType, ok := data["type"].(string)
-	if !ok {
-		consumerLogger.Printf("Message missing 'type' field")
-		c.sendError("Missing message type")
+	if c.handle != nil && c.handle(message) {
 		return
 	}
 
-	if messageType == "ping" {
-		pongMsg := map[string]interface{}{
-			"type":      "pong",
-			"timestamp": data["timestamp"],
-		}
-		msgBytes, err := json.Marshal(pongMsg)
-		if err == nil {
-			c.Send <- msgBytes
+	switch m := message.(type) {
+	case *wsproto.Hello:
+		welcome, protocolErr := c.endpoint.Negotiate(m)
+		if protocolErr != nil {
+			c.sendError(protocolErr)
+			return
 		}
-		return
-	}
-
-	switch messageType {
-	case "subscribe":
-		c.handleSubscribe(data)
-	case "unsubscribe":
-		c.handleUnsubscribe(data)
-	case "event":
-		c.handleEvent(data)
+		c.send(welcome)
+	case *wsproto.Ping:
+		c.send(reply(m.ID, map[string]interface{}{
+			"type":      "pong",
+			"timestamp": m.Timestamp,
+		}))
+	case *wsproto.Subscribe:
+		c.handleSubscribe(m)
+	case *wsproto.Unsubscribe:
+		c.handleUnsubscribe(m)
+	case *wsproto.Event:
+		c.handleEvent(m)
 	default:
-		consumerLogger.Printf("Unknown message type: %s", messageType)
-		c.sendError("Unknown message type: " + messageType)
+		c.sendError(&wsproto.Error{Code: wsproto.CodeUnsupportedType, Message: m.MessageType() + " is not supported on this endpoint", Field: "type", ID: m.RequestID()})
 	}
 }
 
-func (c *BaseWebSocketConsumer) handleSubscribe(data map[string]interface{}) {
-	eventTypes, ok := data["event_types"].([]interface{})
-	if !ok || len(eventTypes) == 0 {
-		c.sendError("No event types specified")
-		return
-	}
-
+func (c *BaseWebSocketConsumer) handleSubscribe(m *wsproto.Subscribe) {
 	manager := GetManager()
-	eventTypeStrings := make([]string, 0, len(eventTypes))
-
-	for _, eventType := range eventTypes {
-		if eventTypeStr, ok := eventType.(string); ok {
-			manager.RegisterEventHandler(eventTypeStr, c.handleEventCallback)
-			eventTypeStrings = append(eventTypeStrings, eventTypeStr)
-		}
+	for _, eventType := range m.EventTypes {
+		manager.RegisterEventHandler(eventType, c.handleEventCallback)
 	}
 
-	subscribedMsg := map[string]interface{}{
+	c.send(reply(m.ID, map[string]interface{}{
 		"type":        "subscribed",
-		"event_types": eventTypeStrings,
-	}
-	msgBytes, err := json.Marshal(subscribedMsg)
-	if err == nil {
-		c.Send <- msgBytes
-	}
+		"event_types": m.EventTypes,
+	}))
 }
 
-func (c *BaseWebSocketConsumer) handleUnsubscribe(data map[string]interface{}) {
-	eventTypes, ok := data["event_types"].([]interface{})
-	if !ok || len(eventTypes) == 0 {
-		c.sendError("No event types specified")
-		return
-	}
-
+func (c *BaseWebSocketConsumer) handleUnsubscribe(m *wsproto.Unsubscribe) {
 	manager := GetManager()
-	eventTypeStrings := make([]string, 0, len(eventTypes))
-
-	for _, eventType := range eventTypes {
-		if eventTypeStr, ok := eventType.(string); ok {
-			manager.UnregisterEventHandler(eventTypeStr, c.handleEventCallback)
-			eventTypeStrings = append(eventTypeStrings, eventTypeStr)
-		}
+	for _, eventType := range m.EventTypes {
+		manager.UnregisterEventHandler(eventType, c.handleEventCallback)
 	}
 
-	unsubscribedMsg := map[string]interface{}{
+	c.send(reply(m.ID, map[string]interface{}{
 		"type":        "unsubscribed",
-		"event_types": eventTypeStrings,
-	}
-	msgBytes, err := json.Marshal(unsubscribedMsg)
-	if err == nil {
-		c.Send <- msgBytes
-	}
+		"event_types": m.EventTypes,
+	}))
 }
 
-func (c *BaseWebSocketConsumer) handleEvent(data map[string]interface{}) {
-	eventType, ok := data["event_type"].(string)
-	if !ok || eventType == "" {
-		c.sendError("No event type specified")
-		return
-	}
-
-	eventData, _ := data["data"].(map[string]interface{})
+func (c *BaseWebSocketConsumer) handleEvent(m *wsproto.Event) {
+	eventData := m.Data
 	if eventData == nil {
 		eventData = make(map[string]interface{})
 	}
 
 	manager := GetManager()
-	err := manager.SendEvent(eventType, eventData)
+	err := manager.SendEvent(m.EventType, eventData)
 	if err != nil {
-		c.sendError("Failed to send event: " + err.Error())
+		c.sendError(&wsproto.Error{Code: wsproto.CodeInternal, Message: "Failed to send event: " + err.Error(), ID: m.ID})
 		return
 	}
 
-	eventSentMsg := map[string]interface{}{
+	c.send(reply(m.ID, map[string]interface{}{
 		"type":       "event_sent",
-		"event_type": eventType,
-	}
-	msgBytes, err := json.Marshal(eventSentMsg)
-	if err == nil {
-		c.Send <- msgBytes
-	}
+		"event_type": m.EventType,
+	}))
 }
 
 func (c *BaseWebSocketConsumer) handleEventCallback(event map[string]interface{}) error {
@@ -267,15 +257,47 @@ func (c *BaseWebSocketConsumer) handleEventCallback(event map[string]interface{}
 	return nil
 }
 
-func (c *BaseWebSocketConsumer) sendError(message string) {
-	errorMsg := map[string]interface{}{
-		"type":    "error",
-		"message": message,
+func (c *BaseWebSocketConsumer) send(message interface{}) {
+	msgBytes, err := json.Marshal(message)
+	if err != nil {
+		consumerLogger.Printf("Error marshaling message for consumer %s: %v", c.ConsumerID, err)
+		return
+	}
+	c.Send <- msgBytes
+}
+
+func (c *BaseWebSocketConsumer) sendError(err *wsproto.Error) {
+	c.send(err.Frame())
+}
+
+// sendLater is send for messages produced after the frame was handled, when
+// the consumer may have been closed in the meantime. Messages for closed or
+// backed up consumers are dropped.
+func (c *BaseWebSocketConsumer) sendLater(message interface{}) {
+	msgBytes, err := json.Marshal(message)
+	if err != nil {
+		consumerLogger.Printf("Error marshaling message for consumer %s: %v", c.ConsumerID, err)
+		return
+	}
+
+	c.ClosedMutex.Lock()
+	defer c.ClosedMutex.Unlock()
+	if c.Closed {
+		return
+	}
+	select {
+	case c.Send <- msgBytes:
+	default:
+		consumerLogger.Printf("Dropping message for consumer %s, its send buffer is full", c.ConsumerID)
 	}
-	msgBytes, err := json.Marshal(errorMsg)
-	if err == nil {
-		c.Send <- msgBytes
+}
+
+// reply adds the id of the frame being answered to message.
+func reply(id string, message map[string]interface{}) map[string]interface{} {
+	if id != "" {
+		message["id"] = id
 	}
+	return message
 }
 
 type AgentWebSocketConsumer struct {
@@ -283,78 +305,209 @@ type AgentWebSocketConsumer struct {
 }
 
 func NewAgentWebSocketConsumer(conn *websocket.Conn) *AgentWebSocketConsumer {
-	base := NewBaseWebSocketConsumer(conn)
+	base := newBaseWebSocketConsumer(conn, agentEndpoint)
 	consumer := &AgentWebSocketConsumer{
 		BaseWebSocketConsumer: base,
 	}
+	base.handle = consumer.handleMessage
 
 	consumer.Groups = append(consumer.Groups, "agent")
 
 	manager := GetManager()
 	manager.RegisterConsumer(consumer.ConsumerID, consumer, consumer.Groups)
 
+	base.start()
 	return consumer
 }
 
-func (c *AgentWebSocketConsumer) handleMessage(message []byte) {
-	var data map[string]interface{}
-	if err := json.Unmarshal(message, &data); err != nil {
-		consumerLogger.Printf("Failed to decode JSON message: %v", err)
-		c.sendError("Invalid JSON")
-		return
-	}
-
-	messageType, ok := data["type"].(string)
-	if !ok {
-		consumerLogger.Printf("Message missing 'type' field")
-		c.sendError("Missing message type")
-		return
-	}
-
-	if messageType == "agent_command" {
-		c.handleAgentCommand(data)
-	} else {
-		c.BaseWebSocketConsumer.handleMessage(message)
+func (c *AgentWebSocketConsumer) handleMessage(message wsproto.Message) bool {
+	switch m := message.(type) {
+	case *wsproto.AgentCommand:
+		c.handleAgentCommand(m)
+	case *wsproto.ApproveCommand:
+		c.handleApproveCommand(m)
+	default:
+		return false
 	}
+	return true
 }
 
-func (c *AgentWebSocketConsumer) handleAgentCommand(data map[string]interface{}) {
-	command, ok := data["command"].(string)
-	if !ok || command == "" {
-		c.sendError("No command specified")
+func (c *AgentWebSocketConsumer) handleAgentCommand(m *wsproto.AgentCommand) {
+	if reason, allowed := c.authorize(rbac.ActionInterpreterExecute, m.WorkspaceID); !allowed {
+		c.sendError(&wsproto.Error{Code: wsproto.CodePermissionDenied, Message: "Permission denied: " + reason, ID: m.ID})
 		return
 	}
 
-	commandData, _ := data["data"].(map[string]interface{})
+	commandData := m.Data
 	if commandData == nil {
 		commandData = make(map[string]interface{})
 	}
 
 	commandDataJSON, err := json.Marshal(commandData)
 	if err != nil {
-		c.sendError("Failed to marshal command data: " + err.Error())
+		c.sendError(&wsproto.Error{Code: wsproto.CodeInvalidField, Message: "Failed to marshal command data: " + err.Error(), Field: "data", ID: m.ID})
+		return
+	}
+
+	if m.WorkspaceID != "" {
+		c.executeAgentCommand(m, commandDataJSON)
 		return
 	}
 
 	manager := GetManager()
 	err = manager.SendEvent("agent_command", map[string]interface{}{
-		"command":     command,
+		"command":     m.Command,
 		"data":        string(commandDataJSON),
 		"consumer_id": c.ConsumerID,
 	})
 	if err != nil {
-		c.sendError("Failed to send agent command: " + err.Error())
+		c.sendError(&wsproto.Error{Code: wsproto.CodeInternal, Message: "Failed to send agent command: " + err.Error(), ID: m.ID})
 		return
 	}
 
-	commandSentMsg := map[string]interface{}{
+	c.send(reply(m.ID, map[string]interface{}{
 		"type":    "command_sent",
-		"command": command,
+		"command": m.Command,
+	}))
+}
+
+// executeAgentCommand sends the command to the agent of the workspace and
+// answers with a command_result once the agent reports back. Params may set
+// timeout_seconds to bound the whole command. Exec commands blocked by the
+// tool policy wait for a human's approval first, if the policy asks for one.
+//
+// Exec commands with stream_output set in params send their output in
+// command_output messages while they run, and return only a preview with
+// the result. Messages a slow client can't take are dropped; the whole
+// output is kept under the output_id to be fetched from the API.
+func (c *AgentWebSocketConsumer) executeAgentCommand(m *wsproto.AgentCommand, params json.RawMessage) {
+	opts := agentcmd.Options{}
+	if timeout, ok := m.Params["timeout_seconds"].(float64); ok && timeout > 0 {
+		opts.Timeout = time.Duration(timeout * float64(time.Second))
+	}
+
+	sent := reply(m.ID, map[string]interface{}{
+		"type":         "command_sent",
+		"command":      m.Command,
+		"workspace_id": m.WorkspaceID,
+	})
+	var output *outputs.Output
+	if streamOutput, _ := m.Params["stream_output"].(bool); streamOutput {
+		store := outputs.DefaultStore()
+		streamed, err := streamingParams(params, store.Config().PreviewBytes)
+		if err != nil {
+			c.sendError(&wsproto.Error{Code: wsproto.CodeInvalidField, Message: "Failed to stream the output: " + err.Error(), Field: "data", ID: m.ID})
+			return
+		}
+		params = streamed
+		output = store.Create(m.WorkspaceID)
+		opts.Output = func(chunk agentcmd.Chunk) {
+			if err := output.Write(chunk.Stream, chunk.Offset, chunk.Data); err != nil {
+				consumerLogger.Printf("Error keeping output %s: %v", output.ID, err)
+			}
+			c.sendLater(reply(m.ID, map[string]interface{}{
+				"type":      "command_output",
+				"output_id": output.ID,
+				"stream":    chunk.Stream,
+				"offset":    chunk.Offset,
+				"data":      string(chunk.Data),
+			}))
+		}
+		sent["output_id"] = output.ID
 	}
-	msgBytes, err := json.Marshal(commandSentMsg)
-	if err == nil {
-		c.Send <- msgBytes
+	c.send(sent)
+
+	go func() {
+		var result *agentcmd.Result
+		err := checkToolPolicy(context.Background(), m.WorkspaceID, core.GetUserID(c.User), m.Command, params)
+		if err == nil {
+			result, err = agentcmd.Default().Execute(context.Background(), m.WorkspaceID, m.Command, params, opts)
+		}
+		emitAgentCommandWebhook(m.WorkspaceID, m.Command, result, err)
+		if output != nil {
+			output.Finish()
+		}
+		if err != nil {
+			c.sendLater(reply(m.ID, map[string]interface{}{
+				"type":    "command_result",
+				"command": m.Command,
+				"success": false,
+				"error":   err.Error(),
+			}))
+			return
+		}
+
+		message := reply(m.ID, map[string]interface{}{
+			"type":       "command_result",
+			"command":    m.Command,
+			"command_id": result.CommandID,
+			"success":    result.Success,
+			"output":     result.Output,
+			"error":      result.Error,
+			"attempts":   result.Attempts,
+		})
+		if output != nil {
+			message["output_id"] = output.ID
+		}
+		c.sendLater(message)
+	}()
+}
+
+// emitAgentCommandWebhook notifies the webhooks of the workspace's
+// organization that an agent command finished.
+func emitAgentCommandWebhook(workspaceID, command string, result *agentcmd.Result, err error) {
+	ctx := context.Background()
+	workspace, lookupErr := middleware.LookupWorkspace(ctx, "workspace", workspaceID)
+	if lookupErr != nil {
+		consumerLogger.Printf("Error looking up workspace %s for webhooks: %v", workspaceID, lookupErr)
+		return
 	}
+
+	eventType := webhooks.AgentCommandCompleted
+	data := map[string]interface{}{"workspace_id": workspaceID, "command": command}
+	if err != nil {
+		eventType = webhooks.AgentCommandFailed
+		data["error"] = err.Error()
+	} else {
+		data["command_id"] = result.CommandID
+		data["success"] = result.Success
+		data["attempts"] = result.Attempts
+		if !result.Success {
+			eventType = webhooks.AgentCommandFailed
+			data["error"] = result.Error
+		}
+	}
+
+	event, err := webhooks.NewEvent(eventType, workspace.OrganizationID, data)
+	if err != nil {
+		consumerLogger.Printf("Error creating %s webhook event: %v", eventType, err)
+		return
+	}
+	webhooks.Emit(ctx, event)
+}
+
+// authorize checks action against the consumer's user. Commands that name a
+// workspace are checked against that workspace's owner.
+func (c *BaseWebSocketConsumer) authorize(action rbac.Action, workspaceID string) (string, bool) {
+	subject, err := middleware.SubjectFromUser(c.User)
+	if c.claims != nil {
+		subject, err = middleware.SubjectFromClaims(c.claims)
+	}
+	if err != nil {
+		consumerLogger.Printf("Error resolving roles for consumer %s: %v", c.ConsumerID, err)
+		return "could not resolve roles", false
+	}
+
+	resource := rbac.Resource{Type: "interpreter"}
+	if workspaceID != "" {
+		resource, err = middleware.LookupWorkspace(context.Background(), "workspace", workspaceID)
+		if err != nil {
+			return err.Error(), false
+		}
+	}
+
+	decision := rbac.DefaultEngine().Authorize(subject, action, resource)
+	return decision.Reason, decision.Allowed
 }
 
 type MLWebSocketConsumer struct {
@@ -362,78 +515,63 @@ type MLWebSocketConsumer struct {
 }
 
 func NewMLWebSocketConsumer(conn *websocket.Conn) *MLWebSocketConsumer {
-	base := NewBaseWebSocketConsumer(conn)
+	base := newBaseWebSocketConsumer(conn, mlEndpoint)
 	consumer := &MLWebSocketConsumer{
 		BaseWebSocketConsumer: base,
 	}
+	base.handle = consumer.handleMessage
 
 	consumer.Groups = append(consumer.Groups, "ml")
 
 	manager := GetManager()
 	manager.RegisterConsumer(consumer.ConsumerID, consumer, consumer.Groups)
 
+	base.start()
 	return consumer
 }
 
-func (c *MLWebSocketConsumer) handleMessage(message []byte) {
-	var data map[string]interface{}
-	if err := json.Unmarshal(message, &data); err != nil {
-		consumerLogger.Printf("Failed to decode JSON message: %v", err)
-		c.sendError("Invalid JSON")
-		return
-	}
-
-	messageType, ok := data["type"].(string)
+func (c *MLWebSocketConsumer) handleMessage(message wsproto.Message) bool {
+	command, ok := message.(*wsproto.MLCommand)
 	if !ok {
-		consumerLogger.Printf("Message missing 'type' field")
-		c.sendError("Missing message type")
-		return
+		return false
 	}
 
-	if messageType == "ml_command" {
-		c.handleMLCommand(data)
-	} else {
-		c.BaseWebSocketConsumer.handleMessage(message)
-	}
+	c.handleMLCommand(command)
+	return true
 }
 
-func (c *MLWebSocketConsumer) handleMLCommand(data map[string]interface{}) {
-	command, ok := data["command"].(string)
-	if !ok || command == "" {
-		c.sendError("No command specified")
-		return
-	}
-
-	commandData, _ := data["data"].(map[string]interface{})
+func (c *MLWebSocketConsumer) handleMLCommand(m *wsproto.MLCommand) {
+	commandData := m.Data
 	if commandData == nil {
 		commandData = make(map[string]interface{})
 	}
 
 	commandDataJSON, err := json.Marshal(commandData)
 	if err != nil {
-		c.sendError("Failed to marshal command data: " + err.Error())
+		c.sendError(&wsproto.Error{Code: wsproto.CodeInvalidField, Message: "Failed to marshal command data: " + err.Error(), Field: "data", ID: m.ID})
+		return
+	}
+
+	if m.WorkspaceID != "" {
+		c.executeAgentCommand(m, commandDataJSON)
 		return
 	}
 
 	manager := GetManager()
 	err = manager.SendEvent("ml_command", map[string]interface{}{
-		"command":     command,
+		"command":     m.Command,
 		"data":        string(commandDataJSON),
 		"consumer_id": c.ConsumerID,
 	})
 	if err != nil {
-		c.sendError("Failed to send ML command: " + err.Error())
+		c.sendError(&wsproto.Error{Code: wsproto.CodeInternal, Message: "Failed to send ML command: " + err.Error(), ID: m.ID})
 		return
 	}
 
-	commandSentMsg := map[string]interface{}{
+	c.send(reply(m.ID, map[string]interface{}{
 		"type":    "command_sent",
-		"command": command,
-	}
-	msgBytes, err := json.Marshal(commandSentMsg)
-	if err == nil {
-		c.Send <- msgBytes
-	}
+		"command": m.Command,
+	}))
 }
 
 func GetManager() *WebSocketManager {
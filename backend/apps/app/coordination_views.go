@@ -0,0 +1,307 @@
+package app
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/spectrumwebco/agent_runtime/backend/core/audit"
+	"github.com/spectrumwebco/agent_runtime/backend/core/coordination"
+	"github.com/spectrumwebco/agent_runtime/backend/db/integrations"
+	"github.com/spectrumwebco/agent_runtime/pkg/djangogo/core"
+)
+
+// maxClaimWait bounds how long claiming a task holds the request open.
+const maxClaimWait = 30 * time.Second
+
+var (
+	scratchpad  *coordination.Scratchpad
+	taskQueue   *coordination.TaskQueue
+	editTracker *coordination.EditTracker
+)
+
+type lockEntryRequest struct {
+	Holder     string `json:"holder" openapi:"required"`
+	TTLSeconds int    `json:"ttl_seconds"`
+}
+
+type setEntryRequest struct {
+	Value string `json:"value" openapi:"required"`
+	// Token is the token of the entry's lock.
+	Token string `json:"token" openapi:"required"`
+}
+
+type unlockEntryRequest struct {
+	Token string `json:"token" openapi:"required"`
+}
+
+type enqueueTaskRequest struct {
+	Type       string            `json:"type" openapi:"required"`
+	Payload    map[string]string `json:"payload"`
+	EnqueuedBy string            `json:"enqueued_by"`
+}
+
+type claimTaskRequest struct {
+	Agent string `json:"agent" openapi:"required"`
+	// WaitSeconds is how long to wait for a task, at most 30.
+	WaitSeconds int `json:"wait_seconds"`
+}
+
+// coordinationError is 409 for held locks and conflicting edits, 403 for
+// writes without the lock, 404 for unknown tasks and 500 otherwise.
+func coordinationError(w http.ResponseWriter, err error) {
+	var (
+		locked   *coordination.LockedError
+		conflict *coordination.ConflictError
+	)
+	status := http.StatusInternalServerError
+	switch {
+	case errors.As(err, &locked):
+		core.JSONResponse(w, map[string]interface{}{"status": "error", "message": err.Error(), "holder": locked.Holder}, http.StatusConflict)
+		return
+	case errors.As(err, &conflict):
+		core.JSONResponse(w, map[string]interface{}{"status": "error", "message": err.Error(), "current": conflict.Current}, http.StatusConflict)
+		return
+	case errors.Is(err, coordination.ErrNotLockHolder):
+		status = http.StatusForbidden
+	case errors.Is(err, coordination.ErrTaskNotFound):
+		status = http.StatusNotFound
+	}
+	core.JSONResponse(w, map[string]interface{}{"status": "error", "message": err.Error()}, status)
+}
+
+// coordinationWorkspace returns the workspace of the request if it belongs to
+// the caller's organization.
+func coordinationWorkspace(w http.ResponseWriter, r *http.Request) (string, bool) {
+	workspaceID := mux.Vars(r)["workspace_id"]
+	if err := checkWorkspace(r.Context(), workspaceID); err != nil {
+		core.JSONResponse(w, map[string]interface{}{"status": "error", "message": err.Error()}, http.StatusNotFound)
+		return "", false
+	}
+	return workspaceID, true
+}
+
+// decodeCoordinationRequest decodes the body into request and checks the
+// names passed in it.
+func decodeCoordinationRequest(w http.ResponseWriter, r *http.Request, request interface{}, names map[string]*string) bool {
+	if err := json.NewDecoder(r.Body).Decode(request); err != nil {
+		core.JSONResponse(w, map[string]interface{}{"status": "error", "message": fmt.Sprintf("invalid request body: %v", err)}, http.StatusBadRequest)
+		return false
+	}
+	for kind, name := range names {
+		if err := coordination.ValidateName(kind, *name); err != nil {
+			core.JSONResponse(w, map[string]interface{}{"status": "error", "message": err.Error()}, http.StatusBadRequest)
+			return false
+		}
+	}
+	return true
+}
+
+// ScratchpadEntries returns the scratchpad of a workspace.
+func ScratchpadEntries(w http.ResponseWriter, r *http.Request) {
+	workspaceID, ok := coordinationWorkspace(w, r)
+	if !ok {
+		return
+	}
+	entries, err := scratchpad.Entries(r.Context(), workspaceID)
+	if err != nil {
+		coordinationError(w, err)
+		return
+	}
+	core.JSONResponse(w, map[string]interface{}{"status": "success", "entries": entries}, http.StatusOK)
+}
+
+// SetScratchpadEntry writes a scratchpad entry whose lock the caller holds.
+func SetScratchpadEntry(w http.ResponseWriter, r *http.Request) {
+	workspaceID, ok := coordinationWorkspace(w, r)
+	if !ok {
+		return
+	}
+	key := mux.Vars(r)["key"]
+	var request setEntryRequest
+	if !decodeCoordinationRequest(w, r, &request, map[string]*string{"key": &key}) {
+		return
+	}
+
+	if err := scratchpad.Set(r.Context(), workspaceID, key, request.Value, request.Token); err != nil {
+		coordinationError(w, err)
+		return
+	}
+	core.JSONResponse(w, map[string]interface{}{"status": "success"}, http.StatusOK)
+}
+
+// LockScratchpadEntry locks a scratchpad entry for an agent.
+func LockScratchpadEntry(w http.ResponseWriter, r *http.Request) {
+	workspaceID, ok := coordinationWorkspace(w, r)
+	if !ok {
+		return
+	}
+	key := mux.Vars(r)["key"]
+	var request lockEntryRequest
+	if !decodeCoordinationRequest(w, r, &request, map[string]*string{"key": &key, "holder": &request.Holder}) {
+		return
+	}
+
+	lock, err := scratchpad.Lock(r.Context(), workspaceID, key, request.Holder, time.Duration(request.TTLSeconds)*time.Second)
+	if err != nil {
+		coordinationError(w, err)
+		return
+	}
+	core.JSONResponse(w, map[string]interface{}{"status": "success", "lock": lock}, http.StatusOK)
+}
+
+// UnlockScratchpadEntry releases the lock of a scratchpad entry.
+func UnlockScratchpadEntry(w http.ResponseWriter, r *http.Request) {
+	workspaceID, ok := coordinationWorkspace(w, r)
+	if !ok {
+		return
+	}
+	key := mux.Vars(r)["key"]
+	var request unlockEntryRequest
+	if !decodeCoordinationRequest(w, r, &request, map[string]*string{"key": &key}) {
+		return
+	}
+
+	if err := scratchpad.Unlock(r.Context(), workspaceID, key, request.Token); err != nil {
+		coordinationError(w, err)
+		return
+	}
+	core.JSONResponse(w, map[string]interface{}{"status": "success"}, http.StatusOK)
+}
+
+// ClaimedTasks returns the tasks of a workspace that are claimed and not
+// acknowledged yet.
+func ClaimedTasks(w http.ResponseWriter, r *http.Request) {
+	workspaceID, ok := coordinationWorkspace(w, r)
+	if !ok {
+		return
+	}
+	claimed, err := taskQueue.Claimed(r.Context(), workspaceID)
+	if err != nil {
+		coordinationError(w, err)
+		return
+	}
+	core.JSONResponse(w, map[string]interface{}{"status": "success", "tasks": claimed}, http.StatusOK)
+}
+
+// EnqueueTask queues a task for the agents of a workspace.
+func EnqueueTask(w http.ResponseWriter, r *http.Request) {
+	workspaceID, ok := coordinationWorkspace(w, r)
+	if !ok {
+		return
+	}
+	var request enqueueTaskRequest
+	if !decodeCoordinationRequest(w, r, &request, nil) {
+		return
+	}
+
+	task, err := taskQueue.Enqueue(r.Context(), workspaceID, coordination.Task{
+		Type:       request.Type,
+		Payload:    request.Payload,
+		EnqueuedBy: request.EnqueuedBy,
+	})
+	if err != nil {
+		core.JSONResponse(w, map[string]interface{}{"status": "error", "message": err.Error()}, http.StatusBadRequest)
+		return
+	}
+
+	recorder := audit.FromContext(r.Context())
+	recorder.SetResource("workspace", workspaceID)
+	recorder.AddMetadata("task_id", task.ID)
+	recorder.AddMetadata("task_type", task.Type)
+
+	core.JSONResponse(w, map[string]interface{}{"status": "success", "task": task}, http.StatusCreated)
+}
+
+// ClaimTask hands the next task of a workspace to an agent. The task is null
+// if none arrived within wait_seconds.
+func ClaimTask(w http.ResponseWriter, r *http.Request) {
+	workspaceID, ok := coordinationWorkspace(w, r)
+	if !ok {
+		return
+	}
+	var request claimTaskRequest
+	if !decodeCoordinationRequest(w, r, &request, map[string]*string{"agent": &request.Agent}) {
+		return
+	}
+
+	wait := time.Duration(request.WaitSeconds) * time.Second
+	if wait > maxClaimWait {
+		wait = maxClaimWait
+	}
+	task, err := taskQueue.Claim(r.Context(), workspaceID, request.Agent, wait)
+	if err != nil {
+		coordinationError(w, err)
+		return
+	}
+	core.JSONResponse(w, map[string]interface{}{"status": "success", "task": task}, http.StatusOK)
+}
+
+// AckTask marks a claimed task as done.
+func AckTask(w http.ResponseWriter, r *http.Request) {
+	workspaceID, ok := coordinationWorkspace(w, r)
+	if !ok {
+		return
+	}
+	if err := taskQueue.Ack(r.Context(), workspaceID, mux.Vars(r)["task_id"]); err != nil {
+		coordinationError(w, err)
+		return
+	}
+	core.JSONResponse(w, map[string]interface{}{"status": "success"}, http.StatusOK)
+}
+
+// WorkspaceEdits returns the recorded file versions of a workspace, or
+// records an edit, rejecting edits based on an outdated version with 409.
+func WorkspaceEdits(w http.ResponseWriter, r *http.Request) {
+	workspaceID, ok := coordinationWorkspace(w, r)
+	if !ok {
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		versions, err := editTracker.Versions(r.Context(), workspaceID)
+		if err != nil {
+			coordinationError(w, err)
+			return
+		}
+		core.JSONResponse(w, map[string]interface{}{"status": "success", "files": versions}, http.StatusOK)
+
+	case http.MethodPost:
+		var edit coordination.Edit
+		if !decodeCoordinationRequest(w, r, &edit, map[string]*string{"agent": &edit.Agent}) {
+			return
+		}
+		if edit.Path == "" || edit.Hash == "" {
+			core.JSONResponse(w, map[string]interface{}{"status": "error", "message": "path and hash are required"}, http.StatusBadRequest)
+			return
+		}
+		version, err := editTracker.Record(r.Context(), workspaceID, edit)
+		if err != nil {
+			coordinationError(w, err)
+			return
+		}
+		core.JSONResponse(w, map[string]interface{}{"status": "success", "version": version}, http.StatusOK)
+	}
+}
+
+func init() {
+	kv := integrations.GetKVStore()
+	locker := integrations.GetLocker()
+	scratchpad = coordination.NewScratchpad(kv, locker)
+	taskQueue = coordination.NewTaskQueue(integrations.GetStreamStore(), coordination.DefaultVisibilityTimeout)
+	editTracker = coordination.NewEditTracker(kv, locker)
+
+	registerAPIView("scratchpad_entries", ScratchpadEntries, []string{"GET"}, []string{"HasAPIKey"})
+	registerAPIView("set_scratchpad_entry", SetScratchpadEntry, []string{"PUT"}, []string{"HasAPIKey"})
+	registerAPIView("lock_scratchpad_entry", LockScratchpadEntry, []string{"POST"}, []string{"HasAPIKey"})
+	registerAPIView("unlock_scratchpad_entry", UnlockScratchpadEntry, []string{"POST"}, []string{"HasAPIKey"})
+	registerAPIView("claimed_tasks", ClaimedTasks, []string{"GET"}, []string{"HasAPIKey"})
+	registerAPIView("enqueue_task", EnqueueTask, []string{"POST"}, []string{"HasAPIKey"})
+	registerAPIView("claim_task", ClaimTask, []string{"POST"}, []string{"HasAPIKey"})
+	registerAPIView("ack_task", AckTask, []string{"POST"}, []string{"HasAPIKey"})
+	registerAPIView("workspace_edits", WorkspaceEdits, []string{"GET", "POST"}, []string{"HasAPIKey"})
+}
@@ -0,0 +1,200 @@
+package app
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"github.com/spectrumwebco/agent_runtime/backend/core/audit"
+	"github.com/spectrumwebco/agent_runtime/backend/core/kerrors"
+	"github.com/spectrumwebco/agent_runtime/backend/db/integrations"
+	"github.com/spectrumwebco/agent_runtime/pkg/djangogo/core"
+)
+
+var (
+	dorisViews  *integrations.DorisViews
+	dorisRouter *integrations.DorisRouter
+)
+
+type refreshMaterializedViewRequest struct {
+	Partitions []string `json:"partitions,omitempty"`
+	// Complete rebuilds the whole view instead of the stale partitions.
+	Complete bool `json:"complete,omitempty"`
+}
+
+type routeDorisQueryRequest struct {
+	Table   string   `json:"table" openapi:"required"`
+	Columns []string `json:"columns" openapi:"required"`
+}
+
+// decodeDorisRequest decodes the body of a request into v or writes 400.
+func decodeDorisRequest(w http.ResponseWriter, r *http.Request, v interface{}) bool {
+	if err := json.NewDecoder(r.Body).Decode(v); err != nil {
+		kerrors.WriteJSON(w, kerrors.Errorf(kerrors.InvalidArgument, "invalid request body: %v", err))
+		return false
+	}
+	return true
+}
+
+// MaterializedViews lists the materialized views of the analytics database
+// with their state, or creates one.
+func MaterializedViews(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodGet {
+		views, err := dorisViews.MaterializedViews(r.Context())
+		if err != nil {
+			kerrors.WriteJSON(w, err)
+			return
+		}
+		core.JSONResponse(w, map[string]interface{}{"status": "success", "materialized_views": views}, http.StatusOK)
+		return
+	}
+
+	var view integrations.DorisMaterializedView
+	if !decodeDorisRequest(w, r, &view) {
+		return
+	}
+	audit.FromContext(r.Context()).SetResource("materialized_view", view.Name)
+	if err := dorisViews.CreateMaterializedView(r.Context(), view); err != nil {
+		kerrors.WriteJSON(w, err)
+		return
+	}
+	dorisRouter.Reset()
+	core.JSONResponse(w, map[string]interface{}{"status": "success", "materialized_view": view}, http.StatusCreated)
+}
+
+// MaterializedView shows the state and last refresh of a materialized view,
+// changes its refresh or properties, or drops it.
+func MaterializedView(w http.ResponseWriter, r *http.Request) {
+	name := mux.Vars(r)["name"]
+	audit.FromContext(r.Context()).SetResource("materialized_view", name)
+
+	switch r.Method {
+	case http.MethodGet:
+		status, err := dorisViews.MaterializedViewStatus(r.Context(), name)
+		if err != nil {
+			kerrors.WriteJSON(w, err)
+			return
+		}
+		core.JSONResponse(w, map[string]interface{}{"status": "success", "materialized_view": status}, http.StatusOK)
+
+	case http.MethodPatch:
+		var change integrations.DorisViewChange
+		if !decodeDorisRequest(w, r, &change) {
+			return
+		}
+		if err := dorisViews.AlterMaterializedView(r.Context(), name, change); err != nil {
+			kerrors.WriteJSON(w, err)
+			return
+		}
+		dorisRouter.Reset()
+		core.JSONResponse(w, map[string]interface{}{"status": "success"}, http.StatusOK)
+
+	case http.MethodDelete:
+		if err := dorisViews.DropMaterializedView(r.Context(), name); err != nil {
+			kerrors.WriteJSON(w, err)
+			return
+		}
+		dorisRouter.Reset()
+		core.JSONResponse(w, map[string]interface{}{"status": "success"}, http.StatusOK)
+	}
+}
+
+// RefreshMaterializedView starts a refresh of a materialized view. Its
+// progress shows in the last refresh of the view.
+func RefreshMaterializedView(w http.ResponseWriter, r *http.Request) {
+	name := mux.Vars(r)["name"]
+	var request refreshMaterializedViewRequest
+	if r.ContentLength != 0 && !decodeDorisRequest(w, r, &request) {
+		return
+	}
+	recorder := audit.FromContext(r.Context())
+	recorder.SetResource("materialized_view", name)
+	recorder.AddMetadata("complete", request.Complete)
+
+	if err := dorisViews.RefreshMaterializedView(r.Context(), name, request.Partitions, request.Complete); err != nil {
+		kerrors.WriteJSON(w, err)
+		return
+	}
+	core.JSONResponse(w, map[string]interface{}{"status": "success"}, http.StatusAccepted)
+}
+
+// TableRollups lists the rollups of a table with their build jobs, or adds
+// one. Rollups are built in the background; the job shows their progress.
+func TableRollups(w http.ResponseWriter, r *http.Request) {
+	table := mux.Vars(r)["table"]
+
+	if r.Method == http.MethodGet {
+		rollups, err := dorisViews.Rollups(r.Context(), table)
+		if err != nil {
+			kerrors.WriteJSON(w, err)
+			return
+		}
+		jobs, err := dorisViews.RollupJobs(r.Context(), table)
+		if err != nil {
+			kerrors.WriteJSON(w, err)
+			return
+		}
+		core.JSONResponse(w, map[string]interface{}{"status": "success", "rollups": rollups, "jobs": jobs}, http.StatusOK)
+		return
+	}
+
+	var rollup integrations.DorisRollup
+	if !decodeDorisRequest(w, r, &rollup) {
+		return
+	}
+	recorder := audit.FromContext(r.Context())
+	recorder.SetResource("rollup", table+"."+rollup.Name)
+	recorder.AddMetadata("columns", strings.Join(rollup.Columns, ","))
+	if err := dorisViews.CreateRollup(r.Context(), table, rollup); err != nil {
+		kerrors.WriteJSON(w, err)
+		return
+	}
+	dorisRouter.Invalidate(table)
+	core.JSONResponse(w, map[string]interface{}{"status": "success", "rollup": rollup}, http.StatusAccepted)
+}
+
+// DropTableRollup drops a rollup of a table.
+func DropTableRollup(w http.ResponseWriter, r *http.Request) {
+	table, name := mux.Vars(r)["table"], mux.Vars(r)["name"]
+	audit.FromContext(r.Context()).SetResource("rollup", table+"."+name)
+	if err := dorisViews.DropRollup(r.Context(), table, name); err != nil {
+		kerrors.WriteJSON(w, err)
+		return
+	}
+	dorisRouter.Invalidate(table)
+	core.JSONResponse(w, map[string]interface{}{"status": "success"}, http.StatusOK)
+}
+
+// RouteDorisQuery returns the materialized view or rollup a query over a
+// table reading the given columns is best run against.
+func RouteDorisQuery(w http.ResponseWriter, r *http.Request) {
+	var request routeDorisQueryRequest
+	if !decodeDorisRequest(w, r, &request) {
+		return
+	}
+	if request.Table == "" || len(request.Columns) == 0 {
+		kerrors.WriteJSON(w, kerrors.New(kerrors.InvalidArgument, "table and columns are required"))
+		return
+	}
+	route, err := dorisRouter.Route(r.Context(), request.Table, request.Columns)
+	if err != nil {
+		kerrors.WriteJSON(w, err)
+		return
+	}
+	core.JSONResponse(w, map[string]interface{}{"status": "success", "route": route}, http.StatusOK)
+}
+
+func init() {
+	dorisViews = integrations.NewDorisViews(integrations.GetDorisStore(""))
+	dorisRouter = integrations.NewDorisRouter(dorisViews, time.Minute)
+
+	registerAPIView("materialized_views", MaterializedViews, []string{"GET", "POST"}, []string{"IsAdminUser"})
+	registerAPIView("materialized_view", MaterializedView, []string{"GET", "PATCH", "DELETE"}, []string{"IsAdminUser"})
+	registerAPIView("refresh_materialized_view", RefreshMaterializedView, []string{"POST"}, []string{"IsAdminUser"})
+	registerAPIView("table_rollups", TableRollups, []string{"GET", "POST"}, []string{"IsAdminUser"})
+	registerAPIView("drop_table_rollup", DropTableRollup, []string{"DELETE"}, []string{"IsAdminUser"})
+	registerAPIView("route_doris_query", RouteDorisQuery, []string{"POST"}, []string{"IsAdminUser"})
+}
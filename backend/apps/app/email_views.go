@@ -0,0 +1,73 @@
+package app
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/spectrumwebco/agent_runtime/backend/core/audit"
+	"github.com/spectrumwebco/agent_runtime/backend/core/email"
+	"github.com/spectrumwebco/agent_runtime/backend/db/integrations"
+	"github.com/spectrumwebco/agent_runtime/pkg/djangogo/core"
+)
+
+var emailNotifier *email.Notifier
+
+type emailPreferencesRequest struct {
+	Notifications *bool `json:"notifications"`
+	Digest        *bool `json:"digest"`
+}
+
+// EmailPreferences reads or updates whether the caller receives notification
+// emails and the daily digest. Fields left out of an update keep their value.
+func EmailPreferences(w http.ResponseWriter, r *http.Request) {
+	user := core.GetUserFromRequest(r)
+	if user == nil || !user.IsAuthenticated() {
+		core.JSONResponse(w, map[string]interface{}{"status": "error", "message": "authentication required"}, http.StatusUnauthorized)
+		return
+	}
+	userID := fmt.Sprint(user.GetID())
+
+	preferences, err := emailNotifier.Preferences().Get(r.Context(), userID)
+	if err != nil {
+		core.JSONResponse(w, map[string]interface{}{"status": "error", "message": err.Error()}, http.StatusInternalServerError)
+		return
+	}
+
+	if r.Method == http.MethodPut {
+		var request emailPreferencesRequest
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			core.JSONResponse(w, map[string]interface{}{"status": "error", "message": fmt.Sprintf("invalid request body: %v", err)}, http.StatusBadRequest)
+			return
+		}
+		if request.Notifications != nil {
+			preferences.Notifications = *request.Notifications
+		}
+		if request.Digest != nil {
+			preferences.Digest = *request.Digest
+		}
+		preferences.UpdatedAt = time.Now().UTC()
+		if err := emailNotifier.Preferences().Set(r.Context(), preferences); err != nil {
+			core.JSONResponse(w, map[string]interface{}{"status": "error", "message": err.Error()}, http.StatusInternalServerError)
+			return
+		}
+
+		recorder := audit.FromContext(r.Context())
+		recorder.SetResource("email_preferences", userID)
+		recorder.AddMetadata("notifications", preferences.Notifications)
+		recorder.AddMetadata("digest", preferences.Digest)
+	}
+
+	core.JSONResponse(w, map[string]interface{}{
+		"status":      "success",
+		"preferences": preferences,
+		"enabled":     email.Default().Enabled(),
+	}, http.StatusOK)
+}
+
+func init() {
+	emailNotifier = email.ConfigureDefault(integrations.GetPostgresStore("default"), email.Default())
+
+	registerAPIView("email_preferences", EmailPreferences, []string{"GET", "PUT"}, []string{"IsAuthenticated"})
+}
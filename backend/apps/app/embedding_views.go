@@ -0,0 +1,194 @@
+package app
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/spectrumwebco/agent_runtime/backend/core/audit"
+	"github.com/spectrumwebco/agent_runtime/backend/core/embeddings"
+	"github.com/spectrumwebco/agent_runtime/backend/core/querycache"
+	"github.com/spectrumwebco/agent_runtime/backend/core/rerank"
+	"github.com/spectrumwebco/agent_runtime/backend/core/tenancy"
+	"github.com/spectrumwebco/agent_runtime/backend/core/vectorindex"
+	"github.com/spectrumwebco/agent_runtime/backend/db/integrations"
+	"github.com/spectrumwebco/agent_runtime/pkg/djangogo/core"
+)
+
+// maxIngestDocuments bounds the documents of one ingest request.
+const maxIngestDocuments = 1000
+
+// defaultSearchResults and maxSearchResults bound the results of a search,
+// and maxSearchCandidates the results fetched for the reranker.
+const (
+	defaultSearchResults = 10
+	maxSearchResults     = 100
+	maxSearchCandidates  = 200
+)
+
+// documentIndexer records ingested documents, so indexes can be rebuilt, and
+// writes them to the index their alias points at.
+var documentIndexer *vectorindex.Indexer
+
+type ingestDocumentsRequest struct {
+	Documents []embeddings.Document `json:"documents" openapi:"required"`
+}
+
+// IngestDocuments embeds documents and adds them to a vector index of the
+// caller's project. Unchanged documents are embedded from the cache, with
+// the model of the index.
+func IngestDocuments(w http.ResponseWriter, r *http.Request) {
+	index := mux.Vars(r)["index"]
+	tenant, ok := tenancy.FromContext(r.Context())
+	if !ok {
+		core.JSONResponse(w, map[string]interface{}{"status": "error", "message": "a project is required to ingest documents"}, http.StatusBadRequest)
+		return
+	}
+
+	var request ingestDocumentsRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		core.JSONResponse(w, map[string]interface{}{"status": "error", "message": fmt.Sprintf("invalid request body: %v", err)}, http.StatusBadRequest)
+		return
+	}
+	if len(request.Documents) > maxIngestDocuments {
+		core.JSONResponse(w, map[string]interface{}{"status": "error", "message": fmt.Sprintf("at most %d documents can be ingested at a time", maxIngestDocuments)}, http.StatusRequestEntityTooLarge)
+		return
+	}
+	for _, document := range request.Documents {
+		if document.ID == "" || document.Text == "" {
+			core.JSONResponse(w, map[string]interface{}{"status": "error", "message": "documents need an id and a text"}, http.StatusBadRequest)
+			return
+		}
+	}
+
+	recorder := audit.FromContext(r.Context())
+	recorder.SetResource("vector_index", index)
+	recorder.AddMetadata("documents", len(request.Documents))
+
+	ids, model, err := documentIndexer.Ingest(r.Context(), tenant, index, request.Documents)
+	if err != nil {
+		core.JSONResponse(w, map[string]interface{}{"status": "error", "message": err.Error()}, http.StatusBadGateway)
+		return
+	}
+
+	core.JSONResponse(w, map[string]interface{}{
+		"status": "success",
+		"ids":    ids,
+		"model":  model,
+	}, http.StatusOK)
+}
+
+type searchRerankOptions struct {
+	// Reranker is a registered reranker, or none. The configured reranker
+	// is used if unset.
+	Reranker string `json:"reranker,omitempty"`
+	// BudgetMS is how long to wait for the reranker before returning the
+	// vector order.
+	BudgetMS int `json:"budget_ms,omitempty"`
+	// Candidates is how many results the reranker chooses from.
+	Candidates int `json:"candidates,omitempty"`
+}
+
+type searchDocumentsRequest struct {
+	Query  string                 `json:"query" openapi:"required"`
+	TopK   int                    `json:"top_k,omitempty"`
+	Filter map[string]interface{} `json:"filter,omitempty"`
+	Rerank *searchRerankOptions   `json:"rerank,omitempty"`
+}
+
+// SearchDocuments returns the documents of a vector index of the caller's
+// project nearest to a query, reranked if a reranker is configured or
+// requested. A reranker that exceeds its budget or fails leaves the vector
+// order, reported in the outcome.
+func SearchDocuments(w http.ResponseWriter, r *http.Request) {
+	index := mux.Vars(r)["index"]
+	tenant, ok := tenancy.FromContext(r.Context())
+	if !ok {
+		core.JSONResponse(w, map[string]interface{}{"status": "error", "message": "a project is required to search documents"}, http.StatusBadRequest)
+		return
+	}
+
+	var request searchDocumentsRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		core.JSONResponse(w, map[string]interface{}{"status": "error", "message": fmt.Sprintf("invalid request body: %v", err)}, http.StatusBadRequest)
+		return
+	}
+	if request.Query == "" {
+		core.JSONResponse(w, map[string]interface{}{"status": "error", "message": "a query is required"}, http.StatusBadRequest)
+		return
+	}
+	if request.TopK == 0 {
+		request.TopK = defaultSearchResults
+	}
+	if request.TopK < 0 || request.TopK > maxSearchResults {
+		core.JSONResponse(w, map[string]interface{}{"status": "error", "message": fmt.Sprintf("top_k must be between 1 and %d", maxSearchResults)}, http.StatusBadRequest)
+		return
+	}
+
+	config := rerank.Default()
+	name, budget, candidates := config.Reranker, config.Budget, config.Candidates
+	if options := request.Rerank; options != nil {
+		if options.Reranker != "" {
+			name = options.Reranker
+		}
+		if options.BudgetMS > 0 {
+			budget = time.Duration(options.BudgetMS) * time.Millisecond
+		}
+		if options.Candidates > 0 {
+			candidates = options.Candidates
+		}
+	}
+	var reranker rerank.Reranker
+	if name != rerank.RerankerNone {
+		if reranker, ok = rerank.Lookup(name); !ok {
+			core.JSONResponse(w, map[string]interface{}{"status": "error", "message": fmt.Sprintf("unknown reranker %q, expected none or one of %v", name, rerank.Names())}, http.StatusBadRequest)
+			return
+		}
+	}
+	fetch := request.TopK
+	if reranker != nil && candidates > fetch {
+		fetch = candidates
+		if fetch > maxSearchCandidates {
+			fetch = maxSearchCandidates
+		}
+	}
+
+	recorder := audit.FromContext(r.Context())
+	recorder.SetResource("vector_index", index)
+	recorder.AddMetadata("reranker", name)
+
+	results, err := documentIndexer.Search(r.Context(), tenant, index, request.Query, fetch, request.Filter)
+	if err != nil {
+		core.JSONResponse(w, map[string]interface{}{"status": "error", "message": err.Error()}, http.StatusBadGateway)
+		return
+	}
+	ranked, outcome := rerank.Rerank(r.Context(), tenant, reranker, request.Query, rerank.FromResults(results), budget)
+	if len(ranked) > request.TopK {
+		ranked = ranked[:request.TopK]
+	}
+
+	core.JSONResponse(w, map[string]interface{}{
+		"status":   "success",
+		"results":  ranked,
+		"reranker": name,
+		"outcome":  outcome,
+	}, http.StatusOK)
+}
+
+func init() {
+	embeddings.SetDefaultEmbedder(embeddings.New(embeddings.Default(), nil, integrations.GetKVStore()))
+	store := vectorindex.ConfigureDefault(integrations.GetPostgresStore("default"))
+	documentIndexer = vectorindex.NewIndexer(
+		store,
+		integrations.GetPhysicalVectorStore(),
+		vectorindex.ModelEmbedders(embeddings.Default(), integrations.GetKVStore()),
+	)
+	documentIndexer.SetCache(querycache.New(querycache.Default(), integrations.GetKVStore()))
+	integrations.SetRAGflowAliases(vectorindex.NewAliasResolver(store, vectorindex.DefaultAliasTTL))
+	rerank.ConfigureDefault(rerank.Default(), nil)
+
+	registerAPIView("ingest_documents", IngestDocuments, []string{"POST"}, []string{"HasAPIKey"})
+	registerAPIView("search_documents", SearchDocuments, []string{"POST"}, []string{"HasAPIKey"})
+}
@@ -0,0 +1,204 @@
+package app
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/spectrumwebco/agent_runtime/backend/core/audit"
+	"github.com/spectrumwebco/agent_runtime/backend/core/experiments"
+	"github.com/spectrumwebco/agent_runtime/backend/core/tenancy"
+	"github.com/spectrumwebco/agent_runtime/backend/db/integrations"
+	"github.com/spectrumwebco/agent_runtime/pkg/djangogo/core"
+)
+
+var (
+	experimentStore experiments.Store
+	exposureLog     experiments.ExposureLog
+)
+
+type createExperimentRequest struct {
+	Key         string                `json:"key" openapi:"required"`
+	Description string                `json:"description"`
+	Variants    []experiments.Variant `json:"variants" openapi:"required"`
+}
+
+// CreateExperiment starts an experiment in the caller's project. The first
+// variant is the control.
+func CreateExperiment(w http.ResponseWriter, r *http.Request) {
+	tenant, ok := tenancy.FromContext(r.Context())
+	if !ok {
+		core.JSONResponse(w, map[string]interface{}{"status": "error", "message": "an organization is required to create experiments"}, http.StatusBadRequest)
+		return
+	}
+
+	var request createExperimentRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		core.JSONResponse(w, map[string]interface{}{"status": "error", "message": fmt.Sprintf("invalid request body: %v", err)}, http.StatusBadRequest)
+		return
+	}
+
+	tenant, _ = tenancy.New(tenant.OrganizationID, tenant.ProjectID)
+	experiment, err := experiments.NewExperiment(tenant.OrganizationID, tenant.ProjectID, request.Key, request.Description, request.Variants, time.Now())
+	if err != nil {
+		core.JSONResponse(w, map[string]interface{}{"status": "error", "message": err.Error()}, http.StatusBadRequest)
+		return
+	}
+	if err := experimentStore.Create(r.Context(), experiment); err != nil {
+		core.JSONResponse(w, map[string]interface{}{"status": "error", "message": err.Error()}, http.StatusConflict)
+		return
+	}
+
+	recorder := audit.FromContext(r.Context())
+	recorder.SetResource("experiment", experiment.ID)
+	recorder.AddMetadata("key", experiment.Key)
+
+	core.JSONResponse(w, map[string]interface{}{"status": "success", "experiment": experiment}, http.StatusCreated)
+}
+
+// ListExperiments returns the experiments of the caller's project, newest
+// first.
+func ListExperiments(w http.ResponseWriter, r *http.Request) {
+	tenant, ok := tenancy.FromContext(r.Context())
+	if !ok {
+		core.JSONResponse(w, map[string]interface{}{"status": "error", "message": "an organization is required to list experiments"}, http.StatusBadRequest)
+		return
+	}
+
+	tenant, _ = tenancy.New(tenant.OrganizationID, tenant.ProjectID)
+	list, err := experimentStore.List(r.Context(), tenant.OrganizationID, tenant.ProjectID)
+	if err != nil {
+		core.JSONResponse(w, map[string]interface{}{"status": "error", "message": err.Error()}, http.StatusInternalServerError)
+		return
+	}
+
+	core.JSONResponse(w, map[string]interface{}{"status": "success", "experiments": list}, http.StatusOK)
+}
+
+// tenantExperiment loads the experiment named in the URL if it belongs to
+// the caller's project.
+func tenantExperiment(r *http.Request) (*experiments.Experiment, tenancy.Tenant, error) {
+	tenant, ok := tenancy.FromContext(r.Context())
+	if !ok {
+		return nil, tenant, experiments.ErrNotFound
+	}
+	tenant, _ = tenancy.New(tenant.OrganizationID, tenant.ProjectID)
+	experiment, err := experimentStore.Get(r.Context(), mux.Vars(r)["experiment_id"])
+	if err == nil && (experiment.OrganizationID != tenant.OrganizationID || experiment.ProjectID != tenant.ProjectID) {
+		err = experiments.ErrNotFound
+	}
+	return experiment, tenant, err
+}
+
+func experimentError(w http.ResponseWriter, err error) {
+	if errors.Is(err, experiments.ErrNotFound) {
+		core.JSONResponse(w, map[string]interface{}{"status": "error", "message": err.Error()}, http.StatusNotFound)
+		return
+	}
+	core.JSONResponse(w, map[string]interface{}{"status": "error", "message": err.Error()}, http.StatusInternalServerError)
+}
+
+// StopExperiment stops assigning variants; every subject gets the control
+// from then on.
+func StopExperiment(w http.ResponseWriter, r *http.Request) {
+	audit.FromContext(r.Context()).SetResource("experiment", mux.Vars(r)["experiment_id"])
+
+	experiment, _, err := tenantExperiment(r)
+	if err == nil {
+		err = experimentStore.Stop(r.Context(), experiment.ID, time.Now())
+	}
+	if err == nil {
+		experiment, err = experimentStore.Get(r.Context(), experiment.ID)
+	}
+	if err != nil {
+		experimentError(w, err)
+		return
+	}
+
+	core.JSONResponse(w, map[string]interface{}{"status": "success", "experiment": experiment}, http.StatusOK)
+}
+
+type assignExperimentRequest struct {
+	SubjectID string `json:"subject_id" openapi:"required"`
+	// TrajectoryID is the trajectory that runs with the variant. Assignments
+	// without one are not logged as exposures.
+	TrajectoryID string `json:"trajectory_id"`
+}
+
+// AssignExperiment returns the variant of a subject and logs the exposure of
+// the trajectory running with it.
+func AssignExperiment(w http.ResponseWriter, r *http.Request) {
+	var request assignExperimentRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		core.JSONResponse(w, map[string]interface{}{"status": "error", "message": fmt.Sprintf("invalid request body: %v", err)}, http.StatusBadRequest)
+		return
+	}
+	if request.SubjectID == "" {
+		core.JSONResponse(w, map[string]interface{}{"status": "error", "message": "subject_id is required"}, http.StatusBadRequest)
+		return
+	}
+
+	experiment, tenant, err := tenantExperiment(r)
+	if err != nil {
+		experimentError(w, err)
+		return
+	}
+
+	variant := experiment.Assign(request.SubjectID)
+	logged := false
+	if request.TrajectoryID != "" && experiment.Status == experiments.StatusRunning {
+		exposure := experiments.Exposure{
+			ExperimentID: experiment.ID,
+			Variant:      variant.Name,
+			SubjectID:    request.SubjectID,
+			TrajectoryID: request.TrajectoryID,
+			OccurredAt:   time.Now().UTC(),
+		}
+		if err := exposureLog.Log(r.Context(), tenant, exposure); err != nil {
+			core.JSONResponse(w, map[string]interface{}{"status": "error", "message": err.Error()}, http.StatusInternalServerError)
+			return
+		}
+		logged = true
+	}
+
+	core.JSONResponse(w, map[string]interface{}{
+		"status":  "success",
+		"variant": variant,
+		"logged":  logged,
+	}, http.StatusOK)
+}
+
+// ExperimentReport compares the success rate of each variant's trajectories
+// with the control's.
+func ExperimentReport(w http.ResponseWriter, r *http.Request) {
+	experiment, tenant, err := tenantExperiment(r)
+	if err != nil {
+		experimentError(w, err)
+		return
+	}
+
+	outcomes, err := exposureLog.Outcomes(r.Context(), tenant, experiment.ID)
+	if err != nil {
+		core.JSONResponse(w, map[string]interface{}{"status": "error", "message": err.Error()}, http.StatusInternalServerError)
+		return
+	}
+
+	core.JSONResponse(w, map[string]interface{}{
+		"status": "success",
+		"report": experiments.NewReport(experiment, outcomes, time.Now()),
+	}, http.StatusOK)
+}
+
+func init() {
+	experimentStore = experiments.ConfigureDefault(integrations.GetPostgresStore("default"))
+	exposureLog = experiments.NewDorisExposureLog(integrations.GetDorisStore(""))
+
+	registerAPIView("create_experiment", CreateExperiment, []string{"POST"}, []string{"HasAPIKey"})
+	registerAPIView("list_experiments", ListExperiments, []string{"GET"}, []string{"HasAPIKey"})
+	registerAPIView("stop_experiment", StopExperiment, []string{"POST"}, []string{"HasAPIKey"})
+	registerAPIView("assign_experiment", AssignExperiment, []string{"POST"}, []string{"HasAPIKey"})
+	registerAPIView("experiment_report", ExperimentReport, []string{"GET"}, []string{"HasAPIKey"})
+}
@@ -0,0 +1,155 @@
+package app
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/spectrumwebco/agent_runtime/backend/core/agentcmd"
+	"github.com/spectrumwebco/agent_runtime/backend/core/audit"
+	"github.com/spectrumwebco/agent_runtime/backend/core/fsdiff"
+	"github.com/spectrumwebco/agent_runtime/pkg/djangogo/core"
+)
+
+var diffClient = fsdiff.NewClient(agentcmd.Default())
+
+type snapshotRequest struct {
+	Name string `json:"name" openapi:"required"`
+}
+
+// fsdiffError is 409 for patches that don't apply, 422 for commands the agent
+// refused, 503 while the agent isn't connected and 500 otherwise.
+func fsdiffError(w http.ResponseWriter, err error) {
+	var (
+		rejected *fsdiff.PatchRejectedError
+		agentErr *fsdiff.AgentError
+	)
+	status := http.StatusInternalServerError
+	switch {
+	case errors.As(err, &rejected):
+		core.JSONResponse(w, map[string]interface{}{"status": "error", "message": err.Error(), "files": rejected.Files}, http.StatusConflict)
+		return
+	case errors.As(err, &agentErr):
+		status = http.StatusUnprocessableEntity
+	case errors.Is(err, agentcmd.ErrNotConnected):
+		status = http.StatusServiceUnavailable
+	}
+	core.JSONResponse(w, map[string]interface{}{"status": "error", "message": err.Error()}, status)
+}
+
+// WorkspaceDiff returns the diff of a workspace's working tree against a git
+// revision or a snapshot, as a unified diff, a change list or both.
+func WorkspaceDiff(w http.ResponseWriter, r *http.Request) {
+	workspaceID, ok := coordinationWorkspace(w, r)
+	if !ok {
+		return
+	}
+	query := r.URL.Query()
+	options := fsdiff.DiffOptions{
+		Base:     query.Get("base"),
+		Snapshot: query.Get("snapshot"),
+		Paths:    query["path"],
+	}
+	if options.Base != "" && options.Snapshot != "" {
+		core.JSONResponse(w, map[string]interface{}{"status": "error", "message": "base and snapshot are mutually exclusive"}, http.StatusBadRequest)
+		return
+	}
+	if options.Snapshot != "" {
+		if err := fsdiff.ValidateSnapshotName(options.Snapshot); err != nil {
+			core.JSONResponse(w, map[string]interface{}{"status": "error", "message": err.Error()}, http.StatusBadRequest)
+			return
+		}
+	}
+	format := query.Get("format")
+	switch format {
+	case "", "unified", "changes":
+	default:
+		core.JSONResponse(w, map[string]interface{}{"status": "error", "message": fmt.Sprintf("unknown format %q, must be unified or changes", format)}, http.StatusBadRequest)
+		return
+	}
+
+	diff, err := diffClient.Diff(r.Context(), workspaceID, options)
+	if err != nil {
+		fsdiffError(w, err)
+		return
+	}
+	switch format {
+	case "unified":
+		diff.Changes = nil
+	case "changes":
+		diff.Patch = ""
+	}
+	core.JSONResponse(w, map[string]interface{}{"status": "success", "diff": diff}, http.StatusOK)
+}
+
+// CreateWorkspaceSnapshot records the working tree of a workspace, to diff
+// against it later.
+func CreateWorkspaceSnapshot(w http.ResponseWriter, r *http.Request) {
+	workspaceID, ok := coordinationWorkspace(w, r)
+	if !ok {
+		return
+	}
+	var request snapshotRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		core.JSONResponse(w, map[string]interface{}{"status": "error", "message": fmt.Sprintf("invalid request body: %v", err)}, http.StatusBadRequest)
+		return
+	}
+	if err := fsdiff.ValidateSnapshotName(request.Name); err != nil {
+		core.JSONResponse(w, map[string]interface{}{"status": "error", "message": err.Error()}, http.StatusBadRequest)
+		return
+	}
+
+	snapshot, err := diffClient.Snapshot(r.Context(), workspaceID, request.Name)
+	if err != nil {
+		fsdiffError(w, err)
+		return
+	}
+	recorder := audit.FromContext(r.Context())
+	recorder.SetResource("workspace", workspaceID)
+	recorder.AddMetadata("snapshot", snapshot.Name)
+	recorder.AddMetadata("commit", snapshot.Commit)
+	core.JSONResponse(w, map[string]interface{}{"status": "success", "snapshot": snapshot}, http.StatusCreated)
+}
+
+// ApplyWorkspacePatch applies a reviewed patch to the working tree of a
+// workspace. With check set it only reports whether the patch applies.
+func ApplyWorkspacePatch(w http.ResponseWriter, r *http.Request) {
+	workspaceID, ok := coordinationWorkspace(w, r)
+	if !ok {
+		return
+	}
+	var request fsdiff.PatchRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		core.JSONResponse(w, map[string]interface{}{"status": "error", "message": fmt.Sprintf("invalid request body: %v", err)}, http.StatusBadRequest)
+		return
+	}
+	changes, err := fsdiff.ParsePatch(request.Patch)
+	if err == nil && len(changes) == 0 {
+		err = errors.New("patch contains no changes")
+	}
+	if err != nil {
+		core.JSONResponse(w, map[string]interface{}{"status": "error", "message": err.Error()}, http.StatusBadRequest)
+		return
+	}
+
+	result, err := diffClient.Apply(r.Context(), workspaceID, request)
+	if err != nil {
+		fsdiffError(w, err)
+		return
+	}
+	recorder := audit.FromContext(r.Context())
+	if request.Check {
+		recorder.Skip()
+	} else {
+		recorder.SetResource("workspace", workspaceID)
+		recorder.AddMetadata("files", result.Files)
+	}
+	core.JSONResponse(w, map[string]interface{}{"status": "success", "result": result, "changes": changes}, http.StatusOK)
+}
+
+func init() {
+	registerAPIView("workspace_diff", WorkspaceDiff, []string{"GET"}, []string{"HasAPIKey"})
+	registerAPIView("create_workspace_snapshot", CreateWorkspaceSnapshot, []string{"POST"}, []string{"HasAPIKey"})
+	registerAPIView("apply_workspace_patch", ApplyWorkspacePatch, []string{"POST"}, []string{"HasAPIKey"})
+}
@@ -0,0 +1,102 @@
+package app
+
+import (
+	"context"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/spectrumwebco/agent_runtime/backend/core/audit"
+	"github.com/spectrumwebco/agent_runtime/backend/core/githubapp"
+	"github.com/spectrumwebco/agent_runtime/backend/core/outbound"
+	"github.com/spectrumwebco/agent_runtime/pkg/djangogo/core"
+)
+
+var githubAppLogger = log.New(os.Stdout, "kled.app.githubapp: ", log.LstdFlags)
+
+// githubIntegration is nil unless the GitHub App is configured.
+var githubIntegration *githubapp.Integration
+
+// maxGitHubDelivery is the largest payload GitHub sends.
+const maxGitHubDelivery = 25 << 20
+
+// githubWorkspaceURL links a workspace created for a pull request or issue.
+// WORKSPACE_URL overrides the frontend's page, with {id} replaced by the
+// workspace.
+func githubWorkspaceURL(workspaceID string) string {
+	if pattern, _ := core.GetSetting("WORKSPACE_URL", ""); pattern.(string) != "" {
+		return strings.ReplaceAll(pattern.(string), "{id}", workspaceID)
+	}
+	base, _ := core.GetSetting("TUNNEL_PUBLIC_URL", "")
+	return strings.TrimSuffix(base.(string), "/") + "/workspaces/" + workspaceID
+}
+
+// GitHubWebhook receives the deliveries of the GitHub App. It is
+// authenticated by the signature of the delivery; the workspace is created
+// after the delivery is acknowledged, as that takes longer than GitHub
+// waits.
+func GitHubWebhook(w http.ResponseWriter, r *http.Request) {
+	if githubIntegration == nil {
+		audit.FromContext(r.Context()).Skip()
+		core.JSONResponse(w, map[string]interface{}{"status": "error", "message": "the GitHub App is not configured"}, http.StatusNotFound)
+		return
+	}
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxGitHubDelivery))
+	if err != nil {
+		core.JSONResponse(w, map[string]interface{}{"status": "error", "message": err.Error()}, http.StatusBadRequest)
+		return
+	}
+	if err := githubapp.VerifySignature(githubapp.Default().WebhookSecret, r.Header.Get("X-Hub-Signature-256"), body); err != nil {
+		core.JSONResponse(w, map[string]interface{}{"status": "error", "message": err.Error()}, http.StatusUnauthorized)
+		return
+	}
+
+	eventType := r.Header.Get("X-GitHub-Event")
+	if eventType != "pull_request" && eventType != "issues" {
+		// ping and events the app doesn't act on
+		audit.FromContext(r.Context()).Skip()
+		core.JSONResponse(w, map[string]interface{}{"status": "success", "handled": false}, http.StatusOK)
+		return
+	}
+	event, err := githubapp.ParseEvent(eventType, body)
+	if err != nil {
+		core.JSONResponse(w, map[string]interface{}{"status": "error", "message": err.Error()}, http.StatusBadRequest)
+		return
+	}
+
+	recorder := audit.FromContext(r.Context())
+	recorder.SetResource("repository", event.Repository.FullName)
+	recorder.AddMetadata("event", eventType)
+	recorder.AddMetadata("action", event.Action)
+	recorder.AddMetadata("delivery", r.Header.Get("X-GitHub-Delivery"))
+
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), githubapp.Default().ProvisionTimeout)
+		defer cancel()
+		if err := githubIntegration.Handle(ctx, event); err != nil {
+			githubAppLogger.Printf("Error handling %s %s of %s: %v", eventType, event.Action, event.Repository.FullName, err)
+		}
+	}()
+	core.JSONResponse(w, map[string]interface{}{"status": "success", "handled": true}, http.StatusAccepted)
+}
+
+func init() {
+	if config := githubapp.Default(); config.Enabled() {
+		httpClient, err := outbound.Default().HTTPClient(forgeTimeout)
+		if err != nil {
+			githubAppLogger.Printf("Error loading the outbound CA bundle: %v", err)
+		}
+		client, err := githubapp.NewClient(config, httpClient)
+		if err != nil {
+			githubAppLogger.Printf("GitHub App disabled: %v", err)
+		} else {
+			provisioner := &githubapp.CLIProvisioner{Path: config.CLIPath, Provider: config.Provider, PrebuildRepository: config.PrebuildRepository}
+			githubIntegration = githubapp.NewIntegration(client, provisioner, config)
+			githubIntegration.WorkspaceURL = githubWorkspaceURL
+		}
+	}
+
+	registerAPIView("github_webhook", GitHubWebhook, []string{"POST"}, []string{"AllowAny"})
+}
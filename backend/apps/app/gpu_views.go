@@ -0,0 +1,192 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/spectrumwebco/agent_runtime/backend/core/email"
+	"github.com/spectrumwebco/agent_runtime/backend/core/gpu"
+	"github.com/spectrumwebco/agent_runtime/backend/core/notify"
+	"github.com/spectrumwebco/agent_runtime/backend/core/tenancy"
+	"github.com/spectrumwebco/agent_runtime/backend/core/workspace"
+	"github.com/spectrumwebco/agent_runtime/backend/db/integrations"
+	"github.com/spectrumwebco/agent_runtime/pkg/djangogo/core"
+)
+
+var (
+	gpuPolicies  gpu.PolicyStore = gpu.NewMemoryPolicyStore()
+	gpuReclaimer *gpu.Reclaimer
+)
+
+// loadGPUWorkspace resolves the owner and project of a workspace. The
+// workspace must belong to the caller's organization.
+func loadGPUWorkspace(ctx context.Context, workspaceID string) (gpu.Workspace, error) {
+	rows, err := integrations.GetPostgresStore("default").ExecuteQuery(
+		`SELECT name, created_by_id, organization_id, project_id FROM app_workspace WHERE id = $1`, workspaceID,
+	)
+	if err != nil {
+		return gpu.Workspace{}, fmt.Errorf("error loading workspace %s: %v", workspaceID, err)
+	}
+	if len(rows) == 0 {
+		return gpu.Workspace{}, fmt.Errorf("workspace %s not found", workspaceID)
+	}
+
+	row := rows[0]
+	organizationID := fmt.Sprint(row["organization_id"])
+	if tenant, ok := tenancy.FromContext(ctx); !ok || tenant.OrganizationID != organizationID {
+		return gpu.Workspace{}, fmt.Errorf("workspace %s not found", workspaceID)
+	}
+
+	projectID := ""
+	if row["project_id"] != nil {
+		projectID = fmt.Sprint(row["project_id"])
+	}
+	tenant, err := tenancy.New(organizationID, projectID)
+	if err != nil {
+		return gpu.Workspace{}, err
+	}
+
+	workspace := gpu.Workspace{ID: workspaceID, ProjectID: tenant.String()}
+	if name, ok := row["name"].(string); ok {
+		workspace.Label = name
+	}
+	if owner := row["created_by_id"]; owner != nil {
+		workspace.OwnerID = fmt.Sprint(owner)
+	}
+	return workspace, nil
+}
+
+// ReportGPUSamples receives samples from the sampler running in a GPU
+// workspace and applies the project's idle policy.
+func ReportGPUSamples(w http.ResponseWriter, r *http.Request) {
+	var report gpu.SampleReport
+	if err := json.NewDecoder(r.Body).Decode(&report); err != nil {
+		core.JSONResponse(w, map[string]interface{}{"status": "error", "message": "Invalid request body"}, http.StatusBadRequest)
+		return
+	}
+	if report.WorkspaceID == "" {
+		core.JSONResponse(w, map[string]interface{}{"status": "error", "message": "workspace_id is required"}, http.StatusBadRequest)
+		return
+	}
+
+	workspace, err := loadGPUWorkspace(r.Context(), report.WorkspaceID)
+	if err != nil {
+		core.JSONResponse(w, map[string]interface{}{"status": "error", "message": err.Error()}, http.StatusNotFound)
+		return
+	}
+
+	decision, err := gpuReclaimer.Observe(r.Context(), workspace, report.Samples)
+	if err != nil {
+		core.JSONResponse(w, map[string]interface{}{"status": "error", "message": err.Error()}, http.StatusInternalServerError)
+		return
+	}
+
+	core.JSONResponse(w, map[string]interface{}{"status": "success", "decision": decision}, http.StatusOK)
+}
+
+// GPUPolicy reads, replaces or removes a project's idle GPU policy. The
+// project is given as "<organization>/<project>" in the project parameter.
+func GPUPolicy(w http.ResponseWriter, r *http.Request) {
+	project := r.URL.Query().Get("project")
+	if project == "" {
+		core.JSONResponse(w, map[string]interface{}{"status": "error", "message": "project is required"}, http.StatusBadRequest)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		policy, err := gpuReclaimer.PolicyFor(r.Context(), project)
+		if err != nil {
+			core.JSONResponse(w, map[string]interface{}{"status": "error", "message": err.Error()}, http.StatusInternalServerError)
+			return
+		}
+		core.JSONResponse(w, map[string]interface{}{"status": "success", "policy": policy}, http.StatusOK)
+
+	case http.MethodPut:
+		policy := gpu.DefaultPolicy()
+		if err := json.NewDecoder(r.Body).Decode(&policy); err != nil {
+			core.JSONResponse(w, map[string]interface{}{"status": "error", "message": err.Error()}, http.StatusBadRequest)
+			return
+		}
+		if err := policy.Validate(); err != nil {
+			core.JSONResponse(w, map[string]interface{}{"status": "error", "message": err.Error()}, http.StatusBadRequest)
+			return
+		}
+		if err := gpuPolicies.SetPolicy(r.Context(), project, policy); err != nil {
+			core.JSONResponse(w, map[string]interface{}{"status": "error", "message": err.Error()}, http.StatusInternalServerError)
+			return
+		}
+		core.JSONResponse(w, map[string]interface{}{"status": "success", "policy": policy}, http.StatusOK)
+
+	case http.MethodDelete:
+		if err := gpuPolicies.DeletePolicy(r.Context(), project); err != nil {
+			core.JSONResponse(w, map[string]interface{}{"status": "error", "message": err.Error()}, http.StatusInternalServerError)
+			return
+		}
+		core.JSONResponse(w, map[string]interface{}{"status": "success"}, http.StatusOK)
+	}
+}
+
+// gpuWorkspaces stops and downgrades idle GPU workspaces with the workspace
+// controller. The change outlives the sample request, as stopping a
+// workspace stops the sampler that sent it.
+type gpuWorkspaces struct{}
+
+func (gpuWorkspaces) Downgrade(ctx context.Context, workspaceID, target string) error {
+	controller, err := getWorkspaceController()
+	if err != nil {
+		return err
+	}
+	return controller.Downgrade(gpuIdleContext(ctx), workspaceID, target)
+}
+
+func (gpuWorkspaces) Stop(ctx context.Context, workspaceID string) error {
+	controller, err := getWorkspaceController()
+	if err != nil {
+		return err
+	}
+	return controller.Stop(gpuIdleContext(ctx), workspaceID)
+}
+
+func gpuIdleContext(ctx context.Context) context.Context {
+	return workspace.WithReason(context.WithoutCancel(ctx), "gpu_idle")
+}
+
+// notifyGPUOwner pushes idle notices to the owner's open WebSocket sessions.
+func notifyGPUOwner(ctx context.Context, notice gpu.Notice) error {
+	if notice.Workspace.OwnerID == "" {
+		return nil
+	}
+	return GetManager().SendToGroup("user_"+notice.Workspace.OwnerID, map[string]interface{}{
+		"type":    "gpu_idle",
+		"message": notice.Message(),
+		"notice":  notice,
+	})
+}
+
+func init() {
+	store := gpu.NewPostgresPolicyStore(integrations.GetPostgresStore("default"))
+	if err := store.EnsureSchema(); err != nil {
+		logger.Printf("GPU policies falling back to in-memory store: %v", err)
+	} else {
+		gpuPolicies = store
+	}
+
+	notifiers := gpu.MultiNotifier{gpu.NotifierFunc(notifyGPUOwner), notify.GPUNotifier, email.GPUNotifier}
+	if webhook, _ := core.GetSetting("GPU_IDLE_SLACK_WEBHOOK_URL", ""); webhook.(string) != "" {
+		notifiers = append(notifiers, &gpu.SlackNotifier{WebhookURL: webhook.(string)})
+	}
+
+	gpuReclaimer = gpu.NewReclaimer(
+		integrations.GetKVStore(),
+		gpuPolicies,
+		gpu.DefaultPolicy(),
+		notifiers,
+		gpuWorkspaces{},
+	)
+
+	registerAPIView("report_gpu_samples", ReportGPUSamples, []string{"POST"}, []string{"HasAPIKey"})
+	registerAPIView("gpu_policy", GPUPolicy, []string{"GET", "PUT", "DELETE"}, []string{"IsAdminUser"})
+}
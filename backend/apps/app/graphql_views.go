@@ -0,0 +1,54 @@
+package app
+
+import (
+	"net/http"
+	"sync"
+
+	"github.com/spectrumwebco/agent_runtime/backend/apps/app/middleware"
+	"github.com/spectrumwebco/agent_runtime/backend/core/graph"
+	"github.com/spectrumwebco/agent_runtime/backend/core/openapi"
+	"github.com/spectrumwebco/agent_runtime/backend/core/rbac"
+	"github.com/spectrumwebco/agent_runtime/backend/core/tenancy"
+	"github.com/spectrumwebco/agent_runtime/backend/db/integrations"
+	"github.com/spectrumwebco/agent_runtime/pkg/djangogo/core"
+)
+
+var (
+	graphHandler     http.Handler
+	graphHandlerOnce sync.Once
+)
+
+// GraphQL serves the GraphQL API of workspaces, events, trajectories and
+// costs. Fields are authorized one by one, so the caller only needs to be
+// authenticated and have a tenant here.
+func GraphQL(w http.ResponseWriter, r *http.Request) {
+	subject, err := middleware.SubjectFromUser(core.GetUserFromRequest(r))
+	if err != nil {
+		core.JSONResponse(w, map[string]interface{}{"status": "error", "message": err.Error()}, http.StatusInternalServerError)
+		return
+	}
+	if subject.ID == "" {
+		core.JSONResponse(w, map[string]interface{}{"status": "error", "message": "authentication required"}, http.StatusUnauthorized)
+		return
+	}
+	if _, ok := tenancy.FromContext(r.Context()); !ok {
+		core.JSONResponse(w, map[string]interface{}{"status": "error", "message": "a project is required"}, http.StatusBadRequest)
+		return
+	}
+
+	graphHandlerOnce.Do(func() {
+		store := graph.NewSQLStore(integrations.GetPostgresStore("default"), integrations.GetDorisStore(""))
+		graphHandler = graph.NewHandler(store, rbac.DefaultEngine())
+	})
+	graphHandler.ServeHTTP(w, r.WithContext(rbac.WithSubject(r.Context(), subject)))
+}
+
+func init() {
+	registerAPIView("graphql", GraphQL, []string{"GET", "POST"}, []string{"IsAuthenticated"})
+
+	openapi.Default().Describe("graphql", openapi.Description{
+		Summary:     "GraphQL API of workspaces, events, trajectories and costs",
+		Description: "Accepts GraphQL requests as JSON bodies, or GET query parameters, and answers with the GraphQL response format. The schema is in core/graph/schema.graphqls and can be introspected.",
+		Tags:        []string{"graphql"},
+	})
+}
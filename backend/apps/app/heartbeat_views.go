@@ -0,0 +1,51 @@
+package app
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/spectrumwebco/agent_runtime/backend/core/heartbeat"
+	"github.com/spectrumwebco/agent_runtime/backend/db/integrations"
+	"github.com/spectrumwebco/agent_runtime/pkg/djangogo/core"
+)
+
+var heartbeatTracker *heartbeat.Tracker
+
+// ListWorkspaceHeartbeats returns the liveness and last-seen time of workspace
+// agents. Repeated workspace_id parameters restrict the result to those
+// workspaces.
+func ListWorkspaceHeartbeats(w http.ResponseWriter, r *http.Request) {
+	statuses, err := heartbeatTracker.List()
+	if err != nil {
+		core.JSONResponse(w, map[string]interface{}{"status": "error", "message": err.Error()}, http.StatusInternalServerError)
+		return
+	}
+
+	if ids := r.URL.Query()["workspace_id"]; len(ids) > 0 {
+		wanted := make(map[string]bool, len(ids))
+		for _, id := range ids {
+			wanted[id] = true
+		}
+		filtered := []heartbeat.Status{}
+		for _, status := range statuses {
+			if wanted[status.WorkspaceID] {
+				filtered = append(filtered, status)
+			}
+		}
+		statuses = filtered
+	}
+
+	core.JSONResponse(w, map[string]interface{}{
+		"status":     "success",
+		"heartbeats": statuses,
+		"interval":   heartbeatTracker.Interval().Seconds(),
+	}, http.StatusOK)
+}
+
+func init() {
+	interval, _ := core.GetSetting("HEARTBEAT_INTERVAL_SECONDS", 15)
+	missedBeats, _ := core.GetSetting("HEARTBEAT_MISSED_BEATS", 3)
+	heartbeatTracker = heartbeat.NewTracker(integrations.GetKVStore(), time.Duration(interval.(int))*time.Second, missedBeats.(int))
+
+	registerAPIView("list_workspace_heartbeats", ListWorkspaceHeartbeats, []string{"GET"}, []string{"HasAPIKey"})
+}
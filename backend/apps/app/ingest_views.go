@@ -0,0 +1,86 @@
+package app
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/gorilla/mux"
+
+	"github.com/spectrumwebco/agent_runtime/backend/core/audit"
+	"github.com/spectrumwebco/agent_runtime/backend/core/ingest"
+	"github.com/spectrumwebco/agent_runtime/backend/core/kerrors"
+	"github.com/spectrumwebco/agent_runtime/backend/db/integrations"
+	"github.com/spectrumwebco/agent_runtime/pkg/djangogo/core"
+)
+
+var ingestManager *ingest.Manager
+
+// ListRoutineLoads lists the routine loads of the analytics database with
+// their state, row counts and lag.
+func ListRoutineLoads(w http.ResponseWriter, r *http.Request) {
+	statuses, err := ingestManager.Statuses(r.Context())
+	if err != nil {
+		kerrors.WriteJSON(w, err)
+		return
+	}
+	core.JSONResponse(w, map[string]interface{}{"status": "success", "routine_loads": statuses}, http.StatusOK)
+}
+
+// EnsureRoutineLoads creates the routine loads of the event topics that
+// don't exist or were stopped.
+func EnsureRoutineLoads(w http.ResponseWriter, r *http.Request) {
+	created, err := ingestManager.Ensure(r.Context())
+	audit.FromContext(r.Context()).AddMetadata("created", created)
+	if err != nil {
+		kerrors.WriteJSON(w, err)
+		return
+	}
+	core.JSONResponse(w, map[string]interface{}{"status": "success", "created": created}, http.StatusOK)
+}
+
+// GetRoutineLoad shows the state, progress and error logs of a routine load.
+func GetRoutineLoad(w http.ResponseWriter, r *http.Request) {
+	status, err := ingestManager.Status(r.Context(), mux.Vars(r)["name"])
+	if err != nil {
+		kerrors.WriteJSON(w, err)
+		return
+	}
+	core.JSONResponse(w, map[string]interface{}{"status": "success", "routine_load": status}, http.StatusOK)
+}
+
+// PauseRoutineLoad pauses a routine load, e.g. while its table is migrated.
+func PauseRoutineLoad(w http.ResponseWriter, r *http.Request) {
+	name := mux.Vars(r)["name"]
+	audit.FromContext(r.Context()).SetResource("routine_load", name)
+	if err := ingestManager.Pause(r.Context(), name); err != nil {
+		kerrors.WriteJSON(w, err)
+		return
+	}
+	core.JSONResponse(w, map[string]interface{}{"status": "success"}, http.StatusOK)
+}
+
+// ResumeRoutineLoad resumes a paused routine load where it stopped.
+func ResumeRoutineLoad(w http.ResponseWriter, r *http.Request) {
+	name := mux.Vars(r)["name"]
+	audit.FromContext(r.Context()).SetResource("routine_load", name)
+	if err := ingestManager.Resume(r.Context(), name); err != nil {
+		kerrors.WriteJSON(w, err)
+		return
+	}
+	core.JSONResponse(w, map[string]interface{}{"status": "success"}, http.StatusOK)
+}
+
+func init() {
+	config := ingest.Default()
+	ingestManager = ingest.NewManager(
+		integrations.NewDorisRoutineLoads(integrations.GetDorisStore("")),
+		ingest.Loads(integrations.GetKafkaClient("", "kled-ingest", ""), config),
+	)
+	go ingest.NewMonitor(ingestManager, config.PollInterval).Run(context.Background())
+
+	registerAPIView("list_routine_loads", ListRoutineLoads, []string{"GET"}, []string{"IsAdminUser"})
+	registerAPIView("ensure_routine_loads", EnsureRoutineLoads, []string{"POST"}, []string{"IsAdminUser"})
+	registerAPIView("get_routine_load", GetRoutineLoad, []string{"GET"}, []string{"IsAdminUser"})
+	registerAPIView("pause_routine_load", PauseRoutineLoad, []string{"POST"}, []string{"IsAdminUser"})
+	registerAPIView("resume_routine_load", ResumeRoutineLoad, []string{"POST"}, []string{"IsAdminUser"})
+}
@@ -0,0 +1,292 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/spectrumwebco/agent_runtime/backend/core/audit"
+	"github.com/spectrumwebco/agent_runtime/backend/core/llm"
+	"github.com/spectrumwebco/agent_runtime/backend/core/metering"
+	"github.com/spectrumwebco/agent_runtime/backend/core/quota"
+	"github.com/spectrumwebco/agent_runtime/backend/core/tenancy"
+	"github.com/spectrumwebco/agent_runtime/backend/db/integrations"
+	"github.com/spectrumwebco/agent_runtime/pkg/djangogo/core"
+)
+
+var (
+	llmGateway *llm.Gateway
+	llmMeter   *metering.Meter
+)
+
+type llmChatRequest struct {
+	llm.ChatRequest
+	// Stream sends the completion as Server-Sent Events: a delta event per
+	// piece of content and a done event with the complete response.
+	Stream bool `json:"stream"`
+	// RunID and TrajectoryID attribute the tokens to an agent run.
+	RunID        string `json:"run_id,omitempty"`
+	TrajectoryID string `json:"trajectory_id,omitempty"`
+}
+
+// llmErrorStatus is 404 for unknown models, 429 over the token budget, the
+// provider's status for invalid requests and 502 when the providers failed.
+func llmErrorStatus(err error) int {
+	var providerErr *llm.ProviderError
+	switch {
+	case errors.Is(err, llm.ErrUnknownModel):
+		return http.StatusNotFound
+	case errors.Is(err, quota.ErrExceeded):
+		return http.StatusTooManyRequests
+	case errors.As(err, &providerErr) && !providerErr.Retryable():
+		return providerErr.StatusCode
+	}
+	return http.StatusBadGateway
+}
+
+// llmCall attributes the calls of a request to the authenticated user and
+// the given run.
+func llmCall(r *http.Request, call metering.Call) context.Context {
+	if user := core.GetUserFromRequest(r); user != nil && user.IsAuthenticated() {
+		call.UserID = user.GetID()
+	}
+	return metering.WithCall(r.Context(), call)
+}
+
+// LLMChat completes a conversation with the providers of a model, falling
+// back to the next provider when one fails.
+func LLMChat(w http.ResponseWriter, r *http.Request) {
+	tenant, ok := tenancy.FromContext(r.Context())
+	if !ok {
+		core.JSONResponse(w, map[string]interface{}{"status": "error", "message": "a project is required to call models"}, http.StatusBadRequest)
+		return
+	}
+
+	var request llmChatRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		core.JSONResponse(w, map[string]interface{}{"status": "error", "message": fmt.Sprintf("invalid request body: %v", err)}, http.StatusBadRequest)
+		return
+	}
+	if request.Model == "" || len(request.Messages) == 0 {
+		core.JSONResponse(w, map[string]interface{}{"status": "error", "message": "model and messages are required"}, http.StatusBadRequest)
+		return
+	}
+	audit.FromContext(r.Context()).AddMetadata("model", request.Model)
+	ctx := llmCall(r, metering.Call{RunID: request.RunID, TrajectoryID: request.TrajectoryID})
+
+	if !request.Stream {
+		response, err := llmGateway.Chat(ctx, tenant, request.ChatRequest)
+		if err != nil {
+			core.JSONResponse(w, map[string]interface{}{"status": "error", "message": err.Error()}, llmErrorStatus(err))
+			return
+		}
+		core.JSONResponse(w, map[string]interface{}{"status": "success", "response": response}, http.StatusOK)
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		core.JSONResponse(w, map[string]interface{}{"status": "error", "message": "streaming is not supported"}, http.StatusInternalServerError)
+		return
+	}
+
+	// The headers are written with the first delta, so a request failing
+	// before it still gets a JSON error.
+	started := false
+	response, err := llmGateway.ChatStream(ctx, tenant, request.ChatRequest, func(delta string) error {
+		if !started {
+			w.Header().Set("Content-Type", "text/event-stream")
+			w.Header().Set("Cache-Control", "no-cache")
+			w.Header().Set("X-Accel-Buffering", "no")
+			w.WriteHeader(http.StatusOK)
+			started = true
+		}
+		if err := writeLLMEvent(w, "delta", map[string]string{"content": delta}); err != nil {
+			return err
+		}
+		flusher.Flush()
+		return nil
+	})
+	if err != nil && !started {
+		core.JSONResponse(w, map[string]interface{}{"status": "error", "message": err.Error()}, llmErrorStatus(err))
+		return
+	}
+	if !started {
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.WriteHeader(http.StatusOK)
+	}
+	if err != nil {
+		writeLLMEvent(w, "error", map[string]string{"message": err.Error()})
+	} else {
+		writeLLMEvent(w, "done", response)
+	}
+	flusher.Flush()
+}
+
+func writeLLMEvent(w http.ResponseWriter, event string, data interface{}) error {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, payload)
+	return err
+}
+
+// LLMEmbeddings embeds the input with the providers of a model.
+func LLMEmbeddings(w http.ResponseWriter, r *http.Request) {
+	tenant, ok := tenancy.FromContext(r.Context())
+	if !ok {
+		core.JSONResponse(w, map[string]interface{}{"status": "error", "message": "a project is required to call models"}, http.StatusBadRequest)
+		return
+	}
+
+	var request llm.EmbeddingRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		core.JSONResponse(w, map[string]interface{}{"status": "error", "message": fmt.Sprintf("invalid request body: %v", err)}, http.StatusBadRequest)
+		return
+	}
+	if request.Model == "" {
+		core.JSONResponse(w, map[string]interface{}{"status": "error", "message": "model is required"}, http.StatusBadRequest)
+		return
+	}
+	audit.FromContext(r.Context()).AddMetadata("model", request.Model)
+
+	response, err := llmGateway.Embed(llmCall(r, metering.Call{}), tenant, request)
+	if err != nil {
+		core.JSONResponse(w, map[string]interface{}{"status": "error", "message": err.Error()}, llmErrorStatus(err))
+		return
+	}
+	core.JSONResponse(w, map[string]interface{}{"status": "success", "response": response}, http.StatusOK)
+}
+
+// LLMModels lists the model aliases and the provider models serving them.
+func LLMModels(w http.ResponseWriter, r *http.Request) {
+	core.JSONResponse(w, map[string]interface{}{
+		"status": "success",
+		"models": llmGateway.Models(),
+		"routes": llm.Default().Routes,
+	}, http.StatusOK)
+}
+
+// LLMUsage returns the tokens the caller's project used by provider and
+// model this month.
+func LLMUsage(w http.ResponseWriter, r *http.Request) {
+	tenant, ok := tenancy.FromContext(r.Context())
+	if !ok {
+		core.JSONResponse(w, map[string]interface{}{"status": "error", "message": "a project is required to read model usage"}, http.StatusBadRequest)
+		return
+	}
+
+	tenant, _ = tenancy.New(tenant.OrganizationID, tenant.ProjectID)
+	now := time.Now().UTC()
+	from := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+	usage, err := llmMeter.Store().Usage(r.Context(), tenant.OrganizationID, tenant.ProjectID, from, now.Add(time.Second))
+	if err != nil {
+		core.JSONResponse(w, map[string]interface{}{"status": "error", "message": err.Error()}, http.StatusInternalServerError)
+		return
+	}
+	core.JSONResponse(w, map[string]interface{}{
+		"status": "success",
+		"period": quota.ResourceLLMTokens.Period(now),
+		"usage":  usage,
+	}, http.StatusOK)
+}
+
+// LLMBudget returns the monthly token budget of the caller's project, how
+// much of it is used and whether it is enforced.
+func LLMBudget(w http.ResponseWriter, r *http.Request) {
+	tenant, ok := tenancy.FromContext(r.Context())
+	if !ok {
+		core.JSONResponse(w, map[string]interface{}{"status": "error", "message": "a project is required to read the token budget"}, http.StatusBadRequest)
+		return
+	}
+
+	tenant, _ = tenancy.New(tenant.OrganizationID, tenant.ProjectID)
+	shown, err := quota.DefaultManager().Show(r.Context(), []quota.Scope{{Type: quota.ScopeProject, ID: tenant.String()}})
+	if err != nil {
+		core.JSONResponse(w, map[string]interface{}{"status": "error", "message": err.Error()}, http.StatusInternalServerError)
+		return
+	}
+	policy, err := llmMeter.Policy(r.Context(), tenant)
+	if err != nil {
+		core.JSONResponse(w, map[string]interface{}{"status": "error", "message": err.Error()}, http.StatusInternalServerError)
+		return
+	}
+
+	budget := map[string]interface{}{"hard_cutoff": policy.HardCutoff}
+	for _, usage := range shown {
+		if usage.Resource == quota.ResourceLLMTokens {
+			budget["period"] = usage.Period
+			budget["used"] = usage.Used
+			budget["limit"] = usage.Limit
+		}
+	}
+	core.JSONResponse(w, map[string]interface{}{"status": "success", "budget": budget}, http.StatusOK)
+}
+
+type llmBudgetRequest struct {
+	OrganizationID string `json:"organization_id" openapi:"required"`
+	ProjectID      string `json:"project_id"`
+	// MonthlyTokens is the budget; 0 is unlimited.
+	MonthlyTokens float64 `json:"monthly_tokens" openapi:"required"`
+	// HardCutoff refuses calls over the budget instead of only warning.
+	HardCutoff bool `json:"hard_cutoff" openapi:"required"`
+}
+
+// SetLLMBudget sets the monthly token budget of a project and how it is
+// enforced.
+func SetLLMBudget(w http.ResponseWriter, r *http.Request) {
+	var request llmBudgetRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		core.JSONResponse(w, map[string]interface{}{"status": "error", "message": fmt.Sprintf("invalid request body: %v", err)}, http.StatusBadRequest)
+		return
+	}
+	tenant, err := tenancy.New(request.OrganizationID, request.ProjectID)
+	if err != nil {
+		core.JSONResponse(w, map[string]interface{}{"status": "error", "message": err.Error()}, http.StatusBadRequest)
+		return
+	}
+	if request.MonthlyTokens < 0 {
+		core.JSONResponse(w, map[string]interface{}{"status": "error", "message": "monthly_tokens must not be negative"}, http.StatusBadRequest)
+		return
+	}
+
+	recorder := audit.FromContext(r.Context())
+	recorder.SetResource("llm_budget", tenant.String())
+	recorder.AddMetadata("monthly_tokens", request.MonthlyTokens)
+	recorder.AddMetadata("hard_cutoff", request.HardCutoff)
+
+	scope := quota.Scope{Type: quota.ScopeProject, ID: tenant.String()}
+	if err := quota.DefaultManager().SetLimit(r.Context(), scope, quota.ResourceLLMTokens, request.MonthlyTokens); err != nil {
+		core.JSONResponse(w, map[string]interface{}{"status": "error", "message": err.Error()}, http.StatusInternalServerError)
+		return
+	}
+	policy := metering.Policy{
+		OrganizationID: tenant.OrganizationID,
+		ProjectID:      tenant.ProjectID,
+		HardCutoff:     request.HardCutoff,
+		UpdatedAt:      time.Now().UTC(),
+	}
+	if err := llmMeter.Policies().Set(r.Context(), policy); err != nil {
+		core.JSONResponse(w, map[string]interface{}{"status": "error", "message": err.Error()}, http.StatusInternalServerError)
+		return
+	}
+
+	core.JSONResponse(w, map[string]interface{}{"status": "success", "policy": policy}, http.StatusOK)
+}
+
+func init() {
+	llmMeter = metering.ConfigureDefault(integrations.GetPostgresStore("default"), metering.Default())
+	llmGateway = llm.ConfigureDefault(integrations.Secrets, llm.Default(), llmMeter)
+	llmGateway.SetGuard(llmMeter)
+
+	registerAPIView("llm_chat", LLMChat, []string{"POST"}, []string{"HasAPIKey"})
+	registerAPIView("llm_embeddings", LLMEmbeddings, []string{"POST"}, []string{"HasAPIKey"})
+	registerAPIView("llm_models", LLMModels, []string{"GET"}, []string{"HasAPIKey"})
+	registerAPIView("llm_usage", LLMUsage, []string{"GET"}, []string{"HasAPIKey"})
+	registerAPIView("llm_budget", LLMBudget, []string{"GET"}, []string{"HasAPIKey"})
+	registerAPIView("set_llm_budget", SetLLMBudget, []string{"PUT"}, []string{"IsAdminUser"})
+}
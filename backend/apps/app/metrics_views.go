@@ -0,0 +1,20 @@
+package app
+
+import (
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/spectrumwebco/agent_runtime/pkg/djangogo/core"
+)
+
+var metricsHandler = promhttp.Handler()
+
+// Metrics serves the Prometheus metrics of the backend, such as
+// kled_redactions_total.
+func Metrics(w http.ResponseWriter, r *http.Request) {
+	metricsHandler.ServeHTTP(w, r)
+}
+
+func init() {
+	registerAPIView("metrics", Metrics, []string{"GET"}, []string{"HasAPIKey"})
+}
@@ -0,0 +1,125 @@
+package middleware
+
+import (
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/spectrumwebco/agent_runtime/backend/core/audit"
+	"github.com/spectrumwebco/agent_runtime/pkg/djangogo/core"
+)
+
+var auditLogger = log.New(log.Writer(), "kled.audit: ", log.LstdFlags)
+
+var auditActions = map[string]string{
+	http.MethodPost:   "create",
+	http.MethodPut:    "update",
+	http.MethodPatch:  "update",
+	http.MethodDelete: "delete",
+}
+
+// AuditMiddleware appends an entry to the audit log for every mutating
+// request. Handlers can enrich the entry through audit.FromContext, for
+// example to record the resource's state before and after the change.
+type AuditMiddleware struct {
+	next    http.Handler
+	store   audit.Store
+	enabled bool
+}
+
+func NewAuditMiddleware(next http.Handler) *AuditMiddleware {
+	enabled, _ := core.GetSetting("AUDIT_LOG_ENABLED", true)
+
+	return &AuditMiddleware{
+		next:    next,
+		store:   audit.DefaultStore(),
+		enabled: enabled.(bool),
+	}
+}
+
+func (m *AuditMiddleware) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	action, mutating := auditActions[r.Method]
+	if !m.enabled || !mutating {
+		m.next.ServeHTTP(w, r)
+		return
+	}
+
+	recorder := &audit.Recorder{}
+	r = r.WithContext(audit.WithRecorder(r.Context(), recorder))
+
+	rw := &responseCapture{ResponseWriter: w}
+	m.next.ServeHTTP(rw, r)
+
+	if rw.statusCode == 0 {
+		rw.statusCode = http.StatusOK
+	}
+
+	resourceType, resourceID := resourceFromPath(r.URL.Path)
+	entry := &audit.Entry{
+		Timestamp:    time.Now(),
+		Action:       action,
+		ResourceType: resourceType,
+		ResourceID:   resourceID,
+		Method:       r.Method,
+		Path:         r.URL.Path,
+		StatusCode:   rw.statusCode,
+		IPAddress:    ClientIP(r),
+		UserAgent:    r.UserAgent(),
+		RequestID:    r.Header.Get("X-Request-ID"),
+		ActorID:      "anonymous",
+	}
+	if user := core.GetUserFromRequest(r); user != nil && user.IsAuthenticated() {
+		entry.ActorID = user.GetID()
+	}
+
+	record, err := recorder.Apply(entry)
+	if err != nil {
+		auditLogger.Printf("Error computing audit diff for %s %s: %v", r.Method, r.URL.Path, err)
+	}
+	if !record {
+		return
+	}
+
+	if err := m.store.Append(r.Context(), entry); err != nil {
+		auditLogger.Printf("Error writing audit entry for %s %s: %v", r.Method, r.URL.Path, err)
+	}
+}
+
+// resourceFromPath derives the resource type and ID from REST style paths such
+// as /api/workspaces/<id>/ or /api/state/shared/<id>/start/.
+func resourceFromPath(path string) (string, string) {
+	segments := []string{}
+	for _, segment := range strings.Split(strings.Trim(path, "/"), "/") {
+		if segment != "" && segment != "api" && !isVersionSegment(segment) {
+			segments = append(segments, segment)
+		}
+	}
+	if len(segments) == 0 {
+		return "", ""
+	}
+
+	for i := 1; i < len(segments); i++ {
+		if looksLikeID(segments[i]) {
+			return strings.Join(segments[:i], "."), segments[i]
+		}
+	}
+	return strings.Join(segments, "."), ""
+}
+
+func isVersionSegment(segment string) bool {
+	return len(segment) >= 2 && segment[0] == 'v' && strings.Trim(segment[1:], "0123456789") == ""
+}
+
+func looksLikeID(segment string) bool {
+	if strings.Trim(segment, "0123456789") == "" {
+		return true
+	}
+	return len(segment) == 36 && strings.Count(segment, "-") == 4
+}
+
+func init() {
+	core.RegisterMiddleware("AuditMiddleware", func(next http.Handler) http.Handler {
+		return NewAuditMiddleware(next)
+	})
+}
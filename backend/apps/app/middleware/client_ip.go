@@ -0,0 +1,92 @@
+package middleware
+
+import (
+	"log"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/spectrumwebco/agent_runtime/pkg/djangogo/core"
+)
+
+var proxyLogger = log.New(log.Writer(), "kled.proxies: ", log.LstdFlags)
+
+var (
+	trustedProxies     []*net.IPNet
+	trustedProxiesOnce sync.Once
+)
+
+// TrustedProxies returns the networks of the TRUSTED_PROXIES setting, a
+// comma-separated list of addresses and CIDRs of the load balancers in front
+// of the backend. Invalid entries are logged and ignored.
+func TrustedProxies() []*net.IPNet {
+	trustedProxiesOnce.Do(func() {
+		setting, _ := core.GetSetting("TRUSTED_PROXIES", "")
+		for _, entry := range strings.Split(setting.(string), ",") {
+			entry = strings.TrimSpace(entry)
+			if entry == "" {
+				continue
+			}
+			if !strings.Contains(entry, "/") {
+				if ip := net.ParseIP(entry); ip != nil && ip.To4() != nil {
+					entry += "/32"
+				} else {
+					entry += "/128"
+				}
+			}
+			_, network, err := net.ParseCIDR(entry)
+			if err != nil {
+				proxyLogger.Printf("Ignoring invalid trusted proxy %q: %v", entry, err)
+				continue
+			}
+			trustedProxies = append(trustedProxies, network)
+		}
+	})
+	return trustedProxies
+}
+
+// ClientIP returns the address of the client of r. X-Forwarded-For is only
+// honored for requests from TrustedProxies, so clients can't pick the
+// address that is audited and rate limited. Proxies append to the header,
+// which makes the rightmost address that isn't a trusted proxy the client;
+// everything left of it may be forged.
+func ClientIP(r *http.Request) string {
+	return clientIPBehind(r, TrustedProxies())
+}
+
+func clientIPBehind(r *http.Request, proxies []*net.IPNet) string {
+	remote := r.RemoteAddr
+	if host, _, err := net.SplitHostPort(remote); err == nil {
+		remote = host
+	}
+	if !trusted(remote, proxies) {
+		return remote
+	}
+
+	hops := strings.Split(r.Header.Get("X-Forwarded-For"), ",")
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := strings.TrimSpace(hops[i])
+		if hop == "" {
+			continue
+		}
+		if !trusted(hop, proxies) {
+			return hop
+		}
+		remote = hop
+	}
+	return remote
+}
+
+func trusted(address string, proxies []*net.IPNet) bool {
+	ip := net.ParseIP(address)
+	if ip == nil {
+		return false
+	}
+	for _, network := range proxies {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
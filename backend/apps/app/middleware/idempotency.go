@@ -0,0 +1,120 @@
+package middleware
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+
+	"github.com/spectrumwebco/agent_runtime/backend/core/idempotency"
+	"github.com/spectrumwebco/agent_runtime/backend/core/jwtauth"
+	"github.com/spectrumwebco/agent_runtime/backend/core/kerrors"
+	"github.com/spectrumwebco/agent_runtime/backend/db/integrations"
+	"github.com/spectrumwebco/agent_runtime/pkg/djangogo/core"
+)
+
+var idempotencyLogger = log.New(log.Writer(), "kled.idempotency: ", log.LstdFlags)
+
+const (
+	idempotencyKeyHeader      = "Idempotency-Key"
+	idempotencyReplayedHeader = "Idempotent-Replayed"
+)
+
+var idempotencyStore = idempotency.NewStore(integrations.GetKVStore(), integrations.GetLocker(), idempotency.Default())
+
+// NewIdempotencyMiddleware replays the response of a mutating request for
+// retries with the same Idempotency-Key header, and rejects duplicates while
+// it runs with 409. It runs before the quota middleware, so retries aren't
+// charged twice. Keys are scoped to the caller, see idempotencyScope;
+// anonymous requests are passed through, as their keys couldn't be told
+// apart.
+func NewIdempotencyMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get(idempotencyKeyHeader)
+		if _, mutating := auditActions[r.Method]; key == "" || !mutating {
+			next.ServeHTTP(w, r)
+			return
+		}
+		scope, ok := idempotencyScope(r)
+		if !ok {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if len(key) > idempotency.Default().MaxKeyLength {
+			kerrors.WriteJSON(w, kerrors.New(kerrors.InvalidArgument, "the idempotency key is too long"))
+			return
+		}
+
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			kerrors.WriteJSON(w, kerrors.Wrap(kerrors.InvalidArgument, err))
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+
+		response, lease, err := idempotencyStore.Begin(scope, key, idempotency.Fingerprint(r.Method, r.URL.Path, body))
+		switch {
+		case errors.Is(err, idempotency.ErrInProgress):
+			kerrors.WriteJSON(w, kerrors.Wrap(kerrors.Conflict, err))
+			return
+		case errors.Is(err, idempotency.ErrKeyReused):
+			kerrors.WriteJSONStatus(w, http.StatusUnprocessableEntity, kerrors.Wrap(kerrors.InvalidArgument, err))
+			return
+		case err != nil:
+			// the KV store being down mustn't take the API with it
+			idempotencyLogger.Printf("Ignoring idempotency key of %s %s: %v", r.Method, r.URL.Path, err)
+			next.ServeHTTP(w, r)
+			return
+		case response != nil:
+			for name, values := range response.Header {
+				w.Header()[name] = values
+			}
+			w.Header().Set(idempotencyReplayedHeader, "true")
+			w.WriteHeader(response.StatusCode)
+			_, _ = w.Write(response.Body)
+			return
+		}
+
+		rw := &responseCapture{ResponseWriter: w}
+		defer func() {
+			if recovered := recover(); recovered != nil {
+				lease.Release()
+				panic(recovered)
+			}
+		}()
+		next.ServeHTTP(rw, r)
+
+		if rw.statusCode == 0 {
+			rw.statusCode = http.StatusOK
+		}
+		header := w.Header().Clone()
+		header.Del("Set-Cookie")
+		if err := lease.Complete(idempotency.Response{StatusCode: rw.statusCode, Header: header, Body: rw.body}); err != nil {
+			idempotencyLogger.Printf("Error storing response of %s %s: %v", r.Method, r.URL.Path, err)
+		}
+	})
+}
+
+// idempotencyScope identifies the caller of a request: the session user, the
+// subject of a Supabase access token or the API key, which is hashed so it
+// isn't stored in the KV store.
+func idempotencyScope(r *http.Request) (string, bool) {
+	if user := core.GetUserFromRequest(r); user != nil && user.IsAuthenticated() {
+		return "user:" + user.GetID(), true
+	}
+	if claims := jwtauth.FromContext(r.Context()); claims != nil && claims.Subject != "" {
+		return "jwt:" + claims.Subject, true
+	}
+	if apiKey := r.Header.Get("X-API-Key"); apiKey != "" {
+		sum := sha256.Sum256([]byte(apiKey))
+		return "apikey:" + hex.EncodeToString(sum[:]), true
+	}
+	return "", false
+}
+
+func init() {
+	core.RegisterMiddleware("IdempotencyMiddleware", NewIdempotencyMiddleware)
+}
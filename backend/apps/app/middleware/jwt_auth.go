@@ -0,0 +1,25 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/spectrumwebco/agent_runtime/backend/core/jwtauth"
+	"github.com/spectrumwebco/agent_runtime/pkg/djangogo/core"
+)
+
+// NewSupabaseJWTMiddleware authenticates end users by the Supabase access
+// token they send as bearer token, so they don't need a Django session. The
+// claims are put into the request context, where the RBAC and tenant
+// middlewares pick them up. It does nothing unless SUPABASE_URL or a JWT
+// secret is configured.
+func NewSupabaseJWTMiddleware(next http.Handler) http.Handler {
+	verifier := jwtauth.DefaultVerifier()
+	if verifier == nil {
+		return next
+	}
+	return verifier.Middleware(next)
+}
+
+func init() {
+	core.RegisterMiddleware("SupabaseJWTMiddleware", NewSupabaseJWTMiddleware)
+}
@@ -0,0 +1,18 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/spectrumwebco/agent_runtime/backend/core/openapi"
+	"github.com/spectrumwebco/agent_runtime/pkg/djangogo/core"
+)
+
+// NewOpenAPIValidationMiddleware rejects requests not matching the OpenAPI
+// document of the API, see core/openapi.
+func NewOpenAPIValidationMiddleware(next http.Handler) http.Handler {
+	return openapi.Default().Validate(openapi.DefaultConfig(), next)
+}
+
+func init() {
+	core.RegisterMiddleware("OpenAPIValidationMiddleware", NewOpenAPIValidationMiddleware)
+}
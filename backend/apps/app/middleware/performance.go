@@ -8,6 +8,7 @@ import (
 	"strings"
 	"time"
 
+	"github.com/spectrumwebco/agent_runtime/backend/core/status"
 	"github.com/spectrumwebco/agent_runtime/pkg/djangogo/core"
 )
 
@@ -56,6 +57,7 @@ func (m *PerformanceMiddleware) ServeHTTP(w http.ResponseWriter, r *http.Request
 
 	rw := &responseCapture{ResponseWriter: w}
 	m.next.ServeHTTP(rw, r)
+	status.DefaultRequests().Record(rw.statusCode)
 
 	durationMs := float64(time.Since(startTime).Milliseconds())
 
@@ -0,0 +1,91 @@
+package middleware
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/spectrumwebco/agent_runtime/backend/core/jwtauth"
+	"github.com/spectrumwebco/agent_runtime/backend/core/kerrors"
+	"github.com/spectrumwebco/agent_runtime/backend/core/quota"
+	"github.com/spectrumwebco/agent_runtime/backend/core/rbac"
+	"github.com/spectrumwebco/agent_runtime/backend/core/tenancy"
+	"github.com/spectrumwebco/agent_runtime/pkg/djangogo/core"
+)
+
+// executionRoutes each charge one interpreter execution. Workspaces are
+// charged by workspace.Controller, whoever changes them.
+var executionRoutes = []rbac.Route{
+	{Method: http.MethodPost, Pattern: "/api/events/forward/"},
+}
+
+// QuotaScopes returns the scopes a request is charged to: the user and, when
+// the request carries a tenant, the user's project.
+func QuotaScopes(ctx context.Context, userID string) []quota.Scope {
+	var scopes []quota.Scope
+	if userID != "" {
+		scopes = append(scopes, quota.Scope{Type: quota.ScopeUser, ID: userID})
+	}
+	if tenant, ok := tenancy.FromContext(ctx); ok {
+		scopes = append(scopes, quota.Scope{Type: quota.ScopeProject, ID: tenant.String()})
+	}
+	return scopes
+}
+
+// QuotaUserID returns the user a request is charged to: the session user or
+// the subject of a Supabase access token.
+func QuotaUserID(r *http.Request) string {
+	if user := core.GetUserFromRequest(r); user != nil && user.IsAuthenticated() {
+		return user.GetID()
+	}
+	if claims := jwtauth.FromContext(r.Context()); claims != nil {
+		return claims.Subject
+	}
+	return ""
+}
+
+func NewQuotaMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		scopes := QuotaScopes(r.Context(), QuotaUserID(r))
+
+		for _, route := range executionRoutes {
+			if _, ok := route.Match(r.Method, r.URL.Path); !ok || len(scopes) == 0 {
+				continue
+			}
+			if err := quota.DefaultManager().Consume(r.Context(), scopes, quota.ResourceExecutionsPerDay, 1); err != nil {
+				WriteQuotaError(w, err)
+				return
+			}
+			break
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// WriteQuotaError responds 429 with the exceeded limit, or 500 when the
+// quota couldn't be checked.
+func WriteQuotaError(w http.ResponseWriter, err error) {
+	w.Header().Set("Content-Type", "application/json")
+
+	var exceeded *quota.ExceededError
+	if !errors.As(err, &exceeded) {
+		logger.Printf("Error checking quota: %v", err)
+		kerrors.WriteJSON(w, kerrors.New(kerrors.Internal, "quota check failed"))
+		return
+	}
+
+	body := kerrors.Body(kerrors.Wrap(kerrors.QuotaExceeded, err))
+	body["error"] = err.Error()
+	body["scope"] = exceeded.Scope
+	body["resource"] = exceeded.Resource
+	body["used"] = exceeded.Used
+	body["limit"] = exceeded.Limit
+	w.WriteHeader(http.StatusTooManyRequests)
+	json.NewEncoder(w).Encode(body)
+}
+
+func init() {
+	core.RegisterMiddleware("QuotaMiddleware", NewQuotaMiddleware)
+}
@@ -0,0 +1,95 @@
+package middleware
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/spectrumwebco/agent_runtime/backend/core/jwtauth"
+	"github.com/spectrumwebco/agent_runtime/backend/core/rbac"
+	"github.com/spectrumwebco/agent_runtime/backend/db/integrations"
+	"github.com/spectrumwebco/agent_runtime/pkg/djangogo/core"
+)
+
+var rbacRoutes = []rbac.Route{
+	{Method: http.MethodPost, Pattern: "/api/workspaces/", Action: rbac.ActionWorkspaceCreate, ResourceType: "workspace"},
+	{Method: http.MethodPost, Pattern: "/api/workspaces/{id}/start/", Action: rbac.ActionWorkspaceStart, ResourceType: "workspace"},
+	{Method: http.MethodPost, Pattern: "/api/workspaces/{id}/stop/", Action: rbac.ActionWorkspaceStop, ResourceType: "workspace"},
+	{Method: http.MethodDelete, Pattern: "/api/workspaces/{id}/", Action: rbac.ActionWorkspaceDelete, ResourceType: "workspace"},
+	// the browser terminal is an interactive shell in the workspace
+	{Method: http.MethodGet, Pattern: "/api/workspaces/{id}/terminal/", Action: rbac.ActionInterpreterExecute, ResourceType: "workspace"},
+	// co-editing participants can open and type into shared sessions
+	{Method: http.MethodGet, Pattern: "/api/workspaces/{id}/coedit/", Action: rbac.ActionInterpreterExecute, ResourceType: "workspace"},
+	{Method: http.MethodGet, Pattern: "/api/workspaces/{id}/diff/", Action: rbac.ActionWorkspaceDiff, ResourceType: "workspace"},
+	{Method: http.MethodPost, Pattern: "/api/workspaces/{id}/snapshots/", Action: rbac.ActionWorkspacePatch, ResourceType: "workspace"},
+	{Method: http.MethodPost, Pattern: "/api/workspaces/{id}/patch/", Action: rbac.ActionWorkspacePatch, ResourceType: "workspace"},
+	{Method: http.MethodPost, Pattern: "/api/workspaces/{id}/publish/", Action: rbac.ActionWorkspacePublish, ResourceType: "workspace"},
+	{Method: http.MethodPut, Pattern: "/api/workspaces/{id}/schedule/", Action: rbac.ActionWorkspaceSchedule, ResourceType: "workspace"},
+	{Method: http.MethodDelete, Pattern: "/api/workspaces/{id}/schedule/", Action: rbac.ActionWorkspaceSchedule, ResourceType: "workspace"},
+	{Method: http.MethodPut, Pattern: "/api/workspaces/{id}/scratchpad/{key}/", Action: rbac.ActionInterpreterExecute, ResourceType: "workspace"},
+	{Method: http.MethodPost, Pattern: "/api/workspaces/{id}/scratchpad/{key}/lock/", Action: rbac.ActionInterpreterExecute, ResourceType: "workspace"},
+	{Method: http.MethodPost, Pattern: "/api/workspaces/{id}/scratchpad/{key}/unlock/", Action: rbac.ActionInterpreterExecute, ResourceType: "workspace"},
+	{Method: http.MethodPost, Pattern: "/api/workspaces/{id}/tasks/enqueue/", Action: rbac.ActionInterpreterExecute, ResourceType: "workspace"},
+	{Method: http.MethodPost, Pattern: "/api/workspaces/{id}/tasks/claim/", Action: rbac.ActionInterpreterExecute, ResourceType: "workspace"},
+	{Method: http.MethodPost, Pattern: "/api/workspaces/{id}/tasks/{task}/ack/", Action: rbac.ActionInterpreterExecute, ResourceType: "workspace"},
+	{Method: http.MethodPost, Pattern: "/api/workspaces/{id}/edits/", Action: rbac.ActionInterpreterExecute, ResourceType: "workspace"},
+	{Method: http.MethodPost, Pattern: "/api/events/forward/", Action: rbac.ActionInterpreterExecute, ResourceType: "interpreter"},
+}
+
+var roleStore = rbac.NewPostgresRoleStore(integrations.GetPostgresStore("default"))
+
+type rbacUser interface {
+	IsAuthenticated() bool
+	IsSuperuser() bool
+	GetID() string
+}
+
+// SubjectFromUser builds the RBAC subject for a djangogo user. Anonymous users
+// yield an empty subject, which the engine always denies.
+func SubjectFromUser(u interface{}) (rbac.Subject, error) {
+	user, ok := u.(rbacUser)
+	if !ok || !user.IsAuthenticated() {
+		return rbac.Subject{}, nil
+	}
+
+	organizationID := ""
+	if orgID, ok := core.GetObjectAttr(user, "organization_id"); ok && orgID != nil {
+		organizationID = fmt.Sprint(orgID)
+	}
+
+	return rbac.SubjectFor(roleStore, user.GetID(), organizationID, user.IsSuperuser())
+}
+
+// SubjectFromClaims builds the RBAC subject for an end user authenticated
+// with a Supabase access token. Their organization comes from the app
+// metadata, which users can't change themselves.
+func SubjectFromClaims(claims *jwtauth.Claims) (rbac.Subject, error) {
+	return rbac.SubjectFor(roleStore, claims.Subject, claims.OrganizationID(), false)
+}
+
+// LookupWorkspace loads a workspace's owner and organization for ownership
+// checks.
+func LookupWorkspace(ctx context.Context, resourceType, resourceID string) (rbac.Resource, error) {
+	return rbac.WorkspaceLookup(integrations.GetPostgresStore("default"))(ctx, resourceType, resourceID)
+}
+
+func NewRBACMiddleware(next http.Handler) http.Handler {
+	return rbac.NewHTTPMiddleware(next, rbac.DefaultEngine(), rbacRoutes, func(r *http.Request) (rbac.Subject, error) {
+		if user := core.GetUserFromRequest(r); user == nil || !user.IsAuthenticated() {
+			if claims := jwtauth.FromContext(r.Context()); claims != nil {
+				return SubjectFromClaims(claims)
+			}
+		}
+		return SubjectFromUser(core.GetUserFromRequest(r))
+	}, LookupWorkspace).Protect("/api/workspaces/")
+}
+
+func init() {
+	if rulesFile, _ := core.GetSetting("RBAC_RULES_FILE", ""); rulesFile.(string) != "" {
+		if err := rbac.DefaultEngine().LoadRulesFile(rulesFile.(string)); err != nil {
+			logger.Printf("Error loading RBAC rules: %v", err)
+		}
+	}
+
+	core.RegisterMiddleware("RBACMiddleware", NewRBACMiddleware)
+}
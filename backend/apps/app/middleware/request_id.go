@@ -0,0 +1,88 @@
+package middleware
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spectrumwebco/agent_runtime/backend/core/events"
+	"github.com/spectrumwebco/agent_runtime/backend/core/tracing"
+	"github.com/spectrumwebco/agent_runtime/pkg/djangogo/core"
+)
+
+// statusWriter remembers the status of a response without buffering it, so
+// streamed responses keep flushing.
+type statusWriter struct {
+	http.ResponseWriter
+	statusCode int
+}
+
+func (w *statusWriter) WriteHeader(code int) {
+	if w.statusCode == 0 {
+		w.statusCode = code
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *statusWriter) Write(b []byte) (int, error) {
+	if w.statusCode == 0 {
+		w.statusCode = http.StatusOK
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *statusWriter) Flush() {
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// NewRequestIDMiddleware gives every request a correlation ID: the
+// X-Request-ID of the client if it is valid, or a new one. The ID is set on
+// the request for the middleware after it, returned in the response and
+// carried by the request context into published events, agent commands and
+// runs. API requests are recorded in the timeline of their ID.
+func NewRequestIDMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(tracing.Header)
+		if !tracing.ValidID(id) {
+			id = tracing.NewID()
+			r.Header.Set(tracing.Header, id)
+		}
+		w.Header().Set(tracing.Header, id)
+		r = r.WithContext(events.WithCorrelationID(r.Context(), id))
+
+		// reading a trace shouldn't add to it
+		if !strings.HasPrefix(r.URL.Path, "/api/") || strings.HasPrefix(r.URL.Path, "/api/traces/") {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		start := time.Now()
+		sw := &statusWriter{ResponseWriter: w}
+		next.ServeHTTP(sw, r)
+		if sw.statusCode == 0 {
+			sw.statusCode = http.StatusOK
+		}
+
+		entry := tracing.Entry{
+			Time:       start.UTC(),
+			Source:     tracing.SourceAPI,
+			Name:       r.Method + " " + r.URL.Path,
+			DurationMs: time.Since(start).Milliseconds(),
+			Attributes: map[string]string{"status_code": strconv.Itoa(sw.statusCode)},
+		}
+		if user := core.GetUserFromRequest(r); user != nil && user.IsAuthenticated() {
+			entry.Attributes["user_id"] = user.GetID()
+		}
+		if sw.statusCode >= http.StatusBadRequest {
+			entry.Error = http.StatusText(sw.statusCode)
+		}
+		tracing.Record(r.Context(), entry)
+	})
+}
+
+func init() {
+	core.RegisterMiddleware("RequestIDMiddleware", NewRequestIDMiddleware)
+}
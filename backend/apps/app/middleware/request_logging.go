@@ -140,12 +140,7 @@ func (m *RequestLoggingMiddleware) getResponseData(rw *responseCapture) map[stri
 }
 
 func (m *RequestLoggingMiddleware) getClientIP(r *http.Request) string {
-	xForwardedFor := r.Header.Get("X-Forwarded-For")
-	if xForwardedFor != "" {
-		parts := strings.Split(xForwardedFor, ",")
-		return strings.TrimSpace(parts[0])
-	}
-	return r.RemoteAddr
+	return ClientIP(r)
 }
 
 func (m *RequestLoggingMiddleware) truncateData(data map[string]interface{}) map[string]interface{} {
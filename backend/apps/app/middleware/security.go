@@ -8,6 +8,7 @@ import (
 	"strings"
 	"time"
 
+	"github.com/spectrumwebco/agent_runtime/backend/core/kerrors"
 	"github.com/spectrumwebco/agent_runtime/pkg/djangogo/core"
 )
 
@@ -47,9 +48,7 @@ func (m *SecurityMiddleware) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 
 	if m.enableRateLimiting {
 		if exceeded, status, message := m.checkRateLimit(r); exceeded {
-			w.Header().Set("Content-Type", "application/json")
-			w.WriteHeader(status)
-			w.Write([]byte(`{"error": "` + message + `"}`))
+			kerrors.WriteJSONStatus(w, status, kerrors.New(kerrors.RateLimited, message))
 			return
 		}
 	}
@@ -117,14 +116,7 @@ func (m *SecurityMiddleware) getClientIdentifier(r *http.Request) string {
 		return "user:" + user.GetID()
 	}
 
-	ip := r.Header.Get("X-Forwarded-For")
-	if ip != "" {
-		parts := strings.Split(ip, ",")
-		ip = strings.TrimSpace(parts[0])
-	} else {
-		ip = r.RemoteAddr
-	}
-
+	ip := ClientIP(r)
 	userAgent := r.UserAgent()
 	identifier := ip + ":" + userAgent
 
@@ -0,0 +1,74 @@
+package middleware
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/spectrumwebco/agent_runtime/backend/core/jwtauth"
+	"github.com/spectrumwebco/agent_runtime/backend/core/kerrors"
+	"github.com/spectrumwebco/agent_runtime/backend/core/tenancy"
+	"github.com/spectrumwebco/agent_runtime/backend/db/integrations"
+	"github.com/spectrumwebco/agent_runtime/pkg/djangogo/core"
+)
+
+var tenantResolver = tenancy.NewResolver(integrations.GetPostgresStore("default"))
+
+// TenantMiddleware attaches the caller's tenant to the request context. The
+// organization comes from the authenticated user, their Supabase access
+// token or API key; the project from the X-Kled-Project header. Requests naming a project outside the
+// caller's organization are rejected. Unauthenticated requests carry no
+// tenant, so tenant-scoped stores refuse them.
+func NewTenantMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		project := r.Header.Get(tenancy.ProjectHeader)
+
+		var (
+			tenant tenancy.Tenant
+			err    error
+			found  bool
+		)
+		if user := core.GetUserFromRequest(r); user != nil && user.IsAuthenticated() {
+			tenant, err = tenantResolver.ForUser(user.GetID(), project)
+			found = true
+		} else if claims := jwtauth.FromContext(r.Context()); claims != nil {
+			tenant, err = tenantForClaims(claims, project)
+			found = true
+		} else if apiKey := r.Header.Get("X-API-Key"); apiKey != "" {
+			tenant, err = tenantResolver.ForAPIKey(apiKey, project)
+			found = true
+		}
+
+		if found && err != nil {
+			code := kerrors.NotAuthenticated
+			if errors.Is(err, tenancy.ErrCrossTenant) {
+				code = kerrors.PermissionDenied
+			}
+			kerrors.WriteJSON(w, kerrors.Wrap(code, err))
+			return
+		}
+
+		if found {
+			r = r.WithContext(tenancy.WithTenant(r.Context(), tenant))
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// tenantForClaims resolves the tenant of an end user authenticated with a
+// Supabase access token by the organization of its app metadata.
+func tenantForClaims(claims *jwtauth.Claims, project string) (tenancy.Tenant, error) {
+	organizationID := claims.OrganizationID()
+	if organizationID == "" {
+		return tenancy.Tenant{}, fmt.Errorf("user %s has no organization", claims.Subject)
+	}
+	return tenantResolver.ForOrganization(organizationID, project)
+}
+
+func init() {
+	if err := tenantResolver.EnsureSchema(); err != nil {
+		logger.Printf("Error preparing projects: %v", err)
+	}
+
+	core.RegisterMiddleware("TenantMiddleware", NewTenantMiddleware)
+}
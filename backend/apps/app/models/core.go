@@ -53,15 +53,36 @@ func (o Organization) String() string {
 	return o.Name
 }
 
+type Project struct {
+	ID             uuid.UUID `json:"id" gorm:"primaryKey;type:uuid;default:uuid_generate_v4()"`
+	Name           string    `json:"name" gorm:"size:255;not null"`
+	Slug           string    `json:"slug" gorm:"not null;uniqueIndex:idx_project_org_slug"`
+	OrganizationID uuid.UUID `json:"organization_id" gorm:"type:uuid;not null;uniqueIndex:idx_project_org_slug"`
+	CreatedAt      time.Time `json:"created_at" gorm:"autoCreateTime"`
+	UpdatedAt      time.Time `json:"updated_at" gorm:"autoUpdateTime"`
+}
+
+func (Project) TableName() string {
+	return "app_project"
+}
+
+func (p Project) String() string {
+	return p.Name
+}
+
 type Workspace struct {
 	ID             uuid.UUID  `json:"id" gorm:"primaryKey;type:uuid;default:uuid_generate_v4()"`
 	Name           string     `json:"name" gorm:"size:255;not null"`
 	Slug           string     `json:"slug" gorm:"not null"`
 	Description    string     `json:"description" gorm:"type:text"`
 	OrganizationID uuid.UUID  `json:"organization_id" gorm:"type:uuid;not null"`
+	ProjectID      *uuid.UUID `json:"project_id" gorm:"type:uuid"`
 	CreatedByID    *uuid.UUID `json:"created_by_id" gorm:"type:uuid"`
-	CreatedAt      time.Time  `json:"created_at" gorm:"autoCreateTime"`
-	UpdatedAt      time.Time  `json:"updated_at" gorm:"autoUpdateTime"`
+	// DesiredState is running or stopped for workspaces the reconciler
+	// manages.
+	DesiredState *string   `json:"desired_state" gorm:"size:32"`
+	CreatedAt    time.Time `json:"created_at" gorm:"autoCreateTime"`
+	UpdatedAt    time.Time `json:"updated_at" gorm:"autoUpdateTime"`
 }
 
 func (Workspace) TableName() string {
@@ -125,6 +146,7 @@ var Users = &UserManager{}
 func init() {
 	db.RegisterModel("User", User{})
 	db.RegisterModel("Organization", Organization{})
+	db.RegisterModel("Project", Project{})
 	db.RegisterModel("Workspace", Workspace{})
 	db.RegisterModel("ApiKey", ApiKey{})
 	
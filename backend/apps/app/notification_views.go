@@ -0,0 +1,166 @@
+package app
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/spectrumwebco/agent_runtime/backend/core/audit"
+	"github.com/spectrumwebco/agent_runtime/backend/core/notify"
+	"github.com/spectrumwebco/agent_runtime/backend/core/tenancy"
+	"github.com/spectrumwebco/agent_runtime/backend/db/integrations"
+	"github.com/spectrumwebco/agent_runtime/pkg/djangogo/core"
+)
+
+var notifier *notify.Notifier
+
+type createNotificationChannelRequest struct {
+	Type       string            `json:"type" openapi:"required"`
+	WebhookURL string            `json:"webhook_url" openapi:"required"`
+	Name       string            `json:"name"`
+	Kinds      []string          `json:"kinds"`
+	Templates  map[string]string `json:"templates"`
+	// AllProjects makes the channel receive the notifications of every
+	// project of the organization instead of the caller's project.
+	AllProjects bool `json:"all_projects"`
+}
+
+// CreateNotificationChannel adds a Slack or Teams channel to the caller's
+// project, or to their whole organization with all_projects.
+func CreateNotificationChannel(w http.ResponseWriter, r *http.Request) {
+	tenant, ok := tenancy.FromContext(r.Context())
+	if !ok {
+		core.JSONResponse(w, map[string]interface{}{"status": "error", "message": "an organization is required to create notification channels"}, http.StatusBadRequest)
+		return
+	}
+
+	var request createNotificationChannelRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		core.JSONResponse(w, map[string]interface{}{"status": "error", "message": fmt.Sprintf("invalid request body: %v", err)}, http.StatusBadRequest)
+		return
+	}
+
+	channelType, err := notify.ParseChannelType(request.Type)
+	if err != nil {
+		core.JSONResponse(w, map[string]interface{}{"status": "error", "message": err.Error()}, http.StatusBadRequest)
+		return
+	}
+	kinds := make([]notify.Kind, 0, len(request.Kinds))
+	for _, value := range request.Kinds {
+		kind, err := notify.ParseKind(value)
+		if err != nil {
+			core.JSONResponse(w, map[string]interface{}{"status": "error", "message": err.Error()}, http.StatusBadRequest)
+			return
+		}
+		kinds = append(kinds, kind)
+	}
+	templates := make(map[notify.Kind]string, len(request.Templates))
+	for kind, text := range request.Templates {
+		templates[notify.Kind(kind)] = text
+	}
+	projectID := tenant.ProjectID
+	if request.AllProjects {
+		projectID = ""
+	}
+
+	channel, err := notify.NewChannel(tenant.OrganizationID, projectID, channelType, request.WebhookURL, kinds, templates, time.Now())
+	if err != nil {
+		core.JSONResponse(w, map[string]interface{}{"status": "error", "message": err.Error()}, http.StatusBadRequest)
+		return
+	}
+	channel.Name = request.Name
+	if err := notifier.Store().Create(r.Context(), channel); err != nil {
+		core.JSONResponse(w, map[string]interface{}{"status": "error", "message": err.Error()}, http.StatusInternalServerError)
+		return
+	}
+
+	recorder := audit.FromContext(r.Context())
+	recorder.SetResource("notification_channel", channel.ID)
+	recorder.AddMetadata("type", channel.Type)
+	recorder.AddMetadata("project_id", channel.ProjectID)
+	recorder.AddMetadata("kinds", channel.Kinds)
+
+	core.JSONResponse(w, map[string]interface{}{"status": "success", "channel": channel}, http.StatusCreated)
+}
+
+// ListNotificationChannels returns the channels of the caller's
+// organization.
+func ListNotificationChannels(w http.ResponseWriter, r *http.Request) {
+	tenant, ok := tenancy.FromContext(r.Context())
+	if !ok {
+		core.JSONResponse(w, map[string]interface{}{"status": "error", "message": "an organization is required to list notification channels"}, http.StatusBadRequest)
+		return
+	}
+
+	channels, err := notifier.Store().List(r.Context(), tenant.OrganizationID)
+	if err != nil {
+		core.JSONResponse(w, map[string]interface{}{"status": "error", "message": err.Error()}, http.StatusInternalServerError)
+		return
+	}
+
+	core.JSONResponse(w, map[string]interface{}{"status": "success", "channels": channels}, http.StatusOK)
+}
+
+// loadNotificationChannel returns a channel of the caller's organization.
+func loadNotificationChannel(r *http.Request, channelID string) (*notify.Channel, error) {
+	tenant, ok := tenancy.FromContext(r.Context())
+	channel, err := notifier.Store().Get(r.Context(), channelID)
+	if err == nil && (!ok || channel.OrganizationID != tenant.OrganizationID) {
+		err = notify.ErrNotFound
+	}
+	return channel, err
+}
+
+func DeleteNotificationChannel(w http.ResponseWriter, r *http.Request) {
+	channelID := mux.Vars(r)["channel_id"]
+	audit.FromContext(r.Context()).SetResource("notification_channel", channelID)
+
+	_, err := loadNotificationChannel(r, channelID)
+	if err == nil {
+		err = notifier.Store().Delete(r.Context(), channelID)
+	}
+	if errors.Is(err, notify.ErrNotFound) {
+		core.JSONResponse(w, map[string]interface{}{"status": "error", "message": err.Error()}, http.StatusNotFound)
+		return
+	} else if err != nil {
+		core.JSONResponse(w, map[string]interface{}{"status": "error", "message": err.Error()}, http.StatusInternalServerError)
+		return
+	}
+
+	core.JSONResponse(w, map[string]interface{}{"status": "success"}, http.StatusOK)
+}
+
+// TestNotificationChannel posts a sample of the first kind the channel
+// receives, ignoring the rate limits, so its URL and templates can be
+// checked.
+func TestNotificationChannel(w http.ResponseWriter, r *http.Request) {
+	channelID := mux.Vars(r)["channel_id"]
+	channel, err := loadNotificationChannel(r, channelID)
+	if errors.Is(err, notify.ErrNotFound) {
+		core.JSONResponse(w, map[string]interface{}{"status": "error", "message": err.Error()}, http.StatusNotFound)
+		return
+	} else if err != nil {
+		core.JSONResponse(w, map[string]interface{}{"status": "error", "message": err.Error()}, http.StatusInternalServerError)
+		return
+	}
+
+	sample := notify.Sample(channel.Kinds[0], channel.OrganizationID, channel.ProjectID, time.Now())
+	if err := notifier.Send(r.Context(), channel, sample); err != nil {
+		core.JSONResponse(w, map[string]interface{}{"status": "error", "message": err.Error()}, http.StatusBadGateway)
+		return
+	}
+
+	core.JSONResponse(w, map[string]interface{}{"status": "success", "notification": sample}, http.StatusOK)
+}
+
+func init() {
+	notifier = notify.ConfigureDefault(integrations.GetPostgresStore("default"), notify.Default())
+
+	registerAPIView("create_notification_channel", CreateNotificationChannel, []string{"POST"}, []string{"HasAPIKey"})
+	registerAPIView("list_notification_channels", ListNotificationChannels, []string{"GET"}, []string{"HasAPIKey"})
+	registerAPIView("delete_notification_channel", DeleteNotificationChannel, []string{"DELETE"}, []string{"HasAPIKey"})
+	registerAPIView("test_notification_channel", TestNotificationChannel, []string{"POST"}, []string{"HasAPIKey"})
+}
@@ -0,0 +1,428 @@
+package app
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"os"
+
+	"github.com/spectrumwebco/agent_runtime/backend/core/chaos"
+	"github.com/spectrumwebco/agent_runtime/backend/core/coordination"
+	"github.com/spectrumwebco/agent_runtime/backend/core/fsdiff"
+	"github.com/spectrumwebco/agent_runtime/backend/core/gpu"
+	"github.com/spectrumwebco/agent_runtime/backend/core/heartbeat"
+	"github.com/spectrumwebco/agent_runtime/backend/core/llm"
+	"github.com/spectrumwebco/agent_runtime/backend/core/openapi"
+	"github.com/spectrumwebco/agent_runtime/backend/core/publish"
+	"github.com/spectrumwebco/agent_runtime/backend/core/runs"
+	"github.com/spectrumwebco/agent_runtime/backend/core/toolpolicy"
+	"github.com/spectrumwebco/agent_runtime/backend/db/integrations"
+	"github.com/spectrumwebco/agent_runtime/pkg/djangogo/api"
+	"github.com/spectrumwebco/agent_runtime/pkg/djangogo/core"
+)
+
+var openapiLogger = log.New(os.Stdout, "kled.app.openapi: ", log.LstdFlags)
+
+// urlPrefix is where core/urls mounts the patterns of this app.
+const urlPrefix = "/api/"
+
+// APIInfo describes the API in the OpenAPI document.
+var APIInfo = openapi.Info{
+	Title:       "Agent Runtime API",
+	Description: "HTTP API of the agent runtime backend.",
+	Version:     "1.0.0",
+}
+
+// registerAPIView registers a view and records it for the OpenAPI document.
+func registerAPIView(name string, view func(http.ResponseWriter, *http.Request), methods, permissions []string) {
+	core.RegisterAPIView(name, view, methods, permissions)
+	openapi.Default().View(name, methods, permissions)
+}
+
+// registerURLPatterns registers the URL patterns of the app and records the
+// routes for the OpenAPI document.
+func registerURLPatterns(patterns []api.URLPattern) {
+	api.RegisterURLPatterns(patterns)
+	for _, pattern := range patterns {
+		if pattern.View == "" {
+			continue
+		}
+		if err := openapi.Default().Route(urlPrefix, pattern.Path, pattern.View); err != nil {
+			openapiLogger.Printf("Error documenting %s: %v", pattern.Path, err)
+		}
+	}
+}
+
+// OpenAPIDocument serves the OpenAPI document of the API.
+func OpenAPIDocument(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	encoder.Encode(openapi.Default().Document(APIInfo))
+}
+
+type heartbeatsResponse struct {
+	Status     string             `json:"status"`
+	Heartbeats []heartbeat.Status `json:"heartbeats"`
+	Interval   float64            `json:"interval"`
+}
+
+type taskResponse struct {
+	Status  string `json:"status"`
+	TaskID  string `json:"task_id"`
+	Message string `json:"message"`
+}
+
+func init() {
+	registerAPIView("openapi_document", OpenAPIDocument, []string{"GET"}, []string{"AllowAny"})
+
+	describe := openapi.Default().Describe
+	describe("openapi_document", openapi.Description{Summary: "OpenAPI document of the API"})
+
+	describe("execute_agent_task", openapi.Description{
+		Summary:  "Submit a task to the agent",
+		Response: taskResponse{},
+		Status:   http.StatusAccepted,
+	})
+
+	describe("show_quota", openapi.Description{Summary: "Usage and limits of the caller"})
+	describe("set_quota_limit", openapi.Description{
+		Summary: "Override a quota limit of a user or project",
+		Request: quotaRequest{},
+	})
+	describe("report_quota_usage", openapi.Description{
+		Summary: "Record accrued usage of a user or project",
+		Request: quotaRequest{},
+	})
+
+	describe("workspace_create", openapi.Description{
+		Summary:     "Create a stopped workspace in the caller's project",
+		Description: "Responds 429 when the storage_gb quota of the caller or the project is used up.",
+		Request:     createWorkspaceRequest{},
+		Status:      http.StatusCreated,
+	})
+	describe("workspace_start", openapi.Description{
+		Summary:     "Start a workspace; responds once it runs",
+		Description: "Responds 429 when the owner or the project of the workspace runs as many workspaces as their quota allows.",
+	})
+	describe("workspace_stop", openapi.Description{Summary: "Stop a workspace; responds once it stopped and keeps its volume"})
+	describe("workspace_delete", openapi.Description{Summary: "Delete a workspace with its volume"})
+	describe("list_workspace_heartbeats", openapi.Description{
+		Summary: "Liveness of workspace agents",
+		Query: []*openapi.Parameter{{
+			Name:        "workspace_id",
+			In:          "query",
+			Description: "Restricts the result to the workspace; may be repeated.",
+			Schema:      &openapi.Schema{Type: "string"},
+		}},
+		Response: heartbeatsResponse{},
+	})
+
+	describe("autoscaling_signals", openapi.Description{Summary: "Latest values of the load signals replicas are scaled by"})
+	describe("autoscaling_advice", openapi.Description{
+		Summary:  "Replica counts suggested by the peak load of the recent window",
+		Response: autoscalingAdviceResponse{},
+	})
+
+	describe("report_gpu_samples", openapi.Description{
+		Summary: "Report GPU utilisation samples of a workspace",
+		Request: gpu.SampleReport{},
+	})
+	describe("gpu_policy", openapi.Description{
+		Summary: "Read, replace or remove the idle GPU policy of a project",
+		Query: []*openapi.Parameter{{
+			Name:        "project",
+			In:          "query",
+			Description: "The project as <organization>/<project>.",
+			Required:    true,
+			Schema:      &openapi.Schema{Type: "string"},
+		}},
+		Request: gpu.Policy{},
+	})
+
+	describe("tool_policy", openapi.Description{
+		Summary: "Read, replace or remove the policy for commands agents run in the caller's organization's workspaces",
+		Request: toolpolicy.Policy{},
+	})
+
+	describe("chaos_faults", openapi.Description{
+		Summary: "List, add or replace, or remove all faults injected into integration clients; only available with AGENT_CHAOS_ENABLED",
+		Request: chaos.Fault{},
+	})
+	describe("delete_chaos_fault", openapi.Description{Summary: "Remove an injected fault"})
+
+	describe("create_tunnel", openapi.Description{
+		Summary: "Create a public link to a workspace port",
+		Request: createTunnelRequest{},
+	})
+	describe("list_tunnels", openapi.Description{Summary: "Tunnels of the caller's project"})
+	describe("revoke_tunnel", openapi.Description{Summary: "Revoke a tunnel"})
+	describe("tunnel_proxy", openapi.Description{Summary: "Proxy a request to a tunnelled port"})
+
+	describe("create_webhook", openapi.Description{
+		Summary: "Register a webhook for the caller's organization",
+		Request: createWebhookRequest{},
+		Status:  http.StatusCreated,
+	})
+	describe("list_webhooks", openapi.Description{Summary: "Webhooks of the caller's organization"})
+	describe("delete_webhook", openapi.Description{Summary: "Delete a webhook and its delivery log"})
+	describe("list_webhook_deliveries", openapi.Description{
+		Summary: "Delivery log of the caller's webhooks, newest first",
+		Query: []*openapi.Parameter{
+			{Name: "webhook_id", In: "query", Description: "Restricts the log to one webhook.", Schema: &openapi.Schema{Type: "string"}},
+			{Name: "status", In: "query", Description: "Restricts the log to pending, succeeded or dead deliveries.", Schema: &openapi.Schema{Type: "string", Enum: []interface{}{"pending", "succeeded", "dead"}}},
+			{Name: "limit", In: "query", Schema: &openapi.Schema{Type: "integer"}},
+		},
+	})
+	describe("redeliver_webhook", openapi.Description{Summary: "Queue a webhook delivery again"})
+	describe("github_webhook", openapi.Description{
+		Summary: "Deliveries of the GitHub App, signed with X-Hub-Signature-256; pull requests and labelled issues get a workspace, deleted again when they close",
+		Status:  http.StatusAccepted,
+	})
+
+	describe("create_notification_channel", openapi.Description{
+		Summary: "Add a Slack or Teams channel to the caller's project or organization",
+		Request: createNotificationChannelRequest{},
+		Status:  http.StatusCreated,
+	})
+	describe("list_notification_channels", openapi.Description{Summary: "Notification channels of the caller's organization"})
+	describe("delete_notification_channel", openapi.Description{Summary: "Delete a notification channel"})
+	describe("test_notification_channel", openapi.Description{Summary: "Post a sample notification to a channel"})
+	describe("email_preferences", openapi.Description{
+		Summary: "Whether the caller receives notification emails and the daily digest",
+		Request: emailPreferencesRequest{},
+	})
+
+	describe("create_session", openapi.Description{
+		Summary: "Sign the caller in on a device; returns a refresh token, shown once, and an access token",
+		Request: createSessionRequest{},
+		Status:  http.StatusCreated,
+	})
+	describe("refresh_session", openapi.Description{
+		Summary: "Exchange a refresh token for a new one and an access token; reusing a token revokes its session",
+		Request: refreshSessionRequest{},
+	})
+	describe("list_sessions", openapi.Description{Summary: "Active sessions of the caller with their devices"})
+	describe("revoke_session", openapi.Description{Summary: "Sign the caller out of a session"})
+	describe("revoke_other_sessions", openapi.Description{Summary: "Sign the caller out of every session but the current one"})
+
+	describe("materialized_views", openapi.Description{
+		Summary: "Materialized views of the analytics database with their state, or create one",
+		Request: integrations.DorisMaterializedView{},
+		Status:  http.StatusCreated,
+	})
+	describe("materialized_view", openapi.Description{
+		Summary: "State and last refresh of a materialized view; change its refresh or properties, or drop it",
+		Request: integrations.DorisViewChange{},
+	})
+	describe("refresh_materialized_view", openapi.Description{
+		Summary: "Refresh the stale or given partitions of a materialized view, or rebuild it",
+		Request: refreshMaterializedViewRequest{},
+		Status:  http.StatusAccepted,
+	})
+	describe("table_rollups", openapi.Description{
+		Summary: "Rollups of an analytics table with their build jobs, or add one",
+		Request: integrations.DorisRollup{},
+		Status:  http.StatusAccepted,
+	})
+	describe("drop_table_rollup", openapi.Description{Summary: "Drop a rollup of an analytics table"})
+	describe("route_doris_query", openapi.Description{
+		Summary: "The materialized view or rollup best serving a query over a table and columns",
+		Request: routeDorisQueryRequest{},
+	})
+	describe("list_routine_loads", openapi.Description{Summary: "Routine loads of the analytics database with their state, loaded rows and Kafka lag"})
+	describe("ensure_routine_loads", openapi.Description{Summary: "Create the routine loads of the workspace event and trajectory topics that don't exist or were stopped"})
+	describe("get_routine_load", openapi.Description{Summary: "State, progress and error logs of a routine load"})
+	describe("pause_routine_load", openapi.Description{Summary: "Pause a routine load, keeping its offsets"})
+	describe("resume_routine_load", openapi.Description{Summary: "Resume a paused routine load where it stopped"})
+
+	describe("llm_chat", openapi.Description{
+		Summary: "Complete a conversation with a model, as Server-Sent Events if stream is set",
+		Request: llmChatRequest{},
+	})
+	describe("llm_embeddings", openapi.Description{
+		Summary: "Embed texts with a model",
+		Request: llm.EmbeddingRequest{},
+	})
+	describe("llm_models", openapi.Description{Summary: "Model aliases and the provider models serving them"})
+	describe("llm_usage", openapi.Description{Summary: "Tokens used by the caller's project this month"})
+	describe("llm_budget", openapi.Description{Summary: "Monthly token budget of the caller's project"})
+	describe("set_llm_budget", openapi.Description{
+		Summary: "Set the monthly token budget of a project and whether it cuts off calls",
+		Request: llmBudgetRequest{},
+	})
+	describe("ingest_documents", openapi.Description{
+		Summary: "Embed documents and add them to a vector index of the caller's project",
+		Request: ingestDocumentsRequest{},
+	})
+	describe("search_documents", openapi.Description{
+		Summary: "Search a vector index of the caller's project, reranking the nearest documents",
+		Request: searchDocumentsRequest{},
+	})
+
+	describe("create_experiment", openapi.Description{
+		Summary: "Start an experiment comparing agent configurations in the caller's project",
+		Request: createExperimentRequest{},
+		Status:  http.StatusCreated,
+	})
+	describe("list_experiments", openapi.Description{Summary: "Experiments of the caller's project, newest first"})
+	describe("stop_experiment", openapi.Description{Summary: "Stop an experiment, assigning the control from then on"})
+	describe("assign_experiment", openapi.Description{
+		Summary: "Variant of a subject, logging the exposure of its trajectory",
+		Request: assignExperimentRequest{},
+	})
+	describe("experiment_report", openapi.Description{Summary: "Success rate of each variant compared with the control"})
+
+	describe("list_prompts", openapi.Description{Summary: "Latest version of every prompt template"})
+	describe("create_prompt", openapi.Description{
+		Summary: "Save the next version of a prompt template",
+		Request: createPromptRequest{},
+		Status:  http.StatusCreated,
+	})
+	describe("render_prompt", openapi.Description{
+		Summary: "Render a prompt version or tag, rejecting missing and unknown variables",
+		Request: renderPromptRequest{},
+	})
+	describe("prompt_versions", openapi.Description{Summary: "Versions of a prompt, newest first, and its rollout tags"})
+	describe("tag_prompt", openapi.Description{
+		Summary: "Point a rollout tag of a prompt at a version",
+		Request: tagPromptRequest{},
+	})
+
+	describe("list_runs", openapi.Description{Summary: "Agent runs of the caller's project, newest first, filtered by ?state="})
+	describe("start_run", openapi.Description{
+		Summary: "Start an agent run",
+		Request: runs.Spec{},
+		Status:  http.StatusCreated,
+	})
+	describe("get_run", openapi.Description{Summary: "State and checkpoint of an agent run"})
+	describe("pause_run", openapi.Description{Summary: "Pause a running agent run, keeping its checkpoint"})
+	describe("resume_run", openapi.Description{Summary: "Resume a paused agent run from its last checkpoint"})
+	describe("cancel_run", openapi.Description{
+		Summary: "Cancel an agent run, stopping its interpreter task and signalling its workspace",
+		Request: cancelRunRequest{},
+	})
+	describe("save_run_checkpoint", openapi.Description{
+		Summary: "Save the progress of an agent run; the returned state tells the runtime whether to go on",
+		Request: runCheckpointRequest{},
+	})
+	describe("finish_run", openapi.Description{
+		Summary: "Record the outcome of an agent run",
+		Request: finishRunRequest{},
+	})
+	describe("run_artifacts", openapi.Description{
+		Summary: "Artifacts of an agent run with signed download URLs, or register the request body as one; 413 if it is too large",
+		Query: []*openapi.Parameter{{
+			Name:        "name",
+			In:          "query",
+			Description: "File name of a new artifact.",
+			Schema:      &openapi.Schema{Type: "string"},
+		}, {
+			Name:        "metadata",
+			In:          "query",
+			Description: "key=value metadata of a new artifact, repeated for each key.",
+			Schema:      &openapi.Schema{Type: "string"},
+		}, {
+			Name:        "retention_days",
+			In:          "query",
+			Description: "Days to keep a new artifact, if shorter than the retention of the organization.",
+			Schema:      &openapi.Schema{Type: "integer"},
+		}},
+	})
+	describe("download_artifact", openapi.Description{
+		Summary: "Content of an artifact, for the expires and signature query parameters of its download URL; 403 once they expired",
+	})
+
+	describe("scratchpad_entries", openapi.Description{Summary: "Shared scratchpad of the agents of a workspace"})
+	describe("set_scratchpad_entry", openapi.Description{
+		Summary: "Write a scratchpad entry; the caller must hold its lock",
+		Request: setEntryRequest{},
+	})
+	describe("lock_scratchpad_entry", openapi.Description{
+		Summary: "Lock a scratchpad entry for an agent; 409 names the agent holding it",
+		Request: lockEntryRequest{},
+	})
+	describe("unlock_scratchpad_entry", openapi.Description{
+		Summary: "Release the lock of a scratchpad entry",
+		Request: unlockEntryRequest{},
+	})
+	describe("claimed_tasks", openapi.Description{Summary: "Tasks of a workspace claimed by an agent and not acknowledged yet"})
+	describe("enqueue_task", openapi.Description{
+		Summary: "Queue a task for the agents of a workspace",
+		Request: enqueueTaskRequest{},
+		Status:  http.StatusCreated,
+	})
+	describe("claim_task", openapi.Description{
+		Summary: "Claim the next task of a workspace; tasks not acknowledged within the visibility timeout are handed out again",
+		Request: claimTaskRequest{},
+	})
+	describe("ack_task", openapi.Description{Summary: "Mark a claimed task as done"})
+	describe("workspace_edits", openapi.Description{
+		Summary: "Recorded file versions of a workspace, or record an edit; 409 if the file changed since the edit's base",
+		Request: coordination.Edit{},
+	})
+	describe("workspace_diff", openapi.Description{
+		Summary: "Diff of a workspace's working tree, untracked files included, against a git revision (base) or a snapshot; format is unified or changes, both if empty",
+	})
+	describe("create_workspace_snapshot", openapi.Description{
+		Summary: "Record the working tree of a workspace as a snapshot to diff against later",
+		Request: snapshotRequest{},
+		Status:  http.StatusCreated,
+	})
+	describe("apply_workspace_patch", openapi.Description{
+		Summary: "Apply a reviewed patch to the working tree of a workspace, or only check it with check; 409 if it doesn't apply",
+		Request: fsdiff.PatchRequest{},
+	})
+	describe("publish_workspace", openapi.Description{
+		Summary: "Commit the changes of a workspace to a branch, push it with the forwarded token and open a GitHub pull request or GitLab merge request; 200 if one was already open",
+		Request: publish.Request{},
+		Status:  http.StatusCreated,
+	})
+	describe("command_output", openapi.Description{
+		Summary: "A stream of the output of an agent command that streamed it, as plain text; supports range requests",
+		Query: []*openapi.Parameter{{
+			Name:        "stream",
+			In:          "query",
+			Description: "stdout or stderr, stdout by default.",
+			Schema:      &openapi.Schema{Type: "string"},
+		}},
+	})
+
+	describe("list_audit_log", openapi.Description{Summary: "Entries of the audit log"})
+	describe("export_audit_log", openapi.Description{Summary: "Export the audit log"})
+	describe("verify_audit_log", openapi.Description{Summary: "Verify the hash chain of the audit log"})
+
+	describe("get_trace", openapi.Description{Summary: "Timeline of everything recorded for a request ID"})
+
+	describe("state_events", openapi.Description{Summary: "Server-Sent Events stream of a state"})
+	describe("workspace_terminal", openapi.Description{Summary: "WebSocket terminal of a workspace"})
+	describe("workspace_coedit", openapi.Description{Summary: "WebSocket relay sharing terminal sessions and presence between the participants of a workspace"})
+	describe("workspace_schedule", openapi.Description{Summary: "Start and stop schedule of a workspace"})
+	describe("list_holidays", openapi.Description{Summary: "Holidays of the organization, on which workspace schedules don't run"})
+	describe("holiday", openapi.Description{Summary: "Add or remove a holiday of the organization"})
+	describe("metrics", openapi.Description{Summary: "Prometheus metrics"})
+	describe("readiness", openapi.Description{
+		Summary:  "Readiness probe; 503 until the required dependencies warmed up",
+		Response: readinessResponse{},
+	})
+	describe("status", openapi.Description{
+		Summary:  "Workspace counts, integration health, queue lags, error rates and active runs in one document",
+		Response: statusResponse{},
+	})
+	describe("pprof_index", openapi.Description{Summary: "Profiles of the process, as served by net/http/pprof"})
+	describe("pprof", openapi.Description{
+		Summary: "A pprof profile; profile samples the CPU for the seconds query parameter, trace records an execution trace",
+		Query: []*openapi.Parameter{{
+			Name:        "seconds",
+			In:          "query",
+			Description: "How long profile and trace sample, 30 for profile and 1 for trace by default.",
+			Schema:      &openapi.Schema{Type: "integer"},
+		}, {
+			Name:        "debug",
+			In:          "query",
+			Description: "1 or 2 for a text profile rather than the protobuf format.",
+			Schema:      &openapi.Schema{Type: "integer"},
+		}},
+	})
+}
@@ -0,0 +1,77 @@
+package app
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"github.com/spectrumwebco/agent_runtime/backend/core/outputs"
+	"github.com/spectrumwebco/agent_runtime/pkg/djangogo/core"
+)
+
+// streamingParams asks the exec command with params to stream its output
+// and to return only the first previewBytes of it with the result.
+func streamingParams(params json.RawMessage, previewBytes int) (json.RawMessage, error) {
+	var p map[string]interface{}
+	if err := json.Unmarshal(params, &p); err != nil {
+		return nil, err
+	}
+	p["stream"] = true
+	p["preview_bytes"] = previewBytes
+	return json.Marshal(p)
+}
+
+// CommandOutput serves a stream of the output of an agent command that
+// streamed it, stdout unless the stream query parameter is stderr. Range
+// requests page through large outputs. Outputs are served by the replica
+// that ran the command until they expire.
+func CommandOutput(w http.ResponseWriter, r *http.Request) {
+	outputID := mux.Vars(r)["output_id"]
+	output, err := outputs.DefaultStore().Get(outputID)
+	if err == nil && checkWorkspace(r.Context(), output.WorkspaceID) != nil {
+		err = outputs.ErrNotFound
+	}
+	if err != nil {
+		core.JSONResponse(w, map[string]interface{}{"status": "error", "message": fmt.Sprintf("output %s not found", outputID)}, http.StatusNotFound)
+		return
+	}
+
+	stream := r.URL.Query().Get("stream")
+	switch stream {
+	case "":
+		stream = "stdout"
+	case "stdout", "stderr":
+	default:
+		core.JSONResponse(w, map[string]interface{}{"status": "error", "message": fmt.Sprintf("unknown stream %q, must be stdout or stderr", stream)}, http.StatusBadRequest)
+		return
+	}
+
+	var reader io.ReadSeeker
+	opened, err := output.Open(stream)
+	switch {
+	case errors.Is(err, outputs.ErrNotFound):
+		// the command didn't write to the stream
+		reader = bytes.NewReader(nil)
+	case err != nil:
+		core.JSONResponse(w, map[string]interface{}{"status": "error", "message": err.Error()}, http.StatusInternalServerError)
+		return
+	default:
+		defer opened.Close()
+		reader = opened
+	}
+
+	info := output.Info()
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("X-Output-Finished", strconv.FormatBool(info.Finished))
+	w.Header().Set("X-Output-Incomplete", strconv.FormatBool(info.Incomplete))
+	http.ServeContent(w, r, "", output.Created, reader)
+}
+
+func init() {
+	registerAPIView("command_output", CommandOutput, []string{"GET"}, []string{"HasAPIKey"})
+}
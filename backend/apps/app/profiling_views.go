@@ -0,0 +1,45 @@
+package app
+
+import (
+	"net/http"
+	"net/http/pprof"
+
+	"github.com/gorilla/mux"
+	"github.com/spectrumwebco/agent_runtime/backend/core/audit"
+)
+
+// The pprof endpoints are served by the router of the API behind the admin
+// permission; net/http/pprof also registers them on http.DefaultServeMux,
+// which the backend never serves.
+
+// PprofIndex lists the profiles of the process, like /debug/pprof/.
+func PprofIndex(w http.ResponseWriter, r *http.Request) {
+	audit.FromContext(r.Context()).Skip()
+	pprof.Index(w, r)
+}
+
+// Pprof serves a profile as net/http/pprof does: profile is a CPU profile
+// sampled for the seconds query parameter, trace an execution trace and
+// the others, such as heap and goroutine, snapshots.
+func Pprof(w http.ResponseWriter, r *http.Request) {
+	name := mux.Vars(r)["profile"]
+	audit.FromContext(r.Context()).SetResource("profile", name)
+
+	switch name {
+	case "cmdline":
+		pprof.Cmdline(w, r)
+	case "profile":
+		pprof.Profile(w, r)
+	case "symbol":
+		pprof.Symbol(w, r)
+	case "trace":
+		pprof.Trace(w, r)
+	default:
+		pprof.Handler(name).ServeHTTP(w, r)
+	}
+}
+
+func init() {
+	registerAPIView("pprof_index", PprofIndex, []string{"GET"}, []string{"IsAdminUser"})
+	registerAPIView("pprof", Pprof, []string{"GET", "POST"}, []string{"IsAdminUser"})
+}
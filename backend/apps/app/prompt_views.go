@@ -0,0 +1,184 @@
+package app
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/spectrumwebco/agent_runtime/backend/core/audit"
+	"github.com/spectrumwebco/agent_runtime/backend/core/prompts"
+	"github.com/spectrumwebco/agent_runtime/backend/db/integrations"
+	"github.com/spectrumwebco/agent_runtime/pkg/djangogo/core"
+)
+
+var promptStore prompts.Store
+
+type createPromptRequest struct {
+	Name        string             `json:"name" openapi:"required"`
+	Description string             `json:"description"`
+	Body        string             `json:"body" openapi:"required"`
+	Variables   []prompts.Variable `json:"variables"`
+	// Tags are pointed at the new version, e.g. ["canary"].
+	Tags []string `json:"tags"`
+}
+
+type tagPromptRequest struct {
+	Tag     string `json:"tag" openapi:"required"`
+	Version int    `json:"version" openapi:"required"`
+}
+
+type renderPromptRequest struct {
+	// Ref is name, name@version or name@tag.
+	Ref       string                 `json:"ref" openapi:"required"`
+	Variables map[string]interface{} `json:"variables"`
+}
+
+// promptError is 404 for unknown prompts, versions and tags, 400 for invalid
+// variables and 500 otherwise.
+func promptError(w http.ResponseWriter, err error) {
+	var validation *prompts.ValidationError
+	status := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, prompts.ErrNotFound):
+		status = http.StatusNotFound
+	case errors.As(err, &validation):
+		core.JSONResponse(w, map[string]interface{}{"status": "error", "message": err.Error(), "problems": validation.Problems}, http.StatusBadRequest)
+		return
+	}
+	core.JSONResponse(w, map[string]interface{}{"status": "error", "message": err.Error()}, status)
+}
+
+// CreatePrompt saves the next version of a prompt.
+func CreatePrompt(w http.ResponseWriter, r *http.Request) {
+	var request createPromptRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		core.JSONResponse(w, map[string]interface{}{"status": "error", "message": fmt.Sprintf("invalid request body: %v", err)}, http.StatusBadRequest)
+		return
+	}
+
+	createdBy := ""
+	if user := core.GetUserFromRequest(r); user != nil && user.IsAuthenticated() {
+		createdBy = user.GetID()
+	}
+	for _, tag := range request.Tags {
+		if err := prompts.ValidateTag(tag); err != nil {
+			core.JSONResponse(w, map[string]interface{}{"status": "error", "message": err.Error()}, http.StatusBadRequest)
+			return
+		}
+	}
+	tmpl, err := prompts.NewTemplate(request.Name, request.Description, request.Body, request.Variables, createdBy, time.Now())
+	if err != nil {
+		core.JSONResponse(w, map[string]interface{}{"status": "error", "message": err.Error()}, http.StatusBadRequest)
+		return
+	}
+	if err := promptStore.Save(r.Context(), tmpl); err != nil {
+		promptError(w, err)
+		return
+	}
+	for _, tag := range request.Tags {
+		if err := promptStore.Tag(r.Context(), tmpl.Name, tag, tmpl.Version); err != nil {
+			promptError(w, err)
+			return
+		}
+	}
+
+	recorder := audit.FromContext(r.Context())
+	recorder.SetResource("prompt", tmpl.Ref())
+	recorder.AddMetadata("tags", request.Tags)
+
+	core.JSONResponse(w, map[string]interface{}{"status": "success", "prompt": tmpl}, http.StatusCreated)
+}
+
+// ListPrompts returns the latest version of every prompt.
+func ListPrompts(w http.ResponseWriter, r *http.Request) {
+	list, err := promptStore.List(r.Context())
+	if err != nil {
+		promptError(w, err)
+		return
+	}
+	core.JSONResponse(w, map[string]interface{}{"status": "success", "prompts": list}, http.StatusOK)
+}
+
+// PromptVersions returns every version of a prompt, newest first, and its
+// tags.
+func PromptVersions(w http.ResponseWriter, r *http.Request) {
+	name := mux.Vars(r)["name"]
+	versions, err := promptStore.Versions(r.Context(), name)
+	if err != nil {
+		promptError(w, err)
+		return
+	}
+	tags, err := promptStore.Tags(r.Context(), name)
+	if err != nil {
+		promptError(w, err)
+		return
+	}
+	core.JSONResponse(w, map[string]interface{}{"status": "success", "versions": versions, "tags": tags}, http.StatusOK)
+}
+
+// TagPrompt points a rollout tag of a prompt at one of its versions.
+func TagPrompt(w http.ResponseWriter, r *http.Request) {
+	name := mux.Vars(r)["name"]
+	var request tagPromptRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		core.JSONResponse(w, map[string]interface{}{"status": "error", "message": fmt.Sprintf("invalid request body: %v", err)}, http.StatusBadRequest)
+		return
+	}
+	if err := prompts.ValidateTag(request.Tag); err != nil {
+		core.JSONResponse(w, map[string]interface{}{"status": "error", "message": err.Error()}, http.StatusBadRequest)
+		return
+	}
+
+	recorder := audit.FromContext(r.Context())
+	recorder.SetResource("prompt", fmt.Sprintf("%s@%d", name, request.Version))
+	recorder.AddMetadata("tag", request.Tag)
+
+	if err := promptStore.Tag(r.Context(), name, request.Tag, request.Version); err != nil {
+		promptError(w, err)
+		return
+	}
+	core.JSONResponse(w, map[string]interface{}{"status": "success"}, http.StatusOK)
+}
+
+// RenderPrompt renders a prompt version with the given variables.
+func RenderPrompt(w http.ResponseWriter, r *http.Request) {
+	var request renderPromptRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		core.JSONResponse(w, map[string]interface{}{"status": "error", "message": fmt.Sprintf("invalid request body: %v", err)}, http.StatusBadRequest)
+		return
+	}
+	if _, _, _, err := prompts.ParseRef(request.Ref); err != nil {
+		core.JSONResponse(w, map[string]interface{}{"status": "error", "message": err.Error()}, http.StatusBadRequest)
+		return
+	}
+
+	tmpl, err := prompts.Resolve(r.Context(), promptStore, request.Ref)
+	if err != nil {
+		promptError(w, err)
+		return
+	}
+	rendered, err := tmpl.Render(request.Variables)
+	if err != nil {
+		promptError(w, err)
+		return
+	}
+	core.JSONResponse(w, map[string]interface{}{
+		"status":  "success",
+		"name":    tmpl.Name,
+		"version": tmpl.Version,
+		"prompt":  rendered,
+	}, http.StatusOK)
+}
+
+func init() {
+	promptStore = prompts.ConfigureDefault(integrations.GetPostgresStore("default"))
+
+	registerAPIView("list_prompts", ListPrompts, []string{"GET"}, []string{"HasAPIKey"})
+	registerAPIView("create_prompt", CreatePrompt, []string{"POST"}, []string{"IsAdminUser"})
+	registerAPIView("render_prompt", RenderPrompt, []string{"POST"}, []string{"HasAPIKey"})
+	registerAPIView("prompt_versions", PromptVersions, []string{"GET"}, []string{"HasAPIKey"})
+	registerAPIView("tag_prompt", TagPrompt, []string{"PUT"}, []string{"IsAdminUser"})
+}
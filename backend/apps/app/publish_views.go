@@ -0,0 +1,106 @@
+package app
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/spectrumwebco/agent_runtime/backend/core/agentcmd"
+	"github.com/spectrumwebco/agent_runtime/backend/core/audit"
+	"github.com/spectrumwebco/agent_runtime/backend/core/outbound"
+	"github.com/spectrumwebco/agent_runtime/backend/core/publish"
+	"github.com/spectrumwebco/agent_runtime/pkg/djangogo/core"
+)
+
+// forgeTimeout bounds each call to the GitHub or GitLab API.
+const forgeTimeout = 30 * time.Second
+
+// trajectoryURL links the summary of a trajectory. TRAJECTORY_SUMMARY_URL
+// overrides the frontend's page, with {id} replaced by the trajectory.
+func trajectoryURL(r *http.Request, trajectoryID string) string {
+	if pattern, _ := core.GetSetting("TRAJECTORY_SUMMARY_URL", ""); pattern.(string) != "" {
+		return strings.ReplaceAll(pattern.(string), "{id}", trajectoryID)
+	}
+	return tunnelBaseURL(r) + "/trajectories/" + trajectoryID
+}
+
+// PublishWorkspace commits the changes of a workspace to a branch, pushes it
+// with the caller's forwarded token and opens a pull request for it.
+func PublishWorkspace(w http.ResponseWriter, r *http.Request) {
+	workspaceID, ok := coordinationWorkspace(w, r)
+	if !ok {
+		return
+	}
+	var request publish.Request
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		core.JSONResponse(w, map[string]interface{}{"status": "error", "message": fmt.Sprintf("invalid request body: %v", err)}, http.StatusBadRequest)
+		return
+	}
+	if request.Title == "" || request.Token == "" {
+		core.JSONResponse(w, map[string]interface{}{"status": "error", "message": "title and token are required"}, http.StatusBadRequest)
+		return
+	}
+	if err := publish.ValidateBranch(request.Branch); err != nil {
+		core.JSONResponse(w, map[string]interface{}{"status": "error", "message": err.Error()}, http.StatusBadRequest)
+		return
+	}
+	if _, err := publish.RenderDescription(request.Template, publish.DescriptionData{}); err != nil {
+		core.JSONResponse(w, map[string]interface{}{"status": "error", "message": err.Error()}, http.StatusBadRequest)
+		return
+	}
+
+	client, err := outbound.Default().HTTPClient(forgeTimeout)
+	if err != nil {
+		core.JSONResponse(w, map[string]interface{}{"status": "error", "message": err.Error()}, http.StatusInternalServerError)
+		return
+	}
+	publisher := publish.NewPublisher(agentcmd.Default(), client)
+	publisher.TrajectoryURL = func(trajectoryID string) string { return trajectoryURL(r, trajectoryID) }
+
+	result, err := publisher.Publish(r.Context(), workspaceID, request)
+	if err != nil {
+		publishError(w, err)
+		return
+	}
+	recorder := audit.FromContext(r.Context())
+	recorder.SetResource("workspace", workspaceID)
+	recorder.AddMetadata("branch", result.Branch)
+	recorder.AddMetadata("commit", result.Commit)
+	recorder.AddMetadata("pull_request", result.PullRequest.URL)
+	status := http.StatusCreated
+	if result.PullRequest.Existing {
+		status = http.StatusOK
+	}
+	core.JSONResponse(w, map[string]interface{}{"status": "success", "result": result}, status)
+}
+
+// publishError is 422 for pushes the workspace failed, 502 for errors of the
+// forge, 503 while the agent isn't connected and 500 otherwise. Forge
+// authentication errors keep their status so callers can ask for another
+// token.
+func publishError(w http.ResponseWriter, err error) {
+	var (
+		agentErr *publish.AgentError
+		forgeErr *publish.ForgeError
+	)
+	status := http.StatusInternalServerError
+	switch {
+	case errors.As(err, &agentErr):
+		status = http.StatusUnprocessableEntity
+	case errors.As(err, &forgeErr):
+		status = http.StatusBadGateway
+		if forgeErr.StatusCode == http.StatusUnauthorized || forgeErr.StatusCode == http.StatusForbidden {
+			status = forgeErr.StatusCode
+		}
+	case errors.Is(err, agentcmd.ErrNotConnected):
+		status = http.StatusServiceUnavailable
+	}
+	core.JSONResponse(w, map[string]interface{}{"status": "error", "message": err.Error()}, status)
+}
+
+func init() {
+	registerAPIView("publish_workspace", PublishWorkspace, []string{"POST"}, []string{"HasAPIKey"})
+}
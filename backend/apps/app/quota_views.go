@@ -0,0 +1,110 @@
+package app
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/spectrumwebco/agent_runtime/backend/apps/app/middleware"
+	"github.com/spectrumwebco/agent_runtime/backend/core/email"
+	"github.com/spectrumwebco/agent_runtime/backend/core/notify"
+	"github.com/spectrumwebco/agent_runtime/backend/core/quota"
+	"github.com/spectrumwebco/agent_runtime/backend/db/integrations"
+	"github.com/spectrumwebco/agent_runtime/pkg/djangogo/core"
+)
+
+// ShowQuota returns the caller's usage and limits for their user and
+// project scopes.
+func ShowQuota(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.QuotaUserID(r)
+	if userID == "" {
+		core.JSONResponse(w, map[string]interface{}{"status": "error", "message": "authentication required"}, http.StatusUnauthorized)
+		return
+	}
+
+	usage, err := quota.DefaultManager().Show(r.Context(), middleware.QuotaScopes(r.Context(), userID))
+	if err != nil {
+		core.JSONResponse(w, map[string]interface{}{"status": "error", "message": err.Error()}, http.StatusInternalServerError)
+		return
+	}
+
+	core.JSONResponse(w, map[string]interface{}{
+		"status":            "success",
+		"usage":             usage,
+		"warning_threshold": quota.WarningThreshold,
+	}, http.StatusOK)
+}
+
+type quotaRequest struct {
+	Scope    quota.Scope    `json:"scope" openapi:"required"`
+	Resource quota.Resource `json:"resource" openapi:"required"`
+	Value    float64        `json:"value" openapi:"required"`
+}
+
+func decodeQuotaRequest(r *http.Request) (quotaRequest, error) {
+	var request quotaRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		return request, fmt.Errorf("invalid request body: %v", err)
+	}
+	if request.Scope.Type != quota.ScopeUser && request.Scope.Type != quota.ScopeProject {
+		return request, fmt.Errorf("scope type must be user or project")
+	}
+	if request.Scope.ID == "" {
+		return request, fmt.Errorf("scope id is required")
+	}
+	if !request.Resource.Valid() {
+		return request, fmt.Errorf("unknown resource %q", request.Resource)
+	}
+	return request, nil
+}
+
+// SetQuotaLimit overrides one limit for a user or project. A value of 0
+// makes the resource unlimited.
+func SetQuotaLimit(w http.ResponseWriter, r *http.Request) {
+	request, err := decodeQuotaRequest(r)
+	if err != nil {
+		core.JSONResponse(w, map[string]interface{}{"status": "error", "message": err.Error()}, http.StatusBadRequest)
+		return
+	}
+
+	if err := quota.DefaultManager().SetLimit(r.Context(), request.Scope, request.Resource, request.Value); err != nil {
+		core.JSONResponse(w, map[string]interface{}{"status": "error", "message": err.Error()}, http.StatusInternalServerError)
+		return
+	}
+
+	core.JSONResponse(w, map[string]interface{}{"status": "success"}, http.StatusOK)
+}
+
+// ReportQuotaUsage records accrued usage, such as CPU and GPU hours or
+// storage, reported by workspace agents.
+func ReportQuotaUsage(w http.ResponseWriter, r *http.Request) {
+	request, err := decodeQuotaRequest(r)
+	if err != nil {
+		core.JSONResponse(w, map[string]interface{}{"status": "error", "message": err.Error()}, http.StatusBadRequest)
+		return
+	}
+
+	if err := quota.DefaultManager().Record(r.Context(), []quota.Scope{request.Scope}, request.Resource, request.Value); err != nil {
+		core.JSONResponse(w, map[string]interface{}{"status": "error", "message": err.Error()}, http.StatusInternalServerError)
+		return
+	}
+
+	core.JSONResponse(w, map[string]interface{}{"status": "success"}, http.StatusOK)
+}
+
+func init() {
+	defaults, _ := core.GetSetting("QUOTA_DEFAULTS", map[string]interface{}{})
+	quota.ConfigureDefault(
+		integrations.GetPostgresStore("default"),
+		quota.ParseDefaults(defaults),
+		quota.MultiNotifier{
+			quota.NewKafkaNotifier(integrations.GetEventProducer("kled-quota")),
+			notify.QuotaNotifier,
+			email.QuotaNotifier,
+		},
+	)
+
+	registerAPIView("show_quota", ShowQuota, []string{"GET"}, []string{"IsAuthenticated"})
+	registerAPIView("set_quota_limit", SetQuotaLimit, []string{"PUT"}, []string{"IsAdminUser"})
+	registerAPIView("report_quota_usage", ReportQuotaUsage, []string{"POST"}, []string{"IsAdminUser"})
+}
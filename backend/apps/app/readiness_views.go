@@ -0,0 +1,41 @@
+package app
+
+import (
+	"net/http"
+
+	"github.com/spectrumwebco/agent_runtime/backend/core/readiness"
+	"github.com/spectrumwebco/agent_runtime/pkg/djangogo/core"
+)
+
+type readinessResponse struct {
+	// Status is ready, degraded or not_ready.
+	Status       string                       `json:"status"`
+	Ready        bool                         `json:"ready"`
+	Degraded     bool                         `json:"degraded"`
+	Dependencies []readiness.DependencyStatus `json:"dependencies"`
+}
+
+// Readiness serves the readiness probe: 200 once every required dependency
+// warmed up and 503 before. Degraded is set while an optional dependency,
+// such as RAGflow, is unavailable.
+func Readiness(w http.ResponseWriter, r *http.Request) {
+	report := readiness.DefaultGate().Report()
+	status, code := "ready", http.StatusOK
+	switch {
+	case !report.Ready:
+		status, code = "not_ready", http.StatusServiceUnavailable
+	case report.Degraded:
+		status = "degraded"
+	}
+
+	core.JSONResponse(w, map[string]interface{}{
+		"status":       status,
+		"ready":        report.Ready,
+		"degraded":     report.Degraded,
+		"dependencies": report.Dependencies,
+	}, code)
+}
+
+func init() {
+	registerAPIView("readiness", Readiness, []string{"GET"}, []string{"AllowAny"})
+}
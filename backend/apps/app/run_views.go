@@ -0,0 +1,279 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+
+	"github.com/gorilla/mux"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"github.com/spectrumwebco/agent_runtime/backend/core/audit"
+	"github.com/spectrumwebco/agent_runtime/backend/core/kerrors"
+	"github.com/spectrumwebco/agent_runtime/backend/core/runs"
+	"github.com/spectrumwebco/agent_runtime/backend/core/tenancy"
+	pb "github.com/spectrumwebco/agent_runtime/backend/protos/gen/go/agent_runs"
+	"github.com/spectrumwebco/agent_runtime/pkg/djangogo/core"
+)
+
+// The run views call the AgentRuns service of the gRPC server, which
+// executes the runs and holds the command streams of the workspace agents.
+// Callers are authorized there with the API key of their request.
+var (
+	runsClient     pb.AgentRunsClient
+	runsClientErr  error
+	runsClientOnce sync.Once
+)
+
+func agentRuns() (pb.AgentRunsClient, error) {
+	runsClientOnce.Do(func() {
+		address := os.Getenv("GRPC_SERVER_ADDRESS")
+		if address == "" {
+			address = "localhost:50051"
+		}
+		var conn *grpc.ClientConn
+		conn, runsClientErr = grpc.Dial(address, grpc.WithTransportCredentials(insecure.NewCredentials()))
+		if runsClientErr == nil {
+			runsClient = pb.NewAgentRunsClient(conn)
+		}
+	})
+	return runsClient, runsClientErr
+}
+
+type cancelRunRequest struct {
+	Reason string `json:"reason"`
+}
+
+type runCheckpointRequest struct {
+	Step         int      `json:"step" openapi:"required"`
+	MemoryRefs   []string `json:"memory_refs"`
+	TrajectoryID string   `json:"trajectory_id"`
+}
+
+type finishRunRequest struct {
+	Succeeded bool   `json:"succeeded" openapi:"required"`
+	Error     string `json:"error"`
+}
+
+// runCall returns the AgentRuns client, a context carrying the caller's API
+// key and the tenant of the request, or writes the error.
+func runCall(w http.ResponseWriter, r *http.Request) (pb.AgentRunsClient, context.Context, tenancy.Tenant, bool) {
+	tenant, ok := tenancy.FromContext(r.Context())
+	if !ok {
+		core.JSONResponse(w, map[string]interface{}{"status": "error", "message": "a project is required to manage runs"}, http.StatusBadRequest)
+		return nil, nil, tenancy.Tenant{}, false
+	}
+	client, err := agentRuns()
+	if err != nil {
+		core.JSONResponse(w, map[string]interface{}{"status": "error", "message": fmt.Sprintf("runs service unavailable: %v", err)}, http.StatusServiceUnavailable)
+		return nil, nil, tenancy.Tenant{}, false
+	}
+	ctx := metadata.AppendToOutgoingContext(r.Context(), "x-api-key", r.Header.Get("X-API-Key"))
+	return client, ctx, tenant, true
+}
+
+// runResponse writes the run returned by the service, or maps its error to
+// the HTTP status.
+func runResponse(w http.ResponseWriter, r *http.Request, msg *pb.Run, err error, statusCode int) {
+	if err != nil {
+		runError(w, err)
+		return
+	}
+	run := runs.FromProto(msg)
+	audit.FromContext(r.Context()).SetResource("run", run.ID)
+	core.JSONResponse(w, map[string]interface{}{"status": "success", "run": run}, statusCode)
+}
+
+func runError(w http.ResponseWriter, err error) {
+	statusCode := http.StatusInternalServerError
+	switch status.Code(err) {
+	case codes.InvalidArgument:
+		statusCode = http.StatusBadRequest
+	case codes.Unauthenticated:
+		statusCode = http.StatusUnauthorized
+	case codes.PermissionDenied:
+		statusCode = http.StatusForbidden
+	case codes.NotFound:
+		statusCode = http.StatusNotFound
+	case codes.FailedPrecondition, codes.Aborted:
+		statusCode = http.StatusConflict
+	case codes.ResourceExhausted:
+		statusCode = http.StatusTooManyRequests
+	case codes.Unavailable:
+		statusCode = http.StatusServiceUnavailable
+	}
+	core.JSONResponse(w, kerrors.Body(kerrors.New(kerrors.FromHTTPStatus(statusCode), status.Convert(err).Message())), statusCode)
+}
+
+// StartRun starts a run in the caller's project.
+func StartRun(w http.ResponseWriter, r *http.Request) {
+	var spec runs.Spec
+	if err := json.NewDecoder(r.Body).Decode(&spec); err != nil {
+		core.JSONResponse(w, map[string]interface{}{"status": "error", "message": fmt.Sprintf("invalid request body: %v", err)}, http.StatusBadRequest)
+		return
+	}
+	if spec.Prompt == "" {
+		core.JSONResponse(w, map[string]interface{}{"status": "error", "message": "prompt is required"}, http.StatusBadRequest)
+		return
+	}
+	client, ctx, tenant, ok := runCall(w, r)
+	if !ok {
+		return
+	}
+
+	msg, err := client.StartRun(ctx, &pb.StartRunRequest{
+		ProjectId:   tenant.ProjectID,
+		WorkspaceId: spec.WorkspaceID,
+		Prompt:      spec.Prompt,
+		Context:     spec.Context,
+	})
+	runResponse(w, r, msg, err, http.StatusCreated)
+}
+
+// ListRuns returns the runs of the caller's project, newest first,
+// optionally in one state.
+func ListRuns(w http.ResponseWriter, r *http.Request) {
+	state := r.URL.Query().Get("state")
+	limit := 0
+	if value := r.URL.Query().Get("limit"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 {
+			core.JSONResponse(w, map[string]interface{}{"status": "error", "message": fmt.Sprintf("invalid limit %q", value)}, http.StatusBadRequest)
+			return
+		}
+		limit = n
+	}
+	client, ctx, tenant, ok := runCall(w, r)
+	if !ok {
+		return
+	}
+
+	resp, err := client.ListRuns(ctx, &pb.ListRunsRequest{ProjectId: tenant.ProjectID, State: state, Limit: int32(limit)})
+	if err != nil {
+		runError(w, err)
+		return
+	}
+	list := make([]*runs.Run, 0, len(resp.Runs))
+	for _, msg := range resp.Runs {
+		list = append(list, runs.FromProto(msg))
+	}
+	core.JSONResponse(w, map[string]interface{}{"status": "success", "runs": list}, http.StatusOK)
+}
+
+// GetRun returns a run of the caller's project.
+func GetRun(w http.ResponseWriter, r *http.Request) {
+	client, ctx, tenant, ok := runCall(w, r)
+	if !ok {
+		return
+	}
+	msg, err := client.GetRun(ctx, &pb.RunRequest{ProjectId: tenant.ProjectID, RunId: mux.Vars(r)["run_id"]})
+	runResponse(w, r, msg, err, http.StatusOK)
+}
+
+// PauseRun stops the execution of a running run, keeping its checkpoint.
+func PauseRun(w http.ResponseWriter, r *http.Request) {
+	client, ctx, tenant, ok := runCall(w, r)
+	if !ok {
+		return
+	}
+	msg, err := client.PauseRun(ctx, &pb.RunRequest{ProjectId: tenant.ProjectID, RunId: mux.Vars(r)["run_id"]})
+	runResponse(w, r, msg, err, http.StatusOK)
+}
+
+// ResumeRun continues a paused run from its last checkpoint.
+func ResumeRun(w http.ResponseWriter, r *http.Request) {
+	client, ctx, tenant, ok := runCall(w, r)
+	if !ok {
+		return
+	}
+	msg, err := client.ResumeRun(ctx, &pb.RunRequest{ProjectId: tenant.ProjectID, RunId: mux.Vars(r)["run_id"]})
+	runResponse(w, r, msg, err, http.StatusOK)
+}
+
+// CancelRun stops a run for good and tells its interpreter and workspace.
+func CancelRun(w http.ResponseWriter, r *http.Request) {
+	var request cancelRunRequest
+	if r.ContentLength > 0 {
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			core.JSONResponse(w, map[string]interface{}{"status": "error", "message": fmt.Sprintf("invalid request body: %v", err)}, http.StatusBadRequest)
+			return
+		}
+	}
+	client, ctx, tenant, ok := runCall(w, r)
+	if !ok {
+		return
+	}
+	audit.FromContext(r.Context()).AddMetadata("reason", request.Reason)
+
+	msg, err := client.CancelRun(ctx, &pb.RunRequest{ProjectId: tenant.ProjectID, RunId: mux.Vars(r)["run_id"], Reason: request.Reason})
+	runResponse(w, r, msg, err, http.StatusOK)
+}
+
+// SaveRunCheckpoint records the progress of a run. Runtimes stop when the
+// returned run is no longer running.
+func SaveRunCheckpoint(w http.ResponseWriter, r *http.Request) {
+	var request runCheckpointRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		core.JSONResponse(w, map[string]interface{}{"status": "error", "message": fmt.Sprintf("invalid request body: %v", err)}, http.StatusBadRequest)
+		return
+	}
+	if request.Step < 0 {
+		core.JSONResponse(w, map[string]interface{}{"status": "error", "message": "step must not be negative"}, http.StatusBadRequest)
+		return
+	}
+	client, ctx, tenant, ok := runCall(w, r)
+	if !ok {
+		return
+	}
+
+	msg, err := client.SaveCheckpoint(ctx, &pb.SaveCheckpointRequest{
+		ProjectId: tenant.ProjectID,
+		RunId:     mux.Vars(r)["run_id"],
+		Checkpoint: &pb.Checkpoint{
+			Step:         int32(request.Step),
+			MemoryRefs:   request.MemoryRefs,
+			TrajectoryId: request.TrajectoryID,
+		},
+	})
+	runResponse(w, r, msg, err, http.StatusOK)
+}
+
+// FinishRun records the outcome of a run reported by its runtime.
+func FinishRun(w http.ResponseWriter, r *http.Request) {
+	var request finishRunRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		core.JSONResponse(w, map[string]interface{}{"status": "error", "message": fmt.Sprintf("invalid request body: %v", err)}, http.StatusBadRequest)
+		return
+	}
+	client, ctx, tenant, ok := runCall(w, r)
+	if !ok {
+		return
+	}
+
+	msg, err := client.FinishRun(ctx, &pb.FinishRunRequest{
+		ProjectId: tenant.ProjectID,
+		RunId:     mux.Vars(r)["run_id"],
+		Succeeded: request.Succeeded,
+		Error:     request.Error,
+	})
+	runResponse(w, r, msg, err, http.StatusOK)
+}
+
+func init() {
+	registerAPIView("list_runs", ListRuns, []string{"GET"}, []string{"HasAPIKey"})
+	registerAPIView("start_run", StartRun, []string{"POST"}, []string{"HasAPIKey"})
+	registerAPIView("get_run", GetRun, []string{"GET"}, []string{"HasAPIKey"})
+	registerAPIView("pause_run", PauseRun, []string{"POST"}, []string{"HasAPIKey"})
+	registerAPIView("resume_run", ResumeRun, []string{"POST"}, []string{"HasAPIKey"})
+	registerAPIView("cancel_run", CancelRun, []string{"POST"}, []string{"HasAPIKey"})
+	registerAPIView("save_run_checkpoint", SaveRunCheckpoint, []string{"POST"}, []string{"HasAPIKey"})
+	registerAPIView("finish_run", FinishRun, []string{"POST"}, []string{"HasAPIKey"})
+}
@@ -0,0 +1,150 @@
+package app
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/spectrumwebco/agent_runtime/backend/core/schedule"
+	"github.com/spectrumwebco/agent_runtime/backend/core/tenancy"
+	"github.com/spectrumwebco/agent_runtime/backend/db/integrations"
+	"github.com/spectrumwebco/agent_runtime/pkg/djangogo/core"
+)
+
+var workspaceSchedules schedule.Store = schedule.NewMemoryStore()
+
+// WorkspaceSchedule reads, replaces or removes the start and stop schedule
+// of a workspace. GET also returns the next start or stop.
+func WorkspaceSchedule(w http.ResponseWriter, r *http.Request) {
+	workspaceID := mux.Vars(r)["workspace_id"]
+	if err := checkWorkspace(r.Context(), workspaceID); err != nil {
+		core.JSONResponse(w, map[string]interface{}{"status": "error", "message": err.Error()}, http.StatusNotFound)
+		return
+	}
+	tenant, _ := tenancy.FromContext(r.Context())
+
+	switch r.Method {
+	case http.MethodGet:
+		current, ok, err := workspaceSchedules.Schedule(r.Context(), workspaceID)
+		if err != nil {
+			core.JSONResponse(w, map[string]interface{}{"status": "error", "message": err.Error()}, http.StatusInternalServerError)
+			return
+		}
+		if !ok {
+			core.JSONResponse(w, map[string]interface{}{"status": "error", "message": "workspace has no schedule"}, http.StatusNotFound)
+			return
+		}
+
+		holidays, err := workspaceSchedules.Holidays(r.Context(), tenant.OrganizationID)
+		if err != nil {
+			core.JSONResponse(w, map[string]interface{}{"status": "error", "message": err.Error()}, http.StatusInternalServerError)
+			return
+		}
+		response := map[string]interface{}{"status": "success", "schedule": current}
+		if action, next, err := current.Next(time.Now(), schedule.HolidaySet(holidays)); err == nil && !next.IsZero() {
+			response["next"] = map[string]interface{}{"action": action, "at": next}
+		}
+		core.JSONResponse(w, response, http.StatusOK)
+
+	case http.MethodPut:
+		var update schedule.Schedule
+		if err := json.NewDecoder(r.Body).Decode(&update); err != nil {
+			core.JSONResponse(w, map[string]interface{}{"status": "error", "message": "Invalid request body"}, http.StatusBadRequest)
+			return
+		}
+		update.WorkspaceID = workspaceID
+		update.OrganizationID = tenant.OrganizationID
+		update.UpdatedAt = time.Now()
+		if update.Timezone == "" {
+			update.Timezone = "UTC"
+		}
+		if err := update.Validate(); err != nil {
+			core.JSONResponse(w, map[string]interface{}{"status": "error", "message": err.Error()}, http.StatusBadRequest)
+			return
+		}
+		if err := workspaceSchedules.SetSchedule(r.Context(), update); err != nil {
+			core.JSONResponse(w, map[string]interface{}{"status": "error", "message": err.Error()}, http.StatusInternalServerError)
+			return
+		}
+		core.JSONResponse(w, map[string]interface{}{"status": "success", "schedule": update}, http.StatusOK)
+
+	case http.MethodDelete:
+		if err := workspaceSchedules.DeleteSchedule(r.Context(), workspaceID); err != nil {
+			core.JSONResponse(w, map[string]interface{}{"status": "error", "message": err.Error()}, http.StatusInternalServerError)
+			return
+		}
+		core.JSONResponse(w, map[string]interface{}{"status": "success"}, http.StatusOK)
+	}
+}
+
+// ListHolidays returns the holidays of the caller's organization, on which
+// workspace schedules don't run.
+func ListHolidays(w http.ResponseWriter, r *http.Request) {
+	tenant, ok := tenancy.FromContext(r.Context())
+	if !ok {
+		core.JSONResponse(w, map[string]interface{}{"status": "error", "message": "organization is required"}, http.StatusBadRequest)
+		return
+	}
+
+	holidays, err := workspaceSchedules.Holidays(r.Context(), tenant.OrganizationID)
+	if err != nil {
+		core.JSONResponse(w, map[string]interface{}{"status": "error", "message": err.Error()}, http.StatusInternalServerError)
+		return
+	}
+	core.JSONResponse(w, map[string]interface{}{"status": "success", "holidays": holidays}, http.StatusOK)
+}
+
+// Holiday adds or removes a holiday of the caller's organization. The date
+// is given as YYYY-MM-DD in the path.
+func Holiday(w http.ResponseWriter, r *http.Request) {
+	tenant, ok := tenancy.FromContext(r.Context())
+	if !ok {
+		core.JSONResponse(w, map[string]interface{}{"status": "error", "message": "organization is required"}, http.StatusBadRequest)
+		return
+	}
+	holiday := schedule.Holiday{OrganizationID: tenant.OrganizationID, Date: mux.Vars(r)["date"]}
+	if err := holiday.Validate(); err != nil {
+		core.JSONResponse(w, map[string]interface{}{"status": "error", "message": err.Error()}, http.StatusBadRequest)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodPut:
+		var body struct {
+			Name string `json:"name"`
+		}
+		if r.ContentLength != 0 {
+			if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+				core.JSONResponse(w, map[string]interface{}{"status": "error", "message": "Invalid request body"}, http.StatusBadRequest)
+				return
+			}
+		}
+		holiday.Name = body.Name
+		if err := workspaceSchedules.SetHoliday(r.Context(), holiday); err != nil {
+			core.JSONResponse(w, map[string]interface{}{"status": "error", "message": err.Error()}, http.StatusInternalServerError)
+			return
+		}
+		core.JSONResponse(w, map[string]interface{}{"status": "success", "holiday": holiday}, http.StatusOK)
+
+	case http.MethodDelete:
+		if err := workspaceSchedules.DeleteHoliday(r.Context(), holiday.OrganizationID, holiday.Date); err != nil {
+			core.JSONResponse(w, map[string]interface{}{"status": "error", "message": err.Error()}, http.StatusInternalServerError)
+			return
+		}
+		core.JSONResponse(w, map[string]interface{}{"status": "success"}, http.StatusOK)
+	}
+}
+
+func init() {
+	store := schedule.NewPostgresStore(integrations.GetPostgresStore("default"))
+	if err := store.EnsureSchema(); err != nil {
+		logger.Printf("Workspace schedules falling back to in-memory store: %v", err)
+	} else {
+		workspaceSchedules = store
+	}
+
+	registerAPIView("workspace_schedule", WorkspaceSchedule, []string{"GET", "PUT", "DELETE"}, []string{"IsAuthenticated"})
+	registerAPIView("list_holidays", ListHolidays, []string{"GET"}, []string{"IsAuthenticated"})
+	registerAPIView("holiday", Holiday, []string{"PUT", "DELETE"}, []string{"IsAdminUser"})
+}
@@ -0,0 +1,214 @@
+package app
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"github.com/spectrumwebco/agent_runtime/backend/core/audit"
+	"github.com/spectrumwebco/agent_runtime/backend/core/jwtauth"
+	"github.com/spectrumwebco/agent_runtime/backend/core/kerrors"
+	"github.com/spectrumwebco/agent_runtime/backend/core/sessions"
+	"github.com/spectrumwebco/agent_runtime/backend/db/integrations"
+	"github.com/spectrumwebco/agent_runtime/pkg/djangogo/core"
+)
+
+var sessionManager *sessions.Manager
+
+type createSessionRequest struct {
+	DeviceName string `json:"device_name"`
+	Platform   string `json:"platform"`
+}
+
+type refreshSessionRequest struct {
+	RefreshToken string `json:"refresh_token" openapi:"required"`
+}
+
+// sessionUser returns the ID and organization of the caller, who may be a
+// Django user or an end user with a Supabase access token, or writes 401.
+func sessionUser(w http.ResponseWriter, r *http.Request) (string, string, bool) {
+	if user := core.GetUserFromRequest(r); user != nil && user.IsAuthenticated() {
+		organizationID := ""
+		if orgID, ok := core.GetObjectAttr(user, "organization_id"); ok && orgID != nil {
+			organizationID = fmt.Sprint(orgID)
+		}
+		return fmt.Sprint(user.GetID()), organizationID, true
+	}
+	if claims := jwtauth.FromContext(r.Context()); claims != nil {
+		return claims.Subject, claims.OrganizationID(), true
+	}
+	kerrors.WriteJSON(w, kerrors.New(kerrors.NotAuthenticated, "authentication required"))
+	return "", "", false
+}
+
+// sessionDevice returns the device a request comes from.
+func sessionDevice(r *http.Request, name, platform string) sessions.Device {
+	return sessions.Device{
+		Name:      name,
+		Platform:  platform,
+		UserAgent: r.UserAgent(),
+		IPAddress: requestClientIP(r),
+	}
+}
+
+// sessionTokens writes the session with a new refresh token and an access
+// token for it.
+func sessionTokens(w http.ResponseWriter, session *sessions.Session, refreshToken string, statusCode int) {
+	ttl := sessionManager.Config().AccessTokenTTL
+	claims := jwtauth.Claims{Subject: session.UserID, Role: "authenticated", SessionID: session.ID}
+	if session.OrganizationID != "" {
+		claims.AppMetadata = map[string]interface{}{"organization_id": session.OrganizationID}
+	}
+	accessToken, err := jwtauth.Sign(jwtauth.Default(), claims, time.Now(), ttl)
+	if err != nil {
+		kerrors.WriteJSON(w, err)
+		return
+	}
+
+	core.JSONResponse(w, map[string]interface{}{
+		"status":        "success",
+		"session":       session,
+		"refresh_token": refreshToken,
+		"access_token":  accessToken,
+		"token_type":    "bearer",
+		"expires_in":    int(ttl.Seconds()),
+	}, statusCode)
+}
+
+// CreateSession signs the caller in on a device. The refresh token returned
+// is only shown once and is exchanged for a new one on every refresh.
+func CreateSession(w http.ResponseWriter, r *http.Request) {
+	userID, organizationID, ok := sessionUser(w, r)
+	if !ok {
+		return
+	}
+	var request createSessionRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			kerrors.WriteJSON(w, kerrors.Errorf(kerrors.InvalidArgument, "invalid request body: %v", err))
+			return
+		}
+	}
+	if jwtauth.Default().Secret == "" {
+		kerrors.WriteJSON(w, jwtauth.ErrNoSecret)
+		return
+	}
+
+	session, refreshToken, err := sessionManager.Create(r.Context(), userID, organizationID, sessionDevice(r, request.DeviceName, request.Platform))
+	if err != nil {
+		kerrors.WriteJSON(w, err)
+		return
+	}
+	recorder := audit.FromContext(r.Context())
+	recorder.SetResource("session", session.ID)
+	recorder.AddMetadata("device_name", session.Device.Name)
+	sessionTokens(w, session, refreshToken, http.StatusCreated)
+}
+
+// RefreshSession exchanges a refresh token for a new one and an access
+// token. It is authenticated by the refresh token alone.
+func RefreshSession(w http.ResponseWriter, r *http.Request) {
+	var request refreshSessionRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		kerrors.WriteJSON(w, kerrors.Errorf(kerrors.InvalidArgument, "invalid request body: %v", err))
+		return
+	}
+	if request.RefreshToken == "" {
+		kerrors.WriteJSON(w, kerrors.New(kerrors.InvalidArgument, "refresh_token is required"))
+		return
+	}
+
+	session, refreshToken, err := sessionManager.Refresh(r.Context(), request.RefreshToken, sessionDevice(r, "", ""))
+	if errors.Is(err, sessions.ErrTokenReused) {
+		// a stolen token; the audit log should show where it came from
+		recorder := audit.FromContext(r.Context())
+		recorder.AddMetadata("reason", sessions.ReasonTokenReused)
+		recorder.AddMetadata("ip_address", requestClientIP(r))
+	}
+	if err != nil {
+		kerrors.WriteJSON(w, err)
+		return
+	}
+	audit.FromContext(r.Context()).SetResource("session", session.ID)
+	sessionTokens(w, session, refreshToken, http.StatusOK)
+}
+
+// ListSessions lists the active sessions of the caller, most recently used
+// first.
+func ListSessions(w http.ResponseWriter, r *http.Request) {
+	userID, _, ok := sessionUser(w, r)
+	if !ok {
+		return
+	}
+	active, err := sessionManager.List(r.Context(), userID)
+	if err != nil {
+		kerrors.WriteJSON(w, err)
+		return
+	}
+	current := ""
+	if claims := jwtauth.FromContext(r.Context()); claims != nil {
+		current = claims.SessionID
+	}
+	core.JSONResponse(w, map[string]interface{}{"status": "success", "sessions": active, "current": current}, http.StatusOK)
+}
+
+// RevokeSession signs the caller out of one of their sessions.
+func RevokeSession(w http.ResponseWriter, r *http.Request) {
+	userID, _, ok := sessionUser(w, r)
+	if !ok {
+		return
+	}
+	sessionID := mux.Vars(r)["session_id"]
+	audit.FromContext(r.Context()).SetResource("session", sessionID)
+
+	reason := sessions.ReasonRevoked
+	if claims := jwtauth.FromContext(r.Context()); claims != nil && claims.SessionID == sessionID {
+		reason = sessions.ReasonSignedOut
+	}
+	if err := sessionManager.Revoke(r.Context(), userID, sessionID, reason); err != nil {
+		kerrors.WriteJSON(w, err)
+		return
+	}
+	core.JSONResponse(w, map[string]interface{}{"status": "success"}, http.StatusOK)
+}
+
+// RevokeOtherSessions signs the caller out everywhere but the session of
+// the access token of the request.
+func RevokeOtherSessions(w http.ResponseWriter, r *http.Request) {
+	userID, _, ok := sessionUser(w, r)
+	if !ok {
+		return
+	}
+	current := ""
+	if claims := jwtauth.FromContext(r.Context()); claims != nil {
+		current = claims.SessionID
+	}
+	revoked, err := sessionManager.RevokeOthers(r.Context(), userID, current)
+	if err != nil {
+		kerrors.WriteJSON(w, err)
+		return
+	}
+	audit.FromContext(r.Context()).AddMetadata("revoked", revoked)
+	core.JSONResponse(w, map[string]interface{}{"status": "success", "revoked": revoked}, http.StatusOK)
+}
+
+func init() {
+	sessionManager = sessions.NewManager(sessions.ConfigureDefault(integrations.GetPostgresStore("default")), sessions.Default())
+	// access tokens of revoked sessions are rejected, not just their
+	// refresh tokens
+	if verifier := jwtauth.DefaultVerifier(); verifier != nil {
+		verifier.SetSessions(sessionManager)
+	}
+
+	// end users with a Supabase access token aren't Django users, so the
+	// views authenticate the caller themselves
+	registerAPIView("create_session", CreateSession, []string{"POST"}, []string{"AllowAny"})
+	registerAPIView("refresh_session", RefreshSession, []string{"POST"}, []string{"AllowAny"})
+	registerAPIView("list_sessions", ListSessions, []string{"GET"}, []string{"AllowAny"})
+	registerAPIView("revoke_session", RevokeSession, []string{"DELETE"}, []string{"AllowAny"})
+	registerAPIView("revoke_other_sessions", RevokeOtherSessions, []string{"POST"}, []string{"AllowAny"})
+}
@@ -0,0 +1,26 @@
+package signals
+
+import (
+	"github.com/spectrumwebco/agent_runtime/backend/core/email"
+	"github.com/spectrumwebco/agent_runtime/backend/core/events"
+	"github.com/spectrumwebco/agent_runtime/backend/core/notify"
+	"github.com/spectrumwebco/agent_runtime/backend/core/slo"
+	"github.com/spectrumwebco/agent_runtime/backend/core/tracing"
+	"github.com/spectrumwebco/agent_runtime/backend/core/webhooks"
+	"github.com/spectrumwebco/agent_runtime/backend/db/integrations"
+)
+
+// init sends the workspace lifecycle events to Kafka, webhooks,
+// notifications, emails, traces and the SLOs. The events are emitted by
+// workspace.Controller with the context of the request that caused them, not
+// on model signals.
+func init() {
+	events.SetPublisher(events.MultiPublisher{
+		events.NewKafkaPublisher(integrations.GetEventProducer("kled-workspace-events"), events.WorkspaceTopic),
+		webhooks.Publisher,
+		notify.Publisher,
+		email.Publisher,
+		tracing.Publisher,
+		slo.Publisher,
+	})
+}
@@ -0,0 +1,37 @@
+package app
+
+import (
+	"context"
+	"time"
+
+	"github.com/spectrumwebco/agent_runtime/backend/core/slo"
+	"github.com/spectrumwebco/agent_runtime/backend/db/integrations"
+	"github.com/spectrumwebco/agent_runtime/pkg/djangogo/core"
+)
+
+var sloStore slo.Store = slo.NewMemoryStore()
+
+// statusSLOs reports the compliance and burn rates of the SLOs.
+func statusSLOs(ctx context.Context) (interface{}, error) {
+	reports := []slo.Report{}
+	for _, objective := range slo.Objectives() {
+		report, err := slo.Evaluate(ctx, sloStore, objective, time.Now())
+		if err != nil {
+			return nil, err
+		}
+		reports = append(reports, report)
+	}
+	return reports, nil
+}
+
+func init() {
+	store := slo.NewPostgresStore(integrations.GetPostgresStore("default"))
+	if err := store.EnsureSchema(); err != nil {
+		logger.Printf("SLO buckets falling back to in-memory store: %v", err)
+	} else {
+		sloStore = store
+	}
+
+	interval, _ := core.GetSetting("SLO_FLUSH_SECONDS", 15)
+	go slo.DefaultTracker().Run(context.Background(), sloStore, time.Duration(interval.(int))*time.Second)
+}
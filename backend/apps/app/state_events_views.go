@@ -0,0 +1,147 @@
+package app
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"github.com/spectrumwebco/agent_runtime/backend/core/tenancy"
+	"github.com/spectrumwebco/agent_runtime/backend/core/wsqueue"
+	"github.com/spectrumwebco/agent_runtime/pkg/djangogo/core"
+)
+
+const sseKeepAliveInterval = 15 * time.Second
+
+func validStateType(stateType StateType) bool {
+	switch stateType {
+	case StateTypeTask, StateTypeAgent, StateTypeLifecycle, StateTypeShared:
+		return true
+	}
+	return false
+}
+
+// StateEvents streams the updates of a state as Server-Sent Events, for
+// clients that can't open a WebSocket. It receives the same state_update
+// messages as the WebSocket endpoint, with the event ID of each update as the
+// SSE id.
+//
+// A client resuming with Last-Event-ID, or the last_event_id query parameter
+// for clients that can't set headers, is sent the updates it missed. If they
+// are no longer available it is sent the full state instead, like a new
+// client.
+func StateEvents(w http.ResponseWriter, r *http.Request) {
+	tenant, ok := tenancy.FromContext(r.Context())
+	if !ok {
+		core.JSONResponse(w, map[string]interface{}{"status": "error", "message": "a project is required to subscribe to state"}, http.StatusBadRequest)
+		return
+	}
+
+	vars := mux.Vars(r)
+	stateType, stateID := StateType(vars["state_type"]), vars["state_id"]
+	if !validStateType(stateType) {
+		core.JSONResponse(w, map[string]interface{}{"status": "error", "message": fmt.Sprintf("unknown state type %q", stateType)}, http.StatusNotFound)
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		core.JSONResponse(w, map[string]interface{}{"status": "error", "message": "streaming is not supported"}, http.StatusInternalServerError)
+		return
+	}
+
+	key := stateKey(stateType, tenant, stateID)
+	subscriberID := uuid.New().String()
+	queue := wsqueue.New("shared_state_sse", subscriberID, wsqueue.Default())
+	// The subscription starts before the replay is read, so no update falls
+	// in between.
+	subscribeState(key, &stateSubscriber{id: subscriberID, queue: queue, close: queue.Close})
+	defer func() {
+		unsubscribeState(key, subscriberID)
+		queue.Close()
+	}()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	// keep proxies such as nginx from buffering the stream
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprint(w, "retry: 3000\n\n")
+
+	// replayed holds the events sent before the first queued update, which
+	// may be queued as well.
+	replayed := make(map[string]bool)
+	lastEventID := r.Header.Get("Last-Event-ID")
+	if lastEventID == "" {
+		lastEventID = r.URL.Query().Get("last_event_id")
+	}
+	missed, resumed := stateHistory.Since(key, lastEventID)
+	if lastEventID == "" || !resumed {
+		snapshot, err := json.Marshal(map[string]interface{}{
+			"type":       "state_update",
+			"state_type": stateType,
+			"state_id":   stateID,
+			"event_id":   stateHistory.Latest(key),
+			"data":       loadState(stateType, tenant, stateID),
+		})
+		if err != nil {
+			wsLogger.Printf("Error marshaling state snapshot of %s: %v", key, err)
+			return
+		}
+		missed = append([][]byte{snapshot}, missed...)
+	}
+	for _, msgBytes := range missed {
+		if err := writeStateEvent(w, msgBytes); err != nil {
+			return
+		}
+		replayed[stateEventID(msgBytes)] = true
+	}
+	flusher.Flush()
+
+	keepAlive := time.NewTicker(sseKeepAliveInterval)
+	defer keepAlive.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-queue.Done():
+			// closed as a slow consumer; the client reconnects and resumes
+			return
+		case <-queue.Ready():
+			for _, msgBytes := range queue.Drain() {
+				if eventID := stateEventID(msgBytes); eventID != "" && replayed[eventID] {
+					continue
+				}
+				if err := writeStateEvent(w, msgBytes); err != nil {
+					return
+				}
+			}
+			replayed = nil
+			flusher.Flush()
+		case <-keepAlive.C:
+			if _, err := fmt.Fprint(w, ": keep-alive\n\n"); err != nil {
+				return
+			}
+			flusher.Flush()
+		}
+	}
+}
+
+// writeStateEvent writes a state_update message as an SSE event.
+func writeStateEvent(w http.ResponseWriter, msgBytes []byte) error {
+	if eventID := stateEventID(msgBytes); eventID != "" {
+		if _, err := fmt.Fprintf(w, "id: %s\n", eventID); err != nil {
+			return err
+		}
+	}
+	_, err := fmt.Fprintf(w, "event: state_update\ndata: %s\n\n", msgBytes)
+	return err
+}
+
+func init() {
+	registerAPIView("state_events", StateEvents, []string{"GET"}, []string{"IsAuthenticated"})
+}
@@ -0,0 +1,177 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/spectrumwebco/agent_runtime/backend/core/cdc"
+	"github.com/spectrumwebco/agent_runtime/backend/core/heartbeat"
+	"github.com/spectrumwebco/agent_runtime/backend/core/ingest"
+	"github.com/spectrumwebco/agent_runtime/backend/core/readiness"
+	"github.com/spectrumwebco/agent_runtime/backend/core/runs"
+	"github.com/spectrumwebco/agent_runtime/backend/core/status"
+	"github.com/spectrumwebco/agent_runtime/backend/core/wsqueue"
+	"github.com/spectrumwebco/agent_runtime/backend/db/integrations"
+	"github.com/spectrumwebco/agent_runtime/pkg/djangogo/core"
+)
+
+var statusCollector *status.Collector
+
+type statusResponse struct {
+	// Status is ok, degraded or down.
+	Status string `json:"status"`
+	status.Document
+	// Failed lists the sections that couldn't be collected.
+	Failed []string `json:"failed"`
+}
+
+// Status returns workspace counts, integration health, queue lags, recent
+// error rates, active agent runs and SLO compliance in one document for
+// status pages.
+// Status is down while a required dependency isn't ready and degraded while
+// an optional one is unavailable or a section failed.
+func Status(w http.ResponseWriter, r *http.Request) {
+	document := statusCollector.Collect(r.Context())
+	failed := document.Failed()
+
+	report := readiness.DefaultGate().Report()
+	overall := "ok"
+	switch {
+	case !report.Ready:
+		overall = "down"
+	case report.Degraded || len(failed) > 0:
+		overall = "degraded"
+	}
+
+	core.JSONResponse(w, map[string]interface{}{
+		"status":       overall,
+		"generated_at": document.GeneratedAt,
+		"sections":     document.Sections,
+		"failed":       failed,
+	}, http.StatusOK)
+}
+
+// statusWorkspaces counts the workspaces by desired state and their agents
+// by liveness.
+func statusWorkspaces(store integrations.SQLStore) status.Section {
+	return func(ctx context.Context) (interface{}, error) {
+		rows, err := store.ExecuteQuery(`SELECT COALESCE(desired_state, 'unmanaged') AS state, COUNT(*) AS count FROM app_workspace GROUP BY 1`)
+		if err != nil {
+			return nil, fmt.Errorf("error counting workspaces: %v", err)
+		}
+		total := 0
+		byState := map[string]int{}
+		for _, row := range rows {
+			count, _ := strconv.Atoi(fmt.Sprint(row["count"]))
+			byState[fmt.Sprint(row["state"])] = count
+			total += count
+		}
+
+		heartbeats, err := heartbeatTracker.List()
+		if err != nil {
+			return nil, err
+		}
+		agents := map[heartbeat.State]int{heartbeat.StateReachable: 0, heartbeat.StateUnreachable: 0}
+		for _, beat := range heartbeats {
+			agents[beat.State]++
+		}
+
+		return map[string]interface{}{
+			"total":    total,
+			"by_state": byState,
+			"agents":   agents,
+		}, nil
+	}
+}
+
+func statusIntegrations(ctx context.Context) (interface{}, error) {
+	return readiness.DefaultGate().Report(), nil
+}
+
+// statusQueues reports how far behind the routine loads of the event topics
+// and the WebSocket consumers are.
+func statusQueues(ctx context.Context) (interface{}, error) {
+	loads := []map[string]interface{}{}
+	for _, load := range ingest.LastStatuses() {
+		loads = append(loads, map[string]interface{}{
+			"name":  load.Name,
+			"topic": load.Topic,
+			"state": load.State,
+			"lag":   load.TotalLag(),
+		})
+	}
+
+	consumers := wsqueue.Consumers()
+	return map[string]interface{}{
+		"routine_loads": loads,
+		"websocket": map[string]interface{}{
+			"connections":     consumers.Connections,
+			"depth":           consumers.Depth,
+			"max_lag_seconds": consumers.MaxLag.Seconds(),
+		},
+	}, nil
+}
+
+// statusReplication reports the WAL the change data capture slot is behind.
+func statusReplication(slot *cdc.Slot) status.Section {
+	return func(ctx context.Context) (interface{}, error) {
+		lag, err := slot.Lag(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return map[string]interface{}{"slot_lag_bytes": lag}, nil
+	}
+}
+
+func statusErrors(ctx context.Context) (interface{}, error) {
+	requests := status.DefaultRequests()
+	return map[string]interface{}{
+		"5m":  requests.Rate(5 * time.Minute),
+		"15m": requests.Rate(15 * time.Minute),
+		"1h":  requests.Rate(time.Hour),
+	}, nil
+}
+
+// statusRuns counts the agent runs that haven't finished, by state.
+func statusRuns(store integrations.SQLStore) status.Section {
+	return func(ctx context.Context) (interface{}, error) {
+		rows, err := store.ExecuteQuery(
+			`SELECT state, COUNT(*) AS count FROM app_agent_run WHERE state IN ($1, $2, $3) GROUP BY state`,
+			string(runs.StatePending), string(runs.StateRunning), string(runs.StatePaused),
+		)
+		if err != nil {
+			return nil, fmt.Errorf("error counting runs: %v", err)
+		}
+		active := 0
+		byState := map[string]int{string(runs.StatePending): 0, string(runs.StateRunning): 0, string(runs.StatePaused): 0}
+		for _, row := range rows {
+			count, _ := strconv.Atoi(fmt.Sprint(row["count"]))
+			byState[fmt.Sprint(row["state"])] = count
+			active += count
+		}
+		return map[string]interface{}{"active": active, "by_state": byState}, nil
+	}
+}
+
+func init() {
+	timeout, _ := core.GetSetting("STATUS_SECTION_TIMEOUT_SECONDS", 3)
+	cacheTTL, _ := core.GetSetting("STATUS_CACHE_SECONDS", 10)
+	statusCollector = status.NewCollector(time.Duration(timeout.(int))*time.Second, time.Duration(cacheTTL.(int))*time.Second)
+
+	postgres := integrations.GetPostgresStore("default")
+	statusCollector.Add("workspaces", statusWorkspaces(postgres))
+	statusCollector.Add("integrations", statusIntegrations)
+	statusCollector.Add("queues", statusQueues)
+	statusCollector.Add("errors", statusErrors)
+	statusCollector.Add("runs", statusRuns(postgres))
+	statusCollector.Add("slos", statusSLOs)
+	// the replication slot only exists where change data capture is set up
+	if config := cdc.Default(); config.Validate() == nil {
+		statusCollector.Add("replication", statusReplication(cdc.NewSlot(postgres, config.Slot, config.Tables)))
+	}
+
+	registerAPIView("status", Status, []string{"GET"}, []string{"HasAPIKey"})
+}
@@ -0,0 +1,163 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"github.com/gorilla/websocket"
+	"github.com/spectrumwebco/agent_runtime/backend/core/audit"
+	"github.com/spectrumwebco/agent_runtime/backend/core/rbac"
+	"github.com/spectrumwebco/agent_runtime/backend/core/tenancy"
+	"github.com/spectrumwebco/agent_runtime/backend/core/terminal"
+	"github.com/spectrumwebco/agent_runtime/backend/db/integrations"
+	"github.com/spectrumwebco/agent_runtime/pkg/djangogo/core"
+)
+
+var (
+	terminalLogger = log.New(log.Writer(), "kled.terminal: ", log.LstdFlags)
+
+	terminalExecutor     terminal.Executor
+	terminalExecutorErr  error
+	terminalExecutorOnce sync.Once
+
+	terminalUpgrader = websocket.Upgrader{
+		ReadBufferSize:  4096,
+		WriteBufferSize: 32 * 1024,
+		// the session is authenticated with the browser's cookies, so only
+		// pages served by this host may connect
+		CheckOrigin: func(r *http.Request) bool {
+			origin, err := url.Parse(r.Header.Get("Origin"))
+			return err == nil && origin.Host == r.Host
+		},
+	}
+)
+
+func getTerminalExecutor() (terminal.Executor, error) {
+	terminalExecutorOnce.Do(func() {
+		namespace, _ := core.GetSetting("TERMINAL_NAMESPACE", "")
+		// the agent executor uses the control channel of the workspace agent
+		// and falls back to exec into the pod for older workspaces
+		executor, _ := core.GetSetting("TERMINAL_EXECUTOR", "agent")
+		if executor.(string) == "kubernetes" {
+			terminalExecutor, terminalExecutorErr = terminal.NewKubernetesExecutor(namespace.(string))
+		} else {
+			terminalExecutor, terminalExecutorErr = terminal.NewAgentExecutor(namespace.(string))
+		}
+	})
+	return terminalExecutor, terminalExecutorErr
+}
+
+// checkWorkspace verifies that the workspace belongs to the caller's
+// organization.
+func checkWorkspace(ctx context.Context, workspaceID string) error {
+	rows, err := integrations.GetPostgresStore("default").ExecuteQuery(
+		`SELECT organization_id FROM app_workspace WHERE id = $1`, workspaceID,
+	)
+	if err != nil {
+		return fmt.Errorf("error loading workspace %s: %v", workspaceID, err)
+	}
+	tenant, ok := tenancy.FromContext(ctx)
+	if len(rows) == 0 || !ok || tenant.OrganizationID != fmt.Sprint(rows[0]["organization_id"]) {
+		return fmt.Errorf("workspace %s not found", workspaceID)
+	}
+	return nil
+}
+
+// WorkspaceTerminal serves a browser terminal for a workspace. A plain GET
+// returns the page, which connects back to the same URL over WebSocket.
+// Opening a terminal needs interpreter.execute on the workspace, which the
+// RBAC middleware checks before the view runs.
+func WorkspaceTerminal(w http.ResponseWriter, r *http.Request) {
+	workspaceID := mux.Vars(r)["workspace_id"]
+	if _, ok := rbac.SubjectFromContext(r.Context()); !ok {
+		core.JSONResponse(w, map[string]interface{}{"status": "error", "message": "opening a terminal was not authorized"}, http.StatusForbidden)
+		return
+	}
+	if err := checkWorkspace(r.Context(), workspaceID); err != nil {
+		core.JSONResponse(w, map[string]interface{}{"status": "error", "message": err.Error()}, http.StatusNotFound)
+		return
+	}
+
+	if !websocket.IsWebSocketUpgrade(r) {
+		if err := terminal.WritePage(w, workspaceID); err != nil {
+			terminalLogger.Printf("Error writing terminal page: %v", err)
+		}
+		return
+	}
+
+	executor, err := getTerminalExecutor()
+	if err != nil {
+		core.JSONResponse(w, map[string]interface{}{"status": "error", "message": err.Error()}, http.StatusServiceUnavailable)
+		return
+	}
+
+	conn, err := terminalUpgrader.Upgrade(w, r, nil)
+	if err != nil {
+		terminalLogger.Printf("Error upgrading terminal connection for workspace %s: %v", workspaceID, err)
+		return
+	}
+
+	idleTimeout, _ := core.GetSetting("TERMINAL_IDLE_TIMEOUT_SECONDS", 900)
+	sessionID := uuid.NewString()
+	// the session outlives the request context once the connection is hijacked
+	result := terminal.Serve(context.Background(), conn, executor, workspaceID, terminal.Options{
+		Size:        terminal.SizeFromQuery(r),
+		IdleTimeout: time.Duration(idleTimeout.(int)) * time.Second,
+	})
+
+	bucket, _ := core.GetSetting("TERMINAL_RECORDINGS_BUCKET", "terminal-recordings")
+	store := terminal.NewSupabaseRecordingStore(integrations.GetSupabaseManager(), bucket.(string))
+	recordingURL, err := store.Save(r.Context(), workspaceID+"/"+sessionID+".cast", result.Recording.Bytes())
+	if err != nil {
+		terminalLogger.Printf("Error saving terminal recording of workspace %s: %v", workspaceID, err)
+	}
+
+	recordTerminalSession(r, workspaceID, sessionID, result, recordingURL)
+}
+
+// recordTerminalSession adds the finished session to the audit log. GET
+// requests are not audited by the middleware.
+func recordTerminalSession(r *http.Request, workspaceID, sessionID string, result *terminal.Result, recordingURL string) {
+	entry := &audit.Entry{
+		Timestamp:    result.StartedAt,
+		ActorID:      "anonymous",
+		Action:       "terminal.session",
+		ResourceType: "workspace",
+		ResourceID:   workspaceID,
+		Method:       r.Method,
+		Path:         r.URL.Path,
+		StatusCode:   http.StatusSwitchingProtocols,
+		IPAddress:    requestClientIP(r),
+		UserAgent:    r.UserAgent(),
+		RequestID:    r.Header.Get("X-Request-ID"),
+		Metadata: map[string]interface{}{
+			"session_id":          sessionID,
+			"duration_seconds":    result.EndedAt.Sub(result.StartedAt).Seconds(),
+			"reason":              result.Reason,
+			"exit_code":           result.ExitCode,
+			"recording_url":       recordingURL,
+			"recording_truncated": result.Recording.Truncated(),
+		},
+	}
+	if user := core.GetUserFromRequest(r); user != nil && user.IsAuthenticated() {
+		entry.ActorID = user.GetID()
+	}
+	if result.Err != nil {
+		entry.Metadata["error"] = result.Err.Error()
+	}
+
+	if err := audit.DefaultStore().Append(context.Background(), entry); err != nil {
+		terminalLogger.Printf("Error writing audit entry for terminal session %s: %v", sessionID, err)
+	}
+}
+
+func init() {
+	registerAPIView("workspace_terminal", WorkspaceTerminal, []string{"GET"}, []string{"IsAuthenticated"})
+}
@@ -0,0 +1,208 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/spectrumwebco/agent_runtime/backend/apps/app/middleware"
+	"github.com/spectrumwebco/agent_runtime/backend/core/audit"
+	"github.com/spectrumwebco/agent_runtime/backend/core/rbac"
+	"github.com/spectrumwebco/agent_runtime/backend/core/tenancy"
+	"github.com/spectrumwebco/agent_runtime/backend/core/toolpolicy"
+	"github.com/spectrumwebco/agent_runtime/backend/core/wsproto"
+	"github.com/spectrumwebco/agent_runtime/backend/db/integrations"
+	"github.com/spectrumwebco/agent_runtime/pkg/djangogo/core"
+)
+
+// execCommand is the agent command running a program in the workspace, the
+// one checked against the tool policy.
+const execCommand = "exec"
+
+var (
+	toolPolicies  toolpolicy.PolicyStore = toolpolicy.NewMemoryPolicyStore()
+	toolApprovals *toolpolicy.Approvals
+	toolGate      *toolpolicy.Gate
+)
+
+// checkToolPolicy returns an error for exec commands the tool policy of the
+// workspace's organization blocks and no human approved.
+func checkToolPolicy(ctx context.Context, workspaceID, requestedBy, command string, params json.RawMessage) error {
+	if command != execCommand {
+		return nil
+	}
+	var exec struct {
+		Command []string `json:"command"`
+		Workdir string   `json:"workdir"`
+	}
+	if err := json.Unmarshal(params, &exec); err != nil {
+		return err
+	}
+	workspace, err := middleware.LookupWorkspace(ctx, "workspace", workspaceID)
+	if err != nil {
+		return err
+	}
+	return toolGate.Check(ctx, workspace.OrganizationID, workspaceID, requestedBy, toolpolicy.Command{Argv: exec.Command, Workdir: exec.Workdir})
+}
+
+// observeToolApproval audits blocked commands and the decisions on them, and
+// asks the requester and the workspace owner to decide on pending ones.
+func observeToolApproval(approval *toolpolicy.Approval) {
+	action := "tool_policy." + string(approval.Status)
+	actor := approval.RequestedBy
+	switch {
+	case approval.Status == toolpolicy.StatusPending:
+		action = "tool_policy.approval_requested"
+	case approval.Status == toolpolicy.StatusRejected && approval.DecidedBy == "":
+		action = "tool_policy.denied"
+	case approval.DecidedBy != "":
+		actor = approval.DecidedBy
+	}
+
+	entry := &audit.Entry{
+		Timestamp:    time.Now(),
+		ActorID:      actor,
+		Action:       action,
+		ResourceType: "workspace",
+		ResourceID:   approval.WorkspaceID,
+		StatusCode:   http.StatusForbidden,
+		Metadata: map[string]interface{}{
+			"command":      approval.Command.Argv,
+			"workdir":      approval.Command.Workdir,
+			"rule":         approval.Decision.Rule,
+			"reason":       approval.Decision.Reason,
+			"requested_by": approval.RequestedBy,
+		},
+	}
+	if approval.ID != "" {
+		entry.Metadata["approval_id"] = approval.ID
+	}
+	if approval.Status == toolpolicy.StatusApproved {
+		entry.StatusCode = http.StatusOK
+	}
+	if approval.Comment != "" {
+		entry.Metadata["comment"] = approval.Comment
+	}
+	if err := audit.DefaultStore().Append(context.Background(), entry); err != nil {
+		consumerLogger.Printf("Error writing audit entry for blocked command in workspace %s: %v", approval.WorkspaceID, err)
+	}
+
+	if approval.ID == "" {
+		return
+	}
+	messageType := "command_approval_decided"
+	if approval.Status == toolpolicy.StatusPending {
+		messageType = "command_approval_requested"
+	}
+	groups := []string{"user_" + approval.RequestedBy}
+	if workspace, err := middleware.LookupWorkspace(context.Background(), "workspace", approval.WorkspaceID); err == nil && workspace.OwnerID != "" && workspace.OwnerID != approval.RequestedBy {
+		groups = append(groups, "user_"+workspace.OwnerID)
+	}
+	for _, group := range groups {
+		err := GetManager().SendToGroup(group, map[string]interface{}{
+			"type":     messageType,
+			"approval": approval,
+		})
+		if err != nil {
+			consumerLogger.Printf("Error sending approval %s to %s: %v", approval.ID, group, err)
+		}
+	}
+}
+
+// handleApproveCommand records a human's decision on a blocked command. The
+// decision releases the command on whichever replica it waits.
+func (c *AgentWebSocketConsumer) handleApproveCommand(m *wsproto.ApproveCommand) {
+	ctx := context.Background()
+	approval, err := toolApprovals.Get(ctx, m.ApprovalID)
+	if errors.Is(err, toolpolicy.ErrApprovalNotFound) {
+		c.sendError(&wsproto.Error{Code: wsproto.CodeInvalidField, Message: err.Error(), Field: "approval_id", ID: m.ID})
+		return
+	} else if err != nil {
+		c.sendError(&wsproto.Error{Code: wsproto.CodeInternal, Message: err.Error(), ID: m.ID})
+		return
+	}
+	if reason, allowed := c.authorize(rbac.ActionCommandApprove, approval.WorkspaceID); !allowed {
+		c.sendError(&wsproto.Error{Code: wsproto.CodePermissionDenied, Message: "Permission denied: " + reason, ID: m.ID})
+		return
+	}
+
+	decided, err := toolApprovals.Decide(ctx, m.ApprovalID, *m.Approve, core.GetUserID(c.User), m.Comment)
+	if errors.Is(err, toolpolicy.ErrAlreadyDecided) {
+		message := err.Error()
+		if decided != nil {
+			message += ", it is " + string(decided.Status)
+		}
+		c.sendError(&wsproto.Error{Code: wsproto.CodeInvalidField, Message: message, Field: "approval_id", ID: m.ID})
+		return
+	} else if err != nil {
+		c.sendError(&wsproto.Error{Code: wsproto.CodeInternal, Message: err.Error(), ID: m.ID})
+		return
+	}
+	c.send(reply(m.ID, map[string]interface{}{
+		"type":     "command_approval_decided",
+		"approval": decided,
+	}))
+}
+
+// ToolPolicy reads, replaces or removes the tool policy of the caller's
+// organization.
+func ToolPolicy(w http.ResponseWriter, r *http.Request) {
+	tenant, ok := tenancy.FromContext(r.Context())
+	if !ok {
+		core.JSONResponse(w, map[string]interface{}{"status": "error", "message": "an organization is required to manage tool policies"}, http.StatusBadRequest)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		policy, err := toolpolicy.PolicyFor(r.Context(), toolPolicies, tenant.OrganizationID)
+		if err != nil {
+			core.JSONResponse(w, map[string]interface{}{"status": "error", "message": err.Error()}, http.StatusInternalServerError)
+			return
+		}
+		core.JSONResponse(w, map[string]interface{}{"status": "success", "policy": policy}, http.StatusOK)
+
+	case http.MethodPut:
+		policy := toolpolicy.DefaultPolicy()
+		if err := json.NewDecoder(r.Body).Decode(&policy); err != nil {
+			core.JSONResponse(w, map[string]interface{}{"status": "error", "message": err.Error()}, http.StatusBadRequest)
+			return
+		}
+		if err := policy.Validate(); err != nil {
+			core.JSONResponse(w, map[string]interface{}{"status": "error", "message": err.Error()}, http.StatusBadRequest)
+			return
+		}
+		before, _ := toolpolicy.PolicyFor(r.Context(), toolPolicies, tenant.OrganizationID)
+		if err := toolPolicies.SetPolicy(r.Context(), tenant.OrganizationID, policy); err != nil {
+			core.JSONResponse(w, map[string]interface{}{"status": "error", "message": err.Error()}, http.StatusInternalServerError)
+			return
+		}
+		recorder := audit.FromContext(r.Context())
+		recorder.SetResource("tool_policy", tenant.OrganizationID)
+		recorder.SetChange(before, policy)
+		core.JSONResponse(w, map[string]interface{}{"status": "success", "policy": policy}, http.StatusOK)
+
+	case http.MethodDelete:
+		if err := toolPolicies.DeletePolicy(r.Context(), tenant.OrganizationID); err != nil {
+			core.JSONResponse(w, map[string]interface{}{"status": "error", "message": err.Error()}, http.StatusInternalServerError)
+			return
+		}
+		audit.FromContext(r.Context()).SetResource("tool_policy", tenant.OrganizationID)
+		core.JSONResponse(w, map[string]interface{}{"status": "success"}, http.StatusOK)
+	}
+}
+
+func init() {
+	store := toolpolicy.NewPostgresPolicyStore(integrations.GetPostgresStore("default"))
+	if err := store.EnsureSchema(); err != nil {
+		logger.Printf("Tool policies falling back to in-memory store: %v", err)
+	} else {
+		toolPolicies = store
+	}
+	toolApprovals = toolpolicy.NewApprovals(integrations.GetKVStore(), integrations.GetLocker(), integrations.GetPubSub())
+	toolGate = toolpolicy.NewGate(toolPolicies, toolApprovals, observeToolApproval)
+
+	registerAPIView("tool_policy", ToolPolicy, []string{"GET", "PUT", "DELETE"}, []string{"IsAdminUser"})
+}
@@ -0,0 +1,67 @@
+package app
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"github.com/spectrumwebco/agent_runtime/backend/core/audit"
+	"github.com/spectrumwebco/agent_runtime/backend/core/tracing"
+	"github.com/spectrumwebco/agent_runtime/backend/db/integrations"
+	"github.com/spectrumwebco/agent_runtime/pkg/djangogo/core"
+)
+
+// GetTrace returns the timeline of a correlation ID: the API requests,
+// published events, agent commands and run state changes recorded for it,
+// merged with the audit log entries of the request.
+func GetTrace(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	if !tracing.ValidID(id) {
+		core.JSONResponse(w, map[string]interface{}{"status": "error", "message": "invalid trace ID"}, http.StatusBadRequest)
+		return
+	}
+
+	entries := []tracing.Entry{}
+	if store := tracing.DefaultStore(); store != nil {
+		recorded, err := store.Timeline(id)
+		if err != nil {
+			core.JSONResponse(w, map[string]interface{}{"status": "error", "message": err.Error()}, http.StatusInternalServerError)
+			return
+		}
+		entries = append(entries, recorded...)
+	}
+
+	audited, err := audit.DefaultStore().Query(r.Context(), audit.Filter{RequestID: id, Limit: audit.MaxQueryLimit})
+	if err != nil {
+		core.JSONResponse(w, map[string]interface{}{"status": "error", "message": err.Error()}, http.StatusInternalServerError)
+		return
+	}
+	for _, entry := range audited {
+		entries = append(entries, tracing.Entry{
+			ID:     strconv.FormatInt(entry.Sequence, 10),
+			Time:   entry.Timestamp,
+			Source: tracing.SourceAudit,
+			Name:   entry.Action + " " + entry.ResourceType,
+			Attributes: map[string]string{
+				"actor_id":    entry.ActorID,
+				"resource_id": entry.ResourceID,
+				"status_code": strconv.Itoa(entry.StatusCode),
+			},
+		})
+	}
+
+	if len(entries) == 0 {
+		core.JSONResponse(w, map[string]interface{}{"status": "error", "message": "no trace found for " + id}, http.StatusNotFound)
+		return
+	}
+	tracing.Sort(entries)
+	core.JSONResponse(w, map[string]interface{}{"status": "success", "id": id, "entries": entries}, http.StatusOK)
+}
+
+func init() {
+	if tracing.Default().Enabled {
+		tracing.SetDefaultStore(tracing.NewStore(integrations.GetKVStore(), tracing.Default()))
+	}
+
+	registerAPIView("get_trace", GetTrace, []string{"GET"}, []string{"IsAdminUser"})
+}
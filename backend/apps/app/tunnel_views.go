@@ -0,0 +1,282 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/spectrumwebco/agent_runtime/backend/apps/app/middleware"
+	"github.com/spectrumwebco/agent_runtime/backend/core/audit"
+	"github.com/spectrumwebco/agent_runtime/backend/core/events"
+	"github.com/spectrumwebco/agent_runtime/backend/core/jwtauth"
+	"github.com/spectrumwebco/agent_runtime/backend/core/tenancy"
+	"github.com/spectrumwebco/agent_runtime/backend/core/tunnel"
+	"github.com/spectrumwebco/agent_runtime/backend/db/integrations"
+	"github.com/spectrumwebco/agent_runtime/pkg/djangogo/core"
+)
+
+// tunnelPathPrefix is the path public tunnel links are served under.
+const tunnelPathPrefix = "/api/t/"
+
+var (
+	tunnelRelay  = tunnel.NewRelay(tunnel.ConfigureDefault(integrations.GetPostgresStore("default")), tunnelPathPrefix, auditTunnelEvent)
+	tunnelLogger = log.New(log.Writer(), "kled.tunnel: ", log.LstdFlags)
+)
+
+// auditTunnelEvent records relay events, which happen outside of the
+// authenticated API and are not seen by the audit middleware.
+func auditTunnelEvent(event tunnel.Event) {
+	entry := &audit.Entry{
+		Timestamp:    time.Now(),
+		ActorID:      event.Share.OwnerID,
+		Action:       event.Action,
+		ResourceType: "tunnel",
+		ResourceID:   event.Share.ID,
+		StatusCode:   event.StatusCode,
+		Metadata: map[string]interface{}{
+			"workspace_id": event.Share.WorkspaceID,
+			"port":         event.Share.Port,
+			"tenant":       event.Share.Tenant,
+		},
+	}
+	if event.Reason != "" {
+		entry.Metadata["reason"] = event.Reason
+	}
+
+	ctx := context.Background()
+	if r := event.Request; r != nil {
+		ctx = r.Context()
+		entry.Method = r.Method
+		entry.Path = r.URL.Path
+		entry.IPAddress = requestClientIP(r)
+		entry.UserAgent = r.UserAgent()
+		entry.RequestID = r.Header.Get("X-Request-ID")
+		if event.Action == tunnel.ActionAccess || event.Action == tunnel.ActionAccessDenied {
+			// visitors of a public link are not the owner of the share
+			entry.ActorID = "anonymous"
+		}
+	}
+
+	if err := audit.DefaultStore().Append(ctx, entry); err != nil {
+		tunnelLogger.Printf("Error writing audit entry for tunnel %s: %v", event.Share.ID, err)
+	}
+}
+
+// requestClientIP returns the client address of r, taken from
+// X-Forwarded-For only behind the TRUSTED_PROXIES.
+func requestClientIP(r *http.Request) string {
+	return middleware.ClientIP(r)
+}
+
+// tunnelBaseURL is the public origin links are built on. TUNNEL_PUBLIC_URL
+// is needed when the backend runs behind a proxy that rewrites the host.
+func tunnelBaseURL(r *http.Request) string {
+	if base, _ := core.GetSetting("TUNNEL_PUBLIC_URL", ""); base.(string) != "" {
+		return strings.TrimSuffix(base.(string), "/")
+	}
+
+	scheme := "http"
+	if r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https" {
+		scheme = "https"
+	}
+	return scheme + "://" + r.Host
+}
+
+func tunnelsEnabled() bool {
+	enabled, _ := core.GetSetting("TUNNELS_ENABLED", false)
+	return enabled.(bool)
+}
+
+type createTunnelRequest struct {
+	WorkspaceID string `json:"workspace_id" openapi:"required"`
+	Port        int    `json:"port" openapi:"required"`
+	TTLSeconds  int    `json:"ttl_seconds"`
+
+	// Preview is set when the tunnel serves a preview environment, whose link
+	// is then published as a workspace.preview_ready event.
+	Preview *struct {
+		Repository string `json:"repository"`
+		Ref        string `json:"ref"`
+	} `json:"preview,omitempty"`
+}
+
+// CreateTunnel creates a public link for a workspace port. The response holds
+// the only copy of the access and connect tokens.
+func CreateTunnel(w http.ResponseWriter, r *http.Request) {
+	if !tunnelsEnabled() {
+		core.JSONResponse(w, map[string]interface{}{"status": "error", "message": "tunnels are disabled on this server"}, http.StatusForbidden)
+		return
+	}
+
+	tenant, ok := tenancy.FromContext(r.Context())
+	if !ok {
+		core.JSONResponse(w, map[string]interface{}{"status": "error", "message": "a project is required to create tunnels"}, http.StatusBadRequest)
+		return
+	}
+
+	var request createTunnelRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		core.JSONResponse(w, map[string]interface{}{"status": "error", "message": fmt.Sprintf("invalid request body: %v", err)}, http.StatusBadRequest)
+		return
+	}
+
+	ownerID := "anonymous"
+	if user := core.GetUserFromRequest(r); user != nil && user.IsAuthenticated() {
+		ownerID = user.GetID()
+	} else if claims := jwtauth.FromContext(r.Context()); claims != nil {
+		ownerID = claims.Subject
+	}
+
+	share, credentials, err := tunnel.NewShare(request.WorkspaceID, request.Port, ownerID, tenant.String(), time.Duration(request.TTLSeconds)*time.Second, time.Now())
+	if err != nil {
+		core.JSONResponse(w, map[string]interface{}{"status": "error", "message": err.Error()}, http.StatusBadRequest)
+		return
+	}
+	if err := tunnelRelay.Store().Create(r.Context(), share); err != nil {
+		core.JSONResponse(w, map[string]interface{}{"status": "error", "message": err.Error()}, http.StatusInternalServerError)
+		return
+	}
+
+	recorder := audit.FromContext(r.Context())
+	recorder.SetResource("tunnel", share.ID)
+	recorder.AddMetadata("workspace_id", share.WorkspaceID)
+	recorder.AddMetadata("port", share.Port)
+	recorder.AddMetadata("expires_at", share.ExpiresAt)
+
+	url := tunnelRelay.URL(tunnelBaseURL(r), share.ID) + "?token=" + credentials.AccessToken
+	if request.Preview != nil {
+		event := events.NewWorkspaceEvent(r.Context(), events.WorkspacePreviewReady, share.WorkspaceID)
+		event.OrganizationID = tenant.OrganizationID
+		event.ActorID = ownerID
+		event.Attributes = map[string]string{
+			"url":        url,
+			"tunnel_id":  share.ID,
+			"port":       strconv.Itoa(share.Port),
+			"repository": request.Preview.Repository,
+			"ref":        request.Preview.Ref,
+			"expires_at": share.ExpiresAt.UTC().Format(time.RFC3339),
+		}
+		events.Emit(r.Context(), event)
+	}
+
+	core.JSONResponse(w, map[string]interface{}{
+		"status":        "success",
+		"tunnel":        share,
+		"url":           url,
+		"access_token":  credentials.AccessToken,
+		"connect_token": credentials.ConnectToken,
+	}, http.StatusCreated)
+}
+
+// ListTunnels returns the tunnels of the caller's project.
+func ListTunnels(w http.ResponseWriter, r *http.Request) {
+	tenant, ok := tenancy.FromContext(r.Context())
+	if !ok {
+		core.JSONResponse(w, map[string]interface{}{"status": "error", "message": "a project is required to list tunnels"}, http.StatusBadRequest)
+		return
+	}
+
+	shares, err := tunnelRelay.Store().List(r.Context(), tenant.String())
+	if err != nil {
+		core.JSONResponse(w, map[string]interface{}{"status": "error", "message": err.Error()}, http.StatusInternalServerError)
+		return
+	}
+
+	tunnels := make([]map[string]interface{}, 0, len(shares))
+	for _, share := range shares {
+		tunnels = append(tunnels, map[string]interface{}{
+			"id":           share.ID,
+			"workspace_id": share.WorkspaceID,
+			"port":         share.Port,
+			"owner_id":     share.OwnerID,
+			"created_at":   share.CreatedAt,
+			"expires_at":   share.ExpiresAt,
+			"connected":    tunnelRelay.Connected(share.ID),
+		})
+	}
+
+	core.JSONResponse(w, map[string]interface{}{"status": "success", "tunnels": tunnels}, http.StatusOK)
+}
+
+// RevokeTunnel deletes a tunnel and disconnects the workspace serving it.
+func RevokeTunnel(w http.ResponseWriter, r *http.Request) {
+	tunnelID := mux.Vars(r)["tunnel_id"]
+	audit.FromContext(r.Context()).SetResource("tunnel", tunnelID)
+
+	tenant, ok := tenancy.FromContext(r.Context())
+	share, err := tunnelRelay.Store().Get(r.Context(), tunnelID)
+	if err == nil && (!ok || share.Tenant != tenant.String()) {
+		err = tunnel.ErrNotFound
+	}
+	if err == nil {
+		err = tunnelRelay.Revoke(r.Context(), tunnelID)
+	}
+	if errors.Is(err, tunnel.ErrNotFound) {
+		core.JSONResponse(w, map[string]interface{}{"status": "error", "message": err.Error()}, http.StatusNotFound)
+		return
+	} else if err != nil {
+		core.JSONResponse(w, map[string]interface{}{"status": "error", "message": err.Error()}, http.StatusInternalServerError)
+		return
+	}
+
+	core.JSONResponse(w, map[string]interface{}{"status": "success"}, http.StatusOK)
+}
+
+// TunnelConnect is the control connection of the CLI serving a tunnel. It is
+// authenticated with the connect token instead of an API key.
+func TunnelConnect(w http.ResponseWriter, r *http.Request) {
+	tunnelRelay.Connect(w, r, mux.Vars(r)["tunnel_id"])
+}
+
+// TunnelStream carries a single visitor connection from the CLI.
+func TunnelStream(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	tunnelRelay.AcceptStream(w, r, vars["tunnel_id"], vars["stream_id"])
+}
+
+// TunnelProxy serves a public link. The relay records accesses itself, so
+// the request is not audited a second time.
+func TunnelProxy(w http.ResponseWriter, r *http.Request) {
+	audit.FromContext(r.Context()).Skip()
+
+	vars := mux.Vars(r)
+	tunnelRelay.ServeShare(w, r, vars["tunnel_id"], vars["rest"])
+}
+
+// NewTunnelHostMiddleware serves the requests for the hosts of shares below
+// TUNNEL_SHARE_DOMAIN. They never reach the API, so workspace apps can't
+// call it from their own origin.
+func NewTunnelHostMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := tunnelRelay.ShareFromHost(r.Host); ok {
+			tunnelRelay.ServeHost(w, r)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func init() {
+	domain, _ := core.GetSetting("TUNNEL_SHARE_DOMAIN", "")
+	tunnelRelay.ShareDomain = strings.Trim(domain.(string), ".")
+	if tunnelRelay.ShareDomain == "" && tunnelsEnabled() {
+		tunnelLogger.Printf("TUNNEL_SHARE_DOMAIN is not set, public links are served on the origin of the backend")
+	}
+	go tunnelRelay.Run(context.Background(), time.Minute)
+
+	core.RegisterMiddleware("TunnelHostMiddleware", NewTunnelHostMiddleware)
+
+	registerAPIView("create_tunnel", CreateTunnel, []string{"POST"}, []string{"HasAPIKey"})
+	registerAPIView("list_tunnels", ListTunnels, []string{"GET"}, []string{"HasAPIKey"})
+	registerAPIView("revoke_tunnel", RevokeTunnel, []string{"DELETE"}, []string{"HasAPIKey"})
+	registerAPIView("tunnel_connect", TunnelConnect, []string{"GET"}, []string{"AllowAny"})
+	registerAPIView("tunnel_stream", TunnelStream, []string{"GET"}, []string{"AllowAny"})
+	registerAPIView("tunnel_proxy", TunnelProxy, []string{"GET", "HEAD", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"}, []string{"AllowAny"})
+}
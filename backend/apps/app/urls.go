@@ -11,7 +11,7 @@ func init() {
 	router.Register("state/shared", "SharedStateViewSet", "shared-state")
 	router.Register("conversations", "ConversationViewSet", "conversation")
 
-	api.RegisterURLPatterns([]api.URLPattern{
+	registerURLPatterns([]api.URLPattern{
 		{Path: "", Include: router.URLs()},
 
 		{Path: "auth/login/", View: "login_view", Name: "login"},
@@ -36,5 +36,130 @@ func init() {
 		{Path: "billing/credits/", View: "get_credits", Name: "get-credits"},
 		{Path: "billing/credits/add/", View: "add_credits", Name: "add-credits"},
 
+		{Path: "audit/", View: "list_audit_log", Name: "audit-log"},
+		{Path: "audit/export/", View: "export_audit_log", Name: "audit-log-export"},
+		{Path: "audit/verify/", View: "verify_audit_log", Name: "audit-log-verify"},
+
+		{Path: "traces/<str:id>/", View: "get_trace", Name: "trace-detail"},
+
+		{Path: "quota/", View: "show_quota", Name: "quota"},
+		{Path: "quota/limits/", View: "set_quota_limit", Name: "quota-limits"},
+		{Path: "quota/usage/", View: "report_quota_usage", Name: "quota-usage"},
+
+		{Path: "gpu/samples/", View: "report_gpu_samples", Name: "gpu-samples"},
+		{Path: "gpu/policies/", View: "gpu_policy", Name: "gpu-policy"},
+		{Path: "tool-policy/", View: "tool_policy", Name: "tool-policy"},
+		{Path: "chaos/faults/", View: "chaos_faults", Name: "chaos-faults"},
+		{Path: "chaos/faults/<str:name>/", View: "delete_chaos_fault", Name: "chaos-fault"},
+
+		{Path: "autoscaling/signals/", View: "autoscaling_signals", Name: "autoscaling-signals"},
+		{Path: "autoscaling/advice/", View: "autoscaling_advice", Name: "autoscaling-advice"},
+
+		{Path: "holidays/", View: "list_holidays", Name: "holidays"},
+		{Path: "holidays/<str:date>/", View: "holiday", Name: "holiday"},
+
+		{Path: "workspaces/", View: "workspace_create", Name: "workspace-create"},
+		{Path: "workspaces/heartbeats/", View: "list_workspace_heartbeats", Name: "workspace-heartbeats"},
+		{Path: "workspaces/<str:workspace_id>/", View: "workspace_delete", Name: "workspace-delete"},
+		{Path: "workspaces/<str:workspace_id>/start/", View: "workspace_start", Name: "workspace-start"},
+		{Path: "workspaces/<str:workspace_id>/stop/", View: "workspace_stop", Name: "workspace-stop"},
+		{Path: "workspaces/<str:workspace_id>/terminal/", View: "workspace_terminal", Name: "workspace-terminal"},
+		{Path: "workspaces/<str:workspace_id>/coedit/", View: "workspace_coedit", Name: "workspace-coedit"},
+		{Path: "workspaces/<str:workspace_id>/schedule/", View: "workspace_schedule", Name: "workspace-schedule"},
+		{Path: "workspaces/<str:workspace_id>/scratchpad/", View: "scratchpad_entries", Name: "workspace-scratchpad"},
+		{Path: "workspaces/<str:workspace_id>/scratchpad/<str:key>/", View: "set_scratchpad_entry", Name: "workspace-scratchpad-entry"},
+		{Path: "workspaces/<str:workspace_id>/scratchpad/<str:key>/lock/", View: "lock_scratchpad_entry", Name: "workspace-scratchpad-lock"},
+		{Path: "workspaces/<str:workspace_id>/scratchpad/<str:key>/unlock/", View: "unlock_scratchpad_entry", Name: "workspace-scratchpad-unlock"},
+		{Path: "workspaces/<str:workspace_id>/tasks/", View: "claimed_tasks", Name: "workspace-tasks"},
+		{Path: "workspaces/<str:workspace_id>/tasks/enqueue/", View: "enqueue_task", Name: "workspace-task-enqueue"},
+		{Path: "workspaces/<str:workspace_id>/tasks/claim/", View: "claim_task", Name: "workspace-task-claim"},
+		{Path: "workspaces/<str:workspace_id>/tasks/<str:task_id>/ack/", View: "ack_task", Name: "workspace-task-ack"},
+		{Path: "workspaces/<str:workspace_id>/edits/", View: "workspace_edits", Name: "workspace-edits"},
+		{Path: "workspaces/<str:workspace_id>/diff/", View: "workspace_diff", Name: "workspace-diff"},
+		{Path: "workspaces/<str:workspace_id>/snapshots/", View: "create_workspace_snapshot", Name: "workspace-snapshots"},
+		{Path: "workspaces/<str:workspace_id>/patch/", View: "apply_workspace_patch", Name: "workspace-patch"},
+		{Path: "workspaces/<str:workspace_id>/publish/", View: "publish_workspace", Name: "workspace-publish"},
+		{Path: "outputs/<str:output_id>/", View: "command_output", Name: "command-output"},
+
+		{Path: "tunnels/", View: "list_tunnels", Name: "tunnels"},
+		{Path: "tunnels/create/", View: "create_tunnel", Name: "tunnel-create"},
+		{Path: "tunnels/<str:tunnel_id>/", View: "revoke_tunnel", Name: "tunnel-revoke"},
+		{Path: "tunnels/<str:tunnel_id>/connect/", View: "tunnel_connect", Name: "tunnel-connect"},
+		{Path: "tunnels/<str:tunnel_id>/streams/<str:stream_id>/", View: "tunnel_stream", Name: "tunnel-stream"},
+		{Path: "t/<str:tunnel_id>/<path:rest>", View: "tunnel_proxy", Name: "tunnel-proxy"},
+
+		{Path: "webhooks/", View: "list_webhooks", Name: "webhooks"},
+		{Path: "webhooks/create/", View: "create_webhook", Name: "webhook-create"},
+		{Path: "webhooks/deliveries/", View: "list_webhook_deliveries", Name: "webhook-deliveries"},
+		{Path: "webhooks/deliveries/<str:delivery_id>/redeliver/", View: "redeliver_webhook", Name: "webhook-redeliver"},
+		{Path: "webhooks/<str:webhook_id>/", View: "delete_webhook", Name: "webhook-delete"},
+		{Path: "integrations/github/webhook/", View: "github_webhook", Name: "github-webhook"},
+		{Path: "notifications/channels/", View: "list_notification_channels", Name: "notification-channels"},
+		{Path: "notifications/channels/create/", View: "create_notification_channel", Name: "notification-channel-create"},
+		{Path: "notifications/channels/<str:channel_id>/test/", View: "test_notification_channel", Name: "notification-channel-test"},
+		{Path: "notifications/channels/<str:channel_id>/", View: "delete_notification_channel", Name: "notification-channel-delete"},
+		{Path: "email/preferences/", View: "email_preferences", Name: "email-preferences"},
+
+		{Path: "sessions/", View: "list_sessions", Name: "sessions"},
+		{Path: "sessions/create/", View: "create_session", Name: "session-create"},
+		{Path: "sessions/refresh/", View: "refresh_session", Name: "session-refresh"},
+		{Path: "sessions/revoke-others/", View: "revoke_other_sessions", Name: "session-revoke-others"},
+		{Path: "sessions/<str:session_id>/", View: "revoke_session", Name: "session-revoke"},
+
+		{Path: "llm/chat/", View: "llm_chat", Name: "llm-chat"},
+		{Path: "llm/embeddings/", View: "llm_embeddings", Name: "llm-embeddings"},
+		{Path: "llm/models/", View: "llm_models", Name: "llm-models"},
+		{Path: "llm/usage/", View: "llm_usage", Name: "llm-usage"},
+		{Path: "llm/budget/", View: "llm_budget", Name: "llm-budget"},
+		{Path: "llm/budget/limits/", View: "set_llm_budget", Name: "llm-budget-limits"},
+		{Path: "vectors/<str:index>/ingest/", View: "ingest_documents", Name: "vector-ingest"},
+		{Path: "vectors/<str:index>/search/", View: "search_documents", Name: "vector-search"},
+
+		{Path: "experiments/", View: "list_experiments", Name: "experiments"},
+		{Path: "experiments/create/", View: "create_experiment", Name: "experiment-create"},
+		{Path: "experiments/<str:experiment_id>/stop/", View: "stop_experiment", Name: "experiment-stop"},
+		{Path: "experiments/<str:experiment_id>/assign/", View: "assign_experiment", Name: "experiment-assign"},
+		{Path: "experiments/<str:experiment_id>/report/", View: "experiment_report", Name: "experiment-report"},
+
+		{Path: "prompts/", View: "list_prompts", Name: "prompts"},
+		{Path: "prompts/create/", View: "create_prompt", Name: "prompt-create"},
+		{Path: "prompts/render/", View: "render_prompt", Name: "prompt-render"},
+		{Path: "prompts/<str:name>/versions/", View: "prompt_versions", Name: "prompt-versions"},
+		{Path: "prompts/<str:name>/tags/", View: "tag_prompt", Name: "prompt-tags"},
+
+		{Path: "runs/", View: "list_runs", Name: "runs"},
+		{Path: "runs/start/", View: "start_run", Name: "run-start"},
+		{Path: "runs/<str:run_id>/", View: "get_run", Name: "run-detail"},
+		{Path: "runs/<str:run_id>/pause/", View: "pause_run", Name: "run-pause"},
+		{Path: "runs/<str:run_id>/resume/", View: "resume_run", Name: "run-resume"},
+		{Path: "runs/<str:run_id>/cancel/", View: "cancel_run", Name: "run-cancel"},
+		{Path: "runs/<str:run_id>/checkpoint/", View: "save_run_checkpoint", Name: "run-checkpoint"},
+		{Path: "runs/<str:run_id>/finish/", View: "finish_run", Name: "run-finish"},
+		{Path: "runs/<str:run_id>/artifacts/", View: "run_artifacts", Name: "run-artifacts"},
+		{Path: "artifacts/<str:artifact_id>/download/", View: "download_artifact", Name: "artifact-download"},
+
+		{Path: "analytics/materialized-views/", View: "materialized_views", Name: "materialized-views"},
+		{Path: "analytics/materialized-views/<str:name>/", View: "materialized_view", Name: "materialized-view"},
+		{Path: "analytics/materialized-views/<str:name>/refresh/", View: "refresh_materialized_view", Name: "materialized-view-refresh"},
+		{Path: "analytics/tables/<str:table>/rollups/", View: "table_rollups", Name: "table-rollups"},
+		{Path: "analytics/tables/<str:table>/rollups/<str:name>/", View: "drop_table_rollup", Name: "table-rollup-drop"},
+		{Path: "analytics/route/", View: "route_doris_query", Name: "analytics-route"},
+		{Path: "analytics/routine-loads/", View: "list_routine_loads", Name: "routine-loads"},
+		{Path: "analytics/routine-loads/ensure/", View: "ensure_routine_loads", Name: "routine-loads-ensure"},
+		{Path: "analytics/routine-loads/<str:name>/", View: "get_routine_load", Name: "routine-load"},
+		{Path: "analytics/routine-loads/<str:name>/pause/", View: "pause_routine_load", Name: "routine-load-pause"},
+		{Path: "analytics/routine-loads/<str:name>/resume/", View: "resume_routine_load", Name: "routine-load-resume"},
+
+		{Path: "metrics/", View: "metrics", Name: "metrics"},
+		{Path: "health/ready/", View: "readiness", Name: "readiness"},
+		{Path: "status/", View: "status", Name: "status"},
+		{Path: "debug/pprof/", View: "pprof_index", Name: "pprof-index"},
+		{Path: "debug/pprof/<str:profile>", View: "pprof", Name: "pprof"},
+		{Path: "openapi.json", View: "openapi_document", Name: "openapi-document"},
+
+		{Path: "graphql/", View: "graphql", Name: "graphql"},
+
+		{Path: "sse/state/<str:state_type>/<str:state_id>/", View: "state_events", Name: "state-events"},
+
 	})
 }
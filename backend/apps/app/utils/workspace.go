@@ -1,6 +1,7 @@
 package utils
 
 import (
+	"context"
 	"fmt"
 	"io/ioutil"
 	"log"
@@ -9,28 +10,24 @@ import (
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/spectrumwebco/agent_runtime/backend/core/tenancy"
 	"github.com/spectrumwebco/agent_runtime/pkg/djangogo/core"
 )
 
 var logger = log.New(os.Stdout, "[Workspace] ", log.LstdFlags)
 
-func CreateWorkspace() string {
+// CreateWorkspace creates a workspace directory under the tenant in ctx. It
+// only makes the directory; workspaces are created by workspace.Controller,
+// which emits their lifecycle events.
+func CreateWorkspace(ctx context.Context) string {
 	workspaceID := uuid.New().String()
 	
-	settings, err := core.GetSettings()
-	if err != nil {
-		logger.Printf("Error getting settings: %v", err)
-		return ""
-	}
-	
-	workspacesDir, ok := settings.Get("WORKSPACES_DIR")
-	if !ok {
-		logger.Printf("WORKSPACES_DIR not found in settings")
+	workspacePath := GetWorkspacePath(ctx, workspaceID)
+	if workspacePath == "" {
 		return ""
 	}
 	
-	workspacePath := filepath.Join(workspacesDir.(string), workspaceID)
-	err = os.MkdirAll(workspacePath, 0755)
+	err := os.MkdirAll(workspacePath, 0755)
 	if err != nil {
 		logger.Printf("Error creating workspace directory: %v", err)
 		return ""
@@ -41,7 +38,15 @@ func CreateWorkspace() string {
 	return workspaceID
 }
 
-func GetWorkspacePath(workspaceID string) string {
+// GetWorkspacePath returns WORKSPACES_DIR/<organization>/<project>/<id> for
+// the tenant in ctx, so one tenant's paths never resolve into another's.
+func GetWorkspacePath(ctx context.Context, workspaceID string) string {
+	tenant, err := tenancy.Require(ctx)
+	if err != nil {
+		logger.Printf("Error resolving workspace path: %v", err)
+		return ""
+	}
+	
 	settings, err := core.GetSettings()
 	if err != nil {
 		logger.Printf("Error getting settings: %v", err)
@@ -54,7 +59,12 @@ func GetWorkspacePath(workspaceID string) string {
 		return ""
 	}
 	
-	return filepath.Join(workspacesDir.(string), workspaceID)
+	if workspaceID != filepath.Base(workspaceID) {
+		logger.Printf("Invalid workspace ID %q", workspaceID)
+		return ""
+	}
+	
+	return filepath.Join(workspacesDir.(string), filepath.FromSlash(tenant.String()), workspaceID)
 }
 
 type FileInfo struct {
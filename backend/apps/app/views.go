@@ -68,7 +68,7 @@ func ExecuteAgentTask(w http.ResponseWriter, r *http.Request) {
 }
 
 func init() {
-	core.RegisterAPIView("api_root", APIRoot, []string{"GET"}, []string{"AllowAny"})
-	core.RegisterAPIView("execute_agent_task", ExecuteAgentTask, []string{"POST"}, []string{"IsAuthenticated"})
+	registerAPIView("api_root", APIRoot, []string{"GET"}, []string{"AllowAny"})
+	registerAPIView("execute_agent_task", ExecuteAgentTask, []string{"POST"}, []string{"IsAuthenticated"})
 	core.RegisterViewSet("UserViewSet", NewUserViewSet())
 }
@@ -0,0 +1,177 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/spectrumwebco/agent_runtime/backend/core/audit"
+	"github.com/spectrumwebco/agent_runtime/backend/core/tenancy"
+	"github.com/spectrumwebco/agent_runtime/backend/core/webhooks"
+	"github.com/spectrumwebco/agent_runtime/backend/db/integrations"
+	"github.com/spectrumwebco/agent_runtime/pkg/djangogo/core"
+)
+
+var webhookDispatcher *webhooks.Dispatcher
+
+type createWebhookRequest struct {
+	URL         string   `json:"url" openapi:"required"`
+	EventTypes  []string `json:"event_types" openapi:"required"`
+	Description string   `json:"description"`
+}
+
+// CreateWebhook registers an endpoint for the caller's organization. The
+// response holds the only copy of the signing secret.
+func CreateWebhook(w http.ResponseWriter, r *http.Request) {
+	tenant, ok := tenancy.FromContext(r.Context())
+	if !ok {
+		core.JSONResponse(w, map[string]interface{}{"status": "error", "message": "an organization is required to create webhooks"}, http.StatusBadRequest)
+		return
+	}
+
+	var request createWebhookRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		core.JSONResponse(w, map[string]interface{}{"status": "error", "message": fmt.Sprintf("invalid request body: %v", err)}, http.StatusBadRequest)
+		return
+	}
+
+	endpoint, err := webhooks.NewEndpoint(tenant.OrganizationID, request.URL, request.EventTypes, webhooks.Default().AllowHTTP, time.Now())
+	if err != nil {
+		core.JSONResponse(w, map[string]interface{}{"status": "error", "message": err.Error()}, http.StatusBadRequest)
+		return
+	}
+	endpoint.Description = request.Description
+	if err := webhookDispatcher.Store().CreateEndpoint(r.Context(), endpoint); err != nil {
+		core.JSONResponse(w, map[string]interface{}{"status": "error", "message": err.Error()}, http.StatusInternalServerError)
+		return
+	}
+
+	recorder := audit.FromContext(r.Context())
+	recorder.SetResource("webhook", endpoint.ID)
+	recorder.AddMetadata("url", endpoint.URL)
+	recorder.AddMetadata("event_types", endpoint.EventTypes)
+
+	core.JSONResponse(w, map[string]interface{}{
+		"status":  "success",
+		"webhook": endpoint,
+		"secret":  endpoint.Secret,
+	}, http.StatusCreated)
+}
+
+// ListWebhooks returns the endpoints of the caller's organization.
+func ListWebhooks(w http.ResponseWriter, r *http.Request) {
+	tenant, ok := tenancy.FromContext(r.Context())
+	if !ok {
+		core.JSONResponse(w, map[string]interface{}{"status": "error", "message": "an organization is required to list webhooks"}, http.StatusBadRequest)
+		return
+	}
+
+	endpoints, err := webhookDispatcher.Store().ListEndpoints(r.Context(), tenant.OrganizationID)
+	if err != nil {
+		core.JSONResponse(w, map[string]interface{}{"status": "error", "message": err.Error()}, http.StatusInternalServerError)
+		return
+	}
+
+	core.JSONResponse(w, map[string]interface{}{"status": "success", "webhooks": endpoints}, http.StatusOK)
+}
+
+// DeleteWebhook removes an endpoint along with its delivery log.
+func DeleteWebhook(w http.ResponseWriter, r *http.Request) {
+	webhookID := mux.Vars(r)["webhook_id"]
+	audit.FromContext(r.Context()).SetResource("webhook", webhookID)
+
+	tenant, ok := tenancy.FromContext(r.Context())
+	endpoint, err := webhookDispatcher.Store().GetEndpoint(r.Context(), webhookID)
+	if err == nil && (!ok || endpoint.OrganizationID != tenant.OrganizationID) {
+		err = webhooks.ErrNotFound
+	}
+	if err == nil {
+		err = webhookDispatcher.Store().DeleteEndpoint(r.Context(), webhookID)
+	}
+	if errors.Is(err, webhooks.ErrNotFound) {
+		core.JSONResponse(w, map[string]interface{}{"status": "error", "message": err.Error()}, http.StatusNotFound)
+		return
+	} else if err != nil {
+		core.JSONResponse(w, map[string]interface{}{"status": "error", "message": err.Error()}, http.StatusInternalServerError)
+		return
+	}
+
+	core.JSONResponse(w, map[string]interface{}{"status": "success"}, http.StatusOK)
+}
+
+// ListWebhookDeliveries is the delivery log of the caller's organization,
+// newest first. status=dead lists the dead letters.
+func ListWebhookDeliveries(w http.ResponseWriter, r *http.Request) {
+	tenant, ok := tenancy.FromContext(r.Context())
+	if !ok {
+		core.JSONResponse(w, map[string]interface{}{"status": "error", "message": "an organization is required to list webhook deliveries"}, http.StatusBadRequest)
+		return
+	}
+
+	query := r.URL.Query()
+	filter := webhooks.DeliveryFilter{OrganizationID: tenant.OrganizationID, EndpointID: query.Get("webhook_id")}
+	if value := query.Get("status"); value != "" {
+		status, err := webhooks.ParseStatus(value)
+		if err != nil {
+			core.JSONResponse(w, map[string]interface{}{"status": "error", "message": err.Error()}, http.StatusBadRequest)
+			return
+		}
+		filter.Status = status
+	}
+	if value := query.Get("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit < 1 || limit > 1000 {
+			core.JSONResponse(w, map[string]interface{}{"status": "error", "message": "limit must be a number between 1 and 1000"}, http.StatusBadRequest)
+			return
+		}
+		filter.Limit = limit
+	}
+
+	deliveries, err := webhookDispatcher.Store().ListDeliveries(r.Context(), filter)
+	if err != nil {
+		core.JSONResponse(w, map[string]interface{}{"status": "error", "message": err.Error()}, http.StatusInternalServerError)
+		return
+	}
+
+	core.JSONResponse(w, map[string]interface{}{"status": "success", "deliveries": deliveries}, http.StatusOK)
+}
+
+// RedeliverWebhook queues a delivery again, typically a dead letter.
+func RedeliverWebhook(w http.ResponseWriter, r *http.Request) {
+	deliveryID := mux.Vars(r)["delivery_id"]
+	audit.FromContext(r.Context()).SetResource("webhook_delivery", deliveryID)
+
+	tenant, ok := tenancy.FromContext(r.Context())
+	delivery, err := webhookDispatcher.Store().GetDelivery(r.Context(), deliveryID)
+	if err == nil && (!ok || delivery.OrganizationID != tenant.OrganizationID) {
+		err = webhooks.ErrNotFound
+	}
+	if err == nil {
+		err = webhookDispatcher.Redeliver(r.Context(), delivery)
+	}
+	if errors.Is(err, webhooks.ErrNotFound) {
+		core.JSONResponse(w, map[string]interface{}{"status": "error", "message": err.Error()}, http.StatusNotFound)
+		return
+	} else if err != nil {
+		core.JSONResponse(w, map[string]interface{}{"status": "error", "message": err.Error()}, http.StatusInternalServerError)
+		return
+	}
+
+	core.JSONResponse(w, map[string]interface{}{"status": "success", "delivery": delivery}, http.StatusOK)
+}
+
+func init() {
+	webhookDispatcher = webhooks.ConfigureDefault(integrations.GetPostgresStore("default"), webhooks.Default())
+	go webhookDispatcher.Run(context.Background())
+
+	registerAPIView("create_webhook", CreateWebhook, []string{"POST"}, []string{"HasAPIKey"})
+	registerAPIView("list_webhooks", ListWebhooks, []string{"GET"}, []string{"HasAPIKey"})
+	registerAPIView("delete_webhook", DeleteWebhook, []string{"DELETE"}, []string{"HasAPIKey"})
+	registerAPIView("list_webhook_deliveries", ListWebhookDeliveries, []string{"GET"}, []string{"HasAPIKey"})
+	registerAPIView("redeliver_webhook", RedeliverWebhook, []string{"POST"}, []string{"HasAPIKey"})
+}
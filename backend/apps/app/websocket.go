@@ -1,12 +1,12 @@
 package app
 
 import (
-	"encoding/json"
 	"log"
 	"os"
 	"sync"
 
 	"github.com/gorilla/websocket"
+	"github.com/spectrumwebco/agent_runtime/backend/core/wsproto"
 	"github.com/spectrumwebco/agent_runtime/pkg/djangogo/core"
 )
 
@@ -44,6 +44,7 @@ func (c *AgentConsumer) Connect() error {
 		"message":   "Connected",
 		"client_id": c.clientID,
 		"task_id":   c.taskID,
+		"protocol":  agentTaskEndpoint.Info(),
 	})
 }
 
@@ -61,92 +62,63 @@ func (c *AgentConsumer) Disconnect() error {
 	return c.conn.Close()
 }
 
+var agentTaskEndpoint = wsproto.NewEndpoint(wsproto.FeatureTaskUpdates, wsproto.FeatureAgentCommands)
+
 func (c *AgentConsumer) Receive() {
 	for {
-		_, message, err := c.conn.ReadMessage()
+		_, frame, err := c.conn.ReadMessage()
 		if err != nil {
 			logger.Printf("Error reading message: %v", err)
 			break
 		}
 
-		var data map[string]interface{}
-		if err := json.Unmarshal(message, &data); err != nil {
-			logger.Printf("Invalid JSON received: %s", message)
-			c.sendMessage(map[string]interface{}{
-				"type":    "error",
-				"message": "Invalid JSON",
-			})
+		message, protocolErr := agentTaskEndpoint.Decode(frame)
+		if protocolErr != nil {
+			logger.Printf("Rejected frame from client %s: %v", c.clientID, protocolErr)
+			c.sendError(protocolErr)
 			continue
 		}
 
-		messageType, ok := data["type"].(string)
-		if !ok {
-			logger.Printf("Unknown message type: %v", data["type"])
-			c.sendMessage(map[string]interface{}{
-				"type":    "error",
-				"message": "Unknown message type",
-			})
-			continue
-		}
-
-		switch messageType {
-		case "task_update":
-			c.handleTaskUpdate(data)
-		case "agent_command":
-			c.handleAgentCommand(data)
-		default:
-			logger.Printf("Unknown message type: %s", messageType)
-			c.sendMessage(map[string]interface{}{
-				"type":    "error",
-				"message": "Unknown message type",
-			})
+		switch m := message.(type) {
+		case *wsproto.Hello:
+			welcome, protocolErr := agentTaskEndpoint.Negotiate(m)
+			if protocolErr != nil {
+				c.sendError(protocolErr)
+				continue
+			}
+			c.sendMessage(welcome)
+		case *wsproto.TaskUpdate:
+			c.handleTaskUpdate(m)
+		case *wsproto.AgentCommand:
+			c.handleAgentCommand(m)
 		}
 	}
 }
 
-func (c *AgentConsumer) handleTaskUpdate(data map[string]interface{}) {
-	taskID, ok := data["task_id"].(string)
-	if !ok {
-		c.sendMessage(map[string]interface{}{
-			"type":    "error",
-			"message": "Missing task_id",
-		})
-		return
-	}
-
-	status, _ := data["status"].(string)
-	message, _ := data["message"].(string)
-
-	core.BroadcastToGroup("task_"+taskID, map[string]interface{}{
+func (c *AgentConsumer) handleTaskUpdate(m *wsproto.TaskUpdate) {
+	core.BroadcastToGroup("task_"+m.TaskID, map[string]interface{}{
 		"type":    "task_update",
-		"task_id": taskID,
-		"status":  status,
-		"message": message,
+		"task_id": m.TaskID,
+		"status":  m.Status,
+		"message": m.Message,
 		"sender":  c.clientID,
 	})
 }
 
-func (c *AgentConsumer) handleAgentCommand(data map[string]interface{}) {
-	command, ok := data["command"].(string)
-	if !ok {
-		c.sendMessage(map[string]interface{}{
-			"type":    "error",
-			"message": "Missing command",
-		})
-		return
-	}
-
-	params, _ := data["params"].(map[string]interface{})
-
-	c.sendMessage(map[string]interface{}{
+func (c *AgentConsumer) handleAgentCommand(m *wsproto.AgentCommand) {
+	c.sendMessage(reply(m.ID, map[string]interface{}{
 		"type":    "command_received",
-		"command": command,
-		"params":  params,
+		"command": m.Command,
+		"params":  m.Params,
 		"message": "Command received",
-	})
+	}))
+}
+
+func (c *AgentConsumer) sendError(err *wsproto.Error) error {
+	return c.sendMessage(err.Frame())
 }
 
-func (c *AgentConsumer) sendMessage(message map[string]interface{}) error {
+func (c *AgentConsumer) sendMessage(message interface{}) error {
 	c.connectedMutex.Lock()
 	defer c.connectedMutex.Unlock()
 
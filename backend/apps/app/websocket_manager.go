@@ -1,12 +1,15 @@
 package app
 
 import (
+	"context"
 	"encoding/json"
 	"log"
 	"os"
 	"sync"
 	"time"
 
+	"github.com/spectrumwebco/agent_runtime/backend/core/fanout"
+	"github.com/spectrumwebco/agent_runtime/backend/core/lifecycle"
 	"github.com/spectrumwebco/agent_runtime/pkg/djangogo/core"
 )
 
@@ -19,6 +22,7 @@ type WebSocketManager struct {
 	eventStreamTask *core.Task
 	mutex           sync.RWMutex
 	initialized     bool
+	closing         bool
 }
 
 var instance *WebSocketManager
@@ -32,6 +36,9 @@ func GetManager() *WebSocketManager {
 			eventHandlers:  make(map[string][]func(map[string]interface{}) error),
 			initialized:    true,
 		}
+		bus := fanout.Default()
+		bus.Handle(fanoutTopicGroup, instance.deliverToGroup)
+		bus.Handle(fanoutTopicBroadcast, instance.deliverBroadcast)
 	})
 	return instance
 }
@@ -40,6 +47,14 @@ func (m *WebSocketManager) RegisterConsumer(consumerID string, consumer core.Web
 	m.mutex.Lock()
 	defer m.mutex.Unlock()
 
+	if m.closing {
+		wsLogger.Printf("Rejecting consumer %s: server is shutting down", consumerID)
+		if closer, ok := consumer.(interface{ Close() }); ok {
+			closer.Close()
+		}
+		return
+	}
+
 	m.consumers[consumerID] = consumer
 
 	if groups != nil {
@@ -102,13 +117,45 @@ func (m *WebSocketManager) SendToConsumer(consumerID string, message map[string]
 	return consumer.Send(string(jsonData))
 }
 
+const (
+	fanoutTopicGroup     = "group"
+	fanoutTopicBroadcast = "broadcast"
+)
+
+// SendToGroup sends message to the consumers of group on every replica. The
+// local consumers receive it even if an error is returned.
 func (m *WebSocketManager) SendToGroup(group string, message map[string]interface{}) error {
+	jsonData, err := json.Marshal(message)
+	if err != nil {
+		return err
+	}
+
+	return fanout.Default().Publish(fanoutTopicGroup, group, jsonData)
+}
+
+// Broadcast sends message to every consumer on every replica.
+func (m *WebSocketManager) Broadcast(message map[string]interface{}) error {
+	jsonData, err := json.Marshal(message)
+	if err != nil {
+		return err
+	}
+
+	return fanout.Default().Publish(fanoutTopicBroadcast, "", jsonData)
+}
+
+func (m *WebSocketManager) deliverToGroup(group string, payload []byte) {
+	var message map[string]interface{}
+	if err := json.Unmarshal(payload, &message); err != nil {
+		wsLogger.Printf("Error decoding message for group %s: %v", group, err)
+		return
+	}
+
 	m.mutex.RLock()
 	consumerIDs, ok := m.consumerGroups[group]
 	m.mutex.RUnlock()
 
 	if !ok {
-		return nil
+		return
 	}
 
 	for consumerID := range consumerIDs {
@@ -116,11 +163,15 @@ func (m *WebSocketManager) SendToGroup(group string, message map[string]interfac
 			wsLogger.Printf("Error sending message to consumer %s: %v", consumerID, err)
 		}
 	}
-
-	return nil
 }
 
-func (m *WebSocketManager) Broadcast(message map[string]interface{}) error {
+func (m *WebSocketManager) deliverBroadcast(_ string, payload []byte) {
+	var message map[string]interface{}
+	if err := json.Unmarshal(payload, &message); err != nil {
+		wsLogger.Printf("Error decoding broadcast message: %v", err)
+		return
+	}
+
 	m.mutex.RLock()
 	consumerIDs := make([]string, 0, len(m.consumers))
 	for consumerID := range m.consumers {
@@ -133,6 +184,36 @@ func (m *WebSocketManager) Broadcast(message map[string]interface{}) error {
 			wsLogger.Printf("Error broadcasting message to consumer %s: %v", consumerID, err)
 		}
 	}
+}
+
+// Shutdown stops accepting new consumers, notifies connected consumers that
+// the server is going away and closes their connections.
+func (m *WebSocketManager) Shutdown(ctx context.Context) error {
+	m.mutex.Lock()
+	m.closing = true
+	m.stopEventStream()
+	consumers := make(map[string]core.WebSocketConsumer, len(m.consumers))
+	for consumerID, consumer := range m.consumers {
+		consumers[consumerID] = consumer
+	}
+	m.mutex.Unlock()
+
+	for consumerID, consumer := range consumers {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		if err := m.SendToConsumer(consumerID, map[string]interface{}{
+			"type":    "server_shutdown",
+			"message": "Server is shutting down",
+		}); err != nil {
+			wsLogger.Printf("Error notifying consumer %s of shutdown: %v", consumerID, err)
+		}
+		if closer, ok := consumer.(interface{ Close() }); ok {
+			closer.Close()
+		}
+		m.UnregisterConsumer(consumerID)
+	}
 
 	return nil
 }
@@ -234,4 +315,5 @@ func (m *WebSocketManager) SendEvent(eventType string, data map[string]interface
 
 func init() {
 	core.RegisterFunction("get_manager", GetManager)
+	lifecycle.Register(lifecycle.PhaseStopAccepting, "websocket-manager", GetManager().Shutdown)
 }
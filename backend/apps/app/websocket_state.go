@@ -8,6 +8,12 @@ import (
 
 	"github.com/google/uuid"
 	"github.com/gorilla/websocket"
+	"github.com/spectrumwebco/agent_runtime/backend/core/fanout"
+	"github.com/spectrumwebco/agent_runtime/backend/core/redact"
+	"github.com/spectrumwebco/agent_runtime/backend/core/slo"
+	"github.com/spectrumwebco/agent_runtime/backend/core/tenancy"
+	"github.com/spectrumwebco/agent_runtime/backend/core/wsproto"
+	"github.com/spectrumwebco/agent_runtime/backend/core/wsqueue"
 	"github.com/spectrumwebco/agent_runtime/pkg/djangogo/core"
 )
 
@@ -26,39 +32,82 @@ type SharedStateConsumer struct {
 	Connection *websocket.Conn
 	StateType StateType
 	StateID string
+	Tenant tenancy.Tenant
 	ConnectionID string
-	Send chan []byte
+	Queue *wsqueue.Queue
 	Closed bool
 	ClosedMutex sync.Mutex
 }
 
+// stateSubscriber is a WebSocket connection or SSE stream receiving the
+// updates of one state.
+type stateSubscriber struct {
+	id    string
+	queue *wsqueue.Queue
+	// close is called when the queue is full under the disconnect policy.
+	close func()
+}
+
 type ConnectionMap struct {
-	Connections map[string][]*SharedStateConsumer
+	Connections map[string][]*stateSubscriber
 	Mutex       sync.RWMutex
 }
 
 var connections = ConnectionMap{
-	Connections: make(map[string][]*SharedStateConsumer),
+	Connections: make(map[string][]*stateSubscriber),
+}
+
+// stateHistory keeps the recent updates of every state, so SSE clients can
+// resume with Last-Event-ID. Every replica receives every update through the
+// fan-out, so a client may resume on any of them.
+var stateHistory = wsqueue.NewHistory(wsqueue.Default().HistorySize, 0)
+
+func stateKey(stateType StateType, tenant tenancy.Tenant, stateID string) string {
+	return string(stateType) + ":" + tenant.ScopedID(stateID)
+}
+
+func subscribeState(key string, subscriber *stateSubscriber) {
+	stateFanout()
+
+	connections.Mutex.Lock()
+	connections.Connections[key] = append(connections.Connections[key], subscriber)
+	connections.Mutex.Unlock()
 }
 
-func NewSharedStateConsumer(conn *websocket.Conn, stateType StateType, stateID string) *SharedStateConsumer {
+func unsubscribeState(key string, id string) {
+	connections.Mutex.Lock()
+	defer connections.Mutex.Unlock()
+
+	subscribers := make([]*stateSubscriber, 0)
+	for _, subscriber := range connections.Connections[key] {
+		if subscriber.id != id {
+			subscribers = append(subscribers, subscriber)
+		}
+	}
+	if len(subscribers) == 0 {
+		delete(connections.Connections, key)
+	} else {
+		connections.Connections[key] = subscribers
+	}
+}
+
+func NewSharedStateConsumer(conn *websocket.Conn, tenant tenancy.Tenant, stateType StateType, stateID string) *SharedStateConsumer {
 	connectionID := uuid.New().String()
 	consumer := &SharedStateConsumer{
 		Connection:   conn,
 		StateType:    stateType,
 		StateID:      stateID,
+		Tenant:       tenant,
 		ConnectionID: connectionID,
-		Send:         make(chan []byte, 256),
+		Queue:        wsqueue.New("shared_state", connectionID, wsqueue.Default()),
 		Closed:       false,
 	}
 
-	key := string(stateType) + ":" + stateID
-	connections.Mutex.Lock()
-	if _, ok := connections.Connections[key]; !ok {
-		connections.Connections[key] = make([]*SharedStateConsumer, 0)
-	}
-	connections.Connections[key] = append(connections.Connections[key], consumer)
-	connections.Mutex.Unlock()
+	subscribeState(stateKey(stateType, tenant, stateID), &stateSubscriber{
+		id:    connectionID,
+		queue: consumer.Queue,
+		close: consumer.Close,
+	})
 
 	go consumer.writePump()
 	go consumer.readPump()
@@ -71,10 +120,7 @@ func NewSharedStateConsumer(conn *websocket.Conn, stateType StateType, stateID s
 			"state_id":   stateID,
 			"data":       initialState,
 		}
-		msgBytes, err := json.Marshal(stateUpdateMsg)
-		if err == nil {
-			consumer.Send <- msgBytes
-		}
+		consumer.send(stateUpdateMsg)
 	}
 
 	wsLogger.Printf("WebSocket connection established for %s state with ID %s", stateType, stateID)
@@ -90,24 +136,9 @@ func (c *SharedStateConsumer) Close() {
 	c.Closed = true
 	c.ClosedMutex.Unlock()
 
-	close(c.Send)
+	c.Queue.Close()
 
-	key := string(c.StateType) + ":" + c.StateID
-	connections.Mutex.Lock()
-	if conns, ok := connections.Connections[key]; ok {
-		newConns := make([]*SharedStateConsumer, 0)
-		for _, conn := range conns {
-			if conn.ConnectionID != c.ConnectionID {
-				newConns = append(newConns, conn)
-			}
-		}
-		if len(newConns) == 0 {
-			delete(connections.Connections, key)
-		} else {
-			connections.Connections[key] = newConns
-		}
-	}
-	connections.Mutex.Unlock()
+	unsubscribeState(stateKey(c.StateType, c.Tenant, c.StateID), c.ConnectionID)
 
 	wsLogger.Printf("WebSocket connection closed for %s state with ID %s", c.StateType, c.StateID)
 }
@@ -146,28 +177,31 @@ func (c *SharedStateConsumer) writePump() {
 
 	for {
 		select {
-		case message, ok := <-c.Send:
-			c.Connection.SetWriteDeadline(time.Now().Add(10 * time.Second))
-			if !ok {
-				c.Connection.WriteMessage(websocket.CloseMessage, []byte{})
-				return
+		case <-c.Queue.Ready():
+			messages := c.Queue.Drain()
+			if len(messages) == 0 {
+				continue
 			}
 
+			c.Connection.SetWriteDeadline(time.Now().Add(10 * time.Second))
 			w, err := c.Connection.NextWriter(websocket.TextMessage)
 			if err != nil {
 				return
 			}
-			w.Write(message)
-
-			n := len(c.Send)
-			for i := 0; i < n; i++ {
-				w.Write([]byte{'\n'})
-				w.Write(<-c.Send)
+			for i, message := range messages {
+				if i > 0 {
+					w.Write([]byte{'\n'})
+				}
+				w.Write(message)
 			}
 
 			if err := w.Close(); err != nil {
 				return
 			}
+		case <-c.Queue.Done():
+			c.Connection.SetWriteDeadline(time.Now().Add(10 * time.Second))
+			c.Connection.WriteMessage(websocket.CloseMessage, []byte{})
+			return
 		case <-ticker.C:
 			c.Connection.SetWriteDeadline(time.Now().Add(10 * time.Second))
 			if err := c.Connection.WriteMessage(websocket.PingMessage, nil); err != nil {
@@ -177,51 +211,72 @@ func (c *SharedStateConsumer) writePump() {
 	}
 }
 
-func (c *SharedStateConsumer) handleMessage(message []byte) {
-	var data map[string]interface{}
-	if err := json.Unmarshal(message, &data); err != nil {
-		wsLogger.Printf("Failed to decode JSON message: %v", err)
-		return
-	}
+var sharedStateEndpoint = wsproto.NewEndpoint(wsproto.FeaturePing, wsproto.FeatureSharedState)
 
-	messageType, ok := data["type"].(string)
-	if !ok {
-		wsLogger.Printf("Message missing 'type' field")
+func (c *SharedStateConsumer) handleMessage(frame []byte) {
+	message, protocolErr := sharedStateEndpoint.Decode(frame)
+	if protocolErr != nil {
+		wsLogger.Printf("Rejected frame on %s state %s: %v", c.StateType, c.StateID, protocolErr)
+		c.send(protocolErr.Frame())
 		return
 	}
 
-	switch messageType {
-	case "update_state":
-		stateData, ok := data["data"].(map[string]interface{})
-		if !ok {
-			wsLogger.Printf("Update state message missing 'data' field")
+	switch m := message.(type) {
+	case *wsproto.Hello:
+		welcome, protocolErr := sharedStateEndpoint.Negotiate(m)
+		if protocolErr != nil {
+			c.send(protocolErr.Frame())
 			return
 		}
+		c.send(welcome)
+
+	case *wsproto.Ping:
+		c.send(reply(m.ID, map[string]interface{}{
+			"type":      "pong",
+			"timestamp": m.Timestamp,
+		}))
 
-		success := c.UpdateState(stateData)
-		if success {
-			c.BroadcastStateUpdate(stateData)
+	case *wsproto.UpdateState:
+		if !c.UpdateState(m.Data) {
+			c.send((&wsproto.Error{Code: wsproto.CodeInternal, Message: "Failed to update state", ID: m.ID}).Frame())
+			return
 		}
+		c.BroadcastStateUpdate(m.Data)
 
-	case "get_state":
-		state := c.GetInitialState()
-		stateUpdateMsg := map[string]interface{}{
+	case *wsproto.GetState:
+		c.send(reply(m.ID, map[string]interface{}{
 			"type":       "state_update",
 			"state_type": c.StateType,
 			"state_id":   c.StateID,
-			"data":       state,
-		}
-		msgBytes, err := json.Marshal(stateUpdateMsg)
-		if err == nil {
-			c.Send <- msgBytes
-		}
+			"data":       c.GetInitialState(),
+		}))
+	}
+}
+
+func (c *SharedStateConsumer) send(message interface{}) {
+	msgBytes, err := json.Marshal(message)
+	if err != nil {
+		wsLogger.Printf("Error marshaling message: %v", err)
+		return
+	}
+	c.pushed(c.Queue.Push(msgBytes))
+}
 
-	default:
-		wsLogger.Printf("Unknown message type: %s", messageType)
+// pushed closes the consumer if a push found its queue full under the
+// disconnect policy.
+func (c *SharedStateConsumer) pushed(err error) {
+	if err == wsqueue.ErrFull {
+		stats := c.Queue.Stats()
+		wsLogger.Printf("Closing slow consumer %s on %s state %s: %d messages pending for %s", c.ConnectionID, c.StateType, c.StateID, stats.Depth, stats.Lag)
+		c.Close()
 	}
 }
 
 func (c *SharedStateConsumer) GetInitialState() map[string]interface{} {
+	return loadState(c.StateType, c.Tenant, c.StateID)
+}
+
+func loadState(stateType StateType, tenant tenancy.Tenant, stateID string) map[string]interface{} {
 	try := func() (map[string]interface{}, error) {
 		grpcBridgeModule, err := core.ImportPythonModule("apps.app.grpc_bridge")
 		if err != nil {
@@ -238,7 +293,7 @@ func (c *SharedStateConsumer) GetInitialState() map[string]interface{} {
 			return nil, err
 		}
 
-		response, err := getState.Call(string(c.StateType), c.StateID)
+		response, err := getState.Call(string(stateType), tenant.ScopedID(stateID))
 		if err != nil {
 			return nil, err
 		}
@@ -281,12 +336,12 @@ func (c *SharedStateConsumer) UpdateState(data map[string]interface{}) bool {
 			return false, err
 		}
 
-		pyData, err := core.MapToPyObject(data)
+		pyData, err := core.MapToPyObject(redact.Default().RedactMap(redact.SourceStateHistory, data))
 		if err != nil {
 			return false, err
 		}
 
-		response, err := updateState.Call(string(c.StateType), c.StateID, pyData)
+		response, err := updateState.Call(string(c.StateType), c.Tenant.ScopedID(c.StateID), pyData)
 		if err != nil {
 			return false, err
 		}
@@ -313,11 +368,33 @@ func (c *SharedStateConsumer) UpdateState(data map[string]interface{}) bool {
 }
 
 func (c *SharedStateConsumer) BroadcastStateUpdate(data map[string]interface{}) {
-	key := string(c.StateType) + ":" + c.StateID
+	broadcastStateUpdate(c.StateType, c.Tenant, c.StateID, data)
+}
+
+const fanoutTopicState = "state_update"
+
+var stateFanoutOnce sync.Once
+
+// stateFanout returns the bus relaying state updates between replicas, and
+// registers the local delivery of updates from other replicas on first use.
+func stateFanout() *fanout.Bus {
+	bus := fanout.Default()
+	stateFanoutOnce.Do(func() {
+		bus.Handle(fanoutTopicState, deliverStateUpdate)
+	})
+	return bus
+}
+
+// broadcastStateUpdate sends a state update to every consumer of a state, on
+// every replica. The event ID lets SSE clients resume after it.
+func broadcastStateUpdate(stateType StateType, tenant tenancy.Tenant, stateID string, data map[string]interface{}) {
+	key := stateKey(stateType, tenant, stateID)
 	stateUpdateMsg := map[string]interface{}{
 		"type":       "state_update",
-		"state_type": c.StateType,
-		"state_id":   c.StateID,
+		"state_type": stateType,
+		"state_id":   stateID,
+		"event_id":   uuid.New().String(),
+		"sent_at":    time.Now().UTC(),
 		"data":       data,
 	}
 	msgBytes, err := json.Marshal(stateUpdateMsg)
@@ -326,20 +403,84 @@ func (c *SharedStateConsumer) BroadcastStateUpdate(data map[string]interface{})
 		return
 	}
 
+	if err := stateFanout().Publish(fanoutTopicState, key, msgBytes); err != nil {
+		wsLogger.Printf("Error relaying state update for %s to other replicas: %v", key, err)
+	}
+}
+
+// deliverStateUpdate sends a state update to the local consumers of the
+// state with key. Updates still pending for a slow consumer are merged, so
+// it receives the combined change instead of every intermediate one.
+func deliverStateUpdate(key string, msgBytes []byte) {
+	if eventID := stateEventID(msgBytes); eventID != "" {
+		stateHistory.Append(key, eventID, msgBytes)
+	}
+	if sentAt := stateSentAt(msgBytes); !sentAt.IsZero() {
+		slo.DefaultTracker().ObserveLatency(slo.StateUpdateLatency, time.Since(sentAt))
+	}
+
+	// Subscribers are closed outside the lock, since closing takes it to
+	// unregister them.
 	connections.Mutex.RLock()
-	if conns, ok := connections.Connections[key]; ok {
-		for _, conn := range conns {
-			select {
-			case conn.Send <- msgBytes:
-			default:
-				conn.Close()
-			}
+	subscribers := append([]*stateSubscriber(nil), connections.Connections[key]...)
+	connections.Mutex.RUnlock()
+
+	for _, subscriber := range subscribers {
+		if err := subscriber.queue.PushCoalesced(key, msgBytes, mergeStateUpdates); err == wsqueue.ErrFull {
+			stats := subscriber.queue.Stats()
+			wsLogger.Printf("Closing slow consumer %s of %s: %d messages pending for %s", subscriber.id, key, stats.Depth, stats.Lag)
+			subscriber.close()
 		}
 	}
-	connections.Mutex.RUnlock()
 }
 
-func GetSharedState(stateID string) map[string]interface{} {
+// stateEventID returns the event ID of a state_update frame, if it has one.
+func stateEventID(msgBytes []byte) string {
+	var msg struct {
+		EventID string `json:"event_id"`
+	}
+	if json.Unmarshal(msgBytes, &msg) != nil {
+		return ""
+	}
+	return msg.EventID
+}
+
+// stateSentAt returns when a state_update frame was broadcast, if it says.
+func stateSentAt(msgBytes []byte) time.Time {
+	var msg struct {
+		SentAt time.Time `json:"sent_at"`
+	}
+	if json.Unmarshal(msgBytes, &msg) != nil {
+		return time.Time{}
+	}
+	return msg.SentAt
+}
+
+// mergeStateUpdates combines two pending state_update frames. Updates carry
+// the changed top-level keys, so the newer values win key by key.
+func mergeStateUpdates(pending, next []byte) []byte {
+	var pendingMsg, nextMsg map[string]interface{}
+	if json.Unmarshal(pending, &pendingMsg) != nil || json.Unmarshal(next, &nextMsg) != nil {
+		return next
+	}
+	pendingData, _ := pendingMsg["data"].(map[string]interface{})
+	nextData, _ := nextMsg["data"].(map[string]interface{})
+	if pendingData == nil || nextData == nil {
+		return next
+	}
+
+	for k, v := range nextData {
+		pendingData[k] = v
+	}
+	nextMsg["data"] = pendingData
+	merged, err := json.Marshal(nextMsg)
+	if err != nil {
+		return next
+	}
+	return merged
+}
+
+func GetSharedState(tenant tenancy.Tenant, stateID string) map[string]interface{} {
 	if stateID == "" {
 		stateID = "default"
 	}
@@ -360,7 +501,7 @@ func GetSharedState(stateID string) map[string]interface{} {
 			return nil, err
 		}
 
-		response, err := getState.Call(string(StateTypeShared), stateID)
+		response, err := getState.Call(string(StateTypeShared), tenant.ScopedID(stateID))
 		if err != nil {
 			return nil, err
 		}
@@ -386,7 +527,7 @@ func GetSharedState(stateID string) map[string]interface{} {
 	return result
 }
 
-func UpdateSharedState(stateID string, data map[string]interface{}) bool {
+func UpdateSharedState(tenant tenancy.Tenant, stateID string, data map[string]interface{}) bool {
 	if stateID == "" {
 		stateID = "default"
 	}
@@ -407,12 +548,12 @@ func UpdateSharedState(stateID string, data map[string]interface{}) bool {
 			return false, err
 		}
 
-		pyData, err := core.MapToPyObject(data)
+		pyData, err := core.MapToPyObject(redact.Default().RedactMap(redact.SourceStateHistory, data))
 		if err != nil {
 			return false, err
 		}
 
-		response, err := updateState.Call(string(StateTypeShared), stateID, pyData)
+		response, err := updateState.Call(string(StateTypeShared), tenant.ScopedID(stateID), pyData)
 		if err != nil {
 			return false, err
 		}
@@ -423,31 +564,7 @@ func UpdateSharedState(stateID string, data map[string]interface{}) bool {
 		}
 
 		if status, ok := responseMap["status"].(string); ok && status == "success" {
-			key := string(StateTypeShared) + ":" + stateID
-			stateUpdateMsg := map[string]interface{}{
-				"type":       "state_update",
-				"state_type": StateTypeShared,
-				"state_id":   stateID,
-				"data":       data,
-			}
-			msgBytes, err := json.Marshal(stateUpdateMsg)
-			if err != nil {
-				wsLogger.Printf("Error marshaling state update: %v", err)
-				return true, nil
-			}
-
-			connections.Mutex.RLock()
-			if conns, ok := connections.Connections[key]; ok {
-				for _, conn := range conns {
-					select {
-					case conn.Send <- msgBytes:
-					default:
-						conn.Close()
-					}
-				}
-			}
-			connections.Mutex.RUnlock()
-
+			broadcastStateUpdate(StateTypeShared, tenant, stateID, data)
 			return true, nil
 		}
 
@@ -0,0 +1,151 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/spectrumwebco/agent_runtime/backend/apps/app/middleware"
+	"github.com/spectrumwebco/agent_runtime/backend/core/audit"
+	"github.com/spectrumwebco/agent_runtime/backend/core/quota"
+	"github.com/spectrumwebco/agent_runtime/backend/core/rbac"
+	"github.com/spectrumwebco/agent_runtime/backend/core/tenancy"
+	"github.com/spectrumwebco/agent_runtime/backend/core/workspace"
+	"github.com/spectrumwebco/agent_runtime/pkg/djangogo/core"
+)
+
+var (
+	workspaceController     *workspace.Controller
+	workspaceControllerErr  error
+	workspaceControllerOnce sync.Once
+)
+
+// getWorkspaceController returns the controller every lifecycle change of a
+// workspace goes through.
+func getWorkspaceController() (*workspace.Controller, error) {
+	workspaceControllerOnce.Do(func() {
+		workspaceController, workspaceControllerErr = workspace.NewDefaultController(workspaceSettings())
+	})
+	return workspaceController, workspaceControllerErr
+}
+
+// workspaceSettings returns the namespace of the Workspace resources, how
+// long to wait for them to start or stop, and the accrued resources a
+// running workspace uses per hour, which must not be exhausted for it to
+// start.
+func workspaceSettings() (string, time.Duration, quota.Rates) {
+	namespace, _ := core.GetSetting("WORKSPACE_NAMESPACE", "")
+	readyTimeout, _ := core.GetSetting("WORKSPACE_READY_TIMEOUT_SECONDS", int(workspace.DefaultReadyTimeout/time.Second))
+	rates, _ := core.GetSetting("QUOTA_WORKSPACE_RATES", map[string]interface{}{"cpu_hours": 1.0})
+	return namespace.(string), time.Duration(readyTimeout.(int)) * time.Second, quota.ParseRates(rates)
+}
+
+type createWorkspaceRequest struct {
+	Name string         `json:"name"`
+	Spec workspace.Spec `json:"spec"`
+}
+
+// CreateWorkspace creates a stopped workspace in the caller's organization
+// and project, owned by the caller.
+func CreateWorkspace(w http.ResponseWriter, r *http.Request) {
+	subject, ok := rbac.SubjectFromContext(r.Context())
+	if !ok {
+		core.JSONResponse(w, map[string]interface{}{"status": "error", "message": "creating a workspace was not authorized"}, http.StatusForbidden)
+		return
+	}
+	tenant, ok := tenancy.FromContext(r.Context())
+	if !ok {
+		core.JSONResponse(w, map[string]interface{}{"status": "error", "message": "organization is required"}, http.StatusBadRequest)
+		return
+	}
+
+	var request createWorkspaceRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		core.JSONResponse(w, map[string]interface{}{"status": "error", "message": "Invalid request body"}, http.StatusBadRequest)
+		return
+	}
+	if request.Name == "" {
+		core.JSONResponse(w, map[string]interface{}{"status": "error", "message": "name is required"}, http.StatusBadRequest)
+		return
+	}
+	if err := request.Spec.Validate(); err != nil {
+		core.JSONResponse(w, map[string]interface{}{"status": "error", "message": err.Error()}, http.StatusBadRequest)
+		return
+	}
+
+	controller, err := getWorkspaceController()
+	if err != nil {
+		workspaceError(w, err)
+		return
+	}
+	created, err := controller.Create(r.Context(), workspace.Workspace{
+		Name:           request.Name,
+		OrganizationID: tenant.OrganizationID,
+		ProjectID:      tenant.ProjectID,
+		OwnerID:        subject.ID,
+	}, request.Spec)
+	if err != nil {
+		workspaceError(w, err)
+		return
+	}
+	audit.FromContext(r.Context()).SetResource("workspace", created.ID)
+	core.JSONResponse(w, map[string]interface{}{"status": "success", "workspace": created}, http.StatusCreated)
+}
+
+// StartWorkspace starts a workspace and responds once it runs.
+func StartWorkspace(w http.ResponseWriter, r *http.Request) {
+	workspaceLifecycle(w, r, (*workspace.Controller).Start)
+}
+
+// StopWorkspace stops a workspace and responds once it stopped.
+func StopWorkspace(w http.ResponseWriter, r *http.Request) {
+	workspaceLifecycle(w, r, (*workspace.Controller).Stop)
+}
+
+// DeleteWorkspace deletes a workspace with its volume.
+func DeleteWorkspace(w http.ResponseWriter, r *http.Request) {
+	workspaceLifecycle(w, r, (*workspace.Controller).Delete)
+}
+
+func workspaceLifecycle(w http.ResponseWriter, r *http.Request, change func(*workspace.Controller, context.Context, string) error) {
+	workspaceID := mux.Vars(r)["workspace_id"]
+	if err := checkWorkspace(r.Context(), workspaceID); err != nil {
+		core.JSONResponse(w, map[string]interface{}{"status": "error", "message": err.Error()}, http.StatusNotFound)
+		return
+	}
+
+	controller, err := getWorkspaceController()
+	if err != nil {
+		workspaceError(w, err)
+		return
+	}
+	if err := change(controller, r.Context(), workspaceID); err != nil {
+		workspaceError(w, err)
+		return
+	}
+	core.JSONResponse(w, map[string]interface{}{"status": "success"}, http.StatusOK)
+}
+
+func workspaceError(w http.ResponseWriter, err error) {
+	if errors.Is(err, quota.ErrExceeded) {
+		middleware.WriteQuotaError(w, err)
+		return
+	}
+
+	status := http.StatusInternalServerError
+	if errors.Is(err, workspace.ErrNotFound) {
+		status = http.StatusNotFound
+	}
+	core.JSONResponse(w, map[string]interface{}{"status": "error", "message": err.Error()}, status)
+}
+
+func init() {
+	registerAPIView("workspace_create", CreateWorkspace, []string{"POST"}, []string{"IsAuthenticated"})
+	registerAPIView("workspace_start", StartWorkspace, []string{"POST"}, []string{"IsAuthenticated"})
+	registerAPIView("workspace_stop", StopWorkspace, []string{"POST"}, []string{"IsAuthenticated"})
+	registerAPIView("workspace_delete", DeleteWorkspace, []string{"DELETE"}, []string{"IsAuthenticated"})
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/spectrumwebco/agent_runtime/backend/core/backup"
+	"github.com/spectrumwebco/agent_runtime/backend/db/integrations"
+	"github.com/spf13/cobra"
+)
+
+func newBackupCmd() *cobra.Command {
+	var (
+		bucket      string
+		databases   []string
+		statePrefix string
+	)
+
+	backupCmd := &cobra.Command{
+		Use:   "backup",
+		Short: "Backs up and restores backend data",
+		Long:  `Backs up the Postgres databases, the Dragonfly shared state and the RAGflow index list to Supabase storage, and restores them.`,
+	}
+	backupCmd.PersistentFlags().StringVar(&bucket, "bucket", "backups", "Supabase storage bucket holding the backups")
+	backupCmd.PersistentFlags().StringSliceVar(&databases, "database", []string{"default"}, "Postgres connections to back up or restore")
+	backupCmd.PersistentFlags().StringVar(&statePrefix, "state-prefix", "shared_state:", "Prefix of the Dragonfly keys to back up or restore")
+
+	newManager := func() *backup.Manager {
+		var sources []backup.Source
+		for _, database := range databases {
+			sources = append(sources, backup.NewPostgresSource(database))
+		}
+		state := backup.NewSharedStateSource(integrations.GetDragonflyManager().Client())
+		state.Prefix = statePrefix
+		sources = append(sources, state, &backup.VectorIndexSource{Store: integrations.GetVectorStore()})
+
+		return backup.NewManager(backup.NewSupabaseStorage(bucket), sources...)
+	}
+
+	createCmd := &cobra.Command{
+		Use:   "create",
+		Short: "Creates a backup",
+		Long:  `Exports every data source, uploads it together with a manifest of checksums and prints the backup id.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			manifest, err := newManager().Create(context.Background())
+			if err != nil {
+				return fmt.Errorf("backup failed: %v", err)
+			}
+			fmt.Printf("Created backup %s with %d artifacts\n", manifest.ID, len(manifest.Artifacts))
+			return nil
+		},
+	}
+
+	var verifyOnly bool
+	restoreCmd := &cobra.Command{
+		Use:   "restore [id]",
+		Short: "Restores a backup",
+		Long:  `Downloads a backup, verifies every artifact against its manifest and only then restores it. Existing data of the restored sources is replaced.`,
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			manager := newManager()
+			if verifyOnly {
+				manifest, _, err := manager.Verify(context.Background(), args[0])
+				if err != nil {
+					return fmt.Errorf("verification failed: %v", err)
+				}
+				fmt.Printf("Backup %s is intact (%d artifacts)\n", manifest.ID, len(manifest.Artifacts))
+				return nil
+			}
+
+			manifest, err := manager.Restore(context.Background(), args[0])
+			if err != nil {
+				return fmt.Errorf("restore failed: %v", err)
+			}
+			fmt.Printf("Restored backup %s created at %s\n", manifest.ID, manifest.CreatedAt.Format("2006-01-02 15:04:05 MST"))
+			return nil
+		},
+	}
+	restoreCmd.Flags().BoolVar(&verifyOnly, "verify-only", false, "Only verify the backup's integrity")
+
+	backupCmd.AddCommand(createCmd)
+	backupCmd.AddCommand(restoreCmd)
+	return backupCmd
+}
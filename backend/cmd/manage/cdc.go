@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/spectrumwebco/agent_runtime/backend/core/cdc"
+	"github.com/spectrumwebco/agent_runtime/backend/core/lifecycle"
+	"github.com/spectrumwebco/agent_runtime/backend/db/integrations"
+	"github.com/spf13/cobra"
+)
+
+func newCDCCmd() *cobra.Command {
+	cdcCmd := &cobra.Command{
+		Use:   "cdc",
+		Short: "Streams Postgres changes to Kafka",
+		Long:  `Publishes the row changes of the tables in AGENT_CDC_TABLES to Kafka, read from a logical replication slot using wal2json.`,
+	}
+
+	runCmd := &cobra.Command{
+		Use:   "run",
+		Short: "Publishes changes until stopped",
+		Long:  `Creates the replication slot if needed and publishes the changes until the process receives SIGTERM or SIGINT. Only one process can read a slot at a time.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			config := cdc.Default()
+			if err := config.Validate(); err != nil {
+				return err
+			}
+			kafka := integrations.GetKafkaClient("", "kled-cdc", "")
+			slot := cdc.NewSlot(integrations.GetPostgresStore("default"), config.Slot, config.Tables)
+			if err := slot.Ensure(context.Background()); err != nil {
+				return err
+			}
+			streamer := cdc.NewStreamer(slot, kafka, config)
+
+			ctx, cancel := context.WithCancel(context.Background())
+			stopped := make(chan struct{})
+			shutdown := lifecycle.DefaultManager()
+			shutdown.Register(lifecycle.PhaseDrainConsumers, "cdc-streamer", func(ctx context.Context) error {
+				cancel()
+				select {
+				case <-stopped:
+					return nil
+				case <-ctx.Done():
+					return ctx.Err()
+				}
+			})
+			integrations.RegisterShutdownClosers(shutdown)
+
+			go func() {
+				defer close(stopped)
+				if err := streamer.Run(ctx); err != nil {
+					fmt.Printf("Error streaming changes: %v\n", err)
+				}
+			}()
+
+			fmt.Printf("Publishing changes of %s from slot %s\n", strings.Join(config.Tables, ", "), config.Slot)
+			return shutdown.WaitForSignal()
+		},
+	}
+
+	statusCmd := &cobra.Command{
+		Use:   "status",
+		Short: "Shows the lag of the replication slot",
+		Long:  `Shows how much WAL the replication slot retains for changes that weren't published yet.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			config := cdc.Default()
+			slot := cdc.NewSlot(integrations.GetPostgresStore("default"), config.Slot, config.Tables)
+			lag, err := slot.Lag(context.Background())
+			if err != nil {
+				return err
+			}
+			fmt.Printf("Slot %s is %d bytes behind\n", config.Slot, lag)
+			return nil
+		},
+	}
+
+	dropCmd := &cobra.Command{
+		Use:   "drop",
+		Short: "Drops the replication slot",
+		Long:  `Drops the replication slot, so Postgres stops retaining WAL for it. Changes made until the next run are not published.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			config := cdc.Default()
+			slot := cdc.NewSlot(integrations.GetPostgresStore("default"), config.Slot, config.Tables)
+			if err := slot.Drop(context.Background()); err != nil {
+				return err
+			}
+			fmt.Printf("Dropped slot %s\n", config.Slot)
+			return nil
+		},
+	}
+
+	cdcCmd.AddCommand(runCmd)
+	cdcCmd.AddCommand(statusCmd)
+	cdcCmd.AddCommand(dropCmd)
+	return cdcCmd
+}
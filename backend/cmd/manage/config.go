@@ -0,0 +1,56 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/spectrumwebco/agent_runtime/backend/core/config"
+	"github.com/spf13/cobra"
+)
+
+func newConfigCmd() *cobra.Command {
+	configCmd := &cobra.Command{
+		Use:   "config",
+		Short: "Works with the settings of the backend",
+		Long:  `Works with the typed settings the backend reads from AGENT_ environment variables.`,
+	}
+
+	var format, output string
+	var options config.RenderOptions
+	renderCmd := &cobra.Command{
+		Use:   "render",
+		Short: "Renders the settings for a deployment",
+		Long: `Renders the settings read from the current environment as a .env file, as Helm values or as ConfigMap and Secret manifests.
+Every setting is rendered, including defaults, so a deployment configured with the output reads exactly these settings. Passwords, keys and tokens go to secretEnv or the Secret.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			out, err := config.Render(config.NewApiSettings(), format, options)
+			if err != nil {
+				return err
+			}
+
+			var w io.Writer = os.Stdout
+			if output != "" && output != "-" {
+				f, err := os.OpenFile(output, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0o600)
+				if err != nil {
+					return err
+				}
+				defer f.Close()
+				w = f
+			}
+			if _, err := w.Write(out); err != nil {
+				return fmt.Errorf("error writing the settings: %v", err)
+			}
+			return nil
+		},
+	}
+	renderCmd.Flags().StringVar(&format, "format", config.FormatEnv, "Format to render, one of "+strings.Join(config.Formats, ", "))
+	renderCmd.Flags().StringVarP(&output, "output", "o", "", "File to write the settings to, stdout if empty")
+	renderCmd.Flags().StringVar(&options.Name, "name", "kled-backend", "Name of the ConfigMap, the Secret is named <name>-secrets")
+	renderCmd.Flags().StringVar(&options.Namespace, "namespace", "", "Namespace of the ConfigMap and the Secret")
+
+	configCmd.AddCommand(renderCmd)
+	return configCmd
+}
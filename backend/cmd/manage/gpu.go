@@ -0,0 +1,66 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/spectrumwebco/agent_runtime/backend/core/gpu"
+	"github.com/spectrumwebco/agent_runtime/backend/core/lifecycle"
+	"github.com/spf13/cobra"
+)
+
+func newGPUSamplerCmd() *cobra.Command {
+	var (
+		server      string
+		workspaceID string
+		interval    time.Duration
+	)
+
+	cmd := &cobra.Command{
+		Use:   "gpu-sampler",
+		Short: "Reports GPU utilization to the server",
+		Long:  `Samples GPU utilization through NVML and reports it to the server, which stops or downgrades idle GPU workspaces according to the project's policy.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if server == "" || workspaceID == "" {
+				return fmt.Errorf("--server and --workspace-id are required")
+			}
+
+			reporter := &gpu.Reporter{
+				Sampler:     &gpu.NVMLSampler{},
+				Endpoint:    strings.TrimSuffix(server, "/") + "/api/gpu/samples/",
+				APIKey:      os.Getenv("KLED_API_KEY"),
+				WorkspaceID: workspaceID,
+				Interval:    interval,
+			}
+
+			ctx, cancel := context.WithCancel(context.Background())
+			stopped := make(chan struct{})
+			shutdown := lifecycle.DefaultManager()
+			shutdown.Register(lifecycle.PhaseStopAccepting, "gpu-sampler", func(ctx context.Context) error {
+				cancel()
+				select {
+				case <-stopped:
+					return nil
+				case <-ctx.Done():
+					return ctx.Err()
+				}
+			})
+
+			go func() {
+				defer close(stopped)
+				reporter.Run(ctx)
+			}()
+
+			fmt.Printf("Reporting GPU utilization of workspace %s every %s\n", workspaceID, interval)
+			return shutdown.WaitForSignal()
+		},
+	}
+
+	cmd.Flags().StringVar(&server, "server", os.Getenv("KLED_SERVER_URL"), "Server URL, defaults to KLED_SERVER_URL")
+	cmd.Flags().StringVar(&workspaceID, "workspace-id", os.Getenv("KLED_WORKSPACE_ID"), "Workspace to report for, defaults to KLED_WORKSPACE_ID")
+	cmd.Flags().DurationVar(&interval, "interval", time.Minute, "Sampling interval")
+	return cmd
+}
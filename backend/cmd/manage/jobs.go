@@ -0,0 +1,210 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spectrumwebco/agent_runtime/backend/core/email"
+	"github.com/spectrumwebco/agent_runtime/backend/core/idempotency"
+	"github.com/spectrumwebco/agent_runtime/backend/core/jobs"
+	"github.com/spectrumwebco/agent_runtime/backend/core/leader"
+	"github.com/spectrumwebco/agent_runtime/backend/core/lifecycle"
+	"github.com/spectrumwebco/agent_runtime/backend/core/metering"
+	"github.com/spectrumwebco/agent_runtime/backend/core/schedule"
+	"github.com/spectrumwebco/agent_runtime/backend/core/slo"
+	"github.com/spectrumwebco/agent_runtime/backend/db/integrations"
+	"github.com/spf13/cobra"
+)
+
+func newJobsCmd() *cobra.Command {
+	jobsCmd := &cobra.Command{
+		Use:   "jobs",
+		Short: "Manages background jobs",
+		Long:  `Lists, runs and schedules the background maintenance jobs.`,
+	}
+
+	listCmd := &cobra.Command{
+		Use:   "list",
+		Short: "Lists registered jobs",
+		Long:  `Lists every registered job with its schedule, next run and last result.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			scheduler, err := newJobScheduler()
+			if err != nil {
+				return err
+			}
+
+			w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+			fmt.Fprintln(w, "NAME\tSCHEDULE\tNEXT RUN\tLAST STATUS\tLAST RUN")
+			now := time.Now()
+			for _, job := range scheduler.Jobs() {
+				next, _ := scheduler.NextRun(job.Name, now)
+				lastStatus, lastRun := "-", "-"
+				if runs, err := scheduler.History().Recent(job.Name, 1); err == nil && len(runs) > 0 {
+					lastStatus = string(runs[0].Status)
+					lastRun = runs[0].StartedAt.Format(time.RFC3339)
+				}
+				fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", job.Name, job.Schedule, next.Format(time.RFC3339), lastStatus, lastRun)
+			}
+			return w.Flush()
+		},
+	}
+
+	runCmd := &cobra.Command{
+		Use:   "run [job]",
+		Short: "Runs a job immediately",
+		Long:  `Runs the named job once, unless another replica currently holds its lock.`,
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			scheduler, err := newJobScheduler()
+			if err != nil {
+				return err
+			}
+
+			fmt.Printf("Running job %s...\n", args[0])
+			if err := scheduler.RunNow(context.Background(), args[0]); err != nil {
+				return fmt.Errorf("job %s failed: %v", args[0], err)
+			}
+			fmt.Printf("Job %s completed successfully\n", args[0])
+			return nil
+		},
+	}
+
+	workerCmd := &cobra.Command{
+		Use:   "worker",
+		Short: "Runs jobs on their schedules",
+		Long:  `Runs the job scheduler until the process receives SIGTERM or SIGINT. Several replicas may run; only the elected leader schedules jobs.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			scheduler, err := newJobScheduler()
+			if err != nil {
+				return err
+			}
+			elector, err := leader.NewElectorFromConfig(jobs.ElectionName, leader.FromEnv())
+			if err != nil {
+				return err
+			}
+
+			ctx, cancel := context.WithCancel(context.Background())
+			stopped := make(chan struct{})
+			shutdown := lifecycle.DefaultManager()
+			shutdown.Register(lifecycle.PhaseDrainConsumers, "job-scheduler", func(ctx context.Context) error {
+				cancel()
+				select {
+				case <-stopped:
+					return nil
+				case <-ctx.Done():
+					return ctx.Err()
+				}
+			})
+			integrations.RegisterShutdownClosers(shutdown)
+
+			go func() {
+				defer close(stopped)
+				elector.Run(ctx, scheduler.Start)
+			}()
+
+			fmt.Printf("Job scheduler started with %d jobs\n", len(scheduler.Jobs()))
+			return shutdown.WaitForSignal()
+		},
+	}
+
+	jobsCmd.AddCommand(listCmd)
+	jobsCmd.AddCommand(runCmd)
+	jobsCmd.AddCommand(workerCmd)
+	return jobsCmd
+}
+
+func newJobScheduler() (*jobs.Scheduler, error) {
+	history := jobs.NewPostgresHistory(integrations.GetPostgresStore("default"))
+	if err := history.EnsureSchema(); err != nil {
+		return nil, err
+	}
+
+	scheduler := jobs.NewScheduler(integrations.GetLocker(), history)
+
+	var rollups []string
+	for _, view := range strings.Split(os.Getenv("KLED_DORIS_ROLLUPS"), ",") {
+		if view = strings.TrimSpace(view); view != "" {
+			rollups = append(rollups, view)
+		}
+	}
+
+	enforcer, err := newRetentionEnforcer()
+	if err != nil {
+		return nil, err
+	}
+
+	digester, err := newEmailDigester()
+	if err != nil {
+		return nil, err
+	}
+
+	calls := metering.NewPostgresStore(integrations.GetPostgresStore("default"))
+	if err := calls.EnsureSchema(); err != nil {
+		return nil, err
+	}
+
+	schedules := schedule.NewPostgresStore(integrations.GetPostgresStore("default"))
+	if err := schedules.EnsureSchema(); err != nil {
+		return nil, err
+	}
+	workspaces, err := newWorkspaceController()
+	if err != nil {
+		return nil, err
+	}
+
+	buckets := slo.NewPostgresStore(integrations.GetPostgresStore("default"))
+	if err := buckets.EnsureSchema(); err != nil {
+		return nil, err
+	}
+	checker := slo.NewChecker(buckets, slo.Objectives(), slo.NewKafkaNotifier(integrations.GetEventProducer("kled-slo")))
+
+	config := jobs.MaintenanceConfig{
+		Postgres:        integrations.GetPostgresStore("default"),
+		Doris:           integrations.GetDorisStore(""),
+		Queue:           integrations.GetMessageQueue(),
+		DorisRollups:    rollups,
+		Retention:       enforcer,
+		RetentionDryRun: os.Getenv("KLED_RETENTION_DRY_RUN") == "true",
+		DigestSchedule:  email.Default().DigestSchedule,
+		RollupLLMUsage:  metering.NewRollup(calls, integrations.GetDorisStore("")).Run,
+
+		RotationRequests:      idempotency.NewStore(integrations.GetKVStore(), integrations.GetLocker(), idempotency.Default()),
+		RunWorkspaceSchedules: schedule.NewRunner(schedules, scheduledWorkspaces{workspaces}).Run,
+		CheckSLOs: func(ctx context.Context) (int, error) {
+			_, alerts, err := checker.Check(ctx)
+			return len(alerts), err
+		},
+	}
+	if digester != nil {
+		config.SendDigests = digester.Send
+	}
+	if err := jobs.RegisterMaintenanceJobs(scheduler, config); err != nil {
+		return nil, err
+	}
+
+	return scheduler, nil
+}
+
+// newEmailDigester returns nil when no SMTP server is configured.
+func newEmailDigester() (*email.Digester, error) {
+	config := email.Default()
+	if !config.Enabled() {
+		return nil, nil
+	}
+
+	postgres := integrations.GetPostgresStore("default")
+	preferences := email.NewPostgresPreferenceStore(postgres)
+	if err := preferences.EnsureSchema(); err != nil {
+		return nil, err
+	}
+	return email.NewDigester(
+		email.NewSQLDigestSource(postgres, integrations.GetDorisStore("")),
+		email.NewSMTPSender(config),
+		preferences,
+		config.TemplateDir,
+	)
+}
@@ -1,21 +1,58 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"os"
 
+	"github.com/spectrumwebco/agent_runtime/backend/core/config"
+	"github.com/spectrumwebco/agent_runtime/backend/core/outputs"
+	"github.com/spectrumwebco/agent_runtime/backend/core/profiling"
+	"github.com/spectrumwebco/agent_runtime/backend/core/rbac"
+	"github.com/spectrumwebco/agent_runtime/backend/core/readiness"
+	"github.com/spectrumwebco/agent_runtime/backend/db/integrations"
+	"github.com/spectrumwebco/agent_runtime/backend/db/integrations/integrationsmock"
 	"github.com/spectrumwebco/django-go/src/core"
 	"github.com/spectrumwebco/django-go/src/core/settings"
 	"github.com/spectrumwebco/django-go/src/db/migrations"
 	"github.com/spf13/cobra"
 )
 
+var (
+	devInMemory bool
+	devSQLite   string
+)
+
 func main() {
 	var rootCmd = &cobra.Command{
 		Use:   "manage",
 		Short: "Django-Go management utility",
 		Long:  `Django-Go management utility for the agent_runtime application.`,
+		PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+			if !devInMemory {
+				return nil
+			}
+
+			// the app and the integration stores share the database, so it
+			// lives in a temporary file rather than in memory
+			if devSQLite == "" {
+				f, err := os.CreateTemp("", "kled-dev-*.sqlite3")
+				if err != nil {
+					return err
+				}
+				f.Close()
+				devSQLite = f.Name()
+			}
+
+			if _, err := integrationsmock.InstallInMemory(devSQLite); err != nil {
+				return fmt.Errorf("error setting up in-memory integrations: %v", err)
+			}
+			fmt.Printf("Running with in-memory integrations and SQLite database %s\n", devSQLite)
+			return nil
+		},
 	}
+	rootCmd.PersistentFlags().BoolVar(&devInMemory, "dev-inmemory", false, "Replace Dragonfly, RocketMQ, Kafka, RAGflow, Postgres and Doris with in-memory implementations")
+	rootCmd.PersistentFlags().StringVar(&devSQLite, "dev-sqlite", "", "SQLite database file used with --dev-inmemory, a temporary file if empty")
 
 	var runserverCmd = &cobra.Command{
 		Use:   "runserver [address]",
@@ -29,6 +66,26 @@ func main() {
 			}
 
 			app := createApp()
+
+			// the server reports ready once its dependencies warmed up;
+			// Vault isn't used with in-memory integrations
+			gate := readiness.DefaultGate()
+			integrations.RegisterReadinessChecks(gate)
+			if !devInMemory {
+				config.RegisterReadinessChecks(gate)
+			}
+			go func() {
+				if err := gate.WarmUp(context.Background()); err != nil {
+					fmt.Printf("Dependencies unavailable, not ready: %v\n", err)
+				}
+			}()
+
+			profilingConfig := profiling.Default()
+			profiling.HandleSIGQUIT(context.Background(), profilingConfig.DumpDir)
+			profiles := profiling.NewSupabaseStore(integrations.GetSupabaseManager(), profilingConfig.Bucket)
+			go profiling.NewCollector(profilingConfig, profiles).Run(context.Background())
+			go outputs.DefaultStore().Run(context.Background())
+
 			fmt.Printf("Starting development server at %s\n", addr)
 			app.Run(addr)
 		},
@@ -46,6 +103,12 @@ func main() {
 				fmt.Printf("Error applying migrations: %v\n", err)
 				os.Exit(1)
 			}
+			// role bindings are read on every authorized request, so their
+			// table is created here instead of when the server starts
+			if err := rbac.NewPostgresRoleStore(integrations.GetPostgresStore("default")).EnsureSchema(); err != nil {
+				fmt.Printf("Error applying migrations: %v\n", err)
+				os.Exit(1)
+			}
 			fmt.Println("Migrations applied successfully")
 		},
 	}
@@ -90,6 +153,18 @@ func main() {
 	rootCmd.AddCommand(makemigrationsCmd)
 	rootCmd.AddCommand(shellCmd)
 	rootCmd.AddCommand(createsuperuserCmd)
+	rootCmd.AddCommand(newJobsCmd())
+	rootCmd.AddCommand(newGPUSamplerCmd())
+	rootCmd.AddCommand(newBackupCmd())
+	rootCmd.AddCommand(newRetentionCmd())
+	rootCmd.AddCommand(newOpenAPICmd())
+	rootCmd.AddCommand(newPromptsCmd())
+	rootCmd.AddCommand(newCDCCmd())
+	rootCmd.AddCommand(newRAGflowCmd())
+	rootCmd.AddCommand(newReconcileCmd())
+	rootCmd.AddCommand(newConfigCmd())
+	rootCmd.AddCommand(newProfileCmd())
+	rootCmd.AddCommand(newSLOCmd())
 
 	if err := rootCmd.Execute(); err != nil {
 		fmt.Println(err)
@@ -98,18 +173,23 @@ func main() {
 }
 
 func createApp() *core.App {
+	database := settings.Database{
+		Engine:   "mysql",
+		Name:     os.Getenv("DJANGO_GO_DB_NAME"),
+		User:     os.Getenv("DJANGO_GO_DB_USER"),
+		Password: os.Getenv("DJANGO_GO_DB_PASSWORD"),
+		Host:     os.Getenv("DJANGO_GO_DB_HOST"),
+		Port:     os.Getenv("DJANGO_GO_DB_PORT"),
+	}
+	if devInMemory {
+		database = settings.Database{Engine: "sqlite3", Name: devSQLite}
+	}
+
 	return core.NewApp(settings.Config{
 		Debug:        true,
 		SecretKey:    os.Getenv("DJANGO_GO_SECRET_KEY"),
 		AllowedHosts: []string{"localhost", "127.0.0.1"},
-		Database: settings.Database{
-			Engine:   "mysql",
-			Name:     os.Getenv("DJANGO_GO_DB_NAME"),
-			User:     os.Getenv("DJANGO_GO_DB_USER"),
-			Password: os.Getenv("DJANGO_GO_DB_PASSWORD"),
-			Host:     os.Getenv("DJANGO_GO_DB_HOST"),
-			Port:     os.Getenv("DJANGO_GO_DB_PORT"),
-		},
+		Database:     database,
 		InstalledApps: []string{
 			"github.com/spectrumwebco/django-go/src/admin",
 			"github.com/spectrumwebco/django-go/src/auth",
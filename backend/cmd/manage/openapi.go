@@ -0,0 +1,59 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/spectrumwebco/agent_runtime/backend/apps/app"
+	"github.com/spectrumwebco/agent_runtime/backend/core/openapi"
+	"github.com/spf13/cobra"
+)
+
+func newOpenAPICmd() *cobra.Command {
+	openapiCmd := &cobra.Command{
+		Use:   "openapi",
+		Short: "Works with the OpenAPI document of the API",
+		Long:  `Works with the OpenAPI 3 document generated from the route definitions of the API.`,
+	}
+
+	var output, server string
+	exportCmd := &cobra.Command{
+		Use:   "export",
+		Short: "Writes the OpenAPI document",
+		Long:  `Writes the OpenAPI document as JSON to stdout or to --output, for generating clients.`,
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			document := *openapi.Default().Document(app.APIInfo)
+			if server != "" {
+				document.Servers = []openapi.Server{{URL: server}}
+			}
+
+			var w io.Writer = os.Stdout
+			if output != "" && output != "-" {
+				f, err := os.Create(output)
+				if err != nil {
+					return err
+				}
+				defer f.Close()
+				w = f
+			}
+
+			encoder := json.NewEncoder(w)
+			encoder.SetIndent("", "  ")
+			if err := encoder.Encode(document); err != nil {
+				return fmt.Errorf("error writing the document: %v", err)
+			}
+			if output != "" && output != "-" {
+				fmt.Printf("Wrote %d paths to %s\n", len(document.Paths), output)
+			}
+			return nil
+		},
+	}
+	exportCmd.Flags().StringVarP(&output, "output", "o", "", "File to write the document to, stdout if empty")
+	exportCmd.Flags().StringVar(&server, "server", "", "Base URL of the API listed in the document, such as https://kled.example.com")
+
+	openapiCmd.AddCommand(exportCmd)
+	return openapiCmd
+}
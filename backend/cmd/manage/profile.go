@@ -0,0 +1,107 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/spectrumwebco/agent_runtime/backend/core/outbound"
+	"github.com/spectrumwebco/agent_runtime/backend/core/profiling"
+	"github.com/spectrumwebco/agent_runtime/backend/db/integrations"
+	"github.com/spf13/cobra"
+)
+
+func newProfileCmd() *cobra.Command {
+	profileCmd := &cobra.Command{
+		Use:   "profile",
+		Short: "Captures runtime profiles of the backend",
+		Long:  `Captures pprof profiles of a running backend for offline analysis with go tool pprof.`,
+	}
+
+	config := profiling.Default()
+	var (
+		server   string
+		token    string
+		duration time.Duration
+	)
+	captureCmd := &cobra.Command{
+		Use:   "capture",
+		Short: "Captures profiles and stores them in Supabase storage",
+		Long: `Captures profiles through the pprof endpoints of a running backend, which need an admin user, and uploads them to Supabase storage under <host>/<time>-<kind>.pb.gz.
+The CPU profile samples for --duration; the other kinds are snapshots.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if duration < time.Second {
+				return fmt.Errorf("the duration must be at least a second, got %s", duration)
+			}
+			serverURL, err := url.Parse(server)
+			if err != nil || serverURL.Host == "" {
+				return fmt.Errorf("invalid server URL %q", server)
+			}
+			client, err := outbound.Default().HTTPClient(duration + time.Minute)
+			if err != nil {
+				return err
+			}
+			store := profiling.NewSupabaseStore(integrations.GetSupabaseManager(), config.Bucket)
+
+			ctx := context.Background()
+			for _, kind := range config.Kinds {
+				at := time.Now()
+				data, err := fetchProfile(ctx, client, serverURL, token, kind, duration)
+				if err != nil {
+					return err
+				}
+				location, err := store.Save(ctx, profiling.Name(serverURL.Hostname(), kind, at), data)
+				if err != nil {
+					return err
+				}
+				fmt.Printf("Stored the %s profile at %s\n", kind, location)
+			}
+			return nil
+		},
+	}
+	captureCmd.Flags().StringVar(&server, "server", "http://localhost:8000", "Base URL of the backend to profile")
+	captureCmd.Flags().StringVar(&token, "token", "", "Bearer token of an admin user")
+	captureCmd.Flags().DurationVar(&duration, "duration", profiling.DefaultCPUDuration, "How long the CPU profile samples")
+	captureCmd.Flags().StringSliceVar(&config.Kinds, "kind", config.Kinds, "Kinds of profiles to capture, out of "+strings.Join(profiling.Kinds, ", "))
+	captureCmd.Flags().StringVar(&config.Bucket, "bucket", config.Bucket, "Supabase storage bucket to store the profiles in")
+
+	profileCmd.AddCommand(captureCmd)
+	return profileCmd
+}
+
+// fetchProfile downloads a profile from the pprof endpoints of the API.
+func fetchProfile(ctx context.Context, client *http.Client, server *url.URL, token, kind string, duration time.Duration) ([]byte, error) {
+	endpoint := server.JoinPath("/api/debug/pprof/", kind)
+	if kind == profiling.KindCPU {
+		endpoint = server.JoinPath("/api/debug/pprof/profile")
+		endpoint.RawQuery = url.Values{"seconds": {fmt.Sprint(int(duration.Seconds()))}}.Encode()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("error capturing the %s profile: %v", kind, err)
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("error capturing the %s profile: %v", kind, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("error capturing the %s profile: %s: %s", kind, resp.Status, strings.TrimSpace(string(data)))
+	}
+	return data, nil
+}
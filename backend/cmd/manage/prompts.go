@@ -0,0 +1,164 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spectrumwebco/agent_runtime/backend/core/prompts"
+	"github.com/spectrumwebco/agent_runtime/backend/db/integrations"
+	"github.com/spf13/cobra"
+)
+
+func newPromptsCmd() *cobra.Command {
+	promptsCmd := &cobra.Command{
+		Use:   "prompts",
+		Short: "Manages prompt templates",
+		Long:  `Lists and compares prompt template versions and rolls their rollout tags back.`,
+	}
+
+	listCmd := &cobra.Command{
+		Use:   "list [name]",
+		Short: "Lists prompts or the versions of one",
+		Long:  `Lists the latest version and tags of every prompt, or every version of the named prompt.`,
+		Args:  cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			store, err := newPromptStore()
+			if err != nil {
+				return err
+			}
+			ctx := context.Background()
+
+			var list []*prompts.Template
+			if len(args) == 1 {
+				list, err = store.Versions(ctx, args[0])
+			} else {
+				list, err = store.List(ctx)
+			}
+			if err != nil {
+				return err
+			}
+
+			w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+			fmt.Fprintln(w, "NAME\tVERSION\tTAGS\tCREATED\tCREATED BY\tDESCRIPTION")
+			tagsByName := map[string]map[int][]string{}
+			for _, tmpl := range list {
+				if _, ok := tagsByName[tmpl.Name]; !ok {
+					tags, err := store.Tags(ctx, tmpl.Name)
+					if err != nil {
+						return err
+					}
+					tagsByName[tmpl.Name] = invertTags(tags)
+				}
+				tags := strings.Join(tagsByName[tmpl.Name][tmpl.Version], ",")
+				if tags == "" {
+					tags = "-"
+				}
+				fmt.Fprintf(w, "%s\t%d\t%s\t%s\t%s\t%s\n", tmpl.Name, tmpl.Version, tags,
+					tmpl.CreatedAt.Format(time.RFC3339), orDash(tmpl.CreatedBy), orDash(tmpl.Description))
+			}
+			return w.Flush()
+		},
+	}
+
+	diffCmd := &cobra.Command{
+		Use:   "diff [from] [to]",
+		Short: "Compares two prompt versions",
+		Long:  `Compares two versions of a prompt, each given as name@version or name@tag. A bare name is its latest version.`,
+		Args:  cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			store, err := newPromptStore()
+			if err != nil {
+				return err
+			}
+			ctx := context.Background()
+
+			from, err := prompts.Resolve(ctx, store, args[0])
+			if err != nil {
+				return fmt.Errorf("%s: %v", args[0], err)
+			}
+			to, err := prompts.Resolve(ctx, store, args[1])
+			if err != nil {
+				return fmt.Errorf("%s: %v", args[1], err)
+			}
+
+			diff := prompts.Diff(from, to)
+			if diff == "" {
+				fmt.Printf("%s and %s are the same\n", from.Ref(), to.Ref())
+				return nil
+			}
+			fmt.Print(diff)
+			return nil
+		},
+	}
+
+	var tag string
+	rollbackCmd := &cobra.Command{
+		Use:   "rollback [name] [version]",
+		Short: "Rolls a rollout tag back",
+		Long:  `Points a rollout tag of a prompt at the given version, or at the version before the one it points at.`,
+		Args:  cobra.RangeArgs(1, 2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			version := 0
+			if len(args) == 2 {
+				n, err := strconv.Atoi(args[1])
+				if err != nil || n < 1 {
+					return fmt.Errorf("invalid version %q", args[1])
+				}
+				version = n
+			}
+			if err := prompts.ValidateTag(tag); err != nil {
+				return err
+			}
+
+			store, err := newPromptStore()
+			if err != nil {
+				return err
+			}
+			version, err = prompts.Rollback(context.Background(), store, args[0], tag, version)
+			if err != nil {
+				return err
+			}
+			fmt.Printf("%s@%s now points at version %d\n", args[0], tag, version)
+			return nil
+		},
+	}
+	rollbackCmd.Flags().StringVar(&tag, "tag", "production", "Rollout tag to move")
+
+	promptsCmd.AddCommand(listCmd)
+	promptsCmd.AddCommand(diffCmd)
+	promptsCmd.AddCommand(rollbackCmd)
+	return promptsCmd
+}
+
+func newPromptStore() (*prompts.PostgresStore, error) {
+	store := prompts.NewPostgresStore(integrations.GetPostgresStore("default"))
+	if err := store.EnsureSchema(); err != nil {
+		return nil, err
+	}
+	return store, nil
+}
+
+// invertTags maps each version to its tags, sorted.
+func invertTags(tags map[string]int) map[int][]string {
+	versions := map[int][]string{}
+	for tag, version := range tags {
+		versions[version] = append(versions[version], tag)
+	}
+	for _, names := range versions {
+		sort.Strings(names)
+	}
+	return versions
+}
+
+func orDash(value string) string {
+	if value == "" {
+		return "-"
+	}
+	return value
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spectrumwebco/agent_runtime/backend/core/embeddings"
+	"github.com/spectrumwebco/agent_runtime/backend/core/tenancy"
+	"github.com/spectrumwebco/agent_runtime/backend/core/vectorindex"
+	"github.com/spectrumwebco/agent_runtime/backend/db/integrations"
+	"github.com/spf13/cobra"
+)
+
+func newRAGflowCmd() *cobra.Command {
+	var project string
+
+	ragflowCmd := &cobra.Command{
+		Use:   "ragflow",
+		Short: "Manages RAGflow indexes",
+		Long:  `Rebuilds RAGflow indexes from the ingested documents and shows the aliases pointing at them.`,
+	}
+	ragflowCmd.PersistentFlags().StringVar(&project, "project", tenancy.DefaultProject, "Project of the index")
+
+	var (
+		dimension int
+		metric    string
+		model     string
+		batchSize int
+		dropOld   bool
+	)
+	reindexCmd := &cobra.Command{
+		Use:   "reindex [organization] [index]",
+		Short: "Rebuilds an index",
+		Long: `Builds a new index with the given dimension, metric and embedding model from the ingested documents, then points the alias of the index at it. ` +
+			`Documents ingested meanwhile are written to both indexes. An interrupted reindex is resumed by running the command again.`,
+		Args: cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			tenant, err := tenancy.New(args[0], project)
+			if err != nil {
+				return err
+			}
+			indexer, err := newVectorIndexer()
+			if err != nil {
+				return err
+			}
+			reindexer := vectorindex.NewReindexer(indexer, batchSize)
+			ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+			defer stop()
+
+			job, err := indexer.Store().ActiveJob(ctx, tenant.IndexName(args[1]))
+			if err != nil {
+				return err
+			}
+			if job != nil {
+				fmt.Printf("Resuming reindex %d into %s at %d/%d documents\n", job.ID, job.Target, job.Done, job.Total)
+			} else {
+				job, err = reindexer.Start(ctx, vectorindex.Spec{Tenant: tenant, Index: args[1], Dimension: dimension, Metric: metric, Model: model})
+				if err != nil {
+					return err
+				}
+				fmt.Printf("Reindexing %d documents of %s into %s\n", job.Total, job.Source, job.Target)
+			}
+
+			err = reindexer.Run(ctx, job, func(job *vectorindex.Job) {
+				fmt.Printf("Copied %d/%d documents (%.0f%%)\n", job.Done, job.Total, job.Progress()*100)
+			})
+			if err != nil {
+				if ctx.Err() != nil {
+					fmt.Printf("Interrupted at %d/%d documents, run the command again to resume\n", job.Done, job.Total)
+				}
+				return err
+			}
+			fmt.Printf("%s now points at %s\n", job.Alias, job.Target)
+
+			if dropOld {
+				// searches resolve the alias from a cache, give them time
+				// to move to the new index
+				time.Sleep(vectorindex.DefaultAliasTTL)
+				if _, err := integrations.GetPhysicalVectorStore().DeleteIndex(job.Source); err != nil {
+					return fmt.Errorf("error deleting index %s: %v", job.Source, err)
+				}
+				fmt.Printf("Deleted index %s\n", job.Source)
+			}
+			return nil
+		},
+	}
+	reindexCmd.Flags().IntVar(&dimension, "dimension", vectorindex.DefaultDimension, "Dimension of the new index")
+	reindexCmd.Flags().StringVar(&metric, "metric", vectorindex.DefaultMetric, "Metric of the new index")
+	reindexCmd.Flags().StringVar(&model, "model", "", "Embedding model of the new index, the default model if empty")
+	reindexCmd.Flags().IntVar(&batchSize, "batch-size", vectorindex.DefaultBatchSize, "Documents embedded at a time")
+	reindexCmd.Flags().BoolVar(&dropOld, "drop-old", false, "Delete the previous index once the alias points at the new one")
+
+	statusCmd := &cobra.Command{
+		Use:   "status [organization] [index]",
+		Short: "Shows the alias and reindexes of an index",
+		Long:  `Shows the index the alias points at and the progress of every reindex of it.`,
+		Args:  cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			tenant, err := tenancy.New(args[0], project)
+			if err != nil {
+				return err
+			}
+			indexer, err := newVectorIndexer()
+			if err != nil {
+				return err
+			}
+			ctx := context.Background()
+
+			alias, err := indexer.Resolve(ctx, tenant, args[1])
+			if err != nil {
+				return err
+			}
+			fmt.Printf("%s points at %s (model %s)\n", alias.Name, alias.Index, orDash(alias.Model))
+
+			jobs, err := indexer.Store().Jobs(ctx, alias.Name)
+			if err != nil {
+				return err
+			}
+			w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+			fmt.Fprintln(w, "ID\tSTATE\tTARGET\tMODEL\tPROGRESS\tUPDATED\tERROR")
+			for _, job := range jobs {
+				fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%d/%d\t%s\t%s\n", job.ID, job.State, job.Target, orDash(job.Model),
+					job.Done, job.Total, job.UpdatedAt.Format(time.RFC3339), orDash(job.Error))
+			}
+			return w.Flush()
+		},
+	}
+
+	abortCmd := &cobra.Command{
+		Use:   "abort [organization] [index]",
+		Short: "Aborts the reindex of an index",
+		Long:  `Stops the running reindex of an index and deletes the index it was building. The alias keeps pointing at the current index.`,
+		Args:  cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			tenant, err := tenancy.New(args[0], project)
+			if err != nil {
+				return err
+			}
+			indexer, err := newVectorIndexer()
+			if err != nil {
+				return err
+			}
+			job, err := vectorindex.NewReindexer(indexer, 0).Abort(context.Background(), tenant, args[1])
+			if err != nil {
+				return err
+			}
+			fmt.Printf("Aborted reindex %d and deleted %s\n", job.ID, job.Target)
+			return nil
+		},
+	}
+
+	ragflowCmd.AddCommand(reindexCmd)
+	ragflowCmd.AddCommand(statusCmd)
+	ragflowCmd.AddCommand(abortCmd)
+	return ragflowCmd
+}
+
+func newVectorIndexer() (*vectorindex.Indexer, error) {
+	store := vectorindex.NewPostgresStore(integrations.GetPostgresStore("default"))
+	if err := store.EnsureSchema(); err != nil {
+		return nil, err
+	}
+	embedders := vectorindex.ModelEmbedders(embeddings.Default(), integrations.GetKVStore())
+	return vectorindex.NewIndexer(store, integrations.GetPhysicalVectorStore(), embedders), nil
+}
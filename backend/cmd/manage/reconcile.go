@@ -0,0 +1,151 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/spectrumwebco/agent_runtime/backend/core/leader"
+	"github.com/spectrumwebco/agent_runtime/backend/core/lifecycle"
+	"github.com/spectrumwebco/agent_runtime/backend/core/quota"
+	"github.com/spectrumwebco/agent_runtime/backend/core/reconcile"
+	"github.com/spectrumwebco/agent_runtime/backend/db/integrations"
+	"github.com/spf13/cobra"
+)
+
+func newReconcileCmd() *cobra.Command {
+	var dryRun bool
+
+	reconcileCmd := &cobra.Command{
+		Use:   "reconcile",
+		Short: "Converges workspace containers on their desired state",
+		Long:  `Compares the desired state of workspaces with their containers, restarts crashed containers, deletes the containers of stopped workspaces, expired containers and orphaned containers with kled labels.`,
+	}
+	reconcileCmd.PersistentFlags().BoolVar(&dryRun, "dry-run", false, "Report drift without fixing it")
+
+	runCmd := &cobra.Command{
+		Use:   "run",
+		Short: "Reconciles every interval until stopped",
+		Long:  `Runs a pass every AGENT_RECONCILE_INTERVAL until the process receives SIGTERM or SIGINT. Several replicas may run; only the elected leader reconciles.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			reconciler, config, err := newReconciler(dryRun)
+			if err != nil {
+				return err
+			}
+			elector, err := leader.NewElectorFromConfig(reconcile.ElectionName, leader.FromEnv())
+			if err != nil {
+				return err
+			}
+
+			ctx, cancel := context.WithCancel(context.Background())
+			stopped := make(chan struct{})
+			shutdown := lifecycle.DefaultManager()
+			shutdown.Register(lifecycle.PhaseStopAccepting, "reconciler", func(ctx context.Context) error {
+				cancel()
+				select {
+				case <-stopped:
+					return nil
+				case <-ctx.Done():
+					return ctx.Err()
+				}
+			})
+			integrations.RegisterShutdownClosers(shutdown)
+
+			go func() {
+				defer close(stopped)
+				elector.Run(ctx, reconciler.Run)
+			}()
+
+			fmt.Printf("Reconciling workspaces every %s\n", config.Interval)
+			return shutdown.WaitForSignal()
+		},
+	}
+
+	onceCmd := &cobra.Command{
+		Use:   "once",
+		Short: "Runs a single pass",
+		Long:  `Runs a single pass unless another process is reconciling, and prints the drift it found.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			reconciler, _, err := newReconciler(dryRun)
+			if err != nil {
+				return err
+			}
+			elector, err := leader.NewElectorFromConfig(reconcile.ElectionName, leader.FromEnv())
+			if err != nil {
+				return err
+			}
+
+			var drift []reconcile.Drift
+			ran, err := elector.Do(context.Background(), func(ctx context.Context) error {
+				var err error
+				drift, err = reconciler.Reconcile(ctx)
+				return err
+			})
+			if err != nil {
+				return err
+			}
+			if !ran {
+				return fmt.Errorf("another process is reconciling")
+			}
+
+			fmt.Printf("%-40s %-24s %-8s %s\n", "CONTAINER", "DRIFT", "ACTION", "ERROR")
+			for _, d := range drift {
+				fmt.Printf("%-40s %-24s %-8s %s\n", d.Container.Name, d.Kind, d.Action, orDash(d.Error))
+			}
+			return nil
+		},
+	}
+
+	desireCmd := &cobra.Command{
+		Use:   "desire [workspace] [running|stopped|none]",
+		Short: "Sets the desired state of a workspace",
+		Long:  `Sets the state the reconciler keeps a workspace in. none stops managing the workspace.`,
+		Args:  cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			var desired reconcile.DesiredState
+			switch args[1] {
+			case "running", "stopped":
+				desired = reconcile.DesiredState(args[1])
+			case "none":
+			default:
+				return fmt.Errorf("the desired state must be running, stopped or none, got %q", args[1])
+			}
+
+			store := reconcile.NewSQLStore(integrations.GetPostgresStore("default"))
+			if err := store.EnsureSchema(); err != nil {
+				return err
+			}
+			if err := store.SetDesired(context.Background(), args[0], desired); err != nil {
+				return err
+			}
+			fmt.Printf("Workspace %s is desired %s\n", args[0], args[1])
+			return nil
+		},
+	}
+
+	reconcileCmd.AddCommand(runCmd)
+	reconcileCmd.AddCommand(onceCmd)
+	reconcileCmd.AddCommand(desireCmd)
+	return reconcileCmd
+}
+
+func newReconciler(dryRun bool) (*reconcile.Reconciler, reconcile.Config, error) {
+	config := reconcile.FromEnv()
+	config.DryRun = config.DryRun || dryRun
+
+	store := reconcile.NewSQLStore(integrations.GetPostgresStore("default"))
+	if err := store.EnsureSchema(); err != nil {
+		return nil, config, err
+	}
+	driver, err := reconcile.NewKubernetesDriver(config.Namespace)
+	if err != nil {
+		return nil, config, err
+	}
+	slots := quota.NewPostgresStore(integrations.GetPostgresStore("default"))
+	if err := slots.EnsureSchema(); err != nil {
+		return nil, config, err
+	}
+
+	reconciler := reconcile.NewReconciler(store, driver, config)
+	reconciler.SetSlots(quota.NewManager(slots, nil, nil))
+	return reconciler, config, nil
+}
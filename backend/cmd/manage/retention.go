@@ -0,0 +1,153 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spectrumwebco/agent_runtime/backend/core/artifacts"
+	"github.com/spectrumwebco/agent_runtime/backend/core/audit"
+	"github.com/spectrumwebco/agent_runtime/backend/core/retention"
+	"github.com/spectrumwebco/agent_runtime/backend/db/integrations"
+	"github.com/spf13/cobra"
+)
+
+func newRetentionCmd() *cobra.Command {
+	retentionCmd := &cobra.Command{
+		Use:   "retention",
+		Short: "Manages data retention",
+		Long:  `Reports and enforces the retention of trajectories, audit logs, state history, workspace events and run artifacts, and manages per-organization overrides.`,
+	}
+
+	var apply bool
+	pruneCmd := &cobra.Command{
+		Use:   "prune",
+		Short: "Reports or deletes data past its retention",
+		Long:  `Reports how many rows of each category and organization are past their retention. With --apply the rows are deleted.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			enforcer, err := newRetentionEnforcer()
+			if err != nil {
+				return err
+			}
+
+			report, runErr := enforcer.Run(context.Background(), !apply)
+			if report != nil {
+				w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+				fmt.Fprintln(w, "CATEGORY\tORGANIZATION\tRETENTION\tCUTOFF\tROWS\tERROR")
+				for _, result := range report.Results {
+					organization := result.OrganizationID
+					if organization == "" {
+						organization = "-"
+					}
+					fmt.Fprintf(w, "%s\t%s\t%dd\t%s\t%d\t%s\n", result.Category, organization, result.RetentionDays,
+						result.Cutoff.Format(time.RFC3339), result.Rows, result.Error)
+				}
+				if err := w.Flush(); err != nil {
+					return err
+				}
+				if report.DryRun {
+					fmt.Printf("Dry run: %d rows would be pruned, rerun with --apply to delete them\n", report.Rows())
+				} else {
+					fmt.Printf("Pruned %d rows\n", report.Rows())
+				}
+			}
+			return runErr
+		},
+	}
+	pruneCmd.Flags().BoolVar(&apply, "apply", false, "Delete the rows instead of only reporting them")
+
+	setCmd := &cobra.Command{
+		Use:   "set [organization] [category] [days]",
+		Short: "Overrides the retention of an organization",
+		Long:  `Overrides the retention in days of one category for an organization. 0 keeps the data forever.`,
+		Args:  cobra.ExactArgs(3),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			category, err := retention.ParseCategory(args[1])
+			if err != nil {
+				return err
+			}
+			days, err := strconv.Atoi(args[2])
+			if err != nil {
+				return fmt.Errorf("invalid number of days %q", args[2])
+			}
+
+			policies := retention.NewPolicyStore(integrations.GetPostgresStore("default"))
+			if err := policies.EnsureSchema(); err != nil {
+				return err
+			}
+			if err := policies.Set(args[0], category, days); err != nil {
+				return err
+			}
+			fmt.Printf("Retention of %s for organization %s set to %d days\n", category, args[0], days)
+			return nil
+		},
+	}
+
+	unsetCmd := &cobra.Command{
+		Use:   "unset [organization] [category]",
+		Short: "Removes a retention override",
+		Long:  `Removes the retention override of one category for an organization, which then uses the default again.`,
+		Args:  cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			category, err := retention.ParseCategory(args[1])
+			if err != nil {
+				return err
+			}
+
+			policies := retention.NewPolicyStore(integrations.GetPostgresStore("default"))
+			if err := policies.EnsureSchema(); err != nil {
+				return err
+			}
+			if err := policies.Unset(args[0], category); err != nil {
+				return err
+			}
+			fmt.Printf("Retention override of %s for organization %s removed\n", category, args[0])
+			return nil
+		},
+	}
+
+	retentionCmd.AddCommand(pruneCmd)
+	retentionCmd.AddCommand(setCmd)
+	retentionCmd.AddCommand(unsetCmd)
+	return retentionCmd
+}
+
+// newRetentionEnforcer prunes every category. Default retentions can be
+// changed with KLED_RETENTION_<CATEGORY>_DAYS, e.g.
+// KLED_RETENTION_AUDIT_LOGS_DAYS=730.
+func newRetentionEnforcer() (*retention.Enforcer, error) {
+	postgres := integrations.GetPostgresStore("default")
+	doris := integrations.GetDorisStore("")
+
+	policies := retention.NewPolicyStore(postgres)
+	if err := policies.EnsureSchema(); err != nil {
+		return nil, err
+	}
+
+	defaults := retention.DefaultDays()
+	for _, category := range retention.Categories {
+		name := "KLED_RETENTION_" + strings.ToUpper(string(category)) + "_DAYS"
+		value := os.Getenv(name)
+		if value == "" {
+			continue
+		}
+		days, err := strconv.Atoi(value)
+		if err != nil || days < 0 {
+			return nil, fmt.Errorf("invalid %s %q", name, value)
+		}
+		defaults[category] = days
+	}
+
+	return retention.NewEnforcer(policies, defaults,
+		retention.DorisTable(retention.Trajectories, doris, "trajectories", "created_at"),
+		retention.DorisTable(retention.Trajectories, doris, "experiment_exposures", "occurred_at"),
+		retention.AuditLog(audit.NewPostgresStore(postgres)),
+		retention.PostgresTable(retention.StateHistory, postgres, "state_history", "created_at"),
+		retention.DorisTable(retention.WorkspaceEvents, doris, "workspace_events", "occurred_at"),
+		retention.RunArtifacts(artifacts.DefaultManager()),
+	), nil
+}
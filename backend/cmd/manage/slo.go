@@ -0,0 +1,76 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/spectrumwebco/agent_runtime/backend/core/slo"
+	"github.com/spectrumwebco/agent_runtime/backend/db/integrations"
+	"github.com/spf13/cobra"
+)
+
+func newSLOCmd() *cobra.Command {
+	sloCmd := &cobra.Command{
+		Use:   "slo",
+		Short: "Reports the service level objectives",
+		Long:  `Reports the compliance and error budgets of the SLOs. The slo-alerts job alerts when a budget burns too fast.`,
+	}
+
+	var asJSON bool
+	reportCmd := &cobra.Command{
+		Use:   "report",
+		Short: "Prints the compliance, remaining error budget and burn rates of every SLO",
+		Long:  `Prints the compliance and remaining error budget of every SLO over its window, the burn rates of the alert windows and which alerts are firing.`,
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			store := slo.NewPostgresStore(integrations.GetPostgresStore("default"))
+			if err := store.EnsureSchema(); err != nil {
+				return err
+			}
+
+			now := time.Now()
+			reports := []slo.Report{}
+			for _, objective := range slo.Objectives() {
+				report, err := slo.Evaluate(context.Background(), store, objective, now)
+				if err != nil {
+					return err
+				}
+				reports = append(reports, report)
+			}
+
+			if asJSON {
+				encoder := json.NewEncoder(os.Stdout)
+				encoder.SetIndent("", "  ")
+				return encoder.Encode(reports)
+			}
+
+			fmt.Printf("%-26s %-10s %-10s %-10s %-8s %-8s %-8s %-8s %s\n", "SLO", "OBJECTIVE", "EVENTS", "COMPLIANT", "BUDGET", "BURN 5M", "BURN 1H", "BURN 6H", "FIRING")
+			for _, report := range reports {
+				fmt.Printf("%-26s %-10s %-10d %-10s %-8s %-8.2f %-8.2f %-8.2f %s\n",
+					report.SLO.Name,
+					percent(report.SLO.Objective),
+					report.Counts.Total,
+					percent(report.Compliance),
+					percent(report.BudgetRemaining),
+					report.BurnRates["5m"],
+					report.BurnRates["1h"],
+					report.BurnRates["6h"],
+					orDash(strings.Join(report.Firing, ",")),
+				)
+			}
+			return nil
+		},
+	}
+	reportCmd.Flags().BoolVar(&asJSON, "json", false, "Print the reports as JSON")
+
+	sloCmd.AddCommand(reportCmd)
+	return sloCmd
+}
+
+func percent(ratio float64) string {
+	return fmt.Sprintf("%.2f%%", ratio*100)
+}
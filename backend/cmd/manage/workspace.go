@@ -0,0 +1,41 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"github.com/spectrumwebco/agent_runtime/backend/core/quota"
+	"github.com/spectrumwebco/agent_runtime/backend/core/workspace"
+	"github.com/spectrumwebco/agent_runtime/backend/db/integrations"
+	djangogo "github.com/spectrumwebco/agent_runtime/pkg/djangogo/core"
+)
+
+// newWorkspaceController returns the controller background jobs change
+// workspaces with. It reads the settings of the server, so jobs charge the
+// same quotas as the API.
+func newWorkspaceController() (*workspace.Controller, error) {
+	defaults, _ := djangogo.GetSetting("QUOTA_DEFAULTS", map[string]interface{}{})
+	quota.ConfigureDefault(
+		integrations.GetPostgresStore("default"),
+		quota.ParseDefaults(defaults),
+		quota.NewKafkaNotifier(integrations.GetEventProducer("kled-quota")),
+	)
+
+	namespace, _ := djangogo.GetSetting("WORKSPACE_NAMESPACE", "")
+	readyTimeout, _ := djangogo.GetSetting("WORKSPACE_READY_TIMEOUT_SECONDS", int(workspace.DefaultReadyTimeout/time.Second))
+	rates, _ := djangogo.GetSetting("QUOTA_WORKSPACE_RATES", map[string]interface{}{"cpu_hours": 1.0})
+	return workspace.NewDefaultController(namespace.(string), time.Duration(readyTimeout.(int))*time.Second, quota.ParseRates(rates))
+}
+
+// scheduledWorkspaces starts and stops workspaces on their schedules.
+type scheduledWorkspaces struct {
+	controller *workspace.Controller
+}
+
+func (s scheduledWorkspaces) Start(ctx context.Context, workspaceID string) error {
+	return s.controller.Start(workspace.WithReason(ctx, "schedule"), workspaceID)
+}
+
+func (s scheduledWorkspaces) Stop(ctx context.Context, workspaceID string) error {
+	return s.controller.Stop(workspace.WithReason(ctx, "schedule"), workspaceID)
+}
@@ -48,14 +48,22 @@ func GetMiddlewareList() []gin.HandlerFunc {
 
 func GetDjangoMiddlewareList() []string {
 	return []string{
+		"apps.app.middleware.request_id.RequestIDMiddleware",
+		"apps.app.tunnel_views.TunnelHostMiddleware",
 		"django.middleware.security.SecurityMiddleware",
 		"django.contrib.sessions.middleware.SessionMiddleware",
 		"django.middleware.common.CommonMiddleware",
 		"django.middleware.csrf.CsrfViewMiddleware",
 		"django.contrib.auth.middleware.AuthenticationMiddleware",
+		"apps.app.middleware.jwt_auth.SupabaseJWTMiddleware",
 		"django.contrib.messages.middleware.MessageMiddleware",
 		"django.middleware.clickjacking.XFrameOptionsMiddleware",
 		"apps.app.middleware.security.SecurityMiddleware",
+		"apps.app.middleware.tenancy.TenantMiddleware",
+		"apps.app.middleware.audit.AuditMiddleware",
+		"apps.app.middleware.rbac.RBACMiddleware",
+		"apps.app.middleware.idempotency.IdempotencyMiddleware",
+		"apps.app.middleware.quota.QuotaMiddleware",
 		"apps.app.middleware.request_logging.RequestLoggingMiddleware",
 		"apps.app.middleware.performance.PerformanceMiddleware",
 		"apps.app.middleware.agent_integration.AgentIntegrationMiddleware",
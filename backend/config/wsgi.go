@@ -1,12 +1,14 @@
 package config
 
 import (
+	"errors"
 	"fmt"
 	"net/http"
 	"os"
 	"os/exec"
 	"strings"
 
+	"github.com/spectrumwebco/agent_runtime/backend/core/lifecycle"
 	"github.com/spectrumwebco/agent_runtime/pkg/djangogo/wsgi"
 )
 
@@ -18,10 +20,34 @@ func WSGIApplication() http.Handler {
 	return wsgi.NewHandler()
 }
 
+// RunWSGIServer serves the WSGI application until the process receives
+// SIGTERM or SIGINT, then stops accepting connections and drains the active
+// requests in the StopAccepting phase of the lifecycle manager.
 func RunWSGIServer(addr string) error {
-	handler := WSGIApplication()
-	fmt.Printf("Starting WSGI server at %s\n", addr)
-	return http.ListenAndServe(addr, handler)
+	srv := &http.Server{Addr: addr, Handler: WSGIApplication()}
+	shutdown := lifecycle.DefaultManager()
+	shutdown.Register(lifecycle.PhaseStopAccepting, "wsgi-server", lifecycle.HTTPServer(srv))
+
+	served := make(chan error, 1)
+	go func() {
+		fmt.Printf("Starting WSGI server at %s\n", addr)
+		served <- srv.ListenAndServe()
+	}()
+	stopped := make(chan error, 1)
+	go func() {
+		stopped <- shutdown.WaitForSignal()
+	}()
+
+	select {
+	case err := <-served:
+		if !errors.Is(err, http.ErrServerClosed) {
+			return err
+		}
+		// the server closes at the start of the shutdown, wait for the rest
+		return <-stopped
+	case err := <-stopped:
+		return err
+	}
 }
 
 func GetPythonWSGIApplication() string {
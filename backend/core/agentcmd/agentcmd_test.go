@@ -0,0 +1,184 @@
+package agentcmd
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"github.com/spectrumwebco/agent_runtime/backend/core/events"
+	pb "github.com/spectrumwebco/agent_runtime/backend/protos/gen/go/agent_control"
+)
+
+func startServer(t *testing.T, dispatcher *Dispatcher) pb.AgentCommandsClient {
+	t.Helper()
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := grpc.NewServer()
+	pb.RegisterAgentCommandsServer(server, NewServer(dispatcher, "secret"))
+	go server.Serve(lis)
+	t.Cleanup(server.Stop)
+
+	conn, err := grpc.NewClient(lis.Addr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return pb.NewAgentCommandsClient(conn)
+}
+
+func connect(t *testing.T, client pb.AgentCommandsClient, token string) pb.AgentCommands_ConnectClient {
+	t.Helper()
+	ctx, cancel := context.WithCancel(metadata.AppendToOutgoingContext(context.Background(), "authorization", "Bearer "+token))
+	t.Cleanup(cancel)
+	stream, err := client.Connect(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return stream
+}
+
+func TestExecuteRetriesUnacknowledgedCommands(t *testing.T) {
+	dispatcher := NewDispatcher()
+	client := startServer(t, dispatcher)
+
+	stream := connect(t, client, "secret")
+	err := stream.Send(&pb.AgentMessage{Message: &pb.AgentMessage_Hello{Hello: &pb.AgentHello{WorkspaceId: "ws-1"}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The agent drops the first attempt and answers the second.
+	go func() {
+		for {
+			command, err := stream.Recv()
+			if err != nil {
+				return
+			}
+			if command.CorrelationId != "request-1" {
+				t.Errorf("expected the correlation ID to be sent with attempt %d, got %q", command.Attempt, command.CorrelationId)
+			}
+			if command.Attempt < 2 {
+				continue
+			}
+			stream.Send(&pb.AgentMessage{Message: &pb.AgentMessage_Ack{Ack: &pb.CommandAck{CommandId: command.Id}}})
+			stream.Send(&pb.AgentMessage{Message: &pb.AgentMessage_Result{Result: &pb.CommandResult{
+				CommandId: command.Id,
+				Success:   true,
+				Output:    command.Params,
+			}}})
+		}
+	}()
+
+	ctx := events.WithCorrelationID(context.Background(), "request-1")
+	result, err := dispatcher.Execute(ctx, "ws-1", "echo", []byte(`{"a":1}`), Options{
+		Timeout:    5 * time.Second,
+		AckTimeout: 100 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !result.Success || string(result.Output) != `{"a":1}` || result.Attempts != 2 {
+		t.Fatalf("unexpected result %+v", result)
+	}
+}
+
+func TestExecuteStreamsOutput(t *testing.T) {
+	dispatcher := NewDispatcher()
+	client := startServer(t, dispatcher)
+
+	stream := connect(t, client, "secret")
+	err := stream.Send(&pb.AgentMessage{Message: &pb.AgentMessage_Hello{Hello: &pb.AgentHello{WorkspaceId: "ws-1"}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		command, err := stream.Recv()
+		if err != nil {
+			return
+		}
+		stream.Send(&pb.AgentMessage{Message: &pb.AgentMessage_Ack{Ack: &pb.CommandAck{CommandId: command.Id}}})
+		for i := 0; i < 3*outputQueue; i++ {
+			stream.Send(&pb.AgentMessage{Message: &pb.AgentMessage_Output{Output: &pb.CommandOutput{
+				CommandId: command.Id,
+				Stream:    "stdout",
+				Offset:    int64(i),
+				Data:      []byte("x"),
+			}}})
+		}
+		stream.Send(&pb.AgentMessage{Message: &pb.AgentMessage_Result{Result: &pb.CommandResult{CommandId: command.Id, Success: true}}})
+	}()
+
+	var offsets []int64
+	_, err = dispatcher.Execute(context.Background(), "ws-1", "exec", nil, Options{
+		Timeout: 5 * time.Second,
+		Output: func(chunk Chunk) {
+			// a slow reader holds back the agent instead of losing output
+			time.Sleep(time.Millisecond)
+			offsets = append(offsets, chunk.Offset)
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(offsets) != 3*outputQueue {
+		t.Fatalf("expected %d chunks before the result, got %d", 3*outputQueue, len(offsets))
+	}
+	for i, offset := range offsets {
+		if offset != int64(i) {
+			t.Fatalf("expected the chunks in order, got %v", offsets)
+		}
+	}
+}
+
+func TestExecuteGivesUpWithoutAcks(t *testing.T) {
+	dispatcher := NewDispatcher()
+	client := startServer(t, dispatcher)
+
+	stream := connect(t, client, "secret")
+	err := stream.Send(&pb.AgentMessage{Message: &pb.AgentMessage_Hello{Hello: &pb.AgentHello{WorkspaceId: "ws-1"}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		for {
+			if _, err := stream.Recv(); err != nil {
+				return
+			}
+		}
+	}()
+
+	_, err = dispatcher.Execute(context.Background(), "ws-1", "echo", nil, Options{
+		Timeout:     5 * time.Second,
+		AckTimeout:  50 * time.Millisecond,
+		MaxAttempts: 2,
+	})
+	if !errors.Is(err, ErrNotAcknowledged) {
+		t.Fatalf("expected ErrNotAcknowledged, got %v", err)
+	}
+}
+
+func TestExecuteWithoutAgent(t *testing.T) {
+	_, err := NewDispatcher().Execute(context.Background(), "ws-1", "echo", nil, Options{Timeout: 50 * time.Millisecond})
+	if !errors.Is(err, ErrNotConnected) {
+		t.Fatalf("expected ErrNotConnected, got %v", err)
+	}
+}
+
+func TestConnectRejectsInvalidToken(t *testing.T) {
+	client := startServer(t, NewDispatcher())
+
+	stream := connect(t, client, "wrong")
+	if _, err := stream.Recv(); status.Code(err) != codes.Unauthenticated {
+		t.Fatalf("expected Unauthenticated, got %v", err)
+	}
+}
@@ -0,0 +1,456 @@
+// Package agentcmd delivers commands issued by the backend to workspace
+// agents.
+//
+// The agent daemon in every workspace keeps a Connect stream to the backend
+// open and announces its workspace in a hello. Execute sends a command down
+// that stream and waits for its result. The agent acknowledges every command
+// it receives; a command that isn't acknowledged in time, or whose stream
+// breaks before the result arrives, is sent again with the same ID. Agents
+// remember the results of recent commands by ID, so a resent command is
+// answered again rather than run twice. Commands may stream their output
+// in chunks ahead of the result.
+//
+// Streams are held by the replica the agent connected to, and a command can
+// only be sent by that replica. On other replicas Execute waits for the agent
+// until the command times out and fails with ErrNotConnected.
+package agentcmd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/spectrumwebco/agent_runtime/backend/core/events"
+	"github.com/spectrumwebco/agent_runtime/backend/core/tracing"
+
+	pb "github.com/spectrumwebco/agent_runtime/backend/protos/gen/go/agent_control"
+)
+
+var agentcmdLogger = log.New(os.Stdout, "kled.agentcmd: ", log.LstdFlags)
+
+var (
+	// ErrNotConnected is returned when the workspace agent isn't connected
+	// to this replica before the command times out.
+	ErrNotConnected = errors.New("workspace agent is not connected")
+	// ErrNotAcknowledged is returned when the agent doesn't acknowledge any
+	// of the attempts to send the command.
+	ErrNotAcknowledged = errors.New("workspace agent did not acknowledge the command")
+	// ErrTimeout is returned when the result doesn't arrive before the
+	// command times out.
+	ErrTimeout = errors.New("timed out waiting for the command result")
+)
+
+var (
+	commandsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "kled_agent_commands_total",
+		Help: "Commands sent to workspace agents, by command and outcome.",
+	}, []string{"command", "outcome"})
+	commandRetries = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "kled_agent_command_retries_total",
+		Help: "Commands sent to workspace agents again after a missing ack or a broken stream.",
+	}, []string{"command"})
+	commandDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "kled_agent_command_duration_seconds",
+		Help:    "Time from issuing a command to a workspace agent until its result arrived.",
+		Buckets: prometheus.ExponentialBuckets(0.01, 2, 14),
+	}, []string{"command"})
+	connectedAgents = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "kled_agent_command_streams",
+		Help: "Workspace agents connected to this replica for commands.",
+	})
+)
+
+func init() {
+	prometheus.MustRegister(commandsTotal, commandRetries, commandDuration, connectedAgents)
+}
+
+const (
+	DefaultTimeout     = 60 * time.Second
+	DefaultAckTimeout  = 5 * time.Second
+	DefaultMaxAttempts = 3
+)
+
+// outputQueue bounds the chunks of a command's output waiting for
+// Options.Output.
+const outputQueue = 16
+
+// Options tune a single Execute call. Zero values use the defaults.
+type Options struct {
+	// Timeout bounds the whole command, including waiting for the agent to
+	// connect and every retry. The agent receives it as the command's
+	// deadline.
+	Timeout time.Duration
+	// AckTimeout is how long to wait for an ack before sending again.
+	AckTimeout time.Duration
+	// MaxAttempts limits how often the command is sent.
+	MaxAttempts int
+	// Output receives the output of a command that streams it, chunk by
+	// chunk in the order the agent sent them, before Execute returns. Chunks
+	// are dropped without it. While Output is busy, chunks queue up to a
+	// bound and then hold back the agent's stream.
+	Output func(Chunk)
+}
+
+func (o Options) withDefaults() Options {
+	if o.Timeout <= 0 {
+		o.Timeout = DefaultTimeout
+	}
+	if o.AckTimeout <= 0 {
+		o.AckTimeout = DefaultAckTimeout
+	}
+	if o.MaxAttempts <= 0 {
+		o.MaxAttempts = DefaultMaxAttempts
+	}
+	return o
+}
+
+// Result is the outcome of a command reported by the agent.
+type Result struct {
+	CommandID string          `json:"command_id"`
+	Success   bool            `json:"success"`
+	Output    json.RawMessage `json:"output,omitempty"`
+	Error     string          `json:"error,omitempty"`
+	Attempts  int             `json:"attempts"`
+}
+
+// Chunk is a piece of the output of a command.
+type Chunk struct {
+	// Stream is stdout or stderr.
+	Stream string
+	// Offset is where Data starts in the stream. An offset past the end of
+	// the chunks received so far means chunks were lost with a broken
+	// stream.
+	Offset int64
+	Data   []byte
+}
+
+// Dispatcher tracks the agents connected to this replica and the commands
+// waiting for their results.
+type Dispatcher struct {
+	mu       sync.Mutex
+	sessions map[string]*session
+	pending  map[string]*pendingCommand
+	// connected is closed and replaced whenever an agent connects.
+	connected chan struct{}
+}
+
+func NewDispatcher() *Dispatcher {
+	return &Dispatcher{
+		sessions:  map[string]*session{},
+		pending:   map[string]*pendingCommand{},
+		connected: make(chan struct{}),
+	}
+}
+
+var (
+	defaultDispatcher     *Dispatcher
+	defaultDispatcherOnce sync.Once
+)
+
+// Default returns the dispatcher shared by the gRPC server and the WebSocket
+// consumers of this process.
+func Default() *Dispatcher {
+	defaultDispatcherOnce.Do(func() {
+		defaultDispatcher = NewDispatcher()
+	})
+	return defaultDispatcher
+}
+
+// session is the Connect stream of one agent.
+type session struct {
+	workspaceID string
+	send        chan *pb.Command
+	done        chan struct{}
+	closeOnce   sync.Once
+}
+
+func (s *session) close() {
+	s.closeOnce.Do(func() { close(s.done) })
+}
+
+type pendingCommand struct {
+	acked   chan struct{}
+	ackOnce sync.Once
+	result  chan *pb.CommandResult
+	// output is nil unless the caller wants the output.
+	output chan *pb.CommandOutput
+	// done is closed when Execute returns.
+	done chan struct{}
+}
+
+// Connected reports whether the agent of workspaceID is connected to this
+// replica.
+func (d *Dispatcher) Connected(workspaceID string) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	_, ok := d.sessions[workspaceID]
+	return ok
+}
+
+// attach registers the stream of a newly connected agent, replacing any
+// older stream of the same workspace.
+func (d *Dispatcher) attach(workspaceID string) *session {
+	s := &session{
+		workspaceID: workspaceID,
+		send:        make(chan *pb.Command, 16),
+		done:        make(chan struct{}),
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if old, ok := d.sessions[workspaceID]; ok {
+		old.close()
+	} else {
+		connectedAgents.Inc()
+	}
+	d.sessions[workspaceID] = s
+	close(d.connected)
+	d.connected = make(chan struct{})
+	return s
+}
+
+func (d *Dispatcher) detach(s *session) {
+	s.close()
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.sessions[s.workspaceID] == s {
+		delete(d.sessions, s.workspaceID)
+		connectedAgents.Dec()
+	}
+}
+
+func (d *Dispatcher) acknowledge(commandID string) {
+	d.mu.Lock()
+	p, ok := d.pending[commandID]
+	d.mu.Unlock()
+	if ok {
+		p.ackOnce.Do(func() { close(p.acked) })
+	}
+}
+
+func (d *Dispatcher) complete(result *pb.CommandResult) {
+	d.mu.Lock()
+	p, ok := d.pending[result.CommandId]
+	d.mu.Unlock()
+	if !ok {
+		// Late results of commands that already timed out, and results
+		// answered again for a resent command, end up here.
+		return
+	}
+	p.ackOnce.Do(func() { close(p.acked) })
+	select {
+	case p.result <- result:
+	default:
+	}
+}
+
+// deliver queues a chunk of output for the command's Execute, waiting while
+// the queue is full.
+func (d *Dispatcher) deliver(output *pb.CommandOutput) {
+	d.mu.Lock()
+	p, ok := d.pending[output.CommandId]
+	d.mu.Unlock()
+	if !ok || p.output == nil {
+		return
+	}
+	select {
+	case p.output <- output:
+	case <-p.done:
+	}
+}
+
+// waitForSession returns the stream of the agent of workspaceID, waiting for
+// the agent to connect until ctx is done.
+func (d *Dispatcher) waitForSession(ctx context.Context, workspaceID string) (*session, error) {
+	for {
+		d.mu.Lock()
+		s, ok := d.sessions[workspaceID]
+		connected := d.connected
+		d.mu.Unlock()
+		if ok {
+			return s, nil
+		}
+
+		select {
+		case <-connected:
+		case <-ctx.Done():
+			if errors.Is(ctx.Err(), context.Canceled) {
+				return nil, ctx.Err()
+			}
+			return nil, ErrNotConnected
+		}
+	}
+}
+
+// Execute sends the command name with params to the agent of workspaceID
+// and waits for its result. A result reporting a failed command is returned
+// without an error. The correlation ID of ctx is passed to the agent, and
+// the command is recorded in its timeline.
+func (d *Dispatcher) Execute(ctx context.Context, workspaceID, name string, params json.RawMessage, opts Options) (*Result, error) {
+	opts = opts.withDefaults()
+	ctx, cancel := context.WithTimeout(ctx, opts.Timeout)
+	defer cancel()
+	deadline, _ := ctx.Deadline()
+
+	id := uuid.New().String()
+	p := &pendingCommand{
+		acked:  make(chan struct{}),
+		result: make(chan *pb.CommandResult, 1),
+		done:   make(chan struct{}),
+	}
+	if opts.Output != nil {
+		p.output = make(chan *pb.CommandOutput, outputQueue)
+	}
+	d.mu.Lock()
+	d.pending[id] = p
+	d.mu.Unlock()
+	defer func() {
+		d.mu.Lock()
+		delete(d.pending, id)
+		d.mu.Unlock()
+		close(p.done)
+	}()
+
+	start := time.Now()
+	result, err := d.execute(ctx, workspaceID, &pb.Command{
+		Id:             id,
+		Name:           name,
+		Params:         params,
+		DeadlineUnixMs: deadline.UnixMilli(),
+		CorrelationId:  events.CorrelationID(ctx),
+	}, p, opts)
+
+	outcome := "success"
+	switch {
+	case errors.Is(err, ErrNotConnected):
+		outcome = "not_connected"
+	case errors.Is(err, ErrNotAcknowledged):
+		outcome = "not_acknowledged"
+	case errors.Is(err, ErrTimeout):
+		outcome = "timeout"
+	case err != nil:
+		outcome = "canceled"
+	case !result.Success:
+		outcome = "failure"
+	}
+	commandsTotal.WithLabelValues(name, outcome).Inc()
+	if err == nil {
+		commandDuration.WithLabelValues(name).Observe(time.Since(start).Seconds())
+	}
+
+	entry := tracing.Entry{
+		Time:       start.UTC(),
+		Source:     tracing.SourceAgent,
+		Name:       name,
+		DurationMs: time.Since(start).Milliseconds(),
+		Attributes: map[string]string{"command_id": id, "workspace_id": workspaceID, "outcome": outcome},
+	}
+	if err != nil {
+		entry.Error = err.Error()
+	} else {
+		entry.Attributes["attempts"] = strconv.Itoa(result.Attempts)
+		entry.Error = result.Error
+	}
+	tracing.Record(ctx, entry)
+	return result, err
+}
+
+func (d *Dispatcher) execute(ctx context.Context, workspaceID string, command *pb.Command, p *pendingCommand, opts Options) (*Result, error) {
+attempts:
+	for attempt := 1; attempt <= opts.MaxAttempts; attempt++ {
+		if attempt > 1 {
+			commandRetries.WithLabelValues(command.Name).Inc()
+		}
+
+		s, err := d.waitForSession(ctx, workspaceID)
+		if err != nil {
+			return nil, err
+		}
+
+		// Every attempt gets its own message, the one sent before may
+		// still be queued on a dead stream.
+		send := &pb.Command{
+			Id:             command.Id,
+			Name:           command.Name,
+			Params:         command.Params,
+			DeadlineUnixMs: command.DeadlineUnixMs,
+			Attempt:        int32(attempt),
+			CorrelationId:  command.CorrelationId,
+		}
+		select {
+		case s.send <- send:
+		case <-s.done:
+			continue
+		case <-ctx.Done():
+			return nil, waitError(ctx)
+		}
+
+		ackTimer := time.NewTimer(opts.AckTimeout)
+		select {
+		case <-p.acked:
+			ackTimer.Stop()
+		case <-ackTimer.C:
+			agentcmdLogger.Printf("Command %s (%s) to workspace %s was not acknowledged, attempt %d of %d, correlation ID %s", command.Id, command.Name, workspaceID, attempt, opts.MaxAttempts, command.CorrelationId)
+			continue
+		case <-s.done:
+			ackTimer.Stop()
+			continue
+		case <-ctx.Done():
+			ackTimer.Stop()
+			return nil, waitError(ctx)
+		}
+
+		for {
+			select {
+			case output := <-p.output:
+				opts.Output(chunk(output))
+			case result := <-p.result:
+				// output is sent before the result, but may still be
+				// queued
+				for len(p.output) > 0 {
+					opts.Output(chunk(<-p.output))
+				}
+				return &Result{
+					CommandID: result.CommandId,
+					Success:   result.Success,
+					Output:    json.RawMessage(result.Output),
+					Error:     result.Error,
+					Attempts:  attempt,
+				}, nil
+			case <-s.done:
+				// The stream broke after the ack, send again so the
+				// agent reports the result on its new stream.
+				continue attempts
+			case <-ctx.Done():
+				return nil, waitError(ctx)
+			}
+		}
+	}
+
+	select {
+	case <-p.acked:
+		// Acknowledged, but every stream broke before the result arrived.
+		return nil, ErrTimeout
+	default:
+		return nil, ErrNotAcknowledged
+	}
+}
+
+func chunk(output *pb.CommandOutput) Chunk {
+	return Chunk{Stream: output.Stream, Offset: output.Offset, Data: output.Data}
+}
+
+func waitError(ctx context.Context) error {
+	if errors.Is(ctx.Err(), context.Canceled) {
+		return ctx.Err()
+	}
+	return ErrTimeout
+}
@@ -0,0 +1,100 @@
+package agentcmd
+
+import (
+	"crypto/subtle"
+	"errors"
+	"io"
+	"strings"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	pb "github.com/spectrumwebco/agent_runtime/backend/protos/gen/go/agent_control"
+)
+
+// Server accepts the Connect streams of workspace agents. Agents must
+// present token as bearer token; an empty token rejects every stream.
+type Server struct {
+	pb.UnimplementedAgentCommandsServer
+
+	dispatcher *Dispatcher
+	token      string
+}
+
+func NewServer(dispatcher *Dispatcher, token string) *Server {
+	return &Server{dispatcher: dispatcher, token: token}
+}
+
+func (s *Server) Connect(stream pb.AgentCommands_ConnectServer) error {
+	if !s.authorized(stream) {
+		return status.Error(codes.Unauthenticated, "invalid agent token")
+	}
+
+	first, err := stream.Recv()
+	if err != nil {
+		return err
+	}
+	hello := first.GetHello()
+	if hello == nil || hello.WorkspaceId == "" {
+		return status.Error(codes.InvalidArgument, "the first message must be a hello with a workspace ID")
+	}
+
+	session := s.dispatcher.attach(hello.WorkspaceId)
+	defer s.dispatcher.detach(session)
+	agentcmdLogger.Printf("Agent of workspace %s connected (version %s)", hello.WorkspaceId, hello.Version)
+
+	received := make(chan error, 1)
+	go func() {
+		received <- s.receive(stream)
+	}()
+
+	for {
+		select {
+		case command := <-session.send:
+			if err := stream.Send(command); err != nil {
+				return err
+			}
+		case err := <-received:
+			agentcmdLogger.Printf("Agent of workspace %s disconnected", hello.WorkspaceId)
+			return err
+		case <-session.done:
+			return status.Error(codes.Aborted, "replaced by a newer stream of the same workspace")
+		}
+	}
+}
+
+func (s *Server) receive(stream pb.AgentCommands_ConnectServer) error {
+	for {
+		message, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		switch {
+		case message.GetAck() != nil:
+			s.dispatcher.acknowledge(message.GetAck().CommandId)
+		case message.GetResult() != nil:
+			s.dispatcher.complete(message.GetResult())
+		case message.GetOutput() != nil:
+			s.dispatcher.deliver(message.GetOutput())
+		}
+	}
+}
+
+func (s *Server) authorized(stream pb.AgentCommands_ConnectServer) bool {
+	if s.token == "" {
+		return false
+	}
+
+	md, _ := metadata.FromIncomingContext(stream.Context())
+	for _, value := range md.Get("authorization") {
+		token := strings.TrimPrefix(value, "Bearer ")
+		if subtle.ConstantTimeCompare([]byte(token), []byte(s.token)) == 1 {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,244 @@
+// Package artifacts keeps the files agent runs produce.
+//
+// A run registers a file as an artifact: its content is uploaded to Supabase
+// storage, and its SHA-256, size, content type and metadata are recorded.
+// Artifacts are listed by run and downloaded through signed URLs, which
+// carry their expiry and an HMAC of it, so they can be handed to clients
+// without an API key. Downloads are checked against the recorded hash.
+//
+// Artifacts are removed once they are older than the retention of the
+// artifacts category of their organization, or earlier if they were
+// registered with an expiry of their own.
+package artifacts
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"github.com/google/uuid"
+	"github.com/spectrumwebco/agent_runtime/backend/db/integrations"
+)
+
+var artifactsLogger = log.New(os.Stdout, "kled.artifacts: ", log.LstdFlags)
+
+var (
+	ErrNotFound = errors.New("artifact not found")
+	// ErrTooLarge is returned for content larger than Config.MaxBytes.
+	ErrTooLarge = errors.New("artifact is too large")
+	// ErrCorrupt is returned when the stored content doesn't match the
+	// recorded hash.
+	ErrCorrupt = errors.New("artifact content doesn't match its hash")
+	// ErrInvalidSignature is returned for download URLs that weren't signed
+	// by this backend or have expired.
+	ErrInvalidSignature = errors.New("invalid or expired download signature")
+)
+
+// Artifact is a file produced by a run.
+type Artifact struct {
+	ID             string `json:"id"`
+	OrganizationID string `json:"organization_id"`
+	ProjectID      string `json:"project_id"`
+	RunID          string `json:"run_id"`
+	WorkspaceID    string `json:"workspace_id,omitempty"`
+	Name           string `json:"name"`
+	ContentType    string `json:"content_type"`
+	Size           int64  `json:"size"`
+	// SHA256 is the hex-encoded hash of the content.
+	SHA256   string            `json:"sha256"`
+	Metadata map[string]string `json:"metadata,omitempty"`
+	// Path is where the content is stored in the bucket.
+	Path      string    `json:"-"`
+	CreatedBy string    `json:"created_by,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+	// ExpiresAt removes the artifact before the retention of its
+	// organization.
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
+
+// ValidateName checks that name can be used as a file name.
+func ValidateName(name string) error {
+	if name == "" || len(name) > 255 || name == "." || name == ".." || strings.ContainsAny(name, `/\`) {
+		return fmt.Errorf("invalid artifact name %q, must be a file name", name)
+	}
+	for _, r := range name {
+		if unicode.IsControl(r) {
+			return fmt.Errorf("invalid artifact name %q, must not contain control characters", name)
+		}
+	}
+	return nil
+}
+
+// Blobs holds the content of artifacts. integrations.SupabaseManager
+// implements it.
+type Blobs interface {
+	UploadFile(bucket, path string, fileData []byte, contentType string) (bool, string, error)
+	DownloadFile(bucket, path string) (bool, []byte, error)
+	DeleteFile(bucket, path string) (bool, error)
+}
+
+// Manager registers, serves and prunes artifacts.
+type Manager struct {
+	config Config
+	store  Store
+	blobs  Blobs
+	now    func() time.Time
+}
+
+func NewManager(config Config, store Store, blobs Blobs) *Manager {
+	return &Manager{config: config, store: store, blobs: blobs, now: time.Now}
+}
+
+var (
+	defaultManager     *Manager
+	defaultManagerOnce sync.Once
+)
+
+// DefaultManager returns the manager of the process, keeping artifacts in
+// Postgres and Supabase storage.
+func DefaultManager() *Manager {
+	defaultManagerOnce.Do(func() {
+		defaultManager = NewManager(Default(), ConfigureDefault(integrations.GetPostgresStore("default")), integrations.GetSupabaseManager())
+	})
+	return defaultManager
+}
+
+// Register uploads content as artifact, which names its run, name and
+// metadata. The ID, size, hash and storage path are set, and the content
+// type detected if it is empty.
+func (m *Manager) Register(ctx context.Context, artifact *Artifact, content io.Reader) (*Artifact, error) {
+	if err := ValidateName(artifact.Name); err != nil {
+		return nil, err
+	}
+	data, err := io.ReadAll(io.LimitReader(content, m.config.MaxBytes+1))
+	if err != nil {
+		return nil, fmt.Errorf("error reading artifact %s: %v", artifact.Name, err)
+	}
+	if int64(len(data)) > m.config.MaxBytes {
+		return nil, ErrTooLarge
+	}
+
+	sum := sha256.Sum256(data)
+	registered := *artifact
+	registered.ID = uuid.New().String()
+	registered.Size = int64(len(data))
+	registered.SHA256 = hex.EncodeToString(sum[:])
+	registered.CreatedAt = m.now().UTC()
+	if registered.ContentType == "" {
+		registered.ContentType = http.DetectContentType(data)
+	}
+	registered.Path = strings.Join([]string{registered.OrganizationID, registered.RunID, registered.ID, registered.Name}, "/")
+
+	ok, _, err := m.blobs.UploadFile(m.config.Bucket, registered.Path, data, registered.ContentType)
+	if err != nil {
+		return nil, fmt.Errorf("error uploading artifact %s: %v", registered.Name, err)
+	} else if !ok {
+		return nil, fmt.Errorf("error uploading artifact %s", registered.Name)
+	}
+	if err := m.store.Create(ctx, &registered); err != nil {
+		m.deleteContent(&registered)
+		return nil, err
+	}
+	return &registered, nil
+}
+
+func (m *Manager) Get(ctx context.Context, id string) (*Artifact, error) {
+	return m.store.Get(ctx, id)
+}
+
+// List returns the artifacts of a run in the order they were registered.
+func (m *Manager) List(ctx context.Context, organizationID, runID string) ([]*Artifact, error) {
+	return m.store.List(ctx, organizationID, runID)
+}
+
+// Content downloads the content of artifact and checks it against the
+// recorded hash.
+func (m *Manager) Content(ctx context.Context, artifact *Artifact) ([]byte, error) {
+	ok, data, err := m.blobs.DownloadFile(m.config.Bucket, artifact.Path)
+	if err != nil {
+		return nil, fmt.Errorf("error downloading artifact %s: %v", artifact.ID, err)
+	} else if !ok {
+		return nil, ErrNotFound
+	}
+	sum := sha256.Sum256(data)
+	if hex.EncodeToString(sum[:]) != artifact.SHA256 {
+		return nil, ErrCorrupt
+	}
+	return data, nil
+}
+
+// Sign returns the query parameters that let anyone download the artifact
+// id until they expire.
+func (m *Manager) Sign(id string) (url.Values, time.Time, error) {
+	if m.config.SigningKey == "" {
+		return nil, time.Time{}, errors.New("no signing key for artifact URLs, set AGENT_ARTIFACTS_SIGNING_KEY or AGENT_SECRET_KEY")
+	}
+	expires := m.now().Add(m.config.URLTTL).Truncate(time.Second)
+	unix := strconv.FormatInt(expires.Unix(), 10)
+	return url.Values{"expires": {unix}, "signature": {m.signature(id, unix)}}, expires, nil
+}
+
+// Verify checks the query parameters of a download URL of the artifact id.
+func (m *Manager) Verify(id string, query url.Values) error {
+	expires, signature := query.Get("expires"), query.Get("signature")
+	unix, err := strconv.ParseInt(expires, 10, 64)
+	if err != nil || m.config.SigningKey == "" || m.now().Unix() > unix {
+		return ErrInvalidSignature
+	}
+	if !hmac.Equal([]byte(signature), []byte(m.signature(id, expires))) {
+		return ErrInvalidSignature
+	}
+	return nil
+}
+
+func (m *Manager) signature(id, expires string) string {
+	mac := hmac.New(sha256.New, []byte(m.config.SigningKey))
+	mac.Write([]byte(id + "\n" + expires))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Prune removes the artifacts of an organization created before before or
+// past their own expiry, or with dryRun only counts them.
+func (m *Manager) Prune(ctx context.Context, organizationID string, before time.Time, dryRun bool) (int64, error) {
+	expired, err := m.store.Expired(ctx, organizationID, before, m.now())
+	if err != nil || dryRun {
+		return int64(len(expired)), err
+	}
+
+	var removed int64
+	for _, artifact := range expired {
+		if err := m.deleteContent(artifact); err != nil {
+			// keep the record so the next run retries
+			continue
+		}
+		if err := m.store.Delete(ctx, artifact.ID); err != nil {
+			return removed, err
+		}
+		removed++
+	}
+	return removed, nil
+}
+
+func (m *Manager) deleteContent(artifact *Artifact) error {
+	ok, err := m.blobs.DeleteFile(m.config.Bucket, artifact.Path)
+	if err == nil && !ok {
+		err = fmt.Errorf("storage refused to delete %s", artifact.Path)
+	}
+	if err != nil {
+		artifactsLogger.Printf("Error deleting the content of artifact %s: %v", artifact.ID, err)
+	}
+	return err
+}
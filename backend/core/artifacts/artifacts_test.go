@@ -0,0 +1,138 @@
+package artifacts
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+type memoryBlobs map[string][]byte
+
+func (b memoryBlobs) UploadFile(bucket, path string, fileData []byte, contentType string) (bool, string, error) {
+	b[bucket+"/"+path] = append([]byte(nil), fileData...)
+	return true, "memory://" + bucket + "/" + path, nil
+}
+
+func (b memoryBlobs) DownloadFile(bucket, path string) (bool, []byte, error) {
+	data, ok := b[bucket+"/"+path]
+	return ok, data, nil
+}
+
+func (b memoryBlobs) DeleteFile(bucket, path string) (bool, error) {
+	delete(b, bucket+"/"+path)
+	return true, nil
+}
+
+func newTestManager(blobs memoryBlobs) *Manager {
+	manager := NewManager(Config{Bucket: "artifacts", MaxBytes: 16, URLTTL: time.Minute, SigningKey: "secret"}, NewMemoryStore(), blobs)
+	manager.now = func() time.Time { return time.Date(2026, 1, 2, 15, 4, 5, 0, time.UTC) }
+	return manager
+}
+
+func TestRegister(t *testing.T) {
+	blobs := memoryBlobs{}
+	manager := newTestManager(blobs)
+	ctx := context.Background()
+
+	artifact, err := manager.Register(ctx, &Artifact{OrganizationID: "acme", RunID: "run-1", Name: "report.txt", Metadata: map[string]string{"step": "3"}}, strings.NewReader("hello"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if artifact.Size != 5 || artifact.SHA256 != "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824" {
+		t.Errorf("unexpected size %d and hash %s", artifact.Size, artifact.SHA256)
+	}
+	if !strings.HasPrefix(artifact.ContentType, "text/plain") {
+		t.Errorf("expected a detected text content type, got %q", artifact.ContentType)
+	}
+	if _, ok := blobs["artifacts/acme/run-1/"+artifact.ID+"/report.txt"]; !ok {
+		t.Errorf("expected the content in storage, got %v", blobs)
+	}
+
+	listed, err := manager.List(ctx, "acme", "run-1")
+	if err != nil || len(listed) != 1 || listed[0].Metadata["step"] != "3" {
+		t.Fatalf("expected the artifact listed with its metadata, got %v, %v", listed, err)
+	}
+	if listed, _ := manager.List(ctx, "other", "run-1"); len(listed) != 0 {
+		t.Errorf("expected no artifacts of another organization, got %v", listed)
+	}
+
+	data, err := manager.Content(ctx, artifact)
+	if err != nil || string(data) != "hello" {
+		t.Fatalf("expected the content back, got %q, %v", data, err)
+	}
+	blobs["artifacts/"+artifact.Path] = []byte("tampered")
+	if _, err := manager.Content(ctx, artifact); !errors.Is(err, ErrCorrupt) {
+		t.Errorf("expected tampered content to fail, got %v", err)
+	}
+
+	if _, err := manager.Register(ctx, &Artifact{OrganizationID: "acme", RunID: "run-1", Name: "big.bin"}, strings.NewReader(strings.Repeat("x", 17))); err != ErrTooLarge {
+		t.Errorf("expected content over the limit to fail, got %v", err)
+	}
+	for _, name := range []string{"", "..", "a/b", "a\nb"} {
+		if _, err := manager.Register(ctx, &Artifact{OrganizationID: "acme", RunID: "run-1", Name: name}, strings.NewReader("x")); err == nil {
+			t.Errorf("expected the name %q to be rejected", name)
+		}
+	}
+}
+
+func TestSign(t *testing.T) {
+	manager := newTestManager(memoryBlobs{})
+
+	query, expires, err := manager.Sign("artifact-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !expires.Equal(time.Date(2026, 1, 2, 15, 5, 5, 0, time.UTC)) {
+		t.Errorf("unexpected expiry %s", expires)
+	}
+	if err := manager.Verify("artifact-1", query); err != nil {
+		t.Errorf("expected the signature to verify, got %v", err)
+	}
+	if err := manager.Verify("artifact-2", query); err != ErrInvalidSignature {
+		t.Errorf("expected the signature of another artifact to fail, got %v", err)
+	}
+
+	tampered := query
+	tampered.Set("expires", "9999999999")
+	if err := manager.Verify("artifact-1", tampered); err != ErrInvalidSignature {
+		t.Errorf("expected an extended expiry to fail, got %v", err)
+	}
+
+	query, _, _ = manager.Sign("artifact-1")
+	manager.now = func() time.Time { return time.Date(2026, 1, 2, 15, 6, 0, 0, time.UTC) }
+	if err := manager.Verify("artifact-1", query); err != ErrInvalidSignature {
+		t.Errorf("expected an expired signature to fail, got %v", err)
+	}
+}
+
+func TestPrune(t *testing.T) {
+	blobs := memoryBlobs{}
+	manager := newTestManager(blobs)
+	ctx := context.Background()
+
+	old, _ := manager.Register(ctx, &Artifact{OrganizationID: "acme", RunID: "run-1", Name: "old.txt"}, strings.NewReader("old"))
+	manager.now = func() time.Time { return time.Date(2026, 2, 1, 0, 0, 0, 0, time.UTC) }
+	expiresAt := manager.now().Add(time.Hour)
+	short, _ := manager.Register(ctx, &Artifact{OrganizationID: "acme", RunID: "run-2", Name: "short.txt", ExpiresAt: &expiresAt}, strings.NewReader("short"))
+	kept, _ := manager.Register(ctx, &Artifact{OrganizationID: "acme", RunID: "run-2", Name: "kept.txt"}, strings.NewReader("kept"))
+
+	before := time.Date(2026, 1, 15, 0, 0, 0, 0, time.UTC)
+	if count, err := manager.Prune(ctx, "acme", before, true); err != nil || count != 1 || len(blobs) != 3 {
+		t.Fatalf("expected a dry run to count 1 artifact, got %d, %v", count, err)
+	}
+
+	manager.now = func() time.Time { return expiresAt }
+	if removed, err := manager.Prune(ctx, "acme", before, false); err != nil || removed != 2 {
+		t.Fatalf("expected 2 artifacts removed, got %d, %v", removed, err)
+	}
+	for _, artifact := range []*Artifact{old, short} {
+		if _, err := manager.Get(ctx, artifact.ID); err != ErrNotFound {
+			t.Errorf("expected %s removed, got %v", artifact.Name, err)
+		}
+	}
+	if _, err := manager.Get(ctx, kept.ID); err != nil || len(blobs) != 1 {
+		t.Errorf("expected %s kept, got %v", kept.Name, err)
+	}
+}
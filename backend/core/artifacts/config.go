@@ -0,0 +1,42 @@
+package artifacts
+
+import (
+	"os"
+	"time"
+
+	"github.com/spectrumwebco/agent_runtime/backend/core/config/env"
+)
+
+type Config struct {
+	// Bucket is the Supabase storage bucket artifacts are stored in.
+	Bucket string `json:"bucket"`
+	// MaxBytes bounds the size of an artifact.
+	MaxBytes int64 `json:"max_bytes"`
+	// URLTTL is how long a signed download URL is valid.
+	URLTTL time.Duration `json:"url_ttl"`
+	// SigningKey signs download URLs, AGENT_SECRET_KEY if unset.
+	SigningKey string `json:"-"`
+}
+
+const (
+	DefaultBucket   = "artifacts"
+	DefaultMaxBytes = 100 * 1024 * 1024
+	DefaultURLTTL   = 15 * time.Minute
+)
+
+var Default = env.Once(FromEnv)
+
+func FromEnv() Config {
+	config := Config{
+		Bucket:     DefaultBucket,
+		MaxBytes:   DefaultMaxBytes,
+		URLTTL:     DefaultURLTTL,
+		SigningKey: os.Getenv("AGENT_SECRET_KEY"),
+	}
+	read := env.NewReader(artifactsLogger)
+	read.String("AGENT_ARTIFACTS_BUCKET", &config.Bucket)
+	read.Int64("AGENT_ARTIFACTS_MAX_BYTES", &config.MaxBytes, 1)
+	read.PositiveDuration("AGENT_ARTIFACTS_URL_TTL", &config.URLTTL)
+	read.String("AGENT_ARTIFACTS_SIGNING_KEY", &config.SigningKey)
+	return config
+}
@@ -0,0 +1,310 @@
+package artifacts
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/spectrumwebco/agent_runtime/backend/db/integrations"
+)
+
+type Store interface {
+	Create(ctx context.Context, artifact *Artifact) error
+	// Get returns the artifact or ErrNotFound.
+	Get(ctx context.Context, id string) (*Artifact, error)
+	// List returns the artifacts of a run, oldest first.
+	List(ctx context.Context, organizationID, runID string) ([]*Artifact, error)
+	// Expired returns the artifacts of an organization created before
+	// before or whose expiry passed at now.
+	Expired(ctx context.Context, organizationID string, before, now time.Time) ([]*Artifact, error)
+	Delete(ctx context.Context, id string) error
+}
+
+type MemoryStore struct {
+	artifacts map[string]*Artifact
+	mu        sync.Mutex
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{artifacts: make(map[string]*Artifact)}
+}
+
+func (s *MemoryStore) Create(ctx context.Context, artifact *Artifact) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.artifacts[artifact.ID]; ok {
+		return fmt.Errorf("artifact %s already exists", artifact.ID)
+	}
+	s.artifacts[artifact.ID] = copyArtifact(artifact)
+	return nil
+}
+
+func (s *MemoryStore) Get(ctx context.Context, id string) (*Artifact, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	artifact, ok := s.artifacts[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return copyArtifact(artifact), nil
+}
+
+func (s *MemoryStore) List(ctx context.Context, organizationID, runID string) ([]*Artifact, error) {
+	return s.filter(func(artifact *Artifact) bool {
+		return artifact.OrganizationID == organizationID && artifact.RunID == runID
+	}), nil
+}
+
+func (s *MemoryStore) Expired(ctx context.Context, organizationID string, before, now time.Time) ([]*Artifact, error) {
+	return s.filter(func(artifact *Artifact) bool {
+		return artifact.OrganizationID == organizationID &&
+			(artifact.CreatedAt.Before(before) || (artifact.ExpiresAt != nil && !artifact.ExpiresAt.After(now)))
+	}), nil
+}
+
+func (s *MemoryStore) filter(match func(*Artifact) bool) []*Artifact {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	artifacts := []*Artifact{}
+	for _, artifact := range s.artifacts {
+		if match(artifact) {
+			artifacts = append(artifacts, copyArtifact(artifact))
+		}
+	}
+	sort.Slice(artifacts, func(i, j int) bool {
+		return artifacts[i].CreatedAt.Before(artifacts[j].CreatedAt)
+	})
+	return artifacts
+}
+
+func (s *MemoryStore) Delete(ctx context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.artifacts[id]; !ok {
+		return ErrNotFound
+	}
+	delete(s.artifacts, id)
+	return nil
+}
+
+func copyArtifact(artifact *Artifact) *Artifact {
+	copied := *artifact
+	if artifact.Metadata != nil {
+		copied.Metadata = make(map[string]string, len(artifact.Metadata))
+		for key, value := range artifact.Metadata {
+			copied.Metadata[key] = value
+		}
+	}
+	if artifact.ExpiresAt != nil {
+		expiresAt := *artifact.ExpiresAt
+		copied.ExpiresAt = &expiresAt
+	}
+	return &copied
+}
+
+// PostgresStore keeps artifacts in app_artifact, their content is in
+// storage.
+type PostgresStore struct {
+	client integrations.SQLStore
+}
+
+func NewPostgresStore(client integrations.SQLStore) *PostgresStore {
+	return &PostgresStore{client: client}
+}
+
+func (s *PostgresStore) EnsureSchema() error {
+	_, err := s.client.ExecuteUpdate(`
+		CREATE TABLE IF NOT EXISTS app_artifact (
+			id VARCHAR(64) PRIMARY KEY,
+			organization_id VARCHAR(255) NOT NULL,
+			project_id VARCHAR(255) NOT NULL DEFAULT '',
+			run_id VARCHAR(255) NOT NULL,
+			workspace_id VARCHAR(255) NOT NULL DEFAULT '',
+			name VARCHAR(255) NOT NULL,
+			content_type VARCHAR(255) NOT NULL DEFAULT '',
+			size BIGINT NOT NULL,
+			sha256 CHAR(64) NOT NULL,
+			metadata JSONB NOT NULL DEFAULT '{}',
+			path TEXT NOT NULL,
+			created_by VARCHAR(255) NOT NULL DEFAULT '',
+			created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+			expires_at TIMESTAMPTZ
+		);
+		CREATE INDEX IF NOT EXISTS app_artifact_run_idx ON app_artifact (organization_id, run_id, created_at);
+		CREATE INDEX IF NOT EXISTS app_artifact_created_idx ON app_artifact (organization_id, created_at)
+	`)
+	if err != nil {
+		return fmt.Errorf("error creating artifact table: %v", err)
+	}
+	return nil
+}
+
+const artifactColumns = `id, organization_id, project_id, run_id, workspace_id, name, content_type, size, sha256, metadata, path, created_by, created_at, expires_at`
+
+func (s *PostgresStore) Create(ctx context.Context, artifact *Artifact) error {
+	metadata := artifact.Metadata
+	if metadata == nil {
+		metadata = map[string]string{}
+	}
+	encoded, err := json.Marshal(metadata)
+	if err != nil {
+		return err
+	}
+	_, err = s.client.ExecuteUpdate(
+		`INSERT INTO app_artifact (`+artifactColumns+`) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14)`,
+		artifact.ID, artifact.OrganizationID, artifact.ProjectID, artifact.RunID, artifact.WorkspaceID, artifact.Name,
+		artifact.ContentType, artifact.Size, artifact.SHA256, string(encoded), artifact.Path, artifact.CreatedBy,
+		artifact.CreatedAt.UTC(), artifact.ExpiresAt,
+	)
+	if err != nil {
+		return fmt.Errorf("error creating artifact %s: %v", artifact.Name, err)
+	}
+	return nil
+}
+
+func (s *PostgresStore) Get(ctx context.Context, id string) (*Artifact, error) {
+	rows, err := s.client.ExecuteQuery(`SELECT `+artifactColumns+` FROM app_artifact WHERE id = $1`, id)
+	if err != nil {
+		return nil, fmt.Errorf("error loading artifact %s: %v", id, err)
+	}
+	if len(rows) == 0 {
+		return nil, ErrNotFound
+	}
+	return artifactFromRow(rows[0])
+}
+
+func (s *PostgresStore) List(ctx context.Context, organizationID, runID string) ([]*Artifact, error) {
+	rows, err := s.client.ExecuteQuery(
+		`SELECT `+artifactColumns+` FROM app_artifact WHERE organization_id = $1 AND run_id = $2 ORDER BY created_at`,
+		organizationID, runID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("error listing artifacts of run %s: %v", runID, err)
+	}
+	return artifactsFromRows(rows)
+}
+
+func (s *PostgresStore) Expired(ctx context.Context, organizationID string, before, now time.Time) ([]*Artifact, error) {
+	rows, err := s.client.ExecuteQuery(
+		`SELECT `+artifactColumns+` FROM app_artifact
+		WHERE organization_id = $1 AND (created_at < $2 OR expires_at <= $3)
+		ORDER BY created_at`,
+		organizationID, before.UTC(), now.UTC(),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("error listing expired artifacts: %v", err)
+	}
+	return artifactsFromRows(rows)
+}
+
+func (s *PostgresStore) Delete(ctx context.Context, id string) error {
+	updated, err := s.client.ExecuteUpdate(`DELETE FROM app_artifact WHERE id = $1`, id)
+	if err != nil {
+		return fmt.Errorf("error deleting artifact %s: %v", id, err)
+	}
+	if updated == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// ConfigureDefault returns the store of artifact records. If the artifacts
+// table cannot be created the records are kept in memory; the uploaded files
+// stay in storage but are no longer listed after a restart.
+func ConfigureDefault(client integrations.SQLStore) Store {
+	store := NewPostgresStore(client)
+	if err := store.EnsureSchema(); err != nil {
+		artifactsLogger.Printf("Artifacts falling back to in-memory store: %v", err)
+		return NewMemoryStore()
+	}
+	return store
+}
+
+func artifactsFromRows(rows []map[string]interface{}) ([]*Artifact, error) {
+	artifacts := make([]*Artifact, 0, len(rows))
+	for _, row := range rows {
+		artifact, err := artifactFromRow(row)
+		if err != nil {
+			return nil, err
+		}
+		artifacts = append(artifacts, artifact)
+	}
+	return artifacts, nil
+}
+
+func artifactFromRow(row map[string]interface{}) (*Artifact, error) {
+	artifact := &Artifact{
+		ID:             toString(row["id"]),
+		OrganizationID: toString(row["organization_id"]),
+		ProjectID:      toString(row["project_id"]),
+		RunID:          toString(row["run_id"]),
+		WorkspaceID:    toString(row["workspace_id"]),
+		Name:           toString(row["name"]),
+		ContentType:    toString(row["content_type"]),
+		Size:           toInt(row["size"]),
+		SHA256:         toString(row["sha256"]),
+		Path:           toString(row["path"]),
+		CreatedBy:      toString(row["created_by"]),
+	}
+	if createdAt, ok := row["created_at"].(time.Time); ok {
+		artifact.CreatedAt = createdAt.UTC()
+	}
+	if expiresAt, ok := row["expires_at"].(time.Time); ok {
+		expiresAt = expiresAt.UTC()
+		artifact.ExpiresAt = &expiresAt
+	}
+
+	var metadata []byte
+	switch v := row["metadata"].(type) {
+	case []byte:
+		metadata = v
+	case string:
+		metadata = []byte(v)
+	}
+	if len(metadata) > 0 {
+		if err := json.Unmarshal(metadata, &artifact.Metadata); err != nil {
+			return nil, fmt.Errorf("error decoding metadata of artifact %s: %v", artifact.ID, err)
+		}
+	}
+	return artifact, nil
+}
+
+func toString(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case []byte:
+		return string(v)
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+func toInt(value interface{}) int64 {
+	switch v := value.(type) {
+	case int64:
+		return v
+	case int32:
+		return int64(v)
+	case int:
+		return int64(v)
+	case float64:
+		return int64(v)
+	case []byte:
+		parsed, _ := strconv.ParseInt(string(v), 10, 64)
+		return parsed
+	case string:
+		parsed, _ := strconv.ParseInt(v, 10, 64)
+		return parsed
+	default:
+		return 0
+	}
+}
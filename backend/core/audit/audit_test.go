@@ -0,0 +1,58 @@
+package audit
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestChainVerification(t *testing.T) {
+	store := NewMemoryStore()
+	for i, action := range []string{"create", "update", "delete"} {
+		entry := &Entry{
+			Timestamp:    time.Date(2024, 1, 1, 0, 0, i, 0, time.UTC),
+			ActorID:      "user-1",
+			Action:       action,
+			ResourceType: "workspace",
+			ResourceID:   "ws-1",
+		}
+		if err := store.Append(context.Background(), entry); err != nil {
+			t.Fatalf("append: %v", err)
+		}
+	}
+
+	entries, err := store.Query(context.Background(), Filter{})
+	if err != nil {
+		t.Fatalf("query: %v", err)
+	}
+	if _, err := Verify(entries, ""); err != nil {
+		t.Fatalf("expected valid chain, got %v", err)
+	}
+
+	tampered := append([]Entry(nil), entries...)
+	tampered[1].ActorID = "user-2"
+	if seq, err := Verify(tampered, ""); err == nil || seq != 2 {
+		t.Fatalf("expected modification of entry 2 to be detected, got %d %v", seq, err)
+	}
+
+	removed := []Entry{entries[0], entries[2]}
+	if seq, err := Verify(removed, ""); err == nil || seq != 3 {
+		t.Fatalf("expected removal of entry 2 to be detected, got %d %v", seq, err)
+	}
+}
+
+func TestDiffRedactsSensitiveFields(t *testing.T) {
+	before := map[string]interface{}{"name": "a", "password": "old", "size": 1}
+	after := map[string]interface{}{"name": "b", "password": "new", "size": 1}
+
+	changes, err := Diff(before, after)
+	if err != nil {
+		t.Fatalf("diff: %v", err)
+	}
+	if len(changes) != 2 || changes[0].Field != "name" || changes[1].Field != "password" {
+		t.Fatalf("expected name and password to change, got %+v", changes)
+	}
+	if changes[1].Before != redacted || changes[1].After != redacted {
+		t.Fatalf("expected password values to be redacted, got %+v", changes[1])
+	}
+}
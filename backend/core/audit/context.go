@@ -0,0 +1,108 @@
+package audit
+
+import (
+	"context"
+	"sync"
+)
+
+// Recorder collects details about a request that only the handler knows, such
+// as the resource it touched and its state before and after the change. The
+// audit middleware attaches one to every mutating request.
+type Recorder struct {
+	resourceType string
+	resourceID   string
+	action       string
+	before       interface{}
+	after        interface{}
+	metadata     map[string]interface{}
+	skip         bool
+	mu           sync.Mutex
+}
+
+type recorderKey struct{}
+
+func WithRecorder(ctx context.Context, recorder *Recorder) context.Context {
+	return context.WithValue(ctx, recorderKey{}, recorder)
+}
+
+// FromContext returns the request's Recorder. It returns a detached Recorder
+// when the request is not audited so callers never need to nil-check.
+func FromContext(ctx context.Context) *Recorder {
+	if recorder, ok := ctx.Value(recorderKey{}).(*Recorder); ok {
+		return recorder
+	}
+	return &Recorder{}
+}
+
+func (r *Recorder) SetResource(resourceType, resourceID string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.resourceType = resourceType
+	r.resourceID = resourceID
+}
+
+// SetAction overrides the action derived from the HTTP method.
+func (r *Recorder) SetAction(action string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.action = action
+}
+
+func (r *Recorder) SetChange(before, after interface{}) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.before = before
+	r.after = after
+}
+
+func (r *Recorder) AddMetadata(key string, value interface{}) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.metadata == nil {
+		r.metadata = map[string]interface{}{}
+	}
+	r.metadata[key] = value
+}
+
+// Skip suppresses the audit entry for this request.
+func (r *Recorder) Skip() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.skip = true
+}
+
+// Apply copies the recorded details onto entry. It reports false if the
+// request asked to be skipped.
+func (r *Recorder) Apply(entry *Entry) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.skip {
+		return false, nil
+	}
+	if r.resourceType != "" {
+		entry.ResourceType = r.resourceType
+	}
+	if r.resourceID != "" {
+		entry.ResourceID = r.resourceID
+	}
+	if r.action != "" {
+		entry.Action = r.action
+	}
+	if len(r.metadata) > 0 {
+		entry.Metadata = r.metadata
+	}
+	if r.before != nil || r.after != nil {
+		changes, err := Diff(r.before, r.after)
+		if err != nil {
+			return true, err
+		}
+		entry.Changes = changes
+	}
+	return true, nil
+}
@@ -0,0 +1,93 @@
+package audit
+
+import (
+	"encoding/json"
+	"reflect"
+	"sort"
+)
+
+// Change is a single field that differs between the before and after state of
+// a resource.
+type Change struct {
+	Field  string      `json:"field"`
+	Before interface{} `json:"before,omitempty"`
+	After  interface{} `json:"after,omitempty"`
+}
+
+// Diff compares the JSON representations of before and after and returns
+// the top-level fields that changed, sorted by name. Either side may be nil
+// for creations and deletions.
+func Diff(before, after interface{}) ([]Change, error) {
+	beforeFields, err := toFields(before)
+	if err != nil {
+		return nil, err
+	}
+	afterFields, err := toFields(after)
+	if err != nil {
+		return nil, err
+	}
+
+	names := map[string]bool{}
+	for name := range beforeFields {
+		names[name] = true
+	}
+	for name := range afterFields {
+		names[name] = true
+	}
+
+	changes := []Change{}
+	for name := range names {
+		b, a := beforeFields[name], afterFields[name]
+		if reflect.DeepEqual(b, a) {
+			continue
+		}
+		if sensitiveFields[name] {
+			b, a = redact(b), redact(a)
+		}
+		changes = append(changes, Change{Field: name, Before: b, After: a})
+	}
+
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].Field < changes[j].Field
+	})
+	return changes, nil
+}
+
+// sensitiveFields are reported as changed but their values are never written
+// to the audit log.
+var sensitiveFields = map[string]bool{
+	"password":      true,
+	"secret":        true,
+	"token":         true,
+	"value":         true,
+	"api_key":       true,
+	"key":           true,
+	"refresh_token": true,
+	"access_token":  true,
+}
+
+const redacted = "[REDACTED]"
+
+func toFields(v interface{}) (map[string]interface{}, error) {
+	if v == nil {
+		return map[string]interface{}{}, nil
+	}
+
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+
+	fields := map[string]interface{}{}
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, err
+	}
+	return fields, nil
+}
+
+func redact(value interface{}) interface{} {
+	if value == nil {
+		return nil
+	}
+	return redacted
+}
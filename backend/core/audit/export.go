@@ -0,0 +1,64 @@
+package audit
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"strconv"
+	"time"
+)
+
+var csvHeader = []string{
+	"sequence", "timestamp", "actor_id", "action", "resource_type", "resource_id",
+	"method", "path", "status_code", "ip_address", "user_agent", "request_id",
+	"changes", "prev_hash", "hash",
+}
+
+func WriteCSV(w io.Writer, entries []Entry) error {
+	writer := csv.NewWriter(w)
+	if err := writer.Write(csvHeader); err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		changes, err := json.Marshal(entry.Changes)
+		if err != nil {
+			return err
+		}
+
+		if err := writer.Write([]string{
+			strconv.FormatInt(entry.Sequence, 10),
+			entry.Timestamp.Format(time.RFC3339Nano),
+			entry.ActorID,
+			entry.Action,
+			entry.ResourceType,
+			entry.ResourceID,
+			entry.Method,
+			entry.Path,
+			strconv.Itoa(entry.StatusCode),
+			entry.IPAddress,
+			entry.UserAgent,
+			entry.RequestID,
+			string(changes),
+			entry.PrevHash,
+			entry.Hash,
+		}); err != nil {
+			return err
+		}
+	}
+
+	writer.Flush()
+	return writer.Error()
+}
+
+// WriteJSONLines writes one JSON object per line. The output keeps every
+// field needed to re-run Verify offline.
+func WriteJSONLines(w io.Writer, entries []Entry) error {
+	encoder := json.NewEncoder(w)
+	for _, entry := range entries {
+		if err := encoder.Encode(entry); err != nil {
+			return err
+		}
+	}
+	return nil
+}
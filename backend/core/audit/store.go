@@ -0,0 +1,393 @@
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/spectrumwebco/agent_runtime/backend/db/integrations"
+)
+
+type Filter struct {
+	ActorID      string
+	Action       string
+	ResourceType string
+	ResourceID   string
+	RequestID    string
+	Since        time.Time
+	Until        time.Time
+	// AfterSequence returns entries with a greater sequence, for paging.
+	AfterSequence int64
+	Limit         int
+}
+
+func (f Filter) matches(e Entry) bool {
+	return (f.ActorID == "" || e.ActorID == f.ActorID) &&
+		(f.Action == "" || e.Action == f.Action) &&
+		(f.ResourceType == "" || e.ResourceType == f.ResourceType) &&
+		(f.ResourceID == "" || e.ResourceID == f.ResourceID) &&
+		(f.RequestID == "" || e.RequestID == f.RequestID) &&
+		(f.Since.IsZero() || !e.Timestamp.Before(f.Since)) &&
+		(f.Until.IsZero() || e.Timestamp.Before(f.Until)) &&
+		e.Sequence > f.AfterSequence
+}
+
+const (
+	DefaultQueryLimit = 100
+	MaxQueryLimit     = 10000
+)
+
+func (f Filter) limit() int {
+	if f.Limit <= 0 {
+		return DefaultQueryLimit
+	}
+	if f.Limit > MaxQueryLimit {
+		return MaxQueryLimit
+	}
+	return f.Limit
+}
+
+type Store interface {
+	// Append seals entry onto the end of the chain and stores it.
+	Append(ctx context.Context, entry *Entry) error
+	// Query returns matching entries in sequence order.
+	Query(ctx context.Context, filter Filter) ([]Entry, error)
+}
+
+type MemoryStore struct {
+	entries []Entry
+	mu      sync.Mutex
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{}
+}
+
+func (s *MemoryStore) Append(ctx context.Context, entry *Entry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	prevHash := GenesisHash
+	if len(s.entries) > 0 {
+		prevHash = s.entries[len(s.entries)-1].Hash
+	}
+	if err := entry.Seal(prevHash); err != nil {
+		return err
+	}
+	entry.Sequence = int64(len(s.entries) + 1)
+	s.entries = append(s.entries, *entry)
+	return nil
+}
+
+func (s *MemoryStore) Query(ctx context.Context, filter Filter) ([]Entry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	result := []Entry{}
+	for _, entry := range s.entries {
+		if filter.matches(entry) {
+			result = append(result, entry)
+			if len(result) == filter.limit() {
+				break
+			}
+		}
+	}
+	return result, nil
+}
+
+// PostgresStore keeps the chain in the app_audit_log table. The table rejects
+// UPDATE and DELETE, and the unique constraint on prev_hash guarantees that
+// concurrent writers on different replicas cannot fork the chain: the loser
+// of a race gets a constraint violation and retries on top of the new tip.
+type PostgresStore struct {
+	store integrations.SQLStore
+	mu    sync.Mutex
+}
+
+func NewPostgresStore(store integrations.SQLStore) *PostgresStore {
+	return &PostgresStore{store: store}
+}
+
+func (s *PostgresStore) EnsureSchema() error {
+	_, err := s.store.ExecuteUpdate(`
+CREATE TABLE IF NOT EXISTS app_audit_log (
+	sequence BIGSERIAL PRIMARY KEY,
+	timestamp TIMESTAMPTZ NOT NULL,
+	actor_id VARCHAR(255) NOT NULL,
+	action VARCHAR(64) NOT NULL,
+	resource_type VARCHAR(255) NOT NULL,
+	resource_id VARCHAR(255) NOT NULL,
+	method VARCHAR(16) NOT NULL,
+	path TEXT NOT NULL,
+	status_code INTEGER NOT NULL,
+	ip_address VARCHAR(64) NOT NULL,
+	user_agent TEXT NOT NULL,
+	request_id VARCHAR(255) NOT NULL,
+	changes JSONB NOT NULL DEFAULT '[]',
+	metadata JSONB NOT NULL DEFAULT '{}',
+	prev_hash CHAR(64) NOT NULL UNIQUE,
+	hash CHAR(64) NOT NULL UNIQUE
+);
+CREATE INDEX IF NOT EXISTS app_audit_log_actor ON app_audit_log (actor_id, timestamp);
+CREATE INDEX IF NOT EXISTS app_audit_log_resource ON app_audit_log (resource_type, resource_id, timestamp);
+CREATE INDEX IF NOT EXISTS app_audit_log_request ON app_audit_log (request_id);
+CREATE OR REPLACE FUNCTION app_audit_log_append_only() RETURNS trigger AS $$
+BEGIN
+	IF TG_OP = 'DELETE' AND current_setting('kled.audit_prune', true) = 'on' THEN
+		RETURN NULL;
+	END IF;
+	RAISE EXCEPTION 'app_audit_log is append-only';
+END;
+$$ LANGUAGE plpgsql;
+DROP TRIGGER IF EXISTS app_audit_log_append_only ON app_audit_log;
+CREATE TRIGGER app_audit_log_append_only BEFORE UPDATE OR DELETE OR TRUNCATE ON app_audit_log
+	FOR EACH STATEMENT EXECUTE FUNCTION app_audit_log_append_only();`)
+	if err != nil {
+		return fmt.Errorf("error creating audit log table: %v", err)
+	}
+	return nil
+}
+
+const appendRetries = 5
+
+func (s *PostgresStore) Append(ctx context.Context, entry *Entry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	changes, err := json.Marshal(entry.Changes)
+	if err != nil {
+		return fmt.Errorf("error encoding audit changes: %v", err)
+	}
+	metadata, err := json.Marshal(entry.Metadata)
+	if err != nil {
+		return fmt.Errorf("error encoding audit metadata: %v", err)
+	}
+
+	var lastErr error
+	for attempt := 0; attempt < appendRetries; attempt++ {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		prevHash, err := s.tip()
+		if err != nil {
+			return err
+		}
+		if err := entry.Seal(prevHash); err != nil {
+			return err
+		}
+
+		rows, err := s.store.ExecuteQuery(`
+INSERT INTO app_audit_log (timestamp, actor_id, action, resource_type, resource_id, method, path, status_code, ip_address, user_agent, request_id, changes, metadata, prev_hash, hash)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15)
+RETURNING sequence`,
+			entry.Timestamp, entry.ActorID, entry.Action, entry.ResourceType, entry.ResourceID,
+			entry.Method, entry.Path, entry.StatusCode, entry.IPAddress, entry.UserAgent, entry.RequestID,
+			string(changes), string(metadata), entry.PrevHash, entry.Hash,
+		)
+		if err != nil {
+			if strings.Contains(err.Error(), "app_audit_log_prev_hash_key") {
+				lastErr = err
+				continue
+			}
+			return fmt.Errorf("error appending audit entry: %v", err)
+		}
+		if len(rows) > 0 {
+			entry.Sequence = toInt64(rows[0]["sequence"])
+		}
+		return nil
+	}
+
+	return fmt.Errorf("error appending audit entry after %d attempts: %v", appendRetries, lastErr)
+}
+
+func (s *PostgresStore) tip() (string, error) {
+	rows, err := s.store.ExecuteQuery(`SELECT hash FROM app_audit_log ORDER BY sequence DESC LIMIT 1`)
+	if err != nil {
+		return "", fmt.Errorf("error reading audit chain tip: %v", err)
+	}
+	if len(rows) == 0 {
+		return GenesisHash, nil
+	}
+	return strings.TrimSpace(fmt.Sprint(rows[0]["hash"])), nil
+}
+
+// Prune deletes the entries older than before, or only counts them if
+// dryRun is set. Entries are only removed from the start of the chain and the
+// tip is always kept, so the rest still verifies from the prev_hash of its
+// first entry. Deletes bypass the append-only trigger through the
+// kled.audit_prune setting, which is local to the pruning transaction.
+func (s *PostgresStore) Prune(ctx context.Context, before time.Time, dryRun bool) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	rows, err := s.store.ExecuteQuery(`
+SELECT COALESCE(
+	(SELECT MIN(sequence) FROM app_audit_log WHERE timestamp >= $1),
+	(SELECT MAX(sequence) FROM app_audit_log),
+	0) AS boundary`, before.UTC())
+	if err != nil {
+		return 0, fmt.Errorf("error finding audit entries to prune: %v", err)
+	}
+	if len(rows) == 0 {
+		return 0, nil
+	}
+	boundary := toInt64(rows[0]["boundary"])
+
+	rows, err = s.store.ExecuteQuery(`SELECT COUNT(*) AS count FROM app_audit_log WHERE sequence < $1`, boundary)
+	if err != nil {
+		return 0, fmt.Errorf("error counting audit entries to prune: %v", err)
+	}
+	count := int64(0)
+	if len(rows) > 0 {
+		count = toInt64(rows[0]["count"])
+	}
+	if dryRun || count == 0 {
+		return count, nil
+	}
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	// SET LOCAL needs a transaction, so the statements run as one batch. The
+	// boundary is an integer we just read, never user input.
+	_, err = s.store.ExecuteUpdate(fmt.Sprintf(`
+BEGIN;
+SET LOCAL kled.audit_prune = 'on';
+DELETE FROM app_audit_log WHERE sequence < %d;
+COMMIT;`, boundary))
+	if err != nil {
+		return 0, fmt.Errorf("error pruning audit entries: %v", err)
+	}
+	return count, nil
+}
+
+func (s *PostgresStore) Query(ctx context.Context, filter Filter) ([]Entry, error) {
+	conditions := []string{"sequence > $1"}
+	params := []interface{}{filter.AfterSequence}
+	add := func(condition string, value interface{}) {
+		params = append(params, value)
+		conditions = append(conditions, fmt.Sprintf(condition, len(params)))
+	}
+
+	if filter.ActorID != "" {
+		add("actor_id = $%d", filter.ActorID)
+	}
+	if filter.Action != "" {
+		add("action = $%d", filter.Action)
+	}
+	if filter.ResourceType != "" {
+		add("resource_type = $%d", filter.ResourceType)
+	}
+	if filter.ResourceID != "" {
+		add("resource_id = $%d", filter.ResourceID)
+	}
+	if filter.RequestID != "" {
+		add("request_id = $%d", filter.RequestID)
+	}
+	if !filter.Since.IsZero() {
+		add("timestamp >= $%d", filter.Since)
+	}
+	if !filter.Until.IsZero() {
+		add("timestamp < $%d", filter.Until)
+	}
+
+	query := fmt.Sprintf(`SELECT * FROM app_audit_log WHERE %s ORDER BY sequence ASC LIMIT %d`, strings.Join(conditions, " AND "), filter.limit())
+	rows, err := s.store.ExecuteQuery(query, params...)
+	if err != nil {
+		return nil, fmt.Errorf("error querying audit log: %v", err)
+	}
+
+	entries := make([]Entry, 0, len(rows))
+	for _, row := range rows {
+		entry := Entry{
+			Sequence:     toInt64(row["sequence"]),
+			ActorID:      fmt.Sprint(row["actor_id"]),
+			Action:       fmt.Sprint(row["action"]),
+			ResourceType: fmt.Sprint(row["resource_type"]),
+			ResourceID:   fmt.Sprint(row["resource_id"]),
+			Method:       fmt.Sprint(row["method"]),
+			Path:         fmt.Sprint(row["path"]),
+			StatusCode:   int(toInt64(row["status_code"])),
+			IPAddress:    fmt.Sprint(row["ip_address"]),
+			UserAgent:    fmt.Sprint(row["user_agent"]),
+			RequestID:    fmt.Sprint(row["request_id"]),
+			PrevHash:     strings.TrimSpace(fmt.Sprint(row["prev_hash"])),
+			Hash:         strings.TrimSpace(fmt.Sprint(row["hash"])),
+		}
+		if timestamp, ok := row["timestamp"].(time.Time); ok {
+			entry.Timestamp = timestamp.UTC()
+		}
+		if err := decodeJSONColumn(row["changes"], &entry.Changes); err != nil {
+			return nil, err
+		}
+		if err := decodeJSONColumn(row["metadata"], &entry.Metadata); err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+func decodeJSONColumn(value interface{}, target interface{}) error {
+	var data []byte
+	switch v := value.(type) {
+	case nil:
+		return nil
+	case []byte:
+		data = v
+	case string:
+		data = []byte(v)
+	default:
+		return fmt.Errorf("unexpected JSON column type %T", value)
+	}
+	if len(data) == 0 {
+		return nil
+	}
+	return json.Unmarshal(data, target)
+}
+
+func toInt64(value interface{}) int64 {
+	switch v := value.(type) {
+	case int64:
+		return v
+	case int:
+		return int64(v)
+	case int32:
+		return int64(v)
+	case float64:
+		return int64(v)
+	case []byte:
+		var n int64
+		fmt.Sscan(string(v), &n)
+		return n
+	case string:
+		var n int64
+		fmt.Sscan(v, &n)
+		return n
+	default:
+		return 0
+	}
+}
+
+var (
+	defaultStore   Store = NewMemoryStore()
+	defaultStoreMu sync.RWMutex
+)
+
+func SetDefaultStore(store Store) {
+	defaultStoreMu.Lock()
+	defer defaultStoreMu.Unlock()
+
+	defaultStore = store
+}
+
+func DefaultStore() Store {
+	defaultStoreMu.RLock()
+	defer defaultStoreMu.RUnlock()
+
+	return defaultStore
+}
@@ -0,0 +1,196 @@
+// Package autoscale exports the load signals replicas are scaled by and
+// suggests replica counts from them.
+//
+// A Sampler measures every signal each interval and exports it as the
+// gauge kled_autoscale_signal{signal}, for the Prometheus adapter of the
+// HPA or the prometheus scaler of KEDA. The latest values are also served
+// as JSON for the metrics-api scaler of KEDA. The Sampler keeps the samples
+// of a window, and Advise suggests the replicas that would serve the peak
+// of the window at the target load per replica of each signal.
+package autoscale
+
+import (
+	"context"
+	"log"
+	"math"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var autoscaleLogger = log.New(os.Stdout, "kled.autoscale: ", log.LstdFlags)
+
+var signalGauge = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+	Name: "kled_autoscale_signal",
+	Help: "Load signals to scale replicas by, by signal.",
+}, []string{"signal"})
+
+func init() {
+	prometheus.MustRegister(signalGauge)
+}
+
+// The signals sampled by the backend.
+const (
+	// SignalPendingWorkspaces is the workspace containers being created.
+	SignalPendingWorkspaces = "pending_workspaces"
+	// SignalQueueDepth is the runs waiting for an interpreter.
+	SignalQueueDepth = "queue_depth"
+	// SignalInterpreterSessions is the runs executing in an interpreter.
+	SignalInterpreterSessions = "interpreter_sessions"
+)
+
+// Source measures a signal.
+type Source func(ctx context.Context) (float64, error)
+
+type Sample struct {
+	At    time.Time `json:"at"`
+	Value float64   `json:"value"`
+}
+
+// Sampler measures its sources every interval and keeps the samples of a
+// window.
+type Sampler struct {
+	config  Config
+	sources map[string]Source
+	history map[string][]Sample
+	now     func() time.Time
+	mu      sync.RWMutex
+}
+
+func NewSampler(config Config) *Sampler {
+	return &Sampler{
+		config:  config,
+		sources: make(map[string]Source),
+		history: make(map[string][]Sample),
+		now:     time.Now,
+	}
+}
+
+func (s *Sampler) SetClock(now func() time.Time) {
+	s.now = now
+}
+
+// Add adds a source. It is called before the Sampler runs.
+func (s *Sampler) Add(signal string, source Source) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.sources[signal] = source
+}
+
+// Sample measures every source once. A source that fails is logged and
+// keeps its previous samples.
+func (s *Sampler) Sample(ctx context.Context) {
+	s.mu.RLock()
+	sources := make(map[string]Source, len(s.sources))
+	for signal, source := range s.sources {
+		sources[signal] = source
+	}
+	s.mu.RUnlock()
+
+	for signal, source := range sources {
+		value, err := source(ctx)
+		if err != nil {
+			autoscaleLogger.Printf("Error measuring %s: %v", signal, err)
+			continue
+		}
+		signalGauge.WithLabelValues(signal).Set(value)
+
+		now := s.now()
+		s.mu.Lock()
+		samples := append(s.history[signal], Sample{At: now, Value: value})
+		cutoff := now.Add(-s.config.Window)
+		for len(samples) > 1 && samples[0].At.Before(cutoff) {
+			samples = samples[1:]
+		}
+		s.history[signal] = samples
+		s.mu.Unlock()
+	}
+}
+
+// Run samples every interval until ctx is done.
+func (s *Sampler) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.config.Interval)
+	defer ticker.Stop()
+
+	for {
+		s.Sample(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Current returns the latest value of every signal sampled.
+func (s *Sampler) Current() map[string]float64 {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	current := make(map[string]float64, len(s.history))
+	for signal, samples := range s.history {
+		current[signal] = samples[len(samples)-1].Value
+	}
+	return current
+}
+
+// Advice is the replicas suggested by a signal.
+type Advice struct {
+	Signal  string  `json:"signal"`
+	Current float64 `json:"current"`
+	// Peak is the highest value of the window.
+	Peak             float64 `json:"peak"`
+	TargetPerReplica float64 `json:"target_per_replica"`
+	Replicas         int     `json:"replicas"`
+}
+
+// Advise suggests replicas for every signal with a target, ordered by
+// signal, and the replicas serving all of them: the highest suggestion.
+// Scaling to the peak of the window rather than the latest value keeps
+// replicas from being removed between bursts.
+func (s *Sampler) Advise() ([]Advice, int) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	advice := []Advice{}
+	replicas := s.config.MinReplicas
+	cutoff := s.now().Add(-s.config.Window)
+	for signal, samples := range s.history {
+		target := s.config.Targets[signal]
+		if target <= 0 {
+			continue
+		}
+		// samples of a failing source age out too, down to its last value
+		peak := samples[len(samples)-1].Value
+		for _, sample := range samples {
+			if !sample.At.Before(cutoff) {
+				peak = math.Max(peak, sample.Value)
+			}
+		}
+		suggested := int(math.Ceil(peak / target))
+		if suggested < s.config.MinReplicas {
+			suggested = s.config.MinReplicas
+		}
+		if suggested > s.config.MaxReplicas {
+			suggested = s.config.MaxReplicas
+		}
+		advice = append(advice, Advice{
+			Signal:           signal,
+			Current:          samples[len(samples)-1].Value,
+			Peak:             peak,
+			TargetPerReplica: target,
+			Replicas:         suggested,
+		})
+		if suggested > replicas {
+			replicas = suggested
+		}
+	}
+	sort.Slice(advice, func(i, j int) bool {
+		return advice[i].Signal < advice[j].Signal
+	})
+	return advice, replicas
+}
@@ -0,0 +1,48 @@
+package autoscale
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestAdviseScalesToThePeakOfTheWindow(t *testing.T) {
+	now := time.Now()
+	sampler := NewSampler(Config{
+		Window:      time.Minute,
+		Targets:     map[string]float64{SignalQueueDepth: 10, SignalInterpreterSessions: 20},
+		MinReplicas: 1,
+		MaxReplicas: 5,
+	})
+	sampler.SetClock(func() time.Time { return now })
+
+	depth, sessions := 0.0, 0.0
+	var sessionsErr error
+	sampler.Add(SignalQueueDepth, func(context.Context) (float64, error) { return depth, nil })
+	sampler.Add(SignalInterpreterSessions, func(context.Context) (float64, error) { return sessions, sessionsErr })
+
+	for _, step := range []struct{ depth, sessions float64 }{{25, 10}, {5, 30}, {0, 15}} {
+		depth, sessions = step.depth, step.sessions
+		sampler.Sample(context.Background())
+		now = now.Add(20 * time.Second)
+	}
+	if current := sampler.Current(); current[SignalQueueDepth] != 0 || current[SignalInterpreterSessions] != 15 {
+		t.Errorf("unexpected current signals %v", current)
+	}
+	advice, replicas := sampler.Advise()
+	if len(advice) != 2 || advice[0].Signal != SignalInterpreterSessions || advice[0].Peak != 30 || advice[0].Replicas != 2 ||
+		advice[1].Peak != 25 || advice[1].Replicas != 3 || replicas != 3 {
+		t.Fatalf("unexpected advice %+v and %d replicas", advice, replicas)
+	}
+
+	// the peak leaves the window, and failed samples keep the last value
+	sessionsErr = errors.New("unavailable")
+	depth = 100
+	now = now.Add(30 * time.Second)
+	sampler.Sample(context.Background())
+	advice, replicas = sampler.Advise()
+	if advice[0].Peak != 15 || advice[0].Replicas != 1 || advice[1].Replicas != 5 || replicas != 5 {
+		t.Errorf("unexpected advice %+v and %d replicas", advice, replicas)
+	}
+}
@@ -0,0 +1,69 @@
+package autoscale
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/spectrumwebco/agent_runtime/backend/core/config/env"
+)
+
+type Config struct {
+	// Interval is the time between samples.
+	Interval time.Duration `json:"interval"`
+	// Window is how far back the advisor looks for the peak of a signal.
+	Window time.Duration `json:"window"`
+	// Targets is the load of each signal one replica is meant to serve.
+	// Signals without a target aren't advised on.
+	Targets     map[string]float64 `json:"targets"`
+	MinReplicas int                `json:"min_replicas"`
+	MaxReplicas int                `json:"max_replicas"`
+}
+
+const (
+	DefaultInterval    = 15 * time.Second
+	DefaultWindow      = 5 * time.Minute
+	DefaultMinReplicas = 1
+	DefaultMaxReplicas = 20
+)
+
+// DefaultTargets are the load per replica of the signals of the backend.
+func DefaultTargets() map[string]float64 {
+	return map[string]float64{
+		SignalPendingWorkspaces:   5,
+		SignalQueueDepth:          10,
+		SignalInterpreterSessions: 20,
+	}
+}
+
+var Default = env.Once(FromEnv)
+
+// FromEnv reads the configuration from the environment.
+// AGENT_AUTOSCALE_TARGETS holds comma separated signal=target pairs
+// overriding the default targets.
+func FromEnv() Config {
+	config := Config{
+		Interval:    DefaultInterval,
+		Window:      DefaultWindow,
+		Targets:     DefaultTargets(),
+		MinReplicas: DefaultMinReplicas,
+		MaxReplicas: DefaultMaxReplicas,
+	}
+	read := env.NewReader(autoscaleLogger)
+	read.PositiveDuration("AGENT_AUTOSCALE_INTERVAL", &config.Interval)
+	read.PositiveDuration("AGENT_AUTOSCALE_WINDOW", &config.Window)
+	read.Int("AGENT_AUTOSCALE_MIN_REPLICAS", &config.MinReplicas, 1)
+	read.Int("AGENT_AUTOSCALE_MAX_REPLICAS", &config.MaxReplicas, 1)
+	if config.MaxReplicas < config.MinReplicas {
+		autoscaleLogger.Printf("AGENT_AUTOSCALE_MAX_REPLICAS must be at least AGENT_AUTOSCALE_MIN_REPLICAS, using %d", config.MinReplicas)
+		config.MaxReplicas = config.MinReplicas
+	}
+	read.Pairs("AGENT_AUTOSCALE_TARGETS", "signal=target pairs with non-negative targets", func(signal, value string) bool {
+		target, err := strconv.ParseFloat(value, 64)
+		if err != nil || target < 0 {
+			return false
+		}
+		config.Targets[signal] = target
+		return true
+	})
+	return config
+}
@@ -0,0 +1,43 @@
+package autoscale
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	"github.com/spectrumwebco/agent_runtime/backend/core/reconcile"
+	"github.com/spectrumwebco/agent_runtime/backend/core/runs"
+	"github.com/spectrumwebco/agent_runtime/backend/db/integrations"
+)
+
+// RunsInState counts the runs of all tenants in a state.
+func RunsInState(store integrations.SQLStore, state runs.State) Source {
+	return func(ctx context.Context) (float64, error) {
+		rows, err := store.ExecuteQuery(`SELECT COUNT(*) AS count FROM app_agent_run WHERE state = $1`, string(state))
+		if err != nil {
+			return 0, fmt.Errorf("error counting %s runs: %v", state, err)
+		}
+		if len(rows) == 0 {
+			return 0, nil
+		}
+		return strconv.ParseFloat(fmt.Sprint(rows[0]["count"]), 64)
+	}
+}
+
+// PendingContainers counts the workspace containers the driver is still
+// creating.
+func PendingContainers(driver reconcile.Driver) Source {
+	return func(ctx context.Context) (float64, error) {
+		containers, err := driver.Containers(ctx)
+		if err != nil {
+			return 0, err
+		}
+		pending := 0
+		for _, container := range containers {
+			if container.State == reconcile.ContainerPending {
+				pending++
+			}
+		}
+		return float64(pending), nil
+	}
+}
@@ -0,0 +1,223 @@
+package backup
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path"
+	"time"
+)
+
+var backupLogger = log.New(os.Stdout, "kled.backup: ", log.LstdFlags)
+
+// ManifestVersion is bumped whenever the layout of a backup changes in a way
+// older restores can't read.
+const ManifestVersion = 1
+
+const manifestFile = "manifest.json"
+
+// Source is a piece of backend state that is part of a backup. Export and
+// Import must round trip: importing the exported data restores the state.
+type Source interface {
+	// Name identifies the artifact in the manifest and must be stable
+	// across releases.
+	Name() string
+	Export(ctx context.Context) ([]byte, error)
+	Import(ctx context.Context, data []byte) error
+}
+
+// Storage persists backup artifacts under slash separated paths.
+type Storage interface {
+	Put(path string, data []byte, contentType string) error
+	Get(path string) ([]byte, error)
+}
+
+// Artifact describes one exported Source in a manifest.
+type Artifact struct {
+	Name   string `json:"name"`
+	Path   string `json:"path"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+// Manifest is written last, so a backup without one is incomplete and is
+// never restored.
+type Manifest struct {
+	Version   int        `json:"version"`
+	ID        string     `json:"id"`
+	CreatedAt time.Time  `json:"created_at"`
+	Artifacts []Artifact `json:"artifacts"`
+}
+
+// Artifact returns the artifact called name, or nil if the backup doesn't
+// contain it.
+func (m *Manifest) Artifact(name string) *Artifact {
+	for i := range m.Artifacts {
+		if m.Artifacts[i].Name == name {
+			return &m.Artifacts[i]
+		}
+	}
+	return nil
+}
+
+// Verify checks data against the size and checksum recorded for a.
+func (a Artifact) Verify(data []byte) error {
+	if int64(len(data)) != a.Size {
+		return fmt.Errorf("artifact %s: size is %d, manifest says %d", a.Name, len(data), a.Size)
+	}
+	if sum := checksum(data); sum != a.SHA256 {
+		return fmt.Errorf("artifact %s: sha256 is %s, manifest says %s", a.Name, sum, a.SHA256)
+	}
+	return nil
+}
+
+func checksum(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// NewID returns a backup id that sorts by creation time.
+func NewID(now time.Time) string {
+	return now.UTC().Format("20060102T150405Z")
+}
+
+// Manager creates and restores backups of Sources in a Storage under
+// Prefix/<id>/.
+type Manager struct {
+	Storage Storage
+	Sources []Source
+	// Prefix is the directory backups are stored in. Defaults to "backups".
+	Prefix string
+
+	now func() time.Time
+}
+
+func NewManager(storage Storage, sources ...Source) *Manager {
+	return &Manager{
+		Storage: storage,
+		Sources: sources,
+		Prefix:  "backups",
+		now:     time.Now,
+	}
+}
+
+func (m *Manager) dir(id string) string {
+	return path.Join(m.Prefix, id)
+}
+
+// Create exports every source and uploads it, then uploads the manifest.
+// Any failure aborts the backup before the manifest is written.
+func (m *Manager) Create(ctx context.Context) (*Manifest, error) {
+	createdAt := m.now().UTC()
+	manifest := &Manifest{
+		Version:   ManifestVersion,
+		ID:        NewID(createdAt),
+		CreatedAt: createdAt,
+		Artifacts: []Artifact{},
+	}
+
+	for _, source := range m.Sources {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		data, err := source.Export(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("export %s: %w", source.Name(), err)
+		}
+
+		artifact := Artifact{
+			Name:   source.Name(),
+			Path:   path.Join(m.dir(manifest.ID), source.Name()),
+			Size:   int64(len(data)),
+			SHA256: checksum(data),
+		}
+		if err := m.Storage.Put(artifact.Path, data, "application/octet-stream"); err != nil {
+			return nil, fmt.Errorf("upload %s: %w", source.Name(), err)
+		}
+		backupLogger.Printf("Backed up %s (%d bytes)", artifact.Name, artifact.Size)
+		manifest.Artifacts = append(manifest.Artifacts, artifact)
+	}
+
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	if err := m.Storage.Put(path.Join(m.dir(manifest.ID), manifestFile), data, "application/json"); err != nil {
+		return nil, fmt.Errorf("upload manifest: %w", err)
+	}
+
+	return manifest, nil
+}
+
+// Manifest downloads the manifest of backup id.
+func (m *Manager) Manifest(id string) (*Manifest, error) {
+	data, err := m.Storage.Get(path.Join(m.dir(id), manifestFile))
+	if err != nil {
+		return nil, fmt.Errorf("download manifest of backup %s: %w", id, err)
+	}
+
+	var manifest Manifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return nil, fmt.Errorf("parse manifest of backup %s: %w", id, err)
+	}
+	if manifest.Version > ManifestVersion {
+		return nil, fmt.Errorf("backup %s has manifest version %d, this release reads up to %d", id, manifest.Version, ManifestVersion)
+	}
+	return &manifest, nil
+}
+
+// Verify downloads every artifact of backup id and checks it against the
+// manifest. It returns the verified artifact data by name.
+func (m *Manager) Verify(ctx context.Context, id string) (*Manifest, map[string][]byte, error) {
+	manifest, err := m.Manifest(id)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	artifacts := make(map[string][]byte, len(manifest.Artifacts))
+	for _, artifact := range manifest.Artifacts {
+		if err := ctx.Err(); err != nil {
+			return nil, nil, err
+		}
+
+		data, err := m.Storage.Get(artifact.Path)
+		if err != nil {
+			return nil, nil, fmt.Errorf("download %s: %w", artifact.Name, err)
+		}
+		if err := artifact.Verify(data); err != nil {
+			return nil, nil, err
+		}
+		artifacts[artifact.Name] = data
+	}
+
+	return manifest, artifacts, nil
+}
+
+// Restore verifies the whole of backup id before importing anything, then
+// imports the artifacts of the configured sources in order. Sources missing
+// from the backup are skipped.
+func (m *Manager) Restore(ctx context.Context, id string) (*Manifest, error) {
+	manifest, artifacts, err := m.Verify(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, source := range m.Sources {
+		data, ok := artifacts[source.Name()]
+		if !ok {
+			backupLogger.Printf("Backup %s has no %s artifact, skipping", id, source.Name())
+			continue
+		}
+		if err := source.Import(ctx, data); err != nil {
+			return nil, fmt.Errorf("restore %s: %w", source.Name(), err)
+		}
+		backupLogger.Printf("Restored %s from backup %s", source.Name(), id)
+	}
+
+	return manifest, nil
+}
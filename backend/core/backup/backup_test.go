@@ -0,0 +1,107 @@
+package backup
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+type memoryStorage struct {
+	files map[string][]byte
+}
+
+func (s *memoryStorage) Put(path string, data []byte, contentType string) error {
+	s.files[path] = append([]byte(nil), data...)
+	return nil
+}
+
+func (s *memoryStorage) Get(path string) ([]byte, error) {
+	data, ok := s.files[path]
+	if !ok {
+		return nil, errNotFound(path)
+	}
+	return data, nil
+}
+
+type errNotFound string
+
+func (e errNotFound) Error() string { return string(e) + " not found" }
+
+type testSource struct {
+	name     string
+	data     []byte
+	imported []byte
+}
+
+func (s *testSource) Name() string { return s.name }
+
+func (s *testSource) Export(ctx context.Context) ([]byte, error) { return s.data, nil }
+
+func (s *testSource) Import(ctx context.Context, data []byte) error {
+	s.imported = data
+	return nil
+}
+
+func newTestManager(sources ...Source) (*Manager, *memoryStorage) {
+	storage := &memoryStorage{files: map[string][]byte{}}
+	m := NewManager(storage, sources...)
+	m.now = func() time.Time { return time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC) }
+	return m, storage
+}
+
+func TestCreateAndRestore(t *testing.T) {
+	postgres := &testSource{name: "postgres-default.sql", data: []byte("CREATE TABLE t ();")}
+	state := &testSource{name: "dragonfly-shared-state.json", data: []byte(`[]`)}
+	m, storage := newTestManager(postgres, state)
+
+	manifest, err := m.Create(context.Background())
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if manifest.ID != "20260301T120000Z" {
+		t.Fatalf("ID = %s", manifest.ID)
+	}
+	if len(manifest.Artifacts) != 2 {
+		t.Fatalf("got %d artifacts, want 2", len(manifest.Artifacts))
+	}
+	if _, ok := storage.files["backups/20260301T120000Z/manifest.json"]; !ok {
+		t.Fatal("manifest was not uploaded")
+	}
+
+	if _, err := m.Restore(context.Background(), manifest.ID); err != nil {
+		t.Fatalf("Restore: %v", err)
+	}
+	if string(postgres.imported) != string(postgres.data) || string(state.imported) != string(state.data) {
+		t.Fatalf("restored %q and %q", postgres.imported, state.imported)
+	}
+}
+
+func TestRestoreRejectsCorruptArtifact(t *testing.T) {
+	postgres := &testSource{name: "postgres-default.sql", data: []byte("CREATE TABLE t ();")}
+	state := &testSource{name: "dragonfly-shared-state.json", data: []byte(`[]`)}
+	m, storage := newTestManager(postgres, state)
+
+	manifest, err := m.Create(context.Background())
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	storage.files["backups/20260301T120000Z/dragonfly-shared-state.json"] = []byte(`[{}]`)
+
+	_, err = m.Restore(context.Background(), manifest.ID)
+	if err == nil || !strings.Contains(err.Error(), "dragonfly-shared-state.json") {
+		t.Fatalf("Restore error = %v, want checksum mismatch", err)
+	}
+	// nothing is imported unless the whole backup verifies
+	if postgres.imported != nil || state.imported != nil {
+		t.Fatal("restore imported data from a corrupt backup")
+	}
+}
+
+func TestRestoreRequiresManifest(t *testing.T) {
+	m, _ := newTestManager(&testSource{name: "postgres-default.sql"})
+
+	if _, err := m.Restore(context.Background(), "20260301T120000Z"); err == nil {
+		t.Fatal("expected an error for a backup without manifest")
+	}
+}
@@ -0,0 +1,229 @@
+package backup
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/spectrumwebco/agent_runtime/backend/db/integrations"
+)
+
+// PostgresSource dumps a database with pg_dump and restores it with psql,
+// using the connection settings of a PostgresOperatorClient. The dump is
+// plain SQL with DROP statements, so restoring over an existing database
+// replaces its objects.
+type PostgresSource struct {
+	// Connection is the Django connection name, used in the artifact name.
+	Connection string
+	// Settings holds host, port, user, password and name.
+	Settings map[string]string
+}
+
+func NewPostgresSource(connectionName string) *PostgresSource {
+	client := integrations.GetPostgresOperatorClient(connectionName)
+	return &PostgresSource{
+		Connection: connectionName,
+		Settings:   client.GetConnectionInfo(),
+	}
+}
+
+func (s *PostgresSource) Name() string {
+	return "postgres-" + s.Connection + ".sql"
+}
+
+func (s *PostgresSource) connectionArgs() []string {
+	args := []string{}
+	if host := s.Settings["host"]; host != "" {
+		args = append(args, "--host", host)
+	}
+	if port := s.Settings["port"]; port != "" {
+		args = append(args, "--port", port)
+	}
+	if user := s.Settings["user"]; user != "" {
+		args = append(args, "--username", user)
+	}
+	return append(args, "--dbname", s.Settings["name"])
+}
+
+func (s *PostgresSource) command(ctx context.Context, name string, args ...string) *exec.Cmd {
+	cmd := exec.CommandContext(ctx, name, append(args, s.connectionArgs()...)...)
+	// the password never appears on the command line
+	cmd.Env = append(os.Environ(), "PGPASSWORD="+s.Settings["password"])
+	return cmd
+}
+
+func (s *PostgresSource) Export(ctx context.Context) ([]byte, error) {
+	if s.Settings["name"] == "" {
+		return nil, fmt.Errorf("no database configured for connection %s", s.Connection)
+	}
+
+	var stdout, stderr bytes.Buffer
+	cmd := s.command(ctx, "pg_dump", "--format=plain", "--clean", "--if-exists", "--no-owner", "--no-privileges")
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("pg_dump: %v: %s", err, bytes.TrimSpace(stderr.Bytes()))
+	}
+	return stdout.Bytes(), nil
+}
+
+func (s *PostgresSource) Import(ctx context.Context, data []byte) error {
+	var stderr bytes.Buffer
+	cmd := s.command(ctx, "psql", "--quiet", "--no-psqlrc", "--single-transaction", "--set", "ON_ERROR_STOP=1")
+	cmd.Stdin = bytes.NewReader(data)
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("psql: %v: %s", err, bytes.TrimSpace(stderr.Bytes()))
+	}
+	return nil
+}
+
+// SharedStateSource exports the Dragonfly keys under Prefix with DUMP and
+// restores them with RESTORE ... REPLACE, keeping their remaining TTL.
+type SharedStateSource struct {
+	Client redis.UniversalClient
+	Prefix string
+}
+
+func NewSharedStateSource(client redis.UniversalClient) *SharedStateSource {
+	return &SharedStateSource{Client: client, Prefix: "shared_state:"}
+}
+
+func (s *SharedStateSource) Name() string {
+	return "dragonfly-shared-state.json"
+}
+
+type dumpedKey struct {
+	Key string `json:"key"`
+	// TTL is in milliseconds, zero for keys without expiry.
+	TTL   int64  `json:"ttl"`
+	Value []byte `json:"value"`
+}
+
+func (s *SharedStateSource) Export(ctx context.Context) ([]byte, error) {
+	if s.Client == nil {
+		return nil, fmt.Errorf("DragonflyDB client not initialized")
+	}
+
+	var (
+		keys []dumpedKey
+		mu   sync.Mutex
+	)
+	dumpNode := func(ctx context.Context, client redis.Cmdable) error {
+		iter := client.Scan(ctx, 0, s.Prefix+"*", 500).Iterator()
+		for iter.Next(ctx) {
+			key := iter.Val()
+			value, err := client.Dump(ctx, key).Result()
+			if err == redis.Nil {
+				// expired or deleted since the scan
+				continue
+			} else if err != nil {
+				return fmt.Errorf("dump %s: %w", key, err)
+			}
+			ttl, err := client.PTTL(ctx, key).Result()
+			if err != nil {
+				return fmt.Errorf("pttl %s: %w", key, err)
+			}
+			if ttl < 0 {
+				ttl = 0
+			}
+
+			mu.Lock()
+			keys = append(keys, dumpedKey{Key: key, TTL: ttl.Milliseconds(), Value: []byte(value)})
+			mu.Unlock()
+		}
+		return iter.Err()
+	}
+
+	var err error
+	if cluster, ok := s.Client.(*redis.ClusterClient); ok {
+		err = cluster.ForEachMaster(ctx, func(ctx context.Context, client *redis.Client) error {
+			return dumpNode(ctx, client)
+		})
+	} else {
+		err = dumpNode(ctx, s.Client)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(keys, func(i, j int) bool { return keys[i].Key < keys[j].Key })
+	return json.Marshal(keys)
+}
+
+func (s *SharedStateSource) Import(ctx context.Context, data []byte) error {
+	if s.Client == nil {
+		return fmt.Errorf("DragonflyDB client not initialized")
+	}
+
+	var keys []dumpedKey
+	if err := json.Unmarshal(data, &keys); err != nil {
+		return err
+	}
+
+	for _, key := range keys {
+		ttl := time.Duration(key.TTL) * time.Millisecond
+		if err := s.Client.RestoreReplace(ctx, key.Key, ttl, string(key.Value)).Err(); err != nil {
+			return fmt.Errorf("restore %s: %w", key.Key, err)
+		}
+	}
+	return nil
+}
+
+// VectorIndexSource snapshots the names of the RAGflow indexes. Vectors are
+// rebuilt from their source documents, so restoring only recreates indexes
+// that are missing, with the default dimension and metric.
+type VectorIndexSource struct {
+	Store integrations.VectorStore
+}
+
+func (s *VectorIndexSource) Name() string {
+	return "ragflow-indexes.json"
+}
+
+type indexSnapshot struct {
+	Indexes []string `json:"indexes"`
+}
+
+func (s *VectorIndexSource) Export(ctx context.Context) ([]byte, error) {
+	indexes, err := s.Store.ListIndexes()
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Strings(indexes)
+	return json.Marshal(indexSnapshot{Indexes: indexes})
+}
+
+func (s *VectorIndexSource) Import(ctx context.Context, data []byte) error {
+	var snapshot indexSnapshot
+	if err := json.Unmarshal(data, &snapshot); err != nil {
+		return err
+	}
+
+	existing, err := s.Store.ListIndexes()
+	if err != nil {
+		return err
+	}
+	present := make(map[string]bool, len(existing))
+	for _, index := range existing {
+		present[index] = true
+	}
+
+	for _, index := range snapshot.Indexes {
+		if present[index] {
+			continue
+		}
+		if _, err := s.Store.CreateIndex(index, 0, ""); err != nil {
+			return fmt.Errorf("create index %s: %w", index, err)
+		}
+	}
+	return nil
+}
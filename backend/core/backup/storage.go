@@ -0,0 +1,42 @@
+package backup
+
+import (
+	"fmt"
+
+	"github.com/spectrumwebco/agent_runtime/backend/db/integrations"
+)
+
+// SupabaseStorage stores backups in a Supabase storage bucket.
+type SupabaseStorage struct {
+	Manager *integrations.SupabaseManager
+	Bucket  string
+}
+
+func NewSupabaseStorage(bucket string) *SupabaseStorage {
+	return &SupabaseStorage{
+		Manager: integrations.GetSupabaseManager(),
+		Bucket:  bucket,
+	}
+}
+
+func (s *SupabaseStorage) Put(path string, data []byte, contentType string) error {
+	ok, _, err := s.Manager.UploadFile(s.Bucket, path, data, contentType)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return fmt.Errorf("upload of %s to bucket %s failed", path, s.Bucket)
+	}
+	return nil
+}
+
+func (s *SupabaseStorage) Get(path string) ([]byte, error) {
+	ok, data, err := s.Manager.DownloadFile(s.Bucket, path)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, fmt.Errorf("%s not found in bucket %s", path, s.Bucket)
+	}
+	return data, nil
+}
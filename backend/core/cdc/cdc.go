@@ -0,0 +1,143 @@
+// Package cdc streams row changes of selected Postgres tables to Kafka, so
+// caches and analytics follow the database without the application writing
+// to both.
+//
+// Changes are decoded by the wal2json plugin of a logical replication slot
+// and read through the SQL interface of the slot. Each change is published
+// as a JSON Change to the topic of its table, keyed by its primary key, so
+// the changes of a row land in the same partition in commit order. The slot
+// only advances once every message of the batch was delivered; consumers
+// must deduplicate by LSN after a crash.
+//
+// A slot can only be read by one process at a time, Postgres rejects
+// concurrent readers.
+package cdc
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"regexp"
+	"time"
+
+	"github.com/spectrumwebco/agent_runtime/backend/core/config/env"
+)
+
+var cdcLogger = log.New(os.Stdout, "kled.cdc: ", log.LstdFlags)
+
+type Op string
+
+const (
+	OpInsert   Op = "insert"
+	OpUpdate   Op = "update"
+	OpDelete   Op = "delete"
+	OpTruncate Op = "truncate"
+)
+
+// The headers of each message, to route them without decoding the body.
+const (
+	HeaderOp    = "kled-cdc-op"
+	HeaderLSN   = "kled-cdc-lsn"
+	HeaderTable = "kled-cdc-table"
+)
+
+// Change is a change of a row.
+type Change struct {
+	// LSN is the position of the change in the WAL. It increases with
+	// every change and can be used to deduplicate.
+	LSN string `json:"lsn"`
+	// XID is the ID of the transaction of the change.
+	XID         string    `json:"xid,omitempty"`
+	CommittedAt time.Time `json:"committed_at,omitempty"`
+
+	Op     Op     `json:"op"`
+	Schema string `json:"schema"`
+	Table  string `json:"table"`
+	// Key holds the primary key of the row, empty for truncates.
+	Key map[string]interface{} `json:"key,omitempty"`
+	// Before holds the replica identity of updated and deleted rows: the
+	// primary key, or every column for tables with REPLICA IDENTITY FULL.
+	Before map[string]interface{} `json:"before,omitempty"`
+	// After holds the row as inserted or updated.
+	After map[string]interface{} `json:"after,omitempty"`
+}
+
+type Config struct {
+	// Slot is the name of the replication slot. It is created on start.
+	Slot string `json:"slot"`
+	// Tables are the schema qualified tables captured, e.g.
+	// public.app_workspace.
+	Tables []string `json:"tables"`
+	// TopicPrefix is prepended to "<schema>.<table>" to name the topic of a
+	// table.
+	TopicPrefix string `json:"topic_prefix"`
+	// BatchSize is the number of changes read at once. Transactions are
+	// never split, so batches can be larger.
+	BatchSize int `json:"batch_size"`
+	// PollInterval is how long the streamer waits when there are no changes.
+	PollInterval time.Duration `json:"poll_interval"`
+	// DeliveryTimeout is how long the streamer waits for Kafka to
+	// acknowledge a batch before it reads the batch again.
+	DeliveryTimeout time.Duration `json:"delivery_timeout"`
+}
+
+const (
+	DefaultSlot            = "kled_cdc"
+	DefaultTopicPrefix     = "cdc"
+	DefaultBatchSize       = 500
+	DefaultPollInterval    = time.Second
+	DefaultDeliveryTimeout = 30 * time.Second
+)
+
+var (
+	identifierPattern = regexp.MustCompile(`^[a-z_][a-z0-9_]*$`)
+	tablePattern      = regexp.MustCompile(`^[a-z_][a-z0-9_]*\.[a-z_][a-z0-9_]*$`)
+)
+
+// Validate checks the slot and table names, which are passed to wal2json
+// unescaped.
+func (c Config) Validate() error {
+	if !identifierPattern.MatchString(c.Slot) {
+		return fmt.Errorf("invalid replication slot name %q", c.Slot)
+	}
+	if len(c.Tables) == 0 {
+		return fmt.Errorf("no tables to capture")
+	}
+	for _, table := range c.Tables {
+		if !tablePattern.MatchString(table) {
+			return fmt.Errorf("invalid table %q, expected <schema>.<table>", table)
+		}
+	}
+	return nil
+}
+
+// Topic returns the topic of the changes of a table.
+func (c Config) Topic(schema, table string) string {
+	if c.TopicPrefix == "" {
+		return schema + "." + table
+	}
+	return c.TopicPrefix + "." + schema + "." + table
+}
+
+var Default = env.Once(FromEnv)
+
+func FromEnv() Config {
+	config := Config{
+		Slot:            DefaultSlot,
+		TopicPrefix:     DefaultTopicPrefix,
+		BatchSize:       DefaultBatchSize,
+		PollInterval:    DefaultPollInterval,
+		DeliveryTimeout: DefaultDeliveryTimeout,
+	}
+	read := env.NewReader(cdcLogger)
+	read.String("AGENT_CDC_SLOT", &config.Slot)
+	// an empty prefix publishes to topics named like the tables
+	if prefix, ok := os.LookupEnv("AGENT_CDC_TOPIC_PREFIX"); ok {
+		config.TopicPrefix = prefix
+	}
+	config.Tables = read.List("AGENT_CDC_TABLES")
+	read.Int("AGENT_CDC_BATCH_SIZE", &config.BatchSize, 1)
+	read.PositiveDuration("AGENT_CDC_POLL_INTERVAL", &config.PollInterval)
+	read.PositiveDuration("AGENT_CDC_DELIVERY_TIMEOUT", &config.DeliveryTimeout)
+	return config
+}
@@ -0,0 +1,196 @@
+package cdc
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakePostgres serves the changes of a slot through its SQL functions.
+type fakePostgres struct {
+	changes  []map[string]interface{}
+	advanced []string
+	slots    map[string]string
+}
+
+func (f *fakePostgres) ExecuteQuery(query string, params ...interface{}) ([]map[string]interface{}, error) {
+	switch {
+	case strings.Contains(query, "pg_logical_slot_peek_changes"):
+		return f.changes, nil
+	case strings.Contains(query, "pg_replication_slot_advance"):
+		f.advanced = append(f.advanced, params[1].(string))
+		f.changes = nil
+		return nil, nil
+	case strings.Contains(query, "pg_create_logical_replication_slot"):
+		f.slots[params[0].(string)] = params[1].(string)
+		return nil, nil
+	case strings.Contains(query, "confirmed_flush_lsn"):
+		return []map[string]interface{}{{"lag": int64(4096)}}, nil
+	case strings.Contains(query, "FROM pg_replication_slots"):
+		if plugin, ok := f.slots[params[0].(string)]; ok {
+			return []map[string]interface{}{{"plugin": plugin}}, nil
+		}
+		return nil, nil
+	}
+	return nil, nil
+}
+
+func (f *fakePostgres) ExecuteUpdate(query string, params ...interface{}) (int64, error) {
+	return 0, nil
+}
+
+type message struct {
+	topic   string
+	key     string
+	change  Change
+	headers map[string]string
+}
+
+type fakeProducer struct {
+	messages []message
+	left     int
+	failed   int64
+	// reject fails the deliveries of the next flush
+	reject bool
+}
+
+func (p *fakeProducer) ProduceWithHeaders(topic string, value interface{}, key string, headers map[string]string) error {
+	var change Change
+	if err := json.Unmarshal(value.([]byte), &change); err != nil {
+		return err
+	}
+	p.messages = append(p.messages, message{topic: topic, key: key, change: change, headers: headers})
+	return nil
+}
+
+func (p *fakeProducer) Flush(timeoutMs int) int {
+	if p.reject {
+		p.failed++
+		p.reject = false
+	}
+	return p.left
+}
+
+func (p *fakeProducer) FailedDeliveries() int64 {
+	return p.failed
+}
+
+func changes() []map[string]interface{} {
+	return []map[string]interface{}{
+		{"lsn": "0/16B3748", "data": `{"action":"B","xid":771,"timestamp":"2026-03-01 12:00:00.123456+00"}`},
+		{"lsn": "0/16B3748", "data": `{"action":"I","schema":"public","table":"app_workspace","columns":[{"name":"id","type":"integer","value":7},{"name":"name","type":"text","value":"api"}],"pk":[{"name":"id","type":"integer"}]}`},
+		{"lsn": "0/16B37F0", "data": `{"action":"U","schema":"public","table":"app_workspace","columns":[{"name":"id","type":"integer","value":7},{"name":"name","type":"text","value":"api-v2"}],"identity":[{"name":"id","type":"integer","value":7}],"pk":[{"name":"id","type":"integer"}]}`},
+		{"lsn": "0/16B3820", "data": `{"action":"C","xid":771,"timestamp":"2026-03-01 12:00:00.123456+00"}`},
+		{"lsn": "0/16B3850", "data": `{"action":"B","xid":772,"timestamp":"2026-03-01 12:00:01+00"}`},
+		{"lsn": "0/16B3850", "data": `{"action":"D","schema":"public","table":"app_workspace","identity":[{"name":"id","type":"integer","value":7}],"pk":[{"name":"id","type":"integer"}]}`},
+		{"lsn": "0/16B38A0", "data": `{"action":"C","xid":772,"timestamp":"2026-03-01 12:00:01+00"}`},
+	}
+}
+
+func testConfig() Config {
+	config := FromEnv()
+	config.Tables = []string{"public.app_workspace"}
+	return config
+}
+
+func TestStreamerPublishesInOrder(t *testing.T) {
+	postgres := &fakePostgres{changes: changes(), slots: map[string]string{}}
+	producer := &fakeProducer{}
+	config := testConfig()
+	slot := NewSlot(postgres, config.Slot, config.Tables)
+	streamer := NewStreamer(slot, producer, config)
+	ctx := context.Background()
+
+	if err := slot.Ensure(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if postgres.slots[DefaultSlot] != Plugin {
+		t.Fatalf("expected the slot to be created, got %v", postgres.slots)
+	}
+
+	published, err := streamer.Poll(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if published != 3 || len(producer.messages) != 3 {
+		t.Fatalf("expected 3 changes, published %d", published)
+	}
+	if len(postgres.advanced) != 1 || postgres.advanced[0] != "0/16B38A0" {
+		t.Errorf("expected the slot to advance past the last commit, got %v", postgres.advanced)
+	}
+
+	var ops []string
+	for _, message := range producer.messages {
+		ops = append(ops, string(message.change.Op))
+		if message.topic != "cdc.public.app_workspace" || message.key != `public.app_workspace:{"id":7}` {
+			t.Errorf("unexpected topic %s or key %s", message.topic, message.key)
+		}
+	}
+	if strings.Join(ops, ",") != "insert,update,delete" {
+		t.Errorf("unexpected order %v", ops)
+	}
+
+	update := producer.messages[1].change
+	if update.XID != "771" || update.LSN != "0/16B37F0" || update.After["name"] != "api-v2" || fmt.Sprint(update.Before["id"]) != "7" {
+		t.Errorf("unexpected update %+v", update)
+	}
+	if !update.CommittedAt.Equal(time.Date(2026, 3, 1, 12, 0, 0, 123456000, time.UTC)) {
+		t.Errorf("unexpected commit time %s", update.CommittedAt)
+	}
+	if producer.messages[2].headers[HeaderOp] != "delete" {
+		t.Errorf("unexpected headers %v", producer.messages[2].headers)
+	}
+}
+
+func TestStreamerRetriesUndeliveredBatches(t *testing.T) {
+	postgres := &fakePostgres{changes: changes(), slots: map[string]string{}}
+	producer := &fakeProducer{left: 1}
+	config := testConfig()
+	streamer := NewStreamer(NewSlot(postgres, config.Slot, config.Tables), producer, config)
+	ctx := context.Background()
+
+	if _, err := streamer.Poll(ctx); err == nil || len(postgres.advanced) != 0 {
+		t.Fatalf("expected the slot not to advance, got %v (%v)", postgres.advanced, err)
+	}
+
+	producer.left, producer.reject = 0, true
+	if _, err := streamer.Poll(ctx); err == nil || len(postgres.advanced) != 0 {
+		t.Fatalf("expected rejected changes to keep the slot, got %v (%v)", postgres.advanced, err)
+	}
+
+	if _, err := streamer.Poll(ctx); err != nil || len(postgres.advanced) != 1 {
+		t.Fatalf("expected the batch to be delivered again, got %v (%v)", postgres.advanced, err)
+	}
+	if len(producer.messages) != 9 {
+		t.Errorf("expected the changes to be published three times, got %d", len(producer.messages))
+	}
+}
+
+func TestPeekKeepsOpenTransactions(t *testing.T) {
+	// the slot functions only return whole transactions, but a batch must
+	// not advance past a transaction it didn't see the commit of
+	postgres := &fakePostgres{changes: changes()[:6], slots: map[string]string{}}
+	batch, err := NewSlot(postgres, DefaultSlot, []string{"public.app_workspace"}).Peek(context.Background(), 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(batch.Changes) != 2 || batch.LSN != "0/16B3820" {
+		t.Errorf("expected the first transaction only, got %d changes up to %s", len(batch.Changes), batch.LSN)
+	}
+}
+
+func TestConfigValidate(t *testing.T) {
+	config := testConfig()
+	if err := config.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	for _, tables := range [][]string{nil, {"app_workspace"}, {"public.app_workspace,public.x"}, {"public.*"}} {
+		config.Tables = tables
+		if config.Validate() == nil {
+			t.Errorf("expected %v to be rejected", tables)
+		}
+	}
+}
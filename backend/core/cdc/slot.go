@@ -0,0 +1,213 @@
+package cdc
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spectrumwebco/agent_runtime/backend/db/integrations"
+)
+
+// Plugin is the output plugin of the slot.
+const Plugin = "wal2json"
+
+// Slot reads the changes of the captured tables from a logical replication
+// slot.
+type Slot struct {
+	store  integrations.SQLStore
+	name   string
+	tables []string
+}
+
+func NewSlot(store integrations.SQLStore, name string, tables []string) *Slot {
+	return &Slot{store: store, name: name, tables: tables}
+}
+
+// Ensure creates the slot if it doesn't exist. A new slot captures the
+// changes committed from then on.
+func (s *Slot) Ensure(ctx context.Context) error {
+	rows, err := s.store.ExecuteQuery(`SELECT plugin FROM pg_replication_slots WHERE slot_name = $1`, s.name)
+	if err != nil {
+		return fmt.Errorf("error loading replication slot %s: %v", s.name, err)
+	}
+	if len(rows) > 0 {
+		if plugin := fmt.Sprint(rows[0]["plugin"]); plugin != Plugin {
+			return fmt.Errorf("replication slot %s uses the %s plugin, expected %s", s.name, plugin, Plugin)
+		}
+		return nil
+	}
+	if _, err := s.store.ExecuteQuery(`SELECT pg_create_logical_replication_slot($1, $2)`, s.name, Plugin); err != nil {
+		return fmt.Errorf("error creating replication slot %s: %v", s.name, err)
+	}
+	cdcLogger.Printf("Created replication slot %s", s.name)
+	return nil
+}
+
+// Drop drops the slot. Postgres keeps the WAL a slot hasn't consumed, so
+// slots that are no longer read must be dropped.
+func (s *Slot) Drop(ctx context.Context) error {
+	if _, err := s.store.ExecuteQuery(`SELECT pg_drop_replication_slot($1)`, s.name); err != nil {
+		return fmt.Errorf("error dropping replication slot %s: %v", s.name, err)
+	}
+	return nil
+}
+
+// Batch is a run of whole transactions read from the slot.
+type Batch struct {
+	Changes []Change
+	// LSN is the end of the last transaction of the batch, where the slot
+	// is advanced to once the batch was delivered. Empty if the batch is.
+	LSN string
+}
+
+// Peek reads at least limit changes, or every pending one, without
+// consuming them.
+func (s *Slot) Peek(ctx context.Context, limit int) (*Batch, error) {
+	rows, err := s.store.ExecuteQuery(`
+SELECT lsn::text AS lsn, data FROM pg_logical_slot_peek_changes($1, NULL, $2,
+  'format-version', '2', 'include-xids', '1', 'include-timestamp', '1', 'include-pk', '1', 'add-tables', $3)`,
+		s.name, limit, strings.Join(s.tables, ","),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("error reading replication slot %s: %v", s.name, err)
+	}
+
+	batch := &Batch{}
+	var (
+		pending     []Change
+		xid         string
+		committedAt time.Time
+	)
+	for _, row := range rows {
+		lsn := fmt.Sprint(row["lsn"])
+		var message wal2jsonMessage
+		decoder := json.NewDecoder(bytes.NewReader(rowBytes(row["data"])))
+		decoder.UseNumber()
+		if err := decoder.Decode(&message); err != nil {
+			return nil, fmt.Errorf("error decoding change at %s: %v", lsn, err)
+		}
+
+		switch message.Action {
+		case "B":
+			pending, xid, committedAt = nil, message.xid(), message.time()
+		case "C":
+			// changes are only handed out with their whole transaction
+			batch.Changes = append(batch.Changes, pending...)
+			batch.LSN = lsn
+			pending = nil
+		case "I", "U", "D", "T":
+			change := message.change()
+			change.LSN, change.XID, change.CommittedAt = lsn, xid, committedAt
+			pending = append(pending, change)
+		}
+	}
+	return batch, nil
+}
+
+// Advance consumes the changes up to lsn, letting Postgres recycle the WAL
+// holding them.
+func (s *Slot) Advance(ctx context.Context, lsn string) error {
+	if _, err := s.store.ExecuteQuery(`SELECT pg_replication_slot_advance($1, $2::pg_lsn)`, s.name, lsn); err != nil {
+		return fmt.Errorf("error advancing replication slot %s to %s: %v", s.name, lsn, err)
+	}
+	return nil
+}
+
+// Lag returns the bytes of WAL the slot hasn't consumed yet.
+func (s *Slot) Lag(ctx context.Context) (int64, error) {
+	rows, err := s.store.ExecuteQuery(
+		`SELECT pg_wal_lsn_diff(pg_current_wal_lsn(), confirmed_flush_lsn)::bigint AS lag FROM pg_replication_slots WHERE slot_name = $1`, s.name,
+	)
+	if err != nil {
+		return 0, fmt.Errorf("error loading the lag of replication slot %s: %v", s.name, err)
+	}
+	if len(rows) == 0 {
+		return 0, fmt.Errorf("replication slot %s not found", s.name)
+	}
+	lag, err := strconv.ParseInt(fmt.Sprint(rows[0]["lag"]), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid lag of replication slot %s: %v", s.name, err)
+	}
+	return lag, nil
+}
+
+func rowBytes(value interface{}) []byte {
+	switch v := value.(type) {
+	case []byte:
+		return v
+	case string:
+		return []byte(v)
+	default:
+		return []byte(fmt.Sprint(v))
+	}
+}
+
+// wal2jsonMessage is a message of the format version 2 of wal2json.
+type wal2jsonMessage struct {
+	Action    string           `json:"action"`
+	XID       json.Number      `json:"xid"`
+	Timestamp string           `json:"timestamp"`
+	Schema    string           `json:"schema"`
+	Table     string           `json:"table"`
+	Columns   []wal2jsonColumn `json:"columns"`
+	Identity  []wal2jsonColumn `json:"identity"`
+	PK        []wal2jsonColumn `json:"pk"`
+}
+
+type wal2jsonColumn struct {
+	Name  string      `json:"name"`
+	Value interface{} `json:"value"`
+}
+
+func (m wal2jsonMessage) xid() string {
+	return m.XID.String()
+}
+
+// time parses the commit timestamp, e.g. 2026-03-01 12:00:00.123456+00.
+func (m wal2jsonMessage) time() time.Time {
+	parsed, err := time.Parse("2006-01-02 15:04:05.999999-07", m.Timestamp)
+	if err != nil {
+		return time.Time{}
+	}
+	return parsed.UTC()
+}
+
+func (m wal2jsonMessage) change() Change {
+	change := Change{Schema: m.Schema, Table: m.Table}
+	switch m.Action {
+	case "I":
+		change.Op, change.After = OpInsert, values(m.Columns)
+	case "U":
+		change.Op, change.After, change.Before = OpUpdate, values(m.Columns), values(m.Identity)
+	case "D":
+		change.Op, change.Before = OpDelete, values(m.Identity)
+	case "T":
+		change.Op = OpTruncate
+		return change
+	}
+
+	row := change.After
+	if row == nil {
+		row = change.Before
+	}
+	change.Key = map[string]interface{}{}
+	for _, column := range m.PK {
+		change.Key[column.Name] = row[column.Name]
+	}
+	return change
+}
+
+func values(columns []wal2jsonColumn) map[string]interface{} {
+	if len(columns) == 0 {
+		return nil
+	}
+	row := make(map[string]interface{}, len(columns))
+	for _, column := range columns {
+		row[column.Name] = column.Value
+	}
+	return row
+}
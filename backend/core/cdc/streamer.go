@@ -0,0 +1,142 @@
+package cdc
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	changesTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "kled_cdc_changes_total",
+		Help: "Row changes published to Kafka, by table and operation.",
+	}, []string{"table", "op"})
+	failedBatchesTotal = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "kled_cdc_failed_batches_total",
+		Help: "Batches of changes that weren't delivered and are read again.",
+	})
+	slotLag = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "kled_cdc_slot_lag_bytes",
+		Help: "WAL retained for changes the replication slot hasn't published yet.",
+	}, []string{"slot"})
+)
+
+func init() {
+	prometheus.MustRegister(changesTotal, failedBatchesTotal, slotLag)
+}
+
+// Producer publishes to Kafka. It is implemented by
+// integrations.KafkaClient.
+type Producer interface {
+	ProduceWithHeaders(topic string, value interface{}, key string, headers map[string]string) error
+	// Flush waits up to timeoutMs for the queued messages to be delivered
+	// and returns how many are left.
+	Flush(timeoutMs int) int
+	FailedDeliveries() int64
+}
+
+// Streamer publishes the changes of a slot to Kafka.
+type Streamer struct {
+	slot     *Slot
+	producer Producer
+	config   Config
+}
+
+func NewStreamer(slot *Slot, producer Producer, config Config) *Streamer {
+	return &Streamer{slot: slot, producer: producer, config: config}
+}
+
+// Run creates the slot if needed and publishes its changes until ctx is
+// done. Failed batches are retried after the poll interval.
+func (s *Streamer) Run(ctx context.Context) error {
+	if err := s.slot.Ensure(ctx); err != nil {
+		return err
+	}
+	for {
+		published, err := s.Poll(ctx)
+		if err != nil {
+			cdcLogger.Printf("Error publishing changes: %v", err)
+		}
+		if err == nil && published > 0 && ctx.Err() == nil {
+			continue
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(s.config.PollInterval):
+		}
+	}
+}
+
+// Poll publishes the pending changes of a batch and returns how many were
+// published. The slot only advances once Kafka acknowledged all of them;
+// otherwise the batch is read and published again.
+func (s *Streamer) Poll(ctx context.Context) (int, error) {
+	batch, err := s.slot.Peek(ctx, s.config.BatchSize)
+	if err != nil {
+		return 0, err
+	}
+	if batch.LSN == "" {
+		return 0, s.updateLag(ctx)
+	}
+
+	failures := s.producer.FailedDeliveries()
+	for _, change := range batch.Changes {
+		if err := s.publish(change); err != nil {
+			failedBatchesTotal.Inc()
+			return 0, err
+		}
+	}
+	if left := s.producer.Flush(int(s.config.DeliveryTimeout.Milliseconds())); left > 0 {
+		failedBatchesTotal.Inc()
+		return 0, fmt.Errorf("%d changes weren't delivered within %s", left, s.config.DeliveryTimeout)
+	}
+	if failed := s.producer.FailedDeliveries() - failures; failed > 0 {
+		failedBatchesTotal.Inc()
+		return 0, fmt.Errorf("%d changes were rejected by Kafka", failed)
+	}
+
+	if err := s.slot.Advance(ctx, batch.LSN); err != nil {
+		return 0, err
+	}
+	for _, change := range batch.Changes {
+		changesTotal.WithLabelValues(change.Schema+"."+change.Table, string(change.Op)).Inc()
+	}
+	return len(batch.Changes), s.updateLag(ctx)
+}
+
+func (s *Streamer) publish(change Change) error {
+	body, err := json.Marshal(change)
+	if err != nil {
+		return fmt.Errorf("error encoding change at %s: %v", change.LSN, err)
+	}
+	return s.producer.ProduceWithHeaders(s.config.Topic(change.Schema, change.Table), body, Key(change), map[string]string{
+		HeaderOp:    string(change.Op),
+		HeaderLSN:   change.LSN,
+		HeaderTable: change.Schema + "." + change.Table,
+	})
+}
+
+func (s *Streamer) updateLag(ctx context.Context) error {
+	lag, err := s.slot.Lag(ctx)
+	if err != nil {
+		return err
+	}
+	slotLag.WithLabelValues(s.slot.name).Set(float64(lag))
+	return nil
+}
+
+// Key returns the message key of a change: the primary key of its row, so
+// the changes of a row keep their order within a partition. Truncates are
+// keyed by their table.
+func Key(change Change) string {
+	if len(change.Key) == 0 {
+		return change.Schema + "." + change.Table
+	}
+	// maps are encoded with sorted keys, so the key is stable
+	key, _ := json.Marshal(change.Key)
+	return change.Schema + "." + change.Table + ":" + string(key)
+}
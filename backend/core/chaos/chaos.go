@@ -0,0 +1,287 @@
+// Package chaos injects faults into the clients of integrations, so retries
+// and fallbacks can be validated in staging.
+//
+// Faults add latency, fail a share of calls or drop connections. They match
+// a target: "http:<host>" for requests made with the outbound HTTP clients,
+// or "kv", "sql", "mq" and "events" for the stores of the integrations
+// package. "*" matches every target and "http:*" every host.
+//
+// Injection is off unless AGENT_CHAOS_ENABLED is set; faults are then
+// managed at runtime through the admin API.
+package chaos
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math/rand"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/spectrumwebco/agent_runtime/backend/core/kerrors"
+)
+
+var chaosLogger = log.New(os.Stdout, "kled.chaos: ", log.LstdFlags)
+
+var (
+	// ErrInjected is returned by calls a fault failed.
+	ErrInjected = kerrors.New(kerrors.BackendUnavailable, "injected fault")
+	// ErrDropped is returned by calls whose connection a fault dropped.
+	ErrDropped = kerrors.New(kerrors.BackendUnavailable, "injected connection drop")
+)
+
+// Fault describes the faults injected into calls to a target.
+type Fault struct {
+	Name   string `json:"name"`
+	Target string `json:"target"`
+	// LatencyMs is added to every matching call, plus up to JitterMs.
+	LatencyMs int64 `json:"latency_ms,omitempty"`
+	JitterMs  int64 `json:"jitter_ms,omitempty"`
+	// ErrorRate is the share of calls that fail, between 0 and 1.
+	ErrorRate float64 `json:"error_rate,omitempty"`
+	// DropRate is the share of calls whose connection is dropped.
+	DropRate float64 `json:"drop_rate,omitempty"`
+	// StatusCode is returned by HTTP calls that fail, 503 by default.
+	StatusCode int `json:"status_code,omitempty"`
+	// ExpiresAt removes the fault automatically, so a forgotten experiment
+	// doesn't keep staging broken.
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
+
+// Validate checks the fault.
+func (f Fault) Validate() error {
+	switch {
+	case f.Name == "":
+		return errors.New("name is required")
+	case f.Target == "":
+		return errors.New("target is required")
+	case f.LatencyMs < 0 || f.JitterMs < 0:
+		return errors.New("latency_ms and jitter_ms must not be negative")
+	case f.ErrorRate < 0 || f.ErrorRate > 1 || f.DropRate < 0 || f.DropRate > 1:
+		return errors.New("error_rate and drop_rate must be between 0 and 1")
+	case f.ErrorRate+f.DropRate > 1:
+		return errors.New("error_rate and drop_rate must not add up to more than 1")
+	case f.StatusCode != 0 && (f.StatusCode < 400 || f.StatusCode > 599):
+		return errors.New("status_code must be an HTTP error status")
+	}
+	return nil
+}
+
+// Matches reports whether the fault applies to the target.
+func (f Fault) Matches(target string) bool {
+	if f.Target == "*" || f.Target == target {
+		return true
+	}
+	prefix, ok := strings.CutSuffix(f.Target, "*")
+	return ok && strings.HasPrefix(target, prefix)
+}
+
+// Stats counts the calls a fault was applied to.
+type Stats struct {
+	Delayed int64 `json:"delayed"`
+	Failed  int64 `json:"failed"`
+	Dropped int64 `json:"dropped"`
+}
+
+// FaultStatus is a fault and what it did.
+type FaultStatus struct {
+	Fault
+	Stats Stats `json:"stats"`
+}
+
+// Injector holds the active faults.
+type Injector struct {
+	enabled bool
+	now     func() time.Time
+	sleep   func(ctx context.Context, d time.Duration) error
+
+	mu     sync.Mutex
+	rand   *rand.Rand
+	faults map[string]*FaultStatus
+}
+
+func NewInjector(enabled bool) *Injector {
+	return &Injector{
+		enabled: enabled,
+		now:     time.Now,
+		sleep:   sleep,
+		rand:    rand.New(rand.NewSource(time.Now().UnixNano())),
+		faults:  map[string]*FaultStatus{},
+	}
+}
+
+var (
+	defaultInjector     *Injector
+	defaultInjectorOnce sync.Once
+)
+
+// Default returns the injector of the process, set up from the environment.
+func Default() *Injector {
+	defaultInjectorOnce.Do(func() {
+		config := ConfigFromEnv()
+		defaultInjector = NewInjector(config.Enabled)
+		for _, fault := range config.Faults {
+			if err := defaultInjector.Set(fault); err != nil {
+				chaosLogger.Printf("Ignoring fault %q from AGENT_CHAOS_FAULTS: %v", fault.Name, err)
+			}
+		}
+		if config.Enabled {
+			chaosLogger.Printf("Fault injection is enabled with %d fault(s)", len(defaultInjector.List()))
+		}
+	})
+	return defaultInjector
+}
+
+// Enabled reports whether faults may be injected.
+func (i *Injector) Enabled() bool {
+	return i != nil && i.enabled
+}
+
+// Set adds or replaces the fault with the same name.
+func (i *Injector) Set(fault Fault) error {
+	if !i.Enabled() {
+		return errors.New("fault injection is disabled")
+	}
+	if err := fault.Validate(); err != nil {
+		return err
+	}
+
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	status := &FaultStatus{Fault: fault}
+	if existing, ok := i.faults[fault.Name]; ok {
+		status.Stats = existing.Stats
+	}
+	i.faults[fault.Name] = status
+	chaosLogger.Printf("Fault %q set for %s", fault.Name, fault.Target)
+	return nil
+}
+
+// Remove removes a fault and reports whether it existed.
+func (i *Injector) Remove(name string) bool {
+	if !i.Enabled() {
+		return false
+	}
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	_, ok := i.faults[name]
+	delete(i.faults, name)
+	if ok {
+		chaosLogger.Printf("Fault %q removed", name)
+	}
+	return ok
+}
+
+// Clear removes all faults.
+func (i *Injector) Clear() {
+	if !i.Enabled() {
+		return
+	}
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	i.faults = map[string]*FaultStatus{}
+}
+
+// List returns the active faults by name.
+func (i *Injector) List() []FaultStatus {
+	if !i.Enabled() {
+		return []FaultStatus{}
+	}
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	i.expire()
+
+	faults := make([]FaultStatus, 0, len(i.faults))
+	for _, status := range i.faults {
+		faults = append(faults, *status)
+	}
+	sort.Slice(faults, func(a, b int) bool { return faults[a].Name < faults[b].Name })
+	return faults
+}
+
+// expire removes faults past their expiry. The lock must be held.
+func (i *Injector) expire() {
+	now := i.now()
+	for name, status := range i.faults {
+		if status.ExpiresAt != nil && !now.Before(*status.ExpiresAt) {
+			delete(i.faults, name)
+			chaosLogger.Printf("Fault %q expired", name)
+		}
+	}
+}
+
+// outcome is what the faults decided for a call.
+type outcome struct {
+	delay      time.Duration
+	err        error
+	statusCode int
+}
+
+func (i *Injector) decide(target string) outcome {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	i.expire()
+
+	result := outcome{}
+	for _, status := range i.faults {
+		if !status.Matches(target) {
+			continue
+		}
+		if status.LatencyMs > 0 || status.JitterMs > 0 {
+			delay := time.Duration(status.LatencyMs) * time.Millisecond
+			if status.JitterMs > 0 {
+				delay += time.Duration(i.rand.Int63n(status.JitterMs)) * time.Millisecond
+			}
+			result.delay += delay
+			status.Stats.Delayed++
+		}
+		if result.err != nil {
+			continue
+		}
+		roll := i.rand.Float64()
+		switch {
+		case roll < status.DropRate:
+			result.err = fmt.Errorf("%w: %s (fault %s)", ErrDropped, target, status.Name)
+			status.Stats.Dropped++
+		case roll < status.DropRate+status.ErrorRate:
+			result.err = fmt.Errorf("%w: %s (fault %s)", ErrInjected, target, status.Name)
+			result.statusCode = status.StatusCode
+			if result.statusCode == 0 {
+				result.statusCode = 503
+			}
+			status.Stats.Failed++
+		}
+	}
+	return result
+}
+
+// Inject applies the faults matching the target to a call: it waits for the
+// added latency and returns ErrInjected or ErrDropped if the call should
+// fail.
+func (i *Injector) Inject(ctx context.Context, target string) error {
+	if !i.Enabled() {
+		return nil
+	}
+	result := i.decide(target)
+	if result.delay > 0 {
+		if err := i.sleep(ctx, result.delay); err != nil {
+			return err
+		}
+	}
+	return result.err
+}
+
+func sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
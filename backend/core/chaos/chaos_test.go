@@ -0,0 +1,167 @@
+package chaos
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func newTestInjector() (*Injector, *time.Duration) {
+	injector := NewInjector(true)
+	slept := new(time.Duration)
+	injector.sleep = func(ctx context.Context, d time.Duration) error {
+		*slept += d
+		return nil
+	}
+	return injector, slept
+}
+
+func TestValidate(t *testing.T) {
+	for _, fault := range []Fault{
+		{Target: "kv"},
+		{Name: "a"},
+		{Name: "a", Target: "kv", LatencyMs: -1},
+		{Name: "a", Target: "kv", ErrorRate: 1.5},
+		{Name: "a", Target: "kv", ErrorRate: 0.6, DropRate: 0.6},
+		{Name: "a", Target: "kv", StatusCode: 200},
+	} {
+		if err := fault.Validate(); err == nil {
+			t.Errorf("expected %+v to be invalid", fault)
+		}
+	}
+	if err := (Fault{Name: "a", Target: "http:*", ErrorRate: 0.5, DropRate: 0.5, StatusCode: 429}).Validate(); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestMatches(t *testing.T) {
+	for target, expected := range map[string]bool{
+		"http:api.github.com": true,
+		"http:gitlab.com":     false,
+		"kv":                  false,
+	} {
+		if (Fault{Target: "http:api.github.com"}).Matches(target) != expected {
+			t.Errorf("expected match of %s to be %v", target, expected)
+		}
+	}
+	if !(Fault{Target: "http:*"}).Matches("http:gitlab.com") || (Fault{Target: "http:*"}).Matches("kv") {
+		t.Error("expected http:* to match every host only")
+	}
+	if !(Fault{Target: "*"}).Matches("sql") {
+		t.Error("expected * to match everything")
+	}
+}
+
+func TestInject(t *testing.T) {
+	injector, slept := newTestInjector()
+	if err := injector.Inject(context.Background(), "kv"); err != nil {
+		t.Fatalf("unexpected error without faults: %v", err)
+	}
+
+	if err := injector.Set(Fault{Name: "slow", Target: "kv", LatencyMs: 200}); err != nil {
+		t.Fatal(err)
+	}
+	if err := injector.Set(Fault{Name: "down", Target: "sql", ErrorRate: 1}); err != nil {
+		t.Fatal(err)
+	}
+	if err := injector.Set(Fault{Name: "flaky", Target: "mq", DropRate: 1}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := injector.Inject(context.Background(), "kv"); err != nil || *slept != 200*time.Millisecond {
+		t.Errorf("expected only latency, got %v after %s", err, *slept)
+	}
+	if err := injector.Inject(context.Background(), "sql"); !errors.Is(err, ErrInjected) {
+		t.Errorf("expected an injected error, got %v", err)
+	}
+	if err := injector.Inject(context.Background(), "mq"); !errors.Is(err, ErrDropped) {
+		t.Errorf("expected a dropped connection, got %v", err)
+	}
+	if err := injector.Inject(context.Background(), "events"); err != nil {
+		t.Errorf("unexpected error for an unmatched target: %v", err)
+	}
+
+	faults := injector.List()
+	if len(faults) != 3 || faults[0].Name != "down" || faults[0].Stats.Failed != 1 || faults[1].Stats.Dropped != 1 || faults[2].Stats.Delayed != 1 {
+		t.Errorf("unexpected faults %+v", faults)
+	}
+
+	if !injector.Remove("down") || injector.Remove("down") {
+		t.Error("expected the fault to be removed once")
+	}
+	if err := injector.Inject(context.Background(), "sql"); err != nil {
+		t.Errorf("unexpected error after removing the fault: %v", err)
+	}
+}
+
+func TestExpiry(t *testing.T) {
+	injector, _ := newTestInjector()
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	injector.now = func() time.Time { return now }
+	expiresAt := now.Add(time.Minute)
+	if err := injector.Set(Fault{Name: "down", Target: "*", ErrorRate: 1, ExpiresAt: &expiresAt}); err != nil {
+		t.Fatal(err)
+	}
+	if err := injector.Inject(context.Background(), "kv"); err == nil {
+		t.Error("expected an injected error before the expiry")
+	}
+
+	now = expiresAt
+	if err := injector.Inject(context.Background(), "kv"); err != nil {
+		t.Errorf("unexpected error after the expiry: %v", err)
+	}
+	if len(injector.List()) != 0 {
+		t.Error("expected the fault to be removed")
+	}
+}
+
+func TestDisabled(t *testing.T) {
+	injector := NewInjector(false)
+	if err := injector.Set(Fault{Name: "down", Target: "*", ErrorRate: 1}); err == nil {
+		t.Error("expected faults to be rejected when disabled")
+	}
+	if injector.Transport(http.DefaultTransport) != http.DefaultTransport {
+		t.Error("expected the transport to be returned as is")
+	}
+}
+
+func TestTransport(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	injector, _ := newTestInjector()
+	client := &http.Client{Transport: injector.Transport(http.DefaultTransport)}
+
+	res, err := client.Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusNoContent {
+		t.Errorf("expected the request to pass, got %d", res.StatusCode)
+	}
+
+	if err := injector.Set(Fault{Name: "limited", Target: "http:127.0.0.1", ErrorRate: 1, StatusCode: http.StatusTooManyRequests}); err != nil {
+		t.Fatal(err)
+	}
+	res, err = client.Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusTooManyRequests || res.Header.Get("X-Kled-Chaos") != "injected" {
+		t.Errorf("expected an injected 429, got %d", res.StatusCode)
+	}
+
+	if err := injector.Set(Fault{Name: "limited", Target: "http:*", DropRate: 1}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.Get(server.URL); !errors.Is(err, ErrDropped) {
+		t.Errorf("expected a dropped connection, got %v", err)
+	}
+}
@@ -0,0 +1,26 @@
+package chaos
+
+import (
+	"encoding/json"
+	"os"
+)
+
+type Config struct {
+	// Enabled allows injecting faults. It should only be set in staging.
+	Enabled bool `json:"enabled"`
+	// Faults are active from the start, e.g. for a resilience test run.
+	Faults []Fault `json:"faults,omitempty"`
+}
+
+// ConfigFromEnv reads AGENT_CHAOS_ENABLED and AGENT_CHAOS_FAULTS, a JSON
+// list of faults. Invalid faults are logged and ignored.
+func ConfigFromEnv() Config {
+	config := Config{Enabled: os.Getenv("AGENT_CHAOS_ENABLED") == "true"}
+	if value := os.Getenv("AGENT_CHAOS_FAULTS"); value != "" {
+		if err := json.Unmarshal([]byte(value), &config.Faults); err != nil {
+			chaosLogger.Printf("AGENT_CHAOS_FAULTS must be a JSON list of faults: %v", err)
+			config.Faults = nil
+		}
+	}
+	return config
+}
@@ -0,0 +1,59 @@
+package chaos
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// Transport wraps an HTTP transport with the faults of target
+// "http:<host>". Failed calls get a response with the fault's status code,
+// dropped calls an error as if the connection was reset. Without injection
+// the transport is returned as is.
+func (i *Injector) Transport(base http.RoundTripper) http.RoundTripper {
+	if !i.Enabled() {
+		return base
+	}
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return &transport{injector: i, base: base}
+}
+
+type transport struct {
+	injector *Injector
+	base     http.RoundTripper
+}
+
+func (t *transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	target := "http:" + req.URL.Hostname()
+	result := t.injector.decide(target)
+	if result.delay > 0 {
+		if err := t.injector.sleep(req.Context(), result.delay); err != nil {
+			return nil, err
+		}
+	}
+	if result.err == nil {
+		return t.base.RoundTrip(req)
+	}
+	if req.Body != nil {
+		_ = req.Body.Close()
+	}
+	if errors.Is(result.err, ErrDropped) {
+		return nil, result.err
+	}
+
+	body := result.err.Error()
+	return &http.Response{
+		Status:        http.StatusText(result.statusCode),
+		StatusCode:    result.statusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        http.Header{"Content-Type": []string{"text/plain"}, "X-Kled-Chaos": []string{"injected"}},
+		Body:          io.NopCloser(strings.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}, nil
+}
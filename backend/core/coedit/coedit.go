@@ -0,0 +1,217 @@
+// Package coedit relays shared terminal sessions between the participants
+// of a workspace, so that a human and an agent, or two humans, can debug
+// together in the same environment.
+//
+// Participants connect over WebSocket and exchange JSON messages. A
+// connection may follow several sessions, so session messages carry the
+// session ID. Terminal data is base64 encoded:
+//
+//	client -> server   {"type": "open", "command": ["bash"], "size": {"columns": 80, "rows": 24}}
+//	                   {"type": "attach", "session": "s1"}
+//	                   {"type": "detach", "session": "s1"}
+//	                   {"type": "input", "session": "s1", "data": "bHMNCg=="}
+//	                   {"type": "resize", "session": "s1", "size": {"columns": 120, "rows": 40}}
+//	                   {"type": "close", "session": "s1"}
+//	                   {"type": "state", "state": {"focus": "s1"}}
+//	server -> client   {"type": "welcome", "participant": {...}, "participants": [...], "sessions": [...]}
+//	                   {"type": "output", "session": "s1", "data": "..."}
+//	                   {"type": "presence", "participants": [...]}
+//	                   {"type": "sessions", "sessions": [...]}
+//	                   {"type": "exit", "session": "s1", "code": 0}
+//	                   {"type": "error", "session": "s1", "message": "..."}
+//
+// Attaching replays the recent output of a session. The last resize wins,
+// and read-only participants may only watch. Sessions are closed once the
+// last participant leaves the workspace.
+package coedit
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/spectrumwebco/agent_runtime/backend/core/terminal"
+)
+
+// Message types.
+const (
+	TypeOpen   = "open"
+	TypeAttach = "attach"
+	TypeDetach = "detach"
+	TypeInput  = "input"
+	TypeResize = "resize"
+	TypeClose  = "close"
+	TypeState  = "state"
+
+	TypeWelcome  = "welcome"
+	TypeOutput   = "output"
+	TypePresence = "presence"
+	TypeSessions = "sessions"
+	TypeExit     = "exit"
+	TypeError    = "error"
+)
+
+// Participant kinds.
+const (
+	KindHuman = "human"
+	KindAgent = "agent"
+)
+
+const (
+	DefaultScrollbackSize = 64 * 1024
+	DefaultMaxSessions    = 8
+)
+
+var (
+	ErrReadOnly        = errors.New("read-only participants can't control sessions")
+	ErrSessionNotFound = errors.New("session not found")
+	ErrTooManySessions = errors.New("too many sessions in the workspace")
+	ErrUnknownType     = errors.New("unknown message type")
+	ErrRoomClosed      = errors.New("workspace relay closed")
+	ErrInvalidTerminal = errors.New("invalid terminal size")
+	ErrNotAttached     = errors.New("not attached to the session")
+)
+
+// Message is a message of the relay protocol in either direction.
+type Message struct {
+	Type    string `json:"type"`
+	Session string `json:"session,omitempty"`
+
+	Command []string               `json:"command,omitempty"`
+	Size    *terminal.Size         `json:"size,omitempty"`
+	Data    []byte                 `json:"data,omitempty"`
+	State   map[string]interface{} `json:"state,omitempty"`
+
+	Participant  *Participant  `json:"participant,omitempty"`
+	Participants []Participant `json:"participants,omitempty"`
+	Sessions     []SessionInfo `json:"sessions,omitempty"`
+
+	Code    int    `json:"code,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+// Participant is a connection to the relay. A user connected twice is two
+// participants with the same UserID.
+type Participant struct {
+	ID       string    `json:"id"`
+	UserID   string    `json:"user_id"`
+	Name     string    `json:"name"`
+	Kind     string    `json:"kind"`
+	ReadOnly bool      `json:"read_only,omitempty"`
+	JoinedAt time.Time `json:"joined_at"`
+
+	// State is free-form presence state set by the client, e.g. the focused
+	// session or a cursor position.
+	State map[string]interface{} `json:"state,omitempty"`
+}
+
+// Peer delivers messages to a participant. Send is called with the room
+// locked, so it must not call back into the room.
+type Peer interface {
+	Send(message *Message) error
+}
+
+type Options struct {
+	// Command is run by sessions opened without a command.
+	Command        []string
+	ScrollbackSize int
+	MaxSessions    int
+}
+
+// Hub holds the relay rooms, one per workspace.
+type Hub struct {
+	executor terminal.Executor
+	options  Options
+
+	// OnPresence, if set, is called with the participants of a workspace
+	// whenever they change, e.g. to publish presence to other channels. It
+	// is called with the room locked.
+	OnPresence func(workspaceID string, participants []Participant)
+
+	mu    sync.Mutex
+	rooms map[string]*Room
+}
+
+func NewHub(executor terminal.Executor, options Options) *Hub {
+	if len(options.Command) == 0 {
+		options.Command = terminal.DefaultCommand
+	}
+	if options.ScrollbackSize <= 0 {
+		options.ScrollbackSize = DefaultScrollbackSize
+	}
+	if options.MaxSessions <= 0 {
+		options.MaxSessions = DefaultMaxSessions
+	}
+	return &Hub{executor: executor, options: options, rooms: map[string]*Room{}}
+}
+
+// Join adds a participant to the room of the workspace and sends it the
+// welcome message. The returned member handles the participant's messages
+// until Leave is called.
+func (h *Hub) Join(workspaceID string, participant Participant, peer Peer) (*Member, error) {
+	if participant.Kind == "" {
+		participant.Kind = KindHuman
+	}
+	if participant.JoinedAt.IsZero() {
+		participant.JoinedAt = time.Now()
+	}
+
+	for {
+		h.mu.Lock()
+		room, ok := h.rooms[workspaceID]
+		if !ok {
+			ctx, cancel := context.WithCancel(context.Background())
+			room = &Room{
+				hub:         h,
+				workspaceID: workspaceID,
+				ctx:         ctx,
+				cancel:      cancel,
+				members:     map[string]*Member{},
+				sessions:    map[string]*session{},
+			}
+			h.rooms[workspaceID] = room
+		}
+		h.mu.Unlock()
+
+		member, err := room.join(participant, peer)
+		if errors.Is(err, ErrRoomClosed) {
+			// the room closed between the lookup and the join
+			continue
+		}
+		return member, err
+	}
+}
+
+// Participants returns the participants connected to the workspace.
+func (h *Hub) Participants(workspaceID string) []Participant {
+	h.mu.Lock()
+	room, ok := h.rooms[workspaceID]
+	h.mu.Unlock()
+	if !ok {
+		return nil
+	}
+
+	room.mu.Lock()
+	defer room.mu.Unlock()
+	return room.participantsLocked()
+}
+
+func (h *Hub) removeRoom(room *Room) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.rooms[room.workspaceID] == room {
+		delete(h.rooms, room.workspaceID)
+	}
+}
+
+func errorMessage(sessionID string, err error) *Message {
+	return &Message{Type: TypeError, Session: sessionID, Message: err.Error()}
+}
+
+func validSize(size *terminal.Size) error {
+	if size == nil || size.Columns == 0 || size.Rows == 0 {
+		return ErrInvalidTerminal
+	}
+	return nil
+}
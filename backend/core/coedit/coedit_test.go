@@ -0,0 +1,271 @@
+package coedit
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/spectrumwebco/agent_runtime/backend/core/terminal"
+)
+
+// echoExecutor echoes input lines until it reads "exit". Canceled sessions
+// are reported on canceled.
+type echoExecutor struct {
+	sizes    chan terminal.Size
+	canceled chan struct{}
+}
+
+func (e *echoExecutor) Exec(ctx context.Context, workspaceID string, options terminal.ExecOptions) (int, error) {
+	go func() {
+		for size := range options.Sizes {
+			e.sizes <- size
+		}
+	}()
+
+	scanner := bufio.NewScanner(options.Stdin)
+	for scanner.Scan() {
+		if scanner.Text() == "exit" {
+			return 3, nil
+		}
+		if _, err := options.Stdout.Write([]byte(workspaceID + ": " + scanner.Text() + "\n")); err != nil {
+			return 0, err
+		}
+	}
+	<-ctx.Done()
+	if e.canceled != nil {
+		e.canceled <- struct{}{}
+	}
+	return 0, ctx.Err()
+}
+
+// testPeer collects the messages sent to a participant.
+type testPeer struct {
+	messages chan *Message
+}
+
+func newTestPeer() *testPeer {
+	return &testPeer{messages: make(chan *Message, 64)}
+}
+
+func (p *testPeer) Send(message *Message) error {
+	p.messages <- message
+	return nil
+}
+
+// next returns the next message of type messageType, skipping others.
+func (p *testPeer) next(t *testing.T, messageType string) *Message {
+	t.Helper()
+
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case message := <-p.messages:
+			if message.Type == messageType {
+				return message
+			}
+		case <-timeout:
+			t.Fatalf("no %s message", messageType)
+			return nil
+		}
+	}
+}
+
+func join(t *testing.T, hub *Hub, participant Participant) (*Member, *testPeer) {
+	t.Helper()
+
+	peer := newTestPeer()
+	member, err := hub.Join("ws-1", participant, peer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return member, peer
+}
+
+func TestRelay(t *testing.T) {
+	executor := &echoExecutor{sizes: make(chan terminal.Size, 8)}
+	hub := NewHub(executor, Options{})
+	var presence [][]Participant
+	hub.OnPresence = func(workspaceID string, participants []Participant) {
+		presence = append(presence, participants)
+	}
+
+	alice, alicePeer := join(t, hub, Participant{ID: "p1", UserID: "alice", Name: "Alice"})
+	welcome := alicePeer.next(t, TypeWelcome)
+	if welcome.Participant.Kind != KindHuman || len(welcome.Participants) != 1 || len(welcome.Sessions) != 0 {
+		t.Fatalf("unexpected welcome %+v", welcome)
+	}
+
+	alice.Handle(&Message{Type: TypeOpen, Size: &terminal.Size{Columns: 100, Rows: 30}})
+	sessions := alicePeer.next(t, TypeSessions).Sessions
+	if len(sessions) != 1 || sessions[0].OpenedBy != "p1" || sessions[0].Attached[0] != "p1" {
+		t.Fatalf("unexpected sessions %+v", sessions)
+	}
+	sessionID := sessions[0].ID
+	if size := <-executor.sizes; size != (terminal.Size{Columns: 100, Rows: 30}) {
+		t.Errorf("unexpected initial size %v", size)
+	}
+
+	alice.Handle(&Message{Type: TypeInput, Session: sessionID, Data: []byte("make test\n")})
+	if output := alicePeer.next(t, TypeOutput); string(output.Data) != "ws-1: make test\n" {
+		t.Errorf("unexpected output %q", output.Data)
+	}
+
+	// the agent joins late and catches up from the scrollback
+	agent, agentPeer := join(t, hub, Participant{ID: "p2", UserID: "agent", Kind: KindAgent})
+	if welcome := agentPeer.next(t, TypeWelcome); len(welcome.Participants) != 2 || len(welcome.Sessions) != 1 {
+		t.Fatalf("unexpected welcome %+v", welcome)
+	}
+	if participants := alicePeer.next(t, TypePresence).Participants; len(participants) != 2 || participants[1].Kind != KindAgent {
+		t.Errorf("unexpected presence %+v", participants)
+	}
+
+	agent.Handle(&Message{Type: TypeInput, Session: sessionID, Data: []byte("ls\n")})
+	if err := agentPeer.next(t, TypeError); err.Message != ErrNotAttached.Error() {
+		t.Errorf("unexpected error %q", err.Message)
+	}
+	agent.Handle(&Message{Type: TypeAttach, Session: sessionID})
+	if output := agentPeer.next(t, TypeOutput); string(output.Data) != "ws-1: make test\n" {
+		t.Errorf("unexpected scrollback %q", output.Data)
+	}
+
+	agent.Handle(&Message{Type: TypeInput, Session: sessionID, Data: []byte("ls\n")})
+	for _, peer := range []*testPeer{alicePeer, agentPeer} {
+		if output := peer.next(t, TypeOutput); string(output.Data) != "ws-1: ls\n" {
+			t.Errorf("unexpected output %q", output.Data)
+		}
+	}
+
+	agent.Handle(&Message{Type: TypeResize, Session: sessionID, Size: &terminal.Size{Columns: 80, Rows: 20}})
+	if size := <-executor.sizes; size != (terminal.Size{Columns: 80, Rows: 20}) {
+		t.Errorf("unexpected size %v", size)
+	}
+
+	// viewers only watch
+	viewer, viewerPeer := join(t, hub, Participant{ID: "p3", UserID: "bob", ReadOnly: true})
+	alicePeer.next(t, TypePresence)
+	viewer.Handle(&Message{Type: TypeAttach, Session: sessionID})
+	viewerPeer.next(t, TypeOutput)
+	viewer.Handle(&Message{Type: TypeInput, Session: sessionID, Data: []byte("rm -rf /\n")})
+	if err := viewerPeer.next(t, TypeError); err.Message != ErrReadOnly.Error() {
+		t.Errorf("unexpected error %q", err.Message)
+	}
+
+	viewer.Handle(&Message{Type: TypeState, State: map[string]interface{}{"focus": sessionID}})
+	if participants := alicePeer.next(t, TypePresence).Participants; participants[2].State["focus"] != sessionID {
+		t.Errorf("unexpected presence %+v", participants)
+	}
+
+	alice.Handle(&Message{Type: TypeInput, Session: sessionID, Data: []byte("exit\n")})
+	for _, peer := range []*testPeer{alicePeer, agentPeer, viewerPeer} {
+		if exit := peer.next(t, TypeExit); exit.Session != sessionID || exit.Code != 3 {
+			t.Errorf("unexpected exit %+v", exit)
+		}
+	}
+
+	viewer.Leave()
+	agent.Leave()
+	alice.Leave()
+	if participants := hub.Participants("ws-1"); len(participants) != 0 {
+		t.Errorf("unexpected participants %+v", participants)
+	}
+	if len(presence) == 0 || presence[len(presence)-1] != nil {
+		t.Errorf("expected empty presence after the last participant left")
+	}
+}
+
+func TestLastLeaveClosesSessions(t *testing.T) {
+	executor := &echoExecutor{sizes: make(chan terminal.Size, 8), canceled: make(chan struct{}, 1)}
+	hub := NewHub(executor, Options{MaxSessions: 1})
+
+	member, peer := join(t, hub, Participant{ID: "p1", UserID: "alice"})
+	member.Handle(&Message{Type: TypeOpen})
+	peer.next(t, TypeSessions)
+	member.Handle(&Message{Type: TypeOpen})
+	if err := peer.next(t, TypeError); err.Message != ErrTooManySessions.Error() {
+		t.Errorf("unexpected error %q", err.Message)
+	}
+
+	member.Leave()
+	select {
+	case <-executor.canceled:
+	case <-time.After(5 * time.Second):
+		t.Fatal("session wasn't closed")
+	}
+
+	// joining again starts over in a new room
+	_, peer = join(t, hub, Participant{ID: "p1", UserID: "alice"})
+	if welcome := peer.next(t, TypeWelcome); len(welcome.Sessions) != 0 {
+		t.Errorf("unexpected sessions %+v", welcome.Sessions)
+	}
+}
+
+func TestServe(t *testing.T) {
+	hub := NewHub(&echoExecutor{sizes: make(chan terminal.Size, 8)}, Options{})
+	results := make(chan error, 1)
+	upgrader := websocket.Upgrader{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		results <- Serve(conn, hub, "ws-1", Participant{ID: "p1", UserID: "alice"})
+	}))
+	defer server.Close()
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	read := func(messageType string) *Message {
+		t.Helper()
+		for {
+			_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+			message := &Message{}
+			if err := conn.ReadJSON(message); err != nil {
+				t.Fatal(err)
+			}
+			if message.Type == messageType {
+				return message
+			}
+		}
+	}
+
+	read(TypeWelcome)
+	if err := conn.WriteMessage(websocket.TextMessage, []byte("{")); err != nil {
+		t.Fatal(err)
+	}
+	if message := read(TypeError); !strings.HasPrefix(message.Message, "invalid message") {
+		t.Errorf("unexpected error %q", message.Message)
+	}
+
+	if err := conn.WriteJSON(&Message{Type: TypeOpen}); err != nil {
+		t.Fatal(err)
+	}
+	sessionID := read(TypeSessions).Sessions[0].ID
+	if err := conn.WriteJSON(&Message{Type: TypeInput, Session: sessionID, Data: []byte("hello\n")}); err != nil {
+		t.Fatal(err)
+	}
+	if message := read(TypeOutput); string(message.Data) != "ws-1: hello\n" {
+		t.Errorf("unexpected output %q", message.Data)
+	}
+
+	_ = conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""))
+	select {
+	case err := <-results:
+		if err != nil && !errors.Is(err, websocket.ErrCloseSent) {
+			t.Errorf("unexpected error %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Serve didn't return")
+	}
+	if participants := hub.Participants("ws-1"); len(participants) != 0 {
+		t.Errorf("unexpected participants %+v", participants)
+	}
+}
@@ -0,0 +1,409 @@
+package coedit
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/spectrumwebco/agent_runtime/backend/core/terminal"
+)
+
+// Room relays the sessions of one workspace between its participants.
+type Room struct {
+	hub         *Hub
+	workspaceID string
+	ctx         context.Context
+	cancel      context.CancelFunc
+
+	mu          sync.Mutex
+	closed      bool
+	members     map[string]*Member
+	sessions    map[string]*session
+	nextSession int
+}
+
+// Member is a participant that joined a room.
+type Member struct {
+	room        *Room
+	participant Participant
+	peer        Peer
+	attached    map[string]bool
+}
+
+// session is an exec session shared by the participants attached to it.
+type session struct {
+	info       SessionInfo
+	stdin      *io.PipeWriter
+	sizes      chan terminal.Size
+	cancel     context.CancelFunc
+	scrollback []byte
+}
+
+// SessionInfo describes a shared session.
+type SessionInfo struct {
+	ID        string        `json:"id"`
+	Command   []string      `json:"command"`
+	OpenedBy  string        `json:"opened_by"`
+	StartedAt time.Time     `json:"started_at"`
+	Size      terminal.Size `json:"size"`
+	// Attached holds the IDs of the participants following the session.
+	Attached []string `json:"attached"`
+}
+
+func (r *Room) join(participant Participant, peer Peer) (*Member, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.closed {
+		return nil, ErrRoomClosed
+	}
+	if _, ok := r.members[participant.ID]; ok {
+		return nil, fmt.Errorf("participant %s already joined", participant.ID)
+	}
+
+	member := &Member{room: r, participant: participant, peer: peer, attached: map[string]bool{}}
+	r.members[participant.ID] = member
+	_ = peer.Send(&Message{
+		Type:         TypeWelcome,
+		Participant:  &member.participant,
+		Participants: r.participantsLocked(),
+		Sessions:     r.sessionsLocked(),
+	})
+	r.broadcastPresenceLocked()
+	return member, nil
+}
+
+// Participant returns the participant of the member.
+func (m *Member) Participant() Participant {
+	return m.participant
+}
+
+// Leave removes the member from the room. The sessions of the room are
+// closed if it was the last member.
+func (m *Member) Leave() {
+	r := m.room
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.members[m.participant.ID] != m {
+		return
+	}
+
+	delete(r.members, m.participant.ID)
+	if len(r.members) > 0 {
+		r.broadcastPresenceLocked()
+		if len(m.attached) > 0 {
+			r.broadcastSessionsLocked()
+		}
+		return
+	}
+
+	r.closed = true
+	r.cancel()
+	for _, s := range r.sessions {
+		_ = s.stdin.Close()
+	}
+	r.hub.removeRoom(r)
+	if r.hub.OnPresence != nil {
+		r.hub.OnPresence(r.workspaceID, nil)
+	}
+}
+
+// Handle processes a message of the member. Errors are sent back to the
+// member as error messages.
+func (m *Member) Handle(message *Message) {
+	var err error
+	switch message.Type {
+	case TypeOpen:
+		err = m.open(message)
+	case TypeAttach:
+		err = m.attach(message.Session)
+	case TypeDetach:
+		err = m.detach(message.Session)
+	case TypeInput:
+		err = m.input(message.Session, message.Data)
+	case TypeResize:
+		err = m.resize(message.Session, message.Size)
+	case TypeClose:
+		err = m.close(message.Session)
+	case TypeState:
+		m.setState(message.State)
+	default:
+		err = fmt.Errorf("%w %q", ErrUnknownType, message.Type)
+	}
+
+	if err != nil {
+		m.sendError(message.Session, err)
+	}
+}
+
+func (m *Member) sendError(sessionID string, err error) {
+	m.room.mu.Lock()
+	defer m.room.mu.Unlock()
+	_ = m.peer.Send(errorMessage(sessionID, err))
+}
+
+func (m *Member) open(message *Message) error {
+	if m.participant.ReadOnly {
+		return ErrReadOnly
+	}
+	size := terminal.DefaultSize
+	if message.Size != nil {
+		if err := validSize(message.Size); err != nil {
+			return err
+		}
+		size = *message.Size
+	}
+	command := message.Command
+	if len(command) == 0 {
+		command = m.room.hub.options.Command
+	}
+
+	r := m.room
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.closed {
+		return ErrRoomClosed
+	} else if len(r.sessions) >= r.hub.options.MaxSessions {
+		return ErrTooManySessions
+	}
+
+	r.nextSession++
+	ctx, cancel := context.WithCancel(r.ctx)
+	stdinReader, stdinWriter := io.Pipe()
+	s := &session{
+		info: SessionInfo{
+			ID:        fmt.Sprintf("s%d", r.nextSession),
+			Command:   command,
+			OpenedBy:  m.participant.ID,
+			StartedAt: time.Now(),
+			Size:      size,
+		},
+		stdin:  stdinWriter,
+		sizes:  make(chan terminal.Size, 8),
+		cancel: cancel,
+	}
+	s.sizes <- size
+	r.sessions[s.info.ID] = s
+	m.attached[s.info.ID] = true
+
+	go func() {
+		code, err := r.hub.executor.Exec(ctx, r.workspaceID, terminal.ExecOptions{
+			Command: command,
+			Stdin:   stdinReader,
+			Stdout:  &sessionWriter{room: r, session: s},
+			Sizes:   s.sizes,
+		})
+		_ = stdinReader.Close()
+		r.exited(s, code, err)
+	}()
+
+	r.broadcastSessionsLocked()
+	return nil
+}
+
+func (m *Member) attach(sessionID string) error {
+	r := m.room
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	s, ok := r.sessions[sessionID]
+	if !ok {
+		return ErrSessionNotFound
+	}
+	if m.attached[sessionID] {
+		return nil
+	}
+
+	m.attached[sessionID] = true
+	if len(s.scrollback) > 0 {
+		_ = m.peer.Send(&Message{Type: TypeOutput, Session: sessionID, Data: append([]byte(nil), s.scrollback...)})
+	}
+	r.broadcastSessionsLocked()
+	return nil
+}
+
+func (m *Member) detach(sessionID string) error {
+	r := m.room
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if !m.attached[sessionID] {
+		return ErrNotAttached
+	}
+
+	delete(m.attached, sessionID)
+	r.broadcastSessionsLocked()
+	return nil
+}
+
+func (m *Member) input(sessionID string, data []byte) error {
+	s, err := m.controlled(sessionID)
+	if err != nil {
+		return err
+	}
+
+	// the pipe blocks until the process reads, so write without the lock
+	if _, err := s.stdin.Write(data); err != nil {
+		return fmt.Errorf("session %s closed", sessionID)
+	}
+	return nil
+}
+
+func (m *Member) resize(sessionID string, size *terminal.Size) error {
+	if err := validSize(size); err != nil {
+		return err
+	}
+	s, err := m.controlled(sessionID)
+	if err != nil {
+		return err
+	}
+
+	r := m.room
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	s.info.Size = *size
+	select {
+	case s.sizes <- *size:
+	default:
+		// the process is behind on resizes, the next one catches up
+	}
+	r.broadcastSessionsLocked()
+	return nil
+}
+
+func (m *Member) close(sessionID string) error {
+	s, err := m.controlled(sessionID)
+	if err != nil {
+		return err
+	}
+
+	s.cancel()
+	_ = s.stdin.Close()
+	return nil
+}
+
+func (m *Member) setState(state map[string]interface{}) {
+	r := m.room
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	m.participant.State = state
+	r.broadcastPresenceLocked()
+}
+
+// controlled returns the session if the member may control it, which needs
+// write access and being attached.
+func (m *Member) controlled(sessionID string) (*session, error) {
+	if m.participant.ReadOnly {
+		return nil, ErrReadOnly
+	}
+
+	r := m.room
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	s, ok := r.sessions[sessionID]
+	if !ok {
+		return nil, ErrSessionNotFound
+	} else if !m.attached[sessionID] {
+		return nil, ErrNotAttached
+	}
+	return s, nil
+}
+
+// sessionWriter fans the output of a session out to the attached members.
+type sessionWriter struct {
+	room    *Room
+	session *session
+}
+
+func (w *sessionWriter) Write(p []byte) (int, error) {
+	r := w.room
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	s := w.session
+	s.scrollback = append(s.scrollback, p...)
+	if limit := r.hub.options.ScrollbackSize; len(s.scrollback) > limit {
+		s.scrollback = append([]byte(nil), s.scrollback[len(s.scrollback)-limit:]...)
+	}
+
+	data := append([]byte(nil), p...)
+	for _, member := range r.members {
+		if member.attached[s.info.ID] {
+			_ = member.peer.Send(&Message{Type: TypeOutput, Session: s.info.ID, Data: data})
+		}
+	}
+	return len(p), nil
+}
+
+func (r *Room) exited(s *session, code int, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	s.cancel()
+	delete(r.sessions, s.info.ID)
+
+	message := &Message{Type: TypeExit, Session: s.info.ID, Code: code}
+	if err != nil {
+		message.Message = err.Error()
+	}
+	for _, member := range r.members {
+		if member.attached[s.info.ID] {
+			delete(member.attached, s.info.ID)
+			_ = member.peer.Send(message)
+		}
+	}
+	if !r.closed {
+		r.broadcastSessionsLocked()
+	}
+}
+
+func (r *Room) participantsLocked() []Participant {
+	participants := make([]Participant, 0, len(r.members))
+	for _, member := range r.members {
+		participants = append(participants, member.participant)
+	}
+	sort.Slice(participants, func(i, j int) bool {
+		if !participants[i].JoinedAt.Equal(participants[j].JoinedAt) {
+			return participants[i].JoinedAt.Before(participants[j].JoinedAt)
+		}
+		return participants[i].ID < participants[j].ID
+	})
+	return participants
+}
+
+func (r *Room) sessionsLocked() []SessionInfo {
+	sessions := make([]SessionInfo, 0, len(r.sessions))
+	for _, s := range r.sessions {
+		info := s.info
+		info.Attached = []string{}
+		for _, member := range r.members {
+			if member.attached[info.ID] {
+				info.Attached = append(info.Attached, member.participant.ID)
+			}
+		}
+		sort.Strings(info.Attached)
+		sessions = append(sessions, info)
+	}
+	sort.Slice(sessions, func(i, j int) bool {
+		return sessions[i].StartedAt.Before(sessions[j].StartedAt) ||
+			sessions[i].StartedAt.Equal(sessions[j].StartedAt) && sessions[i].ID < sessions[j].ID
+	})
+	return sessions
+}
+
+func (r *Room) broadcastPresenceLocked() {
+	participants := r.participantsLocked()
+	r.broadcastLocked(&Message{Type: TypePresence, Participants: participants})
+	if r.hub.OnPresence != nil {
+		r.hub.OnPresence(r.workspaceID, participants)
+	}
+}
+
+func (r *Room) broadcastSessionsLocked() {
+	r.broadcastLocked(&Message{Type: TypeSessions, Sessions: r.sessionsLocked()})
+}
+
+func (r *Room) broadcastLocked(message *Message) {
+	for _, member := range r.members {
+		_ = member.peer.Send(message)
+	}
+}
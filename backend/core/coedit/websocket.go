@@ -0,0 +1,62 @@
+package coedit
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// writeTimeout drops participants that stop reading, so that a slow
+// browser can't stall the output of the others.
+const writeTimeout = 10 * time.Second
+
+// websocketPeer sends relay messages as JSON text messages.
+type websocketPeer struct {
+	conn *websocket.Conn
+	mu   sync.Mutex
+}
+
+func (p *websocketPeer) Send(message *Message) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	_ = p.conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+	if err := p.conn.WriteJSON(message); err != nil {
+		// unblocks the read loop, which makes the participant leave
+		_ = p.conn.Close()
+		return err
+	}
+	return nil
+}
+
+// Serve joins conn to the room of the workspace and relays its messages
+// until the connection closes. conn is closed when Serve returns.
+func Serve(conn *websocket.Conn, hub *Hub, workspaceID string, participant Participant) error {
+	defer conn.Close()
+
+	member, err := hub.Join(workspaceID, participant, &websocketPeer{conn: conn})
+	if err != nil {
+		return err
+	}
+	defer member.Leave()
+
+	for {
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			if _, ok := err.(*websocket.CloseError); ok {
+				return nil
+			}
+			return err
+		}
+
+		message := &Message{}
+		if err := json.Unmarshal(data, message); err != nil {
+			member.sendError("", fmt.Errorf("invalid message: %v", err))
+			continue
+		}
+		member.Handle(message)
+	}
+}
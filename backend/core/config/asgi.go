@@ -6,6 +6,8 @@ import (
 
 	"github.com/gorilla/mux"
 	"github.com/gorilla/websocket"
+	"github.com/spectrumwebco/agent_runtime/backend/core/jwtauth"
+	"github.com/spectrumwebco/agent_runtime/backend/core/kerrors"
 	"github.com/spectrumwebco/agent_runtime/pkg/djangogo/core"
 	"github.com/spectrumwebco/agent_runtime/pkg/djangogo/wsgi"
 )
@@ -40,10 +42,31 @@ var upgrader = websocket.Upgrader{
 	},
 }
 
+// WebSocketHandler upgrades the connection for consumer. Handshakes with
+// an invalid Supabase access token are rejected before the upgrade; the
+// user of a valid one is passed to the consumer as user_id, and its claims
+// are in the context of the connection.
 func WebSocketHandler(consumer WebSocketHandler) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		vars := mux.Vars(r)
-		conn, err := upgrader.Upgrade(w, r, nil)
+		req := r
+		if verifier := jwtauth.DefaultVerifier(); verifier != nil {
+			authenticated, err := verifier.Authenticate(r)
+			if err != nil {
+				kerrors.WriteJSON(w, err)
+				return
+			}
+			if claims := jwtauth.FromContext(authenticated.Context()); claims != nil {
+				if vars == nil {
+					vars = map[string]string{}
+				}
+				vars["user_id"] = claims.Subject
+			}
+			// the consumer reads the claims from the context of the connection
+			req = authenticated
+		}
+
+		conn, err := upgrader.Upgrade(w, req, nil)
 		if err != nil {
 			log.Printf("Error upgrading connection: %v", err)
 			return
@@ -290,10 +290,25 @@ func GetVectorDBConfig() map[string]interface{} {
 }
 
 func GetRocketMQConfig() map[string]interface{} {
-	return map[string]interface{}{
+	apiSettings := NewApiSettings()
+	rocketmqConfig := map[string]interface{}{
 		"host": DBSettings.RocketMQHost,
 		"port": DBSettings.RocketMQPort,
+		"tls":  apiSettings.RocketMQTLS,
+	}
+	for key, value := range map[string]string{
+		"access_key":               apiSettings.RocketMQAccessKey,
+		"secret_key":               apiSettings.RocketMQSecretKey,
+		"tls_ca_location":          apiSettings.RocketMQTLSCALocation,
+		"tls_certificate_location": apiSettings.RocketMQTLSCertLocation,
+		"tls_key_location":         apiSettings.RocketMQTLSKeyLocation,
+		"tls_vault_path":           apiSettings.RocketMQTLSVaultPath,
+	} {
+		if value != "" {
+			rocketmqConfig[key] = value
+		}
 	}
+	return rocketmqConfig
 }
 
 func init() {
@@ -8,15 +8,49 @@ import (
 	"github.com/spectrumwebco/agent_runtime/pkg/djangogo/core"
 )
 
+// GetKafkaSecurityConfig returns the TLS and SASL settings of the Kafka
+// clients. Empty settings are left out, so plaintext clusters keep working.
+func GetKafkaSecurityConfig() map[string]interface{} {
+	apiSettings := NewApiSettings()
+	securityConfig := map[string]interface{}{}
+	for key, value := range map[string]string{
+		"security_protocol":        apiSettings.KafkaSecurityProtocol,
+		"sasl_mechanism":           apiSettings.KafkaSASLMechanism,
+		"sasl_username":            apiSettings.KafkaSASLUsername,
+		"sasl_password":            apiSettings.KafkaSASLPassword,
+		"oauth_token_url":          apiSettings.KafkaOAuthTokenURL,
+		"oauth_client_id":          apiSettings.KafkaOAuthClientID,
+		"oauth_client_secret":      apiSettings.KafkaOAuthClientSecret,
+		"oauth_scope":              apiSettings.KafkaOAuthScope,
+		"ssl_ca_location":          apiSettings.KafkaSSLCALocation,
+		"ssl_certificate_location": apiSettings.KafkaSSLCertLocation,
+		"ssl_key_location":         apiSettings.KafkaSSLKeyLocation,
+		"ssl_key_password":         apiSettings.KafkaSSLKeyPassword,
+		"ssl_vault_path":           apiSettings.KafkaSSLVaultPath,
+	} {
+		if value != "" {
+			securityConfig[key] = value
+		}
+	}
+	return securityConfig
+}
+
+func withKafkaSecurity(kafkaConfig map[string]interface{}) map[string]interface{} {
+	for key, value := range GetKafkaSecurityConfig() {
+		kafkaConfig[key] = value
+	}
+	return kafkaConfig
+}
+
 func GetKafkaConfig() map[string]interface{} {
 	if InKubernetes {
-		return map[string]interface{}{
+		return withKafkaSecurity(map[string]interface{}{
 			"bootstrap_servers":   "kafka-broker.default.svc.cluster.local:9092",
 			"client_id":           "agent-runtime",
 			"group_id":            "agent-runtime-group",
 			"auto_offset_reset":   "earliest",
 			"enable_auto_commit":  true,
-		}
+		})
 	}
 
 	kafkaAvailable := false
@@ -29,13 +63,13 @@ func GetKafkaConfig() map[string]interface{} {
 	}
 
 	if kafkaAvailable {
-		return map[string]interface{}{
+		return withKafkaSecurity(map[string]interface{}{
 			"bootstrap_servers":   "localhost:9092",
 			"client_id":           "agent-runtime",
 			"group_id":            "agent-runtime-group",
 			"auto_offset_reset":   "earliest",
 			"enable_auto_commit":  true,
-		}
+		})
 	}
 
 	return map[string]interface{}{
@@ -65,20 +99,20 @@ func GetKafkaTopics() map[string]string {
 
 func GetKafkaConsumerConfig() map[string]interface{} {
 	kafkaConfig := GetKafkaConfig()
-	return map[string]interface{}{
+	return withKafkaSecurity(map[string]interface{}{
 		"bootstrap_servers":  kafkaConfig["bootstrap_servers"],
 		"group_id":           kafkaConfig["group_id"],
 		"auto_offset_reset":  kafkaConfig["auto_offset_reset"],
 		"enable_auto_commit": kafkaConfig["enable_auto_commit"],
-	}
+	})
 }
 
 func GetKafkaProducerConfig() map[string]interface{} {
 	kafkaConfig := GetKafkaConfig()
-	return map[string]interface{}{
+	return withKafkaSecurity(map[string]interface{}{
 		"bootstrap_servers": kafkaConfig["bootstrap_servers"],
 		"client_id":         kafkaConfig["client_id"],
-	}
+	})
 }
 
 func init() {
@@ -0,0 +1,207 @@
+// Package env reads the settings of the backend packages from the
+// environment.
+//
+// A Reader reads variables into the fields of a configuration that already
+// hold the defaults. Unset and empty variables leave a field alone, and so
+// do invalid values, which are logged with what the variable must be.
+package env
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Once returns a function that calls load the first time it is called and
+// returns that result from then on, such as the Default configuration of a
+// package read with FromEnv.
+func Once[T any](load func() T) func() T {
+	var (
+		value T
+		once  sync.Once
+	)
+	return func() T {
+		once.Do(func() {
+			value = load()
+		})
+		return value
+	}
+}
+
+type Reader struct {
+	logger *log.Logger
+}
+
+// NewReader returns a reader logging invalid values to logger.
+func NewReader(logger *log.Logger) *Reader {
+	return &Reader{logger: logger}
+}
+
+// Invalid logs that the variable name must be want rather than value.
+func (r *Reader) Invalid(name, want, value string) {
+	r.logger.Printf("%s must be %s, got %q", name, want, value)
+}
+
+func (r *Reader) String(name string, target *string) {
+	if value := os.Getenv(name); value != "" {
+		*target = value
+	}
+}
+
+// Bool accepts the values of strconv.ParseBool as well as yes and no.
+func (r *Reader) Bool(name string, target *bool) {
+	value := os.Getenv(name)
+	switch strings.ToLower(value) {
+	case "":
+		return
+	case "yes":
+		*target = true
+		return
+	case "no":
+		*target = false
+		return
+	}
+	parsed, err := strconv.ParseBool(value)
+	if err != nil {
+		r.Invalid(name, "a boolean", value)
+		return
+	}
+	*target = parsed
+}
+
+// Int reads an integer of at least min.
+func (r *Reader) Int(name string, target *int, min int) {
+	var parsed int64
+	if r.integer(name, &parsed, int64(min), strconv.IntSize) {
+		*target = int(parsed)
+	}
+}
+
+// IntRange reads an integer from min to max.
+func (r *Reader) IntRange(name string, target *int, min, max int) {
+	value := os.Getenv(name)
+	if value == "" {
+		return
+	}
+	parsed, err := strconv.Atoi(value)
+	if err != nil || parsed < min || parsed > max {
+		r.Invalid(name, fmt.Sprintf("an integer from %d to %d", min, max), value)
+		return
+	}
+	*target = parsed
+}
+
+// Int64 reads an integer of at least min.
+func (r *Reader) Int64(name string, target *int64, min int64) {
+	r.integer(name, target, min, 64)
+}
+
+func (r *Reader) integer(name string, target *int64, min int64, bits int) bool {
+	value := os.Getenv(name)
+	if value == "" {
+		return false
+	}
+	parsed, err := strconv.ParseInt(value, 10, bits)
+	if err != nil || parsed < min {
+		want := fmt.Sprintf("an integer of at least %d", min)
+		switch min {
+		case 0:
+			want = "a non-negative integer"
+		case 1:
+			want = "a positive integer"
+		}
+		r.Invalid(name, want, value)
+		return false
+	}
+	*target = parsed
+	return true
+}
+
+// Float reads a number of at least min.
+func (r *Reader) Float(name string, target *float64, min float64) {
+	value := os.Getenv(name)
+	if value == "" {
+		return
+	}
+	parsed, err := strconv.ParseFloat(value, 64)
+	if err != nil || parsed < min {
+		r.Invalid(name, fmt.Sprintf("a number of at least %g", min), value)
+		return
+	}
+	*target = parsed
+}
+
+// Duration reads a duration of at least min, such as 0 for durations
+// where 0 turns something off.
+func (r *Reader) Duration(name string, target *time.Duration, min time.Duration) {
+	value := os.Getenv(name)
+	if value == "" {
+		return
+	}
+	parsed, err := time.ParseDuration(value)
+	if err != nil || parsed < min {
+		want := fmt.Sprintf("a duration of at least %s", min)
+		if min == 0 {
+			want = "a non-negative duration"
+		}
+		r.Invalid(name, want, value)
+		return
+	}
+	*target = parsed
+}
+
+func (r *Reader) PositiveDuration(name string, target *time.Duration) {
+	value := os.Getenv(name)
+	if value == "" {
+		return
+	}
+	parsed, err := time.ParseDuration(value)
+	if err != nil || parsed <= 0 {
+		r.Invalid(name, "a positive duration", value)
+		return
+	}
+	*target = parsed
+}
+
+// OneOf reads one of choices.
+func (r *Reader) OneOf(name string, target *string, choices ...string) {
+	value := os.Getenv(name)
+	if value == "" {
+		return
+	}
+	for _, choice := range choices {
+		if value == choice {
+			*target = value
+			return
+		}
+	}
+	r.Invalid(name, "one of "+strings.Join(choices, ", "), value)
+}
+
+// List returns the comma-separated items of name without surrounding
+// spaces and empty items, or nil if it is unset.
+func (r *Reader) List(name string) []string {
+	var items []string
+	for _, item := range strings.Split(os.Getenv(name), ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// Pairs calls parse with the key and value of every comma-separated
+// key=value item of name. Items parse rejects are logged as not being
+// want, e.g. "signal=target pairs".
+func (r *Reader) Pairs(name, want string, parse func(key, value string) bool) {
+	for _, pair := range r.List(name) {
+		key, value, _ := strings.Cut(pair, "=")
+		if !parse(strings.TrimSpace(key), strings.TrimSpace(value)) {
+			r.logger.Printf("%s must hold %s, got %q", name, want, pair)
+		}
+	}
+}
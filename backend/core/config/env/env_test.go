@@ -0,0 +1,119 @@
+package env
+
+import (
+	"bytes"
+	"log"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestReader() (*Reader, *bytes.Buffer) {
+	var logs bytes.Buffer
+	return NewReader(log.New(&logs, "", 0)), &logs
+}
+
+func TestUnsetVariablesKeepDefaults(t *testing.T) {
+	read, logs := newTestReader()
+	t.Setenv("KLED_TEST_STRING", "")
+
+	text, flag, count, timeout := "default", true, 3, time.Second
+	read.String("KLED_TEST_STRING", &text)
+	read.Bool("KLED_TEST_BOOL", &flag)
+	read.Int("KLED_TEST_INT", &count, 1)
+	read.Duration("KLED_TEST_DURATION", &timeout, 0)
+
+	if text != "default" || !flag || count != 3 || timeout != time.Second {
+		t.Fatalf("got %q, %v, %d, %s, want the defaults", text, flag, count, timeout)
+	}
+	if logs.Len() != 0 {
+		t.Fatalf("unset variables were logged: %s", logs.String())
+	}
+}
+
+func TestInvalidValuesAreLoggedAndIgnored(t *testing.T) {
+	read, logs := newTestReader()
+	t.Setenv("KLED_TEST_BOOL", "maybe")
+	t.Setenv("KLED_TEST_INT", "0")
+	t.Setenv("KLED_TEST_DURATION", "30s")
+	t.Setenv("KLED_TEST_CHOICE", "sometimes")
+
+	flag, count, ttl, choice := true, 3, time.Hour, "always"
+	read.Bool("KLED_TEST_BOOL", &flag)
+	read.Int("KLED_TEST_INT", &count, 1)
+	read.Duration("KLED_TEST_DURATION", &ttl, time.Minute)
+	read.OneOf("KLED_TEST_CHOICE", &choice, "always", "never")
+
+	if !flag || count != 3 || ttl != time.Hour || choice != "always" {
+		t.Fatalf("got %v, %d, %s, %q, want the defaults", flag, count, ttl, choice)
+	}
+	for _, want := range []string{
+		`KLED_TEST_BOOL must be a boolean, got "maybe"`,
+		`KLED_TEST_INT must be a positive integer, got "0"`,
+		`KLED_TEST_DURATION must be a duration of at least 1m0s, got "30s"`,
+		`KLED_TEST_CHOICE must be one of always, never, got "sometimes"`,
+	} {
+		if !strings.Contains(logs.String(), want) {
+			t.Errorf("logs %q don't contain %q", logs.String(), want)
+		}
+	}
+}
+
+func TestValidValues(t *testing.T) {
+	read, _ := newTestReader()
+	t.Setenv("KLED_TEST_BOOL", "no")
+	t.Setenv("KLED_TEST_INT", "0")
+	t.Setenv("KLED_TEST_PORT", "6432")
+	t.Setenv("KLED_TEST_DURATION", "0s")
+	t.Setenv("KLED_TEST_LIST", " a, ,b ,")
+
+	flag, count, port, interval := true, 3, 5432, time.Minute
+	read.Bool("KLED_TEST_BOOL", &flag)
+	read.Int("KLED_TEST_INT", &count, 0)
+	read.IntRange("KLED_TEST_PORT", &port, 1, 65535)
+	read.Duration("KLED_TEST_DURATION", &interval, 0)
+
+	if flag || count != 0 || port != 6432 || interval != 0 {
+		t.Fatalf("got %v, %d, %d, %s", flag, count, port, interval)
+	}
+	if list := read.List("KLED_TEST_LIST"); !reflect.DeepEqual(list, []string{"a", "b"}) {
+		t.Fatalf("List returned %q", list)
+	}
+	if list := read.List("KLED_TEST_UNSET"); list != nil {
+		t.Fatalf("List of an unset variable returned %q", list)
+	}
+}
+
+func TestPairs(t *testing.T) {
+	read, logs := newTestReader()
+	t.Setenv("KLED_TEST_PAIRS", "postgres = 10s, dragonfly=soon")
+
+	timeouts := map[string]time.Duration{}
+	read.Pairs("KLED_TEST_PAIRS", "dependency=timeout pairs", func(key, value string) bool {
+		timeout, err := time.ParseDuration(value)
+		if err != nil {
+			return false
+		}
+		timeouts[key] = timeout
+		return true
+	})
+
+	if !reflect.DeepEqual(timeouts, map[string]time.Duration{"postgres": 10 * time.Second}) {
+		t.Fatalf("got %v", timeouts)
+	}
+	if want := `KLED_TEST_PAIRS must hold dependency=timeout pairs, got "dragonfly=soon"`; !strings.Contains(logs.String(), want) {
+		t.Fatalf("logs %q don't contain %q", logs.String(), want)
+	}
+}
+
+func TestOnceLoadsOnce(t *testing.T) {
+	loads := 0
+	load := Once(func() int {
+		loads++
+		return loads
+	})
+	if load() != 1 || load() != 1 || loads != 1 {
+		t.Fatalf("load ran %d times", loads)
+	}
+}
@@ -0,0 +1,154 @@
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/yaml"
+)
+
+// The formats settings are rendered in.
+const (
+	// FormatEnv is a .env file.
+	FormatEnv = "env"
+	// FormatHelm is chart values with the variables under env and
+	// secretEnv.
+	FormatHelm = "helm"
+	// FormatK8sSecret is a ConfigMap manifest of the variables and a Secret
+	// manifest of the secrets.
+	FormatK8sSecret = "k8s-secret"
+)
+
+// Formats are the formats Render supports.
+var Formats = []string{FormatEnv, FormatHelm, FormatK8sSecret}
+
+// envConfig is the configuration of a package, read by its FromEnv.
+type envConfig interface {
+	Variables() map[string]string
+}
+
+// Variables returns the environment variables NewApiSettings reads s from. Scalar
+// settings are AGENT_ and their JSON name in upper case; the configurations
+// of packages render their own variables.
+func (s *ApiSettings) Variables() map[string]string {
+	env := map[string]string{"AGENT_SECRET_KEY": GetSecretKey()}
+
+	value := reflect.ValueOf(*s)
+	for i := 0; i < value.NumField(); i++ {
+		field, fieldValue := value.Type().Field(i), value.Field(i)
+		if config, ok := fieldValue.Interface().(envConfig); ok {
+			for name, value := range config.Variables() {
+				env[name] = value
+			}
+			continue
+		}
+
+		name := "AGENT_" + strings.ToUpper(strings.Split(field.Tag.Get("json"), ",")[0])
+		switch fieldValue.Kind() {
+		case reflect.String:
+			env[name] = fieldValue.String()
+		case reflect.Int:
+			env[name] = strconv.FormatInt(fieldValue.Int(), 10)
+		case reflect.Bool:
+			env[name] = strconv.FormatBool(fieldValue.Bool())
+		case reflect.Slice:
+			env[name] = strings.Join(fieldValue.Interface().([]string), ",")
+		default:
+			panic(fmt.Sprintf("setting %s of kind %s can't be rendered", field.Name, fieldValue.Kind()))
+		}
+	}
+	return env
+}
+
+// IsSecret returns if an environment variable holds a password, key or
+// token, which is rendered into a Secret rather than a ConfigMap.
+func IsSecret(name string) bool {
+	for _, suffix := range []string{"_PASSWORD", "_KEY", "_SECRET", "_TOKEN"} {
+		if strings.HasSuffix(name, suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+// RenderOptions name the rendered Kubernetes objects.
+type RenderOptions struct {
+	// Name is the name of the ConfigMap; the Secret is Name-secrets.
+	Name      string
+	Namespace string
+}
+
+// Render renders the environment of settings in a format, so deployments
+// configure exactly the settings the Go code reads.
+func Render(settings *ApiSettings, format string, options RenderOptions) ([]byte, error) {
+	variables := settings.Variables()
+	env, secrets := map[string]string{}, map[string]string{}
+	for name, value := range variables {
+		if IsSecret(name) {
+			secrets[name] = value
+		} else {
+			env[name] = value
+		}
+	}
+
+	switch format {
+	case FormatEnv:
+		return renderEnvFile(variables), nil
+	case FormatHelm:
+		return yaml.Marshal(map[string]interface{}{"env": env, "secretEnv": secrets})
+	case FormatK8sSecret:
+		objectMeta := metav1.ObjectMeta{Name: options.Name, Namespace: options.Namespace}
+		configMap, err := yaml.Marshal(&corev1.ConfigMap{
+			TypeMeta:   metav1.TypeMeta{APIVersion: "v1", Kind: "ConfigMap"},
+			ObjectMeta: objectMeta,
+			Data:       env,
+		})
+		if err != nil {
+			return nil, err
+		}
+		objectMeta.Name += "-secrets"
+		secret, err := yaml.Marshal(&corev1.Secret{
+			TypeMeta:   metav1.TypeMeta{APIVersion: "v1", Kind: "Secret"},
+			ObjectMeta: objectMeta,
+			Type:       corev1.SecretTypeOpaque,
+			StringData: secrets,
+		})
+		if err != nil {
+			return nil, err
+		}
+		return append(append(configMap, []byte("---\n")...), secret...), nil
+	default:
+		return nil, fmt.Errorf("unknown format %q, expected one of %s", format, strings.Join(Formats, ", "))
+	}
+}
+
+// renderEnvFile writes NAME=value lines sorted by name. Values with
+// characters a shell or dotenv parser would interpret are quoted, in single
+// quotes where possible as neither expands variables in them.
+func renderEnvFile(env map[string]string) []byte {
+	names := make([]string, 0, len(env))
+	for name := range env {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var out bytes.Buffer
+	for _, name := range names {
+		value := env[name]
+		switch {
+		case !strings.ContainsAny(value, " \t\n\"'`$#\\;&|<>(){}*?"):
+		case !strings.ContainsAny(value, "'\n"):
+			value = "'" + value + "'"
+		default:
+			value = strconv.Quote(value)
+		}
+		fmt.Fprintf(&out, "%s=%s\n", name, value)
+	}
+	return out.Bytes()
+}
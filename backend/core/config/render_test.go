@@ -0,0 +1,81 @@
+package config
+
+import (
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// TestEnvRoundTrip checks that the rendered environment configures the
+// settings it was rendered from, so no setting is left out.
+func TestEnvRoundTrip(t *testing.T) {
+	configured := map[string]string{
+		"AGENT_SECRET_KEY":              "secret",
+		"AGENT_DEBUG":                   "false",
+		"AGENT_ALLOWED_HOSTS":           "kled.example.com,api.kled.example.com",
+		"AGENT_POSTGRES_PORT":           "6432",
+		"AGENT_POSTGRES_PASSWORD":       "postgres secret",
+		"AGENT_DRAGONFLY_CLIENT_CACHE":  "true",
+		"AGENT_HTTPS_PROXY":             "http://proxy:3128",
+		"AGENT_REDACTION_DETECTORS":     "email",
+		"AGENT_REDACTION_PATTERNS":      `{"ticket":"TCK-[0-9]+"}`,
+		"AGENT_WS_SLOW_CONSUMER_POLICY": "drop_oldest",
+		"AGENT_OPENAPI_MAX_BODY_BYTES":  "4096",
+		"AGENT_WEBHOOKS_MAX_BACKOFF":    "90s",
+		"AGENT_NOTIFY_PER_MINUTE":       "3",
+		"AGENT_EMAIL_SMTP_HOST":         "smtp.example.com",
+		"AGENT_LLM_PROVIDERS":           "vllm,local-gpu",
+		"AGENT_LLM_LOCAL_GPU_BASE_URL":  "http://gpu:8000/v1",
+		"AGENT_LLM_ROUTES":              "chat=vllm:llama,local-gpu:qwen;code=local-gpu:qwen-coder",
+		"AGENT_EMBEDDINGS_BATCH_SIZE":   "16",
+		"AGENT_RERANK_RERANKER":         "gateway",
+		"AGENT_QUERY_CACHE_TTL":         "0s",
+		"AGENT_LLM_BUDGET_HARD_CUTOFF":  "false",
+	}
+	for name, value := range configured {
+		t.Setenv(name, value)
+	}
+	settings := NewApiSettings()
+	env := settings.Variables()
+
+	for name := range configured {
+		os.Unsetenv(name)
+	}
+	for name, value := range env {
+		t.Setenv(name, value)
+	}
+	if rendered := NewApiSettings(); !reflect.DeepEqual(rendered, settings) {
+		t.Errorf("settings read from the rendered environment differ:\n%+v\n%+v", rendered, settings)
+	}
+}
+
+func TestRender(t *testing.T) {
+	t.Setenv("AGENT_API_KEY", "api-key")
+	t.Setenv("AGENT_ALLOWED_HOSTS", "*")
+	settings := NewApiSettings()
+
+	out, err := Render(settings, FormatEnv, RenderOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains("\n"+string(out), "\nAGENT_ALLOWED_HOSTS='*'\n") || !strings.Contains(string(out), "\nAGENT_API_KEY=api-key\n") {
+		t.Errorf("unexpected env file:\n%s", out)
+	}
+
+	out, err = Render(settings, FormatK8sSecret, RenderOptions{Name: "kled", Namespace: "kled-system"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	configMap, secret, ok := strings.Cut(string(out), "---\n")
+	if !ok || !strings.Contains(configMap, "kind: ConfigMap") || !strings.Contains(secret, "name: kled-secrets") {
+		t.Fatalf("unexpected manifests:\n%s", out)
+	}
+	if strings.Contains(configMap, "AGENT_API_KEY") || !strings.Contains(secret, "AGENT_API_KEY: api-key") {
+		t.Errorf("expected the API key in the secret only:\n%s", out)
+	}
+
+	if _, err := Render(settings, "toml", RenderOptions{}); err == nil {
+		t.Errorf("expected an unknown format to fail")
+	}
+}
@@ -1,10 +1,24 @@
 package config
 
 import (
+	"log"
 	"os"
 	"path/filepath"
 	"strings"
 
+	"github.com/spectrumwebco/agent_runtime/backend/core/config/env"
+	"github.com/spectrumwebco/agent_runtime/backend/core/email"
+	"github.com/spectrumwebco/agent_runtime/backend/core/embeddings"
+	"github.com/spectrumwebco/agent_runtime/backend/core/llm"
+	"github.com/spectrumwebco/agent_runtime/backend/core/metering"
+	"github.com/spectrumwebco/agent_runtime/backend/core/notify"
+	"github.com/spectrumwebco/agent_runtime/backend/core/openapi"
+	"github.com/spectrumwebco/agent_runtime/backend/core/outbound"
+	"github.com/spectrumwebco/agent_runtime/backend/core/querycache"
+	"github.com/spectrumwebco/agent_runtime/backend/core/redact"
+	"github.com/spectrumwebco/agent_runtime/backend/core/rerank"
+	"github.com/spectrumwebco/agent_runtime/backend/core/webhooks"
+	"github.com/spectrumwebco/agent_runtime/backend/core/wsqueue"
 	"github.com/spectrumwebco/agent_runtime/pkg/djangogo/core"
 )
 
@@ -24,6 +38,19 @@ type ApiSettings struct {
 	PostgresDB          string   `json:"postgres_db"`
 	KafkaBootstrapServers string `json:"kafka_bootstrap_servers"`
 	KafkaTopicPrefix    string   `json:"kafka_topic_prefix"`
+	KafkaSecurityProtocol string `json:"kafka_security_protocol"`
+	KafkaSASLMechanism  string   `json:"kafka_sasl_mechanism"`
+	KafkaSASLUsername   string   `json:"kafka_sasl_username"`
+	KafkaSASLPassword   string   `json:"kafka_sasl_password"`
+	KafkaOAuthTokenURL  string   `json:"kafka_oauth_token_url"`
+	KafkaOAuthClientID  string   `json:"kafka_oauth_client_id"`
+	KafkaOAuthClientSecret string `json:"kafka_oauth_client_secret"`
+	KafkaOAuthScope     string   `json:"kafka_oauth_scope"`
+	KafkaSSLCALocation  string   `json:"kafka_ssl_ca_location"`
+	KafkaSSLCertLocation string  `json:"kafka_ssl_certificate_location"`
+	KafkaSSLKeyLocation string   `json:"kafka_ssl_key_location"`
+	KafkaSSLKeyPassword string   `json:"kafka_ssl_key_password"`
+	KafkaSSLVaultPath   string   `json:"kafka_ssl_vault_path"`
 	SupabaseURL         string   `json:"supabase_url"`
 	SupabaseKey         string   `json:"supabase_key"`
 	DragonflyHost       string   `json:"dragonfly_host"`
@@ -31,15 +58,43 @@ type ApiSettings struct {
 	DragonflyPassword   string   `json:"dragonfly_password"`
 	DragonflySSL        bool     `json:"dragonfly_ssl"`
 	DragonflyDB         int      `json:"dragonfly_db"`
+	DragonflyMode       string   `json:"dragonfly_mode"`
+	DragonflyAddrs      string   `json:"dragonfly_addrs"`
+	DragonflyMasterName string   `json:"dragonfly_master_name"`
+	DragonflySentinelPassword string `json:"dragonfly_sentinel_password"`
+	DragonflyReadFrom   string   `json:"dragonfly_read_from"`
+	DragonflyProtocol   int      `json:"dragonfly_protocol"`
+	DragonflyClientCache bool    `json:"dragonfly_client_cache"`
+	DragonflyClientCachePrefixes string `json:"dragonfly_client_cache_prefixes"`
+	DragonflyClientCacheTTL int  `json:"dragonfly_client_cache_ttl"`
 	RagflowURL          string   `json:"ragflow_url"`
 	RagflowAPIKey       string   `json:"ragflow_api_key"`
 	RocketMQNameServer  string   `json:"rocketmq_name_server"`
 	RocketMQProducerGroup string `json:"rocketmq_producer_group"`
 	RocketMQConsumerGroup string `json:"rocketmq_consumer_group"`
+	RocketMQTLS         bool     `json:"rocketmq_tls"`
+	RocketMQAccessKey   string   `json:"rocketmq_access_key"`
+	RocketMQSecretKey   string   `json:"rocketmq_secret_key"`
+	RocketMQTLSCALocation string `json:"rocketmq_tls_ca_location"`
+	RocketMQTLSCertLocation string `json:"rocketmq_tls_certificate_location"`
+	RocketMQTLSKeyLocation string `json:"rocketmq_tls_key_location"`
+	RocketMQTLSVaultPath string  `json:"rocketmq_tls_vault_path"`
 	GRPCHost            string   `json:"grpc_host"`
 	GRPCPort            int      `json:"grpc_port"`
 	MLApiURL            string   `json:"ml_api_url"`
 	MLApiKey            string   `json:"ml_api_key"`
+	Outbound            outbound.Config `json:"outbound"`
+	Redaction           redact.Config   `json:"redaction"`
+	WebSocket           wsqueue.Config  `json:"websocket"`
+	OpenAPI             openapi.Config  `json:"openapi"`
+	Webhooks            webhooks.Config `json:"webhooks"`
+	Notify              notify.Config   `json:"notify"`
+	Email               email.Config    `json:"email"`
+	LLM                 llm.Config      `json:"llm"`
+	Embeddings          embeddings.Config `json:"embeddings"`
+	Rerank              rerank.Config     `json:"rerank"`
+	QueryCache          querycache.Config `json:"query_cache"`
+	LLMBudget           metering.Config   `json:"llm_budget"`
 }
 
 func NewApiSettings() *ApiSettings {
@@ -59,6 +114,19 @@ func NewApiSettings() *ApiSettings {
 		PostgresDB:          getEnv("AGENT_POSTGRES_DB", "agent_runtime"),
 		KafkaBootstrapServers: getEnv("AGENT_KAFKA_BOOTSTRAP_SERVERS", "kafka.default.svc.cluster.local:9092"),
 		KafkaTopicPrefix:    getEnv("AGENT_KAFKA_TOPIC_PREFIX", "agent_runtime"),
+		KafkaSecurityProtocol: getEnv("AGENT_KAFKA_SECURITY_PROTOCOL", ""),
+		KafkaSASLMechanism:  getEnv("AGENT_KAFKA_SASL_MECHANISM", ""),
+		KafkaSASLUsername:   getEnv("AGENT_KAFKA_SASL_USERNAME", ""),
+		KafkaSASLPassword:   getEnv("AGENT_KAFKA_SASL_PASSWORD", ""),
+		KafkaOAuthTokenURL:  getEnv("AGENT_KAFKA_OAUTH_TOKEN_URL", ""),
+		KafkaOAuthClientID:  getEnv("AGENT_KAFKA_OAUTH_CLIENT_ID", ""),
+		KafkaOAuthClientSecret: getEnv("AGENT_KAFKA_OAUTH_CLIENT_SECRET", ""),
+		KafkaOAuthScope:     getEnv("AGENT_KAFKA_OAUTH_SCOPE", ""),
+		KafkaSSLCALocation:  getEnv("AGENT_KAFKA_SSL_CA_LOCATION", ""),
+		KafkaSSLCertLocation: getEnv("AGENT_KAFKA_SSL_CERTIFICATE_LOCATION", ""),
+		KafkaSSLKeyLocation: getEnv("AGENT_KAFKA_SSL_KEY_LOCATION", ""),
+		KafkaSSLKeyPassword: getEnv("AGENT_KAFKA_SSL_KEY_PASSWORD", ""),
+		KafkaSSLVaultPath:   getEnv("AGENT_KAFKA_SSL_VAULT_PATH", ""),
 		SupabaseURL:         getEnv("AGENT_SUPABASE_URL", "http://supabase-db.default.svc.cluster.local:8000"),
 		SupabaseKey:         getEnv("AGENT_SUPABASE_KEY", ""),
 		DragonflyHost:       getEnv("AGENT_DRAGONFLY_HOST", "dragonfly.default.svc.cluster.local"),
@@ -66,15 +134,43 @@ func NewApiSettings() *ApiSettings {
 		DragonflyPassword:   getEnv("AGENT_DRAGONFLY_PASSWORD", ""),
 		DragonflySSL:        getEnvBool("AGENT_DRAGONFLY_SSL", false),
 		DragonflyDB:         getEnvInt("AGENT_DRAGONFLY_DB", 0),
+		DragonflyMode:       getEnv("AGENT_DRAGONFLY_MODE", "standalone"),
+		DragonflyAddrs:      getEnv("AGENT_DRAGONFLY_ADDRS", ""),
+		DragonflyMasterName: getEnv("AGENT_DRAGONFLY_MASTER_NAME", ""),
+		DragonflySentinelPassword: getEnv("AGENT_DRAGONFLY_SENTINEL_PASSWORD", ""),
+		DragonflyReadFrom:   getEnv("AGENT_DRAGONFLY_READ_FROM", "master"),
+		DragonflyProtocol:   getEnvInt("AGENT_DRAGONFLY_PROTOCOL", 3),
+		DragonflyClientCache: getEnvBool("AGENT_DRAGONFLY_CLIENT_CACHE", false),
+		DragonflyClientCachePrefixes: getEnv("AGENT_DRAGONFLY_CLIENT_CACHE_PREFIXES", "shared_state:"),
+		DragonflyClientCacheTTL: getEnvInt("AGENT_DRAGONFLY_CLIENT_CACHE_TTL", 30),
 		RagflowURL:          getEnv("AGENT_RAGFLOW_URL", "http://ragflow.default.svc.cluster.local:8000"),
 		RagflowAPIKey:       getEnv("AGENT_RAGFLOW_API_KEY", ""),
 		RocketMQNameServer:  getEnv("AGENT_ROCKETMQ_NAME_SERVER", "rocketmq-namesrv.default.svc.cluster.local:9876"),
 		RocketMQProducerGroup: getEnv("AGENT_ROCKETMQ_PRODUCER_GROUP", "agent_runtime_producer"),
 		RocketMQConsumerGroup: getEnv("AGENT_ROCKETMQ_CONSUMER_GROUP", "agent_runtime_consumer"),
+		RocketMQTLS:         getEnvBool("AGENT_ROCKETMQ_TLS", false),
+		RocketMQAccessKey:   getEnv("AGENT_ROCKETMQ_ACCESS_KEY", ""),
+		RocketMQSecretKey:   getEnv("AGENT_ROCKETMQ_SECRET_KEY", ""),
+		RocketMQTLSCALocation: getEnv("AGENT_ROCKETMQ_TLS_CA_LOCATION", ""),
+		RocketMQTLSCertLocation: getEnv("AGENT_ROCKETMQ_TLS_CERTIFICATE_LOCATION", ""),
+		RocketMQTLSKeyLocation: getEnv("AGENT_ROCKETMQ_TLS_KEY_LOCATION", ""),
+		RocketMQTLSVaultPath: getEnv("AGENT_ROCKETMQ_TLS_VAULT_PATH", ""),
 		GRPCHost:            getEnv("AGENT_GRPC_HOST", "0.0.0.0"),
 		GRPCPort:            getEnvInt("AGENT_GRPC_PORT", 50051),
 		MLApiURL:            getEnv("AGENT_ML_API_URL", "http://localhost:8000"),
 		MLApiKey:            getEnv("AGENT_ML_API_KEY", ""),
+		Outbound:            outbound.FromEnv(),
+		Redaction:           redact.FromEnv(),
+		WebSocket:           wsqueue.FromEnv(),
+		OpenAPI:             openapi.FromEnv(),
+		Webhooks:            webhooks.FromEnv(),
+		Notify:              notify.FromEnv(),
+		Email:               email.FromEnv(),
+		LLM:                 llm.FromEnv(),
+		Embeddings:          embeddings.FromEnv(),
+		Rerank:              rerank.FromEnv(),
+		QueryCache:          querycache.FromEnv(),
+		LLMBudget:           metering.FromEnv(),
 	}
 }
 
@@ -180,11 +276,20 @@ func GetRestFramework() map[string]interface{} {
 func GetDragonflyConfig() map[string]interface{} {
 	apiSettings := NewApiSettings()
 	return map[string]interface{}{
-		"host":     apiSettings.DragonflyHost,
-		"port":     apiSettings.DragonflyPort,
-		"password": apiSettings.DragonflyPassword,
-		"ssl":      apiSettings.DragonflySSL,
-		"db":       apiSettings.DragonflyDB,
+		"host":              apiSettings.DragonflyHost,
+		"port":              apiSettings.DragonflyPort,
+		"password":          apiSettings.DragonflyPassword,
+		"ssl":               apiSettings.DragonflySSL,
+		"db":                apiSettings.DragonflyDB,
+		"mode":              apiSettings.DragonflyMode,
+		"addrs":             apiSettings.DragonflyAddrs,
+		"master_name":       apiSettings.DragonflyMasterName,
+		"sentinel_password": apiSettings.DragonflySentinelPassword,
+		"read_from":         apiSettings.DragonflyReadFrom,
+		"protocol":          apiSettings.DragonflyProtocol,
+		"client_cache":      apiSettings.DragonflyClientCache,
+		"client_cache_prefixes": apiSettings.DragonflyClientCachePrefixes,
+		"client_cache_ttl":  apiSettings.DragonflyClientCacheTTL,
 	}
 }
 
@@ -325,25 +430,16 @@ func getEnv(key, defaultValue string) string {
 	return value
 }
 
+var settingsEnv = env.NewReader(log.New(os.Stdout, "kled.config: ", log.LstdFlags))
+
 func getEnvBool(key string, defaultValue bool) bool {
-	value := os.Getenv(key)
-	if value == "" {
-		return defaultValue
-	}
-	return value == "true" || value == "True" || value == "1" || value == "yes" || value == "Yes"
+	settingsEnv.Bool(key, &defaultValue)
+	return defaultValue
 }
 
 func getEnvInt(key string, defaultValue int) int {
-	value := os.Getenv(key)
-	if value == "" {
-		return defaultValue
-	}
-	var result int
-	_, err := fmt.Sscanf(value, "%d", &result)
-	if err != nil {
-		return defaultValue
-	}
-	return result
+	settingsEnv.Int(key, &defaultValue, 0)
+	return defaultValue
 }
 
 func init() {
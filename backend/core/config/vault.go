@@ -1,6 +1,7 @@
 package config
 
 import (
+	"context"
 	"fmt"
 	"io/ioutil"
 	"log"
@@ -10,6 +11,9 @@ import (
 	"time"
 
 	"github.com/hashicorp/vault/api"
+	"github.com/spectrumwebco/agent_runtime/backend/core/outbound"
+	"github.com/spectrumwebco/agent_runtime/backend/core/readiness"
+	"github.com/spectrumwebco/agent_runtime/backend/db/integrations"
 	"github.com/spectrumwebco/agent_runtime/pkg/djangogo/core"
 )
 
@@ -63,6 +67,17 @@ func (c *VaultClient) Initialize() {
 
 	config := api.DefaultConfig()
 	config.Address = c.URL
+	if transport, ok := config.HttpClient.Transport.(*http.Transport); ok {
+		outboundConfig := outbound.Default()
+		transport.Proxy = outboundConfig.Proxy()
+
+		rootCAs, err := outboundConfig.RootCAs()
+		if err != nil {
+			log.Printf("Error loading CA bundle for Vault: %v", err)
+		} else if rootCAs != nil && transport.TLSClientConfig != nil {
+			transport.TLSClientConfig.RootCAs = rootCAs
+		}
+	}
 
 	var err error
 	client, err := api.NewClient(config)
@@ -145,6 +160,20 @@ func (c *VaultClient) authenticateKubernetes() {
 	c.Authenticated = c.Client.Token() != ""
 }
 
+// Ping checks the token of the client is valid, logging in again if the
+// client isn't authenticated yet.
+func (c *VaultClient) Ping(ctx context.Context) error {
+	if !c.Authenticated {
+		c.Initialize()
+	}
+	if c.Client == nil || !c.Authenticated {
+		return fmt.Errorf("not authenticated with Vault at %s", c.URL)
+	}
+
+	_, err := c.Client.Auth().Token().LookupSelfWithContext(ctx)
+	return err
+}
+
 func (c *VaultClient) ReadSecret(path string) (map[string]interface{}, error) {
 	isLocal := !isRunningInKubernetes()
 
@@ -344,8 +373,16 @@ var (
 )
 
 func init() {
+	integrations.SetSecretReader(DefaultVaultClient)
+
 	core.RegisterConfig("vault", map[string]interface{}{
 		"vault_client":     DefaultVaultClient,
 		"database_secrets": DefaultDatabaseSecrets,
 	})
 }
+
+// RegisterReadinessChecks registers the Vault token with g, so the backend
+// reports ready once it can read its secrets.
+func RegisterReadinessChecks(g *readiness.Gate) {
+	g.Register(readiness.Dependency{Name: "vault", Check: DefaultVaultClient.Ping})
+}
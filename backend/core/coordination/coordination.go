@@ -0,0 +1,78 @@
+// Package coordination lets several agents work on one workspace at once.
+//
+// Agents of a workspace share three things, all kept in Dragonfly so every
+// backend replica sees the same state:
+//
+//   - a Scratchpad of string entries. Writing an entry requires holding its
+//     lock, which expires after a TTL if its holder doesn't release it.
+//   - a TaskQueue on a Dragonfly stream of the event bus. Agents claim tasks
+//     and acknowledge them when done; tasks claimed but not acknowledged
+//     within the visibility timeout go to the next agent claiming.
+//   - an EditTracker recording the content hash of every file an agent
+//     wrote. An edit based on another hash than the recorded one was made
+//     concurrently with another agent's edit and is rejected as a conflict.
+package coordination
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"regexp"
+	"time"
+)
+
+var coordinationLogger = log.New(os.Stdout, "kled.coordination: ", log.LstdFlags)
+
+var (
+	// ErrNotLockHolder rejects writes without the entry's lock, or with a
+	// lock that expired.
+	ErrNotLockHolder = errors.New("the lock is not held")
+	// ErrTaskNotFound is returned when acknowledging a task that isn't
+	// claimed, e.g. because it was acknowledged already.
+	ErrTaskNotFound = errors.New("task is not claimed")
+)
+
+// LockedError is returned when locking an entry held by another agent.
+type LockedError struct {
+	Key    string
+	Holder string
+}
+
+func (e *LockedError) Error() string {
+	return fmt.Sprintf("%s is locked by %s", e.Key, e.Holder)
+}
+
+// ConflictError rejects an edit based on an outdated version of a file.
+type ConflictError struct {
+	Path     string
+	BaseHash string
+	// Current is the version the edit should have been based on.
+	Current FileVersion
+}
+
+func (e *ConflictError) Error() string {
+	return fmt.Sprintf("%s was changed by %s to %s, the edit is based on %q", e.Path, e.Current.Agent, e.Current.Hash, e.BaseHash)
+}
+
+// FileVersion is the last recorded edit of a file.
+type FileVersion struct {
+	Hash     string    `json:"hash"`
+	Agent    string    `json:"agent"`
+	EditedAt time.Time `json:"edited_at"`
+}
+
+var namePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_.:-]{0,127}$`)
+
+// ValidateName checks scratchpad keys and agent IDs, which become part of
+// Dragonfly keys.
+func ValidateName(kind, name string) error {
+	if !namePattern.MatchString(name) {
+		return fmt.Errorf("invalid %s %q", kind, name)
+	}
+	return nil
+}
+
+func workspaceKey(workspaceID, suffix string) string {
+	return "kled:coordination:" + workspaceID + ":" + suffix
+}
@@ -0,0 +1,110 @@
+package coordination
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/spectrumwebco/agent_runtime/backend/db/integrations/integrationsmock"
+)
+
+func TestScratchpadWritesNeedTheLock(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+	kv := integrationsmock.NewKVStore()
+	kv.SetClock(func() time.Time { return now })
+	scratchpad := NewScratchpad(kv, kv)
+
+	lock, err := scratchpad.Lock(ctx, "ws-1", "plan", "planner", time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var locked *LockedError
+	if _, err := scratchpad.Lock(ctx, "ws-1", "plan", "coder", time.Minute); !errors.As(err, &locked) || locked.Holder != "planner" {
+		t.Fatalf("expected the plan to be locked by the planner, got %v", err)
+	}
+	if err := scratchpad.Set(ctx, "ws-1", "plan", "1. reproduce", "coder/forged"); !errors.Is(err, ErrNotLockHolder) {
+		t.Fatalf("expected a write without the lock to fail, got %v", err)
+	}
+	if err := scratchpad.Set(ctx, "ws-1", "plan", "1. reproduce", lock.Token); err != nil {
+		t.Fatal(err)
+	}
+
+	// expired locks neither allow writes nor keep others out
+	now = now.Add(2 * time.Minute)
+	if err := scratchpad.Set(ctx, "ws-1", "plan", "2. fix", lock.Token); !errors.Is(err, ErrNotLockHolder) {
+		t.Fatalf("expected the expired lock to be rejected, got %v", err)
+	}
+	if _, err := scratchpad.Lock(ctx, "ws-1", "plan", "coder", time.Minute); err != nil {
+		t.Fatal(err)
+	}
+
+	entries, _ := scratchpad.Entries(ctx, "ws-1")
+	if len(entries) != 1 || entries["plan"] != "1. reproduce" {
+		t.Fatalf("unexpected entries %v", entries)
+	}
+}
+
+func TestTasksAreRedeliveredWithoutAck(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+	streams := integrationsmock.NewStreamStore()
+	streams.SetClock(func() time.Time { return now })
+	queue := NewTaskQueue(streams, time.Minute)
+
+	enqueued, err := queue.Enqueue(ctx, "ws-1", Task{Type: "test", Payload: map[string]string{"package": "./api"}, EnqueuedBy: "planner"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	task, err := queue.Claim(ctx, "ws-1", "coder-1", 0)
+	if err != nil || task == nil || task.ID != enqueued.ID || task.Payload["package"] != "./api" {
+		t.Fatalf("unexpected task %+v, %v", task, err)
+	}
+	if task, err := queue.Claim(ctx, "ws-1", "coder-2", 0); err != nil || task != nil {
+		t.Fatalf("expected the task to go to one agent only, got %+v, %v", task, err)
+	}
+
+	// coder-1 went away without acknowledging
+	now = now.Add(2 * time.Minute)
+	task, err = queue.Claim(ctx, "ws-1", "coder-2", 0)
+	if err != nil || task == nil || task.ID != enqueued.ID {
+		t.Fatalf("expected the task to be redelivered, got %+v, %v", task, err)
+	}
+	claimed, _ := queue.Claimed(ctx, "ws-1")
+	if len(claimed) != 1 || claimed[0].Agent != "coder-2" || claimed[0].Deliveries != 2 {
+		t.Fatalf("unexpected claimed tasks %+v", claimed)
+	}
+
+	if err := queue.Ack(ctx, "ws-1", task.ID); err != nil {
+		t.Fatal(err)
+	}
+	if err := queue.Ack(ctx, "ws-1", task.ID); !errors.Is(err, ErrTaskNotFound) {
+		t.Fatalf("expected acknowledging twice to fail, got %v", err)
+	}
+}
+
+func TestConcurrentEditsConflict(t *testing.T) {
+	ctx := context.Background()
+	kv := integrationsmock.NewKVStore()
+	tracker := NewEditTracker(kv, kv)
+
+	// both agents read the file before either wrote it
+	if _, err := tracker.Record(ctx, "ws-1", Edit{Path: "main.go", Agent: "coder-1", Hash: "a"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tracker.Record(ctx, "ws-1", Edit{Path: "main.go", Agent: "coder-1", BaseHash: "a", Hash: "b"}); err != nil {
+		t.Fatal(err)
+	}
+	_, err := tracker.Record(ctx, "ws-1", Edit{Path: "main.go", Agent: "coder-2", BaseHash: "a", Hash: "c"})
+	var conflict *ConflictError
+	if !errors.As(err, &conflict) || conflict.Current.Hash != "b" || conflict.Current.Agent != "coder-1" {
+		t.Fatalf("expected a conflict with coder-1's edit, got %v", err)
+	}
+
+	versions, _ := tracker.Versions(ctx, "ws-1")
+	if versions["main.go"].Hash != "b" {
+		t.Fatalf("unexpected versions %v", versions)
+	}
+}
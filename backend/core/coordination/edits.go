@@ -0,0 +1,118 @@
+package coordination
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/spectrumwebco/agent_runtime/backend/db/integrations"
+)
+
+// editLockTTL bounds how long recording an edit holds the file's lock.
+const editLockTTL = 5 * time.Second
+
+// Edit is a write of a file by an agent.
+type Edit struct {
+	Path  string `json:"path" openapi:"required"`
+	Agent string `json:"agent" openapi:"required"`
+	// BaseHash is the hash of the content the agent read before editing,
+	// empty for files it created.
+	BaseHash string `json:"base_hash"`
+	// Hash is the hash of the content it wrote.
+	Hash string `json:"hash" openapi:"required"`
+}
+
+// EditTracker keeps the version of every file written by an agent in a
+// hash of the KV store. Checking and recording an edit holds a lock of the
+// file, so concurrent edits of one file are decided one at a time.
+type EditTracker struct {
+	kv     integrations.KVStore
+	locker integrations.Locker
+	now    func() time.Time
+}
+
+func NewEditTracker(kv integrations.KVStore, locker integrations.Locker) *EditTracker {
+	return &EditTracker{kv: kv, locker: locker, now: time.Now}
+}
+
+// Record records an edit, or returns a ConflictError if the file changed
+// since the content the edit is based on. Files no agent recorded an edit
+// of are not checked.
+func (t *EditTracker) Record(ctx context.Context, workspaceID string, edit Edit) (*FileVersion, error) {
+	if edit.Path == "" || edit.Hash == "" {
+		return nil, fmt.Errorf("an edit needs a path and a hash")
+	}
+
+	lock := workspaceKey(workspaceID, "files:lock:"+edit.Path)
+	token := uuid.New().String()
+	acquired, err := t.locker.AcquireLock(lock, token, editLockTTL)
+	if err != nil {
+		return nil, err
+	}
+	if !acquired {
+		// another edit of the file is being recorded right now
+		current, err := t.Version(ctx, workspaceID, edit.Path)
+		if err != nil {
+			return nil, err
+		}
+		if current == nil {
+			current = &FileVersion{}
+		}
+		return nil, &ConflictError{Path: edit.Path, BaseHash: edit.BaseHash, Current: *current}
+	}
+	defer func() {
+		if _, err := t.locker.ReleaseLock(lock, token); err != nil {
+			coordinationLogger.Printf("Error unlocking %s of workspace %s: %v", edit.Path, workspaceID, err)
+		}
+	}()
+
+	current, err := t.Version(ctx, workspaceID, edit.Path)
+	if err != nil {
+		return nil, err
+	}
+	if current != nil && current.Hash != edit.BaseHash {
+		return nil, &ConflictError{Path: edit.Path, BaseHash: edit.BaseHash, Current: *current}
+	}
+
+	version := &FileVersion{Hash: edit.Hash, Agent: edit.Agent, EditedAt: t.now().UTC()}
+	encoded, err := json.Marshal(version)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := t.kv.HSet(workspaceKey(workspaceID, "files"), edit.Path, string(encoded)); err != nil {
+		return nil, err
+	}
+	return version, nil
+}
+
+// Version returns the recorded version of a file, or nil.
+func (t *EditTracker) Version(ctx context.Context, workspaceID, path string) (*FileVersion, error) {
+	encoded, err := t.kv.HGet(workspaceKey(workspaceID, "files"), path)
+	if err != nil || encoded == "" {
+		return nil, err
+	}
+	version := &FileVersion{}
+	if err := json.Unmarshal([]byte(encoded), version); err != nil {
+		return nil, fmt.Errorf("error decoding version of %s: %v", path, err)
+	}
+	return version, nil
+}
+
+// Versions returns the recorded versions of every file of a workspace.
+func (t *EditTracker) Versions(ctx context.Context, workspaceID string) (map[string]FileVersion, error) {
+	encoded, err := t.kv.HGetAll(workspaceKey(workspaceID, "files"))
+	if err != nil {
+		return nil, err
+	}
+	versions := make(map[string]FileVersion, len(encoded))
+	for path, value := range encoded {
+		var version FileVersion
+		if err := json.Unmarshal([]byte(value), &version); err != nil {
+			return nil, fmt.Errorf("error decoding version of %s: %v", path, err)
+		}
+		versions[path] = version
+	}
+	return versions, nil
+}
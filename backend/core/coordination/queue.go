@@ -0,0 +1,166 @@
+package coordination
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/spectrumwebco/agent_runtime/backend/db/integrations"
+)
+
+const (
+	DefaultVisibilityTimeout = 5 * time.Minute
+	// taskGroup is the consumer group of every agent of a workspace.
+	taskGroup = "agents"
+	// maxQueuedTasks approximately trims the stream of a workspace.
+	maxQueuedTasks = 10000
+)
+
+type Task struct {
+	ID         string            `json:"id"`
+	Type       string            `json:"type"`
+	Payload    map[string]string `json:"payload,omitempty"`
+	EnqueuedBy string            `json:"enqueued_by,omitempty"`
+}
+
+// ClaimedTask is a task claimed by an agent and not acknowledged yet.
+type ClaimedTask struct {
+	ID          string `json:"id"`
+	Agent       string `json:"agent"`
+	IdleSeconds int64  `json:"idle_seconds"`
+	// Deliveries counts how often the task was claimed.
+	Deliveries int64 `json:"deliveries"`
+}
+
+// TaskQueue queues the tasks of each workspace on its own stream, read by
+// one consumer group so that every task goes to a single agent.
+type TaskQueue struct {
+	streams    integrations.StreamStore
+	visibility time.Duration
+
+	// groups remembers the streams whose group exists.
+	groups sync.Map
+}
+
+// NewTaskQueue returns a queue redelivering tasks not acknowledged within
+// visibility.
+func NewTaskQueue(streams integrations.StreamStore, visibility time.Duration) *TaskQueue {
+	if visibility <= 0 {
+		visibility = DefaultVisibilityTimeout
+	}
+	return &TaskQueue{streams: streams, visibility: visibility}
+}
+
+func (q *TaskQueue) stream(workspaceID string) (string, error) {
+	stream := workspaceKey(workspaceID, "tasks")
+	if _, ok := q.groups.Load(stream); ok {
+		return stream, nil
+	}
+	// from the start, tasks queued before any agent claimed are kept
+	if err := q.streams.StreamCreateGroup(stream, taskGroup, "0"); err != nil {
+		return "", err
+	}
+	q.groups.Store(stream, true)
+	return stream, nil
+}
+
+// Enqueue queues a task and returns it with its ID.
+func (q *TaskQueue) Enqueue(ctx context.Context, workspaceID string, task Task) (*Task, error) {
+	if task.Type == "" {
+		return nil, fmt.Errorf("a task needs a type")
+	}
+	stream, err := q.stream(workspaceID)
+	if err != nil {
+		return nil, err
+	}
+	payload, err := json.Marshal(task.Payload)
+	if err != nil {
+		return nil, err
+	}
+
+	task.ID, err = q.streams.StreamAdd(stream, map[string]interface{}{
+		"type":        task.Type,
+		"payload":     string(payload),
+		"enqueued_by": task.EnqueuedBy,
+	}, maxQueuedTasks)
+	if err != nil {
+		return nil, err
+	}
+	return &task, nil
+}
+
+// Claim returns the next task for agent, waiting up to wait for one. Tasks
+// whose agent didn't acknowledge them within the visibility timeout are
+// claimed before new ones. It returns nil if no task arrived in time.
+func (q *TaskQueue) Claim(ctx context.Context, workspaceID, agent string, wait time.Duration) (*Task, error) {
+	stream, err := q.stream(workspaceID)
+	if err != nil {
+		return nil, err
+	}
+
+	if wait <= 0 {
+		// a block of 0 would wait forever
+		wait = -1
+	}
+	messages, err := q.streams.StreamClaimStale(stream, taskGroup, agent, q.visibility, 1)
+	if err == nil && len(messages) == 0 {
+		messages, err = q.streams.StreamReadGroup(ctx, stream, taskGroup, agent, 1, wait)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(messages) == 0 {
+		return nil, nil
+	}
+	return taskFromMessage(messages[0])
+}
+
+// Ack marks a claimed task as done.
+func (q *TaskQueue) Ack(ctx context.Context, workspaceID, taskID string) error {
+	stream, err := q.stream(workspaceID)
+	if err != nil {
+		return err
+	}
+	acked, err := q.streams.StreamAck(stream, taskGroup, taskID)
+	if err != nil {
+		return err
+	}
+	if acked == 0 {
+		return ErrTaskNotFound
+	}
+	return nil
+}
+
+// Claimed lists the tasks claimed and not acknowledged yet, oldest first.
+func (q *TaskQueue) Claimed(ctx context.Context, workspaceID string) ([]ClaimedTask, error) {
+	stream, err := q.stream(workspaceID)
+	if err != nil {
+		return nil, err
+	}
+	pending, err := q.streams.StreamPending(stream, taskGroup, 100)
+	if err != nil {
+		return nil, err
+	}
+
+	claimed := make([]ClaimedTask, 0, len(pending))
+	for _, entry := range pending {
+		claimed = append(claimed, ClaimedTask{ID: entry.ID, Agent: entry.Consumer, IdleSeconds: int64(entry.Idle.Seconds()), Deliveries: entry.RetryCount})
+	}
+	return claimed, nil
+}
+
+func taskFromMessage(message integrations.StreamMessage) (*Task, error) {
+	task := &Task{
+		ID:         message.ID,
+		Type:       fmt.Sprint(message.Values["type"]),
+		EnqueuedBy: fmt.Sprint(message.Values["enqueued_by"]),
+	}
+	if payload, ok := message.Values["payload"].(string); ok && payload != "" && payload != "null" {
+		if err := json.Unmarshal([]byte(payload), &task.Payload); err != nil {
+			return nil, fmt.Errorf("error decoding payload of task %s: %v", message.ID, err)
+		}
+	}
+	return task, nil
+}
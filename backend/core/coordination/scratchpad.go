@@ -0,0 +1,111 @@
+package coordination
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/spectrumwebco/agent_runtime/backend/db/integrations"
+)
+
+const (
+	DefaultLockTTL = 30 * time.Second
+	MaxLockTTL     = 10 * time.Minute
+	// scratchpadTTL drops scratchpads of workspaces no agent wrote to for a
+	// week.
+	scratchpadTTL = 7 * 24 * time.Hour
+)
+
+// Lock is a held lock of a scratchpad entry. The token proves holding it
+// when writing and unlocking.
+type Lock struct {
+	Key       string    `json:"key"`
+	Holder    string    `json:"holder"`
+	Token     string    `json:"token"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// Scratchpad keeps entries in a hash of the KV store and their locks in
+// keys of the locker, which Dragonfly serves both.
+type Scratchpad struct {
+	kv     integrations.KVStore
+	locker integrations.Locker
+	now    func() time.Time
+}
+
+func NewScratchpad(kv integrations.KVStore, locker integrations.Locker) *Scratchpad {
+	return &Scratchpad{kv: kv, locker: locker, now: time.Now}
+}
+
+// Entries returns every entry of the workspace's scratchpad.
+func (s *Scratchpad) Entries(ctx context.Context, workspaceID string) (map[string]string, error) {
+	entries, err := s.kv.HGetAll(workspaceKey(workspaceID, "scratchpad"))
+	if err != nil {
+		return nil, err
+	}
+	if entries == nil {
+		entries = map[string]string{}
+	}
+	return entries, nil
+}
+
+// Lock locks an entry for holder until ttl passes, or returns a LockedError
+// naming the agent holding it.
+func (s *Scratchpad) Lock(ctx context.Context, workspaceID, key, holder string, ttl time.Duration) (*Lock, error) {
+	if ttl <= 0 {
+		ttl = DefaultLockTTL
+	} else if ttl > MaxLockTTL {
+		ttl = MaxLockTTL
+	}
+
+	// the token starts with the holder so that others can tell who it is
+	token := holder + "/" + uuid.New().String()
+	acquired, err := s.locker.AcquireLock(lockKey(workspaceID, key), token, ttl)
+	if err != nil {
+		return nil, err
+	}
+	if !acquired {
+		current, err := s.kv.Get(lockKey(workspaceID, key))
+		if err != nil {
+			return nil, err
+		}
+		return nil, &LockedError{Key: key, Holder: lockHolder(current)}
+	}
+	return &Lock{Key: key, Holder: holder, Token: token, ExpiresAt: s.now().Add(ttl).UTC()}, nil
+}
+
+// Unlock releases a lock early. Releasing an expired lock is not an error.
+func (s *Scratchpad) Unlock(ctx context.Context, workspaceID, key, token string) error {
+	_, err := s.locker.ReleaseLock(lockKey(workspaceID, key), token)
+	return err
+}
+
+// Set writes an entry whose lock is held with token.
+func (s *Scratchpad) Set(ctx context.Context, workspaceID, key, value, token string) error {
+	current, err := s.kv.Get(lockKey(workspaceID, key))
+	if err != nil {
+		return err
+	}
+	if current == "" || current != token {
+		return ErrNotLockHolder
+	}
+
+	name := workspaceKey(workspaceID, "scratchpad")
+	if _, err := s.kv.HSet(name, key, value); err != nil {
+		return err
+	}
+	if _, err := s.kv.Expire(name, int(scratchpadTTL.Seconds())); err != nil {
+		coordinationLogger.Printf("Error setting expiry of scratchpad of workspace %s: %v", workspaceID, err)
+	}
+	return nil
+}
+
+func lockKey(workspaceID, key string) string {
+	return workspaceKey(workspaceID, "lock:"+key)
+}
+
+func lockHolder(token string) string {
+	holder, _, _ := strings.Cut(token, "/")
+	return holder
+}
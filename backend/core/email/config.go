@@ -0,0 +1,75 @@
+package email
+
+import (
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/spectrumwebco/agent_runtime/backend/core/config/env"
+)
+
+type Config struct {
+	SMTPHost string `json:"smtp_host"`
+	SMTPPort int    `json:"smtp_port"`
+	Username string `json:"username"`
+	Password string `json:"-"`
+	// From is the sender address, e.g. "Kled <noreply@example.com>".
+	From string `json:"from"`
+	// ImplicitTLS connects with TLS from the start, as on port 465, instead
+	// of upgrading with STARTTLS.
+	ImplicitTLS bool          `json:"implicit_tls"`
+	Timeout     time.Duration `json:"timeout"`
+	// TemplateDir may hold digest.txt.tmpl and digest.html.tmpl to replace
+	// the default digest templates.
+	TemplateDir string `json:"template_dir,omitempty"`
+	// DigestSchedule is the cron schedule of the daily digest job.
+	DigestSchedule string `json:"digest_schedule"`
+}
+
+const (
+	DefaultSMTPPort       = 587
+	DefaultTimeout        = 30 * time.Second
+	DefaultDigestSchedule = "0 7 * * *"
+)
+
+// Enabled reports whether an SMTP server is configured. Without one no email
+// is sent.
+func (c Config) Enabled() bool {
+	return c.SMTPHost != "" && c.From != ""
+}
+
+var Default = env.Once(FromEnv)
+
+func FromEnv() Config {
+	config := Config{
+		SMTPHost:       os.Getenv("AGENT_EMAIL_SMTP_HOST"),
+		SMTPPort:       DefaultSMTPPort,
+		Username:       os.Getenv("AGENT_EMAIL_SMTP_USERNAME"),
+		Password:       os.Getenv("AGENT_EMAIL_SMTP_PASSWORD"),
+		From:           os.Getenv("AGENT_EMAIL_FROM"),
+		Timeout:        DefaultTimeout,
+		TemplateDir:    os.Getenv("AGENT_EMAIL_TEMPLATE_DIR"),
+		DigestSchedule: DefaultDigestSchedule,
+	}
+	read := env.NewReader(emailLogger)
+	read.IntRange("AGENT_EMAIL_SMTP_PORT", &config.SMTPPort, 1, 65535)
+	read.Bool("AGENT_EMAIL_SMTP_IMPLICIT_TLS", &config.ImplicitTLS)
+	read.PositiveDuration("AGENT_EMAIL_TIMEOUT", &config.Timeout)
+	read.String("AGENT_EMAIL_DIGEST_SCHEDULE", &config.DigestSchedule)
+	return config
+}
+
+// Variables returns the variables FromEnv reads c from.
+func (c Config) Variables() map[string]string {
+	return map[string]string{
+		"AGENT_EMAIL_SMTP_HOST":         c.SMTPHost,
+		"AGENT_EMAIL_SMTP_PORT":         strconv.Itoa(c.SMTPPort),
+		"AGENT_EMAIL_SMTP_USERNAME":     c.Username,
+		"AGENT_EMAIL_SMTP_PASSWORD":     c.Password,
+		"AGENT_EMAIL_FROM":              c.From,
+		"AGENT_EMAIL_SMTP_IMPLICIT_TLS": strconv.FormatBool(c.ImplicitTLS),
+		"AGENT_EMAIL_TIMEOUT":           c.Timeout.String(),
+		"AGENT_EMAIL_TEMPLATE_DIR":      c.TemplateDir,
+		"AGENT_EMAIL_DIGEST_SCHEDULE":   c.DigestSchedule,
+	}
+}
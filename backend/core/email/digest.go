@@ -0,0 +1,399 @@
+package email
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	htmltemplate "html/template"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/spectrumwebco/agent_runtime/backend/core/events"
+	"github.com/spectrumwebco/agent_runtime/backend/core/tenancy"
+	"github.com/spectrumwebco/agent_runtime/backend/db/integrations"
+)
+
+// Digest summarizes a user's activity over a period.
+type Digest struct {
+	Recipient Recipient
+	From      time.Time
+	To        time.Time
+	// Workspaces is how many workspaces the user owns, WorkspacesCreated
+	// how many of them were created in the period.
+	Workspaces        int
+	WorkspacesCreated int
+	Failures          []WorkspaceFailures
+	// Cost is the billed usage of the user's workspaces that started in the
+	// period.
+	Currency  string
+	Cost      float64
+	CostItems []CostItem
+}
+
+type WorkspaceFailures struct {
+	WorkspaceID   string
+	WorkspaceName string
+	Count         int
+}
+
+type CostItem struct {
+	ResourceType string
+	Quantity     float64
+	Amount       float64
+}
+
+func (d *Digest) FailureCount() int {
+	count := 0
+	for _, failures := range d.Failures {
+		count += failures.Count
+	}
+	return count
+}
+
+// Active reports whether anything happened in the period. Digests of
+// inactive users aren't sent.
+func (d *Digest) Active() bool {
+	return d.WorkspacesCreated > 0 || len(d.Failures) > 0 || len(d.CostItems) > 0
+}
+
+type DigestSource interface {
+	// Digests returns the digest of every user with an email address.
+	Digests(ctx context.Context, from, to time.Time) ([]*Digest, error)
+}
+
+// SQLDigestSource reads users, workspaces and billed usage from Postgres and
+// workspace failures from the Doris database of each tenant.
+type SQLDigestSource struct {
+	postgres integrations.SQLStore
+	doris    integrations.SQLStore
+}
+
+func NewSQLDigestSource(postgres, doris integrations.SQLStore) *SQLDigestSource {
+	return &SQLDigestSource{postgres: postgres, doris: doris}
+}
+
+func (s *SQLDigestSource) Digests(ctx context.Context, from, to time.Time) ([]*Digest, error) {
+	rows, err := s.postgres.ExecuteQuery(`SELECT id, email, first_name, username FROM app_user WHERE is_active AND email <> '' ORDER BY id`)
+	if err != nil {
+		return nil, fmt.Errorf("error listing users: %v", err)
+	}
+	digests := make([]*Digest, 0, len(rows))
+	byUser := make(map[string]*Digest, len(rows))
+	for _, row := range rows {
+		digest := &Digest{Recipient: *recipientFromRow(row), From: from, To: to}
+		digests = append(digests, digest)
+		byUser[digest.Recipient.UserID] = digest
+	}
+
+	if err := s.addWorkspaces(ctx, byUser, from, to); err != nil {
+		return nil, err
+	}
+	if err := s.addCosts(ctx, byUser, from, to); err != nil {
+		return nil, err
+	}
+	return digests, nil
+}
+
+type digestWorkspace struct {
+	name  string
+	owner *Digest
+}
+
+// addWorkspaces counts the workspaces of each user and their failures. A
+// tenant whose events cannot be read is skipped.
+func (s *SQLDigestSource) addWorkspaces(ctx context.Context, byUser map[string]*Digest, from, to time.Time) error {
+	rows, err := s.postgres.ExecuteQuery(
+		`SELECT id, name, created_by_id, organization_id, project_id, created_at FROM app_workspace WHERE created_by_id IS NOT NULL`,
+	)
+	if err != nil {
+		return fmt.Errorf("error listing workspaces: %v", err)
+	}
+
+	workspaces := map[string]digestWorkspace{}
+	tenants := map[tenancy.Tenant]bool{}
+	for _, row := range rows {
+		digest, ok := byUser[toString(row["created_by_id"])]
+		if !ok {
+			continue
+		}
+		digest.Workspaces++
+		if createdAt, ok := row["created_at"].(time.Time); ok && !createdAt.Before(from) && createdAt.Before(to) {
+			digest.WorkspacesCreated++
+		}
+
+		workspaces[toString(row["id"])] = digestWorkspace{name: toString(row["name"]), owner: digest}
+		if tenant, err := tenancy.New(toString(row["organization_id"]), toString(row["project_id"])); err == nil {
+			tenants[tenant] = true
+		}
+	}
+
+	for tenant := range tenants {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		rows, err := tenancy.NewDorisStore(tenant, s.doris).ExecuteQuery(
+			`SELECT workspace_id, COUNT(*) AS failures FROM {schema}.workspace_events
+			WHERE type = ? AND occurred_at >= ? AND occurred_at < ? GROUP BY workspace_id`,
+			string(events.WorkspaceFailed), from.UTC(), to.UTC(),
+		)
+		if err != nil {
+			emailLogger.Printf("Error counting workspace failures of %s: %v", tenant, err)
+			continue
+		}
+		for _, row := range rows {
+			workspaceID := toString(row["workspace_id"])
+			workspace, ok := workspaces[workspaceID]
+			if !ok {
+				continue
+			}
+			workspace.owner.Failures = append(workspace.owner.Failures, WorkspaceFailures{
+				WorkspaceID:   workspaceID,
+				WorkspaceName: workspace.name,
+				Count:         int(toFloat64(row["failures"])),
+			})
+		}
+	}
+
+	for _, digest := range byUser {
+		sort.Slice(digest.Failures, func(i, j int) bool {
+			return digest.Failures[i].Count > digest.Failures[j].Count
+		})
+	}
+	return nil
+}
+
+// addCosts attributes billed usage to the owner of the workspace it was
+// recorded for.
+func (s *SQLDigestSource) addCosts(ctx context.Context, byUser map[string]*Digest, from, to time.Time) error {
+	rows, err := s.postgres.ExecuteQuery(`
+		SELECT w.created_by_id AS user_id, u.resource_type, u.currency,
+			SUM(u.quantity) AS quantity, SUM(u.quantity * u.unit_price) AS amount
+		FROM app_usage u
+		JOIN app_workspace w ON w.id::text = u.metadata->>'workspace_id'
+		WHERE u.start_date >= $1 AND u.start_date < $2 AND w.created_by_id IS NOT NULL
+		GROUP BY w.created_by_id, u.resource_type, u.currency
+		ORDER BY u.resource_type`,
+		from.UTC(), to.UTC(),
+	)
+	if err != nil {
+		return fmt.Errorf("error loading usage: %v", err)
+	}
+
+	for _, row := range rows {
+		digest, ok := byUser[toString(row["user_id"])]
+		if !ok {
+			continue
+		}
+		currency := toString(row["currency"])
+		if digest.Currency == "" {
+			digest.Currency = currency
+		} else if currency != digest.Currency {
+			emailLogger.Printf("Usage of user %s is billed in both %s and %s, leaving %s out of the digest",
+				digest.Recipient.UserID, digest.Currency, currency, currency)
+			continue
+		}
+
+		item := CostItem{
+			ResourceType: toString(row["resource_type"]),
+			Quantity:     toFloat64(row["quantity"]),
+			Amount:       toFloat64(row["amount"]),
+		}
+		digest.Cost += item.Amount
+		digest.CostItems = append(digest.CostItems, item)
+	}
+	return nil
+}
+
+// DefaultDigestText and DefaultDigestHTML render digests unless
+// Config.TemplateDir holds digest.txt.tmpl and digest.html.tmpl. Both see a
+// Digest.
+const (
+	DefaultDigestText = `Hi {{.Recipient.Name}},
+
+Here is your activity from {{date .From}} to {{date .To}}.
+
+Workspaces: {{.Workspaces}} ({{.WorkspacesCreated}} created)
+{{- if .Failures}}
+
+Failures: {{.FailureCount}}
+{{- range .Failures}}
+  {{or .WorkspaceName .WorkspaceID}}: {{.Count}}
+{{- end}}
+{{- end}}
+{{- if .CostItems}}
+
+Cost: {{money .Cost .Currency}}
+{{- range .CostItems}}
+  {{.ResourceType}}: {{money .Amount $.Currency}}
+{{- end}}
+{{- end}}
+
+You can turn off this digest in your email preferences.
+`
+
+	DefaultDigestHTML = `<p>Hi {{.Recipient.Name}},</p>
+<p>Here is your activity from {{date .From}} to {{date .To}}.</p>
+<h3>Workspaces</h3>
+<p>{{.Workspaces}} ({{.WorkspacesCreated}} created)</p>
+{{- if .Failures}}
+<h3>Failures: {{.FailureCount}}</h3>
+<ul>
+{{- range .Failures}}
+<li>{{or .WorkspaceName .WorkspaceID}}: {{.Count}}</li>
+{{- end}}
+</ul>
+{{- end}}
+{{- if .CostItems}}
+<h3>Cost: {{money .Cost .Currency}}</h3>
+<table>
+{{- range .CostItems}}
+<tr><td>{{.ResourceType}}</td><td>{{money .Amount $.Currency}}</td></tr>
+{{- end}}
+</table>
+{{- end}}
+<p><small>You can turn off this digest in your email preferences.</small></p>
+`
+)
+
+var digestFuncs = map[string]interface{}{
+	"date": func(t time.Time) string {
+		return t.UTC().Format("2006-01-02 15:04 MST")
+	},
+	"money": func(amount float64, currency string) string {
+		return strconv.FormatFloat(amount, 'f', 2, 64) + " " + currency
+	},
+}
+
+// Digester renders and sends digests.
+type Digester struct {
+	source      DigestSource
+	sender      Sender
+	preferences PreferenceStore
+	text        *template.Template
+	html        *htmltemplate.Template
+}
+
+// NewDigester loads the digest templates of templateDir, or the defaults if
+// it is empty.
+func NewDigester(source DigestSource, sender Sender, preferences PreferenceStore, templateDir string) (*Digester, error) {
+	text, html := DefaultDigestText, DefaultDigestHTML
+	if templateDir != "" {
+		content, err := os.ReadFile(filepath.Join(templateDir, "digest.txt.tmpl"))
+		if err != nil {
+			return nil, fmt.Errorf("error reading digest template: %v", err)
+		}
+		text = string(content)
+		content, err = os.ReadFile(filepath.Join(templateDir, "digest.html.tmpl"))
+		if err != nil {
+			return nil, fmt.Errorf("error reading digest template: %v", err)
+		}
+		html = string(content)
+	}
+
+	digester := &Digester{source: source, sender: sender, preferences: preferences}
+	var err error
+	if digester.text, err = template.New("digest.txt").Funcs(digestFuncs).Parse(text); err != nil {
+		return nil, fmt.Errorf("invalid digest template: %v", err)
+	}
+	if digester.html, err = htmltemplate.New("digest.html").Funcs(digestFuncs).Parse(html); err != nil {
+		return nil, fmt.Errorf("invalid digest template: %v", err)
+	}
+	return digester, nil
+}
+
+// Render returns the digest as an email.
+func (d *Digester) Render(digest *Digest) (Message, error) {
+	var text, html bytes.Buffer
+	if err := d.text.Execute(&text, digest); err != nil {
+		return Message{}, fmt.Errorf("error rendering digest: %v", err)
+	}
+	if err := d.html.Execute(&html, digest); err != nil {
+		return Message{}, fmt.Errorf("error rendering digest: %v", err)
+	}
+	return Message{
+		To:      digest.Recipient.address(),
+		Subject: "Your activity on " + digest.From.UTC().Format("2006-01-02"),
+		Text:    text.String(),
+		HTML:    html.String(),
+	}, nil
+}
+
+// Send emails the digests of [from, to) to every active user who hasn't
+// turned the digest off, and returns how many were sent. A failed digest
+// doesn't stop the others.
+func (d *Digester) Send(ctx context.Context, from, to time.Time) (int, error) {
+	digests, err := d.source.Digests(ctx, from, to)
+	if err != nil {
+		return 0, err
+	}
+
+	sent, failed := 0, 0
+	for _, digest := range digests {
+		if err := ctx.Err(); err != nil {
+			return sent, err
+		}
+		if !digest.Active() {
+			continue
+		}
+		preferences, err := d.preferences.Get(ctx, digest.Recipient.UserID)
+		if err != nil {
+			return sent, err
+		}
+		if !preferences.Digest {
+			continue
+		}
+
+		message, err := d.Render(digest)
+		if err == nil {
+			err = d.sender.Send(ctx, message)
+		}
+		if err != nil {
+			emailLogger.Printf("Error sending the digest of user %s: %v", digest.Recipient.UserID, err)
+			failed++
+			continue
+		}
+		sent++
+	}
+
+	if failed > 0 {
+		return sent, fmt.Errorf("failed to send %d of %d digests", failed, sent+failed)
+	}
+	return sent, nil
+}
+
+func toString(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case []byte:
+		return string(v)
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+func toFloat64(value interface{}) float64 {
+	switch v := value.(type) {
+	case float64:
+		return v
+	case float32:
+		return float64(v)
+	case int64:
+		return float64(v)
+	case int:
+		return float64(v)
+	case []byte:
+		f, _ := strconv.ParseFloat(strings.TrimSpace(string(v)), 64)
+		return f
+	case string:
+		f, _ := strconv.ParseFloat(strings.TrimSpace(v), 64)
+		return f
+	default:
+		return 0
+	}
+}
@@ -0,0 +1,214 @@
+// Package email sends notifications and daily digests by email over SMTP.
+//
+// Notifications reuse the kinds and templates of package notify, but go to
+// the user concerned rather than to a channel: the owner of a failed or idle
+// workspace, or the user whose quota was reached. The daily digest summarizes
+// each user's workspaces, failures and cost. Users can turn off either in
+// their Preferences.
+package email
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"net/textproto"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+var emailLogger = log.New(os.Stdout, "kled.email: ", log.LstdFlags)
+
+// Message is an email with a plain text body and an optional HTML
+// alternative.
+type Message struct {
+	To      string
+	Subject string
+	Text    string
+	HTML    string
+}
+
+type Sender interface {
+	Send(ctx context.Context, message Message) error
+}
+
+type SenderFunc func(ctx context.Context, message Message) error
+
+func (f SenderFunc) Send(ctx context.Context, message Message) error {
+	return f(ctx, message)
+}
+
+// SMTPSender delivers messages through an SMTP server, upgrading the
+// connection with STARTTLS when the server offers it.
+type SMTPSender struct {
+	config Config
+}
+
+func NewSMTPSender(config Config) *SMTPSender {
+	return &SMTPSender{config: config}
+}
+
+func (s *SMTPSender) Send(ctx context.Context, message Message) error {
+	from, err := mail.ParseAddress(s.config.From)
+	if err != nil {
+		return fmt.Errorf("invalid sender address %q: %v", s.config.From, err)
+	}
+	to, err := mail.ParseAddress(message.To)
+	if err != nil {
+		return fmt.Errorf("invalid recipient address %q: %v", message.To, err)
+	}
+	body, err := Encode(from, to, message, time.Now())
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, s.config.Timeout)
+	defer cancel()
+	client, err := s.dial(ctx)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	if s.config.Username != "" {
+		auth := smtp.PlainAuth("", s.config.Username, s.config.Password, s.config.SMTPHost)
+		if err := client.Auth(auth); err != nil {
+			return fmt.Errorf("error authenticating with %s: %v", s.config.SMTPHost, err)
+		}
+	}
+	if err := client.Mail(from.Address); err != nil {
+		return fmt.Errorf("error sending to %s: %v", to.Address, err)
+	}
+	if err := client.Rcpt(to.Address); err != nil {
+		return fmt.Errorf("error sending to %s: %v", to.Address, err)
+	}
+	writer, err := client.Data()
+	if err != nil {
+		return fmt.Errorf("error sending to %s: %v", to.Address, err)
+	}
+	if _, err := writer.Write(body); err != nil {
+		return fmt.Errorf("error sending to %s: %v", to.Address, err)
+	}
+	if err := writer.Close(); err != nil {
+		return fmt.Errorf("error sending to %s: %v", to.Address, err)
+	}
+	return client.Quit()
+}
+
+func (s *SMTPSender) dial(ctx context.Context) (*smtp.Client, error) {
+	address := net.JoinHostPort(s.config.SMTPHost, strconv.Itoa(s.config.SMTPPort))
+	tlsConfig := &tls.Config{ServerName: s.config.SMTPHost}
+
+	dialer := &net.Dialer{}
+	conn, err := dialer.DialContext(ctx, "tcp", address)
+	if err != nil {
+		return nil, fmt.Errorf("error connecting to %s: %v", address, err)
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	if s.config.ImplicitTLS {
+		conn = tls.Client(conn, tlsConfig)
+	}
+
+	client, err := smtp.NewClient(conn, s.config.SMTPHost)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("error connecting to %s: %v", address, err)
+	}
+	if ok, _ := client.Extension("STARTTLS"); ok && !s.config.ImplicitTLS {
+		if err := client.StartTLS(tlsConfig); err != nil {
+			client.Close()
+			return nil, fmt.Errorf("error starting TLS with %s: %v", address, err)
+		}
+	}
+	return client, nil
+}
+
+// Encode returns the message in RFC 5322 format, as multipart/alternative
+// when it has an HTML body.
+func Encode(from, to *mail.Address, message Message, now time.Time) ([]byte, error) {
+	var buf bytes.Buffer
+	header := textproto.MIMEHeader{}
+	header.Set("From", from.String())
+	header.Set("To", to.String())
+	header.Set("Subject", mime.QEncoding.Encode("utf-8", message.Subject))
+	header.Set("Date", now.Format(time.RFC1123Z))
+	header.Set("Message-ID", fmt.Sprintf("<%s@%s>", uuid.New().String(), domain(from.Address)))
+	header.Set("MIME-Version", "1.0")
+
+	if message.HTML == "" {
+		header.Set("Content-Type", "text/plain; charset=utf-8")
+		header.Set("Content-Transfer-Encoding", "quoted-printable")
+		writeHeader(&buf, header)
+		if err := writeQuotedPrintable(&buf, message.Text); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	}
+
+	var parts bytes.Buffer
+	writer := multipart.NewWriter(&parts)
+	for _, part := range []struct{ contentType, body string }{
+		{"text/plain; charset=utf-8", message.Text},
+		{"text/html; charset=utf-8", message.HTML},
+	} {
+		partWriter, err := writer.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {part.contentType},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		})
+		if err != nil {
+			return nil, err
+		}
+		if err := writeQuotedPrintable(partWriter, part.body); err != nil {
+			return nil, err
+		}
+	}
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+
+	header.Set("Content-Type", "multipart/alternative; boundary="+writer.Boundary())
+	writeHeader(&buf, header)
+	buf.Write(parts.Bytes())
+	return buf.Bytes(), nil
+}
+
+// headerOrder is the order headers are written in.
+var headerOrder = []string{"From", "To", "Subject", "Date", "Message-ID", "MIME-Version", "Content-Type", "Content-Transfer-Encoding"}
+
+func writeHeader(buf *bytes.Buffer, header textproto.MIMEHeader) {
+	for _, key := range headerOrder {
+		if value := header.Get(key); value != "" {
+			fmt.Fprintf(buf, "%s: %s\r\n", key, value)
+		}
+	}
+	buf.WriteString("\r\n")
+}
+
+func writeQuotedPrintable(w io.Writer, text string) error {
+	writer := quotedprintable.NewWriter(w)
+	if _, err := writer.Write([]byte(strings.ReplaceAll(text, "\n", "\r\n"))); err != nil {
+		return err
+	}
+	return writer.Close()
+}
+
+func domain(address string) string {
+	if i := strings.LastIndex(address, "@"); i >= 0 {
+		return address[i+1:]
+	}
+	return "localhost"
+}
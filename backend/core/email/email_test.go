@@ -0,0 +1,174 @@
+package email
+
+import (
+	"context"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/mail"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/spectrumwebco/agent_runtime/backend/core/notify"
+)
+
+type outbox struct {
+	messages []Message
+}
+
+func (o *outbox) Send(ctx context.Context, message Message) error {
+	o.messages = append(o.messages, message)
+	return nil
+}
+
+type directory map[string]*Recipient
+
+func (d directory) Recipient(ctx context.Context, userID string) (*Recipient, error) {
+	return d[userID], nil
+}
+
+func (d directory) WorkspaceOwner(ctx context.Context, workspaceID string) (string, error) {
+	return "", nil
+}
+
+type digestSource []*Digest
+
+func (s digestSource) Digests(ctx context.Context, from, to time.Time) ([]*Digest, error) {
+	return s, nil
+}
+
+func TestEncodeMultipart(t *testing.T) {
+	from := &mail.Address{Name: "Kled", Address: "noreply@example.com"}
+	to := &mail.Address{Name: "Ada", Address: "ada@example.com"}
+	body, err := Encode(from, to, Message{Subject: "Grüße", Text: "plain body", HTML: "<p>html body</p>"}, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	message, err := mail.ReadMessage(strings.NewReader(string(body)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	subject, err := new(mime.WordDecoder).DecodeHeader(message.Header.Get("Subject"))
+	if err != nil || subject != "Grüße" {
+		t.Errorf("expected the encoded subject to decode, got %q (%v)", subject, err)
+	}
+	mediaType, params, err := mime.ParseMediaType(message.Header.Get("Content-Type"))
+	if err != nil || mediaType != "multipart/alternative" {
+		t.Fatalf("expected multipart/alternative, got %q (%v)", mediaType, err)
+	}
+
+	reader := multipart.NewReader(message.Body, params["boundary"])
+	var parts []string
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		content, _ := io.ReadAll(part)
+		parts = append(parts, part.Header.Get("Content-Type")+": "+string(content))
+	}
+	if len(parts) != 2 || !strings.HasSuffix(parts[0], "plain body") || !strings.HasSuffix(parts[1], "<p>html body</p>") {
+		t.Errorf("unexpected parts %q", parts)
+	}
+}
+
+func TestNotifyRespectsPreferences(t *testing.T) {
+	ctx := context.Background()
+	sent := &outbox{}
+	preferences := NewMemoryPreferenceStore()
+	notifier := NewNotifier(sent, preferences, directory{
+		"u1": {UserID: "u1", Email: "ada@example.com", Name: "Ada"},
+	})
+	notification := notify.Notification{
+		Kind: notify.KindQuotaReached,
+		Data: map[string]interface{}{"resource": "cpu_hours", "used": 10.0, "limit": 10.0, "period": "2026-03"},
+	}
+
+	if err := notifier.Notify(ctx, "u1", notification); err != nil {
+		t.Fatal(err)
+	}
+	if err := notifier.Notify(ctx, "unknown", notification); err != nil {
+		t.Fatal(err)
+	}
+	if len(sent.messages) != 1 {
+		t.Fatalf("expected one email, got %+v", sent.messages)
+	}
+	message := sent.messages[0]
+	if message.To != `"Ada" <ada@example.com>` || message.Subject != "Quota reached" ||
+		message.Text != "You reached your cpu_hours quota for 2026-03: 10 of 10 used." {
+		t.Errorf("unexpected email %+v", message)
+	}
+
+	preferences.Set(ctx, Preferences{UserID: "u1", Notifications: false, Digest: true})
+	notifier.Notify(ctx, "u1", notification)
+	if len(sent.messages) != 1 {
+		t.Errorf("expected no email after notifications were turned off, got %d", len(sent.messages))
+	}
+}
+
+func TestDigesterSkipsInactiveAndSuppressedUsers(t *testing.T) {
+	ctx := context.Background()
+	from := time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+	to := from.Add(24 * time.Hour)
+	active := &Digest{
+		Recipient:         Recipient{UserID: "u1", Email: "ada@example.com", Name: "Ada"},
+		Workspaces:        3,
+		WorkspacesCreated: 1,
+		Failures:          []WorkspaceFailures{{WorkspaceID: "ws-1", WorkspaceName: "api", Count: 2}},
+		Currency:          "USD",
+		Cost:              12.5,
+		CostItems:         []CostItem{{ResourceType: "tokens", Quantity: 1000, Amount: 12.5}},
+	}
+	idle := &Digest{Recipient: Recipient{UserID: "u2", Email: "bob@example.com"}, Workspaces: 1}
+	suppressed := &Digest{Recipient: Recipient{UserID: "u3", Email: "eve@example.com"}, WorkspacesCreated: 1}
+
+	sent := &outbox{}
+	preferences := NewMemoryPreferenceStore()
+	preferences.Set(ctx, Preferences{UserID: "u3", Notifications: true, Digest: false})
+	digester, err := NewDigester(digestSource{active, idle, suppressed}, sent, preferences, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	count, err := digester.Send(ctx, from, to)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 1 || len(sent.messages) != 1 || sent.messages[0].To != `"Ada" <ada@example.com>` {
+		t.Fatalf("expected only the active user's digest, got %d %+v", count, sent.messages)
+	}
+	message := sent.messages[0]
+	for _, want := range []string{"Workspaces: 3 (1 created)", "Failures: 2", "api: 2", "Cost: 12.50 USD", "tokens: 12.50 USD"} {
+		if !strings.Contains(message.Text, want) {
+			t.Errorf("expected the digest to contain %q, got:\n%s", want, message.Text)
+		}
+	}
+	if !strings.Contains(message.HTML, "<li>api: 2</li>") {
+		t.Errorf("unexpected HTML digest:\n%s", message.HTML)
+	}
+}
+
+func TestDigestTemplateDir(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "digest.txt.tmpl"), []byte("{{.Recipient.Name}} owns {{.Workspaces}}"), 0o644)
+	os.WriteFile(filepath.Join(dir, "digest.html.tmpl"), []byte("<b>{{.Recipient.Name}}</b>"), 0o644)
+
+	digester, err := NewDigester(digestSource{}, &outbox{}, NewMemoryPreferenceStore(), dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	message, err := digester.Render(&Digest{Recipient: Recipient{Name: "<Ada>", Email: "ada@example.com"}, Workspaces: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if message.Text != "<Ada> owns 2" || message.HTML != "<b>&lt;Ada&gt;</b>" {
+		t.Errorf("unexpected rendering %q %q", message.Text, message.HTML)
+	}
+}
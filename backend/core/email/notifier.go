@@ -0,0 +1,266 @@
+package email
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/spectrumwebco/agent_runtime/backend/core/events"
+	"github.com/spectrumwebco/agent_runtime/backend/core/gpu"
+	"github.com/spectrumwebco/agent_runtime/backend/core/notify"
+	"github.com/spectrumwebco/agent_runtime/backend/core/quota"
+	"github.com/spectrumwebco/agent_runtime/backend/db/integrations"
+)
+
+// Recipient is a user who can be emailed.
+type Recipient struct {
+	UserID string `json:"user_id"`
+	Email  string `json:"email"`
+	Name   string `json:"name"`
+}
+
+// Directory resolves the users notifications are about.
+type Directory interface {
+	// Recipient returns nil for unknown or inactive users and for users
+	// without an email address.
+	Recipient(ctx context.Context, userID string) (*Recipient, error)
+	// WorkspaceOwner returns the ID of the user who created the workspace,
+	// or "" if it isn't known.
+	WorkspaceOwner(ctx context.Context, workspaceID string) (string, error)
+}
+
+// SQLDirectory reads users and workspaces from Postgres.
+type SQLDirectory struct {
+	postgres integrations.SQLStore
+}
+
+func NewSQLDirectory(postgres integrations.SQLStore) *SQLDirectory {
+	return &SQLDirectory{postgres: postgres}
+}
+
+func (d *SQLDirectory) Recipient(ctx context.Context, userID string) (*Recipient, error) {
+	rows, err := d.postgres.ExecuteQuery(
+		`SELECT id, email, first_name, username FROM app_user WHERE id = $1 AND is_active AND email <> ''`, userID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("error loading user %s: %v", userID, err)
+	}
+	if len(rows) == 0 {
+		return nil, nil
+	}
+	return recipientFromRow(rows[0]), nil
+}
+
+func (d *SQLDirectory) WorkspaceOwner(ctx context.Context, workspaceID string) (string, error) {
+	rows, err := d.postgres.ExecuteQuery(`SELECT created_by_id FROM app_workspace WHERE id = $1`, workspaceID)
+	if err != nil {
+		return "", fmt.Errorf("error loading workspace %s: %v", workspaceID, err)
+	}
+	if len(rows) == 0 {
+		return "", nil
+	}
+	return toString(rows[0]["created_by_id"]), nil
+}
+
+func recipientFromRow(row map[string]interface{}) *Recipient {
+	recipient := &Recipient{
+		UserID: toString(row["id"]),
+		Email:  toString(row["email"]),
+		Name:   toString(row["first_name"]),
+	}
+	if recipient.Name == "" {
+		recipient.Name = toString(row["username"])
+	}
+	return recipient
+}
+
+// notificationTemplates override the channel templates of notify where an
+// email addresses a single user.
+var notificationTemplates = map[notify.Kind]string{
+	notify.KindQuotaReached: `You reached your {{.Data.resource}} quota` +
+		`{{with .Data.period}} for {{.}}{{end}}: {{.Data.used}} of {{.Data.limit}} used.`,
+}
+
+// Notifier emails notifications to the users they concern. Without a sender
+// it drops them.
+type Notifier struct {
+	sender      Sender
+	preferences PreferenceStore
+	directory   Directory
+}
+
+func NewNotifier(sender Sender, preferences PreferenceStore, directory Directory) *Notifier {
+	return &Notifier{sender: sender, preferences: preferences, directory: directory}
+}
+
+func (n *Notifier) Preferences() PreferenceStore {
+	return n.preferences
+}
+
+// Notify emails the notification to the user, unless they turned
+// notifications off or have no address.
+func (n *Notifier) Notify(ctx context.Context, userID string, notification notify.Notification) error {
+	if n.sender == nil {
+		return nil
+	}
+	preferences, err := n.preferences.Get(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if !preferences.Notifications {
+		return nil
+	}
+	recipient, err := n.directory.Recipient(ctx, userID)
+	if err != nil || recipient == nil {
+		return err
+	}
+
+	text, err := notify.Render(&notify.Channel{Templates: notificationTemplates}, notification)
+	if err != nil {
+		return err
+	}
+	return n.sender.Send(ctx, Message{
+		To:      recipient.address(),
+		Subject: notify.Titles[notification.Kind],
+		Text:    text,
+	})
+}
+
+func (r *Recipient) address() string {
+	if r.Name == "" {
+		return r.Email
+	}
+	return fmt.Sprintf("%q <%s>", r.Name, r.Email)
+}
+
+// notifyAsync emails without holding up the request or reconciliation that
+// produced the notification. userID may be resolved from the workspace
+// owner.
+func (n *Notifier) notifyAsync(userID, workspaceID string, notification notify.Notification) {
+	if n.sender == nil {
+		return
+	}
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+		defer cancel()
+
+		if userID == "" && workspaceID != "" {
+			owner, err := n.directory.WorkspaceOwner(ctx, workspaceID)
+			if err != nil {
+				emailLogger.Printf("Error resolving the owner of workspace %s: %v", workspaceID, err)
+				return
+			}
+			userID = owner
+		}
+		if userID == "" {
+			return
+		}
+		if err := n.Notify(ctx, userID, notification); err != nil {
+			emailLogger.Printf("Error emailing %s to user %s: %v", notification.Kind, userID, err)
+		}
+	}()
+}
+
+// Publish emails the user who caused a workspace to fail, or else its
+// owner. Other events are ignored.
+func (n *Notifier) Publish(ctx context.Context, event events.WorkspaceEvent) error {
+	if notification, ok := notify.FromWorkspaceEvent(ctx, event); ok {
+		n.notifyAsync(event.ActorID, event.WorkspaceID, notification)
+	}
+	return nil
+}
+
+// NotifyQuota is a quota.Notifier that emails users who reached one of their
+// own quotas.
+func (n *Notifier) NotifyQuota(ctx context.Context, warning quota.Warning) {
+	if warning.Scope.Type != quota.ScopeUser || warning.Ratio < 1 {
+		return
+	}
+	n.notifyAsync(warning.Scope.ID, "", notify.Notification{
+		Kind:       notify.KindQuotaReached,
+		Subject:    string(warning.Resource) + "|" + warning.Period,
+		OccurredAt: warning.OccurredAt,
+		Data: map[string]interface{}{
+			"resource": string(warning.Resource),
+			"used":     warning.Used,
+			"limit":    warning.Limit,
+			"period":   warning.Period,
+		},
+	})
+}
+
+// NotifyGPU is a gpu.Notifier that warns owners before their idle workspace
+// is stopped.
+func (n *Notifier) NotifyGPU(ctx context.Context, notice gpu.Notice) error {
+	if notification, ok := notify.FromGPUNotice(notice); ok {
+		n.notifyAsync(notice.Workspace.OwnerID, notice.Workspace.ID, notification)
+	}
+	return nil
+}
+
+var (
+	defaultNotifier *Notifier
+	notifierMu      sync.RWMutex
+)
+
+// DefaultNotifier returns the notifier installed by ConfigureDefault, or nil
+// before that.
+func DefaultNotifier() *Notifier {
+	notifierMu.RLock()
+	defer notifierMu.RUnlock()
+	return defaultNotifier
+}
+
+func SetDefaultNotifier(notifier *Notifier) {
+	notifierMu.Lock()
+	defer notifierMu.Unlock()
+	defaultNotifier = notifier
+}
+
+// ConfigureDefault installs the default notifier, keeping preferences in
+// Postgres or, if their table cannot be created, in memory. Without an SMTP
+// server the notifier only keeps preferences.
+func ConfigureDefault(client integrations.SQLStore, config Config) *Notifier {
+	var preferences PreferenceStore = NewPostgresPreferenceStore(client)
+	if err := preferences.(*PostgresPreferenceStore).EnsureSchema(); err != nil {
+		emailLogger.Printf("Email preferences falling back to in-memory store: %v", err)
+		preferences = NewMemoryPreferenceStore()
+	}
+
+	var sender Sender
+	if config.Enabled() {
+		sender = NewSMTPSender(config)
+	}
+	notifier := NewNotifier(sender, preferences, NewSQLDirectory(client))
+	SetDefaultNotifier(notifier)
+	return notifier
+}
+
+// Publisher, QuotaNotifier and GPUNotifier forward to whichever notifier is
+// the default at the time, so they can be installed before ConfigureDefault
+// runs.
+var (
+	Publisher     events.Publisher = defaultPublisher{}
+	QuotaNotifier quota.Notifier   = quota.NotifierFunc(func(ctx context.Context, warning quota.Warning) {
+		if notifier := DefaultNotifier(); notifier != nil {
+			notifier.NotifyQuota(ctx, warning)
+		}
+	})
+	GPUNotifier gpu.Notifier = gpu.NotifierFunc(func(ctx context.Context, notice gpu.Notice) error {
+		if notifier := DefaultNotifier(); notifier != nil {
+			return notifier.NotifyGPU(ctx, notice)
+		}
+		return nil
+	})
+)
+
+type defaultPublisher struct{}
+
+func (defaultPublisher) Publish(ctx context.Context, event events.WorkspaceEvent) error {
+	notifier := DefaultNotifier()
+	if notifier == nil {
+		return nil
+	}
+	return notifier.Publish(ctx, event)
+}
@@ -0,0 +1,116 @@
+package email
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/spectrumwebco/agent_runtime/backend/db/integrations"
+)
+
+// Preferences are a user's choices about email. Users without stored
+// preferences receive everything.
+type Preferences struct {
+	UserID        string    `json:"user_id"`
+	Notifications bool      `json:"notifications"`
+	Digest        bool      `json:"digest"`
+	UpdatedAt     time.Time `json:"updated_at,omitempty"`
+}
+
+func DefaultPreferences(userID string) Preferences {
+	return Preferences{UserID: userID, Notifications: true, Digest: true}
+}
+
+type PreferenceStore interface {
+	// Get returns the user's preferences, or DefaultPreferences.
+	Get(ctx context.Context, userID string) (Preferences, error)
+	Set(ctx context.Context, preferences Preferences) error
+}
+
+type MemoryPreferenceStore struct {
+	preferences map[string]Preferences
+	mu          sync.Mutex
+}
+
+func NewMemoryPreferenceStore() *MemoryPreferenceStore {
+	return &MemoryPreferenceStore{preferences: make(map[string]Preferences)}
+}
+
+func (s *MemoryPreferenceStore) Get(ctx context.Context, userID string) (Preferences, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if preferences, ok := s.preferences[userID]; ok {
+		return preferences, nil
+	}
+	return DefaultPreferences(userID), nil
+}
+
+func (s *MemoryPreferenceStore) Set(ctx context.Context, preferences Preferences) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.preferences[preferences.UserID] = preferences
+	return nil
+}
+
+// PostgresPreferenceStore keeps preferences in app_email_preference.
+type PostgresPreferenceStore struct {
+	client integrations.SQLStore
+}
+
+func NewPostgresPreferenceStore(client integrations.SQLStore) *PostgresPreferenceStore {
+	return &PostgresPreferenceStore{client: client}
+}
+
+func (s *PostgresPreferenceStore) EnsureSchema() error {
+	_, err := s.client.ExecuteUpdate(`
+		CREATE TABLE IF NOT EXISTS app_email_preference (
+			user_id VARCHAR(64) PRIMARY KEY,
+			notifications BOOLEAN NOT NULL DEFAULT TRUE,
+			digest BOOLEAN NOT NULL DEFAULT TRUE,
+			updated_at TIMESTAMPTZ NOT NULL DEFAULT now()
+		)
+	`)
+	if err != nil {
+		return fmt.Errorf("error creating email preference table: %v", err)
+	}
+	return nil
+}
+
+func (s *PostgresPreferenceStore) Get(ctx context.Context, userID string) (Preferences, error) {
+	rows, err := s.client.ExecuteQuery(
+		`SELECT notifications, digest, updated_at FROM app_email_preference WHERE user_id = $1`, userID,
+	)
+	if err != nil {
+		return Preferences{}, fmt.Errorf("error loading email preferences of user %s: %v", userID, err)
+	}
+	if len(rows) == 0 {
+		return DefaultPreferences(userID), nil
+	}
+
+	preferences := Preferences{UserID: userID}
+	preferences.Notifications, _ = rows[0]["notifications"].(bool)
+	preferences.Digest, _ = rows[0]["digest"].(bool)
+	if updatedAt, ok := rows[0]["updated_at"].(time.Time); ok {
+		preferences.UpdatedAt = updatedAt.UTC()
+	}
+	return preferences, nil
+}
+
+func (s *PostgresPreferenceStore) Set(ctx context.Context, preferences Preferences) error {
+	_, err := s.client.ExecuteUpdate(`
+		INSERT INTO app_email_preference (user_id, notifications, digest, updated_at)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (user_id) DO UPDATE SET
+			notifications = EXCLUDED.notifications,
+			digest = EXCLUDED.digest,
+			updated_at = EXCLUDED.updated_at`,
+		preferences.UserID, preferences.Notifications, preferences.Digest, preferences.UpdatedAt,
+	)
+	if err != nil {
+		return fmt.Errorf("error saving email preferences of user %s: %v", preferences.UserID, err)
+	}
+	return nil
+}
@@ -0,0 +1,122 @@
+package embeddings
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/spectrumwebco/agent_runtime/backend/core/tenancy"
+	"github.com/spectrumwebco/agent_runtime/backend/db/integrations"
+)
+
+var cacheLookups = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "kled_embeddings_cache_lookups_total",
+	Help: "Embedding cache lookups, by result: hit or miss.",
+}, []string{"result"})
+
+func init() {
+	prometheus.MustRegister(cacheLookups)
+}
+
+// Cache keeps vectors in the tenant's namespace of a KVStore, keyed by the
+// model and the SHA-256 of the text:
+//
+//	embedding:{model}:{sha256}  base64 of little-endian float32s
+//
+// Vectors are stored as float32, which is the precision models produce.
+type Cache struct {
+	inner Embedder
+	kv    integrations.KVStore
+	ttl   time.Duration
+}
+
+func NewCache(inner Embedder, kv integrations.KVStore, ttl time.Duration) *Cache {
+	return &Cache{inner: inner, kv: kv, ttl: ttl}
+}
+
+func (c *Cache) Model() string {
+	return c.inner.Model()
+}
+
+func (c *Cache) key(text string) string {
+	sum := sha256.Sum256([]byte(text))
+	return fmt.Sprintf("embedding:%s:%s", c.inner.Model(), hex.EncodeToString(sum[:]))
+}
+
+// Embed embeds only the texts without a cached vector, each distinct text
+// once. The cache failing is logged and the texts embedded anyway.
+func (c *Cache) Embed(ctx context.Context, tenant tenancy.Tenant, texts []string) ([][]float64, error) {
+	kv := tenancy.NewKVStore(tenant, c.kv)
+
+	// found holds a nil vector for the texts to embed
+	found := make(map[string][]float64, len(texts))
+	var missing []string
+	for _, text := range texts {
+		if _, ok := found[text]; ok {
+			continue
+		}
+		value, err := kv.Get(c.key(text))
+		if err != nil {
+			embeddingsLogger.Printf("Error reading cached embedding: %v", err)
+		}
+		if vector, ok := decodeVector(value); ok {
+			cacheLookups.WithLabelValues("hit").Inc()
+			found[text] = vector
+			continue
+		}
+		cacheLookups.WithLabelValues("miss").Inc()
+		found[text] = nil
+		missing = append(missing, text)
+	}
+
+	if len(missing) > 0 {
+		embedded, err := c.inner.Embed(ctx, tenant, missing)
+		if err != nil {
+			return nil, err
+		}
+		if len(embedded) != len(missing) {
+			return nil, fmt.Errorf("%s returned %d vectors for %d texts", c.inner.Model(), len(embedded), len(missing))
+		}
+		for i, text := range missing {
+			found[text] = embedded[i]
+			if _, err := kv.Set(c.key(text), encodeVector(embedded[i]), int(c.ttl.Seconds())); err != nil {
+				embeddingsLogger.Printf("Error caching embedding: %v", err)
+			}
+		}
+	}
+
+	vectors := make([][]float64, len(texts))
+	for i, text := range texts {
+		vectors[i] = found[text]
+	}
+	return vectors, nil
+}
+
+func encodeVector(vector []float64) string {
+	raw := make([]byte, 4*len(vector))
+	for i, value := range vector {
+		binary.LittleEndian.PutUint32(raw[4*i:], math.Float32bits(float32(value)))
+	}
+	return base64.StdEncoding.EncodeToString(raw)
+}
+
+func decodeVector(value string) ([]float64, bool) {
+	if value == "" {
+		return nil, false
+	}
+	raw, err := base64.StdEncoding.DecodeString(value)
+	if err != nil || len(raw)%4 != 0 || len(raw) == 0 {
+		return nil, false
+	}
+	vector := make([]float64, len(raw)/4)
+	for i := range vector {
+		vector[i] = float64(math.Float32frombits(binary.LittleEndian.Uint32(raw[4*i:])))
+	}
+	return vector, true
+}
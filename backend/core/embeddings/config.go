@@ -0,0 +1,136 @@
+package embeddings
+
+import (
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/spectrumwebco/agent_runtime/backend/core/config/env"
+	"github.com/spectrumwebco/agent_runtime/backend/core/llm"
+	"github.com/spectrumwebco/agent_runtime/backend/core/outbound"
+	"github.com/spectrumwebco/agent_runtime/backend/db/integrations"
+)
+
+const (
+	BackendGateway = "gateway"
+	BackendONNX    = "onnx"
+	BackendRAGflow = "ragflow"
+)
+
+type Config struct {
+	// Backend is gateway, onnx or ragflow.
+	Backend string `json:"backend"`
+	// Model is the gateway model alias, or the RAGflow model.
+	Model string `json:"model"`
+	// ONNXModelDir holds model.onnx and tokenizer.json.
+	ONNXModelDir string `json:"onnx_model_dir,omitempty"`
+	// ONNXMaxLength truncates texts to that many tokens.
+	ONNXMaxLength int    `json:"onnx_max_length"`
+	RAGflowURL    string `json:"ragflow_url,omitempty"`
+	RAGflowAPIKey string `json:"-"`
+	// BatchSize is the most texts passed to the backend at a time.
+	BatchSize int `json:"batch_size"`
+	// CacheTTL is how long vectors are cached; 0 disables the cache.
+	CacheTTL time.Duration `json:"cache_ttl"`
+	Timeout  time.Duration `json:"timeout"`
+}
+
+const (
+	DefaultModel         = "embeddings"
+	DefaultONNXMaxLength = 512
+	DefaultBatchSize     = 64
+	DefaultCacheTTL      = 30 * 24 * time.Hour
+	DefaultTimeout       = time.Minute
+)
+
+var Default = env.Once(FromEnv)
+
+func FromEnv() Config {
+	config := Config{
+		Backend:       BackendGateway,
+		Model:         DefaultModel,
+		ONNXModelDir:  os.Getenv("AGENT_EMBEDDINGS_ONNX_MODEL_DIR"),
+		ONNXMaxLength: DefaultONNXMaxLength,
+		RAGflowURL:    os.Getenv("RAGFLOW_API_URL"),
+		RAGflowAPIKey: os.Getenv("RAGFLOW_API_KEY"),
+		BatchSize:     DefaultBatchSize,
+		CacheTTL:      DefaultCacheTTL,
+		Timeout:       DefaultTimeout,
+	}
+	read := env.NewReader(embeddingsLogger)
+	read.String("AGENT_EMBEDDINGS_RAGFLOW_URL", &config.RAGflowURL)
+	read.String("AGENT_EMBEDDINGS_MODEL", &config.Model)
+	read.OneOf("AGENT_EMBEDDINGS_BACKEND", &config.Backend, BackendGateway, BackendONNX, BackendRAGflow)
+	if config.Backend == BackendONNX && config.ONNXModelDir == "" {
+		embeddingsLogger.Printf("AGENT_EMBEDDINGS_ONNX_MODEL_DIR is required for the onnx backend, using the gateway")
+		config.Backend = BackendGateway
+	}
+	if config.Backend == BackendRAGflow && config.RAGflowURL == "" {
+		embeddingsLogger.Printf("AGENT_EMBEDDINGS_RAGFLOW_URL or RAGFLOW_API_URL is required for the ragflow backend, using the gateway")
+		config.Backend = BackendGateway
+	}
+	read.Int("AGENT_EMBEDDINGS_ONNX_MAX_LENGTH", &config.ONNXMaxLength, 1)
+	read.Int("AGENT_EMBEDDINGS_BATCH_SIZE", &config.BatchSize, 1)
+	read.Duration("AGENT_EMBEDDINGS_CACHE_TTL", &config.CacheTTL, 0)
+	read.PositiveDuration("AGENT_EMBEDDINGS_TIMEOUT", &config.Timeout)
+	return config
+}
+
+// Variables returns the variables FromEnv reads c from.
+func (c Config) Variables() map[string]string {
+	return map[string]string{
+		"AGENT_EMBEDDINGS_BACKEND":         c.Backend,
+		"AGENT_EMBEDDINGS_MODEL":           c.Model,
+		"AGENT_EMBEDDINGS_ONNX_MODEL_DIR":  c.ONNXModelDir,
+		"AGENT_EMBEDDINGS_ONNX_MAX_LENGTH": strconv.Itoa(c.ONNXMaxLength),
+		"AGENT_EMBEDDINGS_RAGFLOW_URL":     c.RAGflowURL,
+		"RAGFLOW_API_KEY":                  c.RAGflowAPIKey,
+		"AGENT_EMBEDDINGS_BATCH_SIZE":      strconv.Itoa(c.BatchSize),
+		"AGENT_EMBEDDINGS_CACHE_TTL":       c.CacheTTL.String(),
+		"AGENT_EMBEDDINGS_TIMEOUT":         c.Timeout.String(),
+	}
+}
+
+// New builds the embedder of a configuration: the backend, batched and,
+// unless the TTL is 0, cached in kv.
+func New(config Config, gateway *llm.Gateway, kv integrations.KVStore) Embedder {
+	var backend Embedder
+	switch config.Backend {
+	case BackendONNX:
+		backend = NewONNXEmbedder(config.ONNXModelDir, config.ONNXMaxLength)
+	case BackendRAGflow:
+		client, err := outbound.Default().HTTPClient(config.Timeout)
+		if err != nil {
+			embeddingsLogger.Printf("Error loading the outbound CA bundle: %v", err)
+		}
+		backend = NewRAGflowEmbedder(config.RAGflowURL, config.RAGflowAPIKey, config.Model, client)
+	default:
+		backend = NewGatewayEmbedder(gateway, config.Model)
+	}
+
+	var embedder Embedder = NewBatcher(backend, config.BatchSize)
+	if config.CacheTTL > 0 && kv != nil {
+		embedder = NewCache(embedder, kv, config.CacheTTL)
+	}
+	return embedder
+}
+
+var (
+	defaultEmbedder   Embedder
+	defaultEmbedderMu sync.RWMutex
+)
+
+func DefaultEmbedder() Embedder {
+	defaultEmbedderMu.RLock()
+	defer defaultEmbedderMu.RUnlock()
+
+	return defaultEmbedder
+}
+
+func SetDefaultEmbedder(embedder Embedder) {
+	defaultEmbedderMu.Lock()
+	defer defaultEmbedderMu.Unlock()
+
+	defaultEmbedder = embedder
+}
@@ -0,0 +1,139 @@
+// Package embeddings turns texts into vectors for the RAGflow indexes.
+//
+// An Embedder is backed by a model of the LLM gateway, a local ONNX model or
+// RAGflow's own embedding endpoint. Batcher splits large inputs into the
+// batches a backend accepts, and Cache keeps the vectors of each text in
+// Dragonfly keyed by a hash of its content, so re-ingesting unchanged
+// documents costs no tokens. Ingest embeds documents and adds them to a
+// vector index.
+package embeddings
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/spectrumwebco/agent_runtime/backend/core/llm"
+	"github.com/spectrumwebco/agent_runtime/backend/core/tenancy"
+	"github.com/spectrumwebco/agent_runtime/backend/db/integrations"
+)
+
+var embeddingsLogger = log.New(os.Stdout, "kled.embeddings: ", log.LstdFlags)
+
+type Embedder interface {
+	// Model names the model. Vectors of different models are not comparable
+	// and are cached apart.
+	Model() string
+	// Embed returns a vector for each text, in order.
+	Embed(ctx context.Context, tenant tenancy.Tenant, texts []string) ([][]float64, error)
+}
+
+// GatewayEmbedder embeds with a model of the LLM gateway, which accounts the
+// tokens to the tenant. A nil gateway is the default gateway at the time of
+// the call.
+type GatewayEmbedder struct {
+	gateway *llm.Gateway
+	model   string
+}
+
+func NewGatewayEmbedder(gateway *llm.Gateway, model string) *GatewayEmbedder {
+	return &GatewayEmbedder{gateway: gateway, model: model}
+}
+
+func (e *GatewayEmbedder) Model() string {
+	return "gateway:" + e.model
+}
+
+func (e *GatewayEmbedder) Embed(ctx context.Context, tenant tenancy.Tenant, texts []string) ([][]float64, error) {
+	gateway := e.gateway
+	if gateway == nil {
+		gateway = llm.DefaultGateway()
+	}
+	if gateway == nil {
+		return nil, fmt.Errorf("the LLM gateway is not configured")
+	}
+	response, err := gateway.Embed(ctx, tenant, llm.EmbeddingRequest{Model: e.model, Input: texts})
+	if err != nil {
+		return nil, err
+	}
+	return response.Embeddings, nil
+}
+
+// Batcher passes at most Size texts at a time to the embedder it wraps.
+type Batcher struct {
+	inner Embedder
+	size  int
+}
+
+func NewBatcher(inner Embedder, size int) *Batcher {
+	return &Batcher{inner: inner, size: size}
+}
+
+func (b *Batcher) Model() string {
+	return b.inner.Model()
+}
+
+func (b *Batcher) Embed(ctx context.Context, tenant tenancy.Tenant, texts []string) ([][]float64, error) {
+	if b.size < 1 || len(texts) <= b.size {
+		return b.inner.Embed(ctx, tenant, texts)
+	}
+
+	vectors := make([][]float64, 0, len(texts))
+	for start := 0; start < len(texts); start += b.size {
+		end := start + b.size
+		if end > len(texts) {
+			end = len(texts)
+		}
+		batch, err := b.inner.Embed(ctx, tenant, texts[start:end])
+		if err != nil {
+			return nil, err
+		}
+		if len(batch) != end-start {
+			return nil, fmt.Errorf("%s returned %d vectors for %d texts", b.inner.Model(), len(batch), end-start)
+		}
+		vectors = append(vectors, batch...)
+	}
+	return vectors, nil
+}
+
+// Document is a text to add to a vector index.
+type Document struct {
+	ID       string                 `json:"id" openapi:"required"`
+	Text     string                 `json:"text" openapi:"required"`
+	Metadata map[string]interface{} `json:"metadata,omitempty"`
+}
+
+// Ingest embeds documents and adds them to an index of the vector store,
+// which should be scoped to the tenant. The text is kept in the metadata so
+// search results carry it.
+func Ingest(ctx context.Context, embedder Embedder, tenant tenancy.Tenant, vectors integrations.VectorStore, index string, documents []Document) ([]string, error) {
+	if len(documents) == 0 {
+		return []string{}, nil
+	}
+
+	texts := make([]string, len(documents))
+	ids := make([]string, len(documents))
+	metadata := make([]map[string]interface{}, len(documents))
+	for i, document := range documents {
+		texts[i] = document.Text
+		ids[i] = document.ID
+		metadata[i] = map[string]interface{}{"text": document.Text, "embedding_model": embedder.Model()}
+		for key, value := range document.Metadata {
+			metadata[i][key] = value
+		}
+	}
+
+	embedded, err := embedder.Embed(ctx, tenant, texts)
+	if err != nil {
+		return nil, fmt.Errorf("error embedding documents for %s: %v", index, err)
+	}
+	ok, added, err := vectors.AddVectors(index, embedded, ids, metadata)
+	if err != nil {
+		return nil, fmt.Errorf("error adding documents to %s: %v", index, err)
+	}
+	if !ok {
+		return nil, fmt.Errorf("error adding documents to %s", index)
+	}
+	return added, nil
+}
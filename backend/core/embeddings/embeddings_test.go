@@ -0,0 +1,111 @@
+package embeddings
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/spectrumwebco/agent_runtime/backend/core/tenancy"
+)
+
+type memoryKV map[string]string
+
+func (m memoryKV) Get(key string) (string, error)               { return m[key], nil }
+func (m memoryKV) Set(key, value string, ex int) (bool, error)  { m[key] = value; return true, nil }
+func (m memoryKV) Delete(key string) (bool, error)              { delete(m, key); return true, nil }
+func (m memoryKV) Exists(key string) (bool, error)              { _, ok := m[key]; return ok, nil }
+func (m memoryKV) Expire(key string, seconds int) (bool, error) { return true, nil }
+func (m memoryKV) GetJSON(key string) (map[string]interface{}, error) {
+	return nil, nil
+}
+func (m memoryKV) SetJSON(key string, value map[string]interface{}, ex int) (bool, error) {
+	return true, nil
+}
+func (m memoryKV) HGet(name, key string) (string, error)          { return "", nil }
+func (m memoryKV) HSet(name, key, value string) (bool, error)     { return true, nil }
+func (m memoryKV) HGetAll(name string) (map[string]string, error) { return nil, nil }
+
+// lengthEmbedder embeds a text as its length and records the batches.
+type lengthEmbedder struct {
+	batches [][]string
+}
+
+func (e *lengthEmbedder) Model() string { return "length" }
+
+func (e *lengthEmbedder) Embed(ctx context.Context, tenant tenancy.Tenant, texts []string) ([][]float64, error) {
+	e.batches = append(e.batches, texts)
+	vectors := make([][]float64, len(texts))
+	for i, text := range texts {
+		vectors[i] = []float64{float64(len(text)), 0.5}
+	}
+	return vectors, nil
+}
+
+func TestCacheEmbedsMissingTextsOnce(t *testing.T) {
+	ctx := context.Background()
+	acme := tenancy.Tenant{OrganizationID: "acme", ProjectID: "default"}
+	backend := &lengthEmbedder{}
+	kv := memoryKV{}
+	embedder := NewCache(NewBatcher(backend, 2), kv, time.Hour)
+
+	vectors, err := embedder.Embed(ctx, acme, []string{"a", "bb", "a", "ccc"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(vectors) != 4 || vectors[0][0] != 1 || vectors[2][0] != 1 || vectors[3][0] != 3 {
+		t.Fatalf("unexpected vectors %v", vectors)
+	}
+	if fmt.Sprint(backend.batches) != "[[a bb] [ccc]]" {
+		t.Errorf("expected distinct texts in batches of two, got %v", backend.batches)
+	}
+
+	backend.batches = nil
+	vectors, err = embedder.Embed(ctx, acme, []string{"ccc", "dddd"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprint(backend.batches) != "[[dddd]]" || vectors[0][0] != 3 || vectors[0][1] != 0.5 || vectors[1][0] != 4 {
+		t.Errorf("expected only the new text to be embedded, got %v and %v", backend.batches, vectors)
+	}
+
+	// the cache is kept apart per tenant
+	backend.batches = nil
+	embedder.Embed(ctx, tenancy.Tenant{OrganizationID: "globex", ProjectID: "default"}, []string{"ccc"})
+	if len(backend.batches) != 1 {
+		t.Errorf("expected another tenant not to share cached vectors, got %v", backend.batches)
+	}
+	for key := range kv {
+		if !strings.Contains(key, "embedding:length:") {
+			t.Errorf("unexpected cache key %s", key)
+		}
+	}
+}
+
+func TestRAGflowEmbedder(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var request struct {
+			Texts []string `json:"texts"`
+		}
+		json.NewDecoder(r.Body).Decode(&request)
+		if r.URL.Path != "/embeddings" || r.Header.Get("Authorization") != "Bearer secret" || len(request.Texts) != 2 {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		fmt.Fprint(w, `{"embeddings":[[1,0],[0,1]]}`)
+	}))
+	defer server.Close()
+
+	embedder := NewRAGflowEmbedder(server.URL+"/", "secret", "", server.Client())
+	vectors, err := embedder.Embed(context.Background(), tenancy.Tenant{OrganizationID: "acme"}, []string{"a", "b"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(vectors) != 2 || vectors[1][1] != 1 || embedder.Model() != "ragflow:default" {
+		t.Errorf("unexpected vectors %v from %s", vectors, embedder.Model())
+	}
+}
@@ -0,0 +1,83 @@
+package embeddings
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+
+	"github.com/spectrumwebco/agent_runtime/backend/core/tenancy"
+)
+
+// onnxScript embeds the JSON list of texts on stdin with the model.onnx and
+// tokenizer.json of the directory in argv[1], mean pooling the last hidden
+// state and normalizing, as sentence-transformers exports expect.
+const onnxScript = `
+import json
+import sys
+
+import numpy as np
+import onnxruntime
+from tokenizers import Tokenizer
+
+model_dir, max_length = sys.argv[1], int(sys.argv[2])
+tokenizer = Tokenizer.from_file(model_dir + "/tokenizer.json")
+tokenizer.enable_truncation(max_length)
+tokenizer.enable_padding()
+session = onnxruntime.InferenceSession(model_dir + "/model.onnx", providers=["CPUExecutionProvider"])
+inputs = {i.name for i in session.get_inputs()}
+
+encodings = tokenizer.encode_batch(json.load(sys.stdin))
+feed = {
+    "input_ids": np.array([e.ids for e in encodings], dtype=np.int64),
+    "attention_mask": np.array([e.attention_mask for e in encodings], dtype=np.int64),
+}
+if "token_type_ids" in inputs:
+    feed["token_type_ids"] = np.array([e.type_ids for e in encodings], dtype=np.int64)
+
+hidden = session.run(None, feed)[0]
+mask = feed["attention_mask"][:, :, None].astype(hidden.dtype)
+pooled = (hidden * mask).sum(axis=1) / np.clip(mask.sum(axis=1), 1e-9, None)
+pooled /= np.clip(np.linalg.norm(pooled, axis=1, keepdims=True), 1e-12, None)
+json.dump(pooled.tolist(), sys.stdout)
+`
+
+// ONNXEmbedder runs a local ONNX model with onnxruntime in a Python
+// process, so no tokens leave the cluster. The directory holds model.onnx
+// and tokenizer.json.
+type ONNXEmbedder struct {
+	dir       string
+	maxLength int
+}
+
+func NewONNXEmbedder(dir string, maxLength int) *ONNXEmbedder {
+	return &ONNXEmbedder{dir: dir, maxLength: maxLength}
+}
+
+func (e *ONNXEmbedder) Model() string {
+	return "onnx:" + filepath.Base(e.dir)
+}
+
+func (e *ONNXEmbedder) Embed(ctx context.Context, tenant tenancy.Tenant, texts []string) ([][]float64, error) {
+	input, err := json.Marshal(texts)
+	if err != nil {
+		return nil, err
+	}
+
+	cmd := exec.CommandContext(ctx, "python", "-c", onnxScript, e.dir, fmt.Sprint(e.maxLength))
+	cmd.Stdin = bytes.NewReader(input)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("error running ONNX model %s: %v: %s", e.dir, err, bytes.TrimSpace(stderr.Bytes()))
+	}
+
+	var vectors [][]float64
+	if err := json.Unmarshal(output, &vectors); err != nil {
+		return nil, fmt.Errorf("error decoding ONNX model output: %v", err)
+	}
+	return vectors, nil
+}
@@ -0,0 +1,75 @@
+package embeddings
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/spectrumwebco/agent_runtime/backend/core/tenancy"
+)
+
+// RAGflowEmbedder calls the embeddings endpoint of RAGflow, so vectors match
+// those RAGflow computes for semantic search.
+type RAGflowEmbedder struct {
+	apiURL string
+	apiKey string
+	model  string
+	client *http.Client
+}
+
+// NewRAGflowEmbedder uses RAGflow's default model when model is empty.
+func NewRAGflowEmbedder(apiURL, apiKey, model string, client *http.Client) *RAGflowEmbedder {
+	return &RAGflowEmbedder{apiURL: strings.TrimSuffix(apiURL, "/"), apiKey: apiKey, model: model, client: client}
+}
+
+func (e *RAGflowEmbedder) Model() string {
+	if e.model == "" {
+		return "ragflow:default"
+	}
+	return "ragflow:" + e.model
+}
+
+func (e *RAGflowEmbedder) Embed(ctx context.Context, tenant tenancy.Tenant, texts []string) ([][]float64, error) {
+	payload := map[string]interface{}{"texts": texts}
+	if e.model != "" {
+		payload["model"] = e.model
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, e.apiURL+"/embeddings", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	if e.apiKey != "" {
+		request.Header.Set("Authorization", fmt.Sprintf("Bearer %s", e.apiKey))
+	}
+	request.Header.Set("Content-Type", "application/json")
+
+	response, err := e.client.Do(request)
+	if err != nil {
+		return nil, fmt.Errorf("error calling RAGflow embeddings: %v", err)
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		message, _ := io.ReadAll(io.LimitReader(response.Body, 4096))
+		return nil, fmt.Errorf("RAGflow embeddings returned %d: %s", response.StatusCode, bytes.TrimSpace(message))
+	}
+
+	var result struct {
+		Embeddings [][]float64 `json:"embeddings"`
+	}
+	if err := json.NewDecoder(response.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("error decoding RAGflow embeddings: %v", err)
+	}
+	if len(result.Embeddings) != len(texts) {
+		return nil, fmt.Errorf("RAGflow returned %d embeddings for %d texts", len(result.Embeddings), len(texts))
+	}
+	return result.Embeddings, nil
+}
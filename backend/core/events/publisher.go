@@ -0,0 +1,96 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+)
+
+var eventsLogger = log.New(os.Stdout, "kled.events: ", log.LstdFlags)
+
+type Publisher interface {
+	Publish(ctx context.Context, event WorkspaceEvent) error
+}
+
+// HeaderProducer is the subset of integrations.KafkaClient used to publish.
+type HeaderProducer interface {
+	ProduceWithHeaders(topic string, value interface{}, key string, headers map[string]string) error
+}
+
+type KafkaPublisher struct {
+	producer HeaderProducer
+	topic    string
+}
+
+func NewKafkaPublisher(producer HeaderProducer, topic string) *KafkaPublisher {
+	if topic == "" {
+		topic = WorkspaceTopic
+	}
+
+	return &KafkaPublisher{
+		producer: producer,
+		topic:    topic,
+	}
+}
+
+func (p *KafkaPublisher) Publish(ctx context.Context, event WorkspaceEvent) error {
+	if event.WorkspaceID == "" {
+		return fmt.Errorf("workspace event %s has no workspace ID", event.Type)
+	}
+
+	body, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("error encoding workspace event: %v", err)
+	}
+
+	return p.producer.ProduceWithHeaders(p.topic, body, event.WorkspaceID, map[string]string{
+		HeaderEventType:     string(event.Type),
+		HeaderSchemaVersion: event.SchemaVersion,
+		HeaderCorrelationID: event.CorrelationID,
+	})
+}
+
+// MultiPublisher publishes to every publisher and returns the first error.
+type MultiPublisher []Publisher
+
+func (m MultiPublisher) Publish(ctx context.Context, event WorkspaceEvent) error {
+	var firstErr error
+	for _, publisher := range m {
+		if err := publisher.Publish(ctx, event); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+var (
+	defaultPublisher Publisher
+	publisherMu      sync.RWMutex
+)
+
+func SetPublisher(publisher Publisher) {
+	publisherMu.Lock()
+	defer publisherMu.Unlock()
+
+	defaultPublisher = publisher
+}
+
+// Emit publishes event with the default publisher. Failures are logged rather
+// than returned so that a broker outage never fails the workspace operation
+// that triggered the event.
+func Emit(ctx context.Context, event WorkspaceEvent) {
+	publisherMu.RLock()
+	publisher := defaultPublisher
+	publisherMu.RUnlock()
+
+	if publisher == nil {
+		return
+	}
+
+	if err := publisher.Publish(ctx, event); err != nil {
+		eventsLogger.Printf("Error publishing %s for workspace %s: %v", event.Type, event.WorkspaceID, err)
+	}
+}
@@ -0,0 +1,213 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type producedMessage struct {
+	topic   string
+	value   []byte
+	key     string
+	headers map[string]string
+}
+
+type fakeProducer struct {
+	messages []producedMessage
+	err      error
+}
+
+func (p *fakeProducer) ProduceWithHeaders(topic string, value interface{}, key string, headers map[string]string) error {
+	if p.err != nil {
+		return p.err
+	}
+	p.messages = append(p.messages, producedMessage{topic: topic, value: value.([]byte), key: key, headers: headers})
+	return nil
+}
+
+// schemaProperty is the part of workspace_event.schema.json the events use.
+type schemaProperty struct {
+	Type                 string          `json:"type"`
+	Format               string          `json:"format"`
+	Enum                 []string        `json:"enum"`
+	Const                *string         `json:"const"`
+	AdditionalProperties *schemaProperty `json:"additionalProperties"`
+}
+
+// validateEvent checks a message body against the required properties,
+// types, formats, enums and constants of workspace_event.schema.json.
+func validateEvent(t *testing.T, body []byte) {
+	t.Helper()
+
+	raw, err := os.ReadFile("workspace_event.schema.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var schema struct {
+		Required   []string                  `json:"required"`
+		Properties map[string]schemaProperty `json:"properties"`
+	}
+	if err := json.Unmarshal(raw, &schema); err != nil {
+		t.Fatalf("invalid schema: %v", err)
+	}
+
+	var event map[string]interface{}
+	if err := json.Unmarshal(body, &event); err != nil {
+		t.Fatalf("invalid body: %v", err)
+	}
+	for _, name := range schema.Required {
+		if _, ok := event[name]; !ok {
+			t.Errorf("required property %s is missing from %s", name, body)
+		}
+	}
+	for name, value := range event {
+		property, ok := schema.Properties[name]
+		if !ok {
+			continue
+		}
+		validateProperty(t, name, property, value)
+	}
+}
+
+func validateProperty(t *testing.T, name string, property schemaProperty, value interface{}) {
+	t.Helper()
+
+	switch property.Type {
+	case "object":
+		fields, ok := value.(map[string]interface{})
+		if !ok {
+			t.Errorf("%s must be an object, got %v", name, value)
+			return
+		}
+		if property.AdditionalProperties != nil {
+			for key, field := range fields {
+				validateProperty(t, name+"."+key, *property.AdditionalProperties, field)
+			}
+		}
+		return
+	case "string":
+	default:
+		t.Fatalf("unsupported schema type %q of %s", property.Type, name)
+	}
+
+	text, ok := value.(string)
+	if !ok {
+		t.Errorf("%s must be a string, got %v", name, value)
+		return
+	}
+	switch property.Format {
+	case "uuid":
+		if _, err := uuid.Parse(text); err != nil {
+			t.Errorf("%s must be a uuid, got %q", name, text)
+		}
+	case "date-time":
+		if _, err := time.Parse(time.RFC3339Nano, text); err != nil {
+			t.Errorf("%s must be a date-time, got %q", name, text)
+		}
+	}
+	if property.Const != nil && text != *property.Const {
+		t.Errorf("%s must be %q, got %q", name, *property.Const, text)
+	}
+	if len(property.Enum) > 0 {
+		found := false
+		for _, allowed := range property.Enum {
+			found = found || allowed == text
+		}
+		if !found {
+			t.Errorf("%s must be one of %v, got %q", name, property.Enum, text)
+		}
+	}
+}
+
+func TestKafkaPublisherKeysAndHeaders(t *testing.T) {
+	producer := &fakeProducer{}
+	publisher := NewKafkaPublisher(producer, "")
+
+	event := NewWorkspaceEvent(WithCorrelationID(context.Background(), "request-1"), WorkspaceFailed, "ws-1")
+	event.WorkspaceName = "api"
+	event.OrganizationID = "acme"
+	event.Error = "image pull failed"
+	event.Attributes = map[string]string{StageAttribute: StageStart}
+	if err := publisher.Publish(context.Background(), event); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(producer.messages) != 1 {
+		t.Fatalf("expected one message, got %d", len(producer.messages))
+	}
+	message := producer.messages[0]
+	if message.topic != WorkspaceTopic || message.key != "ws-1" {
+		t.Errorf("expected the message on %s keyed by the workspace, got %s keyed %q", WorkspaceTopic, message.topic, message.key)
+	}
+	headers := map[string]string{
+		HeaderEventType:     "workspace.failed",
+		HeaderSchemaVersion: SchemaVersion,
+		HeaderCorrelationID: "request-1",
+	}
+	if !reflect.DeepEqual(message.headers, headers) {
+		t.Errorf("expected headers %v, got %v", headers, message.headers)
+	}
+
+	validateEvent(t, message.value)
+	var decoded WorkspaceEvent
+	if err := json.Unmarshal(message.value, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if !decoded.OccurredAt.Equal(event.OccurredAt) {
+		t.Errorf("expected occurred_at %s, got %s", event.OccurredAt, decoded.OccurredAt)
+	}
+	decoded.OccurredAt = event.OccurredAt
+	if !reflect.DeepEqual(decoded, event) {
+		t.Errorf("expected the body to decode to %+v, got %+v", event, decoded)
+	}
+}
+
+func TestEveryEventTypeMatchesSchema(t *testing.T) {
+	producer := &fakeProducer{}
+	publisher := NewKafkaPublisher(producer, "custom.topic")
+
+	for _, eventType := range []EventType{
+		WorkspaceCreated, WorkspaceStarted, WorkspaceStopped, WorkspaceFailed, WorkspaceDeleted,
+		WorkspaceUnreachable, WorkspaceReachable, WorkspaceReconciled, WorkspacePreviewReady,
+	} {
+		// without a correlation ID in the context one is generated
+		if err := publisher.Publish(context.Background(), NewWorkspaceEvent(context.Background(), eventType, "ws-1")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, message := range producer.messages {
+		if message.topic != "custom.topic" || message.headers[HeaderCorrelationID] == "" {
+			t.Errorf("unexpected message %+v", message)
+		}
+		validateEvent(t, message.value)
+	}
+}
+
+func TestKafkaPublisherRejectsEventsWithoutWorkspace(t *testing.T) {
+	producer := &fakeProducer{}
+	err := NewKafkaPublisher(producer, "").Publish(context.Background(), NewWorkspaceEvent(context.Background(), WorkspaceCreated, ""))
+	if err == nil || len(producer.messages) != 0 {
+		t.Errorf("expected the event to be rejected, got %v and %d messages", err, len(producer.messages))
+	}
+}
+
+func TestMultiPublisherPublishesToAll(t *testing.T) {
+	failing := &fakeProducer{err: errors.New("broker down")}
+	working := &fakeProducer{}
+	publisher := MultiPublisher{NewKafkaPublisher(failing, ""), NewKafkaPublisher(working, "")}
+
+	err := publisher.Publish(context.Background(), NewWorkspaceEvent(context.Background(), WorkspaceStopped, "ws-1"))
+	if err == nil || err.Error() != "broker down" {
+		t.Errorf("expected the first error, got %v", err)
+	}
+	if len(working.messages) != 1 {
+		t.Errorf("expected the other publishers to still publish, got %d messages", len(working.messages))
+	}
+}
@@ -0,0 +1,120 @@
+// Package events defines the workspace lifecycle event feed.
+//
+// Every workspace state change is published as a JSON WorkspaceEvent to the
+// Kafka topic WorkspaceTopic, keyed by workspace ID so all events of one
+// workspace land in the same partition and stay ordered. Each message also
+// carries the headers below so consumers can route messages without decoding
+// the body:
+//
+//	kled-event-type      the event type, e.g. "workspace.started"
+//	kled-schema-version  SchemaVersion
+//	kled-correlation-id  the correlation ID of the request that caused it
+//
+// The body is described by workspace_event.schema.json. Consumers must ignore
+// unknown fields; SchemaVersion is only bumped for incompatible changes.
+package events
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	WorkspaceTopic = "workspace.lifecycle"
+	SchemaVersion  = "1"
+
+	HeaderEventType     = "kled-event-type"
+	HeaderSchemaVersion = "kled-schema-version"
+	HeaderCorrelationID = "kled-correlation-id"
+)
+
+type EventType string
+
+const (
+	WorkspaceCreated EventType = "workspace.created"
+	// WorkspaceStarted carries how long the start took in milliseconds as
+	// the start_duration_ms attribute, when the starter measured it.
+	WorkspaceStarted EventType = "workspace.started"
+	WorkspaceStopped EventType = "workspace.stopped"
+	WorkspaceFailed  EventType = "workspace.failed"
+	WorkspaceDeleted EventType = "workspace.deleted"
+
+	// WorkspaceUnreachable and WorkspaceReachable report the liveness of the
+	// workspace agent as tracked by its heartbeats.
+	WorkspaceUnreachable EventType = "workspace.unreachable"
+	WorkspaceReachable   EventType = "workspace.reachable"
+
+	// WorkspaceReconciled reports drift the reconciler fixed, with the
+	// drift and action as attributes.
+	WorkspaceReconciled EventType = "workspace.reconciled"
+
+	// WorkspacePreviewReady announces the public link of a preview
+	// environment, with the url, source and expiry as attributes.
+	WorkspacePreviewReady EventType = "workspace.preview_ready"
+)
+
+// StageAttribute of workspace.failed events names the operation that failed,
+// one of the stages below.
+const StageAttribute = "stage"
+
+const (
+	StageCreate    = "create"
+	StageStart     = "start"
+	StageStop      = "stop"
+	StageDelete    = "delete"
+	StageDowngrade = "downgrade"
+)
+
+type WorkspaceEvent struct {
+	// ID uniquely identifies the event and can be used for deduplication.
+	ID            string    `json:"id"`
+	Type          EventType `json:"type"`
+	SchemaVersion string    `json:"schema_version"`
+	OccurredAt    time.Time `json:"occurred_at"`
+	CorrelationID string    `json:"correlation_id"`
+
+	WorkspaceID    string `json:"workspace_id"`
+	WorkspaceName  string `json:"workspace_name,omitempty"`
+	OrganizationID string `json:"organization_id,omitempty"`
+	ActorID        string `json:"actor_id,omitempty"`
+	Provider       string `json:"provider,omitempty"`
+
+	// Error is set for workspace.failed events.
+	Error string `json:"error,omitempty"`
+	// Attributes holds event-specific details such as the previous state.
+	Attributes map[string]string `json:"attributes,omitempty"`
+}
+
+// NewWorkspaceEvent returns an event stamped with a new ID, the current time
+// and the correlation ID carried by ctx, generating one if ctx has none.
+func NewWorkspaceEvent(ctx context.Context, eventType EventType, workspaceID string) WorkspaceEvent {
+	correlationID := CorrelationID(ctx)
+	if correlationID == "" {
+		correlationID = uuid.New().String()
+	}
+
+	return WorkspaceEvent{
+		ID:            uuid.New().String(),
+		Type:          eventType,
+		SchemaVersion: SchemaVersion,
+		OccurredAt:    time.Now().UTC(),
+		CorrelationID: correlationID,
+		WorkspaceID:   workspaceID,
+	}
+}
+
+type correlationIDKey struct{}
+
+func WithCorrelationID(ctx context.Context, correlationID string) context.Context {
+	return context.WithValue(ctx, correlationIDKey{}, correlationID)
+}
+
+func CorrelationID(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+	correlationID, _ := ctx.Value(correlationIDKey{}).(string)
+	return correlationID
+}
@@ -0,0 +1,130 @@
+// Package experiments runs A/B experiments on agent configurations.
+//
+// An Experiment splits the subjects of a project, typically tasks or
+// workspaces, between weighted variants, each carrying the agent
+// configuration to run with. Assignment hashes the subject, so a subject
+// always gets the same variant without the assignment being stored. Every
+// exposure of a trajectory to a variant is logged next to the trajectories in
+// the tenant's Doris database, and the Report compares the success rate of
+// each variant's trajectories with the control, the first variant.
+package experiments
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"regexp"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+var experimentsLogger = log.New(os.Stdout, "kled.experiments: ", log.LstdFlags)
+
+var ErrNotFound = errors.New("experiment not found")
+
+type Status string
+
+const (
+	StatusRunning Status = "running"
+	// StatusStopped experiments assign every subject to the control and log
+	// no exposures.
+	StatusStopped Status = "stopped"
+)
+
+type Variant struct {
+	Name string `json:"name" openapi:"required"`
+	// Weight is the share of subjects assigned to the variant, relative to
+	// the other variants.
+	Weight int `json:"weight" openapi:"required"`
+	// Config is handed to the agent, e.g. {"retrieval": "hybrid"}.
+	Config map[string]interface{} `json:"config,omitempty"`
+}
+
+type Experiment struct {
+	ID             string `json:"id"`
+	OrganizationID string `json:"organization_id"`
+	ProjectID      string `json:"project_id"`
+	// Key names the experiment within the project, e.g. "retrieval-strategy".
+	Key         string `json:"key"`
+	Description string `json:"description,omitempty"`
+	// Variants lists the control first.
+	Variants  []Variant  `json:"variants"`
+	Status    Status     `json:"status"`
+	CreatedAt time.Time  `json:"created_at"`
+	StoppedAt *time.Time `json:"stopped_at,omitempty"`
+}
+
+var namePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_.-]{0,63}$`)
+
+// NewExperiment validates an experiment and gives it an ID.
+func NewExperiment(organizationID, projectID, key, description string, variants []Variant, now time.Time) (*Experiment, error) {
+	if organizationID == "" || projectID == "" {
+		return nil, fmt.Errorf("experiments belong to a project")
+	}
+	if !namePattern.MatchString(key) {
+		return nil, fmt.Errorf("invalid experiment key %q, use lowercase letters, digits, '.', '_' and '-'", key)
+	}
+	if len(variants) < 2 {
+		return nil, fmt.Errorf("an experiment needs at least two variants")
+	}
+	seen := map[string]bool{}
+	for _, variant := range variants {
+		if !namePattern.MatchString(variant.Name) {
+			return nil, fmt.Errorf("invalid variant name %q", variant.Name)
+		}
+		if seen[variant.Name] {
+			return nil, fmt.Errorf("duplicate variant %q", variant.Name)
+		}
+		seen[variant.Name] = true
+		if variant.Weight < 1 {
+			return nil, fmt.Errorf("variant %q must have a positive weight", variant.Name)
+		}
+	}
+
+	return &Experiment{
+		ID:             uuid.New().String(),
+		OrganizationID: organizationID,
+		ProjectID:      projectID,
+		Key:            key,
+		Description:    description,
+		Variants:       variants,
+		Status:         StatusRunning,
+		CreatedAt:      now.UTC(),
+	}, nil
+}
+
+// Assign returns the variant of a subject. Subjects keep their variant for
+// as long as the variants are unchanged; stopped experiments return the
+// control.
+func (e *Experiment) Assign(subjectID string) Variant {
+	if e.Status != StatusRunning {
+		return e.Variants[0]
+	}
+
+	total := 0
+	for _, variant := range e.Variants {
+		total += variant.Weight
+	}
+	sum := sha256.Sum256([]byte(e.ID + ":" + subjectID))
+	bucket := int(binary.BigEndian.Uint64(sum[:8]) % uint64(total))
+	for _, variant := range e.Variants {
+		if bucket < variant.Weight {
+			return variant
+		}
+		bucket -= variant.Weight
+	}
+	return e.Variants[len(e.Variants)-1]
+}
+
+// Exposure records that a trajectory ran with a variant.
+type Exposure struct {
+	ExperimentID string    `json:"experiment_id"`
+	Variant      string    `json:"variant"`
+	SubjectID    string    `json:"subject_id"`
+	TrajectoryID string    `json:"trajectory_id"`
+	OccurredAt   time.Time `json:"occurred_at"`
+}
@@ -0,0 +1,111 @@
+package experiments
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/spectrumwebco/agent_runtime/backend/core/tenancy"
+)
+
+func newTestExperiment(t *testing.T) *Experiment {
+	t.Helper()
+	experiment, err := NewExperiment("acme", "default", "retrieval-strategy", "", []Variant{
+		{Name: "bm25", Weight: 1, Config: map[string]interface{}{"retrieval": "bm25"}},
+		{Name: "hybrid", Weight: 3, Config: map[string]interface{}{"retrieval": "hybrid"}},
+	}, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return experiment
+}
+
+func TestNewExperimentValidates(t *testing.T) {
+	for name, variants := range map[string][]Variant{
+		"one variant":     {{Name: "a", Weight: 1}},
+		"duplicate names": {{Name: "a", Weight: 1}, {Name: "a", Weight: 1}},
+		"zero weight":     {{Name: "a", Weight: 1}, {Name: "b", Weight: 0}},
+		"invalid name":    {{Name: "a", Weight: 1}, {Name: "B C", Weight: 1}},
+	} {
+		if _, err := NewExperiment("acme", "default", "key", "", variants, time.Now()); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+	if _, err := NewExperiment("acme", "default", "Not A Key", "", []Variant{{Name: "a", Weight: 1}, {Name: "b", Weight: 1}}, time.Now()); err == nil {
+		t.Error("expected an invalid key to be rejected")
+	}
+}
+
+func TestAssignIsStableAndWeighted(t *testing.T) {
+	experiment := newTestExperiment(t)
+
+	counts := map[string]int{}
+	for i := 0; i < 4000; i++ {
+		subject := fmt.Sprintf("task-%d", i)
+		variant := experiment.Assign(subject)
+		if again := experiment.Assign(subject); again.Name != variant.Name {
+			t.Fatalf("subject %s moved from %s to %s", subject, variant.Name, again.Name)
+		}
+		counts[variant.Name]++
+	}
+	if share := float64(counts["hybrid"]) / 4000; share < 0.70 || share > 0.80 {
+		t.Errorf("expected about 75%% of subjects on hybrid, got %.2f", share)
+	}
+
+	experiment.Status = StatusStopped
+	if variant := experiment.Assign("task-1"); variant.Name != "bm25" {
+		t.Errorf("expected a stopped experiment to assign the control, got %s", variant.Name)
+	}
+}
+
+func TestReportComparesWithControl(t *testing.T) {
+	ctx := context.Background()
+	tenant, _ := tenancy.New("acme", "")
+	experiment := newTestExperiment(t)
+	log := NewMemoryExposureLog()
+
+	expose := func(variant string, n, succeeded int) {
+		for i := 0; i < n; i++ {
+			trajectoryID := fmt.Sprintf("%s-%d", variant, i)
+			exposure := Exposure{ExperimentID: experiment.ID, Variant: variant, SubjectID: trajectoryID, TrajectoryID: trajectoryID}
+			// exposing a trajectory twice counts it once
+			log.Log(ctx, tenant, exposure)
+			log.Log(ctx, tenant, exposure)
+			status := "failed"
+			if i < succeeded {
+				status = SucceededStatus
+			}
+			log.SetTrajectory(tenant, trajectoryID, status)
+		}
+	}
+	expose("bm25", 200, 100)
+	expose("hybrid", 200, 130)
+	log.Log(ctx, tenant, Exposure{ExperimentID: experiment.ID, Variant: "hybrid", SubjectID: "running", TrajectoryID: "running"})
+
+	outcomes, err := log.Outcomes(ctx, tenant, experiment.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	report := NewReport(experiment, outcomes, time.Now())
+
+	control, hybrid := report.Variants[0], report.Variants[1]
+	if control.VsControl != nil || control.SuccessRate != 0.5 {
+		t.Errorf("unexpected control %+v", control)
+	}
+	if hybrid.Exposed != 201 || hybrid.Finished != 200 || hybrid.SuccessRate != 0.65 {
+		t.Errorf("unexpected variant %+v", hybrid)
+	}
+	comparison := hybrid.VsControl
+	if comparison == nil || math.Abs(comparison.Difference-0.15) > 1e-9 {
+		t.Fatalf("unexpected comparison %+v", comparison)
+	}
+	// pooled p = 0.575, z = 0.15 / sqrt(0.575 * 0.425 / 100) = 3.03
+	if comparison.PValue < 0.002 || comparison.PValue > 0.003 {
+		t.Errorf("expected a p-value of about 0.0024, got %f", comparison.PValue)
+	}
+	if comparison.Low < 0.05 || comparison.Low > 0.06 || comparison.High < 0.24 || comparison.High > 0.25 {
+		t.Errorf("unexpected confidence interval [%f, %f]", comparison.Low, comparison.High)
+	}
+}
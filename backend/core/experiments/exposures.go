@@ -0,0 +1,193 @@
+package experiments
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/spectrumwebco/agent_runtime/backend/core/tenancy"
+	"github.com/spectrumwebco/agent_runtime/backend/db/integrations"
+)
+
+// SucceededStatus is the status of successful trajectories.
+const SucceededStatus = "succeeded"
+
+// Outcome counts the distinct trajectories exposed to a variant, how many of
+// them finished and how many succeeded.
+type Outcome struct {
+	Exposed   int `json:"exposed"`
+	Finished  int `json:"finished"`
+	Succeeded int `json:"succeeded"`
+}
+
+type ExposureLog interface {
+	Log(ctx context.Context, tenant tenancy.Tenant, exposure Exposure) error
+	// Outcomes returns the outcome of each variant of the experiment that
+	// had exposures.
+	Outcomes(ctx context.Context, tenant tenancy.Tenant, experimentID string) (map[string]Outcome, error)
+}
+
+// MemoryExposureLog keeps exposures along with the outcome of each
+// trajectory, which SetTrajectory records in place of the trajectory store.
+type MemoryExposureLog struct {
+	exposures    map[tenancy.Tenant][]Exposure
+	trajectories map[tenancy.Tenant]map[string]string
+	mu           sync.Mutex
+}
+
+func NewMemoryExposureLog() *MemoryExposureLog {
+	return &MemoryExposureLog{
+		exposures:    make(map[tenancy.Tenant][]Exposure),
+		trajectories: make(map[tenancy.Tenant]map[string]string),
+	}
+}
+
+// SetTrajectory records the status of a finished trajectory.
+func (l *MemoryExposureLog) SetTrajectory(tenant tenancy.Tenant, trajectoryID, status string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.trajectories[tenant] == nil {
+		l.trajectories[tenant] = make(map[string]string)
+	}
+	l.trajectories[tenant][trajectoryID] = status
+}
+
+func (l *MemoryExposureLog) Log(ctx context.Context, tenant tenancy.Tenant, exposure Exposure) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.exposures[tenant] = append(l.exposures[tenant], exposure)
+	return nil
+}
+
+func (l *MemoryExposureLog) Outcomes(ctx context.Context, tenant tenancy.Tenant, experimentID string) (map[string]Outcome, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	outcomes := make(map[string]Outcome)
+	seen := make(map[[2]string]bool)
+	for _, exposure := range l.exposures[tenant] {
+		key := [2]string{exposure.Variant, exposure.TrajectoryID}
+		if exposure.ExperimentID != experimentID || seen[key] {
+			continue
+		}
+		seen[key] = true
+
+		outcome := outcomes[exposure.Variant]
+		outcome.Exposed++
+		if status, ok := l.trajectories[tenant][exposure.TrajectoryID]; ok {
+			outcome.Finished++
+			if status == SucceededStatus {
+				outcome.Succeeded++
+			}
+		}
+		outcomes[exposure.Variant] = outcome
+	}
+	return outcomes, nil
+}
+
+// DorisExposureLog keeps exposures in the experiment_exposures table of the
+// tenant's Doris database, next to the trajectories they are joined with:
+//
+//	{schema}.experiment_exposures  experiment_id, occurred_at, variant,
+//	                               subject_id, trajectory_id
+type DorisExposureLog struct {
+	doris integrations.SQLStore
+	// ensured holds the tenants whose table exists.
+	ensured sync.Map
+}
+
+func NewDorisExposureLog(doris integrations.SQLStore) *DorisExposureLog {
+	return &DorisExposureLog{doris: doris}
+}
+
+func (l *DorisExposureLog) ensureTable(tenant tenancy.Tenant, store *tenancy.SQLStore) error {
+	if _, ok := l.ensured.Load(tenant); ok {
+		return nil
+	}
+	if err := store.EnsureSchema(); err != nil {
+		return err
+	}
+	_, err := store.ExecuteUpdate(`
+		CREATE TABLE IF NOT EXISTS {schema}.experiment_exposures (
+			experiment_id VARCHAR(64) NOT NULL,
+			occurred_at DATETIME NOT NULL,
+			variant VARCHAR(64) NOT NULL,
+			subject_id VARCHAR(255) NOT NULL,
+			trajectory_id VARCHAR(64) NOT NULL
+		)
+		DUPLICATE KEY(experiment_id, occurred_at)
+		DISTRIBUTED BY HASH(experiment_id) BUCKETS 4
+	`)
+	if err != nil {
+		return fmt.Errorf("error creating experiment exposure table of %s: %v", tenant, err)
+	}
+	l.ensured.Store(tenant, true)
+	return nil
+}
+
+func (l *DorisExposureLog) Log(ctx context.Context, tenant tenancy.Tenant, exposure Exposure) error {
+	store := tenancy.NewDorisStore(tenant, l.doris)
+	if err := l.ensureTable(tenant, store); err != nil {
+		return err
+	}
+	_, err := store.ExecuteUpdate(
+		`INSERT INTO {schema}.experiment_exposures (experiment_id, occurred_at, variant, subject_id, trajectory_id) VALUES (?, ?, ?, ?, ?)`,
+		exposure.ExperimentID, exposure.OccurredAt.UTC(), exposure.Variant, exposure.SubjectID, exposure.TrajectoryID,
+	)
+	if err != nil {
+		return fmt.Errorf("error logging exposure to experiment %s: %v", exposure.ExperimentID, err)
+	}
+	return nil
+}
+
+func (l *DorisExposureLog) Outcomes(ctx context.Context, tenant tenancy.Tenant, experimentID string) (map[string]Outcome, error) {
+	store := tenancy.NewDorisStore(tenant, l.doris)
+	if err := l.ensureTable(tenant, store); err != nil {
+		return nil, err
+	}
+	// a trajectory exposed more than once counts once per variant
+	rows, err := store.ExecuteQuery(`
+		SELECT e.variant,
+			COUNT(*) AS exposed,
+			SUM(CASE WHEN t.finished_at IS NOT NULL THEN 1 ELSE 0 END) AS finished,
+			SUM(CASE WHEN t.status = ? THEN 1 ELSE 0 END) AS succeeded
+		FROM (
+			SELECT DISTINCT variant, trajectory_id FROM {schema}.experiment_exposures WHERE experiment_id = ?
+		) e
+		LEFT JOIN {schema}.trajectories t ON t.id = e.trajectory_id
+		GROUP BY e.variant`,
+		SucceededStatus, experimentID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("error loading outcomes of experiment %s: %v", experimentID, err)
+	}
+
+	outcomes := make(map[string]Outcome, len(rows))
+	for _, row := range rows {
+		outcomes[toString(row["variant"])] = Outcome{
+			Exposed:   toInt(row["exposed"]),
+			Finished:  toInt(row["finished"]),
+			Succeeded: toInt(row["succeeded"]),
+		}
+	}
+	return outcomes, nil
+}
+
+func toInt(value interface{}) int {
+	switch v := value.(type) {
+	case int64:
+		return int(v)
+	case int:
+		return v
+	case float64:
+		return int(v)
+	case []byte, string:
+		var n int
+		fmt.Sscan(toString(v), &n)
+		return n
+	default:
+		return 0
+	}
+}
@@ -0,0 +1,75 @@
+package experiments
+
+import (
+	"math"
+	"time"
+)
+
+// Comparison compares the success rate of a variant with the control's.
+type Comparison struct {
+	// Difference is the variant's success rate minus the control's.
+	Difference float64 `json:"difference"`
+	// Low and High bound the 95% confidence interval of Difference.
+	Low  float64 `json:"low"`
+	High float64 `json:"high"`
+	// PValue is the two-sided p-value of a two-proportion z-test.
+	PValue float64 `json:"p_value"`
+}
+
+type VariantReport struct {
+	Variant string `json:"variant"`
+	Outcome
+	// SuccessRate is the share of finished trajectories that succeeded.
+	SuccessRate float64 `json:"success_rate"`
+	// VsControl is unset for the control and while either variant has no
+	// finished trajectories.
+	VsControl *Comparison `json:"vs_control,omitempty"`
+}
+
+type Report struct {
+	Experiment  *Experiment     `json:"experiment"`
+	Variants    []VariantReport `json:"variants"`
+	GeneratedAt time.Time       `json:"generated_at"`
+}
+
+// z95 is the two-sided 95% quantile of the standard normal distribution.
+const z95 = 1.959964
+
+// NewReport compares every variant of the experiment with the control.
+func NewReport(experiment *Experiment, outcomes map[string]Outcome, now time.Time) *Report {
+	report := &Report{Experiment: experiment, GeneratedAt: now.UTC()}
+	for _, variant := range experiment.Variants {
+		outcome := outcomes[variant.Name]
+		variantReport := VariantReport{Variant: variant.Name, Outcome: outcome}
+		if outcome.Finished > 0 {
+			variantReport.SuccessRate = float64(outcome.Succeeded) / float64(outcome.Finished)
+		}
+		report.Variants = append(report.Variants, variantReport)
+	}
+
+	control := report.Variants[0]
+	for i := 1; i < len(report.Variants); i++ {
+		report.Variants[i].VsControl = compare(control, report.Variants[i])
+	}
+	return report
+}
+
+func compare(control, variant VariantReport) *Comparison {
+	n1, n2 := float64(control.Finished), float64(variant.Finished)
+	if n1 == 0 || n2 == 0 {
+		return nil
+	}
+	p1, p2 := control.SuccessRate, variant.SuccessRate
+	comparison := &Comparison{Difference: p2 - p1, PValue: 1}
+
+	se := math.Sqrt(p1*(1-p1)/n1 + p2*(1-p2)/n2)
+	comparison.Low = comparison.Difference - z95*se
+	comparison.High = comparison.Difference + z95*se
+
+	pooled := float64(control.Succeeded+variant.Succeeded) / (n1 + n2)
+	if pooledSE := math.Sqrt(pooled * (1 - pooled) * (1/n1 + 1/n2)); pooledSE > 0 {
+		z := comparison.Difference / pooledSE
+		comparison.PValue = math.Erfc(math.Abs(z) / math.Sqrt2)
+	}
+	return comparison
+}
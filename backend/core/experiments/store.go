@@ -0,0 +1,236 @@
+package experiments
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/spectrumwebco/agent_runtime/backend/db/integrations"
+)
+
+// Store keeps experiment definitions. Exposures are kept by an ExposureLog.
+type Store interface {
+	Create(ctx context.Context, experiment *Experiment) error
+	// Get returns the experiment or ErrNotFound.
+	Get(ctx context.Context, id string) (*Experiment, error)
+	// List returns the experiments of a project, newest first.
+	List(ctx context.Context, organizationID, projectID string) ([]*Experiment, error)
+	Stop(ctx context.Context, id string, at time.Time) error
+}
+
+type MemoryStore struct {
+	experiments map[string]*Experiment
+	mu          sync.Mutex
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{experiments: make(map[string]*Experiment)}
+}
+
+func (s *MemoryStore) Create(ctx context.Context, experiment *Experiment) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, existing := range s.experiments {
+		if existing.OrganizationID == experiment.OrganizationID && existing.ProjectID == experiment.ProjectID && existing.Key == experiment.Key {
+			return fmt.Errorf("experiment %q already exists", experiment.Key)
+		}
+	}
+	copied := *experiment
+	s.experiments[experiment.ID] = &copied
+	return nil
+}
+
+func (s *MemoryStore) Get(ctx context.Context, id string) (*Experiment, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	experiment, ok := s.experiments[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	copied := *experiment
+	return &copied, nil
+}
+
+func (s *MemoryStore) List(ctx context.Context, organizationID, projectID string) ([]*Experiment, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	experiments := []*Experiment{}
+	for _, experiment := range s.experiments {
+		if experiment.OrganizationID == organizationID && experiment.ProjectID == projectID {
+			copied := *experiment
+			experiments = append(experiments, &copied)
+		}
+	}
+	sort.Slice(experiments, func(i, j int) bool {
+		return experiments[i].CreatedAt.After(experiments[j].CreatedAt)
+	})
+	return experiments, nil
+}
+
+func (s *MemoryStore) Stop(ctx context.Context, id string, at time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	experiment, ok := s.experiments[id]
+	if !ok {
+		return ErrNotFound
+	}
+	if experiment.Status != StatusStopped {
+		at = at.UTC()
+		experiment.Status = StatusStopped
+		experiment.StoppedAt = &at
+	}
+	return nil
+}
+
+// PostgresStore keeps experiments in app_experiment.
+type PostgresStore struct {
+	client integrations.SQLStore
+}
+
+func NewPostgresStore(client integrations.SQLStore) *PostgresStore {
+	return &PostgresStore{client: client}
+}
+
+func (s *PostgresStore) EnsureSchema() error {
+	_, err := s.client.ExecuteUpdate(`
+		CREATE TABLE IF NOT EXISTS app_experiment (
+			id VARCHAR(64) PRIMARY KEY,
+			organization_id VARCHAR(255) NOT NULL,
+			project_id VARCHAR(255) NOT NULL,
+			key VARCHAR(64) NOT NULL,
+			description TEXT NOT NULL DEFAULT '',
+			variants JSONB NOT NULL,
+			status VARCHAR(16) NOT NULL,
+			created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+			stopped_at TIMESTAMPTZ,
+			UNIQUE (organization_id, project_id, key)
+		)
+	`)
+	if err != nil {
+		return fmt.Errorf("error creating experiment table: %v", err)
+	}
+	return nil
+}
+
+const experimentColumns = `id, organization_id, project_id, key, description, variants, status, created_at, stopped_at`
+
+func (s *PostgresStore) Create(ctx context.Context, experiment *Experiment) error {
+	variants, err := json.Marshal(experiment.Variants)
+	if err != nil {
+		return err
+	}
+	_, err = s.client.ExecuteUpdate(
+		`INSERT INTO app_experiment (`+experimentColumns+`) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)`,
+		experiment.ID, experiment.OrganizationID, experiment.ProjectID, experiment.Key, experiment.Description,
+		string(variants), string(experiment.Status), experiment.CreatedAt, experiment.StoppedAt,
+	)
+	if err != nil {
+		return fmt.Errorf("error creating experiment %q: %v", experiment.Key, err)
+	}
+	return nil
+}
+
+func (s *PostgresStore) Get(ctx context.Context, id string) (*Experiment, error) {
+	rows, err := s.client.ExecuteQuery(`SELECT `+experimentColumns+` FROM app_experiment WHERE id = $1`, id)
+	if err != nil {
+		return nil, fmt.Errorf("error loading experiment %s: %v", id, err)
+	}
+	if len(rows) == 0 {
+		return nil, ErrNotFound
+	}
+	return experimentFromRow(rows[0])
+}
+
+func (s *PostgresStore) List(ctx context.Context, organizationID, projectID string) ([]*Experiment, error) {
+	rows, err := s.client.ExecuteQuery(
+		`SELECT `+experimentColumns+` FROM app_experiment WHERE organization_id = $1 AND project_id = $2 ORDER BY created_at DESC`,
+		organizationID, projectID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("error listing experiments: %v", err)
+	}
+
+	experiments := make([]*Experiment, 0, len(rows))
+	for _, row := range rows {
+		experiment, err := experimentFromRow(row)
+		if err != nil {
+			return nil, err
+		}
+		experiments = append(experiments, experiment)
+	}
+	return experiments, nil
+}
+
+func (s *PostgresStore) Stop(ctx context.Context, id string, at time.Time) error {
+	updated, err := s.client.ExecuteUpdate(
+		`UPDATE app_experiment SET status = $2, stopped_at = COALESCE(stopped_at, $3) WHERE id = $1`,
+		id, string(StatusStopped), at.UTC(),
+	)
+	if err != nil {
+		return fmt.Errorf("error stopping experiment %s: %v", id, err)
+	}
+	if updated == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// ConfigureDefault returns the store of experiments. If the experiments
+// table cannot be created they are kept in memory, and experiments that
+// were running are forgotten on restart.
+func ConfigureDefault(client integrations.SQLStore) Store {
+	store := NewPostgresStore(client)
+	if err := store.EnsureSchema(); err != nil {
+		experimentsLogger.Printf("Experiments falling back to in-memory store: %v", err)
+		return NewMemoryStore()
+	}
+	return store
+}
+
+func experimentFromRow(row map[string]interface{}) (*Experiment, error) {
+	experiment := &Experiment{
+		ID:             toString(row["id"]),
+		OrganizationID: toString(row["organization_id"]),
+		ProjectID:      toString(row["project_id"]),
+		Key:            toString(row["key"]),
+		Description:    toString(row["description"]),
+		Status:         Status(toString(row["status"])),
+	}
+	if createdAt, ok := row["created_at"].(time.Time); ok {
+		experiment.CreatedAt = createdAt.UTC()
+	}
+	if stoppedAt, ok := row["stopped_at"].(time.Time); ok {
+		stoppedAt = stoppedAt.UTC()
+		experiment.StoppedAt = &stoppedAt
+	}
+
+	var variants []byte
+	switch v := row["variants"].(type) {
+	case []byte:
+		variants = v
+	case string:
+		variants = []byte(v)
+	}
+	if err := json.Unmarshal(variants, &experiment.Variants); err != nil {
+		return nil, fmt.Errorf("error decoding variants of experiment %s: %v", experiment.ID, err)
+	}
+	return experiment, nil
+}
+
+func toString(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case []byte:
+		return string(v)
+	default:
+		return fmt.Sprint(v)
+	}
+}
@@ -0,0 +1,185 @@
+// Package fanout relays WebSocket broadcasts between backend replicas.
+//
+// Each replica only holds its own connections, so a broadcast published on
+// one replica is delivered to its local connections right away and relayed
+// through a pub/sub channel to the other replicas, which deliver it to
+// theirs. Messages carry the ID of the replica that published them, so a
+// replica ignores its own messages when they come back from the channel.
+//
+// The channel is read from the AGENT_WS_FANOUT_CHANNEL setting and defaults
+// to DefaultChannel. Replicas sharing a channel form one fan-out group.
+package fanout
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/spectrumwebco/agent_runtime/backend/core/lifecycle"
+	"github.com/spectrumwebco/agent_runtime/backend/db/integrations"
+)
+
+var fanoutLogger = log.New(os.Stdout, "kled.fanout: ", log.LstdFlags)
+
+const DefaultChannel = "kled:ws:fanout"
+
+var (
+	messagesTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "kled_ws_fanout_messages_total",
+		Help: "Messages published to and received from other replicas, by topic and direction.",
+	}, []string{"topic", "direction"})
+	publishErrorsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "kled_ws_fanout_publish_errors_total",
+		Help: "Messages that could not be relayed to other replicas, by topic.",
+	}, []string{"topic"})
+)
+
+func init() {
+	prometheus.MustRegister(messagesTotal, publishErrorsTotal)
+}
+
+// Handler delivers a message to the local connections of target, such as a
+// group name or a state key.
+type Handler func(target string, payload []byte)
+
+type envelope struct {
+	Origin  string          `json:"origin"`
+	Topic   string          `json:"topic"`
+	Target  string          `json:"target"`
+	Payload json.RawMessage `json:"payload"`
+}
+
+type Bus struct {
+	pubsub  integrations.PubSub
+	channel string
+	origin  string
+
+	mu       sync.RWMutex
+	handlers map[string]Handler
+
+	cancel context.CancelFunc
+}
+
+func New(pubsub integrations.PubSub, channel string) *Bus {
+	if channel == "" {
+		channel = DefaultChannel
+	}
+	return &Bus{
+		pubsub:   pubsub,
+		channel:  channel,
+		origin:   uuid.New().String(),
+		handlers: make(map[string]Handler),
+	}
+}
+
+var (
+	defaultBus     *Bus
+	defaultBusOnce sync.Once
+)
+
+// Default returns the bus of the process. It subscribes in the background,
+// retrying until Dragonfly is reachable; until then messages are only
+// delivered locally.
+func Default() *Bus {
+	defaultBusOnce.Do(func() {
+		defaultBus = New(integrations.GetPubSub(), os.Getenv("AGENT_WS_FANOUT_CHANNEL"))
+		ctx, cancel := context.WithCancel(context.Background())
+		defaultBus.cancel = cancel
+		go defaultBus.Run(ctx)
+		lifecycle.Register(lifecycle.PhaseDrainConsumers, "websocket-fanout", func(context.Context) error {
+			defaultBus.Stop()
+			return nil
+		})
+	})
+	return defaultBus
+}
+
+// Handle sets the handler delivering messages of topic. Messages of topics
+// without a handler are dropped.
+func (b *Bus) Handle(topic string, handler Handler) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.handlers[topic] = handler
+}
+
+// Publish delivers payload, which must be JSON, to the local handler of topic
+// and relays it to the other replicas. Local delivery doesn't depend on the
+// relay, so an error means only the other replicas missed the message.
+func (b *Bus) Publish(topic, target string, payload []byte) error {
+	b.deliver(topic, target, payload)
+
+	data, err := json.Marshal(envelope{Origin: b.origin, Topic: topic, Target: target, Payload: payload})
+	if err != nil {
+		publishErrorsTotal.WithLabelValues(topic).Inc()
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := b.pubsub.Publish(ctx, b.channel, data); err != nil {
+		publishErrorsTotal.WithLabelValues(topic).Inc()
+		return err
+	}
+	messagesTotal.WithLabelValues(topic, "published").Inc()
+	return nil
+}
+
+// Run subscribes to the channel, retrying with backoff until it succeeds or
+// ctx is cancelled. The subscription lasts until ctx is cancelled.
+func (b *Bus) Run(ctx context.Context) error {
+	backoff := time.Second
+	for {
+		err := b.pubsub.SubscribeChannel(ctx, b.channel, b.receive)
+		if err == nil {
+			fanoutLogger.Printf("Subscribed to %s as replica %s", b.channel, b.origin)
+			return nil
+		}
+		fanoutLogger.Printf("Error subscribing to %s, retrying in %s: %v", b.channel, backoff, err)
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(backoff):
+		}
+		if backoff < 30*time.Second {
+			backoff *= 2
+		}
+	}
+}
+
+// Stop ends the subscription of a bus returned by Default.
+func (b *Bus) Stop() {
+	if b.cancel != nil {
+		b.cancel()
+	}
+}
+
+func (b *Bus) receive(data []byte) {
+	var message envelope
+	if err := json.Unmarshal(data, &message); err != nil {
+		fanoutLogger.Printf("Ignoring malformed message on %s: %v", b.channel, err)
+		return
+	}
+	if message.Origin == b.origin {
+		return
+	}
+
+	messagesTotal.WithLabelValues(message.Topic, "received").Inc()
+	b.deliver(message.Topic, message.Target, message.Payload)
+}
+
+func (b *Bus) deliver(topic, target string, payload []byte) {
+	b.mu.RLock()
+	handler := b.handlers[topic]
+	b.mu.RUnlock()
+
+	if handler != nil {
+		handler(target, payload)
+	}
+}
@@ -0,0 +1,106 @@
+package fanout
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+)
+
+// memoryPubSub delivers published messages synchronously to every
+// subscriber, like a channel shared by all replicas.
+type memoryPubSub struct {
+	mu       sync.Mutex
+	handlers []func([]byte)
+	fail     error
+}
+
+func (p *memoryPubSub) Publish(ctx context.Context, channel string, payload []byte) error {
+	p.mu.Lock()
+	handlers, fail := p.handlers, p.fail
+	p.mu.Unlock()
+
+	if fail != nil {
+		return fail
+	}
+	for _, handler := range handlers {
+		handler(payload)
+	}
+	return nil
+}
+
+func (p *memoryPubSub) SubscribeChannel(ctx context.Context, channel string, handler func([]byte)) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.handlers = append(p.handlers, handler)
+	return nil
+}
+
+type recorder struct {
+	mu       sync.Mutex
+	received []string
+}
+
+func (r *recorder) handle(target string, payload []byte) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.received = append(r.received, target+"="+string(payload))
+}
+
+func TestPublishReachesEveryReplicaOnce(t *testing.T) {
+	pubsub := &memoryPubSub{}
+	replicas := make([]*Bus, 3)
+	recorders := make([]*recorder, 3)
+	for i := range replicas {
+		replicas[i] = New(pubsub, "")
+		recorders[i] = &recorder{}
+		replicas[i].Handle("state", recorders[i].handle)
+		if err := replicas[i].Run(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := replicas[0].Publish("state", "task:t1", []byte(`{"n":1}`)); err != nil {
+		t.Fatal(err)
+	}
+	for i, r := range recorders {
+		if len(r.received) != 1 || r.received[0] != `task:t1={"n":1}` {
+			t.Errorf("replica %d received %v", i, r.received)
+		}
+	}
+
+	// Topics without a handler are dropped.
+	if err := replicas[1].Publish("group", "agent", []byte(`{}`)); err != nil {
+		t.Fatal(err)
+	}
+	if len(recorders[2].received) != 1 {
+		t.Errorf("replica 2 received %v", recorders[2].received)
+	}
+}
+
+func TestPublishDeliversLocallyWhenRelayFails(t *testing.T) {
+	pubsub := &memoryPubSub{fail: errors.New("connection refused")}
+	bus := New(pubsub, "")
+	r := &recorder{}
+	bus.Handle("state", r.handle)
+
+	if err := bus.Publish("state", "k", []byte(`1`)); err == nil {
+		t.Fatal("expected the relay error")
+	}
+	if len(r.received) != 1 {
+		t.Fatalf("received %v", r.received)
+	}
+}
+
+func TestReceiveIgnoresMalformedMessages(t *testing.T) {
+	bus := New(&memoryPubSub{}, "")
+	r := &recorder{}
+	bus.Handle("state", r.handle)
+
+	bus.receive([]byte("not json"))
+	if len(r.received) != 0 {
+		t.Fatalf("received %v", r.received)
+	}
+}
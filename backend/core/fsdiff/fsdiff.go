@@ -0,0 +1,187 @@
+// Package fsdiff reviews the changes agents make to workspaces.
+//
+// The agent daemon of a workspace computes the diff of the working tree,
+// untracked files included, against a git revision or a snapshot taken
+// earlier, and applies patches back once they were reviewed. This package
+// issues those agent commands and parses the unified diffs into change lists.
+package fsdiff
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/spectrumwebco/agent_runtime/backend/core/agentcmd"
+)
+
+// Agent commands handled by the workspace daemon.
+const (
+	DiffCommand       = "workspace_diff"
+	SnapshotCommand   = "workspace_snapshot"
+	ApplyPatchCommand = "apply_patch"
+)
+
+// commandTimeout leaves time for diffs of large working trees.
+const commandTimeout = 2 * time.Minute
+
+var snapshotNamePattern = regexp.MustCompile(`^[A-Za-z0-9_-]+(\.[A-Za-z0-9_-]+)*$`)
+
+// ValidateSnapshotName checks a snapshot name before it's sent to the agent,
+// which uses it in a git ref.
+func ValidateSnapshotName(name string) error {
+	if len(name) > 100 || !snapshotNamePattern.MatchString(name) || strings.HasSuffix(name, ".lock") {
+		return fmt.Errorf("invalid snapshot name %q, use letters, digits, dots, dashes and underscores", name)
+	}
+	return nil
+}
+
+// DiffOptions select what the working tree is compared with. Base is a git
+// revision, HEAD if both are empty.
+type DiffOptions struct {
+	Base     string   `json:"base,omitempty"`
+	Snapshot string   `json:"snapshot,omitempty"`
+	Paths    []string `json:"paths,omitempty"`
+}
+
+// Diff is the difference of a working tree to its base.
+type Diff struct {
+	// Base is the revision or snapshot ref compared with, BaseCommit the
+	// commit it resolved to.
+	Base       string   `json:"base"`
+	BaseCommit string   `json:"base_commit"`
+	Patch      string   `json:"patch,omitempty"`
+	Changes    []Change `json:"changes,omitempty"`
+}
+
+// Snapshot is the working tree recorded as a commit.
+type Snapshot struct {
+	Name   string `json:"name"`
+	Ref    string `json:"ref"`
+	Commit string `json:"commit"`
+}
+
+// PatchRequest is a reviewed patch to apply to a working tree.
+type PatchRequest struct {
+	Patch string `json:"patch" openapi:"required"`
+	// Check only reports whether the patch applies.
+	Check bool `json:"check"`
+}
+
+// ApplyResult lists the files a patch touches.
+type ApplyResult struct {
+	Applied bool     `json:"applied"`
+	Files   []string `json:"files,omitempty"`
+}
+
+// PatchRejectedError is returned for patches that don't apply to the working
+// tree. Nothing was changed.
+type PatchRejectedError struct {
+	Files  []string
+	Reason string
+}
+
+func (e *PatchRejectedError) Error() string {
+	return "patch does not apply: " + e.Reason
+}
+
+// AgentError is a command the workspace agent failed, such as a diff against
+// an unknown base.
+type AgentError struct {
+	Command string
+	Message string
+}
+
+func (e *AgentError) Error() string {
+	return fmt.Sprintf("%s failed: %s", e.Command, e.Message)
+}
+
+// Client runs diff commands through the agents connected to this replica.
+type Client struct {
+	dispatcher *agentcmd.Dispatcher
+}
+
+func NewClient(dispatcher *agentcmd.Dispatcher) *Client {
+	return &Client{dispatcher: dispatcher}
+}
+
+func (c *Client) execute(ctx context.Context, workspaceID, command string, params, output interface{}) error {
+	encoded, err := json.Marshal(params)
+	if err != nil {
+		return err
+	}
+	result, err := c.dispatcher.Execute(ctx, workspaceID, command, encoded, agentcmd.Options{Timeout: commandTimeout})
+	if err != nil {
+		return err
+	}
+	if !result.Success {
+		return &AgentError{Command: command, Message: result.Error}
+	}
+	if err := json.Unmarshal(result.Output, output); err != nil {
+		return fmt.Errorf("invalid %s output: %v", command, err)
+	}
+	return nil
+}
+
+// Diff returns the diff of the working tree of a workspace with its changes
+// parsed.
+func (c *Client) Diff(ctx context.Context, workspaceID string, options DiffOptions) (*Diff, error) {
+	if options.Base != "" && options.Snapshot != "" {
+		return nil, errors.New("base and snapshot are mutually exclusive")
+	}
+	if options.Snapshot != "" {
+		if err := ValidateSnapshotName(options.Snapshot); err != nil {
+			return nil, err
+		}
+	}
+
+	diff := &Diff{}
+	if err := c.execute(ctx, workspaceID, DiffCommand, options, diff); err != nil {
+		return nil, err
+	}
+	changes, err := ParsePatch(diff.Patch)
+	if err != nil {
+		return nil, err
+	}
+	diff.Changes = changes
+	return diff, nil
+}
+
+// Snapshot records the working tree of a workspace under name, replacing an
+// earlier snapshot of that name.
+func (c *Client) Snapshot(ctx context.Context, workspaceID, name string) (*Snapshot, error) {
+	if err := ValidateSnapshotName(name); err != nil {
+		return nil, err
+	}
+	snapshot := &Snapshot{}
+	if err := c.execute(ctx, workspaceID, SnapshotCommand, map[string]string{"name": name}, snapshot); err != nil {
+		return nil, err
+	}
+	return snapshot, nil
+}
+
+// Apply applies a patch to the working tree of a workspace, or only checks
+// that it applies. Patches that don't apply fail with a PatchRejectedError.
+func (c *Client) Apply(ctx context.Context, workspaceID string, request PatchRequest) (*ApplyResult, error) {
+	changes, err := ParsePatch(request.Patch)
+	if err != nil {
+		return nil, err
+	}
+	if len(changes) == 0 {
+		return nil, errors.New("patch contains no changes")
+	}
+	var output struct {
+		ApplyResult
+		Error string `json:"error"`
+	}
+	if err := c.execute(ctx, workspaceID, ApplyPatchCommand, request, &output); err != nil {
+		return nil, err
+	}
+	if output.Error != "" {
+		return nil, &PatchRejectedError{Files: output.Files, Reason: output.Error}
+	}
+	return &output.ApplyResult, nil
+}
@@ -0,0 +1,86 @@
+package fsdiff
+
+import (
+	"testing"
+)
+
+const gitPatch = `diff --git a/main.go b/main.go
+index 8b13789..e69de29 100644
+--- a/main.go
++++ b/main.go
+@@ -1,3 +1,4 @@ package main
+ package main
+
+-func main() {}
++func main() {
++}
+\ No newline at end of file
+diff --git a/docs/new file.md b/docs/new file.md
+new file mode 100644
+index 0000000..3b18e51
+--- /dev/null
++++ b/docs/new file.md
+@@ -0,0 +1 @@
++hello
+diff --git a/old.txt b/renamed.txt
+similarity index 100%
+rename from old.txt
+rename to renamed.txt
+diff --git a/logo.png b/logo.png
+deleted file mode 100644
+index 5f3a..0000000
+Binary files a/logo.png and /dev/null differ
+`
+
+func TestParsePatch(t *testing.T) {
+	changes, err := ParsePatch(gitPatch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Change{
+		{Path: "main.go", Status: StatusModified, Additions: 2, Deletions: 1},
+		{Path: "docs/new file.md", Status: StatusAdded, Additions: 1},
+		{Path: "renamed.txt", OldPath: "old.txt", Status: StatusRenamed},
+		{Path: "logo.png", Status: StatusDeleted, Binary: true},
+	}
+	if len(changes) != len(want) {
+		t.Fatalf("got %d changes, want %d: %+v", len(changes), len(want), changes)
+	}
+	for i, change := range changes {
+		hunks := change.Hunks
+		change.Hunks = nil
+		if change.Path != want[i].Path || change.OldPath != want[i].OldPath || change.Status != want[i].Status ||
+			change.Binary != want[i].Binary || change.Additions != want[i].Additions || change.Deletions != want[i].Deletions {
+			t.Errorf("change %d is %+v, want %+v", i, change, want[i])
+		}
+		if i == 0 && (len(hunks) != 1 || hunks[0].Section != "package main" || len(hunks[0].Lines) != 6) {
+			t.Errorf("unexpected hunks of main.go: %+v", hunks)
+		}
+	}
+
+	// diff -u output without git headers
+	changes, err = ParsePatch("--- notes.txt\t2024-01-01 10:00:00\n+++ notes.txt\t2024-01-02 10:00:00\n@@ -1 +1 @@\n-a\n+b\n")
+	if err != nil || len(changes) != 1 || changes[0].Path != "notes.txt" || changes[0].Status != StatusModified {
+		t.Fatalf("unexpected changes of a plain diff: %+v, %v", changes, err)
+	}
+
+	if _, err := ParsePatch("--- a/x\n+++ b/x\n@@ -1,2 +1,2 @@\n-a\n+b\n"); err == nil {
+		t.Fatal("truncated hunks must be rejected")
+	}
+	if changes, err := ParsePatch(""); err != nil || len(changes) != 0 {
+		t.Fatalf("an empty patch has no changes, got %+v, %v", changes, err)
+	}
+}
+
+func TestValidateSnapshotName(t *testing.T) {
+	for _, name := range []string{"before-review", "run_1.step.2"} {
+		if err := ValidateSnapshotName(name); err != nil {
+			t.Errorf("%s: %v", name, err)
+		}
+	}
+	for _, name := range []string{"", "a..b", "../x", "a/b", ".hidden", "x.lock.", "main.lock"} {
+		if err := ValidateSnapshotName(name); err == nil {
+			t.Errorf("%q must be rejected", name)
+		}
+	}
+}
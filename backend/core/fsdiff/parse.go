@@ -0,0 +1,252 @@
+package fsdiff
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+type Status string
+
+const (
+	StatusAdded    Status = "added"
+	StatusModified Status = "modified"
+	StatusDeleted  Status = "deleted"
+	StatusRenamed  Status = "renamed"
+	StatusCopied   Status = "copied"
+)
+
+// Change is a file changed by a patch.
+type Change struct {
+	Path string `json:"path"`
+	// OldPath is the path before a rename or copy.
+	OldPath   string `json:"old_path,omitempty"`
+	Status    Status `json:"status"`
+	Binary    bool   `json:"binary,omitempty"`
+	Additions int    `json:"additions"`
+	Deletions int    `json:"deletions"`
+	Hunks     []Hunk `json:"hunks,omitempty"`
+}
+
+// Hunk is a changed region of a text file. Lines keep their leading ' ',
+// '-' or '+'.
+type Hunk struct {
+	OldStart int      `json:"old_start"`
+	OldLines int      `json:"old_lines"`
+	NewStart int      `json:"new_start"`
+	NewLines int      `json:"new_lines"`
+	Section  string   `json:"section,omitempty"`
+	Lines    []string `json:"lines"`
+}
+
+var hunkHeader = regexp.MustCompile(`^@@ -(\d+)(?:,(\d+))? \+(\d+)(?:,(\d+))? @@ ?(.*)$`)
+
+// ParsePatch parses a unified diff, as written by git diff or by diff -u,
+// into its changes.
+func ParsePatch(patch string) ([]Change, error) {
+	var (
+		changes []Change
+		change  *Change
+		// inHeader is set between the diff --git line of a file and its
+		// first hunk.
+		inHeader bool
+	)
+	lines := strings.Split(strings.TrimSuffix(patch, "\n"), "\n")
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+		switch {
+		case strings.HasPrefix(line, "diff --git "):
+			changes = append(changes, Change{Status: StatusModified})
+			change = &changes[len(changes)-1]
+			change.OldPath, change.Path = gitHeaderPaths(strings.TrimPrefix(line, "diff --git "))
+			inHeader = true
+
+		case strings.HasPrefix(line, "--- ") && i+1 < len(lines) && strings.HasPrefix(lines[i+1], "+++ "):
+			if !inHeader {
+				// plain unified diffs have no diff --git line
+				changes = append(changes, Change{Status: StatusModified})
+				change = &changes[len(changes)-1]
+			}
+			oldPath, newPath := patchPath(line[4:]), patchPath(lines[i+1][4:])
+			switch {
+			case oldPath == "":
+				change.Status = StatusAdded
+			case newPath == "":
+				change.Status = StatusDeleted
+			}
+			if oldPath != "" {
+				change.OldPath = oldPath
+			}
+			if newPath != "" {
+				change.Path = newPath
+			}
+			i++
+
+		case strings.HasPrefix(line, "@@ "):
+			if change == nil {
+				return nil, fmt.Errorf("hunk without a file header at line %d", i+1)
+			}
+			hunk, end, err := parseHunk(lines, i)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %v", change.Path, err)
+			}
+			for _, hunkLine := range hunk.Lines {
+				switch {
+				case strings.HasPrefix(hunkLine, "+"):
+					change.Additions++
+				case strings.HasPrefix(hunkLine, "-"):
+					change.Deletions++
+				}
+			}
+			change.Hunks = append(change.Hunks, hunk)
+			inHeader = false
+			i = end
+
+		case change != nil && inHeader:
+			parseExtendedHeader(change, line)
+		}
+	}
+
+	for i := range changes {
+		change := &changes[i]
+		if change.Path == "" {
+			change.Path = change.OldPath
+		}
+		if change.Path == "" {
+			return nil, fmt.Errorf("change %d has no path", i+1)
+		}
+		switch change.Status {
+		case StatusRenamed, StatusCopied:
+		default:
+			// only renames and copies keep a differing old path
+			change.OldPath = ""
+		}
+	}
+	return changes, nil
+}
+
+// parseExtendedHeader reads the lines git writes between diff --git and the
+// first hunk.
+func parseExtendedHeader(change *Change, line string) {
+	switch {
+	case strings.HasPrefix(line, "new file mode "):
+		change.Status = StatusAdded
+	case strings.HasPrefix(line, "deleted file mode "):
+		change.Status = StatusDeleted
+	case strings.HasPrefix(line, "rename from "):
+		change.Status = StatusRenamed
+		change.OldPath = unquotePath(strings.TrimPrefix(line, "rename from "))
+	case strings.HasPrefix(line, "rename to "):
+		change.Path = unquotePath(strings.TrimPrefix(line, "rename to "))
+	case strings.HasPrefix(line, "copy from "):
+		change.Status = StatusCopied
+		change.OldPath = unquotePath(strings.TrimPrefix(line, "copy from "))
+	case strings.HasPrefix(line, "copy to "):
+		change.Path = unquotePath(strings.TrimPrefix(line, "copy to "))
+	case line == "GIT binary patch" || strings.HasPrefix(line, "Binary files "):
+		change.Binary = true
+	}
+}
+
+// parseHunk parses the hunk starting at lines[start] and returns it with the
+// index of its last line.
+func parseHunk(lines []string, start int) (Hunk, int, error) {
+	match := hunkHeader.FindStringSubmatch(lines[start])
+	if match == nil {
+		return Hunk{}, 0, fmt.Errorf("invalid hunk header %q", lines[start])
+	}
+	count := func(value string) int {
+		if value == "" {
+			return 1
+		}
+		n, _ := strconv.Atoi(value)
+		return n
+	}
+	hunk := Hunk{
+		OldStart: count(match[1]),
+		OldLines: count(match[2]),
+		NewStart: count(match[3]),
+		NewLines: count(match[4]),
+		Section:  match[5],
+	}
+
+	oldLeft, newLeft := hunk.OldLines, hunk.NewLines
+	i := start + 1
+	for ; i < len(lines) && (oldLeft > 0 || newLeft > 0 || strings.HasPrefix(lines[i], `\`)); i++ {
+		line := lines[i]
+		switch {
+		case strings.HasPrefix(line, `\`):
+			// "\ No newline at end of file"
+		case strings.HasPrefix(line, "-"):
+			oldLeft--
+		case strings.HasPrefix(line, "+"):
+			newLeft--
+		case strings.HasPrefix(line, " "), line == "":
+			// editors strip the space of empty context lines
+			oldLeft--
+			newLeft--
+		default:
+			return Hunk{}, 0, fmt.Errorf("unexpected line %q in hunk %q", line, lines[start])
+		}
+		hunk.Lines = append(hunk.Lines, line)
+	}
+	if oldLeft != 0 || newLeft != 0 {
+		return Hunk{}, 0, fmt.Errorf("hunk %q is truncated", lines[start])
+	}
+	return hunk, i - 1, nil
+}
+
+// gitHeaderPaths returns the paths of a diff --git line. Paths with spaces
+// are ambiguous there, so they're only taken when both are the same; the
+// other header lines name them otherwise.
+func gitHeaderPaths(paths string) (string, string) {
+	if strings.HasPrefix(paths, `"`) {
+		if end := closingQuote(paths); end > 0 && end+1 < len(paths) {
+			return patchPath(paths[:end+1]), patchPath(strings.TrimSpace(paths[end+1:]))
+		}
+		return "", ""
+	}
+	if length := (len(paths) - 5) / 2; length > 0 && strings.HasPrefix(paths, "a/") && paths[2+length:] == " b/"+paths[2:2+length] {
+		return paths[2 : 2+length], paths[2 : 2+length]
+	}
+	return "", ""
+}
+
+func closingQuote(value string) int {
+	for i := 1; i < len(value); i++ {
+		switch value[i] {
+		case '\\':
+			i++
+		case '"':
+			return i
+		}
+	}
+	return -1
+}
+
+// patchPath returns the path of a ---/+++ line without the a/ or b/ prefix
+// and the timestamp of diff -u, or "" for /dev/null.
+func patchPath(value string) string {
+	if tab := strings.IndexByte(value, '\t'); tab >= 0 {
+		value = value[:tab]
+	}
+	value = unquotePath(strings.TrimSpace(value))
+	if value == "/dev/null" {
+		return ""
+	}
+	if strings.HasPrefix(value, "a/") || strings.HasPrefix(value, "b/") {
+		return value[2:]
+	}
+	return value
+}
+
+// unquotePath undoes git's C-style quoting of unusual paths.
+func unquotePath(value string) string {
+	if strings.HasPrefix(value, `"`) {
+		if unquoted, err := strconv.Unquote(value); err == nil {
+			return unquoted
+		}
+	}
+	return value
+}
@@ -0,0 +1,244 @@
+package githubapp
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// APIError is an error response of the GitHub API.
+type APIError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("github returned %d: %s", e.StatusCode, e.Message)
+}
+
+// CheckRun is a check run on a commit. Status is queued, in_progress or
+// completed; Conclusion is set once completed.
+type CheckRun struct {
+	ID         int64        `json:"id,omitempty"`
+	Name       string       `json:"name,omitempty"`
+	HeadSHA    string       `json:"head_sha,omitempty"`
+	Status     string       `json:"status,omitempty"`
+	Conclusion string       `json:"conclusion,omitempty"`
+	DetailsURL string       `json:"details_url,omitempty"`
+	Output     *CheckOutput `json:"output,omitempty"`
+}
+
+// CheckOutput is the title and summary shown on a check run.
+type CheckOutput struct {
+	Title   string `json:"title"`
+	Summary string `json:"summary"`
+}
+
+type installationToken struct {
+	token     string
+	expiresAt time.Time
+}
+
+// Client calls the GitHub API as the app's installations.
+type Client struct {
+	appID  int64
+	key    *rsa.PrivateKey
+	apiURL string
+	client *http.Client
+	now    func() time.Time
+
+	mu     sync.Mutex
+	tokens map[int64]installationToken
+}
+
+// NewClient loads the private key of config.
+func NewClient(config Config, client *http.Client) (*Client, error) {
+	pemKey := []byte(config.PrivateKey)
+	if len(pemKey) == 0 {
+		var err error
+		if pemKey, err = os.ReadFile(config.PrivateKeyFile); err != nil {
+			return nil, fmt.Errorf("error reading the GitHub App private key: %v", err)
+		}
+	}
+	key, err := ParsePrivateKey(pemKey)
+	if err != nil {
+		return nil, err
+	}
+	return &Client{
+		appID:  config.AppID,
+		key:    key,
+		apiURL: strings.TrimSuffix(config.APIURL, "/"),
+		client: client,
+		now:    time.Now,
+		tokens: make(map[int64]installationToken),
+	}, nil
+}
+
+// ParsePrivateKey parses the PKCS#1 key GitHub generates for apps, or a
+// PKCS#8 one.
+func ParsePrivateKey(pemKey []byte) (*rsa.PrivateKey, error) {
+	block, _ := pem.Decode(pemKey)
+	if block == nil {
+		return nil, errors.New("GitHub App private key is not PEM encoded")
+	}
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("invalid GitHub App private key: %v", err)
+	}
+	key, ok := parsed.(*rsa.PrivateKey)
+	if !ok {
+		return nil, errors.New("GitHub App private key is not an RSA key")
+	}
+	return key, nil
+}
+
+// appJWT authenticates as the app itself, which is only good for getting
+// installation tokens. The issue time is backdated for clock drift.
+func (c *Client) appJWT() (string, error) {
+	now := c.now()
+	encode := base64.RawURLEncoding.EncodeToString
+	claims, err := json.Marshal(map[string]interface{}{
+		"iat": now.Add(-time.Minute).Unix(),
+		"exp": now.Add(9 * time.Minute).Unix(),
+		"iss": strconv.FormatInt(c.appID, 10),
+	})
+	if err != nil {
+		return "", err
+	}
+	signed := encode([]byte(`{"alg":"RS256","typ":"JWT"}`)) + "." + encode(claims)
+	digest := sha256.Sum256([]byte(signed))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, c.key, crypto.SHA256, digest[:])
+	if err != nil {
+		return "", err
+	}
+	return signed + "." + encode(signature), nil
+}
+
+// InstallationToken returns a token acting as an installation of the app,
+// reused until shortly before it expires.
+func (c *Client) InstallationToken(ctx context.Context, installationID int64) (string, error) {
+	c.mu.Lock()
+	cached, ok := c.tokens[installationID]
+	c.mu.Unlock()
+	if ok && c.now().Add(5*time.Minute).Before(cached.expiresAt) {
+		return cached.token, nil
+	}
+
+	jwt, err := c.appJWT()
+	if err != nil {
+		return "", err
+	}
+	var response struct {
+		Token     string    `json:"token"`
+		ExpiresAt time.Time `json:"expires_at"`
+	}
+	path := "/app/installations/" + strconv.FormatInt(installationID, 10) + "/access_tokens"
+	if err := c.call(ctx, jwt, http.MethodPost, path, nil, &response); err != nil {
+		return "", err
+	}
+
+	c.mu.Lock()
+	c.tokens[installationID] = installationToken{token: response.Token, expiresAt: response.ExpiresAt}
+	c.mu.Unlock()
+	return response.Token, nil
+}
+
+// CreateCheckRun posts a check run on a commit of repo, given as
+// owner/name.
+func (c *Client) CreateCheckRun(ctx context.Context, installationID int64, repo string, run CheckRun) (*CheckRun, error) {
+	token, err := c.InstallationToken(ctx, installationID)
+	if err != nil {
+		return nil, err
+	}
+	created := &CheckRun{}
+	if err := c.call(ctx, token, http.MethodPost, "/repos/"+repo+"/check-runs", run, created); err != nil {
+		return nil, err
+	}
+	return created, nil
+}
+
+// UpdateCheckRun changes the status, conclusion or output of a check run.
+func (c *Client) UpdateCheckRun(ctx context.Context, installationID int64, repo string, run CheckRun) error {
+	token, err := c.InstallationToken(ctx, installationID)
+	if err != nil {
+		return err
+	}
+	id := run.ID
+	run.ID, run.HeadSHA = 0, ""
+	return c.call(ctx, token, http.MethodPatch, "/repos/"+repo+"/check-runs/"+strconv.FormatInt(id, 10), run, nil)
+}
+
+// Comment posts a comment on an issue or pull request.
+func (c *Client) Comment(ctx context.Context, installationID int64, repo string, number int, body string) error {
+	token, err := c.InstallationToken(ctx, installationID)
+	if err != nil {
+		return err
+	}
+	return c.call(ctx, token, http.MethodPost, "/repos/"+repo+"/issues/"+strconv.Itoa(number)+"/comments", map[string]string{"body": body}, nil)
+}
+
+func (c *Client) call(ctx context.Context, token, method, path string, request, response interface{}) error {
+	var body io.Reader
+	if request != nil {
+		encoded, err := json.Marshal(request)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(encoded)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, c.apiURL+path, body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/vnd.github+json")
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("X-GitHub-Api-Version", "2022-11-28")
+	if request != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	res, err := c.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("error calling GitHub: %v", err)
+	}
+	defer res.Body.Close()
+	payload, err := io.ReadAll(io.LimitReader(res.Body, 1<<20))
+	if err != nil {
+		return err
+	}
+	if res.StatusCode >= 300 {
+		var message struct {
+			Message string `json:"message"`
+		}
+		if json.Unmarshal(payload, &message) != nil || message.Message == "" {
+			message.Message = strings.TrimSpace(string(payload))
+		}
+		return &APIError{StatusCode: res.StatusCode, Message: message.Message}
+	}
+	if response == nil {
+		return nil
+	}
+	if err := json.Unmarshal(payload, response); err != nil {
+		return fmt.Errorf("invalid response of GitHub: %v", err)
+	}
+	return nil
+}
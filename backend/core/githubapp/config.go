@@ -0,0 +1,70 @@
+package githubapp
+
+import (
+	"os"
+	"time"
+
+	"github.com/spectrumwebco/agent_runtime/backend/core/config/env"
+)
+
+type Config struct {
+	AppID int64 `json:"app_id"`
+	// PrivateKey is the PEM encoded private key of the app. PrivateKeyFile
+	// is read instead if it's empty.
+	PrivateKey     string `json:"-"`
+	PrivateKeyFile string `json:"private_key_file,omitempty"`
+	WebhookSecret  string `json:"-"`
+	// APIURL is the REST API of GitHub, https://<host>/api/v3 on GitHub
+	// Enterprise Server.
+	APIURL string `json:"api_url"`
+	// TriggerLabel is the issue label that creates a workspace for the
+	// issue.
+	TriggerLabel string `json:"trigger_label"`
+	// CheckName names the check run posted on pull requests.
+	CheckName string `json:"check_name"`
+	// CLIPath is the kled binary workspaces are created with, Provider and
+	// PrebuildRepository are passed to kled up if set.
+	CLIPath            string        `json:"cli_path"`
+	Provider           string        `json:"provider,omitempty"`
+	PrebuildRepository string        `json:"prebuild_repository,omitempty"`
+	ProvisionTimeout   time.Duration `json:"provision_timeout"`
+}
+
+const (
+	DefaultAPIURL           = "https://api.github.com"
+	DefaultTriggerLabel     = "kled"
+	DefaultCheckName        = "kled workspace"
+	DefaultCLIPath          = "kled"
+	DefaultProvisionTimeout = 30 * time.Minute
+)
+
+// Enabled reports whether the app is configured. Without it webhooks are
+// rejected.
+func (c Config) Enabled() bool {
+	return c.AppID != 0 && c.WebhookSecret != "" && (c.PrivateKey != "" || c.PrivateKeyFile != "")
+}
+
+var Default = env.Once(FromEnv)
+
+func FromEnv() Config {
+	config := Config{
+		PrivateKey:         os.Getenv("AGENT_GITHUB_APP_PRIVATE_KEY"),
+		PrivateKeyFile:     os.Getenv("AGENT_GITHUB_APP_PRIVATE_KEY_FILE"),
+		WebhookSecret:      os.Getenv("AGENT_GITHUB_APP_WEBHOOK_SECRET"),
+		APIURL:             DefaultAPIURL,
+		TriggerLabel:       DefaultTriggerLabel,
+		CheckName:          DefaultCheckName,
+		CLIPath:            DefaultCLIPath,
+		Provider:           os.Getenv("AGENT_GITHUB_APP_PROVIDER"),
+		PrebuildRepository: os.Getenv("AGENT_GITHUB_APP_PREBUILD_REPOSITORY"),
+		ProvisionTimeout:   DefaultProvisionTimeout,
+	}
+	read := env.NewReader(githubLogger)
+	read.Int64("AGENT_GITHUB_APP_ID", &config.AppID, 1)
+	read.String("AGENT_GITHUB_APP_API_URL", &config.APIURL)
+	read.String("AGENT_GITHUB_APP_TRIGGER_LABEL", &config.TriggerLabel)
+	read.String("AGENT_GITHUB_APP_CHECK_NAME", &config.CheckName)
+	read.String("AGENT_GITHUB_APP_CLI_PATH", &config.CLIPath)
+	read.PositiveDuration("AGENT_GITHUB_APP_PROVISION_TIMEOUT", &config.ProvisionTimeout)
+	return config
+}
@@ -0,0 +1,203 @@
+// Package githubapp creates workspaces from GitHub App webhooks.
+//
+// When a pull request is opened, reopened or pushed to, a prebuilt workspace
+// is created for its head and a check run on the head commit links to it.
+// Labelling an issue with the trigger label creates a workspace on the
+// default branch and comments the link on the issue. The workspace is
+// deleted when the pull request or issue is closed, or the label removed.
+//
+// Workspaces are created and deleted with the kled CLI, named after the
+// pull request or issue so later events find them.
+package githubapp
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+var githubLogger = log.New(os.Stdout, "kled.githubapp: ", log.LstdFlags)
+
+// WorkspaceSpec is a workspace to create.
+type WorkspaceSpec struct {
+	ID string
+	// Source is the kled up source, a repository URL with an optional
+	// @branch or @pull/<n>/head suffix.
+	Source string
+	// Reset recreates an existing workspace, for pull requests pushed to.
+	Reset bool
+}
+
+// Provisioner creates and deletes workspaces.
+type Provisioner interface {
+	Up(ctx context.Context, spec WorkspaceSpec) error
+	Delete(ctx context.Context, workspaceID string) error
+}
+
+// CLIProvisioner runs the kled CLI.
+type CLIProvisioner struct {
+	Path               string
+	Provider           string
+	PrebuildRepository string
+}
+
+func (p *CLIProvisioner) Up(ctx context.Context, spec WorkspaceSpec) error {
+	args := []string{"up", spec.Source, "--id", spec.ID, "--ide", "none", "--open-ide=false"}
+	if p.Provider != "" {
+		args = append(args, "--provider", p.Provider)
+	}
+	if p.PrebuildRepository != "" {
+		args = append(args, "--prebuild-repository", p.PrebuildRepository)
+	}
+	if spec.Reset {
+		args = append(args, "--reset")
+	}
+	return p.run(ctx, args...)
+}
+
+func (p *CLIProvisioner) Delete(ctx context.Context, workspaceID string) error {
+	return p.run(ctx, "delete", workspaceID, "--force", "--ignore-not-found")
+}
+
+func (p *CLIProvisioner) run(ctx context.Context, args ...string) error {
+	out, err := exec.CommandContext(ctx, p.Path, args...).CombinedOutput()
+	if err != nil {
+		output := strings.TrimSpace(string(out))
+		if len(output) > 2000 {
+			output = output[len(output)-2000:]
+		}
+		return fmt.Errorf("kled %s: %v: %s", args[0], err, output)
+	}
+	return nil
+}
+
+// Integration acts on webhook events.
+type Integration struct {
+	client      *Client
+	provisioner Provisioner
+	config      Config
+	// WorkspaceURL returns the link to connect to a workspace.
+	WorkspaceURL func(workspaceID string) string
+}
+
+func NewIntegration(client *Client, provisioner Provisioner, config Config) *Integration {
+	return &Integration{client: client, provisioner: provisioner, config: config}
+}
+
+// Handle acts on an event. Creating a workspace takes minutes, so callers
+// acknowledge the delivery first and handle it in the background.
+func (i *Integration) Handle(ctx context.Context, event *Event) error {
+	if event.PullRequest != nil {
+		return i.handlePullRequest(ctx, event)
+	}
+	return i.handleIssue(ctx, event)
+}
+
+func (i *Integration) handlePullRequest(ctx context.Context, event *Event) error {
+	repo := event.Repository.FullName
+	number := event.PullRequest.Number
+	workspaceID := WorkspaceID(repo, "pr", number)
+
+	switch event.Action {
+	case "opened", "reopened", "synchronize":
+	case "closed":
+		return i.provisioner.Delete(ctx, workspaceID)
+	default:
+		return nil
+	}
+
+	installation := event.Installation.ID
+	run, err := i.client.CreateCheckRun(ctx, installation, repo, CheckRun{
+		Name:    i.config.CheckName,
+		HeadSHA: event.PullRequest.Head.SHA,
+		Status:  "in_progress",
+		Output:  &CheckOutput{Title: "Creating workspace", Summary: "Creating workspace `" + workspaceID + "` for this commit."},
+	})
+	if err != nil {
+		return err
+	}
+
+	source, err := i.source(ctx, event, fmt.Sprintf("@pull/%d/head", number))
+	if err == nil {
+		err = i.provisioner.Up(ctx, WorkspaceSpec{ID: workspaceID, Source: source, Reset: event.Action == "synchronize"})
+	}
+	update := CheckRun{ID: run.ID, Status: "completed"}
+	if err != nil {
+		update.Conclusion = "failure"
+		update.Output = &CheckOutput{Title: "Workspace creation failed", Summary: "```\n" + err.Error() + "\n```"}
+	} else {
+		link := i.link(workspaceID)
+		update.Conclusion = "success"
+		update.DetailsURL = link
+		update.Output = &CheckOutput{Title: "Workspace ready", Summary: "Connect to workspace `" + workspaceID + "`: " + link}
+	}
+	if updateErr := i.client.UpdateCheckRun(ctx, installation, repo, update); updateErr != nil && err == nil {
+		err = updateErr
+	}
+	return err
+}
+
+func (i *Integration) handleIssue(ctx context.Context, event *Event) error {
+	repo := event.Repository.FullName
+	number := event.Issue.Number
+	workspaceID := WorkspaceID(repo, "issue", number)
+	labelled := event.Label != nil && strings.EqualFold(event.Label.Name, i.config.TriggerLabel)
+
+	switch {
+	case event.Action == "labeled" && labelled:
+	case event.Action == "unlabeled" && labelled, event.Action == "closed":
+		return i.provisioner.Delete(ctx, workspaceID)
+	default:
+		return nil
+	}
+
+	ref := ""
+	if event.Repository.DefaultBranch != "" {
+		ref = "@" + event.Repository.DefaultBranch
+	}
+	source, err := i.source(ctx, event, ref)
+	if err == nil {
+		err = i.provisioner.Up(ctx, WorkspaceSpec{ID: workspaceID, Source: source})
+	}
+	body := "Workspace `" + workspaceID + "` is ready: " + i.link(workspaceID)
+	if err != nil {
+		body = "Creating workspace `" + workspaceID + "` failed:\n```\n" + err.Error() + "\n```"
+	}
+	if commentErr := i.client.Comment(ctx, event.Installation.ID, repo, number, body); commentErr != nil && err == nil {
+		err = commentErr
+	}
+	return err
+}
+
+// source is the kled up source of the event's repository. Private
+// repositories are cloned with an installation token.
+func (i *Integration) source(ctx context.Context, event *Event, ref string) (string, error) {
+	cloneURL := event.Repository.CloneURL
+	if cloneURL == "" {
+		return "", fmt.Errorf("repository %s has no clone URL", event.Repository.FullName)
+	}
+	if event.Repository.Private {
+		token, err := i.client.InstallationToken(ctx, event.Installation.ID)
+		if err != nil {
+			return "", err
+		}
+		u, err := url.Parse(cloneURL)
+		if err != nil {
+			return "", err
+		}
+		u.User = url.UserPassword("x-access-token", token)
+		cloneURL = u.String()
+	}
+	return cloneURL + ref, nil
+}
+
+func (i *Integration) link(workspaceID string) string {
+	if i.WorkspaceURL == nil {
+		return workspaceID
+	}
+	return i.WorkspaceURL(workspaceID)
+}
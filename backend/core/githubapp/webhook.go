@@ -0,0 +1,92 @@
+package githubapp
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// VerifySignature checks the X-Hub-Signature-256 header GitHub signs
+// deliveries with.
+func VerifySignature(secret, header string, body []byte) error {
+	signature, ok := strings.CutPrefix(header, "sha256=")
+	if !ok {
+		return errors.New("missing webhook signature")
+	}
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	if !hmac.Equal([]byte(signature), []byte(hex.EncodeToString(mac.Sum(nil)))) {
+		return errors.New("webhook signature does not match")
+	}
+	return nil
+}
+
+// Repository is the repository of an event.
+type Repository struct {
+	FullName      string `json:"full_name"`
+	CloneURL      string `json:"clone_url"`
+	DefaultBranch string `json:"default_branch"`
+	Private       bool   `json:"private"`
+}
+
+// Event is the part of pull_request and issues deliveries the app acts on.
+type Event struct {
+	Action       string `json:"action"`
+	Installation struct {
+		ID int64 `json:"id"`
+	} `json:"installation"`
+	Repository  Repository `json:"repository"`
+	PullRequest *struct {
+		Number int `json:"number"`
+		Head   struct {
+			SHA string `json:"sha"`
+			Ref string `json:"ref"`
+		} `json:"head"`
+	} `json:"pull_request"`
+	Issue *struct {
+		Number int `json:"number"`
+	} `json:"issue"`
+	Label *struct {
+		Name string `json:"name"`
+	} `json:"label"`
+}
+
+// ParseEvent parses a delivery of the given X-GitHub-Event type. Only
+// pull_request and issues events are accepted.
+func ParseEvent(eventType string, payload []byte) (*Event, error) {
+	if eventType != "pull_request" && eventType != "issues" {
+		return nil, fmt.Errorf("unsupported event %q", eventType)
+	}
+	event := &Event{}
+	if err := json.Unmarshal(payload, event); err != nil {
+		return nil, fmt.Errorf("invalid %s event: %v", eventType, err)
+	}
+	if event.Installation.ID == 0 || event.Repository.FullName == "" {
+		return nil, fmt.Errorf("%s event has no installation or repository", eventType)
+	}
+	if (eventType == "pull_request") != (event.PullRequest != nil) || (eventType == "issues") != (event.Issue != nil) {
+		return nil, fmt.Errorf("malformed %s event", eventType)
+	}
+	return event, nil
+}
+
+var workspaceIDPattern = regexp.MustCompile(`[^0-9a-z]+`)
+
+// WorkspaceID names the workspace of a pull request or issue, so later
+// events find it without storing anything. It follows the rules of kled
+// workspace IDs.
+func WorkspaceID(repo, kind string, number int) string {
+	name := repo[strings.LastIndex(repo, "/")+1:]
+	suffix := "-" + kind + "-" + strconv.Itoa(number)
+	id := strings.Trim(workspaceIDPattern.ReplaceAllString(strings.ToLower(name), "-"), "-")
+	if len(id)+len(suffix) > 48 {
+		id = strings.TrimRight(id[:48-len(suffix)], "-")
+	}
+	return id + suffix
+}
@@ -0,0 +1,103 @@
+package gpu
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/spectrumwebco/agent_runtime/backend/db/integrations/integrationsmock"
+)
+
+func TestParseNVIDIASMI(t *testing.T) {
+	output := []byte("0, GPU-aaa, 3, 120, 40960\n1, GPU-bbb, [N/A], 0, 40960\n")
+	samples, err := ParseNVIDIASMI(output, time.Unix(0, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(samples) != 2 {
+		t.Fatalf("expected 2 samples, got %d", len(samples))
+	}
+	if samples[0].UUID != "GPU-aaa" || samples[0].Utilization != 3 || samples[0].MemoryUsedMiB != 120 {
+		t.Errorf("unexpected sample: %+v", samples[0])
+	}
+	if samples[1].Utilization != 0 {
+		t.Errorf("expected N/A utilization to parse as 0, got %v", samples[1].Utilization)
+	}
+}
+
+type recordingController struct {
+	stopped []string
+}
+
+func (c *recordingController) Downgrade(ctx context.Context, workspaceID, target string) error {
+	return nil
+}
+
+func (c *recordingController) Stop(ctx context.Context, workspaceID string) error {
+	c.stopped = append(c.stopped, workspaceID)
+	return nil
+}
+
+func TestReclaimerStopsAfterGracePeriod(t *testing.T) {
+	ctx := context.Background()
+	policies := NewMemoryPolicyStore()
+	policies.SetPolicy(ctx, "org/p1", Policy{
+		Enabled:         true,
+		IdleUtilization: 10,
+		Window:          Duration(10 * time.Minute),
+		GracePeriod:     Duration(5 * time.Minute),
+		Action:          ActionStop,
+	})
+
+	var notices []Notice
+	controller := &recordingController{}
+	reclaimer := NewReclaimer(integrationsmock.NewKVStore(), policies, DefaultPolicy(), NotifierFunc(func(ctx context.Context, n Notice) error {
+		notices = append(notices, n)
+		return nil
+	}), controller)
+
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	reclaimer.SetClock(func() time.Time { return now })
+	workspace := Workspace{ID: "ws-1", OwnerID: "u1", ProjectID: "org/p1"}
+	idle := []Sample{{Index: 0, Utilization: 2}, {Index: 1, Utilization: 1}}
+
+	observe := func(samples []Sample) Decision {
+		decision, err := reclaimer.Observe(ctx, workspace, samples)
+		if err != nil {
+			t.Fatal(err)
+		}
+		now = now.Add(time.Minute)
+		return decision
+	}
+
+	for i := 0; i < 10; i++ {
+		if decision := observe(idle); decision.Notified {
+			t.Fatalf("notified before the window elapsed at minute %d", i)
+		}
+	}
+
+	// A busy sample resets the window.
+	observe([]Sample{{Index: 0, Utilization: 80}, {Index: 1, Utilization: 0}})
+	for i := 0; i < 10; i++ {
+		observe(idle)
+	}
+	if decision := observe(idle); !decision.Notified || decision.Taken {
+		t.Fatalf("expected a notice without action, got %+v", decision)
+	}
+	if len(notices) != 1 || notices[0].Action != ActionStop {
+		t.Fatalf("expected one stop warning, got %+v", notices)
+	}
+
+	var decision Decision
+	for i := 0; i < 5; i++ {
+		decision = observe(idle)
+	}
+	if !decision.Taken || len(controller.stopped) != 1 {
+		t.Fatalf("expected the workspace to be stopped, got %+v", decision)
+	}
+
+	observe(idle)
+	if len(controller.stopped) != 1 {
+		t.Errorf("expected the action to run once, got %d", len(controller.stopped))
+	}
+}
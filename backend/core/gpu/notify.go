@@ -0,0 +1,100 @@
+package gpu
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// Notice tells a workspace owner that their GPUs are idle and what will
+// happen if they stay idle.
+type Notice struct {
+	Workspace   Workspace `json:"workspace"`
+	IdleSince   time.Time `json:"idle_since"`
+	Utilization float64   `json:"utilization"`
+	Action      Action    `json:"action"`
+	// ActionAt is when Action runs; zero for ActionNotify.
+	ActionAt time.Time `json:"action_at,omitempty"`
+	// Taken is set once Action has been carried out.
+	Taken bool `json:"taken"`
+}
+
+func (n Notice) Message() string {
+	switch {
+	case n.Taken && n.Action == ActionStop:
+		return fmt.Sprintf("Workspace %s was stopped because its GPUs were idle since %s.", n.Workspace.Name(), n.IdleSince.Format(time.RFC3339))
+	case n.Taken && n.Action == ActionDowngrade:
+		return fmt.Sprintf("Workspace %s was downgraded because its GPUs were idle since %s.", n.Workspace.Name(), n.IdleSince.Format(time.RFC3339))
+	case n.Action == ActionNotify:
+		return fmt.Sprintf("Workspace %s has had idle GPUs since %s (%.0f%% utilization).", n.Workspace.Name(), n.IdleSince.Format(time.RFC3339), n.Utilization)
+	}
+	return fmt.Sprintf("Workspace %s has had idle GPUs since %s and will be %s at %s unless it becomes busy.",
+		n.Workspace.Name(), n.IdleSince.Format(time.RFC3339), actionPastTense(n.Action), n.ActionAt.Format(time.RFC3339))
+}
+
+func actionPastTense(action Action) string {
+	if action == ActionStop {
+		return "stopped"
+	}
+	return "downgraded"
+}
+
+type Notifier interface {
+	Notify(ctx context.Context, notice Notice) error
+}
+
+type NotifierFunc func(ctx context.Context, notice Notice) error
+
+func (f NotifierFunc) Notify(ctx context.Context, notice Notice) error {
+	return f(ctx, notice)
+}
+
+// MultiNotifier delivers to every notifier and returns the first error.
+type MultiNotifier []Notifier
+
+func (m MultiNotifier) Notify(ctx context.Context, notice Notice) error {
+	var firstErr error
+	for _, notifier := range m {
+		if err := notifier.Notify(ctx, notice); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// SlackNotifier posts notices to a Slack incoming webhook.
+type SlackNotifier struct {
+	WebhookURL string
+	Client     *http.Client
+}
+
+func (s *SlackNotifier) Notify(ctx context.Context, notice Notice) error {
+	body, err := json.Marshal(map[string]string{"text": notice.Message()})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.WebhookURL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	client := s.Client
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+	res, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("error posting to Slack: %v", err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode >= 300 {
+		return fmt.Errorf("slack webhook returned %s", res.Status)
+	}
+	return nil
+}
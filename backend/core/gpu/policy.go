@@ -0,0 +1,203 @@
+package gpu
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/spectrumwebco/agent_runtime/backend/db/integrations"
+)
+
+type Action string
+
+const (
+	// ActionNotify only tells the owner that the GPU is idle.
+	ActionNotify Action = "notify"
+	// ActionDowngrade moves the workspace to Policy.DowngradeTo.
+	ActionDowngrade Action = "downgrade"
+	// ActionStop stops the workspace.
+	ActionStop Action = "stop"
+)
+
+// Policy decides when a GPU workspace counts as idle and what happens then.
+// The owner is always notified first; Action runs once GracePeriod has passed
+// without the workspace becoming busy again.
+type Policy struct {
+	Enabled bool `json:"enabled"`
+	// IdleUtilization is the utilization percentage every GPU must stay
+	// below for the workspace to count as idle.
+	IdleUtilization float64  `json:"idle_utilization"`
+	Window          Duration `json:"window"`
+	GracePeriod     Duration `json:"grace_period"`
+	Action          Action   `json:"action"`
+	// DowngradeTo names the machine type or GPU profile for ActionDowngrade.
+	DowngradeTo string `json:"downgrade_to,omitempty"`
+}
+
+func DefaultPolicy() Policy {
+	return Policy{
+		Enabled:         true,
+		IdleUtilization: 5,
+		Window:          Duration(30 * time.Minute),
+		GracePeriod:     Duration(15 * time.Minute),
+		Action:          ActionNotify,
+	}
+}
+
+func (p Policy) Validate() error {
+	if p.IdleUtilization < 0 || p.IdleUtilization > 100 {
+		return fmt.Errorf("idle_utilization must be between 0 and 100")
+	}
+	if p.Window <= 0 {
+		return fmt.Errorf("window must be positive")
+	}
+	if p.GracePeriod < 0 {
+		return fmt.Errorf("grace_period must not be negative")
+	}
+	switch p.Action {
+	case ActionNotify, ActionStop:
+	case ActionDowngrade:
+		if p.DowngradeTo == "" {
+			return fmt.Errorf("downgrade_to is required for the downgrade action")
+		}
+	default:
+		return fmt.Errorf("unknown action %q", p.Action)
+	}
+	return nil
+}
+
+// Duration is a time.Duration that is encoded in JSON as a Go duration
+// string such as "30m".
+type Duration time.Duration
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var value string
+	if err := json.Unmarshal(data, &value); err != nil {
+		return fmt.Errorf("duration must be a string such as \"30m\"")
+	}
+	parsed, err := time.ParseDuration(value)
+	if err != nil {
+		return err
+	}
+	*d = Duration(parsed)
+	return nil
+}
+
+// PolicyStore holds per-project overrides of the default policy.
+type PolicyStore interface {
+	// Policy returns the project's policy and whether it has an override.
+	Policy(ctx context.Context, projectID string) (Policy, bool, error)
+	SetPolicy(ctx context.Context, projectID string, policy Policy) error
+	DeletePolicy(ctx context.Context, projectID string) error
+}
+
+type MemoryPolicyStore struct {
+	policies map[string]Policy
+	mu       sync.RWMutex
+}
+
+func NewMemoryPolicyStore() *MemoryPolicyStore {
+	return &MemoryPolicyStore{policies: make(map[string]Policy)}
+}
+
+func (s *MemoryPolicyStore) Policy(ctx context.Context, projectID string) (Policy, bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	policy, ok := s.policies[projectID]
+	return policy, ok, nil
+}
+
+func (s *MemoryPolicyStore) SetPolicy(ctx context.Context, projectID string, policy Policy) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.policies[projectID] = policy
+	return nil
+}
+
+func (s *MemoryPolicyStore) DeletePolicy(ctx context.Context, projectID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.policies, projectID)
+	return nil
+}
+
+// PostgresPolicyStore keeps overrides as JSON in app_gpu_policy.
+type PostgresPolicyStore struct {
+	client integrations.SQLStore
+}
+
+func NewPostgresPolicyStore(client integrations.SQLStore) *PostgresPolicyStore {
+	return &PostgresPolicyStore{client: client}
+}
+
+func (s *PostgresPolicyStore) EnsureSchema() error {
+	_, err := s.client.ExecuteUpdate(`
+		CREATE TABLE IF NOT EXISTS app_gpu_policy (
+			project_id VARCHAR(255) PRIMARY KEY,
+			policy JSONB NOT NULL,
+			updated_at TIMESTAMPTZ NOT NULL DEFAULT now()
+		)
+	`)
+	if err != nil {
+		return fmt.Errorf("error creating GPU policy table: %v", err)
+	}
+	return nil
+}
+
+func (s *PostgresPolicyStore) Policy(ctx context.Context, projectID string) (Policy, bool, error) {
+	rows, err := s.client.ExecuteQuery(`SELECT policy FROM app_gpu_policy WHERE project_id = $1`, projectID)
+	if err != nil {
+		return Policy{}, false, fmt.Errorf("error loading GPU policy for %s: %v", projectID, err)
+	}
+	if len(rows) == 0 {
+		return Policy{}, false, nil
+	}
+
+	var raw []byte
+	switch value := rows[0]["policy"].(type) {
+	case []byte:
+		raw = value
+	case string:
+		raw = []byte(value)
+	default:
+		return Policy{}, false, fmt.Errorf("unexpected GPU policy value %T", value)
+	}
+
+	var policy Policy
+	if err := json.Unmarshal(raw, &policy); err != nil {
+		return Policy{}, false, fmt.Errorf("error decoding GPU policy for %s: %v", projectID, err)
+	}
+	return policy, true, nil
+}
+
+func (s *PostgresPolicyStore) SetPolicy(ctx context.Context, projectID string, policy Policy) error {
+	raw, err := json.Marshal(policy)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.client.ExecuteUpdate(`
+		INSERT INTO app_gpu_policy (project_id, policy) VALUES ($1, $2)
+		ON CONFLICT (project_id) DO UPDATE SET policy = EXCLUDED.policy, updated_at = now()
+	`, projectID, string(raw))
+	if err != nil {
+		return fmt.Errorf("error saving GPU policy for %s: %v", projectID, err)
+	}
+	return nil
+}
+
+func (s *PostgresPolicyStore) DeletePolicy(ctx context.Context, projectID string) error {
+	if _, err := s.client.ExecuteUpdate(`DELETE FROM app_gpu_policy WHERE project_id = $1`, projectID); err != nil {
+		return fmt.Errorf("error deleting GPU policy for %s: %v", projectID, err)
+	}
+	return nil
+}
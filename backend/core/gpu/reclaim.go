@@ -0,0 +1,235 @@
+package gpu
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/spectrumwebco/agent_runtime/backend/db/integrations"
+)
+
+var gpuLogger = log.New(os.Stdout, "kled.gpu: ", log.LstdFlags)
+
+// Workspace identifies the GPU workspace samples were taken from.
+type Workspace struct {
+	ID        string `json:"id"`
+	Label     string `json:"name,omitempty"`
+	OwnerID   string `json:"owner_id"`
+	ProjectID string `json:"project_id"`
+}
+
+func (w Workspace) Name() string {
+	if w.Label != "" {
+		return w.Label
+	}
+	return w.ID
+}
+
+// Controller carries out reclamation actions.
+type Controller interface {
+	Downgrade(ctx context.Context, workspaceID, target string) error
+	Stop(ctx context.Context, workspaceID string) error
+}
+
+// idleState is the per-workspace state kept in the KVStore, so that samples
+// for one workspace may be handled by any replica.
+type idleState struct {
+	IdleSince  time.Time `json:"idle_since"`
+	NotifiedAt time.Time `json:"notified_at"`
+	ActionAt   time.Time `json:"action_at"`
+	Taken      bool      `json:"taken"`
+	LastSample time.Time `json:"last_sample"`
+}
+
+// Decision reports what Observe did.
+type Decision struct {
+	Idle     bool      `json:"idle"`
+	Notified bool      `json:"notified"`
+	Action   Action    `json:"action,omitempty"`
+	ActionAt time.Time `json:"action_at,omitempty"`
+	Taken    bool      `json:"taken"`
+}
+
+// Reclaimer tracks how long each workspace's GPUs have been idle and applies
+// the project's policy.
+type Reclaimer struct {
+	state      integrations.KVStore
+	policies   PolicyStore
+	defaults   Policy
+	notifier   Notifier
+	controller Controller
+	now        func() time.Time
+}
+
+func NewReclaimer(state integrations.KVStore, policies PolicyStore, defaults Policy, notifier Notifier, controller Controller) *Reclaimer {
+	return &Reclaimer{
+		state:      state,
+		policies:   policies,
+		defaults:   defaults,
+		notifier:   notifier,
+		controller: controller,
+		now:        time.Now,
+	}
+}
+
+func (r *Reclaimer) SetClock(now func() time.Time) {
+	r.now = now
+}
+
+// PolicyFor returns the project's override, or the default policy.
+func (r *Reclaimer) PolicyFor(ctx context.Context, projectID string) (Policy, error) {
+	if projectID != "" {
+		policy, ok, err := r.policies.Policy(ctx, projectID)
+		if err != nil {
+			return Policy{}, err
+		}
+		if ok {
+			return policy, nil
+		}
+	}
+	return r.defaults, nil
+}
+
+func stateKey(workspaceID string) string {
+	return "kled:gpu:idle:" + workspaceID
+}
+
+// Observe records a batch of samples taken at the same time and applies the
+// policy. A workspace is idle while every GPU stays below the policy's idle
+// utilization; any busy sample resets the window.
+func (r *Reclaimer) Observe(ctx context.Context, workspace Workspace, samples []Sample) (Decision, error) {
+	if len(samples) == 0 {
+		return Decision{}, nil
+	}
+
+	policy, err := r.PolicyFor(ctx, workspace.ProjectID)
+	if err != nil {
+		return Decision{}, err
+	}
+	if !policy.Enabled {
+		return Decision{}, nil
+	}
+
+	state, err := r.loadState(workspace.ID)
+	if err != nil {
+		return Decision{}, err
+	}
+
+	now := r.now()
+	peak := 0.0
+	for _, sample := range samples {
+		if sample.Utilization > peak {
+			peak = sample.Utilization
+		}
+	}
+
+	window := time.Duration(policy.Window)
+	// A gap longer than the window means the sampler was not running, so
+	// the workspace cannot be shown to have been idle throughout.
+	if peak >= policy.IdleUtilization || (!state.LastSample.IsZero() && now.Sub(state.LastSample) > window) {
+		state = idleState{}
+	}
+	state.LastSample = now
+	if peak >= policy.IdleUtilization {
+		return Decision{}, r.saveState(workspace.ID, state, policy)
+	}
+
+	if state.IdleSince.IsZero() {
+		state.IdleSince = now
+	}
+	decision := Decision{Idle: true, Action: policy.Action}
+
+	if now.Sub(state.IdleSince) >= window && state.NotifiedAt.IsZero() {
+		state.NotifiedAt = now
+		if policy.Action != ActionNotify {
+			state.ActionAt = now.Add(time.Duration(policy.GracePeriod))
+		}
+		r.notify(ctx, Notice{Workspace: workspace, IdleSince: state.IdleSince, Utilization: peak, Action: policy.Action, ActionAt: state.ActionAt})
+	}
+	decision.Notified = !state.NotifiedAt.IsZero()
+	decision.ActionAt = state.ActionAt
+
+	if policy.Action != ActionNotify && !state.Taken && !state.ActionAt.IsZero() && !now.Before(state.ActionAt) {
+		if err := r.act(ctx, workspace, policy); err != nil {
+			return decision, err
+		}
+		state.Taken = true
+		r.notify(ctx, Notice{Workspace: workspace, IdleSince: state.IdleSince, Utilization: peak, Action: policy.Action, Taken: true})
+	}
+	decision.Taken = state.Taken
+
+	return decision, r.saveState(workspace.ID, state, policy)
+}
+
+func (r *Reclaimer) act(ctx context.Context, workspace Workspace, policy Policy) error {
+	if r.controller == nil {
+		return fmt.Errorf("no controller configured for the %s action", policy.Action)
+	}
+
+	gpuLogger.Printf("Reclaiming idle GPUs of workspace %s: %s", workspace.ID, policy.Action)
+	switch policy.Action {
+	case ActionStop:
+		return r.controller.Stop(ctx, workspace.ID)
+	case ActionDowngrade:
+		return r.controller.Downgrade(ctx, workspace.ID, policy.DowngradeTo)
+	}
+	return nil
+}
+
+func (r *Reclaimer) notify(ctx context.Context, notice Notice) {
+	if r.notifier == nil {
+		return
+	}
+	if err := r.notifier.Notify(ctx, notice); err != nil {
+		gpuLogger.Printf("Error notifying owner of workspace %s: %v", notice.Workspace.ID, err)
+	}
+}
+
+func (r *Reclaimer) loadState(workspaceID string) (idleState, error) {
+	raw, err := r.state.GetJSON(stateKey(workspaceID))
+	if err != nil {
+		return idleState{}, fmt.Errorf("error loading GPU idle state for %s: %v", workspaceID, err)
+	}
+
+	state := idleState{}
+	for field, target := range map[string]*time.Time{
+		"idle_since":  &state.IdleSince,
+		"notified_at": &state.NotifiedAt,
+		"action_at":   &state.ActionAt,
+		"last_sample": &state.LastSample,
+	} {
+		if value, ok := raw[field].(string); ok && value != "" {
+			parsed, err := time.Parse(time.RFC3339Nano, value)
+			if err != nil {
+				return idleState{}, fmt.Errorf("invalid GPU idle state for %s: %v", workspaceID, err)
+			}
+			*target = parsed
+		}
+	}
+	state.Taken, _ = raw["taken"].(bool)
+	return state, nil
+}
+
+func (r *Reclaimer) saveState(workspaceID string, state idleState, policy Policy) error {
+	value := map[string]interface{}{"taken": state.Taken}
+	for field, t := range map[string]time.Time{
+		"idle_since":  state.IdleSince,
+		"notified_at": state.NotifiedAt,
+		"action_at":   state.ActionAt,
+		"last_sample": state.LastSample,
+	} {
+		if !t.IsZero() {
+			value[field] = t.Format(time.RFC3339Nano)
+		}
+	}
+
+	// State outlives the window and grace period, after which a silent
+	// workspace starts over.
+	ttl := time.Duration(policy.Window+policy.GracePeriod) * 2
+	if _, err := r.state.SetJSON(stateKey(workspaceID), value, int(ttl.Seconds())); err != nil {
+		return fmt.Errorf("error saving GPU idle state for %s: %v", workspaceID, err)
+	}
+	return nil
+}
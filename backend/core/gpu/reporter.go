@@ -0,0 +1,85 @@
+package gpu
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// SampleReport is the body of POST /api/gpu/samples/.
+type SampleReport struct {
+	WorkspaceID string   `json:"workspace_id"`
+	Samples     []Sample `json:"samples"`
+}
+
+// Reporter runs inside a GPU workspace and periodically sends samples to the
+// server, which owns the idle policy.
+type Reporter struct {
+	Sampler     Sampler
+	Endpoint    string
+	APIKey      string
+	WorkspaceID string
+	Interval    time.Duration
+	Client      *http.Client
+}
+
+func (r *Reporter) Run(ctx context.Context) error {
+	interval := r.Interval
+	if interval <= 0 {
+		interval = time.Minute
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if err := r.reportOnce(ctx); err != nil {
+			gpuLogger.Printf("Error reporting GPU samples: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+func (r *Reporter) reportOnce(ctx context.Context) error {
+	samples, err := r.Sampler.Sample(ctx)
+	if err != nil {
+		return err
+	}
+
+	body, err := json.Marshal(SampleReport{WorkspaceID: r.WorkspaceID, Samples: samples})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, r.Endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if r.APIKey != "" {
+		req.Header.Set("X-API-Key", r.APIKey)
+	}
+
+	client := r.Client
+	if client == nil {
+		client = &http.Client{Timeout: 30 * time.Second}
+	}
+	res, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode >= 300 {
+		return fmt.Errorf("server returned %s", res.Status)
+	}
+	return nil
+}
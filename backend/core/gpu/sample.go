@@ -0,0 +1,89 @@
+package gpu
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Sample is one utilization reading of one GPU.
+type Sample struct {
+	Index          int       `json:"index"`
+	UUID           string    `json:"uuid"`
+	Utilization    float64   `json:"utilization"`
+	MemoryUsedMiB  float64   `json:"memory_used_mib"`
+	MemoryTotalMiB float64   `json:"memory_total_mib"`
+	At             time.Time `json:"at"`
+}
+
+type Sampler interface {
+	Sample(ctx context.Context) ([]Sample, error)
+}
+
+// NVMLSampler reads GPU utilization from NVML through nvidia-smi, which ships
+// with the driver and avoids linking against libnvidia-ml with cgo.
+type NVMLSampler struct {
+	// Binary defaults to nvidia-smi on PATH.
+	Binary string
+}
+
+const nvidiaSMIQuery = "index,uuid,utilization.gpu,memory.used,memory.total"
+
+func (s *NVMLSampler) Sample(ctx context.Context) ([]Sample, error) {
+	binary := s.Binary
+	if binary == "" {
+		binary = "nvidia-smi"
+	}
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, binary, "--query-gpu="+nvidiaSMIQuery, "--format=csv,noheader,nounits")
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("error querying nvidia-smi: %v: %s", err, strings.TrimSpace(stderr.String()))
+	}
+
+	return ParseNVIDIASMI(stdout.Bytes(), time.Now())
+}
+
+// ParseNVIDIASMI parses `nvidia-smi --format=csv,noheader,nounits` output
+// for the nvidiaSMIQuery fields.
+func ParseNVIDIASMI(output []byte, at time.Time) ([]Sample, error) {
+	var samples []Sample
+
+	scanner := bufio.NewScanner(bytes.NewReader(output))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+
+		fields := strings.Split(line, ",")
+		if len(fields) != 5 {
+			return nil, fmt.Errorf("unexpected nvidia-smi line %q", line)
+		}
+		for i := range fields {
+			fields[i] = strings.TrimSpace(fields[i])
+		}
+
+		index, err := strconv.Atoi(fields[0])
+		if err != nil {
+			return nil, fmt.Errorf("invalid GPU index %q", fields[0])
+		}
+		sample := Sample{Index: index, UUID: fields[1], At: at}
+		for i, target := range []*float64{&sample.Utilization, &sample.MemoryUsedMiB, &sample.MemoryTotalMiB} {
+			// Unsupported fields are reported as "[N/A]"; leave them at zero.
+			if value, err := strconv.ParseFloat(fields[i+2], 64); err == nil {
+				*target = value
+			}
+		}
+		samples = append(samples, sample)
+	}
+
+	return samples, scanner.Err()
+}
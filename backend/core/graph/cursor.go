@@ -0,0 +1,68 @@
+package graph
+
+import (
+	"encoding/base64"
+	"fmt"
+	"strings"
+	"time"
+)
+
+const (
+	DefaultPageSize = 20
+	MaxPageSize     = 100
+)
+
+// Cursor is the position of a row in a list ordered by time and ID, newest
+// first. Clients treat it as opaque.
+type Cursor struct {
+	Time time.Time
+	ID   string
+}
+
+func (c Cursor) String() string {
+	return base64.RawURLEncoding.EncodeToString([]byte(c.Time.UTC().Format(time.RFC3339Nano) + "|" + c.ID))
+}
+
+func ParseCursor(value string) (*Cursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, fmt.Errorf("invalid cursor %q", value)
+	}
+	timestamp, id, ok := strings.Cut(string(raw), "|")
+	if !ok || id == "" {
+		return nil, fmt.Errorf("invalid cursor %q", value)
+	}
+	t, err := time.Parse(time.RFC3339Nano, timestamp)
+	if err != nil {
+		return nil, fmt.Errorf("invalid cursor %q", value)
+	}
+	return &Cursor{Time: t, ID: id}, nil
+}
+
+// newPage validates the pagination arguments of a list field.
+func newPage(first *int, after *string) (Page, error) {
+	page := Page{Limit: DefaultPageSize}
+	if first != nil {
+		if *first < 1 || *first > MaxPageSize {
+			return page, fmt.Errorf("first must be between 1 and %d", MaxPageSize)
+		}
+		page.Limit = *first
+	}
+	if after != nil && *after != "" {
+		cursor, err := ParseCursor(*after)
+		if err != nil {
+			return page, err
+		}
+		page.After = cursor
+	}
+	return page, nil
+}
+
+// paginate trims the extra row a store returned beyond the page and reports
+// whether it was there, that is whether another page follows.
+func paginate[T any](rows []T, page Page) ([]T, bool) {
+	if len(rows) > page.Limit {
+		return rows[:page.Limit], true
+	}
+	return rows, false
+}
@@ -0,0 +1,248 @@
+package graph
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/spectrumwebco/agent_runtime/backend/core/graph/model"
+	"github.com/spectrumwebco/agent_runtime/backend/core/rbac"
+	"github.com/spectrumwebco/agent_runtime/backend/core/tenancy"
+)
+
+// memoryStore implements Store over fixed rows of one organization.
+type memoryStore struct {
+	workspaces   []*model.Workspace
+	events       map[string][]*model.WorkspaceEvent
+	trajectories []*model.Trajectory
+	costs        map[string]float64
+}
+
+func newMemoryStore() *memoryStore {
+	owner := "user-1"
+	base := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	store := &memoryStore{events: map[string][]*model.WorkspaceEvent{}, costs: map[string]float64{"": 12.5, "ws-1": 2.5}}
+	for i := 1; i <= 3; i++ {
+		id := fmt.Sprintf("ws-%d", i)
+		store.workspaces = append(store.workspaces, &model.Workspace{
+			ID:             id,
+			Name:           "workspace " + id,
+			OrganizationID: "org-1",
+			CreatedByID:    &owner,
+			CreatedAt:      base.Add(time.Duration(i) * time.Hour),
+		})
+		store.events[id] = []*model.WorkspaceEvent{
+			{ID: id + "-e1", Type: "workspace.created", OccurredAt: base.Add(time.Duration(i) * time.Hour)},
+			{ID: id + "-e2", Type: "workspace.started", OccurredAt: base.Add(time.Duration(i)*time.Hour + time.Minute)},
+		}
+	}
+	store.trajectories = []*model.Trajectory{{ID: "tr-1", WorkspaceID: "ws-1", Status: "succeeded", Steps: 4, CreatedAt: base}}
+	return store
+}
+
+func newest[T any](rows []T, at func(T) (time.Time, string), page Page) []T {
+	sorted := append([]T(nil), rows...)
+	sort.Slice(sorted, func(i, j int) bool {
+		ti, idi := at(sorted[i])
+		tj, idj := at(sorted[j])
+		return ti.After(tj) || ti.Equal(tj) && idi > idj
+	})
+	var result []T
+	for _, row := range sorted {
+		t, id := at(row)
+		if page.After != nil && !(t.Before(page.After.Time) || t.Equal(page.After.Time) && id < page.After.ID) {
+			continue
+		}
+		if len(result) == page.Limit+1 {
+			break
+		}
+		result = append(result, row)
+	}
+	return result
+}
+
+func (s *memoryStore) Workspace(ctx context.Context, tenant tenancy.Tenant, id string) (*model.Workspace, error) {
+	for _, workspace := range s.workspaces {
+		if workspace.ID == id && workspace.OrganizationID == tenant.OrganizationID {
+			return workspace, nil
+		}
+	}
+	return nil, nil
+}
+
+func (s *memoryStore) Workspaces(ctx context.Context, tenant tenancy.Tenant, page Page) ([]*model.Workspace, error) {
+	return newest(s.workspaces, func(w *model.Workspace) (time.Time, string) { return w.CreatedAt, w.ID }, page), nil
+}
+
+func (s *memoryStore) WorkspaceEvents(ctx context.Context, tenant tenancy.Tenant, workspaceID string, types []string, page Page) ([]*model.WorkspaceEvent, error) {
+	return newest(s.events[workspaceID], func(e *model.WorkspaceEvent) (time.Time, string) { return e.OccurredAt, e.ID }, page), nil
+}
+
+func (s *memoryStore) Trajectory(ctx context.Context, tenant tenancy.Tenant, id string) (*model.Trajectory, error) {
+	for _, trajectory := range s.trajectories {
+		if trajectory.ID == id {
+			return trajectory, nil
+		}
+	}
+	return nil, nil
+}
+
+func (s *memoryStore) Trajectories(ctx context.Context, tenant tenancy.Tenant, workspaceID string, page Page) ([]*model.Trajectory, error) {
+	var rows []*model.Trajectory
+	for _, trajectory := range s.trajectories {
+		if trajectory.WorkspaceID == workspaceID {
+			rows = append(rows, trajectory)
+		}
+	}
+	return newest(rows, func(t *model.Trajectory) (time.Time, string) { return t.CreatedAt, t.ID }, page), nil
+}
+
+func (s *memoryStore) Cost(ctx context.Context, tenant tenancy.Tenant, workspaceID string, from, to time.Time) (*model.Cost, error) {
+	total := s.costs[workspaceID]
+	return &model.Cost{Currency: "USD", Total: total, From: from, To: to, Items: []*model.CostItem{{ResourceType: "tokens", Quantity: 1000, Amount: total}}}, nil
+}
+
+type response struct {
+	Data   map[string]interface{} `json:"data"`
+	Errors []struct {
+		Message string        `json:"message"`
+		Path    []interface{} `json:"path"`
+	} `json:"errors"`
+}
+
+func query(t *testing.T, roles []rbac.Role, document string, variables map[string]interface{}) response {
+	t.Helper()
+	handler := NewHandler(newMemoryStore(), rbac.NewEngine())
+
+	body, _ := json.Marshal(map[string]interface{}{"query": document, "variables": variables})
+	req := httptest.NewRequest(http.MethodPost, "/api/graphql/", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	ctx := rbac.WithSubject(req.Context(), rbac.Subject{ID: "user-1", OrganizationID: "org-1", Roles: roles})
+	tenant, err := tenancy.New("org-1", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	req = req.WithContext(tenancy.WithTenant(ctx, tenant))
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("unexpected status %d: %s", w.Code, w.Body.String())
+	}
+	var result response
+	if err := json.Unmarshal(w.Body.Bytes(), &result); err != nil {
+		t.Fatal(err)
+	}
+	return result
+}
+
+const workspacesQuery = `query($after: String) {
+	workspaces(first: 2, after: $after) {
+		edges { cursor node { id events(first: 1) { edges { node { type } } pageInfo { hasNextPage } } } }
+		pageInfo { hasNextPage endCursor }
+	}
+}`
+
+func TestWorkspacesPagination(t *testing.T) {
+	result := query(t, []rbac.Role{rbac.RoleViewer}, workspacesQuery, nil)
+	if len(result.Errors) > 0 {
+		t.Fatalf("unexpected errors %v", result.Errors)
+	}
+
+	connection := result.Data["workspaces"].(map[string]interface{})
+	edges := connection["edges"].([]interface{})
+	if len(edges) != 2 {
+		t.Fatalf("expected 2 workspaces, got %d", len(edges))
+	}
+	first := edges[0].(map[string]interface{})["node"].(map[string]interface{})
+	if first["id"] != "ws-3" {
+		t.Fatalf("expected the newest workspace first, got %v", first["id"])
+	}
+	events := first["events"].(map[string]interface{})
+	if event := events["edges"].([]interface{})[0].(map[string]interface{})["node"].(map[string]interface{}); event["type"] != "workspace.started" {
+		t.Fatalf("expected the newest event first, got %v", event)
+	}
+	if !events["pageInfo"].(map[string]interface{})["hasNextPage"].(bool) {
+		t.Fatal("expected more events")
+	}
+
+	pageInfo := connection["pageInfo"].(map[string]interface{})
+	if !pageInfo["hasNextPage"].(bool) {
+		t.Fatal("expected another page")
+	}
+
+	result = query(t, []rbac.Role{rbac.RoleViewer}, workspacesQuery, map[string]interface{}{"after": pageInfo["endCursor"]})
+	connection = result.Data["workspaces"].(map[string]interface{})
+	edges = connection["edges"].([]interface{})
+	if len(edges) != 1 || edges[0].(map[string]interface{})["node"].(map[string]interface{})["id"] != "ws-1" {
+		t.Fatalf("unexpected second page %v", edges)
+	}
+	if connection["pageInfo"].(map[string]interface{})["hasNextPage"].(bool) {
+		t.Fatal("expected the last page")
+	}
+
+	result = query(t, []rbac.Role{rbac.RoleViewer}, workspacesQuery, map[string]interface{}{"after": "not a cursor"})
+	if len(result.Errors) == 0 {
+		t.Fatal("expected an error for an invalid cursor")
+	}
+}
+
+func TestFieldAuthorization(t *testing.T) {
+	const document = `{
+		workspace(id: "ws-1") {
+			name
+			trajectories { edges { node { id steps workspace { id } } } }
+			cost { total currency }
+		}
+		costs { total }
+	}`
+
+	// viewers read trajectories, but not costs
+	result := query(t, []rbac.Role{rbac.RoleViewer}, document, nil)
+	workspace := result.Data["workspace"].(map[string]interface{})
+	if workspace["name"] != "workspace ws-1" {
+		t.Fatalf("unexpected workspace %v", workspace)
+	}
+	trajectory := workspace["trajectories"].(map[string]interface{})["edges"].([]interface{})[0].(map[string]interface{})["node"].(map[string]interface{})
+	if trajectory["id"] != "tr-1" || trajectory["workspace"].(map[string]interface{})["id"] != "ws-1" {
+		t.Fatalf("unexpected trajectory %v", trajectory)
+	}
+	if workspace["cost"] != nil || result.Data["costs"] != nil {
+		t.Fatalf("expected costs to be hidden, got %v and %v", workspace["cost"], result.Data["costs"])
+	}
+	if len(result.Errors) != 2 {
+		t.Fatalf("expected an error per hidden field, got %v", result.Errors)
+	}
+
+	result = query(t, []rbac.Role{rbac.RoleAdmin}, document, nil)
+	if len(result.Errors) > 0 {
+		t.Fatalf("unexpected errors %v", result.Errors)
+	}
+	if total := result.Data["workspace"].(map[string]interface{})["cost"].(map[string]interface{})["total"]; total != 2.5 {
+		t.Fatalf("unexpected workspace cost %v", total)
+	}
+	if total := result.Data["costs"].(map[string]interface{})["total"]; total != 12.5 {
+		t.Fatalf("unexpected organization cost %v", total)
+	}
+
+	// without roles nothing is readable
+	result = query(t, nil, document, nil)
+	if result.Data["workspace"] != nil {
+		t.Fatalf("expected no workspace, got %v", result.Data["workspace"])
+	}
+}
+
+func TestComplexityLimit(t *testing.T) {
+	result := query(t, []rbac.Role{rbac.RoleAdmin}, `{
+		workspaces(first: 100) { edges { node { events(first: 100) { edges { node { id type } } } } } }
+	}`, nil)
+	if len(result.Errors) == 0 {
+		t.Fatal("expected the query to be rejected")
+	}
+}
@@ -0,0 +1,135 @@
+// Package graph serves the GraphQL API of workspaces, their events,
+// trajectories and costs, see schema.graphqls.
+//
+// The executable schema in generated.go and the models in model are generated
+// by gqlgen from the schema; the resolvers in schema.resolvers.go are kept
+// when regenerating. Lists are paginated with opaque cursors over (time, id)
+// keysets, and fields are authorized one by one with the @authorize
+// directive, so a caller lacking an action still gets the rest of a query.
+package graph
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/99designs/gqlgen/graphql"
+	"github.com/99designs/gqlgen/graphql/handler"
+	"github.com/99designs/gqlgen/graphql/handler/extension"
+	"github.com/99designs/gqlgen/graphql/handler/transport"
+	"github.com/spectrumwebco/agent_runtime/backend/core/graph/model"
+	"github.com/spectrumwebco/agent_runtime/backend/core/rbac"
+	"github.com/spectrumwebco/agent_runtime/backend/core/tenancy"
+)
+
+//go:generate go run github.com/99designs/gqlgen generate --config ../../gqlgen.yml
+
+// ComplexityLimit bounds the cost of a query, counting one per field and
+// multiplying nested lists by their page size.
+const ComplexityLimit = 5000
+
+// DefaultCostPeriod is the period of cost fields without a from argument.
+const DefaultCostPeriod = 30 * 24 * time.Hour
+
+type Resolver struct {
+	store  Store
+	engine *rbac.Engine
+}
+
+func NewResolver(store Store, engine *rbac.Engine) *Resolver {
+	return &Resolver{store: store, engine: engine}
+}
+
+// NewHandler serves the graph over GET and POST. The context of requests
+// must carry the caller's rbac.Subject and tenancy.Tenant.
+func NewHandler(store Store, engine *rbac.Engine) http.Handler {
+	resolver := NewResolver(store, engine)
+	config := Config{Resolvers: resolver}
+	config.Directives.Authorize = resolver.authorize
+	config.Complexity.Workspace.Events = func(childComplexity int, first *int, after *string, types []string) int {
+		return listComplexity(childComplexity, first)
+	}
+	config.Complexity.Workspace.Trajectories = func(childComplexity int, first *int, after *string) int {
+		return listComplexity(childComplexity, first)
+	}
+	config.Complexity.Query.Workspaces = func(childComplexity int, first *int, after *string) int {
+		return listComplexity(childComplexity, first)
+	}
+
+	server := handler.New(NewExecutableSchema(config))
+	server.AddTransport(transport.GET{})
+	server.AddTransport(transport.POST{})
+	server.Use(extension.Introspection{})
+	server.Use(extension.FixedComplexityLimit(ComplexityLimit))
+	return server
+}
+
+func listComplexity(childComplexity int, first *int) int {
+	size := DefaultPageSize
+	if first != nil && *first > 0 {
+		size = *first
+	}
+	return 1 + size*childComplexity
+}
+
+// authorize implements @authorize. Fields of a workspace are authorized on
+// that workspace, other fields on their type of resource, named by the
+// action, in the caller's organization.
+func (r *Resolver) authorize(ctx context.Context, obj interface{}, next graphql.Resolver, action string) (interface{}, error) {
+	subject, _ := rbac.SubjectFromContext(ctx)
+
+	resourceType, _, _ := strings.Cut(action, ".")
+	resource := rbac.Resource{Type: resourceType, OrganizationID: subject.OrganizationID}
+	if workspace, ok := obj.(*model.Workspace); ok {
+		resource = workspaceResource(workspace)
+	} else if field := graphql.GetFieldContext(ctx); field != nil {
+		if id, ok := field.Args["id"].(string); ok {
+			resource.ID = id
+		}
+	}
+
+	decision := r.engine.Authorize(subject, rbac.Action(action), resource)
+	if !decision.Allowed {
+		return nil, fmt.Errorf("not authorized to %s: %s", action, decision.Reason)
+	}
+	return next(ctx)
+}
+
+func workspaceResource(workspace *model.Workspace) rbac.Resource {
+	resource := rbac.Resource{Type: "workspace", ID: workspace.ID, OrganizationID: workspace.OrganizationID}
+	if workspace.CreatedByID != nil {
+		resource.OwnerID = *workspace.CreatedByID
+	}
+	return resource
+}
+
+// period resolves the optional bounds of a cost field.
+func period(from, to *time.Time) (time.Time, time.Time, error) {
+	end := time.Now().UTC()
+	if to != nil {
+		end = *to
+	}
+	start := end.Add(-DefaultCostPeriod)
+	if from != nil {
+		start = *from
+	}
+	if !start.Before(end) {
+		return start, end, fmt.Errorf("from must be before to")
+	}
+	return start, end, nil
+}
+
+func pageInfo(hasNextPage bool, endCursor string) *model.PageInfo {
+	info := &model.PageInfo{HasNextPage: hasNextPage}
+	if endCursor != "" {
+		info.EndCursor = &endCursor
+	}
+	return info
+}
+
+// tenant returns the caller's tenant. Stores are always scoped to it.
+func tenant(ctx context.Context) (tenancy.Tenant, error) {
+	return tenancy.Require(ctx)
+}
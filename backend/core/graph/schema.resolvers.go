@@ -0,0 +1,169 @@
+package graph
+
+// This file will be automatically regenerated based on the schema, any resolver implementations
+// will be copied through when generating and any unknown code will be moved to the end.
+// Code generated by github.com/99designs/gqlgen version v0.17.55
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/spectrumwebco/agent_runtime/backend/core/graph/model"
+	"github.com/spectrumwebco/agent_runtime/backend/core/rbac"
+)
+
+// Workspace is the resolver for the workspace field.
+func (r *queryResolver) Workspace(ctx context.Context, id string) (*model.Workspace, error) {
+	tenant, err := tenant(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return r.store.Workspace(ctx, tenant, id)
+}
+
+// Workspaces is the resolver for the workspaces field.
+func (r *queryResolver) Workspaces(ctx context.Context, first *int, after *string) (*model.WorkspaceConnection, error) {
+	page, err := newPage(first, after)
+	if err != nil {
+		return nil, err
+	}
+	tenant, err := tenant(ctx)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := r.store.Workspaces(ctx, tenant, page)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, hasNextPage := paginate(rows, page)
+	connection := &model.WorkspaceConnection{Edges: make([]*model.WorkspaceEdge, 0, len(rows))}
+	endCursor := ""
+	for _, workspace := range rows {
+		endCursor = Cursor{Time: workspace.CreatedAt, ID: workspace.ID}.String()
+		connection.Edges = append(connection.Edges, &model.WorkspaceEdge{Cursor: endCursor, Node: workspace})
+	}
+	connection.PageInfo = pageInfo(hasNextPage, endCursor)
+	return connection, nil
+}
+
+// Trajectory is the resolver for the trajectory field.
+func (r *queryResolver) Trajectory(ctx context.Context, id string) (*model.Trajectory, error) {
+	tenant, err := tenant(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return r.store.Trajectory(ctx, tenant, id)
+}
+
+// Costs is the resolver for the costs field.
+func (r *queryResolver) Costs(ctx context.Context, from *time.Time, to *time.Time) (*model.Cost, error) {
+	start, end, err := period(from, to)
+	if err != nil {
+		return nil, err
+	}
+	tenant, err := tenant(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return r.store.Cost(ctx, tenant, "", start, end)
+}
+
+// Workspace is the resolver for the workspace field.
+func (r *trajectoryResolver) Workspace(ctx context.Context, obj *model.Trajectory) (*model.Workspace, error) {
+	tenant, err := tenant(ctx)
+	if err != nil {
+		return nil, err
+	}
+	workspace, err := r.store.Workspace(ctx, tenant, obj.WorkspaceID)
+	if err != nil || workspace == nil {
+		return nil, err
+	}
+
+	// reading a trajectory does not imply reading its workspace
+	subject, _ := rbac.SubjectFromContext(ctx)
+	decision := r.engine.Authorize(subject, rbac.ActionWorkspaceGet, workspaceResource(workspace))
+	if !decision.Allowed {
+		return nil, fmt.Errorf("not authorized to %s: %s", rbac.ActionWorkspaceGet, decision.Reason)
+	}
+	return workspace, nil
+}
+
+// Events is the resolver for the events field.
+func (r *workspaceResolver) Events(ctx context.Context, obj *model.Workspace, first *int, after *string, types []string) (*model.WorkspaceEventConnection, error) {
+	page, err := newPage(first, after)
+	if err != nil {
+		return nil, err
+	}
+	tenant, err := tenant(ctx)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := r.store.WorkspaceEvents(ctx, tenant, obj.ID, types, page)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, hasNextPage := paginate(rows, page)
+	connection := &model.WorkspaceEventConnection{Edges: make([]*model.WorkspaceEventEdge, 0, len(rows))}
+	endCursor := ""
+	for _, event := range rows {
+		endCursor = Cursor{Time: event.OccurredAt, ID: event.ID}.String()
+		connection.Edges = append(connection.Edges, &model.WorkspaceEventEdge{Cursor: endCursor, Node: event})
+	}
+	connection.PageInfo = pageInfo(hasNextPage, endCursor)
+	return connection, nil
+}
+
+// Trajectories is the resolver for the trajectories field.
+func (r *workspaceResolver) Trajectories(ctx context.Context, obj *model.Workspace, first *int, after *string) (*model.TrajectoryConnection, error) {
+	page, err := newPage(first, after)
+	if err != nil {
+		return nil, err
+	}
+	tenant, err := tenant(ctx)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := r.store.Trajectories(ctx, tenant, obj.ID, page)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, hasNextPage := paginate(rows, page)
+	connection := &model.TrajectoryConnection{Edges: make([]*model.TrajectoryEdge, 0, len(rows))}
+	endCursor := ""
+	for _, trajectory := range rows {
+		endCursor = Cursor{Time: trajectory.CreatedAt, ID: trajectory.ID}.String()
+		connection.Edges = append(connection.Edges, &model.TrajectoryEdge{Cursor: endCursor, Node: trajectory})
+	}
+	connection.PageInfo = pageInfo(hasNextPage, endCursor)
+	return connection, nil
+}
+
+// Cost is the resolver for the cost field.
+func (r *workspaceResolver) Cost(ctx context.Context, obj *model.Workspace, from *time.Time, to *time.Time) (*model.Cost, error) {
+	start, end, err := period(from, to)
+	if err != nil {
+		return nil, err
+	}
+	tenant, err := tenant(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return r.store.Cost(ctx, tenant, obj.ID, start, end)
+}
+
+// Query returns QueryResolver implementation.
+func (r *Resolver) Query() QueryResolver { return &queryResolver{r} }
+
+// Trajectory returns TrajectoryResolver implementation.
+func (r *Resolver) Trajectory() TrajectoryResolver { return &trajectoryResolver{r} }
+
+// Workspace returns WorkspaceResolver implementation.
+func (r *Resolver) Workspace() WorkspaceResolver { return &workspaceResolver{r} }
+
+type queryResolver struct{ *Resolver }
+type trajectoryResolver struct{ *Resolver }
+type workspaceResolver struct{ *Resolver }
@@ -0,0 +1,307 @@
+package graph
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/spectrumwebco/agent_runtime/backend/core/graph/model"
+	"github.com/spectrumwebco/agent_runtime/backend/core/tenancy"
+	"github.com/spectrumwebco/agent_runtime/backend/db/integrations"
+)
+
+// Page selects the rows of a page, newest first. Stores return up to
+// Limit+1 rows so that the resolvers can tell whether another page follows.
+type Page struct {
+	Limit int
+	// After is the cursor of the last row of the previous page, nil for the
+	// first page.
+	After *Cursor
+}
+
+// Store loads the data of the graph. Every method is scoped to the tenant;
+// rows of other organizations are never returned.
+type Store interface {
+	// Workspace returns nil if the workspace doesn't exist.
+	Workspace(ctx context.Context, tenant tenancy.Tenant, id string) (*model.Workspace, error)
+	Workspaces(ctx context.Context, tenant tenancy.Tenant, page Page) ([]*model.Workspace, error)
+	WorkspaceEvents(ctx context.Context, tenant tenancy.Tenant, workspaceID string, types []string, page Page) ([]*model.WorkspaceEvent, error)
+	// Trajectory returns nil if the trajectory doesn't exist.
+	Trajectory(ctx context.Context, tenant tenancy.Tenant, id string) (*model.Trajectory, error)
+	Trajectories(ctx context.Context, tenant tenancy.Tenant, workspaceID string, page Page) ([]*model.Trajectory, error)
+	// Cost sums the usage of the tenant's organization, or only of the
+	// workspace if workspaceID is set, that started in [from, to).
+	Cost(ctx context.Context, tenant tenancy.Tenant, workspaceID string, from, to time.Time) (*model.Cost, error)
+}
+
+// SQLStore reads workspaces and billed usage from Postgres, and workspace
+// events and trajectories from the tenant's Doris database:
+//
+//	{schema}.workspace_events  id, workspace_id, type, occurred_at, correlation_id,
+//	                           actor_id, error, attributes (JSON)
+//	{schema}.trajectories      id, workspace_id, task_id, status, steps,
+//	                           total_tokens, created_at, finished_at
+type SQLStore struct {
+	postgres integrations.SQLStore
+	doris    integrations.SQLStore
+}
+
+func NewSQLStore(postgres, doris integrations.SQLStore) *SQLStore {
+	return &SQLStore{postgres: postgres, doris: doris}
+}
+
+const workspaceColumns = `id, name, slug, description, organization_id, project_id, created_by_id, created_at, updated_at`
+
+func (s *SQLStore) Workspace(ctx context.Context, tenant tenancy.Tenant, id string) (*model.Workspace, error) {
+	rows, err := s.postgres.ExecuteQuery(
+		`SELECT `+workspaceColumns+` FROM app_workspace WHERE id = $1 AND organization_id = $2`, id, tenant.OrganizationID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("error loading workspace %s: %v", id, err)
+	}
+	if len(rows) == 0 {
+		return nil, nil
+	}
+	return workspaceFromRow(rows[0]), nil
+}
+
+func (s *SQLStore) Workspaces(ctx context.Context, tenant tenancy.Tenant, page Page) ([]*model.Workspace, error) {
+	query := `SELECT ` + workspaceColumns + ` FROM app_workspace WHERE organization_id = $1`
+	params := []interface{}{tenant.OrganizationID}
+	if page.After != nil {
+		query += ` AND (created_at < $2 OR (created_at = $2 AND id < $3))`
+		params = append(params, page.After.Time, page.After.ID)
+	}
+	query += fmt.Sprintf(` ORDER BY created_at DESC, id DESC LIMIT %d`, page.Limit+1)
+
+	rows, err := s.postgres.ExecuteQuery(query, params...)
+	if err != nil {
+		return nil, fmt.Errorf("error listing workspaces: %v", err)
+	}
+	workspaces := make([]*model.Workspace, 0, len(rows))
+	for _, row := range rows {
+		workspaces = append(workspaces, workspaceFromRow(row))
+	}
+	return workspaces, nil
+}
+
+func (s *SQLStore) WorkspaceEvents(ctx context.Context, tenant tenancy.Tenant, workspaceID string, types []string, page Page) ([]*model.WorkspaceEvent, error) {
+	query := `SELECT id, type, occurred_at, correlation_id, actor_id, error, attributes FROM {schema}.workspace_events WHERE workspace_id = ?`
+	params := []interface{}{workspaceID}
+	if len(types) > 0 {
+		query += ` AND type IN (?` + strings.Repeat(`, ?`, len(types)-1) + `)`
+		for _, eventType := range types {
+			params = append(params, eventType)
+		}
+	}
+	query, params = after(query, params, "occurred_at", page)
+
+	rows, err := tenancy.NewDorisStore(tenant, s.doris).ExecuteQuery(query, params...)
+	if err != nil {
+		return nil, fmt.Errorf("error listing events of workspace %s: %v", workspaceID, err)
+	}
+	events := make([]*model.WorkspaceEvent, 0, len(rows))
+	for _, row := range rows {
+		event := &model.WorkspaceEvent{
+			ID:            toString(row["id"]),
+			Type:          toString(row["type"]),
+			OccurredAt:    toTime(row["occurred_at"]),
+			CorrelationID: toString(row["correlation_id"]),
+			ActorID:       toOptionalString(row["actor_id"]),
+			Error:         toOptionalString(row["error"]),
+		}
+		if err := decodeJSONColumn(row["attributes"], &event.Attributes); err != nil {
+			return nil, fmt.Errorf("error decoding attributes of event %s: %v", event.ID, err)
+		}
+		events = append(events, event)
+	}
+	return events, nil
+}
+
+const trajectoryColumns = `id, workspace_id, task_id, status, steps, total_tokens, created_at, finished_at`
+
+func (s *SQLStore) Trajectory(ctx context.Context, tenant tenancy.Tenant, id string) (*model.Trajectory, error) {
+	rows, err := tenancy.NewDorisStore(tenant, s.doris).ExecuteQuery(
+		`SELECT `+trajectoryColumns+` FROM {schema}.trajectories WHERE id = ?`, id,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("error loading trajectory %s: %v", id, err)
+	}
+	if len(rows) == 0 {
+		return nil, nil
+	}
+	return trajectoryFromRow(rows[0]), nil
+}
+
+func (s *SQLStore) Trajectories(ctx context.Context, tenant tenancy.Tenant, workspaceID string, page Page) ([]*model.Trajectory, error) {
+	query, params := after(`SELECT `+trajectoryColumns+` FROM {schema}.trajectories WHERE workspace_id = ?`, []interface{}{workspaceID}, "created_at", page)
+
+	rows, err := tenancy.NewDorisStore(tenant, s.doris).ExecuteQuery(query, params...)
+	if err != nil {
+		return nil, fmt.Errorf("error listing trajectories of workspace %s: %v", workspaceID, err)
+	}
+	trajectories := make([]*model.Trajectory, 0, len(rows))
+	for _, row := range rows {
+		trajectories = append(trajectories, trajectoryFromRow(row))
+	}
+	return trajectories, nil
+}
+
+func (s *SQLStore) Cost(ctx context.Context, tenant tenancy.Tenant, workspaceID string, from, to time.Time) (*model.Cost, error) {
+	query := `
+		SELECT resource_type, currency, SUM(quantity) AS quantity, SUM(quantity * unit_price) AS amount
+		FROM app_usage
+		WHERE organization_id = $1 AND start_date >= $2 AND start_date < $3`
+	params := []interface{}{tenant.OrganizationID, from.UTC(), to.UTC()}
+	if workspaceID != "" {
+		query += ` AND metadata->>'workspace_id' = $4`
+		params = append(params, workspaceID)
+	}
+	query += ` GROUP BY resource_type, currency ORDER BY resource_type`
+
+	rows, err := s.postgres.ExecuteQuery(query, params...)
+	if err != nil {
+		return nil, fmt.Errorf("error loading usage: %v", err)
+	}
+
+	cost := &model.Cost{Currency: "USD", From: from, To: to, Items: []*model.CostItem{}}
+	for i, row := range rows {
+		currency := toString(row["currency"])
+		if i == 0 {
+			cost.Currency = currency
+		} else if currency != cost.Currency {
+			return nil, fmt.Errorf("usage is billed in both %s and %s", cost.Currency, currency)
+		}
+
+		item := &model.CostItem{
+			ResourceType: toString(row["resource_type"]),
+			Quantity:     toFloat64(row["quantity"]),
+			Amount:       toFloat64(row["amount"]),
+		}
+		cost.Total += item.Amount
+		cost.Items = append(cost.Items, item)
+	}
+	return cost, nil
+}
+
+// after appends the keyset condition of the page, ordered by column and id,
+// to a Doris query.
+func after(query string, params []interface{}, column string, page Page) (string, []interface{}) {
+	if page.After != nil {
+		query += fmt.Sprintf(` AND (%[1]s < ? OR (%[1]s = ? AND id < ?))`, column)
+		params = append(params, page.After.Time, page.After.Time, page.After.ID)
+	}
+	return query + fmt.Sprintf(` ORDER BY %s DESC, id DESC LIMIT %d`, column, page.Limit+1), params
+}
+
+func workspaceFromRow(row map[string]interface{}) *model.Workspace {
+	return &model.Workspace{
+		ID:             toString(row["id"]),
+		Name:           toString(row["name"]),
+		Slug:           toString(row["slug"]),
+		Description:    toString(row["description"]),
+		OrganizationID: toString(row["organization_id"]),
+		ProjectID:      toOptionalString(row["project_id"]),
+		CreatedByID:    toOptionalString(row["created_by_id"]),
+		CreatedAt:      toTime(row["created_at"]),
+		UpdatedAt:      toTime(row["updated_at"]),
+	}
+}
+
+func trajectoryFromRow(row map[string]interface{}) *model.Trajectory {
+	trajectory := &model.Trajectory{
+		ID:          toString(row["id"]),
+		WorkspaceID: toString(row["workspace_id"]),
+		TaskID:      toOptionalString(row["task_id"]),
+		Status:      toString(row["status"]),
+		Steps:       int(toFloat64(row["steps"])),
+		TotalTokens: int(toFloat64(row["total_tokens"])),
+		CreatedAt:   toTime(row["created_at"]),
+	}
+	if finishedAt, ok := row["finished_at"].(time.Time); ok {
+		trajectory.FinishedAt = &finishedAt
+	}
+	return trajectory
+}
+
+func toString(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case []byte:
+		return string(v)
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+func toOptionalString(value interface{}) *string {
+	if value == nil {
+		return nil
+	}
+	s := toString(value)
+	if s == "" {
+		return nil
+	}
+	return &s
+}
+
+func toTime(value interface{}) time.Time {
+	switch v := value.(type) {
+	case time.Time:
+		return v
+	case []byte:
+		t, _ := time.Parse(time.RFC3339Nano, string(v))
+		return t
+	case string:
+		t, _ := time.Parse(time.RFC3339Nano, v)
+		return t
+	default:
+		return time.Time{}
+	}
+}
+
+func toFloat64(value interface{}) float64 {
+	switch v := value.(type) {
+	case float64:
+		return v
+	case float32:
+		return float64(v)
+	case int64:
+		return float64(v)
+	case int:
+		return float64(v)
+	case int32:
+		return float64(v)
+	case []byte:
+		var n float64
+		fmt.Sscan(string(v), &n)
+		return n
+	case string:
+		var n float64
+		fmt.Sscan(v, &n)
+		return n
+	default:
+		return 0
+	}
+}
+
+func decodeJSONColumn(value interface{}, target interface{}) error {
+	var data []byte
+	switch v := value.(type) {
+	case nil:
+		return nil
+	case []byte:
+		data = v
+	case string:
+		data = []byte(v)
+	default:
+		return fmt.Errorf("unexpected JSON column type %T", value)
+	}
+	if len(data) == 0 {
+		return nil
+	}
+	return json.Unmarshal(data, target)
+}
@@ -0,0 +1,224 @@
+// Package heartbeat tracks the liveness of workspace agents.
+//
+// The agent daemon in every workspace keeps a Beat stream to the backend open
+// and sends a beat every interval. The Tracker records the last beat of each
+// workspace in the KVStore, so beats and sweeps may be handled by any
+// replica. A workspace that misses several beats in a row is marked
+// unreachable and a workspace.unreachable event is emitted; its next beat
+// marks it reachable again and emits workspace.reachable.
+package heartbeat
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/spectrumwebco/agent_runtime/backend/core/events"
+	"github.com/spectrumwebco/agent_runtime/backend/db/integrations"
+)
+
+var heartbeatLogger = log.New(os.Stdout, "kled.heartbeat: ", log.LstdFlags)
+
+// statusKey is the hash holding the Status of every workspace by ID.
+const statusKey = "kled:heartbeat:workspaces"
+
+type State string
+
+const (
+	StateReachable   State = "reachable"
+	StateUnreachable State = "unreachable"
+)
+
+// Status is the liveness of a single workspace agent.
+type Status struct {
+	WorkspaceID   string    `json:"workspace_id"`
+	WorkspaceUID  string    `json:"workspace_uid,omitempty"`
+	State         State     `json:"state"`
+	LastSeen      time.Time `json:"last_seen"`
+	Version       string    `json:"version,omitempty"`
+	Hostname      string    `json:"hostname,omitempty"`
+	UptimeSeconds int64     `json:"uptime_seconds,omitempty"`
+}
+
+// Beat is a single heartbeat of a workspace agent.
+type Beat struct {
+	WorkspaceID   string
+	WorkspaceUID  string
+	Version       string
+	Hostname      string
+	UptimeSeconds int64
+}
+
+type Tracker struct {
+	store       integrations.KVStore
+	interval    time.Duration
+	missedBeats int
+	now         func() time.Time
+}
+
+// NewTracker creates a tracker expecting a beat every interval that marks
+// workspaces unreachable after missedBeats missed beats.
+func NewTracker(store integrations.KVStore, interval time.Duration, missedBeats int) *Tracker {
+	if interval <= 0 {
+		interval = 15 * time.Second
+	}
+	if missedBeats <= 0 {
+		missedBeats = 3
+	}
+
+	return &Tracker{
+		store:       store,
+		interval:    interval,
+		missedBeats: missedBeats,
+		now:         time.Now,
+	}
+}
+
+func (t *Tracker) SetClock(now func() time.Time) {
+	t.now = now
+}
+
+// Interval is the interval agents are expected to send beats at.
+func (t *Tracker) Interval() time.Duration {
+	return t.interval
+}
+
+// Observe records a beat and marks the workspace reachable again if it was
+// unreachable.
+func (t *Tracker) Observe(ctx context.Context, beat Beat) (Status, error) {
+	if beat.WorkspaceID == "" {
+		return Status{}, fmt.Errorf("workspace ID is required")
+	}
+
+	previous, found, err := t.Get(beat.WorkspaceID)
+	if err != nil {
+		return Status{}, err
+	}
+
+	status := Status{
+		WorkspaceID:   beat.WorkspaceID,
+		WorkspaceUID:  beat.WorkspaceUID,
+		State:         StateReachable,
+		LastSeen:      t.now().UTC(),
+		Version:       beat.Version,
+		Hostname:      beat.Hostname,
+		UptimeSeconds: beat.UptimeSeconds,
+	}
+	if err := t.save(status); err != nil {
+		return Status{}, err
+	}
+
+	if found && previous.State == StateUnreachable {
+		heartbeatLogger.Printf("Workspace %s is reachable again", beat.WorkspaceID)
+		event := events.NewWorkspaceEvent(ctx, events.WorkspaceReachable, beat.WorkspaceID)
+		event.Attributes = map[string]string{
+			"previous_state":  string(StateUnreachable),
+			"unreachable_for": status.LastSeen.Sub(previous.LastSeen).Round(time.Second).String(),
+		}
+		events.Emit(ctx, event)
+	}
+	return status, nil
+}
+
+// Sweep marks every workspace that missed too many beats unreachable and
+// returns the workspaces it marked.
+func (t *Tracker) Sweep(ctx context.Context) ([]Status, error) {
+	statuses, err := t.List()
+	if err != nil {
+		return nil, err
+	}
+
+	deadline := t.now().Add(-time.Duration(t.missedBeats) * t.interval)
+	marked := []Status{}
+	for _, status := range statuses {
+		if status.State != StateReachable || !status.LastSeen.Before(deadline) {
+			continue
+		}
+
+		status.State = StateUnreachable
+		if err := t.save(status); err != nil {
+			return marked, err
+		}
+		marked = append(marked, status)
+
+		heartbeatLogger.Printf("Workspace %s is unreachable, last seen at %s", status.WorkspaceID, status.LastSeen.Format(time.RFC3339))
+		event := events.NewWorkspaceEvent(ctx, events.WorkspaceUnreachable, status.WorkspaceID)
+		event.Attributes = map[string]string{
+			"previous_state": string(StateReachable),
+			"last_seen":      status.LastSeen.Format(time.RFC3339),
+		}
+		events.Emit(ctx, event)
+	}
+	return marked, nil
+}
+
+// Run sweeps every interval until ctx is done.
+func (t *Tracker) Run(ctx context.Context) {
+	ticker := time.NewTicker(t.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := t.Sweep(ctx); err != nil {
+				heartbeatLogger.Printf("Error sweeping heartbeats: %v", err)
+			}
+		}
+	}
+}
+
+func (t *Tracker) Get(workspaceID string) (Status, bool, error) {
+	raw, err := t.store.HGet(statusKey, workspaceID)
+	if err != nil {
+		return Status{}, false, fmt.Errorf("error loading heartbeat of workspace %s: %v", workspaceID, err)
+	}
+	if raw == "" {
+		return Status{}, false, nil
+	}
+
+	status := Status{}
+	if err := json.Unmarshal([]byte(raw), &status); err != nil {
+		return Status{}, false, fmt.Errorf("error decoding heartbeat of workspace %s: %v", workspaceID, err)
+	}
+	return status, true, nil
+}
+
+// List returns the status of every workspace that ever sent a beat, ordered
+// by workspace ID.
+func (t *Tracker) List() ([]Status, error) {
+	raw, err := t.store.HGetAll(statusKey)
+	if err != nil {
+		return nil, fmt.Errorf("error loading heartbeats: %v", err)
+	}
+
+	statuses := make([]Status, 0, len(raw))
+	for workspaceID, value := range raw {
+		status := Status{}
+		if err := json.Unmarshal([]byte(value), &status); err != nil {
+			heartbeatLogger.Printf("Skipping invalid heartbeat of workspace %s: %v", workspaceID, err)
+			continue
+		}
+		statuses = append(statuses, status)
+	}
+	sort.Slice(statuses, func(i, j int) bool {
+		return statuses[i].WorkspaceID < statuses[j].WorkspaceID
+	})
+	return statuses, nil
+}
+
+func (t *Tracker) save(status Status) error {
+	raw, err := json.Marshal(status)
+	if err != nil {
+		return err
+	}
+	if _, err := t.store.HSet(statusKey, status.WorkspaceID, string(raw)); err != nil {
+		return fmt.Errorf("error saving heartbeat of workspace %s: %v", status.WorkspaceID, err)
+	}
+	return nil
+}
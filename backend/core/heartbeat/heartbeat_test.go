@@ -0,0 +1,138 @@
+package heartbeat
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"github.com/spectrumwebco/agent_runtime/backend/core/events"
+	"github.com/spectrumwebco/agent_runtime/backend/db/integrations/integrationsmock"
+	pb "github.com/spectrumwebco/agent_runtime/backend/protos/gen/go/agent_control"
+)
+
+type recordingPublisher struct {
+	events []events.WorkspaceEvent
+}
+
+func (p *recordingPublisher) Publish(ctx context.Context, event events.WorkspaceEvent) error {
+	p.events = append(p.events, event)
+	return nil
+}
+
+func TestTrackerMarksMissedBeats(t *testing.T) {
+	publisher := &recordingPublisher{}
+	events.SetPublisher(publisher)
+	defer events.SetPublisher(nil)
+
+	ctx := context.Background()
+	tracker := NewTracker(integrationsmock.NewKVStore(), 10*time.Second, 3)
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	tracker.SetClock(func() time.Time { return now })
+
+	if _, err := tracker.Observe(ctx, Beat{WorkspaceID: "ws-1", Version: "v1"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Two missed beats are tolerated.
+	now = now.Add(25 * time.Second)
+	if marked, err := tracker.Sweep(ctx); err != nil || len(marked) != 0 {
+		t.Fatalf("expected no unreachable workspaces, got %v (%v)", marked, err)
+	}
+
+	now = now.Add(10 * time.Second)
+	marked, err := tracker.Sweep(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(marked) != 1 || marked[0].WorkspaceID != "ws-1" {
+		t.Fatalf("expected ws-1 to be unreachable, got %v", marked)
+	}
+	if marked, _ := tracker.Sweep(ctx); len(marked) != 0 {
+		t.Fatalf("expected ws-1 to be marked only once, got %v", marked)
+	}
+
+	status, found, err := tracker.Get("ws-1")
+	if err != nil || !found || status.State != StateUnreachable {
+		t.Fatalf("unexpected status %v (found %v, %v)", status, found, err)
+	}
+
+	now = now.Add(time.Minute)
+	status, err = tracker.Observe(ctx, Beat{WorkspaceID: "ws-1", Version: "v1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.State != StateReachable || !status.LastSeen.Equal(now) {
+		t.Fatalf("unexpected status after beat: %v", status)
+	}
+
+	if len(publisher.events) != 2 {
+		t.Fatalf("expected 2 events, got %d", len(publisher.events))
+	}
+	if publisher.events[0].Type != events.WorkspaceUnreachable || publisher.events[1].Type != events.WorkspaceReachable {
+		t.Fatalf("unexpected events %s, %s", publisher.events[0].Type, publisher.events[1].Type)
+	}
+	if publisher.events[1].Attributes["unreachable_for"] != "1m35s" {
+		t.Fatalf("unexpected attributes %v", publisher.events[1].Attributes)
+	}
+}
+
+func TestServer(t *testing.T) {
+	tracker := NewTracker(integrationsmock.NewKVStore(), 5*time.Second, 3)
+
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := grpc.NewServer()
+	pb.RegisterHeartbeatServer(server, NewServer(tracker, "secret"))
+	go func() {
+		_ = server.Serve(lis)
+	}()
+	defer server.Stop()
+
+	conn, err := grpc.NewClient(lis.Addr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	client := pb.NewHeartbeatClient(conn)
+
+	beat := func(token string) (*pb.BeatResponse, error) {
+		ctx := metadata.AppendToOutgoingContext(context.Background(), "authorization", "Bearer "+token)
+		stream, err := client.Beat(ctx)
+		if err != nil {
+			return nil, err
+		}
+		if err := stream.Send(&pb.BeatRequest{WorkspaceId: "ws-1", Hostname: "host"}); err != nil {
+			return nil, err
+		}
+		return stream.Recv()
+	}
+
+	if _, err := beat("wrong"); status.Code(err) != codes.Unauthenticated {
+		t.Fatalf("expected unauthenticated, got %v", err)
+	}
+
+	ack, err := beat("secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ack.IntervalSeconds != 5 {
+		t.Fatalf("expected an interval of 5s, got %d", ack.IntervalSeconds)
+	}
+
+	statuses, err := tracker.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(statuses) != 1 || statuses[0].Hostname != "host" || statuses[0].State != StateReachable {
+		t.Fatalf("unexpected statuses %v", statuses)
+	}
+}
@@ -0,0 +1,75 @@
+package heartbeat
+
+import (
+	"crypto/subtle"
+	"errors"
+	"io"
+	"strings"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	pb "github.com/spectrumwebco/agent_runtime/backend/protos/gen/go/agent_control"
+)
+
+// Server receives the Beat streams of workspace agents. Agents must present
+// token as bearer token; an empty token rejects every stream.
+type Server struct {
+	pb.UnimplementedHeartbeatServer
+
+	tracker *Tracker
+	token   string
+}
+
+func NewServer(tracker *Tracker, token string) *Server {
+	return &Server{tracker: tracker, token: token}
+}
+
+func (s *Server) Beat(stream pb.Heartbeat_BeatServer) error {
+	if !s.authorized(stream) {
+		return status.Error(codes.Unauthenticated, "invalid heartbeat token")
+	}
+
+	ack := &pb.BeatResponse{IntervalSeconds: int64(s.tracker.Interval().Seconds())}
+	for {
+		req, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if req.WorkspaceId == "" {
+			return status.Error(codes.InvalidArgument, "workspace ID is required")
+		}
+
+		_, err = s.tracker.Observe(stream.Context(), Beat{
+			WorkspaceID:   req.WorkspaceId,
+			WorkspaceUID:  req.WorkspaceUid,
+			Version:       req.Version,
+			Hostname:      req.Hostname,
+			UptimeSeconds: req.UptimeSeconds,
+		})
+		if err != nil {
+			return status.Error(codes.Internal, err.Error())
+		}
+		if err := stream.Send(ack); err != nil {
+			return err
+		}
+	}
+}
+
+func (s *Server) authorized(stream pb.Heartbeat_BeatServer) bool {
+	if s.token == "" {
+		return false
+	}
+
+	md, _ := metadata.FromIncomingContext(stream.Context())
+	for _, value := range md.Get("authorization") {
+		token := strings.TrimPrefix(value, "Bearer ")
+		if subtle.ConstantTimeCompare([]byte(token), []byte(s.token)) == 1 {
+			return true
+		}
+	}
+	return false
+}
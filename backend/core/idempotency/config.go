@@ -0,0 +1,52 @@
+package idempotency
+
+import (
+	"log"
+	"os"
+	"time"
+
+	"github.com/spectrumwebco/agent_runtime/backend/core/config/env"
+)
+
+var idempotencyLogger = log.New(os.Stdout, "kled.idempotency: ", log.LstdFlags)
+
+type Config struct {
+	// TTL is how long responses are replayed.
+	TTL time.Duration `json:"ttl"`
+	// LockTTL bounds how long a request holds its key. Duplicates of
+	// requests running longer are not rejected anymore.
+	LockTTL time.Duration `json:"lock_ttl"`
+	// MaxKeyLength rejects longer keys.
+	MaxKeyLength int `json:"max_key_length"`
+	// MaxBodyBytes is the largest response stored; larger ones are not
+	// replayed.
+	MaxBodyBytes int `json:"max_body_bytes"`
+}
+
+const (
+	DefaultTTL          = 24 * time.Hour
+	DefaultLockTTL      = 5 * time.Minute
+	DefaultMaxKeyLength = 255
+	DefaultMaxBodyBytes = 1 << 20
+)
+
+// Default is the configuration shared by the idempotency middleware and the
+// jobs that dedupe their requests, read from the environment on first use.
+var Default = env.Once(FromEnv)
+
+// FromEnv reads how long responses are replayed, how long a request holds
+// its key and the largest response kept from the AGENT_IDEMPOTENCY_*
+// variables.
+func FromEnv() Config {
+	config := Config{
+		TTL:          DefaultTTL,
+		LockTTL:      DefaultLockTTL,
+		MaxKeyLength: DefaultMaxKeyLength,
+		MaxBodyBytes: DefaultMaxBodyBytes,
+	}
+	read := env.NewReader(idempotencyLogger)
+	read.Duration("AGENT_IDEMPOTENCY_TTL", &config.TTL, time.Second)
+	read.Duration("AGENT_IDEMPOTENCY_LOCK_TTL", &config.LockTTL, time.Second)
+	read.Int("AGENT_IDEMPOTENCY_MAX_BODY_BYTES", &config.MaxBodyBytes, 0)
+	return config
+}
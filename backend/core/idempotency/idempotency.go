@@ -0,0 +1,148 @@
+// Package idempotency replays the responses of requests retried with the
+// same Idempotency-Key, so client retries don't create workspaces or apply
+// state updates twice.
+//
+// The first request with a key takes a lock while it runs; duplicates
+// arriving meanwhile are rejected. Its response is stored in the KV store
+// and returned for retries until it expires. Keys are scoped to the caller
+// and bound to the request they were first used with.
+package idempotency
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/spectrumwebco/agent_runtime/backend/db/integrations"
+)
+
+var (
+	// ErrInProgress is returned while the first request with a key runs.
+	ErrInProgress = errors.New("a request with this idempotency key is in progress")
+	// ErrKeyReused is returned when a key is sent with a different request.
+	ErrKeyReused = errors.New("the idempotency key was used for a different request")
+)
+
+// Response is a stored response.
+type Response struct {
+	StatusCode int         `json:"status_code"`
+	Header     http.Header `json:"header,omitempty"`
+	Body       []byte      `json:"body,omitempty"`
+}
+
+type record struct {
+	Fingerprint string    `json:"fingerprint"`
+	Response    Response  `json:"response"`
+	CompletedAt time.Time `json:"completed_at"`
+}
+
+// Cacheable reports whether a response is stored. Server errors and rate
+// limiting are transient, so retries of them run again.
+func Cacheable(statusCode int) bool {
+	return statusCode < http.StatusInternalServerError && statusCode != http.StatusTooManyRequests
+}
+
+// Fingerprint identifies the request a key was used with.
+func Fingerprint(method, path string, body []byte) string {
+	hash := sha256.New()
+	fmt.Fprintf(hash, "%s %s\n", method, path)
+	hash.Write(body)
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// Store keeps the responses in the KV store.
+type Store struct {
+	kv     integrations.KVStore
+	locker integrations.Locker
+	config Config
+	now    func() time.Time
+}
+
+func NewStore(kv integrations.KVStore, locker integrations.Locker, config Config) *Store {
+	return &Store{kv: kv, locker: locker, config: config, now: time.Now}
+}
+
+func recordKey(scope, key string) string {
+	return "kled:idempotency:" + scope + ":" + key
+}
+
+// Lease is held by the first request with a key until it completes.
+type Lease struct {
+	store       *Store
+	key         string
+	token       string
+	fingerprint string
+}
+
+// Begin starts a request with a key. It returns the stored response for a
+// retry of a completed request, or a lease the caller completes with the
+// response.
+func (s *Store) Begin(scope, key, fingerprint string) (*Response, *Lease, error) {
+	if response, err := s.lookup(scope, key, fingerprint); response != nil || err != nil {
+		return response, nil, err
+	}
+
+	token := uuid.New().String()
+	lockKey := recordKey(scope, key) + ":lock"
+	acquired, err := s.locker.AcquireLock(lockKey, token, s.config.LockTTL)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error locking idempotency key: %v", err)
+	}
+	if !acquired {
+		return nil, nil, ErrInProgress
+	}
+
+	// the request may have completed between the lookup and the lock
+	response, err := s.lookup(scope, key, fingerprint)
+	if response != nil || err != nil {
+		_, _ = s.locker.ReleaseLock(lockKey, token)
+		return response, nil, err
+	}
+	return nil, &Lease{store: s, key: recordKey(scope, key), token: token, fingerprint: fingerprint}, nil
+}
+
+func (s *Store) lookup(scope, key, fingerprint string) (*Response, error) {
+	encoded, err := s.kv.Get(recordKey(scope, key))
+	if err != nil {
+		return nil, fmt.Errorf("error loading idempotency key: %v", err)
+	}
+	if encoded == "" {
+		return nil, nil
+	}
+	stored := &record{}
+	if err := json.Unmarshal([]byte(encoded), stored); err != nil {
+		return nil, fmt.Errorf("error decoding idempotency key: %v", err)
+	}
+	if stored.Fingerprint != fingerprint {
+		return nil, ErrKeyReused
+	}
+	return &stored.Response, nil
+}
+
+// Complete stores the response, if it is cacheable, and releases the key.
+func (l *Lease) Complete(response Response) error {
+	defer l.Release()
+	if !Cacheable(response.StatusCode) || len(response.Body) > l.store.config.MaxBodyBytes {
+		return nil
+	}
+
+	encoded, err := json.Marshal(record{Fingerprint: l.fingerprint, Response: response, CompletedAt: l.store.now().UTC()})
+	if err != nil {
+		return err
+	}
+	if _, err := l.store.kv.Set(l.key, string(encoded), int(l.store.config.TTL.Seconds())); err != nil {
+		return fmt.Errorf("error storing idempotency key: %v", err)
+	}
+	return nil
+}
+
+// Release releases the key without storing a response, so a retry runs
+// again.
+func (l *Lease) Release() {
+	_, _ = l.store.locker.ReleaseLock(l.key+":lock", l.token)
+}
@@ -0,0 +1,69 @@
+package idempotency
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/spectrumwebco/agent_runtime/backend/db/integrations/integrationsmock"
+)
+
+func newTestStore() *Store {
+	kv := integrationsmock.NewKVStore()
+	return NewStore(kv, kv, Config{TTL: DefaultTTL, LockTTL: DefaultLockTTL, MaxKeyLength: DefaultMaxKeyLength, MaxBodyBytes: 16})
+}
+
+func TestReplay(t *testing.T) {
+	store := newTestStore()
+	fingerprint := Fingerprint(http.MethodPost, "/api/workspaces/", []byte(`{"name": "a"}`))
+
+	response, lease, err := store.Begin("user-1", "key", fingerprint)
+	if err != nil || response != nil || lease == nil {
+		t.Fatalf("expected a lease, got %v, %v", response, err)
+	}
+	if _, _, err := store.Begin("user-1", "key", fingerprint); !errors.Is(err, ErrInProgress) {
+		t.Errorf("expected the duplicate to be rejected, got %v", err)
+	}
+	if _, other, err := store.Begin("user-2", "key", fingerprint); err != nil || other == nil {
+		t.Errorf("expected keys to be scoped to the caller, got %v", err)
+	}
+
+	if err := lease.Complete(Response{StatusCode: http.StatusCreated, Body: []byte(`{"id": "ws-1"}`)}); err != nil {
+		t.Fatal(err)
+	}
+	response, lease, err = store.Begin("user-1", "key", fingerprint)
+	if err != nil || lease != nil || response == nil || response.StatusCode != http.StatusCreated || string(response.Body) != `{"id": "ws-1"}` {
+		t.Errorf("expected the response to be replayed, got %+v, %v", response, err)
+	}
+
+	other := Fingerprint(http.MethodPost, "/api/workspaces/", []byte(`{"name": "b"}`))
+	if _, _, err := store.Begin("user-1", "key", other); !errors.Is(err, ErrKeyReused) {
+		t.Errorf("expected the reused key to be rejected, got %v", err)
+	}
+}
+
+func TestNotCached(t *testing.T) {
+	store := newTestStore()
+	for i, response := range []Response{
+		{StatusCode: http.StatusServiceUnavailable},
+		{StatusCode: http.StatusTooManyRequests},
+		{StatusCode: http.StatusOK, Body: []byte(`{"too": "large for the store"}`)},
+	} {
+		_, lease, err := store.Begin("user-1", "key", "fingerprint")
+		if err != nil || lease == nil {
+			t.Fatalf("%d: expected a lease, got %v", i, err)
+		}
+		if err := lease.Complete(response); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	_, lease, err := store.Begin("user-1", "key", "fingerprint")
+	if err != nil || lease == nil {
+		t.Fatalf("expected a lease, got %v", err)
+	}
+	lease.Release()
+	if _, lease, err := store.Begin("user-1", "key", "fingerprint"); err != nil || lease == nil {
+		t.Errorf("expected a retry after releasing to run, got %v", err)
+	}
+}
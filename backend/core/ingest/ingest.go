@@ -0,0 +1,186 @@
+// Package ingest streams the event topics of Kafka into Doris with routine
+// loads, which Doris runs by itself, so analytics see workspace events and
+// trajectories within seconds without a consumer of our own.
+//
+// The loads write to the shared analytics tables:
+//
+//	workspace_events  id, type, occurred_at, correlation_id, workspace_id,
+//	                  organization_id, actor_id, error, attributes (JSON)
+//	trajectories      id, workspace_id, organization_id, task_id, status,
+//	                  steps, total_tokens, created_at, finished_at
+package ingest
+
+import (
+	"context"
+	"log"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/spectrumwebco/agent_runtime/backend/core/config/env"
+	"github.com/spectrumwebco/agent_runtime/backend/core/events"
+	"github.com/spectrumwebco/agent_runtime/backend/core/kerrors"
+	"github.com/spectrumwebco/agent_runtime/backend/db/integrations"
+)
+
+var ingestLogger = log.New(os.Stdout, "kled.ingest: ", log.LstdFlags)
+
+// TrajectoryTopic receives a JSON message per finished trajectory, keyed by
+// workspace ID.
+const TrajectoryTopic = "agent.trajectories"
+
+// The names of the routine loads.
+const (
+	WorkspaceEventsLoad = "kled_workspace_events"
+	TrajectoriesLoad    = "kled_trajectories"
+)
+
+type Config struct {
+	// Offset is where new loads start consuming, OFFSET_BEGINNING or
+	// OFFSET_END.
+	Offset string `json:"offset"`
+	// MaxBatchInterval is the longest time a load buffers messages before
+	// writing them, which bounds how stale the tables are.
+	MaxBatchInterval time.Duration `json:"max_batch_interval"`
+	// MaxErrorRows is how many malformed messages a load skips within a
+	// window of 200000 rows before it pauses.
+	MaxErrorRows int `json:"max_error_rows"`
+	// PollInterval is how often the monitor reads the progress of the loads.
+	PollInterval time.Duration `json:"poll_interval"`
+}
+
+const (
+	DefaultOffset           = "OFFSET_BEGINNING"
+	DefaultMaxBatchInterval = 10 * time.Second
+	DefaultMaxErrorRows     = 1000
+	DefaultPollInterval     = 30 * time.Second
+)
+
+var Default = env.Once(FromEnv)
+
+func FromEnv() Config {
+	config := Config{
+		Offset:           DefaultOffset,
+		MaxBatchInterval: DefaultMaxBatchInterval,
+		MaxErrorRows:     DefaultMaxErrorRows,
+		PollInterval:     DefaultPollInterval,
+	}
+	read := env.NewReader(ingestLogger)
+	read.OneOf("AGENT_INGEST_OFFSET", &config.Offset, "OFFSET_BEGINNING", "OFFSET_END")
+	read.Duration("AGENT_INGEST_MAX_BATCH_INTERVAL", &config.MaxBatchInterval, time.Second)
+	read.Duration("AGENT_INGEST_POLL_INTERVAL", &config.PollInterval, time.Second)
+	read.Int("AGENT_INGEST_MAX_ERROR_ROWS", &config.MaxErrorRows, 0)
+	return config
+}
+
+// column is a column of a table with the path of its message field.
+type column struct {
+	name string
+	path string
+}
+
+func fields(names ...string) []column {
+	columns := make([]column, len(names))
+	for i, name := range names {
+		columns[i] = column{name: name, path: "$." + name}
+	}
+	return columns
+}
+
+// Loads returns the routine loads of the event topics, consumed through
+// the brokers and credentials of kafka.
+func Loads(kafka *integrations.KafkaClient, config Config) []integrations.DorisRoutineLoad {
+	load := func(name, table, topic string, columns []column) integrations.DorisRoutineLoad {
+		source := kafka.DorisSource(topic)
+		source.Offset = config.Offset
+		spec := integrations.DorisRoutineLoad{
+			Name:   name,
+			Table:  table,
+			Source: source,
+			Properties: map[string]string{
+				"max_batch_interval": strconv.Itoa(int(config.MaxBatchInterval.Seconds())),
+				"max_error_number":   strconv.Itoa(config.MaxErrorRows),
+			},
+		}
+		for _, column := range columns {
+			spec.Columns = append(spec.Columns, column.name)
+			spec.JSONPaths = append(spec.JSONPaths, column.path)
+		}
+		return spec
+	}
+
+	return []integrations.DorisRoutineLoad{
+		load(WorkspaceEventsLoad, "workspace_events", events.WorkspaceTopic, fields(
+			"id", "type", "occurred_at", "correlation_id", "workspace_id", "organization_id", "actor_id", "error", "attributes",
+		)),
+		load(TrajectoriesLoad, "trajectories", TrajectoryTopic, fields(
+			"id", "workspace_id", "organization_id", "task_id", "status", "steps", "total_tokens", "created_at", "finished_at",
+		)),
+	}
+}
+
+// Manager keeps the routine loads of the event topics running.
+type Manager struct {
+	loads *integrations.DorisRoutineLoads
+	specs []integrations.DorisRoutineLoad
+}
+
+func NewManager(loads *integrations.DorisRoutineLoads, specs []integrations.DorisRoutineLoad) *Manager {
+	return &Manager{loads: loads, specs: specs}
+}
+
+// Ensure creates the loads that don't exist or were stopped, and returns
+// their names. Paused loads are left alone, they were paused on purpose or
+// need their errors looked at before they are resumed.
+func (m *Manager) Ensure(ctx context.Context) ([]string, error) {
+	existing, err := m.loads.RoutineLoads(ctx)
+	if err != nil {
+		return nil, err
+	}
+	running := make(map[string]bool, len(existing))
+	for _, status := range existing {
+		running[status.Name] = true
+	}
+
+	var created []string
+	for _, spec := range m.specs {
+		if running[spec.Name] {
+			continue
+		}
+		if err := m.loads.CreateRoutineLoad(ctx, spec); err != nil {
+			return created, err
+		}
+		ingestLogger.Printf("Created routine load %s from %s into %s", spec.Name, spec.Source.Topic, spec.Table)
+		created = append(created, spec.Name)
+	}
+	return created, nil
+}
+
+// Statuses returns the status of the loads of the database, including the
+// ones the manager doesn't know.
+func (m *Manager) Statuses(ctx context.Context) ([]integrations.DorisRoutineLoadStatus, error) {
+	return m.loads.RoutineLoads(ctx)
+}
+
+// Status returns the status of a load, or a NotFound error.
+func (m *Manager) Status(ctx context.Context, name string) (*integrations.DorisRoutineLoadStatus, error) {
+	return m.loads.RoutineLoad(ctx, name)
+}
+
+// Pause pauses a load, keeping its offsets.
+func (m *Manager) Pause(ctx context.Context, name string) error {
+	return m.loads.PauseRoutineLoad(ctx, name)
+}
+
+// Resume resumes a paused load. Loads that were stopped can't be resumed;
+// Ensure creates them again.
+func (m *Manager) Resume(ctx context.Context, name string) error {
+	status, err := m.loads.RoutineLoad(ctx, name)
+	if err != nil {
+		return err
+	}
+	if status.State != integrations.DorisLoadPaused {
+		return kerrors.Errorf(kerrors.Conflict, "routine load %s is %s, only paused loads can be resumed", name, status.State)
+	}
+	return m.loads.ResumeRoutineLoad(ctx, name)
+}
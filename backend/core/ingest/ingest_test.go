@@ -0,0 +1,117 @@
+package ingest
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"github.com/spectrumwebco/agent_runtime/backend/core/kerrors"
+	"github.com/spectrumwebco/agent_runtime/backend/db/integrations"
+)
+
+// fakeDoris answers SHOW ROUTINE LOAD with rows and records statements.
+type fakeDoris struct {
+	rows       []map[string]interface{}
+	statements []string
+}
+
+func (f *fakeDoris) ExecuteQuery(query string, params ...interface{}) ([]map[string]interface{}, error) {
+	if name := strings.TrimPrefix(query, "SHOW ROUTINE LOAD FOR "); name != query {
+		for _, row := range f.rows {
+			if row["Name"] == name {
+				return []map[string]interface{}{row}, nil
+			}
+		}
+		return nil, nil
+	}
+	return f.rows, nil
+}
+
+func (f *fakeDoris) ExecuteUpdate(query string, params ...interface{}) (int64, error) {
+	f.statements = append(f.statements, query)
+	return 0, nil
+}
+
+func testManager(doris *fakeDoris) *Manager {
+	kafka := &integrations.KafkaClient{BootstrapServers: "kafka:9092", TopicPrefix: "kled"}
+	return NewManager(integrations.NewDorisRoutineLoads(doris), Loads(kafka, FromEnv()))
+}
+
+func TestEnsure(t *testing.T) {
+	doris := &fakeDoris{rows: []map[string]interface{}{{"Name": WorkspaceEventsLoad, "State": "RUNNING"}}}
+	manager := testManager(doris)
+
+	created, err := manager.Ensure(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(created) != 1 || created[0] != TrajectoriesLoad {
+		t.Fatalf("expected the trajectories load to be created, got %v", created)
+	}
+	if len(doris.statements) != 1 || !strings.HasPrefix(doris.statements[0], "CREATE ROUTINE LOAD kled_trajectories ON trajectories COLUMNS(id, workspace_id, organization_id,") {
+		t.Fatalf("unexpected statements %q", doris.statements)
+	}
+	for _, expected := range []string{`"kafka_topic" = "kled.agent.trajectories"`, `"max_batch_interval" = "10"`, `"property.kafka_default_offsets" = "OFFSET_BEGINNING"`} {
+		if !strings.Contains(doris.statements[0], expected) {
+			t.Errorf("expected %s in %s", expected, doris.statements[0])
+		}
+	}
+}
+
+func TestResume(t *testing.T) {
+	doris := &fakeDoris{rows: []map[string]interface{}{
+		{"Name": WorkspaceEventsLoad, "State": "RUNNING"},
+		{"Name": TrajectoriesLoad, "State": "PAUSED"},
+	}}
+	manager := testManager(doris)
+	ctx := context.Background()
+
+	if err := manager.Resume(ctx, WorkspaceEventsLoad); !errors.Is(err, kerrors.ErrConflict) {
+		t.Errorf("expected a conflict resuming a running load, got %v", err)
+	}
+	if err := manager.Resume(ctx, "kled_missing"); !errors.Is(err, kerrors.ErrNotFound) {
+		t.Errorf("expected a missing load not to be found, got %v", err)
+	}
+	if err := manager.Resume(ctx, TrajectoriesLoad); err != nil {
+		t.Fatal(err)
+	}
+	if len(doris.statements) != 1 || doris.statements[0] != "RESUME ROUTINE LOAD FOR kled_trajectories" {
+		t.Errorf("unexpected statements %q", doris.statements)
+	}
+}
+
+func TestMonitor(t *testing.T) {
+	doris := &fakeDoris{rows: []map[string]interface{}{{
+		"Name":                 TrajectoriesLoad,
+		"TableName":            "trajectories",
+		"State":                "PAUSED",
+		"DataSourceProperties": `{"topic":"kled.agent.trajectories"}`,
+		"Statistic":            `{"loadedRows":40,"errorRows":2}`,
+		"Lag":                  `{"0":5,"1":9}`,
+	}}}
+	monitor := NewMonitor(testManager(doris), time.Minute)
+	if err := monitor.Poll(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	defer loads.set(nil)
+
+	expected := `
+# HELP kled_doris_routine_load_lag_messages Messages of a Kafka partition not loaded into Doris yet, by routine load.
+# TYPE kled_doris_routine_load_lag_messages gauge
+kled_doris_routine_load_lag_messages{load="kled_trajectories",partition="0",topic="kled.agent.trajectories"} 5
+kled_doris_routine_load_lag_messages{load="kled_trajectories",partition="1",topic="kled.agent.trajectories"} 9
+# HELP kled_doris_routine_load_state 1 for the current state of a routine load.
+# TYPE kled_doris_routine_load_state gauge
+kled_doris_routine_load_state{load="kled_trajectories",state="PAUSED"} 1
+`
+	if err := testutil.CollectAndCompare(loads, strings.NewReader(expected), "kled_doris_routine_load_lag_messages", "kled_doris_routine_load_state"); err != nil {
+		t.Error(err)
+	}
+	if !monitor.paused[TrajectoriesLoad] {
+		t.Error("expected the paused load to be tracked")
+	}
+}
@@ -0,0 +1,130 @@
+package ingest
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/spectrumwebco/agent_runtime/backend/db/integrations"
+)
+
+var (
+	lagDesc = prometheus.NewDesc("kled_doris_routine_load_lag_messages",
+		"Messages of a Kafka partition not loaded into Doris yet, by routine load.",
+		[]string{"load", "topic", "partition"}, nil)
+	loadedRowsDesc = prometheus.NewDesc("kled_doris_routine_load_loaded_rows_total",
+		"Rows loaded into Doris by a routine load.",
+		[]string{"load", "table"}, nil)
+	errorRowsDesc = prometheus.NewDesc("kled_doris_routine_load_error_rows_total",
+		"Malformed messages skipped by a routine load.",
+		[]string{"load", "table"}, nil)
+	stateDesc = prometheus.NewDesc("kled_doris_routine_load_state",
+		"1 for the current state of a routine load.",
+		[]string{"load", "state"}, nil)
+
+	pollErrorsTotal = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "kled_doris_routine_load_poll_errors_total",
+		Help: "Failed reads of the progress of the Doris routine loads.",
+	})
+)
+
+func init() {
+	prometheus.MustRegister(pollErrorsTotal, loads)
+}
+
+// loadCollector reports the loads seen by the last poll of the monitor.
+// Series of loads that were stopped disappear with them.
+type loadCollector struct {
+	mu       sync.Mutex
+	statuses []integrations.DorisRoutineLoadStatus
+}
+
+var loads = &loadCollector{}
+
+func (c *loadCollector) set(statuses []integrations.DorisRoutineLoadStatus) {
+	c.mu.Lock()
+	c.statuses = statuses
+	c.mu.Unlock()
+}
+
+// LastStatuses returns the loads seen by the last poll of the monitor, nil
+// before the first poll.
+func LastStatuses() []integrations.DorisRoutineLoadStatus {
+	loads.mu.Lock()
+	defer loads.mu.Unlock()
+
+	return append([]integrations.DorisRoutineLoadStatus(nil), loads.statuses...)
+}
+
+func (c *loadCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- lagDesc
+	ch <- loadedRowsDesc
+	ch <- errorRowsDesc
+	ch <- stateDesc
+}
+
+func (c *loadCollector) Collect(ch chan<- prometheus.Metric) {
+	c.mu.Lock()
+	statuses := c.statuses
+	c.mu.Unlock()
+
+	for _, status := range statuses {
+		for partition, lag := range status.Lag {
+			ch <- prometheus.MustNewConstMetric(lagDesc, prometheus.GaugeValue, float64(lag), status.Name, status.Topic, partition)
+		}
+		ch <- prometheus.MustNewConstMetric(loadedRowsDesc, prometheus.CounterValue, float64(status.LoadedRows), status.Name, status.Table)
+		ch <- prometheus.MustNewConstMetric(errorRowsDesc, prometheus.CounterValue, float64(status.ErrorRows), status.Name, status.Table)
+		ch <- prometheus.MustNewConstMetric(stateDesc, prometheus.GaugeValue, 1, status.Name, status.State)
+	}
+}
+
+// Monitor polls the progress of the routine loads for the metrics. Paused
+// loads are logged with the reason Doris gives, as they stay paused until
+// someone resumes them.
+type Monitor struct {
+	manager  *Manager
+	interval time.Duration
+
+	paused map[string]bool
+}
+
+func NewMonitor(manager *Manager, interval time.Duration) *Monitor {
+	return &Monitor{manager: manager, interval: interval, paused: map[string]bool{}}
+}
+
+// Run polls until ctx is done.
+func (m *Monitor) Run(ctx context.Context) {
+	ticker := time.NewTicker(m.interval)
+	defer ticker.Stop()
+
+	for {
+		if err := m.Poll(ctx); err != nil {
+			ingestLogger.Printf("Error reading the progress of the routine loads: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Poll reads the progress of the loads once.
+func (m *Monitor) Poll(ctx context.Context) error {
+	statuses, err := m.manager.Statuses(ctx)
+	if err != nil {
+		pollErrorsTotal.Inc()
+		return err
+	}
+	loads.set(statuses)
+
+	for _, status := range statuses {
+		paused := status.State == integrations.DorisLoadPaused
+		if paused && !m.paused[status.Name] {
+			ingestLogger.Printf("Routine load %s is paused with %d messages behind: %s", status.Name, status.TotalLag(), status.Reason)
+		}
+		m.paused[status.Name] = paused
+	}
+	return nil
+}
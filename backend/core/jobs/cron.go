@@ -0,0 +1,179 @@
+package jobs
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Schedule computes the next activation time after a given time.
+type Schedule interface {
+	Next(after time.Time) time.Time
+}
+
+// ParseSchedule parses a standard five-field cron expression
+// ("minute hour day-of-month month day-of-week"), one of the descriptors
+// @yearly, @monthly, @weekly, @daily and @hourly, or "@every <duration>".
+func ParseSchedule(expr string) (Schedule, error) {
+	expr = strings.TrimSpace(expr)
+
+	if strings.HasPrefix(expr, "@every ") {
+		interval, err := time.ParseDuration(strings.TrimSpace(strings.TrimPrefix(expr, "@every ")))
+		if err != nil {
+			return nil, fmt.Errorf("invalid @every interval: %v", err)
+		}
+		if interval < time.Second {
+			return nil, fmt.Errorf("@every interval must be at least 1s, got %s", interval)
+		}
+		return everySchedule{interval: interval}, nil
+	}
+
+	switch expr {
+	case "@yearly", "@annually":
+		expr = "0 0 1 1 *"
+	case "@monthly":
+		expr = "0 0 1 * *"
+	case "@weekly":
+		expr = "0 0 * * 0"
+	case "@daily", "@midnight":
+		expr = "0 0 * * *"
+	case "@hourly":
+		expr = "0 * * * *"
+	}
+
+	fields := strings.Fields(expr)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("cron expression %q must have 5 fields, got %d", expr, len(fields))
+	}
+
+	var (
+		s   cronSchedule
+		err error
+	)
+	if s.minute, err = parseField(fields[0], 0, 59); err != nil {
+		return nil, fmt.Errorf("minute: %v", err)
+	}
+	if s.hour, err = parseField(fields[1], 0, 23); err != nil {
+		return nil, fmt.Errorf("hour: %v", err)
+	}
+	if s.dom, err = parseField(fields[2], 1, 31); err != nil {
+		return nil, fmt.Errorf("day of month: %v", err)
+	}
+	if s.month, err = parseField(fields[3], 1, 12); err != nil {
+		return nil, fmt.Errorf("month: %v", err)
+	}
+	if s.dow, err = parseField(fields[4], 0, 7); err != nil {
+		return nil, fmt.Errorf("day of week: %v", err)
+	}
+	if s.dow&(1<<7) != 0 {
+		// Both 0 and 7 mean Sunday.
+		s.dow = s.dow&^(1<<7) | 1
+	}
+	s.domStar = fields[2] == "*" || fields[2] == "?"
+	s.dowStar = fields[4] == "*" || fields[4] == "?"
+
+	return s, nil
+}
+
+type everySchedule struct {
+	interval time.Duration
+}
+
+func (s everySchedule) Next(after time.Time) time.Time {
+	return after.Truncate(time.Second).Add(s.interval)
+}
+
+type cronSchedule struct {
+	minute, hour, dom, month, dow uint64
+	domStar, dowStar              bool
+}
+
+func (s cronSchedule) Next(after time.Time) time.Time {
+	t := after.Truncate(time.Minute).Add(time.Minute)
+
+	// Five years covers every valid combination, including 29 February.
+	limit := t.AddDate(5, 0, 0)
+	for t.Before(limit) {
+		if s.month&(1<<uint(t.Month())) == 0 {
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location())
+			continue
+		}
+		if !s.dayMatches(t) {
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location())
+			continue
+		}
+		if s.hour&(1<<uint(t.Hour())) == 0 {
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, t.Location())
+			continue
+		}
+		if s.minute&(1<<uint(t.Minute())) == 0 {
+			t = t.Add(time.Minute)
+			continue
+		}
+		return t
+	}
+
+	return time.Time{}
+}
+
+// dayMatches follows the cron convention that a day matches when either the
+// day of month or the day of week matches, unless one of them is unrestricted.
+func (s cronSchedule) dayMatches(t time.Time) bool {
+	domMatch := s.dom&(1<<uint(t.Day())) != 0
+	dowMatch := s.dow&(1<<uint(t.Weekday())) != 0
+
+	if s.domStar || s.dowStar {
+		return domMatch && dowMatch
+	}
+	return domMatch || dowMatch
+}
+
+func parseField(field string, min, max int) (uint64, error) {
+	var bits uint64
+	for _, part := range strings.Split(field, ",") {
+		rangePart, step := part, 1
+		if i := strings.Index(part, "/"); i >= 0 {
+			var err error
+			step, err = strconv.Atoi(part[i+1:])
+			if err != nil || step <= 0 {
+				return 0, fmt.Errorf("invalid step in %q", part)
+			}
+			rangePart = part[:i]
+		}
+
+		lo, hi := min, max
+		switch {
+		case rangePart == "*" || rangePart == "?":
+		case strings.Contains(rangePart, "-"):
+			bounds := strings.SplitN(rangePart, "-", 2)
+			var err error
+			if lo, err = strconv.Atoi(bounds[0]); err != nil {
+				return 0, fmt.Errorf("invalid range %q", rangePart)
+			}
+			if hi, err = strconv.Atoi(bounds[1]); err != nil {
+				return 0, fmt.Errorf("invalid range %q", rangePart)
+			}
+		default:
+			value, err := strconv.Atoi(rangePart)
+			if err != nil {
+				return 0, fmt.Errorf("invalid value %q", rangePart)
+			}
+			lo = value
+			if strings.Contains(part, "/") {
+				hi = max
+			} else {
+				hi = value
+			}
+		}
+
+		if lo < min || hi > max || lo > hi {
+			return 0, fmt.Errorf("%q is outside %d-%d", part, min, max)
+		}
+		for v := lo; v <= hi; v += step {
+			bits |= 1 << uint(v)
+		}
+	}
+
+	return bits, nil
+}
@@ -0,0 +1,42 @@
+package jobs
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseScheduleNext(t *testing.T) {
+	base := time.Date(2024, time.January, 31, 10, 17, 30, 0, time.UTC)
+
+	tests := []struct {
+		expr     string
+		expected time.Time
+	}{
+		{"*/15 * * * *", time.Date(2024, time.January, 31, 10, 30, 0, 0, time.UTC)},
+		{"0 3 * * *", time.Date(2024, time.February, 1, 3, 0, 0, 0, time.UTC)},
+		{"@hourly", time.Date(2024, time.January, 31, 11, 0, 0, 0, time.UTC)},
+		{"0 0 29 2 *", time.Date(2024, time.February, 29, 0, 0, 0, 0, time.UTC)},
+		{"30 9 * * 1-5", time.Date(2024, time.February, 1, 9, 30, 0, 0, time.UTC)},
+		{"0 12 * * 7", time.Date(2024, time.February, 4, 12, 0, 0, 0, time.UTC)},
+		{"0 0 1 * 3", time.Date(2024, time.February, 1, 0, 0, 0, 0, time.UTC)},
+		{"@every 90s", time.Date(2024, time.January, 31, 10, 19, 0, 0, time.UTC)},
+	}
+
+	for _, test := range tests {
+		schedule, err := ParseSchedule(test.expr)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", test.expr, err)
+		}
+		if next := schedule.Next(base); !next.Equal(test.expected) {
+			t.Errorf("%s: expected %s, got %s", test.expr, test.expected, next)
+		}
+	}
+}
+
+func TestParseScheduleInvalid(t *testing.T) {
+	for _, expr := range []string{"", "* * * *", "60 * * * *", "* 24 * * *", "*/0 * * * *", "5-1 * * * *", "@every 1ms"} {
+		if _, err := ParseSchedule(expr); err == nil {
+			t.Errorf("%q: expected error", expr)
+		}
+	}
+}
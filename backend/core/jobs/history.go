@@ -0,0 +1,172 @@
+package jobs
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/spectrumwebco/agent_runtime/backend/db/integrations"
+)
+
+type RunStatus string
+
+const (
+	RunStatusRunning   RunStatus = "running"
+	RunStatusSucceeded RunStatus = "succeeded"
+	RunStatusFailed    RunStatus = "failed"
+)
+
+type Run struct {
+	ID         string    `json:"id"`
+	JobName    string    `json:"job_name"`
+	Trigger    string    `json:"trigger"`
+	Host       string    `json:"host"`
+	Status     RunStatus `json:"status"`
+	Error      string    `json:"error,omitempty"`
+	StartedAt  time.Time `json:"started_at"`
+	FinishedAt time.Time `json:"finished_at,omitempty"`
+}
+
+type HistoryStore interface {
+	RecordStart(run Run) error
+	RecordFinish(run Run) error
+	// Recent returns up to limit runs, newest first. An empty jobName returns
+	// runs of every job.
+	Recent(jobName string, limit int) ([]Run, error)
+}
+
+type MemoryHistory struct {
+	runs []Run
+	mu   sync.Mutex
+}
+
+func NewMemoryHistory() *MemoryHistory {
+	return &MemoryHistory{}
+}
+
+func (h *MemoryHistory) RecordStart(run Run) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.runs = append(h.runs, run)
+	return nil
+}
+
+func (h *MemoryHistory) RecordFinish(run Run) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for i := range h.runs {
+		if h.runs[i].ID == run.ID {
+			h.runs[i] = run
+			return nil
+		}
+	}
+	h.runs = append(h.runs, run)
+	return nil
+}
+
+func (h *MemoryHistory) Recent(jobName string, limit int) ([]Run, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	runs := []Run{}
+	for _, run := range h.runs {
+		if jobName == "" || run.JobName == jobName {
+			runs = append(runs, run)
+		}
+	}
+	sort.SliceStable(runs, func(i, j int) bool {
+		return runs[i].StartedAt.After(runs[j].StartedAt)
+	})
+	if limit > 0 && len(runs) > limit {
+		runs = runs[:limit]
+	}
+	return runs, nil
+}
+
+// PostgresHistory stores job runs in the app_job_run table.
+type PostgresHistory struct {
+	store integrations.SQLStore
+}
+
+func NewPostgresHistory(store integrations.SQLStore) *PostgresHistory {
+	return &PostgresHistory{store: store}
+}
+
+func (h *PostgresHistory) EnsureSchema() error {
+	_, err := h.store.ExecuteUpdate(`
+CREATE TABLE IF NOT EXISTS app_job_run (
+	id UUID PRIMARY KEY,
+	job_name VARCHAR(255) NOT NULL,
+	trigger VARCHAR(32) NOT NULL,
+	host VARCHAR(255) NOT NULL,
+	status VARCHAR(32) NOT NULL,
+	error TEXT NOT NULL DEFAULT '',
+	started_at TIMESTAMPTZ NOT NULL,
+	finished_at TIMESTAMPTZ
+);
+CREATE INDEX IF NOT EXISTS app_job_run_job_name_started_at ON app_job_run (job_name, started_at DESC);`)
+	if err != nil {
+		return fmt.Errorf("error creating job history table: %v", err)
+	}
+	return nil
+}
+
+func (h *PostgresHistory) RecordStart(run Run) error {
+	_, err := h.store.ExecuteUpdate(
+		`INSERT INTO app_job_run (id, job_name, trigger, host, status, started_at) VALUES ($1, $2, $3, $4, $5, $6)`,
+		run.ID, run.JobName, run.Trigger, run.Host, string(run.Status), run.StartedAt,
+	)
+	return err
+}
+
+func (h *PostgresHistory) RecordFinish(run Run) error {
+	_, err := h.store.ExecuteUpdate(
+		`UPDATE app_job_run SET status = $2, error = $3, finished_at = $4 WHERE id = $1`,
+		run.ID, string(run.Status), run.Error, run.FinishedAt,
+	)
+	return err
+}
+
+func (h *PostgresHistory) Recent(jobName string, limit int) ([]Run, error) {
+	if limit <= 0 {
+		limit = 20
+	}
+
+	query := `SELECT id, job_name, trigger, host, status, error, started_at, finished_at FROM app_job_run`
+	params := []interface{}{}
+	if jobName != "" {
+		query += ` WHERE job_name = $1`
+		params = append(params, jobName)
+	}
+	query += fmt.Sprintf(` ORDER BY started_at DESC LIMIT %d`, limit)
+
+	rows, err := h.store.ExecuteQuery(query, params...)
+	if err != nil {
+		return nil, err
+	}
+
+	runs := make([]Run, 0, len(rows))
+	for _, row := range rows {
+		run := Run{
+			ID:      fmt.Sprint(row["id"]),
+			JobName: fmt.Sprint(row["job_name"]),
+			Trigger: fmt.Sprint(row["trigger"]),
+			Host:    fmt.Sprint(row["host"]),
+			Status:  RunStatus(fmt.Sprint(row["status"])),
+		}
+		if errText, ok := row["error"].(string); ok {
+			run.Error = errText
+		}
+		if startedAt, ok := row["started_at"].(time.Time); ok {
+			run.StartedAt = startedAt
+		}
+		if finishedAt, ok := row["finished_at"].(time.Time); ok {
+			run.FinishedAt = finishedAt
+		}
+		runs = append(runs, run)
+	}
+	return runs, nil
+}
@@ -0,0 +1,294 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/spectrumwebco/agent_runtime/backend/core/idempotency"
+	"github.com/spectrumwebco/agent_runtime/backend/core/retention"
+	"github.com/spectrumwebco/agent_runtime/backend/db/integrations"
+)
+
+const (
+	JobSnapshotPrune      = "snapshot-prune"
+	JobWorkspaceAutoStop  = "workspace-auto-stop"
+	JobCredentialRotation = "credential-rotation"
+	JobDorisRollup        = "doris-rollup"
+	JobRetentionPrune     = "retention-prune"
+	JobEmailDigest        = "email-digest"
+	JobLLMUsageRollup     = "llm-usage-rollup"
+	JobWorkspaceSchedules = "workspace-schedules"
+	JobSLOAlerts          = "slo-alerts"
+
+	// SecretRotationTopic receives one message per secret that is due for
+	// rotation. The secrets service performs the rotation itself.
+	SecretRotationTopic = "secret_rotation"
+)
+
+// rotationScope is the idempotency scope of rotation requests, keyed by
+// secret and due date.
+const rotationScope = "secret_rotation"
+
+// MaintenanceConfig wires the built-in maintenance jobs to their
+// dependencies. A job is only registered when everything it needs is set.
+type MaintenanceConfig struct {
+	Postgres integrations.SQLStore
+	Doris    integrations.SQLStore
+	Queue    integrations.MessageQueue
+	// RotationRequests records the rotation requests sent for each secret
+	// and due date, so the hourly credential-rotation job requests a
+	// rotation once rather than every hour until the secret is rotated. A
+	// request is repeated once its record expires.
+	RotationRequests *idempotency.Store
+
+	// SnapshotRetention is how long snapshots are kept. Defaults to 30 days.
+	SnapshotRetention time.Duration
+	// PruneSnapshots deletes snapshots created before olderThan and returns
+	// how many were removed.
+	PruneSnapshots func(ctx context.Context, olderThan time.Time) (int, error)
+	// StopIdleWorkspaces stops workspaces past their inactivity timeout and
+	// returns how many were stopped. It must stop them with
+	// workspace.Controller, which returns their quota slots.
+	StopIdleWorkspaces func(ctx context.Context) (int, error)
+	// DorisRollups lists the Doris materialized views refreshed by the
+	// doris-rollup job.
+	DorisRollups []string
+	// Retention prunes data past its retention period.
+	Retention *retention.Enforcer
+	// RetentionDryRun makes the retention-prune job only report what it
+	// would delete.
+	RetentionDryRun bool
+	// SendDigests emails the digests of [from, to) and returns how many were
+	// sent. The email-digest job covers the previous UTC day.
+	SendDigests func(ctx context.Context, from, to time.Time) (int, error)
+	// DigestSchedule is the schedule of the email-digest job. Defaults to
+	// 07:00 every day.
+	DigestSchedule string
+	// RollupLLMUsage aggregates the LLM calls of the UTC days from the day
+	// of from to the day of to into Doris. The llm-usage-rollup job covers
+	// yesterday and today every hour.
+	RollupLLMUsage func(ctx context.Context, from, to time.Time) error
+	// RunWorkspaceSchedules starts and stops the workspaces whose schedules
+	// are due and returns how many were started and stopped.
+	RunWorkspaceSchedules func(ctx context.Context) (int, int, error)
+	// CheckSLOs evaluates the burn rates of the SLOs and returns how many
+	// alerts started or resolved.
+	CheckSLOs func(ctx context.Context) (int, error)
+}
+
+func RegisterMaintenanceJobs(s *Scheduler, cfg MaintenanceConfig) error {
+	if cfg.SnapshotRetention <= 0 {
+		cfg.SnapshotRetention = 30 * 24 * time.Hour
+	}
+	if cfg.DigestSchedule == "" {
+		cfg.DigestSchedule = "0 7 * * *"
+	}
+
+	var jobs []Job
+	if cfg.PruneSnapshots != nil {
+		jobs = append(jobs, Job{
+			Name:        JobSnapshotPrune,
+			Description: "Delete workspace snapshots older than the retention period",
+			Schedule:    "0 3 * * *",
+			Timeout:     time.Hour,
+			Run: func(ctx context.Context) error {
+				pruned, err := cfg.PruneSnapshots(ctx, time.Now().Add(-cfg.SnapshotRetention))
+				if err != nil {
+					return err
+				}
+				jobsLogger.Printf("Pruned %d snapshots", pruned)
+				return nil
+			},
+		})
+	}
+
+	if cfg.StopIdleWorkspaces != nil {
+		jobs = append(jobs, Job{
+			Name:        JobWorkspaceAutoStop,
+			Description: "Stop workspaces that exceeded their inactivity timeout",
+			Schedule:    "*/5 * * * *",
+			Timeout:     4 * time.Minute,
+			Run: func(ctx context.Context) error {
+				stopped, err := cfg.StopIdleWorkspaces(ctx)
+				if err != nil {
+					return err
+				}
+				if stopped > 0 {
+					jobsLogger.Printf("Stopped %d idle workspaces", stopped)
+				}
+				return nil
+			},
+		})
+	}
+
+	if cfg.Postgres != nil && cfg.Queue != nil && cfg.RotationRequests != nil {
+		jobs = append(jobs, Job{
+			Name:        JobCredentialRotation,
+			Description: "Request rotation of secrets whose rotation interval has elapsed",
+			Schedule:    "0 * * * *",
+			Timeout:     10 * time.Minute,
+			Run: func(ctx context.Context) error {
+				return requestSecretRotations(ctx, cfg.Postgres, cfg.Queue, cfg.RotationRequests)
+			},
+		})
+	}
+
+	if cfg.Doris != nil && len(cfg.DorisRollups) > 0 {
+		jobs = append(jobs, Job{
+			Name:        JobDorisRollup,
+			Description: "Refresh Doris rollup materialized views",
+			Schedule:    "15 * * * *",
+			Timeout:     30 * time.Minute,
+			Run: func(ctx context.Context) error {
+				for _, view := range cfg.DorisRollups {
+					if err := ctx.Err(); err != nil {
+						return err
+					}
+					if _, err := cfg.Doris.ExecuteUpdate(fmt.Sprintf("REFRESH MATERIALIZED VIEW %s AUTO", view)); err != nil {
+						return fmt.Errorf("error refreshing %s: %v", view, err)
+					}
+				}
+				return nil
+			},
+		})
+	}
+
+	if cfg.Retention != nil {
+		jobs = append(jobs, Job{
+			Name:        JobRetentionPrune,
+			Description: "Delete trajectories, audit logs, state history and workspace events past their retention",
+			Schedule:    "30 4 * * *",
+			Timeout:     2 * time.Hour,
+			Run: func(ctx context.Context) error {
+				report, err := cfg.Retention.Run(ctx, cfg.RetentionDryRun)
+				if report != nil && cfg.RetentionDryRun {
+					jobsLogger.Printf("Retention dry run: %d rows would be pruned", report.Rows())
+				}
+				return err
+			},
+		})
+	}
+
+	if cfg.SendDigests != nil {
+		jobs = append(jobs, Job{
+			Name:        JobEmailDigest,
+			Description: "Email each user a digest of yesterday's workspaces, failures and cost",
+			Schedule:    cfg.DigestSchedule,
+			Timeout:     time.Hour,
+			Run: func(ctx context.Context) error {
+				to := time.Now().UTC().Truncate(24 * time.Hour)
+				sent, err := cfg.SendDigests(ctx, to.Add(-24*time.Hour), to)
+				jobsLogger.Printf("Sent %d email digests", sent)
+				return err
+			},
+		})
+	}
+
+	if cfg.RollupLLMUsage != nil {
+		jobs = append(jobs, Job{
+			Name:        JobLLMUsageRollup,
+			Description: "Aggregate LLM token usage per project and day into Doris",
+			Schedule:    "20 * * * *",
+			Timeout:     30 * time.Minute,
+			Run: func(ctx context.Context) error {
+				now := time.Now().UTC()
+				return cfg.RollupLLMUsage(ctx, now.Add(-24*time.Hour), now)
+			},
+		})
+	}
+
+	if cfg.RunWorkspaceSchedules != nil {
+		jobs = append(jobs, Job{
+			Name:        JobWorkspaceSchedules,
+			Description: "Start and stop workspaces on their schedules",
+			Schedule:    "* * * * *",
+			Timeout:     50 * time.Second,
+			Run: func(ctx context.Context) error {
+				started, stopped, err := cfg.RunWorkspaceSchedules(ctx)
+				if started > 0 || stopped > 0 {
+					jobsLogger.Printf("Started %d and stopped %d scheduled workspaces", started, stopped)
+				}
+				return err
+			},
+		})
+	}
+	if cfg.CheckSLOs != nil {
+		jobs = append(jobs, Job{
+			Name:        JobSLOAlerts,
+			Description: "Alert when the error budget of an SLO burns too fast",
+			Schedule:    "* * * * *",
+			Timeout:     50 * time.Second,
+			Run: func(ctx context.Context) error {
+				alerts, err := cfg.CheckSLOs(ctx)
+				if alerts > 0 {
+					jobsLogger.Printf("Sent %d SLO alerts", alerts)
+				}
+				return err
+			},
+		})
+	}
+
+	for _, job := range jobs {
+		if err := s.Register(job); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// requestSecretRotations requests the rotation of every secret whose
+// rotation interval has elapsed, unless it was already requested for the
+// same due date. The message carries that key as rotation_id, so the secrets
+// service can drop duplicates of requests whose record expired.
+func requestSecretRotations(ctx context.Context, store integrations.SQLStore, queue integrations.MessageQueue, requests *idempotency.Store) error {
+	rows, err := store.ExecuteQuery(`
+SELECT id, organization_id, COALESCE(last_rotated_at, created_at) + (rotation_interval || ' days')::interval AS due_at
+FROM app_secret
+WHERE rotation_interval IS NOT NULL
+  AND COALESCE(last_rotated_at, created_at) + (rotation_interval || ' days')::interval < NOW()`)
+	if err != nil {
+		return fmt.Errorf("error listing secrets due for rotation: %v", err)
+	}
+
+	failed := 0
+	for _, row := range rows {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		secretID := fmt.Sprint(row["id"])
+		rotationID := secretID + ":" + fmt.Sprint(row["due_at"])
+		requested, lease, err := requests.Begin(rotationScope, rotationID, rotationID)
+		if errors.Is(err, idempotency.ErrInProgress) || requested != nil {
+			continue
+		}
+		if err != nil {
+			jobsLogger.Printf("Error checking the rotation request of secret %s: %v", secretID, err)
+			failed++
+			continue
+		}
+
+		sent := queue.SendJSON(SecretRotationTopic, map[string]interface{}{
+			"secret_id":       secretID,
+			"organization_id": fmt.Sprint(row["organization_id"]),
+			"rotation_id":     rotationID,
+			"requested_at":    time.Now().UTC().Format(time.RFC3339),
+		}, "rotate", secretID)
+		if !sent {
+			lease.Release()
+			failed++
+			continue
+		}
+		if err := lease.Complete(idempotency.Response{StatusCode: http.StatusAccepted}); err != nil {
+			jobsLogger.Printf("Error recording the rotation request of secret %s: %v", secretID, err)
+		}
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("failed to request rotation for %d of %d secrets", failed, len(rows))
+	}
+	return nil
+}
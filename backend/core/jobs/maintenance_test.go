@@ -0,0 +1,70 @@
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/spectrumwebco/agent_runtime/backend/core/idempotency"
+	"github.com/spectrumwebco/agent_runtime/backend/db/integrations/integrationsmock"
+)
+
+func TestSecretRotationIsRequestedOncePerDueDate(t *testing.T) {
+	dueAt := "2026-10-01 12:00:00+00"
+	store := integrationsmock.NewSQLStore()
+	store.OnQuery("SELECT id, organization_id", func(params []interface{}) ([]map[string]interface{}, error) {
+		return []map[string]interface{}{{"id": "secret-1", "organization_id": "org-1", "due_at": dueAt}}, nil
+	})
+	queue := integrationsmock.NewMessageQueue()
+	kv := integrationsmock.NewKVStore()
+	requests := idempotency.NewStore(kv, kv, idempotency.Default())
+
+	for run := 0; run < 3; run++ {
+		if err := requestSecretRotations(context.Background(), store, queue, requests); err != nil {
+			t.Fatalf("run %d: %v", run, err)
+		}
+	}
+	messages := queue.Messages(SecretRotationTopic)
+	if len(messages) != 1 {
+		t.Fatalf("got %d rotation requests, want 1", len(messages))
+	}
+	var request map[string]string
+	if err := json.Unmarshal(messages[0].Body, &request); err != nil {
+		t.Fatal(err)
+	}
+	if request["secret_id"] != "secret-1" || request["rotation_id"] != "secret-1:"+dueAt {
+		t.Fatalf("unexpected request %v", request)
+	}
+
+	// rotating the secret moves its due date, which is requested again
+	dueAt = "2026-11-01 12:00:00+00"
+	if err := requestSecretRotations(context.Background(), store, queue, requests); err != nil {
+		t.Fatal(err)
+	}
+	if got := len(queue.Messages(SecretRotationTopic)); got != 2 {
+		t.Fatalf("got %d rotation requests after the due date moved, want 2", got)
+	}
+}
+
+func TestFailedRotationRequestIsRetried(t *testing.T) {
+	store := integrationsmock.NewSQLStore()
+	store.OnQuery("SELECT id, organization_id", func(params []interface{}) ([]map[string]interface{}, error) {
+		return []map[string]interface{}{{"id": "secret-1", "organization_id": "org-1", "due_at": "2026-10-01 12:00:00+00"}}, nil
+	})
+	queue := integrationsmock.NewMessageQueue()
+	kv := integrationsmock.NewKVStore()
+	requests := idempotency.NewStore(kv, kv, idempotency.Default())
+
+	queue.Shutdown()
+	if err := requestSecretRotations(context.Background(), store, queue, requests); err == nil {
+		t.Fatal("expected an error for the unsent request")
+	}
+
+	queue = integrationsmock.NewMessageQueue()
+	if err := requestSecretRotations(context.Background(), store, queue, requests); err != nil {
+		t.Fatal(err)
+	}
+	if got := len(queue.Messages(SecretRotationTopic)); got != 1 {
+		t.Fatalf("got %d rotation requests after the failure, want 1", got)
+	}
+}
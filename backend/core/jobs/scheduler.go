@@ -0,0 +1,283 @@
+// Package jobs runs background maintenance jobs on cron schedules.
+//
+// Every replica runs a Scheduler, but a scheduled activation only executes on
+// the replica that acquires its lock. The lock is keyed by the activation
+// time and expires instead of being released, so a replica whose timer fires
+// after the run finished doesn't run the activation again. Workers run the
+// scheduler under the leader election named ElectionName, so normally only
+// one replica schedules at all. Every execution is recorded in a HistoryStore.
+package jobs
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+var jobsLogger = log.New(os.Stdout, "kled.jobs: ", log.LstdFlags)
+
+const DefaultJobTimeout = 10 * time.Minute
+
+// ElectionName is the leader election of the job workers.
+const ElectionName = "job-scheduler"
+
+type Job struct {
+	Name        string
+	Description string
+	// Schedule is a cron expression accepted by ParseSchedule.
+	Schedule string
+	// Timeout bounds a single run and the lifetime of its locks.
+	Timeout time.Duration
+	Run     func(ctx context.Context) error
+
+	schedule Schedule
+}
+
+// Locker is a distributed mutual-exclusion lock. DragonflyManager implements
+// it with SET NX.
+type Locker interface {
+	AcquireLock(key string, token string, ttl time.Duration) (bool, error)
+	ReleaseLock(key string, token string) (bool, error)
+}
+
+// ErrLocked is returned by RunNow when another replica holds the job's lock.
+var ErrLocked = fmt.Errorf("job is already running on another replica")
+
+type Scheduler struct {
+	jobs    map[string]*Job
+	locker  Locker
+	history HistoryStore
+	host    string
+	now     func() time.Time
+	mu      sync.RWMutex
+}
+
+func NewScheduler(locker Locker, history HistoryStore) *Scheduler {
+	host, _ := os.Hostname()
+	if history == nil {
+		history = NewMemoryHistory()
+	}
+
+	return &Scheduler{
+		jobs:    make(map[string]*Job),
+		locker:  locker,
+		history: history,
+		host:    host,
+		now:     time.Now,
+	}
+}
+
+func (s *Scheduler) Register(job Job) error {
+	if job.Name == "" {
+		return fmt.Errorf("job name is required")
+	}
+	if job.Run == nil {
+		return fmt.Errorf("job %s has no run function", job.Name)
+	}
+
+	schedule, err := ParseSchedule(job.Schedule)
+	if err != nil {
+		return fmt.Errorf("job %s: %v", job.Name, err)
+	}
+	job.schedule = schedule
+	if job.Timeout <= 0 {
+		job.Timeout = DefaultJobTimeout
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.jobs[job.Name]; ok {
+		return fmt.Errorf("job %s is already registered", job.Name)
+	}
+	s.jobs[job.Name] = &job
+	return nil
+}
+
+// Jobs returns the registered jobs sorted by name.
+func (s *Scheduler) Jobs() []Job {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	jobs := make([]Job, 0, len(s.jobs))
+	for _, job := range s.jobs {
+		jobs = append(jobs, *job)
+	}
+	sort.Slice(jobs, func(i, j int) bool {
+		return jobs[i].Name < jobs[j].Name
+	})
+	return jobs
+}
+
+// NextRun returns the next time the named job is due after t.
+func (s *Scheduler) NextRun(name string, t time.Time) (time.Time, error) {
+	s.mu.RLock()
+	job, ok := s.jobs[name]
+	s.mu.RUnlock()
+
+	if !ok {
+		return time.Time{}, fmt.Errorf("job %s not found", name)
+	}
+	return job.schedule.Next(t), nil
+}
+
+func (s *Scheduler) History() HistoryStore {
+	return s.history
+}
+
+// Start runs jobs on their schedules until ctx is cancelled.
+func (s *Scheduler) Start(ctx context.Context) {
+	next := make(map[string]time.Time)
+	now := s.now()
+	for _, job := range s.Jobs() {
+		next[job.Name] = job.schedule.Next(now)
+	}
+
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	for {
+		var earliest time.Time
+		for _, t := range next {
+			if earliest.IsZero() || t.Before(earliest) {
+				earliest = t
+			}
+		}
+		if earliest.IsZero() {
+			<-ctx.Done()
+			return
+		}
+
+		timer := time.NewTimer(time.Until(earliest))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+
+		now := s.now()
+		for name, t := range next {
+			if t.After(now) {
+				continue
+			}
+
+			s.mu.RLock()
+			job := s.jobs[name]
+			s.mu.RUnlock()
+			next[name] = job.schedule.Next(now)
+
+			wg.Add(1)
+			go func(job *Job, activation time.Time) {
+				defer wg.Done()
+				if err := s.runActivation(ctx, job, activation); err != nil && err != ErrLocked {
+					jobsLogger.Printf("Job %s failed: %v", job.Name, err)
+				}
+			}(job, t)
+		}
+	}
+}
+
+// RunNow runs the named job immediately, still honouring its lock.
+func (s *Scheduler) RunNow(ctx context.Context, name string) error {
+	s.mu.RLock()
+	job, ok := s.jobs[name]
+	s.mu.RUnlock()
+
+	if !ok {
+		return fmt.Errorf("job %s not found", name)
+	}
+	return s.run(ctx, job, "manual")
+}
+
+// MinActivationLockTTL is the shortest time an activation lock is kept, so
+// replicas whose clocks or timers lag behind still see it.
+const MinActivationLockTTL = time.Minute
+
+// runActivation runs the activation of job scheduled at activation, unless
+// another replica already claimed it.
+func (s *Scheduler) runActivation(ctx context.Context, job *Job, activation time.Time) error {
+	if s.locker != nil {
+		ttl := job.Timeout
+		if ttl < MinActivationLockTTL {
+			ttl = MinActivationLockTTL
+		}
+		key := fmt.Sprintf("kled:jobs:activation:%s:%d", job.Name, activation.Unix())
+		acquired, err := s.locker.AcquireLock(key, s.host, ttl)
+		if err != nil {
+			return fmt.Errorf("error acquiring lock: %v", err)
+		}
+		if !acquired {
+			return ErrLocked
+		}
+	}
+	return s.run(ctx, job, "schedule")
+}
+
+// run holds the job's lock while it runs, so runs of the same job never
+// overlap.
+func (s *Scheduler) run(ctx context.Context, job *Job, trigger string) error {
+	token := uuid.New().String()
+	lockKey := "kled:jobs:lock:" + job.Name
+
+	if s.locker != nil {
+		acquired, err := s.locker.AcquireLock(lockKey, token, job.Timeout)
+		if err != nil {
+			return fmt.Errorf("error acquiring lock: %v", err)
+		}
+		if !acquired {
+			return ErrLocked
+		}
+		defer func() {
+			if _, err := s.locker.ReleaseLock(lockKey, token); err != nil {
+				jobsLogger.Printf("Error releasing lock for job %s: %v", job.Name, err)
+			}
+		}()
+	}
+
+	run := Run{
+		ID:        token,
+		JobName:   job.Name,
+		Trigger:   trigger,
+		Host:      s.host,
+		Status:    RunStatusRunning,
+		StartedAt: s.now(),
+	}
+	if err := s.history.RecordStart(run); err != nil {
+		jobsLogger.Printf("Error recording start of job %s: %v", job.Name, err)
+	}
+
+	runCtx, cancel := context.WithTimeout(ctx, job.Timeout)
+	defer cancel()
+
+	err := runSafely(runCtx, job)
+
+	run.FinishedAt = s.now()
+	run.Status = RunStatusSucceeded
+	if err != nil {
+		run.Status = RunStatusFailed
+		run.Error = err.Error()
+	}
+	if recordErr := s.history.RecordFinish(run); recordErr != nil {
+		jobsLogger.Printf("Error recording result of job %s: %v", job.Name, recordErr)
+	}
+
+	jobsLogger.Printf("Job %s %s in %s", job.Name, run.Status, run.FinishedAt.Sub(run.StartedAt).Round(time.Millisecond))
+	return err
+}
+
+func runSafely(ctx context.Context, job *Job) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("job panicked: %v", r)
+		}
+	}()
+
+	return job.Run(ctx)
+}
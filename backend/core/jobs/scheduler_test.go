@@ -0,0 +1,67 @@
+package jobs
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+type memoryLocker struct {
+	mu    sync.Mutex
+	locks map[string]string
+}
+
+func (l *memoryLocker) AcquireLock(key string, token string, ttl time.Duration) (bool, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if _, ok := l.locks[key]; ok {
+		return false, nil
+	}
+	l.locks[key] = token
+	return true, nil
+}
+
+func (l *memoryLocker) ReleaseLock(key string, token string) (bool, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.locks[key] != token {
+		return false, nil
+	}
+	delete(l.locks, key)
+	return true, nil
+}
+
+func TestActivationRunsOnce(t *testing.T) {
+	locker := &memoryLocker{locks: map[string]string{}}
+	runs := 0
+	job := Job{Name: "prune", Schedule: "*/5 * * * *", Run: func(ctx context.Context) error {
+		runs++
+		return nil
+	}}
+
+	// two replicas whose timers fire after the other finished
+	replicas := []*Scheduler{NewScheduler(locker, nil), NewScheduler(locker, nil)}
+	for _, scheduler := range replicas {
+		if err := scheduler.Register(job); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	activation := time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC)
+	ctx := context.Background()
+	if err := replicas[0].runActivation(ctx, replicas[0].jobs["prune"], activation); err != nil {
+		t.Fatal(err)
+	}
+	if err := replicas[1].runActivation(ctx, replicas[1].jobs["prune"], activation); err != ErrLocked {
+		t.Fatalf("expected the activation to be claimed, got %v", err)
+	}
+	if err := replicas[1].runActivation(ctx, replicas[1].jobs["prune"], activation.Add(5*time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	if runs != 2 {
+		t.Errorf("expected 2 runs, got %d", runs)
+	}
+}
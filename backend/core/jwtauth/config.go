@@ -0,0 +1,74 @@
+package jwtauth
+
+import (
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/spectrumwebco/agent_runtime/backend/core/config/env"
+)
+
+var jwtLogger = log.New(os.Stdout, "kled.jwtauth: ", log.LstdFlags)
+
+type Config struct {
+	// JWKSURL is where the signing keys of the project are fetched from.
+	// It defaults to the JWKS endpoint of SUPABASE_URL.
+	JWKSURL string `json:"jwks_url"`
+	// Secret verifies HS256 tokens of projects still signing with the
+	// legacy JWT secret. Tokens with that algorithm are rejected without it.
+	Secret string `json:"-"`
+	// Issuer, if set, must match the iss claim.
+	Issuer string `json:"issuer"`
+	// Audience must be one of the aud claim.
+	Audience string `json:"audience"`
+	// JWKSTTL is how long fetched keys are used before they are refetched.
+	JWKSTTL time.Duration `json:"jwks_ttl"`
+	// Leeway is the clock skew allowed for exp and nbf.
+	Leeway time.Duration `json:"leeway"`
+}
+
+const (
+	DefaultAudience = "authenticated"
+	DefaultJWKSTTL  = 10 * time.Minute
+	DefaultLeeway   = 30 * time.Second
+)
+
+// Enabled reports whether tokens can be verified at all.
+func (c Config) Enabled() bool {
+	return c.JWKSURL != "" || c.Secret != ""
+}
+
+var Default = env.Once(FromEnv)
+
+// FromEnv falls back to the JWKS endpoint, issuer and JWT secret of the
+// Supabase project for whatever the AGENT_JWT_* variables leave unset.
+func FromEnv() Config {
+	config := Config{
+		JWKSURL:  os.Getenv("AGENT_JWT_JWKS_URL"),
+		Secret:   os.Getenv("AGENT_JWT_SECRET"),
+		Issuer:   os.Getenv("AGENT_JWT_ISSUER"),
+		Audience: os.Getenv("AGENT_JWT_AUDIENCE"),
+		JWKSTTL:  DefaultJWKSTTL,
+		Leeway:   DefaultLeeway,
+	}
+	if supabaseURL := strings.TrimSuffix(os.Getenv("SUPABASE_URL"), "/"); supabaseURL != "" {
+		if config.JWKSURL == "" {
+			config.JWKSURL = supabaseURL + "/auth/v1/.well-known/jwks.json"
+		}
+		if config.Issuer == "" {
+			config.Issuer = supabaseURL + "/auth/v1"
+		}
+	}
+	if config.Secret == "" {
+		config.Secret = os.Getenv("SUPABASE_JWT_SECRET")
+	}
+	if config.Audience == "" {
+		config.Audience = DefaultAudience
+	}
+
+	read := env.NewReader(jwtLogger)
+	read.Duration("AGENT_JWT_JWKS_TTL", &config.JWKSTTL, 0)
+	read.Duration("AGENT_JWT_LEEWAY", &config.Leeway, 0)
+	return config
+}
@@ -0,0 +1,184 @@
+package jwtauth
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/spectrumwebco/agent_runtime/backend/core/kerrors"
+	"golang.org/x/sync/singleflight"
+)
+
+// minRefresh limits how often tokens with unknown key IDs refetch the keys,
+// so garbage tokens can't hammer the JWKS endpoint.
+const minRefresh = 30 * time.Second
+
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// JWKS fetches the signing keys of a JSON Web Key Set and caches them. Keys
+// are refetched after the TTL, or early when a token names a key that isn't
+// known yet, which is how rotated keys are picked up. Concurrent refreshes
+// share one fetch, which runs without holding the lock.
+type JWKS struct {
+	url    string
+	client *http.Client
+	ttl    time.Duration
+	now    func() time.Time
+
+	refresh singleflight.Group
+
+	mu        sync.Mutex
+	keys      map[string]crypto.PublicKey
+	fetchedAt time.Time
+	triedAt   time.Time
+}
+
+func NewJWKS(url string, client *http.Client, ttl time.Duration) *JWKS {
+	return &JWKS{url: url, client: client, ttl: ttl, now: time.Now}
+}
+
+// Key returns the key with the key ID.
+func (s *JWKS) Key(ctx context.Context, kid string) (crypto.PublicKey, error) {
+	s.mu.Lock()
+	key, known := s.keys[kid]
+	stale := s.now().Sub(s.fetchedAt) >= s.ttl
+	s.mu.Unlock()
+
+	if stale || !known {
+		// the fetch outlives a caller that gives up, as others may be waiting on it
+		fetchCtx := context.WithoutCancel(ctx)
+		if _, err, _ := s.refresh.Do("keys", func() (interface{}, error) {
+			return nil, s.refreshKeys(fetchCtx)
+		}); err != nil {
+			return nil, err
+		}
+		s.mu.Lock()
+		key, known = s.keys[kid]
+		s.mu.Unlock()
+	}
+	if !known {
+		return nil, fmt.Errorf("unknown signing key %q", kid)
+	}
+	return key, nil
+}
+
+// refreshKeys fetches the keys unless they were tried within minRefresh. It
+// only fails if there are no cached keys to fall back to.
+func (s *JWKS) refreshKeys(ctx context.Context) error {
+	s.mu.Lock()
+	now := s.now()
+	if now.Sub(s.triedAt) < minRefresh {
+		s.mu.Unlock()
+		return nil
+	}
+	s.triedAt = now
+	s.mu.Unlock()
+
+	keys, err := s.fetch(ctx)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	switch {
+	case err == nil:
+		s.keys = keys
+		s.fetchedAt = now
+	case s.keys == nil:
+		return err
+	default:
+		// keep verifying with the keys we have while the endpoint is down
+		jwtLogger.Printf("Error refreshing JWKS, using the cached keys: %v", err)
+	}
+	return nil
+}
+
+func (s *JWKS) fetch(ctx context.Context) (map[string]crypto.PublicKey, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, kerrors.Errorf(kerrors.BackendUnavailable, "error fetching JWKS: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, kerrors.Errorf(kerrors.BackendUnavailable, "error fetching JWKS: status %d", resp.StatusCode)
+	}
+
+	set := struct {
+		Keys []jwk `json:"keys"`
+	}{}
+	if err := json.NewDecoder(resp.Body).Decode(&set); err != nil {
+		return nil, fmt.Errorf("error decoding JWKS: %v", err)
+	}
+
+	keys := map[string]crypto.PublicKey{}
+	for _, key := range set.Keys {
+		if key.Use != "" && key.Use != "sig" {
+			continue
+		}
+		parsed, err := key.publicKey()
+		if err != nil {
+			jwtLogger.Printf("Skipping key %q of JWKS: %v", key.Kid, err)
+			continue
+		}
+		keys[key.Kid] = parsed
+	}
+	return keys, nil
+}
+
+func (k jwk) publicKey() (crypto.PublicKey, error) {
+	decode := base64.RawURLEncoding.DecodeString
+	switch k.Kty {
+	case "RSA":
+		n, err := decode(k.N)
+		if err != nil {
+			return nil, fmt.Errorf("invalid modulus: %v", err)
+		}
+		e, err := decode(k.E)
+		if err != nil || len(e) == 0 || len(e) > 4 {
+			return nil, fmt.Errorf("invalid exponent")
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}, nil
+
+	case "EC":
+		if k.Crv != "P-256" {
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := decode(k.X)
+		if err != nil {
+			return nil, fmt.Errorf("invalid x coordinate: %v", err)
+		}
+		y, err := decode(k.Y)
+		if err != nil {
+			return nil, fmt.Errorf("invalid y coordinate: %v", err)
+		}
+		key := &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		if _, err := key.ECDH(); err != nil {
+			return nil, fmt.Errorf("invalid point: %v", err)
+		}
+		return key, nil
+
+	default:
+		return nil, fmt.Errorf("unsupported key type %q", k.Kty)
+	}
+}
@@ -0,0 +1,337 @@
+// Package jwtauth verifies the access tokens Supabase issues to end users,
+// so the backend can authenticate them without asking the Python side.
+//
+// Tokens are verified with the signing keys of the project's JWKS, which
+// are cached and refetched when a token names a rotated key. Projects still
+// on the legacy shared secret verify HS256 tokens with it instead. The
+// claims of a valid token are put into the request context.
+package jwtauth
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/spectrumwebco/agent_runtime/backend/core/kerrors"
+	"github.com/spectrumwebco/agent_runtime/backend/core/outbound"
+)
+
+var (
+	// ErrInvalidToken is returned for tokens that don't verify. The reason
+	// is wrapped into it.
+	ErrInvalidToken = kerrors.New(kerrors.NotAuthenticated, "invalid token")
+	// ErrNoSecret is returned by Sign without a secret to sign with.
+	ErrNoSecret = kerrors.New(kerrors.BackendUnavailable, "no JWT secret configured to sign access tokens with")
+)
+
+// Audience is the aud claim, which may be a string or a list.
+type Audience []string
+
+func (a *Audience) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*a = Audience{single}
+		return nil
+	}
+	var list []string
+	if err := json.Unmarshal(data, &list); err != nil {
+		return err
+	}
+	*a = list
+	return nil
+}
+
+func (a Audience) Contains(audience string) bool {
+	for _, candidate := range a {
+		if candidate == audience {
+			return true
+		}
+	}
+	return false
+}
+
+// Claims are the claims of a Supabase access token.
+type Claims struct {
+	Subject      string                 `json:"sub"`
+	Issuer       string                 `json:"iss"`
+	Audience     Audience               `json:"aud"`
+	ExpiresAt    int64                  `json:"exp"`
+	NotBefore    int64                  `json:"nbf,omitempty"`
+	IssuedAt     int64                  `json:"iat"`
+	Email        string                 `json:"email,omitempty"`
+	Phone        string                 `json:"phone,omitempty"`
+	Role         string                 `json:"role"`
+	SessionID    string                 `json:"session_id,omitempty"`
+	IsAnonymous  bool                   `json:"is_anonymous,omitempty"`
+	AppMetadata  map[string]interface{} `json:"app_metadata,omitempty"`
+	UserMetadata map[string]interface{} `json:"user_metadata,omitempty"`
+}
+
+// OrganizationID returns the organization_id of the app metadata, which
+// users can't change themselves, or "".
+func (c *Claims) OrganizationID() string {
+	if organizationID, ok := c.AppMetadata["organization_id"]; ok && organizationID != nil {
+		return fmt.Sprint(organizationID)
+	}
+	return ""
+}
+
+// SessionChecker reports whether the session an access token was issued
+// for has been revoked, such as *sessions.Manager.
+type SessionChecker interface {
+	Revoked(ctx context.Context, sessionID string) (bool, error)
+}
+
+// Verifier verifies tokens.
+type Verifier struct {
+	config   Config
+	keys     *JWKS
+	sessions SessionChecker
+	now      func() time.Time
+}
+
+// NewVerifier returns a verifier fetching the keys with client. The client
+// may be nil if only the secret is configured.
+func NewVerifier(config Config, client *http.Client) *Verifier {
+	verifier := &Verifier{config: config, now: time.Now}
+	if config.JWKSURL != "" {
+		verifier.keys = NewJWKS(config.JWKSURL, client, config.JWKSTTL)
+	}
+	return verifier
+}
+
+// SetSessions rejects tokens whose session_id names a session sessions
+// reports as revoked. It must be called before tokens are verified.
+func (v *Verifier) SetSessions(sessions SessionChecker) {
+	v.sessions = sessions
+}
+
+func invalid(format string, args ...interface{}) error {
+	return fmt.Errorf("%w: %s", ErrInvalidToken, fmt.Sprintf(format, args...))
+}
+
+// Verify checks the signature, expiry, issuer and audience of token, and
+// its session if SetSessions was called, and returns its claims.
+func (v *Verifier) Verify(ctx context.Context, token string) (*Claims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, invalid("malformed token")
+	}
+
+	header := struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}{}
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, invalid("malformed header: %v", err)
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, invalid("malformed signature: %v", err)
+	}
+	if err := v.verifySignature(ctx, header.Alg, header.Kid, parts[0]+"."+parts[1], signature); err != nil {
+		return nil, err
+	}
+
+	claims := &Claims{}
+	if err := decodeSegment(parts[1], claims); err != nil {
+		return nil, invalid("malformed claims: %v", err)
+	}
+	now := v.now()
+	switch {
+	case claims.ExpiresAt == 0 || now.After(time.Unix(claims.ExpiresAt, 0).Add(v.config.Leeway)):
+		return nil, invalid("token expired")
+	case claims.NotBefore != 0 && now.Add(v.config.Leeway).Before(time.Unix(claims.NotBefore, 0)):
+		return nil, invalid("token not valid yet")
+	case v.config.Issuer != "" && claims.Issuer != v.config.Issuer:
+		return nil, invalid("unexpected issuer %q", claims.Issuer)
+	case v.config.Audience != "" && !claims.Audience.Contains(v.config.Audience):
+		return nil, invalid("unexpected audience %v", []string(claims.Audience))
+	case claims.Subject == "":
+		return nil, invalid("token has no subject")
+	}
+	if claims.SessionID != "" && v.sessions != nil {
+		revoked, err := v.sessions.Revoked(ctx, claims.SessionID)
+		if err != nil {
+			return nil, err
+		}
+		if revoked {
+			return nil, invalid("session revoked")
+		}
+	}
+	return claims, nil
+}
+
+func (v *Verifier) verifySignature(ctx context.Context, alg, kid, signed string, signature []byte) error {
+	digest := sha256.Sum256([]byte(signed))
+	switch alg {
+	case "HS256":
+		if v.config.Secret == "" {
+			return invalid("HS256 tokens are not accepted")
+		}
+		mac := hmac.New(sha256.New, []byte(v.config.Secret))
+		mac.Write([]byte(signed))
+		if !hmac.Equal(mac.Sum(nil), signature) {
+			return invalid("signature mismatch")
+		}
+		return nil
+
+	case "RS256", "ES256":
+		if v.keys == nil {
+			return invalid("%s tokens are not accepted", alg)
+		}
+		key, err := v.keys.Key(ctx, kid)
+		if errors.Is(err, kerrors.ErrBackendUnavailable) {
+			return err
+		} else if err != nil {
+			return invalid("%v", err)
+		}
+
+		switch key := key.(type) {
+		case *rsa.PublicKey:
+			if alg == "RS256" && rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], signature) == nil {
+				return nil
+			}
+		case *ecdsa.PublicKey:
+			// JWS signatures are r and s concatenated rather than ASN.1
+			if alg == "ES256" && len(signature) == 64 {
+				r, s := new(big.Int).SetBytes(signature[:32]), new(big.Int).SetBytes(signature[32:])
+				if ecdsa.Verify(key, digest[:], r, s) {
+					return nil
+				}
+			}
+		}
+		return invalid("signature mismatch")
+
+	default:
+		return invalid("unsupported algorithm %q", alg)
+	}
+}
+
+// Sign returns an HS256 token with claims valid for ttl, signed with the
+// secret of config, so the middleware accepts it like the tokens Supabase
+// issues. The issuer and audience of config are filled in.
+func Sign(config Config, claims Claims, now time.Time, ttl time.Duration) (string, error) {
+	if config.Secret == "" {
+		return "", ErrNoSecret
+	}
+	claims.Issuer = config.Issuer
+	if config.Audience != "" {
+		claims.Audience = Audience{config.Audience}
+	}
+	claims.IssuedAt = now.Unix()
+	claims.ExpiresAt = now.Add(ttl).Unix()
+
+	encoded, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+	encode := base64.RawURLEncoding.EncodeToString
+	signed := encode([]byte(`{"alg":"HS256","typ":"JWT"}`)) + "." + encode(encoded)
+	mac := hmac.New(sha256.New, []byte(config.Secret))
+	mac.Write([]byte(signed))
+	return signed + "." + encode(mac.Sum(nil)), nil
+}
+
+func decodeSegment(segment string, out interface{}) error {
+	decoded, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(decoded, out)
+}
+
+// TokenFromRequest returns the bearer token of r. Browsers can't set headers
+// on WebSocket handshakes, so those may pass it as the access_token query
+// parameter. Bearer tokens that aren't JWTs, like API keys, are ignored.
+func TokenFromRequest(r *http.Request) string {
+	token := ""
+	if authorization := r.Header.Get("Authorization"); len(authorization) > 7 && strings.EqualFold(authorization[:7], "bearer ") {
+		token = strings.TrimSpace(authorization[7:])
+	} else if strings.EqualFold(r.Header.Get("Upgrade"), "websocket") {
+		token = r.URL.Query().Get("access_token")
+	}
+	if strings.Count(token, ".") != 2 {
+		return ""
+	}
+	return token
+}
+
+type contextKey struct{}
+
+// WithClaims returns ctx carrying the claims of a verified token.
+func WithClaims(ctx context.Context, claims *Claims) context.Context {
+	return context.WithValue(ctx, contextKey{}, claims)
+}
+
+// FromContext returns the claims of the request's token, or nil if it
+// didn't send one.
+func FromContext(ctx context.Context) *Claims {
+	claims, _ := ctx.Value(contextKey{}).(*Claims)
+	return claims
+}
+
+// Authenticate verifies the token of r, if it has one, and returns r with
+// its claims. Requests without a token are returned as they are.
+func (v *Verifier) Authenticate(r *http.Request) (*http.Request, error) {
+	token := TokenFromRequest(r)
+	if token == "" {
+		return r, nil
+	}
+	claims, err := v.Verify(r.Context(), token)
+	if err != nil {
+		return r, err
+	}
+	return r.WithContext(WithClaims(r.Context(), claims)), nil
+}
+
+// Middleware rejects requests with invalid tokens with 401 and adds the
+// claims of valid ones to the request context. Requests without a token
+// are passed through for the other authentication methods.
+func (v *Verifier) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		authenticated, err := v.Authenticate(r)
+		if err != nil {
+			if !errors.Is(err, ErrInvalidToken) {
+				jwtLogger.Printf("Error verifying token of %s %s: %v", r.Method, r.URL.Path, err)
+			}
+			kerrors.WriteJSON(w, err)
+			return
+		}
+		next.ServeHTTP(w, authenticated)
+	})
+}
+
+var (
+	defaultVerifier     *Verifier
+	defaultVerifierOnce sync.Once
+)
+
+// DefaultVerifier returns the verifier of the process configuration, or nil
+// if tokens can't be verified.
+func DefaultVerifier() *Verifier {
+	defaultVerifierOnce.Do(func() {
+		config := Default()
+		if !config.Enabled() {
+			return
+		}
+		client, err := outbound.Default().HTTPClient(10 * time.Second)
+		if err != nil {
+			jwtLogger.Printf("Error loading CA bundle for the JWKS: %v", err)
+		}
+		defaultVerifier = NewVerifier(config, client)
+	})
+	return defaultVerifier
+}
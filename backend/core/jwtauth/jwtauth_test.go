@@ -0,0 +1,323 @@
+package jwtauth
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/spectrumwebco/agent_runtime/backend/core/kerrors"
+)
+
+var (
+	testNow    = time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	testIssuer = "https://project.supabase.co/auth/v1"
+)
+
+func encodeSegment(t *testing.T, value interface{}) string {
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return base64.RawURLEncoding.EncodeToString(encoded)
+}
+
+func testClaims(overrides map[string]interface{}) map[string]interface{} {
+	claims := map[string]interface{}{
+		"sub":  "user-1",
+		"iss":  testIssuer,
+		"aud":  "authenticated",
+		"exp":  testNow.Add(time.Hour).Unix(),
+		"iat":  testNow.Unix(),
+		"role": "authenticated",
+		"app_metadata": map[string]interface{}{
+			"organization_id": "org-1",
+		},
+	}
+	for key, value := range overrides {
+		claims[key] = value
+	}
+	return claims
+}
+
+func signRS256(t *testing.T, key *rsa.PrivateKey, kid string, claims map[string]interface{}) string {
+	signed := encodeSegment(t, map[string]string{"alg": "RS256", "kid": kid}) + "." + encodeSegment(t, claims)
+	digest := sha256.Sum256([]byte(signed))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+func signES256(t *testing.T, key *ecdsa.PrivateKey, kid string, claims map[string]interface{}) string {
+	signed := encodeSegment(t, map[string]string{"alg": "ES256", "kid": kid}) + "." + encodeSegment(t, claims)
+	digest := sha256.Sum256([]byte(signed))
+	r, s, err := ecdsa.Sign(rand.Reader, key, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	signature := make([]byte, 64)
+	r.FillBytes(signature[:32])
+	s.FillBytes(signature[32:])
+	return signed + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+func signHS256(t *testing.T, secret string, claims map[string]interface{}) string {
+	signed := encodeSegment(t, map[string]string{"alg": "HS256"}) + "." + encodeSegment(t, claims)
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(signed))
+	return signed + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// jwksServer serves the keys and counts the fetches.
+func jwksServer(t *testing.T, keys *[]map[string]string, fetches *int) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		*fetches++
+		json.NewEncoder(w).Encode(map[string]interface{}{"keys": *keys})
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func rsaJWK(kid string, key *rsa.PrivateKey) map[string]string {
+	return map[string]string{
+		"kty": "RSA", "kid": kid, "use": "sig", "alg": "RS256",
+		"n": base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+		"e": base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+	}
+}
+
+func newTestVerifier(config Config, client *http.Client) (*Verifier, *time.Time) {
+	config.Issuer = testIssuer
+	config.Audience = DefaultAudience
+	config.JWKSTTL = DefaultJWKSTTL
+	config.Leeway = DefaultLeeway
+	verifier := NewVerifier(config, client)
+	now := testNow
+	verifier.now = func() time.Time { return now }
+	if verifier.keys != nil {
+		verifier.keys.now = verifier.now
+	}
+	return verifier, &now
+}
+
+func TestVerify(t *testing.T) {
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	ecKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	ecJWK := map[string]string{
+		"kty": "EC", "kid": "ec-1", "crv": "P-256",
+		"x": base64.RawURLEncoding.EncodeToString(ecKey.X.FillBytes(make([]byte, 32))),
+		"y": base64.RawURLEncoding.EncodeToString(ecKey.Y.FillBytes(make([]byte, 32))),
+	}
+	keys := []map[string]string{rsaJWK("rsa-1", rsaKey), ecJWK}
+	fetches := 0
+	server := jwksServer(t, &keys, &fetches)
+	verifier, _ := newTestVerifier(Config{JWKSURL: server.URL, Secret: "legacy-secret"}, server.Client())
+
+	for name, token := range map[string]string{
+		"RS256": signRS256(t, rsaKey, "rsa-1", testClaims(nil)),
+		"ES256": signES256(t, ecKey, "ec-1", testClaims(nil)),
+		"HS256": signHS256(t, "legacy-secret", testClaims(nil)),
+	} {
+		claims, err := verifier.Verify(context.Background(), token)
+		if err != nil {
+			t.Errorf("%s: %v", name, err)
+		} else if claims.Subject != "user-1" || claims.OrganizationID() != "org-1" {
+			t.Errorf("%s: unexpected claims %+v", name, claims)
+		}
+	}
+	if fetches != 1 {
+		t.Errorf("expected the keys to be fetched once, got %d", fetches)
+	}
+
+	otherKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	for name, token := range map[string]string{
+		"expired":        signRS256(t, rsaKey, "rsa-1", testClaims(map[string]interface{}{"exp": testNow.Add(-time.Minute).Unix()})),
+		"wrong audience": signRS256(t, rsaKey, "rsa-1", testClaims(map[string]interface{}{"aud": []string{"anon"}})),
+		"wrong issuer":   signRS256(t, rsaKey, "rsa-1", testClaims(map[string]interface{}{"iss": "https://other.supabase.co/auth/v1"})),
+		"wrong key":      signRS256(t, otherKey, "rsa-1", testClaims(nil)),
+		"wrong secret":   signHS256(t, "other-secret", testClaims(nil)),
+		"wrong alg":      signRS256(t, rsaKey, "ec-1", testClaims(nil)),
+		"malformed":      "not.a.token",
+	} {
+		if _, err := verifier.Verify(context.Background(), token); !errors.Is(err, ErrInvalidToken) || !errors.Is(err, kerrors.ErrNotAuthenticated) {
+			t.Errorf("%s: expected an invalid token, got %v", name, err)
+		}
+	}
+}
+
+func TestKeyRotation(t *testing.T) {
+	oldKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	newKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	keys := []map[string]string{rsaJWK("old", oldKey)}
+	fetches := 0
+	server := jwksServer(t, &keys, &fetches)
+	verifier, now := newTestVerifier(Config{JWKSURL: server.URL}, server.Client())
+
+	if _, err := verifier.Verify(context.Background(), signRS256(t, oldKey, "old", testClaims(nil))); err != nil {
+		t.Fatal(err)
+	}
+
+	// unknown keys are refetched, but not more often than minRefresh
+	keys = append(keys, rsaJWK("new", newKey))
+	if _, err := verifier.Verify(context.Background(), signRS256(t, newKey, "new", testClaims(nil))); err == nil {
+		t.Error("expected the new key to be unknown right after a fetch")
+	}
+	*now = now.Add(minRefresh)
+	if _, err := verifier.Verify(context.Background(), signRS256(t, newKey, "new", testClaims(nil))); err != nil {
+		t.Errorf("expected the rotated key to be fetched: %v", err)
+	}
+	if fetches != 2 {
+		t.Errorf("expected 2 fetches, got %d", fetches)
+	}
+
+	// the cached keys keep working while the endpoint is down
+	server.Close()
+	*now = now.Add(DefaultJWKSTTL)
+	if _, err := verifier.Verify(context.Background(), signRS256(t, oldKey, "old", testClaims(nil))); err != nil {
+		t.Errorf("expected the cached key to be used: %v", err)
+	}
+}
+
+func TestKeyFetchUnlocked(t *testing.T) {
+	oldKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	newKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	keys := []map[string]string{rsaJWK("old", oldKey)}
+	fetching := make(chan struct{}, 1)
+	release := make(chan struct{})
+	first := true
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !first {
+			fetching <- struct{}{}
+			<-release
+		}
+		first = false
+		json.NewEncoder(w).Encode(map[string]interface{}{"keys": keys})
+	}))
+	t.Cleanup(server.Close)
+	verifier, now := newTestVerifier(Config{JWKSURL: server.URL}, server.Client())
+	if _, err := verifier.keys.Key(context.Background(), "old"); err != nil {
+		t.Fatal(err)
+	}
+
+	keys = append(keys, rsaJWK("new", newKey))
+	*now = now.Add(minRefresh)
+	done := make(chan error, 1)
+	go func() {
+		_, err := verifier.keys.Key(context.Background(), "new")
+		done <- err
+	}()
+	<-fetching
+
+	// known keys don't wait for the fetch of an unknown one
+	if _, err := verifier.keys.Key(context.Background(), "old"); err != nil {
+		t.Errorf("expected the cached key during the fetch: %v", err)
+	}
+	close(release)
+	if err := <-done; err != nil {
+		t.Errorf("expected the rotated key to be fetched: %v", err)
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	verifier, _ := newTestVerifier(Config{Secret: "legacy-secret"}, nil)
+	var seen *Claims
+	handler := verifier.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen = FromContext(r.Context())
+	}))
+
+	for name, test := range map[string]struct {
+		header  string
+		query   string
+		status  int
+		subject string
+	}{
+		"valid":             {header: "Bearer " + signHS256(t, "legacy-secret", testClaims(nil)), status: http.StatusOK, subject: "user-1"},
+		"invalid":           {header: "Bearer " + signHS256(t, "other-secret", testClaims(nil)), status: http.StatusUnauthorized},
+		"no token":          {status: http.StatusOK},
+		"not a jwt":         {header: "Bearer api-key", status: http.StatusOK},
+		"websocket":         {query: "?access_token=" + signHS256(t, "legacy-secret", testClaims(nil)), status: http.StatusOK, subject: "user-1"},
+		"invalid websocket": {query: "?access_token=" + signHS256(t, "other-secret", testClaims(nil)), status: http.StatusUnauthorized},
+	} {
+		seen = nil
+		req := httptest.NewRequest(http.MethodGet, "/ws/agent/1/"+test.query, nil)
+		if test.header != "" {
+			req.Header.Set("Authorization", test.header)
+		}
+		if test.query != "" {
+			req.Header.Set("Upgrade", "websocket")
+		}
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, req)
+
+		if recorder.Code != test.status {
+			t.Errorf("%s: expected %d, got %d", name, test.status, recorder.Code)
+		}
+		subject := ""
+		if seen != nil {
+			subject = seen.Subject
+		}
+		if subject != test.subject {
+			t.Errorf("%s: expected subject %q, got %q", name, test.subject, subject)
+		}
+	}
+}
+
+func TestSign(t *testing.T) {
+	verifier, _ := newTestVerifier(Config{Secret: "legacy-secret"}, nil)
+	token, err := Sign(verifier.config, Claims{Subject: "user-1", SessionID: "session-1"}, testNow, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	claims, err := verifier.Verify(context.Background(), token)
+	if err != nil || claims.Subject != "user-1" || claims.SessionID != "session-1" || claims.Issuer != testIssuer {
+		t.Errorf("unexpected claims %+v: %v", claims, err)
+	}
+
+	if _, err := Sign(Config{}, Claims{Subject: "user-1"}, testNow, time.Minute); !errors.Is(err, ErrNoSecret) {
+		t.Errorf("expected signing without a secret to fail, got %v", err)
+	}
+}
+
+type fakeSessions map[string]bool
+
+func (s fakeSessions) Revoked(ctx context.Context, sessionID string) (bool, error) {
+	if sessionID == "unreachable" {
+		return false, kerrors.New(kerrors.BackendUnavailable, "postgres is unreachable")
+	}
+	return s[sessionID], nil
+}
+
+func TestRevokedSessions(t *testing.T) {
+	verifier, _ := newTestVerifier(Config{Secret: "legacy-secret"}, nil)
+	verifier.SetSessions(fakeSessions{"revoked": true})
+
+	for sessionID, expected := range map[string]error{
+		"":            nil,
+		"active":      nil,
+		"revoked":     ErrInvalidToken,
+		"unreachable": kerrors.ErrBackendUnavailable,
+	} {
+		token, err := Sign(verifier.config, Claims{Subject: "user-1", SessionID: sessionID}, testNow, time.Minute)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = verifier.Verify(context.Background(), token)
+		if (expected == nil && err != nil) || (expected != nil && !errors.Is(err, expected)) {
+			t.Errorf("expected a token of session %q to fail with %v, got %v", sessionID, expected, err)
+		}
+	}
+}
@@ -0,0 +1,33 @@
+package kerrors
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// Body returns the JSON error body of err.
+func Body(err error) map[string]interface{} {
+	code := CodeOf(err)
+	body := map[string]interface{}{
+		"status":  "error",
+		"code":    code,
+		"message": err.Error(),
+	}
+	if fix := RemediationOf(err); fix != "" {
+		body["remediation"] = fix
+	}
+	return body
+}
+
+// WriteJSON writes the JSON error body of err with the status of its code.
+func WriteJSON(w http.ResponseWriter, err error) {
+	WriteJSONStatus(w, HTTPStatus(CodeOf(err)), err)
+}
+
+// WriteJSONStatus writes the JSON error body of err with status, for errors
+// whose status depends on more than their code.
+func WriteJSONStatus(w http.ResponseWriter, status int, err error) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(Body(err))
+}
@@ -0,0 +1,193 @@
+// Package kerrors defines the error codes of the API and the errors carrying
+// them.
+//
+// Error responses are JSON bodies with a machine-readable code next to the
+// message, and a remediation telling the user how to fix the problem:
+//
+//	{"status": "error", "code": "quota_exceeded", "message": "...", "remediation": "..."}
+//
+// The codes are part of the API; the CLI maps them to the same codes in
+// pkg/kerrors to render suggested fixes. Errors are matched by code, so
+// errors.Is(err, kerrors.ErrBackendUnavailable) holds for every error with
+// that code, whatever its message. Errors created with New only match
+// themselves, so packages can declare their own sentinels with a code.
+package kerrors
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+type Code string
+
+const (
+	NotAuthenticated   Code = "not_authenticated"
+	PermissionDenied   Code = "permission_denied"
+	NotFound           Code = "not_found"
+	InvalidArgument    Code = "invalid_argument"
+	Conflict           Code = "conflict"
+	QuotaExceeded      Code = "quota_exceeded"
+	RateLimited        Code = "rate_limited"
+	BackendUnavailable Code = "backend_unavailable"
+	Timeout            Code = "timeout"
+	Internal           Code = "internal"
+)
+
+// The errors of each code. They match every error with their code.
+var (
+	ErrNotAuthenticated   = class(NotAuthenticated, "not authenticated")
+	ErrPermissionDenied   = class(PermissionDenied, "permission denied")
+	ErrNotFound           = class(NotFound, "not found")
+	ErrInvalidArgument    = class(InvalidArgument, "invalid argument")
+	ErrConflict           = class(Conflict, "conflict")
+	ErrQuotaExceeded      = class(QuotaExceeded, "quota exceeded")
+	ErrRateLimited        = class(RateLimited, "rate limited")
+	ErrBackendUnavailable = class(BackendUnavailable, "backend unavailable")
+	ErrTimeout            = class(Timeout, "timed out")
+)
+
+// remediations are the fixes suggested for errors that don't name their own.
+var remediations = map[Code]string{
+	NotAuthenticated:   "Check the API key sent in the X-API-Key header, it may have expired or been revoked.",
+	PermissionDenied:   "Ask an administrator of the organization for a role that allows this action.",
+	QuotaExceeded:      "Stop workspaces you don't need or ask an administrator to raise the limit.",
+	RateLimited:        "Wait a moment before retrying, and back off on repeated failures.",
+	BackendUnavailable: "A service the server depends on is unreachable. Retry later; if it persists, check the health of the databases and brokers.",
+	Timeout:            "Retry the request; if it keeps timing out, check the load of the server.",
+}
+
+// Error is an error with a code.
+type Error struct {
+	Code    Code
+	Message string
+	// Remediation overrides the default remediation of the code.
+	Remediation string
+	Err         error
+
+	// class is set for the Err values matching every error of their code.
+	class bool
+}
+
+func class(code Code, message string) *Error {
+	return &Error{Code: code, Message: message, class: true}
+}
+
+// New returns an error with a code and a message.
+func New(code Code, message string) *Error {
+	return &Error{Code: code, Message: message}
+}
+
+// Errorf returns an error with a code and a message formatted like
+// fmt.Errorf, including wrapping with %w.
+func Errorf(code Code, format string, args ...interface{}) *Error {
+	err := fmt.Errorf(format, args...)
+	return &Error{Code: code, Message: err.Error(), Err: errors.Unwrap(err)}
+}
+
+// Wrap returns err with a code, keeping its message. Wrapping nil returns
+// nil.
+func Wrap(code Code, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &Error{Code: code, Err: err}
+}
+
+func (e *Error) Error() string {
+	if e.Message == "" && e.Err != nil {
+		return e.Err.Error()
+	}
+	return e.Message
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Is matches the Err value of the code.
+func (e *Error) Is(target error) bool {
+	t, ok := target.(*Error)
+	return ok && t.class && t.Code == e.Code
+}
+
+// WithRemediation returns a copy of the error suggesting fix.
+func (e *Error) WithRemediation(fix string) *Error {
+	copied := *e
+	copied.Remediation = fix
+	copied.class = false
+	return &copied
+}
+
+// CodeOf returns the code of err: the code of the first Error it wraps,
+// Timeout for deadlines, or Internal.
+func CodeOf(err error) Code {
+	var coded *Error
+	switch {
+	case errors.As(err, &coded):
+		return coded.Code
+	case errors.Is(err, context.DeadlineExceeded):
+		return Timeout
+	default:
+		return Internal
+	}
+}
+
+// RemediationOf returns the fix suggested for err, or "" if there is none.
+func RemediationOf(err error) string {
+	var coded *Error
+	if errors.As(err, &coded) && coded.Remediation != "" {
+		return coded.Remediation
+	}
+	return remediations[CodeOf(err)]
+}
+
+// HTTPStatus returns the status of responses for errors with the code.
+func HTTPStatus(code Code) int {
+	switch code {
+	case NotAuthenticated:
+		return http.StatusUnauthorized
+	case PermissionDenied:
+		return http.StatusForbidden
+	case NotFound:
+		return http.StatusNotFound
+	case InvalidArgument:
+		return http.StatusBadRequest
+	case Conflict:
+		return http.StatusConflict
+	case QuotaExceeded, RateLimited:
+		return http.StatusTooManyRequests
+	case BackendUnavailable:
+		return http.StatusServiceUnavailable
+	case Timeout:
+		return http.StatusGatewayTimeout
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// FromHTTPStatus returns the code of responses with status, for errors
+// that don't carry one.
+func FromHTTPStatus(status int) Code {
+	switch status {
+	case http.StatusUnauthorized:
+		return NotAuthenticated
+	case http.StatusForbidden:
+		return PermissionDenied
+	case http.StatusNotFound:
+		return NotFound
+	case http.StatusBadRequest, http.StatusUnprocessableEntity:
+		return InvalidArgument
+	case http.StatusConflict:
+		return Conflict
+	case http.StatusTooManyRequests:
+		return RateLimited
+	case http.StatusBadGateway, http.StatusServiceUnavailable:
+		return BackendUnavailable
+	case http.StatusGatewayTimeout:
+		return Timeout
+	default:
+		return Internal
+	}
+}
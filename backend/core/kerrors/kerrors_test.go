@@ -0,0 +1,75 @@
+package kerrors
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestMatching(t *testing.T) {
+	errUnreachable := New(BackendUnavailable, "DragonflyDB is unreachable")
+	wrapped := fmt.Errorf("error loading state: %w", errUnreachable)
+
+	if !errors.Is(wrapped, ErrBackendUnavailable) || !errors.Is(wrapped, errUnreachable) {
+		t.Error("expected the error to match its code and itself")
+	}
+	if errors.Is(New(BackendUnavailable, "other"), errUnreachable) {
+		t.Error("expected errors created with New to only match themselves")
+	}
+	if errors.Is(wrapped, ErrTimeout) {
+		t.Error("expected the error not to match other codes")
+	}
+	if CodeOf(wrapped) != BackendUnavailable || CodeOf(errors.New("plain")) != Internal {
+		t.Errorf("unexpected codes %s and %s", CodeOf(wrapped), CodeOf(errors.New("plain")))
+	}
+	if CodeOf(fmt.Errorf("query: %w", context.DeadlineExceeded)) != Timeout {
+		t.Error("expected deadlines to time out")
+	}
+}
+
+func TestErrorf(t *testing.T) {
+	cause := errors.New("connection refused")
+	err := Errorf(BackendUnavailable, "error connecting to %s: %w", "postgres", cause)
+	if err.Error() != "error connecting to postgres: connection refused" || !errors.Is(err, cause) {
+		t.Errorf("unexpected error %v", err)
+	}
+	if Wrap(NotFound, nil) != nil || Wrap(NotFound, cause).Error() != "connection refused" {
+		t.Error("expected Wrap to keep the message")
+	}
+}
+
+func TestRemediation(t *testing.T) {
+	if RemediationOf(ErrQuotaExceeded) == "" || RemediationOf(errors.New("plain")) != "" {
+		t.Error("expected the default remediations of the codes")
+	}
+	err := fmt.Errorf("start: %w", New(QuotaExceeded, "too many workspaces").WithRemediation("Stop a workspace."))
+	if RemediationOf(err) != "Stop a workspace." {
+		t.Errorf("unexpected remediation %q", RemediationOf(err))
+	}
+}
+
+func TestWriteJSON(t *testing.T) {
+	recorder := httptest.NewRecorder()
+	WriteJSON(recorder, fmt.Errorf("create workspace: %w", New(QuotaExceeded, "quota exceeded for user 1")))
+	if recorder.Code != http.StatusTooManyRequests {
+		t.Errorf("unexpected status %d", recorder.Code)
+	}
+
+	body := map[string]string{}
+	if err := json.Unmarshal(recorder.Body.Bytes(), &body); err != nil {
+		t.Fatal(err)
+	}
+	if body["status"] != "error" || body["code"] != "quota_exceeded" || body["message"] != "create workspace: quota exceeded for user 1" || body["remediation"] == "" {
+		t.Errorf("unexpected body %v", body)
+	}
+
+	for status := range map[int]bool{http.StatusUnauthorized: true, http.StatusNotFound: true, http.StatusServiceUnavailable: true} {
+		if HTTPStatus(FromHTTPStatus(status)) != status {
+			t.Errorf("expected %d to map back to itself", status)
+		}
+	}
+}
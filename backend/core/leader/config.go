@@ -0,0 +1,78 @@
+package leader
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/spectrumwebco/agent_runtime/backend/core/config/env"
+	"github.com/spectrumwebco/agent_runtime/backend/db/integrations"
+)
+
+// The backends keeping the lease.
+const (
+	BackendDragonfly  = "dragonfly"
+	BackendKubernetes = "kubernetes"
+)
+
+type Config struct {
+	Backend string `json:"backend"`
+	// Namespace holds the Leases of the kubernetes backend.
+	Namespace string `json:"namespace,omitempty"`
+	// LeaseDuration is how long other replicas wait for a leader that
+	// stopped renewing before they take over.
+	LeaseDuration time.Duration `json:"lease_duration"`
+	// RenewDeadline is how long a leader keeps leading while its renewals
+	// fail. It must be shorter than LeaseDuration.
+	RenewDeadline time.Duration `json:"renew_deadline"`
+	// RenewPeriod is the time between renewals, RetryPeriod the time
+	// between campaigns.
+	RenewPeriod time.Duration `json:"renew_period"`
+	RetryPeriod time.Duration `json:"retry_period"`
+}
+
+const (
+	DefaultLeaseDuration = 15 * time.Second
+	DefaultRenewDeadline = 10 * time.Second
+	DefaultRenewPeriod   = 2 * time.Second
+	DefaultRetryPeriod   = 2 * time.Second
+)
+
+func FromEnv() Config {
+	config := Config{
+		Backend:       BackendDragonfly,
+		Namespace:     "default",
+		LeaseDuration: DefaultLeaseDuration,
+		RenewDeadline: DefaultRenewDeadline,
+		RenewPeriod:   DefaultRenewPeriod,
+		RetryPeriod:   DefaultRetryPeriod,
+	}
+	read := env.NewReader(leaderLogger)
+	read.OneOf("AGENT_LEADER_BACKEND", &config.Backend, BackendDragonfly, BackendKubernetes)
+	read.String("AGENT_LEADER_NAMESPACE", &config.Namespace)
+	read.PositiveDuration("AGENT_LEADER_LEASE_DURATION", &config.LeaseDuration)
+	read.PositiveDuration("AGENT_LEADER_RENEW_DEADLINE", &config.RenewDeadline)
+	read.PositiveDuration("AGENT_LEADER_RENEW_PERIOD", &config.RenewPeriod)
+	read.PositiveDuration("AGENT_LEADER_RETRY_PERIOD", &config.RetryPeriod)
+	if config.RenewDeadline >= config.LeaseDuration {
+		leaderLogger.Printf("The renew deadline %s must be shorter than the lease duration %s, using the defaults", config.RenewDeadline, config.LeaseDuration)
+		config.LeaseDuration, config.RenewDeadline = DefaultLeaseDuration, DefaultRenewDeadline
+	}
+	return config
+}
+
+// NewElectorFromConfig returns the elector of an election on the backend
+// of config.
+func NewElectorFromConfig(name string, config Config) (*Elector, error) {
+	switch config.Backend {
+	case BackendKubernetes:
+		lock, err := NewLeaseLock(config.Namespace, name)
+		if err != nil {
+			return nil, err
+		}
+		return NewElector(name, lock, config), nil
+	case BackendDragonfly, "":
+		return NewElector(name, NewDragonflyLock(integrations.GetLocker(), name), config), nil
+	default:
+		return nil, fmt.Errorf("unknown leader election backend %q", config.Backend)
+	}
+}
@@ -0,0 +1,32 @@
+package leader
+
+import (
+	"context"
+	"time"
+
+	"github.com/spectrumwebco/agent_runtime/backend/db/integrations"
+)
+
+// DragonflyLock keeps the lease in a Dragonfly key holding the identity of
+// the leader, which expires unless renewed.
+type DragonflyLock struct {
+	locker integrations.Locker
+	key    string
+}
+
+func NewDragonflyLock(locker integrations.Locker, name string) *DragonflyLock {
+	return &DragonflyLock{locker: locker, key: "kled:leader:" + name}
+}
+
+func (l *DragonflyLock) Acquire(ctx context.Context, identity string, ttl time.Duration) (bool, error) {
+	renewed, err := l.locker.RenewLock(l.key, identity, ttl)
+	if err != nil || renewed {
+		return renewed, err
+	}
+	return l.locker.AcquireLock(l.key, identity, ttl)
+}
+
+func (l *DragonflyLock) Release(ctx context.Context, identity string) error {
+	_, err := l.locker.ReleaseLock(l.key, identity)
+	return err
+}
@@ -0,0 +1,138 @@
+package leader
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	coordinationv1 "k8s.io/api/coordination/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+// LeaseLock keeps the lease in a coordination.k8s.io Lease. Expiry is
+// judged by the clock of the replica reading the Lease, so the clocks of
+// the replicas must not drift apart by more than the lease duration.
+type LeaseLock struct {
+	client    kubernetes.Interface
+	namespace string
+	name      string
+	now       func() time.Time
+}
+
+// NewLeaseLock uses the in-cluster config and falls back to the default
+// kubeconfig.
+func NewLeaseLock(namespace, name string) (*LeaseLock, error) {
+	config, err := rest.InClusterConfig()
+	if errors.Is(err, rest.ErrNotInCluster) {
+		config, err = clientcmd.NewNonInteractiveDeferredLoadingClientConfig(
+			clientcmd.NewDefaultClientConfigLoadingRules(),
+			&clientcmd.ConfigOverrides{},
+		).ClientConfig()
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error loading kubernetes config: %v", err)
+	}
+
+	client, err := kubernetes.NewForConfig(config)
+	if err != nil {
+		return nil, fmt.Errorf("error creating kubernetes client: %v", err)
+	}
+	return NewLeaseLockForClient(client, namespace, name), nil
+}
+
+func NewLeaseLockForClient(client kubernetes.Interface, namespace, name string) *LeaseLock {
+	return &LeaseLock{client: client, namespace: namespace, name: "kled-" + name, now: time.Now}
+}
+
+func (l *LeaseLock) Acquire(ctx context.Context, identity string, ttl time.Duration) (bool, error) {
+	leases := l.client.CoordinationV1().Leases(l.namespace)
+	now := metav1.NewMicroTime(l.now())
+	seconds := int32(ttl.Seconds())
+
+	lease, err := leases.Get(ctx, l.name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		_, err = leases.Create(ctx, &coordinationv1.Lease{
+			ObjectMeta: metav1.ObjectMeta{Name: l.name, Namespace: l.namespace},
+			Spec: coordinationv1.LeaseSpec{
+				HolderIdentity:       &identity,
+				LeaseDurationSeconds: &seconds,
+				AcquireTime:          &now,
+				RenewTime:            &now,
+			},
+		}, metav1.CreateOptions{})
+		if apierrors.IsAlreadyExists(err) {
+			return false, nil
+		}
+		if err != nil {
+			return false, fmt.Errorf("error creating lease %s: %v", l.name, err)
+		}
+		return true, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("error loading lease %s: %v", l.name, err)
+	}
+
+	holder := ""
+	if lease.Spec.HolderIdentity != nil {
+		holder = *lease.Spec.HolderIdentity
+	}
+	if holder != identity && holder != "" && !l.expired(lease) {
+		return false, nil
+	}
+	if holder != identity {
+		lease.Spec.AcquireTime = &now
+		transitions := int32(1)
+		if lease.Spec.LeaseTransitions != nil {
+			transitions += *lease.Spec.LeaseTransitions
+		}
+		lease.Spec.LeaseTransitions = &transitions
+	}
+	lease.Spec.HolderIdentity = &identity
+	lease.Spec.LeaseDurationSeconds = &seconds
+	lease.Spec.RenewTime = &now
+
+	// the update is conditional on the resource version read, so of two
+	// replicas taking over an expired lease only one succeeds
+	if _, err := leases.Update(ctx, lease, metav1.UpdateOptions{}); apierrors.IsConflict(err) {
+		return false, nil
+	} else if err != nil {
+		return false, fmt.Errorf("error updating lease %s: %v", l.name, err)
+	}
+	return true, nil
+}
+
+func (l *LeaseLock) expired(lease *coordinationv1.Lease) bool {
+	if lease.Spec.RenewTime == nil || lease.Spec.LeaseDurationSeconds == nil {
+		return true
+	}
+	duration := time.Duration(*lease.Spec.LeaseDurationSeconds) * time.Second
+	return l.now().After(lease.Spec.RenewTime.Add(duration))
+}
+
+// Release clears the holder of the lease, so another replica can take it
+// over without waiting for it to expire.
+func (l *LeaseLock) Release(ctx context.Context, identity string) error {
+	leases := l.client.CoordinationV1().Leases(l.namespace)
+	lease, err := leases.Get(ctx, l.name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("error loading lease %s: %v", l.name, err)
+	}
+	if lease.Spec.HolderIdentity == nil || *lease.Spec.HolderIdentity != identity {
+		return nil
+	}
+
+	lease.Spec.HolderIdentity = nil
+	lease.Spec.RenewTime = nil
+	if _, err := leases.Update(ctx, lease, metav1.UpdateOptions{}); err != nil && !apierrors.IsConflict(err) {
+		return fmt.Errorf("error releasing lease %s: %v", l.name, err)
+	}
+	return nil
+}
@@ -0,0 +1,189 @@
+// Package leader elects one replica to run a singleton controller, such as
+// the workspace reconciler, in a multi-replica deployment.
+//
+// An Elector campaigns for a Lock: a lease with a holder and an expiry, kept
+// in Dragonfly or in a Kubernetes Lease. The leader renews the lease while
+// it runs the controller and steps down, cancelling the controller, once it
+// can't renew within the renew deadline. Other replicas take over when the
+// lease expires. The lease duration must exceed the renew deadline, so a
+// leader stops before another replica can take over.
+package leader
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var leaderLogger = log.New(os.Stdout, "kled.leader: ", log.LstdFlags)
+
+var (
+	leaderGauge = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "kled_leader",
+		Help: "Whether this replica leads an election, by election name.",
+	}, []string{"name"})
+	leaderTransitions = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "kled_leader_transitions_total",
+		Help: "Times this replica started or stopped leading, by election name and transition.",
+	}, []string{"name", "transition"})
+)
+
+func init() {
+	prometheus.MustRegister(leaderGauge, leaderTransitions)
+}
+
+// Lock is a lease held by one identity at a time.
+type Lock interface {
+	// Acquire takes the lease for identity, or renews it if identity holds
+	// it. It returns false while another identity holds an unexpired lease.
+	Acquire(ctx context.Context, identity string, ttl time.Duration) (bool, error)
+	// Release gives the lease up if identity holds it.
+	Release(ctx context.Context, identity string) error
+}
+
+// Elector campaigns for the lock of one election.
+type Elector struct {
+	name     string
+	identity string
+	lock     Lock
+	config   Config
+	leading  atomic.Bool
+}
+
+func NewElector(name string, lock Lock, config Config) *Elector {
+	host, _ := os.Hostname()
+	return &Elector{
+		name:     name,
+		identity: fmt.Sprintf("%s/%s", host, uuid.New().String()),
+		lock:     lock,
+		config:   config,
+	}
+}
+
+// Identity is the holder the elector acquires the lock as.
+func (e *Elector) Identity() string {
+	return e.identity
+}
+
+func (e *Elector) IsLeader() bool {
+	return e.leading.Load()
+}
+
+// Run campaigns until ctx is done, and runs fn whenever this replica leads.
+// The context of fn is cancelled when leadership is lost; Run waits for fn
+// to return before campaigning again.
+func (e *Elector) Run(ctx context.Context, fn func(ctx context.Context)) {
+	for {
+		acquired, err := e.lock.Acquire(ctx, e.identity, e.config.LeaseDuration)
+		if err != nil {
+			leaderLogger.Printf("Error acquiring the %s lease: %v", e.name, err)
+		}
+		if acquired {
+			e.lead(ctx, func(ctx context.Context) error {
+				fn(ctx)
+				return nil
+			})
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(e.config.RetryPeriod):
+		}
+	}
+}
+
+// Do runs fn once if no other replica leads, holding the lease while fn
+// runs. It returns false without running fn if another replica leads.
+func (e *Elector) Do(ctx context.Context, fn func(ctx context.Context) error) (bool, error) {
+	acquired, err := e.lock.Acquire(ctx, e.identity, e.config.LeaseDuration)
+	if err != nil {
+		return false, fmt.Errorf("error acquiring the %s lease: %v", e.name, err)
+	}
+	if !acquired {
+		return false, nil
+	}
+	return true, e.lead(ctx, fn)
+}
+
+// lead runs fn while renewing the lease, which it releases afterwards.
+func (e *Elector) lead(ctx context.Context, fn func(ctx context.Context) error) error {
+	e.setLeading(true)
+	defer e.setLeading(false)
+
+	leaderCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		fnErr error
+		wg    sync.WaitGroup
+	)
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		defer cancel()
+		fnErr = fn(leaderCtx)
+	}()
+
+	e.renew(leaderCtx, cancel)
+	wg.Wait()
+
+	// the lease outlives a cancelled ctx, so it is released without it
+	releaseCtx, cancelRelease := context.WithTimeout(context.Background(), e.config.RetryPeriod)
+	defer cancelRelease()
+	if err := e.lock.Release(releaseCtx, e.identity); err != nil {
+		leaderLogger.Printf("Error releasing the %s lease: %v", e.name, err)
+	}
+	return fnErr
+}
+
+// renew renews the lease every RenewPeriod until ctx is done, and calls
+// stop once the lease was lost or couldn't be renewed within the deadline.
+func (e *Elector) renew(ctx context.Context, stop func()) {
+	ticker := time.NewTicker(e.config.RenewPeriod)
+	defer ticker.Stop()
+
+	renewed := time.Now()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		held, err := e.lock.Acquire(ctx, e.identity, e.config.LeaseDuration)
+		switch {
+		case err == nil && held:
+			renewed = time.Now()
+			continue
+		case err == nil:
+			leaderLogger.Printf("Lost the %s lease to another replica", e.name)
+		case time.Since(renewed) < e.config.RenewDeadline:
+			leaderLogger.Printf("Error renewing the %s lease: %v", e.name, err)
+			continue
+		default:
+			leaderLogger.Printf("Couldn't renew the %s lease within %s: %v", e.name, e.config.RenewDeadline, err)
+		}
+		stop()
+		return
+	}
+}
+
+func (e *Elector) setLeading(leading bool) {
+	e.leading.Store(leading)
+	if leading {
+		leaderGauge.WithLabelValues(e.name).Set(1)
+		leaderTransitions.WithLabelValues(e.name, "started").Inc()
+		leaderLogger.Printf("Leading %s as %s", e.name, e.identity)
+		return
+	}
+	leaderGauge.WithLabelValues(e.name).Set(0)
+	leaderTransitions.WithLabelValues(e.name, "stopped").Inc()
+	leaderLogger.Printf("Stopped leading %s", e.name)
+}
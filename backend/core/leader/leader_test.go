@@ -0,0 +1,125 @@
+package leader
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/spectrumwebco/agent_runtime/backend/db/integrations/integrationsmock"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+var testConfig = Config{
+	LeaseDuration: 150 * time.Millisecond,
+	RenewDeadline: 100 * time.Millisecond,
+	RenewPeriod:   10 * time.Millisecond,
+	RetryPeriod:   10 * time.Millisecond,
+}
+
+func TestElectorsTakeTurns(t *testing.T) {
+	kv := integrationsmock.NewKVStore()
+	first := NewElector("test", NewDragonflyLock(kv, "test"), testConfig)
+	second := NewElector("test", NewDragonflyLock(kv, "test"), testConfig)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	leading := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		first.Run(ctx, func(ctx context.Context) {
+			close(leading)
+			<-ctx.Done()
+		})
+	}()
+	<-leading
+	if !first.IsLeader() {
+		t.Fatalf("expected the first elector to lead")
+	}
+
+	// the lease is renewed past its duration while the leader runs
+	time.Sleep(2 * testConfig.LeaseDuration)
+	if ran, err := second.Do(context.Background(), func(context.Context) error { return nil }); err != nil || ran {
+		t.Fatalf("expected the second elector not to lead, got %v (%v)", ran, err)
+	}
+
+	// stepping down releases the lease at once
+	cancel()
+	<-stopped
+	if first.IsLeader() {
+		t.Errorf("expected the first elector to step down")
+	}
+	ran, err := second.Do(context.Background(), func(context.Context) error {
+		if !second.IsLeader() {
+			t.Errorf("expected the second elector to lead while running")
+		}
+		return nil
+	})
+	if err != nil || !ran {
+		t.Errorf("expected the second elector to lead, got %v (%v)", ran, err)
+	}
+}
+
+func TestLeaderStepsDownWhenLeaseIsLost(t *testing.T) {
+	kv := integrationsmock.NewKVStore()
+	elector := NewElector("test", NewDragonflyLock(kv, "test"), testConfig)
+
+	done := make(chan error)
+	go func() {
+		_, err := elector.Do(context.Background(), func(ctx context.Context) error {
+			<-ctx.Done()
+			return ctx.Err()
+		})
+		done <- err
+	}()
+
+	time.Sleep(testConfig.RenewPeriod)
+	kv.Delete("kled:leader:test")
+	kv.AcquireLock("kled:leader:test", "usurper", time.Minute)
+	select {
+	case err := <-done:
+		if err == nil {
+			t.Errorf("expected the leader's context to be cancelled")
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("expected the leader to step down")
+	}
+}
+
+func TestLeaseLock(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+	lock := NewLeaseLockForClient(fake.NewSimpleClientset(), "kled", "test")
+	lock.now = func() time.Time { return now }
+
+	for _, step := range []struct {
+		identity string
+		advance  time.Duration
+		acquired bool
+	}{
+		{"a", 0, true},
+		{"b", 0, false},
+		{"a", 10 * time.Second, true},
+		{"b", 10 * time.Second, false},
+		// a stopped renewing 20s ago
+		{"b", 10 * time.Second, true},
+		{"a", 0, false},
+	} {
+		now = now.Add(step.advance)
+		acquired, err := lock.Acquire(ctx, step.identity, 15*time.Second)
+		if err != nil || acquired != step.acquired {
+			t.Fatalf("expected %s acquiring to be %v, got %v (%v)", step.identity, step.acquired, acquired, err)
+		}
+	}
+
+	lease, _ := lock.client.CoordinationV1().Leases("kled").Get(ctx, "kled-test", metav1.GetOptions{})
+	if *lease.Spec.LeaseTransitions != 1 {
+		t.Errorf("expected one transition, got %d", *lease.Spec.LeaseTransitions)
+	}
+	if err := lock.Release(ctx, "b"); err != nil {
+		t.Fatal(err)
+	}
+	if acquired, err := lock.Acquire(ctx, "a", 15*time.Second); err != nil || !acquired {
+		t.Errorf("expected the released lease to be acquired, got %v (%v)", acquired, err)
+	}
+}
@@ -0,0 +1,254 @@
+// Package lifecycle coordinates graceful shutdown of backend services.
+//
+// Services register closers with a ShutdownManager under one of the ordered
+// phases below. On SIGTERM or SIGINT the manager runs each phase in turn,
+// running the closers within a phase concurrently, and gives up once the
+// shutdown deadline has passed.
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"sort"
+	"sync"
+	"syscall"
+	"time"
+)
+
+var shutdownLogger = log.New(os.Stdout, "kled.lifecycle: ", log.LstdFlags)
+
+// Phase determines the order in which closers run. Lower phases run first.
+type Phase int
+
+const (
+	// PhaseStopAccepting stops HTTP, gRPC and WebSocket listeners.
+	PhaseStopAccepting Phase = iota
+	// PhaseDrainConsumers stops Kafka and RocketMQ consumers after their
+	// in-flight messages have been handled.
+	PhaseDrainConsumers
+	// PhaseFlushProducers flushes buffered Kafka and RocketMQ messages.
+	PhaseFlushProducers
+	// PhaseClosePools closes Dragonfly and Postgres connection pools.
+	PhaseClosePools
+)
+
+func (p Phase) String() string {
+	switch p {
+	case PhaseStopAccepting:
+		return "stop-accepting"
+	case PhaseDrainConsumers:
+		return "drain-consumers"
+	case PhaseFlushProducers:
+		return "flush-producers"
+	case PhaseClosePools:
+		return "close-pools"
+	default:
+		return fmt.Sprintf("phase-%d", int(p))
+	}
+}
+
+// Closer releases a resource. It should return promptly once ctx is done.
+type Closer func(ctx context.Context) error
+
+type registration struct {
+	phase  Phase
+	name   string
+	closer Closer
+}
+
+const DefaultShutdownTimeout = 30 * time.Second
+
+type ShutdownManager struct {
+	timeout       time.Duration
+	registrations []registration
+	done          chan struct{}
+	err           error
+	started       bool
+	mu            sync.Mutex
+}
+
+func NewShutdownManager(timeout time.Duration) *ShutdownManager {
+	if timeout <= 0 {
+		timeout = DefaultShutdownTimeout
+	}
+
+	return &ShutdownManager{
+		timeout: timeout,
+		done:    make(chan struct{}),
+	}
+}
+
+// Register adds a closer to run during phase. Closers registered after
+// shutdown has started are ignored.
+func (m *ShutdownManager) Register(phase Phase, name string, closer Closer) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.started {
+		shutdownLogger.Printf("Ignoring closer %s registered during shutdown", name)
+		return
+	}
+
+	m.registrations = append(m.registrations, registration{
+		phase:  phase,
+		name:   name,
+		closer: closer,
+	})
+}
+
+// ShuttingDown reports whether Shutdown has been called. Listeners can use it
+// to reject new connections while earlier phases are still running.
+func (m *ShutdownManager) ShuttingDown() bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.started
+}
+
+// Done is closed once every phase has finished or the deadline has passed.
+func (m *ShutdownManager) Done() <-chan struct{} {
+	return m.done
+}
+
+// Shutdown runs all registered closers phase by phase. It is safe to call more
+// than once; later calls wait for the first one and return its result.
+func (m *ShutdownManager) Shutdown(ctx context.Context) error {
+	m.mu.Lock()
+	if m.started {
+		m.mu.Unlock()
+		select {
+		case <-m.done:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		return m.err
+	}
+	m.started = true
+	registrations := append([]registration(nil), m.registrations...)
+	m.mu.Unlock()
+
+	ctx, cancel := context.WithTimeout(ctx, m.timeout)
+	defer cancel()
+
+	sort.SliceStable(registrations, func(i, j int) bool {
+		return registrations[i].phase < registrations[j].phase
+	})
+
+	var errs []error
+	for start := 0; start < len(registrations); {
+		end := start
+		for end < len(registrations) && registrations[end].phase == registrations[start].phase {
+			end++
+		}
+
+		if err := m.runPhase(ctx, registrations[start].phase, registrations[start:end]); err != nil {
+			errs = append(errs, err)
+		}
+		if ctx.Err() != nil {
+			errs = append(errs, fmt.Errorf("shutdown deadline of %s exceeded", m.timeout))
+			break
+		}
+		start = end
+	}
+
+	m.mu.Lock()
+	m.err = errors.Join(errs...)
+	m.mu.Unlock()
+	close(m.done)
+
+	return m.err
+}
+
+func (m *ShutdownManager) runPhase(ctx context.Context, phase Phase, registrations []registration) error {
+	shutdownLogger.Printf("Running shutdown phase %s (%d closers)", phase, len(registrations))
+
+	var (
+		wg   sync.WaitGroup
+		mu   sync.Mutex
+		errs []error
+	)
+	for _, r := range registrations {
+		wg.Add(1)
+		go func(r registration) {
+			defer wg.Done()
+
+			start := time.Now()
+			if err := r.closer(ctx); err != nil {
+				shutdownLogger.Printf("Error closing %s: %v", r.name, err)
+				mu.Lock()
+				errs = append(errs, fmt.Errorf("%s: %w", r.name, err))
+				mu.Unlock()
+				return
+			}
+			shutdownLogger.Printf("Closed %s in %s", r.name, time.Since(start).Round(time.Millisecond))
+		}(r)
+	}
+
+	finished := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(finished)
+	}()
+
+	select {
+	case <-finished:
+	case <-ctx.Done():
+		shutdownLogger.Printf("Shutdown phase %s interrupted by deadline", phase)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	return errors.Join(errs...)
+}
+
+// WaitForSignal blocks until one of signals (SIGTERM and SIGINT by default) is
+// received and then runs Shutdown.
+func (m *ShutdownManager) WaitForSignal(signals ...os.Signal) error {
+	if len(signals) == 0 {
+		signals = []os.Signal{syscall.SIGTERM, os.Interrupt}
+	}
+
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, signals...)
+	defer signal.Stop(sigCh)
+
+	select {
+	case sig := <-sigCh:
+		shutdownLogger.Printf("Received signal %v, shutting down", sig)
+	case <-m.done:
+		return m.err
+	}
+
+	return m.Shutdown(context.Background())
+}
+
+// HTTPServer returns a closer that stops srv from accepting new connections
+// and waits for active requests to finish.
+func HTTPServer(srv *http.Server) Closer {
+	return func(ctx context.Context) error {
+		return srv.Shutdown(ctx)
+	}
+}
+
+// Func adapts a closer without a context or error, such as KafkaClient.Close.
+func Func(fn func()) Closer {
+	return func(ctx context.Context) error {
+		fn()
+		return nil
+	}
+}
+
+var defaultManager = NewShutdownManager(DefaultShutdownTimeout)
+
+func DefaultManager() *ShutdownManager {
+	return defaultManager
+}
+
+func Register(phase Phase, name string, closer Closer) {
+	defaultManager.Register(phase, name, closer)
+}
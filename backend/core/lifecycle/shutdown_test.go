@@ -0,0 +1,85 @@
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestShutdownRunsPhasesInOrder(t *testing.T) {
+	m := NewShutdownManager(time.Second)
+
+	var (
+		mu    sync.Mutex
+		order []string
+	)
+	record := func(name string) Closer {
+		return func(ctx context.Context) error {
+			mu.Lock()
+			defer mu.Unlock()
+			order = append(order, name)
+			return nil
+		}
+	}
+
+	m.Register(PhaseClosePools, "pool", record("pool"))
+	m.Register(PhaseStopAccepting, "http", record("http"))
+	m.Register(PhaseFlushProducers, "producer", record("producer"))
+	m.Register(PhaseDrainConsumers, "consumer", record("consumer"))
+
+	if err := m.Shutdown(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expected := []string{"http", "consumer", "producer", "pool"}
+	if len(order) != len(expected) {
+		t.Fatalf("expected %v, got %v", expected, order)
+	}
+	for i := range expected {
+		if order[i] != expected[i] {
+			t.Fatalf("expected %v, got %v", expected, order)
+		}
+	}
+
+	if !m.ShuttingDown() {
+		t.Fatal("expected manager to report shutting down")
+	}
+}
+
+func TestShutdownCollectsErrorsAndEnforcesDeadline(t *testing.T) {
+	m := NewShutdownManager(50 * time.Millisecond)
+
+	closeErr := errors.New("boom")
+	m.Register(PhaseStopAccepting, "failing", func(ctx context.Context) error {
+		return closeErr
+	})
+	m.Register(PhaseDrainConsumers, "stuck", func(ctx context.Context) error {
+		select {}
+	})
+
+	ranPools := false
+	m.Register(PhaseClosePools, "pool", func(ctx context.Context) error {
+		ranPools = true
+		return nil
+	})
+
+	start := time.Now()
+	err := m.Shutdown(context.Background())
+	if time.Since(start) > time.Second {
+		t.Fatal("shutdown did not respect its deadline")
+	}
+	if !errors.Is(err, closeErr) {
+		t.Fatalf("expected error to wrap closer error, got %v", err)
+	}
+	if ranPools {
+		t.Fatal("expected phases after the deadline to be skipped")
+	}
+
+	select {
+	case <-m.Done():
+	default:
+		t.Fatal("expected Done to be closed")
+	}
+}
@@ -0,0 +1,110 @@
+package llm
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/spectrumwebco/agent_runtime/backend/core/tenancy"
+)
+
+type Operation string
+
+const (
+	OperationChat       Operation = "chat"
+	OperationEmbeddings Operation = "embeddings"
+)
+
+// UsageRecord is the token usage of one call to a provider.
+type UsageRecord struct {
+	Tenant    tenancy.Tenant `json:"tenant"`
+	Provider  string         `json:"provider"`
+	Model     string         `json:"model"`
+	Operation Operation      `json:"operation"`
+	Usage
+	OccurredAt time.Time `json:"occurred_at"`
+}
+
+// Accountant receives the usage of every call the gateway made.
+type Accountant interface {
+	Record(ctx context.Context, record UsageRecord) error
+}
+
+type AccountantFunc func(ctx context.Context, record UsageRecord) error
+
+func (f AccountantFunc) Record(ctx context.Context, record UsageRecord) error {
+	return f(ctx, record)
+}
+
+// ModelUsage is the usage of one provider model by a tenant.
+type ModelUsage struct {
+	Provider string `json:"provider"`
+	Model    string `json:"model"`
+	Requests int    `json:"requests"`
+	Usage
+}
+
+// MemoryAccountant totals the usage of each tenant since the process
+// started.
+type MemoryAccountant struct {
+	usage map[tenancy.Tenant]map[[2]string]*ModelUsage
+	mu    sync.Mutex
+}
+
+func NewMemoryAccountant() *MemoryAccountant {
+	return &MemoryAccountant{usage: make(map[tenancy.Tenant]map[[2]string]*ModelUsage)}
+}
+
+func (a *MemoryAccountant) Record(ctx context.Context, record UsageRecord) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	models := a.usage[record.Tenant]
+	if models == nil {
+		models = make(map[[2]string]*ModelUsage)
+		a.usage[record.Tenant] = models
+	}
+	key := [2]string{record.Provider, record.Model}
+	usage := models[key]
+	if usage == nil {
+		usage = &ModelUsage{Provider: record.Provider, Model: record.Model}
+		models[key] = usage
+	}
+	usage.Requests++
+	usage.PromptTokens += record.PromptTokens
+	usage.CompletionTokens += record.CompletionTokens
+	return nil
+}
+
+// Usage returns the usage of a tenant by provider and model.
+func (a *MemoryAccountant) Usage(tenant tenancy.Tenant) []ModelUsage {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	usage := []ModelUsage{}
+	for _, model := range a.usage[tenant] {
+		usage = append(usage, *model)
+	}
+	sort.Slice(usage, func(i, j int) bool {
+		if usage[i].Provider != usage[j].Provider {
+			return usage[i].Provider < usage[j].Provider
+		}
+		return usage[i].Model < usage[j].Model
+	})
+	return usage
+}
+
+// MultiAccountant records usage with each accountant in turn, returning the
+// first error.
+type MultiAccountant []Accountant
+
+func (m MultiAccountant) Record(ctx context.Context, record UsageRecord) error {
+	var first error
+	for _, accountant := range m {
+		if err := accountant.Record(ctx, record); err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
@@ -0,0 +1,163 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+const (
+	anthropicVersion = "2023-06-01"
+	// DefaultMaxTokens bounds completions of providers that require a bound
+	// when the request sets none.
+	DefaultMaxTokens = 4096
+)
+
+// Anthropic calls the Anthropic Messages API. It has no embeddings.
+type Anthropic struct {
+	httpProvider
+}
+
+func NewAnthropic(name, baseURL string, client *http.Client, keys *KeyCache, vaultPath string) *Anthropic {
+	return &Anthropic{httpProvider{name: name, baseURL: baseURL, client: client, keys: keys, vaultPath: vaultPath}}
+}
+
+type anthropicUsage struct {
+	InputTokens  int `json:"input_tokens"`
+	OutputTokens int `json:"output_tokens"`
+}
+
+func (p *Anthropic) header(header http.Header, key string) {
+	header.Set("anthropic-version", anthropicVersion)
+	if key != "" {
+		header.Set("x-api-key", key)
+	}
+}
+
+// messagesRequest moves system messages to the system prompt, which the
+// Messages API takes separately.
+func (p *Anthropic) messagesRequest(request ChatRequest, stream bool) map[string]interface{} {
+	var system []string
+	messages := []Message{}
+	for _, message := range request.Messages {
+		if message.Role == RoleSystem {
+			system = append(system, message.Content)
+			continue
+		}
+		messages = append(messages, message)
+	}
+
+	body := map[string]interface{}{
+		"model":      request.Model,
+		"messages":   messages,
+		"max_tokens": request.MaxTokens,
+	}
+	if request.MaxTokens == 0 {
+		body["max_tokens"] = DefaultMaxTokens
+	}
+	if len(system) > 0 {
+		body["system"] = strings.Join(system, "\n\n")
+	}
+	if request.Temperature != nil {
+		body["temperature"] = *request.Temperature
+	}
+	if len(request.Stop) > 0 {
+		body["stop_sequences"] = request.Stop
+	}
+	if stream {
+		body["stream"] = true
+	}
+	return body
+}
+
+func (p *Anthropic) Chat(ctx context.Context, request ChatRequest) (*ChatResponse, error) {
+	response, err := p.post(ctx, "/messages", p.messagesRequest(request, false), p.header)
+	if err != nil {
+		return nil, err
+	}
+
+	var decoded struct {
+		Content []struct {
+			Type string `json:"type"`
+			Text string `json:"text"`
+		} `json:"content"`
+		StopReason string         `json:"stop_reason"`
+		Usage      anthropicUsage `json:"usage"`
+	}
+	if err := decodeJSON(response, &decoded); err != nil {
+		return nil, fmt.Errorf("error decoding %s response: %v", p.name, err)
+	}
+
+	var content strings.Builder
+	for _, block := range decoded.Content {
+		if block.Type == "text" {
+			content.WriteString(block.Text)
+		}
+	}
+	return &ChatResponse{
+		Provider:     p.name,
+		Model:        request.Model,
+		Content:      content.String(),
+		FinishReason: decoded.StopReason,
+		Usage:        Usage{PromptTokens: decoded.Usage.InputTokens, CompletionTokens: decoded.Usage.OutputTokens},
+	}, nil
+}
+
+func (p *Anthropic) ChatStream(ctx context.Context, request ChatRequest, onDelta func(string) error) (*ChatResponse, error) {
+	response, err := p.post(ctx, "/messages", p.messagesRequest(request, true), p.header)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+
+	result := &ChatResponse{Provider: p.name, Model: request.Model}
+	var content strings.Builder
+	err = readEvents(response.Body, func(event, data string) error {
+		var decoded struct {
+			Message struct {
+				Usage anthropicUsage `json:"usage"`
+			} `json:"message"`
+			Delta struct {
+				Type       string `json:"type"`
+				Text       string `json:"text"`
+				StopReason string `json:"stop_reason"`
+			} `json:"delta"`
+			Usage anthropicUsage `json:"usage"`
+			Error struct {
+				Message string `json:"message"`
+			} `json:"error"`
+		}
+		if err := json.Unmarshal([]byte(data), &decoded); err != nil {
+			return fmt.Errorf("error decoding %s stream: %v", p.name, err)
+		}
+
+		switch event {
+		case "message_start":
+			result.Usage.PromptTokens = decoded.Message.Usage.InputTokens
+		case "content_block_delta":
+			if decoded.Delta.Type != "text_delta" || decoded.Delta.Text == "" {
+				return nil
+			}
+			content.WriteString(decoded.Delta.Text)
+			return onDelta(decoded.Delta.Text)
+		case "message_delta":
+			result.FinishReason = decoded.Delta.StopReason
+			result.Usage.CompletionTokens = decoded.Usage.OutputTokens
+		case "error":
+			// overloaded_error and the like arrive after the 200 response
+			return &ProviderError{Provider: p.name, StatusCode: http.StatusServiceUnavailable, Message: decoded.Error.Message}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	result.Content = content.String()
+	return result, nil
+}
+
+func (p *Anthropic) Embed(ctx context.Context, request EmbeddingRequest) (*EmbeddingResponse, error) {
+	return nil, ErrUnsupported
+}
@@ -0,0 +1,191 @@
+package llm
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/spectrumwebco/agent_runtime/backend/core/config/env"
+)
+
+const (
+	ProviderTypeOpenAI    = "openai"
+	ProviderTypeAnthropic = "anthropic"
+)
+
+type ProviderConfig struct {
+	Name string `json:"name"`
+	// Type is the API the provider speaks, openai or anthropic. vLLM serves
+	// the OpenAI API.
+	Type    string `json:"type"`
+	BaseURL string `json:"base_url"`
+	// VaultPath is the Vault secret whose api_key field holds the key. A
+	// provider without one is called without a key.
+	VaultPath string `json:"vault_path,omitempty"`
+}
+
+// Target is a model of a provider.
+type Target struct {
+	Provider string `json:"provider"`
+	Model    string `json:"model"`
+}
+
+func (t Target) String() string {
+	return t.Provider + ":" + t.Model
+}
+
+// ParseTarget parses provider:model. The model may contain colons.
+func ParseTarget(value string) (Target, error) {
+	provider, model, ok := strings.Cut(strings.TrimSpace(value), ":")
+	if !ok || provider == "" || model == "" {
+		return Target{}, fmt.Errorf("%q is not provider:model", value)
+	}
+	return Target{Provider: provider, Model: model}, nil
+}
+
+type Config struct {
+	Providers []ProviderConfig `json:"providers"`
+	// Routes maps model aliases to the targets tried in order.
+	Routes map[string][]Target `json:"routes"`
+	// Timeout bounds a call to a provider, including streaming.
+	Timeout time.Duration `json:"timeout"`
+	// KeyTTL is how long API keys read from Vault are used before they are
+	// read again.
+	KeyTTL time.Duration `json:"key_ttl"`
+}
+
+const (
+	DefaultTimeout = 5 * time.Minute
+	DefaultKeyTTL  = 5 * time.Minute
+	DefaultRoutes  = "chat=openai:gpt-4o,anthropic:claude-sonnet-4-5;embeddings=openai:text-embedding-3-small"
+)
+
+// knownProviders are the defaults of the providers AGENT_LLM_PROVIDERS may
+// name without configuring them.
+var knownProviders = map[string]ProviderConfig{
+	"openai":    {Name: "openai", Type: ProviderTypeOpenAI, BaseURL: "https://api.openai.com/v1", VaultPath: "llm/openai"},
+	"anthropic": {Name: "anthropic", Type: ProviderTypeAnthropic, BaseURL: "https://api.anthropic.com/v1", VaultPath: "llm/anthropic"},
+	"vllm":      {Name: "vllm", Type: ProviderTypeOpenAI, BaseURL: "http://vllm.default.svc.cluster.local:8000/v1"},
+}
+
+var Default = env.Once(FromEnv)
+
+// FromEnv reads the providers and routes of the gateway. AGENT_LLM_PROVIDERS
+// lists the providers, openai and anthropic by default. Each is configured
+// with AGENT_LLM_<NAME>_TYPE, _BASE_URL and _VAULT_PATH. AGENT_LLM_ROUTES
+// maps aliases to targets, e.g.
+// "chat=openai:gpt-4o,anthropic:claude-sonnet-4-5;embeddings=vllm:bge-m3".
+func FromEnv() Config {
+	config := Config{Timeout: DefaultTimeout, KeyTTL: DefaultKeyTTL}
+
+	names := "openai,anthropic"
+	if value := os.Getenv("AGENT_LLM_PROVIDERS"); value != "" {
+		names = value
+	}
+	for _, name := range strings.Split(names, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		provider, ok := knownProviders[name]
+		if !ok {
+			provider = ProviderConfig{Name: name, Type: ProviderTypeOpenAI}
+		}
+		prefix := "AGENT_LLM_" + strings.ToUpper(strings.ReplaceAll(name, "-", "_")) + "_"
+		if value := os.Getenv(prefix + "TYPE"); value != "" {
+			provider.Type = value
+		}
+		if value := os.Getenv(prefix + "BASE_URL"); value != "" {
+			provider.BaseURL = value
+		}
+		if value, ok := os.LookupEnv(prefix + "VAULT_PATH"); ok {
+			provider.VaultPath = value
+		}
+		if provider.Type != ProviderTypeOpenAI && provider.Type != ProviderTypeAnthropic {
+			llmLogger.Printf("%sTYPE must be openai or anthropic, got %q, leaving %s out", prefix, provider.Type, name)
+			continue
+		}
+		if provider.BaseURL == "" {
+			llmLogger.Printf("%sBASE_URL is required, leaving %s out", prefix, name)
+			continue
+		}
+		config.Providers = append(config.Providers, provider)
+	}
+
+	routes, err := ParseRoutes(DefaultRoutes)
+	if value := os.Getenv("AGENT_LLM_ROUTES"); value != "" {
+		if parsed, parseErr := ParseRoutes(value); parseErr != nil {
+			llmLogger.Printf("Invalid AGENT_LLM_ROUTES: %v", parseErr)
+		} else {
+			routes, err = parsed, nil
+		}
+	}
+	if err == nil {
+		config.Routes = routes
+	}
+
+	read := env.NewReader(llmLogger)
+	read.PositiveDuration("AGENT_LLM_TIMEOUT", &config.Timeout)
+	read.PositiveDuration("AGENT_LLM_KEY_TTL", &config.KeyTTL)
+	return config
+}
+
+// Variables returns the variables FromEnv reads c from, with every provider
+// configured in full rather than relying on the known providers.
+func (c Config) Variables() map[string]string {
+	env := map[string]string{
+		"AGENT_LLM_TIMEOUT": c.Timeout.String(),
+		"AGENT_LLM_KEY_TTL": c.KeyTTL.String(),
+	}
+
+	names := make([]string, 0, len(c.Providers))
+	for _, provider := range c.Providers {
+		names = append(names, provider.Name)
+		prefix := "AGENT_LLM_" + strings.ToUpper(strings.ReplaceAll(provider.Name, "-", "_")) + "_"
+		env[prefix+"TYPE"] = provider.Type
+		env[prefix+"BASE_URL"] = provider.BaseURL
+		env[prefix+"VAULT_PATH"] = provider.VaultPath
+	}
+	env["AGENT_LLM_PROVIDERS"] = strings.Join(names, ",")
+
+	aliases := make([]string, 0, len(c.Routes))
+	for alias := range c.Routes {
+		aliases = append(aliases, alias)
+	}
+	sort.Strings(aliases)
+	routes := make([]string, 0, len(aliases))
+	for _, alias := range aliases {
+		targets := make([]string, 0, len(c.Routes[alias]))
+		for _, target := range c.Routes[alias] {
+			targets = append(targets, target.String())
+		}
+		routes = append(routes, alias+"="+strings.Join(targets, ","))
+	}
+	env["AGENT_LLM_ROUTES"] = strings.Join(routes, ";")
+	return env
+}
+
+// ParseRoutes parses alias=provider:model,provider:model;alias=... .
+func ParseRoutes(value string) (map[string][]Target, error) {
+	routes := make(map[string][]Target)
+	for _, route := range strings.Split(value, ";") {
+		if strings.TrimSpace(route) == "" {
+			continue
+		}
+		alias, targets, ok := strings.Cut(route, "=")
+		alias = strings.TrimSpace(alias)
+		if !ok || alias == "" || strings.Contains(alias, ":") {
+			return nil, fmt.Errorf("%q is not alias=provider:model,...", route)
+		}
+		for _, target := range strings.Split(targets, ",") {
+			parsed, err := ParseTarget(target)
+			if err != nil {
+				return nil, fmt.Errorf("route %s: %v", alias, err)
+			}
+			routes[alias] = append(routes[alias], parsed)
+		}
+	}
+	return routes, nil
+}
@@ -0,0 +1,262 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/spectrumwebco/agent_runtime/backend/core/outbound"
+	"github.com/spectrumwebco/agent_runtime/backend/core/tenancy"
+	"github.com/spectrumwebco/agent_runtime/backend/db/integrations"
+)
+
+var ErrUnknownModel = errors.New("unknown model")
+
+var (
+	requestsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "kled_llm_requests_total",
+		Help: "Calls to model providers, by provider, operation and outcome: succeeded or failed.",
+	}, []string{"provider", "operation", "outcome"})
+	tokensTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "kled_llm_tokens_total",
+		Help: "Tokens used at model providers, by provider, model and kind: prompt or completion.",
+	}, []string{"provider", "model", "kind"})
+	fallbacksTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "kled_llm_fallbacks_total",
+		Help: "Calls passed on to the next provider of a route after a provider failed, by the provider that failed.",
+	}, []string{"provider"})
+)
+
+func init() {
+	prometheus.MustRegister(requestsTotal, tokensTotal, fallbacksTotal)
+}
+
+// Guard decides whether a tenant may call models, e.g. whether it is within
+// its budget. Its error is returned as is.
+type Guard interface {
+	Allow(ctx context.Context, tenant tenancy.Tenant) error
+}
+
+// Gateway routes calls to the providers serving a model and accounts their
+// usage to the calling tenant.
+type Gateway struct {
+	providers  map[string]Provider
+	routes     map[string][]Target
+	accountant Accountant
+	guard      Guard
+	now        func() time.Time
+}
+
+func NewGateway(providers map[string]Provider, routes map[string][]Target, accountant Accountant) *Gateway {
+	return &Gateway{providers: providers, routes: routes, accountant: accountant, now: time.Now}
+}
+
+func (g *Gateway) Accountant() Accountant {
+	return g.accountant
+}
+
+// SetGuard installs the guard consulted before every call.
+func (g *Gateway) SetGuard(guard Guard) {
+	g.guard = guard
+}
+
+// Models returns the model aliases, sorted.
+func (g *Gateway) Models() []string {
+	aliases := make([]string, 0, len(g.routes))
+	for alias := range g.routes {
+		aliases = append(aliases, alias)
+	}
+	sort.Strings(aliases)
+	return aliases
+}
+
+// targets resolves a model alias, or provider:model naming one target.
+func (g *Gateway) targets(model string) ([]Target, error) {
+	if targets, ok := g.routes[model]; ok {
+		return targets, nil
+	}
+	if target, err := ParseTarget(model); err == nil {
+		if _, ok := g.providers[target.Provider]; ok {
+			return []Target{target}, nil
+		}
+	}
+	return nil, fmt.Errorf("%w %q", ErrUnknownModel, model)
+}
+
+// route calls the targets of a model in order until one succeeds or fails
+// in a way the next would too.
+func (g *Gateway) route(ctx context.Context, tenant tenancy.Tenant, operation Operation, model string, call func(Provider, Target) (Usage, error)) error {
+	targets, err := g.targets(model)
+	if err != nil {
+		return err
+	}
+	if g.guard != nil {
+		if err := g.guard.Allow(ctx, tenant); err != nil {
+			return err
+		}
+	}
+
+	var errs []error
+	for i, target := range targets {
+		provider, ok := g.providers[target.Provider]
+		if !ok {
+			errs = append(errs, fmt.Errorf("provider %s is not configured", target.Provider))
+			continue
+		}
+
+		usage, err := call(provider, target)
+		if err == nil {
+			requestsTotal.WithLabelValues(target.Provider, string(operation), "succeeded").Inc()
+			g.account(ctx, tenant, operation, target, usage)
+			return nil
+		}
+		requestsTotal.WithLabelValues(target.Provider, string(operation), "failed").Inc()
+		errs = append(errs, fmt.Errorf("%s: %w", target, err))
+		if !retryable(ctx, err) {
+			break
+		}
+		if i < len(targets)-1 {
+			fallbacksTotal.WithLabelValues(target.Provider).Inc()
+			llmLogger.Printf("%s failed for %s of %s, falling back: %v", target, operation, tenant, err)
+		}
+	}
+	if len(errs) == 1 {
+		return errs[0]
+	}
+	return fmt.Errorf("all providers failed for %s: %w", model, errors.Join(errs...))
+}
+
+func (g *Gateway) account(ctx context.Context, tenant tenancy.Tenant, operation Operation, target Target, usage Usage) {
+	tokensTotal.WithLabelValues(target.Provider, target.Model, "prompt").Add(float64(usage.PromptTokens))
+	tokensTotal.WithLabelValues(target.Provider, target.Model, "completion").Add(float64(usage.CompletionTokens))
+	if g.accountant == nil {
+		return
+	}
+	if tenant.ProjectID == "" {
+		tenant.ProjectID = tenancy.DefaultProject
+	}
+	record := UsageRecord{
+		Tenant:     tenant,
+		Provider:   target.Provider,
+		Model:      target.Model,
+		Operation:  operation,
+		Usage:      usage,
+		OccurredAt: g.now().UTC(),
+	}
+	if err := g.accountant.Record(ctx, record); err != nil {
+		llmLogger.Printf("Error accounting %s usage of %s: %v", target, tenant, err)
+	}
+}
+
+func (g *Gateway) Chat(ctx context.Context, tenant tenancy.Tenant, request ChatRequest) (*ChatResponse, error) {
+	var response *ChatResponse
+	err := g.route(ctx, tenant, OperationChat, request.Model, func(provider Provider, target Target) (Usage, error) {
+		routed := request
+		routed.Model = target.Model
+		var err error
+		response, err = provider.Chat(ctx, routed)
+		if err != nil {
+			return Usage{}, err
+		}
+		return response.Usage, nil
+	})
+	return response, err
+}
+
+// ChatStream falls back to the next provider only until the first delta was
+// passed to onDelta; a stream failing later fails the call.
+func (g *Gateway) ChatStream(ctx context.Context, tenant tenancy.Tenant, request ChatRequest, onDelta func(string) error) (*ChatResponse, error) {
+	var response *ChatResponse
+	started := false
+	err := g.route(ctx, tenant, OperationChat, request.Model, func(provider Provider, target Target) (Usage, error) {
+		routed := request
+		routed.Model = target.Model
+		var err error
+		response, err = provider.ChatStream(ctx, routed, func(delta string) error {
+			started = true
+			return onDelta(delta)
+		})
+		if err != nil {
+			if started {
+				return Usage{}, &streamError{err}
+			}
+			return Usage{}, err
+		}
+		return response.Usage, nil
+	})
+	return response, err
+}
+
+// streamError is a stream that failed after sending deltas, which another
+// provider can't resume.
+type streamError struct {
+	err error
+}
+
+func (e *streamError) Error() string { return e.err.Error() }
+func (e *streamError) Unwrap() error { return e.err }
+
+func (g *Gateway) Embed(ctx context.Context, tenant tenancy.Tenant, request EmbeddingRequest) (*EmbeddingResponse, error) {
+	if len(request.Input) == 0 {
+		return &EmbeddingResponse{Model: request.Model, Embeddings: [][]float64{}}, nil
+	}
+	var response *EmbeddingResponse
+	err := g.route(ctx, tenant, OperationEmbeddings, request.Model, func(provider Provider, target Target) (Usage, error) {
+		routed := request
+		routed.Model = target.Model
+		var err error
+		response, err = provider.Embed(ctx, routed)
+		if err != nil {
+			return Usage{}, err
+		}
+		return response.Usage, nil
+	})
+	return response, err
+}
+
+var (
+	defaultGateway   *Gateway
+	defaultGatewayMu sync.RWMutex
+)
+
+func DefaultGateway() *Gateway {
+	defaultGatewayMu.RLock()
+	defer defaultGatewayMu.RUnlock()
+
+	return defaultGateway
+}
+
+func SetDefaultGateway(gateway *Gateway) {
+	defaultGatewayMu.Lock()
+	defer defaultGatewayMu.Unlock()
+
+	defaultGateway = gateway
+}
+
+// ConfigureDefault creates the providers of the configuration with keys read
+// through reader and installs the gateway as the default.
+func ConfigureDefault(reader integrations.SecretReader, config Config, accountant Accountant) *Gateway {
+	client, err := outbound.Default().HTTPClient(config.Timeout)
+	if err != nil {
+		llmLogger.Printf("Error loading the outbound CA bundle: %v", err)
+	}
+
+	keys := NewKeyCache(reader, config.KeyTTL)
+	providers := make(map[string]Provider, len(config.Providers))
+	for _, provider := range config.Providers {
+		switch provider.Type {
+		case ProviderTypeAnthropic:
+			providers[provider.Name] = NewAnthropic(provider.Name, provider.BaseURL, client, keys, provider.VaultPath)
+		default:
+			providers[provider.Name] = NewOpenAI(provider.Name, provider.BaseURL, client, keys, provider.VaultPath)
+		}
+	}
+
+	gateway := NewGateway(providers, config.Routes, accountant)
+	SetDefaultGateway(gateway)
+	return gateway
+}
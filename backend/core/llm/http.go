@@ -0,0 +1,113 @@
+package llm
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// httpProvider holds what the HTTP providers share: the endpoint, the client
+// and the Vault path of the API key.
+type httpProvider struct {
+	name      string
+	baseURL   string
+	client    *http.Client
+	keys      *KeyCache
+	vaultPath string
+}
+
+// post sends a JSON request. Responses other than 2xx are returned as a
+// ProviderError; a rejected key is read from Vault again on the next call.
+func (p *httpProvider) post(ctx context.Context, path string, body interface{}, header func(http.Header, string)) (*http.Response, error) {
+	key, err := p.keys.Key(p.vaultPath)
+	if err != nil {
+		return nil, err
+	}
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return nil, err
+	}
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, strings.TrimSuffix(p.baseURL, "/")+path, bytes.NewReader(payload))
+	if err != nil {
+		return nil, err
+	}
+	request.Header.Set("Content-Type", "application/json")
+	header(request.Header, key)
+
+	response, err := p.client.Do(request)
+	if err != nil {
+		return nil, fmt.Errorf("error calling %s: %w", p.name, err)
+	}
+	if response.StatusCode/100 == 2 {
+		return response, nil
+	}
+
+	defer response.Body.Close()
+	message, _ := io.ReadAll(io.LimitReader(response.Body, 4096))
+	if response.StatusCode == http.StatusUnauthorized || response.StatusCode == http.StatusForbidden {
+		p.keys.Invalidate(p.vaultPath)
+	}
+	return nil, &ProviderError{Provider: p.name, StatusCode: response.StatusCode, Message: errorMessage(message)}
+}
+
+// errorMessage extracts error.message from the JSON error bodies of
+// OpenAI-compatible servers and Anthropic.
+func errorMessage(body []byte) string {
+	var decoded struct {
+		Error struct {
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	if json.Unmarshal(body, &decoded) == nil && decoded.Error.Message != "" {
+		return decoded.Error.Message
+	}
+	return strings.TrimSpace(string(body))
+}
+
+func decodeJSON(response *http.Response, value interface{}) error {
+	defer response.Body.Close()
+	return json.NewDecoder(response.Body).Decode(value)
+}
+
+// readEvents calls onEvent with the event name and data of each
+// Server-Sent Event until the stream ends or onEvent returns io.EOF.
+func readEvents(body io.Reader, onEvent func(event, data string) error) error {
+	scanner := bufio.NewScanner(body)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+
+	var event string
+	var data []string
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case line == "":
+			if len(data) > 0 {
+				if err := onEvent(event, strings.Join(data, "\n")); err == io.EOF {
+					return nil
+				} else if err != nil {
+					return err
+				}
+			}
+			event, data = "", nil
+		case strings.HasPrefix(line, "event:"):
+			event = strings.TrimSpace(strings.TrimPrefix(line, "event:"))
+		case strings.HasPrefix(line, "data:"):
+			data = append(data, strings.TrimPrefix(strings.TrimPrefix(line, "data:"), " "))
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	if len(data) > 0 {
+		if err := onEvent(event, strings.Join(data, "\n")); err != io.EOF {
+			return err
+		}
+	}
+	return nil
+}
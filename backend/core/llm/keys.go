@@ -0,0 +1,63 @@
+package llm
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/spectrumwebco/agent_runtime/backend/db/integrations"
+)
+
+// KeyCache reads provider API keys from the api_key field of Vault secrets
+// and keeps them for a while, so rotated keys are picked up without a
+// restart.
+type KeyCache struct {
+	reader integrations.SecretReader
+	ttl    time.Duration
+	keys   map[string]cachedKey
+	mu     sync.Mutex
+	now    func() time.Time
+}
+
+type cachedKey struct {
+	key     string
+	expires time.Time
+}
+
+func NewKeyCache(reader integrations.SecretReader, ttl time.Duration) *KeyCache {
+	return &KeyCache{reader: reader, ttl: ttl, keys: make(map[string]cachedKey), now: time.Now}
+}
+
+// Key returns the key at a Vault path. An empty path is a provider without
+// a key, such as a local vLLM server.
+func (c *KeyCache) Key(path string) (string, error) {
+	if path == "" {
+		return "", nil
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if cached, ok := c.keys[path]; ok && c.now().Before(cached.expires) {
+		return cached.key, nil
+	}
+	secret, err := c.reader.ReadSecret(path)
+	if err != nil {
+		return "", fmt.Errorf("error reading API key at %s: %v", path, err)
+	}
+	key, _ := secret["api_key"].(string)
+	if key == "" {
+		return "", fmt.Errorf("secret %s has no api_key", path)
+	}
+	c.keys[path] = cachedKey{key: key, expires: c.now().Add(c.ttl)}
+	return key, nil
+}
+
+// Invalidate drops a key the provider rejected, so the next call reads it
+// again.
+func (c *KeyCache) Invalidate(path string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	delete(c.keys, path)
+}
@@ -0,0 +1,121 @@
+// Package llm is the gateway to the model providers agents call.
+//
+// Providers such as OpenAI, Anthropic and a local vLLM server are reached
+// through one Provider interface for chat completions, streaming and
+// embeddings. The Gateway resolves a model alias to the provider models that
+// serve it, falls back to the next one when a provider fails in a way another
+// provider may not, and accounts the tokens of every call to the tenant that
+// made it. API keys are read from Vault.
+package llm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+)
+
+var llmLogger = log.New(os.Stdout, "kled.llm: ", log.LstdFlags)
+
+// ErrUnsupported is returned by providers that don't offer an operation,
+// such as Anthropic for embeddings. The gateway falls back to the next
+// provider.
+var ErrUnsupported = errors.New("operation not supported by provider")
+
+const (
+	RoleSystem    = "system"
+	RoleUser      = "user"
+	RoleAssistant = "assistant"
+)
+
+type Message struct {
+	Role    string `json:"role" openapi:"required"`
+	Content string `json:"content" openapi:"required"`
+}
+
+type ChatRequest struct {
+	// Model is a model alias, or provider:model to call one provider
+	// without fallback.
+	Model    string    `json:"model" openapi:"required"`
+	Messages []Message `json:"messages" openapi:"required"`
+	// MaxTokens bounds the completion. Providers that require a bound get
+	// DefaultMaxTokens when it is unset.
+	MaxTokens   int      `json:"max_tokens,omitempty"`
+	Temperature *float64 `json:"temperature,omitempty"`
+	Stop        []string `json:"stop,omitempty"`
+}
+
+type Usage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+}
+
+type ChatResponse struct {
+	// Provider and Model are those that served the request.
+	Provider     string `json:"provider"`
+	Model        string `json:"model"`
+	Content      string `json:"content"`
+	FinishReason string `json:"finish_reason,omitempty"`
+	Usage        Usage  `json:"usage"`
+}
+
+type EmbeddingRequest struct {
+	Model string   `json:"model" openapi:"required"`
+	Input []string `json:"input" openapi:"required"`
+}
+
+type EmbeddingResponse struct {
+	Provider string `json:"provider"`
+	Model    string `json:"model"`
+	// Embeddings are in the order of the input.
+	Embeddings [][]float64 `json:"embeddings"`
+	Usage      Usage       `json:"usage"`
+}
+
+// Provider calls the models of one provider. The model of a request is the
+// provider's own model name.
+type Provider interface {
+	Chat(ctx context.Context, request ChatRequest) (*ChatResponse, error)
+	// ChatStream calls onDelta with each piece of the completion as it
+	// arrives and returns the complete response.
+	ChatStream(ctx context.Context, request ChatRequest, onDelta func(string) error) (*ChatResponse, error)
+	Embed(ctx context.Context, request EmbeddingRequest) (*EmbeddingResponse, error)
+}
+
+// ProviderError is a failed call to a provider.
+type ProviderError struct {
+	Provider   string
+	StatusCode int
+	Message    string
+}
+
+func (e *ProviderError) Error() string {
+	return fmt.Sprintf("%s returned %d: %s", e.Provider, e.StatusCode, e.Message)
+}
+
+// Retryable reports whether another provider may serve the request. Invalid
+// requests fail the same way everywhere.
+func (e *ProviderError) Retryable() bool {
+	switch e.StatusCode {
+	case http.StatusBadRequest, http.StatusRequestEntityTooLarge, http.StatusUnprocessableEntity:
+		return false
+	}
+	return true
+}
+
+// retryable reports whether the gateway falls back to the next provider
+// after err. Network errors are retryable; a canceled request or a stream
+// that already sent deltas is not.
+func retryable(ctx context.Context, err error) bool {
+	var streamErr *streamError
+	if ctx.Err() != nil || errors.As(err, &streamErr) {
+		return false
+	}
+	var providerErr *ProviderError
+	if errors.As(err, &providerErr) {
+		return providerErr.Retryable()
+	}
+	return true
+}
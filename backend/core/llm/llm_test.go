@@ -0,0 +1,179 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/spectrumwebco/agent_runtime/backend/core/tenancy"
+	"github.com/spectrumwebco/agent_runtime/backend/db/integrations"
+)
+
+func testKeys(reads *int) *KeyCache {
+	return NewKeyCache(integrations.SecretReaderFunc(func(path string) (map[string]interface{}, error) {
+		if reads != nil {
+			*reads++
+		}
+		return map[string]interface{}{"api_key": "key-of-" + path}, nil
+	}), time.Hour)
+}
+
+func TestGatewayFallsBackAndAccounts(t *testing.T) {
+	openaiCalls := 0
+	openai := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		openaiCalls++
+		w.WriteHeader(http.StatusServiceUnavailable)
+		fmt.Fprint(w, `{"error":{"message":"overloaded"}}`)
+	}))
+	defer openai.Close()
+
+	var received map[string]interface{}
+	anthropic := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/messages" || r.Header.Get("x-api-key") != "key-of-llm/anthropic" {
+			t.Errorf("unexpected request %s with key %q", r.URL.Path, r.Header.Get("x-api-key"))
+		}
+		json.NewDecoder(r.Body).Decode(&received)
+		fmt.Fprint(w, `{"content":[{"type":"text","text":"hello"}],"stop_reason":"end_turn","usage":{"input_tokens":12,"output_tokens":3}}`)
+	}))
+	defer anthropic.Close()
+
+	keys := testKeys(nil)
+	accountant := NewMemoryAccountant()
+	gateway := NewGateway(map[string]Provider{
+		"openai":    NewOpenAI("openai", openai.URL, openai.Client(), keys, "llm/openai"),
+		"anthropic": NewAnthropic("anthropic", anthropic.URL, anthropic.Client(), keys, "llm/anthropic"),
+	}, map[string][]Target{
+		"chat": {{Provider: "openai", Model: "gpt-4o"}, {Provider: "anthropic", Model: "claude-sonnet-4-5"}},
+	}, accountant)
+
+	tenant := tenancy.Tenant{OrganizationID: "acme"}
+	response, err := gateway.Chat(context.Background(), tenant, ChatRequest{
+		Model:    "chat",
+		Messages: []Message{{Role: RoleSystem, Content: "be brief"}, {Role: RoleUser, Content: "hi"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if openaiCalls != 1 || response.Provider != "anthropic" || response.Model != "claude-sonnet-4-5" || response.Content != "hello" {
+		t.Fatalf("expected anthropic to serve the request, got %+v after %d openai calls", response, openaiCalls)
+	}
+	if received["system"] != "be brief" || len(received["messages"].([]interface{})) != 1 || received["max_tokens"] != float64(DefaultMaxTokens) {
+		t.Errorf("unexpected anthropic request %v", received)
+	}
+
+	usage := accountant.Usage(tenancy.Tenant{OrganizationID: "acme", ProjectID: tenancy.DefaultProject})
+	if len(usage) != 1 || usage[0].Provider != "anthropic" || usage[0].Requests != 1 || usage[0].PromptTokens != 12 || usage[0].CompletionTokens != 3 {
+		t.Errorf("unexpected usage %+v", usage)
+	}
+}
+
+func TestGatewayStopsOnInvalidRequest(t *testing.T) {
+	calls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprint(w, `{"error":{"message":"context too long"}}`)
+	}))
+	defer server.Close()
+
+	keys := testKeys(nil)
+	gateway := NewGateway(map[string]Provider{
+		"a": NewOpenAI("a", server.URL, server.Client(), keys, ""),
+		"b": NewOpenAI("b", server.URL, server.Client(), keys, ""),
+	}, map[string][]Target{"chat": {{Provider: "a", Model: "m"}, {Provider: "b", Model: "m"}}}, nil)
+
+	_, err := gateway.Chat(context.Background(), tenancy.Tenant{OrganizationID: "acme"}, ChatRequest{Model: "chat", Messages: []Message{{Role: RoleUser, Content: "hi"}}})
+	if err == nil || calls != 1 || !strings.Contains(err.Error(), "context too long") {
+		t.Errorf("expected the invalid request not to be retried, got %v after %d calls", err, calls)
+	}
+
+	if _, err := gateway.Chat(context.Background(), tenancy.Tenant{OrganizationID: "acme"}, ChatRequest{Model: "unknown"}); err == nil {
+		t.Error("expected an unknown model to be rejected")
+	}
+}
+
+func TestChatStream(t *testing.T) {
+	openai := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprint(w, "data: {\"choices\":[{\"delta\":{\"content\":\"Hel\"}}]}\n\n")
+		fmt.Fprint(w, "data: {\"choices\":[{\"delta\":{\"content\":\"lo\"},\"finish_reason\":\"stop\"}]}\n\n")
+		fmt.Fprint(w, "data: {\"choices\":[],\"usage\":{\"prompt_tokens\":5,\"completion_tokens\":2}}\n\n")
+		fmt.Fprint(w, "data: [DONE]\n\n")
+	}))
+	defer openai.Close()
+
+	anthropic := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprint(w, "event: message_start\ndata: {\"message\":{\"usage\":{\"input_tokens\":7}}}\n\n")
+		fmt.Fprint(w, "event: content_block_delta\ndata: {\"delta\":{\"type\":\"text_delta\",\"text\":\"Hi \"}}\n\n")
+		fmt.Fprint(w, "event: content_block_delta\ndata: {\"delta\":{\"type\":\"text_delta\",\"text\":\"there\"}}\n\n")
+		fmt.Fprint(w, "event: message_delta\ndata: {\"delta\":{\"stop_reason\":\"end_turn\"},\"usage\":{\"output_tokens\":4}}\n\n")
+		fmt.Fprint(w, "event: message_stop\ndata: {}\n\n")
+	}))
+	defer anthropic.Close()
+
+	keys := testKeys(nil)
+	for _, test := range []struct {
+		provider Provider
+		content  string
+		usage    Usage
+	}{
+		{NewOpenAI("openai", openai.URL, openai.Client(), keys, ""), "Hello", Usage{PromptTokens: 5, CompletionTokens: 2}},
+		{NewAnthropic("anthropic", anthropic.URL, anthropic.Client(), keys, ""), "Hi there", Usage{PromptTokens: 7, CompletionTokens: 4}},
+	} {
+		var deltas []string
+		response, err := test.provider.ChatStream(context.Background(), ChatRequest{Model: "m", Messages: []Message{{Role: RoleUser, Content: "hi"}}}, func(delta string) error {
+			deltas = append(deltas, delta)
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if strings.Join(deltas, "") != test.content || response.Content != test.content || response.Usage != test.usage {
+			t.Errorf("unexpected stream %q, response %+v", deltas, response)
+		}
+	}
+}
+
+func TestRejectedKeyIsReadAgain(t *testing.T) {
+	status := http.StatusUnauthorized
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+		fmt.Fprint(w, `{"data":[{"index":0,"embedding":[0.1,0.2]}],"usage":{"prompt_tokens":2}}`)
+	}))
+	defer server.Close()
+
+	reads := 0
+	provider := NewOpenAI("openai", server.URL, server.Client(), testKeys(&reads), "llm/openai")
+	request := EmbeddingRequest{Model: "m", Input: []string{"text"}}
+	if _, err := provider.Embed(context.Background(), request); err == nil {
+		t.Fatal("expected the rejected key to fail the call")
+	}
+	status = http.StatusOK
+	response, err := provider.Embed(context.Background(), request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reads != 2 || len(response.Embeddings) != 1 || response.Usage.PromptTokens != 2 {
+		t.Errorf("expected the key to be read again, got %d reads and %+v", reads, response)
+	}
+}
+
+func TestParseRoutes(t *testing.T) {
+	routes, err := ParseRoutes("chat=openai:gpt-4o, vllm:meta-llama/Llama-3.1-8B ;embeddings=vllm:bge-m3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	chat := routes["chat"]
+	if len(chat) != 2 || chat[1] != (Target{Provider: "vllm", Model: "meta-llama/Llama-3.1-8B"}) || len(routes["embeddings"]) != 1 {
+		t.Errorf("unexpected routes %+v", routes)
+	}
+	if _, err := ParseRoutes("chat=gpt-4o"); err == nil {
+		t.Error("expected a target without provider to be rejected")
+	}
+}
@@ -0,0 +1,182 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// OpenAI calls the OpenAI API, or any server implementing it such as vLLM.
+type OpenAI struct {
+	httpProvider
+}
+
+func NewOpenAI(name, baseURL string, client *http.Client, keys *KeyCache, vaultPath string) *OpenAI {
+	return &OpenAI{httpProvider{name: name, baseURL: baseURL, client: client, keys: keys, vaultPath: vaultPath}}
+}
+
+type openAIChatRequest struct {
+	Model         string    `json:"model"`
+	Messages      []Message `json:"messages"`
+	MaxTokens     int       `json:"max_tokens,omitempty"`
+	Temperature   *float64  `json:"temperature,omitempty"`
+	Stop          []string  `json:"stop,omitempty"`
+	Stream        bool      `json:"stream,omitempty"`
+	StreamOptions *struct {
+		IncludeUsage bool `json:"include_usage"`
+	} `json:"stream_options,omitempty"`
+}
+
+type openAIUsage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+}
+
+func (u *openAIUsage) usage() Usage {
+	if u == nil {
+		return Usage{}
+	}
+	return Usage{PromptTokens: u.PromptTokens, CompletionTokens: u.CompletionTokens}
+}
+
+func (p *OpenAI) header(header http.Header, key string) {
+	if key != "" {
+		header.Set("Authorization", "Bearer "+key)
+	}
+}
+
+func (p *OpenAI) chatRequest(request ChatRequest, stream bool) openAIChatRequest {
+	body := openAIChatRequest{
+		Model:       request.Model,
+		Messages:    request.Messages,
+		MaxTokens:   request.MaxTokens,
+		Temperature: request.Temperature,
+		Stop:        request.Stop,
+		Stream:      stream,
+	}
+	if stream {
+		// the usage arrives in a last chunk without choices
+		body.StreamOptions = &struct {
+			IncludeUsage bool `json:"include_usage"`
+		}{IncludeUsage: true}
+	}
+	return body
+}
+
+func (p *OpenAI) Chat(ctx context.Context, request ChatRequest) (*ChatResponse, error) {
+	response, err := p.post(ctx, "/chat/completions", p.chatRequest(request, false), p.header)
+	if err != nil {
+		return nil, err
+	}
+
+	var decoded struct {
+		Choices []struct {
+			Message      Message `json:"message"`
+			FinishReason string  `json:"finish_reason"`
+		} `json:"choices"`
+		Usage *openAIUsage `json:"usage"`
+	}
+	if err := decodeJSON(response, &decoded); err != nil {
+		return nil, fmt.Errorf("error decoding %s response: %v", p.name, err)
+	}
+	if len(decoded.Choices) == 0 {
+		return nil, &ProviderError{Provider: p.name, StatusCode: response.StatusCode, Message: "no choices in response"}
+	}
+	return &ChatResponse{
+		Provider:     p.name,
+		Model:        request.Model,
+		Content:      decoded.Choices[0].Message.Content,
+		FinishReason: decoded.Choices[0].FinishReason,
+		Usage:        decoded.Usage.usage(),
+	}, nil
+}
+
+func (p *OpenAI) ChatStream(ctx context.Context, request ChatRequest, onDelta func(string) error) (*ChatResponse, error) {
+	response, err := p.post(ctx, "/chat/completions", p.chatRequest(request, true), p.header)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+
+	result := &ChatResponse{Provider: p.name, Model: request.Model}
+	var content strings.Builder
+	err = readEvents(response.Body, func(event, data string) error {
+		if data == "[DONE]" {
+			return io.EOF
+		}
+		var chunk struct {
+			Choices []struct {
+				Delta struct {
+					Content string `json:"content"`
+				} `json:"delta"`
+				FinishReason *string `json:"finish_reason"`
+			} `json:"choices"`
+			Usage *openAIUsage `json:"usage"`
+			Error *struct {
+				Message string `json:"message"`
+			} `json:"error"`
+		}
+		if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+			return fmt.Errorf("error decoding %s stream: %v", p.name, err)
+		}
+		if chunk.Error != nil {
+			return &ProviderError{Provider: p.name, StatusCode: http.StatusBadGateway, Message: chunk.Error.Message}
+		}
+		if chunk.Usage != nil {
+			result.Usage = chunk.Usage.usage()
+		}
+		for _, choice := range chunk.Choices {
+			if choice.FinishReason != nil {
+				result.FinishReason = *choice.FinishReason
+			}
+			if choice.Delta.Content == "" {
+				continue
+			}
+			content.WriteString(choice.Delta.Content)
+			if err := onDelta(choice.Delta.Content); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	result.Content = content.String()
+	return result, nil
+}
+
+func (p *OpenAI) Embed(ctx context.Context, request EmbeddingRequest) (*EmbeddingResponse, error) {
+	response, err := p.post(ctx, "/embeddings", map[string]interface{}{
+		"model": request.Model,
+		"input": request.Input,
+	}, p.header)
+	if err != nil {
+		return nil, err
+	}
+
+	var decoded struct {
+		Data []struct {
+			Index     int       `json:"index"`
+			Embedding []float64 `json:"embedding"`
+		} `json:"data"`
+		Usage *openAIUsage `json:"usage"`
+	}
+	if err := decodeJSON(response, &decoded); err != nil {
+		return nil, fmt.Errorf("error decoding %s response: %v", p.name, err)
+	}
+	if len(decoded.Data) != len(request.Input) {
+		return nil, &ProviderError{Provider: p.name, StatusCode: response.StatusCode, Message: fmt.Sprintf("%d embeddings for %d inputs", len(decoded.Data), len(request.Input))}
+	}
+	sort.Slice(decoded.Data, func(i, j int) bool { return decoded.Data[i].Index < decoded.Data[j].Index })
+
+	result := &EmbeddingResponse{Provider: p.name, Model: request.Model, Usage: decoded.Usage.usage()}
+	for _, item := range decoded.Data {
+		result.Embeddings = append(result.Embeddings, item.Embedding)
+	}
+	return result, nil
+}
@@ -0,0 +1,45 @@
+package metering
+
+import (
+	"strconv"
+
+	"github.com/spectrumwebco/agent_runtime/backend/core/config/env"
+	"github.com/spectrumwebco/agent_runtime/backend/db/integrations"
+)
+
+type Config struct {
+	// HardCutoff is the policy of projects without one of their own.
+	HardCutoff bool `json:"hard_cutoff"`
+}
+
+var Default = env.Once(FromEnv)
+
+// FromEnv reads AGENT_LLM_BUDGET_HARD_CUTOFF, which defaults to true.
+func FromEnv() Config {
+	config := Config{HardCutoff: true}
+	env.NewReader(meteringLogger).Bool("AGENT_LLM_BUDGET_HARD_CUTOFF", &config.HardCutoff)
+	return config
+}
+
+// Variables returns the variables FromEnv reads c from.
+func (c Config) Variables() map[string]string {
+	return map[string]string{
+		"AGENT_LLM_BUDGET_HARD_CUTOFF": strconv.FormatBool(c.HardCutoff),
+	}
+}
+
+// ConfigureDefault builds a meter backed by Postgres. If its tables cannot
+// be created it falls back to in-memory stores.
+func ConfigureDefault(client integrations.SQLStore, config Config) *Meter {
+	store := NewPostgresStore(client)
+	policies := NewPostgresPolicyStore(client)
+	if err := store.EnsureSchema(); err != nil {
+		meteringLogger.Printf("Metering falling back to in-memory stores: %v", err)
+		return NewMeter(NewMemoryStore(), NewMemoryPolicyStore(), nil, config)
+	}
+	if err := policies.EnsureSchema(); err != nil {
+		meteringLogger.Printf("Metering falling back to in-memory stores: %v", err)
+		return NewMeter(NewMemoryStore(), NewMemoryPolicyStore(), nil, config)
+	}
+	return NewMeter(store, policies, nil, config)
+}
@@ -0,0 +1,160 @@
+// Package metering records the tokens of every call through the LLM gateway
+// and enforces monthly token budgets.
+//
+// The Meter is the gateway's Accountant: it persists each call to Postgres,
+// along with the user, agent run and trajectory it was made for, and charges
+// its tokens to the llm_tokens quota of the project and user. Budgets are
+// the llm_tokens quota limits, so they warn at quota.WarningThreshold and at
+// the limit like every quota. As the gateway's Guard the Meter rejects calls
+// of projects over budget, unless their policy is a soft budget that only
+// warns. The Rollup aggregates the calls per project and day into Doris.
+package metering
+
+import (
+	"context"
+	"errors"
+	"log"
+	"os"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/spectrumwebco/agent_runtime/backend/core/llm"
+	"github.com/spectrumwebco/agent_runtime/backend/core/quota"
+	"github.com/spectrumwebco/agent_runtime/backend/core/tenancy"
+)
+
+var meteringLogger = log.New(os.Stdout, "kled.metering: ", log.LstdFlags)
+
+// Call identifies what a model call was made for. All fields are optional.
+type Call struct {
+	UserID       string `json:"user_id,omitempty"`
+	RunID        string `json:"run_id,omitempty"`
+	TrajectoryID string `json:"trajectory_id,omitempty"`
+}
+
+type callKey struct{}
+
+// WithCall attaches the call to the context passed to the gateway.
+func WithCall(ctx context.Context, call Call) context.Context {
+	return context.WithValue(ctx, callKey{}, call)
+}
+
+func CallFromContext(ctx context.Context) Call {
+	call, _ := ctx.Value(callKey{}).(Call)
+	return call
+}
+
+// Record is a metered call.
+type Record struct {
+	ID             string `json:"id"`
+	OrganizationID string `json:"organization_id"`
+	ProjectID      string `json:"project_id"`
+	Call
+	Provider         string        `json:"provider"`
+	Model            string        `json:"model"`
+	Operation        llm.Operation `json:"operation"`
+	PromptTokens     int           `json:"prompt_tokens"`
+	CompletionTokens int           `json:"completion_tokens"`
+	OccurredAt       time.Time     `json:"occurred_at"`
+}
+
+// Meter is the Accountant and Guard of the gateway.
+type Meter struct {
+	store    Store
+	policies PolicyStore
+	manager  *quota.Manager
+	config   Config
+}
+
+// NewMeter charges tokens to manager, or to quota.DefaultManager() at the
+// time of the call when manager is nil.
+func NewMeter(store Store, policies PolicyStore, manager *quota.Manager, config Config) *Meter {
+	return &Meter{store: store, policies: policies, manager: manager, config: config}
+}
+
+func (m *Meter) Store() Store {
+	return m.store
+}
+
+func (m *Meter) Policies() PolicyStore {
+	return m.policies
+}
+
+func (m *Meter) quotas() *quota.Manager {
+	if m.manager != nil {
+		return m.manager
+	}
+	return quota.DefaultManager()
+}
+
+// Scopes are the quota scopes charged for a call of the tenant: the project
+// and, when known, the user.
+func Scopes(ctx context.Context, tenant tenancy.Tenant) []quota.Scope {
+	scopes := []quota.Scope{{Type: quota.ScopeProject, ID: tenant.String()}}
+	if userID := CallFromContext(ctx).UserID; userID != "" {
+		scopes = append(scopes, quota.Scope{Type: quota.ScopeUser, ID: userID})
+	}
+	return scopes
+}
+
+// Record persists the call and charges its tokens. Both are attempted; the
+// first error is returned.
+func (m *Meter) Record(ctx context.Context, usage llm.UsageRecord) error {
+	record := &Record{
+		ID:               uuid.New().String(),
+		OrganizationID:   usage.Tenant.OrganizationID,
+		ProjectID:        usage.Tenant.ProjectID,
+		Call:             CallFromContext(ctx),
+		Provider:         usage.Provider,
+		Model:            usage.Model,
+		Operation:        usage.Operation,
+		PromptTokens:     usage.PromptTokens,
+		CompletionTokens: usage.CompletionTokens,
+		OccurredAt:       usage.OccurredAt,
+	}
+	if record.ProjectID == "" {
+		record.ProjectID = tenancy.DefaultProject
+	}
+	err := m.store.Insert(ctx, record)
+
+	tokens := float64(usage.PromptTokens + usage.CompletionTokens)
+	if tokens > 0 {
+		if chargeErr := m.quotas().Record(ctx, Scopes(ctx, usage.Tenant), quota.ResourceLLMTokens, tokens); chargeErr != nil && err == nil {
+			err = chargeErr
+		}
+	}
+	return err
+}
+
+// Allow rejects calls of a project or user over its token budget with a
+// *quota.ExceededError, unless the project's budget is soft.
+func (m *Meter) Allow(ctx context.Context, tenant tenancy.Tenant) error {
+	err := m.quotas().Check(ctx, Scopes(ctx, tenant), quota.ResourceLLMTokens)
+	if !errors.Is(err, quota.ErrExceeded) {
+		return err
+	}
+
+	policy, policyErr := m.Policy(ctx, tenant)
+	if policyErr != nil {
+		// fail closed, the budget is known to be exceeded
+		meteringLogger.Printf("Error loading the budget policy of %s: %v", tenant, policyErr)
+		return err
+	}
+	if !policy.HardCutoff {
+		return nil
+	}
+	return err
+}
+
+// Policy returns the tenant's policy, or the configured default.
+func (m *Meter) Policy(ctx context.Context, tenant tenancy.Tenant) (Policy, error) {
+	project := tenant.ProjectID
+	if project == "" {
+		project = tenancy.DefaultProject
+	}
+	policy, err := m.policies.Get(ctx, tenant.OrganizationID, project)
+	if errors.Is(err, ErrNoPolicy) {
+		return Policy{OrganizationID: tenant.OrganizationID, ProjectID: project, HardCutoff: m.config.HardCutoff}, nil
+	}
+	return policy, err
+}
@@ -0,0 +1,133 @@
+package metering
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/spectrumwebco/agent_runtime/backend/core/llm"
+	"github.com/spectrumwebco/agent_runtime/backend/core/quota"
+	"github.com/spectrumwebco/agent_runtime/backend/core/tenancy"
+)
+
+var acme = tenancy.Tenant{OrganizationID: "acme", ProjectID: "default"}
+
+func usage(tenant tenancy.Tenant, model string, prompt, completion int, at time.Time) llm.UsageRecord {
+	return llm.UsageRecord{
+		Tenant:     tenant,
+		Provider:   "openai",
+		Model:      model,
+		Operation:  llm.OperationChat,
+		Usage:      llm.Usage{PromptTokens: prompt, CompletionTokens: completion},
+		OccurredAt: at,
+	}
+}
+
+func TestMeterRecordsCallsAndChargesTokens(t *testing.T) {
+	ctx := WithCall(context.Background(), Call{UserID: "u1", RunID: "run-1"})
+	now := time.Date(2026, 3, 31, 23, 0, 0, 0, time.UTC)
+	manager := quota.NewManager(quota.NewMemoryStore(), nil, nil)
+	manager.SetClock(func() time.Time { return now })
+	store := NewMemoryStore()
+	meter := NewMeter(store, NewMemoryPolicyStore(), manager, Config{HardCutoff: true})
+
+	if err := meter.Record(ctx, usage(acme, "gpt-4o", 100, 20, now)); err != nil {
+		t.Fatal(err)
+	}
+	if err := meter.Record(ctx, usage(acme, "gpt-4o", 10, 5, now)); err != nil {
+		t.Fatal(err)
+	}
+
+	shown, _ := manager.Show(ctx, []quota.Scope{{Type: quota.ScopeProject, ID: "acme/default"}, {Type: quota.ScopeUser, ID: "u1"}})
+	for _, u := range shown {
+		if u.Resource == quota.ResourceLLMTokens && (u.Used != 135 || u.Period != "2026-03") {
+			t.Errorf("expected 135 tokens in 2026-03 for %s, got %g in %s", u.Scope, u.Used, u.Period)
+		}
+	}
+
+	totals, _ := store.Usage(ctx, "acme", "default", now.Add(-time.Hour), now.Add(time.Hour))
+	if len(totals) != 1 || totals[0].Requests != 2 || totals[0].PromptTokens != 110 || totals[0].CompletionTokens != 25 {
+		t.Errorf("unexpected usage %+v", totals)
+	}
+	if store.records[0].RunID != "run-1" || store.records[0].UserID != "u1" {
+		t.Errorf("expected the call to be recorded, got %+v", store.records[0])
+	}
+}
+
+func TestMeterCutsOffProjectsOverBudget(t *testing.T) {
+	ctx := context.Background()
+	manager := quota.NewManager(quota.NewMemoryStore(), nil, nil)
+	policies := NewMemoryPolicyStore()
+	meter := NewMeter(NewMemoryStore(), policies, manager, Config{HardCutoff: true})
+	scope := quota.Scope{Type: quota.ScopeProject, ID: "acme/default"}
+	manager.SetLimit(ctx, scope, quota.ResourceLLMTokens, 100)
+
+	meter.Record(ctx, usage(acme, "gpt-4o", 90, 0, time.Now()))
+	if err := meter.Allow(ctx, acme); err != nil {
+		t.Fatalf("expected calls within budget, got %v", err)
+	}
+
+	// the call in flight is recorded in full, then further calls are refused
+	meter.Record(ctx, usage(acme, "gpt-4o", 30, 10, time.Now()))
+	var exceeded *quota.ExceededError
+	if err := meter.Allow(ctx, acme); !errors.As(err, &exceeded) || exceeded.Used != 130 {
+		t.Fatalf("expected the budget to be exceeded, got %v", err)
+	}
+
+	policies.Set(ctx, Policy{OrganizationID: "acme", ProjectID: "default", HardCutoff: false})
+	if err := meter.Allow(ctx, acme); err != nil {
+		t.Errorf("expected a soft budget to allow calls, got %v", err)
+	}
+	if err := meter.Allow(ctx, tenancy.Tenant{OrganizationID: "globex"}); err != nil {
+		t.Errorf("expected other projects to be unaffected, got %v", err)
+	}
+}
+
+type recordingSQL struct {
+	updates []string
+	params  [][]interface{}
+}
+
+func (s *recordingSQL) ExecuteQuery(query string, params ...interface{}) ([]map[string]interface{}, error) {
+	return nil, nil
+}
+
+func (s *recordingSQL) ExecuteUpdate(query string, params ...interface{}) (int64, error) {
+	s.updates = append(s.updates, query)
+	s.params = append(s.params, params)
+	return 1, nil
+}
+
+func TestRollupWritesDailyTotalsPerProject(t *testing.T) {
+	ctx := context.Background()
+	day := time.Date(2026, 4, 2, 0, 0, 0, 0, time.UTC)
+	store := NewMemoryStore()
+	meter := NewMeter(store, NewMemoryPolicyStore(), quota.NewManager(quota.NewMemoryStore(), nil, nil), Config{})
+	meter.Record(ctx, usage(acme, "gpt-4o", 10, 1, day.Add(time.Hour)))
+	meter.Record(ctx, usage(acme, "gpt-4o", 20, 2, day.Add(2*time.Hour)))
+	meter.Record(ctx, usage(acme, "gpt-4o", 40, 4, day.Add(-time.Hour)))
+	meter.Record(ctx, usage(tenancy.Tenant{OrganizationID: "globex", ProjectID: "default"}, "gpt-4o", 5, 5, day.Add(time.Hour)))
+	meter.Record(ctx, usage(acme, "gpt-4o", 80, 8, day.AddDate(0, 0, 1)))
+
+	doris := &recordingSQL{}
+	if err := NewRollup(store, doris).Run(ctx, day.Add(-time.Hour), day.Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+
+	var inserts [][]interface{}
+	for i, update := range doris.updates {
+		if strings.HasPrefix(update, "INSERT INTO") {
+			inserts = append(inserts, doris.params[i])
+		}
+	}
+	if len(inserts) != 2 {
+		t.Fatalf("expected one insert per project, got %d", len(inserts))
+	}
+	// acme: the day before, then the day itself with both calls summed
+	acmeRows := inserts[0]
+	if len(acmeRows) != 12 || acmeRows[0] != "2026-04-01" || acmeRows[6] != "2026-04-02" || acmeRows[9] != 2 || acmeRows[10] != 30 || acmeRows[11] != 3 {
+		t.Errorf("unexpected rows %v", acmeRows)
+	}
+}
@@ -0,0 +1,110 @@
+package metering
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/spectrumwebco/agent_runtime/backend/core/tenancy"
+	"github.com/spectrumwebco/agent_runtime/backend/db/integrations"
+)
+
+// Rollup aggregates the calls per project and day into the project's
+// llm_usage_daily table in Doris. The table's unique key is the day, provider
+// and model, so rolling up a day again replaces its rows.
+type Rollup struct {
+	store Store
+	doris integrations.SQLStore
+	// ensured holds the tenants whose table exists.
+	ensured sync.Map
+}
+
+func NewRollup(store Store, doris integrations.SQLStore) *Rollup {
+	return &Rollup{store: store, doris: doris}
+}
+
+func (r *Rollup) ensureTable(tenant tenancy.Tenant, store *tenancy.SQLStore) error {
+	if _, ok := r.ensured.Load(tenant); ok {
+		return nil
+	}
+	if err := store.EnsureSchema(); err != nil {
+		return err
+	}
+	_, err := store.ExecuteUpdate(`
+		CREATE TABLE IF NOT EXISTS {schema}.llm_usage_daily (
+			day DATE NOT NULL,
+			provider VARCHAR(64) NOT NULL,
+			model VARCHAR(255) NOT NULL,
+			requests BIGINT NOT NULL,
+			prompt_tokens BIGINT NOT NULL,
+			completion_tokens BIGINT NOT NULL
+		)
+		UNIQUE KEY(day, provider, model)
+		DISTRIBUTED BY HASH(day) BUCKETS 4
+	`)
+	if err != nil {
+		return fmt.Errorf("error creating LLM usage table of %s: %v", tenant, err)
+	}
+	r.ensured.Store(tenant, true)
+	return nil
+}
+
+// Run rolls up the UTC days from the day of from to the day of to. A failed
+// project does not stop the others; the first error is returned.
+func (r *Rollup) Run(ctx context.Context, from, to time.Time) error {
+	start := startOfDay(from)
+	end := startOfDay(to).AddDate(0, 0, 1)
+	daily, err := r.store.Daily(ctx, start, end)
+	if err != nil {
+		return err
+	}
+
+	byTenant := map[tenancy.Tenant][]DailyUsage{}
+	var tenants []tenancy.Tenant
+	for _, usage := range daily {
+		tenant := tenancy.Tenant{OrganizationID: usage.OrganizationID, ProjectID: usage.ProjectID}
+		if _, ok := byTenant[tenant]; !ok {
+			tenants = append(tenants, tenant)
+		}
+		byTenant[tenant] = append(byTenant[tenant], usage)
+	}
+
+	var firstErr error
+	for _, tenant := range tenants {
+		if err := r.write(tenant, byTenant[tenant]); err != nil {
+			meteringLogger.Printf("Error rolling up LLM usage of %s: %v", tenant, err)
+			if firstErr == nil {
+				firstErr = err
+			}
+		}
+	}
+	return firstErr
+}
+
+func (r *Rollup) write(tenant tenancy.Tenant, rows []DailyUsage) error {
+	store := tenancy.NewDorisStore(tenant, r.doris)
+	if err := r.ensureTable(tenant, store); err != nil {
+		return err
+	}
+
+	values := make([]string, 0, len(rows))
+	params := make([]interface{}, 0, len(rows)*6)
+	for _, row := range rows {
+		values = append(values, "(?, ?, ?, ?, ?, ?)")
+		params = append(params, row.Day, row.Provider, row.Model, row.Requests, row.PromptTokens, row.CompletionTokens)
+	}
+	_, err := store.ExecuteUpdate(
+		`INSERT INTO {schema}.llm_usage_daily (day, provider, model, requests, prompt_tokens, completion_tokens) VALUES `+strings.Join(values, ", "),
+		params...,
+	)
+	if err != nil {
+		return fmt.Errorf("error writing LLM usage of %s: %v", tenant, err)
+	}
+	return nil
+}
+
+func startOfDay(t time.Time) time.Time {
+	return t.UTC().Truncate(24 * time.Hour)
+}
@@ -0,0 +1,360 @@
+package metering
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/spectrumwebco/agent_runtime/backend/core/llm"
+	"github.com/spectrumwebco/agent_runtime/backend/db/integrations"
+)
+
+// DailyUsage is the usage of a provider model by a project on a UTC day.
+type DailyUsage struct {
+	OrganizationID string `json:"organization_id"`
+	ProjectID      string `json:"project_id"`
+	// Day is formatted 2006-01-02.
+	Day string `json:"day"`
+	llm.ModelUsage
+}
+
+type Store interface {
+	Insert(ctx context.Context, record *Record) error
+	// Usage totals the calls of a project in [from, to) by provider and
+	// model.
+	Usage(ctx context.Context, organizationID, projectID string, from, to time.Time) ([]llm.ModelUsage, error)
+	// Daily totals the calls of every project in [from, to) by UTC day,
+	// provider and model.
+	Daily(ctx context.Context, from, to time.Time) ([]DailyUsage, error)
+}
+
+type MemoryStore struct {
+	records []*Record
+	mu      sync.Mutex
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{}
+}
+
+func (s *MemoryStore) Insert(ctx context.Context, record *Record) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	copied := *record
+	s.records = append(s.records, &copied)
+	return nil
+}
+
+func (s *MemoryStore) Usage(ctx context.Context, organizationID, projectID string, from, to time.Time) ([]llm.ModelUsage, error) {
+	daily, err := s.Daily(ctx, from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	totals := map[[2]string]*llm.ModelUsage{}
+	for _, day := range daily {
+		if day.OrganizationID != organizationID || day.ProjectID != projectID {
+			continue
+		}
+		key := [2]string{day.Provider, day.Model}
+		total := totals[key]
+		if total == nil {
+			total = &llm.ModelUsage{Provider: day.Provider, Model: day.Model}
+			totals[key] = total
+		}
+		total.Requests += day.Requests
+		total.PromptTokens += day.PromptTokens
+		total.CompletionTokens += day.CompletionTokens
+	}
+
+	usage := []llm.ModelUsage{}
+	for _, total := range totals {
+		usage = append(usage, *total)
+	}
+	sort.Slice(usage, func(i, j int) bool {
+		return usage[i].Provider+":"+usage[i].Model < usage[j].Provider+":"+usage[j].Model
+	})
+	return usage, nil
+}
+
+func (s *MemoryStore) Daily(ctx context.Context, from, to time.Time) ([]DailyUsage, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	type key struct{ organization, project, day, provider, model string }
+	totals := map[key]*DailyUsage{}
+	var keys []key
+	for _, record := range s.records {
+		if record.OccurredAt.Before(from) || !record.OccurredAt.Before(to) {
+			continue
+		}
+		k := key{record.OrganizationID, record.ProjectID, record.OccurredAt.UTC().Format("2006-01-02"), record.Provider, record.Model}
+		total := totals[k]
+		if total == nil {
+			total = &DailyUsage{OrganizationID: k.organization, ProjectID: k.project, Day: k.day}
+			total.Provider, total.Model = k.provider, k.model
+			totals[k] = total
+			keys = append(keys, k)
+		}
+		total.Requests++
+		total.PromptTokens += record.PromptTokens
+		total.CompletionTokens += record.CompletionTokens
+	}
+
+	daily := make([]DailyUsage, 0, len(keys))
+	for _, k := range keys {
+		daily = append(daily, *totals[k])
+	}
+	sort.Slice(daily, func(i, j int) bool {
+		a, b := daily[i], daily[j]
+		return strings.Join([]string{a.OrganizationID, a.ProjectID, a.Day, a.Provider, a.Model}, "\x00") <
+			strings.Join([]string{b.OrganizationID, b.ProjectID, b.Day, b.Provider, b.Model}, "\x00")
+	})
+	return daily, nil
+}
+
+// PostgresStore keeps the calls in app_llm_call.
+type PostgresStore struct {
+	client integrations.SQLStore
+}
+
+func NewPostgresStore(client integrations.SQLStore) *PostgresStore {
+	return &PostgresStore{client: client}
+}
+
+func (s *PostgresStore) EnsureSchema() error {
+	_, err := s.client.ExecuteUpdate(`
+		CREATE TABLE IF NOT EXISTS app_llm_call (
+			id VARCHAR(64) PRIMARY KEY,
+			organization_id VARCHAR(255) NOT NULL,
+			project_id VARCHAR(255) NOT NULL,
+			user_id VARCHAR(255) NOT NULL DEFAULT '',
+			run_id VARCHAR(64) NOT NULL DEFAULT '',
+			trajectory_id VARCHAR(64) NOT NULL DEFAULT '',
+			provider VARCHAR(64) NOT NULL,
+			model VARCHAR(255) NOT NULL,
+			operation VARCHAR(16) NOT NULL,
+			prompt_tokens INTEGER NOT NULL,
+			completion_tokens INTEGER NOT NULL,
+			occurred_at TIMESTAMPTZ NOT NULL
+		);
+		CREATE INDEX IF NOT EXISTS app_llm_call_project_idx ON app_llm_call (organization_id, project_id, occurred_at);
+		CREATE INDEX IF NOT EXISTS app_llm_call_occurred_at_idx ON app_llm_call (occurred_at)
+	`)
+	if err != nil {
+		return fmt.Errorf("error creating LLM call table: %v", err)
+	}
+	return nil
+}
+
+func (s *PostgresStore) Insert(ctx context.Context, record *Record) error {
+	_, err := s.client.ExecuteUpdate(`
+		INSERT INTO app_llm_call (id, organization_id, project_id, user_id, run_id, trajectory_id, provider, model, operation, prompt_tokens, completion_tokens, occurred_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)`,
+		record.ID, record.OrganizationID, record.ProjectID, record.UserID, record.RunID, record.TrajectoryID,
+		record.Provider, record.Model, string(record.Operation), record.PromptTokens, record.CompletionTokens, record.OccurredAt.UTC(),
+	)
+	if err != nil {
+		return fmt.Errorf("error recording LLM call: %v", err)
+	}
+	return nil
+}
+
+func (s *PostgresStore) Usage(ctx context.Context, organizationID, projectID string, from, to time.Time) ([]llm.ModelUsage, error) {
+	rows, err := s.client.ExecuteQuery(`
+		SELECT provider, model, COUNT(*) AS requests,
+			SUM(prompt_tokens) AS prompt_tokens, SUM(completion_tokens) AS completion_tokens
+		FROM app_llm_call
+		WHERE organization_id = $1 AND project_id = $2 AND occurred_at >= $3 AND occurred_at < $4
+		GROUP BY provider, model
+		ORDER BY provider, model`,
+		organizationID, projectID, from.UTC(), to.UTC(),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("error loading LLM usage: %v", err)
+	}
+
+	usage := make([]llm.ModelUsage, 0, len(rows))
+	for _, row := range rows {
+		usage = append(usage, modelUsageFromRow(row))
+	}
+	return usage, nil
+}
+
+func (s *PostgresStore) Daily(ctx context.Context, from, to time.Time) ([]DailyUsage, error) {
+	rows, err := s.client.ExecuteQuery(`
+		SELECT organization_id, project_id, to_char(occurred_at AT TIME ZONE 'UTC', 'YYYY-MM-DD') AS day,
+			provider, model, COUNT(*) AS requests,
+			SUM(prompt_tokens) AS prompt_tokens, SUM(completion_tokens) AS completion_tokens
+		FROM app_llm_call
+		WHERE occurred_at >= $1 AND occurred_at < $2
+		GROUP BY organization_id, project_id, day, provider, model`,
+		from.UTC(), to.UTC(),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("error loading daily LLM usage: %v", err)
+	}
+
+	daily := make([]DailyUsage, 0, len(rows))
+	for _, row := range rows {
+		daily = append(daily, DailyUsage{
+			OrganizationID: toString(row["organization_id"]),
+			ProjectID:      toString(row["project_id"]),
+			Day:            toString(row["day"]),
+			ModelUsage:     modelUsageFromRow(row),
+		})
+	}
+	return daily, nil
+}
+
+func modelUsageFromRow(row map[string]interface{}) llm.ModelUsage {
+	usage := llm.ModelUsage{
+		Provider: toString(row["provider"]),
+		Model:    toString(row["model"]),
+		Requests: toInt(row["requests"]),
+	}
+	usage.PromptTokens = toInt(row["prompt_tokens"])
+	usage.CompletionTokens = toInt(row["completion_tokens"])
+	return usage
+}
+
+// Policy is how a project's token budget is enforced. The budget itself is
+// its llm_tokens quota limit.
+type Policy struct {
+	OrganizationID string `json:"organization_id"`
+	ProjectID      string `json:"project_id"`
+	// HardCutoff rejects calls once the budget is used up. Soft budgets
+	// only warn.
+	HardCutoff bool      `json:"hard_cutoff"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+var ErrNoPolicy = errors.New("no budget policy")
+
+type PolicyStore interface {
+	// Get returns the project's policy or ErrNoPolicy.
+	Get(ctx context.Context, organizationID, projectID string) (Policy, error)
+	Set(ctx context.Context, policy Policy) error
+}
+
+type MemoryPolicyStore struct {
+	policies map[[2]string]Policy
+	mu       sync.Mutex
+}
+
+func NewMemoryPolicyStore() *MemoryPolicyStore {
+	return &MemoryPolicyStore{policies: make(map[[2]string]Policy)}
+}
+
+func (s *MemoryPolicyStore) Get(ctx context.Context, organizationID, projectID string) (Policy, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	policy, ok := s.policies[[2]string{organizationID, projectID}]
+	if !ok {
+		return Policy{}, ErrNoPolicy
+	}
+	return policy, nil
+}
+
+func (s *MemoryPolicyStore) Set(ctx context.Context, policy Policy) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.policies[[2]string{policy.OrganizationID, policy.ProjectID}] = policy
+	return nil
+}
+
+// PostgresPolicyStore keeps policies in app_llm_budget_policy.
+type PostgresPolicyStore struct {
+	client integrations.SQLStore
+}
+
+func NewPostgresPolicyStore(client integrations.SQLStore) *PostgresPolicyStore {
+	return &PostgresPolicyStore{client: client}
+}
+
+func (s *PostgresPolicyStore) EnsureSchema() error {
+	_, err := s.client.ExecuteUpdate(`
+		CREATE TABLE IF NOT EXISTS app_llm_budget_policy (
+			organization_id VARCHAR(255) NOT NULL,
+			project_id VARCHAR(255) NOT NULL,
+			hard_cutoff BOOLEAN NOT NULL,
+			updated_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+			PRIMARY KEY (organization_id, project_id)
+		)
+	`)
+	if err != nil {
+		return fmt.Errorf("error creating budget policy table: %v", err)
+	}
+	return nil
+}
+
+func (s *PostgresPolicyStore) Get(ctx context.Context, organizationID, projectID string) (Policy, error) {
+	rows, err := s.client.ExecuteQuery(
+		`SELECT hard_cutoff, updated_at FROM app_llm_budget_policy WHERE organization_id = $1 AND project_id = $2`,
+		organizationID, projectID,
+	)
+	if err != nil {
+		return Policy{}, fmt.Errorf("error loading budget policy: %v", err)
+	}
+	if len(rows) == 0 {
+		return Policy{}, ErrNoPolicy
+	}
+
+	policy := Policy{OrganizationID: organizationID, ProjectID: projectID}
+	switch v := rows[0]["hard_cutoff"].(type) {
+	case bool:
+		policy.HardCutoff = v
+	default:
+		policy.HardCutoff = toString(v) == "true" || toString(v) == "t"
+	}
+	if updatedAt, ok := rows[0]["updated_at"].(time.Time); ok {
+		policy.UpdatedAt = updatedAt.UTC()
+	}
+	return policy, nil
+}
+
+func (s *PostgresPolicyStore) Set(ctx context.Context, policy Policy) error {
+	_, err := s.client.ExecuteUpdate(`
+		INSERT INTO app_llm_budget_policy (organization_id, project_id, hard_cutoff, updated_at)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (organization_id, project_id) DO UPDATE SET hard_cutoff = EXCLUDED.hard_cutoff, updated_at = EXCLUDED.updated_at`,
+		policy.OrganizationID, policy.ProjectID, policy.HardCutoff, policy.UpdatedAt.UTC(),
+	)
+	if err != nil {
+		return fmt.Errorf("error saving budget policy: %v", err)
+	}
+	return nil
+}
+
+func toString(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case []byte:
+		return string(v)
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+func toInt(value interface{}) int {
+	var n int
+	switch v := value.(type) {
+	case int64:
+		return int(v)
+	case int:
+		return v
+	case float64:
+		return int(v)
+	default:
+		fmt.Sscan(toString(v), &n)
+	}
+	return n
+}
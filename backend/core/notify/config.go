@@ -0,0 +1,48 @@
+package notify
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/spectrumwebco/agent_runtime/backend/core/config/env"
+)
+
+type Config struct {
+	// Cooldown is how long a notification of the same kind about the same
+	// subject is not repeated in a channel.
+	Cooldown time.Duration `json:"cooldown"`
+	// PerMinute limits the messages a channel receives per minute.
+	PerMinute int `json:"per_minute"`
+	// Timeout bounds posting a message.
+	Timeout time.Duration `json:"timeout"`
+}
+
+const (
+	DefaultCooldown  = 30 * time.Minute
+	DefaultPerMinute = 10
+	DefaultTimeout   = 10 * time.Second
+)
+
+var Default = env.Once(FromEnv)
+
+func FromEnv() Config {
+	config := Config{
+		Cooldown:  DefaultCooldown,
+		PerMinute: DefaultPerMinute,
+		Timeout:   DefaultTimeout,
+	}
+	read := env.NewReader(notifyLogger)
+	read.Duration("AGENT_NOTIFY_COOLDOWN", &config.Cooldown, 0)
+	read.Int("AGENT_NOTIFY_PER_MINUTE", &config.PerMinute, 1)
+	read.PositiveDuration("AGENT_NOTIFY_TIMEOUT", &config.Timeout)
+	return config
+}
+
+// Variables returns the variables FromEnv reads c from.
+func (c Config) Variables() map[string]string {
+	return map[string]string{
+		"AGENT_NOTIFY_COOLDOWN":   c.Cooldown.String(),
+		"AGENT_NOTIFY_PER_MINUTE": strconv.Itoa(c.PerMinute),
+		"AGENT_NOTIFY_TIMEOUT":    c.Timeout.String(),
+	}
+}
@@ -0,0 +1,66 @@
+package notify
+
+import (
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// limiter decides which notifications are sent. It is per process, so with
+// several replicas a channel may receive up to one message per replica and
+// cooldown.
+type limiter struct {
+	cooldown  time.Duration
+	perMinute int
+
+	mu       sync.Mutex
+	lastSent map[string]time.Time
+	channels map[string]*rate.Limiter
+}
+
+func newLimiter(cooldown time.Duration, perMinute int) *limiter {
+	return &limiter{
+		cooldown:  cooldown,
+		perMinute: perMinute,
+		lastSent:  map[string]time.Time{},
+		channels:  map[string]*rate.Limiter{},
+	}
+}
+
+// allow reports whether the notification may be sent to the channel now, and
+// if not, why.
+func (l *limiter) allow(channel *Channel, notification Notification, now time.Time) (bool, string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	key := channel.ID + "|" + string(notification.Kind) + "|" + notification.Subject
+	if last, ok := l.lastSent[key]; ok && now.Sub(last) < l.cooldown {
+		return false, "cooldown"
+	}
+
+	channelLimiter, ok := l.channels[channel.ID]
+	if !ok {
+		channelLimiter = rate.NewLimiter(rate.Limit(float64(l.perMinute)/60), l.perMinute)
+		l.channels[channel.ID] = channelLimiter
+	}
+	if !channelLimiter.AllowN(now, 1) {
+		return false, "rate_limited"
+	}
+
+	l.lastSent[key] = now
+	l.prune(now)
+	return true, ""
+}
+
+// prune forgets subjects whose cooldown is over once the map grows large.
+func (l *limiter) prune(now time.Time) {
+	if len(l.lastSent) < 10000 {
+		return
+	}
+	for key, last := range l.lastSent {
+		if now.Sub(last) >= l.cooldown {
+			delete(l.lastSent, key)
+		}
+	}
+}
@@ -0,0 +1,236 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/spectrumwebco/agent_runtime/backend/core/events"
+	"github.com/spectrumwebco/agent_runtime/backend/core/gpu"
+	"github.com/spectrumwebco/agent_runtime/backend/core/outbound"
+	"github.com/spectrumwebco/agent_runtime/backend/core/quota"
+	"github.com/spectrumwebco/agent_runtime/backend/db/integrations"
+)
+
+var (
+	notificationsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "kled_notifications_total",
+		Help: "Notifications posted to Slack and Teams channels, by channel type and outcome: sent or failed.",
+	}, []string{"type", "outcome"})
+	notificationsSuppressed = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "kled_notifications_suppressed_total",
+		Help: "Notifications not posted to a channel, by reason: cooldown or rate_limited.",
+	}, []string{"reason"})
+)
+
+func init() {
+	prometheus.MustRegister(notificationsTotal, notificationsSuppressed)
+}
+
+// Notifier posts notifications to the channels that receive them.
+type Notifier struct {
+	store   Store
+	client  *http.Client
+	limiter *limiter
+	now     func() time.Time
+}
+
+func NewNotifier(store Store, client *http.Client, config Config) *Notifier {
+	if client == nil {
+		client = &http.Client{Timeout: config.Timeout}
+	}
+	return &Notifier{
+		store:   store,
+		client:  client,
+		limiter: newLimiter(config.Cooldown, config.PerMinute),
+		now:     time.Now,
+	}
+}
+
+func (n *Notifier) Store() Store {
+	return n.store
+}
+
+// Notify posts the notification to every channel of its organization and
+// project that receives its kind and isn't rate limited. It returns the
+// first error, after trying every channel.
+func (n *Notifier) Notify(ctx context.Context, notification Notification) error {
+	if notification.OccurredAt.IsZero() {
+		notification.OccurredAt = n.now().UTC()
+	}
+	channels, err := n.store.List(ctx, notification.OrganizationID)
+	if err != nil {
+		return err
+	}
+
+	var firstErr error
+	for _, channel := range channels {
+		if !channel.Receives(notification) {
+			continue
+		}
+		if ok, reason := n.limiter.allow(channel, notification, n.now()); !ok {
+			notificationsSuppressed.WithLabelValues(reason).Inc()
+			continue
+		}
+		if err := n.Send(ctx, channel, notification); err != nil {
+			notifyLogger.Printf("Error notifying channel %s of %s: %v", channel.ID, notification.Kind, err)
+			if firstErr == nil {
+				firstErr = err
+			}
+		}
+	}
+	return firstErr
+}
+
+// Send renders the notification and posts it to the channel, bypassing the
+// rate limits.
+func (n *Notifier) Send(ctx context.Context, channel *Channel, notification Notification) error {
+	message, err := Render(channel, notification)
+	if err != nil {
+		return err
+	}
+
+	body, err := json.Marshal(payload(channel.Type, notification.Kind, message))
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, channel.WebhookURL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	res, err := n.client.Do(req)
+	if err != nil {
+		notificationsTotal.WithLabelValues(string(channel.Type), "failed").Inc()
+		return fmt.Errorf("error posting to %s: %v", channel.Type, err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode >= 300 {
+		notificationsTotal.WithLabelValues(string(channel.Type), "failed").Inc()
+		return fmt.Errorf("%s webhook returned %s", channel.Type, res.Status)
+	}
+	notificationsTotal.WithLabelValues(string(channel.Type), "sent").Inc()
+	return nil
+}
+
+// payload is the body of a Slack or Teams incoming webhook message. Teams
+// gets a MessageCard so the kind shows as its title.
+func payload(channelType ChannelType, kind Kind, message string) interface{} {
+	if channelType == ChannelTeams {
+		return map[string]string{
+			"@type":    "MessageCard",
+			"@context": "https://schema.org/extensions",
+			"summary":  Titles[kind],
+			"title":    Titles[kind],
+			"text":     message,
+		}
+	}
+	return map[string]string{"text": message}
+}
+
+// notifyAsync posts without holding up the request or reconciliation that
+// produced the notification.
+func (n *Notifier) notifyAsync(notification Notification) {
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+		defer cancel()
+		n.Notify(ctx, notification)
+	}()
+}
+
+// Publish notifies of failed workspaces. Other events are ignored.
+func (n *Notifier) Publish(ctx context.Context, event events.WorkspaceEvent) error {
+	if notification, ok := FromWorkspaceEvent(ctx, event); ok {
+		n.notifyAsync(notification)
+	}
+	return nil
+}
+
+// NotifyQuota is a quota.Notifier.
+func (n *Notifier) NotifyQuota(ctx context.Context, warning quota.Warning) {
+	if notification, ok := FromQuotaWarning(warning); ok {
+		n.notifyAsync(notification)
+	}
+}
+
+// NotifyGPU is a gpu.Notifier.
+func (n *Notifier) NotifyGPU(ctx context.Context, notice gpu.Notice) error {
+	if notification, ok := FromGPUNotice(notice); ok {
+		n.notifyAsync(notification)
+	}
+	return nil
+}
+
+var (
+	defaultNotifier *Notifier
+	notifierMu      sync.RWMutex
+)
+
+// DefaultNotifier returns the notifier installed by ConfigureDefault, or nil
+// before that.
+func DefaultNotifier() *Notifier {
+	notifierMu.RLock()
+	defer notifierMu.RUnlock()
+	return defaultNotifier
+}
+
+func SetDefaultNotifier(notifier *Notifier) {
+	notifierMu.Lock()
+	defer notifierMu.Unlock()
+	defaultNotifier = notifier
+}
+
+// ConfigureDefault installs a Postgres-backed default notifier that posts
+// through the outbound proxy configuration. If the channel table cannot be
+// created it falls back to an in-memory store.
+func ConfigureDefault(client integrations.SQLStore, config Config) *Notifier {
+	var store Store = NewPostgresStore(client)
+	if err := store.(*PostgresStore).EnsureSchema(); err != nil {
+		notifyLogger.Printf("Notifications falling back to in-memory store: %v", err)
+		store = NewMemoryStore()
+	}
+
+	httpClient, err := outbound.Default().HTTPClient(config.Timeout)
+	if err != nil {
+		notifyLogger.Printf("Error loading the outbound CA bundle: %v", err)
+	}
+
+	notifier := NewNotifier(store, httpClient, config)
+	SetDefaultNotifier(notifier)
+	return notifier
+}
+
+// Publisher, QuotaNotifier and GPUNotifier forward to whichever notifier is
+// the default at the time, so they can be installed before ConfigureDefault
+// runs.
+var (
+	Publisher     events.Publisher = defaultPublisher{}
+	QuotaNotifier quota.Notifier   = quota.NotifierFunc(func(ctx context.Context, warning quota.Warning) {
+		if notifier := DefaultNotifier(); notifier != nil {
+			notifier.NotifyQuota(ctx, warning)
+		}
+	})
+	GPUNotifier gpu.Notifier = gpu.NotifierFunc(func(ctx context.Context, notice gpu.Notice) error {
+		if notifier := DefaultNotifier(); notifier != nil {
+			return notifier.NotifyGPU(ctx, notice)
+		}
+		return nil
+	})
+)
+
+type defaultPublisher struct{}
+
+func (defaultPublisher) Publish(ctx context.Context, event events.WorkspaceEvent) error {
+	notifier := DefaultNotifier()
+	if notifier == nil {
+		return nil
+	}
+	return notifier.Publish(ctx, event)
+}
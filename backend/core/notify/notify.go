@@ -0,0 +1,154 @@
+// Package notify posts workspace and quota notifications to the Slack
+// and Microsoft Teams channels of a project.
+//
+// A Channel is an incoming webhook URL of an organization, either for one of
+// its projects or for all of them, and lists the notification kinds it
+// receives. Messages are rendered from text/template templates, see
+// DefaultTemplates; a channel may override the template of any kind.
+//
+// To keep a failing workspace or a project at its quota from flooding a
+// channel, the Notifier drops a notification when the same kind was sent
+// about the same subject within the cooldown, and limits how many messages a
+// channel receives per minute.
+package notify
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+var notifyLogger = log.New(os.Stdout, "kled.notify: ", log.LstdFlags)
+
+var ErrNotFound = errors.New("notification channel not found")
+
+type Kind string
+
+const (
+	KindWorkspaceFailed Kind = "workspace.failed"
+	// KindAutoStopWarning warns that a workspace is about to be stopped
+	// for being idle.
+	KindAutoStopWarning Kind = "workspace.auto_stop_warning"
+	KindQuotaReached    Kind = "quota.reached"
+)
+
+var Kinds = []Kind{KindWorkspaceFailed, KindAutoStopWarning, KindQuotaReached}
+
+func ParseKind(value string) (Kind, error) {
+	for _, kind := range Kinds {
+		if string(kind) == value {
+			return kind, nil
+		}
+	}
+	return "", fmt.Errorf("unknown notification kind %q", value)
+}
+
+// Notification is something a project should hear about.
+type Notification struct {
+	Kind           Kind   `json:"kind"`
+	OrganizationID string `json:"organization_id"`
+	// ProjectID is empty when the project isn't known, in which case only
+	// the channels of the whole organization are notified.
+	ProjectID string `json:"project_id,omitempty"`
+	// Subject identifies what the notification is about, e.g. a workspace
+	// ID. Repeats about the same subject are rate limited.
+	Subject string `json:"subject"`
+	// Data is available to the templates as .Data.
+	Data       map[string]interface{} `json:"data,omitempty"`
+	OccurredAt time.Time              `json:"occurred_at"`
+}
+
+type ChannelType string
+
+const (
+	ChannelSlack ChannelType = "slack"
+	ChannelTeams ChannelType = "teams"
+)
+
+func ParseChannelType(value string) (ChannelType, error) {
+	switch ChannelType(value) {
+	case ChannelSlack, ChannelTeams:
+		return ChannelType(value), nil
+	default:
+		return "", fmt.Errorf("unknown channel type %q, must be slack or teams", value)
+	}
+}
+
+// Channel is a Slack or Teams incoming webhook.
+type Channel struct {
+	ID             string `json:"id"`
+	OrganizationID string `json:"organization_id"`
+	// ProjectID is empty for channels of the whole organization.
+	ProjectID string      `json:"project_id,omitempty"`
+	Type      ChannelType `json:"type"`
+	Name      string      `json:"name,omitempty"`
+	// WebhookURL holds the channel's credentials and is never returned.
+	WebhookURL string `json:"-"`
+	Kinds      []Kind `json:"kinds"`
+	// Templates overrides the default template of some kinds.
+	Templates map[Kind]string `json:"templates,omitempty"`
+	CreatedAt time.Time       `json:"created_at"`
+}
+
+// NewChannel validates a channel and gives it an ID. Without kinds it
+// receives every kind.
+func NewChannel(organizationID, projectID string, channelType ChannelType, webhookURL string, kinds []Kind, templates map[Kind]string, now time.Time) (*Channel, error) {
+	if organizationID == "" {
+		return nil, fmt.Errorf("notification channel has no organization")
+	}
+	parsed, err := url.Parse(webhookURL)
+	if err != nil || parsed.Scheme != "https" || parsed.Host == "" {
+		return nil, fmt.Errorf("the webhook URL of a %s channel must be an https URL", channelType)
+	}
+	if len(kinds) == 0 {
+		kinds = append([]Kind(nil), Kinds...)
+	}
+	for kind, text := range templates {
+		if _, err := ParseKind(string(kind)); err != nil {
+			return nil, err
+		}
+		if _, err := parseTemplate(kind, text); err != nil {
+			return nil, err
+		}
+	}
+
+	return &Channel{
+		ID:             uuid.New().String(),
+		OrganizationID: organizationID,
+		ProjectID:      projectID,
+		Type:           channelType,
+		WebhookURL:     webhookURL,
+		Kinds:          kinds,
+		Templates:      templates,
+		CreatedAt:      now.UTC(),
+	}, nil
+}
+
+// Receives reports whether the channel should get the notification.
+func (c *Channel) Receives(notification Notification) bool {
+	if c.OrganizationID != notification.OrganizationID {
+		return false
+	}
+	if c.ProjectID != "" && c.ProjectID != notification.ProjectID {
+		return false
+	}
+	for _, kind := range c.Kinds {
+		if kind == notification.Kind {
+			return true
+		}
+	}
+	return false
+}
+
+// splitProject splits the "<organization>/<project>" identifiers used by
+// quotas and GPU policies.
+func splitProject(project string) (string, string, bool) {
+	organizationID, projectID, ok := strings.Cut(project, "/")
+	return organizationID, projectID, ok && organizationID != "" && projectID != ""
+}
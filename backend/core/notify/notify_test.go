@@ -0,0 +1,163 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+type receiver struct {
+	mu     sync.Mutex
+	bodies []map[string]string
+}
+
+func (r *receiver) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	var body map[string]string
+	json.NewDecoder(req.Body).Decode(&body)
+	r.mu.Lock()
+	r.bodies = append(r.bodies, body)
+	r.mu.Unlock()
+}
+
+func (r *receiver) received() []map[string]string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]map[string]string(nil), r.bodies...)
+}
+
+func newTestNotifier(t *testing.T, config Config) (*Notifier, *httptest.Server, *receiver, *time.Time) {
+	t.Helper()
+	rec := &receiver{}
+	server := httptest.NewTLSServer(rec)
+	t.Cleanup(server.Close)
+
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	notifier := NewNotifier(NewMemoryStore(), server.Client(), config)
+	notifier.now = func() time.Time { return now }
+	return notifier, server, rec, &now
+}
+
+func addChannel(t *testing.T, notifier *Notifier, projectID string, channelType ChannelType, url string, templates map[Kind]string) *Channel {
+	t.Helper()
+	channel, err := NewChannel("org", projectID, channelType, url, nil, templates, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := notifier.Store().Create(context.Background(), channel); err != nil {
+		t.Fatal(err)
+	}
+	return channel
+}
+
+func failed(projectID, workspaceID string) Notification {
+	return Notification{
+		Kind:           KindWorkspaceFailed,
+		OrganizationID: "org",
+		ProjectID:      projectID,
+		Subject:        workspaceID,
+		Data:           map[string]interface{}{"workspace_id": workspaceID, "error": "image pull failed", "stage": "create"},
+	}
+}
+
+func TestRenderDefaultAndOverride(t *testing.T) {
+	channel := &Channel{Templates: map[Kind]string{KindQuotaReached: "{{.Data.resource}} is at {{.Data.used}}/{{.Data.limit}}"}}
+
+	message, err := Render(channel, failed("p1", "ws-1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if message != "Workspace ws-1 failed during create: image pull failed" {
+		t.Errorf("unexpected default message %q", message)
+	}
+
+	message, err = Render(channel, Sample(KindQuotaReached, "org", "p1", time.Now()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if message != "cpu_hours is at 100/100" {
+		t.Errorf("unexpected overridden message %q", message)
+	}
+
+	message, err = Render(&Channel{}, Sample(KindAutoStopWarning, "org", "p1", time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(message, "2026-03-01 11:00 UTC") || !strings.Contains(message, "2026-03-01 12:30 UTC") {
+		t.Errorf("expected formatted times, got %q", message)
+	}
+}
+
+func TestNewChannelValidation(t *testing.T) {
+	if _, err := NewChannel("org", "", ChannelSlack, "http://hooks.slack.com/x", nil, nil, time.Now()); err == nil {
+		t.Error("expected plain http webhook URLs to be rejected")
+	}
+	if _, err := NewChannel("org", "", ChannelSlack, "https://hooks.slack.com/x", nil, map[Kind]string{KindQuotaReached: "{{.Data"}, time.Now()); err == nil {
+		t.Error("expected an invalid template to be rejected")
+	}
+	channel, err := NewChannel("org", "", ChannelTeams, "https://example.webhook.office.com/x", nil, nil, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(channel.Kinds) != len(Kinds) {
+		t.Errorf("expected a channel without kinds to receive all of them, got %v", channel.Kinds)
+	}
+}
+
+func TestNotifyRoutesByProjectAndFormatsPerType(t *testing.T) {
+	notifier, server, rec, _ := newTestNotifier(t, Config{Cooldown: time.Minute, PerMinute: 10})
+	addChannel(t, notifier, "p1", ChannelSlack, server.URL+"/slack", nil)
+	addChannel(t, notifier, "p2", ChannelSlack, server.URL+"/other", nil)
+	addChannel(t, notifier, "", ChannelTeams, server.URL+"/teams", nil)
+
+	if err := notifier.Notify(context.Background(), failed("p1", "ws-1")); err != nil {
+		t.Fatal(err)
+	}
+
+	bodies := rec.received()
+	if len(bodies) != 2 {
+		t.Fatalf("expected the project and organization channels to be notified, got %+v", bodies)
+	}
+	var slack, teams map[string]string
+	for _, body := range bodies {
+		if body["@type"] == "MessageCard" {
+			teams = body
+		} else {
+			slack = body
+		}
+	}
+	if slack == nil || !strings.HasPrefix(slack["text"], "Workspace ws-1 failed") {
+		t.Errorf("unexpected Slack message %+v", slack)
+	}
+	if teams == nil || teams["title"] != "Workspace failed" || teams["text"] != slack["text"] {
+		t.Errorf("unexpected Teams card %+v", teams)
+	}
+}
+
+func TestNotifyCooldownAndRateLimit(t *testing.T) {
+	notifier, server, rec, now := newTestNotifier(t, Config{Cooldown: 10 * time.Minute, PerMinute: 2})
+	addChannel(t, notifier, "p1", ChannelSlack, server.URL, nil)
+	ctx := context.Background()
+
+	notifier.Notify(ctx, failed("p1", "ws-1"))
+	notifier.Notify(ctx, failed("p1", "ws-1"))
+	if got := len(rec.received()); got != 1 {
+		t.Fatalf("expected a repeat within the cooldown to be dropped, got %d messages", got)
+	}
+
+	notifier.Notify(ctx, failed("p1", "ws-2"))
+	notifier.Notify(ctx, failed("p1", "ws-3"))
+	if got := len(rec.received()); got != 2 {
+		t.Fatalf("expected the channel to be limited to 2 messages a minute, got %d", got)
+	}
+
+	*now = now.Add(11 * time.Minute)
+	notifier.Notify(ctx, failed("p1", "ws-1"))
+	if got := len(rec.received()); got != 3 {
+		t.Fatalf("expected a notification after the cooldown, got %d messages", got)
+	}
+}
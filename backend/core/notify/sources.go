@@ -0,0 +1,88 @@
+package notify
+
+import (
+	"context"
+
+	"github.com/spectrumwebco/agent_runtime/backend/core/events"
+	"github.com/spectrumwebco/agent_runtime/backend/core/gpu"
+	"github.com/spectrumwebco/agent_runtime/backend/core/quota"
+	"github.com/spectrumwebco/agent_runtime/backend/core/tenancy"
+)
+
+// FromWorkspaceEvent returns the notification of a workspace.failed event.
+// The project is taken from the tenant in ctx. It reports false for other
+// events and events without an organization.
+func FromWorkspaceEvent(ctx context.Context, event events.WorkspaceEvent) (Notification, bool) {
+	if event.Type != events.WorkspaceFailed {
+		return Notification{}, false
+	}
+
+	notification := Notification{
+		Kind:           KindWorkspaceFailed,
+		OrganizationID: event.OrganizationID,
+		Subject:        event.WorkspaceID,
+		OccurredAt:     event.OccurredAt,
+		Data: map[string]interface{}{
+			"workspace_id":   event.WorkspaceID,
+			"workspace_name": event.WorkspaceName,
+			"error":          event.Error,
+			"stage":          event.Attributes["stage"],
+		},
+	}
+	if tenant, ok := tenancy.FromContext(ctx); ok {
+		notification.OrganizationID = tenant.OrganizationID
+		notification.ProjectID = tenant.ProjectID
+	}
+	return notification, notification.OrganizationID != ""
+}
+
+// FromQuotaWarning returns the notification of a project quota that was
+// reached. Earlier warnings, and user quotas, report false.
+func FromQuotaWarning(warning quota.Warning) (Notification, bool) {
+	if warning.Scope.Type != quota.ScopeProject || warning.Ratio < 1 {
+		return Notification{}, false
+	}
+	organizationID, projectID, ok := splitProject(warning.Scope.ID)
+	if !ok {
+		return Notification{}, false
+	}
+
+	return Notification{
+		Kind:           KindQuotaReached,
+		OrganizationID: organizationID,
+		ProjectID:      projectID,
+		Subject:        string(warning.Resource) + "|" + warning.Period,
+		OccurredAt:     warning.OccurredAt,
+		Data: map[string]interface{}{
+			"resource": string(warning.Resource),
+			"used":     warning.Used,
+			"limit":    warning.Limit,
+			"period":   warning.Period,
+		},
+	}, true
+}
+
+// FromGPUNotice returns the warning that an idle workspace is about to be
+// stopped. Other notices report false.
+func FromGPUNotice(notice gpu.Notice) (Notification, bool) {
+	if notice.Action != gpu.ActionStop || notice.Taken {
+		return Notification{}, false
+	}
+	organizationID, projectID, ok := splitProject(notice.Workspace.ProjectID)
+	if !ok {
+		return Notification{}, false
+	}
+
+	return Notification{
+		Kind:           KindAutoStopWarning,
+		OrganizationID: organizationID,
+		ProjectID:      projectID,
+		Subject:        notice.Workspace.ID,
+		Data: map[string]interface{}{
+			"workspace_id":   notice.Workspace.ID,
+			"workspace_name": notice.Workspace.Name(),
+			"idle_since":     notice.IdleSince,
+			"stop_at":        notice.ActionAt,
+		},
+	}, true
+}
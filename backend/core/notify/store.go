@@ -0,0 +1,221 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/spectrumwebco/agent_runtime/backend/db/integrations"
+)
+
+type Store interface {
+	Create(ctx context.Context, channel *Channel) error
+	// Get returns the channel or ErrNotFound.
+	Get(ctx context.Context, id string) (*Channel, error)
+	// List returns the channels of an organization, including those of
+	// all its projects, oldest first.
+	List(ctx context.Context, organizationID string) ([]*Channel, error)
+	Delete(ctx context.Context, id string) error
+}
+
+type MemoryStore struct {
+	channels map[string]*Channel
+	mu       sync.Mutex
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{channels: make(map[string]*Channel)}
+}
+
+func (s *MemoryStore) Create(ctx context.Context, channel *Channel) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	copied := *channel
+	s.channels[channel.ID] = &copied
+	return nil
+}
+
+func (s *MemoryStore) Get(ctx context.Context, id string) (*Channel, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	channel, ok := s.channels[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	copied := *channel
+	return &copied, nil
+}
+
+func (s *MemoryStore) List(ctx context.Context, organizationID string) ([]*Channel, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	channels := []*Channel{}
+	for _, channel := range s.channels {
+		if channel.OrganizationID == organizationID {
+			copied := *channel
+			channels = append(channels, &copied)
+		}
+	}
+	sort.Slice(channels, func(i, j int) bool {
+		return channels[i].CreatedAt.Before(channels[j].CreatedAt)
+	})
+	return channels, nil
+}
+
+func (s *MemoryStore) Delete(ctx context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.channels[id]; !ok {
+		return ErrNotFound
+	}
+	delete(s.channels, id)
+	return nil
+}
+
+// PostgresStore keeps channels in app_notification_channel.
+type PostgresStore struct {
+	client integrations.SQLStore
+}
+
+func NewPostgresStore(client integrations.SQLStore) *PostgresStore {
+	return &PostgresStore{client: client}
+}
+
+func (s *PostgresStore) EnsureSchema() error {
+	_, err := s.client.ExecuteUpdate(`
+		CREATE TABLE IF NOT EXISTS app_notification_channel (
+			id VARCHAR(64) PRIMARY KEY,
+			organization_id VARCHAR(255) NOT NULL,
+			project_id VARCHAR(255) NOT NULL DEFAULT '',
+			channel_type VARCHAR(16) NOT NULL,
+			name VARCHAR(255) NOT NULL DEFAULT '',
+			webhook_url TEXT NOT NULL,
+			kinds JSONB NOT NULL DEFAULT '[]',
+			templates JSONB NOT NULL DEFAULT '{}',
+			created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+		);
+		CREATE INDEX IF NOT EXISTS app_notification_channel_organization_idx ON app_notification_channel (organization_id);
+	`)
+	if err != nil {
+		return fmt.Errorf("error creating notification channel table: %v", err)
+	}
+	return nil
+}
+
+const channelColumns = `id, organization_id, project_id, channel_type, name, webhook_url, kinds, templates, created_at`
+
+func (s *PostgresStore) Create(ctx context.Context, channel *Channel) error {
+	kinds, err := json.Marshal(channel.Kinds)
+	if err != nil {
+		return err
+	}
+	templates, err := json.Marshal(channel.Templates)
+	if err != nil {
+		return err
+	}
+	_, err = s.client.ExecuteUpdate(
+		`INSERT INTO app_notification_channel (`+channelColumns+`) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)`,
+		channel.ID, channel.OrganizationID, channel.ProjectID, string(channel.Type), channel.Name, channel.WebhookURL,
+		string(kinds), string(templates), channel.CreatedAt,
+	)
+	if err != nil {
+		return fmt.Errorf("error creating notification channel: %v", err)
+	}
+	return nil
+}
+
+func (s *PostgresStore) Get(ctx context.Context, id string) (*Channel, error) {
+	rows, err := s.client.ExecuteQuery(`SELECT `+channelColumns+` FROM app_notification_channel WHERE id = $1`, id)
+	if err != nil {
+		return nil, fmt.Errorf("error loading notification channel %s: %v", id, err)
+	}
+	if len(rows) == 0 {
+		return nil, ErrNotFound
+	}
+	return channelFromRow(rows[0])
+}
+
+func (s *PostgresStore) List(ctx context.Context, organizationID string) ([]*Channel, error) {
+	rows, err := s.client.ExecuteQuery(
+		`SELECT `+channelColumns+` FROM app_notification_channel WHERE organization_id = $1 ORDER BY created_at`,
+		organizationID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("error listing notification channels: %v", err)
+	}
+
+	channels := make([]*Channel, 0, len(rows))
+	for _, row := range rows {
+		channel, err := channelFromRow(row)
+		if err != nil {
+			return nil, err
+		}
+		channels = append(channels, channel)
+	}
+	return channels, nil
+}
+
+func (s *PostgresStore) Delete(ctx context.Context, id string) error {
+	deleted, err := s.client.ExecuteUpdate(`DELETE FROM app_notification_channel WHERE id = $1`, id)
+	if err != nil {
+		return fmt.Errorf("error deleting notification channel %s: %v", id, err)
+	}
+	if deleted == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func channelFromRow(row map[string]interface{}) (*Channel, error) {
+	channel := &Channel{
+		ID:             fmt.Sprint(row["id"]),
+		OrganizationID: toString(row["organization_id"]),
+		ProjectID:      toString(row["project_id"]),
+		Type:           ChannelType(toString(row["channel_type"])),
+		Name:           toString(row["name"]),
+		WebhookURL:     toString(row["webhook_url"]),
+	}
+	if createdAt, ok := row["created_at"].(time.Time); ok {
+		channel.CreatedAt = createdAt.UTC()
+	}
+	if err := decodeJSONColumn(row["kinds"], &channel.Kinds); err != nil {
+		return nil, fmt.Errorf("error decoding kinds of notification channel %s: %v", channel.ID, err)
+	}
+	if err := decodeJSONColumn(row["templates"], &channel.Templates); err != nil {
+		return nil, fmt.Errorf("error decoding templates of notification channel %s: %v", channel.ID, err)
+	}
+	return channel, nil
+}
+
+func toString(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case []byte:
+		return string(v)
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+func decodeJSONColumn(value interface{}, target interface{}) error {
+	switch v := value.(type) {
+	case nil:
+		return nil
+	case []byte:
+		return json.Unmarshal(v, target)
+	case string:
+		return json.Unmarshal([]byte(v), target)
+	default:
+		return fmt.Errorf("unexpected JSON column type %T", value)
+	}
+}
@@ -0,0 +1,112 @@
+package notify
+
+import (
+	"fmt"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// DefaultTemplates render the kinds a channel has no template for. Templates
+// see the Notification, so .Data holds the kind-specific fields:
+//
+//	workspace.failed             workspace_id, workspace_name, error, stage
+//	workspace.auto_stop_warning  workspace_id, workspace_name, idle_since, stop_at
+//	quota.reached                resource, used, limit, period
+var DefaultTemplates = map[Kind]string{
+	KindWorkspaceFailed: `Workspace {{or .Data.workspace_name .Data.workspace_id}} failed` +
+		`{{with .Data.stage}} during {{.}}{{end}}{{with .Data.error}}: {{.}}{{end}}`,
+	KindAutoStopWarning: `Workspace {{or .Data.workspace_name .Data.workspace_id}} has been idle since {{time .Data.idle_since}}` +
+		` and will be stopped at {{time .Data.stop_at}} unless it becomes busy.`,
+	KindQuotaReached: `Project {{.ProjectID}} reached its {{.Data.resource}} quota` +
+		`{{with .Data.period}} for {{.}}{{end}}: {{.Data.used}} of {{.Data.limit}} used.`,
+}
+
+// Titles head Teams cards and name email subjects.
+var Titles = map[Kind]string{
+	KindWorkspaceFailed: "Workspace failed",
+	KindAutoStopWarning: "Workspace will be stopped",
+	KindQuotaReached:    "Quota reached",
+}
+
+var templateFuncs = template.FuncMap{
+	// time formats times, and strings holding RFC 3339 times, in UTC.
+	"time": func(value interface{}) string {
+		switch v := value.(type) {
+		case time.Time:
+			return v.UTC().Format("2006-01-02 15:04 MST")
+		case string:
+			if t, err := time.Parse(time.RFC3339, v); err == nil {
+				return t.UTC().Format("2006-01-02 15:04 MST")
+			}
+			return v
+		default:
+			return fmt.Sprint(v)
+		}
+	},
+}
+
+// Sample returns an example notification of the kind, for trying out a
+// channel and its templates.
+func Sample(kind Kind, organizationID, projectID string, now time.Time) Notification {
+	notification := Notification{
+		Kind:           kind,
+		OrganizationID: organizationID,
+		ProjectID:      projectID,
+		Subject:        "sample",
+		OccurredAt:     now.UTC(),
+	}
+	switch kind {
+	case KindWorkspaceFailed:
+		notification.Data = map[string]interface{}{
+			"workspace_id":   "sample",
+			"workspace_name": "sample-workspace",
+			"error":          "image pull failed",
+			"stage":          "create",
+		}
+	case KindAutoStopWarning:
+		notification.Data = map[string]interface{}{
+			"workspace_id":   "sample",
+			"workspace_name": "sample-workspace",
+			"idle_since":     now.Add(-time.Hour),
+			"stop_at":        now.Add(30 * time.Minute),
+		}
+	case KindQuotaReached:
+		notification.Data = map[string]interface{}{
+			"resource": "cpu_hours",
+			"used":     100.0,
+			"limit":    100.0,
+			"period":   now.UTC().Format("2006-01"),
+		}
+	}
+	return notification
+}
+
+func parseTemplate(kind Kind, text string) (*template.Template, error) {
+	parsed, err := template.New(string(kind)).Funcs(templateFuncs).Option("missingkey=zero").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("invalid template for %s: %v", kind, err)
+	}
+	return parsed, nil
+}
+
+// Render returns the text of a notification in a channel.
+func Render(channel *Channel, notification Notification) (string, error) {
+	text, ok := channel.Templates[notification.Kind]
+	if !ok {
+		text, ok = DefaultTemplates[notification.Kind]
+	}
+	if !ok {
+		return "", fmt.Errorf("no template for %s", notification.Kind)
+	}
+
+	parsed, err := parseTemplate(notification.Kind, text)
+	if err != nil {
+		return "", err
+	}
+	var message strings.Builder
+	if err := parsed.Execute(&message, notification); err != nil {
+		return "", fmt.Errorf("error rendering %s: %v", notification.Kind, err)
+	}
+	return strings.TrimSpace(strings.ReplaceAll(message.String(), "<no value>", "")), nil
+}
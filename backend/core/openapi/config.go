@@ -0,0 +1,46 @@
+package openapi
+
+import (
+	"strconv"
+
+	"github.com/spectrumwebco/agent_runtime/backend/core/config/env"
+)
+
+type Config struct {
+	// ValidateRequests rejects requests not matching the document.
+	ValidateRequests bool `json:"validate_requests"`
+	// ValidateResponses logs and counts JSON responses not matching the
+	// document. It buffers every documented response, so it is meant for
+	// development and staging.
+	ValidateResponses bool `json:"validate_responses"`
+	// MaxBodyBytes bounds the request bodies read for validation. Larger
+	// bodies are passed on unvalidated.
+	MaxBodyBytes int64 `json:"max_body_bytes"`
+}
+
+const DefaultMaxBodyBytes = 1 << 20
+
+var DefaultConfig = env.Once(FromEnv)
+
+// FromEnv validates requests, but not responses, unless the
+// AGENT_OPENAPI_VALIDATE_* variables say otherwise.
+func FromEnv() Config {
+	config := Config{
+		ValidateRequests: true,
+		MaxBodyBytes:     DefaultMaxBodyBytes,
+	}
+	read := env.NewReader(openapiLogger)
+	read.Bool("AGENT_OPENAPI_VALIDATE_REQUESTS", &config.ValidateRequests)
+	read.Bool("AGENT_OPENAPI_VALIDATE_RESPONSES", &config.ValidateResponses)
+	read.Int64("AGENT_OPENAPI_MAX_BODY_BYTES", &config.MaxBodyBytes, 1)
+	return config
+}
+
+// Variables returns the variables FromEnv reads c from.
+func (c Config) Variables() map[string]string {
+	return map[string]string{
+		"AGENT_OPENAPI_VALIDATE_REQUESTS":  strconv.FormatBool(c.ValidateRequests),
+		"AGENT_OPENAPI_VALIDATE_RESPONSES": strconv.FormatBool(c.ValidateResponses),
+		"AGENT_OPENAPI_MAX_BODY_BYTES":     strconv.FormatInt(c.MaxBodyBytes, 10),
+	}
+}
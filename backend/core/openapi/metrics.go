@@ -0,0 +1,20 @@
+package openapi
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	rejectionsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "kled_openapi_request_rejections_total",
+		Help: "Requests rejected for not matching the OpenAPI document, by operation.",
+	}, []string{"operation"})
+	responseViolationsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "kled_openapi_response_violations_total",
+		Help: "Responses not matching the OpenAPI document, by operation.",
+	}, []string{"operation"})
+)
+
+func init() {
+	prometheus.MustRegister(rejectionsTotal, responseViolationsTotal)
+}
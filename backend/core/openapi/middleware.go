@@ -0,0 +1,218 @@
+package openapi
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+
+	"github.com/spectrumwebco/agent_runtime/backend/core/kerrors"
+)
+
+// Validate returns a handler validating the requests, and optionally the
+// responses, of next against the document of the registry. Requests the
+// document doesn't cover are passed on unchecked.
+func (r *Registry) Validate(config Config, next http.Handler) http.Handler {
+	if config.MaxBodyBytes <= 0 {
+		config.MaxBodyBytes = DefaultMaxBodyBytes
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if !config.ValidateRequests && !config.ValidateResponses {
+			next.ServeHTTP(w, req)
+			return
+		}
+		route, description, params, ok := r.match(req.Method, req.URL.Path)
+		if !ok {
+			next.ServeHTTP(w, req)
+			return
+		}
+
+		if config.ValidateRequests {
+			status, err := validateRequest(req, route, description, params, config.MaxBodyBytes)
+			if err != nil {
+				rejectionsTotal.WithLabelValues(route.view).Inc()
+				writeError(w, status, err)
+				return
+			}
+		}
+
+		if !config.ValidateResponses || description.response == nil {
+			next.ServeHTTP(w, req)
+			return
+		}
+		recorder := &responseRecorder{ResponseWriter: w, limit: config.MaxBodyBytes}
+		next.ServeHTTP(recorder, req)
+		checkResponse(recorder, route, description)
+	})
+}
+
+// validateRequest checks the path and query parameters and the JSON body of
+// a request. The body is left for the handler to read.
+func validateRequest(req *http.Request, route *route, description described, params map[string]string, maxBodyBytes int64) (int, error) {
+	for _, param := range route.params {
+		if err := validateParameter(param, params[param.Name], true); err != nil {
+			return http.StatusBadRequest, err
+		}
+	}
+	query := req.URL.Query()
+	for _, param := range description.Query {
+		if err := validateParameter(param, query.Get(param.Name), query.Has(param.Name)); err != nil {
+			return http.StatusBadRequest, err
+		}
+	}
+
+	if description.request == nil || !hasBody(req.Method) || req.Body == nil {
+		return 0, nil
+	}
+	if contentType := req.Header.Get("Content-Type"); contentType != "" {
+		mediaType, _, err := mime.ParseMediaType(contentType)
+		if err != nil || mediaType != "application/json" {
+			return http.StatusUnsupportedMediaType, &ValidationError{Message: "content type must be application/json"}
+		}
+	}
+
+	body, err := io.ReadAll(io.LimitReader(req.Body, maxBodyBytes+1))
+	if err != nil {
+		return http.StatusBadRequest, &ValidationError{Message: "failed to read request body"}
+	}
+	// bodies too large to buffer are left to the handler
+	if int64(len(body)) > maxBodyBytes {
+		req.Body = readCloser{io.MultiReader(bytes.NewReader(body), req.Body), req.Body}
+		return 0, nil
+	}
+	req.Body = readCloser{bytes.NewReader(body), req.Body}
+
+	if len(bytes.TrimSpace(body)) == 0 {
+		return http.StatusBadRequest, &ValidationError{Message: "request body is required"}
+	}
+	var value interface{}
+	if err := json.Unmarshal(body, &value); err != nil {
+		return http.StatusBadRequest, &ValidationError{Message: "request body is not valid JSON"}
+	}
+	if err := description.request.Validate(value); err != nil {
+		return http.StatusBadRequest, err
+	}
+	return 0, nil
+}
+
+func validateParameter(param *Parameter, raw string, present bool) error {
+	if !present || raw == "" {
+		if param.Required {
+			return &ValidationError{Field: param.Name, Message: "is required"}
+		}
+		return nil
+	}
+
+	var value interface{} = raw
+	switch param.Schema.Type {
+	case "integer", "number":
+		number, err := strconv.ParseFloat(raw, 64)
+		if err != nil {
+			return &ValidationError{Field: param.Name, Message: "must be a " + param.Schema.Type}
+		}
+		value = number
+	case "boolean":
+		flag, err := strconv.ParseBool(raw)
+		if err != nil {
+			return &ValidationError{Field: param.Name, Message: "must be a boolean"}
+		}
+		value = flag
+	}
+
+	if err := param.Schema.Validate(value); err != nil {
+		return &ValidationError{Field: param.Name, Message: err.(*ValidationError).Message}
+	}
+	return nil
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	body := kerrors.Body(kerrors.Wrap(kerrors.FromHTTPStatus(status), err))
+	var validationErr *ValidationError
+	if errors.As(err, &validationErr) && validationErr.Field != "" {
+		body["field"] = validationErr.Field
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
+
+// checkResponse validates a recorded successful JSON response. Violations
+// are logged and counted; the response was already sent.
+func checkResponse(recorder *responseRecorder, route *route, description described) {
+	if recorder.status() != description.status() || recorder.truncated {
+		return
+	}
+	mediaType, _, _ := mime.ParseMediaType(recorder.Header().Get("Content-Type"))
+	if mediaType != "application/json" {
+		return
+	}
+
+	var value interface{}
+	err := json.Unmarshal(recorder.body.Bytes(), &value)
+	if err == nil {
+		err = description.response.Validate(value)
+	}
+	if err != nil {
+		responseViolationsTotal.WithLabelValues(route.view).Inc()
+		openapiLogger.Printf("Response of %s does not match the document: %v", route.view, err)
+	}
+}
+
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
+
+// responseRecorder passes a response on while keeping a copy of its body,
+// up to limit bytes.
+type responseRecorder struct {
+	http.ResponseWriter
+	code      int
+	body      bytes.Buffer
+	limit     int64
+	truncated bool
+}
+
+func (r *responseRecorder) WriteHeader(code int) {
+	if r.code == 0 {
+		r.code = code
+	}
+	r.ResponseWriter.WriteHeader(code)
+}
+
+func (r *responseRecorder) Write(data []byte) (int, error) {
+	if r.code == 0 {
+		r.code = http.StatusOK
+	}
+	if !r.truncated {
+		if int64(r.body.Len()+len(data)) > r.limit {
+			r.truncated = true
+			r.body.Reset()
+		} else {
+			r.body.Write(data)
+		}
+	}
+	return r.ResponseWriter.Write(data)
+}
+
+func (r *responseRecorder) status() int {
+	if r.code == 0 {
+		return http.StatusOK
+	}
+	return r.code
+}
+
+func (r *responseRecorder) Flush() {
+	if flusher, ok := r.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+func (r *responseRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
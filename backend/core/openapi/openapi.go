@@ -0,0 +1,389 @@
+// Package openapi describes the backend's HTTP API as an OpenAPI 3 document
+// and validates requests against it.
+//
+// The document is built from the route definitions: the URL patterns of an
+// app give the paths and the views they are routed to, and the views, as
+// registered with their methods and permissions, give the operations.
+// Describe adds what can't be derived from the routes, such as summaries and
+// the Go types of request and response bodies, whose JSON schemas are
+// generated by reflection.
+//
+// Validation is configured with the AGENT_OPENAPI_VALIDATE_REQUESTS and
+// AGENT_OPENAPI_VALIDATE_RESPONSES settings. Requests failing validation are
+// rejected with 400; responses are only checked, and mismatches are logged
+// and counted, so a wrong schema never breaks a working endpoint.
+package openapi
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+)
+
+var openapiLogger = log.New(os.Stdout, "kled.openapi: ", log.LstdFlags)
+
+// Version is the OpenAPI version of the generated documents.
+const Version = "3.0.3"
+
+type Document struct {
+	OpenAPI    string               `json:"openapi"`
+	Info       Info                 `json:"info"`
+	Servers    []Server             `json:"servers,omitempty"`
+	Paths      map[string]*PathItem `json:"paths"`
+	Components Components           `json:"components"`
+}
+
+type Info struct {
+	Title       string `json:"title"`
+	Description string `json:"description,omitempty"`
+	Version     string `json:"version"`
+}
+
+type Server struct {
+	URL string `json:"url"`
+}
+
+// PathItem maps lower case HTTP methods to operations.
+type PathItem map[string]*Operation
+
+type Operation struct {
+	OperationID string                `json:"operationId"`
+	Summary     string                `json:"summary,omitempty"`
+	Description string                `json:"description,omitempty"`
+	Tags        []string              `json:"tags,omitempty"`
+	Parameters  []*Parameter          `json:"parameters,omitempty"`
+	RequestBody *RequestBody          `json:"requestBody,omitempty"`
+	Responses   map[string]*Response  `json:"responses"`
+	Security    []map[string][]string `json:"security,omitempty"`
+	// Permissions lists the permission classes of the view.
+	Permissions []string `json:"x-permissions,omitempty"`
+}
+
+type Parameter struct {
+	Name        string  `json:"name"`
+	In          string  `json:"in"`
+	Description string  `json:"description,omitempty"`
+	Required    bool    `json:"required,omitempty"`
+	Schema      *Schema `json:"schema"`
+}
+
+type RequestBody struct {
+	Required bool                  `json:"required"`
+	Content  map[string]*MediaType `json:"content"`
+}
+
+type Response struct {
+	Description string                `json:"description"`
+	Content     map[string]*MediaType `json:"content,omitempty"`
+}
+
+type MediaType struct {
+	Schema *Schema `json:"schema"`
+}
+
+type Components struct {
+	Schemas         map[string]*Schema         `json:"schemas,omitempty"`
+	SecuritySchemes map[string]*SecurityScheme `json:"securitySchemes,omitempty"`
+}
+
+type SecurityScheme struct {
+	Type string `json:"type"`
+	In   string `json:"in,omitempty"`
+	Name string `json:"name,omitempty"`
+}
+
+// Description documents a view beyond what its route definition tells.
+type Description struct {
+	Summary     string
+	Description string
+	Tags        []string
+	// Query lists the query parameters of the view.
+	Query []*Parameter
+	// Request is a value of the type of the JSON request body, if any.
+	Request interface{}
+	// Response is a value of the type of the JSON body of successful
+	// responses, if known.
+	Response interface{}
+	// Status is the status of successful responses, 200 if zero.
+	Status int
+}
+
+// view is a view as registered with its methods and permissions.
+type view struct {
+	methods     []string
+	permissions []string
+}
+
+// route is a URL pattern routed to a view.
+type route struct {
+	// path is the OpenAPI path, such as /api/tunnels/{tunnel_id}/.
+	path    string
+	pattern *regexp.Regexp
+	params  []*Parameter
+	view    string
+}
+
+// described is a Description with the schemas of its bodies.
+type described struct {
+	Description
+	request  *Schema
+	response *Schema
+}
+
+// Registry collects the routes, views and descriptions the document is built
+// from.
+type Registry struct {
+	mu           sync.RWMutex
+	routes       []*route
+	views        map[string]view
+	descriptions map[string]described
+	// document caches the document until the registry changes.
+	document *Document
+}
+
+func NewRegistry() *Registry {
+	return &Registry{views: map[string]view{}, descriptions: map[string]described{}}
+}
+
+var defaultRegistry = NewRegistry()
+
+// Default returns the registry the apps of the process register with.
+func Default() *Registry {
+	return defaultRegistry
+}
+
+// View records the methods and permissions a view is registered with.
+func (r *Registry) View(name string, methods, permissions []string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.views[name] = view{methods: methods, permissions: permissions}
+	r.document = nil
+}
+
+// Describe documents a view.
+func (r *Registry) Describe(name string, description Description) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	d := described{Description: description}
+	if description.Request != nil {
+		d.request = SchemaOf(description.Request)
+	}
+	if description.Response != nil {
+		d.response = SchemaOf(description.Response)
+	}
+	r.descriptions[name] = d
+	r.document = nil
+}
+
+// patternParam matches the parameters of URL patterns, such as
+// <str:tunnel_id>.
+var patternParam = regexp.MustCompile(`<(?:(\w+):)?(\w+)>`)
+
+// Route records a URL pattern, relative to prefix, that is routed to view.
+func (r *Registry) Route(prefix, pattern, viewName string) error {
+	path := "/" + strings.Trim(prefix, "/") + "/" + strings.TrimPrefix(pattern, "/")
+	path = strings.ReplaceAll(path, "//", "/")
+
+	var params []*Parameter
+	expr := "^"
+	last := 0
+	for _, match := range patternParam.FindAllStringSubmatchIndex(path, -1) {
+		converter, name := "str", path[match[4]:match[5]]
+		if match[2] >= 0 {
+			converter = path[match[2]:match[3]]
+		}
+
+		schema, valueExpr := &Schema{Type: "string"}, `[^/]+`
+		switch converter {
+		case "str", "slug":
+		case "int":
+			schema, valueExpr = &Schema{Type: "integer"}, `[0-9]+`
+		case "uuid":
+			schema, valueExpr = &Schema{Type: "string", Format: "uuid"}, `[0-9a-fA-F-]{36}`
+		case "path":
+			valueExpr = `.+`
+		default:
+			return fmt.Errorf("unknown converter %q in pattern %s", converter, pattern)
+		}
+
+		expr += regexp.QuoteMeta(path[last:match[0]]) + "(" + valueExpr + ")"
+		params = append(params, &Parameter{Name: name, In: "path", Required: true, Schema: schema})
+		last = match[1]
+	}
+	expr += regexp.QuoteMeta(path[last:]) + "$"
+
+	compiled, err := regexp.Compile(expr)
+	if err != nil {
+		return fmt.Errorf("compile pattern %s: %v", pattern, err)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.routes = append(r.routes, &route{
+		path:    patternParam.ReplaceAllString(path, "{$2}"),
+		pattern: compiled,
+		params:  params,
+		view:    viewName,
+	})
+	r.document = nil
+	return nil
+}
+
+// Document returns the OpenAPI document of the registered routes. Routes
+// to views that were never registered are left out.
+func (r *Registry) Document(info Info) *Document {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.document != nil && r.document.Info == info {
+		return r.document
+	}
+
+	document := &Document{
+		OpenAPI: Version,
+		Info:    info,
+		Paths:   map[string]*PathItem{},
+		Components: Components{
+			Schemas: map[string]*Schema{"Error": errorSchema},
+			SecuritySchemes: map[string]*SecurityScheme{
+				"apiKey": {Type: "apiKey", In: "header", Name: "X-API-Key"},
+			},
+		},
+	}
+	for _, route := range r.routes {
+		view, ok := r.views[route.view]
+		if !ok {
+			continue
+		}
+
+		item := document.Paths[route.path]
+		if item == nil {
+			item = &PathItem{}
+			document.Paths[route.path] = item
+		}
+		for _, method := range view.methods {
+			(*item)[strings.ToLower(method)] = r.operation(route, method, view)
+		}
+	}
+
+	r.document = document
+	return document
+}
+
+// errorSchema is the body of the backend's error responses.
+var errorSchema = &Schema{
+	Type: "object",
+	Properties: map[string]*Schema{
+		"status":  {Type: "string"},
+		"message": {Type: "string"},
+		"field":   {Type: "string"},
+	},
+}
+
+func (r *Registry) operation(route *route, method string, view view) *Operation {
+	description := r.descriptions[route.view]
+	operation := &Operation{
+		OperationID: route.view,
+		Summary:     description.Summary,
+		Description: description.Description.Description,
+		Tags:        description.Tags,
+		Parameters:  append(append([]*Parameter{}, route.params...), description.Query...),
+		Permissions: view.permissions,
+		Responses: map[string]*Response{
+			"default": {
+				Description: "Error",
+				Content:     map[string]*MediaType{"application/json": {Schema: &Schema{Ref: "#/components/schemas/Error"}}},
+			},
+		},
+	}
+	if len(operation.Tags) == 0 {
+		operation.Tags = []string{tag(route.path)}
+	}
+	for _, permission := range view.permissions {
+		if permission != "AllowAny" {
+			operation.Security = []map[string][]string{{"apiKey": {}}}
+			break
+		}
+	}
+
+	if description.request != nil && hasBody(method) {
+		operation.RequestBody = &RequestBody{
+			Required: true,
+			Content:  map[string]*MediaType{"application/json": {Schema: description.request}},
+		}
+	}
+
+	success := &Response{Description: "Success"}
+	if description.response != nil {
+		success.Content = map[string]*MediaType{"application/json": {Schema: description.response}}
+	}
+	operation.Responses[fmt.Sprint(description.status())] = success
+	return operation
+}
+
+// tag groups operations by the first segment of their path after /api/.
+func tag(path string) string {
+	segments := strings.Split(strings.Trim(path, "/"), "/")
+	if len(segments) > 1 {
+		return segments[1]
+	}
+	return segments[0]
+}
+
+func hasBody(method string) bool {
+	switch strings.ToUpper(method) {
+	case "POST", "PUT", "PATCH":
+		return true
+	}
+	return false
+}
+
+func (d described) status() int {
+	if d.Status == 0 {
+		return 200
+	}
+	return d.Status
+}
+
+// match returns the operation of a request, and the values of its path
+// parameters. It reports false for requests the document doesn't cover.
+func (r *Registry) match(method, path string) (*route, described, map[string]string, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	for _, route := range r.routes {
+		values := route.pattern.FindStringSubmatch(path)
+		if values == nil {
+			continue
+		}
+
+		view, ok := r.views[route.view]
+		if !ok {
+			return nil, described{}, nil, false
+		}
+		for _, allowed := range view.methods {
+			if strings.EqualFold(allowed, method) {
+				params := make(map[string]string, len(route.params))
+				for i, param := range route.params {
+					params[param.Name] = values[i+1]
+				}
+				return route, r.descriptions[route.view], params, true
+			}
+		}
+		// other methods are answered by the view with 405
+		return nil, described{}, nil, false
+	}
+	return nil, described{}, nil, false
+}
+
+// SortedPaths returns the documented paths in order, for listings.
+func (d *Document) SortedPaths() []string {
+	paths := make([]string, 0, len(d.Paths))
+	for path := range d.Paths {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	return paths
+}
@@ -0,0 +1,173 @@
+package openapi
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	dto "github.com/prometheus/client_model/go"
+)
+
+type createTunnel struct {
+	WorkspaceID string     `json:"workspace_id" openapi:"required"`
+	Port        int        `json:"port" openapi:"required"`
+	Protocol    string     `json:"protocol,omitempty" openapi:"enum=http|tcp"`
+	Labels      []string   `json:"labels,omitempty"`
+	ExpiresAt   *time.Time `json:"expires_at,omitempty"`
+}
+
+type tunnel struct {
+	ID   string `json:"id" openapi:"required"`
+	Port int    `json:"port"`
+}
+
+func newTestRegistry(t *testing.T) *Registry {
+	registry := NewRegistry()
+	registry.View("tunnels", []string{"GET", "POST"}, []string{"IsAuthenticated"})
+	registry.View("tunnel_detail", []string{"GET"}, []string{"AllowAny"})
+	registry.Describe("tunnels", Description{
+		Summary:  "Open a tunnel",
+		Query:    []*Parameter{{Name: "limit", In: "query", Schema: &Schema{Type: "integer"}}},
+		Request:  createTunnel{},
+		Response: tunnel{},
+		Status:   http.StatusCreated,
+	})
+	for pattern, view := range map[string]string{
+		"tunnels/":                  "tunnels",
+		"tunnels/<str:tunnel_id>/":  "tunnel_detail",
+		"never/<int:id>/registered": "missing",
+	} {
+		if err := registry.Route("/api/", pattern, view); err != nil {
+			t.Fatalf("route %s: %v", pattern, err)
+		}
+	}
+	return registry
+}
+
+func TestDocument(t *testing.T) {
+	document := newTestRegistry(t).Document(Info{Title: "Test", Version: "1"})
+
+	if paths := document.SortedPaths(); strings.Join(paths, " ") != "/api/tunnels/ /api/tunnels/{tunnel_id}/" {
+		t.Fatalf("unexpected paths %v", paths)
+	}
+
+	post := (*document.Paths["/api/tunnels/"])["post"]
+	if post.OperationID != "tunnels" || len(post.Security) != 1 || post.Tags[0] != "tunnels" {
+		t.Fatalf("unexpected operation %+v", post)
+	}
+	request := post.RequestBody.Content["application/json"].Schema
+	if strings.Join(request.Required, ",") != "port,workspace_id" {
+		t.Fatalf("unexpected required fields %v", request.Required)
+	}
+	if expires := request.Properties["expires_at"]; expires.Format != "date-time" || !expires.Nullable {
+		t.Fatalf("unexpected schema of expires_at %+v", expires)
+	}
+	if _, ok := post.Responses["201"]; !ok {
+		t.Fatalf("missing success response in %v", post.Responses)
+	}
+
+	detail := (*document.Paths["/api/tunnels/{tunnel_id}/"])["get"]
+	if len(detail.Security) != 0 || detail.Parameters[0].Name != "tunnel_id" {
+		t.Fatalf("unexpected operation %+v", detail)
+	}
+
+	// the document is plain JSON
+	if _, err := json.Marshal(document); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	var received string
+	handler := newTestRegistry(t).Validate(Config{ValidateRequests: true}, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		received = string(body)
+		w.WriteHeader(http.StatusCreated)
+	}))
+
+	for _, test := range []struct {
+		name   string
+		method string
+		target string
+		body   string
+		status int
+		field  string
+	}{
+		{"valid", "POST", "/api/tunnels/", `{"workspace_id": "ws-1", "port": 8080, "protocol": "http"}`, http.StatusCreated, ""},
+		{"missing field", "POST", "/api/tunnels/", `{"workspace_id": "ws-1"}`, http.StatusBadRequest, "port"},
+		{"wrong type", "POST", "/api/tunnels/", `{"workspace_id": "ws-1", "port": "8080"}`, http.StatusBadRequest, "port"},
+		{"not an integer", "POST", "/api/tunnels/", `{"workspace_id": "ws-1", "port": 80.5}`, http.StatusBadRequest, "port"},
+		{"enum", "POST", "/api/tunnels/", `{"workspace_id": "ws-1", "port": 1, "protocol": "udp"}`, http.StatusBadRequest, "protocol"},
+		{"nested", "POST", "/api/tunnels/", `{"workspace_id": "ws-1", "port": 1, "labels": ["a", 2]}`, http.StatusBadRequest, "labels[1]"},
+		{"invalid JSON", "POST", "/api/tunnels/", `{"workspace_id": `, http.StatusBadRequest, ""},
+		{"empty body", "POST", "/api/tunnels/", ``, http.StatusBadRequest, ""},
+		{"query", "GET", "/api/tunnels/?limit=ten", ``, http.StatusBadRequest, "limit"},
+		{"undocumented", "GET", "/api/tunnels/t-1/", ``, http.StatusCreated, ""},
+		{"unknown path", "POST", "/api/unknown/", `nonsense`, http.StatusCreated, ""},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			received = ""
+			req := httptest.NewRequest(test.method, test.target, strings.NewReader(test.body))
+			req.Header.Set("Content-Type", "application/json")
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, req)
+
+			if w.Code != test.status {
+				t.Fatalf("expected status %d, got %d: %s", test.status, w.Code, w.Body.String())
+			}
+			if w.Code == http.StatusBadRequest {
+				body := map[string]string{}
+				if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+					t.Fatal(err)
+				}
+				if body["status"] != "error" || body["field"] != test.field {
+					t.Fatalf("unexpected error %v", body)
+				}
+			} else if received != test.body {
+				// the handler still reads the validated body
+				t.Fatalf("handler received %q", received)
+			}
+		})
+	}
+
+	req := httptest.NewRequest("POST", "/api/tunnels/", strings.NewReader(`port=1`))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	if w.Code != http.StatusUnsupportedMediaType {
+		t.Fatalf("expected status 415, got %d", w.Code)
+	}
+}
+
+func TestValidateResponses(t *testing.T) {
+	body := `{"port": 8080}`
+	handler := newTestRegistry(t).Validate(Config{ValidateResponses: true}, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		io.WriteString(w, body)
+	}))
+
+	req := httptest.NewRequest("POST", "/api/tunnels/", strings.NewReader(`{}`))
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	// the response is passed on, the violation only counted
+	if w.Code != http.StatusCreated || w.Body.String() != body {
+		t.Fatalf("unexpected response %d %s", w.Code, w.Body.String())
+	}
+	if count := violations(t, "tunnels"); count != 1 {
+		t.Fatalf("expected 1 violation, got %v", count)
+	}
+}
+
+func violations(t *testing.T, operation string) float64 {
+	m := &dto.Metric{}
+	if err := responseViolationsTotal.WithLabelValues(operation).Write(m); err != nil {
+		t.Fatal(err)
+	}
+	return m.GetCounter().GetValue()
+}
@@ -0,0 +1,267 @@
+package openapi
+
+import (
+	"encoding"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Schema is the subset of the OpenAPI schema object generated from Go
+// types and checked by Validate.
+type Schema struct {
+	Ref                  string             `json:"$ref,omitempty"`
+	Type                 string             `json:"type,omitempty"`
+	Format               string             `json:"format,omitempty"`
+	Description          string             `json:"description,omitempty"`
+	Enum                 []interface{}      `json:"enum,omitempty"`
+	Nullable             bool               `json:"nullable,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+	AdditionalProperties *Schema            `json:"additionalProperties,omitempty"`
+}
+
+var (
+	timeType       = reflect.TypeOf(time.Time{})
+	durationType   = reflect.TypeOf(time.Duration(0))
+	rawMessageType = reflect.TypeOf(json.RawMessage{})
+
+	jsonMarshalerType = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+	textMarshalerType = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+)
+
+// SchemaOf returns the schema of the JSON encoding of value's type.
+//
+// Fields are named by their json tags. Fields tagged `openapi:"required"`
+// are required, and `openapi:"enum=a|b"` restricts a field to the given
+// values.
+func SchemaOf(value interface{}) *Schema {
+	return schemaOf(reflect.TypeOf(value), map[reflect.Type]bool{})
+}
+
+func schemaOf(t reflect.Type, seen map[reflect.Type]bool) *Schema {
+	if t == nil {
+		return &Schema{}
+	}
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	switch t {
+	case timeType:
+		return &Schema{Type: "string", Format: "date-time"}
+	case durationType:
+		return &Schema{Type: "integer", Format: "int64"}
+	case rawMessageType:
+		return &Schema{}
+	}
+	// custom encodings can't be told from the type, they accept any value
+	if t.Implements(jsonMarshalerType) || reflect.PtrTo(t).Implements(jsonMarshalerType) {
+		return &Schema{}
+	}
+	if t.Implements(textMarshalerType) || reflect.PtrTo(t).Implements(textMarshalerType) {
+		return &Schema{Type: "string"}
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return &Schema{Type: "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32:
+		return &Schema{Type: "integer", Format: "int32"}
+	case reflect.Int64, reflect.Uint64:
+		return &Schema{Type: "integer", Format: "int64"}
+	case reflect.Float32:
+		return &Schema{Type: "number", Format: "float"}
+	case reflect.Float64:
+		return &Schema{Type: "number", Format: "double"}
+	case reflect.String:
+		return &Schema{Type: "string"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return &Schema{Type: "string", Format: "byte"}
+		}
+		return &Schema{Type: "array", Items: schemaOf(t.Elem(), seen)}
+	case reflect.Map:
+		return &Schema{Type: "object", AdditionalProperties: schemaOf(t.Elem(), seen)}
+	case reflect.Struct:
+		// recursive types are cut off at the first repetition
+		if seen[t] {
+			return &Schema{Type: "object"}
+		}
+		seen[t] = true
+		defer delete(seen, t)
+
+		schema := &Schema{Type: "object", Properties: map[string]*Schema{}}
+		addFields(schema, t, seen)
+		sort.Strings(schema.Required)
+		return schema
+	}
+
+	// interfaces and anything without a JSON encoding accept any value
+	return &Schema{}
+}
+
+func addFields(schema *Schema, t reflect.Type, seen map[reflect.Type]bool) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := field.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, _, _ := strings.Cut(tag, ",")
+
+		// embedded structs without a name are flattened, like encoding/json
+		if field.Anonymous && name == "" {
+			embedded := field.Type
+			if embedded.Kind() == reflect.Ptr {
+				embedded = embedded.Elem()
+			}
+			if embedded.Kind() == reflect.Struct {
+				addFields(schema, embedded, seen)
+				continue
+			}
+		}
+		if !field.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+
+		property := schemaOf(field.Type, seen)
+		if field.Type.Kind() == reflect.Ptr {
+			property.Nullable = true
+		}
+		for _, option := range strings.Split(field.Tag.Get("openapi"), ",") {
+			switch {
+			case option == "required":
+				schema.Required = append(schema.Required, name)
+			case strings.HasPrefix(option, "enum="):
+				for _, value := range strings.Split(strings.TrimPrefix(option, "enum="), "|") {
+					property.Enum = append(property.Enum, value)
+				}
+			}
+		}
+		schema.Properties[name] = property
+	}
+}
+
+// ValidationError is a value not matching a schema.
+type ValidationError struct {
+	// Field is the path of the invalid value, such as items[0].name, empty
+	// for the value itself.
+	Field   string
+	Message string
+}
+
+func (e *ValidationError) Error() string {
+	if e.Field == "" {
+		return e.Message
+	}
+	return e.Field + ": " + e.Message
+}
+
+// Validate checks a value decoded by encoding/json against the schema.
+func (s *Schema) Validate(value interface{}) error {
+	return s.validate("", value)
+}
+
+func (s *Schema) validate(field string, value interface{}) error {
+	if s == nil || s.Ref != "" {
+		return nil
+	}
+	if value == nil {
+		if s.Type == "" || s.Nullable {
+			return nil
+		}
+		return &ValidationError{Field: field, Message: "must not be null"}
+	}
+
+	if len(s.Enum) > 0 {
+		allowed := false
+		for _, option := range s.Enum {
+			if fmt.Sprint(option) == fmt.Sprint(value) {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			return &ValidationError{Field: field, Message: fmt.Sprintf("must be one of %v", s.Enum)}
+		}
+	}
+
+	switch s.Type {
+	case "":
+		return nil
+	case "boolean":
+		if _, ok := value.(bool); !ok {
+			return &ValidationError{Field: field, Message: "must be a boolean"}
+		}
+	case "integer":
+		number, ok := value.(float64)
+		if !ok || number != float64(int64(number)) {
+			return &ValidationError{Field: field, Message: "must be an integer"}
+		}
+	case "number":
+		if _, ok := value.(float64); !ok {
+			return &ValidationError{Field: field, Message: "must be a number"}
+		}
+	case "string":
+		text, ok := value.(string)
+		if !ok {
+			return &ValidationError{Field: field, Message: "must be a string"}
+		}
+		if s.Format == "date-time" {
+			if _, err := time.Parse(time.RFC3339, text); err != nil {
+				return &ValidationError{Field: field, Message: "must be an RFC 3339 date-time"}
+			}
+		}
+	case "array":
+		items, ok := value.([]interface{})
+		if !ok {
+			return &ValidationError{Field: field, Message: "must be an array"}
+		}
+		for i, item := range items {
+			if err := s.Items.validate(fmt.Sprintf("%s[%d]", field, i), item); err != nil {
+				return err
+			}
+		}
+	case "object":
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return &ValidationError{Field: field, Message: "must be an object"}
+		}
+		for _, name := range s.Required {
+			if _, ok := object[name]; !ok {
+				return &ValidationError{Field: join(field, name), Message: "is required"}
+			}
+		}
+
+		names := make([]string, 0, len(object))
+		for name := range object {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			property, ok := s.Properties[name]
+			if !ok {
+				property = s.AdditionalProperties
+			}
+			if err := property.validate(join(field, name), object[name]); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func join(field, name string) string {
+	if field == "" {
+		return name
+	}
+	return field + "." + name
+}
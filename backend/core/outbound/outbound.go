@@ -0,0 +1,155 @@
+// Package outbound configures proxies and trusted certificate authorities
+// for connections the backend opens to other services.
+//
+// The configuration is read from the AGENT_HTTP_PROXY, AGENT_HTTPS_PROXY,
+// AGENT_NO_PROXY and AGENT_CA_BUNDLE settings, falling back to the standard
+// HTTP_PROXY, HTTPS_PROXY and NO_PROXY variables. The CA bundle is added to
+// the system roots, so public endpoints keep working behind a TLS
+// intercepting proxy.
+package outbound
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+
+	"github.com/spectrumwebco/agent_runtime/backend/core/chaos"
+	"github.com/spectrumwebco/agent_runtime/backend/core/config/env"
+	"golang.org/x/net/http/httpproxy"
+)
+
+type Config struct {
+	HTTPProxy  string `json:"http_proxy"`
+	HTTPSProxy string `json:"https_proxy"`
+	NoProxy    string `json:"no_proxy"`
+	// CABundle is the path to a PEM file with additional trusted CAs.
+	CABundle string `json:"ca_bundle"`
+}
+
+var Default = env.Once(FromEnv)
+
+func FromEnv() Config {
+	return Config{
+		HTTPProxy:  lookupEnv("AGENT_HTTP_PROXY", "HTTP_PROXY", "http_proxy"),
+		HTTPSProxy: lookupEnv("AGENT_HTTPS_PROXY", "HTTPS_PROXY", "https_proxy"),
+		NoProxy:    lookupEnv("AGENT_NO_PROXY", "NO_PROXY", "no_proxy"),
+		CABundle:   lookupEnv("AGENT_CA_BUNDLE"),
+	}
+}
+
+// Variables returns the variables FromEnv reads c from.
+func (c Config) Variables() map[string]string {
+	return map[string]string{
+		"AGENT_HTTP_PROXY":  c.HTTPProxy,
+		"AGENT_HTTPS_PROXY": c.HTTPSProxy,
+		"AGENT_NO_PROXY":    c.NoProxy,
+		"AGENT_CA_BUNDLE":   c.CABundle,
+	}
+}
+
+func lookupEnv(keys ...string) string {
+	for _, key := range keys {
+		if value := os.Getenv(key); value != "" {
+			return value
+		}
+	}
+	return ""
+}
+
+// Proxy returns the proxy to use for a request, like http.ProxyFromEnvironment.
+func (c Config) Proxy() func(*http.Request) (*url.URL, error) {
+	proxyFunc := (&httpproxy.Config{
+		HTTPProxy:  c.HTTPProxy,
+		HTTPSProxy: c.HTTPSProxy,
+		NoProxy:    c.NoProxy,
+	}).ProxyFunc()
+
+	return func(req *http.Request) (*url.URL, error) {
+		return proxyFunc(req.URL)
+	}
+}
+
+// RootCAs returns the system roots with the CA bundle added, or nil if there
+// is no CA bundle.
+func (c Config) RootCAs() (*x509.CertPool, error) {
+	if c.CABundle == "" {
+		return nil, nil
+	}
+
+	pem, err := os.ReadFile(c.CABundle)
+	if err != nil {
+		return nil, fmt.Errorf("read CA bundle: %w", err)
+	}
+
+	pool, err := x509.SystemCertPool()
+	if err != nil || pool == nil {
+		pool = x509.NewCertPool()
+	}
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("CA bundle %s contains no certificates", c.CABundle)
+	}
+	return pool, nil
+}
+
+// TLSConfig returns a TLS configuration that trusts the CA bundle.
+func (c Config) TLSConfig() (*tls.Config, error) {
+	rootCAs, err := c.RootCAs()
+	if err != nil {
+		return nil, err
+	}
+
+	return &tls.Config{RootCAs: rootCAs, MinVersion: tls.VersionTLS12}, nil
+}
+
+// Transport returns an HTTP transport using the proxy and CA bundle.
+func (c Config) Transport() (*http.Transport, error) {
+	tlsConfig, err := c.TLSConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = c.Proxy()
+	transport.TLSClientConfig = tlsConfig
+	return transport, nil
+}
+
+// HTTPClient returns a client using the proxy and CA bundle. If the CA
+// bundle can't be loaded the error is returned along with a client that
+// only uses the proxy, so callers may decide to continue. Faults of the
+// chaos package are injected into its requests when enabled.
+func (c Config) HTTPClient(timeout time.Duration) (*http.Client, error) {
+	transport, err := c.Transport()
+	if err != nil {
+		transport = http.DefaultTransport.(*http.Transport).Clone()
+		transport.Proxy = c.Proxy()
+		return &http.Client{Timeout: timeout, Transport: chaos.Default().Transport(transport)}, err
+	}
+
+	return &http.Client{Timeout: timeout, Transport: chaos.Default().Transport(transport)}, nil
+}
+
+// Env returns the environment for child processes, e.g. the Python scripts
+// run by the Supabase integration. Unlike RootCAs, most tools replace their
+// default roots with SSL_CERT_FILE, so the bundle should include public CAs
+// if those are needed as well.
+func (c Config) Env() []string {
+	env := []string{}
+	if c.HTTPProxy != "" {
+		env = append(env, "HTTP_PROXY="+c.HTTPProxy, "http_proxy="+c.HTTPProxy)
+	}
+	if c.HTTPSProxy != "" {
+		env = append(env, "HTTPS_PROXY="+c.HTTPSProxy, "https_proxy="+c.HTTPSProxy)
+	}
+	if c.NoProxy != "" {
+		env = append(env, "NO_PROXY="+c.NoProxy, "no_proxy="+c.NoProxy)
+	}
+	if c.CABundle != "" {
+		env = append(env, "SSL_CERT_FILE="+c.CABundle, "REQUESTS_CA_BUNDLE="+c.CABundle)
+	}
+	return env
+}
@@ -0,0 +1,126 @@
+package outbound
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func writeCA(t *testing.T) string {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "kled test CA"},
+		NotBefore:             time.Now(),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(t.TempDir(), "ca.pem")
+	err = os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestProxy(t *testing.T) {
+	config := Config{
+		HTTPProxy:  "http://proxy.corp:3128",
+		HTTPSProxy: "http://proxy.corp:3129",
+		NoProxy:    ".svc.cluster.local",
+	}
+	proxy := config.Proxy()
+
+	for target, expected := range map[string]string{
+		"http://ragflow.example.com/health":                    "http://proxy.corp:3128",
+		"https://vault.example.com/v1/sys/health":              "http://proxy.corp:3129",
+		"http://ragflow.default.svc.cluster.local:8000/health": "",
+	} {
+		req, _ := http.NewRequest("GET", target, nil)
+		proxyURL, err := proxy(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		actual := ""
+		if proxyURL != nil {
+			actual = proxyURL.String()
+		}
+		if actual != expected {
+			t.Errorf("expected proxy %q for %s, got %q", expected, target, actual)
+		}
+	}
+}
+
+func TestCABundle(t *testing.T) {
+	rootCAs, err := Config{}.RootCAs()
+	if err != nil || rootCAs != nil {
+		t.Fatalf("expected no roots without a bundle, got %v, %v", rootCAs, err)
+	}
+
+	config := Config{CABundle: writeCA(t)}
+	transport, err := config.Transport()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if transport.TLSClientConfig.RootCAs == nil {
+		t.Error("expected transport to trust the CA bundle")
+	}
+
+	empty := filepath.Join(t.TempDir(), "empty.pem")
+	if err := os.WriteFile(empty, []byte("no certificates"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	client, err := Config{CABundle: empty, HTTPProxy: "http://proxy.corp:3128"}.HTTPClient(time.Second)
+	if err == nil {
+		t.Error("expected an error for a bundle without certificates")
+	}
+	if client == nil || client.Transport.(*http.Transport).Proxy == nil {
+		t.Error("expected a client using the proxy despite the error")
+	}
+}
+
+func TestFromEnv(t *testing.T) {
+	t.Setenv("HTTPS_PROXY", "http://proxy.corp:3128")
+	t.Setenv("AGENT_HTTPS_PROXY", "http://agent-proxy.corp:3128")
+	t.Setenv("NO_PROXY", "localhost")
+	t.Setenv("AGENT_NO_PROXY", "")
+	t.Setenv("AGENT_CA_BUNDLE", "/etc/kled/ca.pem")
+
+	config := FromEnv()
+	if config.HTTPSProxy != "http://agent-proxy.corp:3128" {
+		t.Errorf("expected AGENT_HTTPS_PROXY to win, got %q", config.HTTPSProxy)
+	}
+	if config.NoProxy != "localhost" {
+		t.Errorf("expected NO_PROXY fallback, got %q", config.NoProxy)
+	}
+
+	env := config.Env()
+	found := false
+	for _, value := range env {
+		if value == "REQUESTS_CA_BUNDLE=/etc/kled/ca.pem" {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("expected CA bundle in child env, got %v", env)
+	}
+}
@@ -0,0 +1,43 @@
+package outputs
+
+import (
+	"os"
+	"time"
+
+	"github.com/spectrumwebco/agent_runtime/backend/core/config/env"
+)
+
+type Config struct {
+	// PreviewBytes bounds stdout and stderr in the result of a command that
+	// streams its output.
+	PreviewBytes int `json:"preview_bytes"`
+	// SpillBytes is the size above which a stream is written to disk.
+	SpillBytes int64 `json:"spill_bytes"`
+	// Dir holds the spilled streams, kled-outputs in the temporary directory
+	// if empty.
+	Dir string `json:"dir"`
+	// Retention is how long outputs can be fetched.
+	Retention time.Duration `json:"retention"`
+}
+
+const (
+	DefaultPreviewBytes = 64 * 1024
+	DefaultSpillBytes   = 1024 * 1024
+	DefaultRetention    = time.Hour
+)
+
+var Default = env.Once(FromEnv)
+
+func FromEnv() Config {
+	config := Config{
+		PreviewBytes: DefaultPreviewBytes,
+		SpillBytes:   DefaultSpillBytes,
+		Dir:          os.Getenv("AGENT_OUTPUT_DIR"),
+		Retention:    DefaultRetention,
+	}
+	read := env.NewReader(outputsLogger)
+	read.Int("AGENT_OUTPUT_PREVIEW_BYTES", &config.PreviewBytes, 1)
+	read.Int64("AGENT_OUTPUT_SPILL_BYTES", &config.SpillBytes, 0)
+	read.PositiveDuration("AGENT_OUTPUT_RETENTION", &config.Retention)
+	return config
+}
@@ -0,0 +1,331 @@
+// Package outputs keeps the output of agent commands that stream it, so
+// clients receive a truncated preview with the result and fetch the whole
+// output on demand.
+//
+// A stream of an output is kept in memory until it grows past the spill
+// size; from then on it is written to a file. Outputs are removed after the
+// retention. They are kept by the replica that ran the command, other
+// replicas don't find them.
+package outputs
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var outputsLogger = log.New(os.Stdout, "kled.outputs: ", log.LstdFlags)
+
+// ErrNotFound is returned for outputs that expired or were kept by another
+// replica, and for streams the command didn't write to.
+var ErrNotFound = errors.New("output not found")
+
+var outputBytes = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "kled_command_output_bytes_total",
+	Help: "Bytes of streamed command output kept for fetching, by where they are kept.",
+}, []string{"storage"})
+
+func init() {
+	prometheus.MustRegister(outputBytes)
+}
+
+// Store holds the outputs of this replica.
+type Store struct {
+	config Config
+	now    func() time.Time
+
+	mu      sync.Mutex
+	outputs map[string]*Output
+}
+
+func NewStore(config Config) *Store {
+	if config.Dir == "" {
+		config.Dir = filepath.Join(os.TempDir(), "kled-outputs")
+	}
+	return &Store{config: config, now: time.Now, outputs: map[string]*Output{}}
+}
+
+var (
+	defaultStore     *Store
+	defaultStoreOnce sync.Once
+)
+
+// DefaultStore returns the store of the process, configured from the
+// environment.
+func DefaultStore() *Store {
+	defaultStoreOnce.Do(func() {
+		defaultStore = NewStore(Default())
+	})
+	return defaultStore
+}
+
+// Config returns the configuration of the store.
+func (s *Store) Config() Config {
+	return s.config
+}
+
+// Create starts an output of a command run in workspaceID.
+func (s *Store) Create(workspaceID string) *Output {
+	output := &Output{
+		ID:          uuid.New().String(),
+		WorkspaceID: workspaceID,
+		Created:     s.now(),
+		store:       s,
+		streams:     map[string]*stream{},
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.outputs[output.ID] = output
+	return output
+}
+
+func (s *Store) Get(id string) (*Output, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	output, ok := s.outputs[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return output, nil
+}
+
+// Prune removes the outputs older than the retention and returns how many
+// it removed.
+func (s *Store) Prune() int {
+	cutoff := s.now().Add(-s.config.Retention)
+
+	s.mu.Lock()
+	var expired []*Output
+	for id, output := range s.outputs {
+		if output.Created.Before(cutoff) {
+			expired = append(expired, output)
+			delete(s.outputs, id)
+		}
+	}
+	s.mu.Unlock()
+
+	for _, output := range expired {
+		output.remove()
+	}
+	return len(expired)
+}
+
+// Run prunes expired outputs until ctx is done, then removes every output.
+func (s *Store) Run(ctx context.Context) {
+	ticker := time.NewTicker(min(s.config.Retention, time.Minute))
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			s.mu.Lock()
+			outputs := s.outputs
+			s.outputs = map[string]*Output{}
+			s.mu.Unlock()
+			for _, output := range outputs {
+				output.remove()
+			}
+			return
+		case <-ticker.C:
+			if removed := s.Prune(); removed > 0 {
+				outputsLogger.Printf("Removed %d expired command outputs", removed)
+			}
+		}
+	}
+}
+
+// Output is the output of one command, by stream.
+type Output struct {
+	ID          string
+	WorkspaceID string
+	Created     time.Time
+
+	store *Store
+
+	mu      sync.Mutex
+	streams map[string]*stream
+	// incomplete is set when chunks were lost.
+	incomplete bool
+	finished   bool
+	removed    bool
+}
+
+// stream is kept in data until it is spilled to file.
+type stream struct {
+	data []byte
+	file *os.File
+	size int64
+}
+
+// Info describes an output.
+type Info struct {
+	ID          string    `json:"id"`
+	WorkspaceID string    `json:"workspace_id"`
+	Created     time.Time `json:"created"`
+	// Sizes are the bytes received per stream.
+	Sizes map[string]int64 `json:"sizes"`
+	// Finished is set once the command's result arrived.
+	Finished bool `json:"finished"`
+	// Incomplete is set when chunks were lost with a broken agent stream.
+	Incomplete bool `json:"incomplete"`
+}
+
+func (o *Output) Info() Info {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	info := Info{
+		ID:          o.ID,
+		WorkspaceID: o.WorkspaceID,
+		Created:     o.Created,
+		Sizes:       make(map[string]int64, len(o.streams)),
+		Finished:    o.finished,
+		Incomplete:  o.incomplete,
+	}
+	for name, s := range o.streams {
+		info.Sizes[name] = s.size
+	}
+	return info
+}
+
+// Streams returns the names of the streams written to, sorted.
+func (o *Output) Streams() []string {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	names := make([]string, 0, len(o.streams))
+	for name := range o.streams {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Write appends a chunk starting at offset to a stream. Data that was
+// already written, from a chunk sent again, is skipped; a chunk past the end
+// of the stream marks the output incomplete.
+func (o *Output) Write(name string, offset int64, data []byte) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.removed {
+		return ErrNotFound
+	}
+
+	s, ok := o.streams[name]
+	if !ok {
+		s = &stream{}
+		o.streams[name] = s
+	}
+	if offset < s.size {
+		if skip := s.size - offset; skip < int64(len(data)) {
+			data = data[skip:]
+		} else {
+			return nil
+		}
+	} else if offset > s.size {
+		o.incomplete = true
+	}
+
+	if s.file == nil && s.size+int64(len(data)) > o.store.config.SpillBytes {
+		if err := o.spill(name, s); err != nil {
+			return err
+		}
+	}
+	if s.file != nil {
+		if _, err := s.file.Write(data); err != nil {
+			return fmt.Errorf("error writing %s of output %s: %v", name, o.ID, err)
+		}
+		outputBytes.WithLabelValues("disk").Add(float64(len(data)))
+	} else {
+		s.data = append(s.data, data...)
+		outputBytes.WithLabelValues("memory").Add(float64(len(data)))
+	}
+	s.size += int64(len(data))
+	return nil
+}
+
+// spill moves a stream from memory to a file.
+func (o *Output) spill(name string, s *stream) error {
+	if err := os.MkdirAll(o.store.config.Dir, 0o700); err != nil {
+		return err
+	}
+	file, err := os.CreateTemp(o.store.config.Dir, o.ID+"-"+name+"-*")
+	if err != nil {
+		return err
+	}
+	if _, err := file.Write(s.data); err != nil {
+		file.Close()
+		os.Remove(file.Name())
+		return fmt.Errorf("error spilling %s of output %s: %v", name, o.ID, err)
+	}
+	s.file, s.data = file, nil
+	return nil
+}
+
+// Finish marks the output as complete once the command's result arrived.
+func (o *Output) Finish() {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.finished = true
+}
+
+type fileReader struct {
+	*io.SectionReader
+	io.Closer
+}
+
+type memoryReader struct {
+	*bytes.Reader
+}
+
+func (memoryReader) Close() error {
+	return nil
+}
+
+// Open returns a reader of a stream as far as it was written. Readers of
+// streams kept in memory share their data instead of copying it.
+func (o *Output) Open(name string) (io.ReadSeekCloser, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	s, ok := o.streams[name]
+	if !ok || o.removed {
+		return nil, ErrNotFound
+	}
+
+	if s.file == nil {
+		// appends never modify the bytes up to size
+		return memoryReader{bytes.NewReader(s.data[:s.size:s.size])}, nil
+	}
+	file, err := os.Open(s.file.Name())
+	if err != nil {
+		return nil, err
+	}
+	return fileReader{io.NewSectionReader(file, 0, s.size), file}, nil
+}
+
+// remove deletes the spilled streams. Readers opened before keep reading
+// them.
+func (o *Output) remove() {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.removed = true
+	for name, s := range o.streams {
+		if s.file == nil {
+			continue
+		}
+		s.file.Close()
+		if err := os.Remove(s.file.Name()); err != nil {
+			outputsLogger.Printf("Error removing %s of output %s: %v", name, o.ID, err)
+		}
+	}
+	o.streams = map[string]*stream{}
+}
@@ -0,0 +1,107 @@
+package outputs
+
+import (
+	"io"
+	"os"
+	"testing"
+	"time"
+)
+
+func readStream(t *testing.T, output *Output, name string) string {
+	t.Helper()
+	reader, err := output.Open(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reader.Close()
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestWriteSpillsToDisk(t *testing.T) {
+	dir := t.TempDir()
+	output := NewStore(Config{SpillBytes: 4, Dir: dir, Retention: time.Hour}).Create("ws-1")
+
+	for _, chunk := range []struct {
+		offset int64
+		data   string
+	}{
+		{0, "ab"},
+		{2, "cd"},
+		// sent again after a reconnect
+		{2, "cdef"},
+		{0, "ab"},
+	} {
+		if err := output.Write("stdout", chunk.offset, []byte(chunk.data)); err != nil {
+			t.Fatal(err)
+		}
+		if chunk.offset == 2 && chunk.data == "cd" {
+			if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+				t.Fatalf("expected stdout in memory up to the spill size, got %v", entries)
+			}
+			memory := readStream(t, output, "stdout")
+			if memory != "abcd" {
+				t.Fatalf("expected abcd in memory, got %q", memory)
+			}
+		}
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 1 {
+		t.Fatalf("expected stdout to be spilled, got %v", entries)
+	}
+	if stdout := readStream(t, output, "stdout"); stdout != "abcdef" {
+		t.Fatalf("expected abcdef, got %q", stdout)
+	}
+	if output.Info().Incomplete {
+		t.Error("expected chunks sent again not to mark the output incomplete")
+	}
+
+	if err := output.Write("stderr", 3, []byte("lost")); err != nil {
+		t.Fatal(err)
+	}
+	info := output.Info()
+	if !info.Incomplete || info.Sizes["stdout"] != 6 || info.Sizes["stderr"] != 4 {
+		t.Fatalf("unexpected info %+v", info)
+	}
+	if _, err := output.Open("missing"); err != ErrNotFound {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+}
+
+func TestPrune(t *testing.T) {
+	dir := t.TempDir()
+	store := NewStore(Config{Dir: dir, Retention: time.Hour})
+	now := time.Date(2026, 1, 2, 15, 0, 0, 0, time.UTC)
+	store.now = func() time.Time { return now }
+
+	old := store.Create("ws-1")
+	if err := old.Write("stdout", 0, []byte("spilled")); err != nil {
+		t.Fatal(err)
+	}
+	reader, err := old.Open("stdout")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reader.Close()
+	now = now.Add(30 * time.Minute)
+	recent := store.Create("ws-1")
+
+	now = now.Add(45 * time.Minute)
+	if removed := store.Prune(); removed != 1 {
+		t.Fatalf("expected one output to expire, removed %d", removed)
+	}
+	if _, err := store.Get(old.ID); err != ErrNotFound {
+		t.Errorf("expected the old output to be removed, got %v", err)
+	}
+	if _, err := store.Get(recent.ID); err != nil {
+		t.Errorf("expected the recent output to be kept, got %v", err)
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+		t.Errorf("expected the spilled streams to be removed, got %v", entries)
+	}
+	if data, _ := io.ReadAll(reader); string(data) != "spilled" {
+		t.Errorf("expected an open reader to keep reading, got %q", data)
+	}
+}
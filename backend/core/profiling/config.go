@@ -0,0 +1,70 @@
+package profiling
+
+import (
+	"os"
+	"strings"
+	"time"
+
+	"github.com/spectrumwebco/agent_runtime/backend/core/config/env"
+)
+
+type Config struct {
+	// Interval is the time between continuous captures. Zero disables them.
+	Interval time.Duration `json:"interval"`
+	// CPUDuration is how long a CPU profile samples.
+	CPUDuration time.Duration `json:"cpu_duration"`
+	// Kinds are the profiles captured continuously.
+	Kinds []string `json:"kinds"`
+	// Bucket is the Supabase storage bucket profiles are stored in.
+	Bucket string `json:"bucket"`
+	// DumpDir holds the dumps written on SIGQUIT, the temporary directory if
+	// empty.
+	DumpDir string `json:"dump_dir"`
+}
+
+const (
+	DefaultCPUDuration = 30 * time.Second
+	DefaultBucket      = "profiles"
+)
+
+var Default = env.Once(FromEnv)
+
+// FromEnv leaves continuous profiling off unless AGENT_PROFILING_INTERVAL is
+// set. AGENT_PROFILING_KINDS holds comma separated kinds.
+func FromEnv() Config {
+	config := Config{
+		CPUDuration: DefaultCPUDuration,
+		Kinds:       []string{KindCPU, KindHeap},
+		Bucket:      DefaultBucket,
+		DumpDir:     os.Getenv("AGENT_PROFILING_DUMP_DIR"),
+	}
+	read := env.NewReader(profilingLogger)
+	read.Duration("AGENT_PROFILING_INTERVAL", &config.Interval, 0)
+	read.PositiveDuration("AGENT_PROFILING_CPU_DURATION", &config.CPUDuration)
+	if config.Interval > 0 && config.CPUDuration >= config.Interval {
+		profilingLogger.Printf("The CPU profile duration %s must be shorter than the interval %s, using half the interval", config.CPUDuration, config.Interval)
+		config.CPUDuration = config.Interval / 2
+	}
+	if os.Getenv("AGENT_PROFILING_KINDS") != "" {
+		kinds := []string{}
+		for _, kind := range read.List("AGENT_PROFILING_KINDS") {
+			if !validKind(kind) {
+				read.Invalid("AGENT_PROFILING_KINDS", "kinds out of "+strings.Join(Kinds, ", "), kind)
+				continue
+			}
+			kinds = append(kinds, kind)
+		}
+		config.Kinds = kinds
+	}
+	read.String("AGENT_PROFILING_BUCKET", &config.Bucket)
+	return config
+}
+
+func validKind(kind string) bool {
+	for _, known := range Kinds {
+		if kind == known {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,242 @@
+// Package profiling captures runtime profiles of the backend for offline
+// analysis with go tool pprof.
+//
+// Profiles are captured on demand through the pprof endpoints of the API,
+// continuously by a Collector, which stores them every interval, and on
+// SIGQUIT, which dumps the stacks of every goroutine and a heap profile
+// without stopping the process.
+package profiling
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"runtime/pprof"
+	"strings"
+	"syscall"
+	"time"
+)
+
+var profilingLogger = log.New(os.Stdout, "kled.profiling: ", log.LstdFlags)
+
+// The kinds of profiles.
+const (
+	// KindCPU samples the stacks running on a CPU for a duration.
+	KindCPU       = "cpu"
+	KindHeap      = "heap"
+	KindAllocs    = "allocs"
+	KindGoroutine = "goroutine"
+	// KindMutex and KindBlock are empty unless the process enabled them with
+	// runtime.SetMutexProfileFraction and runtime.SetBlockProfileRate.
+	KindMutex = "mutex"
+	KindBlock = "block"
+)
+
+var Kinds = []string{KindCPU, KindHeap, KindAllocs, KindGoroutine, KindMutex, KindBlock}
+
+// timestampFormat sorts the profiles of a host by the time they were
+// captured.
+const timestampFormat = "20060102T150405Z"
+
+// Capture captures a profile in the gzipped protobuf format of pprof. A CPU
+// profile samples for duration, the others are snapshots. Only one CPU
+// profile can be captured at a time.
+func Capture(ctx context.Context, kind string, duration time.Duration) ([]byte, error) {
+	if !validKind(kind) {
+		return nil, fmt.Errorf("unknown profile %q, expected one of %s", kind, strings.Join(Kinds, ", "))
+	}
+
+	var buf bytes.Buffer
+	if kind != KindCPU {
+		if err := pprof.Lookup(kind).WriteTo(&buf, 0); err != nil {
+			return nil, fmt.Errorf("error writing the %s profile: %v", kind, err)
+		}
+		return buf.Bytes(), nil
+	}
+
+	if err := pprof.StartCPUProfile(&buf); err != nil {
+		return nil, fmt.Errorf("error starting the CPU profile: %v", err)
+	}
+	timer := time.NewTimer(duration)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		pprof.StopCPUProfile()
+		return buf.Bytes(), nil
+	case <-ctx.Done():
+		pprof.StopCPUProfile()
+		return nil, ctx.Err()
+	}
+}
+
+// Name returns the path a profile is stored under, e.g.
+// api-7d9f/20260102T150405Z-cpu.pb.gz.
+func Name(host, kind string, at time.Time) string {
+	return fmt.Sprintf("%s/%s-%s.pb.gz", host, at.UTC().Format(timestampFormat), kind)
+}
+
+// Store persists profiles and returns where they are.
+type Store interface {
+	Save(ctx context.Context, name string, data []byte) (string, error)
+}
+
+// Uploader is implemented by integrations.SupabaseManager.
+type Uploader interface {
+	UploadFile(bucket, path string, fileData []byte, contentType string) (bool, string, error)
+}
+
+// SupabaseStore uploads profiles to a Supabase storage bucket.
+type SupabaseStore struct {
+	uploader Uploader
+	bucket   string
+}
+
+func NewSupabaseStore(uploader Uploader, bucket string) *SupabaseStore {
+	return &SupabaseStore{uploader: uploader, bucket: bucket}
+}
+
+func (s *SupabaseStore) Save(ctx context.Context, name string, data []byte) (string, error) {
+	ok, url, err := s.uploader.UploadFile(s.bucket, name, data, "application/octet-stream")
+	if err != nil {
+		return "", fmt.Errorf("error uploading profile %s: %v", name, err)
+	} else if !ok {
+		return "", fmt.Errorf("error uploading profile %s", name)
+	}
+	return url, nil
+}
+
+// Collector captures profiles every interval and stores them.
+type Collector struct {
+	config Config
+	store  Store
+	host   string
+	now    func() time.Time
+}
+
+func NewCollector(config Config, store Store) *Collector {
+	host, err := os.Hostname()
+	if err != nil || host == "" {
+		host = "unknown"
+	}
+
+	return &Collector{
+		config: config,
+		store:  store,
+		host:   host,
+		now:    time.Now,
+	}
+}
+
+// Run collects profiles every interval until ctx is done. It returns right
+// away if continuous profiling is disabled.
+func (c *Collector) Run(ctx context.Context) {
+	if c.config.Interval <= 0 || len(c.config.Kinds) == 0 {
+		return
+	}
+	profilingLogger.Printf("Capturing %s profiles every %s", strings.Join(c.config.Kinds, ", "), c.config.Interval)
+
+	ticker := time.NewTicker(c.config.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := c.Collect(ctx); err != nil && ctx.Err() == nil {
+				profilingLogger.Printf("Error collecting profiles: %v", err)
+			}
+		}
+	}
+}
+
+// Collect captures the configured kinds of profiles and stores them. It
+// returns where the stored profiles are, and the errors of the others.
+func (c *Collector) Collect(ctx context.Context) ([]string, error) {
+	var (
+		locations []string
+		errs      []error
+	)
+	for _, kind := range c.config.Kinds {
+		at := c.now()
+		data, err := Capture(ctx, kind, c.config.CPUDuration)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		location, err := c.store.Save(ctx, Name(c.host, kind, at), data)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		locations = append(locations, location)
+	}
+	return locations, errors.Join(errs...)
+}
+
+// Dump writes the stacks of every goroutine, in the format of an
+// unrecovered panic, and a heap profile to dir, the temporary directory if
+// empty. It returns the paths of the files.
+func Dump(dir string, at time.Time) ([]string, error) {
+	if dir == "" {
+		dir = os.TempDir()
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+
+	timestamp := at.UTC().Format(timestampFormat)
+	var paths []string
+	for _, dump := range []struct {
+		kind, name string
+		debug      int
+	}{
+		{KindGoroutine, "goroutines-" + timestamp + ".txt", 2},
+		{KindHeap, "heap-" + timestamp + ".pb.gz", 0},
+	} {
+		path := filepath.Join(dir, dump.name)
+		f, err := os.Create(path)
+		if err != nil {
+			return paths, err
+		}
+		err = pprof.Lookup(dump.kind).WriteTo(f, dump.debug)
+		if closeErr := f.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			return paths, fmt.Errorf("error writing %s: %v", path, err)
+		}
+		paths = append(paths, path)
+	}
+	return paths, nil
+}
+
+// HandleSIGQUIT dumps the stacks of every goroutine to stderr and dumps to
+// dir on every SIGQUIT until ctx is done. Without it the Go runtime writes
+// the stacks and exits.
+func HandleSIGQUIT(ctx context.Context, dir string) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGQUIT)
+
+	go func() {
+		defer signal.Stop(signals)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-signals:
+				pprof.Lookup(KindGoroutine).WriteTo(os.Stderr, 2)
+				paths, err := Dump(dir, time.Now())
+				if err != nil {
+					profilingLogger.Printf("Error dumping goroutines and heap: %v", err)
+					continue
+				}
+				profilingLogger.Printf("Received SIGQUIT, dumped goroutines and heap to %s", strings.Join(paths, ", "))
+			}
+		}
+	}()
+}
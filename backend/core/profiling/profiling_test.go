@@ -0,0 +1,78 @@
+package profiling
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// gzipMagic starts every profile in the protobuf format of pprof.
+var gzipMagic = []byte{0x1f, 0x8b}
+
+type memoryStore map[string][]byte
+
+func (s memoryStore) Save(ctx context.Context, name string, data []byte) (string, error) {
+	s[name] = data
+	return "memory://" + name, nil
+}
+
+func TestCapture(t *testing.T) {
+	for _, kind := range []string{KindCPU, KindHeap, KindGoroutine} {
+		data, err := Capture(context.Background(), kind, 50*time.Millisecond)
+		if err != nil {
+			t.Fatalf("capturing %s: %v", kind, err)
+		}
+		if !bytes.HasPrefix(data, gzipMagic) {
+			t.Errorf("expected a gzipped %s profile", kind)
+		}
+	}
+
+	if _, err := Capture(context.Background(), "threads", 0); err == nil {
+		t.Error("expected an unknown profile to fail")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := Capture(ctx, KindCPU, time.Minute); err != context.Canceled {
+		t.Errorf("expected a canceled CPU profile to stop, got %v", err)
+	}
+}
+
+func TestCollect(t *testing.T) {
+	store := memoryStore{}
+	collector := NewCollector(Config{CPUDuration: 10 * time.Millisecond, Kinds: []string{KindCPU, KindHeap}}, store)
+	collector.host = "api-0"
+	collector.now = func() time.Time { return time.Date(2026, 1, 2, 15, 4, 5, 0, time.UTC) }
+
+	locations, err := collector.Collect(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"memory://api-0/20260102T150405Z-cpu.pb.gz", "memory://api-0/20260102T150405Z-heap.pb.gz"}
+	if strings.Join(locations, ",") != strings.Join(want, ",") || len(store) != 2 {
+		t.Errorf("expected the profiles %v, got %v", want, locations)
+	}
+}
+
+func TestDump(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "dumps")
+	paths, err := Dump(dir, time.Date(2026, 1, 2, 15, 4, 5, 0, time.UTC))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(paths) != 2 || filepath.Base(paths[0]) != "goroutines-20260102T150405Z.txt" || filepath.Base(paths[1]) != "heap-20260102T150405Z.pb.gz" {
+		t.Fatalf("unexpected dumps %v", paths)
+	}
+
+	stacks, err := os.ReadFile(paths[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(stacks), "goroutine ") || !strings.Contains(string(stacks), "TestDump") {
+		t.Errorf("expected the stacks of every goroutine:\n%s", stacks)
+	}
+}
@@ -0,0 +1,100 @@
+package prompts
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Diff describes how to changes from: the description, the variables and a
+// line diff of the body, with removed lines prefixed "-" and added lines
+// "+". It is empty when the versions are the same.
+func Diff(from, to *Template) string {
+	var b strings.Builder
+	if from.Description != to.Description {
+		fmt.Fprintf(&b, "description: %q -> %q\n", from.Description, to.Description)
+	}
+
+	before := map[string]Variable{}
+	for _, variable := range from.Variables {
+		before[variable.Name] = variable
+	}
+	after := map[string]bool{}
+	for _, variable := range to.Variables {
+		after[variable.Name] = true
+		old, ok := before[variable.Name]
+		switch {
+		case !ok:
+			fmt.Fprintf(&b, "variable +%s\n", describeVariable(variable))
+		case old != variable:
+			fmt.Fprintf(&b, "variable %s -> %s\n", describeVariable(old), describeVariable(variable))
+		}
+	}
+	for _, variable := range from.Variables {
+		if !after[variable.Name] {
+			fmt.Fprintf(&b, "variable -%s\n", describeVariable(variable))
+		}
+	}
+
+	if from.Body != to.Body {
+		fmt.Fprintf(&b, "--- %s\n+++ %s\n", from.Ref(), to.Ref())
+		for _, line := range diffLines(strings.Split(from.Body, "\n"), strings.Split(to.Body, "\n")) {
+			b.WriteString(line)
+			b.WriteString("\n")
+		}
+	}
+	return b.String()
+}
+
+func describeVariable(variable Variable) string {
+	switch {
+	case variable.Required:
+		return variable.Name + " (required)"
+	case variable.Default != "":
+		return fmt.Sprintf("%s (default %q)", variable.Name, variable.Default)
+	}
+	return variable.Name
+}
+
+// diffLines is a longest-common-subsequence line diff. Prompts are short,
+// so the quadratic table is fine.
+func diffLines(a, b []string) []string {
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	var lines []string
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		switch {
+		case a[i] == b[j]:
+			lines = append(lines, " "+a[i])
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			lines = append(lines, "-"+a[i])
+			i++
+		default:
+			lines = append(lines, "+"+b[j])
+			j++
+		}
+	}
+	for ; i < len(a); i++ {
+		lines = append(lines, "-"+a[i])
+	}
+	for ; j < len(b); j++ {
+		lines = append(lines, "+"+b[j])
+	}
+	return lines
+}
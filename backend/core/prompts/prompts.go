@@ -0,0 +1,273 @@
+// Package prompts keeps the prompt templates of the agents under version
+// control.
+//
+// A Template is immutable once saved; changing a prompt saves its next
+// version. Rollout tags such as production or canary point at a version, so
+// agents render "name@production" and a change is rolled out, or back, by
+// moving the tag. Rendering is strict: every variable a template uses must
+// be declared, required variables must be given and undeclared ones are
+// rejected, so a renamed variable fails loudly instead of rendering empty.
+package prompts
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+	"text/template/parse"
+	"time"
+)
+
+var promptsLogger = log.New(os.Stdout, "kled.prompts: ", log.LstdFlags)
+
+var ErrNotFound = errors.New("prompt not found")
+
+var (
+	namePattern     = regexp.MustCompile(`^[a-z0-9][a-z0-9._-]{0,127}$`)
+	variablePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+)
+
+type Variable struct {
+	Name        string `json:"name" openapi:"required"`
+	Description string `json:"description,omitempty"`
+	Required    bool   `json:"required"`
+	// Default is rendered when an optional variable is not given.
+	Default string `json:"default,omitempty"`
+}
+
+// Template is a version of a prompt. Its body is a text/template referring
+// to variables as {{.name}}.
+type Template struct {
+	Name        string     `json:"name"`
+	Version     int        `json:"version"`
+	Description string     `json:"description,omitempty"`
+	Body        string     `json:"body"`
+	Variables   []Variable `json:"variables"`
+	CreatedBy   string     `json:"created_by,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+}
+
+// NewTemplate validates a prompt version before it is saved. The store
+// assigns the version.
+func NewTemplate(name, description, body string, variables []Variable, createdBy string, now time.Time) (*Template, error) {
+	if !namePattern.MatchString(name) {
+		return nil, fmt.Errorf("invalid prompt name %q, use lowercase letters, digits, '.', '_' and '-'", name)
+	}
+	if strings.TrimSpace(body) == "" {
+		return nil, fmt.Errorf("the prompt body is empty")
+	}
+	if variables == nil {
+		variables = []Variable{}
+	}
+
+	declared := map[string]bool{}
+	for _, variable := range variables {
+		if !variablePattern.MatchString(variable.Name) {
+			return nil, fmt.Errorf("invalid variable name %q", variable.Name)
+		}
+		if declared[variable.Name] {
+			return nil, fmt.Errorf("duplicate variable %q", variable.Name)
+		}
+		if variable.Required && variable.Default != "" {
+			return nil, fmt.Errorf("required variable %q cannot have a default", variable.Name)
+		}
+		declared[variable.Name] = true
+	}
+
+	t := &Template{
+		Name:        name,
+		Description: description,
+		Body:        body,
+		Variables:   variables,
+		CreatedBy:   createdBy,
+		CreatedAt:   now.UTC(),
+	}
+	used, err := t.referenced()
+	if err != nil {
+		return nil, err
+	}
+	var undeclared []string
+	for _, name := range used {
+		if !declared[name] {
+			undeclared = append(undeclared, name)
+		}
+	}
+	if len(undeclared) > 0 {
+		return nil, fmt.Errorf("the prompt uses undeclared variables: %s", strings.Join(undeclared, ", "))
+	}
+	return t, nil
+}
+
+// Ref returns name@version.
+func (t *Template) Ref() string {
+	return fmt.Sprintf("%s@%d", t.Name, t.Version)
+}
+
+func (t *Template) parse() (*template.Template, error) {
+	parsed, err := template.New(t.Name).Option("missingkey=error").Parse(t.Body)
+	if err != nil {
+		return nil, fmt.Errorf("invalid prompt %s: %v", t.Name, err)
+	}
+	return parsed, nil
+}
+
+// referenced returns the variables the body uses, sorted.
+func (t *Template) referenced() ([]string, error) {
+	parsed, err := t.parse()
+	if err != nil {
+		return nil, err
+	}
+
+	used := map[string]bool{}
+	for _, tree := range parsed.Templates() {
+		if tree.Tree != nil {
+			collectFields(tree.Tree.Root, true, used)
+		}
+	}
+	names := make([]string, 0, len(used))
+	for name := range used {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// collectFields records the variables a node reads: .name while dot is the
+// variables, and $.name anywhere. Inside range and with dot is rebound, so
+// only $.name counts there.
+func collectFields(node parse.Node, atRoot bool, used map[string]bool) {
+	switch n := node.(type) {
+	case *parse.ListNode:
+		if n == nil {
+			return
+		}
+		for _, child := range n.Nodes {
+			collectFields(child, atRoot, used)
+		}
+	case *parse.ActionNode:
+		collectFields(n.Pipe, atRoot, used)
+	case *parse.PipeNode:
+		if n == nil {
+			return
+		}
+		for _, command := range n.Cmds {
+			collectFields(command, atRoot, used)
+		}
+	case *parse.CommandNode:
+		for _, arg := range n.Args {
+			collectFields(arg, atRoot, used)
+		}
+	case *parse.FieldNode:
+		if atRoot && len(n.Ident) > 0 {
+			used[n.Ident[0]] = true
+		}
+	case *parse.VariableNode:
+		if len(n.Ident) > 1 && n.Ident[0] == "$" {
+			used[n.Ident[1]] = true
+		}
+	case *parse.ChainNode:
+		collectFields(n.Node, atRoot, used)
+	case *parse.IfNode:
+		collectFields(n.Pipe, atRoot, used)
+		collectFields(n.List, atRoot, used)
+		collectFields(n.ElseList, atRoot, used)
+	case *parse.RangeNode:
+		collectFields(n.Pipe, atRoot, used)
+		collectFields(n.List, false, used)
+		collectFields(n.ElseList, atRoot, used)
+	case *parse.WithNode:
+		collectFields(n.Pipe, atRoot, used)
+		collectFields(n.List, false, used)
+		collectFields(n.ElseList, atRoot, used)
+	case *parse.TemplateNode:
+		collectFields(n.Pipe, atRoot, used)
+	}
+}
+
+// ValidationError lists every problem with the variables of a render.
+type ValidationError struct {
+	Problems []string
+}
+
+func (e *ValidationError) Error() string {
+	return "invalid prompt variables: " + strings.Join(e.Problems, "; ")
+}
+
+// Render fills in the variables. Missing required and undeclared variables
+// are reported together as a *ValidationError.
+func (t *Template) Render(values map[string]interface{}) (string, error) {
+	declared := map[string]Variable{}
+	for _, variable := range t.Variables {
+		declared[variable.Name] = variable
+	}
+
+	var problems []string
+	for name := range values {
+		if _, ok := declared[name]; !ok {
+			problems = append(problems, fmt.Sprintf("%q is not a variable of %s", name, t.Ref()))
+		}
+	}
+	data := map[string]interface{}{}
+	for _, variable := range t.Variables {
+		value, ok := values[variable.Name]
+		switch {
+		case ok && value != nil:
+			data[variable.Name] = value
+		case variable.Required:
+			problems = append(problems, fmt.Sprintf("%q is required", variable.Name))
+		default:
+			data[variable.Name] = variable.Default
+		}
+	}
+	if len(problems) > 0 {
+		sort.Strings(problems)
+		return "", &ValidationError{Problems: problems}
+	}
+
+	parsed, err := t.parse()
+	if err != nil {
+		return "", err
+	}
+	var out bytes.Buffer
+	if err := parsed.Execute(&out, data); err != nil {
+		return "", fmt.Errorf("error rendering %s: %v", t.Ref(), err)
+	}
+	return out.String(), nil
+}
+
+// ValidateTag checks a rollout tag. Tags cannot be numbers, which would
+// read as versions.
+func ValidateTag(tag string) error {
+	if _, err := strconv.Atoi(tag); err == nil || !namePattern.MatchString(tag) {
+		return fmt.Errorf("invalid tag %q, use lowercase letters, digits, '.', '_' and '-' and not only digits", tag)
+	}
+	return nil
+}
+
+// ParseRef splits "name", "name@3" or "name@production" into the name and
+// the version or tag. The selector is empty for the latest version.
+func ParseRef(ref string) (name string, version int, tag string, err error) {
+	name, selector, _ := strings.Cut(ref, "@")
+	if !namePattern.MatchString(name) {
+		return "", 0, "", fmt.Errorf("invalid prompt reference %q", ref)
+	}
+	if selector == "" {
+		return name, 0, "", nil
+	}
+	if n, convErr := strconv.Atoi(selector); convErr == nil {
+		if n < 1 {
+			return "", 0, "", fmt.Errorf("invalid prompt version in %q", ref)
+		}
+		return name, n, "", nil
+	}
+	if !namePattern.MatchString(selector) {
+		return "", 0, "", fmt.Errorf("invalid prompt tag in %q", ref)
+	}
+	return name, 0, selector, nil
+}
@@ -0,0 +1,82 @@
+package prompts
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNewTemplateRejectsUndeclaredVariables(t *testing.T) {
+	_, err := NewTemplate("triage", "", "Fix {{.issue}} in {{.repo}}", []Variable{{Name: "issue", Required: true}}, "", time.Now())
+	if err == nil || !strings.Contains(err.Error(), "repo") {
+		t.Fatalf("expected repo to be undeclared, got %v", err)
+	}
+
+	// fields inside range refer to the element, $. to the variables
+	_, err = NewTemplate("triage", "", "{{range .files}}{{.path}} {{$.repo}}{{end}}", []Variable{{Name: "files"}, {Name: "repo"}}, "", time.Now())
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+}
+
+func TestRenderValidatesVariables(t *testing.T) {
+	tmpl, err := NewTemplate("triage", "", "Fix {{.issue}} in {{.repo}}.", []Variable{
+		{Name: "issue", Required: true},
+		{Name: "repo", Default: "the monorepo"},
+	}, "", time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	out, err := tmpl.Render(map[string]interface{}{"issue": "#42"})
+	if err != nil || out != "Fix #42 in the monorepo." {
+		t.Fatalf("unexpected render %q, %v", out, err)
+	}
+
+	_, err = tmpl.Render(map[string]interface{}{"repo": "api", "isue": "#42"})
+	var validation *ValidationError
+	if !errors.As(err, &validation) || len(validation.Problems) != 2 {
+		t.Fatalf("expected a missing and an unknown variable, got %v", err)
+	}
+}
+
+func TestVersionsTagsAndRollback(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore()
+	for _, body := range []string{"Be brief.", "Be brief.\nCite files.", "Be thorough.\nCite files."} {
+		tmpl, err := NewTemplate("system", "", body, nil, "admin", time.Now())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := store.Save(ctx, tmpl); err != nil {
+			t.Fatal(err)
+		}
+	}
+	store.Tag(ctx, "system", "production", 3)
+
+	latest, _ := Resolve(ctx, store, "system")
+	tagged, _ := Resolve(ctx, store, "system@production")
+	first, _ := Resolve(ctx, store, "system@1")
+	if latest.Version != 3 || tagged.Version != 3 || first.Body != "Be brief." {
+		t.Fatalf("unexpected resolution %d, %d, %q", latest.Version, tagged.Version, first.Body)
+	}
+	if _, err := Resolve(ctx, store, "system@canary"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected an unknown tag not to resolve, got %v", err)
+	}
+
+	version, err := Rollback(ctx, store, "system", "production", 0)
+	if err != nil || version != 2 {
+		t.Fatalf("expected production to roll back to 2, got %d, %v", version, err)
+	}
+	tagged, _ = Resolve(ctx, store, "system@production")
+	if tagged.Version != 2 {
+		t.Errorf("expected production at 2, got %d", tagged.Version)
+	}
+
+	diff := Diff(tagged, latest)
+	if !strings.Contains(diff, "-Be brief.\n+Be thorough.\n Cite files.") {
+		t.Errorf("unexpected diff\n%s", diff)
+	}
+}
@@ -0,0 +1,381 @@
+package prompts
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/spectrumwebco/agent_runtime/backend/db/integrations"
+)
+
+// Store keeps every version of every prompt and their rollout tags.
+type Store interface {
+	// Save stores t as the next version of its prompt and sets t.Version.
+	Save(ctx context.Context, t *Template) error
+	// Get returns a version or ErrNotFound.
+	Get(ctx context.Context, name string, version int) (*Template, error)
+	// Versions returns the versions of a prompt, newest first, or
+	// ErrNotFound.
+	Versions(ctx context.Context, name string) ([]*Template, error)
+	// List returns the latest version of every prompt, by name.
+	List(ctx context.Context) ([]*Template, error)
+	// Tag points tag at an existing version.
+	Tag(ctx context.Context, name, tag string, version int) error
+	// Tags maps the tags of a prompt to their versions.
+	Tags(ctx context.Context, name string) (map[string]int, error)
+}
+
+// Resolve returns the version a reference names: the latest version, a
+// version number or the version of a tag.
+func Resolve(ctx context.Context, store Store, ref string) (*Template, error) {
+	name, version, tag, err := ParseRef(ref)
+	if err != nil {
+		return nil, err
+	}
+	if tag != "" {
+		tags, err := store.Tags(ctx, name)
+		if err != nil {
+			return nil, err
+		}
+		tagged, ok := tags[tag]
+		if !ok {
+			return nil, fmt.Errorf("%w: %s has no tag %q", ErrNotFound, name, tag)
+		}
+		version = tagged
+	}
+	if version > 0 {
+		return store.Get(ctx, name, version)
+	}
+
+	versions, err := store.Versions(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	return versions[0], nil
+}
+
+// Rollback points tag at version, or at the newest version older than the
+// one the tag points at when version is 0, and returns the version.
+func Rollback(ctx context.Context, store Store, name, tag string, version int) (int, error) {
+	if version == 0 {
+		tags, err := store.Tags(ctx, name)
+		if err != nil {
+			return 0, err
+		}
+		current, ok := tags[tag]
+		if !ok {
+			return 0, fmt.Errorf("%w: %s has no tag %q", ErrNotFound, name, tag)
+		}
+		if current <= 1 {
+			return 0, fmt.Errorf("%s@%s is the first version, there is nothing to roll back to", name, tag)
+		}
+		version = current - 1
+	}
+	if err := store.Tag(ctx, name, tag, version); err != nil {
+		return 0, err
+	}
+	return version, nil
+}
+
+type MemoryStore struct {
+	versions map[string][]*Template
+	tags     map[string]map[string]int
+	mu       sync.Mutex
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		versions: make(map[string][]*Template),
+		tags:     make(map[string]map[string]int),
+	}
+}
+
+func (s *MemoryStore) Save(ctx context.Context, t *Template) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	t.Version = len(s.versions[t.Name]) + 1
+	copied := *t
+	s.versions[t.Name] = append(s.versions[t.Name], &copied)
+	return nil
+}
+
+func (s *MemoryStore) Get(ctx context.Context, name string, version int) (*Template, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	versions := s.versions[name]
+	if version < 1 || version > len(versions) {
+		return nil, ErrNotFound
+	}
+	copied := *versions[version-1]
+	return &copied, nil
+}
+
+func (s *MemoryStore) Versions(ctx context.Context, name string) ([]*Template, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	versions := s.versions[name]
+	if len(versions) == 0 {
+		return nil, ErrNotFound
+	}
+	result := make([]*Template, 0, len(versions))
+	for i := len(versions) - 1; i >= 0; i-- {
+		copied := *versions[i]
+		result = append(result, &copied)
+	}
+	return result, nil
+}
+
+func (s *MemoryStore) List(ctx context.Context) ([]*Template, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	result := []*Template{}
+	for _, versions := range s.versions {
+		copied := *versions[len(versions)-1]
+		result = append(result, &copied)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Name < result[j].Name
+	})
+	return result, nil
+}
+
+func (s *MemoryStore) Tag(ctx context.Context, name, tag string, version int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if version < 1 || version > len(s.versions[name]) {
+		return ErrNotFound
+	}
+	if s.tags[name] == nil {
+		s.tags[name] = map[string]int{}
+	}
+	s.tags[name][tag] = version
+	return nil
+}
+
+func (s *MemoryStore) Tags(ctx context.Context, name string) (map[string]int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(s.versions[name]) == 0 {
+		return nil, ErrNotFound
+	}
+	tags := map[string]int{}
+	for tag, version := range s.tags[name] {
+		tags[tag] = version
+	}
+	return tags, nil
+}
+
+// PostgresStore keeps versions in app_prompt_template and tags in
+// app_prompt_tag.
+type PostgresStore struct {
+	client integrations.SQLStore
+}
+
+func NewPostgresStore(client integrations.SQLStore) *PostgresStore {
+	return &PostgresStore{client: client}
+}
+
+func (s *PostgresStore) EnsureSchema() error {
+	_, err := s.client.ExecuteUpdate(`
+		CREATE TABLE IF NOT EXISTS app_prompt_template (
+			name VARCHAR(128) NOT NULL,
+			version INTEGER NOT NULL,
+			description TEXT NOT NULL DEFAULT '',
+			body TEXT NOT NULL,
+			variables JSONB NOT NULL,
+			created_by VARCHAR(255) NOT NULL DEFAULT '',
+			created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+			PRIMARY KEY (name, version)
+		);
+		CREATE TABLE IF NOT EXISTS app_prompt_tag (
+			name VARCHAR(128) NOT NULL,
+			tag VARCHAR(128) NOT NULL,
+			version INTEGER NOT NULL,
+			updated_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+			PRIMARY KEY (name, tag),
+			FOREIGN KEY (name, version) REFERENCES app_prompt_template (name, version)
+		)
+	`)
+	if err != nil {
+		return fmt.Errorf("error creating prompt tables: %v", err)
+	}
+	return nil
+}
+
+const templateColumns = `name, version, description, body, variables, created_by, created_at`
+
+// Save numbers the version in the insert itself; concurrent saves of a
+// prompt conflict on the primary key instead of sharing a version.
+func (s *PostgresStore) Save(ctx context.Context, t *Template) error {
+	variables, err := json.Marshal(t.Variables)
+	if err != nil {
+		return err
+	}
+	rows, err := s.client.ExecuteQuery(`
+		INSERT INTO app_prompt_template (`+templateColumns+`)
+		SELECT $1, COALESCE(MAX(version), 0) + 1, $2, $3, $4, $5, $6 FROM app_prompt_template WHERE name = $1
+		RETURNING version`,
+		t.Name, t.Description, t.Body, string(variables), t.CreatedBy, t.CreatedAt.UTC(),
+	)
+	if err != nil {
+		return fmt.Errorf("error saving prompt %s: %v", t.Name, err)
+	}
+	if len(rows) == 0 {
+		return fmt.Errorf("error saving prompt %s: no version returned", t.Name)
+	}
+	t.Version = toInt(rows[0]["version"])
+	return nil
+}
+
+func (s *PostgresStore) Get(ctx context.Context, name string, version int) (*Template, error) {
+	rows, err := s.client.ExecuteQuery(
+		`SELECT `+templateColumns+` FROM app_prompt_template WHERE name = $1 AND version = $2`,
+		name, version,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("error loading prompt %s@%d: %v", name, version, err)
+	}
+	if len(rows) == 0 {
+		return nil, ErrNotFound
+	}
+	return templateFromRow(rows[0])
+}
+
+func (s *PostgresStore) Versions(ctx context.Context, name string) ([]*Template, error) {
+	rows, err := s.client.ExecuteQuery(
+		`SELECT `+templateColumns+` FROM app_prompt_template WHERE name = $1 ORDER BY version DESC`,
+		name,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("error loading versions of prompt %s: %v", name, err)
+	}
+	if len(rows) == 0 {
+		return nil, ErrNotFound
+	}
+	return templatesFromRows(rows)
+}
+
+func (s *PostgresStore) List(ctx context.Context) ([]*Template, error) {
+	rows, err := s.client.ExecuteQuery(
+		`SELECT DISTINCT ON (name) ` + templateColumns + ` FROM app_prompt_template ORDER BY name, version DESC`,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("error listing prompts: %v", err)
+	}
+	return templatesFromRows(rows)
+}
+
+func (s *PostgresStore) Tag(ctx context.Context, name, tag string, version int) error {
+	if _, err := s.Get(ctx, name, version); err != nil {
+		return err
+	}
+	_, err := s.client.ExecuteUpdate(`
+		INSERT INTO app_prompt_tag (name, tag, version, updated_at) VALUES ($1, $2, $3, $4)
+		ON CONFLICT (name, tag) DO UPDATE SET version = EXCLUDED.version, updated_at = EXCLUDED.updated_at`,
+		name, tag, version, time.Now().UTC(),
+	)
+	if err != nil {
+		return fmt.Errorf("error tagging prompt %s@%d as %s: %v", name, version, tag, err)
+	}
+	return nil
+}
+
+func (s *PostgresStore) Tags(ctx context.Context, name string) (map[string]int, error) {
+	if _, err := s.Versions(ctx, name); err != nil {
+		return nil, err
+	}
+	rows, err := s.client.ExecuteQuery(`SELECT tag, version FROM app_prompt_tag WHERE name = $1`, name)
+	if err != nil {
+		return nil, fmt.Errorf("error loading tags of prompt %s: %v", name, err)
+	}
+	tags := make(map[string]int, len(rows))
+	for _, row := range rows {
+		tags[toString(row["tag"])] = toInt(row["version"])
+	}
+	return tags, nil
+}
+
+// ConfigureDefault returns the store of prompt versions and tags. If the
+// prompt tables cannot be created they are kept in memory, where saved
+// versions only last until the process restarts.
+func ConfigureDefault(client integrations.SQLStore) Store {
+	store := NewPostgresStore(client)
+	if err := store.EnsureSchema(); err != nil {
+		promptsLogger.Printf("Prompts falling back to in-memory store: %v", err)
+		return NewMemoryStore()
+	}
+	return store
+}
+
+func templatesFromRows(rows []map[string]interface{}) ([]*Template, error) {
+	templates := make([]*Template, 0, len(rows))
+	for _, row := range rows {
+		t, err := templateFromRow(row)
+		if err != nil {
+			return nil, err
+		}
+		templates = append(templates, t)
+	}
+	return templates, nil
+}
+
+func templateFromRow(row map[string]interface{}) (*Template, error) {
+	t := &Template{
+		Name:        toString(row["name"]),
+		Version:     toInt(row["version"]),
+		Description: toString(row["description"]),
+		Body:        toString(row["body"]),
+		CreatedBy:   toString(row["created_by"]),
+	}
+	if createdAt, ok := row["created_at"].(time.Time); ok {
+		t.CreatedAt = createdAt.UTC()
+	}
+
+	var variables []byte
+	switch v := row["variables"].(type) {
+	case []byte:
+		variables = v
+	case string:
+		variables = []byte(v)
+	}
+	if err := json.Unmarshal(variables, &t.Variables); err != nil {
+		return nil, fmt.Errorf("error decoding variables of prompt %s: %v", t.Ref(), err)
+	}
+	return t, nil
+}
+
+func toString(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case []byte:
+		return string(v)
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+func toInt(value interface{}) int {
+	switch v := value.(type) {
+	case int64:
+		return int(v)
+	case int32:
+		return int(v)
+	case int:
+		return v
+	case float64:
+		return int(v)
+	}
+	var n int
+	fmt.Sscan(toString(value), &n)
+	return n
+}
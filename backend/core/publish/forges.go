@@ -0,0 +1,251 @@
+package publish
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// Forge kinds.
+const (
+	ForgeGitHub = "github"
+	ForgeGitLab = "gitlab"
+)
+
+// PullRequestOptions describe the pull request to open from Head into Base.
+type PullRequestOptions struct {
+	Head  string
+	Base  string
+	Title string
+	Body  string
+	Draft bool
+}
+
+// PullRequest is an opened pull request, or merge request on GitLab.
+type PullRequest struct {
+	Number int    `json:"number"`
+	URL    string `json:"url"`
+	// Existing is set if a pull request for the branch was already open.
+	Existing bool `json:"existing,omitempty"`
+}
+
+// ForgeError is an error response of a forge API.
+type ForgeError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *ForgeError) Error() string {
+	return fmt.Sprintf("forge returned %d: %s", e.StatusCode, e.Message)
+}
+
+// Forge opens pull requests on a code hosting service.
+type Forge interface {
+	OpenPullRequest(ctx context.Context, remote *Remote, token string, options PullRequestOptions) (*PullRequest, error)
+}
+
+// ForgeFor returns the forge hosting remote. kind selects it for
+// self-hosted instances whose host names neither; otherwise it's guessed
+// from the host.
+func ForgeFor(remote *Remote, kind string, client *http.Client) (Forge, error) {
+	if kind == "" {
+		switch {
+		case strings.Contains(remote.Host, "github"):
+			kind = ForgeGitHub
+		case strings.Contains(remote.Host, "gitlab"):
+			kind = ForgeGitLab
+		}
+	}
+	switch kind {
+	case ForgeGitHub:
+		apiURL := "https://api.github.com"
+		if remote.Host != "github.com" {
+			// GitHub Enterprise Server
+			apiURL = "https://" + remote.Host + "/api/v3"
+		}
+		return &GitHub{APIURL: apiURL, Client: client}, nil
+	case ForgeGitLab:
+		return &GitLab{APIURL: "https://" + remote.Host + "/api/v4", Client: client}, nil
+	case "":
+		return nil, fmt.Errorf("can't tell the forge of %s, pass github or gitlab as the forge", remote.Host)
+	default:
+		return nil, fmt.Errorf("unknown forge %q, must be github or gitlab", kind)
+	}
+}
+
+// GitHub opens pull requests through the REST API of GitHub.
+type GitHub struct {
+	APIURL string
+	Client *http.Client
+}
+
+func (g *GitHub) OpenPullRequest(ctx context.Context, remote *Remote, token string, options PullRequestOptions) (*PullRequest, error) {
+	request := map[string]interface{}{
+		"title": options.Title,
+		"head":  options.Head,
+		"base":  options.Base,
+		"body":  options.Body,
+		"draft": options.Draft,
+	}
+	var created struct {
+		Number  int    `json:"number"`
+		HTMLURL string `json:"html_url"`
+	}
+	err := forgeCall(ctx, g.Client, g.headers(token), http.MethodPost, g.APIURL+"/repos/"+remote.Path+"/pulls", request, &created)
+	var forgeErr *ForgeError
+	if errors.As(err, &forgeErr) && forgeErr.StatusCode == http.StatusUnprocessableEntity && strings.Contains(forgeErr.Message, "already exists") {
+		return g.existing(ctx, remote, token, options)
+	} else if err != nil {
+		return nil, err
+	}
+	return &PullRequest{Number: created.Number, URL: created.HTMLURL}, nil
+}
+
+func (g *GitHub) existing(ctx context.Context, remote *Remote, token string, options PullRequestOptions) (*PullRequest, error) {
+	query := url.Values{"head": {remote.Owner() + ":" + options.Head}, "base": {options.Base}, "state": {"open"}}
+	var open []struct {
+		Number  int    `json:"number"`
+		HTMLURL string `json:"html_url"`
+	}
+	if err := forgeCall(ctx, g.Client, g.headers(token), http.MethodGet, g.APIURL+"/repos/"+remote.Path+"/pulls?"+query.Encode(), nil, &open); err != nil {
+		return nil, err
+	}
+	if len(open) == 0 {
+		return nil, &ForgeError{StatusCode: http.StatusUnprocessableEntity, Message: "a pull request for " + options.Head + " exists but isn't open"}
+	}
+	return &PullRequest{Number: open[0].Number, URL: open[0].HTMLURL, Existing: true}, nil
+}
+
+func (g *GitHub) headers(token string) map[string]string {
+	return map[string]string{
+		"Accept":               "application/vnd.github+json",
+		"Authorization":        "Bearer " + token,
+		"X-GitHub-Api-Version": "2022-11-28",
+	}
+}
+
+// GitLab opens merge requests through the REST API of GitLab.
+type GitLab struct {
+	APIURL string
+	Client *http.Client
+}
+
+func (g *GitLab) OpenPullRequest(ctx context.Context, remote *Remote, token string, options PullRequestOptions) (*PullRequest, error) {
+	title := options.Title
+	if options.Draft {
+		title = "Draft: " + title
+	}
+	request := map[string]interface{}{
+		"source_branch":        options.Head,
+		"target_branch":        options.Base,
+		"title":                title,
+		"description":          options.Body,
+		"remove_source_branch": true,
+	}
+	var created struct {
+		IID    int    `json:"iid"`
+		WebURL string `json:"web_url"`
+	}
+	project := g.APIURL + "/projects/" + url.PathEscape(remote.Path)
+	err := forgeCall(ctx, g.Client, g.headers(token), http.MethodPost, project+"/merge_requests", request, &created)
+	var forgeErr *ForgeError
+	if errors.As(err, &forgeErr) && forgeErr.StatusCode == http.StatusConflict {
+		query := url.Values{"source_branch": {options.Head}, "target_branch": {options.Base}, "state": {"opened"}}
+		var open []struct {
+			IID    int    `json:"iid"`
+			WebURL string `json:"web_url"`
+		}
+		if err := forgeCall(ctx, g.Client, g.headers(token), http.MethodGet, project+"/merge_requests?"+query.Encode(), nil, &open); err != nil {
+			return nil, err
+		}
+		if len(open) == 0 {
+			return nil, forgeErr
+		}
+		return &PullRequest{Number: open[0].IID, URL: open[0].WebURL, Existing: true}, nil
+	} else if err != nil {
+		return nil, err
+	}
+	return &PullRequest{Number: created.IID, URL: created.WebURL}, nil
+}
+
+func (g *GitLab) headers(token string) map[string]string {
+	// personal, project and OAuth tokens are all accepted as bearer tokens
+	return map[string]string{"Authorization": "Bearer " + token}
+}
+
+func forgeCall(ctx context.Context, client *http.Client, headers map[string]string, method, endpoint string, request, response interface{}) error {
+	var body io.Reader
+	if request != nil {
+		encoded, err := json.Marshal(request)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(encoded)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, endpoint, body)
+	if err != nil {
+		return err
+	}
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+	if request != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	res, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("error calling %s: %v", req.URL.Host, err)
+	}
+	defer res.Body.Close()
+	payload, err := io.ReadAll(io.LimitReader(res.Body, 1<<20))
+	if err != nil {
+		return err
+	}
+
+	if res.StatusCode >= 300 {
+		return &ForgeError{StatusCode: res.StatusCode, Message: forgeMessage(payload)}
+	}
+	if err := json.Unmarshal(payload, response); err != nil {
+		return fmt.Errorf("invalid response of %s: %v", req.URL.Host, err)
+	}
+	return nil
+}
+
+// forgeMessage extracts the explanation of an error response. GitHub puts
+// details in errors, GitLab in message, which may be a list.
+func forgeMessage(payload []byte) string {
+	var response struct {
+		Message interface{} `json:"message"`
+		Errors  []struct {
+			Message string `json:"message"`
+		} `json:"errors"`
+	}
+	if json.Unmarshal(payload, &response) != nil {
+		return strings.TrimSpace(string(payload))
+	}
+	parts := []string{}
+	switch message := response.Message.(type) {
+	case string:
+		parts = append(parts, message)
+	case []interface{}:
+		for _, part := range message {
+			parts = append(parts, fmt.Sprint(part))
+		}
+	case nil:
+	default:
+		parts = append(parts, fmt.Sprint(message))
+	}
+	for _, detail := range response.Errors {
+		if detail.Message != "" {
+			parts = append(parts, detail.Message)
+		}
+	}
+	return strings.Join(parts, ": ")
+}
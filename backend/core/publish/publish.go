@@ -0,0 +1,262 @@
+// Package publish turns the changes an agent made in a workspace into a pull
+// request.
+//
+// The agent daemon of the workspace commits the working tree to a branch and
+// pushes it, using credentials forwarded by the caller or, without them, the
+// ones configured in the workspace. The pull request is then opened on
+// GitHub or GitLab with the same token, its description rendered from a
+// template that links the trajectory of the agent.
+package publish
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/spectrumwebco/agent_runtime/backend/core/agentcmd"
+)
+
+// PublishCommand is the agent command committing and pushing the changes.
+const PublishCommand = "publish_changes"
+
+// publishTimeout leaves time for pushing large changes.
+const publishTimeout = 3 * time.Minute
+
+// DefaultTemplate renders the description of pull requests whose request
+// has no template.
+const DefaultTemplate = `{{with .Summary}}{{.}}
+
+{{end}}{{with .TrajectoryURL}}Agent trajectory: {{.}}
+
+{{end}}{{with .Files}}Changed files:
+{{range .}}- ` + "`{{.}}`" + `
+{{end}}
+{{end}}Published from workspace {{.WorkspaceID}} by kled.`
+
+var branchPattern = regexp.MustCompile(`^[A-Za-z0-9._/-]+$`)
+
+// ValidateBranch rejects branch names git would refuse, so they fail before
+// reaching the workspace.
+func ValidateBranch(branch string) error {
+	if !branchPattern.MatchString(branch) || strings.HasPrefix(branch, "-") || strings.HasPrefix(branch, "/") ||
+		strings.HasSuffix(branch, "/") || strings.HasSuffix(branch, ".lock") || strings.HasSuffix(branch, ".") ||
+		strings.Contains(branch, "..") || strings.Contains(branch, "//") || strings.Contains(branch, "/.") {
+		return fmt.Errorf("invalid branch name %q", branch)
+	}
+	return nil
+}
+
+// Request describes what to publish.
+type Request struct {
+	Branch string `json:"branch" openapi:"required"`
+	// Base is the branch the pull request targets. It defaults to the
+	// branch checked out in the workspace, then the remote's default
+	// branch.
+	Base  string `json:"base"`
+	Title string `json:"title" openapi:"required"`
+	// Message is the commit message, the title if empty.
+	Message string `json:"message"`
+	Remote  string `json:"remote"`
+	Draft   bool   `json:"draft"`
+	// Forge is github or gitlab, guessed from the remote's host if empty.
+	Forge string `json:"forge"`
+	// Token is the caller's forwarded forge token. It pushes the branch and
+	// opens the pull request and is never stored.
+	Token    string `json:"token" openapi:"required"`
+	Username string `json:"username"`
+	// Summary and TrajectoryID describe the agent's work in the
+	// description.
+	Summary      string `json:"summary"`
+	TrajectoryID string `json:"trajectory_id"`
+	// Template replaces DefaultTemplate.
+	Template string `json:"template"`
+	// AuthorName and AuthorEmail are the identity the changes are committed
+	// as, the one configured in the workspace if empty.
+	AuthorName  string `json:"author_name"`
+	AuthorEmail string `json:"author_email"`
+}
+
+// Result is a published branch and its pull request.
+type Result struct {
+	Branch      string       `json:"branch"`
+	Base        string       `json:"base"`
+	Commit      string       `json:"commit"`
+	Committed   bool         `json:"committed"`
+	RemoteURL   string       `json:"remote_url"`
+	Files       []string     `json:"files,omitempty"`
+	PullRequest *PullRequest `json:"pull_request"`
+}
+
+// DescriptionData is what description templates see.
+type DescriptionData struct {
+	WorkspaceID   string
+	Branch        string
+	Base          string
+	Commit        string
+	Files         []string
+	Summary       string
+	TrajectoryURL string
+}
+
+// RenderDescription renders a description template.
+func RenderDescription(text string, data DescriptionData) (string, error) {
+	if text == "" {
+		text = DefaultTemplate
+	}
+	tmpl, err := template.New("description").Option("missingkey=error").Parse(text)
+	if err != nil {
+		return "", fmt.Errorf("invalid description template: %v", err)
+	}
+	var rendered bytes.Buffer
+	if err := tmpl.Execute(&rendered, data); err != nil {
+		return "", fmt.Errorf("error rendering description: %v", err)
+	}
+	return rendered.String(), nil
+}
+
+// AgentError is a publish the workspace agent failed, such as a rejected
+// push.
+type AgentError struct {
+	Message string
+}
+
+func (e *AgentError) Error() string {
+	return "publishing failed in the workspace: " + e.Message
+}
+
+type publishOutput struct {
+	RemoteURL     string   `json:"remote_url"`
+	CurrentBranch string   `json:"current_branch"`
+	DefaultBranch string   `json:"default_branch"`
+	Commit        string   `json:"commit"`
+	Committed     bool     `json:"committed"`
+	Files         []string `json:"files"`
+}
+
+// Publisher publishes the changes of workspaces whose agents are connected
+// to this replica.
+type Publisher struct {
+	dispatcher *agentcmd.Dispatcher
+	client     *http.Client
+	// TrajectoryURL returns the link to the summary of a trajectory.
+	TrajectoryURL func(trajectoryID string) string
+}
+
+func NewPublisher(dispatcher *agentcmd.Dispatcher, client *http.Client) *Publisher {
+	return &Publisher{dispatcher: dispatcher, client: client}
+}
+
+// Publish commits the changes of a workspace to request.Branch, pushes it
+// and opens a pull request for it, or returns the one already open.
+func (p *Publisher) Publish(ctx context.Context, workspaceID string, request Request) (*Result, error) {
+	if err := ValidateBranch(request.Branch); err != nil {
+		return nil, err
+	}
+	if request.Base != "" {
+		if err := ValidateBranch(request.Base); err != nil {
+			return nil, err
+		}
+	}
+	if request.Token == "" {
+		return nil, errors.New("a forge token is required")
+	}
+	if request.Message == "" {
+		request.Message = request.Title
+	}
+	// fail on broken templates before anything is pushed
+	if _, err := RenderDescription(request.Template, DescriptionData{}); err != nil {
+		return nil, err
+	}
+
+	params, err := json.Marshal(map[string]string{
+		"branch":       request.Branch,
+		"message":      request.Message,
+		"remote":       request.Remote,
+		"token":        request.Token,
+		"username":     request.Username,
+		"author_name":  request.AuthorName,
+		"author_email": request.AuthorEmail,
+	})
+	if err != nil {
+		return nil, err
+	}
+	commandResult, err := p.dispatcher.Execute(ctx, workspaceID, PublishCommand, params, agentcmd.Options{Timeout: publishTimeout})
+	if err != nil {
+		return nil, err
+	}
+	if !commandResult.Success {
+		return nil, &AgentError{Message: commandResult.Error}
+	}
+	var output publishOutput
+	if err := json.Unmarshal(commandResult.Output, &output); err != nil {
+		return nil, fmt.Errorf("invalid %s output: %v", PublishCommand, err)
+	}
+
+	result := &Result{
+		Branch:    request.Branch,
+		Base:      request.Base,
+		Commit:    output.Commit,
+		Committed: output.Committed,
+		RemoteURL: output.RemoteURL,
+		Files:     output.Files,
+	}
+	if result.Base == "" {
+		result.Base = baseBranch(request.Branch, output)
+	}
+
+	remote, err := ParseRemote(output.RemoteURL)
+	if err != nil {
+		return nil, err
+	}
+	forge, err := ForgeFor(remote, request.Forge, p.client)
+	if err != nil {
+		return nil, err
+	}
+	data := DescriptionData{
+		WorkspaceID: workspaceID,
+		Branch:      result.Branch,
+		Base:        result.Base,
+		Commit:      result.Commit,
+		Files:       result.Files,
+		Summary:     request.Summary,
+	}
+	if request.TrajectoryID != "" && p.TrajectoryURL != nil {
+		data.TrajectoryURL = p.TrajectoryURL(request.TrajectoryID)
+	}
+	body, err := RenderDescription(request.Template, data)
+	if err != nil {
+		return nil, err
+	}
+
+	result.PullRequest, err = forge.OpenPullRequest(ctx, remote, request.Token, PullRequestOptions{
+		Head:  result.Branch,
+		Base:  result.Base,
+		Title: request.Title,
+		Body:  body,
+		Draft: request.Draft,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// baseBranch picks the target of a pull request: the branch the workspace
+// was on, unless that's the published one, then the remote's default.
+func baseBranch(branch string, output publishOutput) string {
+	switch {
+	case output.CurrentBranch != "" && output.CurrentBranch != branch:
+		return output.CurrentBranch
+	case output.DefaultBranch != "":
+		return output.DefaultBranch
+	default:
+		return "main"
+	}
+}
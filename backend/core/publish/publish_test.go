@@ -0,0 +1,154 @@
+package publish
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestParseRemote(t *testing.T) {
+	for remoteURL, want := range map[string]Remote{
+		"https://github.com/acme/api.git":           {Host: "github.com", Path: "acme/api"},
+		"https://token@GitLab.example.com/a/b/c":    {Host: "gitlab.example.com", Path: "a/b/c"},
+		"ssh://git@github.com:22/acme/api.git":      {Host: "github.com", Path: "acme/api"},
+		"git@gitlab.com:group/subgroup/project.git": {Host: "gitlab.com", Path: "group/subgroup/project"},
+	} {
+		remote, err := ParseRemote(remoteURL)
+		if err != nil {
+			t.Errorf("%s: %v", remoteURL, err)
+			continue
+		}
+		if *remote != want {
+			t.Errorf("%s parsed as %+v, want %+v", remoteURL, *remote, want)
+		}
+	}
+	for _, remoteURL := range []string{"/srv/git/api.git", "https://github.com/api"} {
+		if _, err := ParseRemote(remoteURL); err == nil {
+			t.Errorf("%s must be rejected", remoteURL)
+		}
+	}
+	if owner := (&Remote{Path: "group/subgroup/project"}).Owner(); owner != "group/subgroup" {
+		t.Errorf("owner is %q", owner)
+	}
+}
+
+func TestValidateBranch(t *testing.T) {
+	for _, branch := range []string{"kled/fix-login", "release-1.2"} {
+		if err := ValidateBranch(branch); err != nil {
+			t.Errorf("%s: %v", branch, err)
+		}
+	}
+	for _, branch := range []string{"", "-f", "a..b", "feature/", "x.lock", "has space", "a/.b"} {
+		if err := ValidateBranch(branch); err == nil {
+			t.Errorf("%q must be rejected", branch)
+		}
+	}
+}
+
+func TestRenderDescription(t *testing.T) {
+	body, err := RenderDescription("", DescriptionData{
+		WorkspaceID:   "ws-1",
+		Files:         []string{"main.go"},
+		Summary:       "Fixed the login redirect.",
+		TrajectoryURL: "https://kled.example.com/trajectories/t-1",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, part := range []string{"Fixed the login redirect.", "Agent trajectory: https://kled.example.com/trajectories/t-1", "- `main.go`", "workspace ws-1"} {
+		if !strings.Contains(body, part) {
+			t.Errorf("description lacks %q:\n%s", part, body)
+		}
+	}
+	if body, err := RenderDescription("", DescriptionData{WorkspaceID: "ws-1"}); err != nil || strings.Contains(body, "trajectory") {
+		t.Errorf("empty sections must be left out, got %q, %v", body, err)
+	}
+	if _, err := RenderDescription("{{.Unknown}}", DescriptionData{}); err == nil {
+		t.Error("unknown fields must fail")
+	}
+}
+
+func TestGitHubReturnsExistingPullRequest(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer secret" || r.URL.Path != "/repos/acme/api/pulls" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		if r.Method == http.MethodPost {
+			var request map[string]interface{}
+			json.NewDecoder(r.Body).Decode(&request)
+			if request["head"] != "kled/fix" || request["base"] != "main" {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			w.WriteHeader(http.StatusUnprocessableEntity)
+			w.Write([]byte(`{"message":"Validation Failed","errors":[{"message":"A pull request already exists for acme:kled/fix."}]}`))
+			return
+		}
+		if r.URL.Query().Get("head") != "acme:kled/fix" {
+			w.Write([]byte(`[]`))
+			return
+		}
+		w.Write([]byte(`[{"number":7,"html_url":"https://github.com/acme/api/pull/7"}]`))
+	}))
+	defer server.Close()
+
+	github := &GitHub{APIURL: server.URL, Client: server.Client()}
+	remote := &Remote{Host: "github.com", Path: "acme/api"}
+	pr, err := github.OpenPullRequest(context.Background(), remote, "secret", PullRequestOptions{Head: "kled/fix", Base: "main", Title: "Fix"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pr.Number != 7 || !pr.Existing || pr.URL != "https://github.com/acme/api/pull/7" {
+		t.Fatalf("unexpected pull request %+v", pr)
+	}
+}
+
+func TestGitLabOpensDraftMergeRequest(t *testing.T) {
+	var title string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.EscapedPath() != "/projects/group%2Fapi/merge_requests" {
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"message":["404 Project Not Found"]}`))
+			return
+		}
+		var request map[string]interface{}
+		json.NewDecoder(r.Body).Decode(&request)
+		title, _ = request["title"].(string)
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`{"iid":3,"web_url":"https://gitlab.com/group/api/-/merge_requests/3"}`))
+	}))
+	defer server.Close()
+
+	gitlab := &GitLab{APIURL: server.URL, Client: server.Client()}
+	pr, err := gitlab.OpenPullRequest(context.Background(), &Remote{Host: "gitlab.com", Path: "group/api"}, "secret",
+		PullRequestOptions{Head: "kled/fix", Base: "main", Title: "Fix", Draft: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pr.Number != 3 || pr.Existing || title != "Draft: Fix" {
+		t.Fatalf("unexpected merge request %+v titled %q", pr, title)
+	}
+
+	_, err = gitlab.OpenPullRequest(context.Background(), &Remote{Host: "gitlab.com", Path: "group/missing"}, "secret", PullRequestOptions{})
+	forgeErr, ok := err.(*ForgeError)
+	if !ok || forgeErr.StatusCode != http.StatusNotFound || forgeErr.Message != "404 Project Not Found" {
+		t.Fatalf("unexpected error %v", err)
+	}
+}
+
+func TestForgeFor(t *testing.T) {
+	forge, err := ForgeFor(&Remote{Host: "github.example.com", Path: "a/b"}, "", nil)
+	if err != nil || forge.(*GitHub).APIURL != "https://github.example.com/api/v3" {
+		t.Fatalf("unexpected forge %+v, %v", forge, err)
+	}
+	if _, err := ForgeFor(&Remote{Host: "git.example.com", Path: "a/b"}, "", nil); err == nil {
+		t.Fatal("unknown hosts need an explicit forge")
+	}
+	if forge, err := ForgeFor(&Remote{Host: "git.example.com", Path: "a/b"}, ForgeGitLab, nil); err != nil || forge.(*GitLab).APIURL != "https://git.example.com/api/v4" {
+		t.Fatalf("unexpected forge %+v, %v", forge, err)
+	}
+}
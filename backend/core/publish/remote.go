@@ -0,0 +1,44 @@
+package publish
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// Remote is a git remote hosted by a forge.
+type Remote struct {
+	Host string `json:"host"`
+	// Path is the repository path on the host, such as owner/repo.
+	Path string `json:"path"`
+}
+
+// ParseRemote parses https, ssh and scp-like remote URLs.
+func ParseRemote(remoteURL string) (*Remote, error) {
+	value := strings.TrimSpace(remoteURL)
+	var host, path string
+	if strings.Contains(value, "://") {
+		u, err := url.Parse(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid remote URL %q: %v", remoteURL, err)
+		}
+		host, path = u.Hostname(), u.Path
+	} else if at := strings.Index(value, "@"); at >= 0 && strings.Contains(value[at:], ":") {
+		// git@host:owner/repo.git
+		host, path, _ = strings.Cut(value[at+1:], ":")
+	} else {
+		return nil, fmt.Errorf("remote URL %q is not hosted on a forge", remoteURL)
+	}
+
+	path = strings.TrimSuffix(strings.Trim(path, "/"), ".git")
+	if host == "" || !strings.Contains(path, "/") {
+		return nil, fmt.Errorf("remote URL %q names no repository", remoteURL)
+	}
+	return &Remote{Host: strings.ToLower(host), Path: path}, nil
+}
+
+// Owner returns the namespace of the repository, the part of Path before
+// its name.
+func (r *Remote) Owner() string {
+	return r.Path[:strings.LastIndex(r.Path, "/")]
+}
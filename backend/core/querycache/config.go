@@ -0,0 +1,40 @@
+package querycache
+
+import (
+	"time"
+
+	"github.com/spectrumwebco/agent_runtime/backend/core/config/env"
+	"github.com/spectrumwebco/agent_runtime/backend/db/integrations"
+)
+
+type Config struct {
+	// TTL is how long results are cached; 0 disables the cache.
+	TTL time.Duration `json:"ttl"`
+}
+
+// DefaultTTL outlasts an agent loop. Writes that bypass the Indexer are
+// only seen once results expire.
+const DefaultTTL = 5 * time.Minute
+
+var Default = env.Once(FromEnv)
+
+func FromEnv() Config {
+	config := Config{TTL: DefaultTTL}
+	env.NewReader(querycacheLogger).Duration("AGENT_QUERY_CACHE_TTL", &config.TTL, 0)
+	return config
+}
+
+// Variables returns the variables FromEnv reads c from.
+func (c Config) Variables() map[string]string {
+	return map[string]string{
+		"AGENT_QUERY_CACHE_TTL": c.TTL.String(),
+	}
+}
+
+// New returns the cache of a configuration in kv, or nil if the TTL is 0.
+func New(config Config, kv integrations.KVStore) *Cache {
+	if config.TTL <= 0 || kv == nil {
+		return nil
+	}
+	return NewCache(kv, config.TTL)
+}
@@ -0,0 +1,165 @@
+// Package querycache caches retrieval results in Dragonfly, so agents that
+// repeat a query in their loop don't embed and search it again.
+//
+// Entries are keyed by a fingerprint of the normalized query and of the
+// search parameters, in the tenant's namespace of a KVStore:
+//
+//	querycache:generation:{index}                    current generation
+//	querycache:{index}:{generation}:{sha256}         JSON of the results
+//
+// Writing to an index starts a new generation, which orphans its entries
+// until they expire. The hit rate is kled_query_cache_lookups_total by
+// result.
+package querycache
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/spectrumwebco/agent_runtime/backend/core/tenancy"
+	"github.com/spectrumwebco/agent_runtime/backend/db/integrations"
+)
+
+var querycacheLogger = log.New(os.Stdout, "kled.querycache: ", log.LstdFlags)
+
+var (
+	cacheLookups = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "kled_query_cache_lookups_total",
+		Help: "Retrieval cache lookups, by result: hit or miss.",
+	}, []string{"result"})
+	cacheInvalidations = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "kled_query_cache_invalidations_total",
+		Help: "Writes to indexes that invalidated their cached results.",
+	})
+)
+
+func init() {
+	prometheus.MustRegister(cacheLookups, cacheInvalidations)
+}
+
+// Normalize reduces a query to its lowercase words, so queries differing
+// only in case, whitespace or punctuation share a fingerprint.
+func Normalize(query string) string {
+	words := strings.FieldsFunc(strings.ToLower(query), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	return strings.Join(words, " ")
+}
+
+// Key identifies the results of a search.
+type Key struct {
+	// Index is the index the results are invalidated with, as the caller
+	// names it.
+	Index string
+	// Source is the physical index searched. Once an alias points at
+	// another index, the results of the old one are no longer found.
+	Source string
+	Query  string
+	TopK   int
+	Filter map[string]interface{}
+}
+
+// Fingerprint returns the SHA-256 of the normalized query and the
+// parameters of the key.
+func (k Key) Fingerprint() (string, error) {
+	// maps are encoded with sorted keys, so equal filters encode equally
+	filter, err := json.Marshal(k.Filter)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%s\x00%d\x00%s\x00%s", k.Source, k.TopK, filter, Normalize(k.Query))))
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// Cache keeps search results in a KVStore for ttl. A nil Cache caches
+// nothing.
+type Cache struct {
+	kv  integrations.KVStore
+	ttl time.Duration
+}
+
+func NewCache(kv integrations.KVStore, ttl time.Duration) *Cache {
+	return &Cache{kv: kv, ttl: ttl}
+}
+
+func generationKey(index string) string {
+	return "querycache:generation:" + index
+}
+
+// Fetch returns the cached results of key, or the results of search,
+// which are then cached. The generation is read before searching, so
+// results racing a write are cached under the generation it ends. The
+// cache failing is logged and search called anyway.
+func (c *Cache) Fetch(tenant tenancy.Tenant, key Key, search func() ([]map[string]interface{}, error)) ([]map[string]interface{}, error) {
+	if c == nil {
+		return search()
+	}
+	fingerprint, err := key.Fingerprint()
+	if err != nil {
+		querycacheLogger.Printf("Error fingerprinting query of %s: %v", key.Index, err)
+		return search()
+	}
+	kv := tenancy.NewKVStore(tenant, c.kv)
+
+	generation, err := kv.Get(generationKey(key.Index))
+	if err != nil {
+		querycacheLogger.Printf("Error reading the cache generation of %s: %v", key.Index, err)
+		return search()
+	}
+	if generation == "" {
+		generation = "0"
+	}
+	entryKey := fmt.Sprintf("querycache:%s:%s:%s", key.Index, generation, fingerprint)
+
+	value, err := kv.Get(entryKey)
+	if err != nil {
+		querycacheLogger.Printf("Error reading cached results of %s: %v", key.Index, err)
+	}
+	if value != "" {
+		var results []map[string]interface{}
+		if err := json.Unmarshal([]byte(value), &results); err == nil {
+			cacheLookups.WithLabelValues("hit").Inc()
+			return results, nil
+		}
+	}
+	cacheLookups.WithLabelValues("miss").Inc()
+
+	results, err := search()
+	if err != nil {
+		return nil, err
+	}
+	encoded, err := json.Marshal(results)
+	if err != nil {
+		querycacheLogger.Printf("Error encoding results of %s: %v", key.Index, err)
+		return results, nil
+	}
+	if _, err := kv.Set(entryKey, string(encoded), int(c.ttl.Seconds())); err != nil {
+		querycacheLogger.Printf("Error caching results of %s: %v", key.Index, err)
+	}
+	return results, nil
+}
+
+// Invalidate starts a new generation of the cached results of an index.
+// It is called after writing to the index; a failure is logged, and
+// leaves the results cached until they expire.
+func (c *Cache) Invalidate(tenant tenancy.Tenant, index string) {
+	if c == nil {
+		return
+	}
+	kv := tenancy.NewKVStore(tenant, c.kv)
+	generation := strconv.FormatInt(time.Now().UnixNano(), 36)
+	if _, err := kv.Set(generationKey(index), generation, 0); err != nil {
+		querycacheLogger.Printf("Error invalidating cached results of %s: %v", index, err)
+		return
+	}
+	cacheInvalidations.Inc()
+}
@@ -0,0 +1,78 @@
+package querycache
+
+import (
+	"testing"
+	"time"
+
+	"github.com/spectrumwebco/agent_runtime/backend/core/tenancy"
+	"github.com/spectrumwebco/agent_runtime/backend/db/integrations/integrationsmock"
+)
+
+var acme = tenancy.Tenant{OrganizationID: "acme", ProjectID: "default"}
+
+func TestFetchCachesUntilInvalidated(t *testing.T) {
+	cache := NewCache(integrationsmock.NewKVStore(), time.Minute)
+	searches := 0
+	search := func() ([]map[string]interface{}, error) {
+		searches++
+		return []map[string]interface{}{{"id": "a", "score": 0.5}}, nil
+	}
+	fetch := func(key Key) []map[string]interface{} {
+		t.Helper()
+		results, err := cache.Fetch(acme, key, search)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return results
+	}
+
+	key := Key{Index: "docs", Source: "acme_default__docs", Query: "How do I deploy?", TopK: 5, Filter: map[string]interface{}{"kind": "guide"}}
+	fetch(key)
+	key.Query = "  how do i DEPLOY "
+	if results := fetch(key); searches != 1 || results[0]["id"] != "a" {
+		t.Fatalf("expected the normalized query to hit, got %d searches of %v", searches, results)
+	}
+
+	for _, changed := range []Key{
+		{Index: "docs", Source: "acme_default__docs_v2", Query: key.Query, TopK: 5, Filter: key.Filter},
+		{Index: "docs", Source: key.Source, Query: key.Query, TopK: 10, Filter: key.Filter},
+		{Index: "docs", Source: key.Source, Query: key.Query, TopK: 5},
+	} {
+		searches = 0
+		if fetch(changed); searches != 1 {
+			t.Errorf("expected %+v to miss", changed)
+		}
+	}
+
+	searches = 0
+	cache.Invalidate(acme, "docs")
+	fetch(key)
+	fetch(key)
+	if searches != 1 {
+		t.Errorf("expected one search after invalidating, got %d", searches)
+	}
+
+	// tenants don't share results
+	fetch(key)
+	if _, err := cache.Fetch(tenancy.Tenant{OrganizationID: "globex", ProjectID: "default"}, key, search); err != nil || searches != 2 {
+		t.Errorf("expected another tenant to miss, got %d searches (%v)", searches, err)
+	}
+}
+
+func TestNilCacheSearches(t *testing.T) {
+	var cache *Cache
+	searches := 0
+	for i := 0; i < 2; i++ {
+		cache.Fetch(acme, Key{Index: "docs", Query: "q"}, func() ([]map[string]interface{}, error) {
+			searches++
+			return nil, nil
+		})
+	}
+	cache.Invalidate(acme, "docs")
+	if searches != 2 {
+		t.Errorf("expected a nil cache to search every time, got %d", searches)
+	}
+	if New(Config{}, integrationsmock.NewKVStore()) != nil {
+		t.Errorf("expected a TTL of 0 to disable the cache")
+	}
+}
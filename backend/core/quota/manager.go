@@ -0,0 +1,331 @@
+package quota
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/spectrumwebco/agent_runtime/backend/db/integrations"
+)
+
+var quotaLogger = log.New(os.Stdout, "kled.quota: ", log.LstdFlags)
+
+// Manager enforces limits across one or more scopes. A request is charged to
+// every scope it is made under, typically the user and their project, and
+// fails if any of them would exceed its limit.
+type Manager struct {
+	store    Store
+	defaults map[ScopeType]Limits
+	notifier Notifier
+	now      func() time.Time
+}
+
+func NewManager(store Store, defaults map[ScopeType]Limits, notifier Notifier) *Manager {
+	if defaults == nil {
+		defaults = map[ScopeType]Limits{}
+	}
+
+	return &Manager{
+		store:    store,
+		defaults: defaults,
+		notifier: notifier,
+		now:      time.Now,
+	}
+}
+
+func (m *Manager) SetClock(now func() time.Time) {
+	m.now = now
+}
+
+// LimitsFor returns the defaults for the scope's type overlaid with the
+// scope's own limits.
+func (m *Manager) LimitsFor(ctx context.Context, scope Scope) (Limits, error) {
+	overrides, err := m.store.Limits(ctx, scope)
+	if err != nil {
+		return nil, err
+	}
+
+	limits := Limits{}
+	for resource, limit := range m.defaults[scope.Type] {
+		limits[resource] = limit
+	}
+	for resource, limit := range overrides {
+		limits[resource] = limit
+	}
+	return limits, nil
+}
+
+func (m *Manager) SetLimit(ctx context.Context, scope Scope, resource Resource, limit float64) error {
+	if !resource.Valid() {
+		return fmt.Errorf("unknown quota resource %q", resource)
+	}
+	return m.store.SetLimit(ctx, scope, resource, limit)
+}
+
+// Consume charges amount of resource to every scope. If any scope would
+// exceed its limit the charges already made are reverted and an
+// *ExceededError is returned.
+func (m *Manager) Consume(ctx context.Context, scopes []Scope, resource Resource, amount float64) error {
+	period := resource.Period(m.now())
+	charged := make([]Scope, 0, len(scopes))
+
+	for _, scope := range scopes {
+		limits, err := m.LimitsFor(ctx, scope)
+		if err != nil {
+			m.revert(ctx, charged, resource, period, amount)
+			return err
+		}
+		limit := limits[resource]
+
+		used, ok, err := m.store.Add(ctx, scope, resource, period, amount, limit)
+		if err != nil {
+			m.revert(ctx, charged, resource, period, amount)
+			return err
+		}
+		if !ok {
+			m.revert(ctx, charged, resource, period, amount)
+			return &ExceededError{Scope: scope, Resource: resource, Used: used, Limit: limit, Requested: amount}
+		}
+		charged = append(charged, scope)
+
+		m.warnOnCrossing(ctx, Usage{Scope: scope, Resource: resource, Period: period, Used: used, Limit: limit}, amount)
+	}
+	return nil
+}
+
+// Release returns amount of a gauge resource, such as a concurrent
+// workspace slot, to every scope.
+func (m *Manager) Release(ctx context.Context, scopes []Scope, resource Resource, amount float64) error {
+	period := resource.Period(m.now())
+	for _, scope := range scopes {
+		if _, _, err := m.store.Add(ctx, scope, resource, period, -amount, 0); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Record adds usage that has already happened, such as accrued CPU hours.
+// It never fails on the limit; Check enforces it on the next request.
+func (m *Manager) Record(ctx context.Context, scopes []Scope, resource Resource, amount float64) error {
+	period := resource.Period(m.now())
+	for _, scope := range scopes {
+		limits, err := m.LimitsFor(ctx, scope)
+		if err != nil {
+			return err
+		}
+
+		used, _, err := m.store.Add(ctx, scope, resource, period, amount, 0)
+		if err != nil {
+			return err
+		}
+		m.warnOnCrossing(ctx, Usage{Scope: scope, Resource: resource, Period: period, Used: used, Limit: limits[resource]}, amount)
+	}
+	return nil
+}
+
+// StartWorkspace checks the accrued resources of the scopes and takes a
+// concurrent workspace slot for the workspace. Starting a workspace that
+// already holds a slot charges nothing and returns false.
+func (m *Manager) StartWorkspace(ctx context.Context, scopes []Scope, workspaceID string, rates Rates) (bool, error) {
+	for resource := range rates {
+		if err := m.Check(ctx, scopes, resource); err != nil {
+			return false, err
+		}
+	}
+
+	held, err := m.store.HoldSlot(ctx, Slot{WorkspaceID: workspaceID, Scopes: scopes, Rates: rates, StartedAt: m.now()})
+	if err != nil || !held {
+		return false, err
+	}
+	if err := m.Consume(ctx, scopes, ResourceConcurrentWorkspaces, 1); err != nil {
+		if _, _, releaseErr := m.store.ReleaseSlot(ctx, workspaceID); releaseErr != nil {
+			quotaLogger.Printf("Error releasing workspace slot for %s: %v", workspaceID, releaseErr)
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+// StopWorkspace returns the slot of the workspace and records the resources
+// it accrued while running. Stopping a workspace without a slot does
+// nothing.
+func (m *Manager) StopWorkspace(ctx context.Context, workspaceID string) error {
+	slot, ok, err := m.store.ReleaseSlot(ctx, workspaceID)
+	if err != nil || !ok {
+		return err
+	}
+
+	if err := m.Release(ctx, slot.Scopes, ResourceConcurrentWorkspaces, 1); err != nil {
+		return err
+	}
+	hours := m.now().Sub(slot.StartedAt).Hours()
+	if hours <= 0 {
+		return nil
+	}
+	for resource, rate := range slot.Rates {
+		if rate <= 0 {
+			continue
+		}
+		if err := m.Record(ctx, slot.Scopes, resource, rate*hours); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Check fails if any scope has already used up resource.
+func (m *Manager) Check(ctx context.Context, scopes []Scope, resource Resource) error {
+	for _, scope := range scopes {
+		usage, err := m.usage(ctx, scope, resource)
+		if err != nil {
+			return err
+		}
+		if usage.Limit > 0 && usage.Used >= usage.Limit {
+			return &ExceededError{Scope: scope, Resource: resource, Used: usage.Used, Limit: usage.Limit}
+		}
+	}
+	return nil
+}
+
+// Show returns the current usage of every resource for every scope.
+func (m *Manager) Show(ctx context.Context, scopes []Scope) ([]Usage, error) {
+	var result []Usage
+	for _, scope := range scopes {
+		for _, resource := range Resources {
+			usage, err := m.usage(ctx, scope, resource)
+			if err != nil {
+				return nil, err
+			}
+			result = append(result, usage)
+		}
+	}
+	return result, nil
+}
+
+func (m *Manager) usage(ctx context.Context, scope Scope, resource Resource) (Usage, error) {
+	limits, err := m.LimitsFor(ctx, scope)
+	if err != nil {
+		return Usage{}, err
+	}
+
+	period := resource.Period(m.now())
+	used, err := m.store.Used(ctx, scope, resource, period)
+	if err != nil {
+		return Usage{}, err
+	}
+	return Usage{Scope: scope, Resource: resource, Period: period, Used: used, Limit: limits[resource]}, nil
+}
+
+func (m *Manager) revert(ctx context.Context, scopes []Scope, resource Resource, period string, amount float64) {
+	for _, scope := range scopes {
+		if _, _, err := m.store.Add(ctx, scope, resource, period, -amount, 0); err != nil {
+			quotaLogger.Printf("Error reverting %s charge for %s: %v", resource, scope, err)
+		}
+	}
+}
+
+// warnOnCrossing notifies when a charge moves usage across
+// WarningThreshold or up to the limit, so each crossing produces one
+// warning.
+func (m *Manager) warnOnCrossing(ctx context.Context, usage Usage, amount float64) {
+	if m.notifier == nil || usage.Limit <= 0 || amount <= 0 {
+		return
+	}
+
+	before := (usage.Used - amount) / usage.Limit
+	after := usage.Ratio()
+	if (before < WarningThreshold && after >= WarningThreshold) || (before < 1 && after >= 1) {
+		m.notifier.Notify(ctx, NewWarning(usage, m.now()))
+	}
+}
+
+var (
+	defaultManager *Manager
+	managerMu      sync.RWMutex
+)
+
+func SetDefaultManager(manager *Manager) {
+	managerMu.Lock()
+	defer managerMu.Unlock()
+
+	defaultManager = manager
+}
+
+// DefaultManager returns the manager set with SetDefaultManager, or an
+// unlimited in-memory manager.
+func DefaultManager() *Manager {
+	managerMu.RLock()
+	manager := defaultManager
+	managerMu.RUnlock()
+
+	if manager != nil {
+		return manager
+	}
+
+	managerMu.Lock()
+	defer managerMu.Unlock()
+	if defaultManager == nil {
+		defaultManager = NewManager(NewMemoryStore(), nil, nil)
+	}
+	return defaultManager
+}
+
+// ConfigureDefault installs a Postgres-backed default manager. If the quota
+// tables cannot be created it falls back to an in-memory store so requests
+// are still limited per process.
+func ConfigureDefault(client integrations.SQLStore, defaults map[ScopeType]Limits, notifier Notifier) {
+	store := NewPostgresStore(client)
+	if err := store.EnsureSchema(); err != nil {
+		quotaLogger.Printf("Quotas falling back to in-memory store: %v", err)
+		SetDefaultManager(NewManager(NewMemoryStore(), defaults, notifier))
+		return
+	}
+	SetDefaultManager(NewManager(store, defaults, notifier))
+}
+
+// ParseRates reads the QUOTA_WORKSPACE_RATES setting, which maps accrued
+// resources to what a running workspace uses per hour, e.g.
+// {"cpu_hours": 2, "gpu_hours": 1}. Other resources are ignored: storage is
+// charged when a workspace is created and doesn't accrue.
+func ParseRates(setting interface{}) Rates {
+	rates := Rates{}
+
+	resources, _ := setting.(map[string]interface{})
+	for resource, value := range resources {
+		if !Resource(resource).Accrued() {
+			quotaLogger.Printf("Ignoring quota resource %q, which doesn't accrue per hour", resource)
+			continue
+		}
+		if number, err := toFloat(value); err == nil {
+			rates[Resource(resource)] = number
+		}
+	}
+	return rates
+}
+
+// ParseDefaults reads the QUOTA_DEFAULTS setting, which maps scope types to
+// resource limits, e.g. {"user": {"concurrent_workspaces": 3}}.
+func ParseDefaults(setting interface{}) map[ScopeType]Limits {
+	defaults := map[ScopeType]Limits{}
+
+	scopes, _ := setting.(map[string]interface{})
+	for scopeType, value := range scopes {
+		resources, _ := value.(map[string]interface{})
+		limits := Limits{}
+		for resource, limit := range resources {
+			if !Resource(resource).Valid() {
+				quotaLogger.Printf("Ignoring unknown quota resource %q", resource)
+				continue
+			}
+			if number, err := toFloat(limit); err == nil {
+				limits[Resource(resource)] = number
+			}
+		}
+		defaults[ScopeType(scopeType)] = limits
+	}
+	return defaults
+}
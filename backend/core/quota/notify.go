@@ -0,0 +1,78 @@
+package quota
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/spectrumwebco/agent_runtime/backend/core/events"
+)
+
+const (
+	WarningTopic     = "quota.warnings"
+	WarningEventType = "quota.warning"
+)
+
+type Warning struct {
+	ID         string    `json:"id"`
+	Type       string    `json:"type"`
+	OccurredAt time.Time `json:"occurred_at"`
+	Usage
+	Ratio float64 `json:"ratio"`
+}
+
+func NewWarning(usage Usage, now time.Time) Warning {
+	return Warning{
+		ID:         uuid.New().String(),
+		Type:       WarningEventType,
+		OccurredAt: now.UTC(),
+		Usage:      usage,
+		Ratio:      usage.Ratio(),
+	}
+}
+
+type Notifier interface {
+	Notify(ctx context.Context, warning Warning)
+}
+
+type NotifierFunc func(ctx context.Context, warning Warning)
+
+func (f NotifierFunc) Notify(ctx context.Context, warning Warning) {
+	f(ctx, warning)
+}
+
+// MultiNotifier delivers warnings to every notifier.
+type MultiNotifier []Notifier
+
+func (m MultiNotifier) Notify(ctx context.Context, warning Warning) {
+	for _, notifier := range m {
+		notifier.Notify(ctx, warning)
+	}
+}
+
+// KafkaNotifier publishes warnings to WarningTopic keyed by scope. Failures
+// are logged; a broker outage must not fail the request being charged.
+type KafkaNotifier struct {
+	producer events.HeaderProducer
+}
+
+func NewKafkaNotifier(producer events.HeaderProducer) *KafkaNotifier {
+	return &KafkaNotifier{producer: producer}
+}
+
+func (n *KafkaNotifier) Notify(ctx context.Context, warning Warning) {
+	body, err := json.Marshal(warning)
+	if err != nil {
+		quotaLogger.Printf("Error encoding quota warning: %v", err)
+		return
+	}
+
+	err = n.producer.ProduceWithHeaders(WarningTopic, body, warning.Scope.String(), map[string]string{
+		events.HeaderEventType:     WarningEventType,
+		events.HeaderCorrelationID: events.CorrelationID(ctx),
+	})
+	if err != nil {
+		quotaLogger.Printf("Error publishing quota warning for %s: %v", warning.Scope, err)
+	}
+}
@@ -0,0 +1,132 @@
+package quota
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/spectrumwebco/agent_runtime/backend/core/kerrors"
+)
+
+type Resource string
+
+const (
+	ResourceConcurrentWorkspaces Resource = "concurrent_workspaces"
+	ResourceCPUHours             Resource = "cpu_hours"
+	ResourceGPUHours             Resource = "gpu_hours"
+	ResourceStorageGB            Resource = "storage_gb"
+	ResourceExecutionsPerDay     Resource = "executions_per_day"
+	// ResourceLLMTokens are the prompt and completion tokens used through
+	// the LLM gateway each month.
+	ResourceLLMTokens Resource = "llm_tokens"
+)
+
+var Resources = []Resource{
+	ResourceConcurrentWorkspaces,
+	ResourceCPUHours,
+	ResourceGPUHours,
+	ResourceStorageGB,
+	ResourceExecutionsPerDay,
+	ResourceLLMTokens,
+}
+
+func (r Resource) Valid() bool {
+	for _, resource := range Resources {
+		if r == resource {
+			return true
+		}
+	}
+	return false
+}
+
+// Period returns the accounting period usage of r is recorded under at t.
+// Daily resources reset each UTC day and monthly ones each UTC month; all
+// others accumulate under "".
+func (r Resource) Period(t time.Time) string {
+	switch r {
+	case ResourceExecutionsPerDay:
+		return t.UTC().Format("2006-01-02")
+	case ResourceLLMTokens:
+		return t.UTC().Format("2006-01")
+	}
+	return ""
+}
+
+// Accrued reports whether r accrues while a workspace runs, so it is
+// recorded per hour of running time.
+func (r Resource) Accrued() bool {
+	return r == ResourceCPUHours || r == ResourceGPUHours
+}
+
+// Rates are the accrued resources a running workspace uses per hour, e.g.
+// its CPUs for ResourceCPUHours.
+type Rates map[Resource]float64
+
+// Slot is a concurrent workspace slot held by a running workspace. It keeps
+// the scopes it was charged to, so it is returned to them whoever stops or
+// deletes the workspace.
+type Slot struct {
+	WorkspaceID string    `json:"workspace_id"`
+	Scopes      []Scope   `json:"scopes"`
+	Rates       Rates     `json:"rates"`
+	StartedAt   time.Time `json:"started_at"`
+}
+
+type ScopeType string
+
+const (
+	ScopeUser    ScopeType = "user"
+	ScopeProject ScopeType = "project"
+)
+
+// Scope is the principal a quota applies to. Projects are identified by
+// their tenant, "<organization>/<project>".
+type Scope struct {
+	Type ScopeType `json:"type"`
+	ID   string    `json:"id"`
+}
+
+func (s Scope) String() string {
+	return string(s.Type) + ":" + s.ID
+}
+
+// Limits maps resources to their maximum. Missing or non-positive values
+// mean unlimited.
+type Limits map[Resource]float64
+
+// WarningThreshold is the usage ratio at which a warning is emitted.
+const WarningThreshold = 0.8
+
+type Usage struct {
+	Scope    Scope    `json:"scope"`
+	Resource Resource `json:"resource"`
+	Period   string   `json:"period,omitempty"`
+	Used     float64  `json:"used"`
+	// Limit is 0 when the resource is unlimited.
+	Limit float64 `json:"limit"`
+}
+
+func (u Usage) Ratio() float64 {
+	if u.Limit <= 0 {
+		return 0
+	}
+	return u.Used / u.Limit
+}
+
+var ErrExceeded = errors.New("quota exceeded")
+
+type ExceededError struct {
+	Scope     Scope
+	Resource  Resource
+	Used      float64
+	Limit     float64
+	Requested float64
+}
+
+func (e *ExceededError) Error() string {
+	return fmt.Sprintf("quota exceeded for %s: %s used %g of %g, requested %g", e.Scope, e.Resource, e.Used, e.Limit, e.Requested)
+}
+
+func (e *ExceededError) Is(target error) bool {
+	return target == ErrExceeded || target == kerrors.ErrQuotaExceeded
+}
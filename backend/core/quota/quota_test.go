@@ -0,0 +1,142 @@
+package quota
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestConsumeEnforcesEveryScope(t *testing.T) {
+	ctx := context.Background()
+	user := Scope{Type: ScopeUser, ID: "u1"}
+	project := Scope{Type: ScopeProject, ID: "org/p1"}
+	manager := NewManager(NewMemoryStore(), map[ScopeType]Limits{
+		ScopeUser:    {ResourceConcurrentWorkspaces: 2},
+		ScopeProject: {ResourceConcurrentWorkspaces: 1},
+	}, nil)
+
+	scopes := []Scope{user, project}
+	if err := manager.Consume(ctx, scopes, ResourceConcurrentWorkspaces, 1); err != nil {
+		t.Fatal(err)
+	}
+
+	err := manager.Consume(ctx, scopes, ResourceConcurrentWorkspaces, 1)
+	var exceeded *ExceededError
+	if !errors.As(err, &exceeded) || exceeded.Scope != project {
+		t.Fatalf("expected project quota to be exceeded, got %v", err)
+	}
+
+	usage, _ := manager.Show(ctx, []Scope{user})
+	if usage[0].Used != 1 {
+		t.Errorf("user charge was not reverted: %+v", usage[0])
+	}
+
+	if err := manager.Release(ctx, scopes, ResourceConcurrentWorkspaces, 1); err != nil {
+		t.Fatal(err)
+	}
+	if err := manager.Consume(ctx, scopes, ResourceConcurrentWorkspaces, 1); err != nil {
+		t.Errorf("expected slot to be free after release, got %v", err)
+	}
+}
+
+func TestDailyResourcesReset(t *testing.T) {
+	ctx := context.Background()
+	scope := Scope{Type: ScopeUser, ID: "u1"}
+	manager := NewManager(NewMemoryStore(), map[ScopeType]Limits{
+		ScopeUser: {ResourceExecutionsPerDay: 1},
+	}, nil)
+
+	now := time.Date(2026, 1, 1, 23, 0, 0, 0, time.UTC)
+	manager.SetClock(func() time.Time { return now })
+
+	if err := manager.Consume(ctx, []Scope{scope}, ResourceExecutionsPerDay, 1); err != nil {
+		t.Fatal(err)
+	}
+	if err := manager.Consume(ctx, []Scope{scope}, ResourceExecutionsPerDay, 1); !errors.Is(err, ErrExceeded) {
+		t.Fatalf("expected ErrExceeded, got %v", err)
+	}
+
+	now = now.Add(2 * time.Hour)
+	if err := manager.Consume(ctx, []Scope{scope}, ResourceExecutionsPerDay, 1); err != nil {
+		t.Errorf("expected a new day to reset usage, got %v", err)
+	}
+}
+
+func TestWarningOnceAtThreshold(t *testing.T) {
+	ctx := context.Background()
+	scope := Scope{Type: ScopeUser, ID: "u1"}
+	var warnings []Warning
+	manager := NewManager(NewMemoryStore(), map[ScopeType]Limits{
+		ScopeUser: {ResourceCPUHours: 10},
+	}, NotifierFunc(func(ctx context.Context, w Warning) {
+		warnings = append(warnings, w)
+	}))
+
+	for _, hours := range []float64{5, 3, 1} {
+		if err := manager.Record(ctx, []Scope{scope}, ResourceCPUHours, hours); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if len(warnings) != 1 || warnings[0].Used != 8 {
+		t.Fatalf("expected one warning at 8 hours, got %+v", warnings)
+	}
+
+	manager.Record(ctx, []Scope{scope}, ResourceCPUHours, 2)
+	if len(warnings) != 2 || warnings[1].Ratio < 1 {
+		t.Fatalf("expected a second warning at the limit, got %+v", warnings)
+	}
+	if err := manager.Check(ctx, []Scope{scope}, ResourceCPUHours); !errors.Is(err, ErrExceeded) {
+		t.Errorf("expected exhausted CPU hours to fail Check, got %v", err)
+	}
+}
+
+func TestWorkspaceSlots(t *testing.T) {
+	ctx := context.Background()
+	user := Scope{Type: ScopeUser, ID: "u1"}
+	store := NewMemoryStore()
+	manager := NewManager(store, map[ScopeType]Limits{
+		ScopeUser: {ResourceConcurrentWorkspaces: 1, ResourceCPUHours: 10},
+	}, nil)
+
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	manager.SetClock(func() time.Time { return now })
+
+	rates := Rates{ResourceCPUHours: 2}
+	if started, err := manager.StartWorkspace(ctx, []Scope{user}, "ws1", rates); err != nil || !started {
+		t.Fatalf("expected ws1 to start, got %v", err)
+	}
+	// starting a running workspace again doesn't take a second slot
+	if started, err := manager.StartWorkspace(ctx, []Scope{user}, "ws1", rates); err != nil || started {
+		t.Fatalf("expected no new slot for ws1, got %v, %v", started, err)
+	}
+	if _, err := manager.StartWorkspace(ctx, []Scope{user}, "ws2", rates); !errors.Is(err, ErrExceeded) {
+		t.Fatalf("expected ErrExceeded for ws2, got %v", err)
+	}
+
+	now = now.Add(3 * time.Hour)
+	if err := manager.StopWorkspace(ctx, "ws1"); err != nil {
+		t.Fatal(err)
+	}
+	// stopping a stopped workspace returns nothing
+	if err := manager.StopWorkspace(ctx, "ws1"); err != nil {
+		t.Fatal(err)
+	}
+
+	if used, _ := store.Used(ctx, user, ResourceConcurrentWorkspaces, ""); used != 0 {
+		t.Errorf("expected the slot to be returned once, %g in use", used)
+	}
+	if used, _ := store.Used(ctx, user, ResourceCPUHours, ""); used != 6 {
+		t.Errorf("expected 6 CPU hours, got %g", used)
+	}
+
+	// the accrued CPU hours are checked on the next start
+	now = now.Add(time.Hour)
+	manager.StartWorkspace(ctx, []Scope{user}, "ws1", rates)
+	now = now.Add(2 * time.Hour)
+	manager.StopWorkspace(ctx, "ws1")
+	if _, err := manager.StartWorkspace(ctx, []Scope{user}, "ws1", rates); !errors.Is(err, ErrExceeded) {
+		t.Errorf("expected the CPU hours to be exhausted, got %v", err)
+	}
+}
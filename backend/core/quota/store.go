@@ -0,0 +1,320 @@
+package quota
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/spectrumwebco/agent_runtime/backend/db/integrations"
+)
+
+type Store interface {
+	// Limits returns the per-scope overrides of the default limits.
+	Limits(ctx context.Context, scope Scope) (Limits, error)
+	SetLimit(ctx context.Context, scope Scope, resource Resource, limit float64) error
+	Used(ctx context.Context, scope Scope, resource Resource, period string) (float64, error)
+	// Add adds delta to the usage and returns the new total. When limit is
+	// positive and delta would take usage above it, nothing is changed and
+	// ok is false. Usage never drops below zero.
+	Add(ctx context.Context, scope Scope, resource Resource, period string, delta, limit float64) (used float64, ok bool, err error)
+	// HoldSlot records that slot.WorkspaceID holds a concurrent workspace
+	// slot. It returns false if the workspace already holds one.
+	HoldSlot(ctx context.Context, slot Slot) (bool, error)
+	// ReleaseSlot removes and returns the slot of the workspace, ok is false
+	// if it holds none.
+	ReleaseSlot(ctx context.Context, workspaceID string) (slot Slot, ok bool, err error)
+}
+
+type usageKey struct {
+	scope    Scope
+	resource Resource
+	period   string
+}
+
+type MemoryStore struct {
+	limits map[Scope]Limits
+	usage  map[usageKey]float64
+	slots  map[string]Slot
+	mu     sync.Mutex
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		limits: make(map[Scope]Limits),
+		usage:  make(map[usageKey]float64),
+		slots:  make(map[string]Slot),
+	}
+}
+
+func (s *MemoryStore) Limits(ctx context.Context, scope Scope) (Limits, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	limits := Limits{}
+	for resource, limit := range s.limits[scope] {
+		limits[resource] = limit
+	}
+	return limits, nil
+}
+
+func (s *MemoryStore) SetLimit(ctx context.Context, scope Scope, resource Resource, limit float64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.limits[scope] == nil {
+		s.limits[scope] = Limits{}
+	}
+	s.limits[scope][resource] = limit
+	return nil
+}
+
+func (s *MemoryStore) Used(ctx context.Context, scope Scope, resource Resource, period string) (float64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.usage[usageKey{scope, resource, period}], nil
+}
+
+func (s *MemoryStore) Add(ctx context.Context, scope Scope, resource Resource, period string, delta, limit float64) (float64, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := usageKey{scope, resource, period}
+	used := s.usage[key]
+	if limit > 0 && delta > 0 && used+delta > limit {
+		return used, false, nil
+	}
+	used += delta
+	if used < 0 {
+		used = 0
+	}
+	s.usage[key] = used
+	return used, true, nil
+}
+
+func (s *MemoryStore) HoldSlot(ctx context.Context, slot Slot) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.slots[slot.WorkspaceID]; ok {
+		return false, nil
+	}
+	s.slots[slot.WorkspaceID] = slot
+	return true, nil
+}
+
+func (s *MemoryStore) ReleaseSlot(ctx context.Context, workspaceID string) (Slot, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	slot, ok := s.slots[workspaceID]
+	delete(s.slots, workspaceID)
+	return slot, ok, nil
+}
+
+// PostgresStore keeps limits in app_quota_limit, usage in app_quota_usage
+// and the workspaces holding a slot in app_quota_slot. Conditional adds are a single UPDATE, so concurrent requests cannot
+// overshoot a limit.
+type PostgresStore struct {
+	client integrations.SQLStore
+}
+
+func NewPostgresStore(client integrations.SQLStore) *PostgresStore {
+	return &PostgresStore{client: client}
+}
+
+func (s *PostgresStore) EnsureSchema() error {
+	_, err := s.client.ExecuteUpdate(`
+		CREATE TABLE IF NOT EXISTS app_quota_limit (
+			scope_type VARCHAR(32) NOT NULL,
+			scope_id VARCHAR(255) NOT NULL,
+			resource VARCHAR(64) NOT NULL,
+			quota_limit DOUBLE PRECISION NOT NULL,
+			updated_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+			PRIMARY KEY (scope_type, scope_id, resource)
+		);
+		CREATE TABLE IF NOT EXISTS app_quota_usage (
+			scope_type VARCHAR(32) NOT NULL,
+			scope_id VARCHAR(255) NOT NULL,
+			resource VARCHAR(64) NOT NULL,
+			period VARCHAR(16) NOT NULL DEFAULT '',
+			used DOUBLE PRECISION NOT NULL DEFAULT 0,
+			updated_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+			PRIMARY KEY (scope_type, scope_id, resource, period)
+		);
+		CREATE TABLE IF NOT EXISTS app_quota_slot (
+			workspace_id VARCHAR(255) PRIMARY KEY,
+			scopes JSONB NOT NULL,
+			rates JSONB NOT NULL,
+			started_at TIMESTAMPTZ NOT NULL
+		);
+	`)
+	if err != nil {
+		return fmt.Errorf("error creating quota tables: %v", err)
+	}
+	return nil
+}
+
+func (s *PostgresStore) Limits(ctx context.Context, scope Scope) (Limits, error) {
+	rows, err := s.client.ExecuteQuery(
+		`SELECT resource, quota_limit FROM app_quota_limit WHERE scope_type = $1 AND scope_id = $2`,
+		string(scope.Type), scope.ID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("error loading quota limits for %s: %v", scope, err)
+	}
+
+	limits := Limits{}
+	for _, row := range rows {
+		limit, err := toFloat(row["quota_limit"])
+		if err != nil {
+			return nil, err
+		}
+		limits[Resource(fmt.Sprint(row["resource"]))] = limit
+	}
+	return limits, nil
+}
+
+func (s *PostgresStore) SetLimit(ctx context.Context, scope Scope, resource Resource, limit float64) error {
+	_, err := s.client.ExecuteUpdate(`
+		INSERT INTO app_quota_limit (scope_type, scope_id, resource, quota_limit)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (scope_type, scope_id, resource)
+		DO UPDATE SET quota_limit = EXCLUDED.quota_limit, updated_at = now()
+	`, string(scope.Type), scope.ID, string(resource), limit)
+	if err != nil {
+		return fmt.Errorf("error setting %s limit for %s: %v", resource, scope, err)
+	}
+	return nil
+}
+
+func (s *PostgresStore) Used(ctx context.Context, scope Scope, resource Resource, period string) (float64, error) {
+	rows, err := s.client.ExecuteQuery(`
+		SELECT used FROM app_quota_usage
+		WHERE scope_type = $1 AND scope_id = $2 AND resource = $3 AND period = $4
+	`, string(scope.Type), scope.ID, string(resource), period)
+	if err != nil {
+		return 0, fmt.Errorf("error loading %s usage for %s: %v", resource, scope, err)
+	}
+	if len(rows) == 0 {
+		return 0, nil
+	}
+	return toFloat(rows[0]["used"])
+}
+
+func (s *PostgresStore) Add(ctx context.Context, scope Scope, resource Resource, period string, delta, limit float64) (float64, bool, error) {
+	_, err := s.client.ExecuteUpdate(`
+		INSERT INTO app_quota_usage (scope_type, scope_id, resource, period)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT DO NOTHING
+	`, string(scope.Type), scope.ID, string(resource), period)
+	if err != nil {
+		return 0, false, fmt.Errorf("error recording %s usage for %s: %v", resource, scope, err)
+	}
+
+	rows, err := s.client.ExecuteQuery(`
+		UPDATE app_quota_usage
+		SET used = GREATEST(used + $5, 0), updated_at = now()
+		WHERE scope_type = $1 AND scope_id = $2 AND resource = $3 AND period = $4
+		  AND ($6 <= 0 OR $5 <= 0 OR used + $5 <= $6)
+		RETURNING used
+	`, string(scope.Type), scope.ID, string(resource), period, delta, limit)
+	if err != nil {
+		return 0, false, fmt.Errorf("error recording %s usage for %s: %v", resource, scope, err)
+	}
+	if len(rows) == 0 {
+		used, err := s.Used(ctx, scope, resource, period)
+		return used, false, err
+	}
+
+	used, err := toFloat(rows[0]["used"])
+	return used, true, err
+}
+
+func (s *PostgresStore) HoldSlot(ctx context.Context, slot Slot) (bool, error) {
+	scopes, err := json.Marshal(slot.Scopes)
+	if err != nil {
+		return false, err
+	}
+	rates, err := json.Marshal(slot.Rates)
+	if err != nil {
+		return false, err
+	}
+
+	rows, err := s.client.ExecuteQuery(`
+		INSERT INTO app_quota_slot (workspace_id, scopes, rates, started_at)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (workspace_id) DO NOTHING
+		RETURNING workspace_id
+	`, slot.WorkspaceID, string(scopes), string(rates), slot.StartedAt.UTC())
+	if err != nil {
+		return false, fmt.Errorf("error holding workspace slot for %s: %v", slot.WorkspaceID, err)
+	}
+	return len(rows) > 0, nil
+}
+
+func (s *PostgresStore) ReleaseSlot(ctx context.Context, workspaceID string) (Slot, bool, error) {
+	rows, err := s.client.ExecuteQuery(`
+		DELETE FROM app_quota_slot WHERE workspace_id = $1
+		RETURNING scopes, rates, started_at
+	`, workspaceID)
+	if err != nil {
+		return Slot{}, false, fmt.Errorf("error releasing workspace slot for %s: %v", workspaceID, err)
+	}
+	if len(rows) == 0 {
+		return Slot{}, false, nil
+	}
+
+	slot := Slot{WorkspaceID: workspaceID}
+	if err := decodeJSONColumn(rows[0]["scopes"], &slot.Scopes); err != nil {
+		return Slot{}, false, err
+	}
+	if err := decodeJSONColumn(rows[0]["rates"], &slot.Rates); err != nil {
+		return Slot{}, false, err
+	}
+	if startedAt, ok := rows[0]["started_at"].(time.Time); ok {
+		slot.StartedAt = startedAt
+	}
+	return slot, true, nil
+}
+
+func decodeJSONColumn(value interface{}, target interface{}) error {
+	var data []byte
+	switch v := value.(type) {
+	case nil:
+		return nil
+	case []byte:
+		data = v
+	case string:
+		data = []byte(v)
+	default:
+		return fmt.Errorf("unexpected JSON column type %T", value)
+	}
+	if len(data) == 0 {
+		return nil
+	}
+	return json.Unmarshal(data, target)
+}
+
+func toFloat(value interface{}) (float64, error) {
+	switch v := value.(type) {
+	case float64:
+		return v, nil
+	case float32:
+		return float64(v), nil
+	case int64:
+		return float64(v), nil
+	case int:
+		return float64(v), nil
+	case []byte:
+		return strconv.ParseFloat(string(v), 64)
+	case string:
+		return strconv.ParseFloat(v, 64)
+	case nil:
+		return 0, nil
+	}
+	return 0, fmt.Errorf("unexpected quota value %T", value)
+}
@@ -0,0 +1,148 @@
+package rbac
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/spectrumwebco/agent_runtime/backend/db/integrations"
+)
+
+// RoleStore resolves the roles a user holds in an organization.
+type RoleStore interface {
+	Roles(userID, organizationID string) ([]Role, error)
+}
+
+// PostgresRoleStore reads role bindings from the app_role_binding table.
+type PostgresRoleStore struct {
+	store integrations.SQLStore
+}
+
+func NewPostgresRoleStore(store integrations.SQLStore) *PostgresRoleStore {
+	return &PostgresRoleStore{store: store}
+}
+
+func (s *PostgresRoleStore) EnsureSchema() error {
+	_, err := s.store.ExecuteUpdate(`
+CREATE TABLE IF NOT EXISTS app_role_binding (
+	user_id UUID NOT NULL,
+	organization_id UUID NOT NULL,
+	role VARCHAR(32) NOT NULL CHECK (role IN ('viewer', 'developer', 'admin')),
+	created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+	PRIMARY KEY (user_id, organization_id, role)
+)`)
+	if err != nil {
+		return fmt.Errorf("error creating role binding table: %v", err)
+	}
+	return nil
+}
+
+func (s *PostgresRoleStore) Roles(userID, organizationID string) ([]Role, error) {
+	rows, err := s.store.ExecuteQuery(
+		`SELECT role FROM app_role_binding WHERE user_id = $1 AND organization_id = $2`,
+		userID, organizationID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("error loading roles: %v", err)
+	}
+
+	roles := make([]Role, 0, len(rows))
+	for _, row := range rows {
+		role, err := ParseRole(fmt.Sprint(row["role"]))
+		if err != nil {
+			continue
+		}
+		roles = append(roles, role)
+	}
+	return roles, nil
+}
+
+func (s *PostgresRoleStore) Bind(userID, organizationID string, role Role) error {
+	_, err := s.store.ExecuteUpdate(
+		`INSERT INTO app_role_binding (user_id, organization_id, role) VALUES ($1, $2, $3) ON CONFLICT DO NOTHING`,
+		userID, organizationID, string(role),
+	)
+	return err
+}
+
+func (s *PostgresRoleStore) Unbind(userID, organizationID string, role Role) error {
+	_, err := s.store.ExecuteUpdate(
+		`DELETE FROM app_role_binding WHERE user_id = $1 AND organization_id = $2 AND role = $3`,
+		userID, organizationID, string(role),
+	)
+	return err
+}
+
+// LoadRulesFile adds the rules in a JSON file containing an array of Rule
+// objects to e.
+func (e *Engine) LoadRulesFile(filename string) error {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return fmt.Errorf("error reading rules file: %v", err)
+	}
+
+	var rules []Rule
+	if err := json.Unmarshal(data, &rules); err != nil {
+		return fmt.Errorf("error parsing rules file %s: %v", filename, err)
+	}
+
+	for _, rule := range rules {
+		if err := e.AddRule(rule); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// DefaultRole is granted to organization members without any role binding.
+const DefaultRole = RoleViewer
+
+// SubjectFor builds the Subject for an authenticated user. Superusers always
+// hold the admin role and aren't limited to their organization.
+func SubjectFor(roles RoleStore, userID, organizationID string, superuser bool) (Subject, error) {
+	subject := Subject{ID: userID, OrganizationID: organizationID, Superuser: superuser}
+	if superuser {
+		subject.Roles = []Role{RoleAdmin}
+		return subject, nil
+	}
+
+	bound, err := roles.Roles(userID, organizationID)
+	if err != nil {
+		return subject, err
+	}
+	if len(bound) == 0 {
+		bound = []Role{DefaultRole}
+	}
+	subject.Roles = bound
+	return subject, nil
+}
+
+// WorkspaceLookup loads the owner and organization of workspaces from
+// app_workspace. Other resource types are returned as they are.
+func WorkspaceLookup(store integrations.SQLStore) ResourceLookup {
+	return func(ctx context.Context, resourceType, resourceID string) (Resource, error) {
+		resource := Resource{Type: resourceType, ID: resourceID}
+		if resourceType != "workspace" {
+			return resource, nil
+		}
+
+		rows, err := store.ExecuteQuery(
+			`SELECT created_by_id, organization_id FROM app_workspace WHERE id = $1`, resourceID,
+		)
+		if err != nil {
+			return resource, fmt.Errorf("error loading workspace %s: %v", resourceID, err)
+		}
+		if len(rows) == 0 {
+			return resource, fmt.Errorf("workspace %s not found", resourceID)
+		}
+
+		if owner := rows[0]["created_by_id"]; owner != nil {
+			resource.OwnerID = fmt.Sprint(owner)
+		}
+		if organization := rows[0]["organization_id"]; organization != nil {
+			resource.OrganizationID = fmt.Sprint(organization)
+		}
+		return resource, nil
+	}
+}
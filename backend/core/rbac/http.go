@@ -0,0 +1,154 @@
+package rbac
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/spectrumwebco/agent_runtime/backend/core/kerrors"
+)
+
+type subjectKey struct{}
+
+func WithSubject(ctx context.Context, subject Subject) context.Context {
+	return context.WithValue(ctx, subjectKey{}, subject)
+}
+
+func SubjectFromContext(ctx context.Context) (Subject, bool) {
+	subject, ok := ctx.Value(subjectKey{}).(Subject)
+	return subject, ok
+}
+
+// ResourceLookup loads the owner and organization of a resource so that
+// ownership rules can be evaluated.
+type ResourceLookup func(ctx context.Context, resourceType, resourceID string) (Resource, error)
+
+// Route maps an HTTP endpoint to the action it performs. Pattern segments of
+// the form {id} match any value; the {id} segment names the resource.
+type Route struct {
+	Method       string
+	Pattern      string
+	Action       Action
+	ResourceType string
+}
+
+// Match reports whether the route matches the request and returns the value of
+// its {id} segment.
+func (r Route) Match(method, urlPath string) (string, bool) {
+	if r.Method != "" && r.Method != method {
+		return "", false
+	}
+
+	patternSegments := strings.Split(strings.Trim(r.Pattern, "/"), "/")
+	pathSegments := strings.Split(strings.Trim(urlPath, "/"), "/")
+	if len(patternSegments) != len(pathSegments) {
+		return "", false
+	}
+
+	resourceID := ""
+	for i, segment := range patternSegments {
+		if strings.HasPrefix(segment, "{") && strings.HasSuffix(segment, "}") {
+			if segment == "{id}" {
+				resourceID = pathSegments[i]
+			}
+			continue
+		}
+		if segment != pathSegments[i] {
+			return "", false
+		}
+	}
+	return resourceID, true
+}
+
+// HTTPMiddleware enforces routes. Requests that match no route pass through
+// unchanged so the middleware can be layered over the whole API, except
+// mutating requests below a protected prefix, which are denied.
+type HTTPMiddleware struct {
+	next      http.Handler
+	engine    *Engine
+	routes    []Route
+	subjects  func(r *http.Request) (Subject, error)
+	lookup    ResourceLookup
+	protected []string
+}
+
+func NewHTTPMiddleware(next http.Handler, engine *Engine, routes []Route, subjects func(r *http.Request) (Subject, error), lookup ResourceLookup) *HTTPMiddleware {
+	return &HTTPMiddleware{
+		next:     next,
+		engine:   engine,
+		routes:   routes,
+		subjects: subjects,
+		lookup:   lookup,
+	}
+}
+
+// Protect denies POST, PUT, PATCH and DELETE requests below the prefixes
+// that match no route, so new endpoints can't skip authorization.
+func (m *HTTPMiddleware) Protect(prefixes ...string) *HTTPMiddleware {
+	m.protected = append(m.protected, prefixes...)
+	return m
+}
+
+func (m *HTTPMiddleware) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	for _, route := range m.routes {
+		resourceID, ok := route.Match(r.Method, r.URL.Path)
+		if !ok {
+			continue
+		}
+
+		subject, err := m.subjects(r)
+		if err != nil {
+			writeDenied(w, http.StatusUnauthorized, err.Error())
+			return
+		}
+
+		resource := Resource{Type: route.ResourceType, ID: resourceID}
+		if resourceID != "" && m.lookup != nil {
+			resource, err = m.lookup(r.Context(), route.ResourceType, resourceID)
+			if err != nil {
+				writeDenied(w, http.StatusNotFound, err.Error())
+				return
+			}
+		}
+
+		decision := m.engine.Authorize(subject, route.Action, resource)
+		if !decision.Allowed {
+			status := http.StatusForbidden
+			if subject.ID == "" {
+				status = http.StatusUnauthorized
+			}
+			writeDenied(w, status, decision.Reason)
+			return
+		}
+
+		m.next.ServeHTTP(w, r.WithContext(WithSubject(r.Context(), subject)))
+		return
+	}
+
+	if mutating(r.Method) {
+		for _, prefix := range m.protected {
+			if strings.HasPrefix(r.URL.Path, prefix) {
+				writeDenied(w, http.StatusForbidden, "no route authorizes "+r.Method+" "+r.URL.Path)
+				return
+			}
+		}
+	}
+	m.next.ServeHTTP(w, r)
+}
+
+func mutating(method string) bool {
+	switch method {
+	case http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete:
+		return true
+	}
+	return false
+}
+
+func writeDenied(w http.ResponseWriter, status int, reason string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	body := kerrors.Body(kerrors.New(kerrors.FromHTTPStatus(status), "permission denied"))
+	body["reason"] = reason
+	json.NewEncoder(w).Encode(body)
+}
@@ -0,0 +1,325 @@
+// Package rbac authorizes workspace and interpreter operations.
+//
+// Subjects hold one or more of the built-in roles. The Engine first evaluates
+// custom rules in registration order; the first rule that allows or denies
+// decides. When no rule matches, the built-in role policy applies:
+//
+//	viewer     list workspaces and read logs, trajectories and task status
+//	developer  everything a viewer can, plus create, start, stop and delete
+//	           their own workspaces and run the interpreter in them
+//	admin      every action on every resource of their organization,
+//	           including reading costs
+//
+// Roles are bound per organization, so no role reaches into another
+// organization. Only platform superusers act across organizations.
+package rbac
+
+import (
+	"fmt"
+	"path"
+	"sync"
+)
+
+type Role string
+
+const (
+	RoleViewer    Role = "viewer"
+	RoleDeveloper Role = "developer"
+	RoleAdmin     Role = "admin"
+)
+
+func ParseRole(value string) (Role, error) {
+	switch Role(value) {
+	case RoleViewer, RoleDeveloper, RoleAdmin:
+		return Role(value), nil
+	default:
+		return "", fmt.Errorf("unknown role %q, must be one of viewer, developer or admin", value)
+	}
+}
+
+type Action string
+
+const (
+	ActionWorkspaceList   Action = "workspace.list"
+	ActionWorkspaceGet    Action = "workspace.get"
+	ActionWorkspaceLogs   Action = "workspace.logs"
+	ActionWorkspaceCreate Action = "workspace.create"
+	ActionWorkspaceStart  Action = "workspace.start"
+	ActionWorkspaceStop   Action = "workspace.stop"
+	ActionWorkspaceDelete Action = "workspace.delete"
+	ActionWorkspaceDiff   Action = "workspace.diff"
+	// ActionWorkspacePatch applies patches to, and takes snapshots of, the
+	// working tree of a workspace.
+	ActionWorkspacePatch Action = "workspace.patch"
+	// ActionWorkspacePublish pushes the changes of a workspace and opens a
+	// pull request for them.
+	ActionWorkspacePublish Action = "workspace.publish"
+	// ActionWorkspaceSchedule sets the calendar on which a workspace is
+	// started and stopped.
+	ActionWorkspaceSchedule Action = "workspace.schedule"
+
+	ActionInterpreterExecute Action = "interpreter.execute"
+	ActionInterpreterStatus  Action = "interpreter.status"
+	ActionInterpreterCancel  Action = "interpreter.cancel"
+
+	// ActionCommandApprove approves agent commands blocked by the tool
+	// policy of the workspace's organization.
+	ActionCommandApprove Action = "command.approve"
+
+	ActionTrajectoryRead Action = "trajectory.read"
+	ActionCostRead       Action = "cost.read"
+)
+
+// Subject is the authenticated caller.
+type Subject struct {
+	ID             string
+	OrganizationID string
+	Roles          []Role
+	// Superuser is set for platform operators, who may act on the resources
+	// of every organization.
+	Superuser bool
+}
+
+func (s Subject) HasRole(role Role) bool {
+	for _, r := range s.Roles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+// Resource is the object an action applies to. ID is empty for
+// collection-level actions such as listing or creating workspaces.
+type Resource struct {
+	Type           string
+	ID             string
+	OwnerID        string
+	OrganizationID string
+}
+
+// OwnedBy reports whether the subject owns the resource. Collection-level
+// actions create resources the subject will own; a resource whose owner is
+// unknown is owned by nobody.
+func (r Resource) OwnedBy(subjectID string) bool {
+	if r.ID == "" {
+		return true
+	}
+	return r.OwnerID != "" && r.OwnerID == subjectID
+}
+
+type Effect string
+
+const (
+	EffectAllow   Effect = "allow"
+	EffectDeny    Effect = "deny"
+	EffectAbstain Effect = ""
+)
+
+type Decision struct {
+	Allowed bool
+	Reason  string
+}
+
+// RuleFunc is a custom rule. Returning EffectAbstain defers to later rules and
+// finally to the built-in role policy.
+type RuleFunc func(subject Subject, action Action, resource Resource) (Effect, string)
+
+type grant struct {
+	action  Action
+	ownOnly bool
+}
+
+var rolePolicy = map[Role][]grant{
+	RoleViewer: {
+		{action: ActionWorkspaceList},
+		{action: ActionWorkspaceGet},
+		{action: ActionWorkspaceLogs},
+		{action: ActionWorkspaceDiff},
+		{action: ActionInterpreterStatus},
+		{action: ActionTrajectoryRead},
+	},
+	RoleDeveloper: {
+		{action: ActionWorkspaceList},
+		{action: ActionWorkspaceGet},
+		{action: ActionWorkspaceLogs},
+		{action: ActionWorkspaceDiff},
+		{action: ActionInterpreterStatus},
+		{action: ActionTrajectoryRead},
+		{action: ActionWorkspaceCreate},
+		{action: ActionWorkspaceStart, ownOnly: true},
+		{action: ActionWorkspaceStop, ownOnly: true},
+		{action: ActionWorkspaceDelete, ownOnly: true},
+		{action: ActionWorkspacePatch, ownOnly: true},
+		{action: ActionWorkspacePublish, ownOnly: true},
+		{action: ActionWorkspaceSchedule, ownOnly: true},
+		{action: ActionInterpreterExecute, ownOnly: true},
+		{action: ActionInterpreterCancel, ownOnly: true},
+		{action: ActionCommandApprove, ownOnly: true},
+	},
+}
+
+type Engine struct {
+	rules []namedRule
+	mu    sync.RWMutex
+}
+
+type namedRule struct {
+	name string
+	rule RuleFunc
+}
+
+func NewEngine() *Engine {
+	return &Engine{}
+}
+
+func (e *Engine) AddRuleFunc(name string, rule RuleFunc) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.rules = append(e.rules, namedRule{name: name, rule: rule})
+}
+
+func (e *Engine) AddRule(rule Rule) error {
+	if err := rule.Validate(); err != nil {
+		return err
+	}
+	e.AddRuleFunc(rule.Name, rule.evaluate)
+	return nil
+}
+
+func (e *Engine) Authorize(subject Subject, action Action, resource Resource) Decision {
+	if subject.ID == "" {
+		return Decision{Allowed: false, Reason: "unauthenticated"}
+	}
+
+	// a resource whose organization is unknown only matches subjects
+	// without one. Roles are bound per organization, so even admins stay
+	// within theirs.
+	if (resource.ID != "" || resource.OrganizationID != "") && resource.OrganizationID != subject.OrganizationID && !subject.Superuser {
+		return Decision{Allowed: false, Reason: "resource belongs to another organization"}
+	}
+
+	e.mu.RLock()
+	rules := append([]namedRule(nil), e.rules...)
+	e.mu.RUnlock()
+
+	for _, r := range rules {
+		switch effect, reason := r.rule(subject, action, resource); effect {
+		case EffectAllow:
+			return Decision{Allowed: true, Reason: ruleReason(r.name, reason)}
+		case EffectDeny:
+			return Decision{Allowed: false, Reason: ruleReason(r.name, reason)}
+		}
+	}
+
+	if subject.HasRole(RoleAdmin) {
+		return Decision{Allowed: true, Reason: "admin"}
+	}
+
+	ownerOnlyMatch := false
+	for _, role := range subject.Roles {
+		for _, g := range rolePolicy[role] {
+			if g.action != action {
+				continue
+			}
+			if !g.ownOnly || resource.OwnedBy(subject.ID) {
+				return Decision{Allowed: true, Reason: fmt.Sprintf("role %s grants %s", role, action)}
+			}
+			ownerOnlyMatch = true
+		}
+	}
+
+	if ownerOnlyMatch {
+		return Decision{Allowed: false, Reason: fmt.Sprintf("%s is only allowed on your own resources", action)}
+	}
+	return Decision{Allowed: false, Reason: fmt.Sprintf("no role grants %s", action)}
+}
+
+func ruleReason(name, reason string) string {
+	if reason == "" {
+		return "rule " + name
+	}
+	return fmt.Sprintf("rule %s: %s", name, reason)
+}
+
+// Rule is a declarative custom rule, typically loaded from configuration.
+// Actions and ResourceTypes accept shell patterns such as "workspace.*".
+// Empty lists match everything.
+type Rule struct {
+	Name          string   `json:"name"`
+	Effect        Effect   `json:"effect"`
+	Roles         []Role   `json:"roles,omitempty"`
+	Subjects      []string `json:"subjects,omitempty"`
+	Actions       []string `json:"actions,omitempty"`
+	ResourceTypes []string `json:"resource_types,omitempty"`
+	// OwnerOnly restricts the rule to resources owned by the subject.
+	OwnerOnly bool `json:"owner_only,omitempty"`
+}
+
+func (r Rule) Validate() error {
+	if r.Name == "" {
+		return fmt.Errorf("rule name is required")
+	}
+	if r.Effect != EffectAllow && r.Effect != EffectDeny {
+		return fmt.Errorf("rule %s: effect must be allow or deny", r.Name)
+	}
+	for _, pattern := range append(append([]string{}, r.Actions...), r.ResourceTypes...) {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("rule %s: invalid pattern %q", r.Name, pattern)
+		}
+	}
+	return nil
+}
+
+func (r Rule) evaluate(subject Subject, action Action, resource Resource) (Effect, string) {
+	if len(r.Roles) > 0 {
+		matched := false
+		for _, role := range r.Roles {
+			if subject.HasRole(role) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return EffectAbstain, ""
+		}
+	}
+	if len(r.Subjects) > 0 && !contains(r.Subjects, subject.ID) {
+		return EffectAbstain, ""
+	}
+	if !matchAny(r.Actions, string(action)) || !matchAny(r.ResourceTypes, resource.Type) {
+		return EffectAbstain, ""
+	}
+	if r.OwnerOnly && !resource.OwnedBy(subject.ID) {
+		return EffectAbstain, ""
+	}
+	return r.Effect, ""
+}
+
+func matchAny(patterns []string, value string) bool {
+	if len(patterns) == 0 {
+		return true
+	}
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, value); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+var defaultEngine = NewEngine()
+
+func DefaultEngine() *Engine {
+	return defaultEngine
+}
@@ -0,0 +1,116 @@
+package rbac
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRolePolicy(t *testing.T) {
+	engine := NewEngine()
+	viewer := Subject{ID: "v", Roles: []Role{RoleViewer}}
+	developer := Subject{ID: "d", Roles: []Role{RoleDeveloper}}
+	admin := Subject{ID: "a", Roles: []Role{RoleAdmin}}
+
+	own := Resource{Type: "workspace", ID: "ws-1", OwnerID: "d"}
+	other := Resource{Type: "workspace", ID: "ws-2", OwnerID: "someone-else"}
+
+	tests := []struct {
+		name     string
+		subject  Subject
+		action   Action
+		resource Resource
+		allowed  bool
+	}{
+		{"viewer lists", viewer, ActionWorkspaceList, Resource{Type: "workspace"}, true},
+		{"viewer reads logs", viewer, ActionWorkspaceLogs, other, true},
+		{"viewer cannot start", viewer, ActionWorkspaceStart, other, false},
+		{"developer creates", developer, ActionWorkspaceCreate, Resource{Type: "workspace"}, true},
+		{"developer starts own", developer, ActionWorkspaceStart, own, true},
+		{"developer cannot stop others", developer, ActionWorkspaceStop, other, false},
+		{"developer cannot execute in others", developer, ActionInterpreterExecute, other, false},
+		{"developer cannot stop unowned", developer, ActionWorkspaceStop, Resource{Type: "workspace", ID: "ws-3"}, false},
+		{"developer executes without workspace", developer, ActionInterpreterExecute, Resource{Type: "interpreter"}, true},
+		{"admin stops others", admin, ActionWorkspaceStop, other, true},
+		{"anonymous denied", Subject{}, ActionWorkspaceList, Resource{}, false},
+	}
+
+	for _, test := range tests {
+		if decision := engine.Authorize(test.subject, test.action, test.resource); decision.Allowed != test.allowed {
+			t.Errorf("%s: expected allowed=%v, got %+v", test.name, test.allowed, decision)
+		}
+	}
+}
+
+func TestOrganizations(t *testing.T) {
+	engine := NewEngine()
+	viewer := Subject{ID: "v", OrganizationID: "org-1", Roles: []Role{RoleViewer}}
+
+	tests := []struct {
+		name     string
+		subject  Subject
+		resource Resource
+		allowed  bool
+	}{
+		{"same organization", viewer, Resource{Type: "workspace", ID: "ws-1", OrganizationID: "org-1"}, true},
+		{"other organization", viewer, Resource{Type: "workspace", ID: "ws-1", OrganizationID: "org-2"}, false},
+		{"unknown organization", viewer, Resource{Type: "workspace", ID: "ws-1"}, false},
+		{"subject without organization", Subject{ID: "v", Roles: []Role{RoleViewer}}, Resource{Type: "workspace", ID: "ws-1", OrganizationID: "org-1"}, false},
+		{"collection", viewer, Resource{Type: "workspace"}, true},
+		{"admin of other organization", Subject{ID: "a", OrganizationID: "org-1", Roles: []Role{RoleAdmin}}, Resource{Type: "workspace", ID: "ws-1", OrganizationID: "org-2"}, false},
+		{"superuser", Subject{ID: "s", Roles: []Role{RoleAdmin}, Superuser: true}, Resource{Type: "workspace", ID: "ws-1", OrganizationID: "org-2"}, true},
+	}
+	for _, test := range tests {
+		if decision := engine.Authorize(test.subject, ActionWorkspaceGet, test.resource); decision.Allowed != test.allowed {
+			t.Errorf("%s: expected allowed=%v, got %+v", test.name, test.allowed, decision)
+		}
+	}
+}
+
+func TestHTTPMiddlewareProtect(t *testing.T) {
+	routes := []Route{{Method: http.MethodPost, Pattern: "/api/workspaces/{id}/stop/", Action: ActionWorkspaceStop, ResourceType: "workspace"}}
+	subjects := func(r *http.Request) (Subject, error) {
+		return Subject{ID: "d", Roles: []Role{RoleDeveloper}}, nil
+	}
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	middleware := NewHTTPMiddleware(next, NewEngine(), routes, subjects, nil).Protect("/api/workspaces/")
+
+	for _, test := range []struct {
+		method, path string
+		status       int
+	}{
+		{http.MethodGet, "/api/workspaces/ws-1/unrouted/", http.StatusOK},
+		{http.MethodPatch, "/api/workspaces/ws-1/", http.StatusForbidden},
+		{http.MethodPost, "/api/other/", http.StatusOK},
+	} {
+		res := httptest.NewRecorder()
+		middleware.ServeHTTP(res, httptest.NewRequest(test.method, test.path, nil))
+		if res.Code != test.status {
+			t.Errorf("%s %s: expected %d, got %d", test.method, test.path, test.status, res.Code)
+		}
+	}
+}
+
+func TestCustomRulesTakePrecedence(t *testing.T) {
+	engine := NewEngine()
+	if err := engine.AddRule(Rule{Name: "freeze", Effect: EffectDeny, Actions: []string{"workspace.create"}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := engine.AddRule(Rule{Name: "oncall", Effect: EffectAllow, Subjects: []string{"v"}, Actions: []string{"workspace.*"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	developer := Subject{ID: "d", Roles: []Role{RoleDeveloper}}
+	if engine.Authorize(developer, ActionWorkspaceCreate, Resource{Type: "workspace"}).Allowed {
+		t.Error("expected deny rule to block workspace creation")
+	}
+
+	viewer := Subject{ID: "v", Roles: []Role{RoleViewer}}
+	if !engine.Authorize(viewer, ActionWorkspaceStop, Resource{Type: "workspace", OwnerID: "x"}).Allowed {
+		t.Error("expected allow rule to grant stop to the on-call viewer")
+	}
+
+	if err := engine.AddRule(Rule{Name: "bad", Effect: "maybe"}); err == nil {
+		t.Error("expected invalid effect to be rejected")
+	}
+}
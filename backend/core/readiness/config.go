@@ -0,0 +1,52 @@
+package readiness
+
+import (
+	"time"
+
+	"github.com/spectrumwebco/agent_runtime/backend/core/config/env"
+)
+
+type Config struct {
+	// Timeout is how long a dependency may take to warm up before it is
+	// reported unavailable, for dependencies registered without a timeout.
+	Timeout time.Duration `json:"timeout"`
+	// Timeouts override the timeouts of dependencies by name.
+	Timeouts map[string]time.Duration `json:"timeouts"`
+	// RetryInterval is the time between the checks of a dependency that
+	// isn't warm yet.
+	RetryInterval time.Duration `json:"retry_interval"`
+	// Optional names dependencies that don't hold back readiness, in
+	// addition to those registered as optional.
+	Optional []string `json:"optional"`
+}
+
+const (
+	DefaultTimeout       = time.Minute
+	DefaultRetryInterval = 2 * time.Second
+)
+
+var Default = env.Once(FromEnv)
+
+// FromEnv reads AGENT_READINESS_TIMEOUTS as comma separated
+// dependency=timeout pairs and AGENT_READINESS_OPTIONAL as comma separated
+// dependencies.
+func FromEnv() Config {
+	config := Config{
+		Timeout:       DefaultTimeout,
+		Timeouts:      map[string]time.Duration{},
+		RetryInterval: DefaultRetryInterval,
+	}
+	read := env.NewReader(readinessLogger)
+	read.PositiveDuration("AGENT_READINESS_TIMEOUT", &config.Timeout)
+	read.PositiveDuration("AGENT_READINESS_RETRY_INTERVAL", &config.RetryInterval)
+	read.Pairs("AGENT_READINESS_TIMEOUTS", "dependency=timeout pairs with positive timeouts", func(dependency, value string) bool {
+		timeout, err := time.ParseDuration(value)
+		if err != nil || timeout <= 0 {
+			return false
+		}
+		config.Timeouts[dependency] = timeout
+		return true
+	})
+	config.Optional = read.List("AGENT_READINESS_OPTIONAL")
+	return config
+}
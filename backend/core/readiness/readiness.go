@@ -0,0 +1,295 @@
+// Package readiness gates the readiness of the backend on the warm-up of
+// its dependencies.
+//
+// Dependencies such as the Postgres pool, Dragonfly, the Kafka brokers and
+// Vault are registered with a Gate, and WarmUp checks them concurrently on
+// startup, retrying each until it succeeds. The backend reports ready once
+// every required dependency is warm. A dependency that doesn't warm up
+// within its timeout is reported unavailable; if it is optional, such as
+// RAGflow, the backend is ready anyway and runs degraded until it comes up.
+// The state of every dependency is exported as the gauge
+// kled_dependency_ready{dependency}.
+package readiness
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var readinessLogger = log.New(os.Stdout, "kled.readiness: ", log.LstdFlags)
+
+var readyGauge = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+	Name: "kled_dependency_ready",
+	Help: "Whether a dependency of the backend is warm, by dependency.",
+}, []string{"dependency"})
+
+func init() {
+	prometheus.MustRegister(readyGauge)
+}
+
+// Check warms up a dependency, e.g. by opening a connection, and returns
+// an error if it isn't usable yet. It should return promptly once ctx is
+// done.
+type Check func(ctx context.Context) error
+
+type Dependency struct {
+	Name string
+	// Optional dependencies don't hold back readiness.
+	Optional bool
+	// Timeout is how long the dependency may take to warm up, the timeout
+	// of the configuration if zero.
+	Timeout time.Duration
+	Check   Check
+}
+
+// The states of a dependency.
+const (
+	// StatusPending is a dependency warming up within its timeout.
+	StatusPending = "pending"
+	StatusReady   = "ready"
+	// StatusUnavailable is a dependency that didn't warm up within its
+	// timeout. It is still checked until it does.
+	StatusUnavailable = "unavailable"
+)
+
+type DependencyStatus struct {
+	Name     string `json:"name"`
+	Optional bool   `json:"optional"`
+	Status   string `json:"status"`
+	// Error is the error of the last check that failed.
+	Error    string `json:"error,omitempty"`
+	Attempts int    `json:"attempts"`
+	// WarmUp is how long the dependency took to warm up.
+	WarmUp float64 `json:"warm_up_seconds,omitempty"`
+}
+
+type Report struct {
+	// Ready is whether every required dependency is warm.
+	Ready bool `json:"ready"`
+	// Degraded is whether an optional dependency is unavailable.
+	Degraded     bool               `json:"degraded"`
+	Dependencies []DependencyStatus `json:"dependencies"`
+}
+
+// Gate tracks the warm-up of dependencies.
+type Gate struct {
+	config       Config
+	dependencies []Dependency
+	statuses     map[string]*DependencyStatus
+	mu           sync.RWMutex
+}
+
+func NewGate(config Config) *Gate {
+	if config.Timeout <= 0 {
+		config.Timeout = DefaultTimeout
+	}
+	if config.RetryInterval <= 0 {
+		config.RetryInterval = DefaultRetryInterval
+	}
+
+	return &Gate{
+		config:   config,
+		statuses: make(map[string]*DependencyStatus),
+	}
+}
+
+// Register adds a dependency. It is called before WarmUp. The timeouts and
+// optional dependencies of the configuration override those of dependency.
+func (g *Gate) Register(dependency Dependency) {
+	if timeout, ok := g.config.Timeouts[dependency.Name]; ok {
+		dependency.Timeout = timeout
+	}
+	if dependency.Timeout <= 0 {
+		dependency.Timeout = g.config.Timeout
+	}
+	for _, name := range g.config.Optional {
+		if name == dependency.Name {
+			dependency.Optional = true
+		}
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.dependencies = append(g.dependencies, dependency)
+	g.statuses[dependency.Name] = &DependencyStatus{
+		Name:     dependency.Name,
+		Optional: dependency.Optional,
+		Status:   StatusPending,
+	}
+	readyGauge.WithLabelValues(dependency.Name).Set(0)
+}
+
+// WarmUp checks every dependency concurrently until it succeeds. It returns
+// once every required dependency is warm or past its timeout, with an error
+// naming the required dependencies that aren't warm. Those, and optional
+// dependencies, are checked in the background until they are warm or ctx
+// is done.
+func (g *Gate) WarmUp(ctx context.Context) error {
+	g.mu.RLock()
+	dependencies := append([]Dependency(nil), g.dependencies...)
+	g.mu.RUnlock()
+
+	var required sync.WaitGroup
+	for _, dependency := range dependencies {
+		settled := func() {}
+		if !dependency.Optional {
+			required.Add(1)
+			settled = required.Done
+		}
+		go g.warmUp(ctx, dependency, settled)
+	}
+	required.Wait()
+
+	var errs []error
+	for _, status := range g.Report().Dependencies {
+		if !status.Optional && status.Status != StatusReady {
+			errs = append(errs, fmt.Errorf("%s: %s", status.Name, status.Error))
+		}
+	}
+	if len(errs) == 0 {
+		readinessLogger.Printf("Ready, %d dependencies warmed up", len(dependencies))
+	}
+	return errors.Join(errs...)
+}
+
+// warmUp checks a dependency every retry interval until it succeeds,
+// calling settled once it is warm or past its timeout.
+func (g *Gate) warmUp(ctx context.Context, dependency Dependency, settled func()) {
+	var once sync.Once
+	defer once.Do(settled)
+
+	start := time.Now()
+	deadline := start.Add(dependency.Timeout)
+	for attempt := 1; ; attempt++ {
+		// the first attempts end at the deadline, so the dependency settles
+		// in time even if its check hangs
+		timeout := time.Until(deadline)
+		if timeout <= 0 {
+			timeout = dependency.Timeout
+		}
+		err := runCheck(ctx, dependency.Check, timeout)
+		if err == nil {
+			g.update(dependency.Name, StatusReady, nil, attempt, time.Since(start))
+			readinessLogger.Printf("Warmed up %s in %s", dependency.Name, time.Since(start).Round(time.Millisecond))
+			return
+		}
+		if ctx.Err() != nil {
+			return
+		}
+
+		if time.Now().Before(deadline) {
+			g.update(dependency.Name, StatusPending, err, attempt, 0)
+		} else {
+			if g.update(dependency.Name, StatusUnavailable, err, attempt, 0) {
+				if dependency.Optional {
+					readinessLogger.Printf("Optional dependency %s didn't warm up within %s, running degraded: %v", dependency.Name, dependency.Timeout, err)
+				} else {
+					readinessLogger.Printf("Dependency %s didn't warm up within %s, not ready: %v", dependency.Name, dependency.Timeout, err)
+				}
+			}
+			once.Do(settled)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(g.config.RetryInterval):
+		}
+	}
+}
+
+// runCheck runs a check with a timeout. A check ignoring its context is
+// left running once the timeout has passed.
+func runCheck(ctx context.Context, check Check, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	done := make(chan error, 1)
+	go func() {
+		done <- check(ctx)
+	}()
+
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// update records the outcome of a check and returns whether the status of
+// the dependency changed.
+func (g *Gate) update(name, status string, err error, attempts int, warmUp time.Duration) bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	dependency := g.statuses[name]
+	changed := dependency.Status != status
+	dependency.Status = status
+	dependency.Attempts = attempts
+	dependency.Error = ""
+	if err != nil {
+		dependency.Error = err.Error()
+	}
+	dependency.WarmUp = warmUp.Seconds()
+
+	if status == StatusReady {
+		readyGauge.WithLabelValues(name).Set(1)
+	}
+	return changed
+}
+
+// Ready returns whether every required dependency is warm.
+func (g *Gate) Ready() bool {
+	return g.Report().Ready
+}
+
+// Report returns the state of every dependency, sorted by name.
+func (g *Gate) Report() Report {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+
+	report := Report{Ready: true, Dependencies: make([]DependencyStatus, 0, len(g.statuses))}
+	for _, dependency := range g.statuses {
+		report.Dependencies = append(report.Dependencies, *dependency)
+		if dependency.Status == StatusReady {
+			continue
+		}
+		if !dependency.Optional {
+			report.Ready = false
+		} else if dependency.Status == StatusUnavailable {
+			report.Degraded = true
+		}
+	}
+	sort.Slice(report.Dependencies, func(i, j int) bool {
+		return report.Dependencies[i].Name < report.Dependencies[j].Name
+	})
+	return report
+}
+
+var (
+	defaultGate     *Gate
+	defaultGateOnce sync.Once
+)
+
+// DefaultGate returns the gate of the process, configured from the
+// environment.
+func DefaultGate() *Gate {
+	defaultGateOnce.Do(func() {
+		defaultGate = NewGate(Default())
+	})
+	return defaultGate
+}
+
+func Register(dependency Dependency) {
+	DefaultGate().Register(dependency)
+}
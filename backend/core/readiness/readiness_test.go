@@ -0,0 +1,92 @@
+package readiness
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestWarmUpWaitsForRequiredDependencies(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	gate := NewGate(Config{Timeout: time.Second, RetryInterval: 10 * time.Millisecond})
+	var postgresAttempts atomic.Int32
+	gate.Register(Dependency{Name: "postgres", Check: func(context.Context) error {
+		if postgresAttempts.Add(1) < 3 {
+			return errors.New("connection refused")
+		}
+		return nil
+	}})
+	gate.Register(Dependency{Name: "ragflow", Optional: true, Timeout: 50 * time.Millisecond, Check: func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	}})
+	if gate.Ready() {
+		t.Fatal("expected the gate not to be ready before the warm-up")
+	}
+
+	if err := gate.WarmUp(ctx); err != nil {
+		t.Fatal(err)
+	}
+	report := gate.Report()
+	if !report.Ready || report.Dependencies[0].Status != StatusReady || report.Dependencies[0].Attempts != 3 {
+		t.Errorf("expected postgres to be warm after 3 attempts: %+v", report)
+	}
+
+	// the hanging optional dependency is given up on after its timeout
+	deadline := time.Now().Add(time.Second)
+	for !gate.Report().Degraded && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	report = gate.Report()
+	if !report.Ready || !report.Degraded || report.Dependencies[1].Status != StatusUnavailable {
+		t.Errorf("expected ragflow to be unavailable without holding back readiness: %+v", report)
+	}
+}
+
+func TestWarmUpReportsUnavailableDependencies(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	gate := NewGate(Config{
+		Timeout:       time.Minute,
+		Timeouts:      map[string]time.Duration{"kafka": 30 * time.Millisecond},
+		RetryInterval: 10 * time.Millisecond,
+		Optional:      []string{"vault"},
+	})
+	var kafkaUp atomic.Bool
+	gate.Register(Dependency{Name: "kafka", Check: func(context.Context) error {
+		if !kafkaUp.Load() {
+			return errors.New("no brokers")
+		}
+		return nil
+	}})
+	gate.Register(Dependency{Name: "vault", Check: func(context.Context) error {
+		return errors.New("permission denied")
+	}})
+
+	start := time.Now()
+	err := gate.WarmUp(ctx)
+	if err == nil || err.Error() != "kafka: no brokers" {
+		t.Fatalf("expected kafka to be reported unavailable, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("expected the warm-up to give up after the kafka timeout, took %s", elapsed)
+	}
+	if report := gate.Report(); report.Ready || report.Dependencies[0].Status != StatusUnavailable || !report.Dependencies[1].Optional {
+		t.Errorf("unexpected report %+v", report)
+	}
+
+	// unavailable dependencies are still checked, so the gate becomes ready
+	kafkaUp.Store(true)
+	deadline := time.Now().Add(time.Second)
+	for !gate.Ready() && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if !gate.Ready() {
+		t.Errorf("expected the gate to be ready once kafka is up: %+v", gate.Report())
+	}
+}
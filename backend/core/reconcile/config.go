@@ -0,0 +1,45 @@
+package reconcile
+
+import (
+	"os"
+	"time"
+
+	"github.com/spectrumwebco/agent_runtime/backend/core/config/env"
+)
+
+type Config struct {
+	// Interval is the time between passes.
+	Interval time.Duration `json:"interval"`
+	// Timeout bounds a pass.
+	Timeout time.Duration `json:"timeout"`
+	// OrphanGracePeriod is how old a container without a workspace record
+	// must be to be deleted, so containers of workspaces being created are
+	// left alone.
+	OrphanGracePeriod time.Duration `json:"orphan_grace_period"`
+	// Namespace limits the kubernetes driver to one namespace, empty
+	// watches all namespaces.
+	Namespace string `json:"namespace,omitempty"`
+	// DryRun reports drift without fixing it.
+	DryRun bool `json:"dry_run"`
+}
+
+const (
+	DefaultInterval          = time.Minute
+	DefaultTimeout           = 5 * time.Minute
+	DefaultOrphanGracePeriod = 15 * time.Minute
+)
+
+func FromEnv() Config {
+	config := Config{
+		Interval:          DefaultInterval,
+		Timeout:           DefaultTimeout,
+		OrphanGracePeriod: DefaultOrphanGracePeriod,
+		Namespace:         os.Getenv("AGENT_RECONCILE_NAMESPACE"),
+	}
+	read := env.NewReader(reconcileLogger)
+	read.Bool("AGENT_RECONCILE_DRY_RUN", &config.DryRun)
+	read.PositiveDuration("AGENT_RECONCILE_INTERVAL", &config.Interval)
+	read.PositiveDuration("AGENT_RECONCILE_TIMEOUT", &config.Timeout)
+	read.PositiveDuration("AGENT_RECONCILE_ORPHAN_GRACE", &config.OrphanGracePeriod)
+	return config
+}
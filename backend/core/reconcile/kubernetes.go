@@ -0,0 +1,172 @@
+package reconcile
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+const (
+	// CreatedLabel and WorkspaceLabel match the pods created by the kled
+	// kubernetes driver.
+	CreatedLabel   = "kled.sh/created"
+	WorkspaceLabel = "kled.sh/workspace"
+	ContainerName  = "kled"
+	// ExpiresAtLabel holds the unix time after which the pod of a workspace
+	// is deleted, set from the workspace label of the same name.
+	ExpiresAtLabel = "kled.sh/expires-at"
+)
+
+// deleteTimeout bounds the wait for a restarted pod to be gone.
+const deleteTimeout = time.Minute
+
+// KubernetesDriver reconciles the pods of the kled kubernetes driver. Its
+// pods never restart their containers, so a crashed workspace is a Failed
+// pod; restarting it creates the pod again on the same volume.
+type KubernetesDriver struct {
+	client kubernetes.Interface
+	// namespace limits the pod lookup, empty searches all namespaces
+	namespace string
+}
+
+// NewKubernetesDriver uses the in-cluster config and falls back to the
+// default kubeconfig.
+func NewKubernetesDriver(namespace string) (*KubernetesDriver, error) {
+	config, err := rest.InClusterConfig()
+	if errors.Is(err, rest.ErrNotInCluster) {
+		config, err = clientcmd.NewNonInteractiveDeferredLoadingClientConfig(
+			clientcmd.NewDefaultClientConfigLoadingRules(),
+			&clientcmd.ConfigOverrides{},
+		).ClientConfig()
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error loading kubernetes config: %v", err)
+	}
+
+	client, err := kubernetes.NewForConfig(config)
+	if err != nil {
+		return nil, fmt.Errorf("error creating kubernetes client: %v", err)
+	}
+	return NewKubernetesDriverForClient(client, namespace), nil
+}
+
+func NewKubernetesDriverForClient(client kubernetes.Interface, namespace string) *KubernetesDriver {
+	return &KubernetesDriver{client: client, namespace: namespace}
+}
+
+func (d *KubernetesDriver) Containers(ctx context.Context) ([]Container, error) {
+	pods, err := d.client.CoreV1().Pods(d.namespace).List(ctx, metav1.ListOptions{
+		LabelSelector: CreatedLabel + "=true," + WorkspaceLabel,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error listing workspace pods: %v", err)
+	}
+
+	containers := make([]Container, 0, len(pods.Items))
+	for i := range pods.Items {
+		pod := &pods.Items[i]
+		if pod.DeletionTimestamp != nil {
+			continue
+		}
+		state, reason := podState(pod)
+		container := Container{
+			Name:        pod.Name,
+			Namespace:   pod.Namespace,
+			WorkspaceID: pod.Labels[WorkspaceLabel],
+			State:       state,
+			Reason:      reason,
+			CreatedAt:   pod.CreationTimestamp.Time,
+		}
+		if value, ok := pod.Labels[ExpiresAtLabel]; ok {
+			expiresAt, err := strconv.ParseInt(value, 10, 64)
+			if err != nil {
+				reconcileLogger.Printf("Ignoring invalid %s label of pod %s: %q", ExpiresAtLabel, pod.Name, value)
+			} else {
+				container.ExpiresAt = time.Unix(expiresAt, 0)
+			}
+		}
+		containers = append(containers, container)
+	}
+	return containers, nil
+}
+
+func podState(pod *corev1.Pod) (ContainerState, string) {
+	reason := pod.Status.Reason
+	for _, status := range pod.Status.ContainerStatuses {
+		if status.Name == ContainerName && status.State.Terminated != nil {
+			terminated := status.State.Terminated
+			reason = fmt.Sprintf("%s, exit code %d", terminated.Reason, terminated.ExitCode)
+		}
+	}
+
+	switch pod.Status.Phase {
+	case corev1.PodRunning:
+		return ContainerRunning, reason
+	case corev1.PodSucceeded:
+		return ContainerExited, reason
+	case corev1.PodFailed:
+		return ContainerCrashed, reason
+	default:
+		return ContainerPending, reason
+	}
+}
+
+// Restart deletes the pod and creates it again from its spec once it's
+// gone, unbound from its node so it may be scheduled elsewhere.
+func (d *KubernetesDriver) Restart(ctx context.Context, container Container) error {
+	pods := d.client.CoreV1().Pods(container.Namespace)
+	pod, err := pods.Get(ctx, container.Name, metav1.GetOptions{})
+	if err != nil {
+		return fmt.Errorf("error loading pod %s: %v", container.Name, err)
+	}
+
+	replacement := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        pod.Name,
+			Namespace:   pod.Namespace,
+			Labels:      pod.Labels,
+			Annotations: pod.Annotations,
+		},
+		Spec: *pod.Spec.DeepCopy(),
+	}
+	replacement.Spec.NodeName = ""
+
+	if err := d.Delete(ctx, container); err != nil {
+		return err
+	}
+	err = wait.PollUntilContextTimeout(ctx, time.Second, deleteTimeout, true, func(ctx context.Context) (bool, error) {
+		_, err := pods.Get(ctx, container.Name, metav1.GetOptions{})
+		if apierrors.IsNotFound(err) {
+			return true, nil
+		}
+		return false, err
+	})
+	if err != nil {
+		return fmt.Errorf("error waiting for pod %s to be deleted: %v", container.Name, err)
+	}
+	if _, err := pods.Create(ctx, replacement, metav1.CreateOptions{}); err != nil {
+		return fmt.Errorf("error creating pod %s: %v", container.Name, err)
+	}
+	return nil
+}
+
+// Delete deletes the pod and keeps the volume of the workspace.
+func (d *KubernetesDriver) Delete(ctx context.Context, container Container) error {
+	err := d.client.CoreV1().Pods(container.Namespace).Delete(ctx, container.Name, metav1.DeleteOptions{
+		GracePeriodSeconds: &[]int64{10}[0],
+	})
+	if err != nil && !apierrors.IsNotFound(err) {
+		return fmt.Errorf("error deleting pod %s: %v", container.Name, err)
+	}
+	return nil
+}
@@ -0,0 +1,299 @@
+// Package reconcile converges workspace containers on the state recorded for
+// their workspaces.
+//
+// The desired state of a workspace is the desired_state column of
+// app_workspace: running, stopped, or NULL for workspaces the reconciler
+// doesn't manage. The actual state is what the Driver reports for the
+// containers carrying the kled labels. Every pass fixes four kinds of drift:
+//
+//   - a container whose ExpiresAtLabel has passed is deleted, e.g. the one of
+//     a preview environment whose CLI went away before its TTL ended
+//   - a crashed container of a workspace that should run is restarted
+//   - a container of a workspace that should be stopped is deleted, like
+//     stopping it with the driver does
+//   - a container without a workspace record is an orphan and deleted, once
+//     it is older than the grace period covering workspaces being created
+//
+// The reconciler doesn't provision: a workspace without a container is left
+// to whoever creates it. Each fix emits a workspace.reconciled event, and a
+// deleted container returns the quota slot its workspace held. Only one
+// replica may reconcile at a time: the one leading the election named
+// ElectionName.
+package reconcile
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/spectrumwebco/agent_runtime/backend/core/events"
+)
+
+var reconcileLogger = log.New(os.Stdout, "kled.reconcile: ", log.LstdFlags)
+
+var (
+	reconcilePasses = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "kled_reconcile_passes_total",
+		Help: "Reconciliation passes, by outcome: completed or failed.",
+	}, []string{"outcome"})
+	reconcileActions = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "kled_reconcile_actions_total",
+		Help: "Drift fixed by the reconciler, by action and outcome.",
+	}, []string{"action", "outcome"})
+	reconcileDrift = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "kled_reconcile_drift",
+		Help: "Drift found by the last reconciliation pass, by kind.",
+	}, []string{"drift"})
+)
+
+func init() {
+	prometheus.MustRegister(reconcilePasses, reconcileActions, reconcileDrift)
+}
+
+type DesiredState string
+
+const (
+	DesiredRunning DesiredState = "running"
+	DesiredStopped DesiredState = "stopped"
+)
+
+// Workspace is the record of a workspace. An empty Desired means the
+// workspace isn't managed; its containers are only kept from being orphans.
+type Workspace struct {
+	ID             string
+	Name           string
+	OrganizationID string
+	Desired        DesiredState
+}
+
+type ContainerState string
+
+const (
+	ContainerPending ContainerState = "pending"
+	ContainerRunning ContainerState = "running"
+	// ContainerExited is a container that stopped on its own, ContainerCrashed
+	// one that failed.
+	ContainerExited  ContainerState = "exited"
+	ContainerCrashed ContainerState = "crashed"
+)
+
+// Container is a workspace container as the driver reports it.
+type Container struct {
+	Name        string
+	Namespace   string
+	WorkspaceID string
+	State       ContainerState
+	// Reason explains the state, e.g. the exit code of a crash.
+	Reason    string
+	CreatedAt time.Time
+	// ExpiresAt is when the container is deleted, zero if it doesn't expire.
+	ExpiresAt time.Time
+}
+
+// Driver queries and fixes the containers of workspaces.
+type Driver interface {
+	// Containers returns every container carrying the kled labels.
+	Containers(ctx context.Context) ([]Container, error)
+	// Restart replaces a container that is no longer running with a new one
+	// of the same spec.
+	Restart(ctx context.Context, container Container) error
+	Delete(ctx context.Context, container Container) error
+}
+
+// SlotReleaser returns the concurrent workspace slot of a workspace, such as
+// *quota.Manager.
+type SlotReleaser interface {
+	StopWorkspace(ctx context.Context, workspaceID string) error
+}
+
+// WorkspaceStore lists the records of all workspaces.
+type WorkspaceStore interface {
+	Workspaces(ctx context.Context) ([]Workspace, error)
+}
+
+// DriftKind is a way the actual state differs from the desired one.
+type DriftKind string
+
+const (
+	DriftCrashed  DriftKind = "crashed"
+	DriftStopped  DriftKind = "running_while_stopped"
+	DriftOrphaned DriftKind = "orphaned"
+	DriftExpired  DriftKind = "expired"
+)
+
+type Action string
+
+const (
+	ActionRestart Action = "restart"
+	ActionDelete  Action = "delete"
+)
+
+// Drift is a difference found by a pass and the action fixing it.
+type Drift struct {
+	Kind      DriftKind
+	Action    Action
+	Container Container
+	Workspace *Workspace
+	// Error is set if the action failed.
+	Error string
+}
+
+// Plan compares the workspaces with their containers at now and returns the
+// drift to fix, ordered by container name. Orphans created after
+// orphanedBefore are left alone.
+func Plan(workspaces []Workspace, containers []Container, now, orphanedBefore time.Time) []Drift {
+	records := make(map[string]*Workspace, len(workspaces))
+	for i := range workspaces {
+		records[workspaces[i].ID] = &workspaces[i]
+	}
+
+	var drift []Drift
+	for _, container := range containers {
+		workspace, ok := records[container.WorkspaceID]
+		switch {
+		case !container.ExpiresAt.IsZero() && !now.Before(container.ExpiresAt):
+			drift = append(drift, Drift{Kind: DriftExpired, Action: ActionDelete, Container: container, Workspace: workspace})
+		case !ok:
+			if container.CreatedAt.Before(orphanedBefore) {
+				drift = append(drift, Drift{Kind: DriftOrphaned, Action: ActionDelete, Container: container})
+			}
+		case workspace.Desired == DesiredRunning && container.State == ContainerCrashed:
+			drift = append(drift, Drift{Kind: DriftCrashed, Action: ActionRestart, Container: container, Workspace: workspace})
+		case workspace.Desired == DesiredStopped && (container.State == ContainerRunning || container.State == ContainerPending):
+			drift = append(drift, Drift{Kind: DriftStopped, Action: ActionDelete, Container: container, Workspace: workspace})
+		}
+	}
+	sort.Slice(drift, func(i, j int) bool {
+		return drift[i].Container.Name < drift[j].Container.Name
+	})
+	return drift
+}
+
+// ElectionName is the leader election of the reconcilers.
+const ElectionName = "reconciler"
+
+type Reconciler struct {
+	workspaces WorkspaceStore
+	driver     Driver
+	slots      SlotReleaser
+	config     Config
+	now        func() time.Time
+}
+
+func NewReconciler(workspaces WorkspaceStore, driver Driver, config Config) *Reconciler {
+	return &Reconciler{
+		workspaces: workspaces,
+		driver:     driver,
+		config:     config,
+		now:        time.Now,
+	}
+}
+
+func (r *Reconciler) SetClock(now func() time.Time) {
+	r.now = now
+}
+
+// SetSlots returns the slots of workspaces whose containers are deleted to
+// slots.
+func (r *Reconciler) SetSlots(slots SlotReleaser) {
+	r.slots = slots
+}
+
+// Reconcile runs one pass and returns the drift it found. In dry run mode
+// the drift is only reported.
+func (r *Reconciler) Reconcile(ctx context.Context) ([]Drift, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.config.Timeout)
+	defer cancel()
+
+	workspaces, err := r.workspaces.Workspaces(ctx)
+	if err != nil {
+		reconcilePasses.WithLabelValues("failed").Inc()
+		return nil, fmt.Errorf("error loading workspaces: %v", err)
+	}
+	containers, err := r.driver.Containers(ctx)
+	if err != nil {
+		reconcilePasses.WithLabelValues("failed").Inc()
+		return nil, fmt.Errorf("error listing workspace containers: %v", err)
+	}
+
+	now := r.now()
+	drift := Plan(workspaces, containers, now, now.Add(-r.config.OrphanGracePeriod))
+	counts := map[DriftKind]float64{DriftCrashed: 0, DriftStopped: 0, DriftOrphaned: 0, DriftExpired: 0}
+	for i := range drift {
+		counts[drift[i].Kind]++
+		if r.config.DryRun {
+			reconcileActions.WithLabelValues(string(drift[i].Action), "dry_run").Inc()
+			reconcileLogger.Printf("Would %s %s container %s", drift[i].Action, drift[i].Kind, drift[i].Container.Name)
+			continue
+		}
+		r.fix(ctx, &drift[i])
+	}
+	for kind, count := range counts {
+		reconcileDrift.WithLabelValues(string(kind)).Set(count)
+	}
+	reconcilePasses.WithLabelValues("completed").Inc()
+	return drift, nil
+}
+
+func (r *Reconciler) fix(ctx context.Context, drift *Drift) {
+	var err error
+	switch drift.Action {
+	case ActionRestart:
+		err = r.driver.Restart(ctx, drift.Container)
+	case ActionDelete:
+		err = r.driver.Delete(ctx, drift.Container)
+	}
+
+	outcome := "ok"
+	if err != nil {
+		outcome = "failed"
+		drift.Error = err.Error()
+		reconcileLogger.Printf("Error fixing %s container %s: %v", drift.Kind, drift.Container.Name, err)
+	} else {
+		reconcileLogger.Printf("Fixed %s container %s: %s", drift.Kind, drift.Container.Name, drift.Action)
+		if drift.Action == ActionDelete && r.slots != nil && drift.Container.WorkspaceID != "" {
+			if err := r.slots.StopWorkspace(ctx, drift.Container.WorkspaceID); err != nil {
+				reconcileLogger.Printf("Error releasing the slot of workspace %s: %v", drift.Container.WorkspaceID, err)
+			}
+		}
+	}
+	reconcileActions.WithLabelValues(string(drift.Action), outcome).Inc()
+
+	event := events.NewWorkspaceEvent(ctx, events.WorkspaceReconciled, drift.Container.WorkspaceID)
+	if drift.Workspace != nil {
+		event.WorkspaceName = drift.Workspace.Name
+		event.OrganizationID = drift.Workspace.OrganizationID
+	}
+	event.Error = drift.Error
+	event.Attributes = map[string]string{
+		"drift":           string(drift.Kind),
+		"action":          string(drift.Action),
+		"container":       drift.Container.Name,
+		"container_state": string(drift.Container.State),
+	}
+	if drift.Container.Reason != "" {
+		event.Attributes["reason"] = drift.Container.Reason
+	}
+	events.Emit(ctx, event)
+}
+
+// Run runs a pass every interval until ctx is done.
+func (r *Reconciler) Run(ctx context.Context) {
+	ticker := time.NewTicker(r.config.Interval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := r.Reconcile(ctx); err != nil {
+			reconcileLogger.Printf("Error reconciling workspaces: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
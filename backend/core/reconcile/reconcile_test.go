@@ -0,0 +1,148 @@
+package reconcile
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/spectrumwebco/agent_runtime/backend/core/events"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+type fakeDriver struct {
+	containers []Container
+	restarted  []string
+	deleted    []string
+	err        error
+}
+
+func (d *fakeDriver) Containers(ctx context.Context) ([]Container, error) {
+	return d.containers, nil
+}
+
+func (d *fakeDriver) Restart(ctx context.Context, container Container) error {
+	d.restarted = append(d.restarted, container.Name)
+	return d.err
+}
+
+func (d *fakeDriver) Delete(ctx context.Context, container Container) error {
+	d.deleted = append(d.deleted, container.Name)
+	return d.err
+}
+
+type workspaceList []Workspace
+
+func (l workspaceList) Workspaces(ctx context.Context) ([]Workspace, error) {
+	return l, nil
+}
+
+type releasedSlots []string
+
+func (s *releasedSlots) StopWorkspace(ctx context.Context, workspaceID string) error {
+	*s = append(*s, workspaceID)
+	return nil
+}
+
+type recordingPublisher []events.WorkspaceEvent
+
+func (p *recordingPublisher) Publish(ctx context.Context, event events.WorkspaceEvent) error {
+	*p = append(*p, event)
+	return nil
+}
+
+func TestReconcileFixesDrift(t *testing.T) {
+	now := time.Now()
+	workspaces := workspaceList{
+		{ID: "ws-1", Name: "api", Desired: DesiredRunning},
+		{ID: "ws-2", Desired: DesiredStopped},
+		{ID: "ws-3"},
+	}
+	driver := &fakeDriver{containers: []Container{
+		{Name: "kled-ws-1", WorkspaceID: "ws-1", State: ContainerCrashed, Reason: "Error, exit code 137", CreatedAt: now},
+		{Name: "kled-ws-2", WorkspaceID: "ws-2", State: ContainerRunning, CreatedAt: now},
+		// unmanaged workspaces are left as they are
+		{Name: "kled-ws-3", WorkspaceID: "ws-3", State: ContainerCrashed, CreatedAt: now},
+		{Name: "kled-gone", WorkspaceID: "gone", State: ContainerRunning, CreatedAt: now.Add(-time.Hour)},
+		// young orphans may belong to workspaces being created
+		{Name: "kled-new", WorkspaceID: "new", State: ContainerPending, CreatedAt: now.Add(-time.Minute)},
+		// expired containers are deleted even if they are young or managed
+		{Name: "kled-preview", WorkspaceID: "preview", State: ContainerRunning, CreatedAt: now.Add(-time.Minute), ExpiresAt: now},
+		{Name: "kled-ws-1-preview", WorkspaceID: "ws-1", State: ContainerRunning, CreatedAt: now, ExpiresAt: now.Add(time.Hour)},
+	}}
+
+	publisher := &recordingPublisher{}
+	events.SetPublisher(publisher)
+	defer events.SetPublisher(nil)
+
+	reconciler := NewReconciler(workspaces, driver, Config{Timeout: time.Minute, OrphanGracePeriod: 15 * time.Minute})
+	reconciler.SetClock(func() time.Time { return now })
+	released := &releasedSlots{}
+	reconciler.SetSlots(released)
+	drift, err := reconciler.Reconcile(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(drift) != 4 || drift[0].Kind != DriftOrphaned || drift[1].Kind != DriftExpired || drift[2].Kind != DriftCrashed || drift[3].Kind != DriftStopped {
+		t.Fatalf("unexpected drift %+v", drift)
+	}
+	if len(driver.restarted) != 1 || driver.restarted[0] != "kled-ws-1" {
+		t.Errorf("expected the crashed container to be restarted, got %v", driver.restarted)
+	}
+	if len(driver.deleted) != 3 || driver.deleted[0] != "kled-gone" || driver.deleted[1] != "kled-preview" || driver.deleted[2] != "kled-ws-2" {
+		t.Errorf("expected the orphan, the expired and the stopped container to be deleted, got %v", driver.deleted)
+	}
+	if len(*released) != 3 || (*released)[0] != "gone" || (*released)[1] != "preview" || (*released)[2] != "ws-2" {
+		t.Errorf("expected the slots of the deleted containers to be released, got %v", *released)
+	}
+
+	if len(*publisher) != 4 {
+		t.Fatalf("expected an event per fix, got %+v", *publisher)
+	}
+	event := (*publisher)[2]
+	if event.Type != events.WorkspaceReconciled || event.WorkspaceID != "ws-1" || event.WorkspaceName != "api" ||
+		event.Attributes["action"] != "restart" || event.Attributes["reason"] != "Error, exit code 137" {
+		t.Errorf("unexpected event %+v", event)
+	}
+}
+
+func TestKubernetesDriverRestartsFailedPods(t *testing.T) {
+	ctx := context.Background()
+	client := fake.NewSimpleClientset(&corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "kled-ws-1",
+			Namespace: "kled",
+			Labels:    map[string]string{CreatedLabel: "true", WorkspaceLabel: "ws-1", ExpiresAtLabel: "1767225600"},
+		},
+		Spec: corev1.PodSpec{NodeName: "node-a", Containers: []corev1.Container{{Name: ContainerName}}},
+		Status: corev1.PodStatus{
+			Phase: corev1.PodFailed,
+			ContainerStatuses: []corev1.ContainerStatus{{
+				Name:  ContainerName,
+				State: corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{Reason: "OOMKilled", ExitCode: 137}},
+			}},
+		},
+	})
+	driver := NewKubernetesDriverForClient(client, "")
+
+	containers, err := driver.Containers(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(containers) != 1 || containers[0].State != ContainerCrashed || containers[0].Reason != "OOMKilled, exit code 137" ||
+		!containers[0].ExpiresAt.Equal(time.Unix(1767225600, 0)) {
+		t.Fatalf("unexpected containers %+v", containers)
+	}
+	if err := driver.Restart(ctx, containers[0]); err != nil {
+		t.Fatal(err)
+	}
+
+	pod, err := client.CoreV1().Pods("kled").Get(ctx, "kled-ws-1", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pod.Status.Phase != "" || pod.Spec.NodeName != "" || pod.Labels[WorkspaceLabel] != "ws-1" {
+		t.Errorf("expected a new unscheduled pod, got %+v", pod)
+	}
+}
@@ -0,0 +1,68 @@
+package reconcile
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/spectrumwebco/agent_runtime/backend/db/integrations"
+)
+
+// SQLStore reads the desired state of workspaces from app_workspace.
+type SQLStore struct {
+	store integrations.SQLStore
+}
+
+func NewSQLStore(store integrations.SQLStore) *SQLStore {
+	return &SQLStore{store: store}
+}
+
+// EnsureSchema adds the desired_state column. Existing workspaces are left
+// unmanaged.
+func (s *SQLStore) EnsureSchema() error {
+	_, err := s.store.ExecuteUpdate(`
+		ALTER TABLE app_workspace ADD COLUMN IF NOT EXISTS desired_state VARCHAR(32)
+			CHECK (desired_state IN ('running', 'stopped'));
+	`)
+	if err != nil {
+		return fmt.Errorf("error creating reconciler schema: %v", err)
+	}
+	return nil
+}
+
+func (s *SQLStore) Workspaces(ctx context.Context) ([]Workspace, error) {
+	rows, err := s.store.ExecuteQuery(`SELECT id, name, organization_id, desired_state FROM app_workspace`)
+	if err != nil {
+		return nil, err
+	}
+
+	workspaces := make([]Workspace, 0, len(rows))
+	for _, row := range rows {
+		workspace := Workspace{
+			ID:             fmt.Sprint(row["id"]),
+			Name:           fmt.Sprint(row["name"]),
+			OrganizationID: fmt.Sprint(row["organization_id"]),
+		}
+		if desired, ok := row["desired_state"].(string); ok {
+			workspace.Desired = DesiredState(desired)
+		}
+		workspaces = append(workspaces, workspace)
+	}
+	return workspaces, nil
+}
+
+// SetDesired records the desired state of a workspace, or stops managing
+// it for an empty state.
+func (s *SQLStore) SetDesired(ctx context.Context, workspaceID string, desired DesiredState) error {
+	var value interface{}
+	if desired != "" {
+		value = string(desired)
+	}
+	affected, err := s.store.ExecuteUpdate(`UPDATE app_workspace SET desired_state = $1, updated_at = now() WHERE id = $2`, value, workspaceID)
+	if err != nil {
+		return fmt.Errorf("error updating workspace %s: %v", workspaceID, err)
+	}
+	if affected == 0 {
+		return fmt.Errorf("workspace %s not found", workspaceID)
+	}
+	return nil
+}
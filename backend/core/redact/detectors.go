@@ -0,0 +1,87 @@
+package redact
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"regexp"
+)
+
+var redactLogger = log.New(os.Stdout, "kled.redact: ", log.LstdFlags)
+
+const (
+	DetectorEmail      = "email"
+	DetectorAPIKey     = "api_key"
+	DetectorCreditCard = "credit_card"
+)
+
+// Detector finds one kind of sensitive value. Validate, if set, rejects
+// pattern matches that aren't really sensitive.
+type Detector struct {
+	Name     string
+	Pattern  *regexp.Regexp
+	Validate func(match string) bool
+}
+
+var builtinDetectors = map[string]*Detector{
+	DetectorEmail: {
+		Name:    DetectorEmail,
+		Pattern: regexp.MustCompile(`[A-Za-z0-9._%+-]+@[A-Za-z0-9-]+(?:\.[A-Za-z0-9-]+)*\.[A-Za-z]{2,}`),
+	},
+	// API keys are only recognized by the prefixes of well-known providers;
+	// anything else needs a custom pattern.
+	DetectorAPIKey: {
+		Name: DetectorAPIKey,
+		Pattern: regexp.MustCompile(`\b(?:` +
+			`sk-[A-Za-z0-9_-]{20,}|` +
+			`gh[pousr]_[A-Za-z0-9]{36,}|` +
+			`github_pat_[A-Za-z0-9_]{22,}|` +
+			`(?:AKIA|ASIA)[0-9A-Z]{16}|` +
+			`xox[abposr]-[A-Za-z0-9-]{10,}|` +
+			`AIza[0-9A-Za-z_-]{35}|` +
+			`glpat-[A-Za-z0-9_-]{20,}` +
+			`)`),
+	},
+	DetectorCreditCard: {
+		Name:     DetectorCreditCard,
+		Pattern:  regexp.MustCompile(`\b(?:\d[ -]?){12,18}\d\b`),
+		Validate: luhnValid,
+	},
+}
+
+// NewRegexDetector returns a custom detector replacing every match of
+// pattern.
+func NewRegexDetector(name, pattern string) (*Detector, error) {
+	if name == "" {
+		return nil, fmt.Errorf("custom detector has no name")
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("invalid pattern for detector %q: %v", name, err)
+	}
+	return &Detector{Name: name, Pattern: re}, nil
+}
+
+// luhnValid reports whether the digits of s pass the Luhn checksum, which
+// rules out most numbers that merely look like card numbers.
+func luhnValid(s string) bool {
+	sum, digits := 0, 0
+	double := false
+	for i := len(s) - 1; i >= 0; i-- {
+		c := s[i]
+		if c < '0' || c > '9' {
+			continue
+		}
+		d := int(c - '0')
+		if double {
+			d *= 2
+			if d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+		double = !double
+		digits++
+	}
+	return digits >= 13 && digits <= 19 && sum%10 == 0
+}
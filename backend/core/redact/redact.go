@@ -0,0 +1,233 @@
+// Package redact removes personal data and secrets from agent data before it
+// is persisted.
+//
+// Every match of a detector is replaced with a token such as
+// "<redacted:email:3f9a0c1d2e4b>", whose suffix is a keyed hash of the
+// original value. The same value always yields the same token, so redacted
+// records can still be joined and counted by it, but the value can't be
+// recovered without the key.
+//
+// The configuration is read from the AGENT_REDACTION_ENABLED,
+// AGENT_REDACTION_DETECTORS, AGENT_REDACTION_PATTERNS and
+// AGENT_REDACTION_HASH_KEY settings. The hash key falls back to
+// AGENT_SECRET_KEY.
+package redact
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/spectrumwebco/agent_runtime/backend/core/config/env"
+)
+
+// Source names the kind of data being redacted, for metrics.
+type Source string
+
+const (
+	SourceTrajectory   Source = "trajectory"
+	SourceStateHistory Source = "state_history"
+)
+
+var redactionsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "kled_redactions_total",
+	Help: "Values replaced by the redaction pipeline, by detector and source.",
+}, []string{"detector", "source"})
+
+func init() {
+	prometheus.MustRegister(redactionsTotal)
+}
+
+type Config struct {
+	Enabled bool `json:"enabled"`
+	// Detectors lists the built-in detectors to run.
+	Detectors []string `json:"detectors"`
+	// Patterns maps the names of custom detectors to their regular
+	// expressions.
+	Patterns map[string]string `json:"patterns"`
+	HashKey  string            `json:"-"`
+}
+
+var (
+	defaultRedactor     *Redactor
+	defaultRedactorOnce sync.Once
+)
+
+// Default returns the redactor configured for the process. An invalid
+// configuration is logged and disables redaction of the affected detectors
+// rather than failing writes.
+func Default() *Redactor {
+	defaultRedactorOnce.Do(func() {
+		r, err := New(FromEnv())
+		if err != nil {
+			redactLogger.Printf("Invalid redaction configuration: %v", err)
+		}
+		defaultRedactor = r
+	})
+	return defaultRedactor
+}
+
+func FromEnv() Config {
+	config := Config{
+		Enabled:   true,
+		Detectors: []string{DetectorEmail, DetectorAPIKey, DetectorCreditCard},
+		HashKey:   os.Getenv("AGENT_REDACTION_HASH_KEY"),
+	}
+	read := env.NewReader(redactLogger)
+	read.Bool("AGENT_REDACTION_ENABLED", &config.Enabled)
+	if detectors := read.List("AGENT_REDACTION_DETECTORS"); detectors != nil {
+		config.Detectors = detectors
+	}
+	if patterns := os.Getenv("AGENT_REDACTION_PATTERNS"); patterns != "" {
+		if err := json.Unmarshal([]byte(patterns), &config.Patterns); err != nil {
+			redactLogger.Printf("AGENT_REDACTION_PATTERNS must be a JSON object of names to patterns: %v", err)
+		}
+	}
+	if config.HashKey == "" {
+		config.HashKey = os.Getenv("AGENT_SECRET_KEY")
+	}
+	return config
+}
+
+// Variables returns the variables FromEnv reads c from. The hash key is always
+// set, so it no longer follows AGENT_SECRET_KEY.
+func (c Config) Variables() map[string]string {
+	patterns := ""
+	if len(c.Patterns) > 0 {
+		out, _ := json.Marshal(c.Patterns)
+		patterns = string(out)
+	}
+	return map[string]string{
+		"AGENT_REDACTION_ENABLED":   strconv.FormatBool(c.Enabled),
+		"AGENT_REDACTION_DETECTORS": strings.Join(c.Detectors, ","),
+		"AGENT_REDACTION_PATTERNS":  patterns,
+		"AGENT_REDACTION_HASH_KEY":  c.HashKey,
+	}
+}
+
+// Redactor applies detectors to values. A nil Redactor leaves values
+// unchanged.
+type Redactor struct {
+	detectors []*Detector
+	key       []byte
+}
+
+// New builds a redactor from config. On error it still returns a redactor
+// with every valid detector.
+func New(config Config) (*Redactor, error) {
+	r := &Redactor{key: []byte(config.HashKey)}
+	if !config.Enabled {
+		return r, nil
+	}
+
+	var errs []string
+	for _, name := range config.Detectors {
+		detector, ok := builtinDetectors[name]
+		if !ok {
+			errs = append(errs, fmt.Sprintf("unknown detector %q", name))
+			continue
+		}
+		r.detectors = append(r.detectors, detector)
+	}
+
+	names := make([]string, 0, len(config.Patterns))
+	for name := range config.Patterns {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		detector, err := NewRegexDetector(name, config.Patterns[name])
+		if err != nil {
+			errs = append(errs, err.Error())
+			continue
+		}
+		r.detectors = append(r.detectors, detector)
+	}
+
+	if len(errs) > 0 {
+		return r, fmt.Errorf("%s", strings.Join(errs, "; "))
+	}
+	return r, nil
+}
+
+func (r *Redactor) token(detector, value string) string {
+	mac := hmac.New(sha256.New, r.key)
+	mac.Write([]byte(detector))
+	mac.Write([]byte{0})
+	mac.Write([]byte(value))
+	return "<redacted:" + detector + ":" + hex.EncodeToString(mac.Sum(nil))[:12] + ">"
+}
+
+// Redact replaces every detected value in s.
+func (r *Redactor) Redact(source Source, s string) string {
+	if r == nil {
+		return s
+	}
+
+	for _, detector := range r.detectors {
+		count := 0
+		s = detector.Pattern.ReplaceAllStringFunc(s, func(match string) string {
+			if detector.Validate != nil && !detector.Validate(match) {
+				return match
+			}
+			count++
+			return r.token(detector.Name, match)
+		})
+		if count > 0 {
+			redactionsTotal.WithLabelValues(detector.Name, string(source)).Add(float64(count))
+		}
+	}
+	return s
+}
+
+// RedactValue returns a copy of value with every string redacted, recursing
+// into maps and slices as produced by encoding/json. Map keys are kept.
+func (r *Redactor) RedactValue(source Source, value interface{}) interface{} {
+	if r == nil {
+		return value
+	}
+
+	switch v := value.(type) {
+	case string:
+		return r.Redact(source, v)
+	case []byte:
+		return []byte(r.Redact(source, string(v)))
+	case map[string]interface{}:
+		return r.RedactMap(source, v)
+	case []interface{}:
+		redacted := make([]interface{}, len(v))
+		for i, item := range v {
+			redacted[i] = r.RedactValue(source, item)
+		}
+		return redacted
+	case []string:
+		redacted := make([]string, len(v))
+		for i, item := range v {
+			redacted[i] = r.Redact(source, item)
+		}
+		return redacted
+	default:
+		return value
+	}
+}
+
+// RedactMap is RedactValue for maps.
+func (r *Redactor) RedactMap(source Source, m map[string]interface{}) map[string]interface{} {
+	if r == nil || m == nil {
+		return m
+	}
+
+	redacted := make(map[string]interface{}, len(m))
+	for key, value := range m {
+		redacted[key] = r.RedactValue(source, value)
+	}
+	return redacted
+}
@@ -0,0 +1,41 @@
+package redact
+
+import (
+	"strings"
+
+	"github.com/spectrumwebco/agent_runtime/backend/db/integrations"
+)
+
+// sqlStore redacts the string parameters of INSERT and UPDATE statements.
+// The statements themselves are left alone, so values must be passed as
+// parameters to be redacted.
+type sqlStore struct {
+	inner    integrations.SQLStore
+	redactor *Redactor
+	source   Source
+}
+
+func NewSQLStore(inner integrations.SQLStore, redactor *Redactor, source Source) integrations.SQLStore {
+	return &sqlStore{inner: inner, redactor: redactor, source: source}
+}
+
+func (s *sqlStore) params(query string, params []interface{}) []interface{} {
+	statement := strings.ToUpper(strings.TrimSpace(query))
+	if !strings.HasPrefix(statement, "INSERT") && !strings.HasPrefix(statement, "UPDATE") {
+		return params
+	}
+
+	redacted := make([]interface{}, len(params))
+	for i, param := range params {
+		redacted[i] = s.redactor.RedactValue(s.source, param)
+	}
+	return redacted
+}
+
+func (s *sqlStore) ExecuteQuery(query string, params ...interface{}) ([]map[string]interface{}, error) {
+	return s.inner.ExecuteQuery(query, s.params(query, params)...)
+}
+
+func (s *sqlStore) ExecuteUpdate(query string, params ...interface{}) (int64, error) {
+	return s.inner.ExecuteUpdate(query, s.params(query, params)...)
+}
@@ -0,0 +1,90 @@
+package rerank
+
+import (
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/spectrumwebco/agent_runtime/backend/core/config/env"
+	"github.com/spectrumwebco/agent_runtime/backend/core/llm"
+)
+
+// The names rerankers are registered and selected by. RerankerNone disables
+// reranking for a query.
+const (
+	RerankerNone    = "none"
+	RerankerGateway = "gateway"
+	RerankerONNX    = "onnx"
+)
+
+type Config struct {
+	// Reranker is the reranker of queries that don't choose one, none to
+	// keep the vector order.
+	Reranker string `json:"reranker"`
+	// Model is the gateway model alias of the gateway reranker.
+	Model string `json:"model"`
+	// ONNXModelDir holds the model.onnx and tokenizer.json of a
+	// cross-encoder. The onnx reranker is only available with one.
+	ONNXModelDir  string `json:"onnx_model_dir,omitempty"`
+	ONNXMaxLength int    `json:"onnx_max_length"`
+	// Budget is how long a search waits for the reranker before it keeps
+	// the vector order.
+	Budget time.Duration `json:"budget"`
+	// Candidates is how many results are fetched for the reranker to
+	// choose the top results from.
+	Candidates int `json:"candidates"`
+}
+
+const (
+	DefaultModel         = "rerank"
+	DefaultONNXMaxLength = 512
+	DefaultBudget        = 500 * time.Millisecond
+	DefaultCandidates    = 50
+)
+
+var Default = env.Once(FromEnv)
+
+// FromEnv keeps the vector order unless AGENT_RERANK_RERANKER picks a
+// reranker. The onnx reranker also needs AGENT_RERANK_ONNX_MODEL_DIR.
+func FromEnv() Config {
+	config := Config{
+		Reranker:      RerankerNone,
+		Model:         DefaultModel,
+		ONNXModelDir:  os.Getenv("AGENT_RERANK_ONNX_MODEL_DIR"),
+		ONNXMaxLength: DefaultONNXMaxLength,
+		Budget:        DefaultBudget,
+		Candidates:    DefaultCandidates,
+	}
+	read := env.NewReader(rerankLogger)
+	read.String("AGENT_RERANK_MODEL", &config.Model)
+	read.OneOf("AGENT_RERANK_RERANKER", &config.Reranker, RerankerNone, RerankerGateway, RerankerONNX)
+	if config.Reranker == RerankerONNX && config.ONNXModelDir == "" {
+		rerankLogger.Printf("AGENT_RERANK_ONNX_MODEL_DIR is required for the onnx reranker, not reranking")
+		config.Reranker = RerankerNone
+	}
+	read.Int("AGENT_RERANK_ONNX_MAX_LENGTH", &config.ONNXMaxLength, 1)
+	read.PositiveDuration("AGENT_RERANK_BUDGET", &config.Budget)
+	read.Int("AGENT_RERANK_CANDIDATES", &config.Candidates, 1)
+	return config
+}
+
+// Variables returns the variables FromEnv reads c from.
+func (c Config) Variables() map[string]string {
+	return map[string]string{
+		"AGENT_RERANK_RERANKER":        c.Reranker,
+		"AGENT_RERANK_MODEL":           c.Model,
+		"AGENT_RERANK_ONNX_MODEL_DIR":  c.ONNXModelDir,
+		"AGENT_RERANK_ONNX_MAX_LENGTH": strconv.Itoa(c.ONNXMaxLength),
+		"AGENT_RERANK_BUDGET":          c.Budget.String(),
+		"AGENT_RERANK_CANDIDATES":      strconv.Itoa(c.Candidates),
+	}
+}
+
+// ConfigureDefault registers the rerankers of a configuration: the gateway
+// reranker, and the onnx reranker if a model directory is set.
+func ConfigureDefault(config Config, gateway *llm.Gateway) {
+	Register(NewGatewayReranker(gateway, config.Model))
+	if config.ONNXModelDir != "" {
+		Register(NewONNXReranker(config.ONNXModelDir, config.ONNXMaxLength))
+	}
+}
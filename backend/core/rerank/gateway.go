@@ -0,0 +1,82 @@
+package rerank
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/spectrumwebco/agent_runtime/backend/core/llm"
+	"github.com/spectrumwebco/agent_runtime/backend/core/tenancy"
+)
+
+const gatewayPrompt = `You grade how relevant passages are to a search query. ` +
+	`Answer with a JSON array holding one number from 0 to 10 per passage, in the order of the passages, and nothing else.`
+
+// maxPassageLength bounds the characters of each passage sent to the
+// gateway, so the prompt stays within the context of small models.
+const maxPassageLength = 2000
+
+// GatewayReranker asks a chat model of the LLM gateway to grade all
+// candidates in one call, which accounts the tokens to the tenant. A nil
+// gateway is the default gateway at the time of the call.
+type GatewayReranker struct {
+	gateway *llm.Gateway
+	model   string
+}
+
+func NewGatewayReranker(gateway *llm.Gateway, model string) *GatewayReranker {
+	return &GatewayReranker{gateway: gateway, model: model}
+}
+
+func (r *GatewayReranker) Name() string {
+	return RerankerGateway
+}
+
+func (r *GatewayReranker) Score(ctx context.Context, tenant tenancy.Tenant, query string, texts []string) ([]float64, error) {
+	gateway := r.gateway
+	if gateway == nil {
+		gateway = llm.DefaultGateway()
+	}
+	if gateway == nil {
+		return nil, fmt.Errorf("the LLM gateway is not configured")
+	}
+
+	var prompt strings.Builder
+	fmt.Fprintf(&prompt, "Query: %s\n", query)
+	for i, text := range texts {
+		if len(text) > maxPassageLength {
+			text = text[:maxPassageLength]
+		}
+		fmt.Fprintf(&prompt, "\n[%d] %s\n", i+1, text)
+	}
+
+	temperature := 0.0
+	response, err := gateway.Chat(ctx, tenant, llm.ChatRequest{
+		Model: r.model,
+		Messages: []llm.Message{
+			{Role: llm.RoleSystem, Content: gatewayPrompt},
+			{Role: llm.RoleUser, Content: prompt.String()},
+		},
+		MaxTokens:   8 * len(texts),
+		Temperature: &temperature,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return parseScores(response.Content)
+}
+
+// parseScores reads the JSON array of a completion, ignoring text around
+// it.
+func parseScores(content string) ([]float64, error) {
+	start, end := strings.Index(content, "["), strings.LastIndex(content, "]")
+	if start < 0 || end < start {
+		return nil, fmt.Errorf("no scores in completion %q", content)
+	}
+	var scores []float64
+	if err := json.Unmarshal([]byte(content[start:end+1]), &scores); err != nil {
+		return nil, fmt.Errorf("invalid scores in completion %q: %v", content, err)
+	}
+	return scores, nil
+}
@@ -0,0 +1,81 @@
+package rerank
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+
+	"github.com/spectrumwebco/agent_runtime/backend/core/tenancy"
+)
+
+// onnxScript scores the JSON {"query", "texts"} on stdin with the
+// cross-encoder model.onnx and tokenizer.json of the directory in argv[1].
+// Single logit models output the score; for two class models the score is
+// the logit of the relevant class.
+const onnxScript = `
+import json
+import sys
+
+import numpy as np
+import onnxruntime
+from tokenizers import Tokenizer
+
+model_dir, max_length = sys.argv[1], int(sys.argv[2])
+tokenizer = Tokenizer.from_file(model_dir + "/tokenizer.json")
+tokenizer.enable_truncation(max_length)
+tokenizer.enable_padding()
+session = onnxruntime.InferenceSession(model_dir + "/model.onnx", providers=["CPUExecutionProvider"])
+inputs = {i.name for i in session.get_inputs()}
+
+request = json.load(sys.stdin)
+encodings = tokenizer.encode_batch([(request["query"], text) for text in request["texts"]])
+feed = {
+    "input_ids": np.array([e.ids for e in encodings], dtype=np.int64),
+    "attention_mask": np.array([e.attention_mask for e in encodings], dtype=np.int64),
+}
+if "token_type_ids" in inputs:
+    feed["token_type_ids"] = np.array([e.type_ids for e in encodings], dtype=np.int64)
+
+logits = session.run(None, feed)[0]
+json.dump(logits[:, -1].tolist(), sys.stdout)
+`
+
+// ONNXReranker runs a local cross-encoder with onnxruntime in a Python
+// process, so no text leaves the cluster. The directory holds model.onnx
+// and tokenizer.json.
+type ONNXReranker struct {
+	dir       string
+	maxLength int
+}
+
+func NewONNXReranker(dir string, maxLength int) *ONNXReranker {
+	return &ONNXReranker{dir: dir, maxLength: maxLength}
+}
+
+func (r *ONNXReranker) Name() string {
+	return RerankerONNX
+}
+
+func (r *ONNXReranker) Score(ctx context.Context, tenant tenancy.Tenant, query string, texts []string) ([]float64, error) {
+	input, err := json.Marshal(map[string]interface{}{"query": query, "texts": texts})
+	if err != nil {
+		return nil, err
+	}
+
+	cmd := exec.CommandContext(ctx, "python", "-c", onnxScript, r.dir, fmt.Sprint(r.maxLength))
+	cmd.Stdin = bytes.NewReader(input)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("error running ONNX reranker %s: %v: %s", r.dir, err, bytes.TrimSpace(stderr.Bytes()))
+	}
+
+	var scores []float64
+	if err := json.Unmarshal(output, &scores); err != nil {
+		return nil, fmt.Errorf("error decoding ONNX reranker output: %v", err)
+	}
+	return scores, nil
+}
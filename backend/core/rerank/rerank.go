@@ -0,0 +1,195 @@
+// Package rerank reorders vector search results by their relevance to the
+// query.
+//
+// Vector search ranks by the similarity of embeddings, which is fast but
+// coarse. A Reranker scores each candidate against the query with a
+// cross-encoder: a model of the LLM gateway or a local ONNX model. Rerank
+// runs a reranker within a latency budget and keeps the original order when
+// the reranker is too slow or fails, so reranking never fails a search.
+package rerank
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/spectrumwebco/agent_runtime/backend/core/tenancy"
+)
+
+var rerankLogger = log.New(os.Stdout, "kled.rerank: ", log.LstdFlags)
+
+var (
+	rerankTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "kled_rerank_total",
+		Help: "Searches passed to a reranker, by reranker and outcome.",
+	}, []string{"reranker", "outcome"})
+	rerankDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "kled_rerank_duration_seconds",
+		Help:    "Time rerankers took to score the candidates of a search, including timeouts.",
+		Buckets: []float64{.01, .025, .05, .1, .25, .5, 1, 2.5, 5},
+	}, []string{"reranker"})
+)
+
+func init() {
+	prometheus.MustRegister(rerankTotal, rerankDuration)
+}
+
+// Candidate is a search result.
+type Candidate struct {
+	ID string `json:"id"`
+	// Text is what the reranker compares with the query, the "text"
+	// metadata the documents were ingested with.
+	Text     string                 `json:"text,omitempty"`
+	Metadata map[string]interface{} `json:"metadata,omitempty"`
+	// Score is the similarity the vector search ranked the candidate by.
+	Score float64 `json:"score"`
+	// RerankScore is the score of the reranker, set if it ran.
+	RerankScore *float64 `json:"rerank_score,omitempty"`
+}
+
+// FromResults reads the results of VectorStore.Search or SemanticSearch.
+func FromResults(results []map[string]interface{}) []Candidate {
+	candidates := make([]Candidate, 0, len(results))
+	for _, result := range results {
+		candidate := Candidate{ID: fmt.Sprint(result["id"])}
+		if score, ok := result["score"].(float64); ok {
+			candidate.Score = score
+		}
+		if metadata, ok := result["metadata"].(map[string]interface{}); ok {
+			candidate.Metadata = metadata
+			if text, ok := metadata["text"].(string); ok {
+				candidate.Text = text
+			}
+		}
+		candidates = append(candidates, candidate)
+	}
+	return candidates
+}
+
+type Reranker interface {
+	Name() string
+	// Score returns the relevance of each text to the query, in order.
+	// Higher is more relevant; scores are only compared with each other.
+	Score(ctx context.Context, tenant tenancy.Tenant, query string, texts []string) ([]float64, error)
+}
+
+// Outcome is what became of a rerank.
+type Outcome string
+
+const (
+	// OutcomeReranked means the candidates are in the reranker's order.
+	OutcomeReranked Outcome = "reranked"
+	// OutcomeSkipped means there was no reranker or nothing to reorder.
+	OutcomeSkipped Outcome = "skipped"
+	// OutcomeTimeout and OutcomeFailed keep the original order.
+	OutcomeTimeout Outcome = "timeout"
+	OutcomeFailed  Outcome = "failed"
+)
+
+// Rerank orders candidates by the scores of reranker. If the reranker takes
+// longer than budget or fails, the candidates are returned in their
+// original order. A budget of 0 waits for the reranker as long as ctx
+// allows.
+func Rerank(ctx context.Context, tenant tenancy.Tenant, reranker Reranker, query string, candidates []Candidate, budget time.Duration) ([]Candidate, Outcome) {
+	if reranker == nil || len(candidates) < 2 {
+		return candidates, OutcomeSkipped
+	}
+	if budget > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, budget)
+		defer cancel()
+	}
+
+	texts := make([]string, len(candidates))
+	for i, candidate := range candidates {
+		texts[i] = candidate.Text
+	}
+
+	type scored struct {
+		scores []float64
+		err    error
+	}
+	// the reranker runs apart so one that ignores ctx still can't hold the
+	// search past its budget
+	done := make(chan scored, 1)
+	start := time.Now()
+	go func() {
+		scores, err := reranker.Score(ctx, tenant, query, texts)
+		done <- scored{scores, err}
+	}()
+
+	var result scored
+	select {
+	case result = <-done:
+	case <-ctx.Done():
+		result.err = ctx.Err()
+	}
+	rerankDuration.WithLabelValues(reranker.Name()).Observe(time.Since(start).Seconds())
+
+	outcome := OutcomeReranked
+	switch {
+	case result.err != nil && ctx.Err() != nil:
+		outcome = OutcomeTimeout
+	case result.err != nil:
+		rerankLogger.Printf("Error reranking with %s: %v", reranker.Name(), result.err)
+		outcome = OutcomeFailed
+	case len(result.scores) != len(candidates):
+		rerankLogger.Printf("%s returned %d scores for %d candidates", reranker.Name(), len(result.scores), len(candidates))
+		outcome = OutcomeFailed
+	}
+	rerankTotal.WithLabelValues(reranker.Name(), string(outcome)).Inc()
+	if outcome != OutcomeReranked {
+		return candidates, outcome
+	}
+
+	reranked := make([]Candidate, len(candidates))
+	copy(reranked, candidates)
+	for i := range reranked {
+		score := result.scores[i]
+		reranked[i].RerankScore = &score
+	}
+	sort.SliceStable(reranked, func(i, j int) bool {
+		return *reranked[i].RerankScore > *reranked[j].RerankScore
+	})
+	return reranked, outcome
+}
+
+var (
+	rerankers   = map[string]Reranker{}
+	rerankersMu sync.RWMutex
+)
+
+// Register makes a reranker selectable by name per query.
+func Register(reranker Reranker) {
+	rerankersMu.Lock()
+	defer rerankersMu.Unlock()
+
+	rerankers[reranker.Name()] = reranker
+}
+
+// Lookup returns a registered reranker.
+func Lookup(name string) (Reranker, bool) {
+	rerankersMu.RLock()
+	defer rerankersMu.RUnlock()
+
+	reranker, ok := rerankers[name]
+	return reranker, ok
+}
+
+// Names returns the names of the registered rerankers, sorted.
+func Names() []string {
+	rerankersMu.RLock()
+	defer rerankersMu.RUnlock()
+
+	names := make([]string, 0, len(rerankers))
+	for name := range rerankers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,100 @@
+package rerank
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/spectrumwebco/agent_runtime/backend/core/tenancy"
+)
+
+// fakeReranker scores a text by its length, after delay.
+type fakeReranker struct {
+	delay  time.Duration
+	err    error
+	scores []float64
+}
+
+func (r *fakeReranker) Name() string { return "fake" }
+
+func (r *fakeReranker) Score(ctx context.Context, tenant tenancy.Tenant, query string, texts []string) ([]float64, error) {
+	time.Sleep(r.delay)
+	if r.err != nil {
+		return nil, r.err
+	}
+	if r.scores != nil {
+		return r.scores, nil
+	}
+	scores := make([]float64, len(texts))
+	for i, text := range texts {
+		scores[i] = float64(len(text))
+	}
+	return scores, nil
+}
+
+var acme = tenancy.Tenant{OrganizationID: "acme", ProjectID: "default"}
+
+func testCandidates() []Candidate {
+	return FromResults([]map[string]interface{}{
+		{"id": "a", "score": 0.9, "metadata": map[string]interface{}{"text": "a"}},
+		{"id": "b", "score": 0.8, "metadata": map[string]interface{}{"text": "bbb"}},
+		{"id": "c", "score": 0.7, "metadata": map[string]interface{}{"text": "cc"}},
+	})
+}
+
+func ids(candidates []Candidate) string {
+	var result string
+	for _, candidate := range candidates {
+		result += candidate.ID
+	}
+	return result
+}
+
+func TestRerankOrdersByScore(t *testing.T) {
+	candidates := testCandidates()
+	if candidates[1].Text != "bbb" || candidates[1].Score != 0.8 {
+		t.Fatalf("unexpected candidate %+v", candidates[1])
+	}
+	reranked, outcome := Rerank(context.Background(), acme, &fakeReranker{}, "query", candidates, time.Second)
+	if outcome != OutcomeReranked || ids(reranked) != "bca" {
+		t.Errorf("expected bca reranked, got %s %s", ids(reranked), outcome)
+	}
+	if *reranked[0].RerankScore != 3 || ids(candidates) != "abc" {
+		t.Errorf("expected scores on a reordered copy, got %+v and %s", reranked[0], ids(candidates))
+	}
+}
+
+func TestRerankKeepsOrderOnFallback(t *testing.T) {
+	for name, test := range map[string]struct {
+		reranker *fakeReranker
+		outcome  Outcome
+	}{
+		"timeout":  {&fakeReranker{delay: 200 * time.Millisecond}, OutcomeTimeout},
+		"error":    {&fakeReranker{err: errors.New("unavailable")}, OutcomeFailed},
+		"mismatch": {&fakeReranker{scores: []float64{1}}, OutcomeFailed},
+	} {
+		start := time.Now()
+		reranked, outcome := Rerank(context.Background(), acme, test.reranker, "query", testCandidates(), 20*time.Millisecond)
+		if outcome != test.outcome || ids(reranked) != "abc" || reranked[0].RerankScore != nil {
+			t.Errorf("%s: expected the original order with %s, got %s %s", name, test.outcome, ids(reranked), outcome)
+		}
+		if elapsed := time.Since(start); elapsed > 150*time.Millisecond {
+			t.Errorf("%s: expected the budget to bound the rerank, took %s", name, elapsed)
+		}
+	}
+
+	if _, outcome := Rerank(context.Background(), acme, nil, "query", testCandidates(), 0); outcome != OutcomeSkipped {
+		t.Errorf("expected no reranker to skip, got %s", outcome)
+	}
+}
+
+func TestParseScores(t *testing.T) {
+	scores, err := parseScores("Scores:\n[7, 2.5, 0]\n")
+	if err != nil || len(scores) != 3 || scores[1] != 2.5 {
+		t.Errorf("unexpected scores %v (%v)", scores, err)
+	}
+	if _, err := parseScores("the first passage is relevant"); err == nil {
+		t.Errorf("expected an error for a completion without scores")
+	}
+}
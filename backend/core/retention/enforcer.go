@@ -0,0 +1,250 @@
+package retention
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/spectrumwebco/agent_runtime/backend/core/artifacts"
+	"github.com/spectrumwebco/agent_runtime/backend/core/audit"
+	"github.com/spectrumwebco/agent_runtime/backend/core/tenancy"
+	"github.com/spectrumwebco/agent_runtime/backend/db/integrations"
+)
+
+var retentionLogger = log.New(os.Stdout, "kled.retention: ", log.LstdFlags)
+
+// Target prunes one category of data.
+type Target struct {
+	Category Category
+	// PerTenant targets are pruned once per organization, with that
+	// organization's retention. Other targets use the default retention and
+	// are pruned once with a nil tenant.
+	PerTenant bool
+	// Prune deletes the data older than before, or with dryRun only counts
+	// it, and returns the number of rows.
+	Prune func(ctx context.Context, tenant *tenancy.Tenant, before time.Time, dryRun bool) (int64, error)
+}
+
+// PostgresTable prunes table in every tenant's Postgres schema by its
+// timestamp column.
+func PostgresTable(category Category, store integrations.SQLStore, table, column string) Target {
+	return tableTarget(category, store, table, column, "$", tenancy.NewPostgresStore)
+}
+
+// DorisTable prunes table in every tenant's Doris database by its timestamp
+// column.
+func DorisTable(category Category, store integrations.SQLStore, table, column string) Target {
+	return tableTarget(category, store, table, column, "?", tenancy.NewDorisStore)
+}
+
+func tableTarget(category Category, store integrations.SQLStore, table, column, placeholder string, scope func(tenancy.Tenant, integrations.SQLStore) *tenancy.SQLStore) Target {
+	param := func(n int) string {
+		if placeholder == "$" {
+			return fmt.Sprintf("$%d", n)
+		}
+		return placeholder
+	}
+
+	return Target{
+		Category:  category,
+		PerTenant: true,
+		Prune: func(ctx context.Context, tenant *tenancy.Tenant, before time.Time, dryRun bool) (int64, error) {
+			// tenant schemas are created lazily, so many tenants have no
+			// table to prune
+			rows, err := store.ExecuteQuery(fmt.Sprintf(
+				`SELECT 1 AS found FROM information_schema.tables WHERE table_schema = %s AND table_name = %s`,
+				param(1), param(2)), tenant.SchemaName(), table)
+			if err != nil {
+				return 0, err
+			}
+			if len(rows) == 0 {
+				return 0, nil
+			}
+
+			scoped := scope(*tenant, store)
+			where := fmt.Sprintf("%s < %s", column, param(1))
+			if dryRun {
+				rows, err := scoped.ExecuteQuery(fmt.Sprintf("SELECT COUNT(*) AS count FROM %s.%s WHERE %s", tenancy.SchemaPlaceholder, table, where), before.UTC())
+				if err != nil || len(rows) == 0 {
+					return 0, err
+				}
+				var count int64
+				fmt.Sscan(fmt.Sprint(rows[0]["count"]), &count)
+				return count, nil
+			}
+			return scoped.ExecuteUpdate(fmt.Sprintf("DELETE FROM %s.%s WHERE %s", tenancy.SchemaPlaceholder, table, where), before.UTC())
+		},
+	}
+}
+
+// AuditLog prunes the audit log. It is shared by all tenants, so it always
+// uses the default retention.
+func AuditLog(store *audit.PostgresStore) Target {
+	return Target{
+		Category: AuditLogs,
+		Prune: func(ctx context.Context, tenant *tenancy.Tenant, before time.Time, dryRun bool) (int64, error) {
+			return store.Prune(ctx, before, dryRun)
+		},
+	}
+}
+
+// RunArtifacts prunes the artifacts of runs, their records and their content
+// in storage, per organization.
+func RunArtifacts(manager *artifacts.Manager) Target {
+	return Target{
+		Category:  Artifacts,
+		PerTenant: true,
+		Prune: func(ctx context.Context, tenant *tenancy.Tenant, before time.Time, dryRun bool) (int64, error) {
+			return manager.Prune(ctx, tenant.OrganizationID, before, dryRun)
+		},
+	}
+}
+
+// Policies supplies the organizations and their retention overrides.
+// PolicyStore implements it.
+type Policies interface {
+	Overrides() (map[string]map[Category]int, error)
+	Organizations() ([]string, error)
+}
+
+// Result is the outcome of pruning one target, for one organization if the
+// target is per tenant.
+type Result struct {
+	Category       Category  `json:"category"`
+	OrganizationID string    `json:"organization_id,omitempty"`
+	RetentionDays  int       `json:"retention_days"`
+	Cutoff         time.Time `json:"cutoff"`
+	Rows           int64     `json:"rows"`
+	Error          string    `json:"error,omitempty"`
+}
+
+type Report struct {
+	DryRun  bool     `json:"dry_run"`
+	Results []Result `json:"results"`
+}
+
+// Rows is the number of rows pruned, or that would be pruned in a dry run.
+func (r *Report) Rows() int64 {
+	total := int64(0)
+	for _, result := range r.Results {
+		total += result.Rows
+	}
+	return total
+}
+
+// Enforcer prunes its targets according to the default and per-organization
+// retention.
+type Enforcer struct {
+	Targets  []Target
+	Policies Policies
+	// Defaults is the retention in days of every category. Categories that
+	// are missing or zero are kept forever unless an organization overrides
+	// them.
+	Defaults map[Category]int
+
+	now func() time.Time
+}
+
+func NewEnforcer(policies Policies, defaults map[Category]int, targets ...Target) *Enforcer {
+	return &Enforcer{
+		Targets:  targets,
+		Policies: policies,
+		Defaults: defaults,
+		now:      time.Now,
+	}
+}
+
+func (e *Enforcer) perTenant() bool {
+	for _, target := range e.Targets {
+		if target.PerTenant {
+			return true
+		}
+	}
+	return false
+}
+
+// Run prunes every target. A failing target doesn't stop the others; Run
+// returns an error after trying all of them, with the failures recorded in
+// the report.
+func (e *Enforcer) Run(ctx context.Context, dryRun bool) (*Report, error) {
+	report := &Report{DryRun: dryRun, Results: []Result{}}
+
+	var (
+		organizations []string
+		overrides     map[string]map[Category]int
+		err           error
+	)
+	if e.perTenant() {
+		if organizations, err = e.Policies.Organizations(); err != nil {
+			return nil, err
+		}
+		if overrides, err = e.Policies.Overrides(); err != nil {
+			return nil, err
+		}
+	}
+
+	now := e.now()
+	failed := 0
+	prune := func(target Target, tenant *tenancy.Tenant, days int) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if days <= 0 {
+			return nil
+		}
+
+		result := Result{
+			Category:      target.Category,
+			RetentionDays: days,
+			Cutoff:        now.Add(-time.Duration(days) * 24 * time.Hour).UTC(),
+		}
+		if tenant != nil {
+			result.OrganizationID = tenant.OrganizationID
+		}
+
+		rows, err := target.Prune(ctx, tenant, result.Cutoff, dryRun)
+		if err != nil {
+			failed++
+			result.Error = err.Error()
+			retentionLogger.Printf("Error pruning %s for %q: %v", target.Category, result.OrganizationID, err)
+		}
+		result.Rows = rows
+		report.Results = append(report.Results, result)
+		return nil
+	}
+
+	for _, target := range e.Targets {
+		if !target.PerTenant {
+			if err := prune(target, nil, e.Defaults[target.Category]); err != nil {
+				return report, err
+			}
+			continue
+		}
+
+		for _, organizationID := range organizations {
+			days := e.Defaults[target.Category]
+			if override, ok := overrides[organizationID][target.Category]; ok {
+				days = override
+			}
+
+			tenant, err := tenancy.New(organizationID, "")
+			if err != nil {
+				retentionLogger.Printf("Skipping organization %q: %v", organizationID, err)
+				continue
+			}
+			if err := prune(target, &tenant, days); err != nil {
+				return report, err
+			}
+		}
+	}
+
+	if !dryRun {
+		retentionLogger.Printf("Pruned %d rows", report.Rows())
+	}
+	if failed > 0 {
+		return report, fmt.Errorf("failed to prune %d of %d targets", failed, len(report.Results))
+	}
+	return report, nil
+}
@@ -0,0 +1,133 @@
+// Package retention deletes backend data once it is older than its retention
+// period. Every category of data has a default period, which organizations
+// can override.
+package retention
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/spectrumwebco/agent_runtime/backend/db/integrations"
+)
+
+type Category string
+
+const (
+	Trajectories    Category = "trajectories"
+	AuditLogs       Category = "audit_logs"
+	StateHistory    Category = "state_history"
+	WorkspaceEvents Category = "workspace_events"
+	Artifacts       Category = "artifacts"
+)
+
+var Categories = []Category{Trajectories, AuditLogs, StateHistory, WorkspaceEvents, Artifacts}
+
+func ParseCategory(name string) (Category, error) {
+	for _, category := range Categories {
+		if string(category) == name {
+			return category, nil
+		}
+	}
+	return "", fmt.Errorf("unknown retention category %q", name)
+}
+
+// DefaultDays is the retention of every category, in days, unless configured
+// otherwise. Zero keeps data forever.
+func DefaultDays() map[Category]int {
+	return map[Category]int{
+		Trajectories:    90,
+		AuditLogs:       365,
+		StateHistory:    90,
+		WorkspaceEvents: 90,
+		Artifacts:       30,
+	}
+}
+
+// PolicyStore keeps per-organization overrides in app_retention_policy.
+type PolicyStore struct {
+	store integrations.SQLStore
+}
+
+func NewPolicyStore(store integrations.SQLStore) *PolicyStore {
+	return &PolicyStore{store: store}
+}
+
+func (s *PolicyStore) EnsureSchema() error {
+	_, err := s.store.ExecuteUpdate(`
+		CREATE TABLE IF NOT EXISTS app_retention_policy (
+			organization_id UUID NOT NULL REFERENCES app_organization(id) ON DELETE CASCADE,
+			category VARCHAR(64) NOT NULL,
+			retention_days INTEGER NOT NULL CHECK (retention_days >= 0),
+			updated_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+			PRIMARY KEY (organization_id, category)
+		)
+	`)
+	if err != nil {
+		return fmt.Errorf("error creating retention policy table: %v", err)
+	}
+	return nil
+}
+
+// Overrides returns the retention overrides in days, by organization and
+// category.
+func (s *PolicyStore) Overrides() (map[string]map[Category]int, error) {
+	rows, err := s.store.ExecuteQuery(`SELECT organization_id, category, retention_days FROM app_retention_policy`)
+	if err != nil {
+		return nil, fmt.Errorf("error loading retention policies: %v", err)
+	}
+
+	overrides := make(map[string]map[Category]int)
+	for _, row := range rows {
+		orgID := fmt.Sprint(row["organization_id"])
+		if overrides[orgID] == nil {
+			overrides[orgID] = make(map[Category]int)
+		}
+		var days int
+		fmt.Sscan(fmt.Sprint(row["retention_days"]), &days)
+		overrides[orgID][Category(fmt.Sprint(row["category"]))] = days
+	}
+	return overrides, nil
+}
+
+// Set overrides the retention of category for an organization. Zero keeps
+// its data forever.
+func (s *PolicyStore) Set(organizationID string, category Category, days int) error {
+	if days < 0 {
+		return fmt.Errorf("retention must not be negative")
+	}
+	_, err := s.store.ExecuteUpdate(`
+		INSERT INTO app_retention_policy (organization_id, category, retention_days, updated_at)
+		VALUES ($1, $2, $3, now())
+		ON CONFLICT (organization_id, category)
+		DO UPDATE SET retention_days = EXCLUDED.retention_days, updated_at = now()
+	`, organizationID, string(category), days)
+	if err != nil {
+		return fmt.Errorf("error saving retention policy: %v", err)
+	}
+	return nil
+}
+
+// Unset removes an override, so the organization uses the default again.
+func (s *PolicyStore) Unset(organizationID string, category Category) error {
+	_, err := s.store.ExecuteUpdate(`DELETE FROM app_retention_policy WHERE organization_id = $1 AND category = $2`, organizationID, string(category))
+	if err != nil {
+		return fmt.Errorf("error deleting retention policy: %v", err)
+	}
+	return nil
+}
+
+// Organizations lists every organization, since tenant data is pruned per
+// organization whether or not it has overrides.
+func (s *PolicyStore) Organizations() ([]string, error) {
+	rows, err := s.store.ExecuteQuery(`SELECT id FROM app_organization`)
+	if err != nil {
+		return nil, fmt.Errorf("error listing organizations: %v", err)
+	}
+
+	organizations := make([]string, 0, len(rows))
+	for _, row := range rows {
+		organizations = append(organizations, fmt.Sprint(row["id"]))
+	}
+	sort.Strings(organizations)
+	return organizations, nil
+}
@@ -0,0 +1,107 @@
+package retention
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/spectrumwebco/agent_runtime/backend/core/tenancy"
+)
+
+type staticPolicies struct {
+	organizations []string
+	overrides     map[string]map[Category]int
+}
+
+func (p staticPolicies) Organizations() ([]string, error) { return p.organizations, nil }
+
+func (p staticPolicies) Overrides() (map[string]map[Category]int, error) { return p.overrides, nil }
+
+type pruneCall struct {
+	organization string
+	before       time.Time
+	dryRun       bool
+}
+
+func recordingTarget(category Category, perTenant bool, calls *[]pruneCall, err error) Target {
+	return Target{
+		Category:  category,
+		PerTenant: perTenant,
+		Prune: func(ctx context.Context, tenant *tenancy.Tenant, before time.Time, dryRun bool) (int64, error) {
+			call := pruneCall{before: before, dryRun: dryRun}
+			if tenant != nil {
+				call.organization = tenant.OrganizationID
+			}
+			*calls = append(*calls, call)
+			if err != nil {
+				return 0, err
+			}
+			return 3, nil
+		},
+	}
+}
+
+func TestEnforcerAppliesOverrides(t *testing.T) {
+	now := time.Date(2026, 6, 1, 0, 0, 0, 0, time.UTC)
+	var trajectoryCalls, auditCalls []pruneCall
+
+	e := NewEnforcer(staticPolicies{
+		organizations: []string{"org-a", "org-b", "org-c"},
+		overrides: map[string]map[Category]int{
+			"org-b": {Trajectories: 30},
+			// zero keeps org-c's trajectories forever
+			"org-c": {Trajectories: 0, AuditLogs: 1},
+		},
+	}, map[Category]int{Trajectories: 90, AuditLogs: 365},
+		recordingTarget(Trajectories, true, &trajectoryCalls, nil),
+		recordingTarget(AuditLogs, false, &auditCalls, nil),
+	)
+	e.now = func() time.Time { return now }
+
+	report, err := e.Run(context.Background(), true)
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+
+	if len(trajectoryCalls) != 2 {
+		t.Fatalf("got %d trajectory prunes, want 2: %+v", len(trajectoryCalls), trajectoryCalls)
+	}
+	if trajectoryCalls[0].organization != "org-a" || !trajectoryCalls[0].before.Equal(now.AddDate(0, 0, -90)) {
+		t.Errorf("org-a pruned with %+v", trajectoryCalls[0])
+	}
+	if trajectoryCalls[1].organization != "org-b" || !trajectoryCalls[1].before.Equal(now.AddDate(0, 0, -30)) {
+		t.Errorf("org-b pruned with %+v", trajectoryCalls[1])
+	}
+	if !trajectoryCalls[0].dryRun {
+		t.Error("dry run was not passed to the target")
+	}
+
+	// the audit log is global, so organization overrides don't apply
+	if len(auditCalls) != 1 || auditCalls[0].organization != "" || !auditCalls[0].before.Equal(now.AddDate(0, 0, -365)) {
+		t.Errorf("audit log pruned with %+v", auditCalls)
+	}
+
+	if !report.DryRun || report.Rows() != 9 {
+		t.Errorf("report = %+v, want a dry run of 9 rows", report)
+	}
+}
+
+func TestEnforcerContinuesAfterFailure(t *testing.T) {
+	var failingCalls, calls []pruneCall
+	e := NewEnforcer(staticPolicies{organizations: []string{"org-a"}}, map[Category]int{StateHistory: 90, WorkspaceEvents: 90},
+		recordingTarget(StateHistory, true, &failingCalls, errors.New("boom")),
+		recordingTarget(WorkspaceEvents, true, &calls, nil),
+	)
+
+	report, err := e.Run(context.Background(), false)
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+	if len(calls) != 1 {
+		t.Fatal("a failing target stopped the others")
+	}
+	if report.Results[0].Error != "boom" || report.Results[1].Rows != 3 {
+		t.Errorf("report = %+v", report.Results)
+	}
+}
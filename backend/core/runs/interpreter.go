@@ -0,0 +1,80 @@
+package runs
+
+import (
+	"context"
+	"encoding/json"
+	"strconv"
+)
+
+// Context keys the interpreter receives with every execution of a run, next
+// to the run's own context.
+const (
+	ContextRunID          = "run_id"
+	ContextWorkspaceID    = "workspace_id"
+	ContextCheckpointStep = "checkpoint_step"
+	// ContextMemoryRefs holds the memory refs of the checkpoint as a JSON
+	// array.
+	ContextMemoryRefs   = "checkpoint_memory_refs"
+	ContextTrajectoryID = "trajectory_id"
+	// ContextCorrelationID holds the correlation ID of the request that
+	// started the run, for the trajectory records and log lines of the
+	// interpreter.
+	ContextCorrelationID = "correlation_id"
+)
+
+// Interpreter is the part of the interpreter service executing runs, either
+// in process or through its gRPC client.
+type Interpreter interface {
+	ExecuteTask(ctx context.Context, prompt string, taskContext map[string]string) (string, error)
+	CancelTask(ctx context.Context, taskID string) error
+}
+
+// InterpreterExecutor executes runs as interpreter tasks. The execution ID
+// of a run is its task ID.
+type InterpreterExecutor struct {
+	interpreter Interpreter
+}
+
+func NewInterpreterExecutor(interpreter Interpreter) *InterpreterExecutor {
+	return &InterpreterExecutor{interpreter: interpreter}
+}
+
+func (e *InterpreterExecutor) Start(ctx context.Context, run *Run) (string, error) {
+	return e.interpreter.ExecuteTask(ctx, run.Prompt, ExecutionContext(run))
+}
+
+func (e *InterpreterExecutor) Stop(ctx context.Context, run *Run) error {
+	if run.ExecutionID == "" {
+		return nil
+	}
+	return e.interpreter.CancelTask(ctx, run.ExecutionID)
+}
+
+// ExecutionContext returns the context of an execution of the run: its own
+// context plus the run ID, workspace and checkpoint to resume from.
+func ExecutionContext(run *Run) map[string]string {
+	executionContext := make(map[string]string, len(run.Context)+6)
+	for k, v := range run.Context {
+		executionContext[k] = v
+	}
+	executionContext[ContextRunID] = run.ID
+	if run.WorkspaceID != "" {
+		executionContext[ContextWorkspaceID] = run.WorkspaceID
+	}
+	if run.CorrelationID != "" {
+		executionContext[ContextCorrelationID] = run.CorrelationID
+	}
+	if run.Checkpoint == nil {
+		return executionContext
+	}
+
+	executionContext[ContextCheckpointStep] = strconv.Itoa(run.Checkpoint.Step)
+	if len(run.Checkpoint.MemoryRefs) > 0 {
+		refs, _ := json.Marshal(run.Checkpoint.MemoryRefs)
+		executionContext[ContextMemoryRefs] = string(refs)
+	}
+	if run.Checkpoint.TrajectoryID != "" {
+		executionContext[ContextTrajectoryID] = run.Checkpoint.TrajectoryID
+	}
+	return executionContext
+}
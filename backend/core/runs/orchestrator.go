@@ -0,0 +1,308 @@
+package runs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/spectrumwebco/agent_runtime/backend/core/events"
+	"github.com/spectrumwebco/agent_runtime/backend/core/tenancy"
+	"github.com/spectrumwebco/agent_runtime/backend/core/tracing"
+)
+
+// Executor executes runs, e.g. as interpreter tasks.
+type Executor interface {
+	// Start starts an execution of the run from its checkpoint, or from the
+	// beginning without one, and returns the execution's ID.
+	Start(ctx context.Context, run *Run) (string, error)
+	// Stop stops the run's current execution.
+	Stop(ctx context.Context, run *Run) error
+}
+
+type Signal string
+
+const (
+	SignalPause  Signal = "pause"
+	SignalResume Signal = "resume"
+	SignalCancel Signal = "cancel"
+)
+
+// Signaler tells the run's environment, such as the agent of its
+// workspace, about a change of state. Signals are best effort.
+type Signaler interface {
+	Signal(ctx context.Context, run *Run, signal Signal) error
+}
+
+// maxUpdateAttempts bounds the retries of an update losing to a concurrent
+// one.
+const maxUpdateAttempts = 3
+
+type Orchestrator struct {
+	store     Store
+	executor  Executor
+	signalers []Signaler
+	now       func() time.Time
+}
+
+func NewOrchestrator(store Store, executor Executor, signalers ...Signaler) *Orchestrator {
+	return &Orchestrator{store: store, executor: executor, signalers: signalers, now: time.Now}
+}
+
+func (o *Orchestrator) SetClock(now func() time.Time) {
+	o.now = now
+}
+
+// Get returns a run of the tenant, or ErrNotFound for runs of other
+// tenants.
+func (o *Orchestrator) Get(ctx context.Context, tenant tenancy.Tenant, id string) (*Run, error) {
+	run, err := o.store.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if run.OrganizationID != tenant.OrganizationID || run.ProjectID != tenant.ProjectID {
+		return nil, ErrNotFound
+	}
+	return run, nil
+}
+
+func (o *Orchestrator) List(ctx context.Context, tenant tenancy.Tenant, state State, limit int) ([]*Run, error) {
+	return o.store.List(ctx, tenant.OrganizationID, tenant.ProjectID, state, limit)
+}
+
+// Start creates a run and starts its first execution. A run whose execution
+// cannot be started is returned failed.
+func (o *Orchestrator) Start(ctx context.Context, tenant tenancy.Tenant, spec Spec, createdBy string) (*Run, error) {
+	if spec.Prompt == "" {
+		return nil, fmt.Errorf("a run needs a prompt")
+	}
+	now := o.now().UTC()
+	run := &Run{
+		ID:             uuid.New().String(),
+		OrganizationID: tenant.OrganizationID,
+		ProjectID:      tenant.ProjectID,
+		WorkspaceID:    spec.WorkspaceID,
+		Prompt:         spec.Prompt,
+		Context:        spec.Context,
+		State:          StatePending,
+		CorrelationID:  events.CorrelationID(ctx),
+		CreatedBy:      createdBy,
+		CreatedAt:      now,
+		UpdatedAt:      now,
+	}
+	if err := o.store.Create(ctx, run); err != nil {
+		return nil, err
+	}
+	return o.execute(ctx, tenant, run.ID)
+}
+
+// Resume starts a new execution of a paused run from its checkpoint.
+func (o *Orchestrator) Resume(ctx context.Context, tenant tenancy.Tenant, id string) (*Run, error) {
+	run, err := o.Get(ctx, tenant, id)
+	if err != nil {
+		return nil, err
+	}
+	if run.State != StatePaused {
+		return nil, &TransitionError{RunID: id, From: run.State, To: StateRunning}
+	}
+	run, err = o.execute(ctx, tenant, id)
+	if err == nil && run.State == StateRunning {
+		o.signal(ctx, run, SignalResume)
+	}
+	return run, err
+}
+
+// execute starts an execution of a pending or paused run and marks it
+// running, or failed when the executor refuses it.
+func (o *Orchestrator) execute(ctx context.Context, tenant tenancy.Tenant, id string) (*Run, error) {
+	run, err := o.Get(ctx, tenant, id)
+	if err != nil {
+		return nil, err
+	}
+	executionID, startErr := o.executor.Start(ctx, run)
+	if startErr != nil {
+		runsLogger.Printf("Error starting run %s: %v", id, startErr)
+		return o.transition(ctx, tenant, id, StateFailed, func(run *Run) error {
+			run.Error = startErr.Error()
+			return nil
+		})
+	}
+
+	run, err = o.transition(ctx, tenant, id, StateRunning, func(run *Run) error {
+		run.ExecutionID = executionID
+		return nil
+	})
+	if err != nil {
+		// the run was cancelled while starting, the execution must not
+		// outlive it
+		stopped := &Run{ID: id, ExecutionID: executionID}
+		if stopErr := o.executor.Stop(ctx, stopped); stopErr != nil {
+			runsLogger.Printf("Error stopping orphaned execution %s of run %s: %v", executionID, id, stopErr)
+		}
+	}
+	return run, err
+}
+
+// Pause stops the execution of a running run, keeping its checkpoint.
+func (o *Orchestrator) Pause(ctx context.Context, tenant tenancy.Tenant, id string) (*Run, error) {
+	run, err := o.transition(ctx, tenant, id, StatePaused, nil)
+	if err != nil {
+		return nil, err
+	}
+	o.stop(ctx, run, SignalPause)
+	return run, nil
+}
+
+// Cancel stops a run for good. Cancelling a finished run is an error,
+// cancelling a cancelled one returns it unchanged.
+func (o *Orchestrator) Cancel(ctx context.Context, tenant tenancy.Tenant, id, reason string) (*Run, error) {
+	current, err := o.Get(ctx, tenant, id)
+	if err != nil {
+		return nil, err
+	}
+	if current.State == StateCancelled {
+		return current, nil
+	}
+	wasExecuting := current.State == StateRunning
+
+	run, err := o.transition(ctx, tenant, id, StateCancelled, func(run *Run) error {
+		run.Error = reason
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if wasExecuting {
+		o.stop(ctx, run, SignalCancel)
+	} else {
+		o.signal(ctx, run, SignalCancel)
+	}
+	return run, nil
+}
+
+// Checkpoint saves the progress of a running or paused run and returns the
+// run, whose state tells the runtime whether to go on. Saving the same step
+// again is allowed, so retried saves succeed.
+func (o *Orchestrator) Checkpoint(ctx context.Context, tenant tenancy.Tenant, id string, checkpoint Checkpoint) (*Run, error) {
+	return o.update(ctx, tenant, id, func(run *Run) error {
+		if run.State != StateRunning && run.State != StatePaused {
+			// the runtime learns it has to stop from the state
+			return errUnchanged
+		}
+		if run.Checkpoint != nil && checkpoint.Step < run.Checkpoint.Step {
+			return ErrStaleCheckpoint
+		}
+		checkpoint.SavedAt = o.now().UTC()
+		run.Checkpoint = &checkpoint
+		return nil
+	})
+}
+
+// Finish records the outcome the runtime reports for a running run.
+func (o *Orchestrator) Finish(ctx context.Context, tenant tenancy.Tenant, id string, succeeded bool, message string) (*Run, error) {
+	state := StateFailed
+	if succeeded {
+		state = StateSucceeded
+	}
+	return o.transition(ctx, tenant, id, state, func(run *Run) error {
+		run.Error = message
+		return nil
+	})
+}
+
+// stop stops the execution and signals the environment of a run that left
+// the running state.
+func (o *Orchestrator) stop(ctx context.Context, run *Run, signal Signal) {
+	if err := o.executor.Stop(ctx, run); err != nil {
+		runsLogger.Printf("Error stopping execution %s of run %s: %v", run.ExecutionID, run.ID, err)
+	}
+	o.signal(ctx, run, signal)
+}
+
+func (o *Orchestrator) signal(ctx context.Context, run *Run, signal Signal) {
+	var wg sync.WaitGroup
+	for _, signaler := range o.signalers {
+		wg.Add(1)
+		go func(signaler Signaler) {
+			defer wg.Done()
+			if err := signaler.Signal(ctx, run, signal); err != nil {
+				runsLogger.Printf("Error signalling %s to run %s: %v", signal, run.ID, err)
+			}
+		}(signaler)
+	}
+	wg.Wait()
+}
+
+// errUnchanged makes update return the run without saving it.
+var errUnchanged = errors.New("unchanged")
+
+// transition moves a run to the state, applying mutate to it.
+func (o *Orchestrator) transition(ctx context.Context, tenant tenancy.Tenant, id string, to State, mutate func(*Run) error) (*Run, error) {
+	var from State
+	run, err := o.update(ctx, tenant, id, func(run *Run) error {
+		from = run.State
+		if !run.State.CanTransition(to) {
+			return &TransitionError{RunID: id, From: run.State, To: to}
+		}
+		run.State = to
+		if to.Finished() {
+			finishedAt := o.now().UTC()
+			run.FinishedAt = &finishedAt
+		}
+		if mutate != nil {
+			return mutate(run)
+		}
+		return nil
+	})
+	if err == nil {
+		o.trace(ctx, run, from)
+	}
+	return run, err
+}
+
+// trace records a change of state in the timeline of the request that
+// started the run, and in that of the request changing it.
+func (o *Orchestrator) trace(ctx context.Context, run *Run, from State) {
+	entry := tracing.Entry{
+		Source:     tracing.SourceRun,
+		Name:       "run." + string(run.State),
+		Message:    fmt.Sprintf("run %s went from %s to %s", run.ID, from, run.State),
+		Error:      run.Error,
+		Attributes: map[string]string{"run_id": run.ID, "execution_id": run.ExecutionID, "workspace_id": run.WorkspaceID},
+	}
+	if run.State == StateSucceeded || run.State == StateCancelled {
+		entry.Error = ""
+	}
+	correlationID := events.CorrelationID(ctx)
+	if run.CorrelationID != "" && run.CorrelationID != correlationID {
+		tracing.Record(events.WithCorrelationID(ctx, run.CorrelationID), entry)
+	}
+	tracing.Record(ctx, entry)
+}
+
+// update reads, changes and saves a run, retrying when another update wins
+// the race.
+func (o *Orchestrator) update(ctx context.Context, tenant tenancy.Tenant, id string, change func(*Run) error) (*Run, error) {
+	for attempt := 1; ; attempt++ {
+		run, err := o.Get(ctx, tenant, id)
+		if err != nil {
+			return nil, err
+		}
+		if err := change(run); errors.Is(err, errUnchanged) {
+			return run, nil
+		} else if err != nil {
+			return nil, err
+		}
+		run.UpdatedAt = o.now().UTC()
+
+		err = o.store.Update(ctx, run)
+		if err == nil {
+			return run, nil
+		}
+		if !errors.Is(err, ErrConflict) || attempt == maxUpdateAttempts {
+			return nil, err
+		}
+	}
+}
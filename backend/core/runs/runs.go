@@ -0,0 +1,127 @@
+// Package runs tracks long-running agent runs as resources that can be
+// started, paused, resumed and cancelled.
+//
+// A Run moves through the states below. The agent runtime saves a
+// Checkpoint, the index of its next step and pointers to its memory, as it
+// goes; pausing stops the run's execution and resuming starts a new
+// execution from the last checkpoint. Stopping a run, whether paused or
+// cancelled, is propagated to the interpreter executing it and signalled to
+// the agent of its workspace. Runtimes that miss the signal learn the state
+// from the response to their next checkpoint.
+//
+//	pending -> running -> succeeded | failed
+//	              ^   \
+//	              |    v
+//	            paused -> cancelled (from any unfinished state)
+package runs
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"time"
+)
+
+var runsLogger = log.New(os.Stdout, "kled.runs: ", log.LstdFlags)
+
+var (
+	ErrNotFound = errors.New("run not found")
+	// ErrConflict is returned by Store.Update when the run changed since it
+	// was read.
+	ErrConflict = errors.New("run was modified concurrently")
+	// ErrStaleCheckpoint rejects a checkpoint older than the saved one.
+	ErrStaleCheckpoint = errors.New("checkpoint is older than the saved one")
+)
+
+type State string
+
+const (
+	StatePending   State = "pending"
+	StateRunning   State = "running"
+	StatePaused    State = "paused"
+	StateSucceeded State = "succeeded"
+	StateFailed    State = "failed"
+	StateCancelled State = "cancelled"
+)
+
+var transitions = map[State][]State{
+	StatePending: {StateRunning, StateFailed, StateCancelled},
+	StateRunning: {StatePaused, StateSucceeded, StateFailed, StateCancelled},
+	StatePaused:  {StateRunning, StateFailed, StateCancelled},
+}
+
+func (s State) Valid() bool {
+	switch s {
+	case StatePending, StateRunning, StatePaused, StateSucceeded, StateFailed, StateCancelled:
+		return true
+	}
+	return false
+}
+
+// Finished states are final.
+func (s State) Finished() bool {
+	return s == StateSucceeded || s == StateFailed || s == StateCancelled
+}
+
+func (s State) CanTransition(to State) bool {
+	for _, next := range transitions[s] {
+		if next == to {
+			return true
+		}
+	}
+	return false
+}
+
+// TransitionError rejects a change the state machine does not allow.
+type TransitionError struct {
+	RunID string
+	From  State
+	To    State
+}
+
+func (e *TransitionError) Error() string {
+	return fmt.Sprintf("run %s is %s and cannot become %s", e.RunID, e.From, e.To)
+}
+
+// Checkpoint is where a run can resume from.
+type Checkpoint struct {
+	// Step is the index of the next step to run.
+	Step int `json:"step"`
+	// MemoryRefs point at the run's memory, e.g. KV keys or vector IDs.
+	MemoryRefs   []string  `json:"memory_refs,omitempty"`
+	TrajectoryID string    `json:"trajectory_id,omitempty"`
+	SavedAt      time.Time `json:"saved_at"`
+}
+
+type Run struct {
+	ID             string `json:"id"`
+	OrganizationID string `json:"organization_id"`
+	ProjectID      string `json:"project_id"`
+	// WorkspaceID is the workspace the run acts on, if any.
+	WorkspaceID string            `json:"workspace_id,omitempty"`
+	Prompt      string            `json:"prompt"`
+	Context     map[string]string `json:"context,omitempty"`
+	State       State             `json:"state"`
+	// ExecutionID identifies the current execution, e.g. the interpreter
+	// task. Every resume starts a new one.
+	ExecutionID string      `json:"execution_id,omitempty"`
+	Checkpoint  *Checkpoint `json:"checkpoint,omitempty"`
+	Error       string      `json:"error,omitempty"`
+	CreatedBy   string      `json:"created_by,omitempty"`
+	CreatedAt   time.Time   `json:"created_at"`
+	UpdatedAt   time.Time   `json:"updated_at"`
+	FinishedAt  *time.Time  `json:"finished_at,omitempty"`
+	// Version is incremented by every update.
+	Version int `json:"version"`
+	// CorrelationID is the ID of the request that started the run. It is
+	// passed on to every execution, so trajectories can be traced back.
+	CorrelationID string `json:"correlation_id,omitempty"`
+}
+
+// Spec describes a run to start.
+type Spec struct {
+	WorkspaceID string            `json:"workspace_id"`
+	Prompt      string            `json:"prompt" openapi:"required"`
+	Context     map[string]string `json:"context"`
+}
@@ -0,0 +1,147 @@
+package runs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/spectrumwebco/agent_runtime/backend/core/events"
+	"github.com/spectrumwebco/agent_runtime/backend/core/tenancy"
+)
+
+type fakeInterpreter struct {
+	mu        sync.Mutex
+	started   []map[string]string
+	cancelled []string
+	fail      error
+}
+
+func (f *fakeInterpreter) ExecuteTask(ctx context.Context, prompt string, taskContext map[string]string) (string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.fail != nil {
+		return "", f.fail
+	}
+	f.started = append(f.started, taskContext)
+	return fmt.Sprintf("task-%d", len(f.started)), nil
+}
+
+func (f *fakeInterpreter) CancelTask(ctx context.Context, taskID string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.cancelled = append(f.cancelled, taskID)
+	return nil
+}
+
+type recordingSignaler struct {
+	mu      sync.Mutex
+	signals []Signal
+}
+
+func (s *recordingSignaler) Signal(ctx context.Context, run *Run, signal Signal) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.signals = append(s.signals, signal)
+	return nil
+}
+
+var tenant = tenancy.Tenant{OrganizationID: "acme", ProjectID: "default"}
+
+func TestPauseAndResumeFromCheckpoint(t *testing.T) {
+	ctx := events.WithCorrelationID(context.Background(), "request-1")
+	interpreter := &fakeInterpreter{}
+	signaler := &recordingSignaler{}
+	orchestrator := NewOrchestrator(NewMemoryStore(), NewInterpreterExecutor(interpreter), signaler)
+
+	run, err := orchestrator.Start(ctx, tenant, Spec{Prompt: "fix the build", WorkspaceID: "ws-1"}, "1")
+	if err != nil || run.State != StateRunning || run.ExecutionID != "task-1" {
+		t.Fatalf("unexpected run %+v, %v", run, err)
+	}
+	if _, err := orchestrator.Checkpoint(ctx, tenant, run.ID, Checkpoint{Step: 3, MemoryRefs: []string{"kv:a", "kv:b"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	run, err = orchestrator.Pause(ctx, tenant, run.ID)
+	if err != nil || run.State != StatePaused {
+		t.Fatalf("unexpected run %+v, %v", run, err)
+	}
+	if len(interpreter.cancelled) != 1 || interpreter.cancelled[0] != "task-1" {
+		t.Fatalf("expected task-1 to be cancelled, got %v", interpreter.cancelled)
+	}
+
+	run, err = orchestrator.Resume(ctx, tenant, run.ID)
+	if err != nil || run.State != StateRunning || run.ExecutionID != "task-2" {
+		t.Fatalf("unexpected run %+v, %v", run, err)
+	}
+	// a pause can't be resumed twice
+	var transitionErr *TransitionError
+	if _, err := orchestrator.Resume(ctx, tenant, run.ID); !errors.As(err, &transitionErr) {
+		t.Fatalf("expected a transition error, got %v", err)
+	}
+
+	resumed := interpreter.started[1]
+	if resumed[ContextRunID] != run.ID || resumed[ContextCheckpointStep] != "3" || resumed[ContextMemoryRefs] != `["kv:a","kv:b"]` || resumed[ContextCorrelationID] != "request-1" {
+		t.Fatalf("resumed without the checkpoint: %v", resumed)
+	}
+	if fmt.Sprint(signaler.signals) != "[pause resume]" {
+		t.Fatalf("unexpected signals %v", signaler.signals)
+	}
+}
+
+func TestCancelPropagatesAndStopsCheckpoints(t *testing.T) {
+	ctx := context.Background()
+	interpreter := &fakeInterpreter{}
+	signaler := &recordingSignaler{}
+	orchestrator := NewOrchestrator(NewMemoryStore(), NewInterpreterExecutor(interpreter), signaler)
+
+	run, _ := orchestrator.Start(ctx, tenant, Spec{Prompt: "fix the build"}, "1")
+	if _, err := orchestrator.Checkpoint(ctx, tenant, run.ID, Checkpoint{Step: 2}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := orchestrator.Checkpoint(ctx, tenant, run.ID, Checkpoint{Step: 1}); !errors.Is(err, ErrStaleCheckpoint) {
+		t.Fatalf("expected a stale checkpoint, got %v", err)
+	}
+
+	run, err := orchestrator.Cancel(ctx, tenant, run.ID, "superseded")
+	if err != nil || run.State != StateCancelled || run.Error != "superseded" || run.FinishedAt == nil {
+		t.Fatalf("unexpected run %+v, %v", run, err)
+	}
+	if len(interpreter.cancelled) != 1 || fmt.Sprint(signaler.signals) != "[cancel]" {
+		t.Fatalf("cancel not propagated: %v, %v", interpreter.cancelled, signaler.signals)
+	}
+
+	// the runtime learns about the cancellation from its next checkpoint
+	run, err = orchestrator.Checkpoint(ctx, tenant, run.ID, Checkpoint{Step: 3})
+	if err != nil || run.State != StateCancelled || run.Checkpoint.Step != 2 {
+		t.Fatalf("unexpected run %+v, %v", run, err)
+	}
+	if _, err := orchestrator.Finish(ctx, tenant, run.ID, true, ""); err == nil {
+		t.Fatal("expected a cancelled run not to finish")
+	}
+	if again, err := orchestrator.Cancel(ctx, tenant, run.ID, ""); err != nil || again.Version != run.Version {
+		t.Fatalf("expected cancelling again to change nothing, got %+v, %v", again, err)
+	}
+}
+
+func TestRunsAreScopedToTheirTenant(t *testing.T) {
+	ctx := context.Background()
+	orchestrator := NewOrchestrator(NewMemoryStore(), NewInterpreterExecutor(&fakeInterpreter{fail: errors.New("no capacity")}))
+
+	run, err := orchestrator.Start(ctx, tenant, Spec{Prompt: "fix the build"}, "1")
+	if err != nil || run.State != StateFailed || run.Error != "no capacity" {
+		t.Fatalf("expected the run to fail, got %+v, %v", run, err)
+	}
+
+	other := tenancy.Tenant{OrganizationID: "globex", ProjectID: "default"}
+	if _, err := orchestrator.Get(ctx, other, run.ID); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected runs of other tenants to be hidden, got %v", err)
+	}
+	if _, err := orchestrator.Cancel(ctx, other, run.ID, ""); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected runs of other tenants to be hidden, got %v", err)
+	}
+	if list, _ := orchestrator.List(ctx, tenant, StateFailed, 0); len(list) != 1 {
+		t.Fatalf("expected one failed run, got %d", len(list))
+	}
+}
@@ -0,0 +1,222 @@
+package runs
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/spectrumwebco/agent_runtime/backend/core/rbac"
+	"github.com/spectrumwebco/agent_runtime/backend/core/tenancy"
+	pb "github.com/spectrumwebco/agent_runtime/backend/protos/gen/go/agent_runs"
+)
+
+// Server serves the AgentRuns service. Callers are authenticated by the
+// RBAC interceptor, which stores their subject in the context; runs belong
+// to the subject's organization.
+type Server struct {
+	pb.UnimplementedAgentRunsServer
+
+	orchestrator *Orchestrator
+}
+
+func NewServer(orchestrator *Orchestrator) *Server {
+	return &Server{orchestrator: orchestrator}
+}
+
+func (s *Server) StartRun(ctx context.Context, req *pb.StartRunRequest) (*pb.Run, error) {
+	subject, tenant, err := caller(ctx, req.ProjectId)
+	if err != nil {
+		return nil, err
+	}
+	if req.Prompt == "" {
+		return nil, status.Error(codes.InvalidArgument, "prompt is required")
+	}
+	run, err := s.orchestrator.Start(ctx, tenant, Spec{
+		WorkspaceID: req.WorkspaceId,
+		Prompt:      req.Prompt,
+		Context:     req.Context,
+	}, subject.ID)
+	return toProto(run, err)
+}
+
+func (s *Server) GetRun(ctx context.Context, req *pb.RunRequest) (*pb.Run, error) {
+	_, tenant, err := caller(ctx, req.ProjectId)
+	if err != nil {
+		return nil, err
+	}
+	return toProto(s.orchestrator.Get(ctx, tenant, req.RunId))
+}
+
+func (s *Server) ListRuns(ctx context.Context, req *pb.ListRunsRequest) (*pb.ListRunsResponse, error) {
+	_, tenant, err := caller(ctx, req.ProjectId)
+	if err != nil {
+		return nil, err
+	}
+	state := State(req.State)
+	if state != "" && !state.Valid() {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid state %q", req.State)
+	}
+
+	runs, err := s.orchestrator.List(ctx, tenant, state, int(req.Limit))
+	if err != nil {
+		return nil, statusError(err)
+	}
+	resp := &pb.ListRunsResponse{Runs: make([]*pb.Run, 0, len(runs))}
+	for _, run := range runs {
+		resp.Runs = append(resp.Runs, runToProto(run))
+	}
+	return resp, nil
+}
+
+func (s *Server) PauseRun(ctx context.Context, req *pb.RunRequest) (*pb.Run, error) {
+	_, tenant, err := caller(ctx, req.ProjectId)
+	if err != nil {
+		return nil, err
+	}
+	return toProto(s.orchestrator.Pause(ctx, tenant, req.RunId))
+}
+
+func (s *Server) ResumeRun(ctx context.Context, req *pb.RunRequest) (*pb.Run, error) {
+	_, tenant, err := caller(ctx, req.ProjectId)
+	if err != nil {
+		return nil, err
+	}
+	return toProto(s.orchestrator.Resume(ctx, tenant, req.RunId))
+}
+
+func (s *Server) CancelRun(ctx context.Context, req *pb.RunRequest) (*pb.Run, error) {
+	_, tenant, err := caller(ctx, req.ProjectId)
+	if err != nil {
+		return nil, err
+	}
+	return toProto(s.orchestrator.Cancel(ctx, tenant, req.RunId, req.Reason))
+}
+
+func (s *Server) SaveCheckpoint(ctx context.Context, req *pb.SaveCheckpointRequest) (*pb.Run, error) {
+	_, tenant, err := caller(ctx, req.ProjectId)
+	if err != nil {
+		return nil, err
+	}
+	if req.Checkpoint == nil {
+		return nil, status.Error(codes.InvalidArgument, "checkpoint is required")
+	}
+	return toProto(s.orchestrator.Checkpoint(ctx, tenant, req.RunId, Checkpoint{
+		Step:         int(req.Checkpoint.Step),
+		MemoryRefs:   req.Checkpoint.MemoryRefs,
+		TrajectoryID: req.Checkpoint.TrajectoryId,
+	}))
+}
+
+func (s *Server) FinishRun(ctx context.Context, req *pb.FinishRunRequest) (*pb.Run, error) {
+	_, tenant, err := caller(ctx, req.ProjectId)
+	if err != nil {
+		return nil, err
+	}
+	return toProto(s.orchestrator.Finish(ctx, tenant, req.RunId, req.Succeeded, req.Error))
+}
+
+// caller returns the subject of the call and the tenant of the project it
+// addresses.
+func caller(ctx context.Context, projectID string) (rbac.Subject, tenancy.Tenant, error) {
+	subject, ok := rbac.SubjectFromContext(ctx)
+	if !ok || subject.ID == "" {
+		return rbac.Subject{}, tenancy.Tenant{}, status.Error(codes.Unauthenticated, "authentication required")
+	}
+	tenant, err := tenancy.New(subject.OrganizationID, projectID)
+	if err != nil {
+		return rbac.Subject{}, tenancy.Tenant{}, status.Error(codes.InvalidArgument, err.Error())
+	}
+	return subject, tenant, nil
+}
+
+func toProto(run *Run, err error) (*pb.Run, error) {
+	if err != nil {
+		return nil, statusError(err)
+	}
+	return runToProto(run), nil
+}
+
+func statusError(err error) error {
+	var transitionErr *TransitionError
+	switch {
+	case errors.Is(err, ErrNotFound):
+		return status.Error(codes.NotFound, err.Error())
+	case errors.As(err, &transitionErr):
+		return status.Error(codes.FailedPrecondition, err.Error())
+	case errors.Is(err, ErrStaleCheckpoint), errors.Is(err, ErrConflict):
+		return status.Error(codes.Aborted, err.Error())
+	}
+	return status.Error(codes.Internal, err.Error())
+}
+
+func runToProto(run *Run) *pb.Run {
+	msg := &pb.Run{
+		Id:              run.ID,
+		OrganizationId:  run.OrganizationID,
+		ProjectId:       run.ProjectID,
+		WorkspaceId:     run.WorkspaceID,
+		Prompt:          run.Prompt,
+		Context:         run.Context,
+		State:           string(run.State),
+		ExecutionId:     run.ExecutionID,
+		Error:           run.Error,
+		CreatedBy:       run.CreatedBy,
+		CreatedAtUnixMs: run.CreatedAt.UnixMilli(),
+		UpdatedAtUnixMs: run.UpdatedAt.UnixMilli(),
+	}
+	if run.FinishedAt != nil {
+		msg.FinishedAtUnixMs = run.FinishedAt.UnixMilli()
+	}
+	if run.Checkpoint != nil {
+		msg.Checkpoint = &pb.Checkpoint{
+			Step:          int32(run.Checkpoint.Step),
+			MemoryRefs:    run.Checkpoint.MemoryRefs,
+			TrajectoryId:  run.Checkpoint.TrajectoryID,
+			SavedAtUnixMs: unixMilli(run.Checkpoint.SavedAt),
+		}
+	}
+	return msg
+}
+
+func unixMilli(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.UnixMilli()
+}
+
+// FromProto converts a run received from the AgentRuns service.
+func FromProto(msg *pb.Run) *Run {
+	run := &Run{
+		ID:             msg.Id,
+		OrganizationID: msg.OrganizationId,
+		ProjectID:      msg.ProjectId,
+		WorkspaceID:    msg.WorkspaceId,
+		Prompt:         msg.Prompt,
+		Context:        msg.Context,
+		State:          State(msg.State),
+		ExecutionID:    msg.ExecutionId,
+		Error:          msg.Error,
+		CreatedBy:      msg.CreatedBy,
+		CreatedAt:      time.UnixMilli(msg.CreatedAtUnixMs).UTC(),
+		UpdatedAt:      time.UnixMilli(msg.UpdatedAtUnixMs).UTC(),
+	}
+	if msg.FinishedAtUnixMs != 0 {
+		finishedAt := time.UnixMilli(msg.FinishedAtUnixMs).UTC()
+		run.FinishedAt = &finishedAt
+	}
+	if msg.Checkpoint != nil {
+		run.Checkpoint = &Checkpoint{
+			Step:         int(msg.Checkpoint.Step),
+			MemoryRefs:   msg.Checkpoint.MemoryRefs,
+			TrajectoryID: msg.Checkpoint.TrajectoryId,
+		}
+		if msg.Checkpoint.SavedAtUnixMs != 0 {
+			run.Checkpoint.SavedAt = time.UnixMilli(msg.Checkpoint.SavedAtUnixMs).UTC()
+		}
+	}
+	return run
+}
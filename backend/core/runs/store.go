@@ -0,0 +1,319 @@
+package runs
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/spectrumwebco/agent_runtime/backend/db/integrations"
+)
+
+type Store interface {
+	Create(ctx context.Context, run *Run) error
+	// Get returns the run or ErrNotFound.
+	Get(ctx context.Context, id string) (*Run, error)
+	// List returns the runs of a project, newest first. An empty state
+	// lists every state.
+	List(ctx context.Context, organizationID, projectID string, state State, limit int) ([]*Run, error)
+	// Update saves run if it is still at run.Version, and increments the
+	// version. Otherwise it returns ErrConflict.
+	Update(ctx context.Context, run *Run) error
+}
+
+type MemoryStore struct {
+	runs map[string]*Run
+	mu   sync.Mutex
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{runs: make(map[string]*Run)}
+}
+
+func (s *MemoryStore) Create(ctx context.Context, run *Run) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.runs[run.ID]; ok {
+		return fmt.Errorf("run %s already exists", run.ID)
+	}
+	s.runs[run.ID] = copyRun(run)
+	return nil
+}
+
+func (s *MemoryStore) Get(ctx context.Context, id string) (*Run, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	run, ok := s.runs[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return copyRun(run), nil
+}
+
+func (s *MemoryStore) List(ctx context.Context, organizationID, projectID string, state State, limit int) ([]*Run, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	runs := []*Run{}
+	for _, run := range s.runs {
+		if run.OrganizationID == organizationID && run.ProjectID == projectID && (state == "" || run.State == state) {
+			runs = append(runs, copyRun(run))
+		}
+	}
+	sort.Slice(runs, func(i, j int) bool {
+		return runs[i].CreatedAt.After(runs[j].CreatedAt)
+	})
+	if limit > 0 && len(runs) > limit {
+		runs = runs[:limit]
+	}
+	return runs, nil
+}
+
+func (s *MemoryStore) Update(ctx context.Context, run *Run) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	existing, ok := s.runs[run.ID]
+	if !ok {
+		return ErrNotFound
+	}
+	if existing.Version != run.Version {
+		return ErrConflict
+	}
+	run.Version++
+	s.runs[run.ID] = copyRun(run)
+	return nil
+}
+
+func copyRun(run *Run) *Run {
+	copied := *run
+	if run.Context != nil {
+		copied.Context = make(map[string]string, len(run.Context))
+		for k, v := range run.Context {
+			copied.Context[k] = v
+		}
+	}
+	if run.Checkpoint != nil {
+		checkpoint := *run.Checkpoint
+		checkpoint.MemoryRefs = append([]string(nil), run.Checkpoint.MemoryRefs...)
+		copied.Checkpoint = &checkpoint
+	}
+	return &copied
+}
+
+// PostgresStore keeps runs in app_agent_run.
+type PostgresStore struct {
+	client integrations.SQLStore
+}
+
+func NewPostgresStore(client integrations.SQLStore) *PostgresStore {
+	return &PostgresStore{client: client}
+}
+
+func (s *PostgresStore) EnsureSchema() error {
+	_, err := s.client.ExecuteUpdate(`
+		CREATE TABLE IF NOT EXISTS app_agent_run (
+			id VARCHAR(64) PRIMARY KEY,
+			organization_id VARCHAR(255) NOT NULL,
+			project_id VARCHAR(255) NOT NULL,
+			workspace_id VARCHAR(255) NOT NULL DEFAULT '',
+			prompt TEXT NOT NULL,
+			context JSONB NOT NULL DEFAULT '{}',
+			state VARCHAR(16) NOT NULL,
+			execution_id VARCHAR(255) NOT NULL DEFAULT '',
+			checkpoint JSONB,
+			error TEXT NOT NULL DEFAULT '',
+			created_by VARCHAR(255) NOT NULL DEFAULT '',
+			created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+			updated_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+			finished_at TIMESTAMPTZ,
+			version INTEGER NOT NULL DEFAULT 0
+		);
+		ALTER TABLE app_agent_run ADD COLUMN IF NOT EXISTS correlation_id VARCHAR(255) NOT NULL DEFAULT '';
+		CREATE INDEX IF NOT EXISTS app_agent_run_project_idx ON app_agent_run (organization_id, project_id, created_at DESC)
+	`)
+	if err != nil {
+		return fmt.Errorf("error creating agent run table: %v", err)
+	}
+	return nil
+}
+
+const runColumns = `id, organization_id, project_id, workspace_id, prompt, context, state, execution_id, checkpoint, error, created_by, created_at, updated_at, finished_at, version, correlation_id`
+
+func (s *PostgresStore) Create(ctx context.Context, run *Run) error {
+	runContext, checkpoint, err := encodeRun(run)
+	if err != nil {
+		return err
+	}
+	_, err = s.client.ExecuteUpdate(
+		`INSERT INTO app_agent_run (`+runColumns+`) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16)`,
+		run.ID, run.OrganizationID, run.ProjectID, run.WorkspaceID, run.Prompt, runContext, string(run.State),
+		run.ExecutionID, checkpoint, run.Error, run.CreatedBy, run.CreatedAt.UTC(), run.UpdatedAt.UTC(), run.FinishedAt, run.Version, run.CorrelationID,
+	)
+	if err != nil {
+		return fmt.Errorf("error creating run %s: %v", run.ID, err)
+	}
+	return nil
+}
+
+func (s *PostgresStore) Get(ctx context.Context, id string) (*Run, error) {
+	rows, err := s.client.ExecuteQuery(`SELECT `+runColumns+` FROM app_agent_run WHERE id = $1`, id)
+	if err != nil {
+		return nil, fmt.Errorf("error loading run %s: %v", id, err)
+	}
+	if len(rows) == 0 {
+		return nil, ErrNotFound
+	}
+	return runFromRow(rows[0])
+}
+
+func (s *PostgresStore) List(ctx context.Context, organizationID, projectID string, state State, limit int) ([]*Run, error) {
+	if limit <= 0 {
+		limit = 100
+	}
+	rows, err := s.client.ExecuteQuery(
+		`SELECT `+runColumns+` FROM app_agent_run
+		WHERE organization_id = $1 AND project_id = $2 AND ($3 = '' OR state = $3)
+		ORDER BY created_at DESC LIMIT $4`,
+		organizationID, projectID, string(state), limit,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("error listing runs: %v", err)
+	}
+
+	runs := make([]*Run, 0, len(rows))
+	for _, row := range rows {
+		run, err := runFromRow(row)
+		if err != nil {
+			return nil, err
+		}
+		runs = append(runs, run)
+	}
+	return runs, nil
+}
+
+func (s *PostgresStore) Update(ctx context.Context, run *Run) error {
+	runContext, checkpoint, err := encodeRun(run)
+	if err != nil {
+		return err
+	}
+	updated, err := s.client.ExecuteUpdate(`
+		UPDATE app_agent_run SET context = $3, state = $4, execution_id = $5, checkpoint = $6, error = $7,
+			updated_at = $8, finished_at = $9, version = version + 1
+		WHERE id = $1 AND version = $2`,
+		run.ID, run.Version, runContext, string(run.State), run.ExecutionID, checkpoint, run.Error, run.UpdatedAt.UTC(), run.FinishedAt,
+	)
+	if err != nil {
+		return fmt.Errorf("error updating run %s: %v", run.ID, err)
+	}
+	if updated == 0 {
+		if _, err := s.Get(ctx, run.ID); err != nil {
+			return err
+		}
+		return ErrConflict
+	}
+	run.Version++
+	return nil
+}
+
+// ConfigureDefault returns the store of agent runs. If the runs table cannot
+// be created, runs and their checkpoints are kept in memory and cannot be
+// resumed after a restart.
+func ConfigureDefault(client integrations.SQLStore) Store {
+	store := NewPostgresStore(client)
+	if err := store.EnsureSchema(); err != nil {
+		runsLogger.Printf("Runs falling back to in-memory store: %v", err)
+		return NewMemoryStore()
+	}
+	return store
+}
+
+// encodeRun returns the JSON columns of a run. A missing checkpoint is NULL.
+func encodeRun(run *Run) (string, interface{}, error) {
+	runContext := run.Context
+	if runContext == nil {
+		runContext = map[string]string{}
+	}
+	encodedContext, err := json.Marshal(runContext)
+	if err != nil {
+		return "", nil, err
+	}
+	if run.Checkpoint == nil {
+		return string(encodedContext), nil, nil
+	}
+	checkpoint, err := json.Marshal(run.Checkpoint)
+	if err != nil {
+		return "", nil, err
+	}
+	return string(encodedContext), string(checkpoint), nil
+}
+
+func runFromRow(row map[string]interface{}) (*Run, error) {
+	run := &Run{
+		ID:             toString(row["id"]),
+		OrganizationID: toString(row["organization_id"]),
+		ProjectID:      toString(row["project_id"]),
+		WorkspaceID:    toString(row["workspace_id"]),
+		Prompt:         toString(row["prompt"]),
+		State:          State(toString(row["state"])),
+		ExecutionID:    toString(row["execution_id"]),
+		Error:          toString(row["error"]),
+		CreatedBy:      toString(row["created_by"]),
+		CorrelationID:  toString(row["correlation_id"]),
+		Version:        toInt(row["version"]),
+	}
+	if createdAt, ok := row["created_at"].(time.Time); ok {
+		run.CreatedAt = createdAt.UTC()
+	}
+	if updatedAt, ok := row["updated_at"].(time.Time); ok {
+		run.UpdatedAt = updatedAt.UTC()
+	}
+	if finishedAt, ok := row["finished_at"].(time.Time); ok {
+		finishedAt = finishedAt.UTC()
+		run.FinishedAt = &finishedAt
+	}
+
+	if encoded := toString(row["context"]); encoded != "" {
+		if err := json.Unmarshal([]byte(encoded), &run.Context); err != nil {
+			return nil, fmt.Errorf("error decoding context of run %s: %v", run.ID, err)
+		}
+	}
+	if encoded := toString(row["checkpoint"]); encoded != "" {
+		run.Checkpoint = &Checkpoint{}
+		if err := json.Unmarshal([]byte(encoded), run.Checkpoint); err != nil {
+			return nil, fmt.Errorf("error decoding checkpoint of run %s: %v", run.ID, err)
+		}
+	}
+	return run, nil
+}
+
+func toString(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case []byte:
+		return string(v)
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+func toInt(value interface{}) int {
+	switch v := value.(type) {
+	case int64:
+		return int(v)
+	case int32:
+		return int(v)
+	case int:
+		return v
+	case float64:
+		return int(v)
+	}
+	var n int
+	fmt.Sscan(toString(value), &n)
+	return n
+}
@@ -0,0 +1,54 @@
+package runs
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/spectrumwebco/agent_runtime/backend/core/agentcmd"
+)
+
+// RunSignalCommand is the agent command delivering a Signal to the agent of
+// the run's workspace.
+const RunSignalCommand = "run_signal"
+
+// signalTimeout is short because runtimes missing a signal still learn the
+// state from their next checkpoint.
+const signalTimeout = 10 * time.Second
+
+// RunSignal are the params of a RunSignalCommand.
+type RunSignal struct {
+	RunID  string `json:"run_id"`
+	Signal Signal `json:"signal"`
+}
+
+// WorkspaceSignaler sends signals to the agent of a run's workspace. Runs
+// without a workspace, and agents not connected to this replica, are
+// skipped.
+type WorkspaceSignaler struct {
+	dispatcher *agentcmd.Dispatcher
+}
+
+func NewWorkspaceSignaler(dispatcher *agentcmd.Dispatcher) *WorkspaceSignaler {
+	return &WorkspaceSignaler{dispatcher: dispatcher}
+}
+
+func (s *WorkspaceSignaler) Signal(ctx context.Context, run *Run, signal Signal) error {
+	if run.WorkspaceID == "" || !s.dispatcher.Connected(run.WorkspaceID) {
+		return nil
+	}
+
+	params, err := json.Marshal(RunSignal{RunID: run.ID, Signal: signal})
+	if err != nil {
+		return err
+	}
+	result, err := s.dispatcher.Execute(ctx, run.WorkspaceID, RunSignalCommand, params, agentcmd.Options{Timeout: signalTimeout})
+	if err != nil {
+		return err
+	}
+	if !result.Success {
+		return fmt.Errorf("workspace %s rejected the signal: %s", run.WorkspaceID, result.Error)
+	}
+	return nil
+}
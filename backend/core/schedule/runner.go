@@ -0,0 +1,96 @@
+package schedule
+
+import (
+	"context"
+	"log"
+	"os"
+	"time"
+)
+
+var scheduleLogger = log.New(os.Stdout, "kled.schedule: ", log.LstdFlags)
+
+// Controller starts and stops workspaces, such as workspace.Controller.
+type Controller interface {
+	Start(ctx context.Context, workspaceID string) error
+	Stop(ctx context.Context, workspaceID string) error
+}
+
+// Runner evaluates the schedules of all workspaces.
+type Runner struct {
+	store      Store
+	controller Controller
+	now        func() time.Time
+}
+
+func NewRunner(store Store, controller Controller) *Runner {
+	return &Runner{store: store, controller: controller, now: time.Now}
+}
+
+// Run starts and stops the workspaces due since the previous run and
+// returns how many were started and stopped. A failing schedule doesn't stop
+// the others and is retried on the next run; the first error is returned.
+func (r *Runner) Run(ctx context.Context) (int, int, error) {
+	schedules, err := r.store.Schedules(ctx)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	now := r.now()
+	holidays := map[string]map[string]bool{}
+	started, stopped := 0, 0
+	var firstErr error
+	for _, schedule := range schedules {
+		if err := ctx.Err(); err != nil {
+			return started, stopped, err
+		}
+
+		action, err := r.evaluate(ctx, schedule, now, holidays)
+		if err != nil {
+			scheduleLogger.Printf("Error running schedule of workspace %s: %v", schedule.WorkspaceID, err)
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+
+		switch action {
+		case ActionStart:
+			started++
+		case ActionStop:
+			stopped++
+		}
+	}
+	return started, stopped, firstErr
+}
+
+func (r *Runner) evaluate(ctx context.Context, schedule Schedule, now time.Time, holidays map[string]map[string]bool) (Action, error) {
+	orgHolidays, ok := holidays[schedule.OrganizationID]
+	if !ok && !schedule.IgnoreHolidays {
+		list, err := r.store.Holidays(ctx, schedule.OrganizationID)
+		if err != nil {
+			return "", err
+		}
+		orgHolidays = HolidaySet(list)
+		holidays[schedule.OrganizationID] = orgHolidays
+	}
+
+	after := schedule.CheckedAt
+	if after.IsZero() {
+		after = schedule.UpdatedAt
+	}
+	action, _, err := schedule.Due(after, now, orgHolidays)
+	if err != nil {
+		return "", err
+	}
+
+	switch action {
+	case ActionStart:
+		err = r.controller.Start(ctx, schedule.WorkspaceID)
+	case ActionStop:
+		err = r.controller.Stop(ctx, schedule.WorkspaceID)
+	}
+	if err != nil {
+		return "", err
+	}
+	return action, r.store.MarkChecked(ctx, schedule.WorkspaceID, now)
+}
@@ -0,0 +1,192 @@
+// Package schedule starts and stops workspaces on cron calendars.
+//
+// A workspace schedule has a start and a stop cron expression, evaluated in
+// the timezone of the schedule. The workspace-schedules job runs every
+// minute and starts or stops the workspace for the latest activation since
+// its previous run. Activations on a holiday of the workspace's
+// organization are skipped unless the schedule ignores holidays.
+package schedule
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/spectrumwebco/agent_runtime/backend/core/jobs"
+)
+
+type Action string
+
+const (
+	ActionStart Action = "start"
+	ActionStop  Action = "stop"
+)
+
+// DateLayout is the layout of holiday dates.
+const DateLayout = "2006-01-02"
+
+// MaxCatchUp bounds how far back missed activations are considered, so a
+// scheduler that was down for days doesn't act on stale activations.
+const MaxCatchUp = 24 * time.Hour
+
+type Schedule struct {
+	WorkspaceID    string `json:"workspace_id"`
+	OrganizationID string `json:"organization_id"`
+	// Start and Stop are cron expressions accepted by jobs.ParseSchedule.
+	// Either may be empty.
+	Start string `json:"start,omitempty"`
+	Stop  string `json:"stop,omitempty"`
+	// Timezone is an IANA timezone such as "Europe/Berlin". Defaults to UTC.
+	Timezone string `json:"timezone"`
+	// IgnoreHolidays runs the schedule on the organization's holidays too.
+	IgnoreHolidays bool `json:"ignore_holidays,omitempty"`
+
+	UpdatedAt time.Time `json:"updated_at"`
+	// CheckedAt is when the schedule was last evaluated. Activations up to
+	// then have been handled.
+	CheckedAt time.Time `json:"checked_at,omitempty"`
+}
+
+func (s Schedule) Validate() error {
+	if s.WorkspaceID == "" {
+		return fmt.Errorf("workspace_id is required")
+	}
+	if s.Start == "" && s.Stop == "" {
+		return fmt.Errorf("start or stop is required")
+	}
+	if s.Start != "" {
+		if _, err := jobs.ParseSchedule(s.Start); err != nil {
+			return fmt.Errorf("start: %v", err)
+		}
+	}
+	if s.Stop != "" {
+		if _, err := jobs.ParseSchedule(s.Stop); err != nil {
+			return fmt.Errorf("stop: %v", err)
+		}
+	}
+	if _, err := s.Location(); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (s Schedule) Location() (*time.Location, error) {
+	if s.Timezone == "" {
+		return time.UTC, nil
+	}
+	location, err := time.LoadLocation(s.Timezone)
+	if err != nil {
+		return nil, fmt.Errorf("unknown timezone %q", s.Timezone)
+	}
+	return location, nil
+}
+
+// Next returns the first start or stop later than after, skipping holidays. The
+// returned time is in the timezone of the schedule and zero if nothing is
+// scheduled.
+func (s Schedule) Next(after time.Time, holidays map[string]bool) (Action, time.Time, error) {
+	location, err := s.Location()
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	var (
+		next   time.Time
+		action Action
+	)
+	for _, entry := range []struct {
+		action Action
+		expr   string
+	}{{ActionStart, s.Start}, {ActionStop, s.Stop}} {
+		if entry.expr == "" {
+			continue
+		}
+		t, err := nextActivation(entry.expr, after.In(location), s.holidays(holidays))
+		if err != nil {
+			return "", time.Time{}, err
+		}
+		if !t.IsZero() && (next.IsZero() || t.Before(next)) {
+			next, action = t, entry.action
+		}
+	}
+	return action, next, nil
+}
+
+// Due returns the latest start or stop in (after, now], skipping holidays,
+// or an empty action if there is none. Activations more than MaxCatchUp
+// before now are ignored.
+func (s Schedule) Due(after, now time.Time, holidays map[string]bool) (Action, time.Time, error) {
+	if now.Sub(after) > MaxCatchUp {
+		after = now.Add(-MaxCatchUp)
+	}
+
+	var (
+		due    time.Time
+		action Action
+	)
+	for t := after; ; {
+		next, nextTime, err := s.Next(t, holidays)
+		if err != nil {
+			return "", time.Time{}, err
+		}
+		if nextTime.IsZero() || nextTime.After(now) {
+			break
+		}
+		due, action = nextTime, next
+		t = nextTime
+	}
+	return action, due, nil
+}
+
+func (s Schedule) holidays(holidays map[string]bool) map[string]bool {
+	if s.IgnoreHolidays {
+		return nil
+	}
+	return holidays
+}
+
+// nextActivation returns the first activation of expr later than after that
+// isn't on a holiday.
+func nextActivation(expr string, after time.Time, holidays map[string]bool) (time.Time, error) {
+	cron, err := jobs.ParseSchedule(expr)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	// a year of holidays in a row ends the search
+	for i := 0; i < 366; i++ {
+		t := cron.Next(after)
+		if t.IsZero() || !holidays[t.Format(DateLayout)] {
+			return t, nil
+		}
+		// continue with the first minute of the next day
+		after = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location()).Add(-time.Minute)
+	}
+	return time.Time{}, nil
+}
+
+// Holiday is a day on which the schedules of an organization don't run.
+type Holiday struct {
+	OrganizationID string `json:"organization_id"`
+	// Date is a day such as "2026-12-24" in the timezone of each schedule.
+	Date string `json:"date"`
+	Name string `json:"name,omitempty"`
+}
+
+func (h Holiday) Validate() error {
+	if h.OrganizationID == "" {
+		return fmt.Errorf("organization_id is required")
+	}
+	if _, err := time.Parse(DateLayout, h.Date); err != nil {
+		return fmt.Errorf("date must be YYYY-MM-DD, got %q", h.Date)
+	}
+	return nil
+}
+
+// HolidaySet returns the dates of holidays as a set.
+func HolidaySet(holidays []Holiday) map[string]bool {
+	set := make(map[string]bool, len(holidays))
+	for _, holiday := range holidays {
+		set[holiday.Date] = true
+	}
+	return set
+}
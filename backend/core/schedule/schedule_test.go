@@ -0,0 +1,191 @@
+package schedule
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func mustLocation(t *testing.T, name string) *time.Location {
+	t.Helper()
+
+	location, err := time.LoadLocation(name)
+	if err != nil {
+		t.Skipf("timezone %s not available: %v", name, err)
+	}
+	return location
+}
+
+func TestValidate(t *testing.T) {
+	valid := Schedule{WorkspaceID: "ws-1", Start: "0 9 * * 1-5", Stop: "0 19 * * 1-5", Timezone: "UTC"}
+	if err := valid.Validate(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	for name, schedule := range map[string]Schedule{
+		"no workspace": {Start: "0 9 * * *"},
+		"no times":     {WorkspaceID: "ws-1"},
+		"bad start":    {WorkspaceID: "ws-1", Start: "0 25 * * *"},
+		"bad stop":     {WorkspaceID: "ws-1", Stop: "every day"},
+		"bad timezone": {WorkspaceID: "ws-1", Start: "0 9 * * *", Timezone: "Mars/Olympus"},
+	} {
+		if err := schedule.Validate(); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
+
+func TestDueInTimezone(t *testing.T) {
+	berlin := mustLocation(t, "Europe/Berlin")
+	schedule := Schedule{WorkspaceID: "ws-1", Start: "0 9 * * 1-5", Stop: "0 19 * * 1-5", Timezone: "Europe/Berlin"}
+
+	// Monday 2026-10-12, 09:00 in Berlin is 07:00 UTC
+	after := time.Date(2026, 10, 12, 6, 59, 0, 0, time.UTC)
+	action, at, err := schedule.Due(after, time.Date(2026, 10, 12, 7, 0, 30, 0, time.UTC), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if action != ActionStart || !at.Equal(time.Date(2026, 10, 12, 9, 0, 0, 0, berlin)) {
+		t.Errorf("expected start at 09:00 Berlin, got %s at %s", action, at)
+	}
+
+	// nothing is due before 09:00 in Berlin
+	action, _, err = schedule.Due(after, time.Date(2026, 10, 12, 6, 59, 59, 0, time.UTC), nil)
+	if err != nil || action != "" {
+		t.Errorf("expected nothing due, got %q, %v", action, err)
+	}
+
+	// after a missed day the latest activation wins
+	action, at, err = schedule.Due(after, time.Date(2026, 10, 12, 20, 0, 0, 0, time.UTC), nil)
+	if err != nil || action != ActionStop || at.Hour() != 19 {
+		t.Errorf("expected stop at 19:00, got %s at %s, %v", action, at, err)
+	}
+
+	// the weekend has no activations
+	action, _, err = schedule.Due(time.Date(2026, 10, 17, 0, 0, 0, 0, time.UTC), time.Date(2026, 10, 18, 23, 0, 0, 0, time.UTC), nil)
+	if err != nil || action != "" {
+		t.Errorf("expected nothing due on the weekend, got %q, %v", action, err)
+	}
+}
+
+func TestDueAcrossDaylightSavingTime(t *testing.T) {
+	berlin := mustLocation(t, "Europe/Berlin")
+	schedule := Schedule{WorkspaceID: "ws-1", Start: "0 9 * * *", Timezone: "Europe/Berlin"}
+
+	// Berlin switches to winter time on 2026-10-25, 09:00 is 08:00 UTC then
+	action, at, err := schedule.Due(time.Date(2026, 10, 25, 7, 30, 0, 0, time.UTC), time.Date(2026, 10, 25, 8, 0, 0, 0, time.UTC), nil)
+	if err != nil || action != ActionStart || !at.Equal(time.Date(2026, 10, 25, 9, 0, 0, 0, berlin)) {
+		t.Errorf("expected start at 09:00 winter time, got %s at %s, %v", action, at, err)
+	}
+}
+
+func TestHolidays(t *testing.T) {
+	schedule := Schedule{WorkspaceID: "ws-1", Start: "0 9 * * *", Timezone: "UTC"}
+	holidays := HolidaySet([]Holiday{{OrganizationID: "org", Date: "2026-12-24"}, {OrganizationID: "org", Date: "2026-12-25"}})
+
+	after := time.Date(2026, 12, 24, 0, 0, 0, 0, time.UTC)
+	action, _, err := schedule.Due(after, time.Date(2026, 12, 24, 10, 0, 0, 0, time.UTC), holidays)
+	if err != nil || action != "" {
+		t.Errorf("expected nothing due on a holiday, got %q, %v", action, err)
+	}
+
+	_, next, err := schedule.Next(after, holidays)
+	if err != nil || !next.Equal(time.Date(2026, 12, 26, 9, 0, 0, 0, time.UTC)) {
+		t.Errorf("expected the next start after the holidays, got %s, %v", next, err)
+	}
+
+	schedule.IgnoreHolidays = true
+	action, _, err = schedule.Due(after, time.Date(2026, 12, 24, 10, 0, 0, 0, time.UTC), holidays)
+	if err != nil || action != ActionStart {
+		t.Errorf("expected start when ignoring holidays, got %q, %v", action, err)
+	}
+
+	if err := (Holiday{OrganizationID: "org", Date: "24.12.2026"}).Validate(); err == nil {
+		t.Error("expected an error for an invalid date")
+	}
+}
+
+func TestDueSkipsStaleActivations(t *testing.T) {
+	schedule := Schedule{WorkspaceID: "ws-1", Start: "0 9 * * 1", Timezone: "UTC"}
+
+	// the scheduler was down since before Monday's start
+	action, at, err := schedule.Due(time.Date(2026, 9, 28, 0, 0, 0, 0, time.UTC), time.Date(2026, 10, 1, 8, 0, 0, 0, time.UTC), nil)
+	if err != nil || action != "" {
+		t.Errorf("expected nothing due, got %s at %s, %v", action, at, err)
+	}
+}
+
+type fakeController struct {
+	started, stopped []string
+	err              error
+}
+
+func (c *fakeController) Start(ctx context.Context, workspaceID string) error {
+	if c.err != nil {
+		return c.err
+	}
+	c.started = append(c.started, workspaceID)
+	return nil
+}
+
+func (c *fakeController) Stop(ctx context.Context, workspaceID string) error {
+	if c.err != nil {
+		return c.err
+	}
+	c.stopped = append(c.stopped, workspaceID)
+	return nil
+}
+
+func TestRunner(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore()
+	controller := &fakeController{}
+	runner := NewRunner(store, controller)
+
+	updated := time.Date(2026, 12, 23, 8, 0, 0, 0, time.UTC)
+	for _, schedule := range []Schedule{
+		{WorkspaceID: "ws-1", OrganizationID: "org-a", Start: "0 9 * * *", Stop: "0 18 * * *", UpdatedAt: updated},
+		{WorkspaceID: "ws-2", OrganizationID: "org-b", Start: "0 9 * * *", UpdatedAt: updated},
+	} {
+		if err := store.SetSchedule(ctx, schedule); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := store.SetHoliday(ctx, Holiday{OrganizationID: "org-b", Date: "2026-12-24", Name: "Christmas Eve"}); err != nil {
+		t.Fatal(err)
+	}
+
+	runner.now = func() time.Time { return time.Date(2026, 12, 23, 9, 0, 10, 0, time.UTC) }
+	started, stopped, err := runner.Run(ctx)
+	if err != nil || started != 2 || stopped != 0 {
+		t.Fatalf("expected 2 starts, got %d starts, %d stops, %v", started, stopped, err)
+	}
+
+	// the same minute doesn't run twice
+	started, _, err = runner.Run(ctx)
+	if err != nil || started != 0 {
+		t.Fatalf("expected no starts, got %d, %v", started, err)
+	}
+
+	runner.now = func() time.Time { return time.Date(2026, 12, 24, 9, 0, 10, 0, time.UTC) }
+	started, stopped, err = runner.Run(ctx)
+	if err != nil || started != 1 || stopped != 0 {
+		t.Fatalf("expected only ws-1 to start on the holiday of org-b, got %d starts, %d stops, %v", started, stopped, err)
+	}
+	if len(controller.started) != 3 || controller.started[2] != "ws-1" {
+		t.Errorf("unexpected starts %v", controller.started)
+	}
+
+	// failed commands are retried on the next run
+	controller.err = errors.New("queue down")
+	runner.now = func() time.Time { return time.Date(2026, 12, 24, 18, 0, 10, 0, time.UTC) }
+	if _, _, err := runner.Run(ctx); err == nil {
+		t.Fatal("expected an error")
+	}
+	controller.err = nil
+	runner.now = func() time.Time { return time.Date(2026, 12, 24, 18, 1, 10, 0, time.UTC) }
+	if _, stopped, err := runner.Run(ctx); err != nil || stopped != 1 {
+		t.Fatalf("expected the stop to be retried, got %d, %v", stopped, err)
+	}
+}
@@ -0,0 +1,307 @@
+package schedule
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/spectrumwebco/agent_runtime/backend/db/integrations"
+)
+
+// Store persists workspace schedules and the holidays of organizations.
+type Store interface {
+	// Schedule returns the workspace's schedule and whether it has one.
+	Schedule(ctx context.Context, workspaceID string) (Schedule, bool, error)
+	// SetSchedule saves the schedule as checked at its UpdatedAt, so that
+	// activations before the change don't run.
+	SetSchedule(ctx context.Context, schedule Schedule) error
+	DeleteSchedule(ctx context.Context, workspaceID string) error
+	Schedules(ctx context.Context) ([]Schedule, error)
+	// MarkChecked records that the schedule was evaluated up to at.
+	MarkChecked(ctx context.Context, workspaceID string, at time.Time) error
+
+	Holidays(ctx context.Context, organizationID string) ([]Holiday, error)
+	SetHoliday(ctx context.Context, holiday Holiday) error
+	DeleteHoliday(ctx context.Context, organizationID, date string) error
+}
+
+type MemoryStore struct {
+	schedules map[string]Schedule
+	holidays  map[string]map[string]Holiday
+	mu        sync.RWMutex
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		schedules: make(map[string]Schedule),
+		holidays:  make(map[string]map[string]Holiday),
+	}
+}
+
+func (s *MemoryStore) Schedule(ctx context.Context, workspaceID string) (Schedule, bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	schedule, ok := s.schedules[workspaceID]
+	return schedule, ok, nil
+}
+
+func (s *MemoryStore) SetSchedule(ctx context.Context, schedule Schedule) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	schedule.CheckedAt = schedule.UpdatedAt
+	s.schedules[schedule.WorkspaceID] = schedule
+	return nil
+}
+
+func (s *MemoryStore) DeleteSchedule(ctx context.Context, workspaceID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.schedules, workspaceID)
+	return nil
+}
+
+func (s *MemoryStore) Schedules(ctx context.Context) ([]Schedule, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	schedules := make([]Schedule, 0, len(s.schedules))
+	for _, schedule := range s.schedules {
+		schedules = append(schedules, schedule)
+	}
+	sort.Slice(schedules, func(i, j int) bool {
+		return schedules[i].WorkspaceID < schedules[j].WorkspaceID
+	})
+	return schedules, nil
+}
+
+func (s *MemoryStore) MarkChecked(ctx context.Context, workspaceID string, at time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if schedule, ok := s.schedules[workspaceID]; ok {
+		schedule.CheckedAt = at
+		s.schedules[workspaceID] = schedule
+	}
+	return nil
+}
+
+func (s *MemoryStore) Holidays(ctx context.Context, organizationID string) ([]Holiday, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	holidays := make([]Holiday, 0, len(s.holidays[organizationID]))
+	for _, holiday := range s.holidays[organizationID] {
+		holidays = append(holidays, holiday)
+	}
+	sort.Slice(holidays, func(i, j int) bool {
+		return holidays[i].Date < holidays[j].Date
+	})
+	return holidays, nil
+}
+
+func (s *MemoryStore) SetHoliday(ctx context.Context, holiday Holiday) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.holidays[holiday.OrganizationID] == nil {
+		s.holidays[holiday.OrganizationID] = make(map[string]Holiday)
+	}
+	s.holidays[holiday.OrganizationID][holiday.Date] = holiday
+	return nil
+}
+
+func (s *MemoryStore) DeleteHoliday(ctx context.Context, organizationID, date string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.holidays[organizationID], date)
+	return nil
+}
+
+// PostgresStore keeps schedules in app_workspace_schedule and holidays in
+// app_organization_holiday.
+type PostgresStore struct {
+	client integrations.SQLStore
+}
+
+func NewPostgresStore(client integrations.SQLStore) *PostgresStore {
+	return &PostgresStore{client: client}
+}
+
+func (s *PostgresStore) EnsureSchema() error {
+	_, err := s.client.ExecuteUpdate(`
+		CREATE TABLE IF NOT EXISTS app_workspace_schedule (
+			workspace_id VARCHAR(255) PRIMARY KEY,
+			organization_id VARCHAR(255) NOT NULL,
+			start_cron VARCHAR(255) NOT NULL DEFAULT '',
+			stop_cron VARCHAR(255) NOT NULL DEFAULT '',
+			timezone VARCHAR(64) NOT NULL DEFAULT 'UTC',
+			ignore_holidays BOOLEAN NOT NULL DEFAULT false,
+			updated_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+			checked_at TIMESTAMPTZ
+		)
+	`)
+	if err != nil {
+		return fmt.Errorf("error creating workspace schedule table: %v", err)
+	}
+
+	_, err = s.client.ExecuteUpdate(`
+		CREATE TABLE IF NOT EXISTS app_organization_holiday (
+			organization_id VARCHAR(255) NOT NULL,
+			date DATE NOT NULL,
+			name VARCHAR(255) NOT NULL DEFAULT '',
+			PRIMARY KEY (organization_id, date)
+		)
+	`)
+	if err != nil {
+		return fmt.Errorf("error creating organization holiday table: %v", err)
+	}
+	return nil
+}
+
+const scheduleColumns = `workspace_id, organization_id, start_cron, stop_cron, timezone, ignore_holidays, updated_at, checked_at`
+
+func (s *PostgresStore) Schedule(ctx context.Context, workspaceID string) (Schedule, bool, error) {
+	rows, err := s.client.ExecuteQuery(`SELECT `+scheduleColumns+` FROM app_workspace_schedule WHERE workspace_id = $1`, workspaceID)
+	if err != nil {
+		return Schedule{}, false, fmt.Errorf("error loading schedule of workspace %s: %v", workspaceID, err)
+	}
+	if len(rows) == 0 {
+		return Schedule{}, false, nil
+	}
+	return scheduleFromRow(rows[0]), true, nil
+}
+
+func (s *PostgresStore) SetSchedule(ctx context.Context, schedule Schedule) error {
+	_, err := s.client.ExecuteUpdate(`
+		INSERT INTO app_workspace_schedule (workspace_id, organization_id, start_cron, stop_cron, timezone, ignore_holidays, updated_at, checked_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $7)
+		ON CONFLICT (workspace_id) DO UPDATE SET
+			start_cron = EXCLUDED.start_cron,
+			stop_cron = EXCLUDED.stop_cron,
+			timezone = EXCLUDED.timezone,
+			ignore_holidays = EXCLUDED.ignore_holidays,
+			updated_at = EXCLUDED.updated_at,
+			checked_at = EXCLUDED.checked_at
+	`, schedule.WorkspaceID, schedule.OrganizationID, schedule.Start, schedule.Stop, schedule.Timezone, schedule.IgnoreHolidays, schedule.UpdatedAt)
+	if err != nil {
+		return fmt.Errorf("error saving schedule of workspace %s: %v", schedule.WorkspaceID, err)
+	}
+	return nil
+}
+
+func (s *PostgresStore) DeleteSchedule(ctx context.Context, workspaceID string) error {
+	if _, err := s.client.ExecuteUpdate(`DELETE FROM app_workspace_schedule WHERE workspace_id = $1`, workspaceID); err != nil {
+		return fmt.Errorf("error deleting schedule of workspace %s: %v", workspaceID, err)
+	}
+	return nil
+}
+
+func (s *PostgresStore) Schedules(ctx context.Context) ([]Schedule, error) {
+	rows, err := s.client.ExecuteQuery(`SELECT ` + scheduleColumns + ` FROM app_workspace_schedule ORDER BY workspace_id`)
+	if err != nil {
+		return nil, fmt.Errorf("error listing workspace schedules: %v", err)
+	}
+
+	schedules := make([]Schedule, 0, len(rows))
+	for _, row := range rows {
+		schedules = append(schedules, scheduleFromRow(row))
+	}
+	return schedules, nil
+}
+
+func (s *PostgresStore) MarkChecked(ctx context.Context, workspaceID string, at time.Time) error {
+	if _, err := s.client.ExecuteUpdate(`UPDATE app_workspace_schedule SET checked_at = $2 WHERE workspace_id = $1`, workspaceID, at); err != nil {
+		return fmt.Errorf("error updating schedule of workspace %s: %v", workspaceID, err)
+	}
+	return nil
+}
+
+func (s *PostgresStore) Holidays(ctx context.Context, organizationID string) ([]Holiday, error) {
+	rows, err := s.client.ExecuteQuery(`
+		SELECT organization_id, to_char(date, 'YYYY-MM-DD') AS date, name FROM app_organization_holiday
+		WHERE organization_id = $1 ORDER BY date
+	`, organizationID)
+	if err != nil {
+		return nil, fmt.Errorf("error listing holidays of organization %s: %v", organizationID, err)
+	}
+
+	holidays := make([]Holiday, 0, len(rows))
+	for _, row := range rows {
+		holidays = append(holidays, Holiday{
+			OrganizationID: fmt.Sprint(row["organization_id"]),
+			Date:           toString(row["date"]),
+			Name:           toString(row["name"]),
+		})
+	}
+	return holidays, nil
+}
+
+func (s *PostgresStore) SetHoliday(ctx context.Context, holiday Holiday) error {
+	_, err := s.client.ExecuteUpdate(`
+		INSERT INTO app_organization_holiday (organization_id, date, name) VALUES ($1, $2, $3)
+		ON CONFLICT (organization_id, date) DO UPDATE SET name = EXCLUDED.name
+	`, holiday.OrganizationID, holiday.Date, holiday.Name)
+	if err != nil {
+		return fmt.Errorf("error saving holiday %s: %v", holiday.Date, err)
+	}
+	return nil
+}
+
+func (s *PostgresStore) DeleteHoliday(ctx context.Context, organizationID, date string) error {
+	if _, err := s.client.ExecuteUpdate(`DELETE FROM app_organization_holiday WHERE organization_id = $1 AND date = $2`, organizationID, date); err != nil {
+		return fmt.Errorf("error deleting holiday %s: %v", date, err)
+	}
+	return nil
+}
+
+func scheduleFromRow(row map[string]interface{}) Schedule {
+	schedule := Schedule{
+		WorkspaceID:    fmt.Sprint(row["workspace_id"]),
+		OrganizationID: fmt.Sprint(row["organization_id"]),
+		Start:          toString(row["start_cron"]),
+		Stop:           toString(row["stop_cron"]),
+		Timezone:       toString(row["timezone"]),
+		UpdatedAt:      toTime(row["updated_at"]),
+		CheckedAt:      toTime(row["checked_at"]),
+	}
+	switch v := row["ignore_holidays"].(type) {
+	case bool:
+		schedule.IgnoreHolidays = v
+	case string:
+		schedule.IgnoreHolidays, _ = strconv.ParseBool(v)
+	}
+	return schedule
+}
+
+func toString(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case []byte:
+		return string(v)
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+func toTime(value interface{}) time.Time {
+	switch v := value.(type) {
+	case time.Time:
+		return v.UTC()
+	case string:
+		t, _ := time.Parse(time.RFC3339Nano, v)
+		return t
+	case []byte:
+		t, _ := time.Parse(time.RFC3339Nano, string(v))
+		return t
+	default:
+		return time.Time{}
+	}
+}
@@ -0,0 +1,59 @@
+package sessions
+
+import (
+	"log"
+	"os"
+	"time"
+
+	"github.com/spectrumwebco/agent_runtime/backend/core/config/env"
+)
+
+var sessionsLogger = log.New(os.Stdout, "kled.sessions: ", log.LstdFlags)
+
+type Config struct {
+	// TTL is how long a session lasts without being refreshed.
+	TTL time.Duration `json:"ttl"`
+	// MaxLifetime ends sessions this long after they were created, however
+	// often they are refreshed.
+	MaxLifetime time.Duration `json:"max_lifetime"`
+	// AccessTokenTTL is how long the access tokens handed out with the
+	// refresh tokens are valid.
+	AccessTokenTTL time.Duration `json:"access_token_ttl"`
+	// ReuseGrace is how long the previous refresh token of a session may be
+	// presented again, e.g. by a client retrying a refresh whose response it
+	// lost, without being taken for a stolen token.
+	ReuseGrace time.Duration `json:"reuse_grace"`
+	// RevocationCacheTTL is how long whether a session was revoked is
+	// cached for the access tokens of the session. Access tokens of a
+	// session revoked by another replica keep working for up to this long.
+	RevocationCacheTTL time.Duration `json:"revocation_cache_ttl"`
+}
+
+const (
+	DefaultTTL            = 14 * 24 * time.Hour
+	DefaultMaxLifetime    = 90 * 24 * time.Hour
+	DefaultAccessTokenTTL = 15 * time.Minute
+	DefaultReuseGrace     = 10 * time.Second
+	// DefaultRevocationCacheTTL keeps the session lookups of access tokens
+	// to one per session and replica every half minute.
+	DefaultRevocationCacheTTL = 30 * time.Second
+)
+
+var Default = env.Once(FromEnv)
+
+func FromEnv() Config {
+	config := Config{
+		TTL:                DefaultTTL,
+		MaxLifetime:        DefaultMaxLifetime,
+		AccessTokenTTL:     DefaultAccessTokenTTL,
+		ReuseGrace:         DefaultReuseGrace,
+		RevocationCacheTTL: DefaultRevocationCacheTTL,
+	}
+	read := env.NewReader(sessionsLogger)
+	read.Duration("AGENT_SESSIONS_TTL", &config.TTL, 0)
+	read.Duration("AGENT_SESSIONS_MAX_LIFETIME", &config.MaxLifetime, 0)
+	read.Duration("AGENT_SESSIONS_ACCESS_TOKEN_TTL", &config.AccessTokenTTL, 0)
+	read.Duration("AGENT_SESSIONS_REUSE_GRACE", &config.ReuseGrace, 0)
+	read.Duration("AGENT_SESSIONS_REVOCATION_CACHE_TTL", &config.RevocationCacheTTL, 0)
+	return config
+}
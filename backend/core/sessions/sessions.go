@@ -0,0 +1,318 @@
+// Package sessions keeps the sign-in sessions of users, each with a refresh
+// token that is exchanged for a new one on every use.
+//
+// Only hashes of refresh tokens are stored. A token that was already
+// exchanged and is presented again means two parties hold it, so the
+// session, the family of all tokens descending from its first one, is
+// revoked and every holder has to sign in again. Clients retrying a refresh
+// whose response they lost get a grace period instead.
+package sessions
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/spectrumwebco/agent_runtime/backend/core/kerrors"
+)
+
+// TokenPrefix starts every refresh token, so leaked ones are easy to spot.
+const TokenPrefix = "ksr_"
+
+// The reasons sessions are revoked for.
+const (
+	ReasonSignedOut    = "signed_out"
+	ReasonRevoked      = "revoked"
+	ReasonTokenReused  = "refresh_token_reused"
+	ReasonRevokeOthers = "revoked_other_sessions"
+)
+
+var (
+	ErrNotFound = kerrors.New(kerrors.NotFound, "session not found")
+	// ErrConflict is returned by stores when the token was exchanged
+	// concurrently.
+	ErrConflict     = kerrors.New(kerrors.Conflict, "refresh token was exchanged concurrently")
+	ErrInvalidToken = kerrors.New(kerrors.NotAuthenticated, "invalid refresh token")
+	ErrExpired      = kerrors.New(kerrors.NotAuthenticated, "session expired")
+	ErrRevoked      = kerrors.New(kerrors.NotAuthenticated, "session revoked")
+	// ErrTokenReused is returned when a refresh token is used twice. The
+	// session has been revoked by then.
+	ErrTokenReused = kerrors.New(kerrors.NotAuthenticated, "refresh token was already used, the session has been revoked")
+)
+
+// Device describes where a session is used from. The IP address and user
+// agent are updated on every refresh.
+type Device struct {
+	Name      string `json:"name,omitempty"`
+	Platform  string `json:"platform,omitempty"`
+	UserAgent string `json:"user_agent,omitempty"`
+	IPAddress string `json:"ip_address,omitempty"`
+}
+
+type Session struct {
+	ID             string     `json:"id"`
+	UserID         string     `json:"user_id"`
+	OrganizationID string     `json:"organization_id,omitempty"`
+	Device         Device     `json:"device"`
+	CreatedAt      time.Time  `json:"created_at"`
+	LastUsedAt     time.Time  `json:"last_used_at"`
+	ExpiresAt      time.Time  `json:"expires_at"`
+	RevokedAt      *time.Time `json:"revoked_at,omitempty"`
+	RevokedReason  string     `json:"revoked_reason,omitempty"`
+}
+
+// Active reports whether the session can still be refreshed at now.
+func (s *Session) Active(now time.Time) bool {
+	return s.RevokedAt == nil && now.Before(s.ExpiresAt)
+}
+
+// Token is a stored refresh token. RotatedAt is set once it was exchanged.
+type Token struct {
+	Hash      string     `json:"-"`
+	SessionID string     `json:"session_id"`
+	IssuedAt  time.Time  `json:"issued_at"`
+	RotatedAt *time.Time `json:"rotated_at,omitempty"`
+}
+
+// HashToken returns the hash refresh tokens are stored under.
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func newToken() (string, error) {
+	random := make([]byte, 32)
+	if _, err := rand.Read(random); err != nil {
+		return "", err
+	}
+	return TokenPrefix + base64.RawURLEncoding.EncodeToString(random), nil
+}
+
+// Manager creates, refreshes and revokes sessions.
+type Manager struct {
+	store  Store
+	config Config
+	now    func() time.Time
+
+	// revocations caches whether the sessions access tokens were issued for
+	// are still active, by session ID
+	revocations   map[string]revocation
+	revocationsMu sync.Mutex
+}
+
+type revocation struct {
+	userID    string
+	revoked   bool
+	checkedAt time.Time
+}
+
+// maxRevocations bounds the revocation cache; expired entries are dropped
+// when it is full.
+const maxRevocations = 10000
+
+func NewManager(store Store, config Config) *Manager {
+	return &Manager{store: store, config: config, now: time.Now, revocations: make(map[string]revocation)}
+}
+
+func (m *Manager) Config() Config {
+	return m.config
+}
+
+// expiry returns when a session refreshed at now expires.
+func (m *Manager) expiry(session *Session, now time.Time) time.Time {
+	expiresAt := now.Add(m.config.TTL)
+	if m.config.MaxLifetime > 0 && expiresAt.After(session.CreatedAt.Add(m.config.MaxLifetime)) {
+		expiresAt = session.CreatedAt.Add(m.config.MaxLifetime)
+	}
+	return expiresAt
+}
+
+// Create starts a session and returns it with its first refresh token.
+func (m *Manager) Create(ctx context.Context, userID, organizationID string, device Device) (*Session, string, error) {
+	token, err := newToken()
+	if err != nil {
+		return nil, "", err
+	}
+	now := m.now().UTC()
+	session := &Session{
+		ID:             uuid.NewString(),
+		UserID:         userID,
+		OrganizationID: organizationID,
+		Device:         device,
+		CreatedAt:      now,
+		LastUsedAt:     now,
+	}
+	session.ExpiresAt = m.expiry(session, now)
+
+	if err := m.store.Create(ctx, session, &Token{Hash: HashToken(token), SessionID: session.ID, IssuedAt: now}); err != nil {
+		return nil, "", err
+	}
+	return session, token, nil
+}
+
+// Refresh exchanges a refresh token for a new one. The IP address and user
+// agent of device replace the ones of the session; its name and platform
+// are kept.
+func (m *Manager) Refresh(ctx context.Context, token string, device Device) (*Session, string, error) {
+	session, next, err := m.refresh(ctx, token, device)
+	if errors.Is(err, ErrConflict) {
+		// a concurrent refresh with the same token won, which is a retry
+		// within the grace period now
+		session, next, err = m.refresh(ctx, token, device)
+	}
+	return session, next, err
+}
+
+func (m *Manager) refresh(ctx context.Context, token string, device Device) (*Session, string, error) {
+	if !strings.HasPrefix(token, TokenPrefix) {
+		return nil, "", ErrInvalidToken
+	}
+	previous, err := m.store.Token(ctx, HashToken(token))
+	if errors.Is(err, ErrNotFound) {
+		return nil, "", ErrInvalidToken
+	} else if err != nil {
+		return nil, "", err
+	}
+	session, err := m.store.Get(ctx, previous.SessionID)
+	if errors.Is(err, ErrNotFound) {
+		return nil, "", ErrInvalidToken
+	} else if err != nil {
+		return nil, "", err
+	}
+
+	now := m.now().UTC()
+	switch {
+	case session.RevokedAt != nil:
+		return nil, "", ErrRevoked
+	case !now.Before(session.ExpiresAt):
+		return nil, "", ErrExpired
+	}
+
+	if previous.RotatedAt != nil {
+		if now.Sub(*previous.RotatedAt) > m.config.ReuseGrace {
+			if err := m.store.Revoke(ctx, session.ID, ReasonTokenReused, now); err != nil {
+				return nil, "", err
+			}
+			m.cacheRevocation(session.ID, session.UserID, true, now)
+			sessionsLogger.Printf("Revoked session %s of user %s: refresh token reused from %s", session.ID, session.UserID, device.IPAddress)
+			return nil, "", ErrTokenReused
+		}
+		// the client retries a refresh whose response it lost, so the
+		// token handed out then is replaced
+		previous, err = m.store.ActiveToken(ctx, session.ID)
+		if err != nil {
+			return nil, "", err
+		}
+	}
+
+	next, err := newToken()
+	if err != nil {
+		return nil, "", err
+	}
+	if device.UserAgent != "" {
+		session.Device.UserAgent = device.UserAgent
+	}
+	if device.IPAddress != "" {
+		session.Device.IPAddress = device.IPAddress
+	}
+	session.LastUsedAt = now
+	session.ExpiresAt = m.expiry(session, now)
+
+	if err := m.store.Rotate(ctx, previous.Hash, &Token{Hash: HashToken(next), SessionID: session.ID, IssuedAt: now}, session); err != nil {
+		return nil, "", err
+	}
+	return session, next, nil
+}
+
+// List returns the active sessions of a user, most recently used first.
+func (m *Manager) List(ctx context.Context, userID string) ([]*Session, error) {
+	return m.store.List(ctx, userID, m.now().UTC())
+}
+
+// Revoke ends a session of a user. Sessions of other users are not found.
+func (m *Manager) Revoke(ctx context.Context, userID, sessionID, reason string) error {
+	session, err := m.store.Get(ctx, sessionID)
+	if err != nil {
+		return err
+	}
+	if session.UserID != userID {
+		return ErrNotFound
+	}
+	if session.RevokedAt != nil {
+		return nil
+	}
+	now := m.now().UTC()
+	if err := m.store.Revoke(ctx, sessionID, reason, now); err != nil {
+		return err
+	}
+	m.cacheRevocation(sessionID, userID, true, now)
+	return nil
+}
+
+// RevokeOthers ends every session of a user but keepID, e.g. after the
+// password was changed. It returns how many were revoked.
+func (m *Manager) RevokeOthers(ctx context.Context, userID, keepID string) (int, error) {
+	revoked, err := m.store.RevokeUser(ctx, userID, keepID, ReasonRevokeOthers, m.now().UTC())
+	if err != nil {
+		return 0, err
+	}
+
+	m.revocationsMu.Lock()
+	for sessionID, cached := range m.revocations {
+		if cached.userID == userID && sessionID != keepID {
+			delete(m.revocations, sessionID)
+		}
+	}
+	m.revocationsMu.Unlock()
+	return revoked, nil
+}
+
+// Revoked reports whether the access tokens of a session must be rejected
+// because the session was revoked or expired. The answer is cached for
+// Config.RevocationCacheTTL; sessions revoked through this manager are
+// rejected right away, those revoked by other replicas once the cache
+// expires. Sessions this store doesn't know, like the ones of access tokens
+// Supabase issued, are not revoked.
+func (m *Manager) Revoked(ctx context.Context, sessionID string) (bool, error) {
+	now := m.now().UTC()
+	m.revocationsMu.Lock()
+	cached, ok := m.revocations[sessionID]
+	m.revocationsMu.Unlock()
+	if ok && now.Sub(cached.checkedAt) < m.config.RevocationCacheTTL {
+		return cached.revoked, nil
+	}
+
+	session, err := m.store.Get(ctx, sessionID)
+	if errors.Is(err, ErrNotFound) {
+		m.cacheRevocation(sessionID, "", false, now)
+		return false, nil
+	} else if err != nil {
+		return false, kerrors.Errorf(kerrors.BackendUnavailable, "error checking session %s: %v", sessionID, err)
+	}
+	revoked := !session.Active(now)
+	m.cacheRevocation(sessionID, session.UserID, revoked, now)
+	return revoked, nil
+}
+
+func (m *Manager) cacheRevocation(sessionID, userID string, revoked bool, now time.Time) {
+	m.revocationsMu.Lock()
+	defer m.revocationsMu.Unlock()
+
+	if len(m.revocations) >= maxRevocations {
+		for id, cached := range m.revocations {
+			if now.Sub(cached.checkedAt) >= m.config.RevocationCacheTTL {
+				delete(m.revocations, id)
+			}
+		}
+	}
+	if _, ok := m.revocations[sessionID]; ok || len(m.revocations) < maxRevocations {
+		m.revocations[sessionID] = revocation{userID: userID, revoked: revoked, checkedAt: now}
+	}
+}
@@ -0,0 +1,221 @@
+package sessions
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/spectrumwebco/agent_runtime/backend/core/kerrors"
+)
+
+var testConfig = Config{
+	TTL:            time.Hour,
+	MaxLifetime:    3 * time.Hour,
+	AccessTokenTTL: time.Minute,
+	ReuseGrace:     10 * time.Second,
+}
+
+func newTestManager() (*Manager, *time.Time) {
+	manager := NewManager(NewMemoryStore(), testConfig)
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	manager.now = func() time.Time { return now }
+	return manager, &now
+}
+
+func TestRotation(t *testing.T) {
+	ctx := context.Background()
+	manager, now := newTestManager()
+	session, first, err := manager.Create(ctx, "user-1", "org-1", Device{Name: "laptop", Platform: "darwin", IPAddress: "10.0.0.1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	*now = now.Add(30 * time.Minute)
+	refreshed, second, err := manager.Refresh(ctx, first, Device{UserAgent: "kled/1.0", IPAddress: "10.0.0.2"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if second == first || refreshed.ID != session.ID {
+		t.Fatalf("expected a new token for the same session, got %+v", refreshed)
+	}
+	if refreshed.Device.Name != "laptop" || refreshed.Device.IPAddress != "10.0.0.2" || refreshed.Device.UserAgent != "kled/1.0" {
+		t.Errorf("unexpected device %+v", refreshed.Device)
+	}
+	if !refreshed.ExpiresAt.Equal(now.Add(time.Hour)) {
+		t.Errorf("expected the session to be extended, expires at %v", refreshed.ExpiresAt)
+	}
+
+	stored, err := manager.store.Token(ctx, HashToken(second))
+	if err != nil || stored.SessionID != session.ID {
+		t.Errorf("expected the hash of the token to be stored, got %+v, %v", stored, err)
+	}
+	if _, err := manager.store.Token(ctx, second); !errors.Is(err, ErrNotFound) {
+		t.Error("expected the plain token not to be stored")
+	}
+
+	// the session can't be refreshed past its maximum lifetime
+	for i := 0; i < 5; i++ {
+		*now = now.Add(50 * time.Minute)
+		if refreshed, second, err = manager.Refresh(ctx, second, Device{}); err != nil {
+			break
+		}
+		if refreshed.ExpiresAt.After(session.CreatedAt.Add(testConfig.MaxLifetime)) {
+			t.Fatalf("session expires after its maximum lifetime at %v", refreshed.ExpiresAt)
+		}
+	}
+	if !errors.Is(err, ErrExpired) || !errors.Is(err, kerrors.ErrNotAuthenticated) {
+		t.Errorf("expected the session to expire, got %v", err)
+	}
+}
+
+func TestReuseRevokesSession(t *testing.T) {
+	ctx := context.Background()
+	manager, now := newTestManager()
+	session, first, _ := manager.Create(ctx, "user-1", "", Device{})
+	_, second, err := manager.Refresh(ctx, first, Device{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the first token is replayed after the grace period
+	*now = now.Add(time.Minute)
+	if _, _, err := manager.Refresh(ctx, first, Device{IPAddress: "203.0.113.9"}); !errors.Is(err, ErrTokenReused) {
+		t.Fatalf("expected the reuse to be detected, got %v", err)
+	}
+	revoked, _ := manager.store.Get(ctx, session.ID)
+	if revoked.RevokedAt == nil || revoked.RevokedReason != ReasonTokenReused {
+		t.Errorf("expected the session to be revoked, got %+v", revoked)
+	}
+
+	// which also locks out whoever holds the latest token
+	if _, _, err := manager.Refresh(ctx, second, Device{}); !errors.Is(err, ErrRevoked) {
+		t.Errorf("expected the session to be revoked, got %v", err)
+	}
+}
+
+func TestRetryWithinGrace(t *testing.T) {
+	ctx := context.Background()
+	manager, now := newTestManager()
+	_, first, _ := manager.Create(ctx, "user-1", "", Device{})
+	_, lost, err := manager.Refresh(ctx, first, Device{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	*now = now.Add(5 * time.Second)
+	_, retried, err := manager.Refresh(ctx, first, Device{})
+	if err != nil {
+		t.Fatalf("expected the retry to be accepted, got %v", err)
+	}
+	if _, _, err := manager.Refresh(ctx, retried, Device{}); err != nil {
+		t.Errorf("expected the token of the retry to work, got %v", err)
+	}
+
+	// the token of the lost response was replaced by the retry
+	*now = now.Add(time.Minute)
+	if _, _, err := manager.Refresh(ctx, lost, Device{}); !errors.Is(err, ErrTokenReused) {
+		t.Errorf("expected the lost token to be reused, got %v", err)
+	}
+}
+
+func TestInvalidToken(t *testing.T) {
+	manager, _ := newTestManager()
+	for _, token := range []string{"", "not-a-token", TokenPrefix + "unknown"} {
+		if _, _, err := manager.Refresh(context.Background(), token, Device{}); !errors.Is(err, ErrInvalidToken) {
+			t.Errorf("%q: expected an invalid token, got %v", token, err)
+		}
+	}
+}
+
+func TestListAndRevoke(t *testing.T) {
+	ctx := context.Background()
+	manager, now := newTestManager()
+	laptop, _, _ := manager.Create(ctx, "user-1", "", Device{Name: "laptop"})
+	*now = now.Add(time.Second)
+	phone, _, _ := manager.Create(ctx, "user-1", "", Device{Name: "phone"})
+	*now = now.Add(time.Second)
+	desktop, desktopToken, _ := manager.Create(ctx, "user-1", "", Device{Name: "desktop"})
+	other, _, _ := manager.Create(ctx, "user-2", "", Device{})
+
+	sessions, err := manager.List(ctx, "user-1")
+	if err != nil || len(sessions) != 3 || sessions[0].ID != desktop.ID {
+		t.Fatalf("unexpected sessions %+v, %v", sessions, err)
+	}
+
+	if err := manager.Revoke(ctx, "user-1", other.ID, ReasonRevoked); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected sessions of other users not to be found, got %v", err)
+	}
+	if err := manager.Revoke(ctx, "user-1", phone.ID, ReasonRevoked); err != nil {
+		t.Fatal(err)
+	}
+	if revoked, err := manager.RevokeOthers(ctx, "user-1", desktop.ID); err != nil || revoked != 1 {
+		t.Errorf("expected the laptop to be revoked, got %d, %v", revoked, err)
+	}
+
+	sessions, _ = manager.List(ctx, "user-1")
+	if len(sessions) != 1 || sessions[0].ID != desktop.ID {
+		t.Errorf("expected only the desktop to be left, got %+v", sessions)
+	}
+	if _, _, err := manager.Refresh(ctx, desktopToken, Device{}); err != nil {
+		t.Errorf("expected the kept session to be refreshed, got %v", err)
+	}
+	if session, _ := manager.store.Get(ctx, laptop.ID); session.RevokedReason != ReasonRevokeOthers {
+		t.Errorf("unexpected laptop session %+v", session)
+	}
+	if sessions, _ := manager.List(ctx, "user-2"); len(sessions) != 1 {
+		t.Errorf("expected the sessions of other users to be kept, got %+v", sessions)
+	}
+}
+
+func TestRevokedAccessTokens(t *testing.T) {
+	ctx := context.Background()
+	manager, now := newTestManager()
+	manager.config.RevocationCacheTTL = 30 * time.Second
+	laptop, _, _ := manager.Create(ctx, "user-1", "", Device{Name: "laptop"})
+	phone, _, _ := manager.Create(ctx, "user-1", "", Device{Name: "phone"})
+	desktop, _, _ := manager.Create(ctx, "user-1", "", Device{Name: "desktop"})
+
+	if revoked, err := manager.Revoked(ctx, laptop.ID); err != nil || revoked {
+		t.Fatalf("expected the session to be active, got %v, %v", revoked, err)
+	}
+	if revoked, err := manager.Revoked(ctx, "supabase-session"); err != nil || revoked {
+		t.Errorf("expected unknown sessions not to be revoked, got %v, %v", revoked, err)
+	}
+
+	// revoked by another replica, the cached answer holds until it expires
+	if err := manager.store.Revoke(ctx, laptop.ID, ReasonRevoked, *now); err != nil {
+		t.Fatal(err)
+	}
+	*now = now.Add(10 * time.Second)
+	if revoked, _ := manager.Revoked(ctx, laptop.ID); revoked {
+		t.Error("expected the cached answer within the cache TTL")
+	}
+	*now = now.Add(30 * time.Second)
+	if revoked, _ := manager.Revoked(ctx, laptop.ID); !revoked {
+		t.Error("expected the session to be revoked once the cache expired")
+	}
+
+	// revoked through the manager, the cache is updated right away
+	manager.Revoked(ctx, phone.ID)
+	manager.Revoked(ctx, desktop.ID)
+	if err := manager.Revoke(ctx, "user-1", phone.ID, ReasonSignedOut); err != nil {
+		t.Fatal(err)
+	}
+	if revoked, _ := manager.Revoked(ctx, phone.ID); !revoked {
+		t.Error("expected a signed out session to be revoked immediately")
+	}
+	manager.Create(ctx, "user-1", "", Device{Name: "tablet"})
+	if _, err := manager.RevokeOthers(ctx, "user-1", desktop.ID); err != nil {
+		t.Fatal(err)
+	}
+	if revoked, _ := manager.Revoked(ctx, desktop.ID); revoked {
+		t.Error("expected the kept session to stay active")
+	}
+
+	// sessions also end when they expire
+	*now = now.Add(2 * time.Hour)
+	if revoked, _ := manager.Revoked(ctx, desktop.ID); !revoked {
+		t.Error("expected an expired session to be rejected")
+	}
+}
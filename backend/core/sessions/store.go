@@ -0,0 +1,415 @@
+package sessions
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/spectrumwebco/agent_runtime/backend/db/integrations"
+)
+
+type Store interface {
+	// Create saves a session with its first refresh token.
+	Create(ctx context.Context, session *Session, token *Token) error
+	// Get returns the session or ErrNotFound.
+	Get(ctx context.Context, id string) (*Session, error)
+	// List returns the sessions of a user active at now, most recently used
+	// first.
+	List(ctx context.Context, userID string, now time.Time) ([]*Session, error)
+	// Token returns the refresh token with the hash or ErrNotFound.
+	Token(ctx context.Context, hash string) (*Token, error)
+	// ActiveToken returns the refresh token of a session that wasn't
+	// exchanged yet.
+	ActiveToken(ctx context.Context, sessionID string) (*Token, error)
+	// Rotate marks the token with previousHash exchanged at next.IssuedAt,
+	// saves next and the last use, expiry and device of session. It returns
+	// ErrConflict if the token was exchanged already.
+	Rotate(ctx context.Context, previousHash string, next *Token, session *Session) error
+	// Revoke ends a session, so none of its refresh tokens work anymore.
+	Revoke(ctx context.Context, id, reason string, at time.Time) error
+	// RevokeUser ends the active sessions of a user but exceptID and returns
+	// how many.
+	RevokeUser(ctx context.Context, userID, exceptID, reason string, at time.Time) (int, error)
+}
+
+type MemoryStore struct {
+	sessions map[string]*Session
+	tokens   map[string]*Token
+	mu       sync.Mutex
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{sessions: make(map[string]*Session), tokens: make(map[string]*Token)}
+}
+
+func (s *MemoryStore) Create(ctx context.Context, session *Session, token *Token) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.sessions[session.ID]; ok {
+		return fmt.Errorf("session %s already exists", session.ID)
+	}
+	s.sessions[session.ID] = copySession(session)
+	s.tokens[token.Hash] = copyToken(token)
+	return nil
+}
+
+func (s *MemoryStore) Get(ctx context.Context, id string) (*Session, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	session, ok := s.sessions[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return copySession(session), nil
+}
+
+func (s *MemoryStore) List(ctx context.Context, userID string, now time.Time) ([]*Session, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sessions := []*Session{}
+	for _, session := range s.sessions {
+		if session.UserID == userID && session.Active(now) {
+			sessions = append(sessions, copySession(session))
+		}
+	}
+	sort.Slice(sessions, func(i, j int) bool {
+		return sessions[i].LastUsedAt.After(sessions[j].LastUsedAt)
+	})
+	return sessions, nil
+}
+
+func (s *MemoryStore) Token(ctx context.Context, hash string) (*Token, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	token, ok := s.tokens[hash]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return copyToken(token), nil
+}
+
+func (s *MemoryStore) ActiveToken(ctx context.Context, sessionID string) (*Token, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, token := range s.tokens {
+		if token.SessionID == sessionID && token.RotatedAt == nil {
+			return copyToken(token), nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+func (s *MemoryStore) Rotate(ctx context.Context, previousHash string, next *Token, session *Session) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	previous, ok := s.tokens[previousHash]
+	if !ok {
+		return ErrNotFound
+	}
+	existing, ok := s.sessions[session.ID]
+	if !ok {
+		return ErrNotFound
+	}
+	if previous.RotatedAt != nil || existing.RevokedAt != nil {
+		return ErrConflict
+	}
+	rotatedAt := next.IssuedAt
+	previous.RotatedAt = &rotatedAt
+	s.tokens[next.Hash] = copyToken(next)
+	existing.LastUsedAt = session.LastUsedAt
+	existing.ExpiresAt = session.ExpiresAt
+	existing.Device = session.Device
+	return nil
+}
+
+func (s *MemoryStore) Revoke(ctx context.Context, id, reason string, at time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	session, ok := s.sessions[id]
+	if !ok {
+		return ErrNotFound
+	}
+	if session.RevokedAt == nil {
+		session.RevokedAt = &at
+		session.RevokedReason = reason
+	}
+	return nil
+}
+
+func (s *MemoryStore) RevokeUser(ctx context.Context, userID, exceptID, reason string, at time.Time) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	revoked := 0
+	for _, session := range s.sessions {
+		if session.UserID == userID && session.ID != exceptID && session.Active(at) {
+			revokedAt := at
+			session.RevokedAt = &revokedAt
+			session.RevokedReason = reason
+			revoked++
+		}
+	}
+	return revoked, nil
+}
+
+func copySession(session *Session) *Session {
+	copied := *session
+	if session.RevokedAt != nil {
+		revokedAt := *session.RevokedAt
+		copied.RevokedAt = &revokedAt
+	}
+	return &copied
+}
+
+func copyToken(token *Token) *Token {
+	copied := *token
+	if token.RotatedAt != nil {
+		rotatedAt := *token.RotatedAt
+		copied.RotatedAt = &rotatedAt
+	}
+	return &copied
+}
+
+// PostgresStore keeps sessions in app_session and their refresh tokens in
+// app_session_token.
+type PostgresStore struct {
+	client integrations.SQLStore
+}
+
+func NewPostgresStore(client integrations.SQLStore) *PostgresStore {
+	return &PostgresStore{client: client}
+}
+
+func (s *PostgresStore) EnsureSchema() error {
+	_, err := s.client.ExecuteUpdate(`
+		CREATE TABLE IF NOT EXISTS app_session (
+			id VARCHAR(64) PRIMARY KEY,
+			user_id VARCHAR(255) NOT NULL,
+			organization_id VARCHAR(255) NOT NULL DEFAULT '',
+			device_name VARCHAR(255) NOT NULL DEFAULT '',
+			platform VARCHAR(64) NOT NULL DEFAULT '',
+			user_agent TEXT NOT NULL DEFAULT '',
+			ip_address VARCHAR(64) NOT NULL DEFAULT '',
+			created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+			last_used_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+			expires_at TIMESTAMPTZ NOT NULL,
+			revoked_at TIMESTAMPTZ,
+			revoked_reason VARCHAR(64) NOT NULL DEFAULT ''
+		);
+		CREATE INDEX IF NOT EXISTS app_session_user_idx ON app_session (user_id, last_used_at DESC);
+		CREATE TABLE IF NOT EXISTS app_session_token (
+			hash CHAR(64) PRIMARY KEY,
+			session_id VARCHAR(64) NOT NULL REFERENCES app_session (id) ON DELETE CASCADE,
+			issued_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+			rotated_at TIMESTAMPTZ
+		);
+		CREATE INDEX IF NOT EXISTS app_session_token_session_idx ON app_session_token (session_id) WHERE rotated_at IS NULL
+	`)
+	if err != nil {
+		return fmt.Errorf("error creating session tables: %v", err)
+	}
+	return nil
+}
+
+const sessionColumns = `id, user_id, organization_id, device_name, platform, user_agent, ip_address, created_at, last_used_at, expires_at, revoked_at, revoked_reason`
+
+func (s *PostgresStore) Create(ctx context.Context, session *Session, token *Token) error {
+	_, err := s.client.ExecuteUpdate(`
+		WITH created AS (
+			INSERT INTO app_session (`+sessionColumns+`) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, NULL, '')
+			RETURNING id
+		)
+		INSERT INTO app_session_token (hash, session_id, issued_at) SELECT $11, id, $8 FROM created`,
+		session.ID, session.UserID, session.OrganizationID, session.Device.Name, session.Device.Platform,
+		session.Device.UserAgent, session.Device.IPAddress, session.CreatedAt.UTC(), session.LastUsedAt.UTC(), session.ExpiresAt.UTC(),
+		token.Hash,
+	)
+	if err != nil {
+		return fmt.Errorf("error creating session %s: %v", session.ID, err)
+	}
+	return nil
+}
+
+func (s *PostgresStore) Get(ctx context.Context, id string) (*Session, error) {
+	rows, err := s.client.ExecuteQuery(`SELECT `+sessionColumns+` FROM app_session WHERE id = $1`, id)
+	if err != nil {
+		return nil, fmt.Errorf("error loading session %s: %v", id, err)
+	}
+	if len(rows) == 0 {
+		return nil, ErrNotFound
+	}
+	return sessionFromRow(rows[0]), nil
+}
+
+func (s *PostgresStore) List(ctx context.Context, userID string, now time.Time) ([]*Session, error) {
+	rows, err := s.client.ExecuteQuery(
+		`SELECT `+sessionColumns+` FROM app_session
+		WHERE user_id = $1 AND revoked_at IS NULL AND expires_at > $2
+		ORDER BY last_used_at DESC`,
+		userID, now.UTC(),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("error listing sessions of user %s: %v", userID, err)
+	}
+
+	sessions := make([]*Session, 0, len(rows))
+	for _, row := range rows {
+		sessions = append(sessions, sessionFromRow(row))
+	}
+	return sessions, nil
+}
+
+func (s *PostgresStore) Token(ctx context.Context, hash string) (*Token, error) {
+	rows, err := s.client.ExecuteQuery(`SELECT hash, session_id, issued_at, rotated_at FROM app_session_token WHERE hash = $1`, hash)
+	if err != nil {
+		return nil, fmt.Errorf("error loading refresh token: %v", err)
+	}
+	if len(rows) == 0 {
+		return nil, ErrNotFound
+	}
+	return tokenFromRow(rows[0]), nil
+}
+
+func (s *PostgresStore) ActiveToken(ctx context.Context, sessionID string) (*Token, error) {
+	rows, err := s.client.ExecuteQuery(
+		`SELECT hash, session_id, issued_at, rotated_at FROM app_session_token
+		WHERE session_id = $1 AND rotated_at IS NULL ORDER BY issued_at DESC LIMIT 1`,
+		sessionID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("error loading refresh token of session %s: %v", sessionID, err)
+	}
+	if len(rows) == 0 {
+		return nil, ErrNotFound
+	}
+	return tokenFromRow(rows[0]), nil
+}
+
+func (s *PostgresStore) Rotate(ctx context.Context, previousHash string, next *Token, session *Session) error {
+	// the token is only rotated if nobody else did, in one statement so two
+	// refreshes can't both win
+	updated, err := s.client.ExecuteUpdate(`
+		WITH rotated AS (
+			UPDATE app_session_token SET rotated_at = $2
+			WHERE hash = $1 AND rotated_at IS NULL
+			RETURNING session_id
+		), issued AS (
+			INSERT INTO app_session_token (hash, session_id, issued_at)
+			SELECT $3, session_id, $2 FROM rotated
+			RETURNING session_id
+		)
+		UPDATE app_session SET last_used_at = $4, expires_at = $5, user_agent = $6, ip_address = $7
+		WHERE id IN (SELECT session_id FROM issued) AND revoked_at IS NULL`,
+		previousHash, next.IssuedAt.UTC(), next.Hash, session.LastUsedAt.UTC(), session.ExpiresAt.UTC(),
+		session.Device.UserAgent, session.Device.IPAddress,
+	)
+	if err != nil {
+		return fmt.Errorf("error rotating refresh token of session %s: %v", session.ID, err)
+	}
+	if updated == 0 {
+		return ErrConflict
+	}
+	return nil
+}
+
+func (s *PostgresStore) Revoke(ctx context.Context, id, reason string, at time.Time) error {
+	updated, err := s.client.ExecuteUpdate(
+		`UPDATE app_session SET revoked_at = COALESCE(revoked_at, $2), revoked_reason = CASE WHEN revoked_at IS NULL THEN $3 ELSE revoked_reason END WHERE id = $1`,
+		id, at.UTC(), reason,
+	)
+	if err != nil {
+		return fmt.Errorf("error revoking session %s: %v", id, err)
+	}
+	if updated == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (s *PostgresStore) RevokeUser(ctx context.Context, userID, exceptID, reason string, at time.Time) (int, error) {
+	updated, err := s.client.ExecuteUpdate(
+		`UPDATE app_session SET revoked_at = $3, revoked_reason = $4
+		WHERE user_id = $1 AND id <> $2 AND revoked_at IS NULL AND expires_at > $3`,
+		userID, exceptID, at.UTC(), reason,
+	)
+	if err != nil {
+		return 0, fmt.Errorf("error revoking sessions of user %s: %v", userID, err)
+	}
+	return int(updated), nil
+}
+
+// ConfigureDefault returns the store of login sessions and their refresh
+// tokens. If the sessions tables cannot be created they are kept in memory,
+// which signs every user out when the process restarts.
+func ConfigureDefault(client integrations.SQLStore) Store {
+	store := NewPostgresStore(client)
+	if err := store.EnsureSchema(); err != nil {
+		sessionsLogger.Printf("Sessions falling back to in-memory store: %v", err)
+		return NewMemoryStore()
+	}
+	return store
+}
+
+func sessionFromRow(row map[string]interface{}) *Session {
+	session := &Session{
+		ID:             toString(row["id"]),
+		UserID:         toString(row["user_id"]),
+		OrganizationID: toString(row["organization_id"]),
+		Device: Device{
+			Name:      toString(row["device_name"]),
+			Platform:  toString(row["platform"]),
+			UserAgent: toString(row["user_agent"]),
+			IPAddress: toString(row["ip_address"]),
+		},
+		RevokedReason: toString(row["revoked_reason"]),
+	}
+	if createdAt, ok := row["created_at"].(time.Time); ok {
+		session.CreatedAt = createdAt.UTC()
+	}
+	if lastUsedAt, ok := row["last_used_at"].(time.Time); ok {
+		session.LastUsedAt = lastUsedAt.UTC()
+	}
+	if expiresAt, ok := row["expires_at"].(time.Time); ok {
+		session.ExpiresAt = expiresAt.UTC()
+	}
+	if revokedAt, ok := row["revoked_at"].(time.Time); ok {
+		revokedAt = revokedAt.UTC()
+		session.RevokedAt = &revokedAt
+	}
+	return session
+}
+
+func tokenFromRow(row map[string]interface{}) *Token {
+	token := &Token{
+		Hash:      toString(row["hash"]),
+		SessionID: toString(row["session_id"]),
+	}
+	if issuedAt, ok := row["issued_at"].(time.Time); ok {
+		token.IssuedAt = issuedAt.UTC()
+	}
+	if rotatedAt, ok := row["rotated_at"].(time.Time); ok {
+		rotatedAt = rotatedAt.UTC()
+		token.RotatedAt = &rotatedAt
+	}
+	return token
+}
+
+func toString(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case []byte:
+		return string(v)
+	default:
+		return fmt.Sprint(v)
+	}
+}
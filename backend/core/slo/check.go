@@ -0,0 +1,256 @@
+package slo
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/spectrumwebco/agent_runtime/backend/core/events"
+)
+
+const (
+	AlertTopic             = "slo.alerts"
+	AlertEventType         = "slo.budget_burn"
+	AlertResolvedEventType = "slo.budget_burn_resolved"
+)
+
+// BurnWindow alerts when both its long and short window burn the error
+// budget faster than Rate. The short window lets the alert resolve soon after
+// the burn stops.
+type BurnWindow struct {
+	Severity string
+	Long     time.Duration
+	Short    time.Duration
+	Rate     float64
+}
+
+// BurnWindows are the multiwindow alerts of the SRE workbook for a 30 day
+// window: a page spends 2% of the budget in an hour, a ticket 5% in 6 hours.
+var BurnWindows = []BurnWindow{
+	{Severity: "page", Long: time.Hour, Short: 5 * time.Minute, Rate: 14.4},
+	{Severity: "ticket", Long: 6 * time.Hour, Short: 30 * time.Minute, Rate: 6},
+}
+
+// Report is the compliance of an SLO over its window and the burn rates of
+// the alert windows.
+type Report struct {
+	SLO    SLO    `json:"slo"`
+	Counts Counts `json:"counts"`
+	// Compliance is the share of good events, 1 without events.
+	Compliance float64 `json:"compliance"`
+	// BudgetRemaining is the share of the error budget left, negative once
+	// it's exhausted.
+	BudgetRemaining float64 `json:"budget_remaining"`
+	// BurnRates are keyed by window, e.g. 5m or 6h.
+	BurnRates map[string]float64 `json:"burn_rates"`
+	// Firing lists the severities of the burn windows that alert.
+	Firing []string `json:"firing"`
+}
+
+// Evaluate reports the SLO as of now.
+func Evaluate(ctx context.Context, store Store, slo SLO, now time.Time) (Report, error) {
+	counts, err := store.Counts(ctx, slo.Name, now.Add(-slo.Window), now)
+	if err != nil {
+		return Report{}, err
+	}
+
+	report := Report{
+		SLO:             slo,
+		Counts:          counts,
+		Compliance:      1,
+		BudgetRemaining: 1,
+		BurnRates:       map[string]float64{},
+		Firing:          []string{},
+	}
+	if counts.Total > 0 {
+		report.Compliance = float64(counts.Good) / float64(counts.Total)
+		report.BudgetRemaining = 1 - burnRate(slo, counts)
+	}
+
+	for _, burn := range BurnWindows {
+		for _, window := range []time.Duration{burn.Long, burn.Short} {
+			key := windowName(window)
+			if _, ok := report.BurnRates[key]; ok {
+				continue
+			}
+			counts, err := store.Counts(ctx, slo.Name, now.Add(-window), now)
+			if err != nil {
+				return Report{}, err
+			}
+			report.BurnRates[key] = burnRate(slo, counts)
+		}
+		if report.BurnRates[windowName(burn.Long)] > burn.Rate && report.BurnRates[windowName(burn.Short)] > burn.Rate {
+			report.Firing = append(report.Firing, burn.Severity)
+		}
+	}
+	return report, nil
+}
+
+// burnRate is the share of bad events relative to the error budget.
+func burnRate(slo SLO, counts Counts) float64 {
+	if counts.Total == 0 || slo.ErrorBudget() <= 0 {
+		return 0
+	}
+	return float64(counts.Bad()) / float64(counts.Total) / slo.ErrorBudget()
+}
+
+func windowName(window time.Duration) string {
+	if window%time.Hour == 0 {
+		return fmt.Sprintf("%dh", window/time.Hour)
+	}
+	return fmt.Sprintf("%dm", window/time.Minute)
+}
+
+type Alert struct {
+	ID         string    `json:"id"`
+	Type       string    `json:"type"`
+	OccurredAt time.Time `json:"occurred_at"`
+	SLO        string    `json:"slo"`
+	Severity   string    `json:"severity"`
+	Objective  float64   `json:"objective"`
+	// BurnRate and ShortBurnRate are the burn rates of the long and short
+	// window, alerting above Threshold.
+	BurnRate        float64 `json:"burn_rate"`
+	ShortBurnRate   float64 `json:"short_burn_rate"`
+	Threshold       float64 `json:"threshold"`
+	LongWindow      string  `json:"long_window"`
+	ShortWindow     string  `json:"short_window"`
+	BudgetRemaining float64 `json:"budget_remaining"`
+}
+
+func newAlert(eventType string, report Report, burn BurnWindow, now time.Time) Alert {
+	return Alert{
+		ID:              uuid.New().String(),
+		Type:            eventType,
+		OccurredAt:      now.UTC(),
+		SLO:             report.SLO.Name,
+		Severity:        burn.Severity,
+		Objective:       report.SLO.Objective,
+		BurnRate:        report.BurnRates[windowName(burn.Long)],
+		ShortBurnRate:   report.BurnRates[windowName(burn.Short)],
+		Threshold:       burn.Rate,
+		LongWindow:      windowName(burn.Long),
+		ShortWindow:     windowName(burn.Short),
+		BudgetRemaining: report.BudgetRemaining,
+	}
+}
+
+type Notifier interface {
+	Notify(ctx context.Context, alert Alert)
+}
+
+type NotifierFunc func(ctx context.Context, alert Alert)
+
+func (f NotifierFunc) Notify(ctx context.Context, alert Alert) {
+	f(ctx, alert)
+}
+
+// KafkaNotifier publishes alerts to AlertTopic keyed by SLO. Failures are
+// logged.
+type KafkaNotifier struct {
+	producer events.HeaderProducer
+}
+
+func NewKafkaNotifier(producer events.HeaderProducer) *KafkaNotifier {
+	return &KafkaNotifier{producer: producer}
+}
+
+func (n *KafkaNotifier) Notify(ctx context.Context, alert Alert) {
+	body, err := json.Marshal(alert)
+	if err != nil {
+		sloLogger.Printf("Error encoding SLO alert: %v", err)
+		return
+	}
+
+	err = n.producer.ProduceWithHeaders(AlertTopic, body, alert.SLO, map[string]string{
+		events.HeaderEventType:     alert.Type,
+		events.HeaderCorrelationID: events.CorrelationID(ctx),
+	})
+	if err != nil {
+		sloLogger.Printf("Error publishing SLO alert for %s: %v", alert.SLO, err)
+	}
+}
+
+// Checker evaluates the SLOs and notifies when a burn window starts or stops
+// alerting. Which windows alert is kept in memory, so a restarted checker
+// notifies an ongoing burn once more.
+type Checker struct {
+	store      Store
+	objectives []SLO
+	notifier   Notifier
+	now        func() time.Time
+
+	mu     sync.Mutex
+	firing map[string]bool
+}
+
+func NewChecker(store Store, objectives []SLO, notifier Notifier) *Checker {
+	return &Checker{
+		store:      store,
+		objectives: objectives,
+		notifier:   notifier,
+		now:        time.Now,
+		firing:     make(map[string]bool),
+	}
+}
+
+func (c *Checker) SetClock(now func() time.Time) {
+	c.now = now
+}
+
+// Check evaluates every SLO, notifies the alerts that started or resolved
+// since the previous check and prunes the buckets older than the longest
+// window. It returns the reports and the alerts sent.
+func (c *Checker) Check(ctx context.Context) ([]Report, []Alert, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := c.now()
+	reports := make([]Report, 0, len(c.objectives))
+	alerts := []Alert{}
+	var longest time.Duration
+	for _, slo := range c.objectives {
+		if slo.Window > longest {
+			longest = slo.Window
+		}
+
+		report, err := Evaluate(ctx, c.store, slo, now)
+		if err != nil {
+			return reports, alerts, err
+		}
+		reports = append(reports, report)
+
+		firing := map[string]bool{}
+		for _, severity := range report.Firing {
+			firing[severity] = true
+		}
+		for _, burn := range BurnWindows {
+			key := slo.Name + "/" + burn.Severity
+			switch {
+			case firing[burn.Severity] && !c.firing[key]:
+				alerts = append(alerts, newAlert(AlertEventType, report, burn, now))
+				sloLogger.Printf("SLO %s burns its error budget %.1fx too fast (%s)", slo.Name, report.BurnRates[windowName(burn.Long)], burn.Severity)
+			case !firing[burn.Severity] && c.firing[key]:
+				alerts = append(alerts, newAlert(AlertResolvedEventType, report, burn, now))
+				sloLogger.Printf("SLO %s no longer burns its error budget too fast (%s)", slo.Name, burn.Severity)
+			}
+			c.firing[key] = firing[burn.Severity]
+		}
+	}
+
+	if c.notifier != nil {
+		for _, alert := range alerts {
+			c.notifier.Notify(ctx, alert)
+		}
+	}
+
+	if longest > 0 {
+		if err := c.store.Prune(ctx, now.Add(-longest)); err != nil {
+			return reports, alerts, err
+		}
+	}
+	return reports, alerts, nil
+}
@@ -0,0 +1,152 @@
+// Package slo tracks the service level objectives of the backend and alerts
+// when their error budgets burn too fast.
+//
+// Every SLO counts good and total events: a workspace start that succeeded,
+// or one that took no longer than the threshold of a latency objective. The
+// counts are kept in minute buckets, buffered in memory by the Tracker of
+// every replica and added up in app_slo_bucket, so rolling windows survive
+// restarts and cover all replicas.
+//
+// The Checker evaluates the burn rate, the rate at which the error budget is
+// spent relative to spending it evenly over the window of the SLO, with the
+// multiwindow alerts of the SRE workbook: a page when both the last hour and
+// the last 5 minutes burn 14.4 times too fast, a ticket when both the last 6
+// hours and the last 30 minutes burn 6 times too fast.
+package slo
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var sloLogger = log.New(os.Stdout, "kled.slo: ", log.LstdFlags)
+
+const (
+	WorkspaceStartSuccess = "workspace-start-success"
+	WorkspaceStartLatency = "workspace-start-latency"
+	StateUpdateLatency    = "state-update-latency"
+
+	// DefaultWindow is the compliance window of an SLO.
+	DefaultWindow = 30 * 24 * time.Hour
+)
+
+type SLO struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	// Objective is the share of events that must be good, e.g. 0.99.
+	Objective float64 `json:"objective"`
+	// Threshold makes the SLO a latency objective: events taking longer are
+	// bad.
+	Threshold time.Duration `json:"threshold,omitempty"`
+	Window    time.Duration `json:"window"`
+}
+
+// ErrorBudget is the share of events that may be bad.
+func (s SLO) ErrorBudget() float64 {
+	return 1 - s.Objective
+}
+
+func (s SLO) Validate() error {
+	if s.Name == "" {
+		return fmt.Errorf("an SLO needs a name")
+	}
+	if s.Objective <= 0 || s.Objective >= 1 {
+		return fmt.Errorf("the objective of SLO %s must be between 0 and 1, got %v", s.Name, s.Objective)
+	}
+	if s.Window <= 0 {
+		return fmt.Errorf("the window of SLO %s must be positive", s.Name)
+	}
+	return nil
+}
+
+// Builtin returns the SLOs of the backend with their default objectives.
+func Builtin() []SLO {
+	return []SLO{{
+		Name:        WorkspaceStartSuccess,
+		Description: "Workspace starts that succeed",
+		Objective:   0.99,
+		Window:      DefaultWindow,
+	}, {
+		Name:        WorkspaceStartLatency,
+		Description: "Workspace starts that are ready within the threshold, the p95 start latency",
+		Objective:   0.95,
+		Threshold:   2 * time.Minute,
+		Window:      DefaultWindow,
+	}, {
+		Name:        StateUpdateLatency,
+		Description: "State updates delivered to the consumers of every replica within the threshold",
+		Objective:   0.99,
+		Threshold:   time.Second,
+		Window:      DefaultWindow,
+	}}
+}
+
+var (
+	defaultObjectives     []SLO
+	defaultObjectivesOnce sync.Once
+)
+
+// Objectives returns the SLOs of the process. They are read once.
+func Objectives() []SLO {
+	defaultObjectivesOnce.Do(func() {
+		defaultObjectives = FromEnv()
+	})
+	return defaultObjectives
+}
+
+// FromEnv returns the builtin SLOs with the overrides of the environment,
+// e.g. SLO_WORKSPACE_START_LATENCY_OBJECTIVE=0.9,
+// SLO_WORKSPACE_START_LATENCY_THRESHOLD=3m and SLO_WINDOW=7d. Invalid values
+// are logged and ignored.
+func FromEnv() []SLO {
+	window := DefaultWindow
+	if value := os.Getenv("SLO_WINDOW"); value != "" {
+		parsed, err := parseWindow(value)
+		if err != nil || parsed <= 0 {
+			sloLogger.Printf("SLO_WINDOW must be a positive duration such as 7d or 720h, got %q", value)
+		} else {
+			window = parsed
+		}
+	}
+
+	objectives := Builtin()
+	for i := range objectives {
+		slo := &objectives[i]
+		slo.Window = window
+		prefix := "SLO_" + strings.ToUpper(strings.ReplaceAll(slo.Name, "-", "_")) + "_"
+		if value := os.Getenv(prefix + "OBJECTIVE"); value != "" {
+			objective, err := strconv.ParseFloat(value, 64)
+			if err != nil || objective <= 0 || objective >= 1 {
+				sloLogger.Printf("%sOBJECTIVE must be between 0 and 1, got %q", prefix, value)
+			} else {
+				slo.Objective = objective
+			}
+		}
+		if value := os.Getenv(prefix + "THRESHOLD"); value != "" && slo.Threshold > 0 {
+			threshold, err := time.ParseDuration(value)
+			if err != nil || threshold <= 0 {
+				sloLogger.Printf("%sTHRESHOLD must be a positive duration, got %q", prefix, value)
+			} else {
+				slo.Threshold = threshold
+			}
+		}
+	}
+	return objectives
+}
+
+// parseWindow parses a duration, also accepting whole days such as 30d.
+func parseWindow(value string) (time.Duration, error) {
+	if days, ok := strings.CutSuffix(value, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil {
+			return 0, err
+		}
+		return time.Duration(n) * 24 * time.Hour, nil
+	}
+	return time.ParseDuration(value)
+}
@@ -0,0 +1,140 @@
+package slo
+
+import (
+	"context"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/spectrumwebco/agent_runtime/backend/core/events"
+)
+
+func approx(got, want float64) bool {
+	return math.Abs(got-want) < 1e-9
+}
+
+func TestTrackerFlush(t *testing.T) {
+	tracker := NewTracker(Builtin())
+	now := time.Date(2026, 10, 16, 12, 0, 30, 0, time.UTC)
+	tracker.SetClock(func() time.Time { return now })
+
+	ctx := context.Background()
+	tracker.Publish(ctx, events.WorkspaceEvent{Type: events.WorkspaceStarted, Attributes: map[string]string{StartDurationAttribute: "30000"}})
+	tracker.Publish(ctx, events.WorkspaceEvent{Type: events.WorkspaceStarted, Attributes: map[string]string{StartDurationAttribute: "300000"}})
+	tracker.Publish(ctx, events.WorkspaceEvent{Type: events.WorkspaceFailed, Attributes: map[string]string{events.StageAttribute: events.StageStart}})
+	tracker.Publish(ctx, events.WorkspaceEvent{Type: events.WorkspaceFailed, Attributes: map[string]string{events.StageAttribute: events.StageCreate}})
+	tracker.Publish(ctx, events.WorkspaceEvent{Type: events.WorkspaceFailed})
+	tracker.ObserveLatency(StateUpdateLatency, 200*time.Millisecond)
+	tracker.Record("unknown", true)
+
+	store := NewMemoryStore()
+	if err := tracker.Flush(ctx, store); err != nil {
+		t.Fatal(err)
+	}
+
+	from, to := now.Add(-time.Hour), now.Add(time.Hour)
+	for name, want := range map[string]Counts{
+		WorkspaceStartSuccess: {Good: 2, Total: 3},
+		WorkspaceStartLatency: {Good: 1, Total: 2},
+		StateUpdateLatency:    {Good: 1, Total: 1},
+		"unknown":             {},
+	} {
+		if got, _ := store.Counts(ctx, name, from, to); got != want {
+			t.Errorf("expected %+v for %s, got %+v", want, name, got)
+		}
+	}
+
+	// flushed counts aren't added twice
+	tracker.Flush(ctx, store)
+	if got, _ := store.Counts(ctx, WorkspaceStartSuccess, from, to); got.Total != 3 {
+		t.Errorf("expected 3 starts after a second flush, got %+v", got)
+	}
+}
+
+func TestCheckerAlerts(t *testing.T) {
+	objective := SLO{Name: WorkspaceStartSuccess, Objective: 0.99, Window: DefaultWindow}
+	store := NewMemoryStore()
+	now := time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC)
+	ctx := context.Background()
+
+	// a healthy day, then the last hour fails a fifth of the starts
+	store.Add(ctx, objective.Name, now.Add(-24*time.Hour), Counts{Good: 1000, Total: 1000})
+	store.Add(ctx, objective.Name, now.Add(-40*DefaultWindow/30), Counts{Good: 0, Total: 10})
+	for minute := 1; minute <= 60; minute++ {
+		store.Add(ctx, objective.Name, now.Add(-time.Duration(minute)*time.Minute), Counts{Good: 8, Total: 10})
+	}
+
+	var notified []Alert
+	checker := NewChecker(store, []SLO{objective}, NotifierFunc(func(ctx context.Context, alert Alert) {
+		notified = append(notified, alert)
+	}))
+	checker.SetClock(func() time.Time { return now })
+
+	reports, alerts, err := checker.Check(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	report := reports[0]
+	if report.Counts.Total != 1600 || !approx(report.BurnRates["1h"], 20) || !approx(report.BurnRates["5m"], 20) {
+		t.Errorf("unexpected report %+v", report)
+	}
+	if len(report.Firing) != 2 || len(alerts) != 2 || len(notified) != 2 {
+		t.Fatalf("expected a page and a ticket, got %+v", alerts)
+	}
+	if alerts[0].Type != AlertEventType || alerts[0].Severity != "page" || !approx(alerts[0].BurnRate, 20) || alerts[0].LongWindow != "1h" {
+		t.Errorf("unexpected alert %+v", alerts[0])
+	}
+	// buckets older than the window were pruned
+	if counts, _ := store.Counts(ctx, objective.Name, time.Time{}, now); counts.Total != 1600 {
+		t.Errorf("expected old buckets to be pruned, got %+v", counts)
+	}
+
+	// firing alerts aren't sent again
+	if _, alerts, _ := checker.Check(ctx); len(alerts) != 0 {
+		t.Errorf("expected no new alerts, got %+v", alerts)
+	}
+
+	// the page resolves once the short window recovers, the ticket keeps firing
+	now = now.Add(10 * time.Minute)
+	for minute := 0; minute < 10; minute++ {
+		store.Add(ctx, objective.Name, now.Add(-time.Duration(minute+1)*time.Minute), Counts{Good: 10, Total: 10})
+	}
+	_, alerts, _ = checker.Check(ctx)
+	if len(alerts) != 1 || alerts[0].Type != AlertResolvedEventType || alerts[0].Severity != "page" {
+		t.Errorf("expected the page to resolve, got %+v", alerts)
+	}
+}
+
+func TestEvaluateWithoutEvents(t *testing.T) {
+	report, err := Evaluate(context.Background(), NewMemoryStore(), Builtin()[0], time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Compliance != 1 || report.BudgetRemaining != 1 || len(report.Firing) != 0 || report.BurnRates["6h"] != 0 {
+		t.Errorf("unexpected report %+v", report)
+	}
+}
+
+func TestFromEnv(t *testing.T) {
+	t.Setenv("SLO_WINDOW", "7d")
+	t.Setenv("SLO_WORKSPACE_START_LATENCY_OBJECTIVE", "0.9")
+	t.Setenv("SLO_WORKSPACE_START_LATENCY_THRESHOLD", "3m")
+	t.Setenv("SLO_WORKSPACE_START_SUCCESS_OBJECTIVE", "1.5")
+	t.Setenv("SLO_WORKSPACE_START_SUCCESS_THRESHOLD", "1s")
+
+	objectives := map[string]SLO{}
+	for _, slo := range FromEnv() {
+		if err := slo.Validate(); err != nil {
+			t.Error(err)
+		}
+		objectives[slo.Name] = slo
+	}
+
+	if latency := objectives[WorkspaceStartLatency]; latency.Objective != 0.9 || latency.Threshold != 3*time.Minute || latency.Window != 7*24*time.Hour {
+		t.Errorf("unexpected start latency SLO %+v", latency)
+	}
+	// invalid objectives are ignored and success rates have no threshold
+	if success := objectives[WorkspaceStartSuccess]; success.Objective != 0.99 || success.Threshold != 0 {
+		t.Errorf("unexpected start success SLO %+v", success)
+	}
+}
@@ -0,0 +1,149 @@
+package slo
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/spectrumwebco/agent_runtime/backend/db/integrations"
+)
+
+// Counts are the good and total events of an SLO.
+type Counts struct {
+	Good  int64 `json:"good"`
+	Total int64 `json:"total"`
+}
+
+// Bad returns the events that weren't good.
+func (c Counts) Bad() int64 {
+	return c.Total - c.Good
+}
+
+// Store keeps the minute buckets of the SLOs.
+type Store interface {
+	// Add adds counts to the bucket of the minute.
+	Add(ctx context.Context, slo string, minute time.Time, counts Counts) error
+	// Counts sums up the buckets in [from, to).
+	Counts(ctx context.Context, slo string, from, to time.Time) (Counts, error)
+	// Prune deletes the buckets before before.
+	Prune(ctx context.Context, before time.Time) error
+}
+
+type bucketKey struct {
+	slo    string
+	minute int64
+}
+
+type MemoryStore struct {
+	buckets map[bucketKey]Counts
+	mu      sync.RWMutex
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{buckets: make(map[bucketKey]Counts)}
+}
+
+func (s *MemoryStore) Add(ctx context.Context, slo string, minute time.Time, counts Counts) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := bucketKey{slo: slo, minute: minute.Unix() / 60}
+	bucket := s.buckets[key]
+	bucket.Good += counts.Good
+	bucket.Total += counts.Total
+	s.buckets[key] = bucket
+	return nil
+}
+
+func (s *MemoryStore) Counts(ctx context.Context, slo string, from, to time.Time) (Counts, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	counts := Counts{}
+	for key, bucket := range s.buckets {
+		if key.slo != slo || key.minute*60 < from.Unix() || key.minute*60 >= to.Unix() {
+			continue
+		}
+		counts.Good += bucket.Good
+		counts.Total += bucket.Total
+	}
+	return counts, nil
+}
+
+func (s *MemoryStore) Prune(ctx context.Context, before time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for key := range s.buckets {
+		if key.minute*60 < before.Unix() {
+			delete(s.buckets, key)
+		}
+	}
+	return nil
+}
+
+// PostgresStore keeps the buckets in app_slo_bucket. Replicas add their
+// counts to the same rows.
+type PostgresStore struct {
+	client integrations.SQLStore
+}
+
+func NewPostgresStore(client integrations.SQLStore) *PostgresStore {
+	return &PostgresStore{client: client}
+}
+
+func (s *PostgresStore) EnsureSchema() error {
+	_, err := s.client.ExecuteUpdate(`
+		CREATE TABLE IF NOT EXISTS app_slo_bucket (
+			slo VARCHAR(64) NOT NULL,
+			minute TIMESTAMPTZ NOT NULL,
+			good BIGINT NOT NULL DEFAULT 0,
+			total BIGINT NOT NULL DEFAULT 0,
+			PRIMARY KEY (slo, minute)
+		)
+	`)
+	if err != nil {
+		return fmt.Errorf("error creating SLO bucket table: %v", err)
+	}
+	return nil
+}
+
+func (s *PostgresStore) Add(ctx context.Context, slo string, minute time.Time, counts Counts) error {
+	_, err := s.client.ExecuteUpdate(`
+		INSERT INTO app_slo_bucket (slo, minute, good, total) VALUES ($1, $2, $3, $4)
+		ON CONFLICT (slo, minute) DO UPDATE SET
+			good = app_slo_bucket.good + EXCLUDED.good,
+			total = app_slo_bucket.total + EXCLUDED.total
+	`, slo, minute.UTC().Truncate(time.Minute), counts.Good, counts.Total)
+	if err != nil {
+		return fmt.Errorf("error saving counts of SLO %s: %v", slo, err)
+	}
+	return nil
+}
+
+func (s *PostgresStore) Counts(ctx context.Context, slo string, from, to time.Time) (Counts, error) {
+	rows, err := s.client.ExecuteQuery(`
+		SELECT COALESCE(SUM(good), 0) AS good, COALESCE(SUM(total), 0) AS total FROM app_slo_bucket
+		WHERE slo = $1 AND minute >= $2 AND minute < $3
+	`, slo, from.UTC(), to.UTC())
+	if err != nil {
+		return Counts{}, fmt.Errorf("error loading counts of SLO %s: %v", slo, err)
+	}
+	if len(rows) == 0 {
+		return Counts{}, nil
+	}
+
+	counts := Counts{}
+	counts.Good, _ = strconv.ParseInt(fmt.Sprint(rows[0]["good"]), 10, 64)
+	counts.Total, _ = strconv.ParseInt(fmt.Sprint(rows[0]["total"]), 10, 64)
+	return counts, nil
+}
+
+func (s *PostgresStore) Prune(ctx context.Context, before time.Time) error {
+	if _, err := s.client.ExecuteUpdate(`DELETE FROM app_slo_bucket WHERE minute < $1`, before.UTC()); err != nil {
+		return fmt.Errorf("error pruning SLO buckets: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,162 @@
+package slo
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/spectrumwebco/agent_runtime/backend/core/events"
+)
+
+// StartDurationAttribute is the attribute of workspace.started events holding
+// how long the start took in milliseconds.
+const StartDurationAttribute = "start_duration_ms"
+
+// Tracker counts the events of the SLOs in memory until Flush adds them to
+// the store, so recording an event never waits for the database.
+type Tracker struct {
+	objectives map[string]SLO
+	now        func() time.Time
+
+	mu      sync.Mutex
+	pending map[bucketKey]Counts
+}
+
+func NewTracker(objectives []SLO) *Tracker {
+	tracker := &Tracker{
+		objectives: make(map[string]SLO, len(objectives)),
+		now:        time.Now,
+		pending:    make(map[bucketKey]Counts),
+	}
+	for _, slo := range objectives {
+		tracker.objectives[slo.Name] = slo
+	}
+	return tracker
+}
+
+func (t *Tracker) SetClock(now func() time.Time) {
+	t.now = now
+}
+
+var (
+	defaultTracker     *Tracker
+	defaultTrackerOnce sync.Once
+)
+
+// DefaultTracker returns the tracker of the process, for the Objectives.
+func DefaultTracker() *Tracker {
+	defaultTrackerOnce.Do(func() {
+		defaultTracker = NewTracker(Objectives())
+	})
+	return defaultTracker
+}
+
+// Record counts an event of the SLO. Events of unknown SLOs are ignored.
+func (t *Tracker) Record(slo string, good bool) {
+	if _, ok := t.objectives[slo]; !ok {
+		return
+	}
+
+	key := bucketKey{slo: slo, minute: t.now().Unix() / 60}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	counts := t.pending[key]
+	counts.Total++
+	if good {
+		counts.Good++
+	}
+	t.pending[key] = counts
+}
+
+// ObserveLatency counts an event of a latency SLO, which is good if it took
+// no longer than the threshold.
+func (t *Tracker) ObserveLatency(slo string, latency time.Duration) {
+	objective, ok := t.objectives[slo]
+	if !ok || objective.Threshold <= 0 {
+		return
+	}
+	t.Record(slo, latency <= objective.Threshold)
+}
+
+// Publish counts workspace starts: workspace.started events are good and
+// workspace.failed events of the start stage bad; failures to create, stop
+// or delete a workspace aren't starts. Started events with a start duration
+// are also counted for the start latency.
+func (t *Tracker) Publish(ctx context.Context, event events.WorkspaceEvent) error {
+	switch event.Type {
+	case events.WorkspaceStarted:
+		t.Record(WorkspaceStartSuccess, true)
+		if value, ok := event.Attributes[StartDurationAttribute]; ok {
+			if ms, err := strconv.ParseInt(value, 10, 64); err == nil {
+				t.ObserveLatency(WorkspaceStartLatency, time.Duration(ms)*time.Millisecond)
+			}
+		}
+	case events.WorkspaceFailed:
+		if event.Attributes[events.StageAttribute] == events.StageStart {
+			t.Record(WorkspaceStartSuccess, false)
+		}
+	}
+	return nil
+}
+
+// Flush adds the pending counts to the store. Counts that couldn't be saved
+// stay pending for the next flush; the first error is returned.
+func (t *Tracker) Flush(ctx context.Context, store Store) error {
+	t.mu.Lock()
+	pending := t.pending
+	t.pending = make(map[bucketKey]Counts)
+	t.mu.Unlock()
+
+	var firstErr error
+	for key, counts := range pending {
+		err := store.Add(ctx, key.slo, time.Unix(key.minute*60, 0), counts)
+		if err == nil {
+			continue
+		}
+		if firstErr == nil {
+			firstErr = err
+		}
+
+		t.mu.Lock()
+		merged := t.pending[key]
+		merged.Good += counts.Good
+		merged.Total += counts.Total
+		t.pending[key] = merged
+		t.mu.Unlock()
+	}
+	return firstErr
+}
+
+// Run flushes every interval until ctx is done, and once more then.
+func (t *Tracker) Run(ctx context.Context, store Store, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			flushCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			if err := t.Flush(flushCtx, store); err != nil {
+				sloLogger.Printf("Error flushing SLO counts: %v", err)
+			}
+			cancel()
+			return
+		case <-ticker.C:
+			if err := t.Flush(ctx, store); err != nil {
+				sloLogger.Printf("Error flushing SLO counts: %v", err)
+			}
+		}
+	}
+}
+
+// Publisher counts the workspace starts of the lifecycle events with the
+// default tracker.
+var Publisher events.Publisher = publisher{}
+
+type publisher struct{}
+
+func (publisher) Publish(ctx context.Context, event events.WorkspaceEvent) error {
+	return DefaultTracker().Publish(ctx, event)
+}
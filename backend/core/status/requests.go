@@ -0,0 +1,102 @@
+package status
+
+import (
+	"sync"
+	"time"
+)
+
+// MaxWindow is the longest window error rates are kept for.
+const MaxWindow = time.Hour
+
+const bucketCount = int(MaxWindow / time.Minute)
+
+type requestBucket struct {
+	minute       int64
+	total        int64
+	clientErrors int64
+	serverErrors int64
+}
+
+// Requests counts the served requests by outcome in buckets of a minute,
+// for the recent error rates of the status document.
+type Requests struct {
+	mu      sync.Mutex
+	buckets [bucketCount]requestBucket
+	now     func() time.Time
+}
+
+func NewRequests() *Requests {
+	return &Requests{now: time.Now}
+}
+
+func (r *Requests) SetClock(now func() time.Time) {
+	r.now = now
+}
+
+var defaultRequests = NewRequests()
+
+// DefaultRequests returns the requests recorded by the performance
+// middleware.
+func DefaultRequests() *Requests {
+	return defaultRequests
+}
+
+// Record counts a request answered with statusCode. Zero counts as 200, as
+// for handlers that never call WriteHeader.
+func (r *Requests) Record(statusCode int) {
+	minute := r.now().Unix() / 60
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	bucket := &r.buckets[minute%int64(bucketCount)]
+	if bucket.minute != minute {
+		*bucket = requestBucket{minute: minute}
+	}
+	bucket.total++
+	switch {
+	case statusCode >= 500:
+		bucket.serverErrors++
+	case statusCode >= 400:
+		bucket.clientErrors++
+	}
+}
+
+// ErrorRate summarizes the requests of a window. Rate is the share of
+// requests that failed with a server error.
+type ErrorRate struct {
+	WindowSeconds float64 `json:"window_seconds"`
+	Requests      int64   `json:"requests"`
+	ClientErrors  int64   `json:"client_errors"`
+	ServerErrors  int64   `json:"server_errors"`
+	Rate          float64 `json:"rate"`
+}
+
+// Rate returns the error rate of the last window, rounded up to whole
+// minutes and at most MaxWindow.
+func (r *Requests) Rate(window time.Duration) ErrorRate {
+	minutes := int64((window + time.Minute - 1) / time.Minute)
+	if minutes < 1 {
+		minutes = 1
+	} else if minutes > int64(bucketCount) {
+		minutes = int64(bucketCount)
+	}
+	oldest := r.now().Unix()/60 - minutes + 1
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	rate := ErrorRate{WindowSeconds: float64(minutes * 60)}
+	for _, bucket := range r.buckets {
+		if bucket.minute < oldest {
+			continue
+		}
+		rate.Requests += bucket.total
+		rate.ClientErrors += bucket.clientErrors
+		rate.ServerErrors += bucket.serverErrors
+	}
+	if rate.Requests > 0 {
+		rate.Rate = float64(rate.ServerErrors) / float64(rate.Requests)
+	}
+	return rate
+}
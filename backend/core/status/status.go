@@ -0,0 +1,163 @@
+// Package status assembles the status document served by /api/status/ from
+// independent sections, such as workspace counts and integration health.
+//
+// Sections are collected concurrently, each with its own timeout, and a
+// failing section is reported with its error instead of failing the whole
+// document. Documents are cached for a short time so that status pages
+// polling the endpoint don't turn into load on the dependencies.
+package status
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultTimeout  = 3 * time.Second
+	DefaultCacheTTL = 10 * time.Second
+)
+
+// Section returns the data of one part of the document.
+type Section func(ctx context.Context) (interface{}, error)
+
+type SectionResult struct {
+	Data       interface{} `json:"data,omitempty"`
+	Error      string      `json:"error,omitempty"`
+	DurationMs float64     `json:"duration_ms"`
+}
+
+type Document struct {
+	GeneratedAt time.Time                `json:"generated_at"`
+	Sections    map[string]SectionResult `json:"sections"`
+}
+
+// Failed returns the names of the sections that couldn't be collected.
+func (d Document) Failed() []string {
+	failed := []string{}
+	for name, result := range d.Sections {
+		if result.Error != "" {
+			failed = append(failed, name)
+		}
+	}
+	sort.Strings(failed)
+	return failed
+}
+
+type Collector struct {
+	timeout time.Duration
+	ttl     time.Duration
+	now     func() time.Time
+
+	mu       sync.Mutex
+	sections map[string]Section
+
+	// collecting serializes collections, so concurrent requests for an
+	// expired document wait for one collection instead of starting their own
+	collecting sync.Mutex
+	cached     *Document
+}
+
+// NewCollector returns a collector giving each section timeout and caching
+// documents for ttl. A zero ttl disables the cache.
+func NewCollector(timeout, ttl time.Duration) *Collector {
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+
+	return &Collector{
+		timeout:  timeout,
+		ttl:      ttl,
+		now:      time.Now,
+		sections: make(map[string]Section),
+	}
+}
+
+func (c *Collector) SetClock(now func() time.Time) {
+	c.now = now
+}
+
+// Add registers a section, replacing one of the same name.
+func (c *Collector) Add(name string, section Section) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.sections[name] = section
+}
+
+// Collect returns the cached document or collects a new one.
+func (c *Collector) Collect(ctx context.Context) Document {
+	c.collecting.Lock()
+	defer c.collecting.Unlock()
+
+	if c.cached != nil && c.now().Sub(c.cached.GeneratedAt) < c.ttl {
+		return *c.cached
+	}
+
+	c.mu.Lock()
+	sections := make(map[string]Section, len(c.sections))
+	for name, section := range c.sections {
+		sections[name] = section
+	}
+	c.mu.Unlock()
+
+	document := Document{GeneratedAt: c.now(), Sections: make(map[string]SectionResult, len(sections))}
+	var (
+		wg sync.WaitGroup
+		mu sync.Mutex
+	)
+	for name, section := range sections {
+		wg.Add(1)
+		go func(name string, section Section) {
+			defer wg.Done()
+
+			result := c.collect(ctx, section)
+			mu.Lock()
+			document.Sections[name] = result
+			mu.Unlock()
+		}(name, section)
+	}
+	wg.Wait()
+
+	c.cached = &document
+	return document
+}
+
+// collect runs a section until it returns or its timeout passes. Sections
+// that don't honour the context are left to finish in the background.
+func (c *Collector) collect(ctx context.Context, section Section) SectionResult {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	type outcome struct {
+		data interface{}
+		err  error
+	}
+	start := time.Now()
+	done := make(chan outcome, 1)
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				done <- outcome{err: fmt.Errorf("panic: %v", r)}
+			}
+		}()
+		data, err := section(ctx)
+		done <- outcome{data: data, err: err}
+	}()
+
+	var result SectionResult
+	select {
+	case out := <-done:
+		result.Data = out.data
+		if out.err != nil {
+			result.Data = nil
+			result.Error = out.err.Error()
+		}
+	case <-ctx.Done():
+		result.Error = fmt.Sprintf("timed out after %s", c.timeout)
+	}
+	result.DurationMs = float64(time.Since(start).Microseconds()) / 1000
+	return result
+}
@@ -0,0 +1,87 @@
+package status
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestCollect(t *testing.T) {
+	collector := NewCollector(50*time.Millisecond, time.Minute)
+	now := time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC)
+	collector.SetClock(func() time.Time { return now })
+
+	calls := 0
+	collector.Add("workspaces", func(ctx context.Context) (interface{}, error) {
+		calls++
+		return map[string]int{"running": 3}, nil
+	})
+	collector.Add("queues", func(ctx context.Context) (interface{}, error) {
+		return nil, errors.New("kafka unavailable")
+	})
+	collector.Add("runs", func(ctx context.Context) (interface{}, error) {
+		<-ctx.Done()
+		return 1, nil
+	})
+	collector.Add("panics", func(ctx context.Context) (interface{}, error) {
+		panic("boom")
+	})
+
+	document := collector.Collect(context.Background())
+	if len(document.Sections) != 4 {
+		t.Fatalf("expected 4 sections, got %+v", document.Sections)
+	}
+	if data, ok := document.Sections["workspaces"].Data.(map[string]int); !ok || data["running"] != 3 {
+		t.Errorf("unexpected workspaces section %+v", document.Sections["workspaces"])
+	}
+	if document.Sections["queues"].Error != "kafka unavailable" {
+		t.Errorf("unexpected queues section %+v", document.Sections["queues"])
+	}
+	if got := document.Sections["runs"].Error; got == "" {
+		t.Errorf("expected the runs section to time out")
+	}
+	if failed := document.Failed(); len(failed) != 3 || failed[0] != "panics" || failed[1] != "queues" || failed[2] != "runs" {
+		t.Errorf("unexpected failed sections %v", failed)
+	}
+
+	// documents are cached until the ttl passes
+	collector.Collect(context.Background())
+	if calls != 1 {
+		t.Errorf("expected a cached document, got %d collections", calls)
+	}
+	now = now.Add(time.Minute)
+	if document := collector.Collect(context.Background()); calls != 2 || !document.GeneratedAt.Equal(now) {
+		t.Errorf("expected a new document, got %d collections at %s", calls, document.GeneratedAt)
+	}
+}
+
+func TestRequestRate(t *testing.T) {
+	requests := NewRequests()
+	now := time.Date(2026, 10, 16, 12, 0, 30, 0, time.UTC)
+	requests.SetClock(func() time.Time { return now })
+
+	for _, code := range []int{200, 201, 0, 404, 500} {
+		requests.Record(code)
+	}
+	now = now.Add(10 * time.Minute)
+	for _, code := range []int{200, 503} {
+		requests.Record(code)
+	}
+
+	rate := requests.Rate(5 * time.Minute)
+	if rate.Requests != 2 || rate.ServerErrors != 1 || rate.Rate != 0.5 || rate.WindowSeconds != 300 {
+		t.Errorf("unexpected 5m rate %+v", rate)
+	}
+	rate = requests.Rate(15 * time.Minute)
+	if rate.Requests != 7 || rate.ClientErrors != 1 || rate.ServerErrors != 2 {
+		t.Errorf("unexpected 15m rate %+v", rate)
+	}
+
+	// buckets older than an hour are reused
+	now = now.Add(MaxWindow)
+	requests.Record(200)
+	if rate := requests.Rate(2 * MaxWindow); rate.Requests != 1 || rate.WindowSeconds != MaxWindow.Seconds() {
+		t.Errorf("unexpected rate after an hour %+v", rate)
+	}
+}
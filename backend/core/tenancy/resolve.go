@@ -0,0 +1,91 @@
+package tenancy
+
+import (
+	"fmt"
+
+	"github.com/spectrumwebco/agent_runtime/backend/db/integrations"
+)
+
+// ProjectHeader names the project a request operates on. Requests without
+// it use the organization's default project.
+const ProjectHeader = "X-Kled-Project"
+
+// Resolver maps authenticated principals to tenants using the app_apikey,
+// app_user and app_project tables.
+type Resolver struct {
+	store integrations.SQLStore
+}
+
+func NewResolver(store integrations.SQLStore) *Resolver {
+	return &Resolver{store: store}
+}
+
+func (r *Resolver) EnsureSchema() error {
+	_, err := r.store.ExecuteUpdate(`
+		CREATE TABLE IF NOT EXISTS app_project (
+			id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+			name VARCHAR(255) NOT NULL,
+			slug VARCHAR(255) NOT NULL,
+			organization_id UUID NOT NULL REFERENCES app_organization(id) ON DELETE CASCADE,
+			created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+			updated_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+			UNIQUE (organization_id, slug)
+		);
+		ALTER TABLE app_workspace ADD COLUMN IF NOT EXISTS project_id UUID REFERENCES app_project(id) ON DELETE SET NULL;
+	`)
+	if err != nil {
+		return fmt.Errorf("error creating project schema: %v", err)
+	}
+	return nil
+}
+
+// ForUser resolves the tenant of a user's organization. projectID may be a
+// project ID or slug; it must belong to the same organization.
+func (r *Resolver) ForUser(userID, projectID string) (Tenant, error) {
+	rows, err := r.store.ExecuteQuery(`SELECT organization_id FROM app_user WHERE id = $1`, userID)
+	if err != nil {
+		return Tenant{}, fmt.Errorf("error loading user %s: %v", userID, err)
+	}
+	if len(rows) == 0 || rows[0]["organization_id"] == nil {
+		return Tenant{}, fmt.Errorf("user %s has no organization", userID)
+	}
+	return r.ForOrganization(fmt.Sprint(rows[0]["organization_id"]), projectID)
+}
+
+// ForAPIKey resolves the tenant an API key was issued for.
+func (r *Resolver) ForAPIKey(key, projectID string) (Tenant, error) {
+	rows, err := r.store.ExecuteQuery(`
+		SELECT COALESCE(k.organization_id, u.organization_id) AS organization_id
+		FROM app_apikey k
+		JOIN app_user u ON u.id = k.user_id
+		WHERE k.key = $1 AND (k.expires_at IS NULL OR k.expires_at > now())
+	`, key)
+	if err != nil {
+		return Tenant{}, fmt.Errorf("error loading API key: %v", err)
+	}
+	if len(rows) == 0 {
+		return Tenant{}, fmt.Errorf("invalid API key")
+	}
+	if rows[0]["organization_id"] == nil {
+		return Tenant{}, fmt.Errorf("API key has no organization")
+	}
+	return r.ForOrganization(fmt.Sprint(rows[0]["organization_id"]), projectID)
+}
+
+func (r *Resolver) ForOrganization(organizationID, projectID string) (Tenant, error) {
+	if projectID == "" || projectID == DefaultProject {
+		return New(organizationID, DefaultProject)
+	}
+
+	rows, err := r.store.ExecuteQuery(`
+		SELECT id FROM app_project
+		WHERE organization_id = $1 AND (id::text = $2 OR slug = $2)
+	`, organizationID, projectID)
+	if err != nil {
+		return Tenant{}, fmt.Errorf("error loading project %s: %v", projectID, err)
+	}
+	if len(rows) == 0 {
+		return Tenant{}, fmt.Errorf("%w: project %s is not in organization %s", ErrCrossTenant, projectID, organizationID)
+	}
+	return New(organizationID, fmt.Sprint(rows[0]["id"]))
+}
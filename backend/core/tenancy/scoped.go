@@ -0,0 +1,300 @@
+package tenancy
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/spectrumwebco/agent_runtime/backend/core/redact"
+	"github.com/spectrumwebco/agent_runtime/backend/db/integrations"
+)
+
+// kvStore prefixes every key with the tenant's namespace, so a tenant can
+// only ever address its own keys.
+type kvStore struct {
+	tenant Tenant
+	inner  integrations.KVStore
+}
+
+func NewKVStore(t Tenant, inner integrations.KVStore) integrations.KVStore {
+	return &kvStore{tenant: t, inner: inner}
+}
+
+func (s *kvStore) key(key string) string {
+	return s.tenant.KeyPrefix() + key
+}
+
+func (s *kvStore) Get(key string) (string, error) {
+	return s.inner.Get(s.key(key))
+}
+
+func (s *kvStore) Set(key string, value string, ex int) (bool, error) {
+	return s.inner.Set(s.key(key), value, ex)
+}
+
+func (s *kvStore) Delete(key string) (bool, error) {
+	return s.inner.Delete(s.key(key))
+}
+
+func (s *kvStore) Exists(key string) (bool, error) {
+	return s.inner.Exists(s.key(key))
+}
+
+func (s *kvStore) Expire(key string, seconds int) (bool, error) {
+	return s.inner.Expire(s.key(key), seconds)
+}
+
+func (s *kvStore) GetJSON(key string) (map[string]interface{}, error) {
+	return s.inner.GetJSON(s.key(key))
+}
+
+func (s *kvStore) SetJSON(key string, value map[string]interface{}, ex int) (bool, error) {
+	return s.inner.SetJSON(s.key(key), value, ex)
+}
+
+func (s *kvStore) HGet(name string, key string) (string, error) {
+	return s.inner.HGet(s.key(name), key)
+}
+
+func (s *kvStore) HSet(name string, key string, value string) (bool, error) {
+	return s.inner.HSet(s.key(name), key, value)
+}
+
+func (s *kvStore) HGetAll(name string) (map[string]string, error) {
+	return s.inner.HGetAll(s.key(name))
+}
+
+// vectorStore maps index names onto one physical index per tenant.
+type vectorStore struct {
+	tenant Tenant
+	inner  integrations.VectorStore
+}
+
+// NewVectorStore scopes a vector store to the tenant's namespace. Stores
+// that route namespaces themselves, such as RAGflowManager, resolve the
+// tenant's aliases within it.
+func NewVectorStore(t Tenant, inner integrations.VectorStore) integrations.VectorStore {
+	if namespacer, ok := inner.(integrations.VectorNamespacer); ok {
+		return namespacer.Namespace(t.IndexName(""))
+	}
+	return &vectorStore{tenant: t, inner: inner}
+}
+
+func (s *vectorStore) CreateIndex(indexName string, dimension int, metric string) (bool, error) {
+	return s.inner.CreateIndex(s.tenant.IndexName(indexName), dimension, metric)
+}
+
+func (s *vectorStore) DeleteIndex(indexName string) (bool, error) {
+	return s.inner.DeleteIndex(s.tenant.IndexName(indexName))
+}
+
+// ListIndexes returns only the tenant's indexes, under their unscoped names.
+func (s *vectorStore) ListIndexes() ([]string, error) {
+	indexes, err := s.inner.ListIndexes()
+	if err != nil {
+		return nil, err
+	}
+	prefix := s.tenant.IndexName("")
+	var result []string
+	for _, name := range indexes {
+		if strings.HasPrefix(name, prefix) {
+			result = append(result, strings.TrimPrefix(name, prefix))
+		}
+	}
+	return result, nil
+}
+
+func (s *vectorStore) AddVectors(indexName string, vectors [][]float64, ids []string, metadata []map[string]interface{}) (bool, []string, error) {
+	return s.inner.AddVectors(s.tenant.IndexName(indexName), vectors, ids, metadata)
+}
+
+func (s *vectorStore) DeleteVectors(indexName string, ids []string) (bool, error) {
+	return s.inner.DeleteVectors(s.tenant.IndexName(indexName), ids)
+}
+
+func (s *vectorStore) Search(indexName string, queryVector []float64, topK int, filterMetadata map[string]interface{}) ([]map[string]interface{}, error) {
+	return s.inner.Search(s.tenant.IndexName(indexName), queryVector, topK, filterMetadata)
+}
+
+func (s *vectorStore) SemanticSearch(indexName string, queryText string, topK int, filterMetadata map[string]interface{}) ([]map[string]interface{}, error) {
+	return s.inner.SemanticSearch(s.tenant.IndexName(indexName), queryText, topK, filterMetadata)
+}
+
+func (s *vectorStore) GetVector(indexName string, vectorID string) (map[string]interface{}, error) {
+	return s.inner.GetVector(s.tenant.IndexName(indexName), vectorID)
+}
+
+func (s *vectorStore) UpdateVectorMetadata(indexName string, vectorID string, metadata map[string]interface{}) (bool, error) {
+	return s.inner.UpdateVectorMetadata(s.tenant.IndexName(indexName), vectorID, metadata)
+}
+
+// SchemaPlaceholder is replaced with the tenant's schema in statements run
+// through a scoped SQLStore, e.g. "SELECT * FROM {schema}.trajectories".
+const SchemaPlaceholder = "{schema}"
+
+// tenantSchemaPattern matches schema-qualified references to a tenant schema,
+// quoted or not, but not columns such as tenant_id.
+var tenantSchemaPattern = regexp.MustCompile("(?i)\\btenant_[a-z0-9_]+[\"`]?\\s*\\.")
+
+// sessionPattern matches statements that switch the schema of the pooled
+// connection they run on, which would leak to the statements after them.
+var sessionPattern = regexp.MustCompile(`(?i)^\s*(set|reset|use)\b|\bsearch_path\b|\bset_config\s*\(`)
+
+// SQLStore runs statements against the tenant's own schema. Statements must
+// be a single statement that addresses tenant tables through
+// SchemaPlaceholder; statements naming any tenant schema directly, switching
+// the schema of the connection, or hiding code in comments are rejected.
+type SQLStore struct {
+	tenant Tenant
+	inner  integrations.SQLStore
+	create string
+
+	// hashComments is set for MySQL dialects, where # starts a comment
+	hashComments bool
+}
+
+// NewPostgresStore scopes a Postgres client to a schema per tenant.
+func NewPostgresStore(t Tenant, inner integrations.SQLStore) *SQLStore {
+	return &SQLStore{tenant: t, inner: inner, create: "CREATE SCHEMA IF NOT EXISTS %s"}
+}
+
+// NewDorisStore scopes a Doris client to a database per tenant.
+func NewDorisStore(t Tenant, inner integrations.SQLStore) *SQLStore {
+	return &SQLStore{tenant: t, inner: inner, create: "CREATE DATABASE IF NOT EXISTS %s", hashComments: true}
+}
+
+func (s *SQLStore) rewrite(query string) (string, error) {
+	code, err := s.code(query)
+	if err != nil {
+		return "", err
+	}
+	switch {
+	case !strings.Contains(code, SchemaPlaceholder):
+		return "", fmt.Errorf("%w: statement does not address tables through %s", ErrCrossTenant, SchemaPlaceholder)
+	case tenantSchemaPattern.MatchString(code):
+		return "", fmt.Errorf("%w: statement names a tenant schema directly", ErrCrossTenant)
+	case sessionPattern.MatchString(code):
+		return "", fmt.Errorf("%w: statement changes the schema of the connection", ErrCrossTenant)
+	}
+	return strings.ReplaceAll(query, SchemaPlaceholder, s.tenant.SchemaName()), nil
+}
+
+// code returns the statement with its string literals blanked out, so that
+// only the SQL itself is checked. Comments, further statements and quoting
+// the checks can't follow are rejected.
+func (s *SQLStore) code(query string) (string, error) {
+	var code strings.Builder
+	for i := 0; i < len(query); i++ {
+		c := query[i]
+		switch {
+		case c == '\'':
+			// a literal ends at the next quote that isn't doubled
+			end := i + 1
+			for ; end < len(query); end++ {
+				if query[end] == '\\' {
+					return "", fmt.Errorf("%w: statement has a backslash in a string literal", ErrCrossTenant)
+				}
+				if query[end] == '\'' {
+					if end+1 < len(query) && query[end+1] == '\'' {
+						end++
+						continue
+					}
+					break
+				}
+			}
+			if end == len(query) {
+				return "", fmt.Errorf("%w: statement has an unterminated string literal", ErrCrossTenant)
+			}
+			code.WriteString("''")
+			i = end
+		case c == '"' || c == '`':
+			// quoted identifiers are kept, so that the checks see them
+			end := strings.IndexByte(query[i+1:], c)
+			if end < 0 {
+				return "", fmt.Errorf("%w: statement has an unterminated quoted identifier", ErrCrossTenant)
+			}
+			code.WriteString(query[i : i+end+2])
+			i += end + 1
+		case strings.HasPrefix(query[i:], "--"), strings.HasPrefix(query[i:], "/*"), c == '#' && s.hashComments:
+			return "", fmt.Errorf("%w: statement has a comment", ErrCrossTenant)
+		case c == '$' && i+1 < len(query) && (query[i+1] == '$' || isIdentifierStart(query[i+1])):
+			return "", fmt.Errorf("%w: statement has a dollar-quoted string", ErrCrossTenant)
+		case c == ';':
+			if strings.TrimSpace(query[i+1:]) != "" {
+				return "", fmt.Errorf("%w: query has more than one statement", ErrCrossTenant)
+			}
+			return code.String(), nil
+		default:
+			code.WriteByte(c)
+		}
+	}
+	return code.String(), nil
+}
+
+func isIdentifierStart(c byte) bool {
+	return c == '_' || 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z'
+}
+
+func (s *SQLStore) ExecuteQuery(query string, params ...interface{}) ([]map[string]interface{}, error) {
+	query, err := s.rewrite(query)
+	if err != nil {
+		return nil, err
+	}
+	return s.inner.ExecuteQuery(query, params...)
+}
+
+func (s *SQLStore) ExecuteUpdate(query string, params ...interface{}) (int64, error) {
+	query, err := s.rewrite(query)
+	if err != nil {
+		return 0, err
+	}
+	return s.inner.ExecuteUpdate(query, params...)
+}
+
+// EnsureSchema creates the tenant's schema if it does not exist.
+func (s *SQLStore) EnsureSchema() error {
+	if _, err := s.inner.ExecuteUpdate(fmt.Sprintf(s.create, s.tenant.SchemaName())); err != nil {
+		return fmt.Errorf("error creating schema for tenant %s: %v", s.tenant, err)
+	}
+	return nil
+}
+
+// KV returns the default KVStore scoped to the context's tenant.
+func KV(ctx context.Context) (integrations.KVStore, error) {
+	t, err := Require(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return NewKVStore(t, integrations.GetKVStore()), nil
+}
+
+// Vectors returns the default VectorStore scoped to the context's tenant.
+func Vectors(ctx context.Context) (integrations.VectorStore, error) {
+	t, err := Require(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return NewVectorStore(t, integrations.GetVectorStore()), nil
+}
+
+// Postgres returns the default Postgres client scoped to the context's tenant.
+func Postgres(ctx context.Context) (*SQLStore, error) {
+	t, err := Require(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return NewPostgresStore(t, integrations.GetPostgresStore("default")), nil
+}
+
+// Trajectories returns the Doris client scoped to the context's tenant.
+// Trajectory tables live in the tenant's database rather than the shared
+// trajectory_db. Values written through it are redacted.
+func Trajectories(ctx context.Context) (*SQLStore, error) {
+	t, err := Require(ctx)
+	if err != nil {
+		return nil, err
+	}
+	store := redact.NewSQLStore(integrations.GetDorisStore(""), redact.Default(), redact.SourceTrajectory)
+	return NewDorisStore(t, store), nil
+}
@@ -0,0 +1,120 @@
+package tenancy
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/spectrumwebco/agent_runtime/backend/db/integrations/integrationsmock"
+)
+
+func TestKVStoreIsolatesTenants(t *testing.T) {
+	inner := integrationsmock.NewKVStore()
+	a := NewKVStore(Tenant{OrganizationID: "org-a", ProjectID: "p1"}, inner)
+	b := NewKVStore(Tenant{OrganizationID: "org-b", ProjectID: "p1"}, inner)
+
+	if _, err := a.Set("state", "a", 0); err != nil {
+		t.Fatal(err)
+	}
+	if value, _ := b.Get("state"); value != "" {
+		t.Errorf("tenant b read tenant a's key: %q", value)
+	}
+	if value, _ := inner.Get("t:org-a:p1:state"); value != "a" {
+		t.Errorf("expected prefixed key, got %q", value)
+	}
+}
+
+func TestVectorStoreListsOwnIndexes(t *testing.T) {
+	inner := integrationsmock.NewVectorStore()
+	a := NewVectorStore(Tenant{OrganizationID: "org-a"}, inner)
+	b := NewVectorStore(Tenant{OrganizationID: "org-b"}, inner)
+
+	a.CreateIndex("docs", 3, "cosine")
+	b.CreateIndex("code", 3, "cosine")
+
+	indexes, err := a.ListIndexes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(indexes) != 1 || indexes[0] != "docs" {
+		t.Errorf("expected [docs], got %v", indexes)
+	}
+}
+
+func TestSQLStoreRewritesSchema(t *testing.T) {
+	inner := integrationsmock.NewSQLStore()
+	store := NewPostgresStore(Tenant{OrganizationID: "org-a"}, inner)
+
+	if _, err := store.ExecuteQuery("SELECT * FROM {schema}.trajectories"); err != nil {
+		t.Fatal(err)
+	}
+	statements := inner.Statements()
+	if got := statements[len(statements)-1].Query; got != "SELECT * FROM tenant_org_a.trajectories" {
+		t.Errorf("unexpected rewrite: %s", got)
+	}
+
+	if _, err := store.ExecuteQuery("SELECT * FROM {schema}.trajectories WHERE tenant_id = $1", "org-a"); err != nil {
+		t.Errorf("expected a tenant_id column to be allowed, got %v", err)
+	}
+	for _, query := range []string{
+		"SELECT * FROM tenant_org_b.trajectories",
+		`SELECT * FROM "tenant_org_b" . trajectories`,
+	} {
+		if _, err := store.ExecuteQuery(query); !errors.Is(err, ErrCrossTenant) {
+			t.Errorf("expected ErrCrossTenant for %s, got %v", query, err)
+		}
+	}
+}
+
+func TestSQLStoreRejectsBypasses(t *testing.T) {
+	inner := integrationsmock.NewSQLStore()
+	postgres := NewPostgresStore(Tenant{OrganizationID: "org-a"}, inner)
+	doris := NewDorisStore(Tenant{OrganizationID: "org-a"}, inner)
+
+	for _, query := range []string{
+		"SET search_path TO tenant_org_b",
+		"SELECT set_config('search_path', 'tenant_org_b', false) FROM {schema}.trajectories",
+		"SELECT * FROM trajectories",
+		"SELECT * FROM {schema}.trajectories; SET search_path TO tenant_org_b",
+		"SELECT * FROM tenant_org_b/**/.trajectories, {schema}.trajectories",
+		"SELECT * FROM {schema}.trajectories -- tenant_org_b",
+		"SELECT * FROM {schema}.trajectories WHERE id = $$'$$",
+		"SELECT * FROM {schema}.trajectories WHERE id = 'it\\'s'",
+		`SELECT * FROM "tenant_org_b".trajectories WHERE "'" = {schema}.id`,
+		"SELECT * FROM {schema}.trajectories WHERE id = 'unterminated",
+	} {
+		if _, err := postgres.ExecuteQuery(query); !errors.Is(err, ErrCrossTenant) {
+			t.Errorf("expected ErrCrossTenant for %s, got %v", query, err)
+		}
+	}
+	for _, query := range []string{
+		"USE tenant_org_b",
+		"SELECT * FROM `tenant_org_b`.trajectories, {schema}.trajectories",
+		"SELECT * FROM {schema}.trajectories # tenant_org_b",
+	} {
+		if _, err := doris.ExecuteQuery(query); !errors.Is(err, ErrCrossTenant) {
+			t.Errorf("expected ErrCrossTenant for %s, got %v", query, err)
+		}
+	}
+	if len(inner.Statements()) != 0 {
+		t.Errorf("rejected statements reached the database: %v", inner.Statements())
+	}
+
+	for _, query := range []string{
+		"SELECT * FROM {schema}.trajectories WHERE status = 'it''s -- not a comment; tenant_org_b.x';",
+		`SELECT "tenant_id" FROM {schema}.trajectories WHERE steps @> $1`,
+	} {
+		if _, err := postgres.ExecuteQuery(query); err != nil {
+			t.Errorf("expected %s to be allowed, got %v", query, err)
+		}
+	}
+}
+
+func TestRequireTenant(t *testing.T) {
+	if _, err := KV(context.Background()); !errors.Is(err, ErrNoTenant) {
+		t.Errorf("expected ErrNoTenant, got %v", err)
+	}
+	if _, err := New("Org A", ""); err == nil {
+		t.Error("expected invalid organization id to be rejected")
+	}
+}
@@ -0,0 +1,110 @@
+package tenancy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+var (
+	ErrNoTenant    = errors.New("no tenant in context")
+	ErrCrossTenant = errors.New("cross-tenant access denied")
+)
+
+// DefaultProject is used when a request names an organization but no
+// project.
+const DefaultProject = "default"
+
+var identifierPattern = regexp.MustCompile(`^[a-z0-9-]+$`)
+
+// Tenant identifies the organization and project that owns a piece of
+// state. Every tenant-scoped store derives its namespace from it.
+type Tenant struct {
+	OrganizationID string `json:"organization_id"`
+	ProjectID      string `json:"project_id"`
+}
+
+func New(organizationID, projectID string) (Tenant, error) {
+	if projectID == "" {
+		projectID = DefaultProject
+	}
+	t := Tenant{OrganizationID: organizationID, ProjectID: projectID}
+	return t, t.Validate()
+}
+
+func (t Tenant) Validate() error {
+	if t.OrganizationID == "" {
+		return fmt.Errorf("tenant has no organization")
+	}
+	if !identifierPattern.MatchString(t.OrganizationID) {
+		return fmt.Errorf("invalid organization id %q", t.OrganizationID)
+	}
+	if t.ProjectID != "" && !identifierPattern.MatchString(t.ProjectID) {
+		return fmt.Errorf("invalid project id %q", t.ProjectID)
+	}
+	return nil
+}
+
+func (t Tenant) project() string {
+	if t.ProjectID == "" {
+		return DefaultProject
+	}
+	return t.ProjectID
+}
+
+func (t Tenant) String() string {
+	return t.OrganizationID + "/" + t.project()
+}
+
+// KeyPrefix is prepended to every key written through a scoped KVStore.
+func (t Tenant) KeyPrefix() string {
+	return "t:" + t.OrganizationID + ":" + t.project() + ":"
+}
+
+// ScopedID namespaces an identifier, such as a shared state ID, that is
+// passed to a component without its own tenant awareness.
+func (t Tenant) ScopedID(id string) string {
+	return t.KeyPrefix() + id
+}
+
+// IndexName is the per-tenant name of a vector index.
+func (t Tenant) IndexName(name string) string {
+	return t.sanitized() + "__" + name
+}
+
+// SchemaName is the per-tenant Postgres schema, or Doris database, that holds
+// the tenant's tables. Projects share their organization's schema.
+func (t Tenant) SchemaName() string {
+	return "tenant_" + sanitize(t.OrganizationID)
+}
+
+func (t Tenant) sanitized() string {
+	return sanitize(t.OrganizationID) + "_" + sanitize(t.project())
+}
+
+func sanitize(id string) string {
+	return strings.ReplaceAll(id, "-", "_")
+}
+
+type tenantKey struct{}
+
+func WithTenant(ctx context.Context, t Tenant) context.Context {
+	return context.WithValue(ctx, tenantKey{}, t)
+}
+
+func FromContext(ctx context.Context) (Tenant, bool) {
+	t, ok := ctx.Value(tenantKey{}).(Tenant)
+	return t, ok
+}
+
+// Require returns the context's tenant or ErrNoTenant. Stores use it
+// so that unscoped calls fail instead of reading another tenant's data.
+func Require(ctx context.Context) (Tenant, error) {
+	t, ok := FromContext(ctx)
+	if !ok {
+		return Tenant{}, ErrNoTenant
+	}
+	return t, nil
+}
@@ -0,0 +1,195 @@
+package terminal
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	corev1 "k8s.io/api/core/v1"
+
+	pb "github.com/spectrumwebco/agent_runtime/backend/protos/gen/go/agent_control"
+)
+
+// DaemonConfigEnv holds the config of the agent daemon in the workspace
+// container, including the address and token of its control channel.
+const DaemonConfigEnv = "KLED_WORKSPACE_DAEMON_CONFIG"
+
+// errNoControlChannel is returned for workspaces whose agent doesn't serve a
+// control channel.
+var errNoControlChannel = errors.New("workspace agent has no control channel")
+
+// AgentExecutor runs commands through the control channel of the agent
+// daemon in the workspace pod. Workspaces without a control channel fall back
+// to exec into the pod.
+type AgentExecutor struct {
+	pods *KubernetesExecutor
+}
+
+func NewAgentExecutor(namespace string) (*AgentExecutor, error) {
+	pods, err := NewKubernetesExecutor(namespace)
+	if err != nil {
+		return nil, err
+	}
+	return &AgentExecutor{pods: pods}, nil
+}
+
+func (e *AgentExecutor) Exec(ctx context.Context, workspaceID string, options ExecOptions) (int, error) {
+	pod, err := e.pods.findPod(ctx, workspaceID)
+	if err != nil {
+		return 0, err
+	}
+
+	address, token, err := controlEndpoint(pod)
+	if errors.Is(err, errNoControlChannel) {
+		return e.pods.Exec(ctx, workspaceID, options)
+	} else if err != nil {
+		return 0, err
+	}
+
+	conn, err := grpc.NewClient(address,
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithPerRPCCredentials(controlToken(token)),
+	)
+	if err != nil {
+		return 0, fmt.Errorf("error connecting to workspace agent: %v", err)
+	}
+	defer conn.Close()
+
+	return runControlExec(ctx, pb.NewControlClient(conn), options)
+}
+
+// controlEndpoint reads the control channel address and token from the
+// daemon config of the workspace container.
+func controlEndpoint(pod *corev1.Pod) (string, string, error) {
+	encoded := ""
+	for _, container := range pod.Spec.Containers {
+		if container.Name != ContainerName {
+			continue
+		}
+		for _, env := range container.Env {
+			if env.Name == DaemonConfigEnv {
+				encoded = env.Value
+			}
+		}
+	}
+	if encoded == "" || pod.Status.PodIP == "" {
+		return "", "", errNoControlChannel
+	}
+
+	decoded, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return "", "", fmt.Errorf("error decoding daemon config: %v", err)
+	}
+	config := struct {
+		Control struct {
+			Address string `json:"address"`
+			Token   string `json:"token"`
+		} `json:"control"`
+	}{}
+	if err := json.Unmarshal(decoded, &config); err != nil {
+		return "", "", fmt.Errorf("error decoding daemon config: %v", err)
+	}
+	if config.Control.Address == "" || config.Control.Token == "" {
+		return "", "", errNoControlChannel
+	}
+
+	_, port, err := net.SplitHostPort(config.Control.Address)
+	if err != nil {
+		return "", "", fmt.Errorf("invalid control address %q: %v", config.Control.Address, err)
+	}
+	return net.JoinHostPort(pod.Status.PodIP, port), config.Control.Token, nil
+}
+
+type controlToken string
+
+func (t controlToken) GetRequestMetadata(context.Context, ...string) (map[string]string, error) {
+	return map[string]string{"authorization": "Bearer " + string(t)}, nil
+}
+
+func (t controlToken) RequireTransportSecurity() bool {
+	return false
+}
+
+// runControlExec runs the command of options with a TTY over the control
+// channel.
+func runControlExec(ctx context.Context, client pb.ControlClient, options ExecOptions) (int, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	stream, err := client.Exec(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("error starting exec: %v", err)
+	}
+	var m sync.Mutex
+	send := func(req *pb.ExecRequest) error {
+		m.Lock()
+		defer m.Unlock()
+		return stream.Send(req)
+	}
+
+	start := &pb.ExecStart{Command: options.Command, Tty: true}
+	if err := send(&pb.ExecRequest{Request: &pb.ExecRequest_Start{Start: start}}); err != nil {
+		return 0, fmt.Errorf("error starting exec: %v", err)
+	}
+
+	go func() {
+		for {
+			select {
+			case size := <-options.Sizes:
+				resize := &pb.TerminalSize{Rows: uint32(size.Rows), Columns: uint32(size.Columns)}
+				if send(&pb.ExecRequest{Request: &pb.ExecRequest_Resize{Resize: resize}}) != nil {
+					return
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	if options.Stdin != nil {
+		go func() {
+			buf := make([]byte, 32*1024)
+			for {
+				n, err := options.Stdin.Read(buf)
+				if n > 0 {
+					data := append([]byte(nil), buf[:n]...)
+					if send(&pb.ExecRequest{Request: &pb.ExecRequest_Stdin{Stdin: data}}) != nil {
+						return
+					}
+				}
+				if err != nil {
+					_ = send(&pb.ExecRequest{Request: &pb.ExecRequest_CloseStdin{CloseStdin: true}})
+					return
+				}
+			}
+		}()
+	}
+
+	for {
+		response, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			return 0, errors.New("workspace agent closed the exec stream")
+		} else if err != nil {
+			return 0, err
+		}
+
+		switch response := response.Response.(type) {
+		case *pb.ExecResponse_Stdout:
+			if _, err := options.Stdout.Write(response.Stdout); err != nil {
+				return 0, err
+			}
+		case *pb.ExecResponse_Stderr:
+			if _, err := options.Stdout.Write(response.Stderr); err != nil {
+				return 0, err
+			}
+		case *pb.ExecResponse_ExitCode:
+			return int(response.ExitCode), nil
+		}
+	}
+}
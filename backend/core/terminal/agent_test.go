@@ -0,0 +1,125 @@
+package terminal
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	corev1 "k8s.io/api/core/v1"
+
+	pb "github.com/spectrumwebco/agent_runtime/backend/protos/gen/go/agent_control"
+)
+
+func TestControlEndpoint(t *testing.T) {
+	pod := &corev1.Pod{
+		Spec: corev1.PodSpec{Containers: []corev1.Container{{Name: ContainerName}}},
+		Status: corev1.PodStatus{
+			PodIP: "10.0.0.7",
+		},
+	}
+	if _, _, err := controlEndpoint(pod); !errors.Is(err, errNoControlChannel) {
+		t.Fatalf("expected no control channel, got %v", err)
+	}
+
+	config := base64.StdEncoding.EncodeToString([]byte(`{"control":{"address":":12049","token":"secret"}}`))
+	pod.Spec.Containers[0].Env = []corev1.EnvVar{{Name: DaemonConfigEnv, Value: config}}
+	address, token, err := controlEndpoint(pod)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if address != "10.0.0.7:12049" || token != "secret" {
+		t.Fatalf("unexpected endpoint %s with token %s", address, token)
+	}
+}
+
+// catControl echoes stdin until it is closed and exits with 5.
+type catControl struct {
+	pb.UnimplementedControlServer
+	resized chan *pb.TerminalSize
+}
+
+func (c *catControl) Exec(stream pb.Control_ExecServer) error {
+	md, _ := metadata.FromIncomingContext(stream.Context())
+	if strings.Join(md.Get("authorization"), "") != "Bearer secret" {
+		return errors.New("unauthenticated")
+	}
+
+	for {
+		req, err := stream.Recv()
+		if err != nil {
+			return err
+		}
+
+		switch request := req.Request.(type) {
+		case *pb.ExecRequest_Start:
+			if !request.Start.Tty {
+				return errors.New("expected a terminal")
+			}
+		case *pb.ExecRequest_Stdin:
+			if err := stream.Send(&pb.ExecResponse{Response: &pb.ExecResponse_Stdout{Stdout: request.Stdin}}); err != nil {
+				return err
+			}
+		case *pb.ExecRequest_Resize:
+			c.resized <- request.Resize
+		case *pb.ExecRequest_CloseStdin:
+			return stream.Send(&pb.ExecResponse{Response: &pb.ExecResponse_ExitCode{ExitCode: 5}})
+		}
+	}
+}
+
+func TestRunControlExec(t *testing.T) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := grpc.NewServer()
+	control := &catControl{resized: make(chan *pb.TerminalSize, 1)}
+	pb.RegisterControlServer(server, control)
+	go func() {
+		_ = server.Serve(lis)
+	}()
+	defer server.Stop()
+
+	conn, err := grpc.NewClient(lis.Addr().String(),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithPerRPCCredentials(controlToken("secret")),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	sizes := make(chan Size, 1)
+	sizes <- Size{Columns: 80, Rows: 24}
+	stdin, stdinWriter := io.Pipe()
+	go func() {
+		_, _ = stdinWriter.Write([]byte("ls\n"))
+		// close stdin only after the resize arrived
+		if size := <-control.resized; size.Columns != 80 || size.Rows != 24 {
+			t.Errorf("unexpected terminal size %v", size)
+		}
+		_ = stdinWriter.Close()
+	}()
+
+	stdout := &bytes.Buffer{}
+	code, err := runControlExec(context.Background(), pb.NewControlClient(conn), ExecOptions{
+		Command: []string{"bash"},
+		Stdin:   stdin,
+		Stdout:  stdout,
+		Sizes:   sizes,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if code != 5 || stdout.String() != "ls\n" {
+		t.Fatalf("unexpected exit code %d with output %q", code, stdout.String())
+	}
+}
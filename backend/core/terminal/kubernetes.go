@@ -0,0 +1,120 @@
+package terminal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+	"k8s.io/client-go/tools/remotecommand"
+	utilexec "k8s.io/client-go/util/exec"
+)
+
+const (
+	// WorkspaceLabel and ContainerName match the pods created by the kled
+	// kubernetes driver.
+	WorkspaceLabel = "kled.sh/workspace"
+	ContainerName  = "kled"
+)
+
+// KubernetesExecutor execs into the pod of a workspace.
+type KubernetesExecutor struct {
+	client kubernetes.Interface
+	config *rest.Config
+	// namespace limits the pod lookup, empty searches all namespaces
+	namespace string
+}
+
+// NewKubernetesExecutor uses the in-cluster config and falls back to the
+// default kubeconfig.
+func NewKubernetesExecutor(namespace string) (*KubernetesExecutor, error) {
+	config, err := rest.InClusterConfig()
+	if errors.Is(err, rest.ErrNotInCluster) {
+		config, err = clientcmd.NewNonInteractiveDeferredLoadingClientConfig(
+			clientcmd.NewDefaultClientConfigLoadingRules(),
+			&clientcmd.ConfigOverrides{},
+		).ClientConfig()
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error loading kubernetes config: %v", err)
+	}
+
+	client, err := kubernetes.NewForConfig(config)
+	if err != nil {
+		return nil, fmt.Errorf("error creating kubernetes client: %v", err)
+	}
+	return &KubernetesExecutor{client: client, config: config, namespace: namespace}, nil
+}
+
+func (e *KubernetesExecutor) findPod(ctx context.Context, workspaceID string) (*corev1.Pod, error) {
+	pods, err := e.client.CoreV1().Pods(e.namespace).List(ctx, metav1.ListOptions{
+		LabelSelector: WorkspaceLabel + "=" + workspaceID,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error finding pod of workspace %s: %v", workspaceID, err)
+	}
+	for i := range pods.Items {
+		if pods.Items[i].Status.Phase == corev1.PodRunning {
+			return &pods.Items[i], nil
+		}
+	}
+	return nil, fmt.Errorf("workspace %s is not running", workspaceID)
+}
+
+func (e *KubernetesExecutor) Exec(ctx context.Context, workspaceID string, options ExecOptions) (int, error) {
+	pod, err := e.findPod(ctx, workspaceID)
+	if err != nil {
+		return 0, err
+	}
+
+	req := e.client.CoreV1().RESTClient().Post().
+		Resource("pods").
+		Namespace(pod.Namespace).
+		Name(pod.Name).
+		SubResource("exec").
+		VersionedParams(&corev1.PodExecOptions{
+			Container: ContainerName,
+			Command:   options.Command,
+			Stdin:     true,
+			Stdout:    true,
+			TTY:       true,
+		}, scheme.ParameterCodec)
+
+	executor, err := remotecommand.NewSPDYExecutor(e.config, "POST", req.URL())
+	if err != nil {
+		return 0, fmt.Errorf("error creating exec session: %v", err)
+	}
+
+	err = executor.StreamWithContext(ctx, remotecommand.StreamOptions{
+		Stdin:             options.Stdin,
+		Stdout:            options.Stdout,
+		Tty:               true,
+		TerminalSizeQueue: sizeQueue{ctx: ctx, sizes: options.Sizes},
+	})
+	var exitErr utilexec.CodeExitError
+	if errors.As(err, &exitErr) {
+		return exitErr.Code, nil
+	} else if err != nil {
+		return 0, err
+	}
+	return 0, nil
+}
+
+type sizeQueue struct {
+	ctx   context.Context
+	sizes <-chan Size
+}
+
+func (q sizeQueue) Next() *remotecommand.TerminalSize {
+	select {
+	case size := <-q.sizes:
+		return &remotecommand.TerminalSize{Width: size.Columns, Height: size.Rows}
+	case <-q.ctx.Done():
+		return nil
+	}
+}
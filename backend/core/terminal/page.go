@@ -0,0 +1,28 @@
+package terminal
+
+import (
+	_ "embed"
+	"html/template"
+	"net/http"
+	"strconv"
+)
+
+//go:embed terminal.html
+var pageSource string
+
+var page = template.Must(template.New("terminal").Parse(pageSource))
+
+// WritePage serves the xterm.js front end. It connects back to the URL it
+// was served from, so the same path serves the page and the WebSocket.
+func WritePage(w http.ResponseWriter, workspaceID string) error {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	return page.Execute(w, map[string]string{"WorkspaceID": workspaceID})
+}
+
+// SizeFromQuery reads the initial terminal size sent by the page.
+func SizeFromQuery(r *http.Request) Size {
+	columns, _ := strconv.ParseUint(r.URL.Query().Get("columns"), 10, 16)
+	rows, _ := strconv.ParseUint(r.URL.Query().Get("rows"), 10, 16)
+	return Size{Columns: uint16(columns), Rows: uint16(rows)}
+}
@@ -0,0 +1,56 @@
+// Package terminal serves browser terminals attached to exec sessions in
+// workspaces.
+//
+// The WebSocket protocol follows ttyd, so xterm.js front ends written for it
+// work unchanged. Every message starts with a one byte opcode:
+//
+//	client -> server   '0' <input bytes>
+//	                   '1' {"columns": 80, "rows": 24}
+//	server -> client   '0' <output bytes>
+//	                   '1' {"type": "exit", "code": 0}
+//
+// Sessions are recorded in the asciicast v2 format and end when the process
+// exits, the browser disconnects or no input arrived for the idle timeout.
+package terminal
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+const (
+	OpInput  = '0'
+	OpResize = '1'
+
+	OpOutput = '0'
+	OpStatus = '1'
+)
+
+// Status types sent to the browser before the connection is closed.
+const (
+	StatusExit  = "exit"
+	StatusIdle  = "idle"
+	StatusError = "error"
+)
+
+type Size struct {
+	Columns uint16 `json:"columns"`
+	Rows    uint16 `json:"rows"`
+}
+
+type Status struct {
+	Type    string `json:"type"`
+	Code    int    `json:"code,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+func parseResize(payload []byte) (Size, error) {
+	size := Size{}
+	if err := json.Unmarshal(payload, &size); err != nil {
+		return size, fmt.Errorf("invalid resize message: %v", err)
+	}
+	if size.Columns == 0 || size.Rows == 0 {
+		return size, fmt.Errorf("invalid terminal size %dx%d", size.Columns, size.Rows)
+	}
+	return size, nil
+}
@@ -0,0 +1,103 @@
+package terminal
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// DefaultMaxRecordingSize caps a recording, output past it is dropped.
+const DefaultMaxRecordingSize = 10 << 20
+
+// Recorder writes a session in the asciicast v2 format.
+type Recorder struct {
+	buf       bytes.Buffer
+	start     time.Time
+	limit     int
+	truncated bool
+	now       func() time.Time
+	mu        sync.Mutex
+}
+
+func NewRecorder(size Size, start time.Time, limit int) *Recorder {
+	r := &Recorder{start: start, limit: limit, now: time.Now}
+	header, _ := json.Marshal(map[string]interface{}{
+		"version":   2,
+		"width":     size.Columns,
+		"height":    size.Rows,
+		"timestamp": start.Unix(),
+	})
+	r.buf.Write(header)
+	r.buf.WriteByte('\n')
+	return r
+}
+
+func (r *Recorder) event(code string, data string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.truncated {
+		return
+	}
+	line, _ := json.Marshal([]interface{}{r.now().Sub(r.start).Seconds(), code, data})
+	if r.limit > 0 && r.buf.Len()+len(line)+1 > r.limit {
+		r.truncated = true
+		return
+	}
+	r.buf.Write(line)
+	r.buf.WriteByte('\n')
+}
+
+func (r *Recorder) Output(data []byte) {
+	r.event("o", string(data))
+}
+
+func (r *Recorder) Resize(size Size) {
+	r.event("r", fmt.Sprintf("%dx%d", size.Columns, size.Rows))
+}
+
+// Truncated reports whether output was dropped because of the size limit.
+func (r *Recorder) Truncated() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.truncated
+}
+
+func (r *Recorder) Bytes() []byte {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]byte(nil), r.buf.Bytes()...)
+}
+
+// RecordingStore persists finished recordings and returns where they are.
+type RecordingStore interface {
+	Save(ctx context.Context, name string, data []byte) (string, error)
+}
+
+// Uploader is implemented by integrations.SupabaseManager.
+type Uploader interface {
+	UploadFile(bucket, path string, fileData []byte, contentType string) (bool, string, error)
+}
+
+// SupabaseRecordingStore uploads recordings to a Supabase storage bucket.
+type SupabaseRecordingStore struct {
+	uploader Uploader
+	bucket   string
+}
+
+func NewSupabaseRecordingStore(uploader Uploader, bucket string) *SupabaseRecordingStore {
+	return &SupabaseRecordingStore{uploader: uploader, bucket: bucket}
+}
+
+func (s *SupabaseRecordingStore) Save(ctx context.Context, name string, data []byte) (string, error) {
+	ok, url, err := s.uploader.UploadFile(s.bucket, name, data, "application/x-asciicast")
+	if err != nil {
+		return "", fmt.Errorf("error uploading recording %s: %v", name, err)
+	} else if !ok {
+		return "", fmt.Errorf("error uploading recording %s", name)
+	}
+	return url, nil
+}
@@ -0,0 +1,225 @@
+package terminal
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+const (
+	DefaultIdleTimeout = 15 * time.Minute
+
+	// ReasonDisconnect ends a session whose browser went away.
+	ReasonDisconnect = "disconnect"
+)
+
+// DefaultCommand starts a login shell, bash if the image has it.
+var DefaultCommand = []string{"/bin/sh", "-c", "if command -v bash >/dev/null 2>&1; then exec bash -l; else exec sh -l; fi"}
+
+var DefaultSize = Size{Columns: 80, Rows: 24}
+
+type ExecOptions struct {
+	Command []string
+	Stdin   io.Reader
+	Stdout  io.Writer
+	// Sizes delivers the initial terminal size and every resize.
+	Sizes <-chan Size
+}
+
+// Executor runs a command with a TTY in a workspace. Exec blocks until the
+// command exits, returning its exit code, or until ctx is done.
+type Executor interface {
+	Exec(ctx context.Context, workspaceID string, options ExecOptions) (int, error)
+}
+
+type Options struct {
+	Command          []string
+	Size             Size
+	IdleTimeout      time.Duration
+	MaxRecordingSize int
+}
+
+// Result describes a finished session.
+type Result struct {
+	StartedAt time.Time
+	EndedAt   time.Time
+	// Reason is StatusExit, StatusIdle, StatusError or ReasonDisconnect.
+	Reason    string
+	ExitCode  int
+	Err       error
+	Recording *Recorder
+}
+
+type execResult struct {
+	code int
+	err  error
+}
+
+// outputWriter forwards process output to the browser and the recording.
+type outputWriter struct {
+	conn     *websocket.Conn
+	recorder *Recorder
+	mu       sync.Mutex
+}
+
+func (w *outputWriter) send(op byte, payload []byte) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	message := make([]byte, 0, len(payload)+1)
+	message = append(message, op)
+	message = append(message, payload...)
+	return w.conn.WriteMessage(websocket.BinaryMessage, message)
+}
+
+func (w *outputWriter) Write(p []byte) (int, error) {
+	w.recorder.Output(p)
+	if err := w.send(OpOutput, p); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+func (w *outputWriter) status(status Status) {
+	payload, _ := json.Marshal(status)
+	_ = w.send(OpStatus, payload)
+}
+
+// Serve attaches conn to a new exec session in the workspace and blocks
+// until the session ends. conn is closed when Serve returns.
+func Serve(ctx context.Context, conn *websocket.Conn, executor Executor, workspaceID string, options Options) *Result {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	if len(options.Command) == 0 {
+		options.Command = DefaultCommand
+	}
+	if options.Size.Columns == 0 || options.Size.Rows == 0 {
+		options.Size = DefaultSize
+	}
+	if options.IdleTimeout <= 0 {
+		options.IdleTimeout = DefaultIdleTimeout
+	}
+	if options.MaxRecordingSize <= 0 {
+		options.MaxRecordingSize = DefaultMaxRecordingSize
+	}
+
+	result := &Result{StartedAt: time.Now()}
+	result.Recording = NewRecorder(options.Size, result.StartedAt, options.MaxRecordingSize)
+	output := &outputWriter{conn: conn, recorder: result.Recording}
+
+	sizes := make(chan Size, 8)
+	sizes <- options.Size
+	stdinReader, stdinWriter := io.Pipe()
+
+	execDone := make(chan execResult, 1)
+	go func() {
+		code, err := executor.Exec(ctx, workspaceID, ExecOptions{
+			Command: options.Command,
+			Stdin:   stdinReader,
+			Stdout:  output,
+			Sizes:   sizes,
+		})
+		execDone <- execResult{code: code, err: err}
+	}()
+
+	activity := make(chan struct{}, 1)
+	readDone := make(chan error, 1)
+	go func() {
+		readDone <- readInput(conn, stdinWriter, sizes, result.Recording, activity)
+	}()
+
+	idle := time.NewTimer(options.IdleTimeout)
+	defer idle.Stop()
+
+	exited := false
+loop:
+	for {
+		select {
+		case res := <-execDone:
+			exited = true
+			if res.err != nil {
+				result.Reason, result.Err = StatusError, res.err
+				output.status(Status{Type: StatusError, Message: res.err.Error()})
+			} else {
+				result.Reason, result.ExitCode = StatusExit, res.code
+				output.status(Status{Type: StatusExit, Code: res.code})
+			}
+			break loop
+		case <-readDone:
+			result.Reason = ReasonDisconnect
+			break loop
+		case <-ctx.Done():
+			result.Reason = ReasonDisconnect
+			break loop
+		case <-activity:
+			if !idle.Stop() {
+				select {
+				case <-idle.C:
+				default:
+				}
+			}
+			idle.Reset(options.IdleTimeout)
+		case <-idle.C:
+			result.Reason = StatusIdle
+			output.status(Status{Type: StatusIdle, Message: "session closed after " + options.IdleTimeout.String() + " without input"})
+			break loop
+		}
+	}
+
+	cancel()
+	_ = stdinWriter.Close()
+	output.mu.Lock()
+	_ = conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, result.Reason), time.Now().Add(time.Second))
+	output.mu.Unlock()
+	_ = conn.Close()
+
+	// wait for the process so that nothing is recorded after the result
+	if !exited {
+		select {
+		case <-execDone:
+		case <-time.After(5 * time.Second):
+		}
+	}
+	result.EndedAt = time.Now()
+	return result
+}
+
+// readInput forwards browser input to the process until the connection
+// closes.
+func readInput(conn *websocket.Conn, stdin io.Writer, sizes chan Size, recorder *Recorder, activity chan<- struct{}) error {
+	for {
+		_, message, err := conn.ReadMessage()
+		if err != nil {
+			return err
+		}
+		if len(message) == 0 {
+			continue
+		}
+
+		switch message[0] {
+		case OpInput:
+			select {
+			case activity <- struct{}{}:
+			default:
+			}
+			if _, err := stdin.Write(message[1:]); err != nil {
+				return err
+			}
+		case OpResize:
+			size, err := parseResize(message[1:])
+			if err != nil {
+				continue
+			}
+			recorder.Resize(size)
+			select {
+			case sizes <- size:
+			default:
+			}
+		}
+	}
+}
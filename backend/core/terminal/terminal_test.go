@@ -0,0 +1,145 @@
+package terminal
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// echoExecutor echoes input lines until it reads "exit".
+type echoExecutor struct {
+	sizes chan Size
+}
+
+func (e *echoExecutor) Exec(ctx context.Context, workspaceID string, options ExecOptions) (int, error) {
+	go func() {
+		for size := range options.Sizes {
+			e.sizes <- size
+		}
+	}()
+
+	scanner := bufio.NewScanner(options.Stdin)
+	for scanner.Scan() {
+		if scanner.Text() == "exit" {
+			return 3, nil
+		}
+		if _, err := options.Stdout.Write([]byte(workspaceID + ": " + scanner.Text() + "\r\n")); err != nil {
+			return 0, err
+		}
+	}
+	<-ctx.Done()
+	return 0, ctx.Err()
+}
+
+func startSession(t *testing.T, executor Executor, options Options) (*websocket.Conn, chan *Result) {
+	t.Helper()
+
+	results := make(chan *Result, 1)
+	upgrader := websocket.Upgrader{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		results <- Serve(r.Context(), conn, executor, "ws-1", options)
+	}))
+	t.Cleanup(server.Close)
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn, results
+}
+
+func readMessage(t *testing.T, conn *websocket.Conn) (byte, []byte) {
+	t.Helper()
+
+	_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	_, message, err := conn.ReadMessage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return message[0], message[1:]
+}
+
+func TestSession(t *testing.T) {
+	executor := &echoExecutor{sizes: make(chan Size, 8)}
+	conn, results := startSession(t, executor, Options{Size: Size{Columns: 100, Rows: 30}})
+
+	if size := <-executor.sizes; size != (Size{Columns: 100, Rows: 30}) {
+		t.Errorf("unexpected initial size %v", size)
+	}
+	_ = conn.WriteMessage(websocket.BinaryMessage, []byte(`1{"columns":120,"rows":40}`))
+	if size := <-executor.sizes; size != (Size{Columns: 120, Rows: 40}) {
+		t.Errorf("unexpected resize %v", size)
+	}
+
+	_ = conn.WriteMessage(websocket.BinaryMessage, []byte("0hello\n"))
+	op, payload := readMessage(t, conn)
+	if op != OpOutput || string(payload) != "ws-1: hello\r\n" {
+		t.Fatalf("unexpected output %c %q", op, payload)
+	}
+
+	_ = conn.WriteMessage(websocket.BinaryMessage, []byte("0exit\n"))
+	op, payload = readMessage(t, conn)
+	status := Status{}
+	if err := json.Unmarshal(payload, &status); op != OpStatus || err != nil {
+		t.Fatalf("expected status, got %c %q", op, payload)
+	}
+	if status.Type != StatusExit || status.Code != 3 {
+		t.Errorf("unexpected status %+v", status)
+	}
+
+	result := <-results
+	if result.Reason != StatusExit || result.ExitCode != 3 {
+		t.Errorf("unexpected result %+v", result)
+	}
+
+	lines := strings.Split(strings.TrimSpace(string(result.Recording.Bytes())), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("expected header, resize and output in recording, got %q", lines)
+	}
+	if !strings.Contains(lines[0], `"version":2`) || !strings.Contains(lines[0], `"width":100`) {
+		t.Errorf("unexpected header %s", lines[0])
+	}
+	if !strings.Contains(lines[1], `"r","120x40"`) || !strings.Contains(lines[2], `"o","ws-1: hello\r\n"`) {
+		t.Errorf("unexpected events %q", lines[1:])
+	}
+}
+
+func TestSessionIdleTimeout(t *testing.T) {
+	executor := &echoExecutor{sizes: make(chan Size, 8)}
+	conn, results := startSession(t, executor, Options{IdleTimeout: 100 * time.Millisecond})
+
+	op, payload := readMessage(t, conn)
+	if op != OpStatus || !strings.Contains(string(payload), StatusIdle) {
+		t.Fatalf("expected idle status, got %c %q", op, payload)
+	}
+	if result := <-results; result.Reason != StatusIdle {
+		t.Errorf("expected idle result, got %s", result.Reason)
+	}
+}
+
+func TestRecorderLimit(t *testing.T) {
+	recorder := NewRecorder(DefaultSize, time.Now(), 100)
+	recorder.Output([]byte("short"))
+	recorder.Output([]byte(strings.Repeat("x", 100)))
+	recorder.Output([]byte("dropped"))
+
+	if !recorder.Truncated() {
+		t.Error("expected recording to be truncated")
+	}
+	if strings.Contains(string(recorder.Bytes()), "dropped") {
+		t.Error("output after the limit was recorded")
+	}
+}
@@ -0,0 +1,238 @@
+package toolpolicy
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/spectrumwebco/agent_runtime/backend/db/integrations"
+)
+
+// decisionsChannel carries every decided approval to the waiting replicas.
+const decisionsChannel = "kled:toolpolicy:decisions"
+
+// approvalGrace keeps decided approvals around for a while after they
+// expired, so late decisions are answered with the outcome.
+const approvalGrace = time.Hour
+
+var (
+	ErrApprovalNotFound = errors.New("approval not found")
+	// ErrAlreadyDecided is returned when deciding an approval that was
+	// decided, or expired, before.
+	ErrAlreadyDecided = errors.New("approval was already decided")
+)
+
+type Status string
+
+const (
+	StatusPending  Status = "pending"
+	StatusApproved Status = "approved"
+	StatusRejected Status = "rejected"
+	StatusExpired  Status = "expired"
+)
+
+// Approval is a blocked command waiting for, or decided by, a human.
+type Approval struct {
+	ID             string     `json:"id"`
+	OrganizationID string     `json:"organization_id"`
+	WorkspaceID    string     `json:"workspace_id"`
+	Command        Command    `json:"command"`
+	Decision       Decision   `json:"decision"`
+	RequestedBy    string     `json:"requested_by"`
+	Status         Status     `json:"status"`
+	DecidedBy      string     `json:"decided_by,omitempty"`
+	Comment        string     `json:"comment,omitempty"`
+	CreatedAt      time.Time  `json:"created_at"`
+	ExpiresAt      time.Time  `json:"expires_at"`
+	DecidedAt      *time.Time `json:"decided_at,omitempty"`
+}
+
+// Approvals keeps approvals in the KV store. Deciding takes a lock of the
+// approval, so only the first of concurrent decisions wins.
+type Approvals struct {
+	kv     integrations.KVStore
+	locker integrations.Locker
+	pubsub integrations.PubSub
+	now    func() time.Time
+}
+
+func NewApprovals(kv integrations.KVStore, locker integrations.Locker, pubsub integrations.PubSub) *Approvals {
+	return &Approvals{kv: kv, locker: locker, pubsub: pubsub, now: time.Now}
+}
+
+func approvalKey(id string) string {
+	return "kled:toolpolicy:approval:" + id
+}
+
+// Request stores a pending approval expiring after timeout.
+func (a *Approvals) Request(ctx context.Context, approval *Approval, timeout time.Duration) error {
+	approval.ID = uuid.New().String()
+	approval.Status = StatusPending
+	approval.CreatedAt = a.now().UTC()
+	approval.ExpiresAt = approval.CreatedAt.Add(timeout)
+	return a.save(approval)
+}
+
+func (a *Approvals) save(approval *Approval) error {
+	encoded, err := json.Marshal(approval)
+	if err != nil {
+		return err
+	}
+	ttl := approval.ExpiresAt.Sub(a.now()) + approvalGrace
+	if _, err := a.kv.Set(approvalKey(approval.ID), string(encoded), int(ttl.Seconds())); err != nil {
+		return fmt.Errorf("error saving approval %s: %v", approval.ID, err)
+	}
+	return nil
+}
+
+// Get returns an approval. Pending approvals past their expiry are returned
+// as expired.
+func (a *Approvals) Get(ctx context.Context, id string) (*Approval, error) {
+	approval, err := a.load(id)
+	if err != nil {
+		return nil, err
+	}
+	if approval.Status == StatusPending && !a.now().Before(approval.ExpiresAt) {
+		approval.Status = StatusExpired
+	}
+	return approval, nil
+}
+
+func (a *Approvals) load(id string) (*Approval, error) {
+	encoded, err := a.kv.Get(approvalKey(id))
+	if err != nil {
+		return nil, fmt.Errorf("error loading approval %s: %v", id, err)
+	}
+	if encoded == "" {
+		return nil, ErrApprovalNotFound
+	}
+	approval := &Approval{}
+	if err := json.Unmarshal([]byte(encoded), approval); err != nil {
+		return nil, fmt.Errorf("error decoding approval %s: %v", id, err)
+	}
+	return approval, nil
+}
+
+// Decide approves or rejects a pending approval and releases the command
+// waiting for it.
+func (a *Approvals) Decide(ctx context.Context, id string, approve bool, decidedBy, comment string) (*Approval, error) {
+	status := StatusRejected
+	if approve {
+		status = StatusApproved
+	}
+	return a.decide(ctx, id, status, decidedBy, comment)
+}
+
+func (a *Approvals) decide(ctx context.Context, id string, status Status, decidedBy, comment string) (*Approval, error) {
+	token := uuid.New().String()
+	acquired, err := a.locker.AcquireLock(approvalKey(id)+":lock", token, 10*time.Second)
+	if err != nil {
+		return nil, err
+	}
+	if !acquired {
+		return nil, ErrAlreadyDecided
+	}
+	defer func() {
+		if _, err := a.locker.ReleaseLock(approvalKey(id)+":lock", token); err != nil {
+			toolpolicyLogger.Printf("Error unlocking approval %s: %v", id, err)
+		}
+	}()
+
+	approval, err := a.load(id)
+	if err != nil {
+		return nil, err
+	}
+	if approval.Status != StatusPending {
+		return approval, ErrAlreadyDecided
+	}
+	late := status != StatusExpired && !a.now().Before(approval.ExpiresAt)
+	if late {
+		// the command stopped waiting, record that it expired instead
+		status, decidedBy, comment = StatusExpired, "", ""
+	}
+	approval.Status = status
+	approval.DecidedBy = decidedBy
+	approval.Comment = comment
+	decidedAt := a.now().UTC()
+	approval.DecidedAt = &decidedAt
+	if err := a.save(approval); err != nil {
+		return nil, err
+	}
+
+	encoded, err := json.Marshal(approval)
+	if err != nil {
+		return nil, err
+	}
+	if err := a.pubsub.Publish(ctx, decisionsChannel, encoded); err != nil {
+		// the waiting command still sees the decision when it expires
+		toolpolicyLogger.Printf("Error publishing decision of approval %s: %v", id, err)
+	}
+	if late {
+		return approval, ErrAlreadyDecided
+	}
+	return approval, nil
+}
+
+// Wait blocks until the approval is decided or expires, and returns it.
+// Expired approvals are stored as such, so they can't be approved later.
+func (a *Approvals) Wait(ctx context.Context, id string) (*Approval, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	decided := make(chan *Approval, 1)
+	err := a.pubsub.SubscribeChannel(ctx, decisionsChannel, func(payload []byte) {
+		approval := &Approval{}
+		if json.Unmarshal(payload, approval) != nil || approval.ID != id {
+			return
+		}
+		select {
+		case decided <- approval:
+		default:
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// decisions made before subscribing are only in the store
+	approval, err := a.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if approval.Status != StatusPending {
+		return a.expire(ctx, approval)
+	}
+
+	timer := time.NewTimer(approval.ExpiresAt.Sub(a.now()))
+	defer timer.Stop()
+	select {
+	case approval := <-decided:
+		return approval, nil
+	case <-timer.C:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+
+	approval, err = a.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	return a.expire(ctx, approval)
+}
+
+// expire stores an approval that expired while pending as expired, unless
+// it was decided in the meantime.
+func (a *Approvals) expire(ctx context.Context, approval *Approval) (*Approval, error) {
+	if approval.Status != StatusExpired {
+		return approval, nil
+	}
+	expired, err := a.decide(ctx, approval.ID, StatusExpired, "", "")
+	if err != nil && expired == nil {
+		toolpolicyLogger.Printf("Error expiring approval %s: %v", approval.ID, err)
+		return approval, nil
+	}
+	return expired, nil
+}
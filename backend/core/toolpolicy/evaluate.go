@@ -0,0 +1,352 @@
+package toolpolicy
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// Rules reported in decisions.
+const (
+	RuleBinaryDenied     = "binary.denied"
+	RuleBinaryNotAllowed = "binary.not_allowed"
+	RulePathDenied       = "path.denied"
+	RulePathNotAllowed   = "path.not_allowed"
+	RuleEgressDenied     = "egress.denied"
+	RuleEgressNotAllowed = "egress.not_allowed"
+)
+
+// Command is a command an agent wants to run, as sent in the parameters of
+// the exec agent command.
+type Command struct {
+	Argv    []string `json:"argv"`
+	Workdir string   `json:"workdir,omitempty"`
+}
+
+func (c Command) String() string {
+	return strings.Join(c.Argv, " ")
+}
+
+// Decision is the outcome of evaluating a command. Rule and Reason name the
+// first rule that blocked it.
+type Decision struct {
+	Allowed bool   `json:"allowed"`
+	Rule    string `json:"rule,omitempty"`
+	Reason  string `json:"reason,omitempty"`
+}
+
+func allowed() Decision {
+	return Decision{Allowed: true}
+}
+
+func blocked(rule, format string, args ...interface{}) Decision {
+	return Decision{Rule: rule, Reason: fmt.Sprintf(format, args...)}
+}
+
+// Evaluate checks command against the policy.
+func (p Policy) Evaluate(command Command) Decision {
+	if !p.Enabled {
+		return allowed()
+	}
+	if command.Workdir != "" {
+		if decision := p.checkPath(path.Clean(command.Workdir)); !decision.Allowed {
+			return decision
+		}
+	}
+	for _, argv := range invocations(command.Argv, 0) {
+		if decision := p.checkInvocation(argv, command.Workdir); !decision.Allowed {
+			return decision
+		}
+	}
+	return allowed()
+}
+
+func (p Policy) checkInvocation(argv []string, workdir string) Decision {
+	binary := filepath.Base(argv[0])
+	if matchAny(p.DeniedBinaries, binary) || matchAny(p.DeniedBinaries, argv[0]) {
+		return blocked(RuleBinaryDenied, "%s is denied", binary)
+	}
+	if len(p.AllowedBinaries) > 0 && !matchAny(p.AllowedBinaries, binary) && !matchAny(p.AllowedBinaries, argv[0]) {
+		return blocked(RuleBinaryNotAllowed, "%s is not an allowed binary", binary)
+	}
+
+	for _, arg := range argv[1:] {
+		resolved, ok := argumentPath(arg, workdir)
+		if !ok {
+			continue
+		}
+		if decision := p.checkPath(resolved); !decision.Allowed {
+			return decision
+		}
+	}
+
+	for _, host := range hosts(binary, argv[1:]) {
+		if decision := p.checkHost(host); !decision.Allowed {
+			return decision
+		}
+	}
+	return allowed()
+}
+
+func (p Policy) checkPath(resolved string) Decision {
+	for _, prefix := range p.DeniedPaths {
+		if underPath(resolved, prefix) {
+			return blocked(RulePathDenied, "%s is denied", resolved)
+		}
+	}
+	if len(p.AllowedPaths) == 0 {
+		return allowed()
+	}
+	for _, prefix := range p.AllowedPaths {
+		if underPath(resolved, prefix) {
+			return allowed()
+		}
+	}
+	return blocked(RulePathNotAllowed, "%s is outside the allowed paths", resolved)
+}
+
+func (p Policy) checkHost(host string) Decision {
+	host = strings.ToLower(host)
+	if matchAny(p.Egress.DeniedHosts, host) {
+		return blocked(RuleEgressDenied, "connections to %s are denied", host)
+	}
+	if p.Egress.Default == EffectDeny && !matchAny(p.Egress.AllowedHosts, host) {
+		return blocked(RuleEgressNotAllowed, "%s is not an allowed host", host)
+	}
+	return allowed()
+}
+
+func matchAny(patterns []string, value string) bool {
+	for _, pattern := range patterns {
+		if matched, _ := path.Match(pattern, value); matched {
+			return true
+		}
+	}
+	return false
+}
+
+func underPath(resolved, prefix string) bool {
+	prefix = path.Clean(prefix)
+	return prefix == "/" || resolved == prefix || strings.HasPrefix(resolved, prefix+"/")
+}
+
+// maxShellDepth bounds the nesting of shells running shells.
+const maxShellDepth = 4
+
+var shells = map[string]bool{"sh": true, "bash": true, "dash": true, "zsh": true, "ash": true, "ksh": true}
+
+// wrappers run the command following their own options, and the number of
+// operands they take before it.
+var wrappers = map[string]int{"env": 0, "nice": 0, "nohup": 0, "time": 0, "exec": 0, "command": 0, "xargs": 0, "stdbuf": 0, "timeout": 1}
+
+// invocations returns every command run by argv: argv itself with wrappers
+// removed, or the commands of the script of a shell run with -c.
+func invocations(argv []string, depth int) [][]string {
+	argv = unwrap(argv)
+	if len(argv) == 0 {
+		return nil
+	}
+
+	binary := filepath.Base(argv[0])
+	if shells[binary] && depth < maxShellDepth {
+		for i, arg := range argv[1:] {
+			if strings.HasPrefix(arg, "-") && !strings.HasPrefix(arg, "--") && strings.Contains(arg, "c") && i+2 < len(argv) {
+				var result [][]string
+				for _, segment := range splitScript(argv[i+2]) {
+					result = append(result, invocations(segment, depth+1)...)
+				}
+				// the shell itself has to pass the policy too
+				return append([][]string{{argv[0]}}, result...)
+			}
+		}
+	}
+	return [][]string{argv}
+}
+
+func unwrap(argv []string) []string {
+	for len(argv) > 0 {
+		operands, ok := wrappers[filepath.Base(argv[0])]
+		if !ok {
+			return argv
+		}
+		rest := argv[1:]
+		for len(rest) > 0 && (strings.HasPrefix(rest[0], "-") || strings.Contains(rest[0], "=") && filepath.Base(argv[0]) == "env") {
+			rest = rest[1:]
+		}
+		for ; operands > 0 && len(rest) > 0; operands-- {
+			rest = rest[1:]
+		}
+		if len(rest) == 0 {
+			// a bare wrapper runs nothing else, check the wrapper itself
+			return argv[:1]
+		}
+		argv = rest
+	}
+	return argv
+}
+
+// splitScript splits a shell script into the words of its simple commands.
+// It understands quotes and the usual separators, not the full shell
+// grammar, and leans towards finding too many commands rather than too few.
+func splitScript(script string) [][]string {
+	var (
+		commands [][]string
+		words    []string
+		word     strings.Builder
+		inWord   bool
+		quote    rune
+	)
+	endWord := func() {
+		if inWord {
+			words = append(words, word.String())
+			word.Reset()
+			inWord = false
+		}
+	}
+	endCommand := func() {
+		endWord()
+		// assignments before a command only set its environment
+		for len(words) > 0 && strings.Contains(words[0], "=") && !strings.HasPrefix(words[0], "=") {
+			words = words[1:]
+		}
+		if len(words) > 0 {
+			commands = append(commands, words)
+		}
+		words = nil
+	}
+
+	runes := []rune(script)
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+		switch {
+		case quote == '"' && (r == '`' || r == '$' && i+1 < len(runes) && runes[i+1] == '('):
+			// substitutions run even inside double quotes
+			end := substitutionEnd(runes, i)
+			start := i + 1
+			if r == '$' {
+				start++
+			}
+			commands = append(commands, splitScript(string(runes[start:end]))...)
+			i = end
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			} else if r == '\\' && quote == '"' && i+1 < len(runes) {
+				i++
+				word.WriteRune(runes[i])
+			} else {
+				word.WriteRune(r)
+			}
+		case r == '\'' || r == '"':
+			quote = r
+			inWord = true
+		case r == '\\' && i+1 < len(runes):
+			i++
+			word.WriteRune(runes[i])
+			inWord = true
+		case r == ' ' || r == '\t':
+			endWord()
+		case strings.ContainsRune(";|&\n()`{}", r):
+			endCommand()
+		case r == '$' && i+1 < len(runes) && runes[i+1] == '(':
+			endCommand()
+			i++
+		default:
+			word.WriteRune(r)
+			inWord = true
+		}
+	}
+	endCommand()
+	return commands
+}
+
+// substitutionEnd returns the index of the rune closing the substitution
+// starting at i, or the end of the script if it isn't closed.
+func substitutionEnd(runes []rune, i int) int {
+	if runes[i] == '`' {
+		for j := i + 1; j < len(runes); j++ {
+			if runes[j] == '`' {
+				return j
+			}
+		}
+		return len(runes)
+	}
+	depth := 0
+	for j := i + 1; j < len(runes); j++ {
+		switch runes[j] {
+		case '(':
+			depth++
+		case ')':
+			depth--
+			if depth == 0 {
+				return j
+			}
+		}
+	}
+	return len(runes)
+}
+
+// argumentPath returns the absolute path an argument names, if it looks like
+// a path. Options of the form --flag=value are checked for their value.
+func argumentPath(arg, workdir string) (string, bool) {
+	if strings.HasPrefix(arg, "-") {
+		_, value, ok := strings.Cut(arg, "=")
+		if !ok {
+			return "", false
+		}
+		arg = value
+	}
+	if strings.Contains(arg, "://") {
+		return "", false
+	}
+
+	switch {
+	case path.IsAbs(arg):
+		return path.Clean(arg), true
+	case arg == ".." || strings.HasPrefix(arg, "./") || strings.HasPrefix(arg, "../") || strings.Contains(arg, "/../"):
+		if workdir == "" {
+			return "", false
+		}
+		return path.Join(workdir, arg), true
+	}
+	return "", false
+}
+
+// networkBinaries take hosts as user@host or host operands.
+var networkBinaries = map[string]bool{"ssh": true, "scp": true, "sftp": true, "rsync": true, "git": true, "nc": true, "ncat": true, "netcat": true, "telnet": true}
+
+// hosts returns the hosts named by the arguments of a command: hosts of URLs
+// and, for network tools, user@host and bare host operands.
+func hosts(binary string, args []string) []string {
+	var result []string
+	for _, arg := range args {
+		if strings.Contains(arg, "://") {
+			if _, value, ok := strings.Cut(arg, "="); ok && strings.HasPrefix(arg, "-") {
+				arg = value
+			}
+			if u, err := url.Parse(arg); err == nil && u.Hostname() != "" {
+				result = append(result, u.Hostname())
+			}
+			continue
+		}
+		if !networkBinaries[binary] || strings.HasPrefix(arg, "-") {
+			continue
+		}
+		if _, host, ok := strings.Cut(arg, "@"); ok {
+			host, _, _ = strings.Cut(host, ":")
+			if host != "" {
+				result = append(result, host)
+			}
+			continue
+		}
+		if binary == "nc" || binary == "ncat" || binary == "netcat" || binary == "telnet" {
+			if net.ParseIP(arg) != nil || strings.Contains(arg, ".") {
+				result = append(result, arg)
+			}
+		}
+	}
+	return result
+}
@@ -0,0 +1,87 @@
+package toolpolicy
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// BlockedError is returned for commands the policy blocks and no human
+// approved.
+type BlockedError struct {
+	Approval *Approval
+}
+
+func (e *BlockedError) Error() string {
+	switch e.Approval.Status {
+	case StatusRejected:
+		if e.Approval.DecidedBy != "" {
+			return fmt.Sprintf("command rejected by %s: %s", e.Approval.DecidedBy, e.Approval.Decision.Reason)
+		}
+	case StatusExpired:
+		return fmt.Sprintf("command was not approved in time: %s", e.Approval.Decision.Reason)
+	}
+	return "command blocked by the tool policy: " + e.Approval.Decision.Reason
+}
+
+// Gate checks the commands of an organization's agents before they run.
+type Gate struct {
+	policies  PolicyStore
+	approvals *Approvals
+	// observe is told about every blocked command, once when it is
+	// blocked and once when a pending approval is decided.
+	observe func(*Approval)
+}
+
+// NewGate returns a gate reporting blocked commands and decisions to
+// observe, which audits them and asks humans for approval. approvals may be
+// nil to fail blocked commands right away.
+func NewGate(policies PolicyStore, approvals *Approvals, observe func(*Approval)) *Gate {
+	if observe == nil {
+		observe = func(*Approval) {}
+	}
+	return &Gate{policies: policies, approvals: approvals, observe: observe}
+}
+
+// Check returns nil if command may run in the workspace, waiting for a
+// human's approval if the policy blocks it and asks for one. Otherwise it
+// returns a BlockedError.
+func (g *Gate) Check(ctx context.Context, organizationID, workspaceID, requestedBy string, command Command) error {
+	policy, err := PolicyFor(ctx, g.policies, organizationID)
+	if err != nil {
+		return err
+	}
+	decision := policy.Evaluate(command)
+	if decision.Allowed {
+		return nil
+	}
+
+	approval := &Approval{
+		OrganizationID: organizationID,
+		WorkspaceID:    workspaceID,
+		Command:        command,
+		Decision:       decision,
+		RequestedBy:    requestedBy,
+		Status:         StatusRejected,
+		CreatedAt:      time.Now().UTC(),
+	}
+	if !policy.Approval || g.approvals == nil {
+		g.observe(approval)
+		return &BlockedError{Approval: approval}
+	}
+
+	if err := g.approvals.Request(ctx, approval, time.Duration(policy.ApprovalTimeout)); err != nil {
+		return err
+	}
+	g.observe(approval)
+
+	approval, err = g.approvals.Wait(ctx, approval.ID)
+	if err != nil {
+		return err
+	}
+	g.observe(approval)
+	if approval.Status != StatusApproved {
+		return &BlockedError{Approval: approval}
+	}
+	return nil
+}
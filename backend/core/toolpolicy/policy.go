@@ -0,0 +1,250 @@
+// Package toolpolicy decides which commands agents may run in workspaces.
+//
+// Every organization has a Policy, the DefaultPolicy unless an admin stored
+// its own. Before a command issued by an agent is sent to the workspace,
+// Evaluate checks the binaries it runs, the paths it names and the hosts it
+// connects to against the policy. Commands run through a shell with -c, or
+// through wrappers such as env or timeout, are checked for every command of
+// the script.
+//
+// Blocked commands fail, unless the policy asks for approval: then the Gate
+// records an Approval and waits until a human approves or rejects it, or it
+// expires. Approvals live in Dragonfly and decisions are published on a
+// pub/sub channel, so a command waiting on one replica is released by a
+// decision made on another.
+package toolpolicy
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path"
+	"sync"
+	"time"
+
+	"github.com/spectrumwebco/agent_runtime/backend/db/integrations"
+)
+
+var toolpolicyLogger = log.New(os.Stdout, "kled.toolpolicy: ", log.LstdFlags)
+
+type Effect string
+
+const (
+	EffectAllow Effect = "allow"
+	EffectDeny  Effect = "deny"
+)
+
+// Policy restricts the commands agents run. Binaries and hosts accept shell
+// patterns such as "python*" or "*.github.com"; paths are prefixes.
+type Policy struct {
+	Enabled bool `json:"enabled"`
+	// AllowedBinaries, if set, are the only binaries commands may run.
+	AllowedBinaries []string `json:"allowed_binaries,omitempty"`
+	DeniedBinaries  []string `json:"denied_binaries,omitempty"`
+	// AllowedPaths, if set, are the only directories commands may run in or
+	// name in their arguments.
+	AllowedPaths []string     `json:"allowed_paths,omitempty"`
+	DeniedPaths  []string     `json:"denied_paths,omitempty"`
+	Egress       EgressPolicy `json:"egress"`
+	// Approval lets a human approve blocked commands. Without it they fail
+	// right away.
+	Approval        bool     `json:"approval"`
+	ApprovalTimeout Duration `json:"approval_timeout"`
+}
+
+// EgressPolicy restricts the hosts commands connect to, as far as they can
+// be told from their arguments.
+type EgressPolicy struct {
+	// Default applies to hosts neither list names.
+	Default      Effect   `json:"default"`
+	AllowedHosts []string `json:"allowed_hosts,omitempty"`
+	DeniedHosts  []string `json:"denied_hosts,omitempty"`
+}
+
+// DefaultPolicy keeps agents from escalating privileges, reading the
+// secrets of the workspace pod and reaching the cloud metadata service.
+func DefaultPolicy() Policy {
+	return Policy{
+		Enabled:        true,
+		DeniedBinaries: []string{"sudo", "su", "doas", "nsenter", "chroot", "mount", "umount", "insmod", "modprobe", "iptables", "nft"},
+		DeniedPaths:    []string{"/etc/shadow", "/etc/sudoers", "/proc/sys", "/sys", "/var/run/secrets", "/run/secrets"},
+		Egress: EgressPolicy{
+			Default:     EffectAllow,
+			DeniedHosts: []string{"169.254.169.254", "metadata.google.internal"},
+		},
+		Approval:        true,
+		ApprovalTimeout: Duration(5 * time.Minute),
+	}
+}
+
+func (p Policy) Validate() error {
+	patterns := append(append(append(append([]string{}, p.AllowedBinaries...), p.DeniedBinaries...), p.Egress.AllowedHosts...), p.Egress.DeniedHosts...)
+	for _, pattern := range patterns {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid pattern %q", pattern)
+		}
+	}
+	for _, prefix := range append(append([]string{}, p.AllowedPaths...), p.DeniedPaths...) {
+		if !path.IsAbs(prefix) {
+			return fmt.Errorf("path %q must be absolute", prefix)
+		}
+	}
+	switch p.Egress.Default {
+	case EffectAllow, EffectDeny:
+	default:
+		return fmt.Errorf("egress default must be allow or deny")
+	}
+	if p.Approval && p.ApprovalTimeout <= 0 {
+		return fmt.Errorf("approval_timeout must be positive")
+	}
+	return nil
+}
+
+// Duration is a time.Duration that is encoded in JSON as a Go duration
+// string such as "5m".
+type Duration time.Duration
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var value string
+	if err := json.Unmarshal(data, &value); err != nil {
+		return fmt.Errorf("duration must be a string such as \"5m\"")
+	}
+	parsed, err := time.ParseDuration(value)
+	if err != nil {
+		return err
+	}
+	*d = Duration(parsed)
+	return nil
+}
+
+// PolicyStore holds per-organization overrides of the default policy.
+type PolicyStore interface {
+	// Policy returns the organization's policy and whether it has an
+	// override.
+	Policy(ctx context.Context, organizationID string) (Policy, bool, error)
+	SetPolicy(ctx context.Context, organizationID string, policy Policy) error
+	DeletePolicy(ctx context.Context, organizationID string) error
+}
+
+// PolicyFor returns the organization's policy, or the default.
+func PolicyFor(ctx context.Context, store PolicyStore, organizationID string) (Policy, error) {
+	policy, ok, err := store.Policy(ctx, organizationID)
+	if err != nil {
+		return Policy{}, err
+	}
+	if !ok {
+		return DefaultPolicy(), nil
+	}
+	return policy, nil
+}
+
+type MemoryPolicyStore struct {
+	policies map[string]Policy
+	mu       sync.RWMutex
+}
+
+func NewMemoryPolicyStore() *MemoryPolicyStore {
+	return &MemoryPolicyStore{policies: make(map[string]Policy)}
+}
+
+func (s *MemoryPolicyStore) Policy(ctx context.Context, organizationID string) (Policy, bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	policy, ok := s.policies[organizationID]
+	return policy, ok, nil
+}
+
+func (s *MemoryPolicyStore) SetPolicy(ctx context.Context, organizationID string, policy Policy) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.policies[organizationID] = policy
+	return nil
+}
+
+func (s *MemoryPolicyStore) DeletePolicy(ctx context.Context, organizationID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.policies, organizationID)
+	return nil
+}
+
+// PostgresPolicyStore keeps overrides as JSON in app_tool_policy.
+type PostgresPolicyStore struct {
+	client integrations.SQLStore
+}
+
+func NewPostgresPolicyStore(client integrations.SQLStore) *PostgresPolicyStore {
+	return &PostgresPolicyStore{client: client}
+}
+
+func (s *PostgresPolicyStore) EnsureSchema() error {
+	_, err := s.client.ExecuteUpdate(`
+		CREATE TABLE IF NOT EXISTS app_tool_policy (
+			organization_id VARCHAR(255) PRIMARY KEY,
+			policy JSONB NOT NULL,
+			updated_at TIMESTAMPTZ NOT NULL DEFAULT now()
+		)
+	`)
+	if err != nil {
+		return fmt.Errorf("error creating tool policy table: %v", err)
+	}
+	return nil
+}
+
+func (s *PostgresPolicyStore) Policy(ctx context.Context, organizationID string) (Policy, bool, error) {
+	rows, err := s.client.ExecuteQuery(`SELECT policy FROM app_tool_policy WHERE organization_id = $1`, organizationID)
+	if err != nil {
+		return Policy{}, false, fmt.Errorf("error loading tool policy for %s: %v", organizationID, err)
+	}
+	if len(rows) == 0 {
+		return Policy{}, false, nil
+	}
+
+	var raw []byte
+	switch value := rows[0]["policy"].(type) {
+	case []byte:
+		raw = value
+	case string:
+		raw = []byte(value)
+	default:
+		return Policy{}, false, fmt.Errorf("unexpected tool policy value %T", value)
+	}
+
+	var policy Policy
+	if err := json.Unmarshal(raw, &policy); err != nil {
+		return Policy{}, false, fmt.Errorf("error decoding tool policy for %s: %v", organizationID, err)
+	}
+	return policy, true, nil
+}
+
+func (s *PostgresPolicyStore) SetPolicy(ctx context.Context, organizationID string, policy Policy) error {
+	raw, err := json.Marshal(policy)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.client.ExecuteUpdate(`
+		INSERT INTO app_tool_policy (organization_id, policy) VALUES ($1, $2)
+		ON CONFLICT (organization_id) DO UPDATE SET policy = EXCLUDED.policy, updated_at = now()
+	`, organizationID, string(raw))
+	if err != nil {
+		return fmt.Errorf("error saving tool policy for %s: %v", organizationID, err)
+	}
+	return nil
+}
+
+func (s *PostgresPolicyStore) DeletePolicy(ctx context.Context, organizationID string) error {
+	if _, err := s.client.ExecuteUpdate(`DELETE FROM app_tool_policy WHERE organization_id = $1`, organizationID); err != nil {
+		return fmt.Errorf("error deleting tool policy for %s: %v", organizationID, err)
+	}
+	return nil
+}
@@ -0,0 +1,126 @@
+package toolpolicy
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/spectrumwebco/agent_runtime/backend/db/integrations/integrationsmock"
+)
+
+func TestEvaluate(t *testing.T) {
+	policy := DefaultPolicy()
+	policy.AllowedPaths = []string{"/workspace", "/tmp"}
+	policy.Egress.Default = EffectDeny
+	policy.Egress.AllowedHosts = []string{"github.com", "*.pypi.org"}
+
+	tests := []struct {
+		name    string
+		command Command
+		rule    string
+	}{
+		{"plain command", Command{Argv: []string{"go", "test", "./..."}, Workdir: "/workspace/app"}, ""},
+		{"denied binary", Command{Argv: []string{"/usr/bin/sudo", "ls"}}, RuleBinaryDenied},
+		{"denied binary behind a wrapper", Command{Argv: []string{"env", "A=1", "timeout", "5", "nsenter", "-t", "1"}}, RuleBinaryDenied},
+		{"denied binary in a script", Command{Argv: []string{"bash", "-lc", "cd /workspace && echo ok | sudo tee /x"}}, RuleBinaryDenied},
+		{"denied binary in a substitution", Command{Argv: []string{"sh", "-c", `echo "$(su root)"`}}, RuleBinaryDenied},
+		{"quoted separators", Command{Argv: []string{"sh", "-c", `echo "a; sudo b"`}}, ""},
+		{"workdir outside", Command{Argv: []string{"ls"}, Workdir: "/home/agent"}, RulePathNotAllowed},
+		{"denied path", Command{Argv: []string{"cat", "/var/run/secrets/kubernetes.io/token"}}, RulePathDenied},
+		{"escaping relative path", Command{Argv: []string{"cat", "../../etc/passwd"}, Workdir: "/workspace/app"}, RulePathNotAllowed},
+		{"path in an option", Command{Argv: []string{"tar", "--file=/etc/hosts"}}, RulePathNotAllowed},
+		{"allowed host", Command{Argv: []string{"git", "clone", "https://github.com/org/repo"}}, ""},
+		{"allowed host pattern", Command{Argv: []string{"pip", "download", "https://files.pypi.org/x.whl"}}, ""},
+		{"host not allowed", Command{Argv: []string{"curl", "-sSL", "https://example.com/install.sh"}}, RuleEgressNotAllowed},
+		{"scp-style host", Command{Argv: []string{"git", "clone", "git@gitlab.com:org/repo.git"}}, RuleEgressNotAllowed},
+		{"metadata service", Command{Argv: []string{"wget", "http://169.254.169.254/latest/meta-data"}}, RuleEgressDenied},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			decision := policy.Evaluate(tt.command)
+			if decision.Allowed != (tt.rule == "") || decision.Rule != tt.rule {
+				t.Fatalf("got %+v, want rule %q", decision, tt.rule)
+			}
+		})
+	}
+
+	policy.Enabled = false
+	if decision := policy.Evaluate(Command{Argv: []string{"sudo", "reboot"}}); !decision.Allowed {
+		t.Fatalf("a disabled policy must allow everything, got %+v", decision)
+	}
+}
+
+func TestGateWaitsForApproval(t *testing.T) {
+	kv := integrationsmock.NewKVStore()
+	approvals := NewApprovals(kv, kv, integrationsmock.NewPubSub())
+	policies := NewMemoryPolicyStore()
+
+	var observed []Status
+	decide := true
+	gate := NewGate(policies, approvals, func(approval *Approval) {
+		observed = append(observed, approval.Status)
+		if approval.Status == StatusPending {
+			// a human answers over the WebSocket
+			go approvals.Decide(context.Background(), approval.ID, decide, "user-2", "looks fine")
+		}
+	})
+
+	ctx := context.Background()
+	if err := gate.Check(ctx, "org-1", "ws-1", "user-1", Command{Argv: []string{"ls"}}); err != nil {
+		t.Fatalf("allowed commands must pass: %v", err)
+	}
+	if len(observed) != 0 {
+		t.Fatalf("allowed commands must not be reported, got %v", observed)
+	}
+
+	if err := gate.Check(ctx, "org-1", "ws-1", "user-1", Command{Argv: []string{"sudo", "apt-get", "install", "jq"}}); err != nil {
+		t.Fatalf("approved commands must pass: %v", err)
+	}
+
+	decide = false
+	err := gate.Check(ctx, "org-1", "ws-1", "user-1", Command{Argv: []string{"sudo", "reboot"}})
+	var blockedErr *BlockedError
+	if !errors.As(err, &blockedErr) || blockedErr.Approval.DecidedBy != "user-2" {
+		t.Fatalf("expected the rejection, got %v", err)
+	}
+	want := []Status{StatusPending, StatusApproved, StatusPending, StatusRejected}
+	if len(observed) != len(want) {
+		t.Fatalf("observed %v, want %v", observed, want)
+	}
+	for i := range want {
+		if observed[i] != want[i] {
+			t.Fatalf("observed %v, want %v", observed, want)
+		}
+	}
+
+	// without approvals blocked commands fail right away
+	policy := DefaultPolicy()
+	policy.Approval = false
+	policies.SetPolicy(ctx, "org-1", policy)
+	if err := gate.Check(ctx, "org-1", "ws-1", "user-1", Command{Argv: []string{"sudo", "reboot"}}); !errors.As(err, &blockedErr) || blockedErr.Approval.ID != "" {
+		t.Fatalf("expected an immediate block, got %v", err)
+	}
+}
+
+func TestApprovalsExpire(t *testing.T) {
+	kv := integrationsmock.NewKVStore()
+	approvals := NewApprovals(kv, kv, integrationsmock.NewPubSub())
+	ctx := context.Background()
+
+	approval := &Approval{WorkspaceID: "ws-1", Command: Command{Argv: []string{"sudo", "ls"}}}
+	if err := approvals.Request(ctx, approval, 20*time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	waited, err := approvals.Wait(ctx, approval.ID)
+	if err != nil || waited.Status != StatusExpired {
+		t.Fatalf("expected the approval to expire, got %+v, %v", waited, err)
+	}
+
+	if decided, err := approvals.Decide(ctx, approval.ID, true, "user-2", ""); !errors.Is(err, ErrAlreadyDecided) || decided.Status != StatusExpired {
+		t.Fatalf("expired approvals must not be approved, got %+v, %v", decided, err)
+	}
+	if _, err := approvals.Get(ctx, "missing"); !errors.Is(err, ErrApprovalNotFound) {
+		t.Fatalf("expected ErrApprovalNotFound, got %v", err)
+	}
+}
@@ -0,0 +1,33 @@
+package tracing
+
+import (
+	"log"
+	"os"
+	"time"
+
+	"github.com/spectrumwebco/agent_runtime/backend/core/config/env"
+)
+
+var tracingLogger = log.New(os.Stdout, "kled.tracing: ", log.LstdFlags)
+
+type Config struct {
+	// Enabled turns recording of timelines on. Correlation IDs are
+	// propagated and logged either way.
+	Enabled bool `json:"enabled"`
+	// TTL is how long a timeline is kept after its last entry.
+	TTL time.Duration `json:"ttl"`
+}
+
+const DefaultTTL = 72 * time.Hour
+
+var Default = env.Once(FromEnv)
+
+// FromEnv records timelines unless AGENT_TRACING_ENABLED is false. Timelines
+// are kept for at least a minute.
+func FromEnv() Config {
+	config := Config{Enabled: true, TTL: DefaultTTL}
+	read := env.NewReader(tracingLogger)
+	read.Bool("AGENT_TRACING_ENABLED", &config.Enabled)
+	read.Duration("AGENT_TRACING_TTL", &config.TTL, time.Minute)
+	return config
+}
@@ -0,0 +1,183 @@
+// Package tracing assembles the timeline of a request across the backend,
+// the event bus, workspace agents and agent runs.
+//
+// Every API request carries a correlation ID: the X-Request-ID sent by the
+// CLI or SDK, or one generated by the request ID middleware. It travels in
+// the request context (see events.WithCorrelationID), in the headers of
+// published events, in the commands sent to workspace agents and in the
+// execution context of runs. Components record what they did for it with
+// Record, and Timeline returns the entries of an ID in order.
+package tracing
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/spectrumwebco/agent_runtime/backend/core/events"
+	"github.com/spectrumwebco/agent_runtime/backend/db/integrations"
+)
+
+// Header carries the correlation ID of API requests.
+const Header = "X-Request-ID"
+
+// Sources of timeline entries.
+const (
+	SourceAPI    = "api"
+	SourceEvents = "events"
+	SourceAgent  = "agent"
+	SourceRun    = "run"
+	SourceAudit  = "audit"
+)
+
+var validID = regexp.MustCompile(`^[A-Za-z0-9._:-]{1,128}$`)
+
+// ValidID reports whether a client supplied ID is accepted. Others are
+// replaced, as they end up in log lines and KV keys.
+func ValidID(id string) bool {
+	return validID.MatchString(id)
+}
+
+// NewID returns a new correlation ID.
+func NewID() string {
+	return uuid.New().String()
+}
+
+// Entry is something that happened for a request.
+type Entry struct {
+	ID     string    `json:"id"`
+	Time   time.Time `json:"time"`
+	Source string    `json:"source"`
+	// Name is what happened, e.g. "POST /api/workspaces/" or
+	// "workspace.created".
+	Name       string            `json:"name"`
+	Message    string            `json:"message,omitempty"`
+	DurationMs int64             `json:"duration_ms,omitempty"`
+	Error      string            `json:"error,omitempty"`
+	Attributes map[string]string `json:"attributes,omitempty"`
+}
+
+// Store keeps the entries of every correlation ID in a KV hash that expires
+// after the configured TTL.
+type Store struct {
+	kv     integrations.KVStore
+	config Config
+	now    func() time.Time
+}
+
+func NewStore(kv integrations.KVStore, config Config) *Store {
+	return &Store{kv: kv, config: config, now: time.Now}
+}
+
+func timelineKey(correlationID string) string {
+	return "kled:trace:" + correlationID
+}
+
+// Add adds an entry to the timeline of correlationID.
+func (s *Store) Add(correlationID string, entry Entry) error {
+	if entry.ID == "" {
+		entry.ID = uuid.New().String()
+	}
+	if entry.Time.IsZero() {
+		entry.Time = s.now().UTC()
+	}
+	encoded, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	key := timelineKey(correlationID)
+	if _, err := s.kv.HSet(key, entry.ID, string(encoded)); err != nil {
+		return fmt.Errorf("error recording trace entry: %v", err)
+	}
+	if _, err := s.kv.Expire(key, int(s.config.TTL.Seconds())); err != nil {
+		return fmt.Errorf("error expiring trace: %v", err)
+	}
+	return nil
+}
+
+// Timeline returns the entries of correlationID ordered by time.
+func (s *Store) Timeline(correlationID string) ([]Entry, error) {
+	values, err := s.kv.HGetAll(timelineKey(correlationID))
+	if err != nil {
+		return nil, fmt.Errorf("error loading trace: %v", err)
+	}
+
+	entries := make([]Entry, 0, len(values))
+	for _, value := range values {
+		entry := Entry{}
+		if err := json.Unmarshal([]byte(value), &entry); err != nil {
+			tracingLogger.Printf("Skipping invalid entry of trace %s: %v", correlationID, err)
+			continue
+		}
+		entries = append(entries, entry)
+	}
+	Sort(entries)
+	return entries, nil
+}
+
+// Sort orders entries by time, keeping the order of simultaneous ones.
+func Sort(entries []Entry) {
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].Time.Before(entries[j].Time)
+	})
+}
+
+var (
+	defaultStore   *Store
+	defaultStoreMu sync.RWMutex
+)
+
+func SetDefaultStore(store *Store) {
+	defaultStoreMu.Lock()
+	defer defaultStoreMu.Unlock()
+	defaultStore = store
+}
+
+// DefaultStore returns the store installed by SetDefaultStore, or nil.
+func DefaultStore() *Store {
+	defaultStoreMu.RLock()
+	defer defaultStoreMu.RUnlock()
+	return defaultStore
+}
+
+// Record adds entry to the timeline of the correlation ID carried by ctx.
+// It does nothing without an ID or a default store, and failures are logged
+// rather than returned so tracing never fails the traced operation.
+func Record(ctx context.Context, entry Entry) {
+	correlationID := events.CorrelationID(ctx)
+	store := DefaultStore()
+	if correlationID == "" || store == nil {
+		return
+	}
+	if err := store.Add(correlationID, entry); err != nil {
+		tracingLogger.Printf("Error recording %s for %s: %v", entry.Name, correlationID, err)
+	}
+}
+
+// Publisher records published workspace events in the timeline of their
+// correlation ID.
+var Publisher events.Publisher = publisher{}
+
+type publisher struct{}
+
+func (publisher) Publish(ctx context.Context, event events.WorkspaceEvent) error {
+	entry := Entry{
+		ID:         event.ID,
+		Time:       event.OccurredAt,
+		Source:     SourceEvents,
+		Name:       string(event.Type),
+		Error:      event.Error,
+		Attributes: map[string]string{"workspace_id": event.WorkspaceID},
+	}
+	if event.ActorID != "" {
+		entry.Attributes["actor_id"] = event.ActorID
+	}
+	Record(events.WithCorrelationID(ctx, event.CorrelationID), entry)
+	return nil
+}
@@ -0,0 +1,77 @@
+package tracing
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/spectrumwebco/agent_runtime/backend/core/events"
+	"github.com/spectrumwebco/agent_runtime/backend/db/integrations/integrationsmock"
+)
+
+func TestValidID(t *testing.T) {
+	for id, expected := range map[string]bool{
+		NewID():                   true,
+		"cli-1234:retry.2":        true,
+		"":                        false,
+		"with space":              false,
+		"line\nbreak":             false,
+		string(make([]byte, 129)): false,
+	} {
+		if ValidID(id) != expected {
+			t.Errorf("expected ValidID(%q) to be %v", id, expected)
+		}
+	}
+}
+
+func TestTimeline(t *testing.T) {
+	store := NewStore(integrationsmock.NewKVStore(), Config{Enabled: true, TTL: DefaultTTL})
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i, name := range []string{"workspace.created", "POST /api/workspaces/", "exec"} {
+		// recorded out of order, as they arrive from different replicas
+		offset := []time.Duration{time.Second, 0, 2 * time.Second}[i]
+		if err := store.Add("request-1", Entry{Time: start.Add(offset), Name: name}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := store.Add("request-2", Entry{Name: "other"}); err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err := store.Timeline("request-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 3 || entries[0].Name != "POST /api/workspaces/" || entries[2].Name != "exec" || entries[0].ID == "" {
+		t.Errorf("unexpected timeline %+v", entries)
+	}
+
+	entries, err = store.Timeline("missing")
+	if err != nil || len(entries) != 0 {
+		t.Errorf("expected an empty timeline, got %+v, %v", entries, err)
+	}
+}
+
+func TestRecord(t *testing.T) {
+	store := NewStore(integrationsmock.NewKVStore(), Config{Enabled: true, TTL: DefaultTTL})
+	SetDefaultStore(store)
+	defer SetDefaultStore(nil)
+
+	Record(context.Background(), Entry{Name: "without an ID"})
+	Record(events.WithCorrelationID(context.Background(), "request-1"), Entry{Source: SourceAgent, Name: "exec"})
+	event := events.NewWorkspaceEvent(events.WithCorrelationID(context.Background(), "request-1"), events.WorkspaceCreated, "ws-1")
+	if err := Publisher.Publish(context.Background(), event); err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err := store.Timeline("request-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 || entries[0].Source != SourceAgent || entries[0].Time.IsZero() {
+		t.Errorf("unexpected timeline %+v", entries)
+	}
+	if entries[1].Name != "workspace.created" || entries[1].Attributes["workspace_id"] != "ws-1" {
+		t.Errorf("expected the event to be recorded, got %+v", entries[1])
+	}
+}
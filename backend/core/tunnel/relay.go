@@ -0,0 +1,547 @@
+package tunnel
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/websocket"
+)
+
+var logger = log.New(log.Writer(), "kled.tunnel: ", log.LstdFlags)
+
+const (
+	// AccessCookie holds the access token after the first visit of a link,
+	// scoped to the path of the share.
+	AccessCookie = "kled_tunnel"
+
+	// AppCookiePrefix marks the cookies of workspace apps. The relay renames
+	// the cookies an app sets and scopes them to the share, and forwards only
+	// those, so cookies of the backend never reach a workspace.
+	AppCookiePrefix = "kled_app_"
+
+	// MessageOpen asks the CLI to open a stream connection.
+	MessageOpen = "open"
+
+	DefaultOpenTimeout = 10 * time.Second
+)
+
+// ControlMessage is sent by the relay on the control connection.
+type ControlMessage struct {
+	Type   string `json:"type"`
+	Stream string `json:"stream,omitempty"`
+}
+
+// Audit actions recorded by the relay.
+const (
+	ActionConnect      = "tunnel.connect"
+	ActionDisconnect   = "tunnel.disconnect"
+	ActionAccess       = "tunnel.access"
+	ActionAccessDenied = "tunnel.access_denied"
+	ActionExpired      = "tunnel.expired"
+	ActionRevoked      = "tunnel.revoked"
+)
+
+// Event is passed to the AuditFunc. Request is nil for events that are not
+// caused by a request, such as expiry.
+type Event struct {
+	Action     string
+	Share      *Share
+	Request    *http.Request
+	StatusCode int
+	Reason     string
+}
+
+type AuditFunc func(event Event)
+
+// Relay serves public links and the connections of the CLIs serving them.
+type Relay struct {
+	store Store
+	audit AuditFunc
+
+	// PathPrefix is the path public links are served under, e.g. /api/t/.
+	PathPrefix string
+	// ShareDomain serves public links at <share>.<ShareDomain> instead of
+	// under PathPrefix, so workspace apps don't run on the origin of the
+	// backend and can't call its API with the credentials of a visitor.
+	// Requests under PathPrefix are redirected there.
+	ShareDomain string
+	OpenTimeout time.Duration
+
+	upgrader websocket.Upgrader
+	agents   map[string]*agent
+	mu       sync.Mutex
+	now      func() time.Time
+}
+
+func NewRelay(store Store, pathPrefix string, audit AuditFunc) *Relay {
+	if audit == nil {
+		audit = func(Event) {}
+	}
+
+	return &Relay{
+		store:       store,
+		audit:       audit,
+		PathPrefix:  "/" + strings.Trim(pathPrefix, "/") + "/",
+		OpenTimeout: DefaultOpenTimeout,
+		upgrader: websocket.Upgrader{
+			ReadBufferSize:  32 * 1024,
+			WriteBufferSize: 32 * 1024,
+			// the CLI is not a browser, it authenticates with the connect token
+			CheckOrigin: func(r *http.Request) bool { return true },
+		},
+		agents: make(map[string]*agent),
+		now:    time.Now,
+	}
+}
+
+func (r *Relay) Store() Store {
+	return r.store
+}
+
+// Connected reports whether a CLI is serving the share.
+func (r *Relay) Connected(shareID string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	_, ok := r.agents[shareID]
+	return ok
+}
+
+// agent is the control connection of the CLI serving a share.
+type agent struct {
+	share   *Share
+	control *websocket.Conn
+	writeMu sync.Mutex
+
+	pending map[string]chan net.Conn
+	mu      sync.Mutex
+
+	transport *http.Transport
+	proxy     *httputil.ReverseProxy
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+func (a *agent) close() {
+	a.closeOnce.Do(func() {
+		close(a.done)
+		_ = a.control.Close()
+		a.transport.CloseIdleConnections()
+	})
+}
+
+// open asks the CLI for a new stream and waits until it is connected.
+func (a *agent) open(ctx context.Context, timeout time.Duration) (net.Conn, error) {
+	stream := uuid.NewString()
+	ch := make(chan net.Conn, 1)
+
+	a.mu.Lock()
+	a.pending[stream] = ch
+	a.mu.Unlock()
+	defer func() {
+		a.mu.Lock()
+		delete(a.pending, stream)
+		a.mu.Unlock()
+	}()
+
+	a.writeMu.Lock()
+	_ = a.control.SetWriteDeadline(time.Now().Add(timeout))
+	err := a.control.WriteJSON(ControlMessage{Type: MessageOpen, Stream: stream})
+	a.writeMu.Unlock()
+	if err != nil {
+		return nil, fmt.Errorf("error requesting stream: %v", err)
+	}
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	select {
+	case conn := <-ch:
+		return conn, nil
+	case <-timer.C:
+		return nil, fmt.Errorf("workspace did not open a stream within %s", timeout)
+	case <-a.done:
+		return nil, ErrNotConnected
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func (a *agent) deliver(stream string, conn net.Conn) bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	ch, ok := a.pending[stream]
+	if !ok {
+		return false
+	}
+	delete(a.pending, stream)
+	ch <- conn
+	return true
+}
+
+// loadShare returns the share if it exists and did not expire.
+func (r *Relay) loadShare(ctx context.Context, shareID string) (*Share, int, error) {
+	share, err := r.store.Get(ctx, shareID)
+	if errors.Is(err, ErrNotFound) {
+		return nil, http.StatusNotFound, err
+	} else if err != nil {
+		return nil, http.StatusInternalServerError, err
+	}
+	if share.Expired(r.now()) {
+		return share, http.StatusGone, ErrExpired
+	}
+	return share, http.StatusOK, nil
+}
+
+// Connect upgrades the request to the control connection of the CLI serving
+// the share and blocks until it disconnects. A new connection replaces an
+// existing one.
+func (r *Relay) Connect(w http.ResponseWriter, req *http.Request, shareID string) {
+	share, status, err := r.loadShare(req.Context(), shareID)
+	if err != nil {
+		http.Error(w, err.Error(), status)
+		return
+	}
+	if !share.CheckConnect(bearerToken(req)) {
+		http.Error(w, ErrUnauthorized.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	control, err := r.upgrader.Upgrade(w, req, nil)
+	if err != nil {
+		logger.Printf("Error upgrading control connection of tunnel %s: %v", shareID, err)
+		return
+	}
+
+	a := &agent{
+		share:   share,
+		control: control,
+		pending: make(map[string]chan net.Conn),
+		done:    make(chan struct{}),
+	}
+	a.transport = &http.Transport{
+		DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			return a.open(ctx, r.OpenTimeout)
+		},
+		MaxIdleConnsPerHost: 16,
+		IdleConnTimeout:     90 * time.Second,
+	}
+	a.proxy = &httputil.ReverseProxy{
+		Director: func(out *http.Request) {
+			out.URL.Scheme = "http"
+			out.URL.Host = fmt.Sprintf("localhost:%d", share.Port)
+			// dev servers often only accept requests for localhost
+			out.Host = out.URL.Host
+		},
+		ModifyResponse: scopeAppCookies,
+		Transport:      a.transport,
+		ErrorHandler: func(w http.ResponseWriter, _ *http.Request, err error) {
+			http.Error(w, fmt.Sprintf("workspace did not respond: %v", err), http.StatusBadGateway)
+		},
+	}
+
+	r.mu.Lock()
+	previous := r.agents[shareID]
+	r.agents[shareID] = a
+	r.mu.Unlock()
+	if previous != nil {
+		previous.close()
+	}
+	r.audit(Event{Action: ActionConnect, Share: share, Request: req, StatusCode: http.StatusSwitchingProtocols})
+
+	// the CLI only sends pings and close frames
+	for {
+		if _, _, err := control.ReadMessage(); err != nil {
+			break
+		}
+	}
+
+	r.mu.Lock()
+	if r.agents[shareID] == a {
+		delete(r.agents, shareID)
+	}
+	r.mu.Unlock()
+	a.close()
+	r.audit(Event{Action: ActionDisconnect, Share: share, Request: req})
+}
+
+// AcceptStream upgrades the request to a stream the CLI opened for a
+// pending connection.
+func (r *Relay) AcceptStream(w http.ResponseWriter, req *http.Request, shareID, streamID string) {
+	share, status, err := r.loadShare(req.Context(), shareID)
+	if err != nil {
+		http.Error(w, err.Error(), status)
+		return
+	}
+	if !share.CheckConnect(bearerToken(req)) {
+		http.Error(w, ErrUnauthorized.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	r.mu.Lock()
+	a := r.agents[shareID]
+	r.mu.Unlock()
+	if a == nil {
+		http.Error(w, ErrNotConnected.Error(), http.StatusConflict)
+		return
+	}
+
+	ws, err := r.upgrader.Upgrade(w, req, nil)
+	if err != nil {
+		logger.Printf("Error upgrading stream of tunnel %s: %v", shareID, err)
+		return
+	}
+	if !a.deliver(streamID, newWSConn(ws)) {
+		_ = ws.Close()
+	}
+}
+
+// URL returns the public link of the share, below ShareDomain if it is set
+// and below base, the URL of the backend, otherwise.
+func (r *Relay) URL(base, shareID string) string {
+	base = strings.TrimSuffix(base, "/")
+	if r.ShareDomain != "" {
+		scheme := "https"
+		if strings.HasPrefix(base, "http://") {
+			scheme = "http"
+		}
+		return scheme + "://" + shareID + "." + r.ShareDomain + "/"
+	}
+	return base + r.PathPrefix + shareID + "/"
+}
+
+// ShareFromHost returns the share a request for a host below ShareDomain is
+// for.
+func (r *Relay) ShareFromHost(host string) (string, bool) {
+	if r.ShareDomain == "" {
+		return "", false
+	}
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	shareID, ok := strings.CutSuffix(strings.ToLower(host), "."+strings.ToLower(r.ShareDomain))
+	if !ok || shareID == "" || strings.Contains(shareID, ".") {
+		return "", false
+	}
+	return shareID, true
+}
+
+// ServeShare proxies a request for the public link to the workspace. rest is
+// the path after the share ID. With a ShareDomain the request is redirected
+// to the host of the share instead.
+func (r *Relay) ServeShare(w http.ResponseWriter, req *http.Request, shareID, rest string) {
+	if r.ShareDomain != "" {
+		scheme := "http"
+		if req.TLS != nil || req.Header.Get("X-Forwarded-Proto") == "https" {
+			scheme = "https"
+		}
+		redirect := url.URL{Scheme: scheme, Host: shareID + "." + r.ShareDomain, Path: "/" + strings.TrimPrefix(rest, "/"), RawQuery: req.URL.RawQuery}
+		http.Redirect(w, req, redirect.String(), http.StatusTemporaryRedirect)
+		return
+	}
+	r.serve(w, req, shareID, r.PathPrefix+shareID+"/", rest)
+}
+
+// ServeHost proxies a request for the host of a share below ShareDomain to
+// the workspace.
+func (r *Relay) ServeHost(w http.ResponseWriter, req *http.Request) {
+	shareID, ok := r.ShareFromHost(req.Host)
+	if !ok {
+		http.NotFound(w, req)
+		return
+	}
+	r.serve(w, req, shareID, "/", req.URL.Path)
+}
+
+// serve proxies a request for the share served under sharePath. A token in
+// the query is exchanged for a cookie, so the link can be shared once and
+// then browsed normally.
+func (r *Relay) serve(w http.ResponseWriter, req *http.Request, shareID, sharePath, rest string) {
+	share, status, err := r.loadShare(req.Context(), shareID)
+	if err != nil {
+		if share != nil {
+			r.audit(Event{Action: ActionAccessDenied, Share: share, Request: req, StatusCode: status, Reason: err.Error()})
+		}
+		http.Error(w, err.Error(), status)
+		return
+	}
+
+	if token := req.URL.Query().Get("token"); token != "" {
+		if !share.CheckAccess(token) {
+			r.audit(Event{Action: ActionAccessDenied, Share: share, Request: req, StatusCode: http.StatusUnauthorized, Reason: "invalid token"})
+			http.Error(w, ErrUnauthorized.Error(), http.StatusUnauthorized)
+			return
+		}
+
+		http.SetCookie(w, &http.Cookie{
+			Name:     AccessCookie,
+			Value:    token,
+			Path:     sharePath,
+			Expires:  share.ExpiresAt,
+			HttpOnly: true,
+			Secure:   req.TLS != nil || req.Header.Get("X-Forwarded-Proto") == "https",
+			SameSite: http.SameSiteLaxMode,
+		})
+		r.audit(Event{Action: ActionAccess, Share: share, Request: req, StatusCode: http.StatusSeeOther})
+
+		query := req.URL.Query()
+		query.Del("token")
+		redirect := url.URL{Path: sharePath + strings.TrimPrefix(rest, "/"), RawQuery: query.Encode()}
+		http.Redirect(w, req, redirect.String(), http.StatusSeeOther)
+		return
+	}
+
+	token := bearerToken(req)
+	if cookie, err := req.Cookie(AccessCookie); err == nil && token == "" {
+		token = cookie.Value
+	}
+	if !share.CheckAccess(token) {
+		r.audit(Event{Action: ActionAccessDenied, Share: share, Request: req, StatusCode: http.StatusUnauthorized, Reason: "missing or invalid token"})
+		http.Error(w, ErrUnauthorized.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	r.mu.Lock()
+	a := r.agents[shareID]
+	r.mu.Unlock()
+	if a == nil {
+		http.Error(w, ErrNotConnected.Error(), http.StatusBadGateway)
+		return
+	}
+
+	out := req.Clone(context.WithValue(req.Context(), sharePathKey{}, sharePath))
+	out.URL.Path = "/" + strings.TrimPrefix(rest, "/")
+	out.URL.RawPath = ""
+	out.Header.Del("Authorization")
+	forwardAppCookies(out)
+	a.proxy.ServeHTTP(w, out)
+}
+
+// Revoke deletes the share and disconnects the CLI serving it.
+func (r *Relay) Revoke(ctx context.Context, shareID string) error {
+	share, err := r.store.Get(ctx, shareID)
+	if err != nil {
+		return err
+	}
+	if err := r.store.Delete(ctx, shareID); err != nil {
+		return err
+	}
+
+	r.disconnect(shareID)
+	r.audit(Event{Action: ActionRevoked, Share: share})
+	return nil
+}
+
+// Sweep deletes expired shares and disconnects their CLIs. CLIs connected
+// to this relay for shares another replica revoked or expired are
+// disconnected too.
+func (r *Relay) Sweep(ctx context.Context) error {
+	expired, err := r.store.DeleteExpired(ctx, r.now())
+	if err != nil {
+		return err
+	}
+
+	for _, share := range expired {
+		r.disconnect(share.ID)
+		r.audit(Event{Action: ActionExpired, Share: share})
+	}
+
+	r.mu.Lock()
+	connected := make([]string, 0, len(r.agents))
+	for shareID := range r.agents {
+		connected = append(connected, shareID)
+	}
+	r.mu.Unlock()
+	for _, shareID := range connected {
+		if _, _, err := r.loadShare(ctx, shareID); errors.Is(err, ErrNotFound) || errors.Is(err, ErrExpired) {
+			r.disconnect(shareID)
+		}
+	}
+	return nil
+}
+
+// Run sweeps expired shares every interval until ctx is done.
+func (r *Relay) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := r.Sweep(ctx); err != nil {
+				logger.Printf("Error sweeping expired tunnels: %v", err)
+			}
+		}
+	}
+}
+
+func (r *Relay) disconnect(shareID string) {
+	r.mu.Lock()
+	a := r.agents[shareID]
+	delete(r.agents, shareID)
+	r.mu.Unlock()
+
+	if a != nil {
+		a.close()
+	}
+}
+
+func bearerToken(req *http.Request) string {
+	authorization := req.Header.Get("Authorization")
+	if len(authorization) > 7 && strings.EqualFold(authorization[:7], "bearer ") {
+		return strings.TrimSpace(authorization[7:])
+	}
+	return ""
+}
+
+type sharePathKey struct{}
+
+// forwardAppCookies drops every cookie but the ones of the workspace app,
+// which lose their prefix.
+func forwardAppCookies(req *http.Request) {
+	cookies := req.Cookies()
+	req.Header.Del("Cookie")
+	for _, cookie := range cookies {
+		if name, ok := strings.CutPrefix(cookie.Name, AppCookiePrefix); ok && name != "" {
+			req.AddCookie(&http.Cookie{Name: name, Value: cookie.Value})
+		}
+	}
+}
+
+// scopeAppCookies prefixes the cookies the workspace app sets and scopes
+// them to the path of the share, so they can't shadow or overwrite cookies
+// of the backend.
+func scopeAppCookies(res *http.Response) error {
+	cookies := res.Cookies()
+	if len(cookies) == 0 {
+		return nil
+	}
+	sharePath, _ := res.Request.Context().Value(sharePathKey{}).(string)
+	if sharePath == "" {
+		sharePath = "/"
+	}
+
+	res.Header.Del("Set-Cookie")
+	for _, cookie := range cookies {
+		cookie.Name = AppCookiePrefix + cookie.Name
+		cookie.Domain = ""
+		cookie.Path = sharePath + strings.TrimPrefix(cookie.Path, "/")
+		if value := cookie.String(); value != "" {
+			res.Header.Add("Set-Cookie", value)
+		}
+	}
+	return nil
+}
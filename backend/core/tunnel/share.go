@@ -0,0 +1,122 @@
+// Package tunnel exposes ports inside workspaces on public, token protected
+// links.
+//
+// The kled CLI creates a share for a workspace port and keeps a control
+// WebSocket open to the relay. For every connection of a visitor the relay
+// asks the CLI over the control connection to open a stream WebSocket, which
+// then carries the raw bytes of that connection. Shares expire after their
+// TTL and can be revoked at any time.
+package tunnel
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	DefaultTTL = time.Hour
+	MaxTTL     = 24 * time.Hour
+)
+
+var (
+	ErrNotFound     = errors.New("tunnel not found")
+	ErrExpired      = errors.New("tunnel has expired")
+	ErrUnauthorized = errors.New("invalid tunnel token")
+	ErrNotConnected = errors.New("workspace is not connected to the tunnel")
+)
+
+// Share is a workspace port exposed on a public link. Only hashes of the
+// tokens are stored.
+type Share struct {
+	ID          string    `json:"id"`
+	WorkspaceID string    `json:"workspace_id"`
+	Port        int       `json:"port"`
+	OwnerID     string    `json:"owner_id"`
+	Tenant      string    `json:"tenant"`
+	CreatedAt   time.Time `json:"created_at"`
+	ExpiresAt   time.Time `json:"expires_at"`
+
+	AccessTokenHash  string `json:"-"`
+	ConnectTokenHash string `json:"-"`
+}
+
+// Credentials are returned once when a share is created. The access token
+// is part of the public link, the connect token authenticates the CLI that
+// serves the port.
+type Credentials struct {
+	AccessToken  string `json:"access_token"`
+	ConnectToken string `json:"connect_token"`
+}
+
+// NewShare creates a share of port in the workspace. A zero ttl uses
+// DefaultTTL.
+func NewShare(workspaceID string, port int, ownerID, tenant string, ttl time.Duration, now time.Time) (*Share, Credentials, error) {
+	if workspaceID == "" {
+		return nil, Credentials{}, fmt.Errorf("workspace_id is required")
+	}
+	if port < 1 || port > 65535 {
+		return nil, Credentials{}, fmt.Errorf("port must be between 1 and 65535")
+	}
+	if ttl == 0 {
+		ttl = DefaultTTL
+	}
+	if ttl < time.Minute || ttl > MaxTTL {
+		return nil, Credentials{}, fmt.Errorf("ttl must be between 1m and %s", MaxTTL)
+	}
+
+	accessToken, err := newToken()
+	if err != nil {
+		return nil, Credentials{}, err
+	}
+	connectToken, err := newToken()
+	if err != nil {
+		return nil, Credentials{}, err
+	}
+
+	share := &Share{
+		ID:               uuid.NewString(),
+		WorkspaceID:      workspaceID,
+		Port:             port,
+		OwnerID:          ownerID,
+		Tenant:           tenant,
+		CreatedAt:        now.UTC(),
+		ExpiresAt:        now.UTC().Add(ttl),
+		AccessTokenHash:  hashToken(accessToken),
+		ConnectTokenHash: hashToken(connectToken),
+	}
+	return share, Credentials{AccessToken: accessToken, ConnectToken: connectToken}, nil
+}
+
+func (s *Share) Expired(now time.Time) bool {
+	return !now.Before(s.ExpiresAt)
+}
+
+// CheckAccess reports whether token grants access to the public link.
+func (s *Share) CheckAccess(token string) bool {
+	return token != "" && subtle.ConstantTimeCompare([]byte(hashToken(token)), []byte(s.AccessTokenHash)) == 1
+}
+
+// CheckConnect reports whether token may serve the share.
+func (s *Share) CheckConnect(token string) bool {
+	return token != "" && subtle.ConstantTimeCompare([]byte(hashToken(token)), []byte(s.ConnectTokenHash)) == 1
+}
+
+func newToken() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("error generating tunnel token: %v", err)
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,232 @@
+package tunnel
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/spectrumwebco/agent_runtime/backend/db/integrations"
+)
+
+type Store interface {
+	Create(ctx context.Context, share *Share) error
+	// Get returns the share, including expired ones, or ErrNotFound.
+	Get(ctx context.Context, id string) (*Share, error)
+	// List returns the shares of a tenant, oldest first.
+	List(ctx context.Context, tenant string) ([]*Share, error)
+	Delete(ctx context.Context, id string) error
+	// DeleteExpired removes and returns the shares that expired before now.
+	DeleteExpired(ctx context.Context, now time.Time) ([]*Share, error)
+}
+
+// MemoryStore keeps shares in memory, for tests and single replicas without
+// Postgres. Its shares are lost when the process restarts.
+type MemoryStore struct {
+	shares map[string]*Share
+	mu     sync.Mutex
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{shares: make(map[string]*Share)}
+}
+
+func (s *MemoryStore) Create(ctx context.Context, share *Share) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	copied := *share
+	s.shares[share.ID] = &copied
+	return nil
+}
+
+func (s *MemoryStore) Get(ctx context.Context, id string) (*Share, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	share, ok := s.shares[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	copied := *share
+	return &copied, nil
+}
+
+func (s *MemoryStore) List(ctx context.Context, tenant string) ([]*Share, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	shares := []*Share{}
+	for _, share := range s.shares {
+		if share.Tenant == tenant {
+			copied := *share
+			shares = append(shares, &copied)
+		}
+	}
+	sort.Slice(shares, func(i, j int) bool {
+		return shares[i].CreatedAt.Before(shares[j].CreatedAt)
+	})
+	return shares, nil
+}
+
+func (s *MemoryStore) Delete(ctx context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.shares[id]; !ok {
+		return ErrNotFound
+	}
+	delete(s.shares, id)
+	return nil
+}
+
+func (s *MemoryStore) DeleteExpired(ctx context.Context, now time.Time) ([]*Share, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	expired := []*Share{}
+	for id, share := range s.shares {
+		if share.Expired(now) {
+			expired = append(expired, share)
+			delete(s.shares, id)
+		}
+	}
+	return expired, nil
+}
+
+// PostgresStore keeps shares in app_tunnel_share, so every replica can
+// list and revoke them and they survive restarts. A share is still only
+// served by the replica its CLI is connected to.
+type PostgresStore struct {
+	client integrations.SQLStore
+}
+
+func NewPostgresStore(client integrations.SQLStore) *PostgresStore {
+	return &PostgresStore{client: client}
+}
+
+func (s *PostgresStore) EnsureSchema() error {
+	_, err := s.client.ExecuteUpdate(`
+		CREATE TABLE IF NOT EXISTS app_tunnel_share (
+			id VARCHAR(64) PRIMARY KEY,
+			workspace_id VARCHAR(255) NOT NULL,
+			port INTEGER NOT NULL,
+			owner_id VARCHAR(255) NOT NULL,
+			tenant VARCHAR(255) NOT NULL,
+			created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+			expires_at TIMESTAMPTZ NOT NULL,
+			access_token_hash CHAR(64) NOT NULL,
+			connect_token_hash CHAR(64) NOT NULL
+		);
+		CREATE INDEX IF NOT EXISTS app_tunnel_share_tenant_idx ON app_tunnel_share (tenant, created_at);
+		CREATE INDEX IF NOT EXISTS app_tunnel_share_expires_idx ON app_tunnel_share (expires_at)
+	`)
+	if err != nil {
+		return fmt.Errorf("error creating tunnel share table: %v", err)
+	}
+	return nil
+}
+
+const shareColumns = `id, workspace_id, port, owner_id, tenant, created_at, expires_at, access_token_hash, connect_token_hash`
+
+func (s *PostgresStore) Create(ctx context.Context, share *Share) error {
+	_, err := s.client.ExecuteUpdate(
+		`INSERT INTO app_tunnel_share (`+shareColumns+`) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)`,
+		share.ID, share.WorkspaceID, share.Port, share.OwnerID, share.Tenant,
+		share.CreatedAt.UTC(), share.ExpiresAt.UTC(), share.AccessTokenHash, share.ConnectTokenHash,
+	)
+	if err != nil {
+		return fmt.Errorf("error creating tunnel %s: %v", share.ID, err)
+	}
+	return nil
+}
+
+func (s *PostgresStore) Get(ctx context.Context, id string) (*Share, error) {
+	rows, err := s.client.ExecuteQuery(`SELECT `+shareColumns+` FROM app_tunnel_share WHERE id = $1`, id)
+	if err != nil {
+		return nil, fmt.Errorf("error loading tunnel %s: %v", id, err)
+	}
+	if len(rows) == 0 {
+		return nil, ErrNotFound
+	}
+	return shareFromRow(rows[0]), nil
+}
+
+func (s *PostgresStore) List(ctx context.Context, tenant string) ([]*Share, error) {
+	rows, err := s.client.ExecuteQuery(`SELECT `+shareColumns+` FROM app_tunnel_share WHERE tenant = $1 ORDER BY created_at`, tenant)
+	if err != nil {
+		return nil, fmt.Errorf("error listing tunnels of %s: %v", tenant, err)
+	}
+	return sharesFromRows(rows), nil
+}
+
+func (s *PostgresStore) Delete(ctx context.Context, id string) error {
+	deleted, err := s.client.ExecuteUpdate(`DELETE FROM app_tunnel_share WHERE id = $1`, id)
+	if err != nil {
+		return fmt.Errorf("error deleting tunnel %s: %v", id, err)
+	}
+	if deleted == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (s *PostgresStore) DeleteExpired(ctx context.Context, now time.Time) ([]*Share, error) {
+	rows, err := s.client.ExecuteQuery(`DELETE FROM app_tunnel_share WHERE expires_at <= $1 RETURNING `+shareColumns, now.UTC())
+	if err != nil {
+		return nil, fmt.Errorf("error deleting expired tunnels: %v", err)
+	}
+	return sharesFromRows(rows), nil
+}
+
+// ConfigureDefault returns the store the tunnel server keeps shares in. If the
+// shares table cannot be created, shares are kept in memory and their links
+// stop working when the server restarts.
+func ConfigureDefault(client integrations.SQLStore) Store {
+	store := NewPostgresStore(client)
+	if err := store.EnsureSchema(); err != nil {
+		logger.Printf("Tunnels falling back to in-memory store: %v", err)
+		return NewMemoryStore()
+	}
+	return store
+}
+
+func sharesFromRows(rows []map[string]interface{}) []*Share {
+	shares := make([]*Share, 0, len(rows))
+	for _, row := range rows {
+		shares = append(shares, shareFromRow(row))
+	}
+	return shares
+}
+
+func shareFromRow(row map[string]interface{}) *Share {
+	share := &Share{
+		ID:               toString(row["id"]),
+		WorkspaceID:      toString(row["workspace_id"]),
+		OwnerID:          toString(row["owner_id"]),
+		Tenant:           toString(row["tenant"]),
+		AccessTokenHash:  toString(row["access_token_hash"]),
+		ConnectTokenHash: toString(row["connect_token_hash"]),
+	}
+	share.Port, _ = strconv.Atoi(toString(row["port"]))
+	if createdAt, ok := row["created_at"].(time.Time); ok {
+		share.CreatedAt = createdAt.UTC()
+	}
+	if expiresAt, ok := row["expires_at"].(time.Time); ok {
+		share.ExpiresAt = expiresAt.UTC()
+	}
+	return share
+}
+
+func toString(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case []byte:
+		return string(v)
+	default:
+		return fmt.Sprint(v)
+	}
+}
@@ -0,0 +1,320 @@
+package tunnel
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestShareTokens(t *testing.T) {
+	now := time.Now()
+	share, credentials, err := NewShare("ws-1", 3000, "user-1", "org/project", 0, now)
+	if err != nil {
+		t.Fatalf("NewShare: %v", err)
+	}
+
+	if !share.CheckAccess(credentials.AccessToken) || share.CheckAccess(credentials.ConnectToken) || share.CheckAccess("") {
+		t.Error("access token check is wrong")
+	}
+	if !share.CheckConnect(credentials.ConnectToken) || share.CheckConnect(credentials.AccessToken) {
+		t.Error("connect token check is wrong")
+	}
+	if share.Expired(now) || !share.Expired(now.Add(DefaultTTL)) {
+		t.Error("expiry is wrong")
+	}
+
+	if _, _, err := NewShare("ws-1", 3000, "user-1", "org", 48*time.Hour, now); err == nil {
+		t.Error("expected ttl above the maximum to be rejected")
+	}
+	if _, _, err := NewShare("ws-1", 0, "user-1", "org", 0, now); err == nil {
+		t.Error("expected invalid port to be rejected")
+	}
+}
+
+// serveAgent plays the CLI: it answers open requests by connecting a stream
+// to target.
+func serveAgent(t *testing.T, relayURL, shareID, token, target string) *websocket.Conn {
+	t.Helper()
+
+	header := http.Header{"Authorization": []string{"Bearer " + token}}
+	control, _, err := websocket.DefaultDialer.Dial(relayURL+"/connect/"+shareID, header)
+	if err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+
+	go func() {
+		for {
+			var message ControlMessage
+			if err := control.ReadJSON(&message); err != nil {
+				return
+			}
+
+			go func(stream string) {
+				ws, _, err := websocket.DefaultDialer.Dial(relayURL+"/streams/"+shareID+"/"+stream, header)
+				if err != nil {
+					return
+				}
+				remote := newWSConn(ws)
+				local, err := net.Dial("tcp", target)
+				if err != nil {
+					remote.Close()
+					return
+				}
+
+				go func() {
+					_, _ = io.Copy(local, remote)
+					local.Close()
+				}()
+				_, _ = io.Copy(remote, local)
+				remote.Close()
+			}(message.Stream)
+		}
+	}()
+
+	return control
+}
+
+func TestRelay(t *testing.T) {
+	app := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, err := r.Cookie(AccessCookie); err == nil {
+			t.Error("access cookie was forwarded to the workspace")
+		}
+		if _, err := r.Cookie("sessionid"); err == nil {
+			t.Error("backend session cookie was forwarded to the workspace")
+		}
+		if r.URL.Path == "/login" {
+			http.SetCookie(w, &http.Cookie{Name: "sid", Value: "app", Path: "/"})
+		}
+		if cookie, err := r.Cookie("sid"); err == nil {
+			fmt.Fprintf(w, "%s ", cookie.Value)
+		}
+		fmt.Fprintf(w, "hello from %s", r.URL.Path)
+	}))
+	defer app.Close()
+
+	var (
+		events   []string
+		eventsMu sync.Mutex
+	)
+	store := NewMemoryStore()
+	relay := NewRelay(store, "/t/", func(event Event) {
+		eventsMu.Lock()
+		defer eventsMu.Unlock()
+		events = append(events, event.Action)
+	})
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		parts := strings.SplitN(strings.TrimPrefix(r.URL.Path, "/"), "/", 3)
+		switch {
+		case parts[0] == "connect":
+			relay.Connect(w, r, parts[1])
+		case parts[0] == "streams":
+			relay.AcceptStream(w, r, parts[1], parts[2])
+		case parts[0] == "t":
+			rest := ""
+			if len(parts) == 3 {
+				rest = parts[2]
+			}
+			relay.ServeShare(w, r, parts[1], rest)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	_, port, _ := net.SplitHostPort(strings.TrimPrefix(app.URL, "http://"))
+	var portNumber int
+	fmt.Sscan(port, &portNumber)
+
+	share, credentials, err := NewShare("ws-1", portNumber, "user-1", "org", 0, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Create(context.Background(), share); err != nil {
+		t.Fatal(err)
+	}
+
+	// without a token the link is rejected
+	res, err := http.Get(server.URL + "/t/" + share.ID + "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("expected 401 without token, got %d", res.StatusCode)
+	}
+
+	// not connected yet
+	req, _ := http.NewRequest(http.MethodGet, server.URL+"/t/"+share.ID+"/", nil)
+	req.Header.Set("Authorization", "Bearer "+credentials.AccessToken)
+	res, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusBadGateway {
+		t.Fatalf("expected 502 before the workspace connected, got %d", res.StatusCode)
+	}
+
+	wsURL := "ws" + strings.TrimPrefix(server.URL, "http")
+	control := serveAgent(t, wsURL, share.ID, credentials.ConnectToken, strings.TrimPrefix(app.URL, "http://"))
+	defer control.Close()
+	for i := 0; i < 100 && !relay.Connected(share.ID); i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// the token in the link is exchanged for a cookie
+	jar, _ := cookiejar.New(nil)
+	client := &http.Client{Jar: jar}
+	res, err = client.Get(server.URL + "/t/" + share.ID + "/index.html?token=" + credentials.AccessToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(res.Body)
+	res.Body.Close()
+	if res.StatusCode != http.StatusOK || string(body) != "hello from /index.html" {
+		t.Fatalf("unexpected response %d: %s", res.StatusCode, body)
+	}
+	if res.Request.URL.Query().Get("token") != "" {
+		t.Error("token was not removed from the url")
+	}
+
+	// backend cookies stay with the backend, app cookies are scoped to the share
+	serverURL, _ := url.Parse(server.URL)
+	jar.SetCookies(serverURL, []*http.Cookie{{Name: "sessionid", Value: "admin", Path: "/"}})
+	res, err = client.Get(server.URL + "/t/" + share.ID + "/login")
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if cookies := res.Header.Values("Set-Cookie"); len(cookies) != 1 || !strings.HasPrefix(cookies[0], AppCookiePrefix+"sid=app; Path=/t/"+share.ID+"/") {
+		t.Errorf("expected the app cookie to be scoped to the share, got %v", cookies)
+	}
+	res, err = client.Get(server.URL + "/t/" + share.ID + "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ = io.ReadAll(res.Body)
+	res.Body.Close()
+	if string(body) != "app hello from /" {
+		t.Errorf("expected the app cookie to be forwarded, got %s", body)
+	}
+
+	// revoking disconnects the workspace
+	if err := relay.Revoke(context.Background(), share.ID); err != nil {
+		t.Fatal(err)
+	}
+	res, err = client.Get(server.URL + "/t/" + share.ID + "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusNotFound {
+		t.Fatalf("expected 404 after revoke, got %d", res.StatusCode)
+	}
+
+	eventsMu.Lock()
+	defer eventsMu.Unlock()
+	for _, action := range []string{ActionAccessDenied, ActionConnect, ActionAccess, ActionRevoked} {
+		found := false
+		for _, event := range events {
+			found = found || event == action
+		}
+		if !found {
+			t.Errorf("expected audit event %s, got %v", action, events)
+		}
+	}
+}
+
+func TestShareDomain(t *testing.T) {
+	relay := NewRelay(NewMemoryStore(), "/api/t/", nil)
+	if got := relay.URL("https://kled.example.com", "abc"); got != "https://kled.example.com/api/t/abc/" {
+		t.Errorf("unexpected path link %s", got)
+	}
+
+	relay.ShareDomain = "t.kled.example.com"
+	if got := relay.URL("https://kled.example.com", "abc"); got != "https://abc.t.kled.example.com/" {
+		t.Errorf("unexpected share domain link %s", got)
+	}
+	for host, want := range map[string]string{
+		"abc.t.kled.example.com":      "abc",
+		"ABC.t.kled.example.com:8443": "abc",
+		"t.kled.example.com":          "",
+		"a.b.t.kled.example.com":      "",
+		"abc.kled.example.com":        "",
+	} {
+		if got, _ := relay.ShareFromHost(host); got != want {
+			t.Errorf("expected share %q for %s, got %q", want, host, got)
+		}
+	}
+
+	// links under the path prefix move to the host of the share
+	res := httptest.NewRecorder()
+	relay.ServeShare(res, httptest.NewRequest(http.MethodGet, "/api/t/abc/app.js?token=x", nil), "abc", "app.js")
+	if location := res.Header().Get("Location"); res.Code != http.StatusTemporaryRedirect || location != "http://abc.t.kled.example.com/app.js?token=x" {
+		t.Errorf("unexpected redirect %d to %s", res.Code, location)
+	}
+}
+
+func TestSweep(t *testing.T) {
+	store := NewMemoryStore()
+	relay := NewRelay(store, "/t/", nil)
+
+	share, _, err := NewShare("ws-1", 3000, "user-1", "org", time.Minute, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = store.Create(context.Background(), share)
+
+	relay.now = func() time.Time { return time.Now().Add(2 * time.Minute) }
+	if err := relay.Sweep(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.Get(context.Background(), share.ID); err != ErrNotFound {
+		t.Errorf("expected expired share to be deleted, got %v", err)
+	}
+}
+
+func TestSweepDisconnectsSharesRevokedElsewhere(t *testing.T) {
+	store := NewMemoryStore()
+	relay := NewRelay(store, "/t/", nil)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		relay.Connect(w, r, strings.TrimPrefix(r.URL.Path, "/connect/"))
+	}))
+	defer server.Close()
+
+	share, credentials, err := NewShare("ws-1", 3000, "user-1", "org", 0, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = store.Create(context.Background(), share)
+	control := serveAgent(t, "ws"+strings.TrimPrefix(server.URL, "http"), share.ID, credentials.ConnectToken, "127.0.0.1:1")
+	defer control.Close()
+	for deadline := time.Now().Add(5 * time.Second); !relay.Connected(share.ID); time.Sleep(10 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatal("the CLI did not connect")
+		}
+	}
+
+	// another replica revoked the share in the shared store
+	if err := store.Delete(context.Background(), share.ID); err != nil {
+		t.Fatal(err)
+	}
+	if err := relay.Sweep(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if relay.Connected(share.ID) {
+		t.Error("expected the CLI of the revoked share to be disconnected")
+	}
+}
@@ -0,0 +1,102 @@
+package vectorindex
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/spectrumwebco/agent_runtime/backend/db/integrations"
+)
+
+// DefaultAliasTTL is how long an AliasResolver caches the aliases. After a
+// swap, searches can reach the previous index for that long.
+const DefaultAliasTTL = 10 * time.Second
+
+var _ integrations.IndexAliases = (*AliasResolver)(nil)
+
+// AliasResolver resolves the index names of the RAGflow manager from the
+// aliases of a Store. The aliases and jobs are loaded at once and cached,
+// so resolving a name costs no query.
+type AliasResolver struct {
+	store Store
+	ttl   time.Duration
+
+	mu       sync.Mutex
+	loaded   time.Time
+	physical map[string]string
+	logical  map[string]string
+}
+
+func NewAliasResolver(store Store, ttl time.Duration) *AliasResolver {
+	return &AliasResolver{store: store, ttl: ttl}
+}
+
+func (r *AliasResolver) ResolveIndex(name string) (string, error) {
+	physical, _, err := r.load()
+	if err != nil {
+		return "", err
+	}
+	if index, ok := physical[name]; ok {
+		return index, nil
+	}
+	return name, nil
+}
+
+func (r *AliasResolver) LogicalIndexes() (map[string]string, error) {
+	_, logical, err := r.load()
+	return logical, err
+}
+
+// Invalidate drops the cached aliases, so the next call loads them again.
+func (r *AliasResolver) Invalidate() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.loaded = time.Time{}
+}
+
+func (r *AliasResolver) load() (map[string]string, map[string]string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if !r.loaded.IsZero() && time.Since(r.loaded) < r.ttl {
+		return r.physical, r.logical, nil
+	}
+
+	ctx := context.Background()
+	aliases, err := r.store.Aliases(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	jobs, err := r.store.Jobs(ctx, "")
+	if err != nil {
+		return nil, nil, err
+	}
+
+	physical := make(map[string]string, len(aliases))
+	for _, alias := range aliases {
+		physical[alias.Name] = alias.Index
+	}
+	// every index a reindex built or replaced is hidden, except the ones
+	// the aliases point at
+	logical := map[string]string{}
+	names := map[string]bool{}
+	for _, job := range jobs {
+		logical[job.Source], logical[job.Target] = "", ""
+		names[job.Alias] = true
+	}
+	for name := range physical {
+		logical[name] = ""
+		names[name] = true
+	}
+	for name := range names {
+		if index, ok := physical[name]; ok {
+			logical[index] = name
+		} else {
+			logical[name] = name
+		}
+	}
+
+	r.physical, r.logical, r.loaded = physical, logical, time.Now()
+	return physical, logical, nil
+}
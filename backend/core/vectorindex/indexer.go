@@ -0,0 +1,166 @@
+package vectorindex
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/spectrumwebco/agent_runtime/backend/core/embeddings"
+	"github.com/spectrumwebco/agent_runtime/backend/core/querycache"
+	"github.com/spectrumwebco/agent_runtime/backend/core/tenancy"
+	"github.com/spectrumwebco/agent_runtime/backend/db/integrations"
+)
+
+// Embedders returns the embedder of a model, or the default embedder for
+// an empty model.
+type Embedders func(model string) embeddings.Embedder
+
+// ModelEmbedders builds the embedders of the models from config, changing
+// only the model, and keeps them for reuse.
+func ModelEmbedders(config embeddings.Config, kv integrations.KVStore) Embedders {
+	var (
+		built = map[string]embeddings.Embedder{}
+		mu    sync.Mutex
+	)
+	return func(model string) embeddings.Embedder {
+		if model == "" {
+			return embeddings.DefaultEmbedder()
+		}
+		mu.Lock()
+		defer mu.Unlock()
+
+		if embedder, ok := built[model]; ok {
+			return embedder
+		}
+		modelConfig := config
+		modelConfig.Model = model
+		built[model] = embeddings.New(modelConfig, nil, kv)
+		return built[model]
+	}
+}
+
+// Indexer writes documents to the Store and to the indexes derived from
+// it. vectors is the unscoped vector store; indexes are addressed by the
+// physical names the aliases point at.
+type Indexer struct {
+	store     Store
+	vectors   integrations.VectorStore
+	embedders Embedders
+	cache     *querycache.Cache
+}
+
+func NewIndexer(store Store, vectors integrations.VectorStore, embedders Embedders) *Indexer {
+	return &Indexer{store: store, vectors: vectors, embedders: embedders}
+}
+
+func (i *Indexer) Store() Store {
+	return i.store
+}
+
+// SetCache caches search results in cache, invalidated by the writes of
+// the Indexer. It is called before the Indexer is used.
+func (i *Indexer) SetCache(cache *querycache.Cache) {
+	i.cache = cache
+}
+
+// targets returns the indexes a write to an alias goes to: the index the
+// alias points at, and the index a job is backfilling. The job is loaded
+// before the alias; a job completes only after swapping the alias, so a
+// write never misses the new index during the cutover.
+func (i *Indexer) targets(ctx context.Context, name string) ([]Alias, error) {
+	job, err := i.store.ActiveJob(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	alias, err := i.store.Alias(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	targets := []Alias{*alias}
+	if job != nil && job.Target != alias.Index {
+		targets = append(targets, Alias{Name: name, Index: job.Target, Model: job.Model})
+	}
+	return targets, nil
+}
+
+// Resolve returns the alias of an index of the tenant.
+func (i *Indexer) Resolve(ctx context.Context, tenant tenancy.Tenant, index string) (*Alias, error) {
+	return i.store.Alias(ctx, tenant.IndexName(index))
+}
+
+// Ingest records documents and embeds them into the index of the alias,
+// and into the index being backfilled if a reindex is running. It returns
+// the IDs and the model of the index of the alias.
+func (i *Indexer) Ingest(ctx context.Context, tenant tenancy.Tenant, index string, documents []embeddings.Document) ([]string, string, error) {
+	if err := i.store.SaveDocuments(ctx, tenant, index, documents); err != nil {
+		return nil, "", err
+	}
+	targets, err := i.targets(ctx, tenant.IndexName(index))
+	if err != nil {
+		return nil, "", err
+	}
+
+	var (
+		ids   []string
+		model string
+	)
+	for n, target := range targets {
+		embedder := i.embedders(target.Model)
+		if embedder == nil {
+			return nil, "", fmt.Errorf("no embedder configured for %s", index)
+		}
+		added, err := embeddings.Ingest(ctx, embedder, tenant, i.vectors, target.Index, documents)
+		if err != nil {
+			return nil, "", err
+		}
+		if n == 0 {
+			ids, model = added, embedder.Model()
+		}
+	}
+	i.cache.Invalidate(tenant, index)
+	return ids, model, nil
+}
+
+// Delete deletes documents from the Store and from the indexes of the
+// alias.
+func (i *Indexer) Delete(ctx context.Context, tenant tenancy.Tenant, index string, ids []string) error {
+	if err := i.store.DeleteDocuments(ctx, tenant, index, ids); err != nil {
+		return err
+	}
+	targets, err := i.targets(ctx, tenant.IndexName(index))
+	if err != nil {
+		return err
+	}
+	for _, target := range targets {
+		if _, err := i.vectors.DeleteVectors(target.Index, ids); err != nil {
+			return fmt.Errorf("error deleting documents from %s: %v", target.Index, err)
+		}
+	}
+	i.cache.Invalidate(tenant, index)
+	return nil
+}
+
+// Search embeds query with the model of the alias and returns the topK
+// nearest documents of the index it points at, from the cache if the
+// query was searched since the index was last written.
+func (i *Indexer) Search(ctx context.Context, tenant tenancy.Tenant, index, query string, topK int, filter map[string]interface{}) ([]map[string]interface{}, error) {
+	alias, err := i.Resolve(ctx, tenant, index)
+	if err != nil {
+		return nil, err
+	}
+	key := querycache.Key{Index: index, Source: alias.Index, Query: query, TopK: topK, Filter: filter}
+	return i.cache.Fetch(tenant, key, func() ([]map[string]interface{}, error) {
+		embedder := i.embedders(alias.Model)
+		if embedder == nil {
+			return nil, fmt.Errorf("no embedder configured for %s", index)
+		}
+		vectors, err := embedder.Embed(ctx, tenant, []string{query})
+		if err != nil {
+			return nil, err
+		}
+		if len(vectors) != 1 {
+			return nil, fmt.Errorf("%s returned %d embeddings for the query", embedder.Model(), len(vectors))
+		}
+		return i.vectors.Search(alias.Index, vectors[0], topK, filter)
+	})
+}
@@ -0,0 +1,261 @@
+package vectorindex
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/spectrumwebco/agent_runtime/backend/core/embeddings"
+	"github.com/spectrumwebco/agent_runtime/backend/core/kerrors"
+	"github.com/spectrumwebco/agent_runtime/backend/core/tenancy"
+)
+
+const (
+	DefaultDimension = 1536
+	DefaultMetric    = "cosine"
+	DefaultBatchSize = 100
+)
+
+// Spec describes the index an alias is rebuilt into.
+type Spec struct {
+	Tenant    tenancy.Tenant
+	Index     string
+	Dimension int
+	Metric    string
+	// Model is the embedding model of the new index, empty for the
+	// default model.
+	Model string
+}
+
+// Reindexer rebuilds indexes from the Store of its Indexer.
+type Reindexer struct {
+	indexer   *Indexer
+	batchSize int
+}
+
+func NewReindexer(indexer *Indexer, batchSize int) *Reindexer {
+	if batchSize < 1 {
+		batchSize = DefaultBatchSize
+	}
+	return &Reindexer{indexer: indexer, batchSize: batchSize}
+}
+
+// Start creates the new index and the job backfilling it. From then on
+// ingests are written to both indexes.
+func (r *Reindexer) Start(ctx context.Context, spec Spec) (*Job, error) {
+	if spec.Index == "" {
+		return nil, kerrors.New(kerrors.InvalidArgument, "an index is required")
+	}
+	if spec.Dimension <= 0 {
+		spec.Dimension = DefaultDimension
+	}
+	if spec.Metric == "" {
+		spec.Metric = DefaultMetric
+	}
+
+	store := r.indexer.store
+	name := spec.Tenant.IndexName(spec.Index)
+	if active, err := store.ActiveJob(ctx, name); err != nil {
+		return nil, err
+	} else if active != nil {
+		return nil, kerrors.Errorf(kerrors.Conflict, "%s is already being reindexed by job %d", name, active.ID)
+	}
+	alias, err := store.Alias(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	jobs, err := store.Jobs(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	total, err := store.CountDocuments(ctx, spec.Tenant, spec.Index)
+	if err != nil {
+		return nil, err
+	}
+
+	// the index the alias was created with is the first version
+	target := fmt.Sprintf("%s_v%d", name, len(jobs)+2)
+	if ok, err := r.indexer.vectors.CreateIndex(target, spec.Dimension, spec.Metric); err != nil || !ok {
+		return nil, fmt.Errorf("error creating index %s: %v", target, err)
+	}
+
+	now := time.Now().UTC()
+	job := &Job{
+		Alias:     name,
+		Tenant:    spec.Tenant,
+		Index:     spec.Index,
+		Source:    alias.Index,
+		Target:    target,
+		Dimension: spec.Dimension,
+		Metric:    spec.Metric,
+		Model:     spec.Model,
+		State:     JobBackfilling,
+		Total:     total,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	if err := store.CreateJob(ctx, job); err != nil {
+		return nil, err
+	}
+	vectorindexLogger.Printf("Started %s with %d documents", job, total)
+	return job, nil
+}
+
+// Run backfills the index of a job and swaps the alias to it. A job that
+// was interrupted continues after its cursor. report, if set, is called
+// after each batch. If the backfill fails, the job fails and its index is
+// deleted; start a new job to try again.
+//
+// Only one process should run a job at a time.
+func (r *Reindexer) Run(ctx context.Context, job *Job, report func(*Job)) error {
+	if job.State != JobBackfilling {
+		return kerrors.Errorf(kerrors.Conflict, "%s is %s", job, job.State)
+	}
+	if err := r.run(ctx, job, report); err != nil {
+		// interrupted jobs are resumed, not failed
+		if kerrors.CodeOf(err) == kerrors.Conflict || ctx.Err() != nil {
+			return err
+		}
+		r.fail(job, err)
+		return err
+	}
+	return nil
+}
+
+func (r *Reindexer) run(ctx context.Context, job *Job, report func(*Job)) error {
+	store := r.indexer.store
+	embedder := r.indexer.embedders(job.Model)
+	if embedder == nil {
+		return fmt.Errorf("no embedder configured for %s", job.Index)
+	}
+
+	for {
+		if err := r.checkActive(ctx, job); err != nil {
+			return err
+		}
+		records, err := store.Documents(ctx, job.Tenant, job.Index, job.Cursor, time.Time{}, r.batchSize)
+		if err != nil {
+			return err
+		}
+		if len(records) == 0 {
+			break
+		}
+		if err := r.copy(ctx, job, embedder, records); err != nil {
+			return err
+		}
+		job.Done += len(records)
+		job.Cursor = records[len(records)-1].ID
+		job.UpdatedAt = time.Now().UTC()
+		if err := store.UpdateJob(ctx, job); err != nil {
+			return err
+		}
+		if report != nil {
+			report(job)
+		}
+	}
+
+	// a document changed while its batch was being copied can have been
+	// overwritten with the version the batch read, so everything changed
+	// since the start is copied again
+	for cursor := ""; ; {
+		records, err := store.Documents(ctx, job.Tenant, job.Index, cursor, job.CreatedAt, r.batchSize)
+		if err != nil {
+			return err
+		}
+		if len(records) == 0 {
+			break
+		}
+		if err := r.copy(ctx, job, embedder, records); err != nil {
+			return err
+		}
+		cursor = records[len(records)-1].ID
+	}
+
+	if err := r.checkActive(ctx, job); err != nil {
+		return err
+	}
+	if err := store.SwapAlias(ctx, job.Alias, job.Source, job.Target, job.Model); err != nil {
+		// the alias was moved by someone else, the job is stale
+		return fmt.Errorf("error swapping %s to %s: %v", job.Alias, job.Target, err)
+	}
+	job.State, job.UpdatedAt = JobCompleted, time.Now().UTC()
+	if err := store.UpdateJob(ctx, job); err != nil {
+		return err
+	}
+	vectorindexLogger.Printf("Completed %s, %s now points at %s", job, job.Alias, job.Target)
+	return nil
+}
+
+// copy writes live records to the index of the job and deletes deleted
+// ones from it.
+func (r *Reindexer) copy(ctx context.Context, job *Job, embedder embeddings.Embedder, records []Record) error {
+	var (
+		live    []embeddings.Document
+		deleted []string
+	)
+	for _, record := range records {
+		if record.Deleted {
+			deleted = append(deleted, record.ID)
+		} else {
+			live = append(live, record.Document)
+		}
+	}
+	if len(live) > 0 {
+		if _, err := embeddings.Ingest(ctx, embedder, job.Tenant, r.indexer.vectors, job.Target, live); err != nil {
+			return err
+		}
+	}
+	if len(deleted) > 0 {
+		if _, err := r.indexer.vectors.DeleteVectors(job.Target, deleted); err != nil {
+			return fmt.Errorf("error deleting documents from %s: %v", job.Target, err)
+		}
+	}
+	return nil
+}
+
+// checkActive stops a job that was aborted by another process.
+func (r *Reindexer) checkActive(ctx context.Context, job *Job) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	active, err := r.indexer.store.ActiveJob(ctx, job.Alias)
+	if err != nil {
+		return err
+	}
+	if active == nil || active.ID != job.ID {
+		return kerrors.Errorf(kerrors.Conflict, "%s is no longer backfilling", job)
+	}
+	return nil
+}
+
+func (r *Reindexer) fail(job *Job, cause error) {
+	job.State, job.Error, job.UpdatedAt = JobFailed, cause.Error(), time.Now().UTC()
+	if err := r.indexer.store.UpdateJob(context.Background(), job); err != nil {
+		vectorindexLogger.Printf("Error failing %s: %v", job, err)
+	}
+	if _, err := r.indexer.vectors.DeleteIndex(job.Target); err != nil {
+		vectorindexLogger.Printf("Error deleting index %s of failed %s: %v", job.Target, job, err)
+	}
+	vectorindexLogger.Printf("Failed %s: %v", job, cause)
+}
+
+// Abort stops the job backfilling an index of the tenant and deletes the
+// index it was building. The alias keeps pointing at the current index.
+func (r *Reindexer) Abort(ctx context.Context, tenant tenancy.Tenant, index string) (*Job, error) {
+	job, err := r.indexer.store.ActiveJob(ctx, tenant.IndexName(index))
+	if err != nil {
+		return nil, err
+	}
+	if job == nil {
+		return nil, kerrors.Errorf(kerrors.NotFound, "%s is not being reindexed", tenant.IndexName(index))
+	}
+	job.State, job.UpdatedAt = JobAborted, time.Now().UTC()
+	if err := r.indexer.store.UpdateJob(ctx, job); err != nil {
+		return nil, err
+	}
+	if _, err := r.indexer.vectors.DeleteIndex(job.Target); err != nil {
+		return job, fmt.Errorf("error deleting index %s: %v", job.Target, err)
+	}
+	vectorindexLogger.Printf("Aborted %s", job)
+	return job, nil
+}
@@ -0,0 +1,522 @@
+package vectorindex
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/spectrumwebco/agent_runtime/backend/core/embeddings"
+	"github.com/spectrumwebco/agent_runtime/backend/core/kerrors"
+	"github.com/spectrumwebco/agent_runtime/backend/core/tenancy"
+	"github.com/spectrumwebco/agent_runtime/backend/db/integrations"
+)
+
+type MemoryStore struct {
+	documents map[string]map[string]Record
+	aliases   map[string]Alias
+	jobs      []*Job
+	mu        sync.Mutex
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		documents: make(map[string]map[string]Record),
+		aliases:   make(map[string]Alias),
+	}
+}
+
+func (s *MemoryStore) SaveDocuments(ctx context.Context, tenant tenancy.Tenant, index string, documents []embeddings.Document) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	name := tenant.IndexName(index)
+	if s.documents[name] == nil {
+		s.documents[name] = map[string]Record{}
+	}
+	now := time.Now().UTC()
+	for _, document := range documents {
+		s.documents[name][document.ID] = Record{Document: document, UpdatedAt: now}
+	}
+	return nil
+}
+
+func (s *MemoryStore) DeleteDocuments(ctx context.Context, tenant tenancy.Tenant, index string, ids []string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now().UTC()
+	for _, id := range ids {
+		if record, ok := s.documents[tenant.IndexName(index)][id]; ok {
+			record.Deleted, record.UpdatedAt = true, now
+			s.documents[tenant.IndexName(index)][id] = record
+		}
+	}
+	return nil
+}
+
+func (s *MemoryStore) Documents(ctx context.Context, tenant tenancy.Tenant, index, after string, since time.Time, limit int) ([]Record, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	records := []Record{}
+	for id, record := range s.documents[tenant.IndexName(index)] {
+		if id <= after {
+			continue
+		}
+		if since.IsZero() && record.Deleted || !since.IsZero() && !record.UpdatedAt.After(since) {
+			continue
+		}
+		records = append(records, record)
+	}
+	sort.Slice(records, func(i, j int) bool {
+		return records[i].ID < records[j].ID
+	})
+	if len(records) > limit {
+		records = records[:limit]
+	}
+	return records, nil
+}
+
+func (s *MemoryStore) CountDocuments(ctx context.Context, tenant tenancy.Tenant, index string) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	count := 0
+	for _, record := range s.documents[tenant.IndexName(index)] {
+		if !record.Deleted {
+			count++
+		}
+	}
+	return count, nil
+}
+
+func (s *MemoryStore) Alias(ctx context.Context, name string) (*Alias, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	alias, ok := s.aliases[name]
+	if !ok {
+		return &Alias{Name: name, Index: name}, nil
+	}
+	return &alias, nil
+}
+
+func (s *MemoryStore) Aliases(ctx context.Context) ([]Alias, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	aliases := make([]Alias, 0, len(s.aliases))
+	for _, alias := range s.aliases {
+		aliases = append(aliases, alias)
+	}
+	sort.Slice(aliases, func(i, j int) bool {
+		return aliases[i].Name < aliases[j].Name
+	})
+	return aliases, nil
+}
+
+func (s *MemoryStore) SwapAlias(ctx context.Context, name, from, to, model string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	current := name
+	if alias, ok := s.aliases[name]; ok {
+		current = alias.Index
+	}
+	if current != from {
+		return kerrors.Errorf(kerrors.Conflict, "alias %s points at %s, not %s", name, current, from)
+	}
+	s.aliases[name] = Alias{Name: name, Index: to, Model: model, UpdatedAt: time.Now().UTC()}
+	return nil
+}
+
+func (s *MemoryStore) CreateJob(ctx context.Context, job *Job) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, existing := range s.jobs {
+		if existing.Alias == job.Alias && existing.State == JobBackfilling {
+			return kerrors.Errorf(kerrors.Conflict, "%s is already being reindexed by job %d", job.Alias, existing.ID)
+		}
+	}
+	job.ID = int64(len(s.jobs) + 1)
+	copied := *job
+	s.jobs = append(s.jobs, &copied)
+	return nil
+}
+
+func (s *MemoryStore) UpdateJob(ctx context.Context, job *Job) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if job.ID < 1 || job.ID > int64(len(s.jobs)) {
+		return kerrors.Errorf(kerrors.NotFound, "reindex job %d not found", job.ID)
+	}
+	copied := *job
+	s.jobs[job.ID-1] = &copied
+	return nil
+}
+
+func (s *MemoryStore) ActiveJob(ctx context.Context, alias string) (*Job, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, job := range s.jobs {
+		if job.Alias == alias && job.State == JobBackfilling {
+			copied := *job
+			return &copied, nil
+		}
+	}
+	return nil, nil
+}
+
+func (s *MemoryStore) Jobs(ctx context.Context, alias string) ([]*Job, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	jobs := []*Job{}
+	for i := len(s.jobs) - 1; i >= 0; i-- {
+		if alias == "" || s.jobs[i].Alias == alias {
+			copied := *s.jobs[i]
+			jobs = append(jobs, &copied)
+		}
+	}
+	return jobs, nil
+}
+
+// PostgresStore keeps documents in app_vector_document, aliases in
+// app_vector_alias and jobs in app_vector_reindex.
+type PostgresStore struct {
+	client integrations.SQLStore
+}
+
+func NewPostgresStore(client integrations.SQLStore) *PostgresStore {
+	return &PostgresStore{client: client}
+}
+
+func (s *PostgresStore) EnsureSchema() error {
+	_, err := s.client.ExecuteUpdate(`
+		CREATE TABLE IF NOT EXISTS app_vector_document (
+			index_name VARCHAR(255) NOT NULL,
+			id VARCHAR(255) NOT NULL,
+			text TEXT NOT NULL,
+			metadata JSONB NOT NULL DEFAULT '{}',
+			deleted BOOLEAN NOT NULL DEFAULT false,
+			updated_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+			PRIMARY KEY (index_name, id)
+		);
+		CREATE INDEX IF NOT EXISTS app_vector_document_updated ON app_vector_document (index_name, updated_at);
+		CREATE TABLE IF NOT EXISTS app_vector_alias (
+			name VARCHAR(255) PRIMARY KEY,
+			index_name VARCHAR(255) NOT NULL,
+			model VARCHAR(255) NOT NULL DEFAULT '',
+			updated_at TIMESTAMPTZ NOT NULL DEFAULT now()
+		);
+		CREATE TABLE IF NOT EXISTS app_vector_reindex (
+			id BIGSERIAL PRIMARY KEY,
+			alias VARCHAR(255) NOT NULL,
+			organization_id VARCHAR(255) NOT NULL,
+			project_id VARCHAR(255) NOT NULL,
+			index_name VARCHAR(255) NOT NULL,
+			source VARCHAR(255) NOT NULL,
+			target VARCHAR(255) NOT NULL,
+			dimension INTEGER NOT NULL,
+			metric VARCHAR(32) NOT NULL,
+			model VARCHAR(255) NOT NULL DEFAULT '',
+			state VARCHAR(32) NOT NULL,
+			total INTEGER NOT NULL DEFAULT 0,
+			done INTEGER NOT NULL DEFAULT 0,
+			cursor VARCHAR(255) NOT NULL DEFAULT '',
+			error TEXT NOT NULL DEFAULT '',
+			created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+			updated_at TIMESTAMPTZ NOT NULL DEFAULT now()
+		);
+		CREATE UNIQUE INDEX IF NOT EXISTS app_vector_reindex_active ON app_vector_reindex (alias) WHERE state = 'backfilling'
+	`)
+	if err != nil {
+		return fmt.Errorf("error creating vector index tables: %v", err)
+	}
+	return nil
+}
+
+// SaveDocuments upserts each document; the batches of an ingest are small
+// enough that a statement per document is fine.
+func (s *PostgresStore) SaveDocuments(ctx context.Context, tenant tenancy.Tenant, index string, documents []embeddings.Document) error {
+	now := time.Now().UTC()
+	for _, document := range documents {
+		metadata, err := json.Marshal(document.Metadata)
+		if err != nil {
+			return err
+		}
+		if document.Metadata == nil {
+			metadata = []byte("{}")
+		}
+		_, err = s.client.ExecuteUpdate(`
+			INSERT INTO app_vector_document (index_name, id, text, metadata, deleted, updated_at) VALUES ($1, $2, $3, $4, false, $5)
+			ON CONFLICT (index_name, id) DO UPDATE SET text = EXCLUDED.text, metadata = EXCLUDED.metadata, deleted = false, updated_at = EXCLUDED.updated_at`,
+			tenant.IndexName(index), document.ID, document.Text, string(metadata), now,
+		)
+		if err != nil {
+			return fmt.Errorf("error saving document %s of %s: %v", document.ID, index, err)
+		}
+	}
+	return nil
+}
+
+func (s *PostgresStore) DeleteDocuments(ctx context.Context, tenant tenancy.Tenant, index string, ids []string) error {
+	for _, id := range ids {
+		_, err := s.client.ExecuteUpdate(
+			`UPDATE app_vector_document SET deleted = true, updated_at = $3 WHERE index_name = $1 AND id = $2`,
+			tenant.IndexName(index), id, time.Now().UTC(),
+		)
+		if err != nil {
+			return fmt.Errorf("error deleting document %s of %s: %v", id, index, err)
+		}
+	}
+	return nil
+}
+
+func (s *PostgresStore) Documents(ctx context.Context, tenant tenancy.Tenant, index, after string, since time.Time, limit int) ([]Record, error) {
+	query := `SELECT id, text, metadata, deleted, updated_at FROM app_vector_document WHERE index_name = $1 AND id > $2 AND NOT deleted ORDER BY id LIMIT $3`
+	params := []interface{}{tenant.IndexName(index), after, limit}
+	if !since.IsZero() {
+		query = `SELECT id, text, metadata, deleted, updated_at FROM app_vector_document WHERE index_name = $1 AND id > $2 AND updated_at > $4 ORDER BY id LIMIT $3`
+		params = append(params, since.UTC())
+	}
+	rows, err := s.client.ExecuteQuery(query, params...)
+	if err != nil {
+		return nil, fmt.Errorf("error loading documents of %s: %v", index, err)
+	}
+
+	records := make([]Record, 0, len(rows))
+	for _, row := range rows {
+		record := Record{
+			Document: embeddings.Document{ID: toString(row["id"]), Text: toString(row["text"])},
+			Deleted:  toString(row["deleted"]) == "true",
+		}
+		if updatedAt, ok := row["updated_at"].(time.Time); ok {
+			record.UpdatedAt = updatedAt.UTC()
+		}
+		if metadata := toString(row["metadata"]); metadata != "" {
+			if err := json.Unmarshal([]byte(metadata), &record.Metadata); err != nil {
+				return nil, fmt.Errorf("error decoding metadata of document %s of %s: %v", record.ID, index, err)
+			}
+		}
+		records = append(records, record)
+	}
+	return records, nil
+}
+
+func (s *PostgresStore) CountDocuments(ctx context.Context, tenant tenancy.Tenant, index string) (int, error) {
+	rows, err := s.client.ExecuteQuery(
+		`SELECT COUNT(*) AS count FROM app_vector_document WHERE index_name = $1 AND NOT deleted`, tenant.IndexName(index),
+	)
+	if err != nil {
+		return 0, fmt.Errorf("error counting documents of %s: %v", index, err)
+	}
+	if len(rows) == 0 {
+		return 0, nil
+	}
+	return toInt(rows[0]["count"]), nil
+}
+
+func (s *PostgresStore) Alias(ctx context.Context, name string) (*Alias, error) {
+	rows, err := s.client.ExecuteQuery(`SELECT name, index_name, model, updated_at FROM app_vector_alias WHERE name = $1`, name)
+	if err != nil {
+		return nil, fmt.Errorf("error loading alias %s: %v", name, err)
+	}
+	if len(rows) == 0 {
+		return &Alias{Name: name, Index: name}, nil
+	}
+	return aliasFromRow(rows[0]), nil
+}
+
+func (s *PostgresStore) Aliases(ctx context.Context) ([]Alias, error) {
+	rows, err := s.client.ExecuteQuery(`SELECT name, index_name, model, updated_at FROM app_vector_alias ORDER BY name`)
+	if err != nil {
+		return nil, fmt.Errorf("error loading aliases: %v", err)
+	}
+	aliases := make([]Alias, 0, len(rows))
+	for _, row := range rows {
+		aliases = append(aliases, *aliasFromRow(row))
+	}
+	return aliases, nil
+}
+
+// SwapAlias compares and swaps in one statement. An alias without a row
+// points at the index of its name, so the first swap inserts the row.
+func (s *PostgresStore) SwapAlias(ctx context.Context, name, from, to, model string) error {
+	rows, err := s.client.ExecuteQuery(`
+		INSERT INTO app_vector_alias (name, index_name, model, updated_at)
+		SELECT $1, $3, $4, $5 WHERE $1 = $2
+		ON CONFLICT (name) DO UPDATE SET index_name = EXCLUDED.index_name, model = EXCLUDED.model, updated_at = EXCLUDED.updated_at
+		WHERE app_vector_alias.index_name = $2
+		RETURNING name`,
+		name, from, to, model, time.Now().UTC(),
+	)
+	if err != nil {
+		return fmt.Errorf("error swapping alias %s: %v", name, err)
+	}
+	if len(rows) > 0 {
+		return nil
+	}
+	// from is not the name, so the insert was skipped; the alias must
+	// exist and point at from
+	rows, err = s.client.ExecuteQuery(`
+		UPDATE app_vector_alias SET index_name = $3, model = $4, updated_at = $5
+		WHERE name = $1 AND index_name = $2
+		RETURNING name`,
+		name, from, to, model, time.Now().UTC(),
+	)
+	if err != nil {
+		return fmt.Errorf("error swapping alias %s: %v", name, err)
+	}
+	if len(rows) == 0 {
+		return kerrors.Errorf(kerrors.Conflict, "alias %s no longer points at %s", name, from)
+	}
+	return nil
+}
+
+const jobColumns = `id, alias, organization_id, project_id, index_name, source, target, dimension, metric, model, state, total, done, cursor, error, created_at, updated_at`
+
+func (s *PostgresStore) CreateJob(ctx context.Context, job *Job) error {
+	active, err := s.ActiveJob(ctx, job.Alias)
+	if err != nil {
+		return err
+	}
+	if active != nil {
+		return kerrors.Errorf(kerrors.Conflict, "%s is already being reindexed by job %d", job.Alias, active.ID)
+	}
+	// the partial unique index rejects a job started concurrently
+	rows, err := s.client.ExecuteQuery(`
+		INSERT INTO app_vector_reindex (alias, organization_id, project_id, index_name, source, target, dimension, metric, model, state, total, done, cursor, error, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $15)
+		RETURNING id`,
+		job.Alias, job.Tenant.OrganizationID, job.Tenant.ProjectID, job.Index, job.Source, job.Target,
+		job.Dimension, job.Metric, job.Model, job.State, job.Total, job.Done, job.Cursor, job.Error, job.CreatedAt.UTC(),
+	)
+	if err != nil {
+		return fmt.Errorf("error creating reindex job of %s: %v", job.Alias, err)
+	}
+	if len(rows) == 0 {
+		return fmt.Errorf("error creating reindex job of %s: no id returned", job.Alias)
+	}
+	job.ID = int64(toInt(rows[0]["id"]))
+	return nil
+}
+
+func (s *PostgresStore) UpdateJob(ctx context.Context, job *Job) error {
+	updated, err := s.client.ExecuteUpdate(`
+		UPDATE app_vector_reindex SET state = $2, total = $3, done = $4, cursor = $5, error = $6, updated_at = $7
+		WHERE id = $1`,
+		job.ID, job.State, job.Total, job.Done, job.Cursor, job.Error, job.UpdatedAt.UTC(),
+	)
+	if err != nil {
+		return fmt.Errorf("error updating reindex job %d: %v", job.ID, err)
+	}
+	if updated == 0 {
+		return kerrors.Errorf(kerrors.NotFound, "reindex job %d not found", job.ID)
+	}
+	return nil
+}
+
+func (s *PostgresStore) ActiveJob(ctx context.Context, alias string) (*Job, error) {
+	rows, err := s.client.ExecuteQuery(
+		`SELECT `+jobColumns+` FROM app_vector_reindex WHERE alias = $1 AND state = $2`, alias, JobBackfilling,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("error loading reindex job of %s: %v", alias, err)
+	}
+	if len(rows) == 0 {
+		return nil, nil
+	}
+	return jobFromRow(rows[0]), nil
+}
+
+func (s *PostgresStore) Jobs(ctx context.Context, alias string) ([]*Job, error) {
+	rows, err := s.client.ExecuteQuery(`SELECT `+jobColumns+` FROM app_vector_reindex WHERE $1 = '' OR alias = $1 ORDER BY id DESC`, alias)
+	if err != nil {
+		return nil, fmt.Errorf("error loading reindex jobs of %s: %v", alias, err)
+	}
+	jobs := make([]*Job, 0, len(rows))
+	for _, row := range rows {
+		jobs = append(jobs, jobFromRow(row))
+	}
+	return jobs, nil
+}
+
+// ConfigureDefault returns the store holding the documents and aliases of
+// vector indexes. If their tables cannot be created they are kept in memory,
+// so indexes have to be rebuilt from their sources after a restart.
+func ConfigureDefault(client integrations.SQLStore) Store {
+	store := NewPostgresStore(client)
+	if err := store.EnsureSchema(); err != nil {
+		vectorindexLogger.Printf("Vector indexes falling back to in-memory store: %v", err)
+		return NewMemoryStore()
+	}
+	return store
+}
+
+func aliasFromRow(row map[string]interface{}) *Alias {
+	alias := &Alias{Name: toString(row["name"]), Index: toString(row["index_name"]), Model: toString(row["model"])}
+	if updatedAt, ok := row["updated_at"].(time.Time); ok {
+		alias.UpdatedAt = updatedAt.UTC()
+	}
+	return alias
+}
+
+func jobFromRow(row map[string]interface{}) *Job {
+	job := &Job{
+		ID:        int64(toInt(row["id"])),
+		Alias:     toString(row["alias"]),
+		Tenant:    tenancy.Tenant{OrganizationID: toString(row["organization_id"]), ProjectID: toString(row["project_id"])},
+		Index:     toString(row["index_name"]),
+		Source:    toString(row["source"]),
+		Target:    toString(row["target"]),
+		Dimension: toInt(row["dimension"]),
+		Metric:    toString(row["metric"]),
+		Model:     toString(row["model"]),
+		State:     toString(row["state"]),
+		Total:     toInt(row["total"]),
+		Done:      toInt(row["done"]),
+		Cursor:    toString(row["cursor"]),
+		Error:     toString(row["error"]),
+	}
+	if createdAt, ok := row["created_at"].(time.Time); ok {
+		job.CreatedAt = createdAt.UTC()
+	}
+	if updatedAt, ok := row["updated_at"].(time.Time); ok {
+		job.UpdatedAt = updatedAt.UTC()
+	}
+	return job
+}
+
+func toString(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case []byte:
+		return string(v)
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+func toInt(value interface{}) int {
+	switch v := value.(type) {
+	case int64:
+		return int(v)
+	case int32:
+		return int(v)
+	case int:
+		return v
+	case float64:
+		return int(v)
+	}
+	var n int
+	fmt.Sscan(toString(value), &n)
+	return n
+}
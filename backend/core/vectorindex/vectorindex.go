@@ -0,0 +1,126 @@
+// Package vectorindex keeps the RAGflow indexes rebuildable.
+//
+// Ingested documents are recorded in a Store, the source of truth the
+// indexes are derived from. Application code addresses an index by its
+// alias, which points at the physical index holding the vectors and names
+// the embedding model they were made with. Reindexing builds a new physical
+// index next to the current one: it is created with the new dimension,
+// metric or model, backfilled from the Store while ingests are written to
+// both indexes, and then the alias is swapped, so searches switch over at
+// once.
+package vectorindex
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/spectrumwebco/agent_runtime/backend/core/embeddings"
+	"github.com/spectrumwebco/agent_runtime/backend/core/tenancy"
+)
+
+var vectorindexLogger = log.New(os.Stdout, "kled.vectorindex: ", log.LstdFlags)
+
+// Record is a document as kept in the Store.
+type Record struct {
+	embeddings.Document
+	// Deleted records are kept so a backfill sees documents deleted while
+	// it ran.
+	Deleted   bool      `json:"deleted,omitempty"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// Alias points the name application code uses at a physical index.
+type Alias struct {
+	Name  string `json:"name"`
+	Index string `json:"index"`
+	// Model is the embedding model of the index, empty for the default
+	// model of the process.
+	Model     string    `json:"model,omitempty"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+const (
+	JobBackfilling = "backfilling"
+	JobCompleted   = "completed"
+	JobFailed      = "failed"
+	JobAborted     = "aborted"
+)
+
+// Job is a reindex of an alias.
+type Job struct {
+	ID     int64          `json:"id"`
+	Alias  string         `json:"alias"`
+	Tenant tenancy.Tenant `json:"tenant"`
+	// Index is the name the tenant knows the index by.
+	Index string `json:"index"`
+	// Source is the physical index the alias pointed at when the job
+	// started, Target the one it is built into.
+	Source    string `json:"source"`
+	Target    string `json:"target"`
+	Dimension int    `json:"dimension"`
+	Metric    string `json:"metric"`
+	Model     string `json:"model,omitempty"`
+	State     string `json:"state"`
+	// Total is the number of documents when the backfill started, Done
+	// the number copied so far.
+	Total int `json:"total"`
+	Done  int `json:"done"`
+	// Cursor is the ID of the last document copied; a resumed backfill
+	// continues after it.
+	Cursor    string    `json:"cursor,omitempty"`
+	Error     string    `json:"error,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// Progress returns the share of the documents copied, from 0 to 1.
+func (j *Job) Progress() float64 {
+	if j.State == JobCompleted || j.Total == 0 {
+		return 1
+	}
+	if j.Done >= j.Total {
+		return 1
+	}
+	return float64(j.Done) / float64(j.Total)
+}
+
+func (j *Job) String() string {
+	return fmt.Sprintf("reindex %d of %s into %s", j.ID, j.Alias, j.Target)
+}
+
+// Store keeps the documents, aliases and reindex jobs.
+type Store interface {
+	// SaveDocuments inserts or replaces documents of an index.
+	SaveDocuments(ctx context.Context, tenant tenancy.Tenant, index string, documents []embeddings.Document) error
+	// DeleteDocuments marks documents of an index as deleted.
+	DeleteDocuments(ctx context.Context, tenant tenancy.Tenant, index string, ids []string) error
+	// Documents returns up to limit documents of an index with an ID
+	// after the given one, by ID. With a zero since it returns the live
+	// documents, otherwise the documents changed or deleted after since.
+	Documents(ctx context.Context, tenant tenancy.Tenant, index, after string, since time.Time, limit int) ([]Record, error)
+	// CountDocuments returns the number of live documents of an index.
+	CountDocuments(ctx context.Context, tenant tenancy.Tenant, index string) (int, error)
+
+	// Alias returns an alias. Indexes created before aliases existed have
+	// none; they are returned as an alias pointing at the index of the
+	// same name.
+	Alias(ctx context.Context, name string) (*Alias, error)
+	// Aliases returns the aliases that were swapped at least once.
+	Aliases(ctx context.Context) ([]Alias, error)
+	// SwapAlias points an alias at another index if it still points at
+	// from, or fails with a Conflict.
+	SwapAlias(ctx context.Context, name, from, to, model string) error
+
+	// CreateJob stores a new job and sets its ID. It fails with a Conflict
+	// when the alias already has a job backfilling.
+	CreateJob(ctx context.Context, job *Job) error
+	UpdateJob(ctx context.Context, job *Job) error
+	// ActiveJob returns the job backfilling an alias, or nil.
+	ActiveJob(ctx context.Context, alias string) (*Job, error)
+	// Jobs returns the jobs of an alias, or of every alias for an empty
+	// alias, newest first.
+	Jobs(ctx context.Context, alias string) ([]*Job, error)
+}
@@ -0,0 +1,240 @@
+package vectorindex
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/spectrumwebco/agent_runtime/backend/core/embeddings"
+	"github.com/spectrumwebco/agent_runtime/backend/core/kerrors"
+	"github.com/spectrumwebco/agent_runtime/backend/core/querycache"
+	"github.com/spectrumwebco/agent_runtime/backend/core/tenancy"
+	"github.com/spectrumwebco/agent_runtime/backend/db/integrations/integrationsmock"
+)
+
+// sizedEmbedder embeds a text as a vector of its length, repeated to the
+// dimension of its model.
+type sizedEmbedder struct {
+	model     string
+	dimension int
+}
+
+func (e *sizedEmbedder) Model() string { return e.model }
+
+func (e *sizedEmbedder) Embed(ctx context.Context, tenant tenancy.Tenant, texts []string) ([][]float64, error) {
+	vectors := make([][]float64, len(texts))
+	for i, text := range texts {
+		vectors[i] = make([]float64, e.dimension)
+		for j := range vectors[i] {
+			vectors[i][j] = float64(len(text))
+		}
+	}
+	return vectors, nil
+}
+
+var acme = tenancy.Tenant{OrganizationID: "acme", ProjectID: "default"}
+
+func newTestIndexer(t *testing.T) (*Indexer, *integrationsmock.VectorStore) {
+	t.Helper()
+	vectors := integrationsmock.NewVectorStore()
+	if _, err := vectors.CreateIndex(acme.IndexName("docs"), 2, "cosine"); err != nil {
+		t.Fatal(err)
+	}
+	embedders := map[string]embeddings.Embedder{
+		"":      &sizedEmbedder{model: "small", dimension: 2},
+		"large": &sizedEmbedder{model: "large", dimension: 4},
+	}
+	return NewIndexer(NewMemoryStore(), vectors, func(model string) embeddings.Embedder {
+		return embedders[model]
+	}), vectors
+}
+
+func documents(ids ...string) []embeddings.Document {
+	var result []embeddings.Document
+	for _, id := range ids {
+		result = append(result, embeddings.Document{ID: id, Text: "text of " + id})
+	}
+	return result
+}
+
+func TestReindexSwapsAliasAfterBackfill(t *testing.T) {
+	ctx := context.Background()
+	indexer, vectors := newTestIndexer(t)
+	if _, _, err := indexer.Ingest(ctx, acme, "docs", documents("a", "b", "c", "d", "e")); err != nil {
+		t.Fatal(err)
+	}
+
+	reindexer := NewReindexer(indexer, 2)
+	job, err := reindexer.Start(ctx, Spec{Tenant: acme, Index: "docs", Dimension: 4, Model: "large"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if job.Source != "acme_default__docs" || job.Target != "acme_default__docs_v2" || job.Total != 5 {
+		t.Fatalf("unexpected job %+v", job)
+	}
+	if _, err := reindexer.Start(ctx, Spec{Tenant: acme, Index: "docs"}); kerrors.CodeOf(err) != kerrors.Conflict {
+		t.Errorf("expected a second job to conflict, got %v", err)
+	}
+
+	// writes during the backfill go to both indexes, with the model of each
+	if _, _, err := indexer.Ingest(ctx, acme, "docs", documents("f")); err != nil {
+		t.Fatal(err)
+	}
+	if err := indexer.Delete(ctx, acme, "docs", []string{"a"}); err != nil {
+		t.Fatal(err)
+	}
+	if vector, err := vectors.GetVector(job.Target, "f"); err != nil || len(vector["vector"].([]float64)) != 4 {
+		t.Fatalf("expected f to be written to the new index, got %v (%v)", vector, err)
+	}
+
+	var reported []int
+	if err := reindexer.Run(ctx, job, func(job *Job) { reported = append(reported, job.Done) }); err != nil {
+		t.Fatal(err)
+	}
+	if len(reported) != 3 || reported[2] != 5 || job.State != JobCompleted {
+		t.Errorf("unexpected progress %v of %+v", reported, job)
+	}
+
+	alias, err := indexer.Resolve(ctx, acme, "docs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if alias.Index != job.Target || alias.Model != "large" {
+		t.Errorf("expected the alias to point at the new index, got %+v", alias)
+	}
+	for _, id := range []string{"b", "c", "d", "e", "f"} {
+		if _, err := vectors.GetVector(job.Target, id); err != nil {
+			t.Errorf("expected %s in the new index: %v", id, err)
+		}
+	}
+	if _, err := vectors.GetVector(job.Target, "a"); err == nil {
+		t.Errorf("expected the deleted document to stay deleted")
+	}
+
+	// once swapped, writes go to the new index only
+	_, model, err := indexer.Ingest(ctx, acme, "docs", documents("g"))
+	if err != nil || model != "large" {
+		t.Fatalf("expected g to be embedded with the new model, got %s (%v)", model, err)
+	}
+	if _, err := vectors.GetVector(job.Source, "g"); err == nil {
+		t.Errorf("expected g not to be written to the old index")
+	}
+}
+
+func TestReindexResumesAfterCursor(t *testing.T) {
+	ctx := context.Background()
+	indexer, vectors := newTestIndexer(t)
+	if _, _, err := indexer.Ingest(ctx, acme, "docs", documents("a", "b", "c")); err != nil {
+		t.Fatal(err)
+	}
+
+	reindexer := NewReindexer(indexer, 1)
+	job, err := reindexer.Start(ctx, Spec{Tenant: acme, Index: "docs", Dimension: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cancelled, cancel := context.WithCancel(ctx)
+	err = reindexer.Run(cancelled, job, func(*Job) { cancel() })
+	if err == nil || job.State != JobBackfilling || job.Cursor != "a" {
+		t.Fatalf("expected the job to stop after the first batch, got %+v (%v)", job, err)
+	}
+
+	active, err := indexer.Store().ActiveJob(ctx, job.Alias)
+	if err != nil || active == nil {
+		t.Fatalf("expected the job to stay active, got %v (%v)", active, err)
+	}
+	if err := reindexer.Run(ctx, active, nil); err != nil {
+		t.Fatal(err)
+	}
+	if active.Done != 3 || active.State != JobCompleted {
+		t.Errorf("unexpected job %+v", active)
+	}
+	indexes, _ := vectors.ListIndexes()
+	if strings.Join(indexes, ",") != "acme_default__docs,acme_default__docs_v2" {
+		t.Errorf("unexpected indexes %v", indexes)
+	}
+}
+
+func TestAbortDeletesNewIndex(t *testing.T) {
+	ctx := context.Background()
+	indexer, vectors := newTestIndexer(t)
+	reindexer := NewReindexer(indexer, 0)
+	job, err := reindexer.Start(ctx, Spec{Tenant: acme, Index: "docs"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := reindexer.Abort(ctx, acme, "docs"); err != nil {
+		t.Fatal(err)
+	}
+	if err := reindexer.Run(ctx, job, nil); kerrors.CodeOf(err) != kerrors.Conflict {
+		t.Errorf("expected the aborted job to stop, got %v", err)
+	}
+	if indexes, _ := vectors.ListIndexes(); len(indexes) != 1 {
+		t.Errorf("expected the new index to be deleted, got %v", indexes)
+	}
+	alias, _ := indexer.Resolve(ctx, acme, "docs")
+	if alias.Index != "acme_default__docs" {
+		t.Errorf("expected the alias to be unchanged, got %+v", alias)
+	}
+}
+
+func TestAliasResolverHidesReindexedIndexes(t *testing.T) {
+	ctx := context.Background()
+	indexer, _ := newTestIndexer(t)
+	reindexer := NewReindexer(indexer, 0)
+	resolver := NewAliasResolver(indexer.Store(), time.Hour)
+
+	job, err := reindexer.Start(ctx, Spec{Tenant: acme, Index: "docs", Dimension: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	logical, err := resolver.LogicalIndexes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if logical["acme_default__docs"] != "acme_default__docs" || logical[job.Target] != "" {
+		t.Errorf("expected the index being built to be hidden, got %v", logical)
+	}
+
+	if err := reindexer.Run(ctx, job, nil); err != nil {
+		t.Fatal(err)
+	}
+	if physical, _ := resolver.ResolveIndex("acme_default__docs"); physical != "acme_default__docs" {
+		t.Errorf("expected the cached alias until invalidated, got %s", physical)
+	}
+	resolver.Invalidate()
+	if physical, _ := resolver.ResolveIndex("acme_default__docs"); physical != job.Target {
+		t.Errorf("expected the alias to resolve to %s, got %s", job.Target, physical)
+	}
+	logical, _ = resolver.LogicalIndexes()
+	if logical[job.Target] != "acme_default__docs" || logical["acme_default__docs"] != "" {
+		t.Errorf("expected the new index to be listed under the alias, got %v", logical)
+	}
+}
+
+func TestSearchCacheInvalidatedByWrites(t *testing.T) {
+	ctx := context.Background()
+	indexer, _ := newTestIndexer(t)
+	indexer.SetCache(querycache.NewCache(integrationsmock.NewKVStore(), time.Hour))
+	if _, _, err := indexer.Ingest(ctx, acme, "docs", documents("a")); err != nil {
+		t.Fatal(err)
+	}
+	if results, err := indexer.Search(ctx, acme, "docs", "query", 10, nil); err != nil || len(results) != 1 {
+		t.Fatalf("unexpected results %v (%v)", results, err)
+	}
+
+	if _, _, err := indexer.Ingest(ctx, acme, "docs", documents("b")); err != nil {
+		t.Fatal(err)
+	}
+	if results, _ := indexer.Search(ctx, acme, "docs", "Query?", 10, nil); len(results) != 2 {
+		t.Errorf("expected the ingest to invalidate the cached results, got %v", results)
+	}
+	if err := indexer.Delete(ctx, acme, "docs", []string{"a"}); err != nil {
+		t.Fatal(err)
+	}
+	if results, _ := indexer.Search(ctx, acme, "docs", "query", 10, nil); len(results) != 1 {
+		t.Errorf("expected the delete to invalidate the cached results, got %v", results)
+	}
+}
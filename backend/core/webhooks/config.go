@@ -0,0 +1,81 @@
+package webhooks
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/spectrumwebco/agent_runtime/backend/core/config/env"
+)
+
+type Config struct {
+	// MaxAttempts is how often a delivery is attempted before it becomes a
+	// dead letter.
+	MaxAttempts int `json:"max_attempts"`
+	// InitialBackoff is the delay before the first retry. Every further
+	// retry waits twice as long, up to MaxBackoff.
+	InitialBackoff time.Duration `json:"initial_backoff"`
+	MaxBackoff     time.Duration `json:"max_backoff"`
+	// Timeout bounds a single attempt.
+	Timeout time.Duration `json:"timeout"`
+	// PollInterval is how often the dispatcher looks for due deliveries
+	// when it isn't woken by new events.
+	PollInterval time.Duration `json:"poll_interval"`
+	// AllowHTTP accepts endpoints with plain HTTP URLs, for development.
+	AllowHTTP bool `json:"allow_http"`
+}
+
+const (
+	DefaultMaxAttempts    = 8
+	DefaultInitialBackoff = 30 * time.Second
+	DefaultMaxBackoff     = 6 * time.Hour
+	DefaultTimeout        = 10 * time.Second
+	DefaultPollInterval   = 5 * time.Second
+)
+
+func DefaultConfig() Config {
+	return Config{
+		MaxAttempts:    DefaultMaxAttempts,
+		InitialBackoff: DefaultInitialBackoff,
+		MaxBackoff:     DefaultMaxBackoff,
+		Timeout:        DefaultTimeout,
+		PollInterval:   DefaultPollInterval,
+	}
+}
+
+var Default = env.Once(FromEnv)
+
+func FromEnv() Config {
+	config := DefaultConfig()
+	read := env.NewReader(webhooksLogger)
+	read.Bool("AGENT_WEBHOOKS_ALLOW_HTTP", &config.AllowHTTP)
+	read.Int("AGENT_WEBHOOKS_MAX_ATTEMPTS", &config.MaxAttempts, 1)
+	read.PositiveDuration("AGENT_WEBHOOKS_INITIAL_BACKOFF", &config.InitialBackoff)
+	read.PositiveDuration("AGENT_WEBHOOKS_MAX_BACKOFF", &config.MaxBackoff)
+	read.PositiveDuration("AGENT_WEBHOOKS_TIMEOUT", &config.Timeout)
+	read.PositiveDuration("AGENT_WEBHOOKS_POLL_INTERVAL", &config.PollInterval)
+	return config
+}
+
+// Variables returns the variables FromEnv reads c from.
+func (c Config) Variables() map[string]string {
+	return map[string]string{
+		"AGENT_WEBHOOKS_ALLOW_HTTP":      strconv.FormatBool(c.AllowHTTP),
+		"AGENT_WEBHOOKS_MAX_ATTEMPTS":    strconv.Itoa(c.MaxAttempts),
+		"AGENT_WEBHOOKS_INITIAL_BACKOFF": c.InitialBackoff.String(),
+		"AGENT_WEBHOOKS_MAX_BACKOFF":     c.MaxBackoff.String(),
+		"AGENT_WEBHOOKS_TIMEOUT":         c.Timeout.String(),
+		"AGENT_WEBHOOKS_POLL_INTERVAL":   c.PollInterval.String(),
+	}
+}
+
+// Backoff returns the delay after the given failed attempt, counting from 1.
+func (c Config) Backoff(attempt int) time.Duration {
+	delay := c.InitialBackoff
+	for i := 1; i < attempt && delay < c.MaxBackoff; i++ {
+		delay *= 2
+	}
+	if delay > c.MaxBackoff {
+		delay = c.MaxBackoff
+	}
+	return delay
+}
@@ -0,0 +1,317 @@
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/spectrumwebco/agent_runtime/backend/core/events"
+	"github.com/spectrumwebco/agent_runtime/backend/core/outbound"
+	"github.com/spectrumwebco/agent_runtime/backend/db/integrations"
+)
+
+var (
+	attemptsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "kled_webhook_attempts_total",
+		Help: "Webhook delivery attempts, by outcome: succeeded, retried or dead.",
+	}, []string{"outcome"})
+	attemptDuration = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Name:    "kled_webhook_attempt_duration_seconds",
+		Help:    "Time until a webhook endpoint answered a delivery attempt.",
+		Buckets: prometheus.ExponentialBuckets(0.01, 2, 12),
+	})
+)
+
+func init() {
+	prometheus.MustRegister(attemptsTotal, attemptDuration)
+}
+
+const (
+	// claimBatch is how many due deliveries one pass attempts.
+	claimBatch = 50
+	// maxResponseError bounds the response body kept as the error of a
+	// failed attempt.
+	maxResponseError = 512
+)
+
+// Dispatcher turns events into deliveries and attempts them. Deliveries are
+// stored before they are attempted, so they survive restarts and can be
+// attempted by any replica running the dispatcher.
+type Dispatcher struct {
+	store  Store
+	client *http.Client
+	config Config
+	now    func() time.Time
+	wake   chan struct{}
+}
+
+func NewDispatcher(store Store, client *http.Client, config Config) *Dispatcher {
+	if client == nil {
+		client = &http.Client{}
+	}
+	return &Dispatcher{
+		store:  store,
+		client: client,
+		config: config,
+		now:    time.Now,
+		wake:   make(chan struct{}, 1),
+	}
+}
+
+func (d *Dispatcher) Store() Store {
+	return d.store
+}
+
+// Enqueue creates a delivery of event for every active endpoint of its
+// organization subscribed to its type, and returns how many were created.
+func (d *Dispatcher) Enqueue(ctx context.Context, event Event) (int, error) {
+	if event.OrganizationID == "" {
+		return 0, nil
+	}
+
+	endpoints, err := d.store.ListEndpoints(ctx, event.OrganizationID)
+	if err != nil {
+		return 0, err
+	}
+
+	var payload []byte
+	created := 0
+	now := d.now().UTC()
+	for _, endpoint := range endpoints {
+		if !endpoint.Active || !endpoint.Subscribed(event.Type) {
+			continue
+		}
+		if payload == nil {
+			if payload, err = json.Marshal(event); err != nil {
+				return created, fmt.Errorf("error encoding %s event: %v", event.Type, err)
+			}
+		}
+		if err := d.store.CreateDelivery(ctx, newDelivery(endpoint, event, payload, now)); err != nil {
+			return created, err
+		}
+		created++
+	}
+
+	if created > 0 {
+		select {
+		case d.wake <- struct{}{}:
+		default:
+		}
+	}
+	return created, nil
+}
+
+// Publish implements events.Publisher, so workspace lifecycle events can be
+// delivered alongside the Kafka feed.
+func (d *Dispatcher) Publish(ctx context.Context, event events.WorkspaceEvent) error {
+	webhookEvent, err := FromWorkspaceEvent(event)
+	if err != nil {
+		return err
+	}
+	_, err = d.Enqueue(ctx, webhookEvent)
+	return err
+}
+
+// Run attempts due deliveries until ctx is done.
+func (d *Dispatcher) Run(ctx context.Context) {
+	ticker := time.NewTicker(d.config.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := d.DeliverDue(ctx); err != nil && ctx.Err() == nil {
+			webhooksLogger.Printf("Error delivering webhooks: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-d.wake:
+		}
+	}
+}
+
+// DeliverDue attempts the deliveries that are due and returns how many were
+// attempted.
+func (d *Dispatcher) DeliverDue(ctx context.Context) (int, error) {
+	attempted := 0
+	for {
+		// a claim outlasts the attempt, so it isn't taken over while the
+		// endpoint is still answering
+		deliveries, err := d.store.ClaimDue(ctx, d.now().UTC(), 2*d.config.Timeout, claimBatch)
+		if err != nil {
+			return attempted, err
+		}
+		for _, delivery := range deliveries {
+			if err := ctx.Err(); err != nil {
+				return attempted, err
+			}
+			if err := d.attempt(ctx, delivery); err != nil {
+				webhooksLogger.Printf("Error recording webhook delivery %s: %v", delivery.ID, err)
+			}
+			attempted++
+		}
+		if len(deliveries) < claimBatch {
+			return attempted, nil
+		}
+	}
+}
+
+// attempt sends a delivery once and records the outcome, scheduling a retry
+// or dead-lettering it when it failed.
+func (d *Dispatcher) attempt(ctx context.Context, delivery *Delivery) error {
+	endpoint, err := d.store.GetEndpoint(ctx, delivery.EndpointID)
+	if errors.Is(err, ErrNotFound) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	delivery.Attempts++
+	if !endpoint.Active {
+		delivery.ResponseStatus, err = 0, fmt.Errorf("webhook is disabled")
+	} else {
+		delivery.ResponseStatus, err = d.send(ctx, endpoint, delivery)
+	}
+
+	now := d.now().UTC()
+	delivery.UpdatedAt = now
+	switch {
+	case err == nil:
+		delivery.Status = StatusSucceeded
+		delivery.LastError = ""
+		attemptsTotal.WithLabelValues("succeeded").Inc()
+	case delivery.Attempts >= d.config.MaxAttempts || !endpoint.Active:
+		delivery.Status = StatusDead
+		delivery.LastError = err.Error()
+		attemptsTotal.WithLabelValues("dead").Inc()
+		webhooksLogger.Printf("Dead-lettered %s delivery %s to webhook %s after %d attempts: %v", delivery.EventType, delivery.ID, endpoint.ID, delivery.Attempts, err)
+	default:
+		delivery.LastError = err.Error()
+		delivery.NextAttemptAt = now.Add(d.config.Backoff(delivery.Attempts))
+		attemptsTotal.WithLabelValues("retried").Inc()
+	}
+	return d.store.UpdateDelivery(ctx, delivery)
+}
+
+func (d *Dispatcher) send(ctx context.Context, endpoint *Endpoint, delivery *Delivery) (int, error) {
+	ctx, cancel := context.WithTimeout(ctx, d.config.Timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint.URL, bytes.NewReader(delivery.Payload))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "kled-webhooks/1")
+	req.Header.Set(HeaderID, delivery.ID)
+	req.Header.Set(HeaderEvent, delivery.EventType)
+	req.Header.Set(HeaderSignature, Sign(endpoint.Secret, d.now(), delivery.Payload))
+
+	start := time.Now()
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	attemptDuration.Observe(time.Since(start).Seconds())
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, maxResponseError))
+		return resp.StatusCode, fmt.Errorf("webhook answered %s: %s", resp.Status, bytes.TrimSpace(body))
+	}
+	io.Copy(io.Discard, io.LimitReader(resp.Body, maxResponseError))
+	return resp.StatusCode, nil
+}
+
+// Redeliver queues a delivery again with a fresh set of attempts, typically
+// a dead letter after the endpoint was fixed.
+func (d *Dispatcher) Redeliver(ctx context.Context, delivery *Delivery) error {
+	now := d.now().UTC()
+	delivery.Status = StatusPending
+	delivery.Attempts = 0
+	delivery.NextAttemptAt = now
+	delivery.UpdatedAt = now
+	if err := d.store.UpdateDelivery(ctx, delivery); err != nil {
+		return err
+	}
+
+	select {
+	case d.wake <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+var (
+	defaultDispatcher *Dispatcher
+	dispatcherMu      sync.RWMutex
+)
+
+// DefaultDispatcher returns the dispatcher installed by ConfigureDefault, or
+// nil before that.
+func DefaultDispatcher() *Dispatcher {
+	dispatcherMu.RLock()
+	defer dispatcherMu.RUnlock()
+	return defaultDispatcher
+}
+
+func SetDefaultDispatcher(dispatcher *Dispatcher) {
+	dispatcherMu.Lock()
+	defer dispatcherMu.Unlock()
+	defaultDispatcher = dispatcher
+}
+
+// ConfigureDefault installs a Postgres-backed default dispatcher that sends
+// through the outbound proxy configuration. If the webhook tables cannot be
+// created it falls back to an in-memory store, losing pending deliveries on
+// restart.
+func ConfigureDefault(client integrations.SQLStore, config Config) *Dispatcher {
+	var store Store = NewPostgresStore(client)
+	if err := store.(*PostgresStore).EnsureSchema(); err != nil {
+		webhooksLogger.Printf("Webhooks falling back to in-memory store: %v", err)
+		store = NewMemoryStore()
+	}
+
+	httpClient, err := outbound.Default().HTTPClient(config.Timeout)
+	if err != nil {
+		webhooksLogger.Printf("Error loading the outbound CA bundle: %v", err)
+	}
+
+	dispatcher := NewDispatcher(store, httpClient, config)
+	SetDefaultDispatcher(dispatcher)
+	return dispatcher
+}
+
+// Emit enqueues event with the default dispatcher. Like events.Emit, failures
+// are logged rather than returned.
+func Emit(ctx context.Context, event Event) {
+	dispatcher := DefaultDispatcher()
+	if dispatcher == nil {
+		return
+	}
+	if _, err := dispatcher.Enqueue(ctx, event); err != nil {
+		webhooksLogger.Printf("Error enqueueing %s webhooks: %v", event.Type, err)
+	}
+}
+
+// Publisher forwards workspace events to whichever dispatcher is the default
+// at the time, so it can be installed before ConfigureDefault runs.
+var Publisher events.Publisher = defaultPublisher{}
+
+type defaultPublisher struct{}
+
+func (defaultPublisher) Publish(ctx context.Context, event events.WorkspaceEvent) error {
+	dispatcher := DefaultDispatcher()
+	if dispatcher == nil {
+		return nil
+	}
+	return dispatcher.Publish(ctx, event)
+}
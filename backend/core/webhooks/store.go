@@ -0,0 +1,529 @@
+package webhooks
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/spectrumwebco/agent_runtime/backend/db/integrations"
+)
+
+// DeliveryFilter selects deliveries for the delivery log. Empty fields match
+// everything.
+type DeliveryFilter struct {
+	OrganizationID string
+	EndpointID     string
+	Status         Status
+	Limit          int
+}
+
+const DefaultDeliveryLimit = 100
+
+type Store interface {
+	CreateEndpoint(ctx context.Context, endpoint *Endpoint) error
+	// GetEndpoint returns the endpoint or ErrNotFound.
+	GetEndpoint(ctx context.Context, id string) (*Endpoint, error)
+	// ListEndpoints returns the endpoints of an organization, oldest first.
+	ListEndpoints(ctx context.Context, organizationID string) ([]*Endpoint, error)
+	// DeleteEndpoint removes the endpoint and its deliveries.
+	DeleteEndpoint(ctx context.Context, id string) error
+
+	CreateDelivery(ctx context.Context, delivery *Delivery) error
+	UpdateDelivery(ctx context.Context, delivery *Delivery) error
+	// GetDelivery returns the delivery or ErrNotFound.
+	GetDelivery(ctx context.Context, id string) (*Delivery, error)
+	// ListDeliveries returns matching deliveries, newest first.
+	ListDeliveries(ctx context.Context, filter DeliveryFilter) ([]*Delivery, error)
+	// ClaimDue returns up to limit pending deliveries due at now and
+	// postpones them by lease, so other replicas don't attempt them at the
+	// same time.
+	ClaimDue(ctx context.Context, now time.Time, lease time.Duration, limit int) ([]*Delivery, error)
+}
+
+type MemoryStore struct {
+	endpoints  map[string]*Endpoint
+	deliveries map[string]*Delivery
+	mu         sync.Mutex
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		endpoints:  make(map[string]*Endpoint),
+		deliveries: make(map[string]*Delivery),
+	}
+}
+
+func (s *MemoryStore) CreateEndpoint(ctx context.Context, endpoint *Endpoint) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	copied := *endpoint
+	s.endpoints[endpoint.ID] = &copied
+	return nil
+}
+
+func (s *MemoryStore) GetEndpoint(ctx context.Context, id string) (*Endpoint, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	endpoint, ok := s.endpoints[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	copied := *endpoint
+	return &copied, nil
+}
+
+func (s *MemoryStore) ListEndpoints(ctx context.Context, organizationID string) ([]*Endpoint, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	endpoints := []*Endpoint{}
+	for _, endpoint := range s.endpoints {
+		if endpoint.OrganizationID == organizationID {
+			copied := *endpoint
+			endpoints = append(endpoints, &copied)
+		}
+	}
+	sort.Slice(endpoints, func(i, j int) bool {
+		return endpoints[i].CreatedAt.Before(endpoints[j].CreatedAt)
+	})
+	return endpoints, nil
+}
+
+func (s *MemoryStore) DeleteEndpoint(ctx context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.endpoints[id]; !ok {
+		return ErrNotFound
+	}
+	delete(s.endpoints, id)
+	for deliveryID, delivery := range s.deliveries {
+		if delivery.EndpointID == id {
+			delete(s.deliveries, deliveryID)
+		}
+	}
+	return nil
+}
+
+func (s *MemoryStore) CreateDelivery(ctx context.Context, delivery *Delivery) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	copied := *delivery
+	s.deliveries[delivery.ID] = &copied
+	return nil
+}
+
+func (s *MemoryStore) UpdateDelivery(ctx context.Context, delivery *Delivery) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.deliveries[delivery.ID]; !ok {
+		return ErrNotFound
+	}
+	copied := *delivery
+	s.deliveries[delivery.ID] = &copied
+	return nil
+}
+
+func (s *MemoryStore) GetDelivery(ctx context.Context, id string) (*Delivery, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delivery, ok := s.deliveries[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	copied := *delivery
+	return &copied, nil
+}
+
+func (s *MemoryStore) ListDeliveries(ctx context.Context, filter DeliveryFilter) ([]*Delivery, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	deliveries := []*Delivery{}
+	for _, delivery := range s.deliveries {
+		if (filter.OrganizationID == "" || delivery.OrganizationID == filter.OrganizationID) &&
+			(filter.EndpointID == "" || delivery.EndpointID == filter.EndpointID) &&
+			(filter.Status == "" || delivery.Status == filter.Status) {
+			copied := *delivery
+			deliveries = append(deliveries, &copied)
+		}
+	}
+	sort.Slice(deliveries, func(i, j int) bool {
+		return deliveries[i].CreatedAt.After(deliveries[j].CreatedAt)
+	})
+
+	limit := filter.Limit
+	if limit <= 0 {
+		limit = DefaultDeliveryLimit
+	}
+	if len(deliveries) > limit {
+		deliveries = deliveries[:limit]
+	}
+	return deliveries, nil
+}
+
+func (s *MemoryStore) ClaimDue(ctx context.Context, now time.Time, lease time.Duration, limit int) ([]*Delivery, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	due := []*Delivery{}
+	for _, delivery := range s.deliveries {
+		if delivery.Status == StatusPending && !delivery.NextAttemptAt.After(now) {
+			due = append(due, delivery)
+		}
+	}
+	sort.Slice(due, func(i, j int) bool {
+		return due[i].NextAttemptAt.Before(due[j].NextAttemptAt)
+	})
+	if len(due) > limit {
+		due = due[:limit]
+	}
+
+	claimed := make([]*Delivery, 0, len(due))
+	for _, delivery := range due {
+		delivery.NextAttemptAt = now.Add(lease)
+		copied := *delivery
+		claimed = append(claimed, &copied)
+	}
+	return claimed, nil
+}
+
+// PostgresStore keeps endpoints in app_webhook_endpoint and deliveries,
+// including dead letters, in app_webhook_delivery.
+type PostgresStore struct {
+	client integrations.SQLStore
+}
+
+func NewPostgresStore(client integrations.SQLStore) *PostgresStore {
+	return &PostgresStore{client: client}
+}
+
+func (s *PostgresStore) EnsureSchema() error {
+	_, err := s.client.ExecuteUpdate(`
+		CREATE TABLE IF NOT EXISTS app_webhook_endpoint (
+			id VARCHAR(64) PRIMARY KEY,
+			organization_id VARCHAR(255) NOT NULL,
+			url TEXT NOT NULL,
+			secret VARCHAR(255) NOT NULL,
+			event_types JSONB NOT NULL DEFAULT '[]',
+			description TEXT NOT NULL DEFAULT '',
+			active BOOLEAN NOT NULL DEFAULT TRUE,
+			created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+		);
+		CREATE INDEX IF NOT EXISTS app_webhook_endpoint_organization_idx ON app_webhook_endpoint (organization_id);
+		CREATE TABLE IF NOT EXISTS app_webhook_delivery (
+			id VARCHAR(64) PRIMARY KEY,
+			endpoint_id VARCHAR(64) NOT NULL REFERENCES app_webhook_endpoint (id) ON DELETE CASCADE,
+			organization_id VARCHAR(255) NOT NULL,
+			event_id VARCHAR(64) NOT NULL,
+			event_type VARCHAR(128) NOT NULL,
+			payload JSONB NOT NULL,
+			status VARCHAR(16) NOT NULL,
+			attempts INTEGER NOT NULL DEFAULT 0,
+			response_status INTEGER NOT NULL DEFAULT 0,
+			last_error TEXT NOT NULL DEFAULT '',
+			next_attempt_at TIMESTAMPTZ NOT NULL,
+			created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+			updated_at TIMESTAMPTZ NOT NULL DEFAULT now()
+		);
+		CREATE INDEX IF NOT EXISTS app_webhook_delivery_due_idx ON app_webhook_delivery (next_attempt_at) WHERE status = 'pending';
+		CREATE INDEX IF NOT EXISTS app_webhook_delivery_log_idx ON app_webhook_delivery (organization_id, created_at DESC);
+	`)
+	if err != nil {
+		return fmt.Errorf("error creating webhook tables: %v", err)
+	}
+	return nil
+}
+
+const endpointColumns = `id, organization_id, url, secret, event_types, description, active, created_at`
+
+const deliveryColumns = `id, endpoint_id, organization_id, event_id, event_type, payload, status, attempts,
+	response_status, last_error, next_attempt_at, created_at, updated_at`
+
+func (s *PostgresStore) CreateEndpoint(ctx context.Context, endpoint *Endpoint) error {
+	eventTypes, err := json.Marshal(endpoint.EventTypes)
+	if err != nil {
+		return err
+	}
+	_, err = s.client.ExecuteUpdate(
+		`INSERT INTO app_webhook_endpoint (`+endpointColumns+`) VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`,
+		endpoint.ID, endpoint.OrganizationID, endpoint.URL, endpoint.Secret, string(eventTypes), endpoint.Description, endpoint.Active, endpoint.CreatedAt,
+	)
+	if err != nil {
+		return fmt.Errorf("error creating webhook: %v", err)
+	}
+	return nil
+}
+
+func (s *PostgresStore) GetEndpoint(ctx context.Context, id string) (*Endpoint, error) {
+	rows, err := s.client.ExecuteQuery(`SELECT `+endpointColumns+` FROM app_webhook_endpoint WHERE id = $1`, id)
+	if err != nil {
+		return nil, fmt.Errorf("error loading webhook %s: %v", id, err)
+	}
+	if len(rows) == 0 {
+		return nil, ErrNotFound
+	}
+	return endpointFromRow(rows[0])
+}
+
+func (s *PostgresStore) ListEndpoints(ctx context.Context, organizationID string) ([]*Endpoint, error) {
+	rows, err := s.client.ExecuteQuery(
+		`SELECT `+endpointColumns+` FROM app_webhook_endpoint WHERE organization_id = $1 ORDER BY created_at`,
+		organizationID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("error listing webhooks: %v", err)
+	}
+
+	endpoints := make([]*Endpoint, 0, len(rows))
+	for _, row := range rows {
+		endpoint, err := endpointFromRow(row)
+		if err != nil {
+			return nil, err
+		}
+		endpoints = append(endpoints, endpoint)
+	}
+	return endpoints, nil
+}
+
+func (s *PostgresStore) DeleteEndpoint(ctx context.Context, id string) error {
+	deleted, err := s.client.ExecuteUpdate(`DELETE FROM app_webhook_endpoint WHERE id = $1`, id)
+	if err != nil {
+		return fmt.Errorf("error deleting webhook %s: %v", id, err)
+	}
+	if deleted == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (s *PostgresStore) CreateDelivery(ctx context.Context, delivery *Delivery) error {
+	_, err := s.client.ExecuteUpdate(
+		`INSERT INTO app_webhook_delivery (`+deliveryColumns+`)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13)`,
+		delivery.ID, delivery.EndpointID, delivery.OrganizationID, delivery.EventID, delivery.EventType,
+		string(delivery.Payload), string(delivery.Status), delivery.Attempts, delivery.ResponseStatus,
+		delivery.LastError, delivery.NextAttemptAt, delivery.CreatedAt, delivery.UpdatedAt,
+	)
+	if err != nil {
+		return fmt.Errorf("error creating webhook delivery: %v", err)
+	}
+	return nil
+}
+
+func (s *PostgresStore) UpdateDelivery(ctx context.Context, delivery *Delivery) error {
+	updated, err := s.client.ExecuteUpdate(`
+		UPDATE app_webhook_delivery
+		SET status = $2, attempts = $3, response_status = $4, last_error = $5, next_attempt_at = $6, updated_at = $7
+		WHERE id = $1`,
+		delivery.ID, string(delivery.Status), delivery.Attempts, delivery.ResponseStatus, delivery.LastError,
+		delivery.NextAttemptAt, delivery.UpdatedAt,
+	)
+	if err != nil {
+		return fmt.Errorf("error updating webhook delivery %s: %v", delivery.ID, err)
+	}
+	if updated == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (s *PostgresStore) GetDelivery(ctx context.Context, id string) (*Delivery, error) {
+	rows, err := s.client.ExecuteQuery(`SELECT `+deliveryColumns+` FROM app_webhook_delivery WHERE id = $1`, id)
+	if err != nil {
+		return nil, fmt.Errorf("error loading webhook delivery %s: %v", id, err)
+	}
+	if len(rows) == 0 {
+		return nil, ErrNotFound
+	}
+	return deliveryFromRow(rows[0])
+}
+
+func (s *PostgresStore) ListDeliveries(ctx context.Context, filter DeliveryFilter) ([]*Delivery, error) {
+	query := `SELECT ` + deliveryColumns + ` FROM app_webhook_delivery WHERE TRUE`
+	params := []interface{}{}
+	if filter.OrganizationID != "" {
+		params = append(params, filter.OrganizationID)
+		query += ` AND organization_id = $` + strconv.Itoa(len(params))
+	}
+	if filter.EndpointID != "" {
+		params = append(params, filter.EndpointID)
+		query += ` AND endpoint_id = $` + strconv.Itoa(len(params))
+	}
+	if filter.Status != "" {
+		params = append(params, string(filter.Status))
+		query += ` AND status = $` + strconv.Itoa(len(params))
+	}
+	limit := filter.Limit
+	if limit <= 0 {
+		limit = DefaultDeliveryLimit
+	}
+	params = append(params, limit)
+	query += ` ORDER BY created_at DESC LIMIT $` + strconv.Itoa(len(params))
+
+	rows, err := s.client.ExecuteQuery(query, params...)
+	if err != nil {
+		return nil, fmt.Errorf("error listing webhook deliveries: %v", err)
+	}
+	return deliveriesFromRows(rows)
+}
+
+func (s *PostgresStore) ClaimDue(ctx context.Context, now time.Time, lease time.Duration, limit int) ([]*Delivery, error) {
+	rows, err := s.client.ExecuteQuery(`
+		UPDATE app_webhook_delivery SET next_attempt_at = $2
+		WHERE id IN (
+			SELECT id FROM app_webhook_delivery
+			WHERE status = 'pending' AND next_attempt_at <= $1
+			ORDER BY next_attempt_at
+			LIMIT $3
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING `+deliveryColumns,
+		now, now.Add(lease), limit,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("error claiming webhook deliveries: %v", err)
+	}
+	return deliveriesFromRows(rows)
+}
+
+func endpointFromRow(row map[string]interface{}) (*Endpoint, error) {
+	endpoint := &Endpoint{
+		ID:             toString(row["id"]),
+		OrganizationID: toString(row["organization_id"]),
+		URL:            toString(row["url"]),
+		Secret:         toString(row["secret"]),
+		Description:    toString(row["description"]),
+		Active:         toBool(row["active"]),
+		CreatedAt:      toTime(row["created_at"]),
+	}
+	if err := decodeJSONColumn(row["event_types"], &endpoint.EventTypes); err != nil {
+		return nil, fmt.Errorf("error decoding event types of webhook %s: %v", endpoint.ID, err)
+	}
+	return endpoint, nil
+}
+
+func deliveriesFromRows(rows []map[string]interface{}) ([]*Delivery, error) {
+	deliveries := make([]*Delivery, 0, len(rows))
+	for _, row := range rows {
+		delivery, err := deliveryFromRow(row)
+		if err != nil {
+			return nil, err
+		}
+		deliveries = append(deliveries, delivery)
+	}
+	return deliveries, nil
+}
+
+func deliveryFromRow(row map[string]interface{}) (*Delivery, error) {
+	delivery := &Delivery{
+		ID:             toString(row["id"]),
+		EndpointID:     toString(row["endpoint_id"]),
+		OrganizationID: toString(row["organization_id"]),
+		EventID:        toString(row["event_id"]),
+		EventType:      toString(row["event_type"]),
+		Status:         Status(toString(row["status"])),
+		Attempts:       int(toInt64(row["attempts"])),
+		ResponseStatus: int(toInt64(row["response_status"])),
+		LastError:      toString(row["last_error"]),
+		NextAttemptAt:  toTime(row["next_attempt_at"]),
+		CreatedAt:      toTime(row["created_at"]),
+		UpdatedAt:      toTime(row["updated_at"]),
+	}
+	switch payload := row["payload"].(type) {
+	case []byte:
+		delivery.Payload = append(json.RawMessage(nil), payload...)
+	case string:
+		delivery.Payload = json.RawMessage(payload)
+	case nil:
+	default:
+		return nil, fmt.Errorf("unexpected payload type %T of webhook delivery %s", payload, delivery.ID)
+	}
+	return delivery, nil
+}
+
+func toString(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case []byte:
+		return string(v)
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+func toBool(value interface{}) bool {
+	switch v := value.(type) {
+	case bool:
+		return v
+	case string:
+		enabled, _ := strconv.ParseBool(v)
+		return enabled
+	case []byte:
+		enabled, _ := strconv.ParseBool(string(v))
+		return enabled
+	default:
+		return false
+	}
+}
+
+func toInt64(value interface{}) int64 {
+	switch v := value.(type) {
+	case int64:
+		return v
+	case int32:
+		return int64(v)
+	case int:
+		return int64(v)
+	case float64:
+		return int64(v)
+	case []byte:
+		n, _ := strconv.ParseInt(string(v), 10, 64)
+		return n
+	case string:
+		n, _ := strconv.ParseInt(v, 10, 64)
+		return n
+	default:
+		return 0
+	}
+}
+
+func toTime(value interface{}) time.Time {
+	switch v := value.(type) {
+	case time.Time:
+		return v.UTC()
+	case string:
+		t, _ := time.Parse(time.RFC3339Nano, v)
+		return t
+	case []byte:
+		t, _ := time.Parse(time.RFC3339Nano, string(v))
+		return t
+	default:
+		return time.Time{}
+	}
+}
+
+func decodeJSONColumn(value interface{}, target interface{}) error {
+	switch v := value.(type) {
+	case nil:
+		return nil
+	case []byte:
+		return json.Unmarshal(v, target)
+	case string:
+		return json.Unmarshal([]byte(v), target)
+	default:
+		return fmt.Errorf("unexpected JSON column type %T", value)
+	}
+}
@@ -0,0 +1,282 @@
+// Package webhooks delivers workspace and agent events to URLs registered by
+// tenants.
+//
+// An Endpoint subscribes an organization to event types, either exactly, by
+// prefix ("workspace.*") or all of them ("*"). Every matching event becomes a
+// Delivery, which the Dispatcher POSTs to the endpoint as a JSON Event with
+// these headers:
+//
+//	Kled-Webhook-Id         the delivery ID, the same for every attempt
+//	Kled-Webhook-Event      the event type
+//	Kled-Webhook-Signature  t=<unix time>,v1=<hex HMAC-SHA256 of "<t>.<body>"
+//
+// The signature is keyed with the endpoint's secret, see Verify. A delivery
+// is retried with exponential backoff until the endpoint answers 2xx or the
+// attempts run out, after which it stays in the store as a dead letter until
+// it is redelivered.
+package webhooks
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/spectrumwebco/agent_runtime/backend/core/events"
+)
+
+var webhooksLogger = log.New(os.Stdout, "kled.webhooks: ", log.LstdFlags)
+
+var ErrNotFound = errors.New("webhook not found")
+
+const (
+	HeaderID        = "Kled-Webhook-Id"
+	HeaderEvent     = "Kled-Webhook-Event"
+	HeaderSignature = "Kled-Webhook-Signature"
+
+	// AgentCommandCompleted and AgentCommandFailed report the outcome of
+	// commands sent to workspace agents. Workspace lifecycle events keep
+	// the types of package events.
+	AgentCommandCompleted = "agent.command.completed"
+	AgentCommandFailed    = "agent.command.failed"
+
+	// secretPrefix marks webhook secrets so they are recognisable in logs
+	// and secret scanners.
+	secretPrefix = "whsec_"
+)
+
+// Event is the body of a delivery.
+type Event struct {
+	ID             string          `json:"id"`
+	Type           string          `json:"type"`
+	OrganizationID string          `json:"organization_id"`
+	OccurredAt     time.Time       `json:"occurred_at"`
+	Data           json.RawMessage `json:"data"`
+}
+
+// NewEvent returns an event of an organization carrying data.
+func NewEvent(eventType, organizationID string, data interface{}) (Event, error) {
+	body, err := json.Marshal(data)
+	if err != nil {
+		return Event{}, fmt.Errorf("error encoding %s event: %v", eventType, err)
+	}
+	return Event{
+		ID:             uuid.New().String(),
+		Type:           eventType,
+		OrganizationID: organizationID,
+		OccurredAt:     time.Now().UTC(),
+		Data:           body,
+	}, nil
+}
+
+// FromWorkspaceEvent wraps a workspace lifecycle event, keeping its ID so
+// receivers can deduplicate against the Kafka feed.
+func FromWorkspaceEvent(event events.WorkspaceEvent) (Event, error) {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return Event{}, fmt.Errorf("error encoding workspace event: %v", err)
+	}
+	return Event{
+		ID:             event.ID,
+		Type:           string(event.Type),
+		OrganizationID: event.OrganizationID,
+		OccurredAt:     event.OccurredAt,
+		Data:           body,
+	}, nil
+}
+
+// Endpoint is a URL an organization receives events at.
+type Endpoint struct {
+	ID             string `json:"id"`
+	OrganizationID string `json:"organization_id"`
+	URL            string `json:"url"`
+	// Secret keys the signatures. It is only returned when the endpoint is
+	// created.
+	Secret      string    `json:"-"`
+	EventTypes  []string  `json:"event_types"`
+	Description string    `json:"description,omitempty"`
+	Active      bool      `json:"active"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// NewEndpoint returns an active endpoint with a new ID and secret. Plain
+// HTTP URLs are only accepted when allowHTTP is set.
+func NewEndpoint(organizationID, rawURL string, eventTypes []string, allowHTTP bool, now time.Time) (*Endpoint, error) {
+	if organizationID == "" {
+		return nil, fmt.Errorf("webhook has no organization")
+	}
+	if err := validateURL(rawURL, allowHTTP); err != nil {
+		return nil, err
+	}
+	if len(eventTypes) == 0 {
+		return nil, fmt.Errorf("webhook must subscribe to at least one event type")
+	}
+	for _, eventType := range eventTypes {
+		if eventType == "" || strings.Contains(strings.TrimSuffix(eventType, "*"), "*") {
+			return nil, fmt.Errorf("invalid event type %q", eventType)
+		}
+	}
+
+	secret, err := newSecret()
+	if err != nil {
+		return nil, err
+	}
+	return &Endpoint{
+		ID:             uuid.New().String(),
+		OrganizationID: organizationID,
+		URL:            rawURL,
+		Secret:         secret,
+		EventTypes:     eventTypes,
+		Active:         true,
+		CreatedAt:      now.UTC(),
+	}, nil
+}
+
+func validateURL(rawURL string, allowHTTP bool) error {
+	parsed, err := url.Parse(rawURL)
+	if err != nil || parsed.Host == "" {
+		return fmt.Errorf("invalid webhook URL %q", rawURL)
+	}
+	switch parsed.Scheme {
+	case "https":
+		return nil
+	case "http":
+		if allowHTTP {
+			return nil
+		}
+		return fmt.Errorf("webhook URL must use https")
+	default:
+		return fmt.Errorf("invalid webhook URL %q", rawURL)
+	}
+}
+
+func newSecret() (string, error) {
+	raw := make([]byte, 24)
+	if _, err := rand.Read(raw); err != nil {
+		return "", fmt.Errorf("error generating webhook secret: %v", err)
+	}
+	return secretPrefix + base64.RawURLEncoding.EncodeToString(raw), nil
+}
+
+// Subscribed reports whether the endpoint receives events of eventType.
+func (e *Endpoint) Subscribed(eventType string) bool {
+	for _, pattern := range e.EventTypes {
+		if pattern == "*" || pattern == eventType {
+			return true
+		}
+		if prefix, ok := strings.CutSuffix(pattern, "*"); ok && strings.HasPrefix(eventType, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+type Status string
+
+const (
+	StatusPending   Status = "pending"
+	StatusSucceeded Status = "succeeded"
+	// StatusDead marks dead letters, deliveries that ran out of attempts.
+	StatusDead Status = "dead"
+)
+
+func ParseStatus(value string) (Status, error) {
+	switch Status(value) {
+	case StatusPending, StatusSucceeded, StatusDead:
+		return Status(value), nil
+	default:
+		return "", fmt.Errorf("unknown delivery status %q, must be one of pending, succeeded or dead", value)
+	}
+}
+
+// Delivery is one event sent to one endpoint, with the outcome of its
+// latest attempt.
+type Delivery struct {
+	ID             string          `json:"id"`
+	EndpointID     string          `json:"endpoint_id"`
+	OrganizationID string          `json:"organization_id"`
+	EventID        string          `json:"event_id"`
+	EventType      string          `json:"event_type"`
+	Payload        json.RawMessage `json:"payload"`
+	Status         Status          `json:"status"`
+	Attempts       int             `json:"attempts"`
+	// ResponseStatus is the HTTP status of the latest attempt, 0 if the
+	// request failed before a response arrived.
+	ResponseStatus int       `json:"response_status,omitempty"`
+	LastError      string    `json:"last_error,omitempty"`
+	NextAttemptAt  time.Time `json:"next_attempt_at"`
+	CreatedAt      time.Time `json:"created_at"`
+	UpdatedAt      time.Time `json:"updated_at"`
+}
+
+func newDelivery(endpoint *Endpoint, event Event, payload []byte, now time.Time) *Delivery {
+	return &Delivery{
+		ID:             uuid.New().String(),
+		EndpointID:     endpoint.ID,
+		OrganizationID: endpoint.OrganizationID,
+		EventID:        event.ID,
+		EventType:      event.Type,
+		Payload:        payload,
+		Status:         StatusPending,
+		NextAttemptAt:  now,
+		CreatedAt:      now,
+		UpdatedAt:      now,
+	}
+}
+
+// Sign returns the signature header of body sent at timestamp.
+func Sign(secret string, timestamp time.Time, body []byte) string {
+	t := strconv.FormatInt(timestamp.Unix(), 10)
+	return "t=" + t + ",v1=" + signature(secret, t, body)
+}
+
+func signature(secret, t string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(t))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify checks a signature header against body, rejecting signatures made
+// more than tolerance before now. Receivers written in Go can use it as is.
+func Verify(secret, header string, body []byte, tolerance time.Duration, now time.Time) error {
+	var t string
+	var candidates []string
+	for _, part := range strings.Split(header, ",") {
+		key, value, _ := strings.Cut(strings.TrimSpace(part), "=")
+		switch key {
+		case "t":
+			t = value
+		case "v1":
+			candidates = append(candidates, value)
+		}
+	}
+
+	unix, err := strconv.ParseInt(t, 10, 64)
+	if err != nil || len(candidates) == 0 {
+		return fmt.Errorf("malformed webhook signature")
+	}
+	if age := now.Sub(time.Unix(unix, 0)); tolerance > 0 && (age > tolerance || age < -tolerance) {
+		return fmt.Errorf("webhook signature is too old")
+	}
+
+	expected := signature(secret, t, body)
+	for _, candidate := range candidates {
+		if hmac.Equal([]byte(candidate), []byte(expected)) {
+			return nil
+		}
+	}
+	return fmt.Errorf("webhook signature does not match")
+}
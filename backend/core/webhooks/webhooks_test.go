@@ -0,0 +1,220 @@
+package webhooks
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/spectrumwebco/agent_runtime/backend/core/events"
+)
+
+func TestSignAndVerify(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	body := []byte(`{"id":"1"}`)
+	header := Sign("secret", now, body)
+
+	if err := Verify("secret", header, body, 5*time.Minute, now.Add(time.Minute)); err != nil {
+		t.Fatalf("expected a valid signature: %v", err)
+	}
+	if err := Verify("other", header, body, 5*time.Minute, now); err == nil {
+		t.Fatal("expected a signature with another secret to fail")
+	}
+	if err := Verify("secret", header, []byte(`{"id":"2"}`), 5*time.Minute, now); err == nil {
+		t.Fatal("expected a tampered body to fail")
+	}
+	if err := Verify("secret", header, body, 5*time.Minute, now.Add(time.Hour)); err == nil {
+		t.Fatal("expected an old signature to fail")
+	}
+}
+
+func TestEndpointSubscriptions(t *testing.T) {
+	endpoint, err := NewEndpoint("org-1", "https://example.com/hook", []string{"workspace.*", AgentCommandFailed}, false, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for eventType, want := range map[string]bool{
+		"workspace.started":   true,
+		AgentCommandFailed:    true,
+		AgentCommandCompleted: false,
+	} {
+		if got := endpoint.Subscribed(eventType); got != want {
+			t.Errorf("Subscribed(%q) = %v, want %v", eventType, got, want)
+		}
+	}
+
+	if _, err := NewEndpoint("org-1", "http://example.com/hook", []string{"*"}, false, time.Now()); err == nil {
+		t.Fatal("expected plain HTTP to be rejected")
+	}
+	if _, err := NewEndpoint("org-1", "https://example.com/hook", []string{"work*space"}, false, time.Now()); err == nil {
+		t.Fatal("expected an inner wildcard to be rejected")
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	config := Config{InitialBackoff: time.Second, MaxBackoff: 10 * time.Second}
+	for attempt, want := range map[int]time.Duration{1: time.Second, 2: 2 * time.Second, 4: 8 * time.Second, 5: 10 * time.Second, 30: 10 * time.Second} {
+		if got := config.Backoff(attempt); got != want {
+			t.Errorf("Backoff(%d) = %s, want %s", attempt, got, want)
+		}
+	}
+}
+
+// receiver answers with the queued statuses, then 200, and records the
+// requests it verified.
+type receiver struct {
+	mu       sync.Mutex
+	secret   string
+	statuses []int
+	received []*http.Request
+}
+
+func (r *receiver) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	body, _ := io.ReadAll(req.Body)
+	if err := Verify(r.secret, req.Header.Get(HeaderSignature), body, 0, time.Now()); err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+	r.received = append(r.received, req)
+	if len(r.statuses) > 0 {
+		status := r.statuses[0]
+		r.statuses = r.statuses[1:]
+		w.WriteHeader(status)
+	}
+}
+
+func newTestDispatcher(t *testing.T, statuses ...int) (*Dispatcher, *receiver, *Endpoint, *time.Time) {
+	t.Helper()
+	server := httptest.NewServer(nil)
+	t.Cleanup(server.Close)
+
+	endpoint, err := NewEndpoint("org-1", server.URL, []string{"workspace.*"}, true, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	receiver := &receiver{secret: endpoint.Secret, statuses: statuses}
+	server.Config.Handler = receiver
+
+	store := NewMemoryStore()
+	if err := store.CreateEndpoint(context.Background(), endpoint); err != nil {
+		t.Fatal(err)
+	}
+
+	config := DefaultConfig()
+	config.MaxAttempts = 3
+	config.InitialBackoff = time.Minute
+	dispatcher := NewDispatcher(store, server.Client(), config)
+	now := time.Now()
+	dispatcher.now = func() time.Time { return now }
+	return dispatcher, receiver, endpoint, &now
+}
+
+func publish(t *testing.T, dispatcher *Dispatcher, eventType events.EventType, organizationID string) {
+	t.Helper()
+	event := events.NewWorkspaceEvent(context.Background(), eventType, "ws-1")
+	event.OrganizationID = organizationID
+	if err := dispatcher.Publish(context.Background(), event); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDeliveryRetriesWithBackoff(t *testing.T) {
+	dispatcher, receiver, _, now := newTestDispatcher(t, http.StatusInternalServerError, http.StatusBadGateway)
+	ctx := context.Background()
+
+	publish(t, dispatcher, events.WorkspaceStarted, "org-1")
+	publish(t, dispatcher, events.WorkspaceStarted, "org-2")
+
+	if attempted, err := dispatcher.DeliverDue(ctx); err != nil || attempted != 1 {
+		t.Fatalf("expected one attempt, got %d: %v", attempted, err)
+	}
+	deliveries, _ := dispatcher.Store().ListDeliveries(ctx, DeliveryFilter{})
+	if len(deliveries) != 1 || deliveries[0].Status != StatusPending || deliveries[0].ResponseStatus != http.StatusInternalServerError {
+		t.Fatalf("expected a pending delivery after a 500, got %+v", deliveries)
+	}
+
+	// nothing is due until the backoff elapsed
+	if attempted, _ := dispatcher.DeliverDue(ctx); attempted != 0 {
+		t.Fatalf("expected the retry to wait, got %d attempts", attempted)
+	}
+	*now = now.Add(time.Minute)
+	dispatcher.DeliverDue(ctx)
+	*now = now.Add(time.Minute)
+	if attempted, _ := dispatcher.DeliverDue(ctx); attempted != 0 {
+		t.Fatal("expected the second retry to wait twice as long")
+	}
+	*now = now.Add(time.Minute)
+	dispatcher.DeliverDue(ctx)
+
+	delivery, _ := dispatcher.Store().GetDelivery(ctx, deliveries[0].ID)
+	if delivery.Status != StatusSucceeded || delivery.Attempts != 3 || delivery.LastError != "" {
+		t.Fatalf("expected the third attempt to succeed, got %+v", delivery)
+	}
+	if len(receiver.received) != 3 {
+		t.Fatalf("expected 3 signed requests, got %d", len(receiver.received))
+	}
+	for _, req := range receiver.received {
+		if req.Header.Get(HeaderID) != delivery.ID || req.Header.Get(HeaderEvent) != "workspace.started" {
+			t.Fatalf("unexpected headers %v", req.Header)
+		}
+	}
+}
+
+func TestDeadLetterAndRedeliver(t *testing.T) {
+	dispatcher, receiver, _, now := newTestDispatcher(t, http.StatusGone, http.StatusGone, http.StatusGone)
+	ctx := context.Background()
+
+	publish(t, dispatcher, events.WorkspaceDeleted, "org-1")
+	for i := 0; i < 3; i++ {
+		dispatcher.DeliverDue(ctx)
+		*now = now.Add(time.Hour)
+	}
+
+	dead, _ := dispatcher.Store().ListDeliveries(ctx, DeliveryFilter{OrganizationID: "org-1", Status: StatusDead})
+	if len(dead) != 1 || dead[0].Attempts != 3 || dead[0].ResponseStatus != http.StatusGone {
+		t.Fatalf("expected a dead letter after 3 attempts, got %+v", dead)
+	}
+	if attempted, _ := dispatcher.DeliverDue(ctx); attempted != 0 {
+		t.Fatal("expected dead letters not to be attempted")
+	}
+
+	if err := dispatcher.Redeliver(ctx, dead[0]); err != nil {
+		t.Fatal(err)
+	}
+	dispatcher.DeliverDue(ctx)
+
+	delivery, _ := dispatcher.Store().GetDelivery(ctx, dead[0].ID)
+	if delivery.Status != StatusSucceeded || delivery.Attempts != 1 {
+		t.Fatalf("expected the redelivery to succeed, got %+v", delivery)
+	}
+	if len(receiver.received) != 4 {
+		t.Fatalf("expected 4 requests, got %d", len(receiver.received))
+	}
+}
+
+func TestDisabledEndpointDeadLetters(t *testing.T) {
+	dispatcher, receiver, endpoint, _ := newTestDispatcher(t)
+	ctx := context.Background()
+
+	publish(t, dispatcher, events.WorkspaceCreated, "org-1")
+	endpoint.Active = false
+	dispatcher.Store().CreateEndpoint(ctx, endpoint)
+	dispatcher.DeliverDue(ctx)
+
+	dead, _ := dispatcher.Store().ListDeliveries(ctx, DeliveryFilter{Status: StatusDead})
+	if len(dead) != 1 || len(receiver.received) != 0 {
+		t.Fatalf("expected the delivery to be dead-lettered unsent, got %+v", dead)
+	}
+
+	// disabled endpoints receive no new deliveries
+	publish(t, dispatcher, events.WorkspaceCreated, "org-1")
+	if all, _ := dispatcher.Store().ListDeliveries(ctx, DeliveryFilter{}); len(all) != 1 {
+		t.Fatalf("expected no new delivery, got %d", len(all))
+	}
+}
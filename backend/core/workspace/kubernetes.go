@@ -0,0 +1,226 @@
+package workspace
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/spectrumwebco/agent_runtime/backend/core/reconcile"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+// WorkspaceResource is the Workspace custom resource the kled operator
+// creates, starts, stops and deletes workspaces from.
+var WorkspaceResource = schema.GroupVersionResource{Group: "kled.sh", Version: "v1alpha1", Resource: "workspaces"}
+
+// Phases of a Workspace resource as reported by the operator.
+const (
+	PhaseRunning = "Running"
+	PhaseStopped = "Stopped"
+	PhaseError   = "Error"
+)
+
+// IDLabel holds the ID of the backend workspace on its Workspace resource.
+const IDLabel = "kled.sh/workspace-id"
+
+const (
+	DefaultReadyTimeout = 15 * time.Minute
+	pollInterval        = 2 * time.Second
+)
+
+// ResourceDriver declares workspaces as Workspace resources named after
+// their ID and waits for the operator to apply changes.
+type ResourceDriver struct {
+	client    dynamic.Interface
+	namespace string
+	// readyTimeout bounds the wait for the operator to start or stop a
+	// workspace
+	readyTimeout time.Duration
+}
+
+// NewResourceDriver uses the in-cluster config and falls back to the
+// default kubeconfig.
+func NewResourceDriver(namespace string, readyTimeout time.Duration) (*ResourceDriver, error) {
+	config, err := rest.InClusterConfig()
+	if errors.Is(err, rest.ErrNotInCluster) {
+		config, err = clientcmd.NewNonInteractiveDeferredLoadingClientConfig(
+			clientcmd.NewDefaultClientConfigLoadingRules(),
+			&clientcmd.ConfigOverrides{},
+		).ClientConfig()
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error loading kubernetes config: %v", err)
+	}
+
+	client, err := dynamic.NewForConfig(config)
+	if err != nil {
+		return nil, fmt.Errorf("error creating kubernetes client: %v", err)
+	}
+	return NewResourceDriverForClient(client, namespace, readyTimeout), nil
+}
+
+func NewResourceDriverForClient(client dynamic.Interface, namespace string, readyTimeout time.Duration) *ResourceDriver {
+	if readyTimeout <= 0 {
+		readyTimeout = DefaultReadyTimeout
+	}
+	return &ResourceDriver{client: client, namespace: namespace, readyTimeout: readyTimeout}
+}
+
+func (d *ResourceDriver) resources() dynamic.ResourceInterface {
+	return d.client.Resource(WorkspaceResource).Namespace(d.namespace)
+}
+
+func (d *ResourceDriver) Create(ctx context.Context, workspace Workspace, spec Spec) error {
+	resourceSpec := map[string]interface{}{
+		"repository": spec.Repository,
+		"stopped":    true,
+	}
+	if spec.DevContainerPath != "" {
+		resourceSpec["devContainerPath"] = spec.DevContainerPath
+	}
+	if spec.Provider != "" {
+		resourceSpec["provider"] = spec.Provider
+	}
+	if len(spec.ProviderOptions) > 0 {
+		options := map[string]interface{}{}
+		for key, value := range spec.ProviderOptions {
+			options[key] = value
+		}
+		resourceSpec["providerOptions"] = options
+	}
+	if spec.StorageGB > 0 {
+		resourceSpec["resources"] = map[string]interface{}{
+			"requests": map[string]interface{}{"ephemeral-storage": fmt.Sprintf("%gGi", spec.StorageGB)},
+		}
+	}
+
+	resource := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": WorkspaceResource.GroupVersion().String(),
+		"kind":       "Workspace",
+		"metadata": map[string]interface{}{
+			"name":      workspace.ID,
+			"namespace": d.namespace,
+			"labels":    map[string]interface{}{IDLabel: workspace.ID},
+		},
+		"spec": resourceSpec,
+	}}
+	if _, err := d.resources().Create(ctx, resource, metav1.CreateOptions{}); err != nil {
+		return fmt.Errorf("error creating workspace resource %s: %v", workspace.ID, err)
+	}
+	return nil
+}
+
+// Start clears spec.stopped and waits for the phase Running. If the
+// workspace fails to start it is stopped again, so the operator doesn't keep
+// retrying it.
+func (d *ResourceDriver) Start(ctx context.Context, workspace Workspace) error {
+	if err := d.setStopped(ctx, workspace.ID, false); err != nil {
+		return err
+	}
+
+	err := d.waitFor(ctx, workspace.ID, PhaseRunning)
+	if err != nil {
+		if stopErr := d.setStopped(context.WithoutCancel(ctx), workspace.ID, true); stopErr != nil {
+			workspaceLogger.Printf("Error stopping workspace %s after it failed to start: %v", workspace.ID, stopErr)
+		}
+	}
+	return err
+}
+
+func (d *ResourceDriver) Stop(ctx context.Context, workspace Workspace) error {
+	if err := d.setStopped(ctx, workspace.ID, true); err != nil {
+		return err
+	}
+	return d.waitFor(ctx, workspace.ID, PhaseStopped)
+}
+
+// Delete deletes the resource; the operator deletes the workspace before
+// it removes its finalizer.
+func (d *ResourceDriver) Delete(ctx context.Context, workspace Workspace) error {
+	err := d.resources().Delete(ctx, workspace.ID, metav1.DeleteOptions{})
+	if err != nil && !apierrors.IsNotFound(err) {
+		return fmt.Errorf("error deleting workspace resource %s: %v", workspace.ID, err)
+	}
+	return nil
+}
+
+// SetMachineType sets the MachineTypeOption of the provider. The operator
+// recreates the workspace on the new machine type, so a running workspace
+// is waited for to run again.
+func (d *ResourceDriver) SetMachineType(ctx context.Context, workspace Workspace, machineType string) error {
+	err := d.patchSpec(ctx, workspace.ID, map[string]interface{}{
+		"providerOptions": map[string]interface{}{MachineTypeOption: machineType},
+	})
+	if err != nil || workspace.Desired != reconcile.DesiredRunning {
+		return err
+	}
+	return d.waitFor(ctx, workspace.ID, PhaseRunning)
+}
+
+func (d *ResourceDriver) setStopped(ctx context.Context, name string, stopped bool) error {
+	return d.patchSpec(ctx, name, map[string]interface{}{"stopped": stopped})
+}
+
+func (d *ResourceDriver) patchSpec(ctx context.Context, name string, spec map[string]interface{}) error {
+	patch, err := json.Marshal(map[string]interface{}{"spec": spec})
+	if err != nil {
+		return err
+	}
+	if _, err := d.resources().Patch(ctx, name, types.MergePatchType, patch, metav1.PatchOptions{}); err != nil {
+		return fmt.Errorf("error updating workspace resource %s: %v", name, err)
+	}
+	return nil
+}
+
+// waitFor polls the resource until the operator reconciled the current
+// spec into phase, or reports the phase Error for it.
+func (d *ResourceDriver) waitFor(ctx context.Context, name, phase string) error {
+	err := wait.PollUntilContextTimeout(ctx, pollInterval, d.readyTimeout, true, func(ctx context.Context) (bool, error) {
+		resource, err := d.resources().Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			return false, fmt.Errorf("error loading workspace resource %s: %v", name, err)
+		}
+
+		observed, _, _ := unstructured.NestedInt64(resource.Object, "status", "observedGeneration")
+		if observed < resource.GetGeneration() {
+			return false, nil
+		}
+		current, _, _ := unstructured.NestedString(resource.Object, "status", "phase")
+		switch current {
+		case phase:
+			return true, nil
+		case PhaseError:
+			return false, fmt.Errorf("workspace %s failed: %s", name, readyMessage(resource))
+		}
+		return false, nil
+	})
+	if wait.Interrupted(err) {
+		return fmt.Errorf("workspace %s didn't become %s within %s", name, phase, d.readyTimeout)
+	}
+	return err
+}
+
+// readyMessage returns the message of the Ready condition, which explains
+// an error.
+func readyMessage(resource *unstructured.Unstructured) string {
+	conditions, _, _ := unstructured.NestedSlice(resource.Object, "status", "conditions")
+	for _, condition := range conditions {
+		fields, _ := condition.(map[string]interface{})
+		if fields["type"] == "Ready" {
+			if message, ok := fields["message"].(string); ok {
+				return message
+			}
+		}
+	}
+	return "unknown error"
+}
@@ -0,0 +1,135 @@
+package workspace
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/spectrumwebco/agent_runtime/backend/core/quota"
+	"github.com/spectrumwebco/agent_runtime/backend/core/reconcile"
+	"github.com/spectrumwebco/agent_runtime/backend/core/tenancy"
+	"github.com/spectrumwebco/agent_runtime/backend/db/integrations"
+)
+
+// SQLStore keeps workspaces in app_workspace.
+type SQLStore struct {
+	store integrations.SQLStore
+}
+
+func NewSQLStore(store integrations.SQLStore) *SQLStore {
+	return &SQLStore{store: store}
+}
+
+// EnsureSchema adds the desired_state column the reconciler reads and the
+// storage_gb column.
+func (s *SQLStore) EnsureSchema() error {
+	if err := reconcile.NewSQLStore(s.store).EnsureSchema(); err != nil {
+		return err
+	}
+	_, err := s.store.ExecuteUpdate(`ALTER TABLE app_workspace ADD COLUMN IF NOT EXISTS storage_gb DOUBLE PRECISION NOT NULL DEFAULT 0`)
+	if err != nil {
+		return fmt.Errorf("error creating workspace schema: %v", err)
+	}
+	return nil
+}
+
+func (s *SQLStore) Get(ctx context.Context, workspaceID string) (Workspace, error) {
+	rows, err := s.store.ExecuteQuery(
+		`SELECT id, name, organization_id, project_id, created_by_id, desired_state, storage_gb FROM app_workspace WHERE id = $1`, workspaceID,
+	)
+	if err != nil {
+		return Workspace{}, fmt.Errorf("error loading workspace %s: %v", workspaceID, err)
+	}
+	if len(rows) == 0 {
+		return Workspace{}, fmt.Errorf("%w: %s", ErrNotFound, workspaceID)
+	}
+
+	row := rows[0]
+	workspace := Workspace{
+		ID:             fmt.Sprint(row["id"]),
+		Name:           fmt.Sprint(row["name"]),
+		OrganizationID: fmt.Sprint(row["organization_id"]),
+	}
+	if project := row["project_id"]; project != nil {
+		workspace.ProjectID = fmt.Sprint(project)
+	}
+	if owner := row["created_by_id"]; owner != nil {
+		workspace.OwnerID = fmt.Sprint(owner)
+	}
+	if desired, ok := row["desired_state"].(string); ok {
+		workspace.Desired = reconcile.DesiredState(desired)
+	}
+	if storage, err := strconv.ParseFloat(fmt.Sprint(row["storage_gb"]), 64); err == nil {
+		workspace.StorageGB = storage
+	}
+	return workspace, nil
+}
+
+func (s *SQLStore) Create(ctx context.Context, workspace Workspace) error {
+	_, err := s.store.ExecuteUpdate(`
+		INSERT INTO app_workspace (id, name, slug, description, organization_id, project_id, created_by_id, desired_state, storage_gb, created_at, updated_at)
+		VALUES ($1, $2, $3, '', $4, $5, $6, $7, $8, now(), now())`,
+		workspace.ID, workspace.Name, slug(workspace.Name), workspace.OrganizationID,
+		nullable(projectColumn(workspace.ProjectID)), nullable(workspace.OwnerID), nullable(string(workspace.Desired)), workspace.StorageGB,
+	)
+	if err != nil {
+		return fmt.Errorf("error creating workspace %s: %v", workspace.ID, err)
+	}
+	return nil
+}
+
+func (s *SQLStore) Delete(ctx context.Context, workspaceID string) error {
+	if _, err := s.store.ExecuteUpdate(`DELETE FROM app_workspace WHERE id = $1`, workspaceID); err != nil {
+		return fmt.Errorf("error deleting workspace %s: %v", workspaceID, err)
+	}
+	return nil
+}
+
+func (s *SQLStore) SetDesired(ctx context.Context, workspaceID string, desired reconcile.DesiredState) error {
+	return reconcile.NewSQLStore(s.store).SetDesired(ctx, workspaceID, desired)
+}
+
+// NewDefaultController returns a controller keeping workspaces in the
+// default Postgres store and declaring them as Workspace resources in
+// namespace. They are charged to quota.DefaultManager() with rates.
+func NewDefaultController(namespace string, readyTimeout time.Duration, rates quota.Rates) (*Controller, error) {
+	store := NewSQLStore(integrations.GetPostgresStore("default"))
+	if err := store.EnsureSchema(); err != nil {
+		return nil, err
+	}
+	driver, err := NewResourceDriver(namespace, readyTimeout)
+	if err != nil {
+		return nil, err
+	}
+
+	controller := NewController(store, driver)
+	controller.SetQuota(nil, rates)
+	return controller, nil
+}
+
+// projectColumn maps the default project, which has no row of its own, to
+// an empty project_id.
+func projectColumn(projectID string) string {
+	if projectID == tenancy.DefaultProject {
+		return ""
+	}
+	return projectID
+}
+
+func nullable(value string) interface{} {
+	if value == "" {
+		return nil
+	}
+	return value
+}
+
+// slug lowercases name and joins its words with dashes.
+func slug(name string) string {
+	words := strings.FieldsFunc(strings.ToLower(name), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	return strings.Join(words, "-")
+}
@@ -0,0 +1,350 @@
+// Package workspace creates, starts, stops and deletes workspaces.
+//
+// The Controller is the one place that changes the lifecycle of a
+// workspace, whoever asks for it: the API, a schedule or the GPU reclaimer.
+// It records the desired state the reconciler keeps the workspace in, has
+// the Driver carry the change out and emits the lifecycle event with the
+// context of the request that caused it, so the event carries its
+// correlation ID and actor. Every event of the lifecycle is emitted here and
+// nowhere else.
+//
+// The Controller also charges the quotas of the owner and project of a
+// workspace, whoever changes it: creating a workspace consumes its storage
+// until it is deleted, and a running workspace holds a concurrent workspace
+// slot until it is stopped or deleted.
+package workspace
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/spectrumwebco/agent_runtime/backend/core/events"
+	"github.com/spectrumwebco/agent_runtime/backend/core/quota"
+	"github.com/spectrumwebco/agent_runtime/backend/core/rbac"
+	"github.com/spectrumwebco/agent_runtime/backend/core/reconcile"
+	"github.com/spectrumwebco/agent_runtime/backend/core/slo"
+	"github.com/spectrumwebco/agent_runtime/backend/core/tenancy"
+)
+
+var workspaceLogger = log.New(os.Stdout, "kled.workspace: ", log.LstdFlags)
+
+var ErrNotFound = errors.New("workspace not found")
+
+// Workspace is the record of a workspace.
+type Workspace struct {
+	ID             string `json:"id"`
+	Name           string `json:"name"`
+	OrganizationID string `json:"organization_id"`
+	// ProjectID is empty for workspaces of the default project.
+	ProjectID string                 `json:"project_id,omitempty"`
+	OwnerID   string                 `json:"owner_id,omitempty"`
+	Desired   reconcile.DesiredState `json:"desired_state,omitempty"`
+	// StorageGB is the size of the volume, charged to storage_gb.
+	StorageGB float64 `json:"storage_gb,omitempty"`
+}
+
+// Tenant returns the organization and project the workspace belongs to.
+func (w Workspace) Tenant() (tenancy.Tenant, error) {
+	return tenancy.New(w.OrganizationID, w.ProjectID)
+}
+
+// QuotaScopes returns the scopes the workspace is charged to: its owner and
+// its project.
+func (w Workspace) QuotaScopes() []quota.Scope {
+	var scopes []quota.Scope
+	if w.OwnerID != "" {
+		scopes = append(scopes, quota.Scope{Type: quota.ScopeUser, ID: w.OwnerID})
+	}
+	if tenant, err := w.Tenant(); err == nil {
+		scopes = append(scopes, quota.Scope{Type: quota.ScopeProject, ID: tenant.String()})
+	}
+	return scopes
+}
+
+// MachineTypeOption is the provider option selecting the machine type or GPU
+// profile of a workspace.
+const MachineTypeOption = "MACHINE_TYPE"
+
+// Spec is what a workspace is created from, as passed to kled up.
+type Spec struct {
+	// Repository is the source of the workspace, e.g.
+	// github.com/my-org/my-repo@main.
+	Repository       string            `json:"repository"`
+	DevContainerPath string            `json:"dev_container_path,omitempty"`
+	Provider         string            `json:"provider,omitempty"`
+	ProviderOptions  map[string]string `json:"provider_options,omitempty"`
+	// StorageGB is the size of the volume, left to the provider when 0.
+	StorageGB float64 `json:"storage_gb,omitempty"`
+}
+
+func (s Spec) Validate() error {
+	if strings.TrimSpace(s.Repository) == "" {
+		return fmt.Errorf("repository is required")
+	}
+	if s.StorageGB < 0 {
+		return fmt.Errorf("storage_gb must not be negative")
+	}
+	return nil
+}
+
+// Store keeps the records of workspaces.
+type Store interface {
+	// Get returns ErrNotFound for unknown workspaces.
+	Get(ctx context.Context, workspaceID string) (Workspace, error)
+	Create(ctx context.Context, workspace Workspace) error
+	Delete(ctx context.Context, workspaceID string) error
+	SetDesired(ctx context.Context, workspaceID string, desired reconcile.DesiredState) error
+}
+
+// Driver carries out lifecycle changes on the infrastructure running the
+// workspaces.
+type Driver interface {
+	// Create declares a stopped workspace.
+	Create(ctx context.Context, workspace Workspace, spec Spec) error
+	// Start returns once the workspace runs. A workspace that fails to
+	// start is left stopped.
+	Start(ctx context.Context, workspace Workspace) error
+	// Stop returns once the workspace stopped. Its volume is kept.
+	Stop(ctx context.Context, workspace Workspace) error
+	Delete(ctx context.Context, workspace Workspace) error
+	// SetMachineType moves the workspace to another machine type. A
+	// running workspace is recreated and returns once it runs again.
+	SetMachineType(ctx context.Context, workspace Workspace, machineType string) error
+}
+
+type Controller struct {
+	store  Store
+	driver Driver
+	now    func() time.Time
+
+	quotas *quota.Manager
+	rates  quota.Rates
+}
+
+func NewController(store Store, driver Driver) *Controller {
+	return &Controller{store: store, driver: driver, now: time.Now}
+}
+
+func (c *Controller) SetClock(now func() time.Time) {
+	c.now = now
+}
+
+// SetQuota charges workspaces to manager, or to quota.DefaultManager() at
+// the time of the change when manager is nil. Running workspaces accrue
+// rates per hour.
+func (c *Controller) SetQuota(manager *quota.Manager, rates quota.Rates) {
+	c.quotas = manager
+	c.rates = rates
+}
+
+func (c *Controller) quota() *quota.Manager {
+	if c.quotas != nil {
+		return c.quotas
+	}
+	return quota.DefaultManager()
+}
+
+// Create records a workspace and declares it stopped with the driver. An
+// empty ID is generated. Its storage is charged first, a *quota.ExceededError
+// creates nothing. If the driver fails the record is removed again.
+func (c *Controller) Create(ctx context.Context, workspace Workspace, spec Spec) (Workspace, error) {
+	if err := spec.Validate(); err != nil {
+		return Workspace{}, err
+	}
+	if workspace.ID == "" {
+		workspace.ID = uuid.New().String()
+	}
+	workspace.Desired = reconcile.DesiredStopped
+	workspace.StorageGB = spec.StorageGB
+
+	if err := c.consumeStorage(ctx, workspace); err != nil {
+		return Workspace{}, err
+	}
+	if err := c.store.Create(ctx, workspace); err != nil {
+		c.fail(ctx, workspace, events.StageCreate, err)
+		c.releaseStorage(ctx, workspace)
+		return Workspace{}, err
+	}
+	if err := c.driver.Create(ctx, workspace, spec); err != nil {
+		c.fail(ctx, workspace, events.StageCreate, err)
+		if deleteErr := c.store.Delete(ctx, workspace.ID); deleteErr != nil {
+			workspaceLogger.Printf("Error removing the record of workspace %s: %v", workspace.ID, deleteErr)
+		}
+		c.releaseStorage(ctx, workspace)
+		return Workspace{}, err
+	}
+
+	event := c.event(ctx, events.WorkspaceCreated, workspace)
+	event.Provider = spec.Provider
+	events.Emit(ctx, event)
+	return workspace, nil
+}
+
+// Start starts a workspace and returns once it runs. The time it took is
+// reported as the start duration of the workspace.started event. The
+// workspace takes a concurrent workspace slot first, a
+// *quota.ExceededError leaves it stopped.
+func (c *Controller) Start(ctx context.Context, workspaceID string) error {
+	workspace, err := c.store.Get(ctx, workspaceID)
+	if err != nil {
+		return err
+	}
+
+	started := c.now()
+	held, err := c.quota().StartWorkspace(ctx, workspace.QuotaScopes(), workspace.ID, c.rates)
+	if err != nil {
+		return err
+	}
+	if err := c.store.SetDesired(ctx, workspace.ID, reconcile.DesiredRunning); err != nil {
+		c.fail(ctx, workspace, events.StageStart, err)
+		if held {
+			c.releaseSlot(ctx, workspace)
+		}
+		return err
+	}
+	if err := c.driver.Start(ctx, workspace); err != nil {
+		c.fail(ctx, workspace, events.StageStart, err)
+		if desiredErr := c.store.SetDesired(ctx, workspace.ID, reconcile.DesiredStopped); desiredErr != nil {
+			workspaceLogger.Printf("Error resetting the desired state of workspace %s: %v", workspace.ID, desiredErr)
+		}
+		if held {
+			c.releaseSlot(ctx, workspace)
+		}
+		return err
+	}
+
+	event := c.event(ctx, events.WorkspaceStarted, workspace)
+	event.Attributes[slo.StartDurationAttribute] = strconv.FormatInt(c.now().Sub(started).Milliseconds(), 10)
+	events.Emit(ctx, event)
+	return nil
+}
+
+// Stop stops a workspace and returns once it stopped, which returns its
+// slot.
+func (c *Controller) Stop(ctx context.Context, workspaceID string) error {
+	workspace, err := c.store.Get(ctx, workspaceID)
+	if err != nil {
+		return err
+	}
+
+	if err := c.store.SetDesired(ctx, workspace.ID, reconcile.DesiredStopped); err != nil {
+		c.fail(ctx, workspace, events.StageStop, err)
+		return err
+	}
+	if err := c.driver.Stop(ctx, workspace); err != nil {
+		c.fail(ctx, workspace, events.StageStop, err)
+		return err
+	}
+	c.releaseSlot(ctx, workspace)
+
+	events.Emit(ctx, c.event(ctx, events.WorkspaceStopped, workspace))
+	return nil
+}
+
+// Delete deletes a workspace with its volume and removes its record, which
+// returns its slot and storage.
+func (c *Controller) Delete(ctx context.Context, workspaceID string) error {
+	workspace, err := c.store.Get(ctx, workspaceID)
+	if err != nil {
+		return err
+	}
+
+	if err := c.driver.Delete(ctx, workspace); err != nil {
+		c.fail(ctx, workspace, events.StageDelete, err)
+		return err
+	}
+	c.releaseSlot(ctx, workspace)
+	if err := c.store.Delete(ctx, workspace.ID); err != nil {
+		c.fail(ctx, workspace, events.StageDelete, err)
+		return err
+	}
+	c.releaseStorage(ctx, workspace)
+
+	events.Emit(ctx, c.event(ctx, events.WorkspaceDeleted, workspace))
+	return nil
+}
+
+// Downgrade moves a workspace to a smaller machine type, such as one without
+// GPUs. A running workspace keeps its slot while it is recreated.
+func (c *Controller) Downgrade(ctx context.Context, workspaceID, machineType string) error {
+	workspace, err := c.store.Get(ctx, workspaceID)
+	if err != nil {
+		return err
+	}
+
+	if err := c.driver.SetMachineType(ctx, workspace, machineType); err != nil {
+		c.fail(ctx, workspace, events.StageDowngrade, err)
+		return err
+	}
+	workspaceLogger.Printf("Moved workspace %s to machine type %s", workspace.ID, machineType)
+	return nil
+}
+
+func (c *Controller) consumeStorage(ctx context.Context, workspace Workspace) error {
+	if workspace.StorageGB <= 0 {
+		return nil
+	}
+	return c.quota().Consume(ctx, workspace.QuotaScopes(), quota.ResourceStorageGB, workspace.StorageGB)
+}
+
+// releaseStorage and releaseSlot only log errors: the change they follow
+// already happened.
+func (c *Controller) releaseStorage(ctx context.Context, workspace Workspace) {
+	if workspace.StorageGB <= 0 {
+		return
+	}
+	if err := c.quota().Release(ctx, workspace.QuotaScopes(), quota.ResourceStorageGB, workspace.StorageGB); err != nil {
+		workspaceLogger.Printf("Error releasing the storage of workspace %s: %v", workspace.ID, err)
+	}
+}
+
+func (c *Controller) releaseSlot(ctx context.Context, workspace Workspace) {
+	if err := c.quota().StopWorkspace(ctx, workspace.ID); err != nil {
+		workspaceLogger.Printf("Error releasing the slot of workspace %s: %v", workspace.ID, err)
+	}
+}
+
+func (c *Controller) fail(ctx context.Context, workspace Workspace, stage string, err error) {
+	workspaceLogger.Printf("Error in %s of workspace %s: %v", stage, workspace.ID, err)
+
+	event := c.event(ctx, events.WorkspaceFailed, workspace)
+	event.Error = err.Error()
+	event.Attributes[events.StageAttribute] = stage
+	events.Emit(ctx, event)
+}
+
+// event returns a lifecycle event of workspace caused by the subject in
+// ctx, or by no one for schedules and other background work.
+func (c *Controller) event(ctx context.Context, eventType events.EventType, workspace Workspace) events.WorkspaceEvent {
+	event := events.NewWorkspaceEvent(ctx, eventType, workspace.ID)
+	event.WorkspaceName = workspace.Name
+	event.OrganizationID = workspace.OrganizationID
+	if subject, ok := rbac.SubjectFromContext(ctx); ok {
+		event.ActorID = subject.ID
+	}
+	event.Attributes = map[string]string{}
+	if reason := Reason(ctx); reason != "" {
+		event.Attributes["reason"] = reason
+	}
+	return event
+}
+
+type reasonKey struct{}
+
+// WithReason records why background work such as a schedule changes the
+// lifecycle of a workspace. It is the reason attribute of the events.
+func WithReason(ctx context.Context, reason string) context.Context {
+	return context.WithValue(ctx, reasonKey{}, reason)
+}
+
+func Reason(ctx context.Context) string {
+	reason, _ := ctx.Value(reasonKey{}).(string)
+	return reason
+}
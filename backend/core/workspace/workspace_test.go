@@ -0,0 +1,442 @@
+package workspace
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/spectrumwebco/agent_runtime/backend/core/events"
+	"github.com/spectrumwebco/agent_runtime/backend/core/quota"
+	"github.com/spectrumwebco/agent_runtime/backend/core/rbac"
+	"github.com/spectrumwebco/agent_runtime/backend/core/reconcile"
+	"github.com/spectrumwebco/agent_runtime/backend/core/slo"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+)
+
+type memoryStore map[string]Workspace
+
+func (s memoryStore) Get(ctx context.Context, workspaceID string) (Workspace, error) {
+	workspace, ok := s[workspaceID]
+	if !ok {
+		return Workspace{}, ErrNotFound
+	}
+	return workspace, nil
+}
+
+func (s memoryStore) Create(ctx context.Context, workspace Workspace) error {
+	s[workspace.ID] = workspace
+	return nil
+}
+
+func (s memoryStore) Delete(ctx context.Context, workspaceID string) error {
+	delete(s, workspaceID)
+	return nil
+}
+
+func (s memoryStore) SetDesired(ctx context.Context, workspaceID string, desired reconcile.DesiredState) error {
+	workspace, ok := s[workspaceID]
+	if !ok {
+		return ErrNotFound
+	}
+	workspace.Desired = desired
+	s[workspaceID] = workspace
+	return nil
+}
+
+type fakeDriver struct {
+	calls []string
+	// err fails the call named by failing
+	failing string
+	err     error
+	// startTime is how long a start takes on the test clock
+	startTime time.Duration
+	clock     *time.Time
+}
+
+func (d *fakeDriver) call(name string) error {
+	d.calls = append(d.calls, name)
+	if name == d.failing {
+		return d.err
+	}
+	return nil
+}
+
+func (d *fakeDriver) Create(ctx context.Context, workspace Workspace, spec Spec) error {
+	return d.call("create")
+}
+
+func (d *fakeDriver) Start(ctx context.Context, workspace Workspace) error {
+	if d.clock != nil {
+		*d.clock = d.clock.Add(d.startTime)
+	}
+	return d.call("start")
+}
+
+func (d *fakeDriver) Stop(ctx context.Context, workspace Workspace) error {
+	return d.call("stop")
+}
+
+func (d *fakeDriver) Delete(ctx context.Context, workspace Workspace) error {
+	return d.call("delete")
+}
+
+func (d *fakeDriver) SetMachineType(ctx context.Context, workspace Workspace, machineType string) error {
+	return d.call("set_machine_type:" + machineType)
+}
+
+type recordingPublisher []events.WorkspaceEvent
+
+func (p *recordingPublisher) Publish(ctx context.Context, event events.WorkspaceEvent) error {
+	*p = append(*p, event)
+	return nil
+}
+
+func record(t *testing.T) *recordingPublisher {
+	publisher := &recordingPublisher{}
+	events.SetPublisher(publisher)
+	t.Cleanup(func() { events.SetPublisher(nil) })
+	return publisher
+}
+
+func requestContext() context.Context {
+	ctx := events.WithCorrelationID(context.Background(), "request-1")
+	return rbac.WithSubject(ctx, rbac.Subject{ID: "user-1", OrganizationID: "acme"})
+}
+
+func TestLifecycleEmitsEventsWithRequestContext(t *testing.T) {
+	publisher := record(t)
+	now := time.Date(2026, 1, 5, 9, 0, 0, 0, time.UTC)
+	store := memoryStore{}
+	driver := &fakeDriver{clock: &now, startTime: 90 * time.Second}
+	controller := NewController(store, driver)
+	controller.SetClock(func() time.Time { return now })
+	ctx := requestContext()
+
+	workspace, err := controller.Create(ctx, Workspace{Name: "API server", OrganizationID: "acme", OwnerID: "user-1"}, Spec{Repository: "github.com/acme/api", Provider: "kubernetes"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if workspace.ID == "" || store[workspace.ID].Desired != reconcile.DesiredStopped {
+		t.Fatalf("expected a stopped record, got %+v", store[workspace.ID])
+	}
+	if err := controller.Start(ctx, workspace.ID); err != nil {
+		t.Fatal(err)
+	}
+	if store[workspace.ID].Desired != reconcile.DesiredRunning {
+		t.Errorf("expected the workspace to be desired running, got %q", store[workspace.ID].Desired)
+	}
+	if err := controller.Stop(ctx, workspace.ID); err != nil {
+		t.Fatal(err)
+	}
+	if err := controller.Delete(ctx, workspace.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := store[workspace.ID]; ok {
+		t.Errorf("expected the record to be removed")
+	}
+
+	types := []events.EventType{events.WorkspaceCreated, events.WorkspaceStarted, events.WorkspaceStopped, events.WorkspaceDeleted}
+	if len(*publisher) != len(types) {
+		t.Fatalf("expected one event per change, got %+v", *publisher)
+	}
+	for i, event := range *publisher {
+		if event.Type != types[i] || event.WorkspaceID != workspace.ID || event.WorkspaceName != "API server" ||
+			event.OrganizationID != "acme" || event.ActorID != "user-1" || event.CorrelationID != "request-1" {
+			t.Errorf("unexpected event %+v", event)
+		}
+	}
+	if created := (*publisher)[0]; created.Provider != "kubernetes" {
+		t.Errorf("expected the provider on the created event, got %+v", created)
+	}
+	if started := (*publisher)[1]; started.Attributes[slo.StartDurationAttribute] != "90000" {
+		t.Errorf("expected the start duration, got %+v", started.Attributes)
+	}
+}
+
+func TestFailedStartIsReportedAndLeftStopped(t *testing.T) {
+	publisher := record(t)
+	store := memoryStore{"ws-1": {ID: "ws-1", OrganizationID: "acme", Desired: reconcile.DesiredStopped}}
+	driver := &fakeDriver{failing: "start", err: errors.New("image pull failed")}
+	controller := NewController(store, driver)
+
+	err := controller.Start(WithReason(context.Background(), "schedule"), "ws-1")
+	if err == nil || !strings.Contains(err.Error(), "image pull failed") {
+		t.Fatalf("expected the driver error, got %v", err)
+	}
+	if store["ws-1"].Desired != reconcile.DesiredStopped {
+		t.Errorf("expected the workspace to be desired stopped again, got %q", store["ws-1"].Desired)
+	}
+	if len(*publisher) != 1 {
+		t.Fatalf("expected only a failed event, got %+v", *publisher)
+	}
+	event := (*publisher)[0]
+	if event.Type != events.WorkspaceFailed || event.Error != "image pull failed" ||
+		event.Attributes[events.StageAttribute] != events.StageStart || event.Attributes["reason"] != "schedule" || event.ActorID != "" {
+		t.Errorf("unexpected event %+v", event)
+	}
+}
+
+func TestFailedCreateRemovesRecord(t *testing.T) {
+	publisher := record(t)
+	store := memoryStore{}
+	controller := NewController(store, &fakeDriver{failing: "create", err: errors.New("forbidden")})
+
+	if _, err := controller.Create(requestContext(), Workspace{ID: "ws-1", OrganizationID: "acme"}, Spec{Repository: "github.com/acme/api"}); err == nil {
+		t.Fatal("expected the create to fail")
+	}
+	if len(store) != 0 {
+		t.Errorf("expected the record to be removed, got %+v", store)
+	}
+	if len(*publisher) != 1 || (*publisher)[0].Type != events.WorkspaceFailed || (*publisher)[0].Attributes[events.StageAttribute] != events.StageCreate {
+		t.Errorf("expected a failed create event, got %+v", *publisher)
+	}
+}
+
+func TestDowngrade(t *testing.T) {
+	publisher := record(t)
+	store := memoryStore{"ws-1": {ID: "ws-1", OrganizationID: "acme", Desired: reconcile.DesiredRunning}}
+	driver := &fakeDriver{}
+	controller := NewController(store, driver)
+	ctx := WithReason(context.Background(), "gpu_idle")
+
+	if err := controller.Downgrade(ctx, "ws-1", "cpu-small"); err != nil {
+		t.Fatal(err)
+	}
+	if len(driver.calls) != 1 || driver.calls[0] != "set_machine_type:cpu-small" || len(*publisher) != 0 {
+		t.Errorf("expected only the machine type to change, got calls %v and events %+v", driver.calls, *publisher)
+	}
+
+	driver.failing, driver.err = "set_machine_type:cpu-tiny", errors.New("no capacity")
+	if err := controller.Downgrade(ctx, "ws-1", "cpu-tiny"); err == nil {
+		t.Fatal("expected the downgrade to fail")
+	}
+	if len(*publisher) != 1 || (*publisher)[0].Attributes[events.StageAttribute] != events.StageDowngrade || (*publisher)[0].Attributes["reason"] != "gpu_idle" {
+		t.Errorf("expected a failed downgrade event, got %+v", *publisher)
+	}
+}
+
+func TestUnknownWorkspaceEmitsNothing(t *testing.T) {
+	publisher := record(t)
+	controller := NewController(memoryStore{}, &fakeDriver{})
+
+	if err := controller.Start(context.Background(), "missing"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected ErrNotFound, got %v", err)
+	}
+	if len(*publisher) != 0 {
+		t.Errorf("expected no events, got %+v", *publisher)
+	}
+}
+
+// TestStartsAreCountedForSLOs drives the SLO tracker from the events the
+// controller emits: only starts count, a failed create doesn't.
+func TestStartsAreCountedForSLOs(t *testing.T) {
+	now := time.Date(2026, 1, 5, 9, 0, 0, 0, time.UTC)
+	tracker := slo.NewTracker(slo.Builtin())
+	tracker.SetClock(func() time.Time { return now })
+	events.SetPublisher(tracker)
+	t.Cleanup(func() { events.SetPublisher(nil) })
+
+	ctx := requestContext()
+	store := memoryStore{}
+	driver := &fakeDriver{clock: &now, startTime: 90 * time.Second}
+	controller := NewController(store, driver)
+	controller.SetClock(func() time.Time { return now })
+
+	driver.failing, driver.err = "create", errors.New("forbidden")
+	if _, err := controller.Create(ctx, Workspace{Name: "broken", OrganizationID: "acme"}, Spec{Repository: "github.com/acme/api"}); err == nil {
+		t.Fatal("expected the create to fail")
+	}
+	driver.failing = ""
+	workspace, err := controller.Create(ctx, Workspace{Name: "api", OrganizationID: "acme"}, Spec{Repository: "github.com/acme/api"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := controller.Start(ctx, workspace.ID); err != nil {
+		t.Fatal(err)
+	}
+	if err := controller.Stop(ctx, workspace.ID); err != nil {
+		t.Fatal(err)
+	}
+	driver.failing, driver.err = "start", errors.New("image pull failed")
+	if err := controller.Start(ctx, workspace.ID); err == nil {
+		t.Fatal("expected the start to fail")
+	}
+	driver.failing, driver.err = "stop", errors.New("timeout")
+	controller.Stop(ctx, workspace.ID)
+
+	counts := slo.NewMemoryStore()
+	if err := tracker.Flush(context.Background(), counts); err != nil {
+		t.Fatal(err)
+	}
+	from, to := now.Add(-time.Hour), now.Add(time.Hour)
+	for name, want := range map[string]slo.Counts{
+		slo.WorkspaceStartSuccess: {Good: 1, Total: 2},
+		slo.WorkspaceStartLatency: {Good: 1, Total: 1},
+	} {
+		if got, _ := counts.Counts(context.Background(), name, from, to); got != want {
+			t.Errorf("expected %+v for %s, got %+v", want, name, got)
+		}
+	}
+}
+
+func TestQuotaIsChargedToOwnerAndProject(t *testing.T) {
+	record(t)
+	ctx := requestContext()
+	usage := quota.NewMemoryStore()
+	manager := quota.NewManager(usage, map[quota.ScopeType]quota.Limits{
+		quota.ScopeUser: {quota.ResourceConcurrentWorkspaces: 1, quota.ResourceStorageGB: 15},
+	}, nil)
+	store := memoryStore{}
+	driver := &fakeDriver{}
+	controller := NewController(store, driver)
+	controller.SetQuota(manager, quota.Rates{quota.ResourceCPUHours: 2})
+
+	owner := quota.Scope{Type: quota.ScopeUser, ID: "user-1"}
+	project := quota.Scope{Type: quota.ScopeProject, ID: "acme/default"}
+	used := func(scope quota.Scope, resource quota.Resource) float64 {
+		value, _ := usage.Used(context.Background(), scope, resource, "")
+		return value
+	}
+
+	first, err := controller.Create(ctx, Workspace{Name: "api", OrganizationID: "acme", OwnerID: "user-1"}, Spec{Repository: "github.com/acme/api", StorageGB: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := controller.Create(ctx, Workspace{Name: "web", OrganizationID: "acme", OwnerID: "user-1"}, Spec{Repository: "github.com/acme/web", StorageGB: 10}); !errors.Is(err, quota.ErrExceeded) {
+		t.Fatalf("expected the storage quota to be exceeded, got %v", err)
+	}
+	if len(store) != 1 {
+		t.Errorf("expected nothing to be created over the quota, got %+v", store)
+	}
+	second, err := controller.Create(ctx, Workspace{Name: "web", OrganizationID: "acme", OwnerID: "user-1"}, Spec{Repository: "github.com/acme/web", StorageGB: 5})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if used(owner, quota.ResourceStorageGB) != 15 || used(project, quota.ResourceStorageGB) != 15 {
+		t.Errorf("expected 15 GB charged to the owner and the project")
+	}
+
+	// a start by someone else, such as a schedule, is charged to the owner
+	if err := controller.Start(WithReason(context.Background(), "schedule"), first.ID); err != nil {
+		t.Fatal(err)
+	}
+	if used(owner, quota.ResourceConcurrentWorkspaces) != 1 || used(project, quota.ResourceConcurrentWorkspaces) != 1 {
+		t.Errorf("expected a slot charged to the owner and the project")
+	}
+	calls := len(driver.calls)
+	if err := controller.Start(ctx, second.ID); !errors.Is(err, quota.ErrExceeded) {
+		t.Fatalf("expected the concurrent workspace quota to be exceeded, got %v", err)
+	}
+	if store[second.ID].Desired != reconcile.DesiredStopped || len(driver.calls) != calls {
+		t.Errorf("expected the workspace over the quota not to start, got %+v and calls %v", store[second.ID], driver.calls)
+	}
+
+	if err := controller.Stop(ctx, first.ID); err != nil {
+		t.Fatal(err)
+	}
+	if used(owner, quota.ResourceConcurrentWorkspaces) != 0 {
+		t.Errorf("expected the stop to return the slot")
+	}
+
+	// a failed start returns the slot it took
+	driver.failing, driver.err = "start", errors.New("image pull failed")
+	if err := controller.Start(ctx, second.ID); err == nil {
+		t.Fatal("expected the start to fail")
+	}
+	if used(owner, quota.ResourceConcurrentWorkspaces) != 0 {
+		t.Errorf("expected the failed start to return the slot")
+	}
+
+	driver.failing = ""
+	if err := controller.Start(ctx, second.ID); err != nil {
+		t.Fatal(err)
+	}
+	if err := controller.Delete(ctx, second.ID); err != nil {
+		t.Fatal(err)
+	}
+	if used(owner, quota.ResourceConcurrentWorkspaces) != 0 || used(owner, quota.ResourceStorageGB) != 10 || used(project, quota.ResourceStorageGB) != 10 {
+		t.Errorf("expected the delete to return the slot and the storage")
+	}
+}
+
+func setStatus(t *testing.T, driver *ResourceDriver, name, phase, message string) {
+	t.Helper()
+	resource, err := driver.resources().Get(context.Background(), name, metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	resource.Object["status"] = map[string]interface{}{
+		"phase":      phase,
+		"conditions": []interface{}{map[string]interface{}{"type": "Ready", "message": message}},
+	}
+	if _, err := driver.resources().Update(context.Background(), resource, metav1.UpdateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestResourceDriver(t *testing.T) {
+	ctx := context.Background()
+	client := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), map[schema.GroupVersionResource]string{
+		WorkspaceResource: "WorkspaceList",
+	})
+	driver := NewResourceDriverForClient(client, "kled", time.Second)
+	workspace := Workspace{ID: "ws-1"}
+
+	err := driver.Create(ctx, workspace, Spec{Repository: "github.com/acme/api", ProviderOptions: map[string]string{"MACHINE_TYPE": "small"}, StorageGB: 20})
+	if err != nil {
+		t.Fatal(err)
+	}
+	resource, err := driver.resources().Get(ctx, "ws-1", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	stopped, _, _ := unstructured.NestedBool(resource.Object, "spec", "stopped")
+	machineType, _, _ := unstructured.NestedString(resource.Object, "spec", "providerOptions", "MACHINE_TYPE")
+	storage, _, _ := unstructured.NestedString(resource.Object, "spec", "resources", "requests", "ephemeral-storage")
+	if !stopped || machineType != "small" || storage != "20Gi" || resource.GetLabels()[IDLabel] != "ws-1" {
+		t.Fatalf("unexpected resource %+v", resource.Object)
+	}
+
+	setStatus(t, driver, "ws-1", PhaseRunning, "")
+	if err := driver.Start(ctx, workspace); err != nil {
+		t.Fatal(err)
+	}
+	resource, _ = driver.resources().Get(ctx, "ws-1", metav1.GetOptions{})
+	if stopped, _, _ := unstructured.NestedBool(resource.Object, "spec", "stopped"); stopped {
+		t.Errorf("expected the resource to be started")
+	}
+
+	// a failed start reports the operator's message and stops the workspace
+	setStatus(t, driver, "ws-1", PhaseError, "devcontainer.json not found")
+	if err := driver.Start(ctx, workspace); err == nil || !strings.Contains(err.Error(), "devcontainer.json not found") {
+		t.Fatalf("expected the error of the operator, got %v", err)
+	}
+	resource, _ = driver.resources().Get(ctx, "ws-1", metav1.GetOptions{})
+	if stopped, _, _ := unstructured.NestedBool(resource.Object, "spec", "stopped"); !stopped {
+		t.Errorf("expected the failed workspace to be stopped")
+	}
+
+	// a running workspace is waited for on its new machine type
+	setStatus(t, driver, "ws-1", PhaseRunning, "")
+	if err := driver.SetMachineType(ctx, Workspace{ID: "ws-1", Desired: reconcile.DesiredRunning}, "cpu-small"); err != nil {
+		t.Fatal(err)
+	}
+	resource, _ = driver.resources().Get(ctx, "ws-1", metav1.GetOptions{})
+	machineType, _, _ = unstructured.NestedString(resource.Object, "spec", "providerOptions", "MACHINE_TYPE")
+	if machineType != "cpu-small" {
+		t.Errorf("expected the machine type to change, got %q", machineType)
+	}
+
+	if err := driver.Delete(ctx, workspace); err != nil {
+		t.Fatal(err)
+	}
+	if err := driver.Delete(ctx, workspace); err != nil {
+		t.Errorf("expected deleting a deleted workspace to succeed, got %v", err)
+	}
+}
@@ -0,0 +1,99 @@
+package wsproto
+
+// featureMessages maps every feature to the message types it adds.
+var featureMessages = map[Feature][]string{
+	FeaturePing:             {"ping"},
+	FeatureEvents:           {"subscribe", "unsubscribe", "event"},
+	FeatureAgentCommands:    {"agent_command"},
+	FeatureMLCommands:       {"ml_command"},
+	FeatureSharedState:      {"update_state", "get_state"},
+	FeatureTaskUpdates:      {"task_update"},
+	FeatureCommandApprovals: {"approve_command"},
+}
+
+// Endpoint describes the features of one WebSocket endpoint. Frames of
+// other features are rejected with CodeUnsupportedType.
+type Endpoint struct {
+	Features []Feature
+}
+
+func NewEndpoint(features ...Feature) Endpoint {
+	return Endpoint{Features: features}
+}
+
+func (e Endpoint) supports(feature Feature) bool {
+	for _, f := range e.Features {
+		if f == feature {
+			return true
+		}
+	}
+	return false
+}
+
+// Accepts reports whether the endpoint handles messageType. The handshake is
+// accepted everywhere.
+func (e Endpoint) Accepts(messageType string) bool {
+	if messageType == "hello" {
+		return true
+	}
+	for _, feature := range e.Features {
+		for _, t := range featureMessages[feature] {
+			if t == messageType {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Decode is Decode restricted to the message types of the endpoint.
+func (e Endpoint) Decode(frame []byte) (Message, *Error) {
+	message, err := Decode(frame)
+	if err != nil {
+		return nil, err
+	}
+	if !e.Accepts(message.MessageType()) {
+		return nil, &Error{
+			Code:    CodeUnsupportedType,
+			Message: message.MessageType() + " is not supported on this endpoint",
+			Field:   "type",
+			ID:      message.RequestID(),
+		}
+	}
+	return message, nil
+}
+
+// Negotiate picks the newest version spoken by both sides.
+func (e Endpoint) Negotiate(hello *Hello) (*Welcome, *Error) {
+	version := 0
+	for _, v := range hello.Versions {
+		if v >= MinVersion && v <= Version && v > version {
+			version = v
+		}
+	}
+	if version == 0 {
+		return nil, &Error{
+			Code:    CodeUnsupportedVersion,
+			Message: "no common protocol version",
+			Field:   "versions",
+			ID:      hello.ID,
+		}
+	}
+
+	welcome := &Welcome{Type: "welcome", ID: hello.ID, Version: version, Features: e.Features}
+	for _, feature := range hello.Features {
+		if !e.supports(feature) {
+			welcome.Unsupported = append(welcome.Unsupported, feature)
+		}
+	}
+	return welcome, nil
+}
+
+// Info describes the protocol for the connection_established message.
+func (e Endpoint) Info() ProtocolInfo {
+	versions := []int{}
+	for v := MinVersion; v <= Version; v++ {
+		versions = append(versions, v)
+	}
+	return ProtocolInfo{Versions: versions, Features: e.Features}
+}
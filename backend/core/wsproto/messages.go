@@ -0,0 +1,166 @@
+package wsproto
+
+import "encoding/json"
+
+// Hello starts the version handshake.
+type Hello struct {
+	Envelope
+	// Versions lists every protocol version the client speaks.
+	Versions []int `json:"versions"`
+	// Features optionally lists the features the client wants to use, so
+	// it learns early which of them the endpoint lacks.
+	Features []Feature `json:"features,omitempty"`
+}
+
+func (m *Hello) Validate() *Error {
+	if len(m.Versions) == 0 {
+		return missingField("versions")
+	}
+	return nil
+}
+
+type Ping struct {
+	Envelope
+	// Timestamp is echoed in the pong.
+	Timestamp json.RawMessage `json:"timestamp,omitempty"`
+}
+
+func (m *Ping) Validate() *Error { return nil }
+
+type Subscribe struct {
+	Envelope
+	EventTypes []string `json:"event_types"`
+}
+
+func (m *Subscribe) Validate() *Error { return validateEventTypes(m.EventTypes) }
+
+type Unsubscribe struct {
+	Envelope
+	EventTypes []string `json:"event_types"`
+}
+
+func (m *Unsubscribe) Validate() *Error { return validateEventTypes(m.EventTypes) }
+
+func validateEventTypes(eventTypes []string) *Error {
+	if len(eventTypes) == 0 {
+		return missingField("event_types")
+	}
+	for _, eventType := range eventTypes {
+		if eventType == "" {
+			return &Error{Code: CodeInvalidField, Message: "event types must not be empty", Field: "event_types"}
+		}
+	}
+	return nil
+}
+
+type Event struct {
+	Envelope
+	EventType string                 `json:"event_type"`
+	Data      map[string]interface{} `json:"data,omitempty"`
+}
+
+func (m *Event) Validate() *Error {
+	if m.EventType == "" {
+		return missingField("event_type")
+	}
+	return nil
+}
+
+type AgentCommand struct {
+	Envelope
+	Command string `json:"command"`
+	// WorkspaceID scopes the permission check to one workspace.
+	WorkspaceID string                 `json:"workspace_id,omitempty"`
+	Data        map[string]interface{} `json:"data,omitempty"`
+	Params      map[string]interface{} `json:"params,omitempty"`
+}
+
+func (m *AgentCommand) Validate() *Error {
+	if m.Command == "" {
+		return missingField("command")
+	}
+	return nil
+}
+
+// ApproveCommand decides on an agent command blocked by the tool policy,
+// announced in a command_approval_requested message.
+type ApproveCommand struct {
+	Envelope
+	ApprovalID string `json:"approval_id"`
+	// Approve is required, so a missing field doesn't reject by accident.
+	Approve *bool  `json:"approve"`
+	Comment string `json:"comment,omitempty"`
+}
+
+func (m *ApproveCommand) Validate() *Error {
+	if m.ApprovalID == "" {
+		return missingField("approval_id")
+	}
+	if m.Approve == nil {
+		return missingField("approve")
+	}
+	return nil
+}
+
+type MLCommand struct {
+	Envelope
+	Command string                 `json:"command"`
+	Data    map[string]interface{} `json:"data,omitempty"`
+}
+
+func (m *MLCommand) Validate() *Error {
+	if m.Command == "" {
+		return missingField("command")
+	}
+	return nil
+}
+
+type UpdateState struct {
+	Envelope
+	Data map[string]interface{} `json:"data"`
+}
+
+func (m *UpdateState) Validate() *Error {
+	if m.Data == nil {
+		return missingField("data")
+	}
+	return nil
+}
+
+type GetState struct {
+	Envelope
+}
+
+func (m *GetState) Validate() *Error { return nil }
+
+type TaskUpdate struct {
+	Envelope
+	TaskID  string `json:"task_id"`
+	Status  string `json:"status,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+func (m *TaskUpdate) Validate() *Error {
+	if m.TaskID == "" {
+		return missingField("task_id")
+	}
+	return nil
+}
+
+// Welcome answers a hello.
+type Welcome struct {
+	Type     string    `json:"type"`
+	ID       string    `json:"id,omitempty"`
+	Version  int       `json:"version"`
+	Features []Feature `json:"features"`
+	// Unsupported lists the features requested in the hello that the
+	// endpoint doesn't support.
+	Unsupported []Feature `json:"unsupported,omitempty"`
+}
+
+// ProtocolInfo is included in the connection_established message, so clients
+// that skip the handshake can still discover the protocol.
+type ProtocolInfo struct {
+	Versions []int     `json:"versions"`
+	Features []Feature `json:"features"`
+}
@@ -0,0 +1,197 @@
+// Package wsproto defines the message protocol spoken over the backend's
+// WebSocket endpoints.
+//
+// Every frame is a JSON object with a "type" field and an optional "id",
+// which the server echoes in the reply or error for that frame. Frames are
+// decoded into typed messages and validated before they are handled:
+// unknown fields, wrong field types and missing required fields are rejected
+// with an ErrorMessage carrying a stable ErrorCode instead of being ignored.
+//
+// A client may send a "hello" listing the protocol versions it speaks. The
+// server answers with a "welcome" naming the version it picked and the
+// features the endpoint supports. Version 1 is the original untyped protocol;
+// error frames still carry its "message" field, so clients that skip the
+// handshake keep working.
+package wsproto
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+const (
+	// Version is the newest protocol version spoken by the server.
+	Version = 2
+	// MinVersion is the oldest version still accepted in a hello.
+	MinVersion = 1
+)
+
+// Feature names a capability of an endpoint, announced in the welcome.
+type Feature string
+
+const (
+	FeaturePing          Feature = "ping"
+	FeatureEvents        Feature = "events"
+	FeatureAgentCommands Feature = "agent_commands"
+	FeatureMLCommands    Feature = "ml_commands"
+	FeatureSharedState   Feature = "shared_state"
+	FeatureTaskUpdates   Feature = "task_updates"
+	// FeatureCommandApprovals lets humans decide on agent commands blocked
+	// by the tool policy.
+	FeatureCommandApprovals Feature = "command_approvals"
+)
+
+type ErrorCode string
+
+const (
+	CodeInvalidJSON        ErrorCode = "invalid_json"
+	CodeUnknownType        ErrorCode = "unknown_type"
+	CodeUnsupportedType    ErrorCode = "unsupported_type"
+	CodeMissingField       ErrorCode = "missing_field"
+	CodeInvalidField       ErrorCode = "invalid_field"
+	CodeUnsupportedVersion ErrorCode = "unsupported_version"
+	CodePermissionDenied   ErrorCode = "permission_denied"
+	CodeInternal           ErrorCode = "internal_error"
+)
+
+// Error is a protocol error reported to the client as an ErrorMessage.
+type Error struct {
+	Code    ErrorCode
+	Message string
+	// Field is the offending field, if any.
+	Field string
+	// ID echoes the id of the frame that caused the error.
+	ID string
+}
+
+func (e *Error) Error() string {
+	if e.Field != "" {
+		return fmt.Sprintf("%s: %s (field %s)", e.Code, e.Message, e.Field)
+	}
+	return fmt.Sprintf("%s: %s", e.Code, e.Message)
+}
+
+func Errorf(code ErrorCode, format string, args ...interface{}) *Error {
+	return &Error{Code: code, Message: fmt.Sprintf(format, args...)}
+}
+
+func missingField(field string) *Error {
+	return &Error{Code: CodeMissingField, Message: field + " is required", Field: field}
+}
+
+// ErrorMessage is sent to the client for every rejected frame.
+type ErrorMessage struct {
+	Type    string    `json:"type"`
+	Code    ErrorCode `json:"code"`
+	Message string    `json:"message"`
+	Field   string    `json:"field,omitempty"`
+	ID      string    `json:"id,omitempty"`
+}
+
+// Frame returns the message sent to the client for e.
+func (e *Error) Frame() ErrorMessage {
+	return ErrorMessage{Type: "error", Code: e.Code, Message: e.Message, Field: e.Field, ID: e.ID}
+}
+
+// Envelope holds the fields shared by every message.
+type Envelope struct {
+	Type string `json:"type"`
+	ID   string `json:"id,omitempty"`
+}
+
+func (e Envelope) MessageType() string { return e.Type }
+
+func (e Envelope) RequestID() string { return e.ID }
+
+// Message is a decoded client frame.
+type Message interface {
+	MessageType() string
+	RequestID() string
+	Validate() *Error
+}
+
+var messageTypes = map[string]func() Message{
+	"hello":           func() Message { return &Hello{} },
+	"ping":            func() Message { return &Ping{} },
+	"subscribe":       func() Message { return &Subscribe{} },
+	"unsubscribe":     func() Message { return &Unsubscribe{} },
+	"event":           func() Message { return &Event{} },
+	"agent_command":   func() Message { return &AgentCommand{} },
+	"ml_command":      func() Message { return &MLCommand{} },
+	"update_state":    func() Message { return &UpdateState{} },
+	"get_state":       func() Message { return &GetState{} },
+	"task_update":     func() Message { return &TaskUpdate{} },
+	"approve_command": func() Message { return &ApproveCommand{} },
+}
+
+const unknownFieldPrefix = `json: unknown field "`
+
+// Decode parses and validates a client frame.
+func Decode(frame []byte) (Message, *Error) {
+	var envelope Envelope
+	if err := json.Unmarshal(frame, &envelope); err != nil {
+		var typeErr *json.UnmarshalTypeError
+		if errors.As(err, &typeErr) && typeErr.Field != "" {
+			return nil, &Error{Code: CodeInvalidField, Message: "must be a string", Field: typeErr.Field}
+		}
+		return nil, Errorf(CodeInvalidJSON, "frame is not a JSON object")
+	}
+	if envelope.Type == "" {
+		return nil, &Error{Code: CodeMissingField, Message: "type is required", Field: "type", ID: envelope.ID}
+	}
+
+	factory, ok := messageTypes[envelope.Type]
+	if !ok {
+		return nil, &Error{Code: CodeUnknownType, Message: "unknown message type " + envelope.Type, Field: "type", ID: envelope.ID}
+	}
+
+	message := factory()
+	decoder := json.NewDecoder(bytes.NewReader(frame))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(message); err != nil {
+		protocolErr := decodeError(err)
+		protocolErr.ID = envelope.ID
+		return nil, protocolErr
+	}
+
+	if err := message.Validate(); err != nil {
+		err.ID = envelope.ID
+		return nil, err
+	}
+	return message, nil
+}
+
+func decodeError(err error) *Error {
+	var typeErr *json.UnmarshalTypeError
+	if errors.As(err, &typeErr) {
+		// Newer Go versions report the full path, such as "event_types.0";
+		// the top-level field is reported either way.
+		field := strings.SplitN(typeErr.Field, ".", 2)[0]
+		return &Error{Code: CodeInvalidField, Message: "must be " + jsonKind(typeErr.Type.Kind().String()), Field: field}
+	}
+	if msg := err.Error(); strings.HasPrefix(msg, unknownFieldPrefix) {
+		field := strings.TrimSuffix(strings.TrimPrefix(msg, unknownFieldPrefix), `"`)
+		return &Error{Code: CodeInvalidField, Message: "unknown field", Field: field}
+	}
+	return Errorf(CodeInvalidJSON, "%v", err)
+}
+
+func jsonKind(kind string) string {
+	switch kind {
+	case "string":
+		return "a string"
+	case "slice", "array":
+		return "an array"
+	case "map", "struct":
+		return "an object"
+	case "bool":
+		return "a boolean"
+	case "int", "int64", "float64":
+		return "a number"
+	default:
+		return "a " + kind
+	}
+}
@@ -0,0 +1,95 @@
+package wsproto
+
+import (
+	"testing"
+)
+
+func TestDecodeValidMessages(t *testing.T) {
+	message, err := Decode([]byte(`{"type":"subscribe","id":"r1","event_types":["task.updated"]}`))
+	if err != nil {
+		t.Fatalf("Decode: %v", err)
+	}
+	subscribe, ok := message.(*Subscribe)
+	if !ok {
+		t.Fatalf("got %T, want *Subscribe", message)
+	}
+	if subscribe.ID != "r1" || len(subscribe.EventTypes) != 1 {
+		t.Fatalf("decoded %+v", subscribe)
+	}
+
+	if _, err := Decode([]byte(`{"type":"ping","timestamp":1700000000}`)); err != nil {
+		t.Fatalf("Decode ping: %v", err)
+	}
+}
+
+func TestDecodeErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		frame string
+		code  ErrorCode
+		field string
+	}{
+		{"not json", `{"type":`, CodeInvalidJSON, ""},
+		{"not an object", `[1,2]`, CodeInvalidJSON, ""},
+		{"missing type", `{"id":"r1"}`, CodeMissingField, "type"},
+		{"type not a string", `{"type":5}`, CodeInvalidField, "type"},
+		{"unknown type", `{"type":"teleport"}`, CodeUnknownType, "type"},
+		{"unknown field", `{"type":"get_state","stateid":"x"}`, CodeInvalidField, "stateid"},
+		{"wrong field type", `{"type":"event","event_type":"x","data":"oops"}`, CodeInvalidField, "data"},
+		{"wrong element type", `{"type":"subscribe","event_types":[1]}`, CodeInvalidField, "event_types"},
+		{"missing required field", `{"type":"agent_command","id":"r2"}`, CodeMissingField, "command"},
+		{"empty event types", `{"type":"unsubscribe","event_types":[]}`, CodeMissingField, "event_types"},
+		{"approval without a decision", `{"type":"approve_command","approval_id":"a1"}`, CodeMissingField, "approve"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Decode([]byte(tt.frame))
+			if err == nil {
+				t.Fatal("expected an error")
+			}
+			if err.Code != tt.code || err.Field != tt.field {
+				t.Fatalf("got %s on %q, want %s on %q", err.Code, err.Field, tt.code, tt.field)
+			}
+		})
+	}
+
+	_, err := Decode([]byte(`{"type":"agent_command","id":"r2"}`))
+	if err.ID != "r2" {
+		t.Fatalf("error id = %q, want the frame's id", err.ID)
+	}
+}
+
+func TestEndpointRejectsOtherFeatures(t *testing.T) {
+	endpoint := NewEndpoint(FeaturePing, FeatureSharedState)
+
+	if _, err := endpoint.Decode([]byte(`{"type":"get_state"}`)); err != nil {
+		t.Fatalf("Decode: %v", err)
+	}
+	if _, err := endpoint.Decode([]byte(`{"type":"hello","versions":[1]}`)); err != nil {
+		t.Fatalf("hello must be accepted everywhere: %v", err)
+	}
+	_, err := endpoint.Decode([]byte(`{"type":"ml_command","command":"train"}`))
+	if err == nil || err.Code != CodeUnsupportedType {
+		t.Fatalf("got %v, want %s", err, CodeUnsupportedType)
+	}
+}
+
+func TestNegotiate(t *testing.T) {
+	endpoint := NewEndpoint(FeaturePing, FeatureEvents)
+
+	welcome, err := endpoint.Negotiate(&Hello{Envelope: Envelope{ID: "h"}, Versions: []int{1, 2, 7}, Features: []Feature{FeatureEvents, FeatureMLCommands}})
+	if err != nil {
+		t.Fatalf("Negotiate: %v", err)
+	}
+	if welcome.Version != Version || welcome.ID != "h" {
+		t.Errorf("welcome = %+v", welcome)
+	}
+	if len(welcome.Unsupported) != 1 || welcome.Unsupported[0] != FeatureMLCommands {
+		t.Errorf("unsupported = %v", welcome.Unsupported)
+	}
+
+	if _, err := endpoint.Negotiate(&Hello{Versions: []int{9}}); err == nil || err.Code != CodeUnsupportedVersion {
+		t.Fatalf("got %v, want %s", err, CodeUnsupportedVersion)
+	}
+}
@@ -0,0 +1,100 @@
+package wsqueue
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	DefaultHistorySize = 100
+	// historyMaxAge bounds how long a client can be away and still resume.
+	historyMaxAge = 10 * time.Minute
+)
+
+type historyEntry struct {
+	id   string
+	data []byte
+	at   time.Time
+}
+
+// History keeps the last messages of each key, so a client resuming a
+// stream is sent what it missed instead of a full resynchronization.
+type History struct {
+	size   int
+	maxAge time.Duration
+	now    func() time.Time
+
+	mu        sync.Mutex
+	keys      map[string][]historyEntry
+	lastSweep time.Time
+}
+
+// NewHistory keeps up to size messages per key for at most maxAge.
+func NewHistory(size int, maxAge time.Duration) *History {
+	if size < 1 {
+		size = DefaultHistorySize
+	}
+	if maxAge <= 0 {
+		maxAge = historyMaxAge
+	}
+	return &History{size: size, maxAge: maxAge, now: time.Now, keys: make(map[string][]historyEntry)}
+}
+
+func (h *History) Append(key, id string, data []byte) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	now := h.now()
+	entries := append(h.keys[key], historyEntry{id: id, data: data, at: now})
+	if len(entries) > h.size {
+		entries = append([]historyEntry(nil), entries[len(entries)-h.size:]...)
+	}
+	h.keys[key] = entries
+
+	// Keys that stopped receiving messages are removed once they expire.
+	if now.Sub(h.lastSweep) >= time.Minute {
+		h.lastSweep = now
+		for k, e := range h.keys {
+			if now.Sub(e[len(e)-1].at) > h.maxAge {
+				delete(h.keys, k)
+			}
+		}
+	}
+}
+
+// Since returns the messages of key after the one with id, oldest first. It
+// returns false if id is no longer in the history, in which case the client
+// has to resynchronize.
+func (h *History) Since(key, id string) ([][]byte, bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	entries := h.keys[key]
+	cutoff := h.now().Add(-h.maxAge)
+	for i := len(entries) - 1; i >= 0; i-- {
+		if entries[i].id != id {
+			continue
+		}
+		if entries[i].at.Before(cutoff) {
+			return nil, false
+		}
+		messages := make([][]byte, 0, len(entries)-i-1)
+		for _, entry := range entries[i+1:] {
+			messages = append(messages, entry.data)
+		}
+		return messages, true
+	}
+	return nil, false
+}
+
+// Latest returns the id of the newest message of key, or "" if there is none.
+func (h *History) Latest(key string) string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	entries := h.keys[key]
+	if len(entries) == 0 || h.now().Sub(entries[len(entries)-1].at) > h.maxAge {
+		return ""
+	}
+	return entries[len(entries)-1].id
+}
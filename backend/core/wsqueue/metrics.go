@@ -0,0 +1,111 @@
+package wsqueue
+
+import (
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	droppedTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "kled_ws_messages_dropped_total",
+		Help: "WebSocket messages dropped from full send queues, by endpoint.",
+	}, []string{"endpoint"})
+	coalescedTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "kled_ws_messages_coalesced_total",
+		Help: "WebSocket messages merged into a pending message with the same key, by endpoint.",
+	}, []string{"endpoint"})
+	disconnectsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "kled_ws_slow_consumer_disconnects_total",
+		Help: "WebSocket connections closed because their send queue was full, by endpoint.",
+	}, []string{"endpoint"})
+	deliveryLag = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "kled_ws_delivery_lag_seconds",
+		Help:    "Time WebSocket messages spent in the send queue, by endpoint.",
+		Buckets: []float64{.001, .005, .01, .05, .1, .5, 1, 5, 10, 30},
+	}, []string{"endpoint"})
+)
+
+func init() {
+	prometheus.MustRegister(droppedTotal, coalescedTotal, disconnectsTotal, deliveryLag, consumers)
+}
+
+var (
+	queueDepthDesc = prometheus.NewDesc("kled_ws_consumer_queue_depth",
+		"Pending messages in the send queue of an open WebSocket connection.",
+		[]string{"endpoint", "connection_id"}, nil)
+	queueLagDesc = prometheus.NewDesc("kled_ws_consumer_lag_seconds",
+		"Age of the oldest pending message of an open WebSocket connection.",
+		[]string{"endpoint", "connection_id"}, nil)
+)
+
+// consumerCollector reports the lag of every open queue. Series of closed
+// connections disappear with them instead of lingering as stale gauges.
+type consumerCollector struct {
+	mu     sync.Mutex
+	queues map[*Queue]struct{}
+}
+
+var consumers = &consumerCollector{queues: make(map[*Queue]struct{})}
+
+func track(q *Queue) {
+	consumers.mu.Lock()
+	consumers.queues[q] = struct{}{}
+	consumers.mu.Unlock()
+}
+
+func untrack(q *Queue) {
+	consumers.mu.Lock()
+	delete(consumers.queues, q)
+	consumers.mu.Unlock()
+}
+
+// ConsumerStats sums up the send queues of the open connections.
+type ConsumerStats struct {
+	Connections int
+	// Depth is the number of pending messages of all queues.
+	Depth int
+	// MaxLag is the lag of the queue furthest behind.
+	MaxLag time.Duration
+}
+
+// Consumers returns the stats of the open queues.
+func Consumers() ConsumerStats {
+	consumers.mu.Lock()
+	queues := make([]*Queue, 0, len(consumers.queues))
+	for q := range consumers.queues {
+		queues = append(queues, q)
+	}
+	consumers.mu.Unlock()
+
+	stats := ConsumerStats{Connections: len(queues)}
+	for _, q := range queues {
+		queueStats := q.Stats()
+		stats.Depth += queueStats.Depth
+		if queueStats.Lag > stats.MaxLag {
+			stats.MaxLag = queueStats.Lag
+		}
+	}
+	return stats
+}
+
+func (c *consumerCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- queueDepthDesc
+	ch <- queueLagDesc
+}
+
+func (c *consumerCollector) Collect(ch chan<- prometheus.Metric) {
+	c.mu.Lock()
+	queues := make([]*Queue, 0, len(c.queues))
+	for q := range c.queues {
+		queues = append(queues, q)
+	}
+	c.mu.Unlock()
+
+	for _, q := range queues {
+		stats := q.Stats()
+		ch <- prometheus.MustNewConstMetric(queueDepthDesc, prometheus.GaugeValue, float64(stats.Depth), q.endpoint, q.connectionID)
+		ch <- prometheus.MustNewConstMetric(queueLagDesc, prometheus.GaugeValue, stats.Lag.Seconds(), q.endpoint, q.connectionID)
+	}
+}
@@ -0,0 +1,252 @@
+// Package wsqueue implements the per-connection send queues of the backend's
+// WebSocket endpoints.
+//
+// A queue holds at most BufferSize messages. When a slow client lets it fill
+// up, the queue either drops the oldest pending message or asks the caller to
+// disconnect the client, depending on Policy. Messages pushed with a key
+// replace a pending message with the same key instead of queuing behind it,
+// so a client that falls behind on rapid state updates receives the latest
+// state rather than every intermediate one.
+//
+// History keeps the recent messages of each stream, so clients can resume
+// after a reconnect.
+//
+// The configuration is read from the AGENT_WS_BUFFER_SIZE,
+// AGENT_WS_SLOW_CONSUMER_POLICY, AGENT_WS_COALESCE and AGENT_WS_HISTORY_SIZE
+// settings.
+package wsqueue
+
+import (
+	"errors"
+	"log"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/spectrumwebco/agent_runtime/backend/core/config/env"
+)
+
+var queueLogger = log.New(os.Stdout, "kled.wsqueue: ", log.LstdFlags)
+
+// Policy decides what happens when a message is pushed to a full queue.
+type Policy string
+
+const (
+	// PolicyDropOldest discards the oldest pending message. It suits clients
+	// that can resynchronize, e.g. by requesting the full state.
+	PolicyDropOldest Policy = "drop_oldest"
+	// PolicyDisconnect rejects the message so the caller closes the
+	// connection, and the client reconnects with a fresh state.
+	PolicyDisconnect Policy = "disconnect"
+)
+
+const DefaultBufferSize = 256
+
+var (
+	// ErrFull is returned by Push under PolicyDisconnect when the queue is
+	// full. The caller is expected to close the connection.
+	ErrFull = errors.New("send queue is full")
+	// ErrClosed is returned by Push after Close.
+	ErrClosed = errors.New("send queue is closed")
+)
+
+type Config struct {
+	BufferSize int    `json:"buffer_size"`
+	Policy     Policy `json:"policy"`
+	// Coalesce enables replacing pending messages pushed with the same key.
+	Coalesce bool `json:"coalesce"`
+	// HistorySize is the number of messages per stream kept for resuming.
+	HistorySize int `json:"history_size"`
+}
+
+var Default = env.Once(FromEnv)
+
+func FromEnv() Config {
+	config := Config{
+		BufferSize:  DefaultBufferSize,
+		Policy:      PolicyDisconnect,
+		Coalesce:    true,
+		HistorySize: DefaultHistorySize,
+	}
+	read := env.NewReader(queueLogger)
+	read.Bool("AGENT_WS_COALESCE", &config.Coalesce)
+	read.Int("AGENT_WS_BUFFER_SIZE", &config.BufferSize, 1)
+	read.Int("AGENT_WS_HISTORY_SIZE", &config.HistorySize, 1)
+	policy := string(config.Policy)
+	read.OneOf("AGENT_WS_SLOW_CONSUMER_POLICY", &policy, string(PolicyDropOldest), string(PolicyDisconnect))
+	config.Policy = Policy(policy)
+	return config
+}
+
+// Variables returns the variables FromEnv reads c from.
+func (c Config) Variables() map[string]string {
+	return map[string]string{
+		"AGENT_WS_BUFFER_SIZE":          strconv.Itoa(c.BufferSize),
+		"AGENT_WS_SLOW_CONSUMER_POLICY": string(c.Policy),
+		"AGENT_WS_COALESCE":             strconv.FormatBool(c.Coalesce),
+		"AGENT_WS_HISTORY_SIZE":         strconv.Itoa(c.HistorySize),
+	}
+}
+
+// MergeFunc combines a pending message with a newer one pushed with the same
+// key.
+type MergeFunc func(pending, next []byte) []byte
+
+type item struct {
+	key    string
+	data   []byte
+	queued time.Time
+}
+
+// Queue is the send queue of one connection. It is safe for concurrent use.
+type Queue struct {
+	endpoint     string
+	connectionID string
+	config       Config
+
+	mu        sync.Mutex
+	items     []item
+	closed    bool
+	dropped   uint64
+	coalesced uint64
+
+	ready chan struct{}
+	done  chan struct{}
+}
+
+// New returns the queue of a connection. The endpoint and connection ID label
+// its metrics.
+func New(endpoint, connectionID string, config Config) *Queue {
+	if config.BufferSize < 1 {
+		config.BufferSize = DefaultBufferSize
+	}
+	if config.Policy == "" {
+		config.Policy = PolicyDisconnect
+	}
+
+	q := &Queue{
+		endpoint:     endpoint,
+		connectionID: connectionID,
+		config:       config,
+		ready:        make(chan struct{}, 1),
+		done:         make(chan struct{}),
+	}
+	track(q)
+	return q
+}
+
+// Push appends a message.
+func (q *Queue) Push(data []byte) error {
+	return q.PushCoalesced("", data, nil)
+}
+
+// PushCoalesced appends a message, or merges it into a pending message with
+// the same key if coalescing is enabled. A merged message keeps its place in
+// the queue. A nil merge replaces the pending message.
+func (q *Queue) PushCoalesced(key string, data []byte, merge MergeFunc) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.closed {
+		return ErrClosed
+	}
+
+	if key != "" && q.config.Coalesce {
+		for i := len(q.items) - 1; i >= 0; i-- {
+			if q.items[i].key != key {
+				continue
+			}
+			if merge != nil {
+				data = merge(q.items[i].data, data)
+			}
+			q.items[i].data = data
+			q.coalesced++
+			coalescedTotal.WithLabelValues(q.endpoint).Inc()
+			return nil
+		}
+	}
+
+	if len(q.items) >= q.config.BufferSize {
+		if q.config.Policy == PolicyDisconnect {
+			disconnectsTotal.WithLabelValues(q.endpoint).Inc()
+			return ErrFull
+		}
+		q.items[0] = item{}
+		q.items = q.items[1:]
+		q.dropped++
+		droppedTotal.WithLabelValues(q.endpoint).Inc()
+	}
+
+	q.items = append(q.items, item{key: key, data: data, queued: time.Now()})
+	select {
+	case q.ready <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// Ready is signaled after a push. The writer then calls Drain.
+func (q *Queue) Ready() <-chan struct{} {
+	return q.ready
+}
+
+// Done is closed by Close.
+func (q *Queue) Done() <-chan struct{} {
+	return q.done
+}
+
+// Drain removes and returns every pending message in order.
+func (q *Queue) Drain() [][]byte {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if len(q.items) == 0 {
+		return nil
+	}
+
+	now := time.Now()
+	messages := make([][]byte, len(q.items))
+	for i, it := range q.items {
+		messages[i] = it.data
+		deliveryLag.WithLabelValues(q.endpoint).Observe(now.Sub(it.queued).Seconds())
+	}
+	q.items = nil
+	return messages
+}
+
+// Close discards pending messages and rejects further pushes.
+func (q *Queue) Close() {
+	q.mu.Lock()
+	if q.closed {
+		q.mu.Unlock()
+		return
+	}
+	q.closed = true
+	q.items = nil
+	q.mu.Unlock()
+
+	close(q.done)
+	untrack(q)
+}
+
+// Stats describes how far a connection lags behind.
+type Stats struct {
+	// Depth is the number of pending messages.
+	Depth int
+	// Lag is the age of the oldest pending message.
+	Lag       time.Duration
+	Dropped   uint64
+	Coalesced uint64
+}
+
+func (q *Queue) Stats() Stats {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	stats := Stats{Depth: len(q.items), Dropped: q.dropped, Coalesced: q.coalesced}
+	if len(q.items) > 0 {
+		stats.Lag = time.Since(q.items[0].queued)
+	}
+	return stats
+}
@@ -0,0 +1,155 @@
+package wsqueue
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func drained(q *Queue) string {
+	var parts []string
+	for _, message := range q.Drain() {
+		parts = append(parts, string(message))
+	}
+	return strings.Join(parts, ",")
+}
+
+func TestDropOldest(t *testing.T) {
+	q := New("test", "c1", Config{BufferSize: 2, Policy: PolicyDropOldest})
+	defer q.Close()
+
+	for _, message := range []string{"a", "b", "c"} {
+		if err := q.Push([]byte(message)); err != nil {
+			t.Fatalf("Push(%s): %v", message, err)
+		}
+	}
+	if stats := q.Stats(); stats.Depth != 2 || stats.Dropped != 1 {
+		t.Fatalf("stats = %+v", stats)
+	}
+	if got := drained(q); got != "b,c" {
+		t.Fatalf("drained %q, want b,c", got)
+	}
+}
+
+func TestDisconnect(t *testing.T) {
+	q := New("test", "c2", Config{BufferSize: 1, Policy: PolicyDisconnect})
+
+	if err := q.Push([]byte("a")); err != nil {
+		t.Fatal(err)
+	}
+	if err := q.Push([]byte("b")); err != ErrFull {
+		t.Fatalf("got %v, want ErrFull", err)
+	}
+
+	q.Close()
+	if err := q.Push([]byte("c")); err != ErrClosed {
+		t.Fatalf("got %v, want ErrClosed", err)
+	}
+	select {
+	case <-q.Done():
+	default:
+		t.Fatal("Done not closed")
+	}
+}
+
+func TestCoalesce(t *testing.T) {
+	q := New("test", "c3", Config{BufferSize: 2, Policy: PolicyDisconnect, Coalesce: true})
+	defer q.Close()
+
+	concat := func(pending, next []byte) []byte {
+		return append(append(append([]byte{}, pending...), '+'), next...)
+	}
+	q.PushCoalesced("state", []byte("s1"), concat)
+	q.Push([]byte("event"))
+	// Coalescing doesn't take a slot, so the full queue accepts these.
+	if err := q.PushCoalesced("state", []byte("s2"), concat); err != nil {
+		t.Fatal(err)
+	}
+	if err := q.PushCoalesced("state", []byte("s3"), nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if stats := q.Stats(); stats.Depth != 2 || stats.Coalesced != 2 {
+		t.Fatalf("stats = %+v", stats)
+	}
+	if got := drained(q); got != "s3,event" {
+		t.Fatalf("drained %q, want s3,event", got)
+	}
+
+	// Once delivered, a key queues again.
+	q.PushCoalesced("state", []byte("s4"), concat)
+	if got := drained(q); got != "s4" {
+		t.Fatalf("drained %q, want s4", got)
+	}
+}
+
+func TestCoalesceDisabled(t *testing.T) {
+	q := New("test", "c4", Config{BufferSize: 4})
+	defer q.Close()
+
+	q.PushCoalesced("state", []byte("s1"), nil)
+	q.PushCoalesced("state", []byte("s2"), nil)
+	if got := drained(q); got != "s1,s2" {
+		t.Fatalf("drained %q, want s1,s2", got)
+	}
+}
+
+func TestReadySignal(t *testing.T) {
+	q := New("test", "c5", Config{})
+	defer q.Close()
+
+	q.Push([]byte("a"))
+	q.Push([]byte("b"))
+	select {
+	case <-q.Ready():
+	default:
+		t.Fatal("Ready not signaled")
+	}
+	if got := drained(q); got != "a,b" {
+		t.Fatalf("drained %q", got)
+	}
+	if q.Drain() != nil {
+		t.Fatal("second Drain returned messages")
+	}
+}
+
+func TestHistory(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	h := NewHistory(3, time.Minute)
+	h.now = func() time.Time { return now }
+
+	for i, id := range []string{"e1", "e2", "e3", "e4"} {
+		h.Append("task:t1", id, []byte{byte('a' + i)})
+	}
+	h.Append("task:t2", "x1", []byte("x"))
+
+	messages, ok := h.Since("task:t1", "e2")
+	if !ok || len(messages) != 2 || string(messages[0]) != "c" || string(messages[1]) != "d" {
+		t.Fatalf("Since(e2) = %q, %v", messages, ok)
+	}
+	if messages, ok := h.Since("task:t1", "e4"); !ok || len(messages) != 0 {
+		t.Fatalf("Since(e4) = %q, %v", messages, ok)
+	}
+	// e1 was pushed out by the size limit.
+	if _, ok := h.Since("task:t1", "e1"); ok {
+		t.Fatal("Since(e1) found an evicted message")
+	}
+	if _, ok := h.Since("task:t2", "e3"); ok {
+		t.Fatal("Since found an id of another key")
+	}
+	if latest := h.Latest("task:t1"); latest != "e4" {
+		t.Fatalf("Latest = %q", latest)
+	}
+
+	now = now.Add(2 * time.Minute)
+	if _, ok := h.Since("task:t1", "e3"); ok {
+		t.Fatal("Since found an expired message")
+	}
+	if latest := h.Latest("task:t1"); latest != "" {
+		t.Fatalf("Latest of expired key = %q", latest)
+	}
+	h.Append("task:t3", "y1", nil)
+	if _, ok := h.keys["task:t1"]; ok {
+		t.Fatal("expired key was not swept")
+	}
+}
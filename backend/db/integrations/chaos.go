@@ -0,0 +1,168 @@
+package integrations
+
+import (
+	"context"
+
+	"github.com/spectrumwebco/agent_runtime/backend/core/chaos"
+)
+
+// The chaos stores inject the faults of targets "kv", "sql", "mq" and
+// "events" before calling the store they wrap. They are only used when
+// fault injection is enabled.
+
+func withChaosKVStore(store KVStore) KVStore {
+	if !chaos.Default().Enabled() {
+		return store
+	}
+	return chaosKVStore{store}
+}
+
+type chaosKVStore struct {
+	KVStore
+}
+
+func (s chaosKVStore) inject() error {
+	return chaos.Default().Inject(context.Background(), "kv")
+}
+
+func (s chaosKVStore) Get(key string) (string, error) {
+	if err := s.inject(); err != nil {
+		return "", err
+	}
+	return s.KVStore.Get(key)
+}
+
+func (s chaosKVStore) Set(key string, value string, ex int) (bool, error) {
+	if err := s.inject(); err != nil {
+		return false, err
+	}
+	return s.KVStore.Set(key, value, ex)
+}
+
+func (s chaosKVStore) Delete(key string) (bool, error) {
+	if err := s.inject(); err != nil {
+		return false, err
+	}
+	return s.KVStore.Delete(key)
+}
+
+func (s chaosKVStore) Exists(key string) (bool, error) {
+	if err := s.inject(); err != nil {
+		return false, err
+	}
+	return s.KVStore.Exists(key)
+}
+
+func (s chaosKVStore) Expire(key string, seconds int) (bool, error) {
+	if err := s.inject(); err != nil {
+		return false, err
+	}
+	return s.KVStore.Expire(key, seconds)
+}
+
+func (s chaosKVStore) GetJSON(key string) (map[string]interface{}, error) {
+	if err := s.inject(); err != nil {
+		return nil, err
+	}
+	return s.KVStore.GetJSON(key)
+}
+
+func (s chaosKVStore) SetJSON(key string, value map[string]interface{}, ex int) (bool, error) {
+	if err := s.inject(); err != nil {
+		return false, err
+	}
+	return s.KVStore.SetJSON(key, value, ex)
+}
+
+func (s chaosKVStore) HGet(name string, key string) (string, error) {
+	if err := s.inject(); err != nil {
+		return "", err
+	}
+	return s.KVStore.HGet(name, key)
+}
+
+func (s chaosKVStore) HSet(name string, key string, value string) (bool, error) {
+	if err := s.inject(); err != nil {
+		return false, err
+	}
+	return s.KVStore.HSet(name, key, value)
+}
+
+func (s chaosKVStore) HGetAll(name string) (map[string]string, error) {
+	if err := s.inject(); err != nil {
+		return nil, err
+	}
+	return s.KVStore.HGetAll(name)
+}
+
+func withChaosSQLStore(store SQLStore) SQLStore {
+	if !chaos.Default().Enabled() {
+		return store
+	}
+	return chaosSQLStore{store}
+}
+
+type chaosSQLStore struct {
+	SQLStore
+}
+
+func (s chaosSQLStore) ExecuteQuery(query string, params ...interface{}) ([]map[string]interface{}, error) {
+	if err := chaos.Default().Inject(context.Background(), "sql"); err != nil {
+		return nil, err
+	}
+	return s.SQLStore.ExecuteQuery(query, params...)
+}
+
+func (s chaosSQLStore) ExecuteUpdate(query string, params ...interface{}) (int64, error) {
+	if err := chaos.Default().Inject(context.Background(), "sql"); err != nil {
+		return 0, err
+	}
+	return s.SQLStore.ExecuteUpdate(query, params...)
+}
+
+// withChaosMessageQueue injects faults into sending only; subscriptions are
+// set up once and a failure there would just disable a consumer.
+func withChaosMessageQueue(mq MessageQueue) MessageQueue {
+	if !chaos.Default().Enabled() {
+		return mq
+	}
+	return chaosMessageQueue{mq}
+}
+
+type chaosMessageQueue struct {
+	MessageQueue
+}
+
+func (q chaosMessageQueue) SendMessage(topic string, message interface{}, tags, keys string) bool {
+	if err := chaos.Default().Inject(context.Background(), "mq"); err != nil {
+		rocketmqLogger.Printf("Not sending message to %s: %v", topic, err)
+		return false
+	}
+	return q.MessageQueue.SendMessage(topic, message, tags, keys)
+}
+
+func (q chaosMessageQueue) SendJSON(topic string, data map[string]interface{}, tags, keys string) bool {
+	if err := chaos.Default().Inject(context.Background(), "mq"); err != nil {
+		rocketmqLogger.Printf("Not sending message to %s: %v", topic, err)
+		return false
+	}
+	return q.MessageQueue.SendJSON(topic, data, tags, keys)
+}
+
+func withChaosEventProducer(producer EventProducer) EventProducer {
+	if !chaos.Default().Enabled() {
+		return producer
+	}
+	return chaosEventProducer{producer}
+}
+
+type chaosEventProducer struct {
+	EventProducer
+}
+
+func (p chaosEventProducer) ProduceWithHeaders(topic string, value interface{}, key string, headers map[string]string) error {
+	if err := chaos.Default().Inject(context.Background(), "events"); err != nil {
+		return err
+	}
+	return p.EventProducer.ProduceWithHeaders(topic, value, key, headers)
+}
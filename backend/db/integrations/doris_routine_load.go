@@ -0,0 +1,261 @@
+package integrations
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/spectrumwebco/agent_runtime/backend/core/kerrors"
+)
+
+// The states of a routine load. Paused loads resume where they stopped;
+// stopped and cancelled ones can't be resumed.
+const (
+	DorisLoadNeedScheduling = "NEED_SCHEDULE"
+	DorisLoadRunning        = "RUNNING"
+	DorisLoadPaused         = "PAUSED"
+	DorisLoadStopped        = "STOPPED"
+	DorisLoadCancelled      = "CANCELLED"
+)
+
+// DorisKafkaSource is the Kafka topic a routine load consumes.
+type DorisKafkaSource struct {
+	// Brokers is the comma separated list of bootstrap servers.
+	Brokers string `json:"brokers"`
+	Topic   string `json:"topic"`
+	// Offset is where a new load starts consuming, OFFSET_BEGINNING or
+	// OFFSET_END. Defaults to OFFSET_END.
+	Offset string `json:"offset,omitempty"`
+	// Properties are passed to the Kafka client of Doris, e.g.
+	// security.protocol or group.id.
+	Properties map[string]string `json:"properties,omitempty"`
+}
+
+// DorisSource returns topic, with the topic prefix of the client, as
+// consumed by Doris with the brokers and credentials of the client.
+// Certificate files are local to this process and left out; brokers
+// needing client certificates must be configured with PEM values.
+func (c *KafkaClient) DorisSource(topic string) DorisKafkaSource {
+	properties := map[string]string{}
+	for key, value := range c.Security.properties() {
+		if !strings.HasSuffix(key, ".location") {
+			properties[key] = value
+		}
+	}
+	return DorisKafkaSource{Brokers: c.BootstrapServers, Topic: c.GetFullTopicName(topic), Properties: properties}
+}
+
+// DorisRoutineLoad is a job continuously loading the JSON messages of a
+// Kafka topic into a table.
+type DorisRoutineLoad struct {
+	Name  string `json:"name"`
+	Table string `json:"table"`
+	// Columns are the columns of the table loaded, in the order of
+	// JSONPaths. All columns are loaded by name if empty.
+	Columns []string `json:"columns,omitempty"`
+	// JSONPaths are the paths of the message fields loaded into Columns,
+	// e.g. $.workspace_id.
+	JSONPaths []string         `json:"json_paths,omitempty"`
+	Source    DorisKafkaSource `json:"source"`
+	// Properties of the job, e.g. max_batch_interval or max_error_number.
+	Properties map[string]string `json:"properties,omitempty"`
+}
+
+// DorisRoutineLoads manages the routine loads of a Doris database.
+type DorisRoutineLoads struct {
+	store SQLStore
+}
+
+func NewDorisRoutineLoads(store SQLStore) *DorisRoutineLoads {
+	return &DorisRoutineLoads{store: store}
+}
+
+// RoutineLoads returns the routine loads of the connection.
+func (c *DorisClient) RoutineLoads() *DorisRoutineLoads {
+	return NewDorisRoutineLoads(c)
+}
+
+// CreateRoutineLoad creates a load and starts it.
+func (l *DorisRoutineLoads) CreateRoutineLoad(ctx context.Context, load DorisRoutineLoad) error {
+	if err := dorisIdentifier("routine load", load.Name); err != nil {
+		return err
+	}
+	if err := dorisIdentifier("table", load.Table); err != nil {
+		return err
+	}
+	if err := dorisIdentifiers("column", load.Columns); err != nil {
+		return err
+	}
+	if len(load.JSONPaths) > 0 && len(load.JSONPaths) != len(load.Columns) {
+		return kerrors.New(kerrors.InvalidArgument, "a JSON path is required for every column")
+	}
+	if load.Source.Brokers == "" || load.Source.Topic == "" {
+		return kerrors.New(kerrors.InvalidArgument, "the brokers and topic of a routine load are required")
+	}
+
+	statement := fmt.Sprintf("CREATE ROUTINE LOAD %s ON %s", load.Name, load.Table)
+	if len(load.Columns) > 0 {
+		statement += fmt.Sprintf(" COLUMNS(%s)", strings.Join(load.Columns, ", "))
+	}
+
+	properties := map[string]string{"format": "json"}
+	if len(load.JSONPaths) > 0 {
+		paths, err := json.Marshal(load.JSONPaths)
+		if err != nil {
+			return err
+		}
+		properties["jsonpaths"] = string(paths)
+	}
+	for key, value := range load.Properties {
+		properties[key] = value
+	}
+	statement += dorisProperties(properties)
+
+	offset := load.Source.Offset
+	if offset == "" {
+		offset = "OFFSET_END"
+	}
+	source := map[string]string{
+		"kafka_broker_list":              load.Source.Brokers,
+		"kafka_topic":                    load.Source.Topic,
+		"property.kafka_default_offsets": offset,
+	}
+	for key, value := range load.Source.Properties {
+		source["property."+key] = value
+	}
+	statement += " FROM KAFKA" + strings.TrimPrefix(dorisProperties(source), " PROPERTIES")
+
+	if _, err := l.store.ExecuteUpdate(statement); err != nil {
+		return fmt.Errorf("error creating routine load %s: %v", load.Name, err)
+	}
+	return nil
+}
+
+// PauseRoutineLoad pauses a load, keeping its offsets.
+func (l *DorisRoutineLoads) PauseRoutineLoad(ctx context.Context, name string) error {
+	return l.control(name, "PAUSE", "pausing")
+}
+
+// ResumeRoutineLoad resumes a paused load from its offsets.
+func (l *DorisRoutineLoads) ResumeRoutineLoad(ctx context.Context, name string) error {
+	return l.control(name, "RESUME", "resuming")
+}
+
+// StopRoutineLoad stops a load for good.
+func (l *DorisRoutineLoads) StopRoutineLoad(ctx context.Context, name string) error {
+	return l.control(name, "STOP", "stopping")
+}
+
+func (l *DorisRoutineLoads) control(name, verb, action string) error {
+	if err := dorisIdentifier("routine load", name); err != nil {
+		return err
+	}
+	if _, err := l.store.ExecuteUpdate(fmt.Sprintf("%s ROUTINE LOAD FOR %s", verb, name)); err != nil {
+		return fmt.Errorf("error %s routine load %s: %v", action, name, err)
+	}
+	return nil
+}
+
+// DorisRoutineLoadStatus is the state and progress of a routine load.
+type DorisRoutineLoadStatus struct {
+	ID    string `json:"id"`
+	Name  string `json:"name"`
+	Table string `json:"table"`
+	Topic string `json:"topic"`
+	State string `json:"state"`
+	// Reason is why the load was last paused or stopped.
+	Reason string `json:"reason,omitempty"`
+
+	LoadedRows    int64 `json:"loaded_rows"`
+	ErrorRows     int64 `json:"error_rows"`
+	ReceivedBytes int64 `json:"received_bytes"`
+	// Lag is the number of messages of each partition not loaded yet.
+	Lag map[string]int64 `json:"lag"`
+
+	CreatedAt    string   `json:"created_at,omitempty"`
+	PausedAt     string   `json:"paused_at,omitempty"`
+	ErrorLogURLs []string `json:"error_log_urls,omitempty"`
+}
+
+// TotalLag returns the number of messages of the topic not loaded yet.
+func (s DorisRoutineLoadStatus) TotalLag() int64 {
+	var total int64
+	for _, lag := range s.Lag {
+		total += lag
+	}
+	return total
+}
+
+// RoutineLoads returns the status of the loads of the current database
+// that are neither stopped nor cancelled, sorted by name.
+func (l *DorisRoutineLoads) RoutineLoads(ctx context.Context) ([]DorisRoutineLoadStatus, error) {
+	rows, err := l.store.ExecuteQuery("SHOW ROUTINE LOAD")
+	if err != nil {
+		return nil, fmt.Errorf("error listing routine loads: %v", err)
+	}
+	loads := make([]DorisRoutineLoadStatus, 0, len(rows))
+	for _, row := range rows {
+		loads = append(loads, dorisRoutineLoadFromRow(row))
+	}
+	sort.Slice(loads, func(i, j int) bool { return loads[i].Name < loads[j].Name })
+	return loads, nil
+}
+
+// RoutineLoad returns the status of a load, or a NotFound error.
+func (l *DorisRoutineLoads) RoutineLoad(ctx context.Context, name string) (*DorisRoutineLoadStatus, error) {
+	if err := dorisIdentifier("routine load", name); err != nil {
+		return nil, err
+	}
+	rows, err := l.store.ExecuteQuery("SHOW ROUTINE LOAD FOR " + name)
+	if err != nil {
+		return nil, fmt.Errorf("error loading routine load %s: %v", name, err)
+	}
+	if len(rows) == 0 {
+		return nil, kerrors.Errorf(kerrors.NotFound, "routine load %s not found", name)
+	}
+	status := dorisRoutineLoadFromRow(rows[0])
+	return &status, nil
+}
+
+// dorisRoutineLoadFromRow reads a row of SHOW ROUTINE LOAD, whose progress
+// columns hold JSON documents.
+func dorisRoutineLoadFromRow(row map[string]interface{}) DorisRoutineLoadStatus {
+	status := DorisRoutineLoadStatus{
+		ID:        dorisString(row["Id"]),
+		Name:      dorisString(row["Name"]),
+		Table:     dorisString(row["TableName"]),
+		State:     dorisString(row["State"]),
+		Reason:    dorisString(row["ReasonOfStateChanged"]),
+		CreatedAt: dorisString(row["CreateTime"]),
+		PausedAt:  dorisString(row["PauseTime"]),
+		Lag:       map[string]int64{},
+	}
+
+	var source struct {
+		Topic string `json:"topic"`
+	}
+	if json.Unmarshal([]byte(dorisString(row["DataSourceProperties"])), &source) == nil {
+		status.Topic = source.Topic
+	}
+
+	var statistic map[string]json.Number
+	if json.Unmarshal([]byte(dorisString(row["Statistic"])), &statistic) == nil {
+		status.LoadedRows, _ = statistic["loadedRows"].Int64()
+		status.ErrorRows, _ = statistic["errorRows"].Int64()
+		status.ReceivedBytes, _ = statistic["receivedBytes"].Int64()
+	}
+
+	var lag map[string]json.Number
+	if json.Unmarshal([]byte(dorisString(row["Lag"])), &lag) == nil {
+		for partition, messages := range lag {
+			status.Lag[partition], _ = messages.Int64()
+		}
+	}
+
+	if urls := dorisString(row["ErrorLogUrls"]); urls != "" {
+		status.ErrorLogURLs = strings.Split(urls, ",")
+	}
+	return status
+}
@@ -0,0 +1,94 @@
+package integrations
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/spectrumwebco/agent_runtime/backend/core/kerrors"
+)
+
+func TestDorisRoutineLoadDDL(t *testing.T) {
+	doris := &fakeDoris{}
+	loads := NewDorisRoutineLoads(doris)
+	ctx := context.Background()
+
+	err := loads.CreateRoutineLoad(ctx, DorisRoutineLoad{
+		Name:      "workspace_events_load",
+		Table:     "workspace_events",
+		Columns:   []string{"id", "workspace_id"},
+		JSONPaths: []string{"$.id", "$.workspace_id"},
+		Source: DorisKafkaSource{
+			Brokers:    "kafka:9092",
+			Topic:      "kled.workspace.lifecycle",
+			Properties: map[string]string{"security.protocol": "SASL_SSL"},
+		},
+		Properties: map[string]string{"max_batch_interval": "10"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := loads.PauseRoutineLoad(ctx, "workspace_events_load"); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{
+		`CREATE ROUTINE LOAD workspace_events_load ON workspace_events COLUMNS(id, workspace_id) PROPERTIES ("format" = "json", "jsonpaths" = "[\"$.id\",\"$.workspace_id\"]", "max_batch_interval" = "10") FROM KAFKA ("kafka_broker_list" = "kafka:9092", "kafka_topic" = "kled.workspace.lifecycle", "property.kafka_default_offsets" = "OFFSET_END", "property.security.protocol" = "SASL_SSL")`,
+		`PAUSE ROUTINE LOAD FOR workspace_events_load`,
+	}
+	if len(doris.statements) != len(expected) {
+		t.Fatalf("unexpected statements %q", doris.statements)
+	}
+	for i := range expected {
+		if doris.statements[i] != expected[i] {
+			t.Errorf("expected\n%s\ngot\n%s", expected[i], doris.statements[i])
+		}
+	}
+
+	for name, err := range map[string]error{
+		"name":  loads.ResumeRoutineLoad(ctx, "load; DROP TABLE workspace_events"),
+		"paths": loads.CreateRoutineLoad(ctx, DorisRoutineLoad{Name: "l", Table: "t", Columns: []string{"id"}, JSONPaths: []string{"$.id", "$.type"}}),
+		"topic": loads.CreateRoutineLoad(ctx, DorisRoutineLoad{Name: "l", Table: "t", Source: DorisKafkaSource{Brokers: "kafka:9092"}}),
+	} {
+		if !errors.Is(err, kerrors.ErrInvalidArgument) {
+			t.Errorf("%s: expected an invalid argument, got %v", name, err)
+		}
+	}
+}
+
+func TestDorisRoutineLoadStatus(t *testing.T) {
+	doris := &fakeDoris{results: map[string][]map[string]interface{}{
+		"SHOW ROUTINE LOAD FOR missing": {},
+		"SHOW ROUTINE LOAD": {{
+			"Id":                   int64(10042),
+			"Name":                 "trajectories_load",
+			"TableName":            "trajectories",
+			"State":                "PAUSED",
+			"ReasonOfStateChanged": "ErrorReason{code=errCode = 100, msg='too many filtered rows'}",
+			"DataSourceProperties": `{"topic":"agent.trajectories","currentKafkaPartitions":"0,1"}`,
+			"Statistic":            `{"receivedBytes":2048,"loadedRows":120,"errorRows":3,"totalRows":123}`,
+			"Lag":                  `{"0":15,"1":7}`,
+			"ErrorLogUrls":         "http://be:8040/api/_load_error_log?file=a",
+		}},
+	}}
+	loads := NewDorisRoutineLoads(doris)
+
+	statuses, err := loads.RoutineLoads(context.Background())
+	if err != nil || len(statuses) != 1 {
+		t.Fatalf("unexpected loads %+v, %v", statuses, err)
+	}
+	status := statuses[0]
+	if status.ID != "10042" || status.Topic != "agent.trajectories" || status.State != DorisLoadPaused {
+		t.Errorf("unexpected status %+v", status)
+	}
+	if status.LoadedRows != 120 || status.ErrorRows != 3 || status.ReceivedBytes != 2048 || status.TotalLag() != 22 {
+		t.Errorf("unexpected progress %+v", status)
+	}
+	if len(status.ErrorLogURLs) != 1 {
+		t.Errorf("unexpected error logs %v", status.ErrorLogURLs)
+	}
+
+	if _, err := loads.RoutineLoad(context.Background(), "missing"); !errors.Is(err, kerrors.ErrNotFound) {
+		t.Errorf("expected not found, got %v", err)
+	}
+}
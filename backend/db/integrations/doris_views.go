@@ -0,0 +1,603 @@
+package integrations
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/spectrumwebco/agent_runtime/backend/core/kerrors"
+)
+
+// Doris can't bind identifiers or DDL clauses as parameters, so the names
+// and clauses of views and rollups are validated before they are spliced in.
+var (
+	dorisIdentifierPattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*(\.[A-Za-z_][A-Za-z0-9_]*)?$`)
+	dorisSchedulePattern   = regexp.MustCompile(`^(?i)[1-9][0-9]* (MINUTE|HOUR|DAY|WEEK)$`)
+)
+
+func dorisIdentifier(kind, name string) error {
+	if !dorisIdentifierPattern.MatchString(name) {
+		return kerrors.Errorf(kerrors.InvalidArgument, "invalid %s name %q", kind, name)
+	}
+	return nil
+}
+
+func dorisIdentifiers(kind string, names []string) error {
+	for _, name := range names {
+		if err := dorisIdentifier(kind, name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// dorisProperties renders a PROPERTIES clause, sorted so the DDL is stable.
+func dorisProperties(properties map[string]string) string {
+	if len(properties) == 0 {
+		return ""
+	}
+	keys := make([]string, 0, len(properties))
+	for key := range properties {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	pairs := make([]string, 0, len(keys))
+	for _, key := range keys {
+		pairs = append(pairs, dorisQuote(key)+" = "+dorisQuote(properties[key]))
+	}
+	return " PROPERTIES (" + strings.Join(pairs, ", ") + ")"
+}
+
+func dorisQuote(value string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(value) + `"`
+}
+
+// DorisViews manages the materialized views and rollups of a Doris
+// database, through the DorisClient or a tenant's scoped store.
+type DorisViews struct {
+	store SQLStore
+}
+
+func NewDorisViews(store SQLStore) *DorisViews {
+	return &DorisViews{store: store}
+}
+
+// Views returns the materialized views and rollups of the connection.
+func (c *DorisClient) Views() *DorisViews {
+	return NewDorisViews(c)
+}
+
+// DorisRefresh is how an asynchronous materialized view is refreshed: AUTO
+// only rebuilds the partitions whose base data changed, COMPLETE everything.
+type DorisRefresh struct {
+	Method string `json:"method,omitempty"`
+	// Schedule refreshes the view periodically, e.g. "1 HOUR". Views without
+	// a schedule are refreshed on commit if OnCommit is set, otherwise only
+	// manually.
+	Schedule string `json:"schedule,omitempty"`
+	OnCommit bool   `json:"on_commit,omitempty"`
+}
+
+func (r DorisRefresh) clause() (string, error) {
+	method := strings.ToUpper(r.Method)
+	if method == "" {
+		method = "AUTO"
+	}
+	if method != "AUTO" && method != "COMPLETE" {
+		return "", kerrors.Errorf(kerrors.InvalidArgument, "refresh method must be AUTO or COMPLETE, got %q", r.Method)
+	}
+
+	switch {
+	case r.Schedule != "" && r.OnCommit:
+		return "", kerrors.New(kerrors.InvalidArgument, "a view is refreshed either on a schedule or on commit")
+	case r.Schedule != "":
+		if !dorisSchedulePattern.MatchString(r.Schedule) {
+			return "", kerrors.Errorf(kerrors.InvalidArgument, "invalid refresh schedule %q, e.g. 1 HOUR", r.Schedule)
+		}
+		return fmt.Sprintf("REFRESH %s ON SCHEDULE EVERY %s", method, strings.ToUpper(r.Schedule)), nil
+	case r.OnCommit:
+		return "REFRESH " + method + " ON COMMIT", nil
+	default:
+		return "REFRESH " + method + " ON MANUAL", nil
+	}
+}
+
+// DorisMaterializedView is an asynchronous materialized view, which Doris
+// keeps as a table of its own.
+type DorisMaterializedView struct {
+	Name    string       `json:"name"`
+	Query   string       `json:"query"`
+	Refresh DorisRefresh `json:"refresh"`
+	// PartitionBy is a partition column of the base table, so AUTO refreshes
+	// only rebuild the partitions that changed.
+	PartitionBy   string `json:"partition_by,omitempty"`
+	DistributedBy string `json:"distributed_by,omitempty"`
+	// Buckets is the number of buckets, or automatic if 0.
+	Buckets int `json:"buckets,omitempty"`
+	// Deferred creates the view without building it.
+	Deferred   bool              `json:"deferred,omitempty"`
+	Properties map[string]string `json:"properties,omitempty"`
+}
+
+// CreateMaterializedView creates an asynchronous materialized view. The
+// query is the view's definition and is trusted.
+func (v *DorisViews) CreateMaterializedView(ctx context.Context, view DorisMaterializedView) error {
+	if err := dorisIdentifier("materialized view", view.Name); err != nil {
+		return err
+	}
+	if strings.TrimSpace(view.Query) == "" {
+		return kerrors.New(kerrors.InvalidArgument, "the query of a materialized view is required")
+	}
+	refresh, err := view.Refresh.clause()
+	if err != nil {
+		return err
+	}
+
+	build := "IMMEDIATE"
+	if view.Deferred {
+		build = "DEFERRED"
+	}
+	ddl := fmt.Sprintf("CREATE MATERIALIZED VIEW IF NOT EXISTS %s BUILD %s %s", view.Name, build, refresh)
+	if view.PartitionBy != "" {
+		if err := dorisIdentifier("partition column", view.PartitionBy); err != nil {
+			return err
+		}
+		ddl += fmt.Sprintf(" PARTITION BY (%s)", view.PartitionBy)
+	}
+	if view.DistributedBy != "" {
+		if err := dorisIdentifier("distribution column", view.DistributedBy); err != nil {
+			return err
+		}
+		buckets := "AUTO"
+		if view.Buckets > 0 {
+			buckets = strconv.Itoa(view.Buckets)
+		}
+		ddl += fmt.Sprintf(" DISTRIBUTED BY HASH(%s) BUCKETS %s", view.DistributedBy, buckets)
+	}
+	ddl += dorisProperties(view.Properties) + " AS " + view.Query
+
+	if _, err := v.store.ExecuteUpdate(ddl); err != nil {
+		return fmt.Errorf("error creating materialized view %s: %v", view.Name, err)
+	}
+	return nil
+}
+
+// DorisViewChange alters a materialized view. Unset fields are left alone.
+type DorisViewChange struct {
+	Refresh    *DorisRefresh     `json:"refresh,omitempty"`
+	Properties map[string]string `json:"properties,omitempty"`
+	Rename     string            `json:"rename,omitempty"`
+}
+
+// AlterMaterializedView changes the refresh, properties or name of a view,
+// in that order.
+func (v *DorisViews) AlterMaterializedView(ctx context.Context, name string, change DorisViewChange) error {
+	if err := dorisIdentifier("materialized view", name); err != nil {
+		return err
+	}
+
+	var statements []string
+	if change.Refresh != nil {
+		refresh, err := change.Refresh.clause()
+		if err != nil {
+			return err
+		}
+		statements = append(statements, fmt.Sprintf("ALTER MATERIALIZED VIEW %s %s", name, refresh))
+	}
+	if len(change.Properties) > 0 {
+		statements = append(statements, fmt.Sprintf("ALTER MATERIALIZED VIEW %s SET%s", name, strings.TrimPrefix(dorisProperties(change.Properties), " PROPERTIES")))
+	}
+	if change.Rename != "" {
+		if err := dorisIdentifier("materialized view", change.Rename); err != nil {
+			return err
+		}
+		statements = append(statements, fmt.Sprintf("ALTER MATERIALIZED VIEW %s RENAME %s", name, change.Rename))
+	}
+	if len(statements) == 0 {
+		return kerrors.New(kerrors.InvalidArgument, "nothing to change")
+	}
+
+	for _, statement := range statements {
+		if _, err := v.store.ExecuteUpdate(statement); err != nil {
+			return fmt.Errorf("error altering materialized view %s: %v", name, err)
+		}
+	}
+	return nil
+}
+
+// RefreshMaterializedView starts a refresh of the view, of only the given
+// partitions if any, or of everything if complete is set.
+func (v *DorisViews) RefreshMaterializedView(ctx context.Context, name string, partitions []string, complete bool) error {
+	if err := dorisIdentifier("materialized view", name); err != nil {
+		return err
+	}
+	if err := dorisIdentifiers("partition", partitions); err != nil {
+		return err
+	}
+
+	mode := "AUTO"
+	switch {
+	case len(partitions) > 0:
+		mode = "PARTITIONS(" + strings.Join(partitions, ", ") + ")"
+	case complete:
+		mode = "COMPLETE"
+	}
+	if _, err := v.store.ExecuteUpdate(fmt.Sprintf("REFRESH MATERIALIZED VIEW %s %s", name, mode)); err != nil {
+		return fmt.Errorf("error refreshing materialized view %s: %v", name, err)
+	}
+	return nil
+}
+
+func (v *DorisViews) DropMaterializedView(ctx context.Context, name string) error {
+	if err := dorisIdentifier("materialized view", name); err != nil {
+		return err
+	}
+	if _, err := v.store.ExecuteUpdate(fmt.Sprintf("DROP MATERIALIZED VIEW IF EXISTS %s", name)); err != nil {
+		return fmt.Errorf("error dropping materialized view %s: %v", name, err)
+	}
+	return nil
+}
+
+// DorisViewStatus is the build state of a materialized view.
+type DorisViewStatus struct {
+	Name string `json:"name"`
+	// State is NORMAL once the view was built, INIT before and
+	// SCHEMA_CHANGE if a base table changed so it needs a complete refresh.
+	State        string `json:"state"`
+	RefreshState string `json:"refresh_state"`
+	// Fresh reports whether the view holds all data of its base tables.
+	Fresh       bool           `json:"fresh"`
+	Query       string         `json:"query,omitempty"`
+	LastRefresh *DorisViewTask `json:"last_refresh,omitempty"`
+}
+
+// DorisViewTask is a refresh of a materialized view.
+type DorisViewTask struct {
+	ID         string `json:"id"`
+	Status     string `json:"status"`
+	CreatedAt  string `json:"created_at,omitempty"`
+	FinishedAt string `json:"finished_at,omitempty"`
+	Error      string `json:"error,omitempty"`
+}
+
+// MaterializedViews returns the status of the materialized views of the
+// current database.
+func (v *DorisViews) MaterializedViews(ctx context.Context) ([]DorisViewStatus, error) {
+	rows, err := v.store.ExecuteQuery(`SELECT Name, State, RefreshState, SyncWithBaseTables, QuerySql FROM mv_infos("database" = DATABASE()) ORDER BY Name`)
+	if err != nil {
+		return nil, fmt.Errorf("error listing materialized views: %v", err)
+	}
+	views := make([]DorisViewStatus, 0, len(rows))
+	for _, row := range rows {
+		views = append(views, DorisViewStatus{
+			Name:         dorisString(row["Name"]),
+			State:        dorisString(row["State"]),
+			RefreshState: dorisString(row["RefreshState"]),
+			Fresh:        dorisBool(row["SyncWithBaseTables"]),
+			Query:        dorisString(row["QuerySql"]),
+		})
+	}
+	return views, nil
+}
+
+// MaterializedViewStatus returns the status of a view with its latest
+// refresh, or a NotFound error.
+func (v *DorisViews) MaterializedViewStatus(ctx context.Context, name string) (*DorisViewStatus, error) {
+	if err := dorisIdentifier("materialized view", name); err != nil {
+		return nil, err
+	}
+	views, err := v.MaterializedViews(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, view := range views {
+		if view.Name != name {
+			continue
+		}
+		rows, err := v.store.ExecuteQuery(
+			`SELECT TaskId, Status, CreateTime, FinishTime, ErrorMsg FROM tasks("type" = "mv") WHERE MvName = ? ORDER BY CreateTime DESC LIMIT 1`, name,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("error loading refreshes of materialized view %s: %v", name, err)
+		}
+		if len(rows) > 0 {
+			view.LastRefresh = &DorisViewTask{
+				ID:         dorisString(rows[0]["TaskId"]),
+				Status:     dorisString(rows[0]["Status"]),
+				CreatedAt:  dorisString(rows[0]["CreateTime"]),
+				FinishedAt: dorisString(rows[0]["FinishTime"]),
+				Error:      dorisString(rows[0]["ErrorMsg"]),
+			}
+		}
+		return &view, nil
+	}
+	return nil, kerrors.Errorf(kerrors.NotFound, "materialized view %s not found", name)
+}
+
+// DorisRollup is a rollup of a table: a pre-sorted, for aggregate tables
+// pre-aggregated, copy of some of its columns that Doris picks for queries
+// on the table by itself.
+type DorisRollup struct {
+	Name       string            `json:"name"`
+	Columns    []string          `json:"columns"`
+	Properties map[string]string `json:"properties,omitempty"`
+}
+
+// CreateRollup starts building a rollup of a table. RollupJobs reports the
+// progress of the build.
+func (v *DorisViews) CreateRollup(ctx context.Context, table string, rollup DorisRollup) error {
+	if err := dorisIdentifier("table", table); err != nil {
+		return err
+	}
+	if err := dorisIdentifier("rollup", rollup.Name); err != nil {
+		return err
+	}
+	if len(rollup.Columns) == 0 {
+		return kerrors.New(kerrors.InvalidArgument, "the columns of a rollup are required")
+	}
+	if err := dorisIdentifiers("column", rollup.Columns); err != nil {
+		return err
+	}
+
+	ddl := fmt.Sprintf("ALTER TABLE %s ADD ROLLUP %s (%s)%s", table, rollup.Name, strings.Join(rollup.Columns, ", "), dorisProperties(rollup.Properties))
+	if _, err := v.store.ExecuteUpdate(ddl); err != nil {
+		return fmt.Errorf("error creating rollup %s of %s: %v", rollup.Name, table, err)
+	}
+	return nil
+}
+
+func (v *DorisViews) DropRollup(ctx context.Context, table, name string) error {
+	if err := dorisIdentifier("table", table); err != nil {
+		return err
+	}
+	if err := dorisIdentifier("rollup", name); err != nil {
+		return err
+	}
+	if _, err := v.store.ExecuteUpdate(fmt.Sprintf("ALTER TABLE %s DROP ROLLUP %s", table, name)); err != nil {
+		return fmt.Errorf("error dropping rollup %s of %s: %v", name, table, err)
+	}
+	return nil
+}
+
+// Rollups returns the rollups of a table with their columns. The base table
+// is left out.
+func (v *DorisViews) Rollups(ctx context.Context, table string) ([]DorisRollup, error) {
+	if err := dorisIdentifier("table", table); err != nil {
+		return nil, err
+	}
+	rows, err := v.store.ExecuteQuery(fmt.Sprintf("DESC %s ALL", table))
+	if err != nil {
+		return nil, fmt.Errorf("error describing %s: %v", table, err)
+	}
+
+	// only the first column of an index names it
+	baseName := table[strings.LastIndex(table, ".")+1:]
+	var rollups []DorisRollup
+	current := ""
+	for _, row := range rows {
+		if name := dorisString(row["IndexName"]); name != "" {
+			current = name
+			if current != baseName {
+				rollups = append(rollups, DorisRollup{Name: current})
+			}
+		}
+		if current != "" && current != baseName && len(rollups) > 0 {
+			rollups[len(rollups)-1].Columns = append(rollups[len(rollups)-1].Columns, dorisString(row["Field"]))
+		}
+	}
+	return rollups, nil
+}
+
+// DorisRollupJob is the build of a rollup.
+type DorisRollupJob struct {
+	ID         string `json:"id"`
+	Table      string `json:"table"`
+	Rollup     string `json:"rollup"`
+	State      string `json:"state"`
+	Progress   string `json:"progress,omitempty"`
+	Message    string `json:"message,omitempty"`
+	CreatedAt  string `json:"created_at,omitempty"`
+	FinishedAt string `json:"finished_at,omitempty"`
+}
+
+// Done reports whether the build finished, successfully or not.
+func (j DorisRollupJob) Done() bool {
+	return j.State == "FINISHED" || j.State == "CANCELLED"
+}
+
+// RollupJobs returns the rollup builds of a table, newest first.
+func (v *DorisViews) RollupJobs(ctx context.Context, table string) ([]DorisRollupJob, error) {
+	if err := dorisIdentifier("table", table); err != nil {
+		return nil, err
+	}
+	database, name := "", table
+	if i := strings.LastIndex(table, "."); i >= 0 {
+		database, name = " FROM "+table[:i], table[i+1:]
+	}
+	rows, err := v.store.ExecuteQuery(fmt.Sprintf(`SHOW ALTER TABLE ROLLUP%s WHERE TableName = "%s" ORDER BY CreateTime DESC`, database, name))
+	if err != nil {
+		return nil, fmt.Errorf("error listing rollup jobs of %s: %v", table, err)
+	}
+	jobs := make([]DorisRollupJob, 0, len(rows))
+	for _, row := range rows {
+		jobs = append(jobs, DorisRollupJob{
+			ID:         dorisString(row["JobId"]),
+			Table:      dorisString(row["TableName"]),
+			Rollup:     dorisString(row["RollupIndexName"]),
+			State:      dorisString(row["State"]),
+			Progress:   dorisString(row["Progress"]),
+			Message:    dorisString(row["Msg"]),
+			CreatedAt:  dorisString(row["CreateTime"]),
+			FinishedAt: dorisString(row["FinishTime"]),
+		})
+	}
+	return jobs, nil
+}
+
+// DorisRoute is where an analytical query over a table is best run.
+type DorisRoute struct {
+	// From is the table or materialized view to query.
+	From string `json:"from"`
+	// MaterializedView is set if From is a materialized view.
+	MaterializedView bool `json:"materialized_view"`
+	// Rollup is the rollup of the table covering the query, which Doris
+	// picks by itself when the table is queried.
+	Rollup string `json:"rollup,omitempty"`
+}
+
+// DorisRouter routes analytical queries to the smallest fresh materialized
+// view or rollup holding every column they need. The views and rollups of a
+// table are cached for the TTL.
+type DorisRouter struct {
+	views *DorisViews
+	ttl   time.Duration
+	now   func() time.Time
+
+	mu      sync.Mutex
+	sources map[string]*dorisSources
+}
+
+type dorisSources struct {
+	loadedAt time.Time
+	views    []DorisRollup
+	rollups  []DorisRollup
+}
+
+// NewDorisRouter creates a router caching the sources of a table for ttl.
+func NewDorisRouter(views *DorisViews, ttl time.Duration) *DorisRouter {
+	return &DorisRouter{views: views, ttl: ttl, now: time.Now, sources: map[string]*dorisSources{}}
+}
+
+// Route returns where a query over table that reads columns, including the
+// ones it filters and groups by, is best run. Materialized views defined
+// over table are preferred to rollups, as they can be pre-joined and
+// pre-aggregated; among them, the one with the fewest columns wins.
+func (r *DorisRouter) Route(ctx context.Context, table string, columns []string) (*DorisRoute, error) {
+	if err := dorisIdentifier("table", table); err != nil {
+		return nil, err
+	}
+	if err := dorisIdentifiers("column", columns); err != nil {
+		return nil, err
+	}
+	sources, err := r.load(ctx, table)
+	if err != nil {
+		return nil, err
+	}
+
+	route := &DorisRoute{From: table}
+	if view := smallestCovering(sources.views, columns); view != nil {
+		route.From = view.Name
+		route.MaterializedView = true
+		return route, nil
+	}
+	if rollup := smallestCovering(sources.rollups, columns); rollup != nil {
+		route.Rollup = rollup.Name
+	}
+	return route, nil
+}
+
+// Invalidate drops the cached views and rollups of table, e.g. after one
+// was created.
+func (r *DorisRouter) Invalidate(table string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.sources, table)
+}
+
+// Reset drops the cached views and rollups of every table. Materialized
+// views may read several tables, so changing one invalidates them all.
+func (r *DorisRouter) Reset() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.sources = map[string]*dorisSources{}
+}
+
+func (r *DorisRouter) load(ctx context.Context, table string) (*dorisSources, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if cached, ok := r.sources[table]; ok && r.now().Sub(cached.loadedAt) < r.ttl {
+		return cached, nil
+	}
+
+	rollups, err := r.views.Rollups(ctx, table)
+	if err != nil {
+		return nil, err
+	}
+	sources := &dorisSources{loadedAt: r.now(), rollups: rollups}
+
+	views, err := r.views.MaterializedViews(ctx)
+	if err != nil {
+		return nil, err
+	}
+	baseName := regexp.MustCompile(`(?i)\b` + regexp.QuoteMeta(table[strings.LastIndex(table, ".")+1:]) + `\b`)
+	for _, view := range views {
+		// stale views would answer with old data
+		if view.State != "NORMAL" || !view.Fresh || !baseName.MatchString(view.Query) {
+			continue
+		}
+		rows, err := r.views.store.ExecuteQuery(fmt.Sprintf("DESC %s", view.Name))
+		if err != nil {
+			return nil, fmt.Errorf("error describing materialized view %s: %v", view.Name, err)
+		}
+		source := DorisRollup{Name: view.Name}
+		for _, row := range rows {
+			source.Columns = append(source.Columns, dorisString(row["Field"]))
+		}
+		sources.views = append(sources.views, source)
+	}
+
+	r.sources[table] = sources
+	return sources, nil
+}
+
+func smallestCovering(candidates []DorisRollup, columns []string) *DorisRollup {
+	var best *DorisRollup
+	for i := range candidates {
+		candidate := &candidates[i]
+		has := make(map[string]bool, len(candidate.Columns))
+		for _, column := range candidate.Columns {
+			has[strings.ToLower(column)] = true
+		}
+		covers := true
+		for _, column := range columns {
+			if !has[strings.ToLower(column)] {
+				covers = false
+				break
+			}
+		}
+		if covers && (best == nil || len(candidate.Columns) < len(best.Columns)) {
+			best = candidate
+		}
+	}
+	return best
+}
+
+func dorisString(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case []byte:
+		return string(v)
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+func dorisBool(value interface{}) bool {
+	switch v := value.(type) {
+	case bool:
+		return v
+	case int64:
+		return v != 0
+	default:
+		parsed, _ := strconv.ParseBool(dorisString(value))
+		return parsed
+	}
+}
@@ -0,0 +1,160 @@
+package integrations
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/spectrumwebco/agent_runtime/backend/core/kerrors"
+)
+
+// fakeDoris records statements and answers queries by their longest
+// matching prefix.
+type fakeDoris struct {
+	statements []string
+	results    map[string][]map[string]interface{}
+	queries    int
+}
+
+func (f *fakeDoris) ExecuteQuery(query string, params ...interface{}) ([]map[string]interface{}, error) {
+	f.queries++
+	match := ""
+	for prefix := range f.results {
+		if strings.HasPrefix(query, prefix) && len(prefix) > len(match) {
+			match = prefix
+		}
+	}
+	return f.results[match], nil
+}
+
+func (f *fakeDoris) ExecuteUpdate(query string, params ...interface{}) (int64, error) {
+	f.statements = append(f.statements, query)
+	return 0, nil
+}
+
+func TestDorisMaterializedViewDDL(t *testing.T) {
+	doris := &fakeDoris{}
+	views := NewDorisViews(doris)
+	ctx := context.Background()
+
+	err := views.CreateMaterializedView(ctx, DorisMaterializedView{
+		Name:          "trajectory_daily",
+		Query:         "SELECT DATE(created_at) AS day, status, COUNT(*) AS trajectories FROM trajectories GROUP BY 1, 2",
+		Refresh:       DorisRefresh{Schedule: "1 hour"},
+		PartitionBy:   "day",
+		DistributedBy: "day",
+		Properties:    map[string]string{"replication_num": "1"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := views.AlterMaterializedView(ctx, "trajectory_daily", DorisViewChange{
+		Refresh:    &DorisRefresh{Method: "complete", OnCommit: true},
+		Properties: map[string]string{"grace_period": "3600"},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err := views.RefreshMaterializedView(ctx, "trajectory_daily", []string{"p20260301"}, false); err != nil {
+		t.Fatal(err)
+	}
+	if err := views.CreateRollup(ctx, "trajectories", DorisRollup{Name: "by_status", Columns: []string{"status", "created_at", "total_tokens"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{
+		`CREATE MATERIALIZED VIEW IF NOT EXISTS trajectory_daily BUILD IMMEDIATE REFRESH AUTO ON SCHEDULE EVERY 1 HOUR PARTITION BY (day) DISTRIBUTED BY HASH(day) BUCKETS AUTO PROPERTIES ("replication_num" = "1") AS SELECT DATE(created_at) AS day, status, COUNT(*) AS trajectories FROM trajectories GROUP BY 1, 2`,
+		`ALTER MATERIALIZED VIEW trajectory_daily REFRESH COMPLETE ON COMMIT`,
+		`ALTER MATERIALIZED VIEW trajectory_daily SET ("grace_period" = "3600")`,
+		`REFRESH MATERIALIZED VIEW trajectory_daily PARTITIONS(p20260301)`,
+		`ALTER TABLE trajectories ADD ROLLUP by_status (status, created_at, total_tokens)`,
+	}
+	if strings.Join(doris.statements, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("unexpected statements:\n%s", strings.Join(doris.statements, "\n"))
+	}
+
+	for name, err := range map[string]error{
+		"name":     views.DropMaterializedView(ctx, "views; DROP TABLE trajectories"),
+		"schedule": views.CreateMaterializedView(ctx, DorisMaterializedView{Name: "v", Query: "SELECT 1", Refresh: DorisRefresh{Schedule: "1 HOUR; DROP"}}),
+		"column":   views.CreateRollup(ctx, "trajectories", DorisRollup{Name: "r", Columns: []string{"status)"}}),
+		"nothing":  views.AlterMaterializedView(ctx, "trajectory_daily", DorisViewChange{}),
+	} {
+		if !errors.Is(err, kerrors.ErrInvalidArgument) {
+			t.Errorf("%s: expected an invalid argument, got %v", name, err)
+		}
+	}
+}
+
+func TestDorisRollups(t *testing.T) {
+	doris := &fakeDoris{results: map[string][]map[string]interface{}{
+		"DESC trajectories ALL": {
+			{"IndexName": "trajectories", "Field": "id"},
+			{"IndexName": "", "Field": "status"},
+			{"IndexName": "by_status", "Field": "status"},
+			{"IndexName": "", "Field": "total_tokens"},
+		},
+		"SHOW ALTER TABLE ROLLUP": {
+			{"JobId": int64(1), "TableName": "trajectories", "RollupIndexName": "by_status", "State": "RUNNING", "Progress": "3/8"},
+		},
+	}}
+	views := NewDorisViews(doris)
+
+	rollups, err := views.Rollups(context.Background(), "trajectories")
+	if err != nil || len(rollups) != 1 || rollups[0].Name != "by_status" || strings.Join(rollups[0].Columns, ",") != "status,total_tokens" {
+		t.Fatalf("unexpected rollups %+v, %v", rollups, err)
+	}
+	jobs, err := views.RollupJobs(context.Background(), "trajectories")
+	if err != nil || len(jobs) != 1 || jobs[0].ID != "1" || jobs[0].Done() {
+		t.Fatalf("unexpected jobs %+v, %v", jobs, err)
+	}
+}
+
+func TestDorisRouter(t *testing.T) {
+	doris := &fakeDoris{results: map[string][]map[string]interface{}{
+		"DESC trajectories ALL": {
+			{"IndexName": "trajectories", "Field": "id"},
+			{"IndexName": "by_status", "Field": "status"},
+			{"IndexName": "", "Field": "workspace_id"},
+			{"IndexName": "", "Field": "total_tokens"},
+		},
+		"SELECT Name, State": {
+			{"Name": "trajectory_daily", "State": "NORMAL", "SyncWithBaseTables": true, "QuerySql": "SELECT day, status, trajectories FROM trajectories"},
+			{"Name": "trajectory_hourly", "State": "NORMAL", "SyncWithBaseTables": true, "QuerySql": "SELECT hour, day, status, trajectories FROM trajectories"},
+			{"Name": "trajectory_stale", "State": "NORMAL", "SyncWithBaseTables": false, "QuerySql": "SELECT day FROM trajectories"},
+			{"Name": "event_daily", "State": "NORMAL", "SyncWithBaseTables": true, "QuerySql": "SELECT day FROM workspace_events"},
+		},
+		"DESC trajectory_daily":  {{"Field": "day"}, {"Field": "status"}, {"Field": "trajectories"}},
+		"DESC trajectory_hourly": {{"Field": "hour"}, {"Field": "day"}, {"Field": "status"}, {"Field": "trajectories"}},
+	}}
+	router := NewDorisRouter(NewDorisViews(doris), time.Minute)
+	ctx := context.Background()
+
+	for _, test := range []struct {
+		columns []string
+		route   DorisRoute
+	}{
+		{[]string{"day", "trajectories"}, DorisRoute{From: "trajectory_daily", MaterializedView: true}},
+		{[]string{"hour", "trajectories"}, DorisRoute{From: "trajectory_hourly", MaterializedView: true}},
+		{[]string{"workspace_id", "total_tokens"}, DorisRoute{From: "trajectories", Rollup: "by_status"}},
+		{[]string{"id", "status"}, DorisRoute{From: "trajectories"}},
+	} {
+		route, err := router.Route(ctx, "trajectories", test.columns)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if *route != test.route {
+			t.Errorf("%v: expected %+v, got %+v", test.columns, test.route, *route)
+		}
+	}
+
+	// the sources are cached until invalidated
+	queries := doris.queries
+	if _, err := router.Route(ctx, "trajectories", []string{"day"}); err != nil || doris.queries != queries {
+		t.Errorf("expected the cached sources to be used, got %d queries, %v", doris.queries-queries, err)
+	}
+	router.Invalidate("trajectories")
+	if _, err := router.Route(ctx, "trajectories", []string{"day"}); err != nil || doris.queries == queries {
+		t.Errorf("expected the sources to be reloaded, %v", err)
+	}
+}
@@ -2,6 +2,7 @@ package integrations
 
 import (
 	"context"
+	"crypto/tls"
 	"encoding/json"
 	"fmt"
 	"log"
@@ -10,22 +11,61 @@ import (
 	"strings"
 	"time"
 
-	"github.com/go-redis/redis/v8"
+	"github.com/redis/go-redis/v9"
 	"github.com/spectrumwebco/agent_runtime/pkg/djangogo/db"
 )
 
 var dragonflyLogger = log.New(os.Stdout, "kled.database.dragonfly: ", log.LstdFlags)
 
+// Dragonfly deployment modes. Standalone connects to Host and Port, cluster
+// and sentinel mode use Addrs.
+const (
+	DragonflyModeStandalone = "standalone"
+	DragonflyModeCluster    = "cluster"
+	DragonflyModeSentinel   = "sentinel"
+)
+
+// Replica read preferences for cluster and sentinel mode.
+const (
+	DragonflyReadFromMaster  = "master"
+	DragonflyReadFromReplica = "replica"
+	DragonflyReadFromLatency = "latency"
+	DragonflyReadFromRandom  = "random"
+)
+
 type DragonflyManager struct {
 	Host     string
 	Port     int
 	DB       int
 	Password string
 	UseSSL   bool
-	client   *redis.Client
+
+	// Mode is standalone, cluster or sentinel.
+	Mode string
+	// Addrs are the cluster nodes or sentinels.
+	Addrs []string
+	// MasterName is the name of the master monitored by the sentinels.
+	MasterName       string
+	SentinelPassword string
+	// ReadFrom selects where read-only commands go: master, replica,
+	// latency or random. Writes always go to the master.
+	ReadFrom string
+
+	// Protocol is the RESP version, 3 unless set to 2 for servers or
+	// proxies that don't support RESP3.
+	Protocol int
+	// ClientCache enables client-side caching with server-assisted
+	// invalidation for keys below ClientCachePrefixes. It's only used when
+	// reads go to the master.
+	ClientCache         bool
+	ClientCachePrefixes []string
+	ClientCacheTTL      time.Duration
+
+	client redis.UniversalClient
+	cache  *trackingCache
 }
 
-func NewDragonflyManager(host string, port int, db int, password string, useSSL bool) *DragonflyManager {
+func NewDragonflyManager(host string, port int, dbIndex int, password string, useSSL bool) *DragonflyManager {
 	redisConfig := db.GetSettingMap("DRAGONFLY_CONFIG")
 
 	if host == "" {
@@ -48,16 +88,16 @@ func NewDragonflyManager(host string, port int, db int, password string, useSSL
 		}
 	}
 
-	if db < 0 {
+	if dbIndex < 0 {
 		dbStr := redisConfig["db"]
 		if dbStr != "" {
 			var err error
-			db, err = strconv.Atoi(dbStr)
+			dbIndex, err = strconv.Atoi(dbStr)
 			if err != nil {
-				db = 0
+				dbIndex = 0
 			}
 		} else {
-			db = 0
+			dbIndex = 0
 		}
 	}
 
@@ -73,51 +113,218 @@ func NewDragonflyManager(host string, port int, db int, password string, useSSL
 	}
 
 	manager := &DragonflyManager{
-		Host:     host,
-		Port:     port,
-		DB:       db,
-		Password: password,
-		UseSSL:   useSSL,
+		Host:                host,
+		Port:                port,
+		DB:                  dbIndex,
+		Password:            password,
+		UseSSL:              useSSL,
+		Mode:                strings.ToLower(redisConfig["mode"]),
+		Addrs:               splitAddrs(redisConfig["addrs"]),
+		MasterName:          redisConfig["master_name"],
+		SentinelPassword:    redisConfig["sentinel_password"],
+		ReadFrom:            strings.ToLower(redisConfig["read_from"]),
+		Protocol:            3,
+		ClientCache:         redisConfig["client_cache"] == "True" || redisConfig["client_cache"] == "true" || redisConfig["client_cache"] == "1",
+		ClientCachePrefixes: []string{"shared_state:"},
+	}
+
+	if protocol, err := strconv.Atoi(redisConfig["protocol"]); err == nil && protocol == 2 {
+		manager.Protocol = 2
+	}
+	if prefixes := splitAddrs(redisConfig["client_cache_prefixes"]); len(prefixes) > 0 {
+		manager.ClientCachePrefixes = prefixes
+	}
+	if ttl, err := strconv.Atoi(redisConfig["client_cache_ttl"]); err == nil && ttl > 0 {
+		manager.ClientCacheTTL = time.Duration(ttl) * time.Second
 	}
 
 	manager.client = manager.createClient()
 	return manager
 }
 
-func (m *DragonflyManager) createClient() *redis.Client {
-	client := redis.NewClient(&redis.Options{
-		Addr:     fmt.Sprintf("%s:%d", m.Host, m.Port),
-		Password: m.Password,
-		DB:       m.DB,
-		TLSConfig: func() interface{} {
-			if m.UseSSL {
-				return &tls.Config{
-					MinVersion: tls.VersionTLS12,
-				}
-			}
-			return nil
-		}(),
-	})
+func splitAddrs(addrs string) []string {
+	result := []string{}
+	for _, addr := range strings.Split(addrs, ",") {
+		if addr = strings.TrimSpace(addr); addr != "" {
+			result = append(result, addr)
+		}
+	}
+	return result
+}
+
+func (m *DragonflyManager) tlsConfig() *tls.Config {
+	if !m.UseSSL {
+		return nil
+	}
+
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+	}
+}
+
+// newClient creates the client for the configured mode. Sentinel mode with a
+// replica read preference needs a failover cluster client, the universal
+// client always reads from the master there.
+func (m *DragonflyManager) newClient(protocol int, onConnect func(context.Context, *redis.Conn) error) (redis.UniversalClient, error) {
+	switch m.Mode {
+	case "", DragonflyModeStandalone:
+		return redis.NewClient(&redis.Options{
+			Addr:      fmt.Sprintf("%s:%d", m.Host, m.Port),
+			Password:  m.Password,
+			DB:        m.DB,
+			Protocol:  protocol,
+			TLSConfig: m.tlsConfig(),
+			OnConnect: onConnect,
+		}), nil
+	case DragonflyModeCluster, DragonflyModeSentinel:
+	default:
+		return nil, fmt.Errorf("unknown DragonflyDB mode %q", m.Mode)
+	}
+
+	if len(m.Addrs) == 0 {
+		return nil, fmt.Errorf("DragonflyDB %s mode needs at least one address", m.Mode)
+	}
+
+	options := &redis.UniversalOptions{
+		Addrs:            m.Addrs,
+		Password:         m.Password,
+		SentinelPassword: m.SentinelPassword,
+		Protocol:         protocol,
+		TLSConfig:        m.tlsConfig(),
+		OnConnect:        onConnect,
+	}
+	switch m.ReadFrom {
+	case "", DragonflyReadFromMaster:
+	case DragonflyReadFromReplica:
+		options.ReadOnly = true
+	case DragonflyReadFromLatency:
+		options.ReadOnly = true
+		options.RouteByLatency = true
+	case DragonflyReadFromRandom:
+		options.ReadOnly = true
+		options.RouteRandomly = true
+	default:
+		return nil, fmt.Errorf("unknown DragonflyDB read preference %q", m.ReadFrom)
+	}
+
+	if m.Mode == DragonflyModeCluster {
+		if m.DB != 0 {
+			return nil, fmt.Errorf("DragonflyDB cluster mode only supports database 0")
+		}
+		return redis.NewClusterClient(options.Cluster()), nil
+	}
+
+	if m.MasterName == "" {
+		return nil, fmt.Errorf("DragonflyDB sentinel mode needs a master name")
+	}
+	options.MasterName = m.MasterName
+	options.DB = m.DB
+
+	failoverOptions := options.Failover()
+	if !options.ReadOnly {
+		return redis.NewFailoverClient(failoverOptions), nil
+	}
+
+	failoverOptions.ReplicaOnly = m.ReadFrom == DragonflyReadFromReplica
+	failoverOptions.RouteByLatency = options.RouteByLatency
+	failoverOptions.RouteRandomly = options.RouteRandomly
+	return redis.NewFailoverClusterClient(failoverOptions), nil
+}
+
+func (m *DragonflyManager) createClient() redis.UniversalClient {
+	client, err := m.newClient(m.Protocol, nil)
+	if err != nil {
+		dragonflyLogger.Printf("Error creating DragonflyDB client: %v", err)
+		return nil
+	}
 
 	ctx := context.Background()
-	_, err := client.Ping(ctx).Result()
+	_, err = client.Ping(ctx).Result()
 	if err != nil {
 		dragonflyLogger.Printf("Error creating DragonflyDB client: %v", err)
+		_ = client.Close()
 		return nil
 	}
 
-	dragonflyLogger.Printf("DragonflyDB client initialized with host: %s, port: %d", m.Host, m.Port)
+	if m.Mode == DragonflyModeCluster || m.Mode == DragonflyModeSentinel {
+		dragonflyLogger.Printf("DragonflyDB %s client initialized with addresses: %s", m.Mode, strings.Join(m.Addrs, ","))
+	} else {
+		dragonflyLogger.Printf("DragonflyDB client initialized with host: %s, port: %d", m.Host, m.Port)
+	}
+
+	if m.ClientCache {
+		m.cache = m.createCache(ctx)
+	}
 	return client
 }
 
-func (m *DragonflyManager) Client() *redis.Client {
+// createCache starts client-side caching. Invalidations are received through
+// pub/sub, which needs RESP2 since go-redis doesn't surface RESP3 push
+// messages for tracking.
+func (m *DragonflyManager) createCache(ctx context.Context) *trackingCache {
+	if m.Mode == DragonflyModeCluster || (m.ReadFrom != "" && m.ReadFrom != DragonflyReadFromMaster) {
+		dragonflyLogger.Printf("DragonflyDB client-side caching needs reads from a single master, disabling it")
+		return nil
+	}
+
+	cache := newTrackingCache(m.ClientCachePrefixes, m.ClientCacheTTL)
+	err := cache.start(ctx, func(onConnect func(context.Context, *redis.Conn) error) (redis.UniversalClient, error) {
+		return m.newClient(2, onConnect)
+	})
+	if err != nil {
+		dragonflyLogger.Printf("Error enabling DragonflyDB client-side caching, disabling it: %v", err)
+		return nil
+	}
+
+	dragonflyLogger.Printf("DragonflyDB client-side caching enabled for prefixes: %s", strings.Join(m.ClientCachePrefixes, ","))
+	return cache
+}
+
+// Client returns the underlying client, a *redis.Client in standalone mode
+// and a *redis.ClusterClient or failover client otherwise.
+func (m *DragonflyManager) Client() redis.UniversalClient {
 	return m.client
 }
 
+// Ping checks DragonflyDB answers, connecting first if the manager was
+// created while it was unreachable.
+func (m *DragonflyManager) Ping(ctx context.Context) error {
+	if m.client == nil {
+		m.client = m.createClient()
+	}
+	if m.client == nil {
+		return errDragonflyNotInitialized
+	}
+	return m.client.Ping(ctx).Err()
+}
+
+func (m *DragonflyManager) Close() error {
+	if m.cache != nil {
+		_ = m.cache.close()
+		m.cache = nil
+	}
+	if m.client == nil {
+		return nil
+	}
+
+	err := m.client.Close()
+	m.client = nil
+	return err
+}
+
 func (m *DragonflyManager) Get(key string) (string, error) {
 	if m.client == nil {
 		dragonflyLogger.Println("DragonflyDB client not initialized. Returning empty string.")
-		return "", fmt.Errorf("DragonflyDB client not initialized")
+		return "", errDragonflyNotInitialized
+	}
+
+	cached := m.cache != nil && m.cache.tracks(key)
+	var generation uint64
+	if cached {
+		if val, ok := m.cache.get(key); ok {
+			return val, nil
+		}
+		generation = m.cache.generation.Load()
 	}
 
 	ctx := context.Background()
@@ -129,13 +336,16 @@ func (m *DragonflyManager) Get(key string) (string, error) {
 		return "", err
 	}
 
+	if cached {
+		m.cache.store(key, val, generation)
+	}
 	return val, nil
 }
 
 func (m *DragonflyManager) Set(key string, value string, ex int) (bool, error) {
 	if m.client == nil {
 		dragonflyLogger.Println("DragonflyDB client not initialized. Returning false.")
-		return false, fmt.Errorf("DragonflyDB client not initialized")
+		return false, errDragonflyNotInitialized
 	}
 
 	ctx := context.Background()
@@ -144,6 +354,9 @@ func (m *DragonflyManager) Set(key string, value string, ex int) (bool, error) {
 		expiration = time.Duration(ex) * time.Second
 	}
 
+	if m.cache != nil {
+		m.cache.invalidate(key)
+	}
 	_, err := m.client.Set(ctx, key, value, expiration).Result()
 	if err != nil {
 		dragonflyLogger.Printf("Error setting value in DragonflyDB: %v", err)
@@ -156,10 +369,13 @@ func (m *DragonflyManager) Set(key string, value string, ex int) (bool, error) {
 func (m *DragonflyManager) Delete(key string) (bool, error) {
 	if m.client == nil {
 		dragonflyLogger.Println("DragonflyDB client not initialized. Returning false.")
-		return false, fmt.Errorf("DragonflyDB client not initialized")
+		return false, errDragonflyNotInitialized
 	}
 
 	ctx := context.Background()
+	if m.cache != nil {
+		m.cache.invalidate(key)
+	}
 	result, err := m.client.Del(ctx, key).Result()
 	if err != nil {
 		dragonflyLogger.Printf("Error deleting key from DragonflyDB: %v", err)
@@ -172,7 +388,7 @@ func (m *DragonflyManager) Delete(key string) (bool, error) {
 func (m *DragonflyManager) Exists(key string) (bool, error) {
 	if m.client == nil {
 		dragonflyLogger.Println("DragonflyDB client not initialized. Returning false.")
-		return false, fmt.Errorf("DragonflyDB client not initialized")
+		return false, errDragonflyNotInitialized
 	}
 
 	ctx := context.Background()
@@ -188,7 +404,7 @@ func (m *DragonflyManager) Exists(key string) (bool, error) {
 func (m *DragonflyManager) Expire(key string, seconds int) (bool, error) {
 	if m.client == nil {
 		dragonflyLogger.Println("DragonflyDB client not initialized. Returning false.")
-		return false, fmt.Errorf("DragonflyDB client not initialized")
+		return false, errDragonflyNotInitialized
 	}
 
 	ctx := context.Background()
@@ -201,10 +417,74 @@ func (m *DragonflyManager) Expire(key string, seconds int) (bool, error) {
 	return result, nil
 }
 
+var releaseLockScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0`)
+
+var renewLockScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("PEXPIRE", KEYS[1], ARGV[2])
+end
+return 0`)
+
+// AcquireLock sets key to token if it does not exist yet. The lock expires
+// after ttl so a crashed holder cannot keep it forever.
+func (m *DragonflyManager) AcquireLock(key string, token string, ttl time.Duration) (bool, error) {
+	if m.client == nil {
+		dragonflyLogger.Println("DragonflyDB client not initialized. Returning false.")
+		return false, errDragonflyNotInitialized
+	}
+
+	ctx := context.Background()
+	acquired, err := m.client.SetNX(ctx, key, token, ttl).Result()
+	if err != nil {
+		dragonflyLogger.Printf("Error acquiring lock in DragonflyDB: %v", err)
+		return false, err
+	}
+
+	return acquired, nil
+}
+
+// RenewLock resets the expiry of key to ttl only if it still holds token.
+func (m *DragonflyManager) RenewLock(key string, token string, ttl time.Duration) (bool, error) {
+	if m.client == nil {
+		dragonflyLogger.Println("DragonflyDB client not initialized. Returning false.")
+		return false, errDragonflyNotInitialized
+	}
+
+	ctx := context.Background()
+	result, err := renewLockScript.Run(ctx, m.client, []string{key}, token, ttl.Milliseconds()).Int()
+	if err != nil {
+		dragonflyLogger.Printf("Error renewing lock in DragonflyDB: %v", err)
+		return false, err
+	}
+
+	return result > 0, nil
+}
+
+// ReleaseLock deletes key only if it still holds token.
+func (m *DragonflyManager) ReleaseLock(key string, token string) (bool, error) {
+	if m.client == nil {
+		dragonflyLogger.Println("DragonflyDB client not initialized. Returning false.")
+		return false, errDragonflyNotInitialized
+	}
+
+	ctx := context.Background()
+	result, err := releaseLockScript.Run(ctx, m.client, []string{key}, token).Int()
+	if err != nil {
+		dragonflyLogger.Printf("Error releasing lock in DragonflyDB: %v", err)
+		return false, err
+	}
+
+	return result > 0, nil
+}
+
 func (m *DragonflyManager) GetJSON(key string) (map[string]interface{}, error) {
 	if m.client == nil {
 		dragonflyLogger.Println("DragonflyDB client not initialized. Returning nil.")
-		return nil, fmt.Errorf("DragonflyDB client not initialized")
+		return nil, errDragonflyNotInitialized
 	}
 
 	value, err := m.Get(key)
@@ -228,7 +508,7 @@ func (m *DragonflyManager) GetJSON(key string) (map[string]interface{}, error) {
 func (m *DragonflyManager) SetJSON(key string, value map[string]interface{}, ex int) (bool, error) {
 	if m.client == nil {
 		dragonflyLogger.Println("DragonflyDB client not initialized. Returning false.")
-		return false, fmt.Errorf("DragonflyDB client not initialized")
+		return false, errDragonflyNotInitialized
 	}
 
 	jsonValue, err := json.Marshal(value)
@@ -243,7 +523,7 @@ func (m *DragonflyManager) SetJSON(key string, value map[string]interface{}, ex
 func (m *DragonflyManager) HGet(name string, key string) (string, error) {
 	if m.client == nil {
 		dragonflyLogger.Println("DragonflyDB client not initialized. Returning empty string.")
-		return "", fmt.Errorf("DragonflyDB client not initialized")
+		return "", errDragonflyNotInitialized
 	}
 
 	ctx := context.Background()
@@ -261,7 +541,7 @@ func (m *DragonflyManager) HGet(name string, key string) (string, error) {
 func (m *DragonflyManager) HSet(name string, key string, value string) (bool, error) {
 	if m.client == nil {
 		dragonflyLogger.Println("DragonflyDB client not initialized. Returning false.")
-		return false, fmt.Errorf("DragonflyDB client not initialized")
+		return false, errDragonflyNotInitialized
 	}
 
 	ctx := context.Background()
@@ -277,7 +557,7 @@ func (m *DragonflyManager) HSet(name string, key string, value string) (bool, er
 func (m *DragonflyManager) HGetAll(name string) (map[string]string, error) {
 	if m.client == nil {
 		dragonflyLogger.Println("DragonflyDB client not initialized. Returning empty map.")
-		return map[string]string{}, fmt.Errorf("DragonflyDB client not initialized")
+		return map[string]string{}, errDragonflyNotInitialized
 	}
 
 	ctx := context.Background()
@@ -473,11 +753,18 @@ func (c *DragonflyCache) HasKey(key string) (bool, error) {
 
 func (c *DragonflyCache) Clear() (bool, error) {
 	if c.Manager.client == nil {
-		return false, fmt.Errorf("DragonflyDB client not initialized")
+		return false, errDragonflyNotInitialized
 	}
 
 	ctx := context.Background()
-	_, err := c.Manager.client.FlushDB(ctx).Result()
+	var err error
+	if clusterClient, ok := c.Manager.client.(*redis.ClusterClient); ok {
+		err = clusterClient.ForEachMaster(ctx, func(ctx context.Context, client *redis.Client) error {
+			return client.FlushDB(ctx).Err()
+		})
+	} else {
+		_, err = c.Manager.client.FlushDB(ctx).Result()
+	}
 	if err != nil {
 		dragonflyLogger.Printf("Error clearing DragonflyDB cache: %v", err)
 		return false, err
@@ -543,3 +830,7 @@ except Exception as e:
 }
 
 var dragonflyManager = NewDragonflyManager("", 0, -1, "", false)
+
+func GetDragonflyManager() *DragonflyManager {
+	return dragonflyManager
+}
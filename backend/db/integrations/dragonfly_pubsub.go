@@ -0,0 +1,56 @@
+package integrations
+
+import (
+	"context"
+	"fmt"
+)
+
+// Publish sends payload to the subscribers of channel. Pub/sub is
+// fire-and-forget: subscribers that are disconnected miss the message.
+func (m *DragonflyManager) Publish(ctx context.Context, channel string, payload []byte) error {
+	if m.client == nil {
+		dragonflyLogger.Println("DragonflyDB client not initialized. Returning error.")
+		return errDragonflyNotInitialized
+	}
+
+	err := m.client.Publish(ctx, channel, payload).Err()
+	if err != nil {
+		dragonflyLogger.Printf("Error publishing to channel in DragonflyDB: %v", err)
+		return err
+	}
+
+	return nil
+}
+
+// SubscribeChannel calls handler with every message published to channel
+// until ctx is cancelled. It returns once the subscription is confirmed;
+// after a connection loss the subscription is re-established automatically.
+func (m *DragonflyManager) SubscribeChannel(ctx context.Context, channel string, handler func(payload []byte)) error {
+	if m.client == nil {
+		dragonflyLogger.Println("DragonflyDB client not initialized. Returning error.")
+		return errDragonflyNotInitialized
+	}
+
+	pubsub := m.client.Subscribe(ctx, channel)
+	if _, err := pubsub.Receive(ctx); err != nil {
+		_ = pubsub.Close()
+		return fmt.Errorf("subscribe to %s: %w", channel, err)
+	}
+
+	go func() {
+		defer pubsub.Close()
+		messages := pubsub.Channel()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case message, ok := <-messages:
+				if !ok {
+					return
+				}
+				handler([]byte(message.Payload))
+			}
+		}
+	}()
+	return nil
+}
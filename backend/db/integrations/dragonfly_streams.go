@@ -0,0 +1,166 @@
+package integrations
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+func toStreamMessages(messages []redis.XMessage) []StreamMessage {
+	result := make([]StreamMessage, 0, len(messages))
+	for _, message := range messages {
+		result = append(result, StreamMessage{ID: message.ID, Values: message.Values})
+	}
+	return result
+}
+
+// StreamAdd appends values to stream and returns the id of the entry. If
+// maxLen is greater than zero the stream is approximately trimmed to it.
+func (m *DragonflyManager) StreamAdd(stream string, values map[string]interface{}, maxLen int64) (string, error) {
+	if m.client == nil {
+		dragonflyLogger.Println("DragonflyDB client not initialized. Returning empty string.")
+		return "", errDragonflyNotInitialized
+	}
+
+	ctx := context.Background()
+	id, err := m.client.XAdd(ctx, &redis.XAddArgs{
+		Stream: stream,
+		MaxLen: maxLen,
+		Approx: maxLen > 0,
+		Values: values,
+	}).Result()
+	if err != nil {
+		dragonflyLogger.Printf("Error adding to stream in DragonflyDB: %v", err)
+		return "", err
+	}
+
+	return id, nil
+}
+
+// StreamCreateGroup creates a consumer group reading stream from start, "$"
+// for new messages only or "0" for the whole stream. The stream is created
+// if it doesn't exist and an existing group is not an error.
+func (m *DragonflyManager) StreamCreateGroup(stream string, group string, start string) error {
+	if m.client == nil {
+		dragonflyLogger.Println("DragonflyDB client not initialized. Returning error.")
+		return errDragonflyNotInitialized
+	}
+
+	if start == "" {
+		start = "$"
+	}
+
+	ctx := context.Background()
+	err := m.client.XGroupCreateMkStream(ctx, stream, group, start).Err()
+	if err != nil && !strings.HasPrefix(err.Error(), "BUSYGROUP") {
+		dragonflyLogger.Printf("Error creating stream consumer group in DragonflyDB: %v", err)
+		return err
+	}
+
+	return nil
+}
+
+// StreamReadGroup reads up to count new messages for consumer of group,
+// blocking up to block if there are none. No messages is not an error.
+func (m *DragonflyManager) StreamReadGroup(ctx context.Context, stream string, group string, consumer string, count int64, block time.Duration) ([]StreamMessage, error) {
+	if m.client == nil {
+		dragonflyLogger.Println("DragonflyDB client not initialized. Returning nil.")
+		return nil, errDragonflyNotInitialized
+	}
+
+	streams, err := m.client.XReadGroup(ctx, &redis.XReadGroupArgs{
+		Group:    group,
+		Consumer: consumer,
+		Streams:  []string{stream, ">"},
+		Count:    count,
+		Block:    block,
+	}).Result()
+	if err == redis.Nil {
+		return nil, nil
+	} else if err != nil {
+		dragonflyLogger.Printf("Error reading stream group from DragonflyDB: %v", err)
+		return nil, err
+	}
+
+	messages := []StreamMessage{}
+	for _, s := range streams {
+		messages = append(messages, toStreamMessages(s.Messages)...)
+	}
+	return messages, nil
+}
+
+// StreamAck acknowledges messages of group and returns how many were pending.
+func (m *DragonflyManager) StreamAck(stream string, group string, ids ...string) (int64, error) {
+	if m.client == nil {
+		dragonflyLogger.Println("DragonflyDB client not initialized. Returning 0.")
+		return 0, errDragonflyNotInitialized
+	}
+
+	ctx := context.Background()
+	acked, err := m.client.XAck(ctx, stream, group, ids...).Result()
+	if err != nil {
+		dragonflyLogger.Printf("Error acknowledging stream messages in DragonflyDB: %v", err)
+		return 0, err
+	}
+
+	return acked, nil
+}
+
+// StreamPending lists up to count pending messages of group, oldest first.
+func (m *DragonflyManager) StreamPending(stream string, group string, count int64) ([]StreamPendingEntry, error) {
+	if m.client == nil {
+		dragonflyLogger.Println("DragonflyDB client not initialized. Returning nil.")
+		return nil, errDragonflyNotInitialized
+	}
+
+	ctx := context.Background()
+	pending, err := m.client.XPendingExt(ctx, &redis.XPendingExtArgs{
+		Stream: stream,
+		Group:  group,
+		Start:  "-",
+		End:    "+",
+		Count:  count,
+	}).Result()
+	if err != nil {
+		dragonflyLogger.Printf("Error listing pending stream messages in DragonflyDB: %v", err)
+		return nil, err
+	}
+
+	entries := make([]StreamPendingEntry, 0, len(pending))
+	for _, p := range pending {
+		entries = append(entries, StreamPendingEntry{
+			ID:         p.ID,
+			Consumer:   p.Consumer,
+			Idle:       p.Idle,
+			RetryCount: p.RetryCount,
+		})
+	}
+	return entries, nil
+}
+
+// StreamClaimStale transfers up to count messages that have been pending for
+// at least minIdle, e.g. because their consumer crashed, to consumer.
+func (m *DragonflyManager) StreamClaimStale(stream string, group string, consumer string, minIdle time.Duration, count int64) ([]StreamMessage, error) {
+	if m.client == nil {
+		dragonflyLogger.Println("DragonflyDB client not initialized. Returning nil.")
+		return nil, errDragonflyNotInitialized
+	}
+
+	ctx := context.Background()
+	messages, _, err := m.client.XAutoClaim(ctx, &redis.XAutoClaimArgs{
+		Stream:   stream,
+		Group:    group,
+		Consumer: consumer,
+		MinIdle:  minIdle,
+		Start:    "0-0",
+		Count:    count,
+	}).Result()
+	if err != nil {
+		dragonflyLogger.Printf("Error claiming stale stream messages in DragonflyDB: %v", err)
+		return nil, err
+	}
+
+	return toStreamMessages(messages), nil
+}
@@ -0,0 +1,88 @@
+package integrations
+
+import (
+	"testing"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+func TestDragonflyNewClient(t *testing.T) {
+	for name, test := range map[string]struct {
+		manager DragonflyManager
+		cluster bool
+	}{
+		"standalone": {
+			manager: DragonflyManager{Host: "localhost", Port: 6379},
+		},
+		"cluster": {
+			manager: DragonflyManager{Mode: DragonflyModeCluster, Addrs: []string{"node-0:6379", "node-1:6379"}, ReadFrom: DragonflyReadFromLatency},
+			cluster: true,
+		},
+		"sentinel": {
+			manager: DragonflyManager{Mode: DragonflyModeSentinel, Addrs: []string{"sentinel:26379"}, MasterName: "dragonfly"},
+		},
+		"sentinel replica reads": {
+			manager: DragonflyManager{Mode: DragonflyModeSentinel, Addrs: []string{"sentinel:26379"}, MasterName: "dragonfly", ReadFrom: DragonflyReadFromReplica},
+			cluster: true,
+		},
+	} {
+		client, err := test.manager.newClient(3, nil)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+
+		_, isCluster := client.(*redis.ClusterClient)
+		if isCluster != test.cluster {
+			t.Errorf("%s: expected cluster client %v, got %T", name, test.cluster, client)
+		}
+		_ = client.Close()
+	}
+}
+
+func TestDragonflyNewClientErrors(t *testing.T) {
+	for name, manager := range map[string]DragonflyManager{
+		"unknown mode":       {Mode: "ring"},
+		"no addresses":       {Mode: DragonflyModeCluster},
+		"cluster database":   {Mode: DragonflyModeCluster, Addrs: []string{"node-0:6379"}, DB: 1},
+		"no master name":     {Mode: DragonflyModeSentinel, Addrs: []string{"sentinel:26379"}},
+		"unknown preference": {Mode: DragonflyModeCluster, Addrs: []string{"node-0:6379"}, ReadFrom: "nearest"},
+	} {
+		if _, err := manager.newClient(3, nil); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
+
+func TestTrackingCache(t *testing.T) {
+	cache := newTrackingCache([]string{"shared_state:"}, time.Minute)
+	if cache.tracks("session:1") || !cache.tracks("shared_state:agent") {
+		t.Fatal("expected only keys below the prefix to be tracked")
+	}
+
+	generation := cache.generation.Load()
+	cache.store("shared_state:agent", "v1", generation)
+	if value, ok := cache.get("shared_state:agent"); !ok || value != "v1" {
+		t.Fatalf("expected cached value, got %q, %v", value, ok)
+	}
+
+	cache.invalidate("shared_state:agent")
+	if _, ok := cache.get("shared_state:agent"); ok {
+		t.Error("expected invalidated key to be evicted")
+	}
+
+	// a read that raced with an invalidation must not be cached
+	cache.store("shared_state:agent", "stale", generation)
+	if _, ok := cache.get("shared_state:agent"); ok {
+		t.Error("expected stale read not to be cached")
+	}
+
+	cache.store("shared_state:agent", "v2", cache.generation.Load())
+	messages := make(chan *redis.Message, 1)
+	messages <- &redis.Message{Channel: invalidationChannel}
+	close(messages)
+	cache.receive(messages)
+	if _, ok := cache.get("shared_state:agent"); ok {
+		t.Error("expected a flush to evict all keys")
+	}
+}
@@ -0,0 +1,176 @@
+package integrations
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	invalidationChannel = "__redis__:invalidate"
+
+	defaultClientCacheTTL        = 30 * time.Second
+	defaultClientCacheMaxEntries = 10000
+)
+
+type trackedValue struct {
+	value   string
+	expires time.Time
+}
+
+// trackingCache is a client-side cache for keys below a set of prefixes. It
+// uses server-assisted invalidation in broadcast mode: a dedicated RESP2
+// connection enables CLIENT TRACKING redirected to itself and subscribes to
+// the invalidation channel, so every write to a tracked prefix evicts the
+// local copy. When the connection is re-established the cache is flushed,
+// since invalidations may have been missed in between. Entries additionally
+// expire after ttl.
+type trackingCache struct {
+	prefixes   []string
+	ttl        time.Duration
+	maxEntries int
+
+	mu      sync.RWMutex
+	entries map[string]trackedValue
+
+	// generation is incremented with every invalidation, so reads that
+	// raced with one are not stored.
+	generation atomic.Uint64
+
+	client redis.UniversalClient
+	pubsub *redis.PubSub
+}
+
+func newTrackingCache(prefixes []string, ttl time.Duration) *trackingCache {
+	if ttl <= 0 {
+		ttl = defaultClientCacheTTL
+	}
+
+	return &trackingCache{
+		prefixes:   prefixes,
+		ttl:        ttl,
+		maxEntries: defaultClientCacheMaxEntries,
+		entries:    map[string]trackedValue{},
+	}
+}
+
+// start connects the invalidation client created by newClient and waits for
+// the subscription to be confirmed.
+func (c *trackingCache) start(ctx context.Context, newClient func(onConnect func(context.Context, *redis.Conn) error) (redis.UniversalClient, error)) error {
+	client, err := newClient(c.enableTracking)
+	if err != nil {
+		return err
+	}
+
+	pubsub := client.Subscribe(ctx, invalidationChannel)
+	_, err = pubsub.Receive(ctx)
+	if err != nil {
+		_ = pubsub.Close()
+		_ = client.Close()
+		return fmt.Errorf("subscribe to invalidations: %w", err)
+	}
+
+	c.client = client
+	c.pubsub = pubsub
+	go c.receive(pubsub.Channel())
+	return nil
+}
+
+func (c *trackingCache) enableTracking(ctx context.Context, cn *redis.Conn) error {
+	id, err := cn.ClientID(ctx).Result()
+	if err != nil {
+		return err
+	}
+
+	args := []interface{}{"CLIENT", "TRACKING", "ON", "REDIRECT", id, "BCAST"}
+	for _, prefix := range c.prefixes {
+		args = append(args, "PREFIX", prefix)
+	}
+	err = cn.Do(ctx, args...).Err()
+	if err != nil {
+		return fmt.Errorf("enable client tracking: %w", err)
+	}
+
+	c.flush()
+	return nil
+}
+
+func (c *trackingCache) receive(messages <-chan *redis.Message) {
+	for message := range messages {
+		if len(message.PayloadSlice) > 0 {
+			for _, key := range message.PayloadSlice {
+				c.invalidate(key)
+			}
+		} else if message.Payload != "" {
+			c.invalidate(message.Payload)
+		} else {
+			// a nil payload is sent on FLUSHALL and FLUSHDB
+			c.flush()
+		}
+	}
+}
+
+func (c *trackingCache) tracks(key string) bool {
+	for _, prefix := range c.prefixes {
+		if strings.HasPrefix(key, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *trackingCache) get(key string) (string, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	entry, ok := c.entries[key]
+	if !ok || time.Now().After(entry.expires) {
+		return "", false
+	}
+	return entry.value, true
+}
+
+// store caches value if no invalidation happened since generation was read.
+func (c *trackingCache) store(key, value string, generation uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.generation.Load() != generation {
+		return
+	}
+	if _, ok := c.entries[key]; !ok && len(c.entries) >= c.maxEntries {
+		return
+	}
+	c.entries[key] = trackedValue{value: value, expires: time.Now().Add(c.ttl)}
+}
+
+func (c *trackingCache) invalidate(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.generation.Add(1)
+	delete(c.entries, key)
+}
+
+func (c *trackingCache) flush() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.generation.Add(1)
+	c.entries = map[string]trackedValue{}
+}
+
+func (c *trackingCache) close() error {
+	if c.pubsub != nil {
+		_ = c.pubsub.Close()
+	}
+	if c.client != nil {
+		return c.client.Close()
+	}
+	return nil
+}
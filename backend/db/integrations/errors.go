@@ -0,0 +1,12 @@
+package integrations
+
+import "github.com/spectrumwebco/agent_runtime/backend/core/kerrors"
+
+// The errors of clients that aren't available. They match
+// kerrors.ErrBackendUnavailable, so the API answers them with 503.
+var (
+	errDragonflyNotInitialized = kerrors.New(kerrors.BackendUnavailable, "DragonflyDB client not initialized")
+	errRAGflowNotInitialized   = kerrors.New(kerrors.BackendUnavailable, "RAGflow client not initialized")
+	errKafkaDraining           = kerrors.New(kerrors.BackendUnavailable, "kafka consumers are draining for shutdown")
+	errSupabaseNotInitialized  = kerrors.New(kerrors.BackendUnavailable, "Supabase URL or key not configured")
+)
@@ -0,0 +1,8 @@
+// Package integrationsmock provides in-memory implementations of the
+// integrations.MessageQueue, integrations.KVStore, integrations.StreamStore,
+// integrations.PubSub, integrations.VectorStore and integrations.SQLStore
+// interfaces. They need no network access, build tags or Python runtime and
+// can be installed process-wide with integrations.SetMessageQueue,
+// integrations.SetKVStore, integrations.SetStreamStore, integrations.SetPubSub
+// and integrations.SetVectorStore, or all at once with InstallInMemory.
+package integrationsmock
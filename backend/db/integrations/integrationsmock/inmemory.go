@@ -0,0 +1,60 @@
+package integrationsmock
+
+import (
+	"github.com/spectrumwebco/agent_runtime/backend/db/integrations"
+)
+
+// InMemory holds the stores installed by InstallInMemory.
+type InMemory struct {
+	KV      *KVStore
+	Streams *StreamStore
+	PubSub  *PubSub
+	Queue   *MessageQueue
+	Vectors *VectorStore
+	SQL     *SQLiteStore
+}
+
+// InstallInMemory replaces every integration in the integrations registry
+// with an in-memory implementation, so the backend runs without Dragonfly,
+// RocketMQ, Kafka, RAGflow, Postgres or Doris. Postgres and Doris share one
+// SQLite database at sqlitePath, which is kept in memory if empty.
+func InstallInMemory(sqlitePath string) (*InMemory, error) {
+	sqlStore, err := NewSQLiteStore(sqlitePath)
+	if err != nil {
+		return nil, err
+	}
+
+	m := &InMemory{
+		KV:      NewKVStore(),
+		Streams: NewStreamStore(),
+		PubSub:  NewPubSub(),
+		Queue:   NewMessageQueue(),
+		Vectors: NewVectorStore(),
+		SQL:     sqlStore,
+	}
+
+	integrations.SetKVStore(m.KV)
+	integrations.SetLocker(m.KV)
+	integrations.SetStreamStore(m.Streams)
+	integrations.SetPubSub(m.PubSub)
+	integrations.SetMessageQueue(m.Queue)
+	integrations.SetEventProducer(m.Queue)
+	integrations.SetVectorStore(m.Vectors)
+	integrations.SetPostgresStore(m.SQL)
+	integrations.SetDorisStore(m.SQL)
+	return m, nil
+}
+
+// Uninstall restores the default integrations and closes the database.
+func (m *InMemory) Uninstall() error {
+	integrations.SetKVStore(nil)
+	integrations.SetLocker(nil)
+	integrations.SetStreamStore(nil)
+	integrations.SetPubSub(nil)
+	integrations.SetMessageQueue(nil)
+	integrations.SetEventProducer(nil)
+	integrations.SetVectorStore(nil)
+	integrations.SetPostgresStore(nil)
+	integrations.SetDorisStore(nil)
+	return m.SQL.Close()
+}
@@ -0,0 +1,202 @@
+package integrationsmock
+
+import (
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/spectrumwebco/agent_runtime/backend/db/integrations"
+)
+
+var (
+	_ integrations.KVStore = (*KVStore)(nil)
+	_ integrations.Locker  = (*KVStore)(nil)
+)
+
+type kvEntry struct {
+	value    string
+	expireAt time.Time
+}
+
+func (e kvEntry) expired(now time.Time) bool {
+	return !e.expireAt.IsZero() && now.After(e.expireAt)
+}
+
+// KVStore is an in-memory integrations.KVStore with expiry support.
+type KVStore struct {
+	values map[string]kvEntry
+	hashes map[string]map[string]string
+	now    func() time.Time
+	mu     sync.Mutex
+}
+
+func NewKVStore() *KVStore {
+	return &KVStore{
+		values: make(map[string]kvEntry),
+		hashes: make(map[string]map[string]string),
+		now:    time.Now,
+	}
+}
+
+// SetClock replaces the clock used to evaluate expirations.
+func (s *KVStore) SetClock(now func() time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.now = now
+}
+
+func (s *KVStore) lookup(key string) (kvEntry, bool) {
+	entry, ok := s.values[key]
+	if ok && entry.expired(s.now()) {
+		delete(s.values, key)
+		return kvEntry{}, false
+	}
+	return entry, ok
+}
+
+func (s *KVStore) Get(key string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entry, _ := s.lookup(key)
+	return entry.value, nil
+}
+
+func (s *KVStore) Set(key string, value string, ex int) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entry := kvEntry{value: value}
+	if ex > 0 {
+		entry.expireAt = s.now().Add(time.Duration(ex) * time.Second)
+	}
+	s.values[key] = entry
+	return true, nil
+}
+
+func (s *KVStore) Delete(key string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, ok := s.lookup(key)
+	_, hashOK := s.hashes[key]
+	delete(s.values, key)
+	delete(s.hashes, key)
+	return ok || hashOK, nil
+}
+
+func (s *KVStore) Exists(key string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, ok := s.lookup(key)
+	_, hashOK := s.hashes[key]
+	return ok || hashOK, nil
+}
+
+func (s *KVStore) Expire(key string, seconds int) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entry, ok := s.lookup(key)
+	if !ok {
+		return false, nil
+	}
+	entry.expireAt = s.now().Add(time.Duration(seconds) * time.Second)
+	s.values[key] = entry
+	return true, nil
+}
+
+func (s *KVStore) AcquireLock(key string, token string, ttl time.Duration) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.lookup(key); ok {
+		return false, nil
+	}
+	entry := kvEntry{value: token}
+	if ttl > 0 {
+		entry.expireAt = s.now().Add(ttl)
+	}
+	s.values[key] = entry
+	return true, nil
+}
+
+func (s *KVStore) ReleaseLock(key string, token string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entry, ok := s.lookup(key)
+	if !ok || entry.value != token {
+		return false, nil
+	}
+	delete(s.values, key)
+	return true, nil
+}
+
+func (s *KVStore) RenewLock(key string, token string, ttl time.Duration) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entry, ok := s.lookup(key)
+	if !ok || entry.value != token {
+		return false, nil
+	}
+	entry.expireAt = time.Time{}
+	if ttl > 0 {
+		entry.expireAt = s.now().Add(ttl)
+	}
+	s.values[key] = entry
+	return true, nil
+}
+
+func (s *KVStore) GetJSON(key string) (map[string]interface{}, error) {
+	value, err := s.Get(key)
+	if err != nil || value == "" {
+		return nil, err
+	}
+
+	var result map[string]interface{}
+	if err := json.Unmarshal([]byte(value), &result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+func (s *KVStore) SetJSON(key string, value map[string]interface{}, ex int) (bool, error) {
+	jsonValue, err := json.Marshal(value)
+	if err != nil {
+		return false, err
+	}
+	return s.Set(key, string(jsonValue), ex)
+}
+
+func (s *KVStore) HGet(name string, key string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.hashes[name][key], nil
+}
+
+func (s *KVStore) HSet(name string, key string, value string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.hashes[name]; !ok {
+		s.hashes[name] = make(map[string]string)
+	}
+	s.hashes[name][key] = value
+	return true, nil
+}
+
+func (s *KVStore) HGetAll(name string) (map[string]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	result := make(map[string]string, len(s.hashes[name]))
+	for k, v := range s.hashes[name] {
+		result[k] = v
+	}
+	return result, nil
+}
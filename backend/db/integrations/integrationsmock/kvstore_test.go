@@ -0,0 +1,141 @@
+package integrationsmock
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestKVStoreSetGetExpire(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	store := NewKVStore()
+	store.SetClock(func() time.Time { return now })
+
+	if ok, err := store.Set("session", "a", 60); !ok || err != nil {
+		t.Fatalf("Set returned %v, %v", ok, err)
+	}
+	if ok, _ := store.Set("forever", "b", 0); !ok {
+		t.Fatal("expected Set without expiry to succeed")
+	}
+	if value, _ := store.Get("session"); value != "a" {
+		t.Fatalf("got %q, want a", value)
+	}
+	if value, err := store.Get("missing"); value != "" || err != nil {
+		t.Fatalf("expected a missing key to read as empty, got %q, %v", value, err)
+	}
+
+	now = now.Add(61 * time.Second)
+	if value, _ := store.Get("session"); value != "" {
+		t.Errorf("expected the key to expire, got %q", value)
+	}
+	if exists, _ := store.Exists("session"); exists {
+		t.Error("expected an expired key not to exist")
+	}
+	if value, _ := store.Get("forever"); value != "b" {
+		t.Errorf("expected a key without expiry to stay, got %q", value)
+	}
+
+	if ok, _ := store.Expire("forever", 10); !ok {
+		t.Fatal("expected Expire of an existing key to succeed")
+	}
+	if ok, _ := store.Expire("session", 10); ok {
+		t.Error("expected Expire of an expired key to fail")
+	}
+	now = now.Add(11 * time.Second)
+	if exists, _ := store.Exists("forever"); exists {
+		t.Error("expected the key to expire after Expire")
+	}
+}
+
+func TestKVStoreDelete(t *testing.T) {
+	store := NewKVStore()
+	store.Set("key", "value", 0)
+	store.HSet("hash", "field", "value")
+
+	for _, key := range []string{"key", "hash"} {
+		if deleted, _ := store.Delete(key); !deleted {
+			t.Errorf("expected %s to be deleted", key)
+		}
+		if exists, _ := store.Exists(key); exists {
+			t.Errorf("expected %s not to exist after Delete", key)
+		}
+	}
+	if deleted, _ := store.Delete("key"); deleted {
+		t.Error("expected deleting a missing key to report false")
+	}
+}
+
+func TestKVStoreJSON(t *testing.T) {
+	store := NewKVStore()
+	if ok, err := store.SetJSON("state", map[string]interface{}{"step": "build", "attempt": 2}, 0); !ok || err != nil {
+		t.Fatalf("SetJSON returned %v, %v", ok, err)
+	}
+	value, err := store.GetJSON("state")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := map[string]interface{}{"step": "build", "attempt": float64(2)}; !reflect.DeepEqual(value, want) {
+		t.Errorf("got %v, want %v", value, want)
+	}
+	if value, err := store.GetJSON("missing"); value != nil || err != nil {
+		t.Errorf("expected a missing key to read as nil, got %v, %v", value, err)
+	}
+}
+
+func TestKVStoreHashes(t *testing.T) {
+	store := NewKVStore()
+	store.HSet("workspace", "status", "running")
+	store.HSet("workspace", "owner", "dev")
+	store.HSet("workspace", "status", "stopped")
+
+	if value, _ := store.HGet("workspace", "status"); value != "stopped" {
+		t.Errorf("got %q, want the last value stopped", value)
+	}
+	all, err := store.HGetAll("workspace")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := map[string]string{"status": "stopped", "owner": "dev"}; !reflect.DeepEqual(all, want) {
+		t.Errorf("got %v, want %v", all, want)
+	}
+
+	// the result is a copy
+	all["owner"] = "other"
+	if value, _ := store.HGet("workspace", "owner"); value != "dev" {
+		t.Errorf("changing the result of HGetAll changed the hash to %q", value)
+	}
+	if all, _ := store.HGetAll("missing"); len(all) != 0 {
+		t.Errorf("expected a missing hash to be empty, got %v", all)
+	}
+}
+
+func TestKVStoreLocks(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	store := NewKVStore()
+	store.SetClock(func() time.Time { return now })
+
+	if ok, _ := store.AcquireLock("lock", "a", time.Minute); !ok {
+		t.Fatal("expected a to acquire the lock")
+	}
+	if ok, _ := store.AcquireLock("lock", "b", time.Minute); ok {
+		t.Fatal("expected b not to acquire a held lock")
+	}
+	if ok, _ := store.ReleaseLock("lock", "b"); ok {
+		t.Fatal("expected b not to release the lock of a")
+	}
+	if ok, _ := store.RenewLock("lock", "a", 2*time.Minute); !ok {
+		t.Fatal("expected a to renew its lock")
+	}
+
+	now = now.Add(90 * time.Second)
+	if ok, _ := store.AcquireLock("lock", "b", time.Minute); ok {
+		t.Fatal("expected the renewed lock to still be held")
+	}
+	now = now.Add(time.Minute)
+	if ok, _ := store.AcquireLock("lock", "b", time.Minute); !ok {
+		t.Fatal("expected b to acquire the expired lock")
+	}
+	if ok, _ := store.ReleaseLock("lock", "b"); !ok {
+		t.Fatal("expected b to release its lock")
+	}
+}
@@ -0,0 +1,144 @@
+package integrationsmock
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/spectrumwebco/agent_runtime/backend/db/integrations"
+)
+
+var (
+	_ integrations.MessageQueue  = (*MessageQueue)(nil)
+	_ integrations.EventProducer = (*MessageQueue)(nil)
+)
+
+// Message is a message recorded by MessageQueue.
+type Message struct {
+	Topic     string
+	Body      []byte
+	Tags      string
+	Keys      string
+	Headers   map[string]string
+	Timestamp time.Time
+}
+
+// MessageQueue is an in-memory integrations.MessageQueue. Subscribers are
+// invoked synchronously so tests can assert on side effects without waiting.
+type MessageQueue struct {
+	messages    map[string][]Message
+	subscribers map[string][]func([]byte) bool
+	closed      bool
+	mu          sync.Mutex
+}
+
+func NewMessageQueue() *MessageQueue {
+	return &MessageQueue{
+		messages:    make(map[string][]Message),
+		subscribers: make(map[string][]func([]byte) bool),
+	}
+}
+
+func (q *MessageQueue) SendMessage(topic string, message interface{}, tags, keys string) bool {
+	return q.send(topic, message, tags, keys, nil) == nil
+}
+
+// ProduceWithHeaders records an event like SendMessage, with key as the
+// message keys.
+func (q *MessageQueue) ProduceWithHeaders(topic string, value interface{}, key string, headers map[string]string) error {
+	return q.send(topic, value, "", key, headers)
+}
+
+func (q *MessageQueue) send(topic string, message interface{}, tags, keys string, headers map[string]string) error {
+	var body []byte
+	switch msg := message.(type) {
+	case []byte:
+		body = msg
+	case string:
+		body = []byte(msg)
+	default:
+		jsonBytes, err := json.Marshal(message)
+		if err != nil {
+			return err
+		}
+		body = jsonBytes
+	}
+
+	q.mu.Lock()
+	if q.closed {
+		q.mu.Unlock()
+		return fmt.Errorf("message queue is shut down")
+	}
+	q.messages[topic] = append(q.messages[topic], Message{
+		Topic:     topic,
+		Body:      body,
+		Tags:      tags,
+		Keys:      keys,
+		Headers:   headers,
+		Timestamp: time.Now(),
+	})
+	subscribers := append([]func([]byte) bool(nil), q.subscribers[topic]...)
+	q.mu.Unlock()
+
+	for _, callback := range subscribers {
+		callback(body)
+	}
+
+	return nil
+}
+
+func (q *MessageQueue) SendJSON(topic string, data map[string]interface{}, tags, keys string) bool {
+	jsonBytes, err := json.Marshal(data)
+	if err != nil {
+		return false
+	}
+
+	return q.SendMessage(topic, jsonBytes, tags, keys)
+}
+
+func (q *MessageQueue) Subscribe(topic string, callback func([]byte) bool) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.closed {
+		return false
+	}
+	q.subscribers[topic] = append(q.subscribers[topic], callback)
+	return true
+}
+
+func (q *MessageQueue) Unsubscribe(topic string) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	delete(q.subscribers, topic)
+	return true
+}
+
+func (q *MessageQueue) Shutdown() bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.closed = true
+	q.subscribers = make(map[string][]func([]byte) bool)
+	return true
+}
+
+// Messages returns a copy of the messages sent to topic.
+func (q *MessageQueue) Messages(topic string) []Message {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	return append([]Message(nil), q.messages[topic]...)
+}
+
+// Reset drops all recorded messages and subscribers and reopens the queue.
+func (q *MessageQueue) Reset() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.messages = make(map[string][]Message)
+	q.subscribers = make(map[string][]func([]byte) bool)
+	q.closed = false
+}
@@ -0,0 +1,82 @@
+package integrationsmock
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestMessageQueueRecordsMessages(t *testing.T) {
+	queue := NewMessageQueue()
+
+	if !queue.SendMessage("events", "raw", "tag", "key") {
+		t.Fatal("expected SendMessage to succeed")
+	}
+	if !queue.SendJSON("events", map[string]interface{}{"type": "started"}, "", "") {
+		t.Fatal("expected SendJSON to succeed")
+	}
+	if err := queue.ProduceWithHeaders("events", map[string]string{"type": "stopped"}, "workspace-1", map[string]string{"trace": "t1"}); err != nil {
+		t.Fatal(err)
+	}
+
+	messages := queue.Messages("events")
+	if len(messages) != 3 {
+		t.Fatalf("got %d messages, want 3", len(messages))
+	}
+	if string(messages[0].Body) != "raw" || messages[0].Tags != "tag" || messages[0].Keys != "key" {
+		t.Errorf("unexpected first message %+v", messages[0])
+	}
+	var body map[string]string
+	if err := json.Unmarshal(messages[1].Body, &body); err != nil || body["type"] != "started" {
+		t.Errorf("expected the JSON body, got %s, %v", messages[1].Body, err)
+	}
+	if messages[2].Keys != "workspace-1" || messages[2].Headers["trace"] != "t1" {
+		t.Errorf("expected the key and headers of the event, got %+v", messages[2])
+	}
+	if other := queue.Messages("other"); len(other) != 0 {
+		t.Errorf("expected no messages on another topic, got %v", other)
+	}
+}
+
+func TestMessageQueueSubscribers(t *testing.T) {
+	queue := NewMessageQueue()
+	var received []string
+	if !queue.Subscribe("events", func(body []byte) bool {
+		received = append(received, string(body))
+		return true
+	}) {
+		t.Fatal("expected Subscribe to succeed")
+	}
+
+	// subscribers run synchronously
+	queue.SendMessage("events", "a", "", "")
+	queue.SendMessage("other", "b", "", "")
+	if len(received) != 1 || received[0] != "a" {
+		t.Fatalf("got %q, want [a]", received)
+	}
+
+	queue.Unsubscribe("events")
+	queue.SendMessage("events", "c", "", "")
+	if len(received) != 1 {
+		t.Errorf("expected no delivery after Unsubscribe, got %q", received)
+	}
+}
+
+func TestMessageQueueShutdown(t *testing.T) {
+	queue := NewMessageQueue()
+	queue.Shutdown()
+
+	if queue.SendMessage("events", "a", "", "") {
+		t.Error("expected SendMessage to fail after Shutdown")
+	}
+	if err := queue.ProduceWithHeaders("events", "a", "", nil); err == nil {
+		t.Error("expected ProduceWithHeaders to fail after Shutdown")
+	}
+	if queue.Subscribe("events", func([]byte) bool { return true }) {
+		t.Error("expected Subscribe to fail after Shutdown")
+	}
+
+	queue.Reset()
+	if !queue.SendMessage("events", "a", "", "") || len(queue.Messages("events")) != 1 {
+		t.Error("expected Reset to reopen the queue")
+	}
+}
@@ -0,0 +1,55 @@
+package integrationsmock
+
+import (
+	"context"
+	"sync"
+
+	"github.com/spectrumwebco/agent_runtime/backend/db/integrations"
+)
+
+var _ integrations.PubSub = (*PubSub)(nil)
+
+type subscription struct {
+	ctx     context.Context
+	handler func([]byte)
+}
+
+// PubSub is an in-memory integrations.PubSub. Handlers are invoked
+// synchronously by Publish, like MessageQueue subscribers.
+type PubSub struct {
+	subscribers map[string][]*subscription
+	mu          sync.Mutex
+}
+
+func NewPubSub() *PubSub {
+	return &PubSub{subscribers: make(map[string][]*subscription)}
+}
+
+func (p *PubSub) Publish(ctx context.Context, channel string, payload []byte) error {
+	p.mu.Lock()
+	var handlers []func([]byte)
+	active := p.subscribers[channel][:0]
+	for _, sub := range p.subscribers[channel] {
+		if sub.ctx.Err() != nil {
+			continue
+		}
+		active = append(active, sub)
+		handlers = append(handlers, sub.handler)
+	}
+	p.subscribers[channel] = active
+	p.mu.Unlock()
+
+	for _, handler := range handlers {
+		handler(append([]byte(nil), payload...))
+	}
+	return nil
+}
+
+// SubscribeChannel registers handler until ctx is cancelled.
+func (p *PubSub) SubscribeChannel(ctx context.Context, channel string, handler func(payload []byte)) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.subscribers[channel] = append(p.subscribers[channel], &subscription{ctx: ctx, handler: handler})
+	return nil
+}
@@ -0,0 +1,113 @@
+package integrationsmock
+
+import (
+	"database/sql"
+	"fmt"
+	"regexp"
+
+	"github.com/spectrumwebco/agent_runtime/backend/db/integrations"
+	_ "modernc.org/sqlite"
+)
+
+var _ integrations.SQLStore = (*SQLiteStore)(nil)
+
+// postgresRewrites translate the Postgres dialect used by the backend stores
+// into SQLite. They cover schema setup and the functions the stores use, not
+// Postgres in general.
+var postgresRewrites = []struct {
+	pattern     *regexp.Regexp
+	replacement string
+}{
+	{regexp.MustCompile(`(?i)\bBIGSERIAL\s+PRIMARY\s+KEY\b`), "INTEGER PRIMARY KEY AUTOINCREMENT"},
+	{regexp.MustCompile(`(?i)\bSERIAL\s+PRIMARY\s+KEY\b`), "INTEGER PRIMARY KEY AUTOINCREMENT"},
+	{regexp.MustCompile(`(?i)\bJSONB\b`), "TEXT"},
+	{regexp.MustCompile(`(?i)::\s*(jsonb|json|text|int|bigint|timestamptz|timestamp)\b`), ""},
+	{regexp.MustCompile(`(?i)\bNOW\(\)`), "CURRENT_TIMESTAMP"},
+	{regexp.MustCompile(`(?i)\bILIKE\b`), "LIKE"},
+	// numbered parameters are ?NNN in SQLite
+	{regexp.MustCompile(`\$(\d+)`), "?${1}"},
+}
+
+// SQLiteStore is an integrations.SQLStore backed by SQLite, so stores that
+// create their own schema work without a Postgres or Doris server.
+type SQLiteStore struct {
+	db *sql.DB
+}
+
+// NewSQLiteStore opens the database at path, or a private in-memory database
+// if path is empty or ":memory:".
+func NewSQLiteStore(path string) (*SQLiteStore, error) {
+	if path == "" {
+		path = ":memory:"
+	}
+
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		return nil, fmt.Errorf("open sqlite database: %w", err)
+	}
+	// a single connection keeps an in-memory database alive and serializes
+	// writes, which SQLite needs anyway
+	db.SetMaxOpenConns(1)
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("open sqlite database: %w", err)
+	}
+
+	return &SQLiteStore{db: db}, nil
+}
+
+func translatePostgres(query string) string {
+	for _, rewrite := range postgresRewrites {
+		query = rewrite.pattern.ReplaceAllString(query, rewrite.replacement)
+	}
+	return query
+}
+
+func (s *SQLiteStore) ExecuteQuery(query string, params ...interface{}) ([]map[string]interface{}, error) {
+	rows, err := s.db.Query(translatePostgres(query), params...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]map[string]interface{}, 0)
+	for rows.Next() {
+		values := make([]interface{}, len(columns))
+		valuePtrs := make([]interface{}, len(columns))
+		for i := range columns {
+			valuePtrs[i] = &values[i]
+		}
+		if err := rows.Scan(valuePtrs...); err != nil {
+			return nil, err
+		}
+
+		row := make(map[string]interface{}, len(columns))
+		for i, col := range columns {
+			if b, ok := values[i].([]byte); ok {
+				row[col] = string(b)
+			} else {
+				row[col] = values[i]
+			}
+		}
+		result = append(result, row)
+	}
+
+	return result, rows.Err()
+}
+
+func (s *SQLiteStore) ExecuteUpdate(query string, params ...interface{}) (int64, error) {
+	result, err := s.db.Exec(translatePostgres(query), params...)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+func (s *SQLiteStore) Close() error {
+	return s.db.Close()
+}
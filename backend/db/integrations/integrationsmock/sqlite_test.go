@@ -0,0 +1,39 @@
+package integrationsmock
+
+import "testing"
+
+func TestTranslatePostgres(t *testing.T) {
+	for query, expected := range map[string]string{
+		"CREATE TABLE t (id BIGSERIAL PRIMARY KEY, data JSONB)":           "CREATE TABLE t (id INTEGER PRIMARY KEY AUTOINCREMENT, data TEXT)",
+		"UPDATE t SET data = $1::jsonb, updated_at = NOW() WHERE id = $2": "UPDATE t SET data = ?1, updated_at = CURRENT_TIMESTAMP WHERE id = ?2",
+		"SELECT * FROM t WHERE name ILIKE $1":                             "SELECT * FROM t WHERE name LIKE ?1",
+	} {
+		if actual := translatePostgres(query); actual != expected {
+			t.Errorf("expected %q, got %q", expected, actual)
+		}
+	}
+}
+
+func TestSQLiteStore(t *testing.T) {
+	store, err := NewSQLiteStore("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+
+	if _, err := store.ExecuteUpdate(`CREATE TABLE app_workspace (id SERIAL PRIMARY KEY, name TEXT, created_at TIMESTAMPTZ DEFAULT NOW())`); err != nil {
+		t.Fatal(err)
+	}
+	affected, err := store.ExecuteUpdate(`INSERT INTO app_workspace (name) VALUES ($1), ($2)`, "a", "b")
+	if err != nil || affected != 2 {
+		t.Fatalf("expected two inserted rows, got %d, %v", affected, err)
+	}
+
+	rows, err := store.ExecuteQuery(`SELECT name FROM app_workspace WHERE id = $1`, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 1 || rows[0]["name"] != "b" {
+		t.Errorf("expected workspace b, got %v", rows)
+	}
+}
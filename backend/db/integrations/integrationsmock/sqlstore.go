@@ -0,0 +1,97 @@
+package integrationsmock
+
+import (
+	"strings"
+	"sync"
+
+	"github.com/spectrumwebco/agent_runtime/backend/db/integrations"
+)
+
+var _ integrations.SQLStore = (*SQLStore)(nil)
+
+// Statement is a query or update recorded by SQLStore.
+type Statement struct {
+	Query  string
+	Params []interface{}
+}
+
+// SQLStore is an integrations.SQLStore that records every statement and
+// answers from canned results registered with OnQuery and OnUpdate. Statements
+// are matched by the longest registered prefix after whitespace normalization.
+type SQLStore struct {
+	queries    map[string]func(params []interface{}) ([]map[string]interface{}, error)
+	updates    map[string]func(params []interface{}) (int64, error)
+	statements []Statement
+	mu         sync.Mutex
+}
+
+func NewSQLStore() *SQLStore {
+	return &SQLStore{
+		queries: make(map[string]func(params []interface{}) ([]map[string]interface{}, error)),
+		updates: make(map[string]func(params []interface{}) (int64, error)),
+	}
+}
+
+func normalizeSQL(query string) string {
+	return strings.ToLower(strings.Join(strings.Fields(query), " "))
+}
+
+func (s *SQLStore) OnQuery(prefix string, handler func(params []interface{}) ([]map[string]interface{}, error)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.queries[normalizeSQL(prefix)] = handler
+}
+
+func (s *SQLStore) OnUpdate(prefix string, handler func(params []interface{}) (int64, error)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.updates[normalizeSQL(prefix)] = handler
+}
+
+func (s *SQLStore) ExecuteQuery(query string, params ...interface{}) ([]map[string]interface{}, error) {
+	s.mu.Lock()
+	s.statements = append(s.statements, Statement{Query: query, Params: params})
+	handler := longestPrefix(s.queries, normalizeSQL(query))
+	s.mu.Unlock()
+
+	if handler == nil {
+		return []map[string]interface{}{}, nil
+	}
+	return handler(params)
+}
+
+func (s *SQLStore) ExecuteUpdate(query string, params ...interface{}) (int64, error) {
+	s.mu.Lock()
+	s.statements = append(s.statements, Statement{Query: query, Params: params})
+	handler := longestPrefix(s.updates, normalizeSQL(query))
+	s.mu.Unlock()
+
+	if handler == nil {
+		return 0, nil
+	}
+	return handler(params)
+}
+
+// Statements returns a copy of every statement executed so far.
+func (s *SQLStore) Statements() []Statement {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]Statement(nil), s.statements...)
+}
+
+func longestPrefix[T any](handlers map[string]T, query string) T {
+	var (
+		best    T
+		bestLen = -1
+	)
+	for prefix, handler := range handlers {
+		if strings.HasPrefix(query, prefix) && len(prefix) > bestLen {
+			best = handler
+			bestLen = len(prefix)
+		}
+	}
+	return best
+}
@@ -0,0 +1,48 @@
+package integrationsmock
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestSQLStoreAnswersByLongestPrefix(t *testing.T) {
+	store := NewSQLStore()
+	store.OnQuery("SELECT id FROM runs", func(params []interface{}) ([]map[string]interface{}, error) {
+		return []map[string]interface{}{{"id": "all"}}, nil
+	})
+	store.OnQuery("select id from runs where status", func(params []interface{}) ([]map[string]interface{}, error) {
+		return []map[string]interface{}{{"id": params[0]}}, nil
+	})
+	store.OnUpdate("DELETE FROM runs", func(params []interface{}) (int64, error) {
+		return 0, errors.New("locked")
+	})
+
+	rows, err := store.ExecuteQuery("SELECT id\n\t FROM runs WHERE status = $1", "failed")
+	if err != nil || !reflect.DeepEqual(rows, []map[string]interface{}{{"id": "failed"}}) {
+		t.Errorf("expected the longer prefix to answer regardless of whitespace and case, got %v, %v", rows, err)
+	}
+	rows, _ = store.ExecuteQuery("SELECT id FROM runs ORDER BY id")
+	if !reflect.DeepEqual(rows, []map[string]interface{}{{"id": "all"}}) {
+		t.Errorf("got %v, want the shorter prefix to answer", rows)
+	}
+	rows, err = store.ExecuteQuery("SELECT name FROM prompts")
+	if err != nil || rows == nil || len(rows) != 0 {
+		t.Errorf("expected no rows for an unregistered query, got %v, %v", rows, err)
+	}
+
+	if _, err := store.ExecuteUpdate("DELETE FROM runs WHERE id = $1", "r1"); err == nil {
+		t.Error("expected the error of the update handler")
+	}
+	if affected, err := store.ExecuteUpdate("UPDATE runs SET status = $1", "done"); affected != 0 || err != nil {
+		t.Errorf("expected no rows affected for an unregistered update, got %d, %v", affected, err)
+	}
+
+	statements := store.Statements()
+	if len(statements) != 5 {
+		t.Fatalf("got %d statements, want 5", len(statements))
+	}
+	if last := statements[4]; last.Query != "UPDATE runs SET status = $1" || !reflect.DeepEqual(last.Params, []interface{}{"done"}) {
+		t.Errorf("unexpected recorded statement %+v", last)
+	}
+}
@@ -0,0 +1,299 @@
+package integrationsmock
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/spectrumwebco/agent_runtime/backend/db/integrations"
+)
+
+var _ integrations.StreamStore = (*StreamStore)(nil)
+
+type pendingMessage struct {
+	consumer  string
+	delivered time.Time
+	count     int64
+}
+
+type streamGroup struct {
+	// lastDelivered is the index of the next entry to deliver
+	lastDelivered int
+	pending       map[string]*pendingMessage
+}
+
+type stream struct {
+	entries []integrations.StreamMessage
+	groups  map[string]*streamGroup
+	lastID  int64
+	seq     int64
+}
+
+// StreamStore is an in-memory integrations.StreamStore with consumer group,
+// pending entry and claim semantics matching Redis Streams.
+type StreamStore struct {
+	streams map[string]*stream
+	now     func() time.Time
+	// added is closed and replaced whenever an entry is appended, so blocked
+	// readers wake up.
+	added chan struct{}
+	mu    sync.Mutex
+}
+
+func NewStreamStore() *StreamStore {
+	return &StreamStore{
+		streams: make(map[string]*stream),
+		now:     time.Now,
+		added:   make(chan struct{}),
+	}
+}
+
+// SetClock replaces the clock used to compute idle times.
+func (s *StreamStore) SetClock(now func() time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.now = now
+}
+
+func (s *StreamStore) stream(name string) *stream {
+	st, ok := s.streams[name]
+	if !ok {
+		st = &stream{groups: make(map[string]*streamGroup)}
+		s.streams[name] = st
+	}
+	return st
+}
+
+func (s *StreamStore) group(streamName, group string) (*stream, *streamGroup, error) {
+	st, ok := s.streams[streamName]
+	if !ok {
+		return nil, nil, fmt.Errorf("NOGROUP no such key '%s' or consumer group '%s'", streamName, group)
+	}
+	g, ok := st.groups[group]
+	if !ok {
+		return nil, nil, fmt.Errorf("NOGROUP no such key '%s' or consumer group '%s'", streamName, group)
+	}
+	return st, g, nil
+}
+
+func (s *StreamStore) StreamAdd(streamName string, values map[string]interface{}, maxLen int64) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	st := s.stream(streamName)
+	ms := s.now().UnixMilli()
+	if ms > st.lastID {
+		st.lastID, st.seq = ms, 0
+	} else {
+		st.seq++
+	}
+	id := fmt.Sprintf("%d-%d", st.lastID, st.seq)
+
+	copied := make(map[string]interface{}, len(values))
+	for key, value := range values {
+		copied[key] = fmt.Sprint(value)
+	}
+	st.entries = append(st.entries, integrations.StreamMessage{ID: id, Values: copied})
+
+	if maxLen > 0 && int64(len(st.entries)) > maxLen {
+		trimmed := len(st.entries) - int(maxLen)
+		st.entries = st.entries[trimmed:]
+		for _, g := range st.groups {
+			g.lastDelivered -= trimmed
+			if g.lastDelivered < 0 {
+				g.lastDelivered = 0
+			}
+		}
+	}
+
+	close(s.added)
+	s.added = make(chan struct{})
+	return id, nil
+}
+
+func (s *StreamStore) StreamCreateGroup(streamName string, group string, start string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	st := s.stream(streamName)
+	if _, ok := st.groups[group]; ok {
+		return nil
+	}
+
+	g := &streamGroup{pending: make(map[string]*pendingMessage)}
+	if start == "" || start == "$" {
+		g.lastDelivered = len(st.entries)
+	}
+	st.groups[group] = g
+	return nil
+}
+
+func (s *StreamStore) StreamReadGroup(ctx context.Context, streamName string, group string, consumer string, count int64, block time.Duration) ([]integrations.StreamMessage, error) {
+	var timeout <-chan time.Time
+	if block > 0 {
+		timer := time.NewTimer(block)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+
+	for {
+		s.mu.Lock()
+		messages, err := s.deliver(streamName, group, consumer, count)
+		added := s.added
+		s.mu.Unlock()
+		if err != nil || len(messages) > 0 || block <= 0 {
+			return messages, err
+		}
+
+		select {
+		case <-added:
+		case <-timeout:
+			return nil, nil
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+func (s *StreamStore) deliver(streamName, group, consumer string, count int64) ([]integrations.StreamMessage, error) {
+	st, g, err := s.group(streamName, group)
+	if err != nil {
+		return nil, err
+	}
+
+	end := len(st.entries)
+	if count > 0 && g.lastDelivered+int(count) < end {
+		end = g.lastDelivered + int(count)
+	}
+
+	messages := append([]integrations.StreamMessage(nil), st.entries[g.lastDelivered:end]...)
+	for _, message := range messages {
+		g.pending[message.ID] = &pendingMessage{consumer: consumer, delivered: s.now(), count: 1}
+	}
+	g.lastDelivered = end
+	return messages, nil
+}
+
+func (s *StreamStore) StreamAck(streamName string, group string, ids ...string) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, g, err := s.group(streamName, group)
+	if err != nil {
+		return 0, err
+	}
+
+	acked := int64(0)
+	for _, id := range ids {
+		if _, ok := g.pending[id]; ok {
+			delete(g.pending, id)
+			acked++
+		}
+	}
+	return acked, nil
+}
+
+func (s *StreamStore) StreamPending(streamName string, group string, count int64) ([]integrations.StreamPendingEntry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, g, err := s.group(streamName, group)
+	if err != nil {
+		return nil, err
+	}
+
+	entries := []integrations.StreamPendingEntry{}
+	for _, id := range sortedIDs(g.pending) {
+		if count > 0 && int64(len(entries)) >= count {
+			break
+		}
+		p := g.pending[id]
+		entries = append(entries, integrations.StreamPendingEntry{
+			ID:         id,
+			Consumer:   p.consumer,
+			Idle:       s.now().Sub(p.delivered),
+			RetryCount: p.count,
+		})
+	}
+	return entries, nil
+}
+
+func (s *StreamStore) StreamClaimStale(streamName string, group string, consumer string, minIdle time.Duration, count int64) ([]integrations.StreamMessage, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	st, g, err := s.group(streamName, group)
+	if err != nil {
+		return nil, err
+	}
+
+	entries := make(map[string]integrations.StreamMessage, len(st.entries))
+	for _, entry := range st.entries {
+		entries[entry.ID] = entry
+	}
+
+	messages := []integrations.StreamMessage{}
+	for _, id := range sortedIDs(g.pending) {
+		if count > 0 && int64(len(messages)) >= count {
+			break
+		}
+		p := g.pending[id]
+		if s.now().Sub(p.delivered) < minIdle {
+			continue
+		}
+
+		entry, ok := entries[id]
+		if !ok {
+			// trimmed entries are dropped from the pending list like XAUTOCLAIM does
+			delete(g.pending, id)
+			continue
+		}
+
+		p.consumer = consumer
+		p.delivered = s.now()
+		p.count++
+		messages = append(messages, entry)
+	}
+	return messages, nil
+}
+
+func sortedIDs(pending map[string]*pendingMessage) []string {
+	ids := make([]string, 0, len(pending))
+	for id := range pending {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool {
+		return compareIDs(ids[i], ids[j]) < 0
+	})
+	return ids
+}
+
+func compareIDs(a, b string) int {
+	aMs, aSeq := splitID(a)
+	bMs, bSeq := splitID(b)
+	if aMs != bMs {
+		if aMs < bMs {
+			return -1
+		}
+		return 1
+	}
+	if aSeq != bSeq {
+		if aSeq < bSeq {
+			return -1
+		}
+		return 1
+	}
+	return 0
+}
+
+func splitID(id string) (int64, int64) {
+	ms, seq, _ := strings.Cut(id, "-")
+	msValue, _ := strconv.ParseInt(ms, 10, 64)
+	seqValue, _ := strconv.ParseInt(seq, 10, 64)
+	return msValue, seqValue
+}
@@ -0,0 +1,106 @@
+package integrationsmock
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/spectrumwebco/agent_runtime/backend/db/integrations"
+)
+
+func TestStreamStoreGroups(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	store := NewStreamStore()
+	store.SetClock(func() time.Time { return now })
+
+	if _, err := store.StreamAdd("events", map[string]interface{}{"n": 0}, 0); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.StreamCreateGroup("events", "workers", "$"); err != nil {
+		t.Fatal(err)
+	}
+	for i := 1; i <= 3; i++ {
+		if _, err := store.StreamAdd("events", map[string]interface{}{"n": i}, 0); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	messages, err := store.StreamReadGroup(context.Background(), "events", "workers", "a", 2, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(messages) != 2 || messages[0].Values["n"] != "1" {
+		t.Fatalf("expected the two entries added after the group, got %v", messages)
+	}
+	if _, err := store.StreamAck("events", "workers", messages[0].ID); err != nil {
+		t.Fatal(err)
+	}
+
+	pending, err := store.StreamPending("events", "workers", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pending) != 1 || pending[0].ID != messages[1].ID || pending[0].Consumer != "a" {
+		t.Fatalf("expected the unacknowledged entry to be pending for a, got %v", pending)
+	}
+
+	claimed, err := store.StreamClaimStale("events", "workers", "b", time.Minute, 10)
+	if err != nil || len(claimed) != 0 {
+		t.Fatalf("expected nothing to claim before the idle time, got %v, %v", claimed, err)
+	}
+	now = now.Add(2 * time.Minute)
+	claimed, err = store.StreamClaimStale("events", "workers", "b", time.Minute, 10)
+	if err != nil || len(claimed) != 1 || claimed[0].ID != messages[1].ID {
+		t.Fatalf("expected the stale entry to be claimed, got %v, %v", claimed, err)
+	}
+	pending, _ = store.StreamPending("events", "workers", 10)
+	if pending[0].Consumer != "b" || pending[0].RetryCount != 2 {
+		t.Errorf("expected the entry to be owned by b with two deliveries, got %v", pending[0])
+	}
+}
+
+func TestConsumeStream(t *testing.T) {
+	store := NewStreamStore()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	if err := store.StreamCreateGroup("events", "workers", "$"); err != nil {
+		t.Fatal(err)
+	}
+
+	handled := make(chan string, 10)
+	failed := false
+	done := make(chan error)
+	go func() {
+		done <- integrations.ConsumeStream(ctx, store, "events", "workers", "a", 0, func(message integrations.StreamMessage) error {
+			if !failed {
+				failed = true
+				return fmt.Errorf("transient")
+			}
+			handled <- message.Values["n"].(string)
+			return nil
+		})
+	}()
+
+	if _, err := store.StreamAdd("events", map[string]interface{}{"n": 1}, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case n := <-handled:
+		if n != "1" {
+			t.Errorf("expected entry 1, got %s", n)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the failed entry to be redelivered")
+	}
+
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	if pending, _ := store.StreamPending("events", "workers", 10); len(pending) != 0 {
+		t.Errorf("expected no pending entries, got %v", pending)
+	}
+}
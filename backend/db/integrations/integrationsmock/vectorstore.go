@@ -0,0 +1,308 @@
+package integrationsmock
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/spectrumwebco/agent_runtime/backend/db/integrations"
+)
+
+var _ integrations.VectorStore = (*VectorStore)(nil)
+
+type vectorIndex struct {
+	dimension int
+	metric    string
+	vectors   map[string][]float64
+	metadata  map[string]map[string]interface{}
+	order     []string
+}
+
+// VectorStore is an in-memory integrations.VectorStore using brute-force
+// similarity search. SemanticSearch embeds the query with Embed when set and
+// otherwise falls back to substring matching on the "text" metadata field.
+type VectorStore struct {
+	Embed func(text string) []float64
+
+	indexes map[string]*vectorIndex
+	nextID  int
+	mu      sync.Mutex
+}
+
+func NewVectorStore() *VectorStore {
+	return &VectorStore{
+		indexes: make(map[string]*vectorIndex),
+	}
+}
+
+func (s *VectorStore) CreateIndex(indexName string, dimension int, metric string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.indexes[indexName]; ok {
+		return false, fmt.Errorf("index %s already exists", indexName)
+	}
+	if metric == "" {
+		metric = "cosine"
+	}
+	s.indexes[indexName] = &vectorIndex{
+		dimension: dimension,
+		metric:    metric,
+		vectors:   make(map[string][]float64),
+		metadata:  make(map[string]map[string]interface{}),
+	}
+	return true, nil
+}
+
+func (s *VectorStore) DeleteIndex(indexName string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.indexes[indexName]; !ok {
+		return false, fmt.Errorf("index %s not found", indexName)
+	}
+	delete(s.indexes, indexName)
+	return true, nil
+}
+
+func (s *VectorStore) ListIndexes() ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	names := make([]string, 0, len(s.indexes))
+	for name := range s.indexes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+func (s *VectorStore) AddVectors(indexName string, vectors [][]float64, ids []string, metadata []map[string]interface{}) (bool, []string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	index, ok := s.indexes[indexName]
+	if !ok {
+		return false, nil, fmt.Errorf("index %s not found", indexName)
+	}
+	if ids != nil && len(ids) != len(vectors) {
+		return false, nil, fmt.Errorf("got %d ids for %d vectors", len(ids), len(vectors))
+	}
+	if metadata != nil && len(metadata) != len(vectors) {
+		return false, nil, fmt.Errorf("got %d metadata entries for %d vectors", len(metadata), len(vectors))
+	}
+
+	added := make([]string, 0, len(vectors))
+	for i, vector := range vectors {
+		if index.dimension > 0 && len(vector) != index.dimension {
+			return false, added, fmt.Errorf("vector %d has dimension %d, expected %d", i, len(vector), index.dimension)
+		}
+
+		var id string
+		if ids != nil {
+			id = ids[i]
+		} else {
+			s.nextID++
+			id = fmt.Sprintf("vec-%d", s.nextID)
+		}
+		if _, exists := index.vectors[id]; !exists {
+			index.order = append(index.order, id)
+		}
+		index.vectors[id] = append([]float64(nil), vector...)
+
+		meta := map[string]interface{}{}
+		if metadata != nil {
+			for k, v := range metadata[i] {
+				meta[k] = v
+			}
+		}
+		index.metadata[id] = meta
+		added = append(added, id)
+	}
+
+	return true, added, nil
+}
+
+func (s *VectorStore) DeleteVectors(indexName string, ids []string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	index, ok := s.indexes[indexName]
+	if !ok {
+		return false, fmt.Errorf("index %s not found", indexName)
+	}
+
+	remove := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		remove[id] = true
+		delete(index.vectors, id)
+		delete(index.metadata, id)
+	}
+
+	order := index.order[:0]
+	for _, id := range index.order {
+		if !remove[id] {
+			order = append(order, id)
+		}
+	}
+	index.order = order
+	return true, nil
+}
+
+func (s *VectorStore) Search(indexName string, queryVector []float64, topK int, filterMetadata map[string]interface{}) ([]map[string]interface{}, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	index, ok := s.indexes[indexName]
+	if !ok {
+		return []map[string]interface{}{}, fmt.Errorf("index %s not found", indexName)
+	}
+
+	results := []map[string]interface{}{}
+	for _, id := range index.order {
+		if !matchesFilter(index.metadata[id], filterMetadata) {
+			continue
+		}
+		results = append(results, map[string]interface{}{
+			"id":       id,
+			"score":    similarity(index.metric, queryVector, index.vectors[id]),
+			"metadata": copyMetadata(index.metadata[id]),
+		})
+	}
+
+	sort.SliceStable(results, func(i, j int) bool {
+		return results[i]["score"].(float64) > results[j]["score"].(float64)
+	})
+	return limit(results, topK), nil
+}
+
+func (s *VectorStore) SemanticSearch(indexName string, queryText string, topK int, filterMetadata map[string]interface{}) ([]map[string]interface{}, error) {
+	if s.Embed != nil {
+		return s.Search(indexName, s.Embed(queryText), topK, filterMetadata)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	index, ok := s.indexes[indexName]
+	if !ok {
+		return []map[string]interface{}{}, fmt.Errorf("index %s not found", indexName)
+	}
+
+	query := strings.ToLower(queryText)
+	results := []map[string]interface{}{}
+	for _, id := range index.order {
+		meta := index.metadata[id]
+		text, _ := meta["text"].(string)
+		if !strings.Contains(strings.ToLower(text), query) || !matchesFilter(meta, filterMetadata) {
+			continue
+		}
+		results = append(results, map[string]interface{}{
+			"id":       id,
+			"score":    1.0,
+			"metadata": copyMetadata(meta),
+		})
+	}
+	return limit(results, topK), nil
+}
+
+func (s *VectorStore) GetVector(indexName string, vectorID string) (map[string]interface{}, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	index, ok := s.indexes[indexName]
+	if !ok {
+		return nil, fmt.Errorf("index %s not found", indexName)
+	}
+	vector, ok := index.vectors[vectorID]
+	if !ok {
+		return nil, fmt.Errorf("vector %s not found in index %s", vectorID, indexName)
+	}
+
+	return map[string]interface{}{
+		"id":       vectorID,
+		"vector":   append([]float64(nil), vector...),
+		"metadata": copyMetadata(index.metadata[vectorID]),
+	}, nil
+}
+
+func (s *VectorStore) UpdateVectorMetadata(indexName string, vectorID string, metadata map[string]interface{}) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	index, ok := s.indexes[indexName]
+	if !ok {
+		return false, fmt.Errorf("index %s not found", indexName)
+	}
+	if _, ok := index.vectors[vectorID]; !ok {
+		return false, fmt.Errorf("vector %s not found in index %s", vectorID, indexName)
+	}
+
+	for k, v := range metadata {
+		index.metadata[vectorID][k] = v
+	}
+	return true, nil
+}
+
+func matchesFilter(metadata, filter map[string]interface{}) bool {
+	for k, v := range filter {
+		if fmt.Sprint(metadata[k]) != fmt.Sprint(v) {
+			return false
+		}
+	}
+	return true
+}
+
+func copyMetadata(metadata map[string]interface{}) map[string]interface{} {
+	result := make(map[string]interface{}, len(metadata))
+	for k, v := range metadata {
+		result[k] = v
+	}
+	return result
+}
+
+func limit(results []map[string]interface{}, topK int) []map[string]interface{} {
+	if topK <= 0 {
+		topK = 10
+	}
+	if len(results) > topK {
+		return results[:topK]
+	}
+	return results
+}
+
+func similarity(metric string, a, b []float64) float64 {
+	n := len(a)
+	if len(b) < n {
+		n = len(b)
+	}
+
+	switch metric {
+	case "l2", "euclidean":
+		var sum float64
+		for i := 0; i < n; i++ {
+			d := a[i] - b[i]
+			sum += d * d
+		}
+		return -math.Sqrt(sum)
+	case "dot", "inner_product":
+		var dot float64
+		for i := 0; i < n; i++ {
+			dot += a[i] * b[i]
+		}
+		return dot
+	default:
+		var dot, normA, normB float64
+		for i := 0; i < n; i++ {
+			dot += a[i] * b[i]
+			normA += a[i] * a[i]
+			normB += b[i] * b[i]
+		}
+		if normA == 0 || normB == 0 {
+			return 0
+		}
+		return dot / (math.Sqrt(normA) * math.Sqrt(normB))
+	}
+}
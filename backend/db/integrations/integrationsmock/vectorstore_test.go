@@ -0,0 +1,108 @@
+package integrationsmock
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestVectorStoreIndexes(t *testing.T) {
+	store := NewVectorStore()
+	if ok, err := store.CreateIndex("docs", 2, ""); !ok || err != nil {
+		t.Fatalf("CreateIndex returned %v, %v", ok, err)
+	}
+	if _, err := store.CreateIndex("docs", 2, ""); err == nil {
+		t.Error("expected creating an existing index to fail")
+	}
+	store.CreateIndex("code", 2, "dot")
+
+	indexes, _ := store.ListIndexes()
+	if !reflect.DeepEqual(indexes, []string{"code", "docs"}) {
+		t.Errorf("got %v, want [code docs]", indexes)
+	}
+
+	if ok, err := store.DeleteIndex("docs"); !ok || err != nil {
+		t.Fatalf("DeleteIndex returned %v, %v", ok, err)
+	}
+	if _, err := store.DeleteIndex("docs"); err == nil {
+		t.Error("expected deleting a missing index to fail")
+	}
+	if _, err := store.Search("docs", []float64{1, 0}, 1, nil); err == nil {
+		t.Error("expected searching a deleted index to fail")
+	}
+}
+
+func TestVectorStoreSearch(t *testing.T) {
+	store := NewVectorStore()
+	store.CreateIndex("docs", 2, "cosine")
+
+	_, ids, err := store.AddVectors("docs",
+		[][]float64{{1, 0}, {0, 1}, {1, 1}},
+		[]string{"x", "y", "xy"},
+		[]map[string]interface{}{{"lang": "go"}, {"lang": "python"}, {"lang": "go"}},
+	)
+	if err != nil || !reflect.DeepEqual(ids, []string{"x", "y", "xy"}) {
+		t.Fatalf("AddVectors returned %v, %v", ids, err)
+	}
+	if _, _, err := store.AddVectors("docs", [][]float64{{1, 0, 0}}, nil, nil); err == nil {
+		t.Error("expected a vector of the wrong dimension to be rejected")
+	}
+
+	results, err := store.Search("docs", []float64{1, 0.1}, 2, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := resultIDs(results); !reflect.DeepEqual(got, []string{"x", "xy"}) {
+		t.Errorf("got %v, want the two closest vectors [x xy]", got)
+	}
+
+	results, _ = store.Search("docs", []float64{0, 1}, 10, map[string]interface{}{"lang": "go"})
+	if got := resultIDs(results); !reflect.DeepEqual(got, []string{"xy", "x"}) {
+		t.Errorf("got %v, want only the go vectors [xy x]", got)
+	}
+
+	if _, err := store.DeleteVectors("docs", []string{"xy"}); err != nil {
+		t.Fatal(err)
+	}
+	results, _ = store.Search("docs", []float64{1, 1}, 10, nil)
+	if got := resultIDs(results); len(got) != 2 || got[0] == "xy" || got[1] == "xy" {
+		t.Errorf("expected the deleted vector to be gone, got %v", got)
+	}
+	if _, err := store.GetVector("docs", "xy"); err == nil {
+		t.Error("expected GetVector of a deleted vector to fail")
+	}
+}
+
+func TestVectorStoreMetadata(t *testing.T) {
+	store := NewVectorStore()
+	store.CreateIndex("docs", 0, "")
+	_, ids, _ := store.AddVectors("docs", [][]float64{{1, 2, 3}}, nil, []map[string]interface{}{{"text": "Retry the build"}})
+
+	if _, err := store.UpdateVectorMetadata("docs", ids[0], map[string]interface{}{"source": "runbook"}); err != nil {
+		t.Fatal(err)
+	}
+	vector, err := store.GetVector("docs", ids[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := map[string]interface{}{"text": "Retry the build", "source": "runbook"}; !reflect.DeepEqual(vector["metadata"], want) {
+		t.Errorf("got metadata %v, want %v", vector["metadata"], want)
+	}
+
+	// without Embed, semantic search matches the text metadata
+	results, _ := store.SemanticSearch("docs", "the BUILD", 5, nil)
+	if got := resultIDs(results); !reflect.DeepEqual(got, ids) {
+		t.Errorf("got %v, want %v", got, ids)
+	}
+	results, _ = store.SemanticSearch("docs", "deploy", 5, nil)
+	if len(results) != 0 {
+		t.Errorf("expected no match, got %v", results)
+	}
+}
+
+func resultIDs(results []map[string]interface{}) []string {
+	ids := []string{}
+	for _, result := range results {
+		ids = append(ids, result["id"].(string))
+	}
+	return ids
+}
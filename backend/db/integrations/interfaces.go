@@ -0,0 +1,253 @@
+package integrations
+
+import (
+	"context"
+	"time"
+)
+
+// MessageQueue is the publish/subscribe surface shared by RocketMQManager and
+// MockRocketMQManager.
+type MessageQueue interface {
+	SendMessage(topic string, message interface{}, tags, keys string) bool
+	SendJSON(topic string, data map[string]interface{}, tags, keys string) bool
+	Subscribe(topic string, callback func([]byte) bool) bool
+	Unsubscribe(topic string) bool
+	Shutdown() bool
+}
+
+// KVStore is the key/value surface implemented by DragonflyManager.
+type KVStore interface {
+	Get(key string) (string, error)
+	Set(key string, value string, ex int) (bool, error)
+	Delete(key string) (bool, error)
+	Exists(key string) (bool, error)
+	Expire(key string, seconds int) (bool, error)
+	GetJSON(key string) (map[string]interface{}, error)
+	SetJSON(key string, value map[string]interface{}, ex int) (bool, error)
+	HGet(name string, key string) (string, error)
+	HSet(name string, key string, value string) (bool, error)
+	HGetAll(name string) (map[string]string, error)
+}
+
+// StreamStore is the append-only log surface with consumer groups
+// implemented by DragonflyManager on top of Redis Streams.
+type StreamStore interface {
+	StreamAdd(stream string, values map[string]interface{}, maxLen int64) (string, error)
+	StreamCreateGroup(stream string, group string, start string) error
+	StreamReadGroup(ctx context.Context, stream string, group string, consumer string, count int64, block time.Duration) ([]StreamMessage, error)
+	StreamAck(stream string, group string, ids ...string) (int64, error)
+	StreamPending(stream string, group string, count int64) ([]StreamPendingEntry, error)
+	StreamClaimStale(stream string, group string, consumer string, minIdle time.Duration, count int64) ([]StreamMessage, error)
+}
+
+// PubSub is the broadcast surface implemented by DragonflyManager. Every
+// subscriber of a channel receives every message published to it while it
+// is subscribed.
+type PubSub interface {
+	Publish(ctx context.Context, channel string, payload []byte) error
+	SubscribeChannel(ctx context.Context, channel string, handler func(payload []byte)) error
+}
+
+// VectorStore is the vector index surface implemented by RAGflowManager.
+type VectorStore interface {
+	CreateIndex(indexName string, dimension int, metric string) (bool, error)
+	DeleteIndex(indexName string) (bool, error)
+	ListIndexes() ([]string, error)
+	AddVectors(indexName string, vectors [][]float64, ids []string, metadata []map[string]interface{}) (bool, []string, error)
+	DeleteVectors(indexName string, ids []string) (bool, error)
+	Search(indexName string, queryVector []float64, topK int, filterMetadata map[string]interface{}) ([]map[string]interface{}, error)
+	SemanticSearch(indexName string, queryText string, topK int, filterMetadata map[string]interface{}) ([]map[string]interface{}, error)
+	GetVector(indexName string, vectorID string) (map[string]interface{}, error)
+	UpdateVectorMetadata(indexName string, vectorID string, metadata map[string]interface{}) (bool, error)
+}
+
+// SQLStore is the query surface implemented by PostgresOperatorClient and
+// DorisClient.
+type SQLStore interface {
+	ExecuteQuery(query string, params ...interface{}) ([]map[string]interface{}, error)
+	ExecuteUpdate(query string, params ...interface{}) (int64, error)
+}
+
+// EventProducer publishes keyed messages with headers, implemented by
+// KafkaClient.
+type EventProducer interface {
+	ProduceWithHeaders(topic string, value interface{}, key string, headers map[string]string) error
+}
+
+// Locker is the distributed lock surface implemented by DragonflyManager.
+type Locker interface {
+	AcquireLock(key string, token string, ttl time.Duration) (bool, error)
+	// RenewLock extends a lock its holder still holds.
+	RenewLock(key string, token string, ttl time.Duration) (bool, error)
+	ReleaseLock(key string, token string) (bool, error)
+}
+
+var (
+	_ MessageQueue  = (*RocketMQManager)(nil)
+	_ MessageQueue  = (*MockRocketMQManager)(nil)
+	_ KVStore       = (*DragonflyManager)(nil)
+	_ StreamStore   = (*DragonflyManager)(nil)
+	_ PubSub        = (*DragonflyManager)(nil)
+	_ VectorStore   = (*RAGflowManager)(nil)
+	_ SQLStore      = (*PostgresOperatorClient)(nil)
+	_ SQLStore      = (*DorisClient)(nil)
+	_ EventProducer = (*KafkaClient)(nil)
+	_ Locker        = (*DragonflyManager)(nil)
+)
+
+var (
+	defaultMessageQueue  MessageQueue
+	defaultKVStore       KVStore
+	defaultStreamStore   StreamStore
+	defaultPubSub        PubSub
+	defaultVectorStore   VectorStore
+	defaultPostgresStore SQLStore
+	defaultDorisStore    SQLStore
+	defaultEventProducer EventProducer
+	defaultLocker        Locker
+)
+
+// The stores returned by the getters below resolve overrides on every call,
+// since many of them are captured in package init functions before flags
+// like --dev-inmemory are parsed.
+
+// SetMessageQueue overrides the MessageQueue returned by GetMessageQueue.
+// Passing nil restores the default RocketMQ-backed implementation.
+func SetMessageQueue(mq MessageQueue) {
+	defaultMessageQueue = mq
+}
+
+func GetMessageQueue() MessageQueue {
+	return withChaosMessageQueue(lazyMessageQueue(func() MessageQueue {
+		if defaultMessageQueue != nil {
+			return defaultMessageQueue
+		}
+		return GetRocketMQManager()
+	}))
+}
+
+// SetKVStore overrides the KVStore returned by GetKVStore. Passing nil
+// restores the default Dragonfly-backed implementation.
+func SetKVStore(store KVStore) {
+	defaultKVStore = store
+}
+
+func GetKVStore() KVStore {
+	return withChaosKVStore(lazyKVStore(func() KVStore {
+		if defaultKVStore != nil {
+			return defaultKVStore
+		}
+		return dragonflyManager
+	}))
+}
+
+// SetStreamStore overrides the StreamStore returned by GetStreamStore.
+// Passing nil restores the default Dragonfly-backed implementation.
+func SetStreamStore(store StreamStore) {
+	defaultStreamStore = store
+}
+
+func GetStreamStore() StreamStore {
+	return lazyStreamStore(func() StreamStore {
+		if defaultStreamStore != nil {
+			return defaultStreamStore
+		}
+		return dragonflyManager
+	})
+}
+
+// SetPubSub overrides the PubSub returned by GetPubSub. Passing nil restores
+// the default Dragonfly-backed implementation.
+func SetPubSub(pubsub PubSub) {
+	defaultPubSub = pubsub
+}
+
+func GetPubSub() PubSub {
+	return lazyPubSub(func() PubSub {
+		if defaultPubSub != nil {
+			return defaultPubSub
+		}
+		return dragonflyManager
+	})
+}
+
+// SetVectorStore overrides the VectorStore returned by GetVectorStore.
+// Passing nil restores the default RAGflow-backed implementation.
+func SetVectorStore(store VectorStore) {
+	defaultVectorStore = store
+}
+
+func GetVectorStore() VectorStore {
+	return lazyVectorStore(func() VectorStore {
+		if defaultVectorStore != nil {
+			return defaultVectorStore
+		}
+		return ragflowManager
+	})
+}
+
+// SetPostgresStore overrides the SQLStore returned by GetPostgresStore for
+// every connection. Passing nil restores the CrunchyData Postgres clients.
+func SetPostgresStore(store SQLStore) {
+	defaultPostgresStore = store
+}
+
+func GetPostgresStore(connectionName string) SQLStore {
+	return withChaosSQLStore(lazySQLStore(func() SQLStore {
+		if defaultPostgresStore != nil {
+			return defaultPostgresStore
+		}
+		return cachedClient("postgres/"+connectionName, func() interface{} {
+			return GetPostgresOperatorClient(connectionName)
+		}).(SQLStore)
+	}))
+}
+
+// SetDorisStore overrides the SQLStore returned by GetDorisStore for every
+// connection. Passing nil restores the default Doris clients.
+func SetDorisStore(store SQLStore) {
+	defaultDorisStore = store
+}
+
+func GetDorisStore(connectionName string) SQLStore {
+	return withChaosSQLStore(lazySQLStore(func() SQLStore {
+		if defaultDorisStore != nil {
+			return defaultDorisStore
+		}
+		return cachedClient("doris/"+connectionName, func() interface{} {
+			return GetDorisClient(connectionName)
+		}).(SQLStore)
+	}))
+}
+
+// SetEventProducer overrides the EventProducer returned by GetEventProducer.
+// Passing nil restores the default Kafka clients.
+func SetEventProducer(producer EventProducer) {
+	defaultEventProducer = producer
+}
+
+func GetEventProducer(clientID string) EventProducer {
+	return withChaosEventProducer(lazyEventProducer(func() EventProducer {
+		if defaultEventProducer != nil {
+			return defaultEventProducer
+		}
+		return cachedClient("kafka/"+clientID, func() interface{} {
+			return GetKafkaClient("", clientID, "")
+		}).(EventProducer)
+	}))
+}
+
+// SetLocker overrides the Locker returned by GetLocker. Passing nil restores
+// the default Dragonfly-backed implementation.
+func SetLocker(locker Locker) {
+	defaultLocker = locker
+}
+
+func GetLocker() Locker {
+	return lazyLocker(func() Locker {
+		if defaultLocker != nil {
+			return defaultLocker
+		}
+		return dragonflyManager
+	})
+}
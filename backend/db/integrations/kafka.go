@@ -7,21 +7,33 @@ import (
 	"log"
 	"os"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/confluentinc/confluent-kafka-go/v2/kafka"
+	"github.com/spectrumwebco/agent_runtime/backend/core/outbound"
 	"github.com/spectrumwebco/agent_runtime/pkg/djangogo/db"
 )
 
 var logger = log.New(os.Stdout, "kafka: ", log.LstdFlags)
 
+var (
+	kafkaClients      = make(map[*KafkaClient]struct{})
+	kafkaClientsMu    sync.Mutex
+	kafkaConsumeLoops sync.WaitGroup
+	kafkaDraining     atomic.Bool
+)
+
 type KafkaClient struct {
 	BootstrapServers string
 	ClientID string
 	GroupID string
 	TopicPrefix string
+	Security KafkaSecurity
 	producer *kafka.Producer
 	consumer *kafka.Consumer
+	failedDeliveries atomic.Int64
 }
 
 func NewKafkaClient(bootstrapServers, clientID, groupID string) *KafkaClient {
@@ -44,21 +56,45 @@ func NewKafkaClient(bootstrapServers, clientID, groupID string) *KafkaClient {
 	
 	topicPrefix := kafkaConfig["topic_prefix"]
 	
-	return &KafkaClient{
+	security, err := KafkaSecurityFromSettings(kafkaConfig)
+	if err != nil {
+		logger.Printf("Error loading Kafka security settings: %v", err)
+	}
+	
+	client := &KafkaClient{
 		BootstrapServers: bootstrapServers,
 		ClientID:         clientID,
 		GroupID:          groupID,
 		TopicPrefix:      topicPrefix,
+		Security:         security,
 	}
+	
+	kafkaClientsMu.Lock()
+	kafkaClients[client] = struct{}{}
+	kafkaClientsMu.Unlock()
+	
+	return client
+}
+
+// configMap adds the connection and security settings shared by producers,
+// consumers and admin clients to values.
+func (c *KafkaClient) configMap(values kafka.ConfigMap) *kafka.ConfigMap {
+	values["bootstrap.servers"] = c.BootstrapServers
+	if caBundle := outbound.Default().CABundle; caBundle != "" {
+		values["ssl.ca.location"] = caBundle
+	}
+	for key, value := range c.Security.properties() {
+		values[key] = value
+	}
+	return &values
 }
 
 func (c *KafkaClient) GetProducer() (*kafka.Producer, error) {
 	if c.producer == nil {
 		var err error
-		c.producer, err = kafka.NewProducer(&kafka.ConfigMap{
-			"bootstrap.servers": c.BootstrapServers,
-			"client.id":         c.ClientID,
-		})
+		c.producer, err = kafka.NewProducer(c.configMap(kafka.ConfigMap{
+			"client.id": c.ClientID,
+		}))
 		if err != nil {
 			return nil, fmt.Errorf("failed to create producer: %v", err)
 		}
@@ -68,6 +104,7 @@ func (c *KafkaClient) GetProducer() (*kafka.Producer, error) {
 				switch ev := e.(type) {
 				case *kafka.Message:
 					if ev.TopicPartition.Error != nil {
+						c.failedDeliveries.Add(1)
 						logger.Printf("Delivery failed: %v\n", ev.TopicPartition.Error)
 					} else {
 						logger.Printf("Delivered message to %v\n", ev.TopicPartition)
@@ -89,11 +126,10 @@ func (c *KafkaClient) GetConsumer(topics []string, groupID string, autoOffsetRes
 		groupID = c.GroupID
 	}
 	
-	consumer, err := kafka.NewConsumer(&kafka.ConfigMap{
-		"bootstrap.servers": c.BootstrapServers,
+	consumer, err := kafka.NewConsumer(c.configMap(kafka.ConfigMap{
 		"group.id":          groupID,
 		"auto.offset.reset": autoOffsetReset,
-	})
+	}))
 	if err != nil {
 		return nil, fmt.Errorf("failed to create consumer: %v", err)
 	}
@@ -168,6 +204,22 @@ func (c *KafkaClient) Produce(topic string, value interface{}, key string, heade
 	return nil
 }
 
+func (c *KafkaClient) ProduceWithHeaders(topic string, value interface{}, key string, headers map[string]string) error {
+	kafkaHeaders := make([]kafka.Header, 0, len(headers))
+	for k, v := range headers {
+		kafkaHeaders = append(kafkaHeaders, kafka.Header{Key: k, Value: []byte(v)})
+	}
+	
+	return c.Produce(topic, value, key, kafkaHeaders, nil)
+}
+
+// FailedDeliveries returns how many messages the brokers failed to accept
+// since the client was created. Produce only queues messages, so callers
+// needing delivery compare it before and after a Flush.
+func (c *KafkaClient) FailedDeliveries() int64 {
+	return c.failedDeliveries.Load()
+}
+
 func (c *KafkaClient) Flush(timeoutMs int) int {
 	if c.producer == nil {
 		return 0
@@ -230,16 +282,23 @@ func (c *KafkaClient) Consume(topics []string, timeoutMs int, numMessages int, g
 }
 
 func (c *KafkaClient) ConsumeLoop(topics []string, callback func(map[string]interface{}), groupID string, timeoutMs int, exitCondition func() bool) error {
+	if kafkaDraining.Load() {
+		return errKafkaDraining
+	}
+	
 	consumer, err := c.GetConsumer(topics, groupID, "")
 	if err != nil {
 		return err
 	}
 	defer consumer.Close()
 	
+	kafkaConsumeLoops.Add(1)
+	defer kafkaConsumeLoops.Done()
+	
 	timeout := time.Duration(timeoutMs) * time.Millisecond
 	
 	for {
-		if exitCondition != nil && exitCondition() {
+		if kafkaDraining.Load() || (exitCondition != nil && exitCondition()) {
 			break
 		}
 		
@@ -290,9 +349,7 @@ func (c *KafkaClient) ConsumeLoop(topics []string, callback func(map[string]inte
 func (c *KafkaClient) CreateTopic(topic string, numPartitions int, replicationFactor int) (bool, error) {
 	fullTopic := c.GetFullTopicName(topic)
 	
-	adminClient, err := kafka.NewAdminClient(&kafka.ConfigMap{
-		"bootstrap.servers": c.BootstrapServers,
-	})
+	adminClient, err := kafka.NewAdminClient(c.configMap(kafka.ConfigMap{}))
 	if err != nil {
 		return false, fmt.Errorf("failed to create admin client: %v", err)
 	}
@@ -325,9 +382,7 @@ func (c *KafkaClient) CreateTopic(topic string, numPartitions int, replicationFa
 func (c *KafkaClient) DeleteTopic(topic string) (bool, error) {
 	fullTopic := c.GetFullTopicName(topic)
 	
-	adminClient, err := kafka.NewAdminClient(&kafka.ConfigMap{
-		"bootstrap.servers": c.BootstrapServers,
-	})
+	adminClient, err := kafka.NewAdminClient(c.configMap(kafka.ConfigMap{}))
 	if err != nil {
 		return false, fmt.Errorf("failed to create admin client: %v", err)
 	}
@@ -352,9 +407,7 @@ func (c *KafkaClient) DeleteTopic(topic string) (bool, error) {
 }
 
 func (c *KafkaClient) ListTopics() (map[string]interface{}, error) {
-	adminClient, err := kafka.NewAdminClient(&kafka.ConfigMap{
-		"bootstrap.servers": c.BootstrapServers,
-	})
+	adminClient, err := kafka.NewAdminClient(c.configMap(kafka.ConfigMap{}))
 	if err != nil {
 		return nil, fmt.Errorf("failed to create admin client: %v", err)
 	}
@@ -386,6 +439,25 @@ func (c *KafkaClient) ListTopics() (map[string]interface{}, error) {
 	return topics, nil
 }
 
+// Ping fetches the metadata of the cluster, which checks the brokers are
+// reachable and accept the credentials of the client.
+func (c *KafkaClient) Ping(ctx context.Context) error {
+	adminClient, err := kafka.NewAdminClient(c.configMap(kafka.ConfigMap{}))
+	if err != nil {
+		return fmt.Errorf("failed to create admin client: %v", err)
+	}
+	defer adminClient.Close()
+
+	timeout := 30 * time.Second
+	if deadline, ok := ctx.Deadline(); ok {
+		timeout = time.Until(deadline)
+	}
+	if _, err := adminClient.GetMetadata(nil, false, int(timeout.Milliseconds())); err != nil {
+		return fmt.Errorf("failed to fetch metadata: %v", err)
+	}
+	return nil
+}
+
 func (c *KafkaClient) Close() {
 	if c.producer != nil {
 		c.producer.Flush(1000)
@@ -397,6 +469,21 @@ func (c *KafkaClient) Close() {
 		c.consumer.Close()
 		c.consumer = nil
 	}
+	
+	kafkaClientsMu.Lock()
+	delete(kafkaClients, c)
+	kafkaClientsMu.Unlock()
+}
+
+func openKafkaClients() []*KafkaClient {
+	kafkaClientsMu.Lock()
+	defer kafkaClientsMu.Unlock()
+	
+	clients := make([]*KafkaClient, 0, len(kafkaClients))
+	for client := range kafkaClients {
+		clients = append(clients, client)
+	}
+	return clients
 }
 
 func GetKafkaClient(bootstrapServers, clientID, groupID string) *KafkaClient {
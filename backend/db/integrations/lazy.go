@@ -0,0 +1,194 @@
+package integrations
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+var (
+	clients   = make(map[string]interface{})
+	clientsMu sync.Mutex
+)
+
+// cachedClient returns the client stored under key, creating it on first use
+// so lazily resolved stores don't set up a new connection per call.
+func cachedClient(key string, create func() interface{}) interface{} {
+	clientsMu.Lock()
+	defer clientsMu.Unlock()
+
+	client, ok := clients[key]
+	if !ok {
+		client = create()
+		clients[key] = client
+	}
+	return client
+}
+
+type lazyMessageQueue func() MessageQueue
+
+func (f lazyMessageQueue) SendMessage(topic string, message interface{}, tags, keys string) bool {
+	return f().SendMessage(topic, message, tags, keys)
+}
+
+func (f lazyMessageQueue) SendJSON(topic string, data map[string]interface{}, tags, keys string) bool {
+	return f().SendJSON(topic, data, tags, keys)
+}
+
+func (f lazyMessageQueue) Subscribe(topic string, callback func([]byte) bool) bool {
+	return f().Subscribe(topic, callback)
+}
+
+func (f lazyMessageQueue) Unsubscribe(topic string) bool {
+	return f().Unsubscribe(topic)
+}
+
+func (f lazyMessageQueue) Shutdown() bool {
+	return f().Shutdown()
+}
+
+type lazyKVStore func() KVStore
+
+func (f lazyKVStore) Get(key string) (string, error) {
+	return f().Get(key)
+}
+
+func (f lazyKVStore) Set(key string, value string, ex int) (bool, error) {
+	return f().Set(key, value, ex)
+}
+
+func (f lazyKVStore) Delete(key string) (bool, error) {
+	return f().Delete(key)
+}
+
+func (f lazyKVStore) Exists(key string) (bool, error) {
+	return f().Exists(key)
+}
+
+func (f lazyKVStore) Expire(key string, seconds int) (bool, error) {
+	return f().Expire(key, seconds)
+}
+
+func (f lazyKVStore) GetJSON(key string) (map[string]interface{}, error) {
+	return f().GetJSON(key)
+}
+
+func (f lazyKVStore) SetJSON(key string, value map[string]interface{}, ex int) (bool, error) {
+	return f().SetJSON(key, value, ex)
+}
+
+func (f lazyKVStore) HGet(name string, key string) (string, error) {
+	return f().HGet(name, key)
+}
+
+func (f lazyKVStore) HSet(name string, key string, value string) (bool, error) {
+	return f().HSet(name, key, value)
+}
+
+func (f lazyKVStore) HGetAll(name string) (map[string]string, error) {
+	return f().HGetAll(name)
+}
+
+type lazySQLStore func() SQLStore
+
+func (f lazySQLStore) ExecuteQuery(query string, params ...interface{}) ([]map[string]interface{}, error) {
+	return f().ExecuteQuery(query, params...)
+}
+
+func (f lazySQLStore) ExecuteUpdate(query string, params ...interface{}) (int64, error) {
+	return f().ExecuteUpdate(query, params...)
+}
+
+type lazyEventProducer func() EventProducer
+
+func (f lazyEventProducer) ProduceWithHeaders(topic string, value interface{}, key string, headers map[string]string) error {
+	return f().ProduceWithHeaders(topic, value, key, headers)
+}
+
+type lazyStreamStore func() StreamStore
+
+func (f lazyStreamStore) StreamAdd(stream string, values map[string]interface{}, maxLen int64) (string, error) {
+	return f().StreamAdd(stream, values, maxLen)
+}
+
+func (f lazyStreamStore) StreamCreateGroup(stream string, group string, start string) error {
+	return f().StreamCreateGroup(stream, group, start)
+}
+
+func (f lazyStreamStore) StreamReadGroup(ctx context.Context, stream string, group string, consumer string, count int64, block time.Duration) ([]StreamMessage, error) {
+	return f().StreamReadGroup(ctx, stream, group, consumer, count, block)
+}
+
+func (f lazyStreamStore) StreamAck(stream string, group string, ids ...string) (int64, error) {
+	return f().StreamAck(stream, group, ids...)
+}
+
+func (f lazyStreamStore) StreamPending(stream string, group string, count int64) ([]StreamPendingEntry, error) {
+	return f().StreamPending(stream, group, count)
+}
+
+func (f lazyStreamStore) StreamClaimStale(stream string, group string, consumer string, minIdle time.Duration, count int64) ([]StreamMessage, error) {
+	return f().StreamClaimStale(stream, group, consumer, minIdle, count)
+}
+
+type lazyPubSub func() PubSub
+
+func (f lazyPubSub) Publish(ctx context.Context, channel string, payload []byte) error {
+	return f().Publish(ctx, channel, payload)
+}
+
+func (f lazyPubSub) SubscribeChannel(ctx context.Context, channel string, handler func(payload []byte)) error {
+	return f().SubscribeChannel(ctx, channel, handler)
+}
+
+type lazyVectorStore func() VectorStore
+
+func (f lazyVectorStore) CreateIndex(indexName string, dimension int, metric string) (bool, error) {
+	return f().CreateIndex(indexName, dimension, metric)
+}
+
+func (f lazyVectorStore) DeleteIndex(indexName string) (bool, error) {
+	return f().DeleteIndex(indexName)
+}
+
+func (f lazyVectorStore) ListIndexes() ([]string, error) {
+	return f().ListIndexes()
+}
+
+func (f lazyVectorStore) AddVectors(indexName string, vectors [][]float64, ids []string, metadata []map[string]interface{}) (bool, []string, error) {
+	return f().AddVectors(indexName, vectors, ids, metadata)
+}
+
+func (f lazyVectorStore) DeleteVectors(indexName string, ids []string) (bool, error) {
+	return f().DeleteVectors(indexName, ids)
+}
+
+func (f lazyVectorStore) Search(indexName string, queryVector []float64, topK int, filterMetadata map[string]interface{}) ([]map[string]interface{}, error) {
+	return f().Search(indexName, queryVector, topK, filterMetadata)
+}
+
+func (f lazyVectorStore) SemanticSearch(indexName string, queryText string, topK int, filterMetadata map[string]interface{}) ([]map[string]interface{}, error) {
+	return f().SemanticSearch(indexName, queryText, topK, filterMetadata)
+}
+
+func (f lazyVectorStore) GetVector(indexName string, vectorID string) (map[string]interface{}, error) {
+	return f().GetVector(indexName, vectorID)
+}
+
+func (f lazyVectorStore) UpdateVectorMetadata(indexName string, vectorID string, metadata map[string]interface{}) (bool, error) {
+	return f().UpdateVectorMetadata(indexName, vectorID, metadata)
+}
+
+type lazyLocker func() Locker
+
+func (f lazyLocker) AcquireLock(key string, token string, ttl time.Duration) (bool, error) {
+	return f().AcquireLock(key, token, ttl)
+}
+
+func (f lazyLocker) RenewLock(key string, token string, ttl time.Duration) (bool, error) {
+	return f().RenewLock(key, token, ttl)
+}
+
+func (f lazyLocker) ReleaseLock(key string, token string) (bool, error) {
+	return f().ReleaseLock(key, token)
+}
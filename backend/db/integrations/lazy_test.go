@@ -0,0 +1,49 @@
+package integrations
+
+import (
+	"testing"
+	"time"
+)
+
+type fakeLocker struct {
+	acquired []string
+}
+
+func (l *fakeLocker) AcquireLock(key string, token string, ttl time.Duration) (bool, error) {
+	l.acquired = append(l.acquired, key)
+	return true, nil
+}
+
+func (l *fakeLocker) RenewLock(key string, token string, ttl time.Duration) (bool, error) {
+	return true, nil
+}
+
+func (l *fakeLocker) ReleaseLock(key string, token string) (bool, error) {
+	return true, nil
+}
+
+func TestLazyGettersResolveOverridesOnUse(t *testing.T) {
+	// captured before the override, like stores kept by package init
+	// functions before --dev-inmemory is parsed
+	locker := GetLocker()
+	stream, pubsub, vectors := GetStreamStore(), GetPubSub(), GetVectorStore()
+
+	override := &fakeLocker{}
+	SetLocker(override)
+	defer SetLocker(nil)
+
+	if ok, err := locker.AcquireLock("leader", "token", time.Second); !ok || err != nil {
+		t.Fatalf("unexpected result %v, %v", ok, err)
+	}
+	if len(override.acquired) != 1 || override.acquired[0] != "leader" {
+		t.Errorf("expected the override to take the lock, got %v", override.acquired)
+	}
+
+	for name, store := range map[string]interface{}{"stream": stream, "pubsub": pubsub, "vectors": vectors} {
+		switch store.(type) {
+		case lazyStreamStore, lazyPubSub, lazyVectorStore:
+		default:
+			t.Errorf("expected the %s store to be resolved lazily, got %T", name, store)
+		}
+	}
+}
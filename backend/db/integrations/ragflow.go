@@ -9,8 +9,11 @@ import (
 	"net/http"
 	"os"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/spectrumwebco/agent_runtime/backend/core/outbound"
 	"github.com/spectrumwebco/agent_runtime/pkg/djangogo/db"
 )
 
@@ -20,7 +23,10 @@ type RAGflowManager struct {
 	APIURL   string
 	APIKey   string
 	client   *http.Client
-	hasSetup bool
+	hasSetup atomic.Bool
+
+	aliases   IndexAliases
+	aliasesMu sync.RWMutex
 }
 
 func NewRAGflowManager(apiURL string, apiKey string) *RAGflowManager {
@@ -45,9 +51,8 @@ func NewRAGflowManager(apiURL string, apiKey string) *RAGflowManager {
 	}
 
 	manager := &RAGflowManager{
-		APIURL:   apiURL,
-		APIKey:   apiKey,
-		hasSetup: false,
+		APIURL: apiURL,
+		APIKey: apiKey,
 	}
 
 	manager.client = manager.createClient()
@@ -55,44 +60,64 @@ func NewRAGflowManager(apiURL string, apiKey string) *RAGflowManager {
 }
 
 func (m *RAGflowManager) createClient() *http.Client {
-	client := &http.Client{
-		Timeout: 30 * time.Second,
+	client, err := outbound.Default().HTTPClient(30 * time.Second)
+	if err != nil {
+		ragflowLogger.Printf("Error loading CA bundle for RAGflow: %v", err)
 	}
 
 	if m.APIURL != "" {
-		req, err := http.NewRequest("GET", fmt.Sprintf("%s/health", m.APIURL), nil)
-		if err != nil {
-			ragflowLogger.Printf("Error creating RAGflow request: %v", err)
-			return client
-		}
-
-		if m.APIKey != "" {
-			req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", m.APIKey))
-		}
-		req.Header.Set("Content-Type", "application/json")
-
-		resp, err := client.Do(req)
-		if err != nil {
+		if err := m.ping(context.Background(), client); err != nil {
 			ragflowLogger.Printf("Error connecting to RAGflow API: %v", err)
-			return client
-		}
-		defer resp.Body.Close()
-
-		if resp.StatusCode == 200 {
-			ragflowLogger.Printf("RAGflow client initialized with API URL: %s", m.APIURL)
-			m.hasSetup = true
 		} else {
-			ragflowLogger.Printf("RAGflow API returned status code %d", resp.StatusCode)
+			ragflowLogger.Printf("RAGflow client initialized with API URL: %s", m.APIURL)
 		}
 	}
 
 	return client
 }
 
+// Ping checks the health of the RAGflow API. A manager created while
+// RAGflow was unreachable starts using it once a ping succeeds.
+func (m *RAGflowManager) Ping(ctx context.Context) error {
+	if m.APIURL == "" {
+		return errRAGflowNotInitialized
+	}
+	return m.ping(ctx, m.client)
+}
+
+func (m *RAGflowManager) ping(ctx context.Context, client *http.Client) error {
+	req, err := http.NewRequestWithContext(ctx, "GET", fmt.Sprintf("%s/health", m.APIURL), nil)
+	if err != nil {
+		return err
+	}
+
+	if m.APIKey != "" {
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", m.APIKey))
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		return fmt.Errorf("RAGflow API returned status code %d", resp.StatusCode)
+	}
+	m.hasSetup.Store(true)
+	return nil
+}
+
 func (m *RAGflowManager) CreateIndex(indexName string, dimension int, metric string) (bool, error) {
-	if !m.hasSetup || m.APIURL == "" {
+	if !m.hasSetup.Load() || m.APIURL == "" {
 		ragflowLogger.Println("RAGflow client not initialized. Returning false.")
-		return false, fmt.Errorf("RAGflow client not initialized")
+		return false, errRAGflowNotInitialized
+	}
+
+	indexName, err := m.resolve(indexName)
+	if err != nil {
+		return false, err
 	}
 
 	if dimension <= 0 {
@@ -148,9 +173,14 @@ func (m *RAGflowManager) CreateIndex(indexName string, dimension int, metric str
 }
 
 func (m *RAGflowManager) DeleteIndex(indexName string) (bool, error) {
-	if !m.hasSetup || m.APIURL == "" {
+	if !m.hasSetup.Load() || m.APIURL == "" {
 		ragflowLogger.Println("RAGflow client not initialized. Returning false.")
-		return false, fmt.Errorf("RAGflow client not initialized")
+		return false, errRAGflowNotInitialized
+	}
+
+	indexName, err := m.resolve(indexName)
+	if err != nil {
+		return false, err
 	}
 
 	req, err := http.NewRequest("DELETE", fmt.Sprintf("%s/indexes/%s", m.APIURL, indexName), nil)
@@ -186,9 +216,9 @@ func (m *RAGflowManager) DeleteIndex(indexName string) (bool, error) {
 }
 
 func (m *RAGflowManager) ListIndexes() ([]string, error) {
-	if !m.hasSetup || m.APIURL == "" {
+	if !m.hasSetup.Load() || m.APIURL == "" {
 		ragflowLogger.Println("RAGflow client not initialized. Returning empty list.")
-		return []string{}, fmt.Errorf("RAGflow client not initialized")
+		return []string{}, errRAGflowNotInitialized
 	}
 
 	req, err := http.NewRequest("GET", fmt.Sprintf("%s/indexes", m.APIURL), nil)
@@ -217,7 +247,7 @@ func (m *RAGflowManager) ListIndexes() ([]string, error) {
 			ragflowLogger.Printf("Error decoding RAGflow response: %v", err)
 			return []string{}, err
 		}
-		return result.Indexes, nil
+		return m.logical(result.Indexes)
 	}
 
 	var errorResponse map[string]interface{}
@@ -230,9 +260,14 @@ func (m *RAGflowManager) ListIndexes() ([]string, error) {
 }
 
 func (m *RAGflowManager) AddVectors(indexName string, vectors [][]float64, ids []string, metadata []map[string]interface{}) (bool, []string, error) {
-	if !m.hasSetup || m.APIURL == "" {
+	if !m.hasSetup.Load() || m.APIURL == "" {
 		ragflowLogger.Println("RAGflow client not initialized. Returning false.")
-		return false, nil, fmt.Errorf("RAGflow client not initialized")
+		return false, nil, errRAGflowNotInitialized
+	}
+
+	indexName, err := m.resolve(indexName)
+	if err != nil {
+		return false, nil, err
 	}
 
 	payload := map[string]interface{}{
@@ -292,9 +327,14 @@ func (m *RAGflowManager) AddVectors(indexName string, vectors [][]float64, ids [
 }
 
 func (m *RAGflowManager) DeleteVectors(indexName string, ids []string) (bool, error) {
-	if !m.hasSetup || m.APIURL == "" {
+	if !m.hasSetup.Load() || m.APIURL == "" {
 		ragflowLogger.Println("RAGflow client not initialized. Returning false.")
-		return false, fmt.Errorf("RAGflow client not initialized")
+		return false, errRAGflowNotInitialized
+	}
+
+	indexName, err := m.resolve(indexName)
+	if err != nil {
+		return false, err
 	}
 
 	payload := map[string]interface{}{
@@ -339,9 +379,14 @@ func (m *RAGflowManager) DeleteVectors(indexName string, ids []string) (bool, er
 }
 
 func (m *RAGflowManager) Search(indexName string, queryVector []float64, topK int, filterMetadata map[string]interface{}) ([]map[string]interface{}, error) {
-	if !m.hasSetup || m.APIURL == "" {
+	if !m.hasSetup.Load() || m.APIURL == "" {
 		ragflowLogger.Println("RAGflow client not initialized. Returning empty list.")
-		return []map[string]interface{}{}, fmt.Errorf("RAGflow client not initialized")
+		return []map[string]interface{}{}, errRAGflowNotInitialized
+	}
+
+	indexName, err := m.resolve(indexName)
+	if err != nil {
+		return []map[string]interface{}{}, err
 	}
 
 	if topK <= 0 {
@@ -402,9 +447,14 @@ func (m *RAGflowManager) Search(indexName string, queryVector []float64, topK in
 }
 
 func (m *RAGflowManager) SemanticSearch(indexName string, queryText string, topK int, filterMetadata map[string]interface{}) ([]map[string]interface{}, error) {
-	if !m.hasSetup || m.APIURL == "" {
+	if !m.hasSetup.Load() || m.APIURL == "" {
 		ragflowLogger.Println("RAGflow client not initialized. Returning empty list.")
-		return []map[string]interface{}{}, fmt.Errorf("RAGflow client not initialized")
+		return []map[string]interface{}{}, errRAGflowNotInitialized
+	}
+
+	indexName, err := m.resolve(indexName)
+	if err != nil {
+		return []map[string]interface{}{}, err
 	}
 
 	if topK <= 0 {
@@ -465,9 +515,14 @@ func (m *RAGflowManager) SemanticSearch(indexName string, queryText string, topK
 }
 
 func (m *RAGflowManager) GetVector(indexName string, vectorID string) (map[string]interface{}, error) {
-	if !m.hasSetup || m.APIURL == "" {
+	if !m.hasSetup.Load() || m.APIURL == "" {
 		ragflowLogger.Println("RAGflow client not initialized. Returning nil.")
-		return nil, fmt.Errorf("RAGflow client not initialized")
+		return nil, errRAGflowNotInitialized
+	}
+
+	indexName, err := m.resolve(indexName)
+	if err != nil {
+		return nil, err
 	}
 
 	req, err := http.NewRequest("GET", fmt.Sprintf("%s/indexes/%s/vectors/%s", m.APIURL, indexName, vectorID), nil)
@@ -507,9 +562,14 @@ func (m *RAGflowManager) GetVector(indexName string, vectorID string) (map[strin
 }
 
 func (m *RAGflowManager) UpdateVectorMetadata(indexName string, vectorID string, metadata map[string]interface{}) (bool, error) {
-	if !m.hasSetup || m.APIURL == "" {
+	if !m.hasSetup.Load() || m.APIURL == "" {
 		ragflowLogger.Println("RAGflow client not initialized. Returning false.")
-		return false, fmt.Errorf("RAGflow client not initialized")
+		return false, errRAGflowNotInitialized
+	}
+
+	indexName, err := m.resolve(indexName)
+	if err != nil {
+		return false, err
 	}
 
 	payload := map[string]interface{}{
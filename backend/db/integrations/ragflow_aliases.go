@@ -0,0 +1,169 @@
+package integrations
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// IndexAliases maps the index names application code uses to the physical
+// RAGflow indexes, so an index can be rebuilt and swapped without callers
+// noticing. It is implemented by vectorindex.AliasResolver.
+type IndexAliases interface {
+	// ResolveIndex returns the physical index of a name; names without an
+	// alias are their own physical index.
+	ResolveIndex(name string) (string, error)
+	// LogicalIndexes maps physical indexes to the name they are listed
+	// under. Indexes mapped to "" are hidden, such as indexes being built
+	// or retired by a reindex; indexes missing from the map are listed
+	// under their own name.
+	LogicalIndexes() (map[string]string, error)
+}
+
+// VectorNamespacer is a VectorStore that can scope itself to a namespace.
+type VectorNamespacer interface {
+	VectorStore
+	// Namespace returns a view of the store whose index names are
+	// prefixed with namespace and which only lists the namespace's
+	// indexes.
+	Namespace(namespace string) VectorStore
+}
+
+var _ VectorNamespacer = (*RAGflowManager)(nil)
+
+// SetAliases makes the manager resolve index names through aliases.
+// Passing nil addresses physical indexes directly.
+func (m *RAGflowManager) SetAliases(aliases IndexAliases) {
+	m.aliasesMu.Lock()
+	defer m.aliasesMu.Unlock()
+
+	m.aliases = aliases
+}
+
+func (m *RAGflowManager) indexAliases() IndexAliases {
+	m.aliasesMu.RLock()
+	defer m.aliasesMu.RUnlock()
+
+	return m.aliases
+}
+
+// Physical returns a manager addressing physical indexes directly, for the
+// code that maintains the aliases.
+func (m *RAGflowManager) Physical() *RAGflowManager {
+	physical := &RAGflowManager{APIURL: m.APIURL, APIKey: m.APIKey, client: m.client}
+	physical.hasSetup.Store(m.hasSetup.Load())
+	return physical
+}
+
+func (m *RAGflowManager) resolve(indexName string) (string, error) {
+	aliases := m.indexAliases()
+	if aliases == nil {
+		return indexName, nil
+	}
+	physical, err := aliases.ResolveIndex(indexName)
+	if err != nil {
+		return "", fmt.Errorf("error resolving RAGflow index %s: %v", indexName, err)
+	}
+	return physical, nil
+}
+
+// logical replaces the physical indexes listed by RAGflow with their names.
+func (m *RAGflowManager) logical(indexes []string) ([]string, error) {
+	aliases := m.indexAliases()
+	if aliases == nil {
+		return indexes, nil
+	}
+	names, err := aliases.LogicalIndexes()
+	if err != nil {
+		return nil, fmt.Errorf("error loading RAGflow index aliases: %v", err)
+	}
+
+	seen := map[string]bool{}
+	result := []string{}
+	for _, physical := range indexes {
+		name, ok := names[physical]
+		if !ok {
+			name = physical
+		}
+		if name != "" && !seen[name] {
+			seen[name] = true
+			result = append(result, name)
+		}
+	}
+	sort.Strings(result)
+	return result, nil
+}
+
+// Namespace returns a view of the manager for one tenant. Names are
+// prefixed with the namespace before they are resolved, so each tenant has
+// its own aliases.
+func (m *RAGflowManager) Namespace(namespace string) VectorStore {
+	return &ragflowNamespace{manager: m, namespace: namespace}
+}
+
+type ragflowNamespace struct {
+	manager   *RAGflowManager
+	namespace string
+}
+
+func (n *ragflowNamespace) CreateIndex(indexName string, dimension int, metric string) (bool, error) {
+	return n.manager.CreateIndex(n.namespace+indexName, dimension, metric)
+}
+
+func (n *ragflowNamespace) DeleteIndex(indexName string) (bool, error) {
+	return n.manager.DeleteIndex(n.namespace + indexName)
+}
+
+// ListIndexes returns only the namespace's indexes, without the prefix.
+func (n *ragflowNamespace) ListIndexes() ([]string, error) {
+	indexes, err := n.manager.ListIndexes()
+	if err != nil {
+		return nil, err
+	}
+	var result []string
+	for _, name := range indexes {
+		if strings.HasPrefix(name, n.namespace) {
+			result = append(result, strings.TrimPrefix(name, n.namespace))
+		}
+	}
+	return result, nil
+}
+
+func (n *ragflowNamespace) AddVectors(indexName string, vectors [][]float64, ids []string, metadata []map[string]interface{}) (bool, []string, error) {
+	return n.manager.AddVectors(n.namespace+indexName, vectors, ids, metadata)
+}
+
+func (n *ragflowNamespace) DeleteVectors(indexName string, ids []string) (bool, error) {
+	return n.manager.DeleteVectors(n.namespace+indexName, ids)
+}
+
+func (n *ragflowNamespace) Search(indexName string, queryVector []float64, topK int, filterMetadata map[string]interface{}) ([]map[string]interface{}, error) {
+	return n.manager.Search(n.namespace+indexName, queryVector, topK, filterMetadata)
+}
+
+func (n *ragflowNamespace) SemanticSearch(indexName string, queryText string, topK int, filterMetadata map[string]interface{}) ([]map[string]interface{}, error) {
+	return n.manager.SemanticSearch(n.namespace+indexName, queryText, topK, filterMetadata)
+}
+
+func (n *ragflowNamespace) GetVector(indexName string, vectorID string) (map[string]interface{}, error) {
+	return n.manager.GetVector(n.namespace+indexName, vectorID)
+}
+
+func (n *ragflowNamespace) UpdateVectorMetadata(indexName string, vectorID string, metadata map[string]interface{}) (bool, error) {
+	return n.manager.UpdateVectorMetadata(n.namespace+indexName, vectorID, metadata)
+}
+
+// SetRAGflowAliases makes the default RAGflow manager resolve index names
+// through aliases.
+func SetRAGflowAliases(aliases IndexAliases) {
+	ragflowManager.SetAliases(aliases)
+}
+
+// GetPhysicalVectorStore returns the VectorStore addressing physical
+// indexes. Only an overridden store is returned as is; it has no aliases.
+func GetPhysicalVectorStore() VectorStore {
+	if defaultVectorStore != nil {
+		return defaultVectorStore
+	}
+	return ragflowManager.Physical()
+}
@@ -0,0 +1,76 @@
+package integrations
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+type fakeAliases map[string]string
+
+func (f fakeAliases) ResolveIndex(name string) (string, error) {
+	if physical, ok := f[name]; ok {
+		return physical, nil
+	}
+	return name, nil
+}
+
+func (f fakeAliases) LogicalIndexes() (map[string]string, error) {
+	names := map[string]string{"acme_default__docs": ""}
+	for name, physical := range f {
+		names[physical] = name
+	}
+	return names, nil
+}
+
+// newTestRAGflow serves a RAGflow API recording the paths requested.
+func newTestRAGflow(t *testing.T, indexes []string) (*RAGflowManager, *[]string) {
+	t.Helper()
+	var paths []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.Method+" "+r.URL.Path)
+		switch {
+		case r.URL.Path == "/indexes":
+			json.NewEncoder(w).Encode(map[string]interface{}{"indexes": indexes})
+		default:
+			json.NewEncoder(w).Encode(map[string]interface{}{"results": []interface{}{}})
+		}
+	}))
+	t.Cleanup(server.Close)
+	manager := &RAGflowManager{APIURL: server.URL, client: server.Client()}
+	manager.hasSetup.Store(true)
+	return manager, &paths
+}
+
+func TestRAGflowResolvesAliases(t *testing.T) {
+	manager, paths := newTestRAGflow(t, []string{"acme_default__docs", "acme_default__docs_v2", "acme_default__notes", "globex_default__docs"})
+	manager.SetAliases(fakeAliases{"acme_default__docs": "acme_default__docs_v2"})
+	acme := manager.Namespace("acme_default__")
+
+	if _, err := acme.Search("docs", []float64{1}, 5, nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := manager.Physical().Search("acme_default__docs", []float64{1}, 5, nil); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(*paths, ",") != "POST /indexes/acme_default__docs_v2/search,POST /indexes/acme_default__docs/search" {
+		t.Errorf("unexpected requests %v", *paths)
+	}
+
+	indexes, err := acme.ListIndexes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(indexes, ",") != "docs,notes" {
+		t.Errorf("expected the namespace's logical indexes, got %v", indexes)
+	}
+	indexes, err = manager.Physical().ListIndexes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(indexes) != 4 {
+		t.Errorf("expected every physical index, got %v", indexes)
+	}
+}
@@ -0,0 +1,63 @@
+package integrations
+
+import (
+	"context"
+	"time"
+
+	"github.com/spectrumwebco/agent_runtime/backend/core/readiness"
+)
+
+// RegisterReadinessChecks registers the warm-up of the stores with g. The
+// Postgres pool, Dragonfly and the Kafka brokers hold back readiness; Doris
+// and RAGflow are optional, the backend runs without analytics and vector
+// search until they come up. Stores replaced with in-memory
+// implementations are checked through those.
+func RegisterReadinessChecks(g *readiness.Gate) {
+	g.Register(readiness.Dependency{
+		Name: "postgres",
+		Check: func(ctx context.Context) error {
+			_, err := GetPostgresStore("default").ExecuteQuery("SELECT 1")
+			return err
+		},
+	})
+	g.Register(readiness.Dependency{
+		Name: "dragonfly",
+		Check: func(ctx context.Context) error {
+			if defaultKVStore != nil {
+				_, err := defaultKVStore.Exists("kled:readiness")
+				return err
+			}
+			return dragonflyManager.Ping(ctx)
+		},
+	})
+	g.Register(readiness.Dependency{
+		Name: "kafka",
+		Check: func(ctx context.Context) error {
+			if defaultEventProducer != nil {
+				return nil
+			}
+			client := GetKafkaClient("", "kled-readiness", "")
+			defer client.Close()
+			return client.Ping(ctx)
+		},
+	})
+	g.Register(readiness.Dependency{
+		Name:     "doris",
+		Optional: true,
+		Check: func(ctx context.Context) error {
+			_, err := GetDorisStore("default").ExecuteQuery("SELECT 1")
+			return err
+		},
+	})
+	g.Register(readiness.Dependency{
+		Name:     "ragflow",
+		Optional: true,
+		Timeout:  30 * time.Second,
+		Check: func(ctx context.Context) error {
+			if defaultVectorStore != nil {
+				return nil
+			}
+			return ragflowManager.Ping(ctx)
+		},
+	})
+}
@@ -17,6 +17,7 @@ var rocketmqLogger = log.New(os.Stdout, "kled.database.rocketmq: ", log.LstdFlag
 type RocketMQManager struct {
 	NameServer string
 	GroupID string
+	Security RocketMQSecurity
 	producer interface{}
 	consumers map[string]interface{}
 	mu sync.Mutex
@@ -48,9 +49,15 @@ func NewRocketMQManager(nameServer, groupID string) *RocketMQManager {
 		rocketmqLogger.Printf("RocketMQ name server not provided. Using mock client.")
 	}
 
+	security, err := RocketMQSecurityFromSettings(rocketmqConfig)
+	if err != nil {
+		rocketmqLogger.Printf("Error loading RocketMQ security settings: %v", err)
+	}
+
 	return &RocketMQManager{
 		NameServer: nameServer,
 		GroupID:    groupID,
+		Security:   security,
 		consumers:  make(map[string]interface{}),
 	}
 }
@@ -94,11 +101,11 @@ try:
     from rocketmq.client import Producer
     producer = Producer("%s")
     producer.set_name_server_address("%s")
-    producer.start()
+%s    producer.start()
     print(json.dumps({"status": "success", "producer_id": id(producer)}))
 except Exception as e:
     print(json.dumps({"status": "error", "message": str(e)}))
-`, m.GroupID, m.NameServer)
+`, m.GroupID, m.NameServer, m.Security.pythonSetup("producer"))
 
 	cmd := db.ExecutePythonScript(script)
 	output, err := cmd.CombinedOutput()
@@ -153,7 +160,7 @@ try:
     # Create consumer
     consumer = PushConsumer("%s")
     consumer.set_name_server_address("%s")
-
+%s
     # Define callback function
     def _callback(msg):
         try:
@@ -171,7 +178,7 @@ try:
     print(json.dumps({"status": "success", "consumer_id": id(consumer)}))
 except Exception as e:
     print(json.dumps({"status": "error", "message": str(e)}))
-`, m.GroupID, m.NameServer, callbackID, topic)
+`, m.GroupID, m.NameServer, m.Security.pythonSetup("consumer"), callbackID, topic)
 
 	cmd := db.ExecutePythonScript(script)
 	output, err := cmd.CombinedOutput()
@@ -626,9 +633,9 @@ func (m *MockRocketMQManager) Shutdown() bool {
 
 var RocketMQAvailable = checkRocketMQAvailable()
 
-var rocketmqManager interface{}
+var rocketmqManager MessageQueue
 
-func GetRocketMQManager() interface{} {
+func GetRocketMQManager() MessageQueue {
 	if rocketmqManager == nil {
 		if RocketMQAvailable {
 			rocketmqManager = NewRocketMQManager("", "")
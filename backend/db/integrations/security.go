@@ -0,0 +1,345 @@
+package integrations
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	vault "github.com/hashicorp/vault/api"
+)
+
+// SecretReader reads a secret by path. core/config.VaultClient implements it.
+type SecretReader interface {
+	ReadSecret(path string) (map[string]interface{}, error)
+}
+
+var (
+	secretReader   SecretReader = envVaultReader{}
+	secretReaderMu sync.Mutex
+)
+
+// SetSecretReader replaces the reader used for Vault-sourced certificates
+// and credentials. By default VAULT_ADDR and VAULT_TOKEN are used.
+func SetSecretReader(reader SecretReader) {
+	secretReaderMu.Lock()
+	defer secretReaderMu.Unlock()
+
+	secretReader = reader
+}
+
+// SecretReaderFunc adapts a function to a SecretReader.
+type SecretReaderFunc func(path string) (map[string]interface{}, error)
+
+func (f SecretReaderFunc) ReadSecret(path string) (map[string]interface{}, error) {
+	return f(path)
+}
+
+// Secrets forwards to whichever reader SetSecretReader installed at the
+// time, so it can be handed out before core/config replaces the default.
+var Secrets SecretReader = SecretReaderFunc(readSecret)
+
+func readSecret(path string) (map[string]interface{}, error) {
+	secretReaderMu.Lock()
+	reader := secretReader
+	secretReaderMu.Unlock()
+
+	return reader.ReadSecret(path)
+}
+
+// envVaultReader reads KV v2 secrets below secret/ like VaultClient.
+type envVaultReader struct{}
+
+func (envVaultReader) ReadSecret(path string) (map[string]interface{}, error) {
+	client, err := vault.NewClient(vault.DefaultConfig())
+	if err != nil {
+		return nil, fmt.Errorf("create vault client: %w", err)
+	}
+
+	secret, err := client.Logical().Read("secret/data/" + path)
+	if err != nil {
+		return nil, err
+	} else if secret == nil || secret.Data == nil {
+		return nil, fmt.Errorf("no secret found at %s", path)
+	}
+
+	data, ok := secret.Data["data"].(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("invalid secret data format at %s", path)
+	}
+	return data, nil
+}
+
+// TLSFiles are the certificates of a TLS connection, either as paths or
+// as PEM read from Vault.
+type TLSFiles struct {
+	CALocation   string
+	CertLocation string
+	KeyLocation  string
+	KeyPassword  string
+
+	CAPEM   string
+	CertPEM string
+	KeyPEM  string
+}
+
+// loadVault fills the PEM fields from the Vault secret at path. The secret
+// holds the keys ca, cert, key and optionally key_password.
+func (f *TLSFiles) loadVault(path string) (map[string]interface{}, error) {
+	secret, err := readSecret(path)
+	if err != nil {
+		return nil, fmt.Errorf("read TLS secret %s: %w", path, err)
+	}
+
+	f.CAPEM = secretString(secret, "ca", f.CAPEM)
+	f.CertPEM = secretString(secret, "cert", f.CertPEM)
+	f.KeyPEM = secretString(secret, "key", f.KeyPEM)
+	f.KeyPassword = secretString(secret, "key_password", f.KeyPassword)
+	return secret, nil
+}
+
+// writeFiles writes PEMs to dir for clients that only accept paths.
+func (f *TLSFiles) writeFiles(dir string) error {
+	for _, file := range []struct {
+		pem      string
+		location *string
+		name     string
+	}{
+		{f.CAPEM, &f.CALocation, "ca.pem"},
+		{f.CertPEM, &f.CertLocation, "cert.pem"},
+		{f.KeyPEM, &f.KeyLocation, "key.pem"},
+	} {
+		if file.pem == "" {
+			continue
+		}
+
+		path := filepath.Join(dir, file.name)
+		err := os.WriteFile(path, []byte(file.pem), 0600)
+		if err != nil {
+			return err
+		}
+		*file.location = path
+	}
+	return nil
+}
+
+func secretString(secret map[string]interface{}, key, fallback string) string {
+	if value, ok := secret[key].(string); ok && value != "" {
+		return value
+	}
+	return fallback
+}
+
+var kafkaSASLMechanisms = []string{"PLAIN", "SCRAM-SHA-256", "SCRAM-SHA-512", "OAUTHBEARER"}
+
+// KafkaSecurity configures encryption and authentication of Kafka clients.
+type KafkaSecurity struct {
+	// Protocol is PLAINTEXT, SSL, SASL_PLAINTEXT or SASL_SSL.
+	Protocol string
+
+	SASLMechanism string
+	SASLUsername  string
+	SASLPassword  string
+
+	// OAuth client credentials for OAUTHBEARER, tokens are fetched from
+	// OAuthTokenURL by librdkafka.
+	OAuthTokenURL     string
+	OAuthClientID     string
+	OAuthClientSecret string
+	OAuthScope        string
+
+	TLS TLSFiles
+}
+
+// KafkaSecurityFromSettings reads the security keys of the KAFKA_CONFIG
+// setting. If ssl_vault_path is set, certificates and SASL credentials are
+// read from Vault, the secret may contain ca, cert, key, key_password,
+// sasl_username and sasl_password.
+func KafkaSecurityFromSettings(settings map[string]string) (KafkaSecurity, error) {
+	security := KafkaSecurity{
+		Protocol:          strings.ToUpper(settings["security_protocol"]),
+		SASLMechanism:     strings.ToUpper(settings["sasl_mechanism"]),
+		SASLUsername:      settings["sasl_username"],
+		SASLPassword:      settings["sasl_password"],
+		OAuthTokenURL:     settings["oauth_token_url"],
+		OAuthClientID:     settings["oauth_client_id"],
+		OAuthClientSecret: settings["oauth_client_secret"],
+		OAuthScope:        settings["oauth_scope"],
+		TLS: TLSFiles{
+			CALocation:   settings["ssl_ca_location"],
+			CertLocation: settings["ssl_certificate_location"],
+			KeyLocation:  settings["ssl_key_location"],
+			KeyPassword:  settings["ssl_key_password"],
+		},
+	}
+
+	if path := settings["ssl_vault_path"]; path != "" {
+		secret, err := security.TLS.loadVault(path)
+		if err != nil {
+			return security, err
+		}
+		security.SASLUsername = secretString(secret, "sasl_username", security.SASLUsername)
+		security.SASLPassword = secretString(secret, "sasl_password", security.SASLPassword)
+	}
+
+	return security, security.Validate()
+}
+
+func (s KafkaSecurity) Validate() error {
+	switch s.Protocol {
+	case "", "PLAINTEXT", "SSL":
+	case "SASL_PLAINTEXT", "SASL_SSL":
+		if !containsString(kafkaSASLMechanisms, s.SASLMechanism) {
+			return fmt.Errorf("unsupported kafka SASL mechanism %q, expected one of %s", s.SASLMechanism, strings.Join(kafkaSASLMechanisms, ", "))
+		}
+		if s.SASLMechanism == "OAUTHBEARER" {
+			if s.OAuthTokenURL == "" || s.OAuthClientID == "" {
+				return fmt.Errorf("kafka OAUTHBEARER needs a token url and client id")
+			}
+		} else if s.SASLUsername == "" || s.SASLPassword == "" {
+			return fmt.Errorf("kafka SASL %s needs a username and password", s.SASLMechanism)
+		}
+	default:
+		return fmt.Errorf("unsupported kafka security protocol %q", s.Protocol)
+	}
+
+	if (s.TLS.CertLocation == "") != (s.TLS.KeyLocation == "") || (s.TLS.CertPEM == "") != (s.TLS.KeyPEM == "") {
+		return fmt.Errorf("kafka client certificate and key need to be set together")
+	}
+	return nil
+}
+
+func (s KafkaSecurity) usesTLS() bool {
+	return s.Protocol == "SSL" || s.Protocol == "SASL_SSL"
+}
+
+// properties returns the librdkafka properties for the security settings.
+func (s KafkaSecurity) properties() map[string]string {
+	properties := map[string]string{}
+	if s.Protocol == "" {
+		return properties
+	}
+
+	properties["security.protocol"] = s.Protocol
+	if strings.HasPrefix(s.Protocol, "SASL_") {
+		properties["sasl.mechanisms"] = s.SASLMechanism
+		if s.SASLMechanism == "OAUTHBEARER" {
+			properties["sasl.oauthbearer.method"] = "oidc"
+			properties["sasl.oauthbearer.token.endpoint.url"] = s.OAuthTokenURL
+			properties["sasl.oauthbearer.client.id"] = s.OAuthClientID
+			properties["sasl.oauthbearer.client.secret"] = s.OAuthClientSecret
+			if s.OAuthScope != "" {
+				properties["sasl.oauthbearer.scope"] = s.OAuthScope
+			}
+		} else {
+			properties["sasl.username"] = s.SASLUsername
+			properties["sasl.password"] = s.SASLPassword
+		}
+	}
+
+	if s.usesTLS() {
+		for key, value := range map[string]string{
+			"ssl.ca.location":          s.TLS.CALocation,
+			"ssl.certificate.location": s.TLS.CertLocation,
+			"ssl.key.location":         s.TLS.KeyLocation,
+			"ssl.key.password":         s.TLS.KeyPassword,
+			"ssl.ca.pem":               s.TLS.CAPEM,
+			"ssl.certificate.pem":      s.TLS.CertPEM,
+			"ssl.key.pem":              s.TLS.KeyPEM,
+		} {
+			if value != "" {
+				properties[key] = value
+			}
+		}
+	}
+	return properties
+}
+
+// RocketMQSecurity configures TLS and ACL credentials of RocketMQ clients.
+type RocketMQSecurity struct {
+	TLS       bool
+	AccessKey string
+	SecretKey string
+
+	TLSFiles TLSFiles
+}
+
+// RocketMQSecurityFromSettings reads the security keys of the
+// ROCKETMQ_CONFIG setting. If tls_vault_path is set, certificates and ACL
+// credentials are read from Vault, the secret may contain ca, cert, key,
+// access_key and secret_key.
+func RocketMQSecurityFromSettings(settings map[string]string) (RocketMQSecurity, error) {
+	security := RocketMQSecurity{
+		TLS:       settings["tls"] == "true",
+		AccessKey: settings["access_key"],
+		SecretKey: settings["secret_key"],
+		TLSFiles: TLSFiles{
+			CALocation:   settings["tls_ca_location"],
+			CertLocation: settings["tls_certificate_location"],
+			KeyLocation:  settings["tls_key_location"],
+			KeyPassword:  settings["tls_key_password"],
+		},
+	}
+
+	if path := settings["tls_vault_path"]; path != "" {
+		secret, err := security.TLSFiles.loadVault(path)
+		if err != nil {
+			return security, err
+		}
+		security.AccessKey = secretString(secret, "access_key", security.AccessKey)
+		security.SecretKey = secretString(secret, "secret_key", security.SecretKey)
+	}
+
+	if (security.AccessKey == "") != (security.SecretKey == "") {
+		return security, fmt.Errorf("rocketmq access key and secret key need to be set together")
+	}
+
+	// the rocketmq client only accepts certificate paths
+	if security.TLSFiles.CAPEM != "" || security.TLSFiles.CertPEM != "" || security.TLSFiles.KeyPEM != "" {
+		dir, err := os.MkdirTemp("", "kled-rocketmq-tls-")
+		if err != nil {
+			return security, err
+		}
+		if err := security.TLSFiles.writeFiles(dir); err != nil {
+			return security, fmt.Errorf("write rocketmq TLS files: %w", err)
+		}
+	}
+	return security, nil
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// pythonSetup returns the statements that configure ACL credentials and TLS
+// on the rocketmq client named client, indented for the try blocks of the
+// RocketMQ scripts. Older rocketmq-client-python releases have no TLS
+// support, the script fails with a clear error then instead of falling back
+// to plaintext.
+func (s RocketMQSecurity) pythonSetup(client string) string {
+	setup := ""
+	if s.AccessKey != "" {
+		setup += fmt.Sprintf("    %s.set_session_credentials(%s, %s, \"\")\n", client, pythonString(s.AccessKey), pythonString(s.SecretKey))
+	}
+	if s.TLS {
+		setup += fmt.Sprintf(`    _set_tls_config = getattr(%s, "set_tls_config", None)
+    if _set_tls_config is None:
+        raise RuntimeError("installed rocketmq client does not support TLS")
+    _set_tls_config(%s, %s, %s)
+`, client, pythonString(s.TLSFiles.CALocation), pythonString(s.TLSFiles.CertLocation), pythonString(s.TLSFiles.KeyLocation))
+	}
+	return setup
+}
+
+// pythonString quotes value as a Python string literal.
+func pythonString(value string) string {
+	out, _ := json.Marshal(value)
+	return string(out)
+}
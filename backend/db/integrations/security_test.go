@@ -0,0 +1,110 @@
+package integrations
+
+import (
+	"os"
+	"strings"
+	"testing"
+)
+
+type staticSecretReader map[string]map[string]interface{}
+
+func (r staticSecretReader) ReadSecret(path string) (map[string]interface{}, error) {
+	return r[path], nil
+}
+
+func TestKafkaSecurityProperties(t *testing.T) {
+	security, err := KafkaSecurityFromSettings(map[string]string{
+		"security_protocol": "sasl_ssl",
+		"sasl_mechanism":    "scram-sha-512",
+		"sasl_username":     "agent",
+		"sasl_password":     "secret",
+		"ssl_ca_location":   "/etc/kafka/ca.pem",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	properties := security.properties()
+	for key, expected := range map[string]string{
+		"security.protocol": "SASL_SSL",
+		"sasl.mechanisms":   "SCRAM-SHA-512",
+		"sasl.username":     "agent",
+		"sasl.password":     "secret",
+		"ssl.ca.location":   "/etc/kafka/ca.pem",
+	} {
+		if properties[key] != expected {
+			t.Errorf("expected %s to be %q, got %q", key, expected, properties[key])
+		}
+	}
+
+	plaintext, err := KafkaSecurityFromSettings(map[string]string{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(plaintext.properties()) != 0 {
+		t.Errorf("expected no properties without security settings, got %v", plaintext.properties())
+	}
+}
+
+func TestKafkaSecurityValidate(t *testing.T) {
+	for name, security := range map[string]KafkaSecurity{
+		"unknown protocol":   {Protocol: "TLS"},
+		"unknown mechanism":  {Protocol: "SASL_SSL", SASLMechanism: "GSSAPI"},
+		"missing password":   {Protocol: "SASL_PLAINTEXT", SASLMechanism: "PLAIN", SASLUsername: "agent"},
+		"missing token url":  {Protocol: "SASL_SSL", SASLMechanism: "OAUTHBEARER", OAuthClientID: "agent"},
+		"certificate no key": {Protocol: "SSL", TLS: TLSFiles{CertLocation: "/etc/kafka/cert.pem"}},
+	} {
+		if err := security.Validate(); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+
+	oauth := KafkaSecurity{Protocol: "SASL_SSL", SASLMechanism: "OAUTHBEARER", OAuthTokenURL: "https://auth/token", OAuthClientID: "agent"}
+	if err := oauth.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	if oauth.properties()["sasl.oauthbearer.method"] != "oidc" {
+		t.Errorf("expected oidc token retrieval, got %v", oauth.properties())
+	}
+}
+
+func TestSecurityFromVault(t *testing.T) {
+	SetSecretReader(staticSecretReader{
+		"kafka/tls":    {"ca": "kafka ca", "cert": "kafka cert", "key": "kafka key", "sasl_password": "from vault"},
+		"rocketmq/tls": {"ca": "rocketmq ca", "access_key": "ak", "secret_key": "sk"},
+	})
+	defer SetSecretReader(envVaultReader{})
+
+	kafkaSecurity, err := KafkaSecurityFromSettings(map[string]string{
+		"security_protocol": "SASL_SSL",
+		"sasl_mechanism":    "PLAIN",
+		"sasl_username":     "agent",
+		"ssl_vault_path":    "kafka/tls",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	properties := kafkaSecurity.properties()
+	if properties["ssl.certificate.pem"] != "kafka cert" || properties["sasl.password"] != "from vault" {
+		t.Errorf("expected certificates and password from vault, got %v", properties)
+	}
+
+	rocketmqSecurity, err := RocketMQSecurityFromSettings(map[string]string{
+		"tls":            "true",
+		"tls_vault_path": "rocketmq/tls",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(strings.TrimSuffix(rocketmqSecurity.TLSFiles.CALocation, "/ca.pem"))
+
+	ca, err := os.ReadFile(rocketmqSecurity.TLSFiles.CALocation)
+	if err != nil || string(ca) != "rocketmq ca" {
+		t.Errorf("expected CA written to a file, got %q, %v", ca, err)
+	}
+
+	setup := rocketmqSecurity.pythonSetup("producer")
+	if !strings.Contains(setup, `producer.set_session_credentials("ak", "sk", "")`) || !strings.Contains(setup, "set_tls_config") {
+		t.Errorf("unexpected rocketmq setup:\n%s", setup)
+	}
+}
@@ -0,0 +1,71 @@
+package integrations
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/spectrumwebco/agent_runtime/backend/core/lifecycle"
+)
+
+// RegisterShutdownClosers registers the shared integration clients with m so
+// that consumers are drained, producers flushed and pools closed on shutdown.
+func RegisterShutdownClosers(m *lifecycle.ShutdownManager) {
+	m.Register(lifecycle.PhaseDrainConsumers, "kafka-consumers", drainKafkaConsumers)
+	m.Register(lifecycle.PhaseFlushProducers, "kafka-producers", flushKafkaProducers)
+	m.Register(lifecycle.PhaseFlushProducers, "rocketmq", func(ctx context.Context) error {
+		if rocketmqManager == nil {
+			return nil
+		}
+		if !rocketmqManager.Shutdown() {
+			return fmt.Errorf("RocketMQ shutdown reported failure")
+		}
+		return nil
+	})
+	m.Register(lifecycle.PhaseClosePools, "kafka-clients", func(ctx context.Context) error {
+		for _, client := range openKafkaClients() {
+			client.Close()
+		}
+		return nil
+	})
+	m.Register(lifecycle.PhaseClosePools, "dragonfly", func(ctx context.Context) error {
+		return dragonflyManager.Close()
+	})
+}
+
+func drainKafkaConsumers(ctx context.Context) error {
+	kafkaDraining.Store(true)
+
+	drained := make(chan struct{})
+	go func() {
+		kafkaConsumeLoops.Wait()
+		close(drained)
+	}()
+
+	select {
+	case <-drained:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("kafka consumers did not drain: %v", ctx.Err())
+	}
+}
+
+func flushKafkaProducers(ctx context.Context) error {
+	timeoutMs := 10000
+	if deadline, ok := ctx.Deadline(); ok {
+		timeoutMs = int(time.Until(deadline).Milliseconds())
+		if timeoutMs < 0 {
+			timeoutMs = 0
+		}
+	}
+
+	pending := 0
+	for _, client := range openKafkaClients() {
+		pending += client.Flush(timeoutMs)
+	}
+
+	if pending > 0 {
+		return fmt.Errorf("%d kafka messages were not delivered", pending)
+	}
+	return nil
+}
@@ -0,0 +1,64 @@
+package integrations
+
+import (
+	"context"
+	"log"
+	"os"
+	"time"
+)
+
+var streamsLogger = log.New(os.Stdout, "kled.database.streams: ", log.LstdFlags)
+
+// StreamMessage is an entry of a stream.
+type StreamMessage struct {
+	ID     string
+	Values map[string]interface{}
+}
+
+// StreamPendingEntry is a message delivered to a consumer of a group but not
+// acknowledged yet.
+type StreamPendingEntry struct {
+	ID         string
+	Consumer   string
+	Idle       time.Duration
+	RetryCount int64
+}
+
+// ConsumeStream runs a consumer of group until ctx is cancelled. Messages
+// are acknowledged when handler returns nil and redelivered otherwise.
+// Messages pending longer than minIdle, including ones the handler failed
+// on, are claimed before new ones are read.
+func ConsumeStream(ctx context.Context, store StreamStore, stream string, group string, consumer string, minIdle time.Duration, handler func(StreamMessage) error) error {
+	err := store.StreamCreateGroup(stream, group, "$")
+	if err != nil {
+		return err
+	}
+
+	for ctx.Err() == nil {
+		messages, err := store.StreamClaimStale(stream, group, consumer, minIdle, 10)
+		if err == nil && len(messages) == 0 {
+			messages, err = store.StreamReadGroup(ctx, stream, group, consumer, 10, 5*time.Second)
+		}
+		if err != nil {
+			if ctx.Err() != nil {
+				break
+			}
+			select {
+			case <-ctx.Done():
+			case <-time.After(time.Second):
+			}
+			continue
+		}
+
+		for _, message := range messages {
+			if err := handler(message); err != nil {
+				streamsLogger.Printf("Error handling stream message %s from %s: %v", message.ID, stream, err)
+				continue
+			}
+
+			_, _ = store.StreamAck(stream, group, message.ID)
+		}
+	}
+
+	return nil
+}
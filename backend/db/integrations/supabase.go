@@ -4,18 +4,39 @@ import (
 	"encoding/json"
 	"fmt"
 	"log"
+	"net/http"
 	"os"
 	"os/exec"
 	"strings"
+	"sync"
 
+	"github.com/spectrumwebco/agent_runtime/backend/core/outbound"
 	"github.com/spectrumwebco/agent_runtime/pkg/djangogo/db"
 )
 
 var supabaseLogger = log.New(os.Stdout, "kled.database.supabase: ", log.LstdFlags)
 
+// withOutboundEnv makes the Supabase SDK in cmd use the configured proxy and
+// CA bundle.
+func withOutboundEnv(cmd *exec.Cmd) *exec.Cmd {
+	env := outbound.Default().Env()
+	if len(env) == 0 {
+		return cmd
+	}
+
+	if cmd.Env == nil {
+		cmd.Env = os.Environ()
+	}
+	cmd.Env = append(cmd.Env, env...)
+	return cmd
+}
+
 type SupabaseManager struct {
 	URL string
 	Key string
+
+	httpClient     *http.Client
+	authClientOnce sync.Once
 }
 
 func NewSupabaseManager(url, key string) *SupabaseManager {
@@ -65,7 +86,7 @@ except Exception as e:
     print(json.dumps({"success": False, "error": str(e)}))
 `, m.URL, m.Key)
 
-	cmd := db.ExecutePythonScript(script)
+	cmd := withOutboundEnv(db.ExecutePythonScript(script))
 	output, err := cmd.CombinedOutput()
 	if err != nil {
 		supabaseLogger.Printf("Error initializing Supabase client: %v", err)
@@ -124,7 +145,7 @@ except Exception as e:
     print(json.dumps({"success": False, "error": str(e)}))
 `, m.URL, m.Key, methodName, strings.Replace(string(argsJSON), "'", "\\'", -1))
 
-	cmd := exec.Command("python", "-c", script)
+	cmd := withOutboundEnv(exec.Command("python", "-c", script))
 	output, err := cmd.CombinedOutput()
 	if err != nil {
 		supabaseLogger.Printf("Error executing Python Supabase method: %v", err)
@@ -391,7 +412,7 @@ except Exception as e:
     print(json.dumps({"success": False, "error": str(e)}))
 `, m.URL, m.Key, tempFile.Name(), bucket, path, contentType)
 
-	cmd := db.ExecutePythonScript(script)
+	cmd := withOutboundEnv(db.ExecutePythonScript(script))
 	output, err := cmd.CombinedOutput()
 	if err != nil {
 		return false, "", fmt.Errorf("error uploading file: %v", err)
@@ -455,6 +476,20 @@ func (m *SupabaseManager) DownloadFile(bucket, path string) (bool, []byte, error
 	return true, []byte(fileDataStr), nil
 }
 
+func (m *SupabaseManager) DeleteFile(bucket, path string) (bool, error) {
+	result, err := m.ExecutePythonMethod("delete_file", bucket, path)
+	if err != nil {
+		return false, err
+	}
+	
+	success, ok := result.(bool)
+	if !ok {
+		return false, fmt.Errorf("unexpected result type: %T", result)
+	}
+	
+	return success, nil
+}
+
 func (m *SupabaseManager) InvokeFunction(functionName string, payload map[string]interface{}, headers map[string]string) (bool, interface{}, error) {
 	result, err := m.ExecutePythonMethod("invoke_function", functionName, payload, headers)
 	if err != nil {
@@ -488,3 +523,7 @@ func (m *SupabaseManager) InvokeFunction(functionName string, payload map[string
 }
 
 var supabaseManager = NewSupabaseManager("", "")
+
+func GetSupabaseManager() *SupabaseManager {
+	return supabaseManager
+}
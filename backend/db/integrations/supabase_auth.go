@@ -0,0 +1,270 @@
+package integrations
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spectrumwebco/agent_runtime/backend/core/kerrors"
+	"github.com/spectrumwebco/agent_runtime/backend/core/outbound"
+)
+
+// The admin operations below call the GoTrue API of the project directly
+// instead of going through the Python SDK. They need the service role key.
+
+// SupabaseUser is a user of the GoTrue admin API.
+type SupabaseUser struct {
+	ID               string                 `json:"id"`
+	Aud              string                 `json:"aud,omitempty"`
+	Role             string                 `json:"role,omitempty"`
+	Email            string                 `json:"email,omitempty"`
+	Phone            string                 `json:"phone,omitempty"`
+	EmailConfirmedAt *time.Time             `json:"email_confirmed_at,omitempty"`
+	InvitedAt        *time.Time             `json:"invited_at,omitempty"`
+	LastSignInAt     *time.Time             `json:"last_sign_in_at,omitempty"`
+	BannedUntil      *time.Time             `json:"banned_until,omitempty"`
+	CreatedAt        time.Time              `json:"created_at"`
+	UpdatedAt        time.Time              `json:"updated_at"`
+	AppMetadata      map[string]interface{} `json:"app_metadata,omitempty"`
+	UserMetadata     map[string]interface{} `json:"user_metadata,omitempty"`
+}
+
+// SupabaseUserPage is a page of ListUsers.
+type SupabaseUserPage struct {
+	Users []SupabaseUser `json:"users"`
+	// Total is the number of users, or -1 if GoTrue didn't return it.
+	Total int `json:"total"`
+	// NextPage is the page following this one, or 0 for the last page.
+	NextPage int `json:"next_page"`
+}
+
+// SupabaseLink is a link generated for a user, e.g. a magic link.
+type SupabaseLink struct {
+	User             SupabaseUser `json:"user"`
+	ActionLink       string       `json:"action_link"`
+	EmailOTP         string       `json:"email_otp,omitempty"`
+	HashedToken      string       `json:"hashed_token,omitempty"`
+	VerificationType string       `json:"verification_type,omitempty"`
+	RedirectTo       string       `json:"redirect_to,omitempty"`
+}
+
+// SupabaseUserUpdate changes a user. Unset fields are kept.
+type SupabaseUserUpdate struct {
+	Email        string                 `json:"email,omitempty"`
+	Role         string                 `json:"role,omitempty"`
+	AppMetadata  map[string]interface{} `json:"app_metadata,omitempty"`
+	UserMetadata map[string]interface{} `json:"user_metadata,omitempty"`
+	// BanDuration bans the user for a duration like "24h", "none" lifts a
+	// ban.
+	BanDuration string `json:"ban_duration,omitempty"`
+}
+
+// SupabaseMaxUsersPerPage is the largest page GoTrue returns.
+const SupabaseMaxUsersPerPage = 1000
+
+// InviteUserByEmail creates a user and sends them an invite email. data is
+// stored as their user metadata; redirectTo, if set, is where the link in
+// the email leads.
+func (m *SupabaseManager) InviteUserByEmail(ctx context.Context, email string, data map[string]interface{}, redirectTo string) (*SupabaseUser, error) {
+	query := url.Values{}
+	if redirectTo != "" {
+		query.Set("redirect_to", redirectTo)
+	}
+
+	user := &SupabaseUser{}
+	if _, err := m.gotrue(ctx, http.MethodPost, "/invite", query, map[string]interface{}{"email": email, "data": data}, user); err != nil {
+		return nil, fmt.Errorf("error inviting %s: %w", email, err)
+	}
+	return user, nil
+}
+
+// GenerateMagicLink returns a sign in link for the user with email without
+// sending it, e.g. to deliver it through the notification service.
+func (m *SupabaseManager) GenerateMagicLink(ctx context.Context, email, redirectTo string) (*SupabaseLink, error) {
+	body := map[string]interface{}{"type": "magiclink", "email": email}
+	if redirectTo != "" {
+		body["redirect_to"] = redirectTo
+	}
+
+	// GoTrue returns the properties of the link next to the ones of the user
+	raw := json.RawMessage{}
+	if _, err := m.gotrue(ctx, http.MethodPost, "/admin/generate_link", nil, body, &raw); err != nil {
+		return nil, fmt.Errorf("error generating magic link for %s: %w", email, err)
+	}
+	link := &SupabaseLink{}
+	if err := json.Unmarshal(raw, link); err != nil {
+		return nil, fmt.Errorf("error decoding magic link: %v", err)
+	}
+	if link.User.ID == "" {
+		if err := json.Unmarshal(raw, &link.User); err != nil {
+			return nil, fmt.Errorf("error decoding magic link: %v", err)
+		}
+	}
+	return link, nil
+}
+
+// ResetPasswordForEmail sends a password reset email to the user with
+// email. GoTrue doesn't tell whether the user exists.
+func (m *SupabaseManager) ResetPasswordForEmail(ctx context.Context, email, redirectTo string) error {
+	query := url.Values{}
+	if redirectTo != "" {
+		query.Set("redirect_to", redirectTo)
+	}
+
+	if _, err := m.gotrue(ctx, http.MethodPost, "/recover", query, map[string]interface{}{"email": email}, nil); err != nil {
+		return fmt.Errorf("error sending password reset to %s: %w", email, err)
+	}
+	return nil
+}
+
+// ListUsers returns a page of the users. Pages start at 1; perPage is
+// capped at SupabaseMaxUsersPerPage.
+func (m *SupabaseManager) ListUsers(ctx context.Context, page, perPage int) (*SupabaseUserPage, error) {
+	if page < 1 {
+		page = 1
+	}
+	if perPage < 1 || perPage > SupabaseMaxUsersPerPage {
+		perPage = SupabaseMaxUsersPerPage
+	}
+	query := url.Values{}
+	query.Set("page", strconv.Itoa(page))
+	query.Set("per_page", strconv.Itoa(perPage))
+
+	result := &SupabaseUserPage{Total: -1}
+	header, err := m.gotrue(ctx, http.MethodGet, "/admin/users", query, nil, result)
+	if err != nil {
+		return nil, fmt.Errorf("error listing users: %w", err)
+	}
+	if total, err := strconv.Atoi(header.Get("X-Total-Count")); err == nil {
+		result.Total = total
+	}
+
+	switch {
+	case result.Total >= 0:
+		if page*perPage < result.Total {
+			result.NextPage = page + 1
+		}
+	case len(result.Users) == perPage:
+		result.NextPage = page + 1
+	}
+	return result, nil
+}
+
+// UpdateUserByID changes the role, metadata or email of a user.
+func (m *SupabaseManager) UpdateUserByID(ctx context.Context, id string, update SupabaseUserUpdate) (*SupabaseUser, error) {
+	user := &SupabaseUser{}
+	if _, err := m.gotrue(ctx, http.MethodPut, "/admin/users/"+url.PathEscape(id), nil, update, user); err != nil {
+		return nil, fmt.Errorf("error updating user %s: %w", id, err)
+	}
+	return user, nil
+}
+
+// UpdateUserRole sets the role of a user, which ends up in the role claim of
+// their tokens.
+func (m *SupabaseManager) UpdateUserRole(ctx context.Context, id, role string) (*SupabaseUser, error) {
+	return m.UpdateUserByID(ctx, id, SupabaseUserUpdate{Role: role})
+}
+
+// UpdateUserMetadata merges the given keys into the metadata of a user.
+// appMetadata can't be changed by the user themselves, so it is where roles
+// and entitlements of the application belong. Either may be nil.
+func (m *SupabaseManager) UpdateUserMetadata(ctx context.Context, id string, userMetadata, appMetadata map[string]interface{}) (*SupabaseUser, error) {
+	return m.UpdateUserByID(ctx, id, SupabaseUserUpdate{UserMetadata: userMetadata, AppMetadata: appMetadata})
+}
+
+func (m *SupabaseManager) authClient() *http.Client {
+	m.authClientOnce.Do(func() {
+		if m.httpClient != nil {
+			return
+		}
+		client, err := outbound.Default().HTTPClient(30 * time.Second)
+		if err != nil {
+			supabaseLogger.Printf("Error loading CA bundle for Supabase: %v", err)
+		}
+		m.httpClient = client
+	})
+	return m.httpClient
+}
+
+// gotrue sends a request to the GoTrue API and decodes the response into
+// out, if set.
+func (m *SupabaseManager) gotrue(ctx context.Context, method, path string, query url.Values, body, out interface{}) (http.Header, error) {
+	if m.URL == "" || m.Key == "" {
+		return nil, errSupabaseNotInitialized
+	}
+
+	endpoint := strings.TrimSuffix(m.URL, "/") + "/auth/v1" + path
+	if len(query) > 0 {
+		endpoint += "?" + query.Encode()
+	}
+
+	var reader io.Reader
+	if body != nil {
+		encoded, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		reader = bytes.NewReader(encoded)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, endpoint, reader)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("apikey", m.Key)
+	req.Header.Set("Authorization", "Bearer "+m.Key)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := m.authClient().Do(req)
+	if err != nil {
+		return nil, kerrors.Wrap(kerrors.BackendUnavailable, err)
+	}
+	defer resp.Body.Close()
+
+	raw, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode >= http.StatusBadRequest {
+		return nil, gotrueError(resp.StatusCode, raw)
+	}
+	if out != nil && len(raw) > 0 {
+		if err := json.Unmarshal(raw, out); err != nil {
+			return nil, fmt.Errorf("error decoding GoTrue response: %v", err)
+		}
+	}
+	return resp.Header, nil
+}
+
+// gotrueError returns the error of a failed GoTrue request with the code of
+// its status. GoTrue has used several error formats over time.
+func gotrueError(status int, raw []byte) error {
+	response := struct {
+		Msg              string `json:"msg"`
+		Message          string `json:"message"`
+		ErrorDescription string `json:"error_description"`
+		Error            string `json:"error"`
+	}{}
+	message := strings.TrimSpace(string(raw))
+	if json.Unmarshal(raw, &response) == nil {
+		for _, candidate := range []string{response.Msg, response.Message, response.ErrorDescription, response.Error} {
+			if candidate != "" {
+				message = candidate
+				break
+			}
+		}
+	}
+	if message == "" {
+		message = http.StatusText(status)
+	}
+	return kerrors.New(kerrors.FromHTTPStatus(status), fmt.Sprintf("GoTrue returned %d: %s", status, message))
+}
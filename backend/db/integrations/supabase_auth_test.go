@@ -0,0 +1,129 @@
+package integrations
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/spectrumwebco/agent_runtime/backend/core/kerrors"
+)
+
+func newTestSupabaseManager(t *testing.T, handler http.HandlerFunc) *SupabaseManager {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("apikey") != "service-key" || r.Header.Get("Authorization") != "Bearer service-key" {
+			w.WriteHeader(http.StatusUnauthorized)
+			fmt.Fprint(w, `{"msg": "invalid JWT"}`)
+			return
+		}
+		handler(w, r)
+	}))
+	t.Cleanup(server.Close)
+	return &SupabaseManager{URL: server.URL, Key: "service-key", httpClient: server.Client()}
+}
+
+func TestSupabaseInviteAndLinks(t *testing.T) {
+	requests := map[string]map[string]interface{}{}
+	manager := newTestSupabaseManager(t, func(w http.ResponseWriter, r *http.Request) {
+		body := map[string]interface{}{}
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		requests[r.URL.Path] = body
+
+		switch r.URL.Path {
+		case "/auth/v1/invite":
+			if r.URL.Query().Get("redirect_to") != "https://kled.io/welcome" {
+				t.Errorf("unexpected query %s", r.URL.RawQuery)
+			}
+			fmt.Fprint(w, `{"id": "user-1", "email": "a@kled.io", "invited_at": "2026-01-01T00:00:00Z"}`)
+		case "/auth/v1/admin/generate_link":
+			fmt.Fprint(w, `{"id": "user-1", "email": "a@kled.io", "action_link": "https://kled.io/verify?token=1", "verification_type": "magiclink"}`)
+		case "/auth/v1/recover":
+			fmt.Fprint(w, `{}`)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	})
+
+	user, err := manager.InviteUserByEmail(context.Background(), "a@kled.io", map[string]interface{}{"team": "core"}, "https://kled.io/welcome")
+	if err != nil || user.ID != "user-1" || user.InvitedAt == nil {
+		t.Fatalf("unexpected invite %+v: %v", user, err)
+	}
+	if data, _ := requests["/auth/v1/invite"]["data"].(map[string]interface{}); data["team"] != "core" {
+		t.Errorf("expected the metadata to be sent, got %v", requests["/auth/v1/invite"])
+	}
+
+	link, err := manager.GenerateMagicLink(context.Background(), "a@kled.io", "")
+	if err != nil || link.ActionLink != "https://kled.io/verify?token=1" || link.User.ID != "user-1" {
+		t.Fatalf("unexpected link %+v: %v", link, err)
+	}
+	if requests["/auth/v1/admin/generate_link"]["type"] != "magiclink" {
+		t.Errorf("unexpected link request %v", requests["/auth/v1/admin/generate_link"])
+	}
+
+	if err := manager.ResetPasswordForEmail(context.Background(), "a@kled.io", ""); err != nil {
+		t.Fatal(err)
+	}
+	if requests["/auth/v1/recover"]["email"] != "a@kled.io" {
+		t.Errorf("unexpected reset request %v", requests["/auth/v1/recover"])
+	}
+}
+
+func TestSupabaseListUsers(t *testing.T) {
+	manager := newTestSupabaseManager(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("per_page") != "2" {
+			t.Errorf("unexpected query %s", r.URL.RawQuery)
+		}
+		w.Header().Set("X-Total-Count", "3")
+		if r.URL.Query().Get("page") == "1" {
+			fmt.Fprint(w, `{"users": [{"id": "user-1"}, {"id": "user-2"}]}`)
+		} else {
+			fmt.Fprint(w, `{"users": [{"id": "user-3"}]}`)
+		}
+	})
+
+	page, err := manager.ListUsers(context.Background(), 1, 2)
+	if err != nil || len(page.Users) != 2 || page.Total != 3 || page.NextPage != 2 {
+		t.Fatalf("unexpected first page %+v: %v", page, err)
+	}
+	page, err = manager.ListUsers(context.Background(), page.NextPage, 2)
+	if err != nil || len(page.Users) != 1 || page.Users[0].ID != "user-3" || page.NextPage != 0 {
+		t.Fatalf("unexpected last page %+v: %v", page, err)
+	}
+}
+
+func TestSupabaseUpdateUser(t *testing.T) {
+	manager := newTestSupabaseManager(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPut || r.URL.Path != "/auth/v1/admin/users/user-1" {
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(w, `{"code": 404, "msg": "User not found"}`)
+			return
+		}
+		update := SupabaseUserUpdate{}
+		_ = json.NewDecoder(r.Body).Decode(&update)
+		json.NewEncoder(w).Encode(SupabaseUser{ID: "user-1", Role: update.Role, AppMetadata: update.AppMetadata})
+	})
+
+	user, err := manager.UpdateUserRole(context.Background(), "user-1", "admin")
+	if err != nil || user.Role != "admin" {
+		t.Fatalf("unexpected user %+v: %v", user, err)
+	}
+	user, err = manager.UpdateUserMetadata(context.Background(), "user-1", nil, map[string]interface{}{"plan": "team"})
+	if err != nil || user.AppMetadata["plan"] != "team" {
+		t.Fatalf("unexpected user %+v: %v", user, err)
+	}
+
+	_, err = manager.UpdateUserRole(context.Background(), "user-2", "admin")
+	if !errors.Is(err, kerrors.ErrNotFound) || err.Error() != "error updating user user-2: GoTrue returned 404: User not found" {
+		t.Errorf("unexpected error %v", err)
+	}
+}
+
+func TestSupabaseNotConfigured(t *testing.T) {
+	_, err := (&SupabaseManager{}).ListUsers(context.Background(), 1, 10)
+	if !errors.Is(err, kerrors.ErrBackendUnavailable) {
+		t.Errorf("expected the backend to be unavailable, got %v", err)
+	}
+}
@@ -0,0 +1,151 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"github.com/spectrumwebco/agent_runtime/api/generated/protos"
+	"github.com/spectrumwebco/agent_runtime/backend/core/quota"
+	"github.com/spectrumwebco/agent_runtime/backend/core/rbac"
+	"github.com/spectrumwebco/agent_runtime/backend/core/runs"
+	"github.com/spectrumwebco/agent_runtime/backend/core/tenancy"
+	"github.com/spectrumwebco/agent_runtime/backend/db/integrations"
+	agentruns "github.com/spectrumwebco/agent_runtime/backend/protos/gen/go/agent_runs"
+)
+
+var agentServiceMethods = map[string]rbac.GRPCMethod{
+	// tasks run in the workspace named by their context, if any
+	"/agent.AgentService/ExecuteTask": {
+		Action:       rbac.ActionInterpreterExecute,
+		ResourceType: "workspace",
+		ResourceID: func(req interface{}) string {
+			return req.(*protos.ExecuteTaskRequest).GetContext()["workspace_id"]
+		},
+	},
+	"/agent.AgentService/GetTaskStatus": {
+		Action:       rbac.ActionInterpreterStatus,
+		ResourceType: "task",
+		ResourceID:   func(req interface{}) string { return req.(*protos.GetTaskStatusRequest).GetTaskId() },
+	},
+	"/agent.AgentService/CancelTask": {
+		Action:       rbac.ActionInterpreterCancel,
+		ResourceType: "task",
+		ResourceID:   func(req interface{}) string { return req.(*protos.CancelTaskRequest).GetTaskId() },
+	},
+	// runs are executed as interpreter tasks, the runtime reports progress
+	// with the status permission
+	"/runs.AgentRuns/StartRun":       {Action: rbac.ActionInterpreterExecute, ResourceType: "workspace", ResourceID: startRunWorkspace},
+	"/runs.AgentRuns/ResumeRun":      {Action: rbac.ActionInterpreterExecute, ResourceType: "run", ResourceID: runID},
+	"/runs.AgentRuns/GetRun":         {Action: rbac.ActionInterpreterStatus, ResourceType: "interpreter"},
+	"/runs.AgentRuns/ListRuns":       {Action: rbac.ActionInterpreterStatus, ResourceType: "interpreter"},
+	"/runs.AgentRuns/SaveCheckpoint": {Action: rbac.ActionInterpreterStatus, ResourceType: "interpreter"},
+	"/runs.AgentRuns/FinishRun":      {Action: rbac.ActionInterpreterStatus, ResourceType: "interpreter"},
+	"/runs.AgentRuns/PauseRun":       {Action: rbac.ActionInterpreterCancel, ResourceType: "run", ResourceID: runID},
+	"/runs.AgentRuns/CancelRun":      {Action: rbac.ActionInterpreterCancel, ResourceType: "run", ResourceID: runID},
+}
+
+func startRunWorkspace(req interface{}) string {
+	return req.(*agentruns.StartRunRequest).GetWorkspaceId()
+}
+
+func runID(req interface{}) string {
+	return req.(*agentruns.RunRequest).GetRunId()
+}
+
+// executingMethods start interpreter tasks and are charged against the
+// execution quota.
+var executingMethods = map[string]bool{
+	"/agent.AgentService/ExecuteTask": true,
+	"/runs.AgentRuns/StartRun":        true,
+	"/runs.AgentRuns/ResumeRun":       true,
+}
+
+// grpcSubject resolves the caller from the x-api-key metadata entry. Calls
+// without a key resolve to the anonymous subject and are denied by the engine.
+func grpcSubject(ctx context.Context) (rbac.Subject, error) {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return rbac.Subject{}, nil
+	}
+	keys := md.Get("x-api-key")
+	if len(keys) == 0 || keys[0] == "" {
+		return rbac.Subject{}, nil
+	}
+
+	client := integrations.GetPostgresStore("default")
+	rows, err := client.ExecuteQuery(`
+		SELECT k.user_id, k.organization_id, u.is_superuser
+		FROM app_apikey k
+		JOIN app_user u ON u.id = k.user_id
+		WHERE k.key = $1
+	`, keys[0])
+	if err != nil {
+		return rbac.Subject{}, fmt.Errorf("failed to look up API key: %v", err)
+	}
+	if len(rows) == 0 {
+		return rbac.Subject{}, fmt.Errorf("invalid API key")
+	}
+
+	userID := fmt.Sprintf("%v", rows[0]["user_id"])
+	organizationID := ""
+	if rows[0]["organization_id"] != nil {
+		organizationID = fmt.Sprintf("%v", rows[0]["organization_id"])
+	}
+	superuser, _ := rows[0]["is_superuser"].(bool)
+
+	return rbac.SubjectFor(rbac.NewPostgresRoleStore(client), userID, organizationID, superuser)
+}
+
+// newAgentServiceAuthorizer loads the owners of tasks from the agent service,
+// of runs from the run store and of workspaces from Postgres.
+func newAgentServiceAuthorizer(tasks *AgentServiceServer, runStore runs.Store) *rbac.GRPCAuthorizer {
+	workspaces := rbac.WorkspaceLookup(integrations.GetPostgresStore("default"))
+	lookup := func(ctx context.Context, resourceType, resourceID string) (rbac.Resource, error) {
+		switch resourceType {
+		case "task":
+			return tasks.LookupTask(ctx, resourceType, resourceID)
+		case "run":
+			run, err := runStore.Get(ctx, resourceID)
+			if err != nil {
+				return rbac.Resource{}, err
+			}
+			return rbac.Resource{Type: resourceType, ID: run.ID, OwnerID: run.CreatedBy, OrganizationID: run.OrganizationID}, nil
+		default:
+			return workspaces(ctx, resourceType, resourceID)
+		}
+	}
+	return rbac.NewGRPCAuthorizer(rbac.DefaultEngine(), agentServiceMethods, grpcSubject, lookup)
+}
+
+// quotaUnaryInterceptor charges calls starting interpreter tasks against the
+// caller's daily execution quota. It runs after the authorizer, which stores
+// the subject.
+func quotaUnaryInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	if !executingMethods[info.FullMethod] {
+		return handler(ctx, req)
+	}
+
+	subject, ok := rbac.SubjectFromContext(ctx)
+	if !ok || subject.ID == "" {
+		return handler(ctx, req)
+	}
+
+	scopes := []quota.Scope{{Type: quota.ScopeUser, ID: subject.ID}}
+	if tenant, err := tenancy.New(subject.OrganizationID, ""); err == nil {
+		scopes = append(scopes, quota.Scope{Type: quota.ScopeProject, ID: tenant.String()})
+	}
+
+	if err := quota.DefaultManager().Consume(ctx, scopes, quota.ResourceExecutionsPerDay, 1); err != nil {
+		if errors.Is(err, quota.ErrExceeded) {
+			return nil, status.Error(codes.ResourceExhausted, err.Error())
+		}
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	return handler(ctx, req)
+}
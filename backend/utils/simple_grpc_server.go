@@ -6,9 +6,7 @@ import (
 	"log"
 	"net"
 	"os"
-	"os/signal"
 	"sync"
-	"syscall"
 	"time"
 
 	"github.com/google/uuid"
@@ -18,10 +16,24 @@ import (
 	"google.golang.org/grpc/status"
 
 	"github.com/spectrumwebco/agent_runtime/api/generated/protos"
+	"github.com/spectrumwebco/agent_runtime/backend/core/agentcmd"
+	"github.com/spectrumwebco/agent_runtime/backend/core/heartbeat"
+	"github.com/spectrumwebco/agent_runtime/backend/core/lifecycle"
+	"github.com/spectrumwebco/agent_runtime/backend/core/quota"
+	"github.com/spectrumwebco/agent_runtime/backend/core/rbac"
+	"github.com/spectrumwebco/agent_runtime/backend/core/runs"
+	"github.com/spectrumwebco/agent_runtime/backend/db/integrations"
+	agentcontrol "github.com/spectrumwebco/agent_runtime/backend/protos/gen/go/agent_control"
+	agentruns "github.com/spectrumwebco/agent_runtime/backend/protos/gen/go/agent_runs"
+	"github.com/spectrumwebco/agent_runtime/pkg/djangogo/core"
 )
 
 type Task struct {
 	ID      string
+	// OwnerID and OrganizationID are those of the caller that submitted the
+	// task, for ownership checks of later calls.
+	OwnerID        string
+	OrganizationID string
 	Status  string
 	Prompt  string
 	Context map[string]string
@@ -57,6 +69,10 @@ func (s *AgentServiceServer) ExecuteTask(ctx context.Context, req *protos.Execut
 		Result:  "",
 		Events:  []string{"Task created"},
 	}
+	if subject, ok := rbac.SubjectFromContext(ctx); ok {
+		task.OwnerID = subject.ID
+		task.OrganizationID = subject.OrganizationID
+	}
 
 	s.mu.Lock()
 	s.tasks[taskID] = task
@@ -71,6 +87,18 @@ func (s *AgentServiceServer) ExecuteTask(ctx context.Context, req *protos.Execut
 	}, nil
 }
 
+// LookupTask loads the owner and organization of a task for ownership
+// checks.
+func (s *AgentServiceServer) LookupTask(ctx context.Context, resourceType, resourceID string) (rbac.Resource, error) {
+	s.mu.Lock()
+	task, exists := s.tasks[resourceID]
+	s.mu.Unlock()
+	if !exists {
+		return rbac.Resource{}, fmt.Errorf("task %s not found", resourceID)
+	}
+	return rbac.Resource{Type: resourceType, ID: task.ID, OwnerID: task.OwnerID, OrganizationID: task.OrganizationID}, nil
+}
+
 func (s *AgentServiceServer) GetTaskStatus(ctx context.Context, req *protos.GetTaskStatusRequest) (*protos.GetTaskStatusResponse, error) {
 	log.Printf("Received GetTaskStatus request for task: %s", req.TaskId)
 
@@ -144,16 +172,71 @@ func (s *AgentServiceServer) executeTaskAsync(task *Task) {
 	task.Events = append(task.Events, "Task execution started", "Task execution completed")
 }
 
+// taskInterpreter executes runs as tasks of the in-process AgentService.
+type taskInterpreter struct {
+	server *AgentServiceServer
+}
+
+func (i taskInterpreter) ExecuteTask(ctx context.Context, prompt string, taskContext map[string]string) (string, error) {
+	resp, err := i.server.ExecuteTask(ctx, &protos.ExecuteTaskRequest{Prompt: prompt, Context: taskContext})
+	if err != nil {
+		return "", err
+	}
+	return resp.TaskId, nil
+}
+
+func (i taskInterpreter) CancelTask(ctx context.Context, taskID string) error {
+	_, err := i.server.CancelTask(ctx, &protos.CancelTaskRequest{TaskId: taskID})
+	if status.Code(err) == codes.NotFound {
+		// tasks don't survive restarts of the server
+		return nil
+	}
+	return err
+}
+
 func Serve() {
 	port := os.Getenv("GRPC_SERVER_PORT")
 	if port == "" {
 		port = "50051"
 	}
 
-	server := grpc.NewServer()
-	
+	defaults, _ := core.GetSetting("QUOTA_DEFAULTS", map[string]interface{}{})
+	quota.ConfigureDefault(
+		integrations.GetPostgresStore("default"),
+		quota.ParseDefaults(defaults),
+		quota.NewKafkaNotifier(integrations.GetEventProducer("kled-quota")),
+	)
+
 	agentService := NewAgentServiceServer()
+	runStore := runs.ConfigureDefault(integrations.GetPostgresStore("default"))
+
+	authorizer := newAgentServiceAuthorizer(agentService, runStore)
+	server := grpc.NewServer(
+		grpc.ChainUnaryInterceptor(authorizer.UnaryServerInterceptor(), quotaUnaryInterceptor),
+		grpc.ChainStreamInterceptor(authorizer.StreamServerInterceptor()),
+	)
+	
 	protos.RegisterAgentServiceServer(server, agentService)
+
+	// runs execute as tasks of this server, their workspaces are signalled
+	// through the command streams below
+	orchestrator := runs.NewOrchestrator(
+		runStore,
+		runs.NewInterpreterExecutor(taskInterpreter{server: agentService}),
+		runs.NewWorkspaceSignaler(agentcmd.Default()),
+	)
+	agentruns.RegisterAgentRunsServer(server, runs.NewServer(orchestrator))
+
+	// workspace agents stream heartbeats, missed beats are swept here
+	heartbeatInterval, _ := core.GetSetting("HEARTBEAT_INTERVAL_SECONDS", 15)
+	missedBeats, _ := core.GetSetting("HEARTBEAT_MISSED_BEATS", 3)
+	heartbeatToken, _ := core.GetSetting("HEARTBEAT_TOKEN", "")
+	tracker := heartbeat.NewTracker(integrations.GetKVStore(), time.Duration(heartbeatInterval.(int))*time.Second, missedBeats.(int))
+	agentcontrol.RegisterHeartbeatServer(server, heartbeat.NewServer(tracker, heartbeatToken.(string)))
+	// the same agents connect for commands, results go back to the issuer
+	agentcontrol.RegisterAgentCommandsServer(server, agentcmd.NewServer(agentcmd.Default(), heartbeatToken.(string)))
+	sweepCtx, stopSweeping := context.WithCancel(context.Background())
+	go tracker.Run(sweepCtx)
 	
 	reflection.Register(server)
 
@@ -169,13 +252,28 @@ func Serve() {
 		}
 	}()
 
-	sigCh := make(chan os.Signal, 1)
-	signal.Notify(sigCh, os.Interrupt, syscall.SIGTERM)
+	shutdown := lifecycle.DefaultManager()
+	shutdown.Register(lifecycle.PhaseStopAccepting, "grpc-server", func(ctx context.Context) error {
+		stopped := make(chan struct{})
+		go func() {
+			server.GracefulStop()
+			close(stopped)
+		}()
+
+		select {
+		case <-stopped:
+			return nil
+		case <-ctx.Done():
+			server.Stop()
+			return ctx.Err()
+		}
+	})
+	shutdown.Register(lifecycle.PhaseStopAccepting, "heartbeat-sweeper", lifecycle.Func(stopSweeping))
+	integrations.RegisterShutdownClosers(shutdown)
 
-	sig := <-sigCh
-	log.Printf("Received signal %v, stopping server...", sig)
-	
-	server.GracefulStop()
+	if err := shutdown.WaitForSignal(); err != nil {
+		log.Printf("Shutdown completed with errors: %v", err)
+	}
 	log.Println("Server stopped")
 }
 
@@ -19,5 +19,7 @@ func NewContainerCmd(flags *flags.GlobalFlags) *cobra.Command {
 	containerCmd.AddCommand(NewCredentialsServerCmd(flags))
 	containerCmd.AddCommand(NewSetupLoftPlatformAccessCmd(flags))
 	containerCmd.AddCommand(NewSSHServerCmd(flags))
+	containerCmd.AddCommand(NewFileSyncCmd())
+	containerCmd.AddCommand(NewControlCmd())
 	return containerCmd
 }
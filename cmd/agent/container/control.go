@@ -0,0 +1,39 @@
+package container
+
+import (
+	"os"
+
+	"github.com/loft-sh/devpod/pkg/agent/control"
+	"github.com/loft-sh/devpod/pkg/stdio"
+	"github.com/loft-sh/log"
+	"github.com/spf13/cobra"
+)
+
+// ControlCmd holds the control cmd flags
+type ControlCmd struct {
+	Workdir string
+}
+
+// NewControlCmd creates a new command
+func NewControlCmd() *cobra.Command {
+	cmd := &ControlCmd{}
+	controlCmd := &cobra.Command{
+		Use:    "control",
+		Short:  "Serves the control channel on stdio for kled cp",
+		Hidden: true,
+		Args:   cobra.NoArgs,
+		RunE: func(c *cobra.Command, _ []string) error {
+			return cmd.Run(c)
+		},
+	}
+	controlCmd.Flags().StringVar(&cmd.Workdir, "workdir", "", "Directory relative paths resolve against")
+	return controlCmd
+}
+
+// Run runs the command logic. The connection was authenticated by ssh
+// already and the command runs as the workspace user, so the control
+// channel needs no token. The process exits once stdin is closed
+func (cmd *ControlCmd) Run(c *cobra.Command) error {
+	lis := stdio.NewStdioListener(os.Stdin, os.Stdout, true)
+	return control.NewServer("", cmd.Workdir, log.Discard).Serve(c.Context(), lis)
+}
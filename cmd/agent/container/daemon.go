@@ -5,6 +5,7 @@ import (
 	"encoding/base64"
 	"encoding/json"
 	"fmt"
+	"net"
 	"os"
 	"os/exec"
 	"os/signal"
@@ -14,6 +15,7 @@ import (
 	"time"
 
 	"github.com/loft-sh/devpod/pkg/agent"
+	"github.com/loft-sh/devpod/pkg/agent/control"
 	agentd "github.com/loft-sh/devpod/pkg/daemon/agent"
 	"github.com/loft-sh/devpod/pkg/devcontainer"
 	"github.com/loft-sh/devpod/pkg/platform/client"
@@ -46,12 +48,15 @@ func NewDaemonCmd() *cobra.Command {
 		RunE:  cmd.Run,
 	}
 	daemonCmd.Flags().StringVar(&cmd.Config.Timeout, "timeout", "", "The timeout to stop the container after")
+	daemonCmd.Flags().StringVar(&cmd.Config.Control.Address, "control-address", "", "The address to serve the gRPC control channel on")
+	daemonCmd.Flags().StringVar(&cmd.Config.Heartbeat.Address, "heartbeat-address", "", "The gRPC address of the backend to send heartbeats to")
+	daemonCmd.Flags().StringVar(&cmd.Config.Heartbeat.Interval, "heartbeat-interval", "", "The interval to send heartbeats at until the backend announces one")
 	return daemonCmd
 }
 
 func (cmd *DaemonCmd) Run(c *cobra.Command, args []string) error {
 	ctx := c.Context()
-	errChan := make(chan error, 4)
+	errChan := make(chan error, 5)
 	var wg sync.WaitGroup
 
 	if err := cmd.loadConfig(); err != nil {
@@ -105,6 +110,24 @@ func (cmd *DaemonCmd) Run(c *cobra.Command, args []string) error {
 		go runSshServer(ctx, cmd, errChan, &wg)
 	}
 
+	// Start gRPC control channel.
+	if cmd.shouldRunControlServer() {
+		tasksStarted = true
+		wg.Add(1)
+		go runControlServer(ctx, cmd, errChan, &wg)
+	}
+
+	// Start heartbeats to the backend.
+	if cmd.Config.Heartbeat.Address != "" {
+		tasksStarted = true
+		wg.Add(1)
+		go runHeartbeat(ctx, cmd, errChan, &wg)
+
+		// Commands are received from the same backend.
+		wg.Add(1)
+		go runCommands(ctx, cmd, errChan, &wg)
+	}
+
 	// In case no task is configured, just wait indefinitely.
 	if !tasksStarted {
 		wg.Add(1)
@@ -145,6 +168,15 @@ func (cmd *DaemonCmd) loadConfig() error {
 		if cmd.Config.Timeout != "" {
 			cfg.Timeout = cmd.Config.Timeout
 		}
+		if cmd.Config.Control.Address != "" {
+			cfg.Control.Address = cmd.Config.Control.Address
+		}
+		if cmd.Config.Heartbeat.Address != "" {
+			cfg.Heartbeat.Address = cmd.Config.Heartbeat.Address
+		}
+		if cmd.Config.Heartbeat.Interval != "" {
+			cfg.Heartbeat.Interval = cmd.Config.Heartbeat.Interval
+		}
 		cmd.Config = &cfg
 	}
 	return nil
@@ -162,6 +194,27 @@ func (cmd *DaemonCmd) shouldRunSsh() bool {
 	return cmd.Config.Ssh.Workdir != "" || cmd.Config.Ssh.User != ""
 }
 
+// shouldRunControlServer returns true if the control channel has an address. Without a
+// token the control channel is only served on loopback addresses.
+func (cmd *DaemonCmd) shouldRunControlServer() bool {
+	if cmd.Config.Control.Address == "" {
+		return false
+	} else if cmd.Config.Control.Token != "" {
+		return true
+	}
+
+	host, _, err := net.SplitHostPort(cmd.Config.Control.Address)
+	if err != nil {
+		return false
+	}
+	ip := net.ParseIP(host)
+	if host != "localhost" && (ip == nil || !ip.IsLoopback()) {
+		cmd.Log.Warnf("Not serving the control channel on %s without a token", cmd.Config.Control.Address)
+		return false
+	}
+	return true
+}
+
 // setupActivityFile creates and sets permissions on the container activity file.
 func setupActivityFile() error {
 	if err := os.WriteFile(agent.ContainerActivityFile, nil, 0777); err != nil {
@@ -278,6 +331,50 @@ func runSshServer(ctx context.Context, cmd *DaemonCmd, errChan chan<- error, wg
 	close(done)
 }
 
+// runControlServer serves the gRPC control channel.
+func runControlServer(ctx context.Context, cmd *DaemonCmd, errChan chan<- error, wg *sync.WaitGroup) {
+	defer wg.Done()
+	lis, err := net.Listen("tcp", cmd.Config.Control.Address)
+	if err != nil {
+		errChan <- fmt.Errorf("control server: %w", err)
+		return
+	}
+
+	cmd.Log.Infof("Serving control channel on %s", lis.Addr())
+	server := control.NewServer(cmd.Config.Control.Token, cmd.Config.Ssh.Workdir, cmd.Log)
+	if err := server.Serve(ctx, lis); err != nil {
+		errChan <- fmt.Errorf("control server: %w", err)
+	}
+}
+
+// runHeartbeat sends heartbeats to the backend. Unreachable backends are
+// retried and never stop the daemon.
+func runHeartbeat(ctx context.Context, cmd *DaemonCmd, errChan chan<- error, wg *sync.WaitGroup) {
+	defer wg.Done()
+	var interval time.Duration
+	if cmd.Config.Heartbeat.Interval != "" {
+		var err error
+		interval, err = time.ParseDuration(cmd.Config.Heartbeat.Interval)
+		if err != nil {
+			errChan <- fmt.Errorf("parse heartbeat interval: %w", err)
+			return
+		}
+	}
+
+	cmd.Log.Infof("Sending heartbeats to %s", cmd.Config.Heartbeat.Address)
+	heartbeater := &control.Heartbeater{
+		Address:      cmd.Config.Heartbeat.Address,
+		Token:        cmd.Config.Heartbeat.Token,
+		WorkspaceID:  cmd.Config.Heartbeat.WorkspaceID,
+		WorkspaceUID: cmd.Config.Heartbeat.WorkspaceUID,
+		Interval:     interval,
+		Log:          cmd.Log,
+	}
+	if err := heartbeater.Run(ctx); err != nil {
+		errChan <- fmt.Errorf("heartbeat: %w", err)
+	}
+}
+
 // handleSignals listens for OS termination signals and sends an error through errChan.
 func handleSignals(ctx context.Context, errChan chan<- error) {
 	sigChan := make(chan os.Signal, 1)
@@ -293,3 +390,29 @@ func handleSignals(ctx context.Context, errChan chan<- error) {
 func initLogging() log.Logger {
 	return log.NewStdoutLogger(nil, os.Stdout, os.Stderr, logrus.InfoLevel)
 }
+
+// runCommands runs the commands issued by the backend until ctx is done.
+func runCommands(ctx context.Context, cmd *DaemonCmd, errChan chan<- error, wg *sync.WaitGroup) {
+	defer wg.Done()
+	runner := &control.CommandRunner{
+		Address:      cmd.Config.Heartbeat.Address,
+		Token:        cmd.Config.Heartbeat.Token,
+		WorkspaceID:  cmd.Config.Heartbeat.WorkspaceID,
+		WorkspaceUID: cmd.Config.Heartbeat.WorkspaceUID,
+		Handlers: map[string]control.CommandHandler{
+			"ping": control.PingCommandHandler,
+			"exec": control.ExecCommandHandler(cmd.Config.Ssh.Workdir),
+			// runtimes of agent runs learn of pauses and cancellations here
+			"run_signal": control.RunSignalCommandHandler(control.DefaultRunSignalDir),
+			// change review: diffs of the working tree and reviewed patches
+			"workspace_diff":     control.DiffCommandHandler(cmd.Config.Ssh.Workdir),
+			"workspace_snapshot": control.SnapshotCommandHandler(cmd.Config.Ssh.Workdir),
+			"apply_patch":        control.ApplyPatchCommandHandler(cmd.Config.Ssh.Workdir),
+			"publish_changes":    control.PublishCommandHandler(cmd.Config.Ssh.Workdir),
+		},
+		Log: cmd.Log,
+	}
+	if err := runner.Run(ctx); err != nil {
+		errChan <- fmt.Errorf("agent commands: %w", err)
+	}
+}
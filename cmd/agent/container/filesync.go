@@ -0,0 +1,117 @@
+package container
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+
+	"github.com/loft-sh/devpod/pkg/filesync"
+	"github.com/spf13/cobra"
+)
+
+// FileSyncCmd holds the cmd flags
+type FileSyncCmd struct {
+	Path   string
+	Ignore []string
+}
+
+// NewFileSyncCmd creates a new command
+func NewFileSyncCmd() *cobra.Command {
+	cmd := &FileSyncCmd{}
+	fileSyncCmd := &cobra.Command{
+		Use:    "filesync",
+		Short:  "Serves the workspace side of kled workspace sync",
+		Hidden: true,
+	}
+	fileSyncCmd.PersistentFlags().StringVar(&cmd.Path, "path", "", "The folder to sync")
+	_ = fileSyncCmd.MarkPersistentFlagRequired("path")
+
+	scanCmd := &cobra.Command{
+		Use:   "scan",
+		Short: "Prints a snapshot of the folder",
+		Args:  cobra.NoArgs,
+		RunE: func(_ *cobra.Command, _ []string) error {
+			return cmd.Scan()
+		},
+	}
+	scanCmd.Flags().StringArrayVar(&cmd.Ignore, "ignore", []string{}, "Ignore pattern")
+	fileSyncCmd.AddCommand(scanCmd)
+	fileSyncCmd.AddCommand(&cobra.Command{
+		Use:   "export",
+		Short: "Writes the paths read from stdin as tar stream",
+		Args:  cobra.NoArgs,
+		RunE: func(_ *cobra.Command, _ []string) error {
+			paths, err := filesync.ReadPaths(os.Stdin)
+			if err != nil {
+				return err
+			}
+			return filesync.WriteArchive(os.Stdout, cmd.Path, paths)
+		},
+	})
+	fileSyncCmd.AddCommand(&cobra.Command{
+		Use:   "import",
+		Short: "Extracts the tar stream read from stdin",
+		Args:  cobra.NoArgs,
+		RunE: func(_ *cobra.Command, _ []string) error {
+			if err := os.MkdirAll(cmd.Path, 0o755); err != nil {
+				return err
+			}
+			return filesync.ExtractArchive(os.Stdin, cmd.Path)
+		},
+	})
+	fileSyncCmd.AddCommand(&cobra.Command{
+		Use:   "delete",
+		Short: "Deletes the paths read from stdin",
+		Args:  cobra.NoArgs,
+		RunE: func(_ *cobra.Command, _ []string) error {
+			paths, err := filesync.ReadPaths(os.Stdin)
+			if err != nil {
+				return err
+			}
+			return filesync.DeletePaths(cmd.Path, paths)
+		},
+	})
+	return fileSyncCmd
+}
+
+// Scan prints the snapshot of the folder. The snapshot is cached so
+// unchanged files are not hashed on every poll.
+func (cmd *FileSyncCmd) Scan() error {
+	if err := os.MkdirAll(cmd.Path, 0o755); err != nil {
+		return err
+	}
+
+	cachePath := scanCachePath(cmd.Path)
+	previous := filesync.Snapshot{}
+	if out, err := os.ReadFile(cachePath); err == nil {
+		_ = json.Unmarshal(out, &previous)
+	}
+
+	snapshot, err := filesync.Scan(cmd.Path, cmd.Ignore, previous)
+	if err != nil {
+		return err
+	}
+
+	out, err := json.Marshal(snapshot)
+	if err != nil {
+		return err
+	}
+	if cachePath != "" && os.MkdirAll(filepath.Dir(cachePath), 0o755) == nil {
+		_ = os.WriteFile(cachePath, out, 0o600)
+	}
+
+	_, err = os.Stdout.Write(out)
+	return err
+}
+
+func scanCachePath(path string) string {
+	cacheDir, err := os.UserCacheDir()
+	if err != nil {
+		return ""
+	}
+
+	hash := sha256.Sum256([]byte(path))
+	return filepath.Join(cacheDir, "kled", "filesync", hex.EncodeToString(hash[:])+".json")
+}
@@ -44,6 +44,7 @@ import (
 	provider2 "github.com/loft-sh/devpod/pkg/provider"
 	"github.com/loft-sh/devpod/pkg/single"
 	"github.com/loft-sh/devpod/pkg/ts"
+	"github.com/loft-sh/devpod/pkg/workspaceenv"
 	"github.com/loft-sh/log"
 	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
@@ -188,7 +189,8 @@ func (cmd *SetupContainerCmd) Run(ctx context.Context) error {
 	}
 
 	// setup container
-	err = setup.SetupContainer(ctx, setupInfo, workspaceInfo.CLIOptions.WorkspaceEnv, cmd.ChownWorkspace, &workspaceInfo.CLIOptions.Platform, tunnelClient, logger)
+	workspaceEnv := resolveWorkspaceEnv(setupInfo.SubstitutionContext.ContainerWorkspaceFolder, &workspaceInfo.CLIOptions, logger)
+	err = setup.SetupContainer(ctx, setupInfo, workspaceEnv, cmd.ChownWorkspace, &workspaceInfo.CLIOptions.Platform, tunnelClient, logger)
 	if err != nil {
 		return err
 	}
@@ -669,3 +671,46 @@ func (p *progressReader) Read(b []byte) (n int, err error) {
 
 	return n, err
 }
+
+// resolveWorkspaceEnv merges the project .env of the workspace folder into
+// the env variables resolved by kled up. It overrides the provider and
+// template variables and is overridden by --workspace-env and Vault secrets
+func resolveWorkspaceEnv(workspaceFolder string, options *provider2.CLIOptions, logger log.Logger) []string {
+	project := map[string]string{}
+	data, err := os.ReadFile(filepath.Join(workspaceFolder, workspaceenv.DotEnvFile))
+	if err == nil {
+		project, err = workspaceenv.ParseDotEnv(data)
+		if err != nil {
+			logger.Warnf("Skip %s of the project: %v", workspaceenv.DotEnvFile, err)
+			project = nil
+		}
+	} else if !os.IsNotExist(err) {
+		logger.Warnf("Skip %s of the project: %v", workspaceenv.DotEnvFile, err)
+	}
+
+	variables := workspaceenv.Resolve(
+		workspaceenv.Layer{Env: workspaceenv.FromList(options.WorkspaceEnvDefaults)},
+		workspaceenv.Layer{Env: project},
+		workspaceenv.Layer{Env: workspaceenv.FromList(options.WorkspaceEnv)},
+	)
+
+	// a LANG the image has no locale for, e.g. the one of the host, makes
+	// every shell warn
+	for i, variable := range variables {
+		if variable.Name != "LANG" {
+			continue
+		}
+
+		out, err := exec.Command("locale", "-a").Output()
+		if err != nil {
+			break
+		}
+		lang := workspaceenv.SupportedLocale(variable.Value, strings.Fields(string(out)))
+		if lang != variable.Value {
+			logger.Debugf("Locale %s isn't available in the workspace, using %s", variable.Value, lang)
+			variables[i].Value = lang
+		}
+	}
+
+	return workspaceenv.ToList(variables)
+}
@@ -0,0 +1,89 @@
+package workspace
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/loft-sh/devpod/cmd/flags"
+	"github.com/loft-sh/devpod/pkg/agent"
+	"github.com/loft-sh/devpod/pkg/driver/docker"
+	"github.com/loft-sh/devpod/pkg/volumecrypt"
+	"github.com/loft-sh/log"
+	"github.com/spf13/cobra"
+)
+
+// RotateVolumeKeysCmd holds the cmd flags
+type RotateVolumeKeysCmd struct {
+	*flags.GlobalFlags
+
+	ID        string
+	Rewrap    bool
+	RotateKEK bool
+}
+
+// NewRotateVolumeKeysCmd creates a new command
+func NewRotateVolumeKeysCmd(flags *flags.GlobalFlags) *cobra.Command {
+	cmd := &RotateVolumeKeysCmd{
+		GlobalFlags: flags,
+	}
+	c := &cobra.Command{
+		Use:   "rotate-volume-keys",
+		Short: "Rotates the keys of the encrypted volumes of the workspace",
+		Args:  cobra.NoArgs,
+		RunE: func(cobraCmd *cobra.Command, _ []string) error {
+			return cmd.Run(cobraCmd.Context())
+		},
+	}
+	c.Flags().StringVar(&cmd.ID, "id", "", "The workspace id")
+	c.Flags().BoolVar(&cmd.Rewrap, "rewrap", false, "Only rewrap the stored keys with the latest version of the Vault transit key")
+	c.Flags().BoolVar(&cmd.RotateKEK, "rotate-transit-key", false, "Rotate the Vault transit key before rewrapping the stored keys")
+	_ = c.MarkFlagRequired("id")
+
+	return c
+}
+
+func (cmd *RotateVolumeKeysCmd) Run(ctx context.Context) error {
+	// get workspace info
+	shouldExit, workspaceInfo, err := agent.ReadAgentWorkspaceInfo(cmd.AgentDir, cmd.Context, cmd.ID, log.Default.ErrorStreamOnly())
+	if err != nil {
+		return err
+	} else if shouldExit {
+		return nil
+	}
+
+	manager, err := docker.NewVolumeManager(workspaceInfo, log.Default)
+	if err != nil {
+		return err
+	} else if manager == nil {
+		return fmt.Errorf("the volumes of the workspace are not encrypted, set agent.docker.encryptVolumes in the provider to encrypt them")
+	}
+
+	if cmd.RotateKEK {
+		transit, ok := manager.Keys.(*volumecrypt.VaultTransit)
+		if !ok {
+			return fmt.Errorf("the volume keys are not wrapped with a Vault transit key")
+		}
+		err = transit.RotateKey(ctx)
+		if err != nil {
+			return err
+		}
+	}
+
+	names, err := manager.Volumes()
+	if err != nil {
+		return err
+	}
+	for _, name := range names {
+		if cmd.Rewrap || cmd.RotateKEK {
+			err = manager.Rewrap(ctx, name)
+		} else {
+			err = manager.Rotate(ctx, name)
+		}
+		if err != nil {
+			return fmt.Errorf("encrypted volume %s: %w", name, err)
+		}
+	}
+
+	log.Default.Donef("Rotated the keys of %d encrypted volumes", len(names))
+	return nil
+}
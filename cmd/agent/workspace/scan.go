@@ -0,0 +1,77 @@
+package workspace
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/loft-sh/devpod/cmd/flags"
+	"github.com/loft-sh/devpod/pkg/agent"
+	"github.com/loft-sh/devpod/pkg/imagescan"
+	"github.com/loft-sh/log"
+	"github.com/spf13/cobra"
+)
+
+// ScanCmd holds the cmd flags
+type ScanCmd struct {
+	*flags.GlobalFlags
+
+	ID     string
+	Rescan bool
+}
+
+// NewScanCmd creates a new command
+func NewScanCmd(flags *flags.GlobalFlags) *cobra.Command {
+	cmd := &ScanCmd{
+		GlobalFlags: flags,
+	}
+	c := &cobra.Command{
+		Use:   "scan",
+		Short: "Prints the vulnerability report of the workspace image",
+		Args:  cobra.NoArgs,
+		RunE: func(cobraCmd *cobra.Command, _ []string) error {
+			return cmd.Run(cobraCmd.Context())
+		},
+	}
+	c.Flags().StringVar(&cmd.ID, "id", "", "The workspace id")
+	c.Flags().BoolVar(&cmd.Rescan, "rescan", false, "Scan the image again instead of printing the last report")
+	_ = c.MarkFlagRequired("id")
+
+	return c
+}
+
+func (cmd *ScanCmd) Run(ctx context.Context) error {
+	// get workspace info
+	shouldExit, workspaceInfo, err := agent.ReadAgentWorkspaceInfo(cmd.AgentDir, cmd.Context, cmd.ID, log.Default.ErrorStreamOnly())
+	if err != nil {
+		return err
+	} else if shouldExit {
+		return nil
+	}
+
+	report, err := imagescan.LoadReport(workspaceInfo.Origin)
+	if err != nil {
+		return err
+	} else if report == nil {
+		return fmt.Errorf("the workspace image was not scanned yet, enable scanning with 'kled context set-options -o IMAGE_SCAN=warn' and rebuild the workspace")
+	}
+
+	if cmd.Rescan {
+		options := workspaceInfo.ImageScan
+		if options.Severity == "" {
+			options.Severity = report.Threshold
+		}
+
+		report, err = imagescan.Scan(ctx, report.Image, options)
+		if err != nil {
+			return err
+		}
+		err = imagescan.SaveReport(workspaceInfo.Origin, report)
+		if err != nil {
+			return err
+		}
+	}
+
+	return json.NewEncoder(os.Stdout).Encode(report)
+}
@@ -16,6 +16,7 @@ import (
 	"github.com/loft-sh/devpod/pkg/binaries"
 	"github.com/loft-sh/devpod/pkg/client/clientimplementation"
 	"github.com/loft-sh/devpod/pkg/command"
+	"github.com/loft-sh/devpod/pkg/contentstore"
 	"github.com/loft-sh/devpod/pkg/credentials"
 	agentdaemon "github.com/loft-sh/devpod/pkg/daemon/agent"
 	"github.com/loft-sh/devpod/pkg/devcontainer"
@@ -131,6 +132,8 @@ func (cmd *UpCmd) kledUp(ctx context.Context, workspaceInfo *provider2.AgentWork
 	result, err := runner.Up(ctx, devcontainer.UpOptions{
 		CLIOptions:    workspaceInfo.CLIOptions,
 		RegistryCache: workspaceInfo.RegistryCache,
+		ImageScan:     workspaceInfo.ImageScan,
+		Policy:        workspaceInfo.DevContainerPolicy,
 	}, workspaceInfo.InjectTimeout)
 	if err != nil {
 		return nil, err
@@ -140,6 +143,17 @@ func (cmd *UpCmd) kledUp(ctx context.Context, workspaceInfo *provider2.AgentWork
 }
 
 func CreateRunner(workspaceInfo *provider2.AgentWorkspaceInfo, log log.Logger) (devcontainer.Runner, error) {
+	// images and features are resolved from the content store of this machine
+	if workspaceInfo.Offline {
+		_ = os.Setenv(contentstore.OfflineEnv, "true")
+	}
+
+	// outbound connections, including image pulls, use the proxy and CA bundle of the context
+	err := workspaceInfo.Outbound.Apply()
+	if err != nil {
+		log.Warnf("Error applying proxy configuration: %v", err)
+	}
+
 	return devcontainer.NewRunner(agent.ContainerKledHelperLocation, agent.DefaultAgentDownloadURL(), workspaceInfo, log)
 }
 
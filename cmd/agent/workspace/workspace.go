@@ -22,5 +22,7 @@ func NewWorkspaceCmd(flags *flags.GlobalFlags) *cobra.Command {
 	workspaceCmd.AddCommand(NewInstallDotfilesCmd(flags))
 	workspaceCmd.AddCommand(NewSetupGPGCmd(flags))
 	workspaceCmd.AddCommand(NewLogsCmd(flags))
+	workspaceCmd.AddCommand(NewScanCmd(flags))
+	workspaceCmd.AddCommand(NewRotateVolumeKeysCmd(flags))
 	return workspaceCmd
 }
@@ -0,0 +1,114 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/docker/go-units"
+	"github.com/loft-sh/devpod/cmd/flags"
+	"github.com/loft-sh/devpod/pkg/sdk"
+	"github.com/loft-sh/devpod/pkg/sso"
+	"github.com/loft-sh/log"
+	"github.com/loft-sh/log/table"
+	"github.com/spf13/cobra"
+)
+
+// ArtifactsListCmd holds the artifacts list cmd flags
+type ArtifactsListCmd struct {
+	*flags.GlobalFlags
+
+	Server  string
+	APIKey  string
+	Project string
+	RunID   string
+	Output  string
+}
+
+// NewArtifactsCmd creates a new command
+func NewArtifactsCmd(flags *flags.GlobalFlags) *cobra.Command {
+	artifactsCmd := &cobra.Command{
+		Use:   "artifacts",
+		Short: "Manage the artifacts of agent runs",
+	}
+
+	cmd := &ArtifactsListCmd{
+		GlobalFlags: flags,
+	}
+	listCmd := &cobra.Command{
+		Use:   "list",
+		Short: "Lists the artifacts of a run",
+		Long: `Lists the files an agent run registered as artifacts, with their size, SHA-256
+and a signed URL that downloads them without an API key until it expires.`,
+		Args: cobra.NoArgs,
+		RunE: func(cobraCmd *cobra.Command, args []string) error {
+			return cmd.Run(cobraCmd.Context())
+		},
+	}
+
+	listCmd.Flags().StringVar(&cmd.Server, "server", os.Getenv("KLED_SERVER_URL"), "The Kled server URL. You can also use KLED_SERVER_URL to set this")
+	listCmd.Flags().StringVar(&cmd.APIKey, "api-key", os.Getenv("KLED_API_KEY"), "The API key to authenticate with. You can also use KLED_API_KEY to set this")
+	listCmd.Flags().StringVar(&cmd.Project, "project", os.Getenv("KLED_PROJECT"), "The project of the run. You can also use KLED_PROJECT to set this")
+	listCmd.Flags().StringVar(&cmd.RunID, "run", "", "The ID of the run")
+	listCmd.Flags().StringVar(&cmd.Output, "output", "plain", "The output format to use. Can be json or plain")
+	_ = listCmd.MarkFlagRequired("run")
+
+	artifactsCmd.AddCommand(listCmd)
+	return artifactsCmd
+}
+
+// Run runs the command logic
+func (cmd *ArtifactsListCmd) Run(ctx context.Context) error {
+	if cmd.Server == "" {
+		return fmt.Errorf("no server specified, use --server or KLED_SERVER_URL")
+	}
+	if cmd.Output != "plain" && cmd.Output != "json" {
+		return fmt.Errorf("unexpected output format, choose either json or plain. Got %s", cmd.Output)
+	}
+
+	client, err := sdk.New(sdk.Options{Server: cmd.Server, APIKey: cmd.APIKey, Project: cmd.Project, HTTPClient: sso.HTTPClient(cmd.Server)})
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+	artifacts, err := client.Artifacts.List(ctx, cmd.RunID)
+	if sdk.IsNotFound(err) {
+		return fmt.Errorf("run %s not found", cmd.RunID)
+	} else if err != nil {
+		return err
+	}
+
+	if cmd.Output == "json" {
+		out, err := json.Marshal(artifacts)
+		if err != nil {
+			return err
+		}
+		fmt.Print(string(out))
+		return nil
+	}
+
+	tableEntries := [][]string{}
+	for _, artifact := range artifacts {
+		tableEntries = append(tableEntries, []string{
+			artifact.Name,
+			units.HumanSize(float64(artifact.Size)),
+			artifact.SHA256,
+			artifact.CreatedAt.Local().Format(time.RFC3339),
+			artifact.DownloadURL,
+		})
+	}
+
+	table.PrintTable(log.Default, []string{
+		"Name",
+		"Size",
+		"SHA-256",
+		"Created",
+		"URL",
+	}, tableEntries)
+	return nil
+}
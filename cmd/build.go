@@ -11,6 +11,7 @@ import (
 	"github.com/loft-sh/devpod/pkg/agent/tunnelserver"
 	"github.com/loft-sh/devpod/pkg/client"
 	"github.com/loft-sh/devpod/pkg/config"
+	"github.com/loft-sh/devpod/pkg/devcontainer/build"
 	config2 "github.com/loft-sh/devpod/pkg/devcontainer/config"
 	"github.com/loft-sh/devpod/pkg/image"
 	"github.com/loft-sh/devpod/pkg/provider"
@@ -62,6 +63,16 @@ func NewBuildCmd(flags *flags.GlobalFlags) *cobra.Command {
 				}
 			}
 
+			// resolve build cache backends
+			cmd.CacheFrom, err = build.NormalizeCacheOptions(cmd.CacheFrom, false)
+			if err != nil {
+				return fmt.Errorf("cache from: %w", err)
+			}
+			cmd.CacheTo, err = build.NormalizeCacheOptions(cmd.CacheTo, true)
+			if err != nil {
+				return fmt.Errorf("cache to: %w", err)
+			}
+
 			if devPodConfig.ContextOption(config.ContextOptionSSHStrictHostKeyChecking) == "true" {
 				cmd.StrictHostKeyChecking = true
 			}
@@ -127,6 +138,8 @@ func NewBuildCmd(flags *flags.GlobalFlags) *cobra.Command {
 	buildCmd.Flags().StringVar(&cmd.Repository, "repository", "", "The repository to push to")
 	buildCmd.Flags().StringSliceVar(&cmd.Tag, "tag", []string{}, "Image Tag(s) in the form of a comma separated list --tag latest,arm64 or multiple flags --tag latest --tag arm64")
 	buildCmd.Flags().StringSliceVar(&cmd.Platforms, "platform", []string{}, "Set target platform for build")
+	buildCmd.Flags().StringArrayVar(&cmd.CacheFrom, "cache-from", []string{}, "Import build cache from a registry or a local directory, e.g. --cache-from ghcr.io/my-org/cache or --cache-from type=local,src=.cache")
+	buildCmd.Flags().StringArrayVar(&cmd.CacheTo, "cache-to", []string{}, "Export build cache to a registry or a local directory, e.g. --cache-to ghcr.io/my-org/cache or --cache-to type=local,dest=.cache")
 	buildCmd.Flags().BoolVar(&cmd.SkipPush, "skip-push", false, "If true will not push the image to the repository, useful for testing")
 	buildCmd.Flags().Var(&cmd.GitCloneStrategy, "git-clone-strategy", "The git clone strategy Kled uses to checkout git based workspaces. Can be full (default), blobless, treeless or shallow")
 	buildCmd.Flags().BoolVar(&cmd.GitCloneRecursiveSubmodules, "git-clone-recursive-submodules", false, "If true will clone git submodule repositories recursively")
@@ -0,0 +1,110 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/loft-sh/devpod/cmd/flags"
+	client2 "github.com/loft-sh/devpod/pkg/client"
+	"github.com/loft-sh/devpod/pkg/config"
+	provider2 "github.com/loft-sh/devpod/pkg/provider"
+	workspace2 "github.com/loft-sh/devpod/pkg/workspace"
+	"github.com/loft-sh/devpod/pkg/workspacestate"
+	"github.com/loft-sh/log"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/pflag"
+)
+
+// bulkExcerptLines is the number of log lines shown for a failed workspace
+const bulkExcerptLines = 10
+
+// BulkOptions are the flags of commands that can operate on many workspaces
+type BulkOptions struct {
+	All      bool
+	Selector string
+	Parallel int
+}
+
+func (o *BulkOptions) addFlags(flags *pflag.FlagSet, verb string) {
+	flags.BoolVar(&o.All, "all", false, fmt.Sprintf("If true will %s all workspaces", verb))
+	flags.StringVarP(&o.Selector, "selector", "l", "", fmt.Sprintf("Label selector of the workspaces to %s, e.g. team=ml,env!=prod", verb))
+	flags.IntVar(&o.Parallel, "parallel", 4, "The number of workspaces to operate on at the same time")
+}
+
+// enabled returns if the command should operate on many workspaces
+func (o *BulkOptions) enabled(args []string) bool {
+	return o.All || o.Selector != "" || len(args) > 1
+}
+
+// bulkOperation describes an operation for the progress output, e.g.
+// stop, Stopping and stopped
+type bulkOperation struct {
+	Verb      string
+	Progress  string
+	PastTense string
+
+	// Run runs the operation for a single workspace
+	Run func(ctx context.Context, client client2.BaseWorkspaceClient, log log.Logger) error
+}
+
+// runBulk runs the operation for all selected workspaces concurrently. The
+// log of every workspace is captured and only shown when it failed. Returns
+// an error listing the failed workspaces if any failed.
+func runBulk(ctx context.Context, kledConfig *config.Config, globalFlags *flags.GlobalFlags, options BulkOptions, args []string, operation bulkOperation) error {
+	workspaces, err := workspace2.List(ctx, kledConfig, false, globalFlags.Owner, log.Default.ErrorStreamOnly())
+	if err != nil {
+		return fmt.Errorf("list workspaces: %w", err)
+	}
+
+	selected, err := workspace2.Select(workspaces, args, options.All, options.Selector)
+	if err != nil {
+		return err
+	} else if len(selected) == 0 {
+		log.Default.Info("No workspaces matched")
+		return nil
+	}
+
+	// buffers is only written before the workspaces are started
+	buffers := map[string]*workspacestate.LogBuffer{}
+	for _, workspace := range selected {
+		buffers[workspace.ID] = workspacestate.NewLogBuffer(bulkExcerptLines)
+	}
+
+	log.Default.Infof("%s %d workspace(s) with up to %d in parallel", operation.Progress, len(selected), options.Parallel)
+	results := workspace2.RunParallel(ctx, selected, options.Parallel, func(ctx context.Context, workspace *provider2.Workspace) error {
+		buffer := buffers[workspace.ID]
+		logger := log.NewStreamLogger(buffer, buffer, logrus.InfoLevel)
+
+		client, err := workspace2.Get(ctx, kledConfig, []string{workspace.ID}, false, globalFlags.Owner, logger)
+		if err != nil {
+			return err
+		}
+
+		return operation.Run(ctx, client, logger)
+	}, func(result workspace2.BulkResult, done, total int) {
+		if result.Err == nil {
+			log.Default.Donef("[%d/%d] Workspace %s %s in %s", done, total, result.Workspace.ID, operation.PastTense, result.Duration.Round(time.Second))
+			return
+		}
+
+		log.Default.Errorf("[%d/%d] Failed to %s workspace %s: %v", done, total, operation.Verb, result.Workspace.ID, result.Err)
+		for _, line := range buffers[result.Workspace.ID].Lines() {
+			log.Default.Info("    " + line)
+		}
+	})
+
+	failed := workspace2.FailedResults(results)
+	if len(failed) > 0 {
+		ids := []string{}
+		for _, result := range failed {
+			ids = append(ids, result.Workspace.ID)
+		}
+
+		return fmt.Errorf("failed to %s %d of %d workspace(s): %s", operation.Verb, len(failed), len(results), strings.Join(ids, ", "))
+	}
+
+	log.Default.Donef("Successfully %s %d workspace(s)", operation.PastTense, len(results))
+	return nil
+}
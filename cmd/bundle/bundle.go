@@ -0,0 +1,23 @@
+package bundle
+
+import (
+	"github.com/loft-sh/devpod/cmd/flags"
+	"github.com/spf13/cobra"
+)
+
+// NewBundleCmd returns a new command
+func NewBundleCmd(flags *flags.GlobalFlags) *cobra.Command {
+	bundleCmd := &cobra.Command{
+		Use:   "bundle",
+		Short: "Kled offline content bundle commands",
+		Long: `Bundles carry images, features and templates to machines without network access.
+Export a bundle on a connected machine, import it on the air-gapped machine and
+enable offline mode with:
+kled context set-options -o OFFLINE=true`,
+	}
+
+	bundleCmd.AddCommand(NewExportCmd(flags))
+	bundleCmd.AddCommand(NewImportCmd(flags))
+	bundleCmd.AddCommand(NewListCmd(flags))
+	return bundleCmd
+}
@@ -0,0 +1,114 @@
+package bundle
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"runtime"
+
+	"github.com/loft-sh/devpod/cmd/flags"
+	"github.com/loft-sh/devpod/pkg/contentstore"
+	"github.com/loft-sh/devpod/pkg/devcontainer/feature"
+	"github.com/loft-sh/devpod/pkg/image"
+	"github.com/loft-sh/devpod/pkg/workspacetemplate"
+	"github.com/loft-sh/log"
+	"github.com/spf13/cobra"
+)
+
+// ExportCmd holds the export cmd flags
+type ExportCmd struct {
+	flags.GlobalFlags
+
+	Output    string
+	Images    []string
+	Features  []string
+	Templates []string
+	Arch      string
+}
+
+// NewExportCmd creates a new command
+func NewExportCmd(flags *flags.GlobalFlags) *cobra.Command {
+	cmd := &ExportCmd{
+		GlobalFlags: *flags,
+	}
+	exportCmd := &cobra.Command{
+		Use:   "export",
+		Short: "Export images, features and templates into a portable bundle",
+		Example: `kled bundle export -o gpu.tar.gz \
+  --image nvcr.io/nvidia/pytorch:24.05-py3 \
+  --feature ghcr.io/devcontainers/features/python:1 \
+  --template oci://ghcr.io/my-org/templates/pytorch-cuda12:1.0`,
+		Args: cobra.NoArgs,
+		RunE: func(cobraCmd *cobra.Command, args []string) error {
+			return cmd.Run(cobraCmd.Context())
+		},
+	}
+
+	exportCmd.Flags().StringVarP(&cmd.Output, "output", "o", "kled-bundle.tar.gz", "The file to write the bundle to")
+	exportCmd.Flags().StringArrayVar(&cmd.Images, "image", []string{}, "An image to add to the bundle")
+	exportCmd.Flags().StringArrayVar(&cmd.Features, "feature", []string{}, "A devcontainer feature to add to the bundle, either an OCI reference or a tarball url")
+	exportCmd.Flags().StringArrayVar(&cmd.Templates, "template", []string{}, "A workspace template source to add to the bundle")
+	exportCmd.Flags().StringVar(&cmd.Arch, "arch", runtime.GOARCH, "The architecture of the machines the bundle is imported on")
+	return exportCmd
+}
+
+// Run runs the command logic
+func (cmd *ExportCmd) Run(ctx context.Context) error {
+	if len(cmd.Images) == 0 && len(cmd.Features) == 0 && len(cmd.Templates) == 0 {
+		return fmt.Errorf("please specify at least one --image, --feature or --template")
+	} else if contentstore.Offline() {
+		return fmt.Errorf("cannot export a bundle in offline mode")
+	}
+
+	tempDir, err := os.MkdirTemp("", "kled-bundle-*")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tempDir)
+
+	store, err := contentstore.Open(tempDir)
+	if err != nil {
+		return err
+	}
+
+	for _, ref := range cmd.Images {
+		log.Default.Infof("Export image %s", ref)
+		img, err := image.GetImageForArch(ctx, ref, cmd.Arch)
+		if err != nil {
+			return err
+		}
+
+		err = store.AddImage(ref, img)
+		if err != nil {
+			return err
+		}
+	}
+	for _, id := range cmd.Features {
+		log.Default.Infof("Export feature %s", id)
+		err = feature.Export(id, store, nil, log.Default)
+		if err != nil {
+			return fmt.Errorf("export feature %s: %w", id, err)
+		}
+	}
+	for _, source := range cmd.Templates {
+		log.Default.Infof("Export template %s", source)
+		err = workspacetemplate.Export(ctx, source, store, log.Default)
+		if err != nil {
+			return fmt.Errorf("export template %s: %w", source, err)
+		}
+	}
+
+	file, err := os.Create(cmd.Output)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	err = store.WriteBundle(file)
+	if err != nil {
+		return err
+	}
+
+	log.Default.Donef("Exported bundle to %s", cmd.Output)
+	return nil
+}
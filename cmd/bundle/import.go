@@ -0,0 +1,55 @@
+package bundle
+
+import (
+	"context"
+	"os"
+
+	"github.com/loft-sh/devpod/cmd/flags"
+	"github.com/loft-sh/devpod/pkg/contentstore"
+	"github.com/loft-sh/log"
+	"github.com/spf13/cobra"
+)
+
+// ImportCmd holds the import cmd flags
+type ImportCmd struct {
+	flags.GlobalFlags
+}
+
+// NewImportCmd creates a new command
+func NewImportCmd(flags *flags.GlobalFlags) *cobra.Command {
+	cmd := &ImportCmd{
+		GlobalFlags: *flags,
+	}
+	importCmd := &cobra.Command{
+		Use:   "import [bundle]",
+		Short: "Import a bundle into the local content store",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cobraCmd *cobra.Command, args []string) error {
+			return cmd.Run(cobraCmd.Context(), args[0])
+		},
+	}
+
+	return importCmd
+}
+
+// Run runs the command logic
+func (cmd *ImportCmd) Run(ctx context.Context, path string) error {
+	store, err := contentstore.Default()
+	if err != nil {
+		return err
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	err = store.ImportBundle(file)
+	if err != nil {
+		return err
+	}
+
+	log.Default.Donef("Imported bundle %s into %s", path, store.Dir)
+	return nil
+}
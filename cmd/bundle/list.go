@@ -0,0 +1,91 @@
+package bundle
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/loft-sh/devpod/cmd/flags"
+	"github.com/loft-sh/devpod/pkg/contentstore"
+	"github.com/loft-sh/log"
+	"github.com/loft-sh/log/table"
+	"github.com/spf13/cobra"
+)
+
+// ListCmd holds the list cmd flags
+type ListCmd struct {
+	flags.GlobalFlags
+
+	Output string
+}
+
+// NewListCmd creates a new command
+func NewListCmd(flags *flags.GlobalFlags) *cobra.Command {
+	cmd := &ListCmd{
+		GlobalFlags: *flags,
+	}
+	listCmd := &cobra.Command{
+		Use:     "list",
+		Aliases: []string{"ls"},
+		Short:   "List the content of the local content store",
+		Args:    cobra.NoArgs,
+		RunE: func(cobraCmd *cobra.Command, args []string) error {
+			return cmd.Run(cobraCmd.Context())
+		},
+	}
+
+	listCmd.Flags().StringVar(&cmd.Output, "output", "plain", "The output format to use. Can be json or plain")
+	return listCmd
+}
+
+type contentEntry struct {
+	Source string `json:"source"`
+	Type   string `json:"type"`
+}
+
+// Run runs the command logic
+func (cmd *ListCmd) Run(ctx context.Context) error {
+	store, err := contentstore.Default()
+	if err != nil {
+		return err
+	}
+
+	images, err := store.Images()
+	if err != nil {
+		return err
+	}
+	files, err := store.Files()
+	if err != nil {
+		return err
+	}
+
+	entries := []contentEntry{}
+	for _, ref := range images {
+		entries = append(entries, contentEntry{Source: ref, Type: "oci"})
+	}
+	for _, source := range files {
+		entries = append(entries, contentEntry{Source: source, Type: "archive"})
+	}
+
+	if cmd.Output == "plain" {
+		tableEntries := [][]string{}
+		for _, entry := range entries {
+			tableEntries = append(tableEntries, []string{entry.Source, entry.Type})
+		}
+
+		table.PrintTable(log.Default, []string{
+			"Source",
+			"Type",
+		}, tableEntries)
+	} else if cmd.Output == "json" {
+		out, err := json.MarshalIndent(entries, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Print(string(out))
+	} else {
+		return fmt.Errorf("unexpected output format, choose either json or plain. Got %s", cmd.Output)
+	}
+
+	return nil
+}
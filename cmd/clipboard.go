@@ -0,0 +1,129 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/atotto/clipboard"
+	"github.com/loft-sh/devpod/cmd/flags"
+	"github.com/loft-sh/devpod/pkg/agent/control"
+	"github.com/loft-sh/devpod/pkg/config"
+	workspace2 "github.com/loft-sh/devpod/pkg/workspace"
+	"github.com/loft-sh/log"
+	"github.com/spf13/cobra"
+)
+
+// ClipboardCmd holds the clipboard cmd flags
+type ClipboardCmd struct {
+	*flags.GlobalFlags
+
+	// Pipe reads from stdin and writes to stdout instead of the local
+	// clipboard
+	Pipe bool
+}
+
+// NewClipboardCmd creates a new command
+func NewClipboardCmd(flags *flags.GlobalFlags) *cobra.Command {
+	cmd := &ClipboardCmd{
+		GlobalFlags: flags,
+	}
+	clipboardCmd := &cobra.Command{
+		Use:   "clipboard",
+		Short: "Shares the clipboard between the local machine and a workspace",
+		Long: `Copies the clipboard between the local machine and a workspace over the
+control channel of the workspace agent.
+
+  kled clipboard copy my-workspace
+  kled clipboard paste my-workspace
+
+In the workspace the clipboard of its display is used if it runs one with
+wl-copy, xclip or xsel installed, otherwise the file ~/` + control.ClipboardFile + `.`,
+	}
+
+	copyCmd := &cobra.Command{
+		Use:   "copy [flags] WORKSPACE",
+		Short: "Copies the local clipboard to the clipboard of a workspace",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cobraCmd *cobra.Command, args []string) error {
+			return cmd.Copy(cobraCmd.Context(), args[0])
+		},
+	}
+	copyCmd.Flags().BoolVar(&cmd.Pipe, "stdin", false, "If true, copies stdin instead of the local clipboard")
+
+	pasteCmd := &cobra.Command{
+		Use:   "paste [flags] WORKSPACE",
+		Short: "Copies the clipboard of a workspace to the local clipboard",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cobraCmd *cobra.Command, args []string) error {
+			return cmd.Paste(cobraCmd.Context(), args[0])
+		},
+	}
+	pasteCmd.Flags().BoolVar(&cmd.Pipe, "stdout", false, "If true, prints the clipboard of the workspace instead of copying it to the local clipboard")
+
+	clipboardCmd.AddCommand(copyCmd)
+	clipboardCmd.AddCommand(pasteCmd)
+	return clipboardCmd
+}
+
+// Copy sets the clipboard of the workspace to the local clipboard
+func (cmd *ClipboardCmd) Copy(ctx context.Context, workspaceName string) error {
+	var content []byte
+	var err error
+	if cmd.Pipe {
+		content, err = io.ReadAll(os.Stdin)
+	} else {
+		var text string
+		text, err = clipboard.ReadAll()
+		content = []byte(text)
+	}
+	if err != nil {
+		return fmt.Errorf("read local clipboard: %w", err)
+	}
+
+	return cmd.run(ctx, workspaceName, func(ctx context.Context, client control.ControlClient) error {
+		return control.WriteClipboard(ctx, client, content)
+	})
+}
+
+// Paste sets the local clipboard to the clipboard of the workspace
+func (cmd *ClipboardCmd) Paste(ctx context.Context, workspaceName string) error {
+	var content []byte
+	err := cmd.run(ctx, workspaceName, func(ctx context.Context, client control.ControlClient) error {
+		var err error
+		content, err = control.ReadClipboard(ctx, client)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	if cmd.Pipe {
+		_, err = io.Copy(os.Stdout, bytes.NewReader(content))
+		return err
+	}
+	err = clipboard.WriteAll(string(content))
+	if err != nil {
+		return fmt.Errorf("write local clipboard: %w", err)
+	}
+
+	return nil
+}
+
+func (cmd *ClipboardCmd) run(ctx context.Context, workspaceName string, clipboardFunc func(context.Context, control.ControlClient) error) error {
+	kledConfig, err := config.LoadConfig(cmd.Context, cmd.Provider)
+	if err != nil {
+		return err
+	}
+	client, err := workspace2.Get(ctx, kledConfig, []string{workspaceName}, false, cmd.Owner, log.Default.ErrorStreamOnly())
+	if err != nil {
+		return err
+	}
+	workdir, _ := workspaceFolder(client)
+
+	return runCopy(ctx, client, workdir, &copyProgress{}, func(ctx context.Context, copier *control.Copier) error {
+		return clipboardFunc(ctx, copier.Client)
+	})
+}
@@ -0,0 +1,68 @@
+package completion
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+)
+
+// NewCompletionCmd creates a new command that generates shell completion
+// scripts from the command tree it is added to.
+func NewCompletionCmd() *cobra.Command {
+	completionCmd := &cobra.Command{
+		Use:   "completion bash|zsh|fish|powershell",
+		Short: "Generates the shell completion script",
+		Long: `Generates the completion script for the given shell.
+
+Bash:
+  $ source <(kled completion bash)
+
+  # To load completions for each session, execute once:
+  # Linux:
+  $ kled completion bash > /etc/bash_completion.d/kled
+  # macOS:
+  $ kled completion bash > $(brew --prefix)/etc/bash_completion.d/kled
+
+Zsh:
+  # If shell completion is not already enabled in your environment,
+  # you will need to enable it. You can execute the following once:
+  $ echo "autoload -U compinit; compinit" >> ~/.zshrc
+
+  # To load completions for each session, execute once:
+  $ kled completion zsh > "${fpath[1]}/_kled"
+
+Fish:
+  $ kled completion fish | source
+
+  # To load completions for each session, execute once:
+  $ kled completion fish > ~/.config/fish/completions/kled.fish
+
+PowerShell:
+  PS> kled completion powershell | Out-String | Invoke-Expression
+
+  # To load completions for every new session, add the output of the above
+  # command to your PowerShell profile.
+`,
+		DisableFlagsInUseLine: true,
+		ValidArgs:             []string{"bash", "zsh", "fish", "powershell"},
+		Args:                  cobra.MatchAll(cobra.ExactArgs(1), cobra.OnlyValidArgs),
+		RunE: func(cobraCmd *cobra.Command, args []string) error {
+			root := cobraCmd.Root()
+			switch args[0] {
+			case "bash":
+				return root.GenBashCompletionV2(os.Stdout, true)
+			case "zsh":
+				return root.GenZshCompletion(os.Stdout)
+			case "fish":
+				return root.GenFishCompletion(os.Stdout, true)
+			case "powershell":
+				return root.GenPowerShellCompletionWithDesc(os.Stdout)
+			}
+
+			return fmt.Errorf("unsupported shell %s", args[0])
+		},
+	}
+
+	return completionCmd
+}
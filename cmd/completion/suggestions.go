@@ -83,3 +83,40 @@ func GetContextSuggestions(rootCmd *cobra.Command, context, provider string, arg
 
 	return suggestions, cobra.ShellCompDirectiveNoFileComp
 }
+
+// GetProviderOptionSuggestions suggests KEY= for every option of the provider
+// the workspace would be created with, and the enum values once a key is typed.
+func GetProviderOptionSuggestions(rootCmd *cobra.Command, context, provider string, args []string, toComplete string, owner platform.OwnerFilter, logger log.Logger) ([]string, cobra.ShellCompDirective) {
+	devPodConfig, err := config.LoadConfig(context, provider)
+	if err != nil {
+		return nil, cobra.ShellCompDirectiveError
+	}
+
+	defaultProvider, _, err := workspace.LoadProviders(devPodConfig, log.Default.ErrorStreamOnly())
+	if err != nil {
+		return nil, cobra.ShellCompDirectiveError
+	}
+
+	var suggestions []string
+	if key, value, found := strings.Cut(toComplete, "="); found {
+		option := defaultProvider.Config.Options[key]
+		if option == nil {
+			return nil, cobra.ShellCompDirectiveNoFileComp
+		}
+
+		for _, enum := range option.Enum {
+			if strings.HasPrefix(enum.Value, value) {
+				suggestions = append(suggestions, key+"="+enum.Value)
+			}
+		}
+		return suggestions, cobra.ShellCompDirectiveNoFileComp
+	}
+
+	for name, option := range defaultProvider.Config.Options {
+		if option.Hidden || !strings.HasPrefix(name, toComplete) {
+			continue
+		}
+		suggestions = append(suggestions, name+"=\t"+option.Description)
+	}
+	return suggestions, cobra.ShellCompDirectiveNoFileComp | cobra.ShellCompDirectiveNoSpace
+}
@@ -0,0 +1,100 @@
+package completion
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/loft-sh/devpod/pkg/config"
+	"github.com/loft-sh/devpod/pkg/platform"
+	providerpkg "github.com/loft-sh/devpod/pkg/provider"
+	"github.com/loft-sh/devpod/pkg/types"
+	"github.com/loft-sh/log"
+	"github.com/spf13/cobra"
+)
+
+func TestGetProviderOptionSuggestions(t *testing.T) {
+	t.Setenv(config.KLED_HOME, t.TempDir())
+	kledConfig, err := config.LoadConfig("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	kledConfig.Current().DefaultProvider = "aws"
+	kledConfig.Current().Providers["aws"] = &config.ProviderConfig{Initialized: true}
+	if err := config.SaveConfig(kledConfig); err != nil {
+		t.Fatal(err)
+	}
+	err = providerpkg.SaveProviderConfig(kledConfig.DefaultContext, &providerpkg.ProviderConfig{
+		Name: "aws",
+		Exec: providerpkg.ProviderCommands{Command: types.StrArray{"true"}},
+		Options: map[string]*types.Option{
+			"AWS_REGION": {
+				Description: "The region to create machines in",
+				Enum:        types.OptionEnumArray{{Value: "us-east-1"}, {Value: "us-west-2"}, {Value: "eu-west-1"}},
+			},
+			"AWS_DISK_SIZE": {Description: "The disk size in GB"},
+			"AWS_TOKEN":     {Description: "An internal token", Hidden: true},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name          string
+		toComplete    string
+		want          []string
+		wantDirective cobra.ShellCompDirective
+	}{
+		{
+			name:          "all keys",
+			want:          []string{"AWS_DISK_SIZE=\tThe disk size in GB", "AWS_REGION=\tThe region to create machines in"},
+			wantDirective: cobra.ShellCompDirectiveNoFileComp | cobra.ShellCompDirectiveNoSpace,
+		},
+		{
+			name:          "key prefix",
+			toComplete:    "AWS_R",
+			want:          []string{"AWS_REGION=\tThe region to create machines in"},
+			wantDirective: cobra.ShellCompDirectiveNoFileComp | cobra.ShellCompDirectiveNoSpace,
+		},
+		{
+			name:          "hidden key",
+			toComplete:    "AWS_T",
+			wantDirective: cobra.ShellCompDirectiveNoFileComp | cobra.ShellCompDirectiveNoSpace,
+		},
+		{
+			name:          "all enum values",
+			toComplete:    "AWS_REGION=",
+			want:          []string{"AWS_REGION=eu-west-1", "AWS_REGION=us-east-1", "AWS_REGION=us-west-2"},
+			wantDirective: cobra.ShellCompDirectiveNoFileComp,
+		},
+		{
+			name:          "enum value prefix",
+			toComplete:    "AWS_REGION=us-",
+			want:          []string{"AWS_REGION=us-east-1", "AWS_REGION=us-west-2"},
+			wantDirective: cobra.ShellCompDirectiveNoFileComp,
+		},
+		{
+			name:          "option without enum",
+			toComplete:    "AWS_DISK_SIZE=4",
+			wantDirective: cobra.ShellCompDirectiveNoFileComp,
+		},
+		{
+			name:          "unknown option",
+			toComplete:    "GCLOUD_ZONE=",
+			wantDirective: cobra.ShellCompDirectiveNoFileComp,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, directive := GetProviderOptionSuggestions(&cobra.Command{}, "", "", nil, test.toComplete, platform.SelfOwnerFilter, log.Discard)
+			sort.Strings(got)
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("got %q, want %q", got, test.want)
+			}
+			if directive != test.wantDirective {
+				t.Errorf("got directive %d, want %d", directive, test.wantDirective)
+			}
+		})
+	}
+}
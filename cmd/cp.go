@@ -0,0 +1,262 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/alessio/shellescape"
+	"github.com/docker/go-units"
+	"github.com/loft-sh/devpod/cmd/flags"
+	"github.com/loft-sh/devpod/pkg/agent"
+	"github.com/loft-sh/devpod/pkg/agent/control"
+	client2 "github.com/loft-sh/devpod/pkg/client"
+	"github.com/loft-sh/devpod/pkg/config"
+	workspace2 "github.com/loft-sh/devpod/pkg/workspace"
+	"github.com/loft-sh/log"
+	"github.com/mattn/go-isatty"
+	"github.com/spf13/cobra"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// CpCmd holds the cp cmd flags
+type CpCmd struct {
+	*flags.GlobalFlags
+
+	Retries int
+	Quiet   bool
+}
+
+// NewCpCmd creates a new command
+func NewCpCmd(flags *flags.GlobalFlags) *cobra.Command {
+	cmd := &CpCmd{
+		GlobalFlags: flags,
+	}
+	cpCmd := &cobra.Command{
+		Use:   "cp [flags] SRC DEST",
+		Short: "Copies files between the local machine and a workspace",
+		Long: `Copies a file or folder between the local machine and a workspace.
+One of SRC and DEST is a path in a workspace written as WORKSPACE:PATH,
+relative paths in the workspace resolve against the workspace folder.
+
+  kled cp ./data my-workspace:data
+  kled cp my-workspace:/tmp/report.html .
+
+Modes and modification times are preserved and symlinks are skipped. An
+interrupted copy is resumed from where it stopped, by reconnecting up to
+--retries times or by running the same copy again. Use - as the local path
+to copy from stdin or to stdout.`,
+		Args: cobra.ExactArgs(2),
+		RunE: func(cobraCmd *cobra.Command, args []string) error {
+			return cmd.Run(cobraCmd.Context(), args[0], args[1])
+		},
+	}
+
+	cpCmd.Flags().IntVar(&cmd.Retries, "retries", 3, "How often to reconnect and resume if the connection is lost")
+	cpCmd.Flags().BoolVarP(&cmd.Quiet, "quiet", "q", false, "If true, doesn't print progress")
+	return cpCmd
+}
+
+// Run runs the command logic
+func (cmd *CpCmd) Run(ctx context.Context, src, dest string) error {
+	srcWorkspace, srcPath := splitCopyPath(src)
+	destWorkspace, destPath := splitCopyPath(dest)
+	if srcWorkspace != "" && destWorkspace != "" {
+		return fmt.Errorf("copying between workspaces is not supported, copy to the local machine first")
+	} else if srcWorkspace == "" && destWorkspace == "" {
+		return fmt.Errorf("either SRC or DEST needs to be a path in a workspace, e.g. my-workspace:/tmp")
+	}
+	workspaceName := srcWorkspace + destWorkspace
+
+	kledConfig, err := config.LoadConfig(cmd.Context, cmd.Provider)
+	if err != nil {
+		return err
+	}
+	client, err := workspace2.Get(ctx, kledConfig, []string{workspaceName}, false, cmd.Owner, log.Default.ErrorStreamOnly())
+	if err != nil {
+		return err
+	}
+	// relative paths resolve against the workspace folder if it's known
+	workdir, _ := workspaceFolder(client)
+
+	progress := cmd.progress(src, dest)
+	defer progress.Done()
+	copyFunc := func(ctx context.Context, copier *control.Copier) error {
+		switch {
+		case destWorkspace != "" && srcPath == "-":
+			return copier.UploadReader(ctx, os.Stdin, destPath)
+		case destWorkspace != "":
+			return copier.Upload(ctx, srcPath, destPath)
+		case destPath == "-":
+			return copier.DownloadWriter(ctx, srcPath, os.Stdout)
+		default:
+			return copier.Download(ctx, srcPath, destPath)
+		}
+	}
+
+	for attempt := 0; ; attempt++ {
+		err = runCopy(ctx, client, workdir, progress, copyFunc)
+		if err == nil || attempt >= cmd.Retries || !connectionLost(err) {
+			return err
+		}
+
+		log.Default.Warnf("Connection to workspace lost, resuming copy (%d/%d): %v", attempt+1, cmd.Retries, err)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(time.Second * time.Duration(attempt+1)):
+		}
+	}
+}
+
+func (cmd *CpCmd) progress(src, dest string) *copyProgress {
+	progress := &copyProgress{name: src + " -> " + dest}
+	if !cmd.Quiet && isatty.IsTerminal(os.Stderr.Fd()) {
+		progress.out = os.Stderr
+	}
+
+	return progress
+}
+
+// runCopy connects to the control channel of the workspace through kled ssh
+// and runs copyFunc with it. The control channel runs as the workspace user,
+// so copied files belong to them
+func runCopy(ctx context.Context, client client2.BaseWorkspaceClient, workdir string, progress control.Progress, copyFunc func(context.Context, *control.Copier) error) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	execPath, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	helperArgs := []string{agent.ContainerKledHelperLocation, "agent", "container", "control", "--workdir", workdir}
+	sshCmd := exec.CommandContext(ctx, execPath,
+		"ssh",
+		"--agent-forwarding=false",
+		"--start-services=false",
+		"--context", client.Context(),
+		client.Workspace(),
+		"--command", shellescape.QuoteCommand(helperArgs),
+	)
+	stderr := &bytes.Buffer{}
+	sshCmd.Stderr = stderr
+	stdin, err := sshCmd.StdinPipe()
+	if err != nil {
+		return err
+	}
+	stdout, err := sshCmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	err = sshCmd.Start()
+	if err != nil {
+		return fmt.Errorf("connect to workspace: %w", err)
+	}
+	defer func() {
+		_ = stdin.Close()
+		_ = sshCmd.Wait()
+	}()
+
+	controlClient, conn, err := control.DialStdio(stdout, stdin)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	err = copyFunc(ctx, &control.Copier{Client: controlClient, Progress: progress, Log: log.Default})
+	if err != nil && stderr.Len() > 0 && connectionLost(err) {
+		return fmt.Errorf("%w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+
+	return err
+}
+
+func connectionLost(err error) bool {
+	code := status.Code(err)
+	return code == codes.Unavailable || errors.Is(err, io.ErrUnexpectedEOF)
+}
+
+// splitCopyPath splits WORKSPACE:PATH, paths without a workspace and
+// Windows paths like C:\data are local
+func splitCopyPath(arg string) (string, string) {
+	workspace, path, ok := strings.Cut(arg, ":")
+	if !ok || workspace == "" || strings.ContainsAny(workspace, `/\`) {
+		return "", arg
+	}
+	if len(workspace) == 1 && (strings.HasPrefix(path, `\`) || strings.HasPrefix(path, "/")) {
+		return "", arg
+	}
+
+	return workspace, path
+}
+
+// copyProgress renders a progress bar of a copy, it renders nothing if out
+// is nil
+type copyProgress struct {
+	name string
+	out  io.Writer
+
+	m          sync.Mutex
+	total      int64
+	done       int64
+	started    time.Time
+	lastRender time.Time
+}
+
+func (p *copyProgress) Start(total int64) {
+	p.m.Lock()
+	defer p.m.Unlock()
+
+	p.total, p.done, p.started = total, 0, time.Now()
+	p.render(true)
+}
+
+func (p *copyProgress) Add(n int64) {
+	p.m.Lock()
+	defer p.m.Unlock()
+
+	p.done += n
+	p.render(false)
+}
+
+// Done renders the final state and ends the line of the progress bar
+func (p *copyProgress) Done() {
+	p.m.Lock()
+	defer p.m.Unlock()
+
+	if p.out == nil || p.started.IsZero() {
+		return
+	}
+	p.render(true)
+	_, _ = fmt.Fprintln(p.out)
+}
+
+func (p *copyProgress) render(force bool) {
+	if p.out == nil || (!force && time.Since(p.lastRender) < 100*time.Millisecond) {
+		return
+	}
+	p.lastRender = time.Now()
+
+	const width = 30
+	bar := strings.Repeat(" ", width)
+	percent := ""
+	if p.total > 0 {
+		filled := int(min(p.done, p.total) * width / p.total)
+		bar = strings.Repeat("=", filled) + strings.Repeat(" ", width-filled)
+		percent = fmt.Sprintf(" %3d%%", min(p.done, p.total)*100/p.total)
+	}
+	rate := ""
+	if elapsed := time.Since(p.started).Seconds(); elapsed > 0 {
+		rate = " " + units.HumanSize(float64(p.done)/elapsed) + "/s"
+	}
+
+	_, _ = fmt.Fprintf(p.out, "\r\033[K%s [%s]%s %s%s", p.name, bar, percent, units.HumanSize(float64(p.done)), rate)
+}
@@ -0,0 +1,238 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/loft-sh/devpod/cmd/flags"
+	"github.com/loft-sh/devpod/cmd/provider"
+	"github.com/loft-sh/devpod/pkg/config"
+	"github.com/loft-sh/devpod/pkg/copy"
+	"github.com/loft-sh/devpod/pkg/workspace"
+	"github.com/loft-sh/devpod/pkg/workspacetemplate"
+	"github.com/loft-sh/log"
+	"github.com/loft-sh/log/survey"
+	"github.com/loft-sh/log/terminal"
+	"github.com/spf13/cobra"
+)
+
+// NewCreateCmd creates a new command. It accepts the same flags as up, but
+// asks for the source and provider when they are missing and the session is
+// interactive, and can scaffold the workspace from a template.
+func NewCreateCmd(f *flags.GlobalFlags) *cobra.Command {
+	createCmd := NewUpCmd(f)
+	createCmd.Use = "create [flags] [workspace-path|workspace-name]"
+	createCmd.Short = "Creates a new workspace, asking for missing information"
+
+	templateName := ""
+	createCmd.Flags().StringVar(&templateName, "template", "", "The template to scaffold the workspace folder from. See 'kled template list'")
+
+	runUp := createCmd.RunE
+	createCmd.RunE = func(cobraCmd *cobra.Command, args []string) error {
+		var err error
+		if templateName != "" {
+			args, err = applyTemplate(cobraCmd, f, args, templateName, log.Default)
+			if err != nil {
+				return err
+			}
+		}
+
+		if terminal.IsTerminalIn {
+			args, err = promptCreate(cobraCmd, f, args, log.Default)
+			if err != nil {
+				return err
+			}
+		}
+
+		return runUp(cobraCmd, args)
+	}
+
+	return createCmd
+}
+
+// promptCreate asks for the values create cannot continue without. The
+// selected provider is configured through the provider's own option
+// definitions, so required options are asked for as well.
+func promptCreate(cobraCmd *cobra.Command, globalFlags *flags.GlobalFlags, args []string, logger log.Logger) ([]string, error) {
+	source, err := cobraCmd.Flags().GetString("source")
+	if err != nil {
+		return nil, err
+	}
+
+	if len(args) == 0 && source == "" {
+		answer, err := logger.Question(&survey.QuestionOptions{
+			Question:               "Enter a git repository, local folder or image to create the workspace from",
+			ValidationRegexPattern: `^\S+$`,
+			ValidationMessage:      "source must not be empty or contain spaces",
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		args = []string{answer}
+	}
+
+	kledConfig, err := config.LoadConfig(globalFlags.Context, globalFlags.Provider)
+	if err != nil {
+		return nil, err
+	}
+
+	providerName := kledConfig.Current().DefaultProvider
+	if providerName != "" {
+		return args, nil
+	}
+
+	providers, err := workspace.LoadAllProviders(kledConfig, logger.ErrorStreamOnly())
+	if err != nil {
+		return nil, err
+	} else if len(providers) == 0 {
+		return nil, fmt.Errorf("no provider found. Please add one via 'kled provider add'")
+	}
+
+	names := make([]string, 0, len(providers))
+	for name := range providers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	providerName, err = logger.Question(&survey.QuestionOptions{
+		Question:     "Select a provider for the workspace",
+		DefaultValue: names[0],
+		Options:      names,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	providerOptions, err := cobraCmd.Flags().GetStringArray("provider-option")
+	if err != nil {
+		return nil, err
+	}
+
+	selected := providers[providerName]
+	if selected.State == nil || !selected.State.Initialized {
+		// only this workspace uses the selected provider, so it doesn't become
+		// the default
+		err = provider.InitProvider(context.Background(), selected.Config, kledConfig.DefaultContext, providerOptions, logger)
+		if err != nil {
+			return nil, fmt.Errorf("configure provider %s: %w", providerName, err)
+		}
+	}
+
+	globalFlags.Provider = providerName
+	return args, nil
+}
+
+// applyTemplate scaffolds the template into the workspace folder and fills in
+// the template's provider defaults, env and secrets unless they were given.
+func applyTemplate(cobraCmd *cobra.Command, globalFlags *flags.GlobalFlags, args []string, templateName string, logger log.Logger) ([]string, error) {
+	template, err := workspacetemplate.Get(templateName)
+	if err != nil {
+		return nil, err
+	}
+
+	folder := template.Name
+	if len(args) > 0 {
+		folder = args[0]
+	}
+	if strings.Contains(folder, "://") || strings.HasPrefix(folder, "git@") {
+		return nil, fmt.Errorf("--template can only be used with a local folder, got %s", folder)
+	}
+
+	folder, err = filepath.Abs(folder)
+	if err != nil {
+		return nil, err
+	}
+
+	if template.Provider != nil && template.Provider.Name != "" && globalFlags.Provider == "" {
+		globalFlags.Provider = template.Provider.Name
+
+		providerOptions, err := cobraCmd.Flags().GetStringArray("provider-option")
+		if err != nil {
+			return nil, err
+		}
+
+		for key, value := range template.Provider.Options {
+			if hasOption(providerOptions, key) {
+				continue
+			}
+
+			err = cobraCmd.Flags().Set("provider-option", key+"="+value)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	workspaceEnv, err := cobraCmd.Flags().GetStringArray("workspace-env")
+	if err != nil {
+		return nil, err
+	}
+
+	for _, secret := range template.Secrets {
+		if hasOption(workspaceEnv, secret.Name) {
+			continue
+		}
+
+		value, ok := os.LookupEnv(secret.Name)
+		if (!ok || value == "") && secret.Required {
+			if !terminal.IsTerminalIn {
+				return nil, fmt.Errorf("secret %s is required by template %s, please set it in the environment or via --workspace-env", secret.Name, templateName)
+			}
+
+			if secret.Description != "" {
+				logger.Info(secret.Description)
+			}
+			value, err = logger.Question(&survey.QuestionOptions{
+				Question:   fmt.Sprintf("Please enter a value for %s", secret.Name),
+				IsPassword: true,
+			})
+			if err != nil {
+				return nil, err
+			}
+		}
+		if value == "" {
+			continue
+		}
+
+		err = cobraCmd.Flags().Set("workspace-env", secret.Name+"="+value)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	for name, value := range template.Env {
+		err = cobraCmd.Flags().Set("template-env", name+"="+value)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// secrets are checked first, so nothing is written when one is missing
+	err = copy.CreateIfNotExists(folder, 0755)
+	if err != nil {
+		return nil, err
+	}
+
+	files, err := workspacetemplate.Scaffold(template, folder)
+	if err != nil {
+		return nil, fmt.Errorf("scaffold template %s: %w", templateName, err)
+	}
+	logger.Infof("Scaffolded %d file(s) from template %s into %s", len(files), templateName, folder)
+
+	return []string{folder}, nil
+}
+
+func hasOption(options []string, key string) bool {
+	for _, option := range options {
+		if strings.HasPrefix(option, key+"=") {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,131 @@
+package cmd
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/loft-sh/devpod/cmd/flags"
+	"github.com/loft-sh/devpod/pkg/config"
+	providerpkg "github.com/loft-sh/devpod/pkg/provider"
+	"github.com/loft-sh/devpod/pkg/types"
+	"github.com/loft-sh/log"
+	"github.com/loft-sh/log/survey"
+	"github.com/spf13/cobra"
+)
+
+// answeringLogger answers the questions of a prompt in order
+type answeringLogger struct {
+	log.Logger
+
+	answers   []string
+	questions []string
+}
+
+func (l *answeringLogger) Question(params *survey.QuestionOptions) (string, error) {
+	l.questions = append(l.questions, params.Question)
+	if len(l.answers) == 0 {
+		return "", fmt.Errorf("unexpected question %q", params.Question)
+	}
+	answer := l.answers[0]
+	l.answers = l.answers[1:]
+	return answer, nil
+}
+
+func (l *answeringLogger) ErrorStreamOnly() log.Logger {
+	return l
+}
+
+func TestPromptCreateConfiguresProviderWithoutMakingItDefault(t *testing.T) {
+	tests := []struct {
+		name            string
+		defaultProvider string
+		initialized     bool
+		answers         []string
+		wantProvider    string
+		wantRegion      string
+	}{
+		{
+			name:         "uninitialized provider",
+			answers:      []string{"gcloud"},
+			wantProvider: "gcloud",
+			wantRegion:   "us-central1",
+		},
+		{
+			name:         "initialized provider",
+			initialized:  true,
+			answers:      []string{"gcloud"},
+			wantProvider: "gcloud",
+			wantRegion:   "europe-west1",
+		},
+		{
+			name:            "default provider",
+			defaultProvider: "aws",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Setenv(config.KLED_HOME, t.TempDir())
+			kledConfig, err := config.LoadConfig("", "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			kledConfig.Current().DefaultProvider = test.defaultProvider
+			if test.initialized {
+				kledConfig.Current().Providers["gcloud"] = &config.ProviderConfig{
+					Initialized: true,
+					Options:     map[string]config.OptionValue{"GCLOUD_REGION": {Value: "europe-west1", UserProvided: true}},
+				}
+			}
+			if err := config.SaveConfig(kledConfig); err != nil {
+				t.Fatal(err)
+			}
+			for _, provider := range []*providerpkg.ProviderConfig{
+				{Name: "aws"},
+				{Name: "gcloud", Options: map[string]*types.Option{"GCLOUD_REGION": {Default: "us-central1"}}},
+			} {
+				provider.Exec.Command = types.StrArray{"true"}
+				if err := providerpkg.SaveProviderConfig(kledConfig.DefaultContext, provider); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			createCmd := &cobra.Command{}
+			createCmd.Flags().String("source", "", "")
+			createCmd.Flags().StringArray("provider-option", []string{}, "")
+			globalFlags := &flags.GlobalFlags{}
+			logger := &answeringLogger{Logger: log.Discard, answers: test.answers}
+
+			args, err := promptCreate(createCmd, globalFlags, []string{"github.com/my-org/my-repo"}, logger)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(args, []string{"github.com/my-org/my-repo"}) {
+				t.Errorf("got args %q", args)
+			}
+			if len(logger.answers) != 0 {
+				t.Errorf("questions %q left answers %q", logger.questions, logger.answers)
+			}
+			if globalFlags.Provider != test.wantProvider {
+				t.Errorf("workspace uses provider %q, want %q", globalFlags.Provider, test.wantProvider)
+			}
+
+			kledConfig, err = config.LoadConfig("", "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := kledConfig.Current().DefaultProvider; got != test.defaultProvider {
+				t.Errorf("default provider changed to %q, want %q", got, test.defaultProvider)
+			}
+			if test.wantProvider == "" {
+				return
+			}
+			if state := kledConfig.Current().Providers[test.wantProvider]; state == nil || !state.Initialized {
+				t.Errorf("expected %s to be initialized, got %+v", test.wantProvider, state)
+			}
+			if got := kledConfig.ProviderOptions(test.wantProvider)["GCLOUD_REGION"].Value; got != test.wantRegion {
+				t.Errorf("got GCLOUD_REGION %q, want %q", got, test.wantRegion)
+			}
+		})
+	}
+}
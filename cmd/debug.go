@@ -0,0 +1,306 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/loft-sh/devpod/cmd/completion"
+	"github.com/loft-sh/devpod/cmd/flags"
+	"github.com/loft-sh/devpod/cmd/provider"
+	"github.com/loft-sh/devpod/pkg/client"
+	"github.com/loft-sh/devpod/pkg/command"
+	"github.com/loft-sh/devpod/pkg/config"
+	daemon "github.com/loft-sh/devpod/pkg/daemon/platform"
+	"github.com/loft-sh/devpod/pkg/debugbundle"
+	pkgprovider "github.com/loft-sh/devpod/pkg/provider"
+	"github.com/loft-sh/devpod/pkg/version"
+	"github.com/loft-sh/devpod/pkg/workspace"
+	"github.com/loft-sh/devpod/pkg/workspacestate"
+	"github.com/loft-sh/log"
+	"github.com/spf13/cobra"
+)
+
+// NewDebugCmd returns a new command
+func NewDebugCmd(flags *flags.GlobalFlags) *cobra.Command {
+	debugCmd := &cobra.Command{
+		Use:   "debug",
+		Short: "Debugging utilities",
+	}
+
+	debugCmd.AddCommand(NewDebugBundleCmd(flags))
+	return debugCmd
+}
+
+// DebugBundleCmd holds the configuration
+type DebugBundleCmd struct {
+	*flags.GlobalFlags
+
+	Output     string
+	MaxLogSize int64
+}
+
+// NewDebugBundleCmd creates a new command
+func NewDebugBundleCmd(flags *flags.GlobalFlags) *cobra.Command {
+	cmd := &DebugBundleCmd{
+		GlobalFlags: flags,
+	}
+	bundleCmd := &cobra.Command{
+		Use:   "bundle [workspace-path|workspace-name]",
+		Short: "Collects logs, configuration, recent events and health checks into a redacted archive for bug reports",
+		RunE: func(cobraCmd *cobra.Command, args []string) error {
+			return cmd.Run(cobraCmd.Context(), args)
+		},
+		ValidArgsFunction: func(rootCmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+			return completion.GetWorkspaceSuggestions(rootCmd, cmd.Context, cmd.Provider, args, toComplete, cmd.Owner, log.Default)
+		},
+	}
+
+	bundleCmd.Flags().StringVarP(&cmd.Output, "output", "o", "", "The file to write the bundle to. Defaults to kled-debug-<timestamp>.tar.gz")
+	bundleCmd.Flags().Int64Var(&cmd.MaxLogSize, "max-log-size", 1024*1024, "The maximum number of bytes to include from the end of each log file")
+	return bundleCmd
+}
+
+type healthCheck struct {
+	Name    string `json:"name"`
+	OK      bool   `json:"ok"`
+	Message string `json:"message,omitempty"`
+}
+
+// Run runs the command logic
+func (cmd *DebugBundleCmd) Run(ctx context.Context, args []string) error {
+	now := time.Now()
+	output := cmd.Output
+	if output == "" {
+		output = fmt.Sprintf("kled-debug-%s.tar.gz", now.Format("20060102-150405"))
+	}
+
+	f, err := os.Create(output)
+	if err != nil {
+		return fmt.Errorf("create bundle: %w", err)
+	}
+	defer f.Close()
+
+	bundle := debugbundle.NewWriter(f, strings.TrimSuffix(filepath.Base(output), ".tar.gz"))
+	collector := &bundleCollector{
+		bundle:     bundle,
+		maxLogSize: cmd.MaxLogSize,
+		logger:     log.Default.ErrorStreamOnly(),
+	}
+
+	// like troubleshoot, collect as much as possible and record what failed
+	// instead of returning early
+	collector.add("version.json", map[string]string{
+		"cliVersion": version.GetVersion(),
+		"os":         runtime.GOOS,
+		"arch":       runtime.GOARCH,
+		"goVersion":  runtime.Version(),
+		"createdAt":  now.UTC().Format(time.RFC3339),
+	})
+	collector.collect(ctx, cmd.GlobalFlags, args)
+
+	collector.add("health.json", collector.checks)
+	collector.add("errors.json", collector.errors)
+	if err := bundle.Close(); err != nil {
+		return fmt.Errorf("write bundle: %w", err)
+	}
+
+	log.Default.Donef("Wrote debug bundle to %s", output)
+	if len(collector.errors) > 0 {
+		log.Default.Warnf("%d item(s) could not be collected, see errors.json in the bundle", len(collector.errors))
+	}
+	return nil
+}
+
+type bundleCollector struct {
+	bundle     *debugbundle.Writer
+	maxLogSize int64
+	logger     log.Logger
+
+	checks []healthCheck
+	errors []PrintableError
+}
+
+func (c *bundleCollector) collect(ctx context.Context, globalFlags *flags.GlobalFlags, args []string) {
+	kledConfig, err := config.LoadConfig(globalFlags.Context, globalFlags.Provider)
+	c.check("config", err)
+	if err != nil {
+		c.fail("load config", err)
+		return
+	}
+	c.add("config.json", kledConfig)
+
+	providers, err := collectProviders(kledConfig, c.logger)
+	if err != nil {
+		c.fail("collect providers", err)
+	}
+	c.add("providers.json", providers)
+
+	proInstances, err := collectPlatformInfo(kledConfig, c.logger)
+	if err != nil {
+		c.fail("collect platform info", err)
+	}
+	c.add("pro-instances.json", proInstances)
+
+	workspaces, err := workspace.ListLocalWorkspaces(kledConfig.DefaultContext, false, c.logger)
+	if err != nil {
+		c.fail("list workspaces", err)
+	}
+	c.add("workspaces.json", workspaces)
+	c.collectEvents(kledConfig.DefaultContext, workspaces)
+
+	c.checkDocker(ctx)
+	c.collectDaemonLogs(kledConfig, providers)
+
+	if len(args) == 0 {
+		return
+	}
+
+	workspaceClient, err := workspace.Get(ctx, kledConfig, args, false, globalFlags.Owner, c.logger)
+	if err != nil {
+		c.fail("get workspace", err)
+		return
+	}
+
+	workspaceConfig := workspaceClient.WorkspaceConfig()
+	c.add("workspace/workspace.json", workspaceConfig)
+	c.collectWorkspaceDir(kledConfig.DefaultContext, workspaceConfig.ID)
+
+	status, err := workspaceClient.Status(ctx, client.StatusOptions{})
+	c.check("workspace status", err)
+	if err != nil {
+		c.fail("workspace status", err)
+	} else {
+		c.add("workspace/status.json", map[string]client.Status{"status": status})
+	}
+
+	if daemonClient, ok := workspaceClient.(client.DaemonClient); ok {
+		dir, err := pkgprovider.GetDaemonDir(kledConfig.DefaultContext, daemonClient.Provider())
+		if err != nil {
+			c.fail("get daemon dir", err)
+			return
+		}
+
+		status, err := daemon.NewLocalClient(dir, daemonClient.Provider()).Status(ctx, true)
+		c.check("daemon", err)
+		if err != nil {
+			c.fail("get daemon status", err)
+		} else {
+			c.add("workspace/daemon-status.json", status)
+		}
+	}
+}
+
+// checkDocker records whether the local docker daemon is reachable, which
+// is the most common cause of failing workspaces on the docker provider.
+func (c *bundleCollector) checkDocker(ctx context.Context) {
+	if !command.Exists("docker") {
+		c.checks = append(c.checks, healthCheck{Name: "docker", Message: "docker not found in PATH"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	out, err := exec.CommandContext(ctx, "docker", "version", "--format", "{{.Server.Version}}").CombinedOutput()
+	if err != nil {
+		c.checks = append(c.checks, healthCheck{Name: "docker", Message: strings.TrimSpace(string(out))})
+		return
+	}
+	c.checks = append(c.checks, healthCheck{Name: "docker", OK: true, Message: "server " + strings.TrimSpace(string(out))})
+}
+
+// maxEvents is the number of recent events added to a bundle.
+const maxEvents = 100
+
+type workspaceEvent struct {
+	Workspace string `json:"workspace"`
+	workspacestate.Transition
+}
+
+// collectEvents adds the most recent state transitions of all workspaces,
+// newest first.
+func (c *bundleCollector) collectEvents(contextName string, workspaces []*pkgprovider.Workspace) {
+	events := []workspaceEvent{}
+	for _, ws := range workspaces {
+		state, err := workspacestate.Load(contextName, ws.ID)
+		if err != nil {
+			c.fail("load state of "+ws.ID, err)
+			continue
+		}
+
+		for _, transition := range state.History {
+			events = append(events, workspaceEvent{Workspace: ws.ID, Transition: transition})
+		}
+	}
+
+	sort.SliceStable(events, func(i, j int) bool {
+		return events[i].Timestamp.After(events[j].Timestamp)
+	})
+	if len(events) > maxEvents {
+		events = events[:maxEvents]
+	}
+	c.add("events.json", events)
+}
+
+// collectDaemonLogs adds the platform daemon log of every configured provider.
+func (c *bundleCollector) collectDaemonLogs(kledConfig *config.Config, providers map[string]provider.ProviderWithDefault) {
+	for name := range providers {
+		dir, err := pkgprovider.GetDaemonDir(kledConfig.DefaultContext, name)
+		if err != nil {
+			c.fail("get daemon dir", err)
+			continue
+		}
+
+		c.addFile(path.Join("logs", "daemon", name+".log"), filepath.Join(dir, "daemon.log"))
+	}
+}
+
+// collectWorkspaceDir adds the workspace's result file and any logs stored
+// next to it.
+func (c *bundleCollector) collectWorkspaceDir(contextName, workspaceID string) {
+	dir, err := pkgprovider.GetWorkspaceDir(contextName, workspaceID)
+	if err != nil {
+		c.fail("get workspace dir", err)
+		return
+	}
+
+	c.addFile(path.Join("workspace", pkgprovider.WorkspaceResultFile), filepath.Join(dir, pkgprovider.WorkspaceResultFile))
+
+	logs, _ := filepath.Glob(filepath.Join(dir, "*.log"))
+	for _, logFile := range logs {
+		c.addFile(path.Join("workspace", "logs", filepath.Base(logFile)), logFile)
+	}
+}
+
+func (c *bundleCollector) add(name string, v interface{}) {
+	if err := c.bundle.AddJSON(name, v); err != nil {
+		c.fail("add "+name, err)
+	}
+}
+
+func (c *bundleCollector) addFile(name, filePath string) {
+	err := c.bundle.AddFileTail(name, filePath, c.maxLogSize)
+	if err != nil && !os.IsNotExist(err) {
+		c.fail("add "+name, err)
+	}
+}
+
+func (c *bundleCollector) check(name string, err error) {
+	check := healthCheck{Name: name, OK: err == nil}
+	if err != nil {
+		check.Message = debugbundle.RedactText(err.Error())
+	}
+	c.checks = append(c.checks, check)
+}
+
+func (c *bundleCollector) fail(what string, err error) {
+	c.errors = append(c.errors, PrintableError{fmt.Errorf("%s: %w", what, err)})
+}
@@ -0,0 +1,199 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/loft-sh/devpod/cmd/completion"
+	"github.com/loft-sh/devpod/cmd/flags"
+	"github.com/loft-sh/devpod/pkg/agent/control"
+	client2 "github.com/loft-sh/devpod/pkg/client"
+	"github.com/loft-sh/devpod/pkg/config"
+	workspace2 "github.com/loft-sh/devpod/pkg/workspace"
+	"github.com/loft-sh/devpod/pkg/workspaceenv"
+	"github.com/loft-sh/log"
+	"github.com/loft-sh/log/table"
+	"github.com/spf13/cobra"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// EnvCmd holds the env cmd flags
+type EnvCmd struct {
+	*flags.GlobalFlags
+
+	Output string
+}
+
+// envEntry is a resolved env variable of the workspace
+type envEntry struct {
+	Name      string                `json:"name"`
+	Value     string                `json:"value"`
+	Source    workspaceenv.Source   `json:"source"`
+	Secret    bool                  `json:"secret,omitempty"`
+	Ref       string                `json:"ref,omitempty"`
+	Overrides []workspaceenv.Source `json:"overrides,omitempty"`
+}
+
+// NewEnvCmd creates a new command
+func NewEnvCmd(flags *flags.GlobalFlags) *cobra.Command {
+	cmd := &EnvCmd{
+		GlobalFlags: flags,
+	}
+	envCmd := &cobra.Command{
+		Use:   "env [flags] [workspace-path|workspace-name]",
+		Short: "Shows the env variables of a workspace and where they come from",
+		Long: `Shows the env variables put into a workspace and their source. Sources
+override each other in this order:
+  host      TZ and LANG of the host, unless turned off with the
+            HOST_TIMEZONE_LOCALE context option or --skip-personalization
+  provider  workspaceEnv of the provider
+  template  env of the template the workspace was created from
+  project   the .env file of the workspace folder
+  cli       --workspace-env or -e of kled up
+  vault     --workspace-secret of kled up, read from Vault
+
+Values of Vault secrets are masked. The project .env is read from the local
+folder or, for other sources, from the running workspace.`,
+		RunE: func(cobraCmd *cobra.Command, args []string) error {
+			kledConfig, err := config.LoadConfig(cmd.Context, cmd.Provider)
+			if err != nil {
+				return err
+			}
+
+			client, err := workspace2.Get(cobraCmd.Context(), kledConfig, args, false, cmd.Owner, log.Default.ErrorStreamOnly())
+			if err != nil {
+				return err
+			}
+
+			return cmd.Run(cobraCmd.Context(), kledConfig, client)
+		},
+		ValidArgsFunction: func(rootCmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+			return completion.GetWorkspaceSuggestions(rootCmd, cmd.Context, cmd.Provider, args, toComplete, cmd.Owner, log.Default)
+		},
+	}
+
+	envCmd.Flags().StringVar(&cmd.Output, "output", "plain", "The output format to use. Can be json or plain")
+	return envCmd
+}
+
+// Run runs the command logic
+func (cmd *EnvCmd) Run(ctx context.Context, kledConfig *config.Config, client client2.BaseWorkspaceClient) error {
+	if cmd.Output != "json" && cmd.Output != "plain" {
+		return fmt.Errorf("unexpected output format, choose either json or plain. Got %s", cmd.Output)
+	}
+
+	workspaceConfig := client.WorkspaceConfig()
+	lower, upper, err := workspace2.EnvLayers(ctx, kledConfig, workspaceConfig, true, log.Default)
+	if err != nil {
+		// still show the other sources, secrets are masked anyway
+		log.Default.Warnf("%v, showing secrets without checking them", err)
+		lower, upper, err = workspace2.EnvLayers(ctx, kledConfig, workspaceConfig, false, log.Default)
+		if err != nil {
+			return err
+		}
+	}
+
+	project, err := projectEnv(ctx, client)
+	if err != nil {
+		log.Default.Warnf("Skip the project %s: %v", workspaceenv.DotEnvFile, err)
+	}
+	layers := append(lower, workspaceenv.Layer{Source: workspaceenv.SourceProject, Env: project})
+	layers = append(layers, upper...)
+
+	entries := []envEntry{}
+	for _, variable := range workspaceenv.Resolve(layers...) {
+		entry := envEntry{
+			Name:      variable.Name,
+			Value:     variable.DisplayValue(),
+			Source:    variable.Source,
+			Secret:    variable.Secret,
+			Overrides: variable.Overrides,
+		}
+		if variable.Source == workspaceenv.SourceVault && workspaceConfig.Env != nil {
+			entry.Ref = workspaceConfig.Env.Secrets[variable.Name]
+		}
+		entries = append(entries, entry)
+	}
+
+	if cmd.Output == "json" {
+		out, err := json.MarshalIndent(entries, "", "  ")
+		if err != nil {
+			return err
+		}
+
+		fmt.Print(string(out))
+		return nil
+	}
+
+	if len(entries) == 0 {
+		log.Default.Infof("Workspace '%s' has no env variables", client.Workspace())
+		return nil
+	}
+
+	tableEntries := [][]string{}
+	for _, entry := range entries {
+		source := string(entry.Source)
+		if entry.Ref != "" {
+			source += " (" + entry.Ref + ")"
+		}
+		overrides := []string{}
+		for _, override := range entry.Overrides {
+			overrides = append(overrides, string(override))
+		}
+
+		tableEntries = append(tableEntries, []string{
+			entry.Name,
+			entry.Value,
+			source,
+			strings.Join(overrides, ", "),
+		})
+	}
+
+	table.PrintTable(log.Default, []string{
+		"Name",
+		"Value",
+		"Source",
+		"Overrides",
+	}, tableEntries)
+	return nil
+}
+
+// projectEnv reads the .env of the workspace folder, locally for local
+// folders and through the control channel of the workspace otherwise
+func projectEnv(ctx context.Context, client client2.BaseWorkspaceClient) (map[string]string, error) {
+	source := client.WorkspaceConfig().Source
+	if source.LocalFolder != "" {
+		data, err := os.ReadFile(filepath.Join(source.LocalFolder, workspaceenv.DotEnvFile))
+		if os.IsNotExist(err) {
+			return nil, nil
+		} else if err != nil {
+			return nil, err
+		}
+
+		return workspaceenv.ParseDotEnv(data)
+	}
+
+	folder, err := workspaceFolder(client)
+	if err != nil {
+		return nil, err
+	}
+	data := &bytes.Buffer{}
+	err = runCopy(ctx, client, folder, nil, func(ctx context.Context, copier *control.Copier) error {
+		return copier.DownloadWriter(ctx, path.Join(folder, workspaceenv.DotEnvFile), data)
+	})
+	if err != nil {
+		if status.Code(err) == codes.NotFound {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return workspaceenv.ParseDotEnv(data.Bytes())
+}
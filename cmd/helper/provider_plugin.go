@@ -0,0 +1,92 @@
+package helper
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/loft-sh/devpod/cmd/flags"
+	"github.com/loft-sh/devpod/pkg/provider"
+	"github.com/loft-sh/devpod/pkg/providerplugin"
+	"github.com/loft-sh/devpod/pkg/version"
+	"github.com/spf13/cobra"
+)
+
+type ProviderPluginCmd struct {
+	*flags.GlobalFlags
+
+	Plugin string
+}
+
+// NewProviderPluginCmd creates a new command
+func NewProviderPluginCmd(flags *flags.GlobalFlags) *cobra.Command {
+	cmd := &ProviderPluginCmd{
+		GlobalFlags: flags,
+	}
+	providerPluginCmd := &cobra.Command{
+		Use:       "provider-plugin [method]",
+		Short:     "Runs a provider command through a provider plugin",
+		Args:      cobra.ExactArgs(1),
+		ValidArgs: providerplugin.Methods,
+		RunE: func(_ *cobra.Command, args []string) error {
+			return cmd.Run(context.Background(), args[0])
+		},
+	}
+	providerPluginCmd.Flags().StringVar(&cmd.Plugin, "plugin", "", "The path to the plugin binary")
+	_ = providerPluginCmd.MarkFlagRequired("plugin")
+	return providerPluginCmd
+}
+
+// Run runs the command logic
+func (cmd *ProviderPluginCmd) Run(ctx context.Context, method string) error {
+	client, err := providerplugin.Start(ctx, cmd.Plugin, os.Environ(), os.Stderr, version.GetVersion())
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	manifest := client.Manifest()
+	if !manifest.Supports(method) {
+		return fmt.Errorf("plugin %s doesn't support %s", manifest.Name, method)
+	}
+
+	pluginContext := providerplugin.Context{
+		MachineID:       os.Getenv(provider.MACHINE_ID),
+		MachineFolder:   os.Getenv(provider.MACHINE_FOLDER),
+		WorkspaceID:     os.Getenv(provider.WORKSPACE_ID),
+		WorkspaceFolder: os.Getenv(provider.WORKSPACE_FOLDER),
+		ProviderFolder:  os.Getenv(provider.PROVIDER_FOLDER),
+		Options:         map[string]string{},
+	}
+	for name := range manifest.Options {
+		if value, ok := os.LookupEnv(name); ok {
+			pluginContext.Options[name] = value
+		}
+	}
+
+	switch method {
+	case providerplugin.MethodExec:
+		exitCode, err := client.Exec(ctx, &providerplugin.ExecParams{
+			Context: pluginContext,
+			Command: os.Getenv(provider.CommandEnv),
+		}, os.Stdin, os.Stdout, os.Stderr)
+		if err != nil {
+			return err
+		} else if exitCode != 0 {
+			_ = client.Close()
+			os.Exit(exitCode)
+		}
+	case providerplugin.MethodStatus:
+		result := &providerplugin.StatusResult{}
+		err := client.Call(method, &pluginContext, result)
+		if err != nil {
+			return err
+		}
+
+		fmt.Print(result.Status)
+	default:
+		return client.Call(method, &pluginContext, nil)
+	}
+
+	return nil
+}
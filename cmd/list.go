@@ -4,11 +4,15 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"os"
 	"sort"
 	"time"
 
 	"github.com/loft-sh/devpod/cmd/flags"
 	"github.com/loft-sh/devpod/pkg/config"
+	"github.com/loft-sh/devpod/pkg/provider"
+	"github.com/loft-sh/devpod/pkg/sdk"
+	"github.com/loft-sh/devpod/pkg/sso"
 	"github.com/loft-sh/devpod/pkg/workspace"
 	"github.com/loft-sh/log"
 	"github.com/loft-sh/log/table"
@@ -21,6 +25,16 @@ type ListCmd struct {
 
 	Output  string
 	SkipPro bool
+	Server  string
+	APIKey  string
+}
+
+// listEntry adds the liveness of the workspace agent to the json output
+type listEntry struct {
+	*provider.Workspace
+
+	LastSeen *time.Time `json:"lastSeen,omitempty"`
+	Agent    string     `json:"agentState,omitempty"`
 }
 
 // NewListCmd creates a new destroy command
@@ -44,6 +58,8 @@ func NewListCmd(flags *flags.GlobalFlags) *cobra.Command {
 
 	listCmd.Flags().StringVar(&cmd.Output, "output", "plain", "The output format to use. Can be json or plain")
 	listCmd.Flags().BoolVar(&cmd.SkipPro, "skip-pro", false, "Don't list pro workspaces")
+	listCmd.Flags().StringVar(&cmd.Server, "server", os.Getenv("KLED_SERVER_URL"), "The Kled server URL to query agent heartbeats from. You can also use KLED_SERVER_URL to set this")
+	listCmd.Flags().StringVar(&cmd.APIKey, "api-key", os.Getenv("KLED_API_KEY"), "The API key to authenticate with. You can also use KLED_API_KEY to set this")
 	return listCmd
 }
 
@@ -59,11 +75,29 @@ func (cmd *ListCmd) Run(ctx context.Context) error {
 		return err
 	}
 
+	// the server is optional, without it the last seen column stays empty
+	heartbeats := map[string]sdk.Heartbeat{}
+	if cmd.Server != "" && len(workspaces) > 0 {
+		heartbeats, err = cmd.fetchHeartbeats(ctx, workspaces)
+		if err != nil {
+			log.Default.Warnf("Error retrieving workspace heartbeats: %v", err)
+		}
+	}
+
 	if cmd.Output == "json" {
 		sort.SliceStable(workspaces, func(i, j int) bool {
 			return workspaces[i].LastUsedTimestamp.Time.Unix() > workspaces[j].LastUsedTimestamp.Time.Unix()
 		})
-		out, err := json.Marshal(workspaces)
+		entries := []listEntry{}
+		for _, entry := range workspaces {
+			listEntry := listEntry{Workspace: entry}
+			if beat, ok := lookupHeartbeat(heartbeats, entry); ok {
+				listEntry.LastSeen = &beat.LastSeen
+				listEntry.Agent = beat.State
+			}
+			entries = append(entries, listEntry)
+		}
+		out, err := json.Marshal(entries)
 		if err != nil {
 			return err
 		}
@@ -78,6 +112,13 @@ func (cmd *ListCmd) Run(ctx context.Context) error {
 			if entry.IsPro() && entry.Pro.DisplayName != "" && entry.ID != entry.Pro.DisplayName {
 				name = fmt.Sprintf("%s (%s)", entry.Pro.DisplayName, entry.ID)
 			}
+			lastSeen := "-"
+			if beat, ok := lookupHeartbeat(heartbeats, entry); ok {
+				lastSeen = time.Since(beat.LastSeen).Round(1 * time.Second).String()
+				if beat.State == "unreachable" {
+					lastSeen += " (unreachable)"
+				}
+			}
 			tableEntries = append(tableEntries, []string{
 				name,
 				entry.Source.String(),
@@ -85,6 +126,7 @@ func (cmd *ListCmd) Run(ctx context.Context) error {
 				entry.Provider.Name,
 				entry.IDE.Name,
 				time.Since(entry.LastUsedTimestamp.Time).Round(1 * time.Second).String(),
+				lastSeen,
 				time.Since(entry.CreationTimestamp.Time).Round(1 * time.Second).String(),
 				fmt.Sprintf("%t", entry.IsPro()),
 			})
@@ -97,6 +139,7 @@ func (cmd *ListCmd) Run(ctx context.Context) error {
 			"Provider",
 			"IDE",
 			"Last Used",
+			"Last Seen",
 			"Age",
 			"Pro",
 		}, tableEntries)
@@ -106,3 +149,35 @@ func (cmd *ListCmd) Run(ctx context.Context) error {
 
 	return nil
 }
+
+// fetchHeartbeats retrieves the last heartbeats of the workspace agents from
+// the server, keyed by workspace ID.
+func (cmd *ListCmd) fetchHeartbeats(ctx context.Context, workspaces []*provider.Workspace) (map[string]sdk.Heartbeat, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	client, err := sdk.New(sdk.Options{Server: cmd.Server, APIKey: cmd.APIKey, HTTPClient: sso.HTTPClient(cmd.Server)})
+	if err != nil {
+		return nil, err
+	}
+	defer client.Close()
+
+	ids := make([]string, 0, len(workspaces))
+	for _, workspace := range workspaces {
+		ids = append(ids, workspace.ID)
+	}
+	heartbeats, err := client.Workspaces.Heartbeats(ctx, ids...)
+	if err != nil {
+		return nil, fmt.Errorf("request heartbeats: %w", err)
+	}
+	return heartbeats, nil
+}
+
+// lookupHeartbeat ignores heartbeats of an earlier workspace with the same ID
+func lookupHeartbeat(heartbeats map[string]sdk.Heartbeat, workspace *provider.Workspace) (sdk.Heartbeat, bool) {
+	beat, ok := heartbeats[workspace.ID]
+	if !ok || (beat.WorkspaceUID != "" && workspace.UID != "" && beat.WorkspaceUID != workspace.UID) {
+		return sdk.Heartbeat{}, false
+	}
+	return beat, true
+}
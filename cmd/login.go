@@ -0,0 +1,123 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/loft-sh/devpod/cmd/flags"
+	"github.com/loft-sh/devpod/pkg/sso"
+	"github.com/loft-sh/log"
+	"github.com/skratchdot/open-golang/open"
+	"github.com/spf13/cobra"
+)
+
+// LoginCmd holds the login cmd flags
+type LoginCmd struct {
+	*flags.GlobalFlags
+
+	Server    string
+	Issuer    string
+	ClientID  string
+	Scopes    []string
+	Audience  string
+	NoBrowser bool
+}
+
+// NewLoginCmd creates a new command
+func NewLoginCmd(flags *flags.GlobalFlags) *cobra.Command {
+	cmd := &LoginCmd{
+		GlobalFlags: flags,
+	}
+	loginCmd := &cobra.Command{
+		Use:   "login",
+		Short: "Log in to a Kled server with single sign-on",
+		Long: `Logs in to a Kled server through the OIDC provider of your organization. The
+command prints a code and opens the provider's page to approve it in a browser,
+which may also be on another device.
+
+The tokens are kept in the OS keychain and refreshed automatically. Commands
+talking to the server send them unless an API key is given:
+  kled login --server https://kled.example.com --issuer https://sso.example.com --client-id kled-cli
+
+Logging in again reuses the issuer and client ID of the previous login.`,
+		Args: cobra.NoArgs,
+		RunE: func(cobraCmd *cobra.Command, args []string) error {
+			return cmd.Run(cobraCmd.Context())
+		},
+	}
+
+	loginCmd.Flags().StringVar(&cmd.Server, "server", os.Getenv("KLED_SERVER_URL"), "The Kled server URL. You can also use KLED_SERVER_URL to set this")
+	loginCmd.Flags().StringVar(&cmd.Issuer, "issuer", os.Getenv("KLED_OIDC_ISSUER"), "The URL of the OIDC provider. You can also use KLED_OIDC_ISSUER to set this")
+	loginCmd.Flags().StringVar(&cmd.ClientID, "client-id", os.Getenv("KLED_OIDC_CLIENT_ID"), "The OIDC client ID of the CLI. You can also use KLED_OIDC_CLIENT_ID to set this")
+	loginCmd.Flags().StringSliceVar(&cmd.Scopes, "scopes", nil, "The scopes to request, "+strings.Join(sso.DefaultScopes, ",")+" if empty")
+	loginCmd.Flags().StringVar(&cmd.Audience, "audience", "", "The audience to request access tokens for, required by some providers")
+	loginCmd.Flags().BoolVar(&cmd.NoBrowser, "no-browser", false, "Only print the login URL instead of opening a browser")
+	return loginCmd
+}
+
+// Run runs the command logic
+func (cmd *LoginCmd) Run(ctx context.Context) error {
+	if cmd.Server == "" {
+		return fmt.Errorf("no server specified, use --server or KLED_SERVER_URL")
+	}
+
+	options := sso.LoginOptions{
+		Server:   cmd.Server,
+		Issuer:   cmd.Issuer,
+		ClientID: cmd.ClientID,
+		Scopes:   cmd.Scopes,
+		Audience: cmd.Audience,
+	}
+	previous, err := sso.Find(cmd.Server)
+	if err != nil {
+		return err
+	} else if previous != nil {
+		if options.Issuer == "" {
+			options.Issuer = previous.Issuer
+		}
+		if options.ClientID == "" {
+			options.ClientID = previous.ClientID
+		}
+		if len(options.Scopes) == 0 {
+			options.Scopes = previous.Scopes
+		}
+		if options.Audience == "" {
+			options.Audience = previous.Audience
+		}
+	}
+	if options.Issuer == "" || options.ClientID == "" {
+		return fmt.Errorf("no OIDC provider specified, use --issuer and --client-id")
+	}
+
+	login, err := sso.DeviceLogin(ctx, options, func(authorization *sso.DeviceAuthorization) {
+		url := authorization.VerificationURIComplete
+		if url == "" {
+			url = authorization.VerificationURI
+		}
+		log.Default.Infof("Your login code is %s", authorization.UserCode)
+		log.Default.Infof("Approve it at %s", url)
+		if !cmd.NoBrowser {
+			err := open.Run(url)
+			if err != nil {
+				log.Default.Debugf("Couldn't open a browser: %v", err)
+			}
+		}
+		log.Default.Info("Waiting for the login to be approved...")
+	})
+	if err != nil {
+		return err
+	}
+
+	user := login.Email
+	if user == "" {
+		user = login.Subject
+	}
+	if user != "" {
+		log.Default.Donef("Successfully logged in to %s as %s", login.Server, user)
+	} else {
+		log.Default.Donef("Successfully logged in to %s", login.Server)
+	}
+	return nil
+}
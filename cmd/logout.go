@@ -0,0 +1,52 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/loft-sh/devpod/cmd/flags"
+	"github.com/loft-sh/devpod/pkg/sso"
+	"github.com/loft-sh/log"
+	"github.com/spf13/cobra"
+)
+
+// LogoutCmd holds the logout cmd flags
+type LogoutCmd struct {
+	*flags.GlobalFlags
+
+	Server string
+}
+
+// NewLogoutCmd creates a new command
+func NewLogoutCmd(flags *flags.GlobalFlags) *cobra.Command {
+	cmd := &LogoutCmd{
+		GlobalFlags: flags,
+	}
+	logoutCmd := &cobra.Command{
+		Use:   "logout",
+		Short: "Log out of a Kled server",
+		Long:  `Removes the tokens kled login stored for a Kled server from the OS keychain.`,
+		Args:  cobra.NoArgs,
+		RunE: func(cobraCmd *cobra.Command, args []string) error {
+			return cmd.Run()
+		},
+	}
+
+	logoutCmd.Flags().StringVar(&cmd.Server, "server", os.Getenv("KLED_SERVER_URL"), "The Kled server URL. You can also use KLED_SERVER_URL to set this")
+	return logoutCmd
+}
+
+// Run runs the command logic
+func (cmd *LogoutCmd) Run() error {
+	if cmd.Server == "" {
+		return fmt.Errorf("no server specified, use --server or KLED_SERVER_URL")
+	}
+
+	err := sso.Logout(cmd.Server)
+	if err != nil {
+		return err
+	}
+
+	log.Default.Donef("Successfully logged out of %s", sso.NormalizeServer(cmd.Server))
+	return nil
+}
@@ -2,10 +2,12 @@ package machine
 
 import (
 	"context"
+	"fmt"
 
 	"github.com/loft-sh/devpod/cmd/flags"
 	"github.com/loft-sh/devpod/pkg/client"
 	"github.com/loft-sh/devpod/pkg/config"
+	"github.com/loft-sh/devpod/pkg/provider"
 	"github.com/loft-sh/devpod/pkg/workspace"
 	"github.com/loft-sh/log"
 	"github.com/spf13/cobra"
@@ -16,6 +18,8 @@ type CreateCmd struct {
 	*flags.GlobalFlags
 
 	ProviderOptions []string
+	MaxWorkspaces   int
+	AutoDelete      bool
 }
 
 // NewCreateCmd creates a new create command
@@ -30,7 +34,9 @@ func NewCreateCmd(flags *flags.GlobalFlags) *cobra.Command {
 			return cmd.Run(context.Background(), args)
 		},
 	}
-	createCmd.Flags().StringSliceVar(&cmd.ProviderOptions, "provider-option", []string{}, "Provider option in the form KEY=VALUE")
+	createCmd.Flags().StringSliceVarP(&cmd.ProviderOptions, "provider-option", "o", []string{}, "Provider option in the form KEY=VALUE, see 'kled provider options' for the available options")
+	createCmd.Flags().IntVar(&cmd.MaxWorkspaces, "max-workspaces", 0, "The number of workspaces this machine can host. If set, new workspaces of the provider are placed on this machine while it has capacity")
+	createCmd.Flags().BoolVar(&cmd.AutoDelete, "auto-delete", false, "If true, deletes the machine together with its last workspace")
 	return createCmd
 }
 
@@ -41,11 +47,26 @@ func (cmd *CreateCmd) Run(ctx context.Context, args []string) error {
 		return err
 	}
 
+	if cmd.MaxWorkspaces < 0 {
+		return fmt.Errorf("--max-workspaces must not be negative")
+	}
+
 	machineClient, err := workspace.ResolveMachine(devPodConfig, args, cmd.ProviderOptions, log.Default)
 	if err != nil {
 		return err
 	}
 
+	// configure how the machine is shared
+	if cmd.MaxWorkspaces > 0 || cmd.AutoDelete {
+		machineConfig := machineClient.MachineConfig()
+		machineConfig.MaxWorkspaces = cmd.MaxWorkspaces
+		machineConfig.AutoDelete = cmd.AutoDelete
+		err = provider.SaveMachineConfig(machineConfig)
+		if err != nil {
+			return err
+		}
+	}
+
 	err = machineClient.Create(ctx, client.CreateOptions{})
 	if err != nil {
 		return err
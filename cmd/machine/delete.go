@@ -35,7 +35,7 @@ func NewDeleteCmd(flags *flags.GlobalFlags) *cobra.Command {
 	}
 
 	deleteCmd.Flags().StringVar(&cmd.GracePeriod, "grace-period", "", "The amount of time to give the command to delete the workspace")
-	deleteCmd.Flags().BoolVar(&cmd.Force, "force", false, "Delete workspace even if it is not found remotely anymore")
+	deleteCmd.Flags().BoolVar(&cmd.Force, "force", false, "Delete the machine even if workspaces still use it or it is not found remotely anymore")
 	return deleteCmd
 }
 
@@ -51,16 +51,23 @@ func (cmd *DeleteCmd) Run(ctx context.Context, args []string) error {
 		return err
 	}
 
-	// check if there are workspaces that still use this machine
-	workspaces, err := workspace.List(ctx, devPodConfig, false, platform.SelfOwnerFilter, log.Default)
-	if err != nil {
-		return err
-	}
+	if !cmd.Force {
+		// check if there are workspaces that still use this machine
+		err = workspace.CheckMachineUnused(devPodConfig.DefaultContext, machineClient.Machine(), log.Default)
+		if err != nil {
+			return err
+		}
+
+		workspaces, err := workspace.List(ctx, devPodConfig, false, platform.SelfOwnerFilter, log.Default)
+		if err != nil {
+			return err
+		}
 
-	// search for workspace that uses this machine
-	for _, workspace := range workspaces {
-		if workspace.Machine.ID == machineClient.Machine() {
-			return fmt.Errorf("cannot delete machine '%s', because workspace '%s' is still using it. Please delete the workspace '%s' before deleting the machine", workspace.Machine.ID, workspace.ID, workspace.ID)
+		// search for workspace that uses this machine
+		for _, workspace := range workspaces {
+			if workspace.Machine.ID == machineClient.Machine() {
+				return fmt.Errorf("cannot delete machine '%s', because workspace '%s' is still using it. Please delete the workspace '%s' before deleting the machine", workspace.Machine.ID, workspace.ID, workspace.ID)
+			}
 		}
 	}
 
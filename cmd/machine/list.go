@@ -6,11 +6,13 @@ import (
 	"fmt"
 	"os"
 	"sort"
+	"strconv"
 	"time"
 
 	"github.com/loft-sh/devpod/cmd/flags"
 	"github.com/loft-sh/devpod/pkg/config"
 	"github.com/loft-sh/devpod/pkg/provider"
+	"github.com/loft-sh/devpod/pkg/workspace"
 	"github.com/loft-sh/log"
 	"github.com/loft-sh/log/table"
 	"github.com/pkg/errors"
@@ -60,6 +62,11 @@ func (cmd *ListCmd) Run(ctx context.Context) error {
 	}
 
 	if cmd.Output == "plain" {
+		usage, err := workspace.MachineUsage(devPodConfig.DefaultContext, log.Default)
+		if err != nil {
+			return err
+		}
+
 		tableEntries := [][]string{}
 		for _, entry := range entries {
 			machineConfig, err := provider.LoadMachineConfig(devPodConfig.DefaultContext, entry.Name())
@@ -67,9 +74,15 @@ func (cmd *ListCmd) Run(ctx context.Context) error {
 				return errors.Wrap(err, "load machine config")
 			}
 
+			workspaces := strconv.Itoa(usage[machineConfig.ID])
+			if machineConfig.MaxWorkspaces > 0 {
+				workspaces += "/" + strconv.Itoa(machineConfig.MaxWorkspaces)
+			}
 			tableEntries = append(tableEntries, []string{
 				machineConfig.ID,
 				machineConfig.Provider.Name,
+				workspaces,
+				strconv.FormatBool(machineConfig.AutoDelete),
 				time.Since(machineConfig.CreationTimestamp.Time).Round(1 * time.Second).String(),
 			})
 		}
@@ -80,6 +93,8 @@ func (cmd *ListCmd) Run(ctx context.Context) error {
 		table.PrintTable(log.Default, []string{
 			"Name",
 			"Provider",
+			"Workspaces",
+			"Auto Delete",
 			"Age",
 		}, tableEntries)
 	} else if cmd.Output == "json" {
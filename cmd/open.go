@@ -0,0 +1,197 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/loft-sh/devpod/cmd/completion"
+	"github.com/loft-sh/devpod/cmd/flags"
+	client2 "github.com/loft-sh/devpod/pkg/client"
+	"github.com/loft-sh/devpod/pkg/config"
+	"github.com/loft-sh/devpod/pkg/ide/ideparse"
+	"github.com/loft-sh/devpod/pkg/ide/jetbrains"
+	"github.com/loft-sh/devpod/pkg/ide/vscode"
+	workspace2 "github.com/loft-sh/devpod/pkg/workspace"
+	"github.com/loft-sh/log"
+	"github.com/spf13/cobra"
+)
+
+// OpenCmd holds the open cmd flags
+type OpenCmd struct {
+	*flags.GlobalFlags
+
+	IDE        string
+	IDEOptions []string
+	Timeout    time.Duration
+}
+
+// NewOpenCmd creates a new command
+func NewOpenCmd(flags *flags.GlobalFlags) *cobra.Command {
+	cmd := &OpenCmd{
+		GlobalFlags: flags,
+	}
+	openCmd := &cobra.Command{
+		Use:   "open [flags] [workspace-path|workspace-name]",
+		Short: "Opens an existing workspace in an IDE",
+		Long: `Starts an existing workspace, installs the server of the IDE in the
+container, waits until it is ready and opens the local IDE client connected
+to it. The IDE is remembered for the workspace.
+
+  kled workspace open my-workspace --ide vscode
+  kled workspace open my-workspace --ide goland`,
+		RunE: func(cobraCmd *cobra.Command, args []string) error {
+			ctx, cancel := WithSignals(cobraCmd.Context())
+			defer cancel()
+
+			kledConfig, err := config.LoadConfig(cmd.Context, cmd.Provider)
+			if err != nil {
+				return err
+			}
+
+			client, err := workspace2.Get(ctx, kledConfig, args, true, cmd.Owner, log.Default)
+			if err != nil {
+				return err
+			}
+
+			return cmd.Run(ctx, kledConfig, client, log.Default)
+		},
+		ValidArgsFunction: func(rootCmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+			return completion.GetWorkspaceSuggestions(rootCmd, cmd.Context, cmd.Provider, args, toComplete, cmd.Owner, log.Default)
+		},
+	}
+
+	openCmd.Flags().StringVar(&cmd.IDE, "ide", "", "The IDE to open the workspace in, e.g. vscode, goland or pycharm. If empty the IDE of the workspace is used")
+	openCmd.Flags().StringArrayVar(&cmd.IDEOptions, "ide-option", []string{}, "IDE option in the form KEY=VALUE")
+	openCmd.Flags().DurationVar(&cmd.Timeout, "timeout", 5*time.Minute, "How long to wait for the IDE server to become ready")
+	return openCmd
+}
+
+// Run runs the command logic
+func (cmd *OpenCmd) Run(ctx context.Context, kledConfig *config.Config, client client2.BaseWorkspaceClient, log log.Logger) error {
+	workspace, err := ideparse.RefreshIDEOptions(kledConfig, client.WorkspaceConfig(), cmd.IDE, cmd.IDEOptions)
+	if err != nil {
+		return err
+	} else if workspace.IDE.Name == string(config.IDENone) {
+		return fmt.Errorf("workspace '%s' has no IDE, choose one with --ide", client.Workspace())
+	}
+
+	upCmd := &UpCmd{
+		GlobalFlags:     cmd.GlobalFlags,
+		ConfigureSSH:    true,
+		OpenIDE:         true,
+		ideReadyTimeout: cmd.Timeout,
+	}
+	upCmd.IDE = workspace.IDE.Name
+	upCmd.SSHConfigPath = kledConfig.ContextOption(config.ContextOptionSSHConfigPath)
+
+	return upCmd.Run(ctx, kledConfig, client, nil, log)
+}
+
+// ideReadyInterval is the time between two probes of the IDE server
+var ideReadyInterval = 2 * time.Second
+
+var errIDENotReady = errors.New("IDE server not ready")
+
+// waitForIDE waits until the IDE server in the workspace can accept the
+// local client. IDEs served in the browser wait for their server when they
+// are started.
+func waitForIDE(ctx context.Context, client client2.BaseWorkspaceClient, user string, timeout time.Duration, log log.Logger) error {
+	ideConfig := client.WorkspaceConfig().IDE
+	readyCommand := ideReadyCommand(ideConfig.Name, user, ideConfig.Options, log)
+	if readyCommand == "" {
+		return nil
+	}
+
+	log.Infof("Waiting for the %s server to be ready...", ideConfig.Name)
+	err := waitUntilReady(ctx, timeout, func(ctx context.Context) error {
+		sshCmd, err := createSSHCommand(ctx, client, log, []string{"--user", user, "--command", readyCommand})
+		if err != nil {
+			return err
+		}
+		return sshCmd.Run()
+	}, log)
+	if errors.Is(err, errIDENotReady) {
+		return fmt.Errorf("timed out after %s waiting for the %s server in workspace '%s'", timeout, ideConfig.Name, client.Workspace())
+	}
+	return err
+}
+
+// ideReadyCommand returns a shell command that succeeds as the user once the
+// server of ideName is ready, or an empty string if there is nothing to wait
+// for.
+func ideReadyCommand(ideName, user string, options map[string]config.OptionValue, log log.Logger) string {
+	switch ideName {
+	case string(config.IDEVSCode):
+		return vscode.ReadyCommand(vscode.FlavorStable)
+	case string(config.IDEVSCodeInsiders):
+		return vscode.ReadyCommand(vscode.FlavorInsiders)
+	case string(config.IDECursor):
+		return vscode.ReadyCommand(vscode.FlavorCursor)
+	case string(config.IDECodium):
+		return vscode.ReadyCommand(vscode.FlavorCodium)
+	case string(config.IDEPositron):
+		return vscode.ReadyCommand(vscode.FlavorPositron)
+	case string(config.IDEZed):
+		// the client uploads its server over ssh when it connects, so the
+		// workspace only has to accept ssh as the user
+		return "true"
+	}
+	if server := jetbrainsServer(ideName, user, options, log); server != nil {
+		return server.ReadyCommand()
+	}
+	return ""
+}
+
+// waitUntilReady runs probe until it succeeds, ctx is done or timeout has
+// passed, which is reported as errIDENotReady.
+func waitUntilReady(ctx context.Context, timeout time.Duration, probe func(ctx context.Context) error, log log.Logger) error {
+	deadline := time.Now().Add(timeout)
+	for {
+		err := probe(ctx)
+		if err == nil {
+			return nil
+		} else if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		log.Debugf("IDE server not ready: %v", err)
+
+		if time.Now().After(deadline) {
+			return errIDENotReady
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(ideReadyInterval):
+		}
+	}
+}
+
+// jetbrainsServer returns the backend of a JetBrains IDE or nil if ideName
+// is not a JetBrains IDE.
+func jetbrainsServer(ideName, user string, options map[string]config.OptionValue, log log.Logger) *jetbrains.GenericJetBrainsServer {
+	switch ideName {
+	case string(config.IDERustRover):
+		return jetbrains.NewRustRoverServer(user, options, log)
+	case string(config.IDEGoland):
+		return jetbrains.NewGolandServer(user, options, log)
+	case string(config.IDEPyCharm):
+		return jetbrains.NewPyCharmServer(user, options, log)
+	case string(config.IDEPhpStorm):
+		return jetbrains.NewPhpStorm(user, options, log)
+	case string(config.IDEIntellij):
+		return jetbrains.NewIntellij(user, options, log)
+	case string(config.IDECLion):
+		return jetbrains.NewCLionServer(user, options, log)
+	case string(config.IDERider):
+		return jetbrains.NewRiderServer(user, options, log)
+	case string(config.IDERubyMine):
+		return jetbrains.NewRubyMineServer(user, options, log)
+	case string(config.IDEWebStorm):
+		return jetbrains.NewWebStormServer(user, options, log)
+	case string(config.IDEDataSpell):
+		return jetbrains.NewDataSpellServer(user, options, log)
+	}
+	return nil
+}
@@ -0,0 +1,111 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/loft-sh/devpod/pkg/config"
+	"github.com/loft-sh/log"
+)
+
+func TestIDEReadyCommand(t *testing.T) {
+	tests := []struct {
+		ide  config.IDE
+		want string
+	}{
+		{ide: config.IDEVSCode, want: `test -f "$HOME/.vscode-server/data/Machine/settings.json"`},
+		{ide: config.IDEVSCodeInsiders, want: `test -f "$HOME/.vscode-server-insiders/data/Machine/settings.json"`},
+		{ide: config.IDECursor, want: `test -f "$HOME/.cursor-server/data/Machine/settings.json"`},
+		{ide: config.IDECodium, want: `test -f "$HOME/.vscodium-server/data/Machine/settings.json"`},
+		{ide: config.IDEPositron, want: `test -f "$HOME/.positron-server/data/Machine/settings.json"`},
+		{ide: config.IDEZed, want: "true"},
+		{ide: config.IDEGoland, want: `test -x "$HOME/.cache/JetBrains/RemoteDev/dist/goland/bin/remote-dev-server.sh"`},
+		{ide: config.IDEIntellij, want: `test -x "$HOME/.cache/JetBrains/RemoteDev/dist/intellij/bin/remote-dev-server.sh"`},
+		{ide: config.IDEJupyterNotebook, want: ""},
+		{ide: config.IDENone, want: ""},
+	}
+	for _, test := range tests {
+		t.Run(string(test.ide), func(t *testing.T) {
+			// the user name never ends up in the command
+			got := ideReadyCommand(string(test.ide), "dev; rm -rf /", nil, log.Discard)
+			if got != test.want {
+				t.Fatalf("got %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestJetbrainsServer(t *testing.T) {
+	for ide, id := range map[config.IDE]string{
+		config.IDERustRover: "rustrover",
+		config.IDEGoland:    "goland",
+		config.IDEPyCharm:   "pycharm",
+		config.IDEPhpStorm:  "phpstorm",
+		config.IDEIntellij:  "intellij",
+		config.IDECLion:     "clion",
+		config.IDERider:     "rider",
+		config.IDERubyMine:  "rubymine",
+		config.IDEWebStorm:  "webstorm",
+		config.IDEDataSpell: "dataspell",
+	} {
+		server := jetbrainsServer(string(ide), "dev", nil, log.Discard)
+		if server == nil {
+			t.Errorf("%s has no JetBrains server", ide)
+			continue
+		}
+		if want := `test -x "$HOME/.cache/JetBrains/RemoteDev/dist/` + id + `/bin/remote-dev-server.sh"`; server.ReadyCommand() != want {
+			t.Errorf("%s waits for %q, want %q", ide, server.ReadyCommand(), want)
+		}
+	}
+	for _, ide := range []config.IDE{config.IDEVSCode, config.IDEFleet, config.IDENone} {
+		if jetbrainsServer(string(ide), "dev", nil, log.Discard) != nil {
+			t.Errorf("expected no JetBrains server for %s", ide)
+		}
+	}
+}
+
+func TestWaitUntilReady(t *testing.T) {
+	interval := ideReadyInterval
+	ideReadyInterval = time.Millisecond
+	t.Cleanup(func() { ideReadyInterval = interval })
+
+	t.Run("ready", func(t *testing.T) {
+		probes := 0
+		err := waitUntilReady(context.Background(), time.Minute, func(ctx context.Context) error {
+			if probes++; probes < 3 {
+				return errors.New("exit status 1")
+			}
+			return nil
+		}, log.Discard)
+		if err != nil || probes != 3 {
+			t.Fatalf("got %v after %d probes, want ready after 3", err, probes)
+		}
+	})
+
+	t.Run("timeout", func(t *testing.T) {
+		probes := 0
+		err := waitUntilReady(context.Background(), 20*time.Millisecond, func(ctx context.Context) error {
+			probes++
+			return errors.New("exit status 1")
+		}, log.Discard)
+		if !errors.Is(err, errIDENotReady) || probes < 2 {
+			t.Fatalf("got %v after %d probes, want errIDENotReady", err, probes)
+		}
+	})
+
+	t.Run("canceled", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		probes := 0
+		err := waitUntilReady(ctx, time.Minute, func(ctx context.Context) error {
+			if probes++; probes == 2 {
+				cancel()
+			}
+			return errors.New("exit status 1")
+		}, log.Discard)
+		if !errors.Is(err, context.Canceled) || probes != 2 {
+			t.Fatalf("got %v after %d probes, want context.Canceled after 2", err, probes)
+		}
+	})
+}
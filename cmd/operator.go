@@ -0,0 +1,225 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/go-logr/logr/funcr"
+	"github.com/loft-sh/devpod/cmd/flags"
+	client2 "github.com/loft-sh/devpod/pkg/client"
+	"github.com/loft-sh/devpod/pkg/config"
+	"github.com/loft-sh/devpod/pkg/operator"
+	"github.com/loft-sh/devpod/pkg/operator/api/v1alpha1"
+	workspace2 "github.com/loft-sh/devpod/pkg/workspace"
+	"github.com/loft-sh/devpod/pkg/workspacestate"
+	"github.com/loft-sh/log"
+	"github.com/spf13/cobra"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/healthz"
+	metricsserver "sigs.k8s.io/controller-runtime/pkg/metrics/server"
+)
+
+// OperatorCmd holds the operator cmd flags
+type OperatorCmd struct {
+	*flags.GlobalFlags
+
+	MetricsAddress          string
+	ProbeAddress            string
+	LeaderElect             bool
+	LeaderElectionNamespace string
+	ResyncPeriod            time.Duration
+	URLTemplate             string
+	Concurrency             int
+}
+
+// NewOperatorCmd creates a new command
+func NewOperatorCmd(f *flags.GlobalFlags) *cobra.Command {
+	cmd := &OperatorCmd{
+		GlobalFlags: f,
+	}
+	operatorCmd := &cobra.Command{
+		Use:   "operator",
+		Short: "Manage workspaces declared as Workspace resources",
+	}
+
+	runCmd := &cobra.Command{
+		Use:   "run",
+		Short: "Runs the operator",
+		Long: `Runs the operator, which creates, starts, stops and deletes a workspace
+for every Workspace resource of the cluster, the same way kled up, stop and
+delete do. Workspaces are kept in the kled home of the operator, so it
+should be on a persistent volume.
+
+Install the Workspace resource first with:
+  kled operator crd | kubectl apply -f -`,
+		Args: cobra.NoArgs,
+		RunE: func(cobraCmd *cobra.Command, args []string) error {
+			ctx, cancel := WithSignals(cobraCmd.Context())
+			defer cancel()
+
+			return cmd.Run(ctx)
+		},
+	}
+	runCmd.Flags().StringVar(&cmd.MetricsAddress, "metrics-bind-address", ":8080", "The address the metrics endpoint binds to, 0 to disable it")
+	runCmd.Flags().StringVar(&cmd.ProbeAddress, "health-probe-bind-address", ":8081", "The address the health probe endpoints bind to")
+	runCmd.Flags().BoolVar(&cmd.LeaderElect, "leader-elect", false, "If true only one of several operator replicas manages workspaces at a time")
+	runCmd.Flags().StringVar(&cmd.LeaderElectionNamespace, "leader-election-namespace", "", "The namespace of the leader election lease, the namespace of the operator if empty")
+	runCmd.Flags().DurationVar(&cmd.ResyncPeriod, "resync-period", 5*time.Minute, "How often workspaces are checked for drift from their spec")
+	runCmd.Flags().StringVar(&cmd.URLTemplate, "url-template", "", "The URL of running workspaces, {id} is replaced with the workspace id, e.g. https://{id}.workspaces.example.com")
+	runCmd.Flags().IntVar(&cmd.Concurrency, "concurrency", 4, "The number of workspaces to change at the same time")
+	operatorCmd.AddCommand(runCmd)
+
+	operatorCmd.AddCommand(&cobra.Command{
+		Use:   "crd",
+		Short: "Prints the CustomResourceDefinition of the Workspace resource",
+		Args:  cobra.NoArgs,
+		RunE: func(cobraCmd *cobra.Command, args []string) error {
+			_, err := os.Stdout.Write(operator.CRD)
+			return err
+		},
+	})
+	return operatorCmd
+}
+
+// Run runs the command logic
+func (cmd *OperatorCmd) Run(ctx context.Context) error {
+	// controller-runtime logs through the kled logger
+	verbosity := 0
+	if cmd.Debug {
+		verbosity = 1
+	}
+	ctrl.SetLogger(funcr.New(func(prefix, args string) {
+		log.Default.Info(prefix + " " + args)
+	}, funcr.Options{Verbosity: verbosity}))
+
+	scheme := runtime.NewScheme()
+	if err := clientgoscheme.AddToScheme(scheme); err != nil {
+		return err
+	}
+	if err := v1alpha1.AddToScheme(scheme); err != nil {
+		return err
+	}
+
+	restConfig, err := ctrl.GetConfig()
+	if err != nil {
+		return fmt.Errorf("get kubernetes config: %w", err)
+	}
+	mgr, err := ctrl.NewManager(restConfig, ctrl.Options{
+		Scheme:                  scheme,
+		Metrics:                 metricsserver.Options{BindAddress: cmd.MetricsAddress},
+		HealthProbeBindAddress:  cmd.ProbeAddress,
+		LeaderElection:          cmd.LeaderElect,
+		LeaderElectionID:        "kled-operator",
+		LeaderElectionNamespace: cmd.LeaderElectionNamespace,
+	})
+	if err != nil {
+		return fmt.Errorf("create manager: %w", err)
+	}
+	if err := mgr.AddHealthzCheck("healthz", healthz.Ping); err != nil {
+		return err
+	}
+	if err := mgr.AddReadyzCheck("readyz", healthz.Ping); err != nil {
+		return err
+	}
+
+	reconciler := &operator.Reconciler{
+		Client:                  mgr.GetClient(),
+		Workspaces:              &cliWorkspaces{GlobalFlags: cmd.GlobalFlags},
+		ResyncPeriod:            cmd.ResyncPeriod,
+		URLTemplate:             cmd.URLTemplate,
+		MaxConcurrentReconciles: cmd.Concurrency,
+	}
+	if err := reconciler.SetupWithManager(mgr); err != nil {
+		return fmt.Errorf("set up workspace controller: %w", err)
+	}
+
+	log.Default.Info("Starting the workspace operator")
+	return mgr.Start(ctx)
+}
+
+// cliWorkspaces changes workspaces for the operator with the code of kled up,
+// stop, delete and status.
+type cliWorkspaces struct {
+	*flags.GlobalFlags
+}
+
+func (w *cliWorkspaces) Up(ctx context.Context, id string, spec v1alpha1.WorkspaceSpec) error {
+	kledConfig, err := config.LoadConfig(w.Context, spec.Provider)
+	if err != nil {
+		return err
+	}
+
+	upCmd := &UpCmd{
+		GlobalFlags:     w.GlobalFlags,
+		ProviderOptions: operator.ProviderOptions(spec),
+	}
+	upCmd.ID = id
+	upCmd.IDE = string(config.IDENone)
+	upCmd.DevContainerPath = spec.DevContainerPath
+	if spec.Network != nil {
+		upCmd.Network = spec.Network.Mode
+		upCmd.AllowEgress = spec.Network.AllowEgress
+	}
+	if spec.DNS != nil {
+		upCmd.ExtraHosts = spec.DNS.ExtraHosts
+		upCmd.DNS = spec.DNS.Servers
+		upCmd.DNSSearch = spec.DNS.Search
+	}
+
+	client, logger, err := upCmd.prepareClient(ctx, kledConfig, []string{spec.Repository})
+	if err != nil {
+		return fmt.Errorf("prepare workspace client: %w", err)
+	}
+
+	return upCmd.Run(ctx, kledConfig, client, []string{spec.Repository}, logger)
+}
+
+func (w *cliWorkspaces) Stop(ctx context.Context, id string) error {
+	kledConfig, err := config.LoadConfig(w.Context, "")
+	if err != nil {
+		return err
+	}
+
+	client, err := workspace2.Get(ctx, kledConfig, []string{id}, false, w.Owner, log.Default)
+	if err != nil {
+		return err
+	}
+
+	stopCmd := &StopCmd{GlobalFlags: w.GlobalFlags}
+	return stopCmd.Run(ctx, kledConfig, client, log.Default)
+}
+
+func (w *cliWorkspaces) Delete(ctx context.Context, id string) error {
+	kledConfig, err := config.LoadConfig(w.Context, "")
+	if err != nil {
+		return err
+	}
+
+	_, err = workspace2.Delete(ctx, kledConfig, []string{id}, true, false, client2.DeleteOptions{IgnoreNotFound: true}, w.Owner, log.Default)
+	return err
+}
+
+func (w *cliWorkspaces) State(ctx context.Context, id string) (*workspacestate.State, error) {
+	kledConfig, err := config.LoadConfig(w.Context, "")
+	if err != nil {
+		return nil, err
+	}
+	if workspace2.Exists(ctx, kledConfig, nil, id, w.Owner, log.Default) == "" {
+		return nil, nil
+	}
+
+	client, err := workspace2.Get(ctx, kledConfig, []string{id}, false, w.Owner, log.Default)
+	if err != nil {
+		return nil, err
+	}
+	instanceStatus, err := client.Status(ctx, client2.StatusOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	return reconcileWorkspaceState(client, instanceStatus, log.Default), nil
+}
@@ -0,0 +1,191 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/docker/go-connections/nat"
+	"github.com/loft-sh/devpod/cmd/completion"
+	"github.com/loft-sh/devpod/cmd/flags"
+	client2 "github.com/loft-sh/devpod/pkg/client"
+	"github.com/loft-sh/devpod/pkg/config"
+	"github.com/loft-sh/devpod/pkg/portmanager"
+	provider2 "github.com/loft-sh/devpod/pkg/provider"
+	workspace2 "github.com/loft-sh/devpod/pkg/workspace"
+	"github.com/loft-sh/log"
+	"github.com/loft-sh/log/table"
+	"github.com/spf13/cobra"
+)
+
+// PortsCmd holds the ports cmd flags
+type PortsCmd struct {
+	*flags.GlobalFlags
+
+	Output string
+}
+
+// portEntry is a port of the workspace, forwarded or only configured
+type portEntry struct {
+	Source    portmanager.Source `json:"source"`
+	Remote    string             `json:"remote"`
+	Local     string             `json:"local,omitempty"`
+	Public    bool               `json:"public"`
+	Forwarded bool               `json:"forwarded"`
+	PID       int                `json:"pid,omitempty"`
+	StartedAt *time.Time         `json:"startedAt,omitempty"`
+}
+
+// NewPortsCmd creates a new command
+func NewPortsCmd(flags *flags.GlobalFlags) *cobra.Command {
+	cmd := &PortsCmd{
+		GlobalFlags: flags,
+	}
+	portsCmd := &cobra.Command{
+		Use:   "ports [flags] [workspace-path|workspace-name]",
+		Short: "Lists the forwarded and configured ports of a workspace",
+		Long: `Lists the ports of a workspace: the appPort and forwardPorts of the
+devcontainer.json and the ports detected in the running container. Ports are
+forwarded while an ssh session or IDE is connected. If a local port is taken,
+the next free port is used.
+
+Ports are bound on localhost. To bind them on all interfaces run:
+  kled context set-options -o PUBLIC_PORTS=true`,
+		RunE: func(cobraCmd *cobra.Command, args []string) error {
+			kledConfig, err := config.LoadConfig(cmd.Context, cmd.Provider)
+			if err != nil {
+				return err
+			}
+
+			client, err := workspace2.Get(cobraCmd.Context(), kledConfig, args, false, cmd.Owner, log.Default.ErrorStreamOnly())
+			if err != nil {
+				return err
+			}
+
+			return cmd.Run(cobraCmd.Context(), client)
+		},
+		ValidArgsFunction: func(rootCmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+			return completion.GetWorkspaceSuggestions(rootCmd, cmd.Context, cmd.Provider, args, toComplete, cmd.Owner, log.Default)
+		},
+	}
+
+	portsCmd.Flags().StringVar(&cmd.Output, "output", "plain", "The output format to use. Can be json or plain")
+	return portsCmd
+}
+
+// Run runs the command logic
+func (cmd *PortsCmd) Run(ctx context.Context, client client2.BaseWorkspaceClient) error {
+	forwards, err := portmanager.List(client.Context(), client.Workspace())
+	if err != nil {
+		return fmt.Errorf("list forwarded ports: %w", err)
+	}
+
+	entries := []portEntry{}
+	forwardedRemotes := map[string]bool{}
+	for _, forward := range forwards {
+		startedAt := forward.StartedAt
+		entries = append(entries, portEntry{
+			Source:    forward.Source,
+			Remote:    forward.Remote,
+			Local:     forward.Local,
+			Public:    forward.Public(),
+			Forwarded: true,
+			PID:       forward.PID,
+			StartedAt: &startedAt,
+		})
+		forwardedRemotes[forward.Remote] = true
+	}
+
+	// configured ports that are not forwarded right now
+	for _, entry := range configuredPorts(client) {
+		if !forwardedRemotes[entry.Remote] {
+			entries = append(entries, entry)
+		}
+	}
+
+	if cmd.Output == "json" {
+		out, err := json.MarshalIndent(entries, "", "  ")
+		if err != nil {
+			return err
+		}
+
+		fmt.Print(string(out))
+		return nil
+	} else if cmd.Output != "plain" {
+		return fmt.Errorf("unexpected output format, choose either json or plain. Got %s", cmd.Output)
+	}
+
+	if len(entries) == 0 {
+		log.Default.Infof("Workspace '%s' has no forwarded or configured ports", client.Workspace())
+		return nil
+	}
+
+	tableEntries := [][]string{}
+	for _, entry := range entries {
+		binding, status, pid := "", "Not forwarded", ""
+		if entry.Forwarded {
+			binding, status, pid = "localhost", "Forwarded", strconv.Itoa(entry.PID)
+			if entry.Public {
+				binding = "public"
+			}
+		}
+
+		tableEntries = append(tableEntries, []string{
+			string(entry.Source),
+			entry.Remote,
+			entry.Local,
+			binding,
+			status,
+			pid,
+		})
+	}
+
+	table.PrintTable(log.Default, []string{
+		"Source",
+		"Remote",
+		"Local",
+		"Binding",
+		"Status",
+		"PID",
+	}, tableEntries)
+	return nil
+}
+
+// configuredPorts returns the appPort and forwardPorts of the last result
+// of the workspace
+func configuredPorts(client client2.BaseWorkspaceClient) []portEntry {
+	result, err := provider2.LoadWorkspaceResult(client.Context(), client.Workspace())
+	if err != nil || result == nil || result.MergedConfig == nil {
+		return nil
+	}
+
+	entries := []portEntry{}
+	for _, appPort := range result.MergedConfig.AppPort {
+		parsed, err := nat.ParsePortSpec(appPort)
+		if err != nil {
+			continue
+		}
+
+		for _, parsedPort := range parsed {
+			entries = append(entries, portEntry{
+				Source: portmanager.SourceAppPort,
+				Remote: "localhost:" + parsedPort.Port.Port(),
+			})
+		}
+	}
+	for _, forwardPort := range result.MergedConfig.ForwardPorts {
+		remote := forwardPort
+		if _, err := strconv.Atoi(forwardPort); err == nil {
+			remote = "localhost:" + forwardPort
+		}
+
+		entries = append(entries, portEntry{
+			Source: portmanager.SourceForwardPorts,
+			Remote: remote,
+		})
+	}
+
+	return entries
+}
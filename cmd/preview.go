@@ -0,0 +1,336 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/alessio/shellescape"
+	"github.com/loft-sh/devpod/cmd/flags"
+	client2 "github.com/loft-sh/devpod/pkg/client"
+	"github.com/loft-sh/devpod/pkg/config"
+	config2 "github.com/loft-sh/devpod/pkg/devcontainer/config"
+	"github.com/loft-sh/devpod/pkg/platform"
+	provider2 "github.com/loft-sh/devpod/pkg/provider"
+	"github.com/loft-sh/devpod/pkg/random"
+	"github.com/loft-sh/devpod/pkg/tunnel"
+	workspace2 "github.com/loft-sh/devpod/pkg/workspace"
+	"github.com/loft-sh/log"
+	"github.com/spf13/cobra"
+)
+
+// previewSource is what a preview environment was built from, sent along
+// with its link
+type previewSource struct {
+	Repository string `json:"repository"`
+	Ref        string `json:"ref,omitempty"`
+}
+
+// PreviewCmd holds the preview cmd flags
+type PreviewCmd struct {
+	*flags.GlobalFlags
+
+	Repository string
+	Ref        string
+	Task       string
+	Port       int
+	TTL        time.Duration
+	Wait       time.Duration
+
+	ID               string
+	DevContainerPath string
+	ProviderOptions  []string
+
+	Server  string
+	APIKey  string
+	Project string
+}
+
+// NewPreviewCmd creates a new command
+func NewPreviewCmd(flags *flags.GlobalFlags) *cobra.Command {
+	previewCmd := &cobra.Command{
+		Use:   "preview",
+		Short: "Short-lived preview environments of a branch",
+	}
+
+	previewCmd.AddCommand(NewPreviewCreateCmd(flags))
+	previewCmd.AddCommand(NewPreviewPruneCmd(flags))
+	return previewCmd
+}
+
+// NewPreviewCreateCmd creates a new command
+func NewPreviewCreateCmd(flags *flags.GlobalFlags) *cobra.Command {
+	cmd := &PreviewCmd{
+		GlobalFlags: flags,
+	}
+	createCmd := &cobra.Command{
+		Use:   "create",
+		Short: "Builds a branch and exposes its app on a public link until the TTL ends",
+		Long: `Builds a workspace from the given repository and ref, starts its app task in
+the background and exposes the port of the task on a public link served by the
+kled server. The server publishes the link as a workspace.preview_ready event.
+
+The app task is declared in the customizations of the devcontainer.json, the
+port can also be given with --port:
+
+  "customizations": {
+    "kled": {
+      "tasks": {
+        "app": {"command": "npm start", "dependsOn": ["build"], "port": 3000}
+      }
+    }
+  }
+
+The workspace is deleted when the TTL ends or this command is interrupted. Its
+expiry is also recorded as the kled.sh/expires-at label of the workspace, so
+the reconciler of the kled server deletes the pod of a preview on Kubernetes
+whose command went away, and kled preview prune deletes expired local ones.
+Tunnels are disabled unless the server sets TUNNELS_ENABLED.
+
+Example:
+  kled preview create --repo github.com/my-org/my-repo --ref feature-x --ttl 4h`,
+		Args: cobra.NoArgs,
+		RunE: func(cobraCmd *cobra.Command, args []string) error {
+			// the workspace would be built only for the server to reject its link
+			if err := tunnel.ValidateTTL(cmd.TTL); err != nil {
+				return err
+			}
+			if cmd.Server == "" {
+				return fmt.Errorf("no server specified, use --server or KLED_SERVER_URL")
+			}
+			kledConfig, err := config.LoadConfig(cmd.Context, cmd.Provider)
+			if err != nil {
+				return err
+			}
+
+			ctx, cancel := WithSignals(cobraCmd.Context())
+			defer cancel()
+
+			upCmd := &UpCmd{GlobalFlags: cmd.GlobalFlags}
+			upCmd.IDE = string(config.IDENone)
+			upCmd.ID = cmd.ID
+			if upCmd.ID == "" {
+				upCmd.ID = previewID(cmd.Repository)
+			}
+			upCmd.DevContainerPath = cmd.DevContainerPath
+			upCmd.ProviderOptions = cmd.ProviderOptions
+			upCmd.Labels = []string{provider2.ExpiresAtLabel + "=" + strconv.FormatInt(time.Now().Add(cmd.TTL).Unix(), 10)}
+
+			// previews of earlier runs that weren't deleted
+			pruneExpiredWorkspaces(ctx, kledConfig, cmd.Owner, log.Default)
+			client, logger, err := upCmd.prepareClient(ctx, kledConfig, []string{previewRef(cmd.Repository, cmd.Ref)})
+			if err != nil {
+				return fmt.Errorf("prepare workspace client: %w", err)
+			}
+
+			return cmd.Run(ctx, kledConfig, upCmd, client, logger)
+		},
+	}
+
+	createCmd.Flags().StringVar(&cmd.Repository, "repo", "", "The git repository to build, e.g. github.com/my-org/my-repo")
+	createCmd.Flags().StringVar(&cmd.Ref, "ref", "", "The branch to build, defaults to the default branch of the repository")
+	createCmd.Flags().StringVar(&cmd.Task, "task", "app", "The task that serves the app")
+	createCmd.Flags().IntVarP(&cmd.Port, "port", "p", 0, "The port the app serves on, defaults to the port of the task")
+	createCmd.Flags().DurationVar(&cmd.TTL, "ttl", 2*time.Hour, "How long the preview lives before it is deleted, at most 24h")
+	createCmd.Flags().DurationVar(&cmd.Wait, "wait", 5*time.Minute, "How long to wait for the app to listen on its port")
+	createCmd.Flags().StringVar(&cmd.ID, "id", "", "The id to use for the workspace, generated from the repository if empty")
+	createCmd.Flags().StringVar(&cmd.DevContainerPath, "devcontainer-path", "", "The path to the devcontainer.json relative to the project")
+	createCmd.Flags().StringArrayVarP(&cmd.ProviderOptions, "provider-option", "o", []string{}, "Provider option in the form KEY=VALUE")
+	createCmd.Flags().StringVar(&cmd.Server, "server", os.Getenv("KLED_SERVER_URL"), "The Kled server URL. You can also use KLED_SERVER_URL to set this")
+	createCmd.Flags().StringVar(&cmd.APIKey, "api-key", os.Getenv("KLED_API_KEY"), "The API key to authenticate with. You can also use KLED_API_KEY to set this")
+	createCmd.Flags().StringVar(&cmd.Project, "project", os.Getenv("KLED_PROJECT"), "The project the preview belongs to. You can also use KLED_PROJECT to set this")
+	_ = createCmd.MarkFlagRequired("repo")
+	return createCmd
+}
+
+// Run runs the command logic
+func (cmd *PreviewCmd) Run(ctx context.Context, kledConfig *config.Config, upCmd *UpCmd, client client2.BaseWorkspaceClient, log log.Logger) (err error) {
+	defer func() {
+		// tear down even if the preview was interrupted
+		deleteCtx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
+		defer cancel()
+		log.Infof("Deleting preview workspace '%s'", client.Workspace())
+		_, deleteErr := workspace2.Delete(deleteCtx, kledConfig, []string{client.Workspace()}, true, true, client2.DeleteOptions{}, cmd.Owner, log)
+		if deleteErr != nil {
+			log.Errorf("Error deleting workspace '%s': %v", client.Workspace(), deleteErr)
+			if err == nil {
+				err = deleteErr
+			}
+		}
+	}()
+
+	result, err := upCmd.kledUp(ctx, kledConfig, client, log)
+	if err != nil {
+		return err
+	} else if result == nil {
+		return fmt.Errorf("didn't receive a result back from agent")
+	}
+	if failedHook := config2.FailedLifecycleHook(result); failedHook != nil {
+		return fmt.Errorf("lifecycle hook %s failed: %s", failedHook.Hook, failedHook.Error)
+	}
+
+	var devContainer *config2.DevContainerConfig
+	if result.DevContainerConfigWithPath != nil {
+		devContainer = result.DevContainerConfigWithPath.Config
+	}
+	tasks, err := config2.GetTasks(devContainer)
+	if err != nil {
+		return err
+	}
+	ordered, err := config2.ResolveTasks(tasks, []string{cmd.Task})
+	if err != nil {
+		return err
+	}
+	app := tasks[cmd.Task]
+	port := cmd.Port
+	if port == 0 {
+		port = app.Port
+	}
+	if port < 1 || port > 65535 {
+		return fmt.Errorf("task %s declares no port, use --port", cmd.Task)
+	}
+
+	// the tasks the app depends on run to completion first
+	user := config2.GetRemoteUser(result)
+	workdir := result.SubstitutionContext.ContainerWorkspaceFolder
+	for _, name := range ordered[:len(ordered)-1] {
+		log.Infof("Running task %s", name)
+		if err := runTask(ctx, client, log, user, workdir, tasks[name]); err != nil {
+			return fmt.Errorf("task %s failed: %w", name, err)
+		}
+	}
+
+	appLog := "/tmp/kled-preview-" + cmd.Task + ".log"
+	log.Infof("Starting task %s, its output goes to %s", cmd.Task, appLog)
+	background := "nohup sh -c " + shellescape.Quote(taskScript(app)) + " > " + shellescape.Quote(appLog) + " 2>&1 < /dev/null &"
+	if err := cmd.ssh(ctx, client, log, user, taskWorkdir(workdir, app), background); err != nil {
+		return fmt.Errorf("start task %s: %w", cmd.Task, err)
+	}
+	if err := cmd.waitForPort(ctx, client, log, user, workdir, port); err != nil {
+		_ = cmd.ssh(ctx, client, log, user, workdir, "tail -n 50 "+shellescape.Quote(appLog))
+		return err
+	}
+
+	share := &ShareCmd{
+		GlobalFlags: cmd.GlobalFlags,
+		Port:        port,
+		TTL:         cmd.TTL,
+		Server:      cmd.Server,
+		APIKey:      cmd.APIKey,
+		Project:     cmd.Project,
+		preview:     &previewSource{Repository: cmd.Repository, Ref: cmd.Ref},
+	}
+	target, stop, err := share.localTarget(ctx, client, log)
+	if err != nil {
+		return err
+	}
+	defer stop()
+
+	response, err := share.createTunnel(ctx, client.Workspace())
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if time.Now().Before(response.Tunnel.ExpiresAt) {
+			if err := share.revokeTunnel(response.Tunnel.ID); err != nil {
+				log.Warnf("Error revoking link: %v", err)
+			}
+		}
+	}()
+
+	log.Donef("Preview of %s is available at:\n\n  %s\n", previewRef(cmd.Repository, cmd.Ref), response.URL)
+	log.Infof("The preview is deleted at %s. Press Ctrl+C to delete it now", response.Tunnel.ExpiresAt.Local().Format(time.RFC1123))
+
+	relayCtx, cancel := context.WithDeadline(ctx, response.Tunnel.ExpiresAt)
+	defer cancel()
+	tunnelURL := strings.TrimSuffix(cmd.Server, "/") + "/api/tunnels/" + response.Tunnel.ID + "/"
+	err = tunnel.ServeRelay(relayCtx, tunnelURL, response.ConnectToken, target, log)
+	if err == nil && ctx.Err() == nil {
+		log.Info("Preview expired")
+	}
+	return err
+}
+
+// NewPreviewPruneCmd creates a new command
+func NewPreviewPruneCmd(flags *flags.GlobalFlags) *cobra.Command {
+	return &cobra.Command{
+		Use:   "prune",
+		Short: "Deletes the local workspaces whose expiry has passed",
+		Long: `Deletes the local workspaces whose kled.sh/expires-at label has passed, e.g.
+previews whose kled preview create was killed before the TTL ended. Run it
+from a cron job to clean up after interrupted previews.`,
+		Args: cobra.NoArgs,
+		RunE: func(cobraCmd *cobra.Command, args []string) error {
+			kledConfig, err := config.LoadConfig(flags.Context, flags.Provider)
+			if err != nil {
+				return err
+			}
+
+			pruneExpiredWorkspaces(cobraCmd.Context(), kledConfig, flags.Owner, log.Default)
+			return nil
+		},
+	}
+}
+
+// pruneExpiredWorkspaces deletes the local workspaces whose expiry label has
+// passed. Errors are only logged
+func pruneExpiredWorkspaces(ctx context.Context, kledConfig *config.Config, owner platform.OwnerFilter, log log.Logger) {
+	workspaces, err := workspace2.ListLocalWorkspaces(kledConfig.DefaultContext, true, log)
+	if err != nil {
+		log.Warnf("Error listing workspaces: %v", err)
+		return
+	}
+
+	now := time.Now()
+	for _, workspace := range workspaces {
+		expiresAt, err := strconv.ParseInt(workspace.Labels[provider2.ExpiresAtLabel], 10, 64)
+		if err != nil || now.Before(time.Unix(expiresAt, 0)) {
+			continue
+		}
+
+		log.Infof("Deleting expired workspace '%s'", workspace.ID)
+		_, err = workspace2.Delete(ctx, kledConfig, []string{workspace.ID}, true, true, client2.DeleteOptions{}, owner, log)
+		if err != nil {
+			log.Warnf("Error deleting workspace '%s': %v", workspace.ID, err)
+		}
+	}
+}
+
+// waitForPort waits until a process in the workspace listens on port
+func (cmd *PreviewCmd) waitForPort(ctx context.Context, client client2.BaseWorkspaceClient, log log.Logger, user, workdir string, port int) error {
+	log.Infof("Waiting for the app to listen on port %d", port)
+	script := fmt.Sprintf(`i=0; while [ $i -lt %d ]; do grep -qE ':%04X [0-9A-F]+:[0-9A-F]+ 0A' /proc/net/tcp /proc/net/tcp6 2>/dev/null && exit 0; i=$((i+1)); sleep 1; done; exit 1`, int(cmd.Wait.Seconds()), port)
+	if err := cmd.ssh(ctx, client, log, user, workdir, script); err != nil {
+		return fmt.Errorf("task %s didn't listen on port %d within %s", cmd.Task, port, cmd.Wait)
+	}
+	return nil
+}
+
+func (cmd *PreviewCmd) ssh(ctx context.Context, client client2.BaseWorkspaceClient, log log.Logger, user, workdir, script string) error {
+	sshCmd, err := createSSHCommand(ctx, client, log, []string{"--user", user, "--workdir", workdir, "--command", script})
+	if err != nil {
+		return err
+	}
+	sshCmd.Stdout = os.Stdout
+	sshCmd.Stderr = os.Stderr
+	return sshCmd.Run()
+}
+
+// previewID returns a workspace id for a new preview of the repository
+func previewID(repository string) string {
+	name := workspace2.ToID(repository)
+	if len(name) > 32 {
+		name = strings.Trim(name[:32], "-")
+	}
+	return "preview-" + name + "-" + random.String(5)
+}
+
+func previewRef(repository, ref string) string {
+	if ref == "" {
+		return repository
+	}
+	return repository + "@" + ref
+}
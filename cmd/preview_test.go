@@ -0,0 +1,36 @@
+package cmd
+
+import (
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/loft-sh/devpod/cmd/flags"
+)
+
+func TestPreviewCreateValidatesTTL(t *testing.T) {
+	tests := []struct {
+		ttl     string
+		wantErr string
+	}{
+		{ttl: "30s", wantErr: "invalid ttl 30s"},
+		{ttl: "48h", wantErr: "invalid ttl 48h0m0s"},
+		{ttl: "0s", wantErr: "invalid ttl 0s"},
+		// a valid ttl only fails on the missing server
+		{ttl: "1m", wantErr: "no server specified"},
+		{ttl: "24h", wantErr: "no server specified"},
+	}
+	for _, test := range tests {
+		t.Run(test.ttl, func(t *testing.T) {
+			createCmd := NewPreviewCreateCmd(&flags.GlobalFlags{})
+			createCmd.SetArgs([]string{"--repo", "github.com/my-org/my-repo", "--server", "", "--ttl", test.ttl})
+			createCmd.SetOut(io.Discard)
+			createCmd.SetErr(io.Discard)
+
+			err := createCmd.Execute()
+			if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+				t.Fatalf("got error %v, want %q", err, test.wantErr)
+			}
+		})
+	}
+}
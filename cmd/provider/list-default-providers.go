@@ -10,6 +10,7 @@ import (
 
 	"github.com/loft-sh/devpod/cmd/flags"
 	devpodhttp "github.com/loft-sh/devpod/pkg/http"
+	"github.com/loft-sh/devpod/pkg/providerplugin"
 	"github.com/spf13/cobra"
 )
 
@@ -70,5 +71,13 @@ func NewListAvailableCmd(flags *flags.GlobalFlags) *cobra.Command {
 
 // Run runs the command logic
 func (cmd *ListAvailableCmd) Run(ctx context.Context) error {
+	plugins := providerplugin.Discover()
+	if len(plugins) > 0 {
+		fmt.Println("List of provider plugins found on PATH:")
+		for _, name := range plugins {
+			fmt.Println("\t", name)
+		}
+	}
+
 	return getKledProviderList()
 }
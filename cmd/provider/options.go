@@ -6,10 +6,12 @@ import (
 	"fmt"
 	"sort"
 	"strconv"
+	"strings"
 
 	"github.com/loft-sh/devpod/cmd/completion"
 	"github.com/loft-sh/devpod/cmd/flags"
 	"github.com/loft-sh/devpod/pkg/config"
+	"github.com/loft-sh/devpod/pkg/options/resolver"
 	"github.com/loft-sh/devpod/pkg/types"
 	"github.com/loft-sh/devpod/pkg/workspace"
 	"github.com/loft-sh/log"
@@ -99,11 +101,21 @@ func printOptions(kledConfig *config.Config, provider *workspace.ProviderWithOpt
 				value = "********"
 			}
 
+			optionType := entry.Type
+			if optionType == "" {
+				optionType = "string"
+			}
+			if entry.Password {
+				optionType += " (secret)"
+			}
+
 			tableEntries = append(tableEntries, []string{
 				optionName,
+				optionType,
 				strconv.FormatBool(entry.Required),
 				entry.Description,
 				entry.Default,
+				strings.Join(resolver.EnumValues(entry.Enum), ", "),
 				value,
 			})
 		}
@@ -113,9 +125,11 @@ func printOptions(kledConfig *config.Config, provider *workspace.ProviderWithOpt
 
 		table.PrintTable(log.Default, []string{
 			"Name",
+			"Type",
 			"Required",
 			"Description",
 			"Default",
+			"Allowed",
 			"Value",
 		}, tableEntries)
 	} else if format == "json" {
@@ -125,10 +139,15 @@ func printOptions(kledConfig *config.Config, provider *workspace.ProviderWithOpt
 				continue
 			}
 
+			value := entryOptions[optionName].Value
+			if value != "" && entry.Password {
+				value = "********"
+			}
+
 			options[optionName] = optionWithValue{
 				Option:   *entry,
 				Children: entryOptions[optionName].Children,
-				Value:    entryOptions[optionName].Value,
+				Value:    value,
 			}
 		}
 
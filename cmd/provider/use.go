@@ -119,6 +119,23 @@ func ConfigureProvider(ctx context.Context, provider *provider2.ProviderConfig,
 	return nil
 }
 
+// InitProvider sets the options of a provider and initializes it like
+// ConfigureProvider, but keeps the default provider
+func InitProvider(ctx context.Context, provider *provider2.ProviderConfig, context string, userOptions []string, log log.Logger) error {
+	kledConfig, err := setOptions(ctx, provider, context, userOptions, false, false, false, false, nil, log)
+	if err != nil {
+		return err
+	}
+
+	err = config.SaveConfig(kledConfig)
+	if err != nil {
+		return errors.Wrap(err, "save config")
+	}
+
+	log.Donef("Successfully configured provider '%s'", provider.Name)
+	return nil
+}
+
 func setOptions(
 	ctx context.Context,
 	provider *provider2.ProviderConfig,
@@ -0,0 +1,65 @@
+package provider
+
+import (
+	"context"
+	"testing"
+
+	"github.com/loft-sh/devpod/pkg/config"
+	providerpkg "github.com/loft-sh/devpod/pkg/provider"
+	"github.com/loft-sh/devpod/pkg/types"
+	"github.com/loft-sh/log"
+)
+
+func TestInitProviderKeepsDefault(t *testing.T) {
+	tests := []struct {
+		name            string
+		defaultProvider string
+		options         []string
+		wantRegion      string
+	}{
+		{name: "other default", defaultProvider: "docker", wantRegion: "us-east-1"},
+		{name: "no default", wantRegion: "us-east-1"},
+		{name: "user options", defaultProvider: "docker", options: []string{"AWS_REGION=eu-west-1"}, wantRegion: "eu-west-1"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Setenv(config.KLED_HOME, t.TempDir())
+			kledConfig, err := config.LoadConfig("", "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			kledConfig.Current().DefaultProvider = test.defaultProvider
+			if err := config.SaveConfig(kledConfig); err != nil {
+				t.Fatal(err)
+			}
+			aws := &providerpkg.ProviderConfig{
+				Name: "aws",
+				Exec: providerpkg.ProviderCommands{Command: types.StrArray{"true"}},
+				Options: map[string]*types.Option{
+					"AWS_REGION": {Description: "The region to create machines in", Default: "us-east-1"},
+				},
+			}
+			if err := providerpkg.SaveProviderConfig(kledConfig.DefaultContext, aws); err != nil {
+				t.Fatal(err)
+			}
+
+			if err := InitProvider(context.Background(), aws, kledConfig.DefaultContext, test.options, log.Discard); err != nil {
+				t.Fatal(err)
+			}
+
+			kledConfig, err = config.LoadConfig("", "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := kledConfig.Current().DefaultProvider; got != test.defaultProvider {
+				t.Errorf("default provider changed to %q, want %q", got, test.defaultProvider)
+			}
+			if state := kledConfig.Current().Providers["aws"]; state == nil || !state.Initialized {
+				t.Errorf("expected aws to be initialized, got %+v", state)
+			}
+			if got := kledConfig.ProviderOptions("aws")["AWS_REGION"].Value; got != test.wantRegion {
+				t.Errorf("got AWS_REGION %q, want %q", got, test.wantRegion)
+			}
+		})
+	}
+}
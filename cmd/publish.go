@@ -0,0 +1,221 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/url"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/loft-sh/devpod/cmd/completion"
+	"github.com/loft-sh/devpod/cmd/flags"
+	client2 "github.com/loft-sh/devpod/pkg/client"
+	"github.com/loft-sh/devpod/pkg/config"
+	"github.com/loft-sh/devpod/pkg/sdk"
+	"github.com/loft-sh/devpod/pkg/sso"
+	workspace2 "github.com/loft-sh/devpod/pkg/workspace"
+	"github.com/loft-sh/log"
+	"github.com/spf13/cobra"
+)
+
+// PublishCmd holds the publish cmd flags
+type PublishCmd struct {
+	*flags.GlobalFlags
+
+	Branch     string
+	Base       string
+	Title      string
+	Message    string
+	Draft      bool
+	Forge      string
+	Token      string
+	Trajectory string
+	Summary    string
+	Template   string
+	Server     string
+	APIKey     string
+}
+
+// NewPublishCmd creates a new command
+func NewPublishCmd(flags *flags.GlobalFlags) *cobra.Command {
+	cmd := &PublishCmd{
+		GlobalFlags: flags,
+	}
+	publishCmd := &cobra.Command{
+		Use:   "publish [flags] [workspace-path|workspace-name]",
+		Short: "Opens a pull request with the changes of a workspace",
+		Long: `Commits the changes of a workspace to a branch, pushes it and opens a
+GitHub pull request or GitLab merge request for it. The description links the
+agent trajectory given with --trajectory.
+
+Your git credentials are forwarded to push and open the pull request: the
+token given with --token, GITHUB_TOKEN or GITLAB_TOKEN, or else the one your
+local git credential helper has for the repository. The server doesn't store
+them.`,
+		RunE: func(cobraCmd *cobra.Command, args []string) error {
+			kledConfig, err := config.LoadConfig(cmd.Context, cmd.Provider)
+			if err != nil {
+				return err
+			}
+
+			client, err := workspace2.Get(cobraCmd.Context(), kledConfig, args, false, cmd.Owner, log.Default.ErrorStreamOnly())
+			if err != nil {
+				return err
+			}
+
+			return cmd.Run(cobraCmd.Context(), client, log.Default)
+		},
+		ValidArgsFunction: func(rootCmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+			return completion.GetWorkspaceSuggestions(rootCmd, cmd.Context, cmd.Provider, args, toComplete, cmd.Owner, log.Default)
+		},
+	}
+
+	publishCmd.Flags().StringVar(&cmd.Branch, "branch", "", "The branch to push the changes to, kled/<workspace> by default")
+	publishCmd.Flags().StringVar(&cmd.Base, "base", "", "The branch the pull request targets, by default the one checked out in the workspace")
+	publishCmd.Flags().StringVar(&cmd.Title, "title", "", "The title of the pull request")
+	publishCmd.Flags().StringVarP(&cmd.Message, "message", "m", "", "The commit message, the title by default")
+	publishCmd.Flags().BoolVar(&cmd.Draft, "draft", false, "Open the pull request as a draft")
+	publishCmd.Flags().StringVar(&cmd.Forge, "forge", "", "github or gitlab, needed if the repository's host names neither")
+	publishCmd.Flags().StringVar(&cmd.Token, "token", "", "The token to push and open the pull request with")
+	publishCmd.Flags().StringVar(&cmd.Trajectory, "trajectory", "", "The ID of the agent trajectory to link in the description")
+	publishCmd.Flags().StringVar(&cmd.Summary, "summary", "", "A summary of the changes for the description")
+	publishCmd.Flags().StringVar(&cmd.Template, "template", "", "A file with a Go template for the description")
+	publishCmd.Flags().StringVar(&cmd.Server, "server", os.Getenv("KLED_SERVER_URL"), "The Kled server URL. You can also use KLED_SERVER_URL to set this")
+	publishCmd.Flags().StringVar(&cmd.APIKey, "api-key", os.Getenv("KLED_API_KEY"), "The API key to authenticate with. You can also use KLED_API_KEY to set this")
+	return publishCmd
+}
+
+// Run runs the command logic
+func (cmd *PublishCmd) Run(ctx context.Context, client client2.BaseWorkspaceClient, log log.Logger) error {
+	if cmd.Server == "" {
+		return fmt.Errorf("no server specified, use --server or KLED_SERVER_URL")
+	}
+	workspaceID := client.Workspace()
+
+	request := sdk.PublishRequest{
+		Branch:       cmd.Branch,
+		Base:         cmd.Base,
+		Title:        cmd.Title,
+		Message:      cmd.Message,
+		Draft:        cmd.Draft,
+		Forge:        cmd.Forge,
+		Token:        cmd.Token,
+		Summary:      cmd.Summary,
+		TrajectoryID: cmd.Trajectory,
+	}
+	if request.Branch == "" {
+		request.Branch = "kled/" + workspaceID
+	}
+	if request.Title == "" {
+		request.Title = "Changes from workspace " + workspaceID
+	}
+	if cmd.Template != "" {
+		template, err := os.ReadFile(cmd.Template)
+		if err != nil {
+			return fmt.Errorf("read template: %w", err)
+		}
+		request.Template = string(template)
+	}
+	if request.Token == "" {
+		request.Token = os.Getenv("GITHUB_TOKEN")
+	}
+	if request.Token == "" {
+		request.Token = os.Getenv("GITLAB_TOKEN")
+	}
+	if request.Token == "" {
+		var repository string
+		if workspace := client.WorkspaceConfig(); workspace != nil {
+			repository = workspace.Source.GitRepository
+		}
+		request.Username, request.Token = gitCredential(ctx, repository)
+		if request.Token == "" {
+			return fmt.Errorf("no git credentials found for %q, use --token, GITHUB_TOKEN or GITLAB_TOKEN", repository)
+		}
+	}
+	// commit as the local git user rather than the workspace's
+	request.AuthorName = gitConfig(ctx, "user.name")
+	request.AuthorEmail = gitConfig(ctx, "user.email")
+
+	sdkClient, err := sdk.New(sdk.Options{Server: cmd.Server, APIKey: cmd.APIKey, HTTPClient: sso.HTTPClient(cmd.Server)})
+	if err != nil {
+		return err
+	}
+	defer sdkClient.Close()
+
+	requestID := sdk.NewRequestID()
+	log.Infof("Publishing the changes of %s to %s", workspaceID, request.Branch)
+	log.Debugf("Request ID %s", requestID)
+	ctx, cancel := context.WithTimeout(sdk.WithRequestID(ctx, requestID), 5*time.Minute)
+	defer cancel()
+	result, err := sdkClient.Workspaces.Publish(ctx, workspaceID, request)
+	if err != nil {
+		return fmt.Errorf("publish workspace (request ID %s, see kled trace %s): %w", requestID, requestID, err)
+	}
+
+	if !result.Committed {
+		log.Info("No uncommitted changes, pushed the existing commits")
+	}
+	if result.PullRequest.Existing {
+		log.Donef("Updated pull request %s", result.PullRequest.URL)
+	} else {
+		log.Donef("Opened pull request %s", result.PullRequest.URL)
+	}
+	return nil
+}
+
+// gitCredential asks the local git credential helpers for the credentials of
+// a repository's host, without prompting.
+func gitCredential(ctx context.Context, repository string) (string, string) {
+	host := repositoryHost(repository)
+	if host == "" {
+		return "", ""
+	}
+	fill := exec.CommandContext(ctx, "git", "credential", "fill")
+	fill.Stdin = strings.NewReader("protocol=https\nhost=" + host + "\n\n")
+	fill.Env = append(os.Environ(), "GIT_TERMINAL_PROMPT=0")
+	out, err := fill.Output()
+	if err != nil {
+		return "", ""
+	}
+
+	var username, password string
+	for _, line := range strings.Split(string(out), "\n") {
+		key, value, _ := strings.Cut(line, "=")
+		switch key {
+		case "username":
+			username = value
+		case "password":
+			password = value
+		}
+	}
+	return username, password
+}
+
+// repositoryHost returns the host of https, ssh and scp-like repository URLs.
+func repositoryHost(repository string) string {
+	if strings.Contains(repository, "://") {
+		u, err := url.Parse(repository)
+		if err != nil {
+			return ""
+		}
+		return u.Hostname()
+	}
+	if at := strings.Index(repository, "@"); at >= 0 {
+		host, _, found := strings.Cut(repository[at+1:], ":")
+		if found {
+			return host
+		}
+	}
+	return ""
+}
+
+func gitConfig(ctx context.Context, key string) string {
+	out, err := exec.CommandContext(ctx, "git", "config", "--get", key).Output()
+	if err != nil {
+		return ""
+	}
+	return string(bytes.TrimSpace(out))
+}
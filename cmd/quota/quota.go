@@ -0,0 +1,17 @@
+package quota
+
+import (
+	"github.com/loft-sh/devpod/cmd/flags"
+	"github.com/spf13/cobra"
+)
+
+// NewQuotaCmd returns a new command
+func NewQuotaCmd(flags *flags.GlobalFlags) *cobra.Command {
+	quotaCmd := &cobra.Command{
+		Use:   "quota",
+		Short: "Kled quota commands",
+	}
+
+	quotaCmd.AddCommand(NewShowCmd(flags))
+	return quotaCmd
+}
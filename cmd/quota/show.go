@@ -0,0 +1,167 @@
+package quota
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/loft-sh/devpod/cmd/flags"
+	"github.com/loft-sh/devpod/pkg/sso"
+	"github.com/loft-sh/log"
+	"github.com/loft-sh/log/table"
+	"github.com/spf13/cobra"
+)
+
+type scope struct {
+	Type string `json:"type"`
+	ID   string `json:"id"`
+}
+
+type usage struct {
+	Scope    scope   `json:"scope"`
+	Resource string  `json:"resource"`
+	Period   string  `json:"period,omitempty"`
+	Used     float64 `json:"used"`
+	Limit    float64 `json:"limit"`
+}
+
+type showResponse struct {
+	Status           string  `json:"status"`
+	Message          string  `json:"message"`
+	Usage            []usage `json:"usage"`
+	WarningThreshold float64 `json:"warning_threshold"`
+}
+
+// ShowCmd holds the configuration
+type ShowCmd struct {
+	*flags.GlobalFlags
+
+	Server  string
+	APIKey  string
+	Project string
+	Output  string
+}
+
+// NewShowCmd creates a new command
+func NewShowCmd(flags *flags.GlobalFlags) *cobra.Command {
+	cmd := &ShowCmd{
+		GlobalFlags: flags,
+	}
+	showCmd := &cobra.Command{
+		Use:   "show",
+		Short: "Shows quota usage for the current user and project",
+		Args:  cobra.NoArgs,
+		RunE: func(cobraCmd *cobra.Command, args []string) error {
+			return cmd.Run(cobraCmd.Context())
+		},
+	}
+
+	showCmd.Flags().StringVar(&cmd.Server, "server", os.Getenv("KLED_SERVER_URL"), "The Kled server URL. You can also use KLED_SERVER_URL to set this")
+	showCmd.Flags().StringVar(&cmd.APIKey, "api-key", os.Getenv("KLED_API_KEY"), "The API key to authenticate with. You can also use KLED_API_KEY to set this")
+	showCmd.Flags().StringVar(&cmd.Project, "project", os.Getenv("KLED_PROJECT"), "The project to show quotas for. You can also use KLED_PROJECT to set this")
+	showCmd.Flags().StringVar(&cmd.Output, "output", "plain", "The output format to use. Can be json or plain")
+	return showCmd
+}
+
+// Run runs the command logic
+func (cmd *ShowCmd) Run(ctx context.Context) error {
+	if cmd.Server == "" {
+		return fmt.Errorf("no server specified, use --server or KLED_SERVER_URL")
+	}
+	if cmd.Output != "plain" && cmd.Output != "json" {
+		return fmt.Errorf("unexpected output format, choose either json or plain. Got %s", cmd.Output)
+	}
+
+	response, err := cmd.fetch(ctx)
+	if err != nil {
+		return err
+	}
+
+	if cmd.Output == "json" {
+		out, err := json.Marshal(response.Usage)
+		if err != nil {
+			return err
+		}
+		fmt.Print(string(out))
+		return nil
+	}
+
+	tableEntries := [][]string{}
+	for _, entry := range response.Usage {
+		limit := "unlimited"
+		percent := "-"
+		warning := ""
+		if entry.Limit > 0 {
+			limit = formatAmount(entry.Limit)
+			ratio := entry.Used / entry.Limit
+			percent = fmt.Sprintf("%.0f%%", ratio*100)
+			if ratio >= response.WarningThreshold {
+				warning = "near limit"
+			}
+		}
+
+		tableEntries = append(tableEntries, []string{
+			entry.Scope.Type + " " + entry.Scope.ID,
+			entry.Resource,
+			formatAmount(entry.Used),
+			limit,
+			percent,
+			warning,
+		})
+	}
+
+	table.PrintTable(log.Default, []string{
+		"Scope",
+		"Resource",
+		"Used",
+		"Limit",
+		"Usage",
+		"Warning",
+	}, tableEntries)
+	return nil
+}
+
+func (cmd *ShowCmd) fetch(ctx context.Context) (*showResponse, error) {
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimSuffix(cmd.Server, "/")+"/api/quota/", nil)
+	if err != nil {
+		return nil, err
+	}
+	if cmd.APIKey != "" {
+		req.Header.Set("X-API-Key", cmd.APIKey)
+	}
+	if cmd.Project != "" {
+		req.Header.Set("X-Kled-Project", cmd.Project)
+	}
+
+	res, err := sso.HTTPClient(cmd.Server).Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("request quota: %w", err)
+	}
+	defer res.Body.Close()
+
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		return nil, fmt.Errorf("read quota response: %w", err)
+	}
+
+	response := &showResponse{}
+	if err := json.Unmarshal(body, response); err != nil {
+		return nil, fmt.Errorf("unexpected response (%d): %s", res.StatusCode, strings.TrimSpace(string(body)))
+	}
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("request quota (%d): %s", res.StatusCode, response.Message)
+	}
+	return response, nil
+}
+
+func formatAmount(amount float64) string {
+	return strings.TrimSuffix(strings.TrimRight(fmt.Sprintf("%.2f", amount), "0"), ".")
+}
@@ -0,0 +1,79 @@
+package registry
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/loft-sh/devpod/cmd/flags"
+	"github.com/loft-sh/devpod/pkg/registry"
+	"github.com/loft-sh/log"
+	"github.com/loft-sh/log/table"
+	"github.com/spf13/cobra"
+)
+
+// ListCmd holds the list cmd flags
+type ListCmd struct {
+	flags.GlobalFlags
+
+	Output string
+}
+
+// NewListCmd creates a new command
+func NewListCmd(flags *flags.GlobalFlags) *cobra.Command {
+	cmd := &ListCmd{
+		GlobalFlags: *flags,
+	}
+	listCmd := &cobra.Command{
+		Use:     "list",
+		Aliases: []string{"ls"},
+		Short:   "List the container registries kled has credentials for",
+		Args:    cobra.NoArgs,
+		RunE: func(cobraCmd *cobra.Command, args []string) error {
+			return cmd.Run(cobraCmd.Context())
+		},
+	}
+
+	listCmd.Flags().StringVar(&cmd.Output, "output", "plain", "The output format to use. Can be json or plain")
+	return listCmd
+}
+
+// Run runs the command logic
+func (cmd *ListCmd) Run(ctx context.Context) error {
+	registries, err := registry.List()
+	if err != nil {
+		return err
+	}
+
+	if cmd.Output == "plain" {
+		tableEntries := [][]string{}
+		for _, r := range registries {
+			tableEntries = append(tableEntries, []string{
+				r.Server,
+				r.Username,
+				string(r.Store),
+				r.Helper,
+				r.CreatedAt.Local().Format(time.DateTime),
+			})
+		}
+
+		table.PrintTable(log.Default, []string{
+			"Server",
+			"Username",
+			"Store",
+			"Helper",
+			"Created",
+		}, tableEntries)
+	} else if cmd.Output == "json" {
+		out, err := json.MarshalIndent(registries, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Print(string(out))
+	} else {
+		return fmt.Errorf("unexpected output format, choose either json or plain. Got %s", cmd.Output)
+	}
+
+	return nil
+}
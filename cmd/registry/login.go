@@ -0,0 +1,94 @@
+package registry
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/loft-sh/devpod/cmd/flags"
+	"github.com/loft-sh/devpod/pkg/registry"
+	"github.com/loft-sh/log"
+	"github.com/spf13/cobra"
+)
+
+// LoginCmd holds the login cmd flags
+type LoginCmd struct {
+	flags.GlobalFlags
+
+	Username      string
+	Password      string
+	PasswordStdin bool
+	Store         string
+	VaultPath     string
+	Helper        string
+}
+
+// NewLoginCmd creates a new command
+func NewLoginCmd(flags *flags.GlobalFlags) *cobra.Command {
+	cmd := &LoginCmd{
+		GlobalFlags: *flags,
+	}
+	loginCmd := &cobra.Command{
+		Use:   "login [server]",
+		Short: "Log in to a container registry",
+		Long: `Stores credentials for a container registry. Kled uses them to pull and push
+workspace images and forwards them into workspaces.
+
+Secrets are kept in the OS keychain or in Vault (VAULT_ADDR and VAULT_TOKEN):
+  kled registry login ghcr.io -u my-user --password-stdin
+  kled registry login registry.example.com -u my-user --store vault
+
+Cloud registries can refresh short lived tokens instead:
+  kled registry login 123456789.dkr.ecr.us-east-1.amazonaws.com --helper ecr`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cobraCmd *cobra.Command, args []string) error {
+			return cmd.Run(cobraCmd.Context(), args[0])
+		},
+	}
+
+	loginCmd.Flags().StringVarP(&cmd.Username, "username", "u", "", "The registry username")
+	loginCmd.Flags().StringVarP(&cmd.Password, "password", "p", "", "The registry password or token")
+	loginCmd.Flags().BoolVar(&cmd.PasswordStdin, "password-stdin", false, "Read the password from stdin")
+	loginCmd.Flags().StringVar(&cmd.Store, "store", string(registry.StoreKeychain), "Where to store the secret. Can be keychain or vault")
+	loginCmd.Flags().StringVar(&cmd.VaultPath, "vault-path", registry.DefaultVaultPath, "The Vault KV v2 path to store the secret below")
+	loginCmd.Flags().StringVar(&cmd.Helper, "helper", "", "Refresh tokens with a cloud provider helper instead of storing a secret. Can be ecr, gcr or acr")
+	return loginCmd
+}
+
+// Run runs the command logic
+func (cmd *LoginCmd) Run(ctx context.Context, server string) error {
+	store := registry.StoreType(cmd.Store)
+	if store != registry.StoreKeychain && store != registry.StoreVault {
+		return fmt.Errorf("unexpected store, choose either keychain or vault. Got %s", cmd.Store)
+	}
+
+	password := cmd.Password
+	if cmd.PasswordStdin {
+		if password != "" {
+			return fmt.Errorf("--password and --password-stdin are mutually exclusive")
+		}
+
+		out, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			return err
+		}
+		password = strings.TrimRight(string(out), "\r\n")
+	}
+
+	loggedIn, err := registry.Login(ctx, registry.LoginOptions{
+		Server:    server,
+		Username:  cmd.Username,
+		Secret:    password,
+		Store:     store,
+		VaultPath: cmd.VaultPath,
+		Helper:    cmd.Helper,
+	})
+	if err != nil {
+		return err
+	}
+
+	log.Default.Donef("Successfully logged in to registry %s", loggedIn.Server)
+	return nil
+}
@@ -0,0 +1,19 @@
+package registry
+
+import (
+	"github.com/loft-sh/devpod/cmd/flags"
+	"github.com/spf13/cobra"
+)
+
+// NewRegistryCmd returns a new command
+func NewRegistryCmd(flags *flags.GlobalFlags) *cobra.Command {
+	registryCmd := &cobra.Command{
+		Use:   "registry",
+		Short: "Kled container registry credential commands",
+	}
+
+	registryCmd.AddCommand(NewLoginCmd(flags))
+	registryCmd.AddCommand(NewListCmd(flags))
+	registryCmd.AddCommand(NewRemoveCmd(flags))
+	return registryCmd
+}
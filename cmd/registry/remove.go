@@ -0,0 +1,62 @@
+package registry
+
+import (
+	"context"
+
+	"github.com/loft-sh/devpod/cmd/flags"
+	"github.com/loft-sh/devpod/pkg/registry"
+	"github.com/loft-sh/log"
+	"github.com/spf13/cobra"
+)
+
+// RemoveCmd holds the remove cmd flags
+type RemoveCmd struct {
+	flags.GlobalFlags
+}
+
+// NewRemoveCmd creates a new command
+func NewRemoveCmd(flags *flags.GlobalFlags) *cobra.Command {
+	cmd := &RemoveCmd{
+		GlobalFlags: *flags,
+	}
+	removeCmd := &cobra.Command{
+		Use:     "remove [server]",
+		Aliases: []string{"logout", "rm"},
+		Short:   "Remove the credentials of a container registry",
+		Args:    cobra.ExactArgs(1),
+		RunE: func(cobraCmd *cobra.Command, args []string) error {
+			return cmd.Run(cobraCmd.Context(), args[0])
+		},
+		ValidArgsFunction: suggestRegistries,
+	}
+
+	return removeCmd
+}
+
+// Run runs the command logic
+func (cmd *RemoveCmd) Run(ctx context.Context, server string) error {
+	err := registry.Logout(ctx, server)
+	if err != nil {
+		return err
+	}
+
+	log.Default.Donef("Successfully removed credentials for registry %s", registry.NormalizeServer(server))
+	return nil
+}
+
+func suggestRegistries(_ *cobra.Command, args []string, _ string) ([]string, cobra.ShellCompDirective) {
+	if len(args) > 0 {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+
+	registries, err := registry.List()
+	if err != nil {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+
+	servers := []string{}
+	for _, r := range registries {
+		servers = append(servers, r.Server)
+	}
+	return servers, cobra.ShellCompDirectiveNoFileComp
+}
@@ -6,6 +6,7 @@ import (
 	"os/exec"
 
 	"github.com/loft-sh/devpod/cmd/agent" // TODO: Update import paths when repository is renamed
+	"github.com/loft-sh/devpod/cmd/bundle"
 	"github.com/loft-sh/devpod/cmd/completion"
 	"github.com/loft-sh/devpod/cmd/context"
 	"github.com/loft-sh/devpod/cmd/flags"
@@ -15,9 +16,16 @@ import (
 	"github.com/loft-sh/devpod/cmd/machine"
 	"github.com/loft-sh/devpod/cmd/pro"
 	"github.com/loft-sh/devpod/cmd/provider"
+	"github.com/loft-sh/devpod/cmd/quota"
+	"github.com/loft-sh/devpod/cmd/registry"
+	"github.com/loft-sh/devpod/cmd/template"
+	"github.com/loft-sh/devpod/cmd/test"
 	"github.com/loft-sh/devpod/cmd/use"
 	"github.com/loft-sh/devpod/pkg/client/clientimplementation"
 	"github.com/loft-sh/devpod/pkg/config"
+	"github.com/loft-sh/devpod/pkg/contentstore"
+	"github.com/loft-sh/devpod/pkg/kerrors"
+	"github.com/loft-sh/devpod/pkg/outbound"
 	"github.com/loft-sh/devpod/pkg/telemetry"
 	log2 "github.com/loft-sh/log"
 	"github.com/loft-sh/log/terminal"
@@ -66,6 +74,19 @@ It provides commands for:
 			kledConfig, err := config.LoadConfig(globalFlags.Context, globalFlags.Provider)
 			if err == nil {
 				telemetry.StartCLI(kledConfig, cobraCmd)
+
+				if kledConfig.ContextOption(config.ContextOptionOffline) == "true" {
+					_ = os.Setenv(contentstore.OfflineEnv, "true")
+				}
+
+				outboundOptions, err := outbound.FromContext(kledConfig)
+				if err != nil {
+					return err
+				}
+				err = outboundOptions.Apply()
+				if err != nil {
+					return err
+				}
 			}
 
 			return nil
@@ -111,7 +132,7 @@ func Execute() {
 					log2.Default.Error("Try enabling Debug mode under Settings to see a more verbose output")
 				}
 			}
-			log2.Default.Fatal(err)
+			log2.Default.Fatal(kerrors.Render(err))
 		}
 	}
 }
@@ -139,11 +160,20 @@ func BuildRoot() *cobra.Command {
 	rootCmd.AddCommand(NewClusterCmd(globalFlags))
 	rootCmd.AddCommand(NewSpaceCmd(globalFlags))
 	rootCmd.AddCommand(NewPolicyCmd(globalFlags))
+	rootCmd.AddCommand(quota.NewQuotaCmd(globalFlags))
+	rootCmd.AddCommand(template.NewTemplateCmd(globalFlags))
+	rootCmd.AddCommand(registry.NewRegistryCmd(globalFlags))
+	rootCmd.AddCommand(bundle.NewBundleCmd(globalFlags))
 	
 	rootCmd.AddCommand(kcluster.NewKClusterCmd(globalFlags))
 	rootCmd.AddCommand(NewUpCmd(globalFlags))
+	rootCmd.AddCommand(NewRunCmd(globalFlags))
+	rootCmd.AddCommand(NewPreviewCmd(globalFlags))
 	rootCmd.AddCommand(NewDeleteCmd(globalFlags))
 	rootCmd.AddCommand(NewSSHCmd(globalFlags))
+	rootCmd.AddCommand(NewCpCmd(globalFlags))
+	rootCmd.AddCommand(NewClipboardCmd(globalFlags))
+	rootCmd.AddCommand(NewStartCmd(globalFlags))
 	rootCmd.AddCommand(NewStopCmd(globalFlags))
 	rootCmd.AddCommand(NewListCmd(globalFlags))
 	rootCmd.AddCommand(NewStatusCmd(globalFlags))
@@ -153,6 +183,14 @@ func BuildRoot() *cobra.Command {
 	rootCmd.AddCommand(NewImportCmd(globalFlags))
 	rootCmd.AddCommand(NewLogsCmd(globalFlags))
 	rootCmd.AddCommand(NewTroubleshootCmd(globalFlags))
+	rootCmd.AddCommand(NewDebugCmd(globalFlags))
+	rootCmd.AddCommand(test.NewTestCmd(globalFlags))
+	rootCmd.AddCommand(NewTraceCmd(globalFlags))
+	rootCmd.AddCommand(NewArtifactsCmd(globalFlags))
+	rootCmd.AddCommand(NewLoginCmd(globalFlags))
+	rootCmd.AddCommand(NewLogoutCmd(globalFlags))
+	rootCmd.AddCommand(NewOperatorCmd(globalFlags))
+	rootCmd.AddCommand(completion.NewCompletionCmd())
 	
 	return rootCmd
 }
@@ -0,0 +1,261 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/alessio/shellescape"
+	"github.com/loft-sh/devpod/cmd/flags"
+	client2 "github.com/loft-sh/devpod/pkg/client"
+	"github.com/loft-sh/devpod/pkg/command"
+	"github.com/loft-sh/devpod/pkg/config"
+	config2 "github.com/loft-sh/devpod/pkg/devcontainer/config"
+	workspace2 "github.com/loft-sh/devpod/pkg/workspace"
+	"github.com/loft-sh/log"
+	"github.com/spf13/cobra"
+)
+
+// RunCmd holds the run cmd flags
+type RunCmd struct {
+	*flags.GlobalFlags
+
+	Tasks    []string
+	Keep     bool
+	Continue bool
+
+	ID               string
+	Source           string
+	DevContainerPath string
+	ProviderOptions  []string
+	Recreate         bool
+}
+
+// NewRunCmd creates a new command
+func NewRunCmd(f *flags.GlobalFlags) *cobra.Command {
+	cmd := &RunCmd{
+		GlobalFlags: f,
+	}
+	runCmd := &cobra.Command{
+		Use:   "run [flags] [workspace-path|workspace-name]",
+		Short: "Runs devcontainer tasks headlessly, e.g. in CI",
+		Long: `Starts the workspace, runs the given tasks in it and deletes it again, so CI
+systems can build and test in the exact environment developers use.
+
+Tasks are declared in the customizations of the devcontainer.json, either as a
+command or with dependencies, environment and working directory:
+
+  "customizations": {
+    "kled": {
+      "tasks": {
+        "build": "make build",
+        "test": {"command": ["go", "test", "./..."], "dependsOn": ["build"]}
+      }
+    }
+  }
+
+The output of the tasks is streamed and the command exits with the exit code
+of the first failed task.
+
+Example:
+  kled run --task build --task test .`,
+		RunE: func(cobraCmd *cobra.Command, args []string) error {
+			if len(cmd.Tasks) == 0 {
+				return fmt.Errorf("no task specified, use --task")
+			}
+			kledConfig, err := config.LoadConfig(cmd.Context, cmd.Provider)
+			if err != nil {
+				return err
+			}
+
+			ctx, cancel := WithSignals(cobraCmd.Context())
+			defer cancel()
+
+			upCmd := &UpCmd{GlobalFlags: cmd.GlobalFlags}
+			upCmd.IDE = string(config.IDENone)
+			upCmd.ID = cmd.ID
+			upCmd.Source = cmd.Source
+			upCmd.DevContainerPath = cmd.DevContainerPath
+			upCmd.ProviderOptions = cmd.ProviderOptions
+			upCmd.Recreate = cmd.Recreate
+			client, logger, err := upCmd.prepareClient(ctx, kledConfig, args)
+			if err != nil {
+				return fmt.Errorf("prepare workspace client: %w", err)
+			}
+
+			return cmd.Run(ctx, kledConfig, upCmd, client, logger)
+		},
+	}
+
+	runCmd.Flags().StringArrayVar(&cmd.Tasks, "task", []string{}, "The task to run, can be given multiple times. Tasks run in the given order, after the tasks they depend on")
+	runCmd.Flags().BoolVar(&cmd.Keep, "keep", false, "Keep the workspace after the tasks finished instead of deleting it")
+	runCmd.Flags().BoolVar(&cmd.Continue, "continue-on-error", false, "Run the remaining tasks after a task failed. Tasks depending on it are still skipped")
+	runCmd.Flags().StringVar(&cmd.ID, "id", "", "The id to use for the workspace")
+	runCmd.Flags().StringVar(&cmd.Source, "source", "", "Optional source for the workspace. E.g. git:https://github.com/my-org/my-repo")
+	runCmd.Flags().StringVar(&cmd.DevContainerPath, "devcontainer-path", "", "The path to the devcontainer.json relative to the project")
+	runCmd.Flags().StringArrayVarP(&cmd.ProviderOptions, "provider-option", "o", []string{}, "Provider option in the form KEY=VALUE")
+	runCmd.Flags().BoolVar(&cmd.Recreate, "recreate", false, "If true will remove any existing containers and recreate them")
+	return runCmd
+}
+
+// taskResult is the outcome of a task, for the summary.
+type taskResult struct {
+	name     string
+	exitCode int
+	skipped  bool
+	duration time.Duration
+}
+
+// Run runs the command logic
+func (cmd *RunCmd) Run(ctx context.Context, kledConfig *config.Config, upCmd *UpCmd, client client2.BaseWorkspaceClient, log log.Logger) (err error) {
+	if !cmd.Keep {
+		defer func() {
+			// tear down even if the run was interrupted
+			deleteCtx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
+			defer cancel()
+			log.Infof("Deleting workspace '%s'", client.Workspace())
+			_, deleteErr := workspace2.Delete(deleteCtx, kledConfig, []string{client.Workspace()}, true, true, client2.DeleteOptions{}, cmd.Owner, log)
+			if deleteErr != nil {
+				log.Errorf("Error deleting workspace '%s': %v", client.Workspace(), deleteErr)
+				if err == nil {
+					err = deleteErr
+				}
+			}
+		}()
+	}
+
+	result, err := upCmd.kledUp(ctx, kledConfig, client, log)
+	if err != nil {
+		return err
+	} else if result == nil {
+		return fmt.Errorf("didn't receive a result back from agent")
+	}
+	if failedHook := config2.FailedLifecycleHook(result); failedHook != nil {
+		return fmt.Errorf("lifecycle hook %s failed: %s", failedHook.Hook, failedHook.Error)
+	}
+
+	var devContainer *config2.DevContainerConfig
+	if result.DevContainerConfigWithPath != nil {
+		devContainer = result.DevContainerConfigWithPath.Config
+	}
+	tasks, err := config2.GetTasks(devContainer)
+	if err != nil {
+		return err
+	}
+	ordered, err := config2.ResolveTasks(tasks, cmd.Tasks)
+	if err != nil {
+		return err
+	}
+
+	user := config2.GetRemoteUser(result)
+	workdir := result.SubstitutionContext.ContainerWorkspaceFolder
+	failed := map[string]bool{}
+	results := []taskResult{}
+	var firstFailure error
+	for _, name := range ordered {
+		task := tasks[name]
+		if (firstFailure != nil && !cmd.Continue) || dependsOnFailed(task, failed) {
+			failed[name] = true
+			results = append(results, taskResult{name: name, skipped: true})
+			continue
+		}
+
+		log.Infof("Running task %s", name)
+		start := time.Now()
+		taskErr := runTask(ctx, client, log, user, workdir, task)
+		results = append(results, taskResult{name: name, exitCode: exitCode(taskErr), duration: time.Since(start)})
+		if taskErr != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			log.Errorf("Task %s failed: %v", name, taskErr)
+			failed[name] = true
+			if firstFailure == nil {
+				firstFailure = taskErr
+			}
+		}
+	}
+
+	printTaskSummary(results, log)
+	return firstFailure
+}
+
+// runTask runs a task over ssh with its output going to ours. A failed
+// command returns its *exec.ExitError, which makes kled exit with the same
+// code.
+func runTask(ctx context.Context, client client2.BaseWorkspaceClient, log log.Logger, user, workdir string, task *config2.Task) error {
+	sshCmd, err := createSSHCommand(ctx, client, log, []string{"--user", user, "--workdir", taskWorkdir(workdir, task), "--command", taskScript(task)})
+	if err != nil {
+		return err
+	}
+	sshCmd.Stdout = os.Stdout
+	sshCmd.Stderr = os.Stderr
+	return sshCmd.Run()
+}
+
+// taskWorkdir returns the folder the task runs in, relative paths are
+// relative to the workspace folder.
+func taskWorkdir(workdir string, task *config2.Task) string {
+	if task.WorkingDir == "" {
+		return workdir
+	} else if strings.HasPrefix(task.WorkingDir, "/") {
+		return task.WorkingDir
+	}
+	return strings.TrimSuffix(workdir, "/") + "/" + task.WorkingDir
+}
+
+// taskScript returns the shell script running the task command with its
+// environment.
+func taskScript(task *config2.Task) string {
+	script := command.Quote(task.Command)
+	if len(task.Env) > 0 {
+		keys := make([]string, 0, len(task.Env))
+		for key := range task.Env {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		exports := []string{}
+		for _, key := range keys {
+			exports = append(exports, "export "+key+"="+shellescape.Quote(task.Env[key]))
+		}
+		script = strings.Join(exports, "; ") + "; " + script
+	}
+	return script
+}
+
+func dependsOnFailed(task *config2.Task, failed map[string]bool) bool {
+	for _, dependency := range task.DependsOn {
+		if failed[dependency] {
+			return true
+		}
+	}
+	return false
+}
+
+func exitCode(err error) int {
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return exitErr.ExitCode()
+	} else if err != nil {
+		return 1
+	}
+	return 0
+}
+
+func printTaskSummary(results []taskResult, log log.Logger) {
+	for _, result := range results {
+		switch {
+		case result.skipped:
+			log.Warnf("%-20s skipped", result.name)
+		case result.exitCode != 0:
+			log.Errorf("%-20s failed with exit code %d after %s", result.name, result.exitCode, result.duration.Round(time.Second))
+		default:
+			log.Donef("%-20s succeeded after %s", result.name, result.duration.Round(time.Second))
+		}
+	}
+}
@@ -0,0 +1,231 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/loft-sh/devpod/cmd/completion"
+	"github.com/loft-sh/devpod/cmd/flags"
+	"github.com/loft-sh/devpod/pkg/agent"
+	clientpkg "github.com/loft-sh/devpod/pkg/client"
+	"github.com/loft-sh/devpod/pkg/config"
+	"github.com/loft-sh/devpod/pkg/imagescan"
+	"github.com/loft-sh/devpod/pkg/ssh"
+	"github.com/loft-sh/devpod/pkg/workspace"
+	"github.com/loft-sh/log"
+	"github.com/loft-sh/log/table"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+// ScanCmd holds the configuration
+type ScanCmd struct {
+	*flags.GlobalFlags
+
+	Rescan   bool
+	Severity string
+	Output   string
+}
+
+// NewScanCmd creates a new command
+func NewScanCmd(flags *flags.GlobalFlags) *cobra.Command {
+	cmd := &ScanCmd{
+		GlobalFlags: flags,
+	}
+	scanCmd := &cobra.Command{
+		Use:   "scan [flags] [workspace-path|workspace-name]",
+		Short: "Shows the vulnerability report of the workspace image",
+		Long: `Shows the vulnerabilities found in the workspace image when it was built.
+Images are scanned with trivy if scanning is enabled:
+  kled context set-options -o IMAGE_SCAN=warn -o IMAGE_SCAN_SEVERITY=HIGH
+
+With IMAGE_SCAN=block, workspaces with findings at or above the severity don't start.`,
+		RunE: func(cobraCmd *cobra.Command, args []string) error {
+			return cmd.Run(cobraCmd.Context(), args)
+		},
+		ValidArgsFunction: func(rootCmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+			return completion.GetWorkspaceSuggestions(rootCmd, cmd.Context, cmd.Provider, args, toComplete, cmd.Owner, log.Default)
+		},
+	}
+
+	scanCmd.Flags().BoolVar(&cmd.Rescan, "rescan", false, "Scan the image again with the current vulnerability database")
+	scanCmd.Flags().StringVar(&cmd.Severity, "severity", "", "The lowest severity to show. Defaults to the severity the image was scanned with")
+	scanCmd.Flags().StringVar(&cmd.Output, "output", "plain", "The output format to use. Can be json or plain")
+	return scanCmd
+}
+
+// Run runs the command logic
+func (cmd *ScanCmd) Run(ctx context.Context, args []string) error {
+	if cmd.Output != "plain" && cmd.Output != "json" {
+		return fmt.Errorf("unexpected output format, choose either json or plain. Got %s", cmd.Output)
+	}
+	var threshold imagescan.Severity
+	if cmd.Severity != "" {
+		var err error
+		threshold, err = imagescan.ParseSeverity(cmd.Severity)
+		if err != nil {
+			return err
+		}
+	}
+
+	kledConfig, err := config.LoadConfig(cmd.Context, cmd.Provider)
+	if err != nil {
+		return err
+	}
+
+	baseClient, err := workspace.Get(ctx, kledConfig, args, false, cmd.Owner, log.Default.ErrorStreamOnly())
+	if err != nil {
+		return err
+	}
+
+	client, ok := baseClient.(clientpkg.WorkspaceClient)
+	if !ok {
+		return fmt.Errorf("this command is not supported for proxy providers")
+	}
+
+	out, err := cmd.runAgentScan(ctx, kledConfig, client)
+	if err != nil {
+		return err
+	}
+
+	report := &imagescan.Report{}
+	err = json.Unmarshal(out, report)
+	if err != nil {
+		return fmt.Errorf("parse scan report: %w", err)
+	}
+	if threshold == "" {
+		threshold = report.Threshold
+	}
+
+	if cmd.Output == "json" {
+		report.Vulnerabilities = report.Findings(threshold)
+		out, err := json.Marshal(report)
+		if err != nil {
+			return err
+		}
+		fmt.Print(string(out))
+		return nil
+	}
+
+	log.Default.Infof("Image %s scanned at %s", report.Image, report.ScannedAt.Format("2006-01-02 15:04:05"))
+	findings := report.Findings(threshold)
+	if len(findings) == 0 {
+		log.Default.Donef("No vulnerabilities of severity %s or higher", threshold)
+		return nil
+	}
+
+	tableEntries := [][]string{}
+	for _, finding := range findings {
+		tableEntries = append(tableEntries, []string{
+			string(finding.Severity),
+			finding.ID,
+			finding.Package,
+			finding.InstalledVersion,
+			finding.FixedVersion,
+			finding.Title,
+		})
+	}
+	table.PrintTable(log.Default, []string{
+		"Severity",
+		"ID",
+		"Package",
+		"Installed",
+		"Fixed",
+		"Title",
+	}, tableEntries)
+	return nil
+}
+
+// runAgentScan runs the scan command of the agent on the machine and returns
+// the report it prints.
+func (cmd *ScanCmd) runAgentScan(ctx context.Context, kledConfig *config.Config, client clientpkg.WorkspaceClient) ([]byte, error) {
+	logger := log.Default
+
+	// create readers
+	stdoutReader, stdoutWriter, err := os.Pipe()
+	if err != nil {
+		return nil, err
+	}
+	stdinReader, stdinWriter, err := os.Pipe()
+	if err != nil {
+		return nil, err
+	}
+	defer stdoutWriter.Close()
+	defer stdinWriter.Close()
+
+	// ssh tunnel command
+	sshServerCmd := fmt.Sprintf("'%s' helper ssh-server --stdio", client.AgentPath())
+	if logger.GetLevel() == logrus.DebugLevel {
+		sshServerCmd += " --debug"
+	}
+
+	// Get the timeout from the context options
+	timeout := config.ParseTimeOption(kledConfig, config.ContextOptionAgentInjectTimeout)
+
+	// start ssh server in background
+	go func() {
+		stderr := logger.ErrorStreamOnly().Writer(logrus.DebugLevel, false)
+		defer stderr.Close()
+
+		_ = agent.InjectAgentAndExecute(
+			ctx,
+			func(ctx context.Context, command string, stdin io.Reader, stdout io.Writer, stderr io.Writer) error {
+				return client.Command(ctx, clientpkg.CommandOptions{
+					Command: command,
+					Stdin:   stdin,
+					Stdout:  stdout,
+					Stderr:  stderr,
+				})
+			},
+			client.AgentLocal(),
+			client.AgentPath(),
+			client.AgentURL(),
+			true,
+			sshServerCmd,
+			stdinReader,
+			stdoutWriter,
+			stderr,
+			logger.ErrorStreamOnly(), timeout)
+	}()
+
+	// create agent command
+	agentCommand := fmt.Sprintf("'%s' agent workspace scan --context '%s' --id '%s'", client.AgentPath(), client.Context(), client.Workspace())
+	if cmd.Rescan {
+		agentCommand += " --rescan"
+	}
+	if logger.GetLevel() == logrus.DebugLevel {
+		agentCommand += " --debug"
+	}
+
+	// start ssh client as root / default user
+	sshClient, err := ssh.StdioClientWithUser(stdoutReader, stdinWriter, "" /* default */, false)
+	if err != nil {
+		return nil, err
+	}
+	defer sshClient.Close()
+
+	session, err := sshClient.NewSession()
+	if err != nil {
+		return nil, err
+	}
+	defer session.Close()
+
+	stdout := &bytes.Buffer{}
+	stderr := &bytes.Buffer{}
+	session.Stdout = stdout
+	session.Stderr = stderr
+	err = session.Run(agentCommand)
+	if err != nil {
+		if message := strings.TrimSpace(stderr.String()); message != "" {
+			return nil, fmt.Errorf("%s", message)
+		}
+		return nil, err
+	}
+
+	return stdout.Bytes(), nil
+}
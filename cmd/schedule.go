@@ -0,0 +1,268 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/loft-sh/devpod/cmd/completion"
+	"github.com/loft-sh/devpod/cmd/flags"
+	"github.com/loft-sh/devpod/pkg/config"
+	"github.com/loft-sh/devpod/pkg/sso"
+	workspace2 "github.com/loft-sh/devpod/pkg/workspace"
+	"github.com/loft-sh/devpod/pkg/workspaceenv"
+	"github.com/loft-sh/log"
+	"github.com/loft-sh/log/table"
+	"github.com/spf13/cobra"
+)
+
+// ScheduleCmd holds the schedule cmd flags
+type ScheduleCmd struct {
+	*flags.GlobalFlags
+
+	Server  string
+	APIKey  string
+	Project string
+}
+
+type workspaceSchedule struct {
+	WorkspaceID    string `json:"workspace_id,omitempty"`
+	Start          string `json:"start,omitempty"`
+	Stop           string `json:"stop,omitempty"`
+	Timezone       string `json:"timezone"`
+	IgnoreHolidays bool   `json:"ignore_holidays,omitempty"`
+}
+
+type scheduleResponse struct {
+	Status   string            `json:"status"`
+	Message  string            `json:"message"`
+	Schedule workspaceSchedule `json:"schedule"`
+	Next     *struct {
+		Action string    `json:"action"`
+		At     time.Time `json:"at"`
+	} `json:"next,omitempty"`
+}
+
+// NewScheduleCmd creates a new command
+func NewScheduleCmd(flags *flags.GlobalFlags) *cobra.Command {
+	cmd := &ScheduleCmd{
+		GlobalFlags: flags,
+	}
+	scheduleCmd := &cobra.Command{
+		Use:   "schedule",
+		Short: "Starts and stops workspaces on a calendar",
+		Long: `Manages the schedule on which the kled server starts and stops a workspace.
+Start and stop are cron expressions evaluated in the timezone of the schedule.
+Schedules don't run on the holidays of the organization unless
+--ignore-holidays is set.`,
+	}
+
+	scheduleCmd.PersistentFlags().StringVar(&cmd.Server, "server", os.Getenv("KLED_SERVER_URL"), "The Kled server URL. You can also use KLED_SERVER_URL to set this")
+	scheduleCmd.PersistentFlags().StringVar(&cmd.APIKey, "api-key", os.Getenv("KLED_API_KEY"), "The API key to authenticate with. You can also use KLED_API_KEY to set this")
+	scheduleCmd.PersistentFlags().StringVar(&cmd.Project, "project", os.Getenv("KLED_PROJECT"), "The project of the workspace. You can also use KLED_PROJECT to set this")
+
+	scheduleCmd.AddCommand(cmd.newSetCmd())
+	scheduleCmd.AddCommand(cmd.newShowCmd())
+	scheduleCmd.AddCommand(cmd.newClearCmd())
+	return scheduleCmd
+}
+
+func (cmd *ScheduleCmd) newSetCmd() *cobra.Command {
+	schedule := workspaceSchedule{}
+	setCmd := &cobra.Command{
+		Use:   "set [flags] [workspace-path|workspace-name]",
+		Short: "Sets the start and stop schedule of a workspace",
+		Example: `  # start at 9 and stop at 19 on weekdays
+  kled workspace schedule set my-workspace --start "0 9 * * 1-5" --stop "0 19 * * 1-5"`,
+		RunE: func(cobraCmd *cobra.Command, args []string) error {
+			if schedule.Start == "" && schedule.Stop == "" {
+				return fmt.Errorf("specify --start, --stop or both")
+			}
+
+			workspaceID, err := cmd.workspaceID(cobraCmd.Context(), args)
+			if err != nil {
+				return err
+			}
+
+			response, err := cmd.request(cobraCmd.Context(), http.MethodPut, workspaceID, schedule)
+			if err != nil {
+				return fmt.Errorf("set schedule: %w", err)
+			}
+
+			log.Default.Donef("Set the schedule of workspace '%s': start %s, stop %s (%s)", workspaceID, cronOrNever(response.Schedule.Start), cronOrNever(response.Schedule.Stop), response.Schedule.Timezone)
+			return nil
+		},
+		ValidArgsFunction: cmd.suggestWorkspaces,
+	}
+
+	timezone := workspaceenv.HostEnv()["TZ"]
+	if timezone == "" {
+		timezone = "UTC"
+	}
+	setCmd.Flags().StringVar(&schedule.Start, "start", "", "Cron expression of when to start the workspace, e.g. \"0 9 * * 1-5\"")
+	setCmd.Flags().StringVar(&schedule.Stop, "stop", "", "Cron expression of when to stop the workspace, e.g. \"0 19 * * 1-5\"")
+	setCmd.Flags().StringVar(&schedule.Timezone, "timezone", timezone, "The IANA timezone the schedule is evaluated in. Defaults to the timezone of this machine")
+	setCmd.Flags().BoolVar(&schedule.IgnoreHolidays, "ignore-holidays", false, "Also start and stop the workspace on the holidays of the organization")
+	return setCmd
+}
+
+func (cmd *ScheduleCmd) newShowCmd() *cobra.Command {
+	output := ""
+	showCmd := &cobra.Command{
+		Use:   "show [flags] [workspace-path|workspace-name]",
+		Short: "Shows the schedule of a workspace and its next start or stop",
+		RunE: func(cobraCmd *cobra.Command, args []string) error {
+			if output != "plain" && output != "json" {
+				return fmt.Errorf("unexpected output format, choose either json or plain. Got %s", output)
+			}
+
+			workspaceID, err := cmd.workspaceID(cobraCmd.Context(), args)
+			if err != nil {
+				return err
+			}
+
+			response, err := cmd.request(cobraCmd.Context(), http.MethodGet, workspaceID, nil)
+			if err != nil {
+				return fmt.Errorf("get schedule: %w", err)
+			}
+
+			if output == "json" {
+				out, err := json.Marshal(response)
+				if err != nil {
+					return err
+				}
+				fmt.Print(string(out))
+				return nil
+			}
+
+			next := "-"
+			if response.Next != nil {
+				next = response.Next.Action + " at " + response.Next.At.Local().Format(time.RFC1123)
+			}
+			holidays := "skipped"
+			if response.Schedule.IgnoreHolidays {
+				holidays = "ignored"
+			}
+			table.PrintTable(log.Default, []string{
+				"Start",
+				"Stop",
+				"Timezone",
+				"Holidays",
+				"Next",
+			}, [][]string{{
+				cronOrNever(response.Schedule.Start),
+				cronOrNever(response.Schedule.Stop),
+				response.Schedule.Timezone,
+				holidays,
+				next,
+			}})
+			return nil
+		},
+		ValidArgsFunction: cmd.suggestWorkspaces,
+	}
+
+	showCmd.Flags().StringVar(&output, "output", "plain", "The output format to use. Can be json or plain")
+	return showCmd
+}
+
+func (cmd *ScheduleCmd) newClearCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "clear [flags] [workspace-path|workspace-name]",
+		Short: "Removes the schedule of a workspace",
+		RunE: func(cobraCmd *cobra.Command, args []string) error {
+			workspaceID, err := cmd.workspaceID(cobraCmd.Context(), args)
+			if err != nil {
+				return err
+			}
+
+			if _, err := cmd.request(cobraCmd.Context(), http.MethodDelete, workspaceID, nil); err != nil {
+				return fmt.Errorf("clear schedule: %w", err)
+			}
+
+			log.Default.Donef("Removed the schedule of workspace '%s'", workspaceID)
+			return nil
+		},
+		ValidArgsFunction: cmd.suggestWorkspaces,
+	}
+}
+
+func (cmd *ScheduleCmd) suggestWorkspaces(rootCmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	return completion.GetWorkspaceSuggestions(rootCmd, cmd.Context, cmd.Provider, args, toComplete, cmd.Owner, log.Default)
+}
+
+func (cmd *ScheduleCmd) workspaceID(ctx context.Context, args []string) (string, error) {
+	if cmd.Server == "" {
+		return "", fmt.Errorf("no server specified, use --server or KLED_SERVER_URL")
+	}
+
+	kledConfig, err := config.LoadConfig(cmd.Context, cmd.Provider)
+	if err != nil {
+		return "", err
+	}
+
+	client, err := workspace2.Get(ctx, kledConfig, args, false, cmd.Owner, log.Default.ErrorStreamOnly())
+	if err != nil {
+		return "", err
+	}
+	return client.Workspace(), nil
+}
+
+func (cmd *ScheduleCmd) request(ctx context.Context, method, workspaceID string, body interface{}) (*scheduleResponse, error) {
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	var reader io.Reader
+	if body != nil {
+		out, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		reader = bytes.NewReader(out)
+	}
+
+	url := strings.TrimSuffix(cmd.Server, "/") + "/api/workspaces/" + workspaceID + "/schedule/"
+	req, err := http.NewRequestWithContext(ctx, method, url, reader)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if cmd.APIKey != "" {
+		req.Header.Set("X-API-Key", cmd.APIKey)
+	}
+	if cmd.Project != "" {
+		req.Header.Set("X-Kled-Project", cmd.Project)
+	}
+
+	res, err := sso.HTTPClient(cmd.Server).Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	out, err := io.ReadAll(res.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	response := &scheduleResponse{}
+	if err := json.Unmarshal(out, response); err != nil {
+		return nil, fmt.Errorf("unexpected response (%d): %s", res.StatusCode, strings.TrimSpace(string(out)))
+	}
+	if res.StatusCode >= http.StatusBadRequest {
+		return nil, fmt.Errorf("%d: %s", res.StatusCode, response.Message)
+	}
+	return response, nil
+}
+
+func cronOrNever(expr string) string {
+	if expr == "" {
+		return "never"
+	}
+	return expr
+}
@@ -0,0 +1,264 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/loft-sh/devpod/cmd/completion"
+	"github.com/loft-sh/devpod/cmd/flags"
+	client2 "github.com/loft-sh/devpod/pkg/client"
+	"github.com/loft-sh/devpod/pkg/config"
+	"github.com/loft-sh/devpod/pkg/port"
+	"github.com/loft-sh/devpod/pkg/portmanager"
+	"github.com/loft-sh/devpod/pkg/sso"
+	"github.com/loft-sh/devpod/pkg/tunnel"
+	workspace2 "github.com/loft-sh/devpod/pkg/workspace"
+	"github.com/loft-sh/log"
+	"github.com/spf13/cobra"
+)
+
+// ShareCmd holds the share cmd flags
+type ShareCmd struct {
+	*flags.GlobalFlags
+
+	Port    int
+	TTL     time.Duration
+	Server  string
+	APIKey  string
+	Project string
+
+	// preview marks the link as the one of a preview environment, the
+	// server announces it with an event
+	preview *previewSource
+}
+
+type shareTunnel struct {
+	ID          string    `json:"id"`
+	WorkspaceID string    `json:"workspace_id"`
+	Port        int       `json:"port"`
+	ExpiresAt   time.Time `json:"expires_at"`
+}
+
+type shareResponse struct {
+	Status       string      `json:"status"`
+	Message      string      `json:"message"`
+	Tunnel       shareTunnel `json:"tunnel"`
+	URL          string      `json:"url"`
+	ConnectToken string      `json:"connect_token"`
+}
+
+// NewShareCmd creates a new command
+func NewShareCmd(flags *flags.GlobalFlags) *cobra.Command {
+	cmd := &ShareCmd{
+		GlobalFlags: flags,
+	}
+	shareCmd := &cobra.Command{
+		Use:   "share [flags] [workspace-path|workspace-name]",
+		Short: "Exposes a port of a workspace on a public link",
+		Long: `Exposes a port of a workspace on a public link served by the kled server.
+The link contains an access token and expires after the given TTL. The link
+is revoked when this command exits. Every access is recorded in the audit log.
+
+Tunnels are disabled unless the server sets TUNNELS_ENABLED.`,
+		RunE: func(cobraCmd *cobra.Command, args []string) error {
+			kledConfig, err := config.LoadConfig(cmd.Context, cmd.Provider)
+			if err != nil {
+				return err
+			}
+
+			client, err := workspace2.Get(cobraCmd.Context(), kledConfig, args, false, cmd.Owner, log.Default.ErrorStreamOnly())
+			if err != nil {
+				return err
+			}
+
+			return cmd.Run(cobraCmd.Context(), client, log.Default)
+		},
+		ValidArgsFunction: func(rootCmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+			return completion.GetWorkspaceSuggestions(rootCmd, cmd.Context, cmd.Provider, args, toComplete, cmd.Owner, log.Default)
+		},
+	}
+
+	shareCmd.Flags().IntVarP(&cmd.Port, "port", "p", 0, "The port inside the workspace to share")
+	shareCmd.Flags().DurationVar(&cmd.TTL, "ttl", time.Hour, "How long the link is valid, at most 24h")
+	shareCmd.Flags().StringVar(&cmd.Server, "server", os.Getenv("KLED_SERVER_URL"), "The Kled server URL. You can also use KLED_SERVER_URL to set this")
+	shareCmd.Flags().StringVar(&cmd.APIKey, "api-key", os.Getenv("KLED_API_KEY"), "The API key to authenticate with. You can also use KLED_API_KEY to set this")
+	shareCmd.Flags().StringVar(&cmd.Project, "project", os.Getenv("KLED_PROJECT"), "The project the link belongs to. You can also use KLED_PROJECT to set this")
+	_ = shareCmd.MarkFlagRequired("port")
+	return shareCmd
+}
+
+// Run runs the command logic
+func (cmd *ShareCmd) Run(ctx context.Context, client client2.BaseWorkspaceClient, log log.Logger) error {
+	if cmd.Server == "" {
+		return fmt.Errorf("no server specified, use --server or KLED_SERVER_URL")
+	}
+	if cmd.Port < 1 || cmd.Port > 65535 {
+		return fmt.Errorf("invalid port %d", cmd.Port)
+	}
+	if err := tunnel.ValidateTTL(cmd.TTL); err != nil {
+		return err
+	}
+
+	target, stop, err := cmd.localTarget(ctx, client, log)
+	if err != nil {
+		return err
+	}
+	defer stop()
+
+	share, err := cmd.createTunnel(ctx, client.Workspace())
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if time.Now().After(share.Tunnel.ExpiresAt) {
+			log.Info("Link expired")
+			return
+		}
+		if err := cmd.revokeTunnel(share.Tunnel.ID); err != nil {
+			log.Warnf("Error revoking link: %v", err)
+		} else {
+			log.Info("Link revoked")
+		}
+	}()
+
+	log.Donef("Port %d of workspace '%s' is available at:\n\n  %s\n", cmd.Port, client.Workspace(), share.URL)
+	log.Infof("The link expires at %s. Press Ctrl+C to revoke it", share.Tunnel.ExpiresAt.Local().Format(time.RFC1123))
+
+	ctx, cancel := context.WithDeadline(ctx, share.Tunnel.ExpiresAt)
+	defer cancel()
+	tunnelURL := strings.TrimSuffix(cmd.Server, "/") + "/api/tunnels/" + share.Tunnel.ID + "/"
+	return tunnel.ServeRelay(ctx, tunnelURL, share.ConnectToken, target, log)
+}
+
+// localTarget returns a local address that reaches the port in the
+// workspace. An existing forward is reused, otherwise the port is forwarded
+// by a background ssh session until stop is called.
+func (cmd *ShareCmd) localTarget(ctx context.Context, client client2.BaseWorkspaceClient, log log.Logger) (string, func(), error) {
+	forwards, err := portmanager.List(client.Context(), client.Workspace())
+	if err != nil {
+		return "", nil, fmt.Errorf("list forwarded ports: %w", err)
+	}
+	for _, forward := range forwards {
+		if forward.Remote == "localhost:"+strconv.Itoa(cmd.Port) {
+			log.Debugf("Using existing forward %s", forward.Local)
+			return strings.Replace(forward.Local, "0.0.0.0", "localhost", 1), func() {}, nil
+		}
+	}
+
+	localPort, err := port.FindAvailablePort(cmd.Port)
+	if err != nil {
+		return "", nil, err
+	}
+	execPath, err := os.Executable()
+	if err != nil {
+		return "", nil, err
+	}
+
+	log.Infof("Forwarding port %d of workspace '%s'", cmd.Port, client.Workspace())
+	forwardCmd := exec.CommandContext(ctx, execPath,
+		"ssh",
+		"--context", client.Context(),
+		"--forward-ports", fmt.Sprintf("%d:localhost:%d", localPort, cmd.Port),
+		"--start-services=false",
+		client.Workspace(),
+	)
+	forwardCmd.Stdout = io.Discard
+	forwardCmd.Stderr = io.Discard
+	if err := forwardCmd.Start(); err != nil {
+		return "", nil, fmt.Errorf("forward port: %w", err)
+	}
+	stop := func() {
+		_ = forwardCmd.Process.Kill()
+		_ = forwardCmd.Wait()
+	}
+
+	target := "localhost:" + strconv.Itoa(localPort)
+	for deadline := time.Now().Add(time.Minute); time.Now().Before(deadline); time.Sleep(500 * time.Millisecond) {
+		conn, err := net.DialTimeout("tcp", target, time.Second)
+		if err == nil {
+			_ = conn.Close()
+			return target, stop, nil
+		}
+	}
+
+	stop()
+	return "", nil, fmt.Errorf("timed out forwarding port %d of workspace '%s'", cmd.Port, client.Workspace())
+}
+
+func (cmd *ShareCmd) request(ctx context.Context, method, path string, body interface{}) (*shareResponse, error) {
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	var reader io.Reader
+	if body != nil {
+		out, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		reader = bytes.NewReader(out)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, strings.TrimSuffix(cmd.Server, "/")+path, reader)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if cmd.APIKey != "" {
+		req.Header.Set("X-API-Key", cmd.APIKey)
+	}
+	if cmd.Project != "" {
+		req.Header.Set("X-Kled-Project", cmd.Project)
+	}
+
+	res, err := sso.HTTPClient(cmd.Server).Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	out, err := io.ReadAll(res.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	response := &shareResponse{}
+	if err := json.Unmarshal(out, response); err != nil {
+		return nil, fmt.Errorf("unexpected response (%d): %s", res.StatusCode, strings.TrimSpace(string(out)))
+	}
+	if res.StatusCode >= http.StatusBadRequest {
+		return nil, fmt.Errorf("%d: %s", res.StatusCode, response.Message)
+	}
+	return response, nil
+}
+
+func (cmd *ShareCmd) createTunnel(ctx context.Context, workspaceID string) (*shareResponse, error) {
+	body := map[string]interface{}{
+		"workspace_id": workspaceID,
+		"port":         cmd.Port,
+		"ttl_seconds":  int(cmd.TTL.Seconds()),
+	}
+	if cmd.preview != nil {
+		body["preview"] = cmd.preview
+	}
+	response, err := cmd.request(ctx, http.MethodPost, "/api/tunnels/create/", body)
+	if err != nil {
+		return nil, fmt.Errorf("create link: %w", err)
+	}
+	return response, nil
+}
+
+func (cmd *ShareCmd) revokeTunnel(id string) error {
+	// the command context is already cancelled at this point
+	_, err := cmd.request(context.Background(), http.MethodDelete, "/api/tunnels/"+id+"/", nil)
+	return err
+}
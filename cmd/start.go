@@ -0,0 +1,80 @@
+package cmd
+
+import (
+	"context"
+
+	"github.com/loft-sh/devpod/cmd/completion"
+	"github.com/loft-sh/devpod/cmd/flags"
+	client2 "github.com/loft-sh/devpod/pkg/client"
+	"github.com/loft-sh/devpod/pkg/config"
+	workspace2 "github.com/loft-sh/devpod/pkg/workspace"
+	"github.com/loft-sh/log"
+	"github.com/spf13/cobra"
+)
+
+// StartCmd holds the start cmd flags
+type StartCmd struct {
+	*flags.GlobalFlags
+	BulkOptions
+}
+
+// NewStartCmd creates a new command
+func NewStartCmd(flags *flags.GlobalFlags) *cobra.Command {
+	cmd := &StartCmd{
+		GlobalFlags: flags,
+	}
+	startCmd := &cobra.Command{
+		Use:   "start [flags] [workspace-name...]",
+		Short: "Starts existing workspaces without opening an IDE",
+		Long: `Starts one or more existing workspaces without opening an IDE.
+
+Use --all or a label selector to start many workspaces at once:
+  kled workspace start --all
+  kled workspace start -l team=ml --parallel 8`,
+		RunE: func(cobraCmd *cobra.Command, args []string) error {
+			ctx, cancel := WithSignals(cobraCmd.Context())
+			defer cancel()
+
+			kledConfig, err := config.LoadConfig(cmd.Context, cmd.Provider)
+			if err != nil {
+				return err
+			}
+
+			if cmd.BulkOptions.enabled(args) {
+				return runBulk(ctx, kledConfig, cmd.GlobalFlags, cmd.BulkOptions, args, bulkOperation{
+					Verb:      "start",
+					Progress:  "Starting",
+					PastTense: "started",
+					Run: func(ctx context.Context, client client2.BaseWorkspaceClient, log log.Logger) error {
+						return cmd.Run(ctx, kledConfig, client, log)
+					},
+				})
+			}
+
+			client, err := workspace2.Get(ctx, kledConfig, args, false, cmd.Owner, log.Default)
+			if err != nil {
+				return err
+			}
+
+			return cmd.Run(ctx, kledConfig, client, log.Default)
+		},
+		ValidArgsFunction: func(rootCmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+			return completion.GetWorkspaceSuggestions(rootCmd, cmd.Context, cmd.Provider, args, toComplete, cmd.Owner, log.Default)
+		},
+	}
+
+	cmd.BulkOptions.addFlags(startCmd.Flags(), "start")
+	return startCmd
+}
+
+// Run runs the command logic
+func (cmd *StartCmd) Run(ctx context.Context, kledConfig *config.Config, client client2.BaseWorkspaceClient, log log.Logger) error {
+	// every workspace gets its own up command as up keeps per run state
+	upCmd := &UpCmd{
+		GlobalFlags:  cmd.GlobalFlags,
+		ConfigureSSH: true,
+	}
+	upCmd.SSHConfigPath = kledConfig.ContextOption(config.ContextOptionSSHConfigPath)
+
+	return upCmd.Run(ctx, kledConfig, client, nil, log)
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"strconv"
 	"time"
 
 	"github.com/loft-sh/devpod/cmd/completion"
@@ -11,8 +12,12 @@ import (
 	client2 "github.com/loft-sh/devpod/pkg/client"
 	"github.com/loft-sh/devpod/pkg/client/clientimplementation"
 	"github.com/loft-sh/devpod/pkg/config"
+	config2 "github.com/loft-sh/devpod/pkg/devcontainer/config"
+	provider2 "github.com/loft-sh/devpod/pkg/provider"
 	workspace2 "github.com/loft-sh/devpod/pkg/workspace"
+	"github.com/loft-sh/devpod/pkg/workspacestate"
 	"github.com/loft-sh/log"
+	"github.com/loft-sh/log/table"
 	"github.com/pkg/errors"
 	"github.com/spf13/cobra"
 )
@@ -85,6 +90,15 @@ func (cmd *StatusCmd) Run(ctx context.Context, client client2.BaseWorkspaceClien
 		return err
 	}
 
+	// lifecycle hook results are only known locally for workspaces started
+	// from this machine
+	var lifecycleHooks []config2.LifecycleHookResult
+	if result, err := provider2.LoadWorkspaceResult(client.Context(), client.Workspace()); err == nil && result != nil {
+		lifecycleHooks = result.LifecycleHooks
+	}
+
+	state := reconcileWorkspaceState(client, instanceStatus, log)
+
 	if cmd.Output == "plain" {
 		if instanceStatus == client2.StatusStopped {
 			log.Infof("Workspace '%s' is '%s', you can start it via 'kled up %s'", client.Workspace(), instanceStatus, client.Workspace())
@@ -95,12 +109,18 @@ func (cmd *StatusCmd) Run(ctx context.Context, client client2.BaseWorkspaceClien
 		} else {
 			log.Infof("Workspace '%s' is '%s'", client.Workspace(), instanceStatus)
 		}
+
+		printWorkspaceState(state, log)
+		printLifecycleHooks(lifecycleHooks, log)
 	} else if cmd.Output == "json" {
 		out, err := json.Marshal(&client2.WorkspaceStatus{
 			ID:       client.Workspace(),
 			Context:  client.Context(),
 			Provider: client.Provider(),
 			State:    string(instanceStatus),
+
+			LifecycleHooks: lifecycleHooks,
+			Lifecycle:      state,
 		})
 		if err != nil {
 			return err
@@ -113,3 +133,117 @@ func (cmd *StatusCmd) Run(ctx context.Context, client client2.BaseWorkspaceClien
 
 	return nil
 }
+
+func printLifecycleHooks(hooks []config2.LifecycleHookResult, log log.Logger) {
+	if len(hooks) == 0 {
+		return
+	}
+
+	tableEntries := [][]string{}
+	for _, hook := range hooks {
+		name := hook.Hook
+		if hook.Name != "" {
+			name += " (" + hook.Name + ")"
+		}
+
+		attempts := ""
+		if hook.Attempts > 0 {
+			attempts = strconv.Itoa(hook.Attempts)
+		}
+
+		finishedAt := ""
+		if hook.FinishedAt != nil {
+			finishedAt = hook.FinishedAt.Format(time.RFC3339)
+		}
+
+		tableEntries = append(tableEntries, []string{
+			name,
+			string(hook.State),
+			attempts,
+			finishedAt,
+			hook.Error,
+		})
+	}
+
+	table.PrintTable(log, []string{
+		"Lifecycle Hook",
+		"State",
+		"Attempts",
+		"Finished",
+		"Error",
+	}, tableEntries)
+}
+
+// reconcileWorkspaceState updates the recorded phase with the status observed
+// from the provider, e.g. when the machine was stopped outside of kled.
+// Workspaces in Error keep their state until the next up or stop.
+func reconcileWorkspaceState(client client2.BaseWorkspaceClient, instanceStatus client2.Status, log log.Logger) *workspacestate.State {
+	tracker := workspacestate.NewTracker(client.Context(), client.Workspace(), log)
+	state := tracker.State()
+	if state.Phase == workspacestate.PhaseError {
+		return state
+	}
+
+	observed := workspacestate.Phase("")
+	switch instanceStatus {
+	case client2.StatusRunning:
+		observed = workspacestate.PhaseRunning
+	case client2.StatusStopped:
+		observed = workspacestate.PhaseStopped
+	}
+	if observed == "" || observed == state.Phase {
+		return state
+	}
+
+	tracker.Set(observed, "Observed")
+	return tracker.State()
+}
+
+func printWorkspaceState(state *workspacestate.State, log log.Logger) {
+	if state == nil || state.Phase == "" {
+		return
+	}
+
+	phase := string(state.Phase)
+	if state.Reason != "" {
+		phase += " (" + state.Reason + ")"
+	}
+	log.Infof("Phase: %s since %s", phase, state.LastTransitionTime.Format(time.RFC3339))
+
+	if state.Phase == workspacestate.PhaseError {
+		if state.FailedStep != "" {
+			log.Infof("Failed step: %s", state.FailedStep)
+		}
+		if state.Message != "" {
+			log.Infof("Error: %s", state.Message)
+		}
+		if len(state.LogExcerpt) > 0 {
+			log.Info("Last log lines of the failed step:")
+			for _, line := range state.LogExcerpt {
+				log.Info("  " + line)
+			}
+		}
+	}
+
+	history := state.History
+	if len(history) > 5 {
+		history = history[len(history)-5:]
+	}
+
+	tableEntries := [][]string{}
+	for _, transition := range history {
+		tableEntries = append(tableEntries, []string{
+			transition.Timestamp.Format(time.RFC3339),
+			string(transition.From),
+			string(transition.To),
+			transition.Reason,
+		})
+	}
+
+	table.PrintTable(log, []string{
+		"Time",
+		"From",
+		"To",
+		"Reason",
+	}, tableEntries)
+}
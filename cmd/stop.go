@@ -10,6 +10,7 @@ import (
 	"github.com/loft-sh/devpod/pkg/client/clientimplementation"
 	"github.com/loft-sh/devpod/pkg/config"
 	workspace2 "github.com/loft-sh/devpod/pkg/workspace"
+	"github.com/loft-sh/devpod/pkg/workspacestate"
 	"github.com/loft-sh/log"
 	"github.com/pkg/errors"
 	"github.com/spf13/cobra"
@@ -19,6 +20,7 @@ import (
 type StopCmd struct {
 	*flags.GlobalFlags
 	client2.StopOptions
+	BulkOptions
 }
 
 // NewStopCmd creates a new destroy command
@@ -27,7 +29,7 @@ func NewStopCmd(flags *flags.GlobalFlags) *cobra.Command {
 		GlobalFlags: flags,
 	}
 	stopCmd := &cobra.Command{
-		Use:     "stop [flags] [workspace-path|workspace-name]",
+		Use:     "stop [flags] [workspace-path|workspace-name...]",
 		Aliases: []string{"down"},
 		Short:   "Stops an existing workspace",
 		RunE: func(cobraCmd *cobra.Command, args []string) error {
@@ -42,23 +44,35 @@ func NewStopCmd(flags *flags.GlobalFlags) *cobra.Command {
 				return fmt.Errorf("decode platform options: %w", err)
 			}
 
+			if cmd.BulkOptions.enabled(args) {
+				return runBulk(ctx, kledConfig, cmd.GlobalFlags, cmd.BulkOptions, args, bulkOperation{
+					Verb:      "stop",
+					Progress:  "Stopping",
+					PastTense: "stopped",
+					Run: func(ctx context.Context, client client2.BaseWorkspaceClient, log log.Logger) error {
+						return cmd.Run(ctx, kledConfig, client, log)
+					},
+				})
+			}
+
 			client, err := workspace2.Get(ctx, kledConfig, args, false, cmd.Owner, log.Default)
 			if err != nil {
 				return err
 			}
 
-			return cmd.Run(ctx, kledConfig, client)
+			return cmd.Run(ctx, kledConfig, client, log.Default)
 		},
 		ValidArgsFunction: func(rootCmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
 			return completion.GetWorkspaceSuggestions(rootCmd, cmd.Context, cmd.Provider, args, toComplete, cmd.Owner, log.Default)
 		},
 	}
 
+	cmd.BulkOptions.addFlags(stopCmd.Flags(), "stop")
 	return stopCmd
 }
 
 // Run runs the command logic
-func (cmd *StopCmd) Run(ctx context.Context, kledConfig *config.Config, client client2.BaseWorkspaceClient) error {
+func (cmd *StopCmd) Run(ctx context.Context, kledConfig *config.Config, client client2.BaseWorkspaceClient, log log.Logger) error {
 	// lock workspace
 	if !cmd.Platform.Enabled {
 		err := client.Lock(ctx)
@@ -76,32 +90,39 @@ func (cmd *StopCmd) Run(ctx context.Context, kledConfig *config.Config, client c
 		return fmt.Errorf("cannot stop workspace because it is '%s'", instanceStatus)
 	}
 
+	tracker := workspacestate.NewTracker(client.Context(), client.Workspace(), log)
+	tracker.Set(workspacestate.PhaseStopping, "Stop")
+
 	// stop if single machine provider
-	wasStopped, err := cmd.stopSingleMachine(ctx, client, kledConfig)
+	wasStopped, err := cmd.stopSingleMachine(ctx, client, kledConfig, log)
 	if err != nil {
+		tracker.Fail("stop", "StopFailed", err, nil)
 		return err
 	} else if wasStopped {
+		tracker.Set(workspacestate.PhaseStopped, "Stop")
 		return nil
 	}
 
 	// stop environment
 	err = client.Stop(ctx, client2.StopOptions{})
 	if err != nil {
+		tracker.Fail("stop", "StopFailed", err, nil)
 		return err
 	}
 
+	tracker.Set(workspacestate.PhaseStopped, "Stop")
 	return nil
 }
 
-func (cmd *StopCmd) stopSingleMachine(ctx context.Context, client client2.BaseWorkspaceClient, kledConfig *config.Config) (bool, error) {
+func (cmd *StopCmd) stopSingleMachine(ctx context.Context, client client2.BaseWorkspaceClient, kledConfig *config.Config, log log.Logger) (bool, error) {
 	// check if single machine
-	singleMachineName := workspace2.SingleMachineName(kledConfig, client.Provider(), log.Default)
+	singleMachineName := workspace2.SingleMachineName(kledConfig, client.Provider(), log)
 	if !kledConfig.Current().IsSingleMachine(client.Provider()) || client.WorkspaceConfig().Machine.ID != singleMachineName {
 		return false, nil
 	}
 
 	// try to find other workspace with same machine
-	workspaces, err := workspace2.List(ctx, kledConfig, false, cmd.Owner, log.Default)
+	workspaces, err := workspace2.List(ctx, kledConfig, false, cmd.Owner, log)
 	if err != nil {
 		return false, errors.Wrap(err, "list workspaces")
 	}
@@ -121,7 +142,7 @@ func (cmd *StopCmd) stopSingleMachine(ctx context.Context, client client2.BaseWo
 	}
 
 	// if we haven't found another workspace on this machine, delete the whole machine
-	machineClient, err := workspace2.GetMachine(kledConfig, []string{singleMachineName}, log.Default)
+	machineClient, err := workspace2.GetMachine(kledConfig, []string{singleMachineName}, log)
 	if err != nil {
 		return false, errors.Wrap(err, "get machine")
 	}
@@ -132,6 +153,6 @@ func (cmd *StopCmd) stopSingleMachine(ctx context.Context, client client2.BaseWo
 		return false, errors.Wrap(err, "delete machine")
 	}
 
-	log.Default.Donef("Successfully stopped workspace '%s'", client.Workspace())
+	log.Donef("Successfully stopped workspace '%s'", client.Workspace())
 	return true, nil
 }
@@ -0,0 +1,201 @@
+package cmd
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"time"
+
+	"github.com/alessio/shellescape"
+	"github.com/docker/go-units"
+	"github.com/loft-sh/devpod/cmd/completion"
+	"github.com/loft-sh/devpod/cmd/flags"
+	"github.com/loft-sh/devpod/pkg/agent"
+	client2 "github.com/loft-sh/devpod/pkg/client"
+	"github.com/loft-sh/devpod/pkg/config"
+	"github.com/loft-sh/devpod/pkg/filesync"
+	provider2 "github.com/loft-sh/devpod/pkg/provider"
+	workspace2 "github.com/loft-sh/devpod/pkg/workspace"
+	"github.com/loft-sh/log"
+	"github.com/spf13/cobra"
+)
+
+// SyncCmd holds the sync cmd flags
+type SyncCmd struct {
+	*flags.GlobalFlags
+
+	Local    string
+	Remote   string
+	Watch    bool
+	Interval time.Duration
+	Strategy string
+	Ignore   []string
+}
+
+// NewSyncCmd creates a new command
+func NewSyncCmd(flags *flags.GlobalFlags) *cobra.Command {
+	cmd := &SyncCmd{
+		GlobalFlags: flags,
+	}
+	syncCmd := &cobra.Command{
+		Use:   "sync [flags] [workspace-path|workspace-name]",
+		Short: "Syncs a local folder with a workspace",
+		Long: `Syncs a local folder with a folder in the workspace in both directions.
+Use this on providers without bind mounts, e.g. Kubernetes or remote machines,
+to edit files locally.
+
+Paths matching the patterns in the .kledignore file of the local folder or
+passed with --ignore are not synced. A path that changed on both sides since
+the last sync is a conflict, resolved by --strategy:
+  manual  keep both sides and report the conflict (default)
+  local   the local folder wins
+  remote  the workspace wins
+  newer   the side that was modified last wins
+
+With --watch the folder is synced on every local change and the workspace is
+polled every --interval until interrupted.`,
+		RunE: func(cobraCmd *cobra.Command, args []string) error {
+			kledConfig, err := config.LoadConfig(cmd.Context, cmd.Provider)
+			if err != nil {
+				return err
+			}
+
+			client, err := workspace2.Get(cobraCmd.Context(), kledConfig, args, false, cmd.Owner, log.Default.ErrorStreamOnly())
+			if err != nil {
+				return err
+			}
+
+			return cmd.Run(cobraCmd.Context(), client, log.Default)
+		},
+		ValidArgsFunction: func(rootCmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+			return completion.GetWorkspaceSuggestions(rootCmd, cmd.Context, cmd.Provider, args, toComplete, cmd.Owner, log.Default)
+		},
+	}
+
+	syncCmd.Flags().StringVar(&cmd.Local, "local", ".", "The local folder to sync")
+	syncCmd.Flags().StringVar(&cmd.Remote, "remote", "", "The folder in the workspace to sync, defaults to the workspace folder")
+	syncCmd.Flags().BoolVar(&cmd.Watch, "watch", false, "If true, keeps syncing changes until interrupted")
+	syncCmd.Flags().DurationVar(&cmd.Interval, "interval", 5*time.Second, "How often the workspace is checked for changes in watch mode")
+	syncCmd.Flags().StringVar(&cmd.Strategy, "strategy", string(filesync.StrategyManual), "How to resolve conflicts: manual, local, remote or newer")
+	syncCmd.Flags().StringArrayVar(&cmd.Ignore, "ignore", []string{}, "Additional ignore pattern, can be used multiple times")
+	return syncCmd
+}
+
+// Run runs the command logic
+func (cmd *SyncCmd) Run(ctx context.Context, client client2.BaseWorkspaceClient, log log.Logger) error {
+	strategy, err := filesync.ParseStrategy(cmd.Strategy)
+	if err != nil {
+		return err
+	}
+	if cmd.Watch && cmd.Interval < time.Second {
+		return fmt.Errorf("interval must be at least 1s")
+	}
+
+	localRoot, err := filepath.Abs(cmd.Local)
+	if err != nil {
+		return err
+	}
+	if info, err := os.Stat(localRoot); err != nil {
+		return err
+	} else if !info.IsDir() {
+		return fmt.Errorf("%s is not a folder", localRoot)
+	}
+
+	remoteRoot := cmd.Remote
+	if remoteRoot == "" {
+		remoteRoot, err = workspaceFolder(client)
+		if err != nil {
+			return err
+		}
+	}
+
+	ignore, err := filesync.LoadIgnorePatterns(localRoot, cmd.Ignore)
+	if err != nil {
+		return err
+	}
+	statePath, err := syncStatePath(client, localRoot, remoteRoot)
+	if err != nil {
+		return err
+	}
+
+	session, err := filesync.NewSession(
+		&filesync.LocalReplica{Root: localRoot},
+		&filesync.RemoteReplica{Root: remoteRoot, Command: syncHelperCommand(client)},
+		filesync.Options{Strategy: strategy, Ignore: ignore, StatePath: statePath},
+		log,
+	)
+	if err != nil {
+		return err
+	}
+
+	log.Infof("Syncing %s with %s in workspace '%s'", localRoot, remoteRoot, client.Workspace())
+	if cmd.Watch {
+		log.Info("Watching for changes, press Ctrl+C to stop")
+		return session.Watch(ctx, localRoot, cmd.Interval)
+	}
+
+	result, err := session.Sync(ctx)
+	if err != nil {
+		return err
+	}
+	if !result.Changed() && len(result.Conflicts) == 0 {
+		log.Done("Already in sync")
+		return nil
+	}
+
+	log.Donef("Pushed %d, pulled %d, deleted %d locally and %d in the workspace (%s)", result.Pushed, result.Pulled, result.DeletedLocal, result.DeletedRemote, units.HumanSize(float64(result.Bytes)))
+	if len(result.Conflicts) > 0 {
+		return fmt.Errorf("%d conflict(s) were not synced, resolve them or rerun with --strategy", len(result.Conflicts))
+	}
+	return nil
+}
+
+// workspaceFolder returns the folder the workspace source was checked out to.
+func workspaceFolder(client client2.BaseWorkspaceClient) (string, error) {
+	result, err := provider2.LoadWorkspaceResult(client.Context(), client.Workspace())
+	if err != nil {
+		return "", err
+	}
+	if result == nil || result.SubstitutionContext == nil || result.SubstitutionContext.ContainerWorkspaceFolder == "" {
+		return "", fmt.Errorf("workspace folder of '%s' is unknown, start the workspace or use --remote", client.Workspace())
+	}
+
+	return result.SubstitutionContext.ContainerWorkspaceFolder, nil
+}
+
+// syncStatePath returns where the state of the last sync between the two
+// folders is stored.
+func syncStatePath(client client2.BaseWorkspaceClient, localRoot, remoteRoot string) (string, error) {
+	workspaceDir, err := provider2.GetWorkspaceDir(client.Context(), client.Workspace())
+	if err != nil {
+		return "", err
+	}
+
+	hash := sha256.Sum256([]byte(localRoot + "\x00" + remoteRoot))
+	return filepath.Join(workspaceDir, "sync", hex.EncodeToString(hash[:8])+".json"), nil
+}
+
+// syncHelperCommand runs the filesync helper of the agent through kled ssh.
+// The helper runs as the workspace user, so synced files belong to them.
+func syncHelperCommand(client client2.BaseWorkspaceClient) filesync.CommandFunc {
+	return func(ctx context.Context, args []string) (*exec.Cmd, error) {
+		execPath, err := os.Executable()
+		if err != nil {
+			return nil, err
+		}
+
+		helperArgs := append([]string{agent.ContainerKledHelperLocation, "agent", "container", "filesync"}, args...)
+		return exec.CommandContext(ctx, execPath,
+			"ssh",
+			"--agent-forwarding=false",
+			"--start-services=false",
+			"--context", client.Context(),
+			client.Workspace(),
+			"--command", shellescape.QuoteCommand(helperArgs),
+		), nil
+	}
+}
@@ -0,0 +1,49 @@
+package template
+
+import (
+	"context"
+
+	"github.com/loft-sh/devpod/cmd/flags"
+	"github.com/loft-sh/devpod/pkg/workspacetemplate"
+	"github.com/loft-sh/log"
+	"github.com/spf13/cobra"
+)
+
+// AddCmd holds the add cmd flags
+type AddCmd struct {
+	flags.GlobalFlags
+}
+
+// NewAddCmd creates a new command
+func NewAddCmd(flags *flags.GlobalFlags) *cobra.Command {
+	cmd := &AddCmd{
+		GlobalFlags: *flags,
+	}
+	addCmd := &cobra.Command{
+		Use:   "add [folder|git-url|oci://reference]",
+		Short: "Adds a workspace template from a folder, git repository or OCI registry",
+		Long: `Adds a workspace template. A template is a folder with a template.yaml
+at its root, for example:
+
+kled template add ./my-template
+kled template add github.com/my-org/templates@main/pytorch-cuda12
+kled template add oci://ghcr.io/my-org/templates/pytorch-cuda12:1.0`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cobraCmd *cobra.Command, args []string) error {
+			return cmd.Run(cobraCmd.Context(), args[0])
+		},
+	}
+
+	return addCmd
+}
+
+// Run runs the command logic
+func (cmd *AddCmd) Run(ctx context.Context, source string) error {
+	template, err := workspacetemplate.Add(ctx, source, log.Default)
+	if err != nil {
+		return err
+	}
+
+	log.Default.Donef("Successfully added template %s", template.Name)
+	return nil
+}
@@ -0,0 +1,44 @@
+package template
+
+import (
+	"context"
+
+	"github.com/loft-sh/devpod/cmd/flags"
+	"github.com/loft-sh/devpod/pkg/workspacetemplate"
+	"github.com/loft-sh/log"
+	"github.com/spf13/cobra"
+)
+
+// DeleteCmd holds the delete cmd flags
+type DeleteCmd struct {
+	flags.GlobalFlags
+}
+
+// NewDeleteCmd creates a new command
+func NewDeleteCmd(flags *flags.GlobalFlags) *cobra.Command {
+	cmd := &DeleteCmd{
+		GlobalFlags: *flags,
+	}
+	deleteCmd := &cobra.Command{
+		Use:   "delete [name]",
+		Short: "Delete an installed workspace template",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(_ *cobra.Command, args []string) error {
+			return cmd.Run(context.Background(), args[0])
+		},
+		ValidArgsFunction: suggestTemplates,
+	}
+
+	return deleteCmd
+}
+
+// Run runs the command logic
+func (cmd *DeleteCmd) Run(ctx context.Context, name string) error {
+	err := workspacetemplate.Remove(name)
+	if err != nil {
+		return err
+	}
+
+	log.Default.Donef("Successfully deleted template %s", name)
+	return nil
+}
@@ -0,0 +1,89 @@
+package template
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/loft-sh/devpod/cmd/flags"
+	"github.com/loft-sh/devpod/pkg/workspacetemplate"
+	"github.com/loft-sh/log"
+	"github.com/loft-sh/log/table"
+	"github.com/spf13/cobra"
+)
+
+// ListCmd holds the list cmd flags
+type ListCmd struct {
+	flags.GlobalFlags
+
+	Output string
+}
+
+// NewListCmd creates a new command
+func NewListCmd(flags *flags.GlobalFlags) *cobra.Command {
+	cmd := &ListCmd{
+		GlobalFlags: *flags,
+	}
+	listCmd := &cobra.Command{
+		Use:     "list",
+		Aliases: []string{"ls"},
+		Short:   "List installed workspace templates",
+		Args:    cobra.NoArgs,
+		RunE: func(_ *cobra.Command, args []string) error {
+			return cmd.Run(context.Background())
+		},
+	}
+
+	listCmd.Flags().StringVar(&cmd.Output, "output", "plain", "The output format to use. Can be json or plain")
+	return listCmd
+}
+
+// Run runs the command logic
+func (cmd *ListCmd) Run(ctx context.Context) error {
+	templates, err := workspacetemplate.List()
+	if err != nil {
+		return err
+	}
+
+	if cmd.Output == "plain" {
+		tableEntries := [][]string{}
+		for _, template := range templates {
+			provider := ""
+			if template.Provider != nil {
+				provider = template.Provider.Name
+			}
+
+			secrets := []string{}
+			for _, secret := range template.Secrets {
+				secrets = append(secrets, secret.Name)
+			}
+
+			tableEntries = append(tableEntries, []string{
+				template.Name,
+				template.Version,
+				provider,
+				strings.Join(secrets, ","),
+				template.Description,
+			})
+		}
+
+		table.PrintTable(log.Default, []string{
+			"Name",
+			"Version",
+			"Provider",
+			"Secrets",
+			"Description",
+		}, tableEntries)
+	} else if cmd.Output == "json" {
+		out, err := json.MarshalIndent(templates, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Print(string(out))
+	} else {
+		return fmt.Errorf("unexpected output format, choose either json or plain. Got %s", cmd.Output)
+	}
+
+	return nil
+}
@@ -0,0 +1,20 @@
+package template
+
+import (
+	"github.com/loft-sh/devpod/cmd/flags"
+	"github.com/spf13/cobra"
+)
+
+// NewTemplateCmd returns a new command
+func NewTemplateCmd(flags *flags.GlobalFlags) *cobra.Command {
+	templateCmd := &cobra.Command{
+		Use:   "template",
+		Short: "Kled Workspace Template commands",
+	}
+
+	templateCmd.AddCommand(NewListCmd(flags))
+	templateCmd.AddCommand(NewAddCmd(flags))
+	templateCmd.AddCommand(NewUseCmd(flags))
+	templateCmd.AddCommand(NewDeleteCmd(flags))
+	return templateCmd
+}
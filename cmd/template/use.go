@@ -0,0 +1,109 @@
+package template
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/loft-sh/devpod/cmd/flags"
+	"github.com/loft-sh/devpod/pkg/copy"
+	"github.com/loft-sh/devpod/pkg/workspacetemplate"
+	"github.com/loft-sh/log"
+	"github.com/spf13/cobra"
+)
+
+// UseCmd holds the use cmd flags
+type UseCmd struct {
+	flags.GlobalFlags
+}
+
+// NewUseCmd creates a new command
+func NewUseCmd(flags *flags.GlobalFlags) *cobra.Command {
+	cmd := &UseCmd{
+		GlobalFlags: *flags,
+	}
+	useCmd := &cobra.Command{
+		Use:   "use [name] [folder]",
+		Short: "Scaffolds the files of a workspace template into a folder",
+		Long: `Copies the devcontainer.json, scripts and other files of a template into
+the given folder, or the current one. Existing files are never overwritten.
+
+Use 'kled workspace create --template [name]' to scaffold and create the
+workspace with the template's provider defaults and secrets in one step.`,
+		Args: cobra.RangeArgs(1, 2),
+		RunE: func(_ *cobra.Command, args []string) error {
+			folder := "."
+			if len(args) == 2 {
+				folder = args[1]
+			}
+
+			return cmd.Run(context.Background(), args[0], folder)
+		},
+		ValidArgsFunction: suggestTemplates,
+	}
+
+	return useCmd
+}
+
+// Run runs the command logic
+func (cmd *UseCmd) Run(ctx context.Context, name, folder string) error {
+	template, err := workspacetemplate.Get(name)
+	if err != nil {
+		return err
+	}
+
+	err = copy.CreateIfNotExists(folder, 0755)
+	if err != nil {
+		return err
+	}
+
+	files, err := workspacetemplate.Scaffold(template, folder)
+	if err != nil {
+		return fmt.Errorf("scaffold template %s: %w", name, err)
+	}
+	for _, file := range files {
+		log.Default.Infof("Created %s", file)
+	}
+
+	if template.Provider != nil && template.Provider.Name != "" {
+		providerOptions := []string{}
+		for key, value := range template.Provider.Options {
+			providerOptions = append(providerOptions, fmt.Sprintf("--provider-option %s=%s", key, value))
+		}
+		sort.Strings(providerOptions)
+
+		log.Default.Infof("Template %s suggests provider %s %s", name, template.Provider.Name, strings.Join(providerOptions, " "))
+	}
+
+	for _, secret := range template.MissingSecrets(os.LookupEnv) {
+		if secret.Description != "" {
+			log.Default.Warnf("Secret %s is required by the template, but not set: %s", secret.Name, secret.Description)
+		} else {
+			log.Default.Warnf("Secret %s is required by the template, but not set", secret.Name)
+		}
+	}
+
+	log.Default.Donef("Successfully scaffolded template %s into %s", name, folder)
+	return nil
+}
+
+func suggestTemplates(cobraCmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	if len(args) > 0 {
+		return nil, cobra.ShellCompDirectiveDefault
+	}
+
+	templates, err := workspacetemplate.List()
+	if err != nil {
+		return nil, cobra.ShellCompDirectiveError
+	}
+
+	suggestions := []string{}
+	for _, template := range templates {
+		if strings.HasPrefix(template.Name, toComplete) {
+			suggestions = append(suggestions, template.Name)
+		}
+	}
+	return suggestions, cobra.ShellCompDirectiveNoFileComp
+}
@@ -0,0 +1,314 @@
+package test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/loft-sh/devpod/cmd/flags"
+	"github.com/loft-sh/devpod/pkg/config"
+	"github.com/loft-sh/devpod/pkg/probe"
+	provider2 "github.com/loft-sh/devpod/pkg/provider"
+	"github.com/loft-sh/log"
+	"github.com/loft-sh/log/table"
+	"github.com/spf13/cobra"
+)
+
+// BenchmarkCmd holds the configuration
+type BenchmarkCmd struct {
+	*flags.GlobalFlags
+
+	ID                  string
+	Image               string
+	SizeMiB             int
+	Iterations          int
+	RegressionThreshold float64
+	FailOnRegression    bool
+	Keep                bool
+	History             bool
+	Output              string
+}
+
+// NewBenchmarkCmd creates a new command
+func NewBenchmarkCmd(flags *flags.GlobalFlags) *cobra.Command {
+	cmd := &BenchmarkCmd{
+		GlobalFlags: flags,
+	}
+	benchmarkCmd := &cobra.Command{
+		Use:   "benchmark [source]",
+		Short: "Benchmarks a workspace on the current provider",
+		Long: `Creates a workspace from the source and measures its cold start, the
+throughput of file I/O in the workspace folder and the latency of starting
+sh, python3 and node in it. For the docker provider, the time to pull the
+workspace image is measured after the workspace was deleted, which removes
+the image from the local cache.
+
+Results are stored per provider in the kled home and compared to the
+previous run; --history shows the last run of every provider.
+
+Example:
+  kled test benchmark --provider docker github.com/microsoft/vscode-remote-try-go`,
+		Args: cobra.MaximumNArgs(1),
+		RunE: func(cobraCmd *cobra.Command, args []string) error {
+			return cmd.Run(cobraCmd.Context(), args)
+		},
+	}
+
+	benchmarkCmd.Flags().StringVar(&cmd.ID, "id", "kled-benchmark", "The id of the benchmark workspace. An existing workspace with the id is deleted")
+	benchmarkCmd.Flags().StringVar(&cmd.Image, "image", "", "The image to measure pulling. Defaults to the image of the devcontainer.json")
+	benchmarkCmd.Flags().IntVar(&cmd.SizeMiB, "size", 256, "The size of the file written and read in MiB")
+	benchmarkCmd.Flags().IntVar(&cmd.Iterations, "iterations", 10, "How often each interpreter is started")
+	benchmarkCmd.Flags().Float64Var(&cmd.RegressionThreshold, "regression-threshold", 0.2, "How much worse than the previous run a measurement may get, e.g. 0.2 for 20%")
+	benchmarkCmd.Flags().BoolVar(&cmd.FailOnRegression, "fail-on-regression", false, "Exit non-zero if a measurement regressed")
+	benchmarkCmd.Flags().BoolVar(&cmd.Keep, "keep", false, "Keep the workspace after the benchmark")
+	benchmarkCmd.Flags().BoolVar(&cmd.History, "history", false, "Show the last benchmark of every provider instead of running one")
+	benchmarkCmd.Flags().StringVar(&cmd.Output, "output", "plain", "The output format to use. Can be json or plain")
+	return benchmarkCmd
+}
+
+// Run runs the command logic
+func (cmd *BenchmarkCmd) Run(ctx context.Context, args []string) error {
+	if err := validateOutput(cmd.Output); err != nil {
+		return err
+	}
+	configDir, err := config.GetConfigDir()
+	if err != nil {
+		return err
+	}
+	store := &probe.BenchmarkStore{Dir: filepath.Join(configDir, "benchmarks")}
+	if cmd.History {
+		return cmd.printHistory(store)
+	}
+
+	kledConfig, err := config.LoadConfig(cmd.Context, cmd.Provider)
+	if err != nil {
+		return err
+	}
+	provider := kledConfig.Current().DefaultProvider
+	if provider == "" {
+		return fmt.Errorf("no provider selected, use --provider or kled provider use")
+	}
+	source := "."
+	if len(args) > 0 {
+		source = args[0]
+	}
+
+	benchmark, err := cmd.benchmark(ctx, kledConfig.DefaultContext, provider, source)
+	if err != nil {
+		return err
+	}
+
+	previous, err := store.Load(provider)
+	if err != nil {
+		return err
+	}
+	var last *probe.Benchmark
+	if len(previous) > 0 {
+		last = &previous[len(previous)-1]
+	}
+	comparisons := probe.Compare(last, *benchmark, cmd.RegressionThreshold)
+	if err := store.Save(*benchmark); err != nil {
+		return fmt.Errorf("save benchmark: %w", err)
+	}
+
+	if err := cmd.printComparisons(benchmark, comparisons); err != nil {
+		return err
+	}
+	if cmd.FailOnRegression {
+		regressed := []string{}
+		for _, comparison := range comparisons {
+			if comparison.Regression {
+				regressed = append(regressed, comparison.Name)
+			}
+		}
+		if len(regressed) > 0 {
+			return fmt.Errorf("%d measurement(s) regressed: %s", len(regressed), strings.Join(regressed, ", "))
+		}
+	}
+	return nil
+}
+
+func (cmd *BenchmarkCmd) benchmark(ctx context.Context, kledContext, provider, source string) (*probe.Benchmark, error) {
+	benchmark := &probe.Benchmark{Provider: provider, Source: source, Time: time.Now()}
+	deleted := false
+	defer func() {
+		if !deleted && !cmd.Keep {
+			if _, err := cmd.kled(context.Background(), "delete", cmd.ID, "--force", "--ignore-not-found"); err != nil {
+				log.Default.Errorf("Error deleting workspace '%s': %v", cmd.ID, err)
+			}
+		}
+	}()
+
+	log.Default.Infof("Deleting existing benchmark workspace '%s'", cmd.ID)
+	if _, err := cmd.kled(ctx, "delete", cmd.ID, "--force", "--ignore-not-found"); err != nil {
+		return nil, err
+	}
+
+	log.Default.Infof("Measuring cold start of %s on %s", source, provider)
+	start := time.Now()
+	if _, err := cmd.kled(ctx, "up", source, "--id", cmd.ID, "--ide", "none", "--open-ide=false"); err != nil {
+		return nil, err
+	}
+	benchmark.Add("cold-start", time.Since(start), time.Second, "s")
+
+	log.Default.Info("Measuring file I/O and interpreter latency")
+	out, err := cmd.kled(ctx, "ssh", cmd.ID, "--start-services=false", "--command", probe.BenchmarkScript(cmd.SizeMiB, cmd.Iterations))
+	if err != nil {
+		return nil, err
+	}
+	if err := probe.ParseBenchmarkScript(out, cmd.SizeMiB, benchmark); err != nil {
+		return nil, err
+	}
+
+	if provider != "docker" {
+		benchmark.Skip("image-pull", "only measured for the docker provider")
+		return benchmark, nil
+	} else if cmd.Keep {
+		benchmark.Skip("image-pull", "the image is in use by the kept workspace")
+		return benchmark, nil
+	}
+	image := cmd.Image
+	if image == "" {
+		result, err := provider2.LoadWorkspaceResult(kledContext, cmd.ID)
+		if err == nil && result != nil && result.MergedConfig != nil {
+			image = result.MergedConfig.Image
+		}
+	}
+	if image == "" {
+		benchmark.Skip("image-pull", "the devcontainer.json has no image, use --image")
+		return benchmark, nil
+	}
+
+	deleted = true
+	if _, err := cmd.kled(ctx, "delete", cmd.ID, "--force", "--ignore-not-found"); err != nil {
+		return nil, err
+	}
+	log.Default.Infof("Measuring pull of %s", image)
+	_ = exec.CommandContext(ctx, "docker", "image", "rm", image).Run()
+	start = time.Now()
+	if out, err := exec.CommandContext(ctx, "docker", "pull", image).CombinedOutput(); err != nil {
+		return nil, fmt.Errorf("docker pull %s: %v: %s", image, err, strings.TrimSpace(string(out)))
+	}
+	benchmark.Add("image-pull", time.Since(start), time.Second, "s")
+	return benchmark, nil
+}
+
+// kled runs a kled command with the global flags and returns its stdout.
+func (cmd *BenchmarkCmd) kled(ctx context.Context, args ...string) ([]byte, error) {
+	self, err := os.Executable()
+	if err != nil {
+		return nil, err
+	}
+	if cmd.Context != "" {
+		args = append(args, "--context", cmd.Context)
+	}
+	if cmd.Provider != "" && args[0] == "up" {
+		args = append(args, "--provider", cmd.Provider)
+	}
+
+	out, err := exec.CommandContext(ctx, self, args...).Output()
+	if err != nil {
+		message := err.Error()
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			stderr := strings.TrimSpace(string(exitErr.Stderr))
+			if len(stderr) > 2000 {
+				stderr = stderr[len(stderr)-2000:]
+			}
+			message += ": " + stderr
+		}
+		return nil, fmt.Errorf("kled %s: %s", args[0], message)
+	}
+	return out, nil
+}
+
+func (cmd *BenchmarkCmd) printComparisons(benchmark *probe.Benchmark, comparisons []probe.Comparison) error {
+	if cmd.Output == "json" {
+		out, err := json.Marshal(map[string]interface{}{
+			"provider":     benchmark.Provider,
+			"source":       benchmark.Source,
+			"time":         benchmark.Time,
+			"measurements": comparisons,
+		})
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(out))
+		return nil
+	}
+
+	tableEntries := [][]string{}
+	for _, comparison := range comparisons {
+		if comparison.Skipped != "" {
+			tableEntries = append(tableEntries, []string{comparison.Name, "-", "-", "-", comparison.Skipped})
+			continue
+		}
+		previous, change, note := "-", "-", ""
+		if comparison.Previous != nil {
+			previous = formatValue(*comparison.Previous, comparison.Unit)
+			change = fmt.Sprintf("%+.0f%%", comparison.Change*100)
+		}
+		if comparison.Regression {
+			note = "regression"
+		}
+		tableEntries = append(tableEntries, []string{comparison.Name, formatValue(comparison.Value, comparison.Unit), previous, change, note})
+	}
+	table.PrintTable(log.Default, []string{
+		"Measurement",
+		"Value",
+		"Previous",
+		"Worse by",
+		"Note",
+	}, tableEntries)
+	return nil
+}
+
+func (cmd *BenchmarkCmd) printHistory(store *probe.BenchmarkStore) error {
+	latest, err := store.Latest()
+	if err != nil {
+		return err
+	}
+	if cmd.Output == "json" {
+		out, err := json.Marshal(latest)
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(out))
+		return nil
+	}
+
+	names := []string{}
+	for _, benchmark := range latest {
+		for _, measurement := range benchmark.Measurements {
+			if !slices.Contains(names, measurement.Name) {
+				names = append(names, measurement.Name)
+			}
+		}
+	}
+	tableEntries := [][]string{}
+	for _, benchmark := range latest {
+		entry := []string{benchmark.Provider, benchmark.Time.Format(time.DateTime)}
+		for _, name := range names {
+			if measurement := benchmark.Get(name); measurement != nil {
+				entry = append(entry, formatValue(measurement.Value, measurement.Unit))
+			} else {
+				entry = append(entry, "-")
+			}
+		}
+		tableEntries = append(tableEntries, entry)
+	}
+	table.PrintTable(log.Default, append([]string{"Provider", "Time"}, names...), tableEntries)
+	return nil
+}
+
+func formatValue(value float64, unit string) string {
+	return strconv.FormatFloat(value, 'f', -1, 64) + " " + unit
+}
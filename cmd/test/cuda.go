@@ -0,0 +1,80 @@
+package test
+
+import (
+	"context"
+	"strconv"
+
+	"github.com/loft-sh/devpod/cmd/flags"
+	"github.com/loft-sh/devpod/pkg/probe"
+	"github.com/spf13/cobra"
+)
+
+// CUDACmd holds the configuration
+type CUDACmd struct {
+	*flags.GlobalFlags
+
+	MinGPUs    int
+	MinVersion string
+	MinMemory  string
+	Output     string
+}
+
+// NewCUDACmd creates a new command
+func NewCUDACmd(flags *flags.GlobalFlags) *cobra.Command {
+	cmd := &CUDACmd{
+		GlobalFlags: flags,
+	}
+	cudaCmd := &cobra.Command{
+		Use:   "cuda [workspace]",
+		Short: "Checks the NVIDIA GPUs and CUDA version of this machine or a workspace",
+		Long: `Lists the NVIDIA GPUs with nvidia-smi and checks the CUDA version the driver
+supports. With a workspace, the checks run in its container, which shows
+whether the GPUs were passed through.
+
+The command exits non-zero if a check fails.`,
+		Args: cobra.MaximumNArgs(1),
+		RunE: func(cobraCmd *cobra.Command, args []string) error {
+			return cmd.Run(cobraCmd.Context(), args)
+		},
+	}
+
+	cudaCmd.Flags().IntVar(&cmd.MinGPUs, "min-gpus", 1, "The number of GPUs required")
+	cudaCmd.Flags().StringVar(&cmd.MinVersion, "min-version", "", "The CUDA version the driver has to support, e.g. 12.1")
+	cudaCmd.Flags().StringVar(&cmd.MinMemory, "min-memory", "", "The memory each GPU needs, e.g. 16g")
+	cudaCmd.Flags().StringVar(&cmd.Output, "output", "plain", "The output format to use. Can be json or plain")
+	return cudaCmd
+}
+
+// Run runs the command logic
+func (cmd *CUDACmd) Run(ctx context.Context, args []string) error {
+	if err := validateOutput(cmd.Output); err != nil {
+		return err
+	}
+	minMemory, err := parseSize("min-memory", cmd.MinMemory)
+	if err != nil {
+		return err
+	}
+
+	var report *probe.Report
+	if len(args) > 0 {
+		remoteArgs := []string{"cuda", "--min-gpus", strconv.Itoa(cmd.MinGPUs)}
+		if cmd.MinVersion != "" {
+			remoteArgs = append(remoteArgs, "--min-version", cmd.MinVersion)
+		}
+		if cmd.MinMemory != "" {
+			remoteArgs = append(remoteArgs, "--min-memory", cmd.MinMemory)
+		}
+
+		report, err = probeWorkspace(ctx, cmd.GlobalFlags, args[0], remoteArgs)
+		if err != nil {
+			return err
+		}
+	} else {
+		report = probe.GPUs(ctx, probe.CUDAOptions{
+			MinGPUs:      cmd.MinGPUs,
+			MinVersion:   cmd.MinVersion,
+			MinMemoryMiB: float64(minMemory) / (1 << 20),
+		})
+	}
+	return printReport(report, cmd.Output)
+}
@@ -0,0 +1,117 @@
+package test
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/docker/go-units"
+	"github.com/loft-sh/devpod/cmd/flags"
+	"github.com/loft-sh/devpod/pkg/probe"
+	"github.com/spf13/cobra"
+)
+
+// ResourcesCmd holds the configuration
+type ResourcesCmd struct {
+	*flags.GlobalFlags
+
+	MinCPUs   float64
+	MinMemory string
+	MinDisk   string
+	Paths     []string
+	Endpoints []string
+	Timeout   time.Duration
+	Output    string
+}
+
+// NewResourcesCmd creates a new command
+func NewResourcesCmd(flags *flags.GlobalFlags) *cobra.Command {
+	cmd := &ResourcesCmd{
+		GlobalFlags: flags,
+	}
+	resourcesCmd := &cobra.Command{
+		Use:   "resources [workspace]",
+		Short: "Checks CPU, memory, disk and network of this machine or a workspace",
+		Long: `Probes the CPUs, memory and disks including container limits, and checks
+that the given endpoints are reachable. With a workspace, the checks run in its
+container.
+
+The command exits non-zero if a check fails.`,
+		Args: cobra.MaximumNArgs(1),
+		RunE: func(cobraCmd *cobra.Command, args []string) error {
+			return cmd.Run(cobraCmd.Context(), args)
+		},
+	}
+
+	resourcesCmd.Flags().Float64Var(&cmd.MinCPUs, "min-cpus", 0, "The number of CPUs required, e.g. 2 or 0.5")
+	resourcesCmd.Flags().StringVar(&cmd.MinMemory, "min-memory", "", "The memory required, e.g. 4g")
+	resourcesCmd.Flags().StringVar(&cmd.MinDisk, "min-disk", "", "The free disk space required on each path, e.g. 20g")
+	resourcesCmd.Flags().StringArrayVar(&cmd.Paths, "path", []string{"/"}, "The directory whose file system is checked, can be given multiple times")
+	resourcesCmd.Flags().StringArrayVar(&cmd.Endpoints, "endpoint", probe.DefaultEndpoints, "A host:port that has to be reachable, can be given multiple times")
+	resourcesCmd.Flags().DurationVar(&cmd.Timeout, "timeout", 5*time.Second, "The timeout for each endpoint")
+	resourcesCmd.Flags().StringVar(&cmd.Output, "output", "plain", "The output format to use. Can be json or plain")
+	return resourcesCmd
+}
+
+// Run runs the command logic
+func (cmd *ResourcesCmd) Run(ctx context.Context, args []string) error {
+	if err := validateOutput(cmd.Output); err != nil {
+		return err
+	}
+	options := probe.ResourceOptions{
+		MinCPUs:   cmd.MinCPUs,
+		Paths:     cmd.Paths,
+		Endpoints: cmd.Endpoints,
+		Timeout:   cmd.Timeout,
+	}
+	var err error
+	if options.MinMemory, err = parseSize("min-memory", cmd.MinMemory); err != nil {
+		return err
+	}
+	if options.MinDisk, err = parseSize("min-disk", cmd.MinDisk); err != nil {
+		return err
+	}
+
+	var report *probe.Report
+	if len(args) > 0 {
+		report, err = probeWorkspace(ctx, cmd.GlobalFlags, args[0], cmd.remoteArgs())
+		if err != nil {
+			return err
+		}
+	} else {
+		report = probe.Resources(ctx, options)
+	}
+	return printReport(report, cmd.Output)
+}
+
+func (cmd *ResourcesCmd) remoteArgs() []string {
+	args := []string{"resources", "--timeout", cmd.Timeout.String()}
+	if cmd.MinCPUs > 0 {
+		args = append(args, "--min-cpus", strconv.FormatFloat(cmd.MinCPUs, 'f', -1, 64))
+	}
+	if cmd.MinMemory != "" {
+		args = append(args, "--min-memory", cmd.MinMemory)
+	}
+	if cmd.MinDisk != "" {
+		args = append(args, "--min-disk", cmd.MinDisk)
+	}
+	for _, path := range cmd.Paths {
+		args = append(args, "--path", path)
+	}
+	for _, endpoint := range cmd.Endpoints {
+		args = append(args, "--endpoint", endpoint)
+	}
+	return args
+}
+
+func parseSize(flag, size string) (uint64, error) {
+	if size == "" {
+		return 0, nil
+	}
+	bytes, err := units.RAMInBytes(size)
+	if err != nil || bytes < 0 {
+		return 0, fmt.Errorf("invalid --%s %q", flag, size)
+	}
+	return uint64(bytes), nil
+}
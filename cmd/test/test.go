@@ -0,0 +1,98 @@
+package test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/alessio/shellescape"
+	"github.com/loft-sh/devpod/cmd/flags"
+	"github.com/loft-sh/devpod/pkg/agent"
+	"github.com/loft-sh/devpod/pkg/probe"
+	"github.com/loft-sh/log"
+	"github.com/loft-sh/log/table"
+	"github.com/spf13/cobra"
+)
+
+// NewTestCmd returns a new command
+func NewTestCmd(flags *flags.GlobalFlags) *cobra.Command {
+	testCmd := &cobra.Command{
+		Use:   "test",
+		Short: "Kled environment checks",
+	}
+
+	testCmd.AddCommand(NewResourcesCmd(flags))
+	testCmd.AddCommand(NewCUDACmd(flags))
+	testCmd.AddCommand(NewBenchmarkCmd(flags))
+	return testCmd
+}
+
+// probeWorkspace runs the same check in a workspace through kled ssh, with
+// the kled binary the agent installed there, and returns its report.
+func probeWorkspace(ctx context.Context, globalFlags *flags.GlobalFlags, workspace string, args []string) (*probe.Report, error) {
+	self, err := os.Executable()
+	if err != nil {
+		return nil, err
+	}
+
+	command := shellescape.QuoteCommand(append([]string{agent.ContainerKledHelperLocation, "test"}, append(args, "--output", "json")...))
+	sshArgs := []string{"ssh", workspace, "--start-services=false", "--command", command}
+	if globalFlags.Context != "" {
+		sshArgs = append(sshArgs, "--context", globalFlags.Context)
+	}
+
+	var stdout, stderr bytes.Buffer
+	sshCmd := exec.CommandContext(ctx, self, sshArgs...)
+	sshCmd.Stdout = &stdout
+	sshCmd.Stderr = &stderr
+	// failed checks exit non-zero, the report is still printed
+	runErr := sshCmd.Run()
+
+	report := &probe.Report{}
+	if err := json.Unmarshal(stdout.Bytes(), report); err != nil {
+		if runErr != nil {
+			return nil, fmt.Errorf("probe workspace %s: %v: %s", workspace, runErr, strings.TrimSpace(stderr.String()))
+		}
+		return nil, fmt.Errorf("probe workspace %s: unexpected output: %s", workspace, strings.TrimSpace(stdout.String()))
+	}
+	return report, nil
+}
+
+// printReport prints the checks of the report and returns an error if any
+// failed, so kled exits non-zero.
+func printReport(report *probe.Report, output string) error {
+	if output == "json" {
+		out, err := json.Marshal(report)
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(out))
+		return report.FailedError()
+	}
+
+	tableEntries := [][]string{}
+	for _, check := range report.Checks {
+		tableEntries = append(tableEntries, []string{
+			check.Name,
+			strings.ToUpper(string(check.Status)),
+			check.Message,
+		})
+	}
+	table.PrintTable(log.Default, []string{
+		"Check",
+		"Status",
+		"Message",
+	}, tableEntries)
+	return report.FailedError()
+}
+
+func validateOutput(output string) error {
+	if output != "plain" && output != "json" {
+		return fmt.Errorf("unexpected output format, choose either json or plain. Got %s", output)
+	}
+	return nil
+}
@@ -0,0 +1,137 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/loft-sh/devpod/cmd/flags"
+	"github.com/loft-sh/devpod/pkg/sdk"
+	"github.com/loft-sh/devpod/pkg/sso"
+	"github.com/loft-sh/log"
+	"github.com/loft-sh/log/table"
+	"github.com/spf13/cobra"
+)
+
+// TraceCmd holds the trace cmd flags
+type TraceCmd struct {
+	*flags.GlobalFlags
+
+	Server string
+	APIKey string
+	Output string
+}
+
+// NewTraceCmd creates a new command
+func NewTraceCmd(flags *flags.GlobalFlags) *cobra.Command {
+	cmd := &TraceCmd{
+		GlobalFlags: flags,
+	}
+	traceCmd := &cobra.Command{
+		Use:   "trace [request-id]",
+		Short: "Shows everything that happened for a request",
+		Long: `Shows the timeline of a request ID: the API requests sent with it, the
+workspace events they published, the commands sent to workspace agents, the
+state changes of agent runs and the audit log entries.
+
+Request IDs are returned by the server in the X-Request-ID header and are
+printed by failing commands. Reading traces requires an admin API key.`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cobraCmd *cobra.Command, args []string) error {
+			return cmd.Run(cobraCmd.Context(), args[0])
+		},
+	}
+
+	traceCmd.Flags().StringVar(&cmd.Server, "server", os.Getenv("KLED_SERVER_URL"), "The Kled server URL. You can also use KLED_SERVER_URL to set this")
+	traceCmd.Flags().StringVar(&cmd.APIKey, "api-key", os.Getenv("KLED_API_KEY"), "The API key to authenticate with. You can also use KLED_API_KEY to set this")
+	traceCmd.Flags().StringVar(&cmd.Output, "output", "plain", "The output format to use. Can be json or plain")
+	return traceCmd
+}
+
+// Run runs the command logic
+func (cmd *TraceCmd) Run(ctx context.Context, requestID string) error {
+	if cmd.Server == "" {
+		return fmt.Errorf("no server specified, use --server or KLED_SERVER_URL")
+	}
+	if cmd.Output != "plain" && cmd.Output != "json" {
+		return fmt.Errorf("unexpected output format, choose either json or plain. Got %s", cmd.Output)
+	}
+
+	client, err := sdk.New(sdk.Options{Server: cmd.Server, APIKey: cmd.APIKey, HTTPClient: sso.HTTPClient(cmd.Server)})
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+	trace, err := client.Traces.Get(ctx, requestID)
+	if sdk.IsNotFound(err) {
+		return fmt.Errorf("no trace found for %s, traces expire after a few days", requestID)
+	} else if err != nil {
+		return err
+	}
+
+	if cmd.Output == "json" {
+		out, err := json.Marshal(trace)
+		if err != nil {
+			return err
+		}
+		fmt.Print(string(out))
+		return nil
+	}
+
+	tableEntries := [][]string{}
+	start := trace.Entries[0].Time
+	for _, entry := range trace.Entries {
+		duration := ""
+		if entry.DurationMs > 0 {
+			duration = (time.Duration(entry.DurationMs) * time.Millisecond).String()
+		}
+		tableEntries = append(tableEntries, []string{
+			entry.Time.Local().Format("15:04:05.000"),
+			"+" + entry.Time.Sub(start).Round(time.Millisecond).String(),
+			entry.Source,
+			entry.Name,
+			duration,
+			traceDetails(entry),
+		})
+	}
+
+	table.PrintTable(log.Default, []string{
+		"Time",
+		"Offset",
+		"Source",
+		"Name",
+		"Duration",
+		"Details",
+	}, tableEntries)
+	return nil
+}
+
+// traceDetails summarizes the error, message and attributes of an entry
+func traceDetails(entry sdk.TraceEntry) string {
+	details := []string{}
+	if entry.Error != "" {
+		details = append(details, "error: "+entry.Error)
+	}
+	if entry.Message != "" {
+		details = append(details, entry.Message)
+	}
+
+	keys := make([]string, 0, len(entry.Attributes))
+	for key, value := range entry.Attributes {
+		if value != "" {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		details = append(details, key+"="+entry.Attributes[key])
+	}
+	return strings.Join(details, ", ")
+}
@@ -9,13 +9,16 @@ import (
 	"os"
 	"os/exec"
 	"os/signal"
+	"os/user"
 	"path/filepath"
 	"slices"
 	"strconv"
 	"strings"
 	"syscall"
+	"time"
 
 	"github.com/blang/semver"
+	"github.com/loft-sh/devpod/cmd/completion"
 	"github.com/loft-sh/devpod/cmd/flags"
 	"github.com/loft-sh/devpod/pkg/agent"
 	"github.com/loft-sh/devpod/pkg/agent/tunnelserver"
@@ -23,6 +26,7 @@ import (
 	"github.com/loft-sh/devpod/pkg/client/clientimplementation"
 	"github.com/loft-sh/devpod/pkg/command"
 	"github.com/loft-sh/devpod/pkg/config"
+	"github.com/loft-sh/devpod/pkg/devcontainer/build"
 	config2 "github.com/loft-sh/devpod/pkg/devcontainer/config"
 	"github.com/loft-sh/devpod/pkg/devcontainer/sshtunnel"
 	"github.com/loft-sh/devpod/pkg/ide"
@@ -33,6 +37,7 @@ import (
 	"github.com/loft-sh/devpod/pkg/ide/rstudio"
 	"github.com/loft-sh/devpod/pkg/ide/vscode"
 	"github.com/loft-sh/devpod/pkg/ide/zed"
+	"github.com/loft-sh/devpod/pkg/netpolicy"
 	open2 "github.com/loft-sh/devpod/pkg/open"
 	"github.com/loft-sh/devpod/pkg/platform"
 	"github.com/loft-sh/devpod/pkg/port"
@@ -43,6 +48,8 @@ import (
 	"github.com/loft-sh/devpod/pkg/util"
 	"github.com/loft-sh/devpod/pkg/version"
 	workspace2 "github.com/loft-sh/devpod/pkg/workspace"
+	"github.com/loft-sh/devpod/pkg/workspaceenv"
+	"github.com/loft-sh/devpod/pkg/workspacestate"
 	"github.com/loft-sh/log"
 	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
@@ -67,10 +74,32 @@ type UpCmd struct {
 
 	SSHConfigPath string
 
+	Labels []string
+
+	Network     string
+	AllowEgress []string
+
+	ExtraHosts []string
+	DNS        []string
+	DNSSearch  []string
+
+	WorkspaceSecrets []string
+	TemplateEnv      []string
+
+	SkipPersonalization bool
+
 	DotfilesSource        string
 	DotfilesScript        string
 	DotfilesScriptEnv     []string // Key=Value to pass to install script
 	DotfilesScriptEnvFile []string // Paths to files containing Key=Value pairs to pass to install script
+
+	// ideReadyTimeout makes up wait for the IDE server before opening the
+	// IDE, used by workspace open
+	ideReadyTimeout time.Duration
+
+	// skipPersonalizationSet is true if --skip-personalization was passed,
+	// otherwise the saved choice of the workspace is kept
+	skipPersonalizationSet bool
 }
 
 // NewUpCmd creates a new up command
@@ -90,6 +119,16 @@ func NewUpCmd(f *flags.GlobalFlags) *cobra.Command {
 			if kledConfig.ContextOption(config.ContextOptionSSHStrictHostKeyChecking) == "true" {
 				cmd.StrictHostKeyChecking = true
 			}
+			cmd.CacheFrom, err = build.NormalizeCacheOptions(cmd.CacheFrom, false)
+			if err != nil {
+				return fmt.Errorf("cache from: %w", err)
+			}
+			cmd.skipPersonalizationSet = cobraCmd.Flags().Changed("skip-personalization")
+			if cmd.PolicyOverride != "" {
+				if currentUser, err := user.Current(); err == nil {
+					cmd.PolicyOverrideUser = currentUser.Username
+				}
+			}
 
 			ctx, cancel := WithSignals(cobraCmd.Context())
 			defer cancel()
@@ -113,12 +152,12 @@ func NewUpCmd(f *flags.GlobalFlags) *cobra.Command {
 	upCmd.Flags().StringArrayVar(&cmd.IDEOptions, "ide-option", []string{}, "IDE option in the form KEY=VALUE")
 	upCmd.Flags().StringVar(&cmd.DevContainerImage, "devcontainer-image", "", "The container image to use, this will override the devcontainer.json value in the project")
 	upCmd.Flags().StringVar(&cmd.DevContainerPath, "devcontainer-path", "", "The path to the devcontainer.json relative to the project")
-	upCmd.Flags().StringArrayVar(&cmd.ProviderOptions, "provider-option", []string{}, "Provider option in the form KEY=VALUE")
+	upCmd.Flags().StringArrayVarP(&cmd.ProviderOptions, "provider-option", "o", []string{}, "Provider option in the form KEY=VALUE, see 'kled provider options' for the available options")
 	upCmd.Flags().BoolVar(&cmd.Reconfigure, "reconfigure", false, "Reconfigure the options for this workspace. Only supported in DevPod Pro right now.")
 	upCmd.Flags().BoolVar(&cmd.Recreate, "recreate", false, "If true will remove any existing containers and recreate them")
 	upCmd.Flags().BoolVar(&cmd.Reset, "reset", false, "If true will remove any existing containers including sources, and recreate them")
 	upCmd.Flags().StringSliceVar(&cmd.PrebuildRepositories, "prebuild-repository", []string{}, "Docker repository that hosts devpod prebuilds for this workspace")
-	upCmd.Flags().StringArrayVar(&cmd.WorkspaceEnv, "workspace-env", []string{}, "Extra env variables to put into the workspace. E.g. MY_ENV_VAR=MY_VALUE")
+	upCmd.Flags().StringArrayVarP(&cmd.WorkspaceEnv, "workspace-env", "e", []string{}, "Extra env variables to put into the workspace. E.g. MY_ENV_VAR=MY_VALUE. They are saved and override the provider, template and project .env variables, see 'kled workspace env'")
 	upCmd.Flags().StringSliceVar(&cmd.WorkspaceEnvFile, "workspace-env-file", []string{}, "The path to files containing a list of extra env variables to put into the workspace. E.g. MY_ENV_VAR=MY_VALUE")
 	upCmd.Flags().StringArrayVar(&cmd.InitEnv, "init-env", []string{}, "Extra env variables to inject during the initialization of the workspace. E.g. MY_ENV_VAR=MY_VALUE")
 	upCmd.Flags().StringVar(&cmd.ID, "id", "", "The id to use for the workspace")
@@ -131,6 +170,22 @@ func NewUpCmd(f *flags.GlobalFlags) *cobra.Command {
 	upCmd.Flags().StringVar(&cmd.FallbackImage, "fallback-image", "", "The fallback image to use if no devcontainer configuration has been detected")
 	upCmd.Flags().BoolVar(&cmd.DisableDaemon, "disable-daemon", false, "If enabled, will not install a daemon into the target machine to track activity")
 	upCmd.Flags().StringVar(&cmd.Source, "source", "", "Optional source for the workspace. E.g. git:https://github.com/my-org/my-repo")
+	upCmd.Flags().StringArrayVar(&cmd.CacheFrom, "cache-from", []string{}, "Import build cache from a registry or a local directory, e.g. exported by kled build --cache-to")
+	upCmd.Flags().StringVar(&cmd.PolicyOverride, "policy-override", "", "Create the workspace even if its devcontainer configuration violates the DEVCONTAINER_POLICY. The reason is recorded in the policy audit log of the workspace")
+	upCmd.Flags().StringArrayVarP(&cmd.Labels, "label", "l", []string{}, "Label to add to the workspace in the form KEY=VALUE, used to select workspaces with e.g. kled workspace stop -l KEY=VALUE")
+	upCmd.Flags().StringVar(&cmd.Network, "network", "", "The network mode of the workspace. Can be isolated, to run it in a network of its own with egress only to --allow-egress, or open. Changing it needs --recreate")
+	upCmd.Flags().StringArrayVar(&cmd.AllowEgress, "allow-egress", []string{}, "Host, IP or CIDR with an optional port an isolated workspace may connect to, e.g. llm-gateway.example.com:443, or registries for common package registries. Host names are resolved whenever the workspace starts")
+	upCmd.Flags().StringArrayVar(&cmd.ExtraHosts, "add-host", []string{}, "Entry to add to /etc/hosts of the workspace in the form HOST:IP. Changing it needs --recreate")
+	upCmd.Flags().StringArrayVar(&cmd.DNS, "dns", []string{}, "IP of a DNS server the workspace uses instead of the default ones of the provider. Changing it needs --recreate")
+	upCmd.Flags().StringArrayVar(&cmd.DNSSearch, "dns-search", []string{}, "DNS search domain of the workspace. Changing it needs --recreate")
+	upCmd.Flags().StringArrayVar(&cmd.WorkspaceSecrets, "workspace-secret", []string{}, "Vault secret to put into the workspace as env variable in the form NAME=PATH#FIELD, e.g. API_KEY=secret/data/team/api#key. It is read from VAULT_ADDR with VAULT_TOKEN whenever the workspace starts")
+	upCmd.Flags().BoolVar(&cmd.SkipPersonalization, "skip-personalization", false, "If true, the workspace doesn't get the dotfiles of the DOTFILES_URL context option or the timezone and locale of the host. The choice is saved for the workspace")
+	upCmd.Flags().StringArrayVar(&cmd.TemplateEnv, "template-env", []string{}, "Env variable of the template the workspace is created from")
+	_ = upCmd.Flags().MarkHidden("template-env")
+
+	_ = upCmd.RegisterFlagCompletionFunc("provider-option", func(cobraCmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		return completion.GetProviderOptionSuggestions(cobraCmd, cmd.Context, cmd.Provider, args, toComplete, cmd.Owner, log.Default)
+	})
 
 	// testing
 	upCmd.Flags().StringVar(&cmd.DaemonInterval, "daemon-interval", "", "TESTING ONLY")
@@ -166,12 +221,31 @@ func (cmd *UpCmd) Run(
 		log.Debug("Reusing SSH_AUTH_SOCK is not supported with platform mode, consider launching the IDE from the platform UI")
 	}
 
-	result, err := cmd.kledUp(ctx, kledConfig, client, log)
+	// track the workspace phase and keep the last log lines in case it fails
+	tracker := workspacestate.NewTracker(client.Context(), client.Workspace(), log)
+	step, phase, failReason := "start", workspacestate.PhaseStarting, "StartFailed"
+	if cmd.Recreate || tracker.State().LastTransitions[workspacestate.PhaseRunning].IsZero() {
+		step, phase, failReason = "build", workspacestate.PhaseBuilding, "BuildFailed"
+	}
+	tracker.Set(phase, "Up")
+	logBuffer := workspacestate.NewLogBuffer(workspacestate.DefaultExcerptLines)
+
+	result, err := cmd.kledUp(ctx, kledConfig, client, logBuffer.Tee(log))
 	if err != nil {
+		tracker.Fail(step, failReason, err, logBuffer.Lines())
 		return err
 	} else if result == nil {
-		return fmt.Errorf("didn't receive a result back from agent")
-	} else if cmd.Platform.Enabled {
+		err = fmt.Errorf("didn't receive a result back from agent")
+		tracker.Fail(step, failReason, err, logBuffer.Lines())
+		return err
+	}
+
+	if failedHook := config2.FailedLifecycleHook(result); failedHook != nil {
+		tracker.Fail(failedHook.Hook, "LifecycleHookFailed", errors.New(failedHook.Error), logBuffer.Lines())
+	} else {
+		tracker.Set(workspacestate.PhaseRunning, "Up")
+	}
+	if cmd.Platform.Enabled {
 		return nil
 	}
 
@@ -219,6 +293,12 @@ func (cmd *UpCmd) Run(
 	}
 
 	// open ide
+	if cmd.OpenIDE && cmd.ideReadyTimeout > 0 {
+		err = waitForIDE(ctx, client, user, cmd.ideReadyTimeout, log)
+		if err != nil {
+			return err
+		}
+	}
 	if cmd.OpenIDE {
 		ideConfig := client.WorkspaceConfig().IDE
 		switch ideConfig.Name {
@@ -377,6 +457,10 @@ func (cmd *UpCmd) kledUp(
 		return nil, fmt.Errorf("save workspace result: %w", err)
 	}
 
+	if failedHook := config2.FailedLifecycleHook(result); failedHook != nil {
+		log.Warnf("Lifecycle hook %s failed and will run again on the next start, see 'kled workspace status %s' for details", failedHook.Hook, client.Workspace())
+	}
+
 	return result, nil
 }
 
@@ -1064,6 +1148,10 @@ func setupDotfiles(
 	log log.Logger,
 ) error {
 	dotfilesRepo := kledConfig.ContextOption(config.ContextOptionDotfilesURL)
+	if client.WorkspaceConfig().SkipPersonalization {
+		// dotfiles passed with --dotfiles are still installed
+		dotfilesRepo = ""
+	}
 	if dotfiles != "" {
 		dotfilesRepo = dotfiles
 	}
@@ -1387,6 +1475,21 @@ func (cmd *UpCmd) prepareClient(ctx context.Context,	kledConfig *config.Config,
 		cmd.SSHConfigPath = kledConfig.ContextOption(config.ContextOptionSSHConfigPath)
 	}
 
+	labels, err := workspace2.ParseLabels(cmd.Labels)
+	if err != nil {
+		return nil, logger, err
+	}
+
+	networkPolicy, err := netpolicy.Parse(cmd.Network, cmd.AllowEgress)
+	if err != nil {
+		return nil, logger, err
+	}
+
+	dns, err := workspace2.ParseDNS(cmd.ExtraHosts, cmd.DNS, cmd.DNSSearch)
+	if err != nil {
+		return nil, logger, err
+	}
+
 	client, err := workspace2.Resolve(
 		ctx,
 		kledConfig,
@@ -1410,6 +1513,59 @@ func (cmd *UpCmd) prepareClient(ctx context.Context,	kledConfig *config.Config,
 		return nil, logger, err
 	}
 
+	if len(labels) > 0 {
+		workspaceConfig := client.WorkspaceConfig()
+		if workspaceConfig.Labels == nil {
+			workspaceConfig.Labels = map[string]string{}
+		}
+		for key, value := range labels {
+			workspaceConfig.Labels[key] = value
+		}
+
+		err = provider2.SaveWorkspaceConfig(workspaceConfig)
+		if err != nil {
+			return nil, logger, fmt.Errorf("save workspace labels: %w", err)
+		}
+	}
+
+	if networkPolicy != nil {
+		workspaceConfig := client.WorkspaceConfig()
+		workspaceConfig.Network = networkPolicy
+		if !networkPolicy.Enabled() {
+			workspaceConfig.Network = nil
+		}
+
+		err = provider2.SaveWorkspaceConfig(workspaceConfig)
+		if err != nil {
+			return nil, logger, fmt.Errorf("save workspace network: %w", err)
+		}
+	}
+
+	if dns != nil {
+		workspaceConfig := client.WorkspaceConfig()
+		workspaceConfig.DNS = dns
+
+		err = provider2.SaveWorkspaceConfig(workspaceConfig)
+		if err != nil {
+			return nil, logger, fmt.Errorf("save workspace dns: %w", err)
+		}
+	}
+
+	if cmd.skipPersonalizationSet {
+		workspaceConfig := client.WorkspaceConfig()
+		workspaceConfig.SkipPersonalization = cmd.SkipPersonalization
+
+		err = provider2.SaveWorkspaceConfig(workspaceConfig)
+		if err != nil {
+			return nil, logger, fmt.Errorf("save workspace personalization: %w", err)
+		}
+	}
+
+	err = cmd.resolveWorkspaceEnv(ctx, kledConfig, client, logger)
+	if err != nil {
+		return nil, logger, err
+	}
+
 	if !cmd.Platform.Enabled {
 		proInstance := getProInstance(kledConfig, client.Provider(), logger)
 		err = checkProviderUpdate(kledConfig, proInstance, logger)
@@ -1421,6 +1577,30 @@ func (cmd *UpCmd) prepareClient(ctx context.Context,	kledConfig *config.Config,
 	return client, logger, nil
 }
 
+// resolveWorkspaceEnv saves the env variables of the workspace and passes
+// the resolved layers to the agent, which merges them with the project .env
+// of the workspace folder
+func (cmd *UpCmd) resolveWorkspaceEnv(ctx context.Context, kledConfig *config.Config, client client2.BaseWorkspaceClient, logger log.Logger) error {
+	workspaceConfig := client.WorkspaceConfig()
+	changed, err := workspace2.UpdateEnv(workspaceConfig, cmd.TemplateEnv, cmd.WorkspaceEnv, cmd.WorkspaceSecrets)
+	if err != nil {
+		return err
+	} else if changed {
+		err = provider2.SaveWorkspaceConfig(workspaceConfig)
+		if err != nil {
+			return fmt.Errorf("save workspace env: %w", err)
+		}
+	}
+
+	lower, upper, err := workspace2.EnvLayers(ctx, kledConfig, workspaceConfig, true, logger)
+	if err != nil {
+		return err
+	}
+	cmd.WorkspaceEnvDefaults = workspaceenv.ToList(workspaceenv.Resolve(lower...))
+	cmd.WorkspaceEnv = workspaceenv.ToList(workspaceenv.Resolve(upper...))
+	return nil
+}
+
 func WithSignals(ctx context.Context) (context.Context, func()) {
 	ctx, cancel := context.WithCancel(ctx)
 	signals := make(chan os.Signal, 1)
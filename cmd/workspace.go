@@ -14,15 +14,25 @@ func NewWorkspaceCmd(globalFlags *flags.GlobalFlags) *cobra.Command {
 	}
 
 	workspaceCmd.AddCommand(NewUpCmd(globalFlags))
+	workspaceCmd.AddCommand(NewCreateCmd(globalFlags))
 	workspaceCmd.AddCommand(NewSSHCmd(globalFlags))
 	workspaceCmd.AddCommand(NewStatusCmd(globalFlags))
 	workspaceCmd.AddCommand(NewDeleteCmd(globalFlags))
 	workspaceCmd.AddCommand(NewListCmd(globalFlags))
+	workspaceCmd.AddCommand(NewStartCmd(globalFlags))
 	workspaceCmd.AddCommand(NewStopCmd(globalFlags))
 	workspaceCmd.AddCommand(NewBuildCmd(globalFlags))
 	workspaceCmd.AddCommand(NewExportCmd(globalFlags))
 	workspaceCmd.AddCommand(NewImportCmd(globalFlags))
 	workspaceCmd.AddCommand(NewLogsCmd(globalFlags))
+	workspaceCmd.AddCommand(NewPortsCmd(globalFlags))
+	workspaceCmd.AddCommand(NewShareCmd(globalFlags))
+	workspaceCmd.AddCommand(NewOpenCmd(globalFlags))
+	workspaceCmd.AddCommand(NewSyncCmd(globalFlags))
+	workspaceCmd.AddCommand(NewScanCmd(globalFlags))
+	workspaceCmd.AddCommand(NewPublishCmd(globalFlags))
+	workspaceCmd.AddCommand(NewEnvCmd(globalFlags))
+	workspaceCmd.AddCommand(NewScheduleCmd(globalFlags))
 	
 	return workspaceCmd
 }
@@ -0,0 +1,148 @@
+package control
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+
+	"github.com/loft-sh/devpod/pkg/stdio"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+// Dial connects to the control channel at address, e.g. a port forwarded
+// through the workspace tunnel.
+func Dial(address, token string) (ControlClient, io.Closer, error) {
+	conn, err := grpc.NewClient(address,
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithPerRPCCredentials(tokenCredentials(token)),
+	)
+	if err != nil {
+		return nil, nil, fmt.Errorf("connect to control channel %s: %w", address, err)
+	}
+
+	return NewControlClient(conn), conn, nil
+}
+
+// DialStdio connects to a control channel served on the stdin and stdout of
+// a process, e.g. kled agent container control run through kled ssh. The
+// process is expected to authenticate the connection itself
+func DialStdio(reader io.Reader, writer io.WriteCloser) (ControlClient, io.Closer, error) {
+	pipe := stdio.NewStdioStream(reader, writer, false, 0)
+	conn, err := grpc.NewClient("passthrough:///stdio",
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithContextDialer(func(context.Context, string) (net.Conn, error) {
+			return pipe, nil
+		}),
+	)
+	if err != nil {
+		return nil, nil, fmt.Errorf("connect to control channel: %w", err)
+	}
+
+	return NewControlClient(conn), conn, nil
+}
+
+type tokenCredentials string
+
+func (t tokenCredentials) GetRequestMetadata(context.Context, ...string) (map[string]string, error) {
+	if t == "" {
+		return nil, nil
+	}
+
+	return map[string]string{AuthorizationHeader: "Bearer " + string(t)}, nil
+}
+
+func (t tokenCredentials) RequireTransportSecurity() bool {
+	return false
+}
+
+// Terminal resizes the terminal of a running command.
+type Terminal interface {
+	Resize(size *TerminalSize) error
+}
+
+// Run runs a command through the control channel and returns its exit code.
+// onStart receives a Terminal once the command runs, it may be nil.
+func Run(ctx context.Context, client ControlClient, start *ExecStart, stdin io.Reader, stdout, stderr io.Writer, onStart func(Terminal)) (int, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	stream, err := client.Exec(ctx)
+	if err != nil {
+		return 0, err
+	}
+	sender := &execClientSender{stream: stream}
+	err = sender.send(&ExecRequest{Request: &ExecRequest_Start{Start: start}})
+	if err != nil {
+		return 0, err
+	}
+	if onStart != nil {
+		onStart(sender)
+	}
+
+	if stdin != nil {
+		go func() {
+			buf := make([]byte, chunkSize)
+			for {
+				n, err := stdin.Read(buf)
+				if n > 0 {
+					data := append([]byte(nil), buf[:n]...)
+					if sender.send(&ExecRequest{Request: &ExecRequest_Stdin{Stdin: data}}) != nil {
+						return
+					}
+				}
+				if err != nil {
+					_ = sender.send(&ExecRequest{Request: &ExecRequest_CloseStdin{CloseStdin: true}})
+					return
+				}
+			}
+		}()
+	} else {
+		err = sender.send(&ExecRequest{Request: &ExecRequest_CloseStdin{CloseStdin: true}})
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	for {
+		response, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			return 0, errors.New("control channel closed before the command exited")
+		} else if err != nil {
+			return 0, err
+		}
+
+		switch response := response.Response.(type) {
+		case *ExecResponse_Stdout:
+			if stdout != nil {
+				_, _ = stdout.Write(response.Stdout)
+			}
+		case *ExecResponse_Stderr:
+			if stderr != nil {
+				_, _ = stderr.Write(response.Stderr)
+			}
+		case *ExecResponse_ExitCode:
+			return int(response.ExitCode), nil
+		}
+	}
+}
+
+// execClientSender serializes the requests of an exec stream.
+type execClientSender struct {
+	m      sync.Mutex
+	stream Control_ExecClient
+}
+
+func (s *execClientSender) send(request *ExecRequest) error {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	return s.stream.Send(request)
+}
+
+func (s *execClientSender) Resize(size *TerminalSize) error {
+	return s.send(&ExecRequest{Request: &ExecRequest_Resize{Resize: size}})
+}
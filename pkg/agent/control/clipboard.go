@@ -0,0 +1,66 @@
+package control
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+)
+
+// ClipboardFile holds the clipboard of workspaces without a display, relative
+// to the home of the workspace user. Tools in the workspace can read and
+// write it like any other file
+const ClipboardFile = ".kled/clipboard"
+
+// writeClipboardScript stores stdin in the clipboard of the display of the
+// workspace if it has one and a clipboard tool, and in ClipboardFile
+// otherwise
+const writeClipboardScript = `
+if [ -n "$WAYLAND_DISPLAY" ] && command -v wl-copy >/dev/null 2>&1; then
+  exec wl-copy
+elif [ -n "$DISPLAY" ] && command -v xclip >/dev/null 2>&1; then
+  exec xclip -selection clipboard -in
+elif [ -n "$DISPLAY" ] && command -v xsel >/dev/null 2>&1; then
+  exec xsel --clipboard --input
+fi
+mkdir -p "$(dirname "$HOME/` + ClipboardFile + `")" && cat > "$HOME/` + ClipboardFile + `"
+`
+
+// readClipboardScript prints the clipboard written by writeClipboardScript
+const readClipboardScript = `
+if [ -n "$WAYLAND_DISPLAY" ] && command -v wl-paste >/dev/null 2>&1; then
+  exec wl-paste --no-newline
+elif [ -n "$DISPLAY" ] && command -v xclip >/dev/null 2>&1; then
+  exec xclip -selection clipboard -out
+elif [ -n "$DISPLAY" ] && command -v xsel >/dev/null 2>&1; then
+  exec xsel --clipboard --output
+fi
+if [ -f "$HOME/` + ClipboardFile + `" ]; then
+  cat "$HOME/` + ClipboardFile + `"
+fi
+`
+
+// WriteClipboard sets the clipboard of the workspace to content
+func WriteClipboard(ctx context.Context, client ControlClient, content []byte) error {
+	_, err := runClipboardScript(ctx, client, writeClipboardScript, content)
+	return err
+}
+
+// ReadClipboard returns the clipboard of the workspace, it's empty if
+// nothing was copied yet
+func ReadClipboard(ctx context.Context, client ControlClient) ([]byte, error) {
+	return runClipboardScript(ctx, client, readClipboardScript, nil)
+}
+
+func runClipboardScript(ctx context.Context, client ControlClient, script string, stdin []byte) ([]byte, error) {
+	stdout := &bytes.Buffer{}
+	stderr := &bytes.Buffer{}
+	exitCode, err := Run(ctx, client, &ExecStart{Command: []string{"sh", "-c", script}}, bytes.NewReader(stdin), stdout, stderr, nil)
+	if err != nil {
+		return nil, err
+	} else if exitCode != 0 {
+		return nil, fmt.Errorf("access clipboard of workspace: exit code %d: %s", exitCode, strings.TrimSpace(stderr.String()))
+	}
+
+	return stdout.Bytes(), nil
+}
@@ -0,0 +1,417 @@
+package control
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/loft-sh/devpod/pkg/version"
+	"github.com/loft-sh/log"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+// maxCommandResults bounds the results kept for answering resent commands.
+const maxCommandResults = 256
+
+// CorrelationIDEnv passes the correlation ID of the request that issued a
+// command to the processes it runs, so their output can be traced back with
+// kled trace.
+const CorrelationIDEnv = "KLED_CORRELATION_ID"
+
+type correlationIDKey struct{}
+
+// CorrelationID returns the correlation ID of the command being handled.
+func CorrelationID(ctx context.Context) string {
+	correlationID, _ := ctx.Value(correlationIDKey{}).(string)
+	return correlationID
+}
+
+// The streams of the output of a command.
+const (
+	OutputStdout = "stdout"
+	OutputStderr = "stderr"
+)
+
+// maxOutputChunk bounds the data of a single CommandOutput message.
+const maxOutputChunk = 32 * 1024
+
+type outputKey struct{}
+
+type outputSender struct {
+	commandID string
+	send      func(*AgentMessage) error
+}
+
+// OutputWriter returns a writer that streams stream of the output of the
+// command being handled to the backend. Every write is sent in chunks before
+// it returns, so a backend that reads slowly holds back the command rather
+// than the output piling up in memory. Chunks that can't be sent are
+// dropped. Outside of a CommandRunner the output is discarded.
+func OutputWriter(ctx context.Context, stream string) io.Writer {
+	sender, ok := ctx.Value(outputKey{}).(*outputSender)
+	if !ok {
+		return io.Discard
+	}
+	return &outputWriter{sender: sender, stream: stream}
+}
+
+type outputWriter struct {
+	sender *outputSender
+	stream string
+	offset int64
+}
+
+func (w *outputWriter) Write(p []byte) (int, error) {
+	written := len(p)
+	for len(p) > 0 {
+		chunk := p[:min(len(p), maxOutputChunk)]
+		// the message is encoded before Send returns, chunk isn't copied
+		_ = w.sender.send(&AgentMessage{Message: &AgentMessage_Output{Output: &CommandOutput{
+			CommandId: w.sender.commandID,
+			Stream:    w.stream,
+			Offset:    w.offset,
+			Data:      chunk,
+		}}})
+		w.offset += int64(len(chunk))
+		p = p[len(chunk):]
+	}
+	return written, nil
+}
+
+// CommandHandler runs a command sent by the backend. The output is encoded
+// as JSON.
+type CommandHandler func(ctx context.Context, params json.RawMessage) (interface{}, error)
+
+// CommandRunner keeps a Connect stream to the backend open and runs the
+// commands it receives with Handlers. The backend resends commands it got
+// no acknowledgement or result for, so every command ID runs at most once
+// and resent commands are answered with the stored result. Broken streams
+// are reopened with backoff.
+type CommandRunner struct {
+	Address      string
+	Token        string
+	WorkspaceID  string
+	WorkspaceUID string
+	Handlers     map[string]CommandHandler
+	Log          log.Logger
+
+	mu      sync.Mutex
+	running map[string]bool
+	results map[string]*CommandResult
+	order   []string
+}
+
+// Run runs commands until ctx is done.
+func (r *CommandRunner) Run(ctx context.Context) error {
+	r.mu.Lock()
+	r.running = map[string]bool{}
+	r.results = map[string]*CommandResult{}
+	r.mu.Unlock()
+
+	conn, err := grpc.NewClient(r.Address,
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithPerRPCCredentials(tokenCredentials(r.Token)),
+	)
+	if err != nil {
+		return fmt.Errorf("connect to command endpoint %s: %w", r.Address, err)
+	}
+	defer conn.Close()
+
+	client := NewAgentCommandsClient(conn)
+	backoff := time.Second
+	for {
+		start := time.Now()
+		err := r.serve(ctx, client)
+		if ctx.Err() != nil {
+			return nil
+		}
+		// a stream that stayed up for a while resets the backoff
+		if time.Since(start) > time.Minute {
+			backoff = time.Second
+		}
+		r.Log.Debugf("Command stream to %s closed: %v, reconnecting in %s", r.Address, err, backoff)
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(backoff):
+		}
+		backoff = min(backoff*2, 30*time.Second)
+	}
+}
+
+// serve receives commands on a single stream until it breaks.
+func (r *CommandRunner) serve(ctx context.Context, client AgentCommandsClient) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	stream, err := client.Connect(ctx)
+	if err != nil {
+		return err
+	}
+
+	// results of running commands are sent from their own goroutines
+	var sendMu sync.Mutex
+	send := func(message *AgentMessage) error {
+		sendMu.Lock()
+		defer sendMu.Unlock()
+		return stream.Send(message)
+	}
+
+	err = send(&AgentMessage{Message: &AgentMessage_Hello{Hello: &AgentHello{
+		WorkspaceId:  r.WorkspaceID,
+		WorkspaceUid: r.WorkspaceUID,
+		Version:      version.GetVersion(),
+	}}})
+	if err != nil {
+		return err
+	}
+
+	for {
+		command, err := stream.Recv()
+		if err != nil {
+			return err
+		}
+
+		err = send(&AgentMessage{Message: &AgentMessage_Ack{Ack: &CommandAck{CommandId: command.Id}}})
+		if err != nil {
+			return err
+		}
+
+		result, started := r.start(command.Id)
+		if result != nil {
+			if err := send(&AgentMessage{Message: &AgentMessage_Result{Result: result}}); err != nil {
+				return err
+			}
+			continue
+		} else if !started {
+			// still running, the result is sent when it finishes
+			continue
+		}
+
+		go func() {
+			result := r.run(ctx, command, send)
+			if err := send(&AgentMessage{Message: &AgentMessage_Result{Result: result}}); err != nil {
+				r.Log.Debugf("Error sending result of command %s: %v", command.Id, err)
+			}
+		}()
+	}
+}
+
+// start returns the stored result of a finished command, or marks the
+// command as running and reports whether it has to be started.
+func (r *CommandRunner) start(id string) (*CommandResult, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if result, ok := r.results[id]; ok {
+		return result, false
+	}
+	if r.running[id] {
+		return nil, false
+	}
+	r.running[id] = true
+	return nil, true
+}
+
+func (r *CommandRunner) run(ctx context.Context, command *Command, send func(*AgentMessage) error) *CommandResult {
+	if command.DeadlineUnixMs > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithDeadline(ctx, time.UnixMilli(command.DeadlineUnixMs))
+		defer cancel()
+	}
+
+	if command.CorrelationId != "" {
+		ctx = context.WithValue(ctx, correlationIDKey{}, command.CorrelationId)
+	}
+	ctx = context.WithValue(ctx, outputKey{}, &outputSender{commandID: command.Id, send: send})
+	r.Log.Debugf("Running command %s (%s), correlation ID %s", command.Id, command.Name, command.CorrelationId)
+
+	result := &CommandResult{CommandId: command.Id}
+	handler, ok := r.Handlers[command.Name]
+	if !ok {
+		result.Error = fmt.Sprintf("unknown command %q", command.Name)
+	} else if output, err := handler(ctx, command.Params); err != nil {
+		result.Error = err.Error()
+	} else if result.Output, err = json.Marshal(output); err != nil {
+		result.Error = fmt.Sprintf("encode output: %v", err)
+	} else {
+		result.Success = true
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.running, command.Id)
+	r.results[command.Id] = result
+	r.order = append(r.order, command.Id)
+	if len(r.order) > maxCommandResults {
+		delete(r.results, r.order[0])
+		r.order = r.order[1:]
+	}
+	return result
+}
+
+// DefaultExecPreviewBytes bounds the stdout and stderr returned in the
+// result of an exec command, which keeps results below the message size
+// limit of gRPC.
+const DefaultExecPreviewBytes = 1024 * 1024
+
+type execParams struct {
+	Command []string          `json:"command"`
+	Workdir string            `json:"workdir,omitempty"`
+	Env     map[string]string `json:"env,omitempty"`
+	// Stream sends the output to the backend while the command runs.
+	Stream bool `json:"stream,omitempty"`
+	// PreviewBytes bounds stdout and stderr in the result,
+	// DefaultExecPreviewBytes if zero.
+	PreviewBytes int `json:"preview_bytes,omitempty"`
+}
+
+type execOutput struct {
+	ExitCode int    `json:"exit_code"`
+	Stdout   string `json:"stdout"`
+	Stderr   string `json:"stderr"`
+	// Truncated is set when stdout or stderr is longer than the preview;
+	// the sizes of the whole output are set with it.
+	Truncated   bool  `json:"truncated,omitempty"`
+	StdoutBytes int64 `json:"stdout_bytes,omitempty"`
+	StderrBytes int64 `json:"stderr_bytes,omitempty"`
+}
+
+// previewBuffer keeps the first limit bytes written to it and counts the
+// rest.
+type previewBuffer struct {
+	limit int
+	data  []byte
+	size  int64
+}
+
+func (b *previewBuffer) Write(p []byte) (int, error) {
+	if room := b.limit - len(b.data); room > 0 {
+		b.data = append(b.data, p[:min(room, len(p))]...)
+	}
+	b.size += int64(len(p))
+	return len(p), nil
+}
+
+func (b *previewBuffer) truncated() bool {
+	return b.size > int64(len(b.data))
+}
+
+// ExecCommandHandler runs a command without a terminal and returns its exit
+// code and output. Commands run in workdir unless the parameters name one.
+// Only the first bytes of the output are returned, up to the preview size;
+// commands that stream their output send all of it with OutputWriter.
+func ExecCommandHandler(workdir string) CommandHandler {
+	return func(ctx context.Context, params json.RawMessage) (interface{}, error) {
+		var p execParams
+		if err := json.Unmarshal(params, &p); err != nil {
+			return nil, fmt.Errorf("invalid exec parameters: %w", err)
+		} else if len(p.Command) == 0 {
+			return nil, errors.New("command is required")
+		}
+
+		cmd := exec.CommandContext(ctx, p.Command[0], p.Command[1:]...)
+		cmd.Dir = p.Workdir
+		if cmd.Dir == "" {
+			cmd.Dir = workdir
+		}
+		cmd.Env = os.Environ()
+		if correlationID := CorrelationID(ctx); correlationID != "" {
+			cmd.Env = append(cmd.Env, CorrelationIDEnv+"="+correlationID)
+		}
+		for k, v := range p.Env {
+			cmd.Env = append(cmd.Env, k+"="+v)
+		}
+		if p.PreviewBytes <= 0 {
+			p.PreviewBytes = DefaultExecPreviewBytes
+		}
+		stdout := &previewBuffer{limit: p.PreviewBytes}
+		stderr := &previewBuffer{limit: p.PreviewBytes}
+		cmd.Stdout, cmd.Stderr = stdout, stderr
+		if p.Stream {
+			cmd.Stdout = io.MultiWriter(stdout, OutputWriter(ctx, OutputStdout))
+			cmd.Stderr = io.MultiWriter(stderr, OutputWriter(ctx, OutputStderr))
+		}
+
+		err := cmd.Run()
+		var exitErr *exec.ExitError
+		if err != nil && !errors.As(err, &exitErr) {
+			return nil, err
+		}
+		output := &execOutput{ExitCode: cmd.ProcessState.ExitCode(), Stdout: string(stdout.data), Stderr: string(stderr.data)}
+		if stdout.truncated() || stderr.truncated() {
+			output.Truncated = true
+			output.StdoutBytes, output.StderrBytes = stdout.size, stderr.size
+		}
+		return output, nil
+	}
+}
+
+// DefaultRunSignalDir is where RunSignalCommandHandler leaves the signals
+// of agent runs for the runtimes in the workspace.
+const DefaultRunSignalDir = "/var/run/kled/runs"
+
+type runSignalParams struct {
+	RunID  string `json:"run_id"`
+	Signal string `json:"signal"`
+}
+
+// RunSignalCommandHandler writes the signal of an agent run, pause, resume
+// or cancel, to the file named after the run in dir. Runtimes poll the file
+// between steps.
+func RunSignalCommandHandler(dir string) CommandHandler {
+	return func(ctx context.Context, params json.RawMessage) (interface{}, error) {
+		var p runSignalParams
+		if err := json.Unmarshal(params, &p); err != nil {
+			return nil, fmt.Errorf("invalid run signal parameters: %w", err)
+		}
+		if p.RunID == "" || p.RunID != filepath.Base(p.RunID) || strings.HasPrefix(p.RunID, ".") {
+			return nil, fmt.Errorf("invalid run ID %q", p.RunID)
+		}
+		switch p.Signal {
+		case "pause", "resume", "cancel":
+		default:
+			return nil, fmt.Errorf("unknown run signal %q", p.Signal)
+		}
+
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return nil, err
+		}
+		// rename so runtimes never read a partial signal
+		tmp, err := os.CreateTemp(dir, ".signal-*")
+		if err != nil {
+			return nil, err
+		}
+		defer os.Remove(tmp.Name())
+		if _, err := tmp.WriteString(p.Signal + "\n"); err != nil {
+			tmp.Close()
+			return nil, err
+		}
+		if err := tmp.Close(); err != nil {
+			return nil, err
+		}
+		if err := os.Chmod(tmp.Name(), 0o644); err != nil {
+			return nil, err
+		}
+		if err := os.Rename(tmp.Name(), filepath.Join(dir, p.RunID)); err != nil {
+			return nil, err
+		}
+		return map[string]string{"run_id": p.RunID, "signal": p.Signal}, nil
+	}
+}
+
+// PingCommandHandler answers with the agent version, to check that commands
+// reach the agent.
+func PingCommandHandler(context.Context, json.RawMessage) (interface{}, error) {
+	return map[string]string{"version": version.GetVersion()}, nil
+}
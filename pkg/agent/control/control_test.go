@@ -0,0 +1,622 @@
+package control
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/loft-sh/log"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"gotest.tools/assert"
+)
+
+func startTestServer(t *testing.T, token string) (string, string) {
+	workdir := t.TempDir()
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NilError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- NewServer(token, workdir, log.Discard).Serve(ctx, lis)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		assert.NilError(t, <-done)
+	})
+
+	return lis.Addr().String(), workdir
+}
+
+func dialTestServer(t *testing.T, address, token string) ControlClient {
+	client, conn, err := Dial(address, token)
+	assert.NilError(t, err)
+	t.Cleanup(func() {
+		_ = conn.Close()
+	})
+
+	return client
+}
+
+func TestAuthorization(t *testing.T) {
+	address, _ := startTestServer(t, "secret")
+
+	_, err := dialTestServer(t, address, "wrong").Health(context.Background(), &HealthRequest{})
+	assert.Equal(t, status.Code(err), codes.Unauthenticated)
+
+	health, err := dialTestServer(t, address, "secret").Health(context.Background(), &HealthRequest{})
+	assert.NilError(t, err)
+	assert.Assert(t, health.Hostname != "")
+}
+
+func TestExec(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("needs a shell")
+	}
+	address, workdir := startTestServer(t, "")
+	client := dialTestServer(t, address, "")
+
+	stdout := &bytes.Buffer{}
+	stderr := &bytes.Buffer{}
+	exitCode, err := Run(context.Background(), client, &ExecStart{
+		Command: []string{"sh", "-c", `cat; pwd; echo "$GREETING" >&2; exit 3`},
+		Env:     map[string]string{"GREETING": "hello"},
+	}, strings.NewReader("input\n"), stdout, stderr, nil)
+	assert.NilError(t, err)
+	assert.Equal(t, exitCode, 3)
+	resolvedWorkdir, err := filepath.EvalSymlinks(workdir)
+	assert.NilError(t, err)
+	assert.Equal(t, stdout.String(), "input\n"+resolvedWorkdir+"\n")
+	assert.Equal(t, stderr.String(), "hello\n")
+
+	// terminals report their size and merge stderr into stdout
+	stdout.Reset()
+	exitCode, err = Run(context.Background(), client, &ExecStart{
+		Command: []string{"sh", "-c", "stty size; echo err >&2"},
+		Tty:     true,
+		Size:    &TerminalSize{Rows: 24, Columns: 100},
+	}, nil, stdout, nil, nil)
+	assert.NilError(t, err)
+	assert.Equal(t, exitCode, 0)
+	assert.Equal(t, strings.ReplaceAll(stdout.String(), "\r", ""), "24 100\nerr\n")
+
+	_, err = Run(context.Background(), client, &ExecStart{Command: []string{"does-not-exist"}}, nil, io.Discard, io.Discard, nil)
+	assert.Equal(t, status.Code(err), codes.FailedPrecondition)
+}
+
+func TestFiles(t *testing.T) {
+	address, workdir := startTestServer(t, "")
+	client := dialTestServer(t, address, "")
+	ctx := context.Background()
+
+	content := bytes.Repeat([]byte("kled"), chunkSize)
+	writer, err := client.WriteFile(ctx)
+	assert.NilError(t, err)
+	assert.NilError(t, writer.Send(&WriteFileRequest{Path: "dir/file.txt", Mode: 0600, Content: content[:10]}))
+	assert.NilError(t, writer.Send(&WriteFileRequest{Content: content[10:]}))
+	written, err := writer.CloseAndRecv()
+	assert.NilError(t, err)
+	assert.Equal(t, written.Size, int64(len(content)))
+
+	stat, err := client.Stat(ctx, &StatRequest{Path: filepath.Join(workdir, "dir", "file.txt")})
+	assert.NilError(t, err)
+	assert.Equal(t, stat.Size, int64(len(content)))
+	if runtime.GOOS != "windows" {
+		assert.Equal(t, stat.Mode, uint32(0600))
+	}
+
+	list, err := client.ListDir(ctx, &ListDirRequest{Path: "dir"})
+	assert.NilError(t, err)
+	assert.Equal(t, len(list.Entries), 1)
+	assert.Equal(t, list.Entries[0].Name, "file.txt")
+
+	reader, err := client.ReadFile(ctx, &ReadFileRequest{Path: "dir/file.txt"})
+	assert.NilError(t, err)
+	read := &bytes.Buffer{}
+	for {
+		chunk, err := reader.Recv()
+		if err == io.EOF {
+			break
+		}
+		assert.NilError(t, err)
+		read.Write(chunk.Content)
+	}
+	assert.DeepEqual(t, read.Bytes(), content)
+
+	_, err = client.Remove(ctx, &RemoveRequest{Path: "dir"})
+	assert.Assert(t, err != nil)
+	_, err = client.Remove(ctx, &RemoveRequest{Path: "dir", Recursive: true})
+	assert.NilError(t, err)
+	_, err = client.Stat(ctx, &StatRequest{Path: "dir"})
+	assert.Equal(t, status.Code(err), codes.NotFound)
+}
+
+func TestResumableWrite(t *testing.T) {
+	address, workdir := startTestServer(t, "")
+	client := dialTestServer(t, address, "")
+	ctx := context.Background()
+
+	content := []byte("hello resumable world")
+	key := ResumeKey(int64(len(content)), 1700000000, 0640)
+	partialPath := PartialPath(filepath.Join(workdir, "file.txt"), key)
+	assert.NilError(t, os.WriteFile(partialPath, content[:5], 0600))
+
+	// the offset has to match the partial file
+	writer, err := client.WriteFile(ctx)
+	assert.NilError(t, err)
+	assert.NilError(t, writer.Send(&WriteFileRequest{Path: "file.txt", ResumeKey: key, Offset: 3, Content: content[3:]}))
+	_, err = writer.CloseAndRecv()
+	assert.Equal(t, status.Code(err), codes.FailedPrecondition)
+
+	writer, err = client.WriteFile(ctx)
+	assert.NilError(t, err)
+	assert.NilError(t, writer.Send(&WriteFileRequest{Path: "file.txt", Mode: 0640, ModTime: 1700000000, ResumeKey: key, Offset: 5, Content: content[5:]}))
+	written, err := writer.CloseAndRecv()
+	assert.NilError(t, err)
+	assert.Equal(t, written.Size, int64(len(content)))
+
+	read, err := os.ReadFile(filepath.Join(workdir, "file.txt"))
+	assert.NilError(t, err)
+	assert.DeepEqual(t, read, content)
+	stat, err := client.Stat(ctx, &StatRequest{Path: "file.txt"})
+	assert.NilError(t, err)
+	assert.Equal(t, stat.ModTime, int64(1700000000))
+	_, err = os.Stat(partialPath)
+	assert.Assert(t, os.IsNotExist(err))
+
+	reader, err := client.ReadFile(ctx, &ReadFileRequest{Path: "file.txt", Offset: 6})
+	assert.NilError(t, err)
+	chunk, err := reader.Recv()
+	assert.NilError(t, err)
+	assert.Equal(t, string(chunk.Content), "resumable world")
+}
+
+func TestCopy(t *testing.T) {
+	address, workdir := startTestServer(t, "")
+	client := dialTestServer(t, address, "")
+	ctx := context.Background()
+
+	local := t.TempDir()
+	modTime := time.Unix(1700000000, 0)
+	assert.NilError(t, os.MkdirAll(filepath.Join(local, "src", "sub"), 0755))
+	assert.NilError(t, os.WriteFile(filepath.Join(local, "src", "sub", "script.sh"), []byte("#!/bin/sh\n"), 0750))
+	assert.NilError(t, os.WriteFile(filepath.Join(local, "src", "data.txt"), bytes.Repeat([]byte("x"), 3*chunkSize), 0644))
+	assert.NilError(t, os.Chtimes(filepath.Join(local, "src", "data.txt"), modTime, modTime))
+
+	// an interrupted upload left the first chunk behind
+	data, err := os.Stat(filepath.Join(local, "src", "data.txt"))
+	assert.NilError(t, err)
+	key := localMeta(data).resumeKey()
+	assert.NilError(t, os.MkdirAll(filepath.Join(workdir, "dst", "src"), 0755))
+	assert.NilError(t, os.WriteFile(PartialPath(filepath.Join(workdir, "dst", "src", "data.txt"), key), bytes.Repeat([]byte("x"), chunkSize), 0600))
+
+	progress := &recordingProgress{}
+	copier := &Copier{Client: client, Progress: progress, Log: log.Discard}
+	assert.NilError(t, os.MkdirAll(filepath.Join(workdir, "dst"), 0755))
+	assert.NilError(t, copier.Upload(ctx, filepath.Join(local, "src"), "dst"))
+	assert.Equal(t, progress.total, int64(3*chunkSize+10))
+	assert.Equal(t, progress.done, progress.total)
+
+	stat, err := os.Stat(filepath.Join(workdir, "dst", "src", "data.txt"))
+	assert.NilError(t, err)
+	assert.Equal(t, stat.Size(), int64(3*chunkSize))
+	assert.Equal(t, stat.ModTime().Unix(), modTime.Unix())
+
+	back := filepath.Join(local, "back")
+	assert.NilError(t, copier.Download(ctx, "dst/src", back))
+	script, err := os.Stat(filepath.Join(back, "sub", "script.sh"))
+	assert.NilError(t, err)
+	if runtime.GOOS != "windows" {
+		assert.Equal(t, script.Mode().Perm(), os.FileMode(0750))
+	}
+	read, err := os.ReadFile(filepath.Join(back, "data.txt"))
+	assert.NilError(t, err)
+	assert.Equal(t, len(read), 3*chunkSize)
+
+	stdout := &bytes.Buffer{}
+	assert.NilError(t, copier.UploadReader(ctx, strings.NewReader("from stdin"), "pasted.txt"))
+	assert.NilError(t, copier.DownloadWriter(ctx, "pasted.txt", stdout))
+	assert.Equal(t, stdout.String(), "from stdin")
+}
+
+// listingClient answers ListDir with entries, like a compromised workspace
+// could
+type listingClient struct {
+	ControlClient
+	entries []*FileInfo
+}
+
+func (c *listingClient) ListDir(context.Context, *ListDirRequest, ...grpc.CallOption) (*ListDirResponse, error) {
+	return &ListDirResponse{Entries: c.entries}, nil
+}
+
+func TestDownloadRejectsEscapingNames(t *testing.T) {
+	dst := t.TempDir()
+	for _, name := range []string{"..", "../authorized_keys", "sub/../../x", "/etc/passwd", `..\x`} {
+		copier := &Copier{Client: &listingClient{entries: []*FileInfo{{Name: name, Mode: 0644}}}, Log: log.Discard}
+		_, err := copier.walkRemote(context.Background(), "src", dst, fileMeta{isDir: true})
+		assert.ErrorContains(t, err, "invalid file name")
+	}
+
+	copier := &Copier{Client: &listingClient{entries: []*FileInfo{{Name: "..data", Mode: 0644}}}, Log: log.Discard}
+	entries, err := copier.walkRemote(context.Background(), "src", dst, fileMeta{isDir: true})
+	assert.NilError(t, err)
+	assert.Equal(t, entries[1].dst, filepath.Join(dst, "..data"))
+}
+
+func TestClipboard(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("needs a shell")
+	}
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("DISPLAY", "")
+	t.Setenv("WAYLAND_DISPLAY", "")
+	address, _ := startTestServer(t, "")
+	client := dialTestServer(t, address, "")
+	ctx := context.Background()
+
+	content, err := ReadClipboard(ctx, client)
+	assert.NilError(t, err)
+	assert.Equal(t, len(content), 0)
+
+	assert.NilError(t, WriteClipboard(ctx, client, []byte("copied\ntext")))
+	stored, err := os.ReadFile(filepath.Join(home, ClipboardFile))
+	assert.NilError(t, err)
+	assert.Equal(t, string(stored), "copied\ntext")
+
+	content, err = ReadClipboard(ctx, client)
+	assert.NilError(t, err)
+	assert.Equal(t, string(content), "copied\ntext")
+}
+
+type recordingProgress struct {
+	total int64
+	done  int64
+}
+
+func (p *recordingProgress) Start(total int64) {
+	p.total, p.done = total, 0
+}
+
+func (p *recordingProgress) Add(n int64) {
+	p.done += n
+}
+
+func TestListPorts(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("needs /proc")
+	}
+	address, _ := startTestServer(t, "")
+	client := dialTestServer(t, address, "")
+
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NilError(t, err)
+	defer lis.Close()
+	port := uint32(lis.Addr().(*net.TCPAddr).Port)
+
+	ports, err := client.ListPorts(context.Background(), &ListPortsRequest{})
+	assert.NilError(t, err)
+	found := false
+	for _, p := range ports.Ports {
+		found = found || p.Port == port
+		assert.Assert(t, !strings.HasSuffix(address, ":"+strconv.Itoa(int(p.Port))), "control port is listed")
+	}
+	assert.Assert(t, found)
+}
+
+// recordingHeartbeat records beats and breaks every stream after two beats.
+type recordingHeartbeat struct {
+	UnimplementedHeartbeatServer
+	beats chan *BeatRequest
+}
+
+func (r *recordingHeartbeat) Beat(stream Heartbeat_BeatServer) error {
+	md, _ := metadata.FromIncomingContext(stream.Context())
+	if strings.Join(md.Get(AuthorizationHeader), "") != "Bearer secret" {
+		return status.Error(codes.Unauthenticated, "invalid token")
+	}
+
+	for i := 0; i < 2; i++ {
+		beat, err := stream.Recv()
+		if err != nil {
+			return err
+		}
+		r.beats <- beat
+		if err := stream.Send(&BeatResponse{}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func TestHeartbeat(t *testing.T) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NilError(t, err)
+	server := grpc.NewServer()
+	backend := &recordingHeartbeat{beats: make(chan *BeatRequest, 10)}
+	RegisterHeartbeatServer(server, backend)
+	go func() {
+		_ = server.Serve(lis)
+	}()
+	defer server.Stop()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- (&Heartbeater{
+			Address:     lis.Addr().String(),
+			Token:       "secret",
+			WorkspaceID: "my-workspace",
+			Interval:    50 * time.Millisecond,
+			Log:         log.Discard,
+		}).Run(ctx)
+	}()
+
+	// the third beat arrives on a reopened stream
+	for i := 0; i < 3; i++ {
+		select {
+		case beat := <-backend.beats:
+			assert.Equal(t, beat.WorkspaceId, "my-workspace")
+			assert.Assert(t, beat.Hostname != "")
+		case <-time.After(10 * time.Second):
+			t.Fatalf("timed out waiting for beat %d", i+1)
+		}
+	}
+
+	cancel()
+	assert.NilError(t, <-done)
+}
+
+type scriptedCommands struct {
+	UnimplementedAgentCommandsServer
+
+	commands []*Command
+	messages chan *AgentMessage
+}
+
+func (s *scriptedCommands) Connect(stream AgentCommands_ConnectServer) error {
+	for _, command := range s.commands {
+		if err := stream.Send(command); err != nil {
+			return err
+		}
+	}
+	for {
+		message, err := stream.Recv()
+		if err != nil {
+			return err
+		}
+		s.messages <- message
+	}
+}
+
+func TestCommandRunner(t *testing.T) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NilError(t, err)
+	server := grpc.NewServer()
+	backend := &scriptedCommands{
+		commands: []*Command{
+			{Id: "c1", Name: "exec", Params: []byte(`{"command":["sh","-c","echo hi $KLED_CORRELATION_ID; exit 3"]}`), CorrelationId: "request-1"},
+			{Id: "c2", Name: "missing"},
+			// resent before the result arrived, must not run twice
+			{Id: "c1", Name: "exec", Params: []byte(`{"command":["sh","-c","echo hi $KLED_CORRELATION_ID; exit 3"]}`), CorrelationId: "request-1", Attempt: 2},
+		},
+		messages: make(chan *AgentMessage, 10),
+	}
+	RegisterAgentCommandsServer(server, backend)
+	go func() {
+		_ = server.Serve(lis)
+	}()
+	defer server.Stop()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- (&CommandRunner{
+			Address:     lis.Addr().String(),
+			WorkspaceID: "my-workspace",
+			Handlers:    map[string]CommandHandler{"exec": ExecCommandHandler(t.TempDir())},
+			Log:         log.Discard,
+		}).Run(ctx)
+	}()
+
+	acks := map[string]int{}
+	results := map[string][]*CommandResult{}
+	for len(acks) < 2 || acks["c1"] < 2 || len(results) < 2 {
+		select {
+		case message := <-backend.messages:
+			switch {
+			case message.GetHello() != nil:
+				assert.Equal(t, message.GetHello().WorkspaceId, "my-workspace")
+			case message.GetAck() != nil:
+				acks[message.GetAck().CommandId]++
+			case message.GetResult() != nil:
+				result := message.GetResult()
+				results[result.CommandId] = append(results[result.CommandId], result)
+			}
+		case <-time.After(10 * time.Second):
+			t.Fatalf("timed out, got acks %v and results %v", acks, results)
+		}
+	}
+
+	assert.Assert(t, results["c1"][0].Success)
+	assert.Equal(t, string(results["c1"][0].Output), `{"exit_code":3,"stdout":"hi request-1\n","stderr":""}`)
+	assert.Assert(t, !results["c2"][0].Success)
+	assert.Equal(t, results["c2"][0].Error, `unknown command "missing"`)
+
+	cancel()
+	assert.NilError(t, <-done)
+}
+
+func TestCommandRunnerStreamsOutput(t *testing.T) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NilError(t, err)
+	server := grpc.NewServer()
+	backend := &scriptedCommands{
+		commands: []*Command{
+			{Id: "c1", Name: "exec", Params: []byte(`{"command":["sh","-c","printf 0123456789; printf oops >&2"],"stream":true,"preview_bytes":4}`)},
+		},
+		messages: make(chan *AgentMessage, 10),
+	}
+	RegisterAgentCommandsServer(server, backend)
+	go func() {
+		_ = server.Serve(lis)
+	}()
+	defer server.Stop()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		_ = (&CommandRunner{
+			Address:     lis.Addr().String(),
+			WorkspaceID: "my-workspace",
+			Handlers:    map[string]CommandHandler{"exec": ExecCommandHandler(t.TempDir())},
+			Log:         log.Discard,
+		}).Run(ctx)
+	}()
+
+	streamed := map[string]string{}
+	var result *CommandResult
+	for result == nil {
+		select {
+		case message := <-backend.messages:
+			if output := message.GetOutput(); output != nil {
+				assert.Equal(t, output.CommandId, "c1")
+				assert.Equal(t, output.Offset, int64(len(streamed[output.Stream])))
+				streamed[output.Stream] += string(output.Data)
+			}
+			result = message.GetResult()
+		case <-time.After(10 * time.Second):
+			t.Fatalf("timed out, got output %v", streamed)
+		}
+	}
+
+	assert.DeepEqual(t, streamed, map[string]string{OutputStdout: "0123456789", OutputStderr: "oops"})
+	assert.Equal(t, string(result.Output), `{"exit_code":0,"stdout":"0123","stderr":"oops","truncated":true,"stdout_bytes":10,"stderr_bytes":4}`)
+}
+
+func TestRunSignalCommandHandler(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "runs")
+	handler := RunSignalCommandHandler(dir)
+
+	_, err := handler(context.Background(), []byte(`{"run_id":"r1","signal":"pause"}`))
+	assert.NilError(t, err)
+	_, err = handler(context.Background(), []byte(`{"run_id":"r1","signal":"cancel"}`))
+	assert.NilError(t, err)
+	signal, err := os.ReadFile(filepath.Join(dir, "r1"))
+	assert.NilError(t, err)
+	assert.Equal(t, string(signal), "cancel\n")
+
+	_, err = handler(context.Background(), []byte(`{"run_id":"../r1","signal":"cancel"}`))
+	assert.ErrorContains(t, err, "invalid run ID")
+	_, err = handler(context.Background(), []byte(`{"run_id":"r1","signal":"stop"}`))
+	assert.ErrorContains(t, err, "unknown run signal")
+}
+
+func TestDiffAndApplyPatch(t *testing.T) {
+	repo := t.TempDir()
+	git := func(args ...string) {
+		_, err := runGit(context.Background(), repo, []string{"GIT_AUTHOR_NAME=t", "GIT_AUTHOR_EMAIL=t@t", "GIT_COMMITTER_NAME=t", "GIT_COMMITTER_EMAIL=t@t"}, nil, args...)
+		assert.NilError(t, err)
+	}
+	git("init", "-q")
+	assert.NilError(t, os.WriteFile(filepath.Join(repo, "main.go"), []byte("package main\n"), 0o644))
+	git("add", "main.go")
+	git("commit", "-q", "-m", "initial")
+
+	ctx := context.Background()
+	diff := DiffCommandHandler(repo)
+	snapshot := SnapshotCommandHandler(repo)
+	apply := ApplyPatchCommandHandler(repo)
+
+	_, err := snapshot(ctx, []byte(`{"name":"before"}`))
+	assert.NilError(t, err)
+	assert.NilError(t, os.WriteFile(filepath.Join(repo, "main.go"), []byte("package main\n\nfunc main() {}\n"), 0o644))
+	assert.NilError(t, os.WriteFile(filepath.Join(repo, "new.txt"), []byte("untracked\n"), 0o644))
+
+	output, err := diff(ctx, []byte(`{}`))
+	assert.NilError(t, err)
+	patch := output.(*diffOutput).Patch
+	assert.Assert(t, strings.Contains(patch, "+func main() {}"), patch)
+	assert.Assert(t, strings.Contains(patch, "new file mode"), "untracked files must be in the diff: %s", patch)
+	status, err := runGit(ctx, repo, nil, nil, "status", "--porcelain")
+	assert.NilError(t, err)
+	assert.Equal(t, status, "M main.go\n?? new.txt", "the index must be untouched")
+
+	output, err = diff(ctx, []byte(`{"snapshot":"before","paths":["new.txt"]}`))
+	assert.NilError(t, err)
+	assert.Equal(t, output.(*diffOutput).Base, SnapshotRefPrefix+"before")
+	assert.Assert(t, !strings.Contains(output.(*diffOutput).Patch, "main.go"))
+	_, err = diff(ctx, []byte(`{"snapshot":"missing"}`))
+	assert.ErrorContains(t, err, "unknown base")
+
+	// a reviewed patch goes back onto the base
+	git("checkout", "-q", "--", "main.go")
+	assert.NilError(t, os.Remove(filepath.Join(repo, "new.txt")))
+	output, err = apply(ctx, []byte(`{"check":true,"patch":`+strconv.Quote(patch)+`}`))
+	assert.NilError(t, err)
+	assert.DeepEqual(t, output, &applyPatchOutput{Files: []string{"main.go", "new.txt"}})
+	output, err = apply(ctx, []byte(`{"patch":`+strconv.Quote(patch)+`}`))
+	assert.NilError(t, err)
+	assert.Assert(t, output.(*applyPatchOutput).Applied)
+	content, err := os.ReadFile(filepath.Join(repo, "new.txt"))
+	assert.NilError(t, err)
+	assert.Equal(t, string(content), "untracked\n")
+
+	output, err = apply(ctx, []byte(`{"patch":`+strconv.Quote(patch)+`}`))
+	assert.NilError(t, err)
+	assert.Assert(t, !output.(*applyPatchOutput).Applied)
+	assert.Assert(t, strings.Contains(output.(*applyPatchOutput).Error, "already exists"), output)
+}
+
+func TestPublishCommandHandler(t *testing.T) {
+	ctx := context.Background()
+	identity := []string{"GIT_AUTHOR_NAME=t", "GIT_AUTHOR_EMAIL=t@t", "GIT_COMMITTER_NAME=t", "GIT_COMMITTER_EMAIL=t@t"}
+	remote := filepath.Join(t.TempDir(), "remote.git")
+	_, err := runGit(ctx, t.TempDir(), nil, nil, "init", "-q", "--bare", "-b", "main", remote)
+	assert.NilError(t, err)
+	repo := t.TempDir()
+	for _, args := range [][]string{
+		{"init", "-q", "-b", "main"},
+		{"remote", "add", "origin", remote},
+		{"commit", "-q", "--allow-empty", "-m", "initial"},
+		{"push", "-q", "origin", "main"},
+	} {
+		_, err := runGit(ctx, repo, identity, nil, args...)
+		assert.NilError(t, err)
+	}
+	assert.NilError(t, os.WriteFile(filepath.Join(repo, "fix.go"), []byte("package fix\n"), 0o644))
+
+	handler := PublishCommandHandler(repo)
+	_, err = handler(ctx, []byte(`{"branch":"bad..branch","message":"fix"}`))
+	assert.ErrorContains(t, err, "invalid branch")
+
+	output, err := handler(ctx, []byte(`{"branch":"kled/fix","message":"Fix it","author_name":"Ada","author_email":"ada@example.com"}`))
+	assert.NilError(t, err)
+	published := output.(*publishOutput)
+	assert.Equal(t, published.RemoteURL, remote)
+	assert.Equal(t, published.CurrentBranch, "main")
+	assert.Assert(t, published.Committed)
+	assert.DeepEqual(t, published.Files, []string{"fix.go"})
+
+	pushed, err := runGit(ctx, remote, nil, nil, "log", "-1", "--format=%an %s", "kled/fix")
+	assert.NilError(t, err)
+	assert.Equal(t, pushed, "Ada Fix it")
+
+	// publishing again without changes pushes the branch as it is
+	output, err = handler(ctx, []byte(`{"branch":"kled/fix","message":"Fix it"}`))
+	assert.NilError(t, err)
+	assert.Assert(t, !output.(*publishOutput).Committed)
+	assert.Equal(t, output.(*publishOutput).Commit, published.Commit)
+}
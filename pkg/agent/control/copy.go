@@ -0,0 +1,472 @@
+package control
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/loft-sh/log"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Progress tracks the file content transferred by a copy
+type Progress interface {
+	// Start is called with the total size once the files are known
+	Start(total int64)
+	// Add is called with the size of every chunk that was transferred
+	Add(n int64)
+}
+
+// Copier copies files and directories between the local machine and the
+// workspace of the control channel. Files are written to partial files that
+// are continued by the next copy if one is interrupted, and files that are
+// already up to date are skipped. Modes and modification times are preserved,
+// symlinks are skipped
+type Copier struct {
+	Client   ControlClient
+	Progress Progress
+	Log      log.Logger
+}
+
+type copyEntry struct {
+	src  string
+	dst  string
+	info fileMeta
+}
+
+type fileMeta struct {
+	size    int64
+	mode    fs.FileMode
+	modTime int64
+	isDir   bool
+}
+
+func (m fileMeta) resumeKey() string {
+	return ResumeKey(m.size, m.modTime, uint32(m.mode.Perm()))
+}
+
+func (m fileMeta) upToDate(other fileMeta) bool {
+	return m.size == other.size && m.modTime == other.modTime && m.mode.Perm() == other.mode.Perm()
+}
+
+func localMeta(info fs.FileInfo) fileMeta {
+	return fileMeta{size: info.Size(), mode: info.Mode(), modTime: info.ModTime().Unix(), isDir: info.IsDir()}
+}
+
+func remoteMeta(info *FileInfo) fileMeta {
+	return fileMeta{size: info.Size, mode: fs.FileMode(info.Mode), modTime: info.ModTime, isDir: info.IsDir}
+}
+
+// Upload copies the local file or directory src to dst in the workspace. If
+// dst is an existing directory, src is copied into it
+func (c *Copier) Upload(ctx context.Context, src, dst string) error {
+	info, err := os.Stat(src)
+	if err != nil {
+		return err
+	}
+	target, err := c.Client.Stat(ctx, &StatRequest{Path: dst})
+	if err == nil && target.IsDir {
+		dst = path.Join(dst, filepath.Base(src))
+	} else if err != nil && status.Code(err) != codes.NotFound {
+		return err
+	}
+
+	entries := []copyEntry{{src: src, dst: dst, info: localMeta(info)}}
+	if info.IsDir() {
+		entries, err = c.walkLocal(src, dst)
+		if err != nil {
+			return err
+		}
+	}
+	c.start(entries)
+
+	for _, entry := range entries {
+		if entry.info.isDir {
+			err = c.writeRemoteDir(ctx, entry.dst, entry.info.mode|0700, 0)
+		} else {
+			err = c.uploadFile(ctx, entry)
+		}
+		if err != nil {
+			return fmt.Errorf("upload %s: %w", entry.src, err)
+		}
+	}
+
+	// apply the modes and times of directories last, as writing files
+	// changes them and they may not be writable
+	for i := len(entries) - 1; i >= 0; i-- {
+		if entries[i].info.isDir {
+			err = c.writeRemoteDir(ctx, entries[i].dst, entries[i].info.mode, entries[i].info.modTime)
+			if err != nil {
+				return fmt.Errorf("upload %s: %w", entries[i].src, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// UploadReader copies the content of reader to the file dst in the
+// workspace, e.g. to paste from stdin
+func (c *Copier) UploadReader(ctx context.Context, reader io.Reader, dst string) error {
+	c.progress().Start(0)
+	stream, err := c.Client.WriteFile(ctx)
+	if err != nil {
+		return err
+	}
+
+	req := &WriteFileRequest{Path: dst}
+	buf := make([]byte, chunkSize)
+	for {
+		n, err := reader.Read(buf)
+		if n > 0 {
+			req.Content = buf[:n]
+			if err := stream.Send(req); err != nil {
+				return streamError(stream, err)
+			}
+			c.progress().Add(int64(n))
+			req = &WriteFileRequest{}
+		}
+		if errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			return err
+		}
+	}
+	if req.Path != "" {
+		// nothing was read, create an empty file
+		if err := stream.Send(req); err != nil {
+			return streamError(stream, err)
+		}
+	}
+
+	_, err = stream.CloseAndRecv()
+	return err
+}
+
+func (c *Copier) walkLocal(src, dst string) ([]copyEntry, error) {
+	entries := []copyEntry{}
+	err := filepath.WalkDir(src, func(name string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() && !d.Type().IsRegular() {
+			c.Log.Warnf("Skip %s, only files and directories are copied", name)
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, name)
+		if err != nil {
+			return err
+		}
+
+		entries = append(entries, copyEntry{src: name, dst: path.Join(dst, filepath.ToSlash(rel)), info: localMeta(info)})
+		return nil
+	})
+
+	return entries, err
+}
+
+func (c *Copier) writeRemoteDir(ctx context.Context, dst string, mode fs.FileMode, modTime int64) error {
+	stream, err := c.Client.WriteFile(ctx)
+	if err != nil {
+		return err
+	}
+	err = stream.Send(&WriteFileRequest{Path: dst, Mode: uint32(mode.Perm()), ModTime: modTime, Directory: true})
+	if err != nil {
+		return streamError(stream, err)
+	}
+
+	_, err = stream.CloseAndRecv()
+	return err
+}
+
+func (c *Copier) uploadFile(ctx context.Context, entry copyEntry) error {
+	existing, err := c.Client.Stat(ctx, &StatRequest{Path: entry.dst})
+	if err == nil && remoteMeta(existing).upToDate(entry.info) {
+		c.progress().Add(entry.info.size)
+		return nil
+	} else if err != nil && status.Code(err) != codes.NotFound {
+		return err
+	}
+
+	// continue the partial file of an interrupted copy of the same content
+	key := entry.info.resumeKey()
+	var offset int64
+	partial, err := c.Client.Stat(ctx, &StatRequest{Path: PartialPath(entry.dst, key)})
+	if err == nil && partial.Size <= entry.info.size {
+		offset = partial.Size
+	} else if err != nil && status.Code(err) != codes.NotFound {
+		return err
+	}
+
+	file, err := os.Open(entry.src)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	_, err = file.Seek(offset, io.SeekStart)
+	if err != nil {
+		return err
+	}
+	c.progress().Add(offset)
+
+	stream, err := c.Client.WriteFile(ctx)
+	if err != nil {
+		return err
+	}
+	req := &WriteFileRequest{
+		Path:      entry.dst,
+		Mode:      uint32(entry.info.mode.Perm()),
+		ModTime:   entry.info.modTime,
+		ResumeKey: key,
+		Offset:    offset,
+	}
+	buf := make([]byte, chunkSize)
+	for {
+		n, err := file.Read(buf)
+		if n > 0 || req.Path != "" {
+			req.Content = buf[:n]
+			if err := stream.Send(req); err != nil {
+				return streamError(stream, err)
+			}
+			c.progress().Add(int64(n))
+			req = &WriteFileRequest{}
+		}
+		if errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			return err
+		}
+	}
+
+	_, err = stream.CloseAndRecv()
+	return err
+}
+
+// Download copies the file or directory src in the workspace to the local
+// path dst. If dst is an existing directory, src is copied into it
+func (c *Copier) Download(ctx context.Context, src, dst string) error {
+	info, err := c.Client.Stat(ctx, &StatRequest{Path: src})
+	if err != nil {
+		return err
+	}
+	if target, err := os.Stat(dst); err == nil && target.IsDir() {
+		dst = filepath.Join(dst, path.Base(src))
+	}
+
+	entries := []copyEntry{{src: src, dst: dst, info: remoteMeta(info)}}
+	if info.IsDir {
+		entries, err = c.walkRemote(ctx, src, dst, remoteMeta(info))
+		if err != nil {
+			return err
+		}
+	}
+	c.start(entries)
+
+	for _, entry := range entries {
+		if entry.info.isDir {
+			err = os.MkdirAll(entry.dst, entry.info.mode.Perm()|0700)
+		} else {
+			err = c.downloadFile(ctx, entry)
+		}
+		if err != nil {
+			return fmt.Errorf("download %s: %w", entry.src, err)
+		}
+	}
+
+	for i := len(entries) - 1; i >= 0; i-- {
+		if entries[i].info.isDir {
+			err = applyMeta(entries[i].dst, entries[i].info)
+			if err != nil {
+				return fmt.Errorf("download %s: %w", entries[i].src, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// DownloadWriter copies the content of the file src in the workspace to
+// writer, e.g. to print it to stdout
+func (c *Copier) DownloadWriter(ctx context.Context, src string, writer io.Writer) error {
+	info, err := c.Client.Stat(ctx, &StatRequest{Path: src})
+	if err != nil {
+		return err
+	} else if info.IsDir {
+		return fmt.Errorf("%s is a directory", src)
+	}
+	c.progress().Start(info.Size)
+
+	return c.readRemote(ctx, src, 0, writer)
+}
+
+func (c *Copier) walkRemote(ctx context.Context, src, dst string, info fileMeta) ([]copyEntry, error) {
+	entries := []copyEntry{{src: src, dst: dst, info: info}}
+	response, err := c.Client.ListDir(ctx, &ListDirRequest{Path: src})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, child := range response.Entries {
+		childDst, err := localChildPath(dst, child.Name)
+		if err != nil {
+			return nil, err
+		}
+		childSrc := path.Join(src, child.Name)
+		meta := remoteMeta(child)
+		if meta.isDir {
+			children, err := c.walkRemote(ctx, childSrc, childDst, meta)
+			if err != nil {
+				return nil, err
+			}
+			entries = append(entries, children...)
+		} else if meta.mode.IsRegular() {
+			entries = append(entries, copyEntry{src: childSrc, dst: childDst, info: meta})
+		} else {
+			c.Log.Warnf("Skip %s, only files and directories are copied", childSrc)
+		}
+	}
+
+	return entries, nil
+}
+
+// localChildPath joins the name of a directory entry sent by the workspace to
+// dst. The workspace isn't trusted, so names that would leave dst, like
+// ../.ssh/authorized_keys or an absolute path, are rejected
+func localChildPath(dst, name string) (string, error) {
+	if name == "" || name == "." || name == ".." || strings.ContainsAny(name, `/\`) || filepath.IsAbs(name) || filepath.VolumeName(name) != "" {
+		return "", fmt.Errorf("workspace sent the invalid file name %q", name)
+	}
+
+	child := filepath.Join(dst, name)
+	rel, err := filepath.Rel(dst, child)
+	if err != nil || rel != name {
+		return "", fmt.Errorf("workspace sent the invalid file name %q", name)
+	}
+
+	return child, nil
+}
+
+func (c *Copier) downloadFile(ctx context.Context, entry copyEntry) error {
+	existing, err := os.Stat(entry.dst)
+	if err == nil && localMeta(existing).upToDate(entry.info) {
+		c.progress().Add(entry.info.size)
+		return nil
+	}
+	err = os.MkdirAll(filepath.Dir(entry.dst), 0755)
+	if err != nil {
+		return err
+	}
+
+	// continue the partial file of an interrupted copy of the same content
+	partialPath := PartialPath(entry.dst, entry.info.resumeKey())
+	flags := os.O_WRONLY | os.O_CREATE | os.O_APPEND
+	var offset int64
+	if partial, err := os.Stat(partialPath); err == nil && partial.Size() <= entry.info.size {
+		offset = partial.Size()
+	} else {
+		flags |= os.O_TRUNC
+	}
+	file, err := os.OpenFile(partialPath, flags, 0600)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	c.progress().Add(offset)
+
+	err = c.readRemote(ctx, entry.src, offset, file)
+	if err != nil {
+		return err
+	}
+	err = file.Close()
+	if err != nil {
+		return err
+	}
+	err = applyMeta(partialPath, entry.info)
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(partialPath, entry.dst)
+}
+
+func (c *Copier) readRemote(ctx context.Context, src string, offset int64, writer io.Writer) error {
+	stream, err := c.Client.ReadFile(ctx, &ReadFileRequest{Path: src, Offset: offset})
+	if err != nil {
+		return err
+	}
+
+	for {
+		chunk, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		_, err = writer.Write(chunk.Content)
+		if err != nil {
+			return err
+		}
+		c.progress().Add(int64(len(chunk.Content)))
+	}
+}
+
+func (c *Copier) start(entries []copyEntry) {
+	var total int64
+	for _, entry := range entries {
+		if !entry.info.isDir {
+			total += entry.info.size
+		}
+	}
+
+	c.progress().Start(total)
+}
+
+func (c *Copier) progress() Progress {
+	if c.Progress == nil {
+		return noProgress{}
+	}
+
+	return c.Progress
+}
+
+func applyMeta(name string, info fileMeta) error {
+	err := os.Chmod(name, info.mode.Perm())
+	if err != nil {
+		return err
+	}
+
+	return os.Chtimes(name, time.Now(), time.Unix(info.modTime, 0))
+}
+
+// streamError returns the status of a client stream that failed to send,
+// which is more helpful than the io.EOF of the send
+func streamError(stream Control_WriteFileClient, err error) error {
+	if !errors.Is(err, io.EOF) {
+		return err
+	}
+	_, err = stream.CloseAndRecv()
+	if err == nil {
+		err = io.ErrUnexpectedEOF
+	}
+
+	return err
+}
+
+type noProgress struct{}
+
+func (noProgress) Start(int64) {}
+
+func (noProgress) Add(int64) {}
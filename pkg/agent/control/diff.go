@@ -0,0 +1,288 @@
+package control
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// SnapshotRefPrefix prefixes the refs of workspace snapshots, which record
+// the working tree, untracked files included, as a commit.
+const SnapshotRefPrefix = "refs/kled/snapshots/"
+
+// maxPatchSize keeps diffs below the message size of the command stream.
+const maxPatchSize = 2 << 20
+
+var snapshotNamePattern = regexp.MustCompile(`^[A-Za-z0-9_-]+(\.[A-Za-z0-9_-]+)*$`)
+
+// validSnapshotName accepts the names that make valid refs.
+func validSnapshotName(name string) bool {
+	return len(name) <= 100 && snapshotNamePattern.MatchString(name) && !strings.HasSuffix(name, ".lock")
+}
+
+type diffParams struct {
+	// Base is the git revision to diff against, HEAD if empty.
+	Base string `json:"base,omitempty"`
+	// Snapshot diffs against a snapshot instead of Base.
+	Snapshot string   `json:"snapshot,omitempty"`
+	Paths    []string `json:"paths,omitempty"`
+	Workdir  string   `json:"workdir,omitempty"`
+}
+
+type diffOutput struct {
+	Base       string `json:"base"`
+	BaseCommit string `json:"base_commit"`
+	Patch      string `json:"patch"`
+}
+
+type snapshotParams struct {
+	Name    string `json:"name"`
+	Workdir string `json:"workdir,omitempty"`
+}
+
+type snapshotOutput struct {
+	Name   string `json:"name"`
+	Ref    string `json:"ref"`
+	Commit string `json:"commit"`
+}
+
+type applyPatchParams struct {
+	Patch string `json:"patch"`
+	// Check only reports whether the patch applies.
+	Check   bool   `json:"check,omitempty"`
+	Workdir string `json:"workdir,omitempty"`
+}
+
+type applyPatchOutput struct {
+	Applied bool     `json:"applied"`
+	Files   []string `json:"files,omitempty"`
+	// Error is git's explanation of a patch that doesn't apply.
+	Error string `json:"error,omitempty"`
+}
+
+// DiffCommandHandler returns the diff of the working tree, untracked files
+// included, against a git revision or a snapshot. The index of the
+// repository is left untouched.
+func DiffCommandHandler(workdir string) CommandHandler {
+	return func(ctx context.Context, params json.RawMessage) (interface{}, error) {
+		var p diffParams
+		if err := json.Unmarshal(params, &p); err != nil {
+			return nil, fmt.Errorf("invalid diff parameters: %w", err)
+		}
+		base := p.Base
+		if p.Snapshot != "" {
+			if base != "" {
+				return nil, errors.New("base and snapshot are mutually exclusive")
+			}
+			if !validSnapshotName(p.Snapshot) {
+				return nil, fmt.Errorf("invalid snapshot name %q", p.Snapshot)
+			}
+			base = SnapshotRefPrefix + p.Snapshot
+		} else if base == "" {
+			base = "HEAD"
+		} else if strings.HasPrefix(base, "-") {
+			return nil, fmt.Errorf("invalid base %q", base)
+		}
+
+		repo, err := repositoryRoot(ctx, p.Workdir, workdir)
+		if err != nil {
+			return nil, err
+		}
+		commit, err := runGit(ctx, repo, nil, nil, "rev-parse", "--verify", "--quiet", base+"^{commit}")
+		if err != nil {
+			return nil, fmt.Errorf("unknown base %q", base)
+		}
+		tree, err := workingTree(ctx, repo)
+		if err != nil {
+			return nil, err
+		}
+
+		args := []string{"diff", "--binary", "--no-color", "--no-ext-diff", "--find-renames", commit, tree, "--"}
+		patch, err := runGit(ctx, repo, nil, nil, append(args, p.Paths...)...)
+		if err != nil {
+			return nil, err
+		}
+		if len(patch) > maxPatchSize {
+			return nil, fmt.Errorf("diff is larger than %d bytes, limit it to some paths", maxPatchSize)
+		}
+		return &diffOutput{Base: base, BaseCommit: commit, Patch: patch}, nil
+	}
+}
+
+// SnapshotCommandHandler records the working tree as a commit under
+// SnapshotRefPrefix, for later diffs against it. Taking a snapshot with the
+// name of an existing one replaces it.
+func SnapshotCommandHandler(workdir string) CommandHandler {
+	return func(ctx context.Context, params json.RawMessage) (interface{}, error) {
+		var p snapshotParams
+		if err := json.Unmarshal(params, &p); err != nil {
+			return nil, fmt.Errorf("invalid snapshot parameters: %w", err)
+		}
+		if !validSnapshotName(p.Name) {
+			return nil, fmt.Errorf("invalid snapshot name %q", p.Name)
+		}
+
+		repo, err := repositoryRoot(ctx, p.Workdir, workdir)
+		if err != nil {
+			return nil, err
+		}
+		tree, err := workingTree(ctx, repo)
+		if err != nil {
+			return nil, err
+		}
+		args := []string{"commit-tree", tree, "-m", "kled snapshot " + p.Name}
+		if head, err := runGit(ctx, repo, nil, nil, "rev-parse", "--verify", "--quiet", "HEAD^{commit}"); err == nil {
+			args = append(args, "-p", head)
+		}
+		// the workspace user may have no identity configured
+		env := []string{
+			"GIT_AUTHOR_NAME=kled", "GIT_AUTHOR_EMAIL=kled@localhost",
+			"GIT_COMMITTER_NAME=kled", "GIT_COMMITTER_EMAIL=kled@localhost",
+		}
+		commit, err := runGit(ctx, repo, env, nil, args...)
+		if err != nil {
+			return nil, err
+		}
+		ref := SnapshotRefPrefix + p.Name
+		if _, err := runGit(ctx, repo, nil, nil, "update-ref", ref, commit); err != nil {
+			return nil, err
+		}
+		return &snapshotOutput{Name: p.Name, Ref: ref, Commit: commit}, nil
+	}
+}
+
+// ApplyPatchCommandHandler applies a patch to the working tree. Patches that
+// don't apply cleanly change nothing and are reported in the output rather
+// than as an error.
+func ApplyPatchCommandHandler(workdir string) CommandHandler {
+	return func(ctx context.Context, params json.RawMessage) (interface{}, error) {
+		var p applyPatchParams
+		if err := json.Unmarshal(params, &p); err != nil {
+			return nil, fmt.Errorf("invalid patch parameters: %w", err)
+		} else if strings.TrimSpace(p.Patch) == "" {
+			return nil, errors.New("patch is required")
+		}
+
+		repo, err := repositoryRoot(ctx, p.Workdir, workdir)
+		if err != nil {
+			return nil, err
+		}
+		numstat, err := runGit(ctx, repo, nil, strings.NewReader(p.Patch), "apply", "--numstat", "-z", "-")
+		if err != nil {
+			return &applyPatchOutput{Error: err.Error()}, nil
+		}
+		output := &applyPatchOutput{Files: patchFiles(numstat)}
+
+		args := []string{"apply", "--whitespace=nowarn"}
+		if p.Check {
+			args = append(args, "--check")
+		}
+		if _, err := runGit(ctx, repo, nil, strings.NewReader(p.Patch), append(args, "-")...); err != nil {
+			output.Error = err.Error()
+			return output, nil
+		}
+		output.Applied = !p.Check
+		return output, nil
+	}
+}
+
+// patchFiles returns the files of `git apply --numstat -z`, the new path of
+// renamed ones.
+func patchFiles(numstat string) []string {
+	var files []string
+	fields := strings.Split(numstat, "\x00")
+	for i := 0; i < len(fields); i++ {
+		parts := strings.SplitN(fields[i], "\t", 3)
+		if len(parts) != 3 {
+			continue
+		}
+		if parts[2] != "" {
+			files = append(files, parts[2])
+		} else if i+2 < len(fields) {
+			// renames list the old and the new path as separate fields
+			files = append(files, fields[i+2])
+			i += 2
+		}
+	}
+	return files
+}
+
+// repositoryRoot returns the top level of the repository containing dir, or
+// fallback if dir is empty.
+func repositoryRoot(ctx context.Context, dir, fallback string) (string, error) {
+	if dir == "" {
+		dir = fallback
+	}
+	root, err := runGit(ctx, dir, nil, nil, "rev-parse", "--show-toplevel")
+	if err != nil {
+		return "", fmt.Errorf("%s is not in a git repository", dir)
+	}
+	return root, nil
+}
+
+// workingTree writes the working tree as a git tree and returns its ID. It
+// stages into a copy of the index, so the stat cache of the repository is
+// reused without changing what the user staged.
+func workingTree(ctx context.Context, repo string) (string, error) {
+	index, err := os.CreateTemp("", "kled-index-*")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(index.Name())
+
+	indexPath, err := runGit(ctx, repo, nil, nil, "rev-parse", "--path-format=absolute", "--git-path", "index")
+	if err != nil {
+		index.Close()
+		return "", err
+	}
+	if current, err := os.Open(indexPath); err == nil {
+		_, err = io.Copy(index, current)
+		current.Close()
+		if err != nil {
+			index.Close()
+			return "", err
+		}
+	} else if !os.IsNotExist(err) {
+		index.Close()
+		return "", err
+	}
+	if err := index.Close(); err != nil {
+		return "", err
+	}
+
+	env := []string{"GIT_INDEX_FILE=" + index.Name()}
+	if _, err := runGit(ctx, repo, env, nil, "add", "--all", "--", "."); err != nil {
+		return "", err
+	}
+	return runGit(ctx, repo, env, nil, "write-tree")
+}
+
+// runGit runs git in dir and returns its trimmed output. Failures carry
+// git's error output.
+func runGit(ctx context.Context, dir string, env []string, stdin io.Reader, args ...string) (string, error) {
+	cmd := exec.CommandContext(ctx, "git", args...)
+	cmd.Dir = filepath.Clean(dir)
+	cmd.Env = append(os.Environ(), env...)
+	cmd.Stdin = stdin
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if message := strings.TrimSpace(stderr.String()); message != "" {
+			return "", fmt.Errorf("git %s: %s", args[0], message)
+		}
+		return "", fmt.Errorf("git %s: %w", args[0], err)
+	}
+	if args[0] == "diff" || args[0] == "apply" {
+		return stdout.String(), nil
+	}
+	return strings.TrimSpace(stdout.String()), nil
+}
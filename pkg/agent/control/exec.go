@@ -0,0 +1,151 @@
+package control
+
+import (
+	"errors"
+	"io"
+	"os"
+	"os/exec"
+	"sync"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func (s *Server) Exec(stream Control_ExecServer) error {
+	req, err := stream.Recv()
+	if err != nil {
+		return err
+	}
+	start := req.GetStart()
+	if start == nil {
+		return status.Error(codes.InvalidArgument, "the first exec request must start the command")
+	} else if len(start.Command) == 0 {
+		return status.Error(codes.InvalidArgument, "command is required")
+	}
+
+	cmd := exec.CommandContext(stream.Context(), start.Command[0], start.Command[1:]...)
+	cmd.Dir = start.Workdir
+	if cmd.Dir == "" {
+		cmd.Dir = s.workdir
+	}
+	cmd.Env = os.Environ()
+	for k, v := range start.Env {
+		cmd.Env = append(cmd.Env, k+"="+v)
+	}
+
+	sender := &execSender{stream: stream}
+	var (
+		stdin   io.WriteCloser
+		resize  func(*TerminalSize)
+		outputs sync.WaitGroup
+	)
+	if start.Tty {
+		terminal, err := startPTY(cmd, start.Size)
+		if err != nil {
+			return status.Errorf(codes.FailedPrecondition, "start command: %v", err)
+		}
+		defer terminal.Close()
+
+		stdin = terminal
+		resize = func(size *TerminalSize) {
+			_ = setPTYSize(terminal, size)
+		}
+		outputs.Add(1)
+		go func() {
+			defer outputs.Done()
+			// reading the terminal fails once the command exited
+			_, _ = io.Copy(sender.writer(false), terminal)
+		}()
+	} else {
+		stdin, err = cmd.StdinPipe()
+		if err != nil {
+			return status.Errorf(codes.Internal, "start command: %v", err)
+		}
+		cmd.Stdout = sender.writer(false)
+		cmd.Stderr = sender.writer(true)
+		err = cmd.Start()
+		if err != nil {
+			return status.Errorf(codes.FailedPrecondition, "start command: %v", err)
+		}
+		resize = func(*TerminalSize) {}
+	}
+
+	go func() {
+		for {
+			req, err := stream.Recv()
+			if err != nil {
+				// the client closed its side of the stream
+				_ = closeStdin(stdin, start.Tty)
+				return
+			}
+
+			switch request := req.Request.(type) {
+			case *ExecRequest_Stdin:
+				_, _ = stdin.Write(request.Stdin)
+			case *ExecRequest_CloseStdin:
+				_ = closeStdin(stdin, start.Tty)
+			case *ExecRequest_Resize:
+				resize(request.Resize)
+			}
+		}
+	}()
+
+	exitCode := 0
+	err = cmd.Wait()
+	outputs.Wait()
+	exitErr := &exec.ExitError{}
+	if errors.As(err, &exitErr) {
+		exitCode = exitErr.ExitCode()
+	} else if err != nil {
+		return status.Errorf(codes.Internal, "run command: %v", err)
+	}
+	s.log.Debugf("Command %v exited with %d", start.Command, exitCode)
+
+	return sender.send(&ExecResponse{Response: &ExecResponse_ExitCode{ExitCode: int32(exitCode)}})
+}
+
+// closeStdin closes the stdin of a command. A terminal stays open for the
+// output and gets an end of transmission instead.
+func closeStdin(stdin io.WriteCloser, tty bool) error {
+	if tty {
+		_, err := stdin.Write([]byte{4})
+		return err
+	}
+
+	return stdin.Close()
+}
+
+// execSender serializes the responses of an exec stream.
+type execSender struct {
+	m      sync.Mutex
+	stream Control_ExecServer
+}
+
+func (s *execSender) send(response *ExecResponse) error {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	return s.stream.Send(response)
+}
+
+func (s *execSender) writer(stderr bool) io.Writer {
+	return writerFunc(func(p []byte) (int, error) {
+		// the stream keeps the message, p may be reused by the caller
+		data := append([]byte(nil), p...)
+		response := &ExecResponse{Response: &ExecResponse_Stdout{Stdout: data}}
+		if stderr {
+			response = &ExecResponse{Response: &ExecResponse_Stderr{Stderr: data}}
+		}
+		if err := s.send(response); err != nil {
+			return 0, err
+		}
+
+		return len(p), nil
+	})
+}
+
+type writerFunc func(p []byte) (int, error)
+
+func (f writerFunc) Write(p []byte) (int, error) {
+	return f(p)
+}
@@ -0,0 +1,318 @@
+package control
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// chunkSize is the size of the file chunks that are streamed
+const chunkSize = 64 * 1024
+
+func (s *Server) resolvePath(path string) (string, error) {
+	if path == "" {
+		return "", status.Error(codes.InvalidArgument, "path is required")
+	}
+	if !filepath.IsAbs(path) && s.workdir != "" {
+		path = filepath.Join(s.workdir, path)
+	}
+
+	return filepath.Clean(path), nil
+}
+
+func (s *Server) Stat(_ context.Context, req *StatRequest) (*FileInfo, error) {
+	path, err := s.resolvePath(req.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	stat, err := os.Stat(path)
+	if err != nil {
+		return nil, fileError(err)
+	}
+
+	return toFileInfo(stat), nil
+}
+
+func (s *Server) ListDir(_ context.Context, req *ListDirRequest) (*ListDirResponse, error) {
+	path, err := s.resolvePath(req.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	entries, err := os.ReadDir(path)
+	if err != nil {
+		return nil, fileError(err)
+	}
+
+	response := &ListDirResponse{}
+	for _, entry := range entries {
+		info, err := entry.Info()
+		if err != nil {
+			// removed in the meantime
+			continue
+		}
+
+		response.Entries = append(response.Entries, toFileInfo(info))
+	}
+
+	return response, nil
+}
+
+func (s *Server) ReadFile(req *ReadFileRequest, stream Control_ReadFileServer) error {
+	path, err := s.resolvePath(req.Path)
+	if err != nil {
+		return err
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return fileError(err)
+	}
+	defer file.Close()
+
+	if req.Offset > 0 {
+		_, err = file.Seek(req.Offset, io.SeekStart)
+		if err != nil {
+			return fileError(err)
+		}
+	}
+
+	buf := make([]byte, chunkSize)
+	for {
+		n, err := file.Read(buf)
+		if n > 0 {
+			if err := stream.Send(&FileChunk{Content: buf[:n]}); err != nil {
+				return err
+			}
+		}
+		if errors.Is(err, io.EOF) {
+			return nil
+		} else if err != nil {
+			return fileError(err)
+		}
+	}
+}
+
+func (s *Server) WriteFile(stream Control_WriteFileServer) error {
+	req, err := stream.Recv()
+	if err != nil {
+		return err
+	}
+	path, err := s.resolvePath(req.Path)
+	if err != nil {
+		return err
+	}
+	mode, modTime := fs.FileMode(req.Mode).Perm(), req.ModTime
+	if req.Directory {
+		if mode == 0 {
+			mode = 0755
+		}
+
+		return s.writeDir(stream, path, mode, modTime)
+	}
+	if mode == 0 {
+		mode = 0644
+	}
+
+	err = os.MkdirAll(filepath.Dir(path), 0755)
+	if err != nil {
+		return fileError(err)
+	}
+
+	file, err := openWriteTarget(path, req.ResumeKey, req.Offset)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	if req.ResumeKey == "" {
+		defer os.Remove(file.Name())
+	}
+
+	size := req.Offset
+	for {
+		n, err := file.Write(req.Content)
+		size += int64(n)
+		if err != nil {
+			return fileError(err)
+		}
+
+		req, err = stream.Recv()
+		if errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			return err
+		}
+	}
+
+	err = file.Chmod(mode)
+	if err != nil {
+		return fileError(err)
+	}
+	err = file.Close()
+	if err != nil {
+		return fileError(err)
+	}
+	if modTime > 0 {
+		err = os.Chtimes(file.Name(), time.Now(), time.Unix(modTime, 0))
+		if err != nil {
+			return fileError(err)
+		}
+	}
+	err = os.Rename(file.Name(), path)
+	if err != nil {
+		return fileError(err)
+	}
+
+	return stream.SendAndClose(&WriteFileResponse{Size: size})
+}
+
+// openWriteTarget opens the file the content of a write goes to before it's
+// renamed to path. Plain writes use a temporary file so readers never see a
+// partial file, resumable writes continue the partial file of resumeKey at
+// offset
+func openWriteTarget(path, resumeKey string, offset int64) (*os.File, error) {
+	if resumeKey == "" {
+		file, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*")
+		if err != nil {
+			return nil, fileError(err)
+		}
+
+		return file, nil
+	}
+	if !validResumeKey(resumeKey) {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid resume key %s", resumeKey)
+	}
+
+	partialPath := PartialPath(path, resumeKey)
+	if offset == 0 {
+		file, err := os.OpenFile(partialPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+		if err != nil {
+			return nil, fileError(err)
+		}
+
+		return file, nil
+	}
+
+	file, err := os.OpenFile(partialPath, os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return nil, fileError(err)
+	}
+	stat, err := file.Stat()
+	if err != nil {
+		_ = file.Close()
+		return nil, fileError(err)
+	} else if stat.Size() != offset {
+		_ = file.Close()
+		return nil, status.Errorf(codes.FailedPrecondition, "partial file %s has %d bytes, expected %d", partialPath, stat.Size(), offset)
+	}
+
+	return file, nil
+}
+
+// writeDir creates the directory of a write request, the request must not
+// have content
+func (s *Server) writeDir(stream Control_WriteFileServer, path string, mode fs.FileMode, modTime int64) error {
+	err := os.MkdirAll(path, mode)
+	if err != nil {
+		return fileError(err)
+	}
+	err = os.Chmod(path, mode)
+	if err != nil {
+		return fileError(err)
+	}
+	if modTime > 0 {
+		err = os.Chtimes(path, time.Now(), time.Unix(modTime, 0))
+		if err != nil {
+			return fileError(err)
+		}
+	}
+
+	_, err = stream.Recv()
+	if !errors.Is(err, io.EOF) {
+		if err == nil {
+			return status.Error(codes.InvalidArgument, "directories can't have content")
+		}
+		return err
+	}
+
+	return stream.SendAndClose(&WriteFileResponse{})
+}
+
+// PartialPath returns the path of the partial file a resumable write of
+// resumeKey to path goes to. It lives next to path, so it can be renamed
+// once the write is complete
+func PartialPath(path, resumeKey string) string {
+	return filepath.Join(filepath.Dir(path), "."+filepath.Base(path)+"."+resumeKey+".kledpart")
+}
+
+// ResumeKey returns the resume key of a source file, it changes whenever the
+// file is modified so stale partial files are never continued
+func ResumeKey(size, modTime int64, mode uint32) string {
+	hash := sha256.Sum256([]byte(fmt.Sprintf("%d:%d:%o", size, modTime, mode)))
+	return hex.EncodeToString(hash[:8])
+}
+
+func validResumeKey(key string) bool {
+	if len(key) > 64 {
+		return false
+	}
+	for _, r := range key {
+		if !(r >= '0' && r <= '9') && !(r >= 'a' && r <= 'z') && !(r >= 'A' && r <= 'Z') && r != '-' && r != '_' {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (s *Server) Remove(_ context.Context, req *RemoveRequest) (*RemoveResponse, error) {
+	path, err := s.resolvePath(req.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	if req.Recursive {
+		err = os.RemoveAll(path)
+	} else {
+		err = os.Remove(path)
+	}
+	if err != nil {
+		return nil, fileError(err)
+	}
+
+	return &RemoveResponse{}, nil
+}
+
+func toFileInfo(info fs.FileInfo) *FileInfo {
+	return &FileInfo{
+		Name:    info.Name(),
+		Size:    info.Size(),
+		Mode:    uint32(info.Mode()),
+		ModTime: info.ModTime().Unix(),
+		IsDir:   info.IsDir(),
+	}
+}
+
+func fileError(err error) error {
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		return status.Error(codes.NotFound, err.Error())
+	case errors.Is(err, fs.ErrPermission):
+		return status.Error(codes.PermissionDenied, err.Error())
+	case errors.Is(err, fs.ErrExist):
+		return status.Error(codes.AlreadyExists, err.Error())
+	}
+
+	return status.Error(codes.Internal, err.Error())
+}
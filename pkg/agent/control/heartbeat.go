@@ -0,0 +1,125 @@
+package control
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/loft-sh/devpod/pkg/version"
+	"github.com/loft-sh/log"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+// DefaultHeartbeatInterval is used until the backend announces its interval.
+const DefaultHeartbeatInterval = 15 * time.Second
+
+// Heartbeater keeps a Beat stream to the backend open and sends a beat every
+// interval. Broken streams are reopened with backoff.
+type Heartbeater struct {
+	Address      string
+	Token        string
+	WorkspaceID  string
+	WorkspaceUID string
+	Interval     time.Duration
+	Log          log.Logger
+
+	started time.Time
+}
+
+// Run sends heartbeats until ctx is done.
+func (h *Heartbeater) Run(ctx context.Context) error {
+	if h.Interval <= 0 {
+		h.Interval = DefaultHeartbeatInterval
+	}
+	h.started = time.Now()
+
+	conn, err := grpc.NewClient(h.Address,
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithPerRPCCredentials(tokenCredentials(h.Token)),
+	)
+	if err != nil {
+		return fmt.Errorf("connect to heartbeat endpoint %s: %w", h.Address, err)
+	}
+	defer conn.Close()
+
+	client := NewHeartbeatClient(conn)
+	backoff := time.Second
+	for {
+		start := time.Now()
+		err := h.beat(ctx, client)
+		if ctx.Err() != nil {
+			return nil
+		}
+		// a stream that stayed up for a while resets the backoff
+		if time.Since(start) > 2*h.Interval {
+			backoff = time.Second
+		}
+		h.Log.Debugf("Heartbeat stream to %s closed: %v, reconnecting in %s", h.Address, err, backoff)
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(backoff):
+		}
+		backoff = min(backoff*2, h.Interval)
+	}
+}
+
+// beat sends beats on a single stream until it breaks.
+func (h *Heartbeater) beat(ctx context.Context, client HeartbeatClient) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	stream, err := client.Beat(ctx)
+	if err != nil {
+		return err
+	}
+
+	// acknowledgements carry the interval the backend expects
+	intervals := make(chan time.Duration, 1)
+	errs := make(chan error, 1)
+	go func() {
+		for {
+			res, err := stream.Recv()
+			if err != nil {
+				errs <- err
+				return
+			}
+			if res.IntervalSeconds > 0 {
+				select {
+				case <-intervals:
+				default:
+				}
+				intervals <- time.Duration(res.IntervalSeconds) * time.Second
+			}
+		}
+	}()
+
+	hostname, _ := os.Hostname()
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case err := <-errs:
+			return err
+		case interval := <-intervals:
+			h.Interval = interval
+		case <-timer.C:
+			err := stream.Send(&BeatRequest{
+				WorkspaceId:   h.WorkspaceID,
+				WorkspaceUid:  h.WorkspaceUID,
+				Version:       version.GetVersion(),
+				Hostname:      hostname,
+				UptimeSeconds: int64(time.Since(h.started).Seconds()),
+			})
+			if err != nil {
+				return err
+			}
+			timer.Reset(h.Interval)
+		}
+	}
+}
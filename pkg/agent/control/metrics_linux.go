@@ -0,0 +1,73 @@
+//go:build linux
+// +build linux
+
+package control
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+func collectMetrics(workdir string) (*MetricsResponse, error) {
+	metrics := &MetricsResponse{Cpus: int32(runtime.NumCPU())}
+
+	loadavg, err := os.ReadFile("/proc/loadavg")
+	if err != nil {
+		return nil, err
+	}
+	_, err = fmt.Sscanf(string(loadavg), "%f %f %f", &metrics.Load1, &metrics.Load5, &metrics.Load15)
+	if err != nil {
+		return nil, fmt.Errorf("parse /proc/loadavg: %w", err)
+	}
+
+	meminfo, err := os.Open("/proc/meminfo")
+	if err != nil {
+		return nil, err
+	}
+	defer meminfo.Close()
+
+	scanner := bufio.NewScanner(meminfo)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 {
+			continue
+		}
+
+		kb, err := strconv.ParseUint(fields[1], 10, 64)
+		if err != nil {
+			continue
+		}
+		switch fields[0] {
+		case "MemTotal:":
+			metrics.MemoryTotalBytes = kb * 1024
+		case "MemAvailable:":
+			metrics.MemoryAvailableBytes = kb * 1024
+		}
+	}
+
+	if workdir == "" {
+		workdir = "/"
+	}
+	stat := &syscall.Statfs_t{}
+	if err := syscall.Statfs(workdir, stat); err == nil {
+		metrics.DiskTotalBytes = stat.Blocks * uint64(stat.Bsize)
+		metrics.DiskAvailableBytes = stat.Bavail * uint64(stat.Bsize)
+	}
+
+	entries, err := os.ReadDir("/proc")
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range entries {
+		if _, err := strconv.Atoi(entry.Name()); err == nil && entry.IsDir() {
+			metrics.Processes++
+		}
+	}
+
+	return metrics, nil
+}
@@ -0,0 +1,54 @@
+package control
+
+import (
+	"context"
+	"sort"
+
+	"github.com/loft-sh/devpod/pkg/netstat"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func (s *Server) ListPorts(context.Context, *ListPortsRequest) (*ListPortsResponse, error) {
+	listening := func(sock *netstat.SockTabEntry) bool {
+		return sock.State == netstat.Listen && sock.LocalAddr != nil
+	}
+	socks, err := netstat.TCPSocks(listening)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "list ports: %v", err)
+	}
+	socks6, err := netstat.TCP6Socks(listening)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "list ports: %v", err)
+	}
+
+	response := &ListPortsResponse{}
+	seen := map[string]bool{}
+	for _, sock := range append(socks, socks6...) {
+		// the control channel itself is not a workspace port
+		if int(sock.LocalAddr.Port) == s.port {
+			continue
+		}
+
+		port := &Port{
+			Port:    uint32(sock.LocalAddr.Port),
+			Address: sock.LocalAddr.IP.String(),
+		}
+		if sock.Process != nil {
+			port.Process = sock.Process.Name
+			port.Pid = int32(sock.Process.Pid)
+		}
+		if key := sock.LocalAddr.String(); !seen[key] {
+			seen[key] = true
+			response.Ports = append(response.Ports, port)
+		}
+	}
+	sort.Slice(response.Ports, func(i, j int) bool {
+		if response.Ports[i].Port != response.Ports[j].Port {
+			return response.Ports[i].Port < response.Ports[j].Port
+		}
+		return response.Ports[i].Address < response.Ports[j].Address
+	})
+
+	return response, nil
+}
@@ -0,0 +1,27 @@
+//go:build !windows
+// +build !windows
+
+package control
+
+import (
+	"os"
+	"os/exec"
+
+	"github.com/creack/pty"
+)
+
+func startPTY(cmd *exec.Cmd, size *TerminalSize) (*os.File, error) {
+	if size == nil {
+		return pty.Start(cmd)
+	}
+
+	return pty.StartWithSize(cmd, toWinsize(size))
+}
+
+func setPTYSize(f *os.File, size *TerminalSize) error {
+	return pty.Setsize(f, toWinsize(size))
+}
+
+func toWinsize(size *TerminalSize) *pty.Winsize {
+	return &pty.Winsize{Rows: uint16(size.Rows), Cols: uint16(size.Columns)}
+}
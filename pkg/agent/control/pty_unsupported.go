@@ -0,0 +1,18 @@
+//go:build windows
+// +build windows
+
+package control
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+)
+
+func startPTY(cmd *exec.Cmd, size *TerminalSize) (*os.File, error) {
+	return nil, errors.New("terminals are not supported on windows")
+}
+
+func setPTYSize(f *os.File, size *TerminalSize) error {
+	return nil
+}
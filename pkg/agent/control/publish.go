@@ -0,0 +1,138 @@
+package control
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// publishCredentialHelper answers git's credential requests with the token
+// passed in the environment of the push, so it never lands in the config or
+// on the command line.
+const publishCredentialHelper = `!f() { test "$1" = get && echo "username=$KLED_PUBLISH_USERNAME" && echo "password=$KLED_PUBLISH_TOKEN"; }; f`
+
+type publishParams struct {
+	Branch  string `json:"branch"`
+	Message string `json:"message"`
+	// Remote is the remote to push to, origin if empty.
+	Remote string `json:"remote,omitempty"`
+	// Token and Username are credentials forwarded by the caller. Without a
+	// token the push uses the credentials configured in the workspace.
+	Token       string `json:"token,omitempty"`
+	Username    string `json:"username,omitempty"`
+	AuthorName  string `json:"author_name,omitempty"`
+	AuthorEmail string `json:"author_email,omitempty"`
+	Workdir     string `json:"workdir,omitempty"`
+}
+
+type publishOutput struct {
+	RemoteURL string `json:"remote_url"`
+	Branch    string `json:"branch"`
+	// CurrentBranch is the branch checked out before publishing, empty if
+	// HEAD was detached. DefaultBranch is the remote's HEAD, if known.
+	CurrentBranch string   `json:"current_branch,omitempty"`
+	DefaultBranch string   `json:"default_branch,omitempty"`
+	Commit        string   `json:"commit"`
+	Committed     bool     `json:"committed"`
+	Files         []string `json:"files,omitempty"`
+}
+
+// PublishCommandHandler commits the changes of the working tree to a branch
+// and pushes it, so a pull request can be opened for it.
+func PublishCommandHandler(workdir string) CommandHandler {
+	return func(ctx context.Context, params json.RawMessage) (interface{}, error) {
+		var p publishParams
+		if err := json.Unmarshal(params, &p); err != nil {
+			return nil, fmt.Errorf("invalid publish parameters: %w", err)
+		}
+		if p.Message == "" {
+			return nil, errors.New("commit message is required")
+		}
+		if p.Remote == "" {
+			p.Remote = "origin"
+		}
+		if p.Username == "" {
+			p.Username = "x-access-token"
+		}
+
+		repo, err := repositoryRoot(ctx, p.Workdir, workdir)
+		if err != nil {
+			return nil, err
+		}
+		if p.Branch == "" || strings.HasPrefix(p.Branch, "-") {
+			return nil, fmt.Errorf("invalid branch %q", p.Branch)
+		}
+		if _, err := runGit(ctx, repo, nil, nil, "check-ref-format", "--branch", p.Branch); err != nil {
+			return nil, fmt.Errorf("invalid branch %q", p.Branch)
+		}
+		remoteURL, err := runGit(ctx, repo, nil, nil, "remote", "get-url", p.Remote)
+		if err != nil {
+			return nil, fmt.Errorf("unknown remote %q", p.Remote)
+		}
+
+		output := &publishOutput{RemoteURL: remoteURL, Branch: p.Branch}
+		if current, err := runGit(ctx, repo, nil, nil, "symbolic-ref", "--quiet", "--short", "HEAD"); err == nil {
+			output.CurrentBranch = current
+		}
+		if head, err := runGit(ctx, repo, nil, nil, "symbolic-ref", "--quiet", "--short", "refs/remotes/"+p.Remote+"/HEAD"); err == nil {
+			output.DefaultBranch = strings.TrimPrefix(head, p.Remote+"/")
+		}
+
+		if output.CurrentBranch != p.Branch {
+			if _, err := runGit(ctx, repo, nil, nil, "checkout", "-B", p.Branch); err != nil {
+				return nil, err
+			}
+		}
+		if _, err := runGit(ctx, repo, nil, nil, "add", "--all", "--", "."); err != nil {
+			return nil, err
+		}
+		staged, err := runGit(ctx, repo, nil, nil, "diff", "--cached", "--name-only", "-z")
+		if err != nil {
+			return nil, err
+		}
+		for _, file := range strings.Split(staged, "\x00") {
+			if file != "" {
+				output.Files = append(output.Files, file)
+			}
+		}
+		if len(output.Files) > 0 {
+			if _, err := runGit(ctx, repo, publishAuthor(ctx, repo, p), nil, "commit", "--quiet", "--no-verify", "-m", p.Message); err != nil {
+				return nil, err
+			}
+			output.Committed = true
+		}
+		if output.Commit, err = runGit(ctx, repo, nil, nil, "rev-parse", "HEAD"); err != nil {
+			return nil, err
+		}
+
+		args := []string{"push", "--quiet", "--set-upstream", p.Remote, "HEAD:refs/heads/" + p.Branch}
+		env := []string{"GIT_TERMINAL_PROMPT=0"}
+		if p.Token != "" {
+			args = append([]string{"-c", "credential.helper=", "-c", "credential.helper=" + publishCredentialHelper}, args...)
+			env = append(env, "KLED_PUBLISH_USERNAME="+p.Username, "KLED_PUBLISH_TOKEN="+p.Token)
+		}
+		if _, err := runGit(ctx, repo, env, nil, args...); err != nil {
+			return nil, err
+		}
+		return output, nil
+	}
+}
+
+// publishAuthor returns the environment setting the author of the commit.
+// The caller's identity wins over the one configured in the workspace, and
+// workspaces without one commit as kled.
+func publishAuthor(ctx context.Context, repo string, p publishParams) []string {
+	name, email := p.AuthorName, p.AuthorEmail
+	if name == "" || email == "" {
+		if configured, err := runGit(ctx, repo, nil, nil, "config", "user.email"); err == nil && configured != "" {
+			return nil
+		}
+		name, email = "kled", "kled@localhost"
+	}
+	return []string{
+		"GIT_AUTHOR_NAME=" + name, "GIT_AUTHOR_EMAIL=" + email,
+		"GIT_COMMITTER_NAME=" + name, "GIT_COMMITTER_EMAIL=" + email,
+	}
+}
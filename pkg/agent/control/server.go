@@ -0,0 +1,132 @@
+package control
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"net"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/loft-sh/devpod/pkg/version"
+	"github.com/loft-sh/log"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	// DefaultPort is the port the control channel listens on inside the
+	// workspace.
+	DefaultPort = 12049
+
+	// AuthorizationHeader carries the bearer token of the control channel
+	AuthorizationHeader = "authorization"
+)
+
+// NewToken returns a random token for the control channel.
+func NewToken() (string, error) {
+	token := make([]byte, 32)
+	_, err := rand.Read(token)
+	if err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(token), nil
+}
+
+// NewServer creates the control server. Requests need to present token, an
+// empty token disables authentication. Relative paths and commands without
+// a working directory resolve against workdir.
+func NewServer(token, workdir string, log log.Logger) *Server {
+	return &Server{
+		token:   token,
+		workdir: workdir,
+		started: time.Now(),
+		log:     log,
+	}
+}
+
+type Server struct {
+	UnimplementedControlServer
+
+	token   string
+	workdir string
+	started time.Time
+	log     log.Logger
+
+	// port is the port of the control channel itself
+	port int
+}
+
+// Serve serves the control channel on lis until ctx is done.
+func (s *Server) Serve(ctx context.Context, lis net.Listener) error {
+	if addr, ok := lis.Addr().(*net.TCPAddr); ok {
+		s.port = addr.Port
+	}
+
+	grpcServer := grpc.NewServer(
+		grpc.UnaryInterceptor(func(ctx context.Context, req interface{}, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+			if err := s.authorize(ctx); err != nil {
+				return nil, err
+			}
+			return handler(ctx, req)
+		}),
+		grpc.StreamInterceptor(func(srv interface{}, stream grpc.ServerStream, _ *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+			if err := s.authorize(stream.Context()); err != nil {
+				return err
+			}
+			return handler(srv, stream)
+		}),
+	)
+	RegisterControlServer(grpcServer, s)
+
+	go func() {
+		<-ctx.Done()
+		grpcServer.Stop()
+	}()
+
+	err := grpcServer.Serve(lis)
+	if err != nil && !errors.Is(err, grpc.ErrServerStopped) {
+		return err
+	}
+	return nil
+}
+
+func (s *Server) authorize(ctx context.Context) error {
+	if s.token == "" {
+		return nil
+	}
+
+	md, _ := metadata.FromIncomingContext(ctx)
+	for _, value := range md.Get(AuthorizationHeader) {
+		token := strings.TrimPrefix(value, "Bearer ")
+		if subtle.ConstantTimeCompare([]byte(token), []byte(s.token)) == 1 {
+			return nil
+		}
+	}
+
+	return status.Error(codes.Unauthenticated, "invalid control token")
+}
+
+func (s *Server) Health(ctx context.Context, _ *HealthRequest) (*HealthResponse, error) {
+	hostname, _ := os.Hostname()
+	return &HealthResponse{
+		Version:       version.GetVersion(),
+		Hostname:      hostname,
+		UptimeSeconds: int64(time.Since(s.started).Seconds()),
+	}, nil
+}
+
+func (s *Server) Metrics(ctx context.Context, _ *MetricsRequest) (*MetricsResponse, error) {
+	metrics, err := collectMetrics(s.workdir)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "collect metrics: %v", err)
+	}
+
+	return metrics, nil
+}
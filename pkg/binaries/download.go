@@ -21,6 +21,11 @@ import (
 )
 
 func ToEnvironmentWithBinaries(context string, workspace *provider2.Workspace, machine *provider2.Machine, options map[string]config.OptionValue, config *provider2.ProviderConfig, extraEnv map[string]string, log log.Logger) ([]string, error) {
+	// provider commands without workspace or machine, e.g. init, still need the base environment
+	if workspace == nil && machine == nil {
+		extraEnv = provider2.Merge(provider2.GetBaseEnvironment(context, config.Name), extraEnv)
+	}
+
 	environ := provider2.ToEnvironment(workspace, machine, options, extraEnv)
 	binariesMap, err := GetBinaries(context, config)
 	if err != nil {
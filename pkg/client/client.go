@@ -9,6 +9,7 @@ import (
 	"github.com/loft-sh/api/v4/pkg/devpod"
 	"github.com/loft-sh/devpod/pkg/devcontainer/config"
 	"github.com/loft-sh/devpod/pkg/provider"
+	"github.com/loft-sh/devpod/pkg/workspacestate"
 	"golang.org/x/crypto/ssh"
 )
 
@@ -211,6 +212,14 @@ type WorkspaceStatus struct {
 	Context  string `json:"context,omitempty"`
 	Provider string `json:"provider,omitempty"`
 	State    string `json:"state,omitempty"`
+
+	// LifecycleHooks are the results of the devcontainer lifecycle commands
+	// of the last start
+	LifecycleHooks []config.LifecycleHookResult `json:"lifecycleHooks,omitempty"`
+
+	// Lifecycle is the recorded phase of the workspace including the last
+	// transitions and the failed step when in Error
+	Lifecycle *workspacestate.State `json:"lifecycle,omitempty"`
 }
 
 type User struct {
@@ -19,7 +19,10 @@ import (
 	"github.com/loft-sh/devpod/pkg/compress"
 	"github.com/loft-sh/devpod/pkg/config"
 	config2 "github.com/loft-sh/devpod/pkg/devcontainer/config"
+	"github.com/loft-sh/devpod/pkg/devcontainer/policy"
+	"github.com/loft-sh/devpod/pkg/imagescan"
 	"github.com/loft-sh/devpod/pkg/options"
+	"github.com/loft-sh/devpod/pkg/outbound"
 	"github.com/loft-sh/devpod/pkg/provider"
 	"github.com/loft-sh/devpod/pkg/shell"
 	"github.com/loft-sh/devpod/pkg/ssh"
@@ -158,6 +161,20 @@ func (s *workspaceClient) AgentInfo(cliOptions provider.CLIOptions) (string, *pr
 func (s *workspaceClient) compressedAgentInfo(cliOptions provider.CLIOptions) (string, *provider.AgentWorkspaceInfo, error) {
 	agentInfo := s.agentInfo(cliOptions)
 
+	// load the devcontainer policy, it's evaluated by the agent
+	devContainerPolicy, err := policy.Load(s.kledConfig.ContextOption(config.ContextOptionDevContainerPolicy))
+	if err != nil {
+		return "", nil, err
+	}
+	agentInfo.DevContainerPolicy = devContainerPolicy
+
+	// pass proxy and CA bundle, the agent might run on another machine
+	outboundOptions, err := outbound.FromContext(s.kledConfig)
+	if err != nil {
+		return "", nil, err
+	}
+	agentInfo.Outbound = outboundOptions
+
 	// marshal config
 	out, err := json.Marshal(agentInfo)
 	if err != nil {
@@ -223,6 +240,16 @@ func (s *workspaceClient) agentInfo(cliOptions provider.CLIOptions) *provider.Ag
 	// Set registry cache from context option
 	agentInfo.RegistryCache = s.kledConfig.ContextOption(config.ContextOptionRegistryCache)
 
+	// Set image scanning from context options
+	agentInfo.ImageScan = imagescan.Options{
+		Mode:     imagescan.Mode(s.kledConfig.ContextOption(config.ContextOptionImageScan)),
+		Severity: imagescan.Severity(s.kledConfig.ContextOption(config.ContextOptionImageScanSeverity)),
+		Server:   s.kledConfig.ContextOption(config.ContextOptionImageScanServer),
+	}
+
+	// Set offline mode from context option
+	agentInfo.Offline = s.kledConfig.ContextOption(config.ContextOptionOffline) == "true"
+
 	return agentInfo
 }
 
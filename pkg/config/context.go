@@ -17,11 +17,23 @@ const (
 	ContextOptionAgentURL                   = "AGENT_URL"
 	ContextOptionDotfilesURL                = "DOTFILES_URL"
 	ContextOptionDotfilesScript             = "DOTFILES_SCRIPT"
+	ContextOptionHostTimezoneLocale         = "HOST_TIMEZONE_LOCALE"
 	ContextOptionSSHAgentForwarding         = "SSH_AGENT_FORWARDING"
 	ContextOptionSSHConfigPath              = "SSH_CONFIG_PATH"
 	ContextOptionAgentInjectTimeout         = "AGENT_INJECT_TIMEOUT"
 	ContextOptionRegistryCache              = "REGISTRY_CACHE"
 	ContextOptionSSHStrictHostKeyChecking   = "SSH_STRICT_HOST_KEY_CHECKING"
+	ContextOptionPublicPorts                = "PUBLIC_PORTS"
+	ContextOptionMachineMaxWorkspaces       = "MACHINE_MAX_WORKSPACES"
+	ContextOptionImageScan                  = "IMAGE_SCAN"
+	ContextOptionImageScanSeverity          = "IMAGE_SCAN_SEVERITY"
+	ContextOptionImageScanServer            = "IMAGE_SCAN_SERVER"
+	ContextOptionDevContainerPolicy         = "DEVCONTAINER_POLICY"
+	ContextOptionOffline                    = "OFFLINE"
+	ContextOptionHTTPProxy                  = "HTTP_PROXY"
+	ContextOptionHTTPSProxy                 = "HTTPS_PROXY"
+	ContextOptionNoProxy                    = "NO_PROXY"
+	ContextOptionCABundle                   = "CA_BUNDLE"
 )
 
 var ContextOptions = []ContextOption{
@@ -85,6 +97,12 @@ var ContextOptions = []ContextOption{
 		Name:        ContextOptionDotfilesScript,
 		Description: "Specifies the script to run after cloning dotfiles repo to install them",
 	},
+	{
+		Name:        ContextOptionHostTimezoneLocale,
+		Description: "Specifies if workspaces get the timezone and locale of the host as TZ and LANG",
+		Default:     "true",
+		Enum:        []string{"true", "false"},
+	},
 	{
 		Name:        ContextOptionSSHConfigPath,
 		Description: "Specifies the path where the ssh config should be written to",
@@ -105,6 +123,59 @@ var ContextOptions = []ContextOption{
 		Default:     "false",
 		Enum:        []string{"true", "false"},
 	},
+	{
+		Name:        ContextOptionPublicPorts,
+		Description: "Specifies if forwarded workspace ports are bound on all interfaces instead of localhost only",
+		Default:     "false",
+		Enum:        []string{"true", "false"},
+	},
+	{
+		Name:        ContextOptionMachineMaxWorkspaces,
+		Description: "Specifies how many workspaces a new machine hosts. With more than one, new workspaces are packed onto existing machines and a machine is deleted with its last workspace",
+		Default:     "1",
+	},
+	{
+		Name:        ContextOptionImageScan,
+		Description: "Specifies if workspace images are scanned for vulnerabilities with trivy before the workspace starts. warn reports findings, block refuses to start the workspace",
+		Default:     "off",
+		Enum:        []string{"off", "warn", "block"},
+	},
+	{
+		Name:        ContextOptionImageScanSeverity,
+		Description: "Specifies the lowest severity of vulnerabilities that are reported or block the workspace",
+		Default:     "CRITICAL",
+		Enum:        []string{"UNKNOWN", "LOW", "MEDIUM", "HIGH", "CRITICAL"},
+	},
+	{
+		Name:        ContextOptionImageScanServer,
+		Description: "Specifies the address of a trivy server to scan images with instead of a local vulnerability database",
+	},
+	{
+		Name:        ContextOptionDevContainerPolicy,
+		Description: "Specifies the path to a policy file the devcontainer configuration of new workspaces is validated against, e.g. to forbid privileged containers or restrict images to approved registries",
+	},
+	{
+		Name:        ContextOptionOffline,
+		Description: "Specifies if images, features and templates are only resolved from the local content store populated with kled bundle import",
+		Default:     "false",
+		Enum:        []string{"true", "false"},
+	},
+	{
+		Name:        ContextOptionHTTPProxy,
+		Description: "Specifies the proxy for outbound HTTP connections of kled and its agents, defaults to the HTTP_PROXY environment variable",
+	},
+	{
+		Name:        ContextOptionHTTPSProxy,
+		Description: "Specifies the proxy for outbound HTTPS connections of kled and its agents, defaults to the HTTPS_PROXY environment variable",
+	},
+	{
+		Name:        ContextOptionNoProxy,
+		Description: "Specifies a comma separated list of hosts that are connected to without a proxy, defaults to the NO_PROXY environment variable",
+	},
+	{
+		Name:        ContextOptionCABundle,
+		Description: "Specifies the path to a PEM file with additional certificate authorities kled and its agents trust, e.g. of a TLS intercepting proxy or a private registry",
+	},
 }
 
 func MergeContextOptions(contextConfig *ContextConfig, environ []string) {
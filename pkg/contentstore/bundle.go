@@ -0,0 +1,44 @@
+package contentstore
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/loft-sh/devpod/pkg/extract"
+)
+
+// WriteBundle writes the whole store as a gzipped tar archive that can be
+// imported on a machine without network access
+func (s *Store) WriteBundle(writer io.Writer) error {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	err := extract.WriteTar(writer, s.Dir, true)
+	if err != nil {
+		return fmt.Errorf("write bundle: %w", err)
+	}
+
+	return nil
+}
+
+// ImportBundle merges a bundle written by WriteBundle into the store
+func (s *Store) ImportBundle(reader io.Reader) error {
+	tempDir, err := os.MkdirTemp("", "kled-bundle-*")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tempDir)
+
+	err = extract.Extract(reader, tempDir)
+	if err != nil {
+		return fmt.Errorf("extract bundle: %w", err)
+	}
+
+	bundle, err := Open(tempDir)
+	if err != nil {
+		return err
+	}
+
+	return s.Merge(bundle)
+}
@@ -0,0 +1,330 @@
+package contentstore
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"sync"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/layout"
+	"github.com/google/go-containerregistry/pkg/v1/match"
+	"github.com/google/go-containerregistry/pkg/v1/tarball"
+	"github.com/loft-sh/devpod/pkg/config"
+)
+
+const (
+	// OfflineEnv enables offline mode, images, features and templates are
+	// then only resolved from the content store
+	OfflineEnv = "KLED_OFFLINE"
+
+	// DirEnv overrides the location of the content store
+	DirEnv = "KLED_CONTENT_STORE"
+
+	refAnnotation = "org.opencontainers.image.ref.name"
+	filesIndex    = "index.json"
+)
+
+// ErrNotFound is returned if content is missing from the store
+var ErrNotFound = errors.New("not found in content store")
+
+// Offline returns true if kled should not reach out to registries or
+// download anything
+func Offline() bool {
+	offline, _ := strconv.ParseBool(os.Getenv(OfflineEnv))
+	return offline
+}
+
+// Store holds images and OCI features in an OCI image layout below images/
+// and downloaded archives, like url features and templates, below files/.
+type Store struct {
+	Dir string
+
+	m sync.Mutex
+}
+
+// Default opens the content store in the kled config dir or at KLED_CONTENT_STORE
+func Default() (*Store, error) {
+	dir := os.Getenv(DirEnv)
+	if dir == "" {
+		configDir, err := config.GetConfigDir()
+		if err != nil {
+			return nil, err
+		}
+
+		dir = filepath.Join(configDir, "content")
+	}
+
+	return Open(dir)
+}
+
+// Open opens the content store at dir and initializes it if it's empty
+func Open(dir string) (*Store, error) {
+	store := &Store{Dir: dir}
+	err := os.MkdirAll(store.filesDir(), 0755)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = layout.FromPath(store.imagesDir())
+	if err != nil {
+		_, err = layout.Write(store.imagesDir(), empty.Index)
+		if err != nil {
+			return nil, fmt.Errorf("initialize content store: %w", err)
+		}
+	}
+
+	return store, nil
+}
+
+func (s *Store) imagesDir() string {
+	return filepath.Join(s.Dir, "images")
+}
+
+func (s *Store) filesDir() string {
+	return filepath.Join(s.Dir, "files")
+}
+
+// normalizeRef makes ubuntu:22.04 and docker.io/library/ubuntu:22.04 the same entry
+func normalizeRef(ref string) (string, error) {
+	parsed, err := name.ParseReference(ref)
+	if err != nil {
+		return "", err
+	}
+
+	return parsed.Name(), nil
+}
+
+// AddImage adds img to the store, replacing an image with the same reference
+func (s *Store) AddImage(ref string, img v1.Image) error {
+	normalized, err := normalizeRef(ref)
+	if err != nil {
+		return err
+	}
+
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	path, err := layout.FromPath(s.imagesDir())
+	if err != nil {
+		return err
+	}
+
+	err = path.ReplaceImage(img, match.Annotation(refAnnotation, normalized), layout.WithAnnotations(map[string]string{
+		refAnnotation: normalized,
+	}))
+	if err != nil {
+		return fmt.Errorf("add image %s to content store: %w", ref, err)
+	}
+
+	return nil
+}
+
+// Image returns the image stored for ref
+func (s *Store) Image(ref string) (v1.Image, error) {
+	normalized, err := normalizeRef(ref)
+	if err != nil {
+		return nil, err
+	}
+
+	path, err := layout.FromPath(s.imagesDir())
+	if err != nil {
+		return nil, err
+	}
+	index, err := path.ImageIndex()
+	if err != nil {
+		return nil, err
+	}
+	manifest, err := index.IndexManifest()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, descriptor := range manifest.Manifests {
+		if descriptor.Annotations[refAnnotation] == normalized {
+			return index.Image(descriptor.Digest)
+		}
+	}
+
+	return nil, fmt.Errorf("image %s: %w", ref, ErrNotFound)
+}
+
+// Images returns the references of all stored images and OCI features
+func (s *Store) Images() ([]string, error) {
+	path, err := layout.FromPath(s.imagesDir())
+	if err != nil {
+		return nil, err
+	}
+	index, err := path.ImageIndex()
+	if err != nil {
+		return nil, err
+	}
+	manifest, err := index.IndexManifest()
+	if err != nil {
+		return nil, err
+	}
+
+	refs := []string{}
+	for _, descriptor := range manifest.Manifests {
+		if ref := descriptor.Annotations[refAnnotation]; ref != "" {
+			refs = append(refs, ref)
+		}
+	}
+	sort.Strings(refs)
+	return refs, nil
+}
+
+// DockerArchive streams the image stored for ref as an archive docker load
+// and nerdctl load understand
+func (s *Store) DockerArchive(ref string) (io.ReadCloser, error) {
+	img, err := s.Image(ref)
+	if err != nil {
+		return nil, err
+	}
+	parsed, err := name.ParseReference(ref)
+	if err != nil {
+		return nil, err
+	}
+
+	reader, writer := io.Pipe()
+	go func() {
+		_ = writer.CloseWithError(tarball.Write(parsed, img, writer))
+	}()
+
+	return reader, nil
+}
+
+// AddFile stores the content of reader for source, e.g. the url of a feature
+// or a template repository
+func (s *Store) AddFile(source string, reader io.Reader) error {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	index, err := s.readFilesIndex()
+	if err != nil {
+		return err
+	}
+
+	hash := sha256.Sum256([]byte(source))
+	fileName := hex.EncodeToString(hash[:]) + ".tgz"
+	file, err := os.Create(filepath.Join(s.filesDir(), fileName))
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	_, err = io.Copy(file, reader)
+	if err != nil {
+		return fmt.Errorf("add %s to content store: %w", source, err)
+	}
+
+	index[source] = fileName
+	return s.writeFilesIndex(index)
+}
+
+// File opens the content stored for source
+func (s *Store) File(source string) (io.ReadCloser, error) {
+	index, err := s.readFilesIndex()
+	if err != nil {
+		return nil, err
+	}
+
+	fileName, ok := index[source]
+	if !ok {
+		return nil, fmt.Errorf("%s: %w", source, ErrNotFound)
+	}
+
+	return os.Open(filepath.Join(s.filesDir(), fileName))
+}
+
+// Files returns the sources of all stored files
+func (s *Store) Files() ([]string, error) {
+	index, err := s.readFilesIndex()
+	if err != nil {
+		return nil, err
+	}
+
+	sources := []string{}
+	for source := range index {
+		sources = append(sources, source)
+	}
+	sort.Strings(sources)
+	return sources, nil
+}
+
+// Merge copies all images and files from other into the store
+func (s *Store) Merge(other *Store) error {
+	refs, err := other.Images()
+	if err != nil {
+		return err
+	}
+	for _, ref := range refs {
+		img, err := other.Image(ref)
+		if err != nil {
+			return err
+		}
+
+		err = s.AddImage(ref, img)
+		if err != nil {
+			return err
+		}
+	}
+
+	sources, err := other.Files()
+	if err != nil {
+		return err
+	}
+	for _, source := range sources {
+		err = s.mergeFile(other, source)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s *Store) mergeFile(other *Store, source string) error {
+	reader, err := other.File(source)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	return s.AddFile(source, reader)
+}
+
+func (s *Store) readFilesIndex() (map[string]string, error) {
+	index := map[string]string{}
+	out, err := os.ReadFile(filepath.Join(s.filesDir(), filesIndex))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return index, nil
+		}
+		return nil, err
+	}
+
+	err = json.Unmarshal(out, &index)
+	if err != nil {
+		return nil, fmt.Errorf("parse content store index: %w", err)
+	}
+	return index, nil
+}
+
+func (s *Store) writeFilesIndex(index map[string]string) error {
+	out, err := json.MarshalIndent(index, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(filepath.Join(s.filesDir(), filesIndex), out, 0644)
+}
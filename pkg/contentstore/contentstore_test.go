@@ -0,0 +1,82 @@
+package contentstore
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"gotest.tools/assert"
+)
+
+func TestOffline(t *testing.T) {
+	t.Setenv(OfflineEnv, "")
+	assert.Assert(t, !Offline())
+	t.Setenv(OfflineEnv, "true")
+	assert.Assert(t, Offline())
+}
+
+func TestStore(t *testing.T) {
+	store, err := Open(t.TempDir())
+	assert.NilError(t, err)
+
+	img, err := random.Image(256, 1)
+	assert.NilError(t, err)
+	assert.NilError(t, store.AddImage("ubuntu:22.04", img))
+	assert.NilError(t, store.AddImage("docker.io/library/ubuntu:22.04", img))
+
+	refs, err := store.Images()
+	assert.NilError(t, err)
+	assert.DeepEqual(t, refs, []string{"index.docker.io/library/ubuntu:22.04"})
+
+	stored, err := store.Image("ubuntu:22.04")
+	assert.NilError(t, err)
+	digest, err := img.Digest()
+	assert.NilError(t, err)
+	storedDigest, err := stored.Digest()
+	assert.NilError(t, err)
+	assert.Equal(t, storedDigest, digest)
+
+	_, err = store.Image("alpine")
+	assert.Assert(t, errors.Is(err, ErrNotFound))
+
+	source := "https://example.com/devcontainer-feature-go.tgz"
+	assert.NilError(t, store.AddFile(source, strings.NewReader("feature")))
+	reader, err := store.File(source)
+	assert.NilError(t, err)
+	content, err := io.ReadAll(reader)
+	assert.NilError(t, err)
+	assert.NilError(t, reader.Close())
+	assert.Equal(t, string(content), "feature")
+
+	_, err = store.File("github.com/my-org/templates")
+	assert.Assert(t, errors.Is(err, ErrNotFound))
+}
+
+func TestBundle(t *testing.T) {
+	source, err := Open(t.TempDir())
+	assert.NilError(t, err)
+
+	img, err := random.Image(256, 2)
+	assert.NilError(t, err)
+	assert.NilError(t, source.AddImage("ghcr.io/devcontainers/features/go:1", img))
+	assert.NilError(t, source.AddFile("github.com/my-org/templates", strings.NewReader("template")))
+
+	bundle := &bytes.Buffer{}
+	assert.NilError(t, source.WriteBundle(bundle))
+
+	target, err := Open(t.TempDir())
+	assert.NilError(t, err)
+	assert.NilError(t, target.AddFile("https://example.com/devcontainer-feature-go.tgz", strings.NewReader("feature")))
+	assert.NilError(t, target.ImportBundle(bundle))
+
+	refs, err := target.Images()
+	assert.NilError(t, err)
+	assert.DeepEqual(t, refs, []string{"ghcr.io/devcontainers/features/go:1"})
+
+	files, err := target.Files()
+	assert.NilError(t, err)
+	assert.DeepEqual(t, files, []string{"github.com/my-org/templates", "https://example.com/devcontainer-feature-go.tgz"})
+}
@@ -11,6 +11,7 @@ import (
 	"runtime"
 
 	"github.com/loft-sh/api/v4/pkg/devpod"
+	"github.com/loft-sh/devpod/pkg/agent/control"
 	"github.com/loft-sh/devpod/pkg/devcontainer/config"
 	provider2 "github.com/loft-sh/devpod/pkg/provider"
 	"github.com/loft-sh/devpod/pkg/single"
@@ -24,12 +25,37 @@ type SshConfig struct {
 	User    string `json:"user,omitempty"`
 }
 
+// ControlConfig configures the gRPC control channel of the daemon
+type ControlConfig struct {
+	Address string `json:"address,omitempty"`
+	Token   string `json:"token,omitempty"`
+}
+
+// HeartbeatConfig configures the heartbeats the daemon sends to the backend
+type HeartbeatConfig struct {
+	Address      string `json:"address,omitempty"`
+	Token        string `json:"token,omitempty"`
+	Interval     string `json:"interval,omitempty"`
+	WorkspaceID  string `json:"workspaceId,omitempty"`
+	WorkspaceUID string `json:"workspaceUid,omitempty"`
+}
+
 type DaemonConfig struct {
-	Platform devpod.PlatformOptions `json:"platform,omitempty"`
-	Ssh      SshConfig              `json:"ssh,omitempty"`
-	Timeout  string                 `json:"timeout"`
+	Platform  devpod.PlatformOptions `json:"platform,omitempty"`
+	Ssh       SshConfig              `json:"ssh,omitempty"`
+	Control   ControlConfig          `json:"control,omitempty"`
+	Heartbeat HeartbeatConfig        `json:"heartbeat,omitempty"`
+	Timeout   string                 `json:"timeout"`
 }
 
+const (
+	// HeartbeatAddressEnv holds the gRPC address of the backend the daemon
+	// sends heartbeats to. Without it no heartbeats are sent.
+	HeartbeatAddressEnv = "KLED_HEARTBEAT_ADDRESS"
+	// HeartbeatTokenEnv holds the token presented to the heartbeat endpoint
+	HeartbeatTokenEnv = "KLED_HEARTBEAT_TOKEN"
+)
+
 func BuildDaemonConfig(platformOptions devpod.PlatformOptions, workspaceConfig *provider2.Workspace, substitutionContext *config.SubstitutionContext, mergedConfig *config.MergedDevContainerConfig) (*DaemonConfig, error) {
 	var workdir string
 	if workspaceConfig.Source.GitSubPath != "" {
@@ -49,12 +75,29 @@ func BuildDaemonConfig(platformOptions devpod.PlatformOptions, workspaceConfig *
 		user = "root"
 	}
 
+	controlToken, err := control.NewToken()
+	if err != nil {
+		return nil, perrors.Wrap(err, "create control token")
+	}
+
 	daemonConfig := &DaemonConfig{
 		Platform: platformOptions,
 		Ssh: SshConfig{
 			Workdir: workdir,
 			User:    user,
 		},
+		Control: ControlConfig{
+			Address: fmt.Sprintf(":%d", control.DefaultPort),
+			Token:   controlToken,
+		},
+	}
+	if address := os.Getenv(HeartbeatAddressEnv); address != "" {
+		daemonConfig.Heartbeat = HeartbeatConfig{
+			Address:      address,
+			Token:        os.Getenv(HeartbeatTokenEnv),
+			WorkspaceID:  workspaceConfig.ID,
+			WorkspaceUID: workspaceConfig.UID,
+		}
 	}
 
 	return daemonConfig, nil
@@ -0,0 +1,131 @@
+package debugbundle
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"regexp"
+	"time"
+)
+
+var pemEnd = regexp.MustCompile(`-----END [A-Z ]*PRIVATE KEY-----`)
+
+// Writer writes a gzipped tarball whose entries are redacted before they are
+// added, so that the bundle can be attached to a bug report as is.
+type Writer struct {
+	root string
+	now  time.Time
+
+	gw *gzip.Writer
+	tw *tar.Writer
+}
+
+// NewWriter returns a Writer that places all entries below root.
+func NewWriter(w io.Writer, root string) *Writer {
+	gw := gzip.NewWriter(w)
+	return &Writer{
+		root: root,
+		now:  time.Now(),
+		gw:   gw,
+		tw:   tar.NewWriter(gw),
+	}
+}
+
+// AddJSON adds v as indented JSON after redacting it.
+func (w *Writer) AddJSON(name string, v interface{}) error {
+	redacted, err := RedactValue(v)
+	if err != nil {
+		return fmt.Errorf("redact %s: %w", name, err)
+	}
+
+	out, err := json.MarshalIndent(redacted, "", "  ")
+	if err != nil {
+		return fmt.Errorf("marshal %s: %w", name, err)
+	}
+
+	return w.add(name, out)
+}
+
+// AddText adds free text, such as a log, after redacting it.
+func (w *Writer) AddText(name string, text []byte) error {
+	return w.add(name, []byte(RedactText(string(text))))
+}
+
+// AddFileTail adds at most the last maxBytes of the file at filePath as text.
+// A tail that starts within a line or a private key drops the partial part,
+// as the redaction of a key needs its BEGIN line.
+func (w *Writer) AddFileTail(name, filePath string, maxBytes int64) error {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	stat, err := f.Stat()
+	if err != nil {
+		return err
+	}
+
+	truncated := maxBytes > 0 && stat.Size() > maxBytes
+	if truncated {
+		_, err = f.Seek(stat.Size()-maxBytes, io.SeekStart)
+		if err != nil {
+			return err
+		}
+	}
+
+	out, err := io.ReadAll(f)
+	if err != nil {
+		return err
+	}
+	if truncated {
+		out = trimPartialStart(out)
+	}
+
+	return w.AddText(name, out)
+}
+
+// trimPartialStart drops the partial first line of a tail and, if the tail
+// starts within a private key, everything up to its END line.
+func trimPartialStart(out []byte) []byte {
+	if loc := pemEnd.FindIndex(out); loc != nil && !bytes.Contains(out[:loc[0]], []byte("-----BEGIN ")) {
+		return out[loc[1]:]
+	}
+	if i := bytes.IndexByte(out, '\n'); i >= 0 {
+		return out[i+1:]
+	}
+	return nil
+}
+
+func (w *Writer) add(name string, data []byte) error {
+	err := w.tw.WriteHeader(&tar.Header{
+		Name:    path.Join(w.root, name),
+		Mode:    0o644,
+		Size:    int64(len(data)),
+		ModTime: w.now,
+	})
+	if err != nil {
+		return fmt.Errorf("write header %s: %w", name, err)
+	}
+
+	_, err = w.tw.Write(data)
+	if err != nil {
+		return fmt.Errorf("write %s: %w", name, err)
+	}
+
+	return nil
+}
+
+// Close flushes the tarball. It does not close the underlying writer.
+func (w *Writer) Close() error {
+	if err := w.tw.Close(); err != nil {
+		return err
+	}
+
+	return w.gw.Close()
+}
@@ -0,0 +1,82 @@
+package debugbundle
+
+import (
+	"encoding/json"
+	"regexp"
+)
+
+// Redacted replaces every value removed from a bundle.
+const Redacted = "**REDACTED**"
+
+// sensitiveKey matches map keys whose string values are always removed,
+// e.g. provider options such as AWS_SECRET_ACCESS_KEY or GITHUB_TOKEN.
+var sensitiveKey = regexp.MustCompile(`(?i)(token|passw(or)?d|secret|credential|api[_-]?key|access[_-]?key|private[_-]?key|auth|cookie|session)`)
+
+// secretPatterns match secrets embedded in free text such as log lines.
+// Each pattern keeps its first group and replaces the rest of the match.
+var secretPatterns = []*regexp.Regexp{
+	regexp.MustCompile(`(?s)(-----BEGIN [A-Z ]*PRIVATE KEY-----).*?-----END [A-Z ]*PRIVATE KEY-----`),
+	regexp.MustCompile(`(?i)(bearer\s+)[A-Za-z0-9._~+/=-]+`),
+	regexp.MustCompile(`(?i)(basic\s+)[A-Za-z0-9+/=]{8,}`),
+	regexp.MustCompile(`([a-z][a-z0-9+.-]*://[^/\s:@]+:)[^/\s@]+(@)`),
+	regexp.MustCompile(`(?i)((?:token|passw(?:or)?d|secret|api[_-]?key|access[_-]?key|client[_-]?secret)["']?\s*[=:]\s*["']?)[^\s"'&,;]+`),
+	regexp.MustCompile(`()\b(?:AKIA|ASIA)[0-9A-Z]{16}\b`),
+	regexp.MustCompile(`()\bgh[pousr]_[A-Za-z0-9]{36,}\b`),
+	regexp.MustCompile(`()\bxox[abposr]-[A-Za-z0-9-]{10,}\b`),
+	regexp.MustCompile(`()\beyJ[A-Za-z0-9_-]{10,}\.[A-Za-z0-9_-]{10,}\.[A-Za-z0-9_-]+\b`),
+}
+
+// RedactText removes secrets from free text.
+func RedactText(text string) string {
+	for _, pattern := range secretPatterns {
+		text = pattern.ReplaceAllStringFunc(text, func(match string) string {
+			groups := pattern.FindStringSubmatch(match)
+			replacement := groups[1] + Redacted
+			// keep the separator of credentials in URLs
+			if len(groups) > 2 {
+				replacement += groups[2]
+			}
+			return replacement
+		})
+	}
+	return text
+}
+
+// RedactValue returns a copy of v, as decoded from its JSON form, with the
+// string values of sensitive keys removed and all other strings passed
+// through RedactText.
+func RedactValue(v interface{}) (interface{}, error) {
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+
+	var decoded interface{}
+	if err := json.Unmarshal(raw, &decoded); err != nil {
+		return nil, err
+	}
+
+	return redact(decoded, false), nil
+}
+
+func redact(v interface{}, sensitive bool) interface{} {
+	switch value := v.(type) {
+	case map[string]interface{}:
+		for key, child := range value {
+			value[key] = redact(child, sensitive || sensitiveKey.MatchString(key))
+		}
+		return value
+	case []interface{}:
+		for i, child := range value {
+			value[i] = redact(child, sensitive)
+		}
+		return value
+	case string:
+		if sensitive && value != "" {
+			return Redacted
+		}
+		return RedactText(value)
+	default:
+		return value
+	}
+}
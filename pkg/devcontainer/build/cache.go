@@ -0,0 +1,133 @@
+package build
+
+import (
+	"encoding/csv"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/loft-sh/devpod/pkg/util"
+)
+
+var cacheTypes = []string{"registry", "local", "inline", "gha", "s3", "azblob"}
+
+// NormalizeCacheOptions turns --cache-from and --cache-to values into buildx
+// cache entries. Besides the full buildx syntax (type=local,src=...) a value
+// can be a directory, which uses the local backend, or an image reference,
+// which uses the registry backend. Directories are made absolute so they can
+// be resolved by the agent.
+func NormalizeCacheOptions(values []string, export bool) ([]string, error) {
+	normalized := []string{}
+	for _, value := range values {
+		entry, err := normalizeCacheOption(value, export)
+		if err != nil {
+			return nil, err
+		}
+		normalized = append(normalized, entry)
+	}
+	return normalized, nil
+}
+
+func normalizeCacheOption(value string, export bool) (string, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return "", fmt.Errorf("cache option is empty")
+	}
+
+	// plain directory or image reference
+	if !strings.Contains(value, "=") {
+		if isCacheDir(value) {
+			dir, err := absCacheDir(value)
+			if err != nil {
+				return "", err
+			}
+			if export {
+				return "type=local,dest=" + dir + ",mode=max", nil
+			}
+			return "type=local,src=" + dir, nil
+		}
+
+		if export {
+			return "type=registry,ref=" + value + ",mode=max,image-manifest=true", nil
+		}
+		return "type=registry,ref=" + value, nil
+	}
+
+	fields, err := csv.NewReader(strings.NewReader(value)).Read()
+	if err != nil {
+		return "", fmt.Errorf("parse cache option %s: %w", value, err)
+	}
+
+	cacheType := ""
+	for i, field := range fields {
+		key, val, ok := strings.Cut(field, "=")
+		if !ok {
+			return "", fmt.Errorf("invalid cache option %s, expected key=value pairs", value)
+		}
+
+		switch strings.ToLower(key) {
+		case "type":
+			cacheType = val
+		case "src", "dest":
+			dir, err := absCacheDir(val)
+			if err != nil {
+				return "", err
+			}
+			fields[i] = key + "=" + dir
+		}
+	}
+	if cacheType == "" {
+		return "", fmt.Errorf("cache option %s is missing a type", value)
+	}
+	for _, t := range cacheTypes {
+		if t == cacheType {
+			return strings.Join(fields, ","), nil
+		}
+	}
+
+	return "", fmt.Errorf("unknown cache type %s, expected one of %s", cacheType, strings.Join(cacheTypes, ", "))
+}
+
+func isCacheDir(value string) bool {
+	if strings.HasPrefix(value, "/") || strings.HasPrefix(value, ".") || strings.HasPrefix(value, "~") || filepath.IsAbs(value) {
+		return true
+	}
+
+	stat, err := os.Stat(value)
+	return err == nil && stat.IsDir()
+}
+
+func absCacheDir(dir string) (string, error) {
+	if strings.HasPrefix(dir, "~") {
+		home, err := util.UserHomeDir()
+		if err != nil {
+			return "", err
+		}
+		dir = filepath.Join(home, strings.TrimPrefix(dir, "~"))
+	}
+
+	return filepath.Abs(dir)
+}
+
+// importableCache filters local cache imports that don't exist yet, which
+// is the case for the first build that exports to a directory.
+func importableCache(entries []string) []string {
+	importable := []string{}
+	for _, entry := range entries {
+		if strings.HasPrefix(entry, "type=local,") || strings.Contains(entry, ",type=local") {
+			src := ""
+			for _, field := range strings.Split(entry, ",") {
+				if strings.HasPrefix(field, "src=") {
+					src = strings.TrimPrefix(field, "src=")
+				}
+			}
+			if _, err := os.Stat(filepath.Join(src, "index.json")); err != nil {
+				continue
+			}
+		}
+
+		importable = append(importable, entry)
+	}
+	return importable
+}
@@ -0,0 +1,61 @@
+package build
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"gotest.tools/assert"
+)
+
+func TestNormalizeCacheOptions(t *testing.T) {
+	dir := t.TempDir()
+
+	from, err := NormalizeCacheOptions([]string{
+		"ghcr.io/my-org/cache:main",
+		dir,
+		"type=local,src=" + dir,
+		"type=gha,scope=devcontainer",
+	}, false)
+	assert.NilError(t, err)
+	assert.DeepEqual(t, from, []string{
+		"type=registry,ref=ghcr.io/my-org/cache:main",
+		"type=local,src=" + dir,
+		"type=local,src=" + dir,
+		"type=gha,scope=devcontainer",
+	})
+
+	to, err := NormalizeCacheOptions([]string{"ghcr.io/my-org/cache:main", dir}, true)
+	assert.NilError(t, err)
+	assert.DeepEqual(t, to, []string{
+		"type=registry,ref=ghcr.io/my-org/cache:main,mode=max,image-manifest=true",
+		"type=local,dest=" + dir + ",mode=max",
+	})
+
+	wd, err := os.Getwd()
+	assert.NilError(t, err)
+	from, err = NormalizeCacheOptions([]string{"./.cache"}, false)
+	assert.NilError(t, err)
+	assert.DeepEqual(t, from, []string{"type=local,src=" + filepath.Join(wd, ".cache")})
+
+	_, err = NormalizeCacheOptions([]string{"type=ftp,ref=x"}, false)
+	assert.ErrorContains(t, err, "unknown cache type")
+	_, err = NormalizeCacheOptions([]string{"ref=x"}, false)
+	assert.ErrorContains(t, err, "missing a type")
+}
+
+func TestImportableCache(t *testing.T) {
+	exported := t.TempDir()
+	assert.NilError(t, os.WriteFile(filepath.Join(exported, "index.json"), []byte("{}"), 0600))
+	missing := filepath.Join(t.TempDir(), "missing")
+
+	entries := importableCache([]string{
+		"type=registry,ref=ghcr.io/my-org/cache",
+		"type=local,src=" + exported,
+		"type=local,src=" + missing,
+	})
+	assert.DeepEqual(t, entries, []string{
+		"type=registry,ref=ghcr.io/my-org/cache",
+		"type=local,src=" + exported,
+	})
+}
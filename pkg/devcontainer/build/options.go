@@ -97,7 +97,19 @@ func NewOptions(
 		if options.ExportCache {
 			buildOptions.CacheTo = []string{fmt.Sprintf("type=registry,ref=%s,mode=max,image-manifest=true", options.RegistryCache)}
 		}
-	} else {
+	}
+
+	// cache from the devcontainer.json and --cache-from / --cache-to
+	cacheFrom, err := NormalizeCacheOptions(parsedConfig.Config.GetCacheFrom(), false)
+	if err != nil {
+		return nil, err
+	}
+	cacheFrom = append(cacheFrom, options.CacheFrom...)
+	buildOptions.CacheFrom = append(buildOptions.CacheFrom, importableCache(cacheFrom)...)
+	if options.ExportCache {
+		buildOptions.CacheTo = append(buildOptions.CacheTo, options.CacheTo...)
+	}
+	if options.RegistryCache == "" && len(buildOptions.CacheTo) == 0 {
 		buildOptions.BuildArgs["BUILDKIT_INLINE_CACHE"] = "1"
 	}
 
@@ -117,6 +117,10 @@ func (r *runner) runDockerCompose(
 	options UpOptions,
 	timeout time.Duration,
 ) (*config.Result, error) {
+	if r.WorkspaceConfig.Workspace.Network.Enabled() {
+		return nil, fmt.Errorf("network isolation is not supported for docker compose workspaces")
+	}
+
 	composeHelper, err := r.composeHelper()
 	if err != nil {
 		return nil, errors.Wrap(err, "find docker compose")
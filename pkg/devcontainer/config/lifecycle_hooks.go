@@ -0,0 +1,46 @@
+package config
+
+import "time"
+
+type LifecycleHookState string
+
+const (
+	LifecycleHookStateSucceeded LifecycleHookState = "Succeeded"
+	LifecycleHookStateFailed    LifecycleHookState = "Failed"
+	LifecycleHookStateSkipped   LifecycleHookState = "Skipped"
+)
+
+// LifecycleHookResult is the outcome of a single lifecycle command, e.g. one
+// named command of a postCreateCommand.
+type LifecycleHookResult struct {
+	// Hook is the devcontainer.json property, e.g. postCreateCommand
+	Hook string `json:"hook"`
+
+	// Name of the command if the hook is an object of named commands
+	Name string `json:"name,omitempty"`
+
+	// Command that was run
+	Command string `json:"command"`
+
+	State    LifecycleHookState `json:"state"`
+	Attempts int                `json:"attempts,omitempty"`
+	Error    string             `json:"error,omitempty"`
+
+	StartedAt  *time.Time `json:"startedAt,omitempty"`
+	FinishedAt *time.Time `json:"finishedAt,omitempty"`
+}
+
+// FailedLifecycleHook returns the first failed lifecycle command, if any.
+func FailedLifecycleHook(result *Result) *LifecycleHookResult {
+	if result == nil {
+		return nil
+	}
+
+	for i := range result.LifecycleHooks {
+		if result.LifecycleHooks[i].State == LifecycleHookStateFailed {
+			return &result.LifecycleHooks[i]
+		}
+	}
+
+	return nil
+}
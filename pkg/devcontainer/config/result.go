@@ -7,6 +7,7 @@ type Result struct {
 	MergedConfig               *MergedDevContainerConfig   `json:"MergedConfig"`
 	SubstitutionContext        *SubstitutionContext        `json:"SubstitutionContext"`
 	ContainerDetails           *ContainerDetails           `json:"ContainerDetails"`
+	LifecycleHooks             []LifecycleHookResult       `json:"LifecycleHooks,omitempty"`
 }
 
 type DevContainerConfigWithPath struct {
@@ -0,0 +1,127 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/loft-sh/devpod/pkg/types"
+)
+
+// Task is a command declared in customizations.kled.tasks of the
+// devcontainer.json, run by kled run. A task is either a command, as a
+// string run by the shell or an array run as is, or an object:
+//
+//	"tasks": {
+//	  "build": "make build",
+//	  "test": {"command": ["go", "test", "./..."], "dependsOn": ["build"], "env": {"CGO_ENABLED": "0"}},
+//	  "app": {"command": "npm start", "port": 3000}
+//	}
+type Task struct {
+	Command    types.StrArray    `json:"command,omitempty"`
+	WorkingDir string            `json:"workingDir,omitempty"`
+	Env        map[string]string `json:"env,omitempty"`
+	DependsOn  types.StrArray    `json:"dependsOn,omitempty"`
+
+	// Port is the port a long running task serves on, kled preview exposes it
+	Port int `json:"port,omitempty"`
+}
+
+func (t *Task) UnmarshalJSON(data []byte) error {
+	var command types.StrArray
+	if err := json.Unmarshal(data, &command); err == nil {
+		*t = Task{Command: command}
+		return nil
+	}
+
+	type task Task
+	parsed := task{}
+	if err := json.Unmarshal(data, &parsed); err != nil {
+		return err
+	}
+	*t = Task(parsed)
+	return nil
+}
+
+type taskCustomizations struct {
+	Tasks map[string]*Task `json:"tasks,omitempty"`
+}
+
+// GetTasks returns the tasks declared in the kled customizations, falling
+// back to the devpod ones.
+func GetTasks(parsedConfig *DevContainerConfig) (map[string]*Task, error) {
+	tasks := map[string]*Task{}
+	if parsedConfig == nil || parsedConfig.Customizations == nil {
+		return tasks, nil
+	}
+
+	for _, key := range []string{"devpod", "kled"} {
+		if parsedConfig.Customizations[key] == nil {
+			continue
+		}
+		customizations := &taskCustomizations{}
+		if err := Convert(parsedConfig.Customizations[key], customizations); err != nil {
+			return nil, fmt.Errorf("parse %s tasks: %w", key, err)
+		}
+		for name, task := range customizations.Tasks {
+			if task == nil || len(task.Command) == 0 {
+				return nil, fmt.Errorf("task %s has no command", name)
+			}
+			tasks[name] = task
+		}
+	}
+	return tasks, nil
+}
+
+// ResolveTasks orders the named tasks after the tasks they depend on. Every
+// task is listed once, before the first task depending on it.
+func ResolveTasks(tasks map[string]*Task, names []string) ([]string, error) {
+	ordered := []string{}
+	done := map[string]bool{}
+	visiting := map[string]bool{}
+
+	var visit func(name string, path []string) error
+	visit = func(name string, path []string) error {
+		if done[name] {
+			return nil
+		}
+		task, ok := tasks[name]
+		if !ok {
+			return fmt.Errorf("unknown task %s, declared tasks are: %s", name, taskNames(tasks))
+		}
+		if visiting[name] {
+			return fmt.Errorf("tasks depend on each other: %s", strings.Join(append(path, name), " -> "))
+		}
+
+		visiting[name] = true
+		for _, dependency := range task.DependsOn {
+			if err := visit(dependency, append(path, name)); err != nil {
+				return err
+			}
+		}
+		visiting[name] = false
+		done[name] = true
+		ordered = append(ordered, name)
+		return nil
+	}
+
+	for _, name := range names {
+		if err := visit(name, nil); err != nil {
+			return nil, err
+		}
+	}
+	return ordered, nil
+}
+
+func taskNames(tasks map[string]*Task) string {
+	if len(tasks) == 0 {
+		return "none"
+	}
+	names := make([]string, 0, len(tasks))
+	for name := range tasks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
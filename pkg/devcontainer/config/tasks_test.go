@@ -0,0 +1,49 @@
+package config
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestGetAndResolveTasks(t *testing.T) {
+	devContainer := &DevContainerConfig{}
+	err := json.Unmarshal([]byte(`{
+		"customizations": {
+			"devpod": {"tasks": {"lint": "golangci-lint run", "build": "echo old"}},
+			"kled": {"tasks": {
+				"build": "make build",
+				"generate": ["go", "generate", "./..."],
+				"test": {"command": "go test ./...", "dependsOn": ["generate", "build"], "env": {"CGO_ENABLED": "0"}},
+				"app": {"command": "npm start", "dependsOn": ["build"], "port": 3000}
+			}}
+		}
+	}`), devContainer)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tasks, err := GetTasks(devContainer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tasks) != 5 || tasks["build"].Command[0] != "make build" || len(tasks["generate"].Command) != 3 || tasks["test"].Env["CGO_ENABLED"] != "0" || tasks["app"].Port != 3000 {
+		t.Fatalf("unexpected tasks %+v", tasks)
+	}
+
+	ordered, err := ResolveTasks(tasks, []string{"build", "test", "lint"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(ordered, ","); got != "build,generate,test,lint" {
+		t.Fatalf("unexpected order %s", got)
+	}
+
+	if _, err := ResolveTasks(tasks, []string{"deploy"}); err == nil || !strings.Contains(err.Error(), "app, build, generate, lint, test") {
+		t.Fatalf("expected an unknown task error, got %v", err)
+	}
+	tasks["build"].DependsOn = []string{"test"}
+	if _, err := ResolveTasks(tasks, []string{"test"}); err == nil || !strings.Contains(err.Error(), "test -> build -> test") {
+		t.Fatalf("expected a cycle error, got %v", err)
+	}
+}
@@ -10,10 +10,8 @@ import (
 	"regexp"
 	"strings"
 
-	"github.com/google/go-containerregistry/pkg/authn"
-	"github.com/google/go-containerregistry/pkg/name"
 	v1 "github.com/google/go-containerregistry/pkg/v1"
-	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/loft-sh/devpod/pkg/contentstore"
 	"github.com/loft-sh/devpod/pkg/devcontainer/config"
 	"github.com/loft-sh/devpod/pkg/extract"
 	devpodhttp "github.com/loft-sh/devpod/pkg/http"
@@ -121,12 +119,7 @@ func processOCIFeature(id string, log log.Logger) (string, error) {
 		}
 	}
 
-	ref, err := name.ParseReference(id)
-	if err != nil {
-		return "", err
-	}
-
-	img, err := remote.Image(ref, remote.WithAuthFromKeychain(authn.DefaultKeychain))
+	img, err := getFeatureImage(id)
 	if err != nil {
 		return "", err
 	}
@@ -211,7 +204,11 @@ func processDirectTarFeature(id string, httpHeaders map[string]string, log log.L
 
 	// download feature tarball
 	downloadFile := filepath.Join(featureFolder, "feature.tgz")
-	err = downloadFeatureFromURL(id, downloadFile, httpHeaders, log)
+	if contentstore.Offline() {
+		err = copyFeatureFromStore(id, downloadFile)
+	} else {
+		err = downloadFeatureFromURL(id, downloadFile, httpHeaders, log)
+	}
 	if err != nil {
 		return "", err
 	}
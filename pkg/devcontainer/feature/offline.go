@@ -0,0 +1,109 @@
+package feature
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/loft-sh/devpod/pkg/contentstore"
+	"github.com/loft-sh/log"
+	"github.com/pkg/errors"
+)
+
+// getFeatureImage returns the OCI artifact of a feature from its registry or,
+// in offline mode, from the content store
+func getFeatureImage(id string) (v1.Image, error) {
+	if contentstore.Offline() {
+		store, err := contentstore.Default()
+		if err != nil {
+			return nil, err
+		}
+
+		img, err := store.Image(id)
+		if err != nil {
+			return nil, fmt.Errorf("offline mode: feature %w", err)
+		}
+		return img, nil
+	}
+
+	ref, err := name.ParseReference(id)
+	if err != nil {
+		return nil, err
+	}
+
+	return remote.Image(ref, remote.WithAuthFromKeychain(authn.DefaultKeychain))
+}
+
+func copyFeatureFromStore(id string, destFile string) error {
+	store, err := contentstore.Default()
+	if err != nil {
+		return err
+	}
+
+	reader, err := store.File(id)
+	if err != nil {
+		return fmt.Errorf("offline mode: feature %w", err)
+	}
+	defer reader.Close()
+
+	err = os.MkdirAll(filepath.Dir(destFile), 0755)
+	if err != nil {
+		return errors.Wrap(err, "create feature folder")
+	}
+
+	file, err := os.Create(destFile)
+	if err != nil {
+		return errors.Wrap(err, "create feature file")
+	}
+	defer file.Close()
+
+	_, err = io.Copy(file, reader)
+	return err
+}
+
+// Export adds the feature id to store, so it can be installed in offline mode.
+// Local features are part of the workspace and don't need to be exported.
+func Export(id string, store *contentstore.Store, httpHeaders map[string]string, log log.Logger) error {
+	if strings.HasPrefix(id, "./") || strings.HasPrefix(id, "../") {
+		return fmt.Errorf("local feature %s doesn't need to be exported", id)
+	}
+
+	if strings.HasPrefix(id, "https://") || strings.HasPrefix(id, "http://") {
+		tempDir, err := os.MkdirTemp("", "kled-feature-*")
+		if err != nil {
+			return err
+		}
+		defer os.RemoveAll(tempDir)
+
+		downloadFile := filepath.Join(tempDir, "feature.tgz")
+		err = downloadFeatureFromURL(id, downloadFile, httpHeaders, log)
+		if err != nil {
+			return err
+		}
+
+		file, err := os.Open(downloadFile)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+
+		return store.AddFile(id, file)
+	}
+
+	ref, err := name.ParseReference(id)
+	if err != nil {
+		return err
+	}
+	img, err := remote.Image(ref, remote.WithAuthFromKeychain(authn.DefaultKeychain))
+	if err != nil {
+		return errors.Wrapf(err, "retrieve feature %s", id)
+	}
+
+	return store.AddImage(id, img)
+}
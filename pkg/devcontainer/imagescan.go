@@ -0,0 +1,58 @@
+package devcontainer
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/loft-sh/devpod/pkg/imagescan"
+)
+
+// maxLoggedFindings limits the findings printed during workspace start
+const maxLoggedFindings = 10
+
+// scanImage scans the workspace image and stores the report in the workspace
+// folder. In block mode, findings at or above the threshold fail the start.
+func (r *runner) scanImage(ctx context.Context, image string, options imagescan.Options) error {
+	if !options.Enabled() {
+		return nil
+	} else if image == "" {
+		r.Log.Debugf("Skip image scan, no image was built")
+		return nil
+	}
+
+	r.Log.Infof("Scanning image %s for vulnerabilities", image)
+	report, err := imagescan.Scan(ctx, image, options)
+	if err != nil {
+		if options.Mode == imagescan.ModeBlock {
+			return fmt.Errorf("image scan: %w", err)
+		}
+
+		r.Log.Warnf("Error scanning image %s: %v", image, err)
+		return nil
+	}
+
+	findings := report.Findings(report.Threshold)
+	report.Blocked = options.Mode == imagescan.ModeBlock && len(findings) > 0
+	err = imagescan.SaveReport(r.WorkspaceConfig.Origin, report)
+	if err != nil {
+		r.Log.Warnf("Error saving image scan report: %v", err)
+	}
+	if len(findings) == 0 {
+		r.Log.Donef("Image scan found %s", report.Summary())
+		return nil
+	}
+
+	for i, finding := range findings {
+		if i == maxLoggedFindings {
+			r.Log.Warnf("... and %d more", len(findings)-maxLoggedFindings)
+			break
+		}
+		r.Log.Warnf("%s %s in %s %s", finding.Severity, finding.ID, finding.Package, finding.InstalledVersion)
+	}
+	if report.Blocked {
+		return fmt.Errorf("image %s has %s, refusing to start the workspace. Run 'kled workspace scan' to see the full report", image, report.Summary())
+	}
+
+	r.Log.Warnf("Image %s has %s", image, report.Summary())
+	return nil
+}
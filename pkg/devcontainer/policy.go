@@ -0,0 +1,83 @@
+package devcontainer
+
+import (
+	"os"
+	"time"
+
+	"github.com/loft-sh/devpod/pkg/devcontainer/config"
+	"github.com/loft-sh/devpod/pkg/devcontainer/policy"
+	"github.com/loft-sh/devpod/pkg/dockerfile"
+)
+
+// enforcePolicy validates the devcontainer configuration against the policy
+// of the workspace. Overridden violations are recorded in the workspace folder.
+func (r *runner) enforcePolicy(parsedConfig *config.DevContainerConfig, options UpOptions) error {
+	if options.Policy == nil {
+		return nil
+	}
+
+	violations := options.Policy.Evaluate(policy.Input{
+		Config: parsedConfig,
+		Images: r.policyImages(parsedConfig),
+	})
+	for _, violation := range violations {
+		if violation.Action == policy.ActionWarn {
+			r.Log.Warnf("Policy %s", violation)
+		}
+	}
+
+	overridden, err := policy.Enforce(violations, policy.Override{
+		Reason: options.PolicyOverride,
+		User:   options.PolicyOverrideUser,
+	})
+	if err != nil {
+		return err
+	} else if len(overridden) == 0 {
+		return nil
+	}
+
+	for _, violation := range overridden {
+		r.Log.Warnf("Policy %s (overridden: %s)", violation, options.PolicyOverride)
+	}
+	err = policy.AppendAudit(r.WorkspaceConfig.Origin, policy.AuditEntry{
+		Time:       time.Now().UTC(),
+		Workspace:  r.WorkspaceConfig.Workspace.ID,
+		User:       options.PolicyOverrideUser,
+		Reason:     options.PolicyOverride,
+		Violations: overridden,
+	})
+	if err != nil {
+		r.Log.Warnf("Error recording policy override: %v", err)
+	}
+
+	return nil
+}
+
+// policyImages returns the image of the config or the base image of its Dockerfile
+func (r *runner) policyImages(parsedConfig *config.DevContainerConfig) []string {
+	if parsedConfig.Image != "" {
+		return []string{parsedConfig.Image}
+	} else if !isDockerFileConfig(parsedConfig) {
+		return nil
+	}
+
+	dockerfilePath, err := r.getDockerfilePath(parsedConfig)
+	if err != nil {
+		return nil
+	}
+	content, err := os.ReadFile(dockerfilePath)
+	if err != nil {
+		return nil
+	}
+	parsedDockerfile, err := dockerfile.Parse(string(content))
+	if err != nil {
+		r.Log.Debugf("Error parsing Dockerfile for policy: %v", err)
+		return nil
+	}
+
+	baseImage := parsedDockerfile.FindBaseImage(parsedConfig.GetArgs(), parsedConfig.GetTarget())
+	if baseImage == "" {
+		return nil
+	}
+	return []string{baseImage}
+}
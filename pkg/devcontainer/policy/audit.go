@@ -0,0 +1,69 @@
+package policy
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// AuditFile is the file in the workspace folder overrides are appended to
+const AuditFile = "policy-audit.jsonl"
+
+// Override allows a workspace to be created despite denied violations
+type Override struct {
+	Reason string `json:"reason"`
+	User   string `json:"user,omitempty"`
+}
+
+type AuditEntry struct {
+	Time       time.Time   `json:"time"`
+	Workspace  string      `json:"workspace"`
+	User       string      `json:"user,omitempty"`
+	Reason     string      `json:"reason"`
+	Violations []Violation `json:"violations"`
+}
+
+// Enforce returns an error if violations contains denied violations that
+// aren't overridden. It returns the overridden violations otherwise.
+func Enforce(violations []Violation, override Override) ([]Violation, error) {
+	denied := Denied(violations)
+	if len(denied) == 0 {
+		return nil, nil
+	}
+
+	messages := []string{}
+	for _, violation := range denied {
+		messages = append(messages, violation.String())
+	}
+	if override.Reason == "" {
+		return nil, fmt.Errorf("devcontainer configuration violates policy:\n  %s\nFix the configuration or rerun with --policy-override <reason>", strings.Join(messages, "\n  "))
+	}
+
+	for _, violation := range denied {
+		if !violation.Overridable {
+			return nil, fmt.Errorf("devcontainer configuration violates policy rule %s which cannot be overridden: %s", violation.Rule, violation.Message)
+		}
+	}
+
+	return denied, nil
+}
+
+// AppendAudit records an override in the workspace folder
+func AppendAudit(workspaceDir string, entry AuditEntry) error {
+	out, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(filepath.Join(workspaceDir, AuditFile), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	_, err = f.Write(append(out, '\n'))
+	return err
+}
@@ -0,0 +1,194 @@
+package policy
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/distribution/reference"
+	"github.com/docker/go-units"
+	"github.com/loft-sh/devpod/pkg/devcontainer/config"
+)
+
+// Input is what a policy is evaluated against
+type Input struct {
+	Config *config.DevContainerConfig
+
+	// Images are the images the workspace container is created from, e.g. the
+	// image of the config or the base image of its Dockerfile
+	Images []string
+}
+
+type Violation struct {
+	Rule        string `json:"rule"`
+	Action      Action `json:"action"`
+	Message     string `json:"message"`
+	Overridable bool   `json:"overridable"`
+}
+
+func (v Violation) String() string {
+	return fmt.Sprintf("%s: %s", v.Rule, v.Message)
+}
+
+// Evaluate returns all violations of the policy, a nil policy has none
+func (p *Policy) Evaluate(input Input) []Violation {
+	if p == nil || input.Config == nil {
+		return nil
+	}
+
+	violations := []Violation{}
+	for _, rule := range p.Rules {
+		for _, message := range rule.check(input) {
+			if rule.Description != "" {
+				message += " (" + rule.Description + ")"
+			}
+
+			violations = append(violations, Violation{
+				Rule:        rule.Name,
+				Action:      rule.action(),
+				Message:     message,
+				Overridable: !rule.NoOverride,
+			})
+		}
+	}
+
+	return violations
+}
+
+// Denied filters the violations that block the workspace
+func Denied(violations []Violation) []Violation {
+	denied := []Violation{}
+	for _, violation := range violations {
+		if violation.Action == ActionDeny {
+			denied = append(denied, violation)
+		}
+	}
+	return denied
+}
+
+func (r Rule) check(input Input) []string {
+	conf := input.Config
+	messages := []string{}
+
+	if r.Privileged != nil && !*r.Privileged {
+		if (conf.Privileged != nil && *conf.Privileged) || hasRunArg(conf.RunArgs, "--privileged") {
+			messages = append(messages, "privileged containers are not allowed")
+		}
+	}
+
+	if len(r.AllowedRegistries) > 0 {
+		for _, image := range input.Images {
+			if !imageAllowed(image, r.AllowedRegistries) {
+				messages = append(messages, fmt.Sprintf("image %s is not from an approved registry (%s)", image, strings.Join(r.AllowedRegistries, ", ")))
+			}
+		}
+	}
+
+	if len(r.ForbiddenCapabilities) > 0 {
+		capabilities := append([]string{}, conf.CapAdd...)
+		capabilities = append(capabilities, runArgValues(conf.RunArgs, "--cap-add")...)
+		for _, capability := range capabilities {
+			if capabilityForbidden(capability, r.ForbiddenCapabilities) {
+				messages = append(messages, fmt.Sprintf("capability %s is not allowed", capability))
+			}
+		}
+	}
+
+	for _, runArg := range r.ForbiddenRunArgs {
+		if hasRunArg(conf.RunArgs, runArg) {
+			messages = append(messages, fmt.Sprintf("run arg %s is not allowed", runArg))
+		}
+	}
+
+	if r.MaxCPUs > 0 {
+		cpus := []string{}
+		if conf.HostRequirements != nil && conf.HostRequirements.CPUs > 0 {
+			cpus = append(cpus, strconv.Itoa(conf.HostRequirements.CPUs))
+		}
+		cpus = append(cpus, runArgValues(conf.RunArgs, "--cpus")...)
+		for _, value := range cpus {
+			requested, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				messages = append(messages, fmt.Sprintf("cannot parse cpu request %q", value))
+			} else if requested > r.MaxCPUs {
+				messages = append(messages, fmt.Sprintf("%s cpus requested, at most %s are allowed", value, strconv.FormatFloat(r.MaxCPUs, 'f', -1, 64)))
+			}
+		}
+	}
+
+	if r.MaxMemory != "" {
+		limit, _ := units.RAMInBytes(r.MaxMemory)
+		memory := []string{}
+		if conf.HostRequirements != nil && conf.HostRequirements.Memory != "" {
+			memory = append(memory, conf.HostRequirements.Memory)
+		}
+		memory = append(memory, runArgValues(conf.RunArgs, "--memory", "-m")...)
+		for _, value := range memory {
+			requested, err := units.RAMInBytes(value)
+			if err != nil {
+				messages = append(messages, fmt.Sprintf("cannot parse memory request %q", value))
+			} else if requested > limit {
+				messages = append(messages, fmt.Sprintf("%s memory requested, at most %s is allowed", value, r.MaxMemory))
+			}
+		}
+	}
+
+	return messages
+}
+
+// imageAllowed checks if the fully qualified repository of image is one of
+// the allowed registries or below one of them.
+func imageAllowed(image string, allowed []string) bool {
+	named, err := reference.ParseNormalizedNamed(image)
+	if err != nil {
+		return false
+	}
+
+	name := named.Name()
+	for _, registry := range allowed {
+		registry = strings.TrimSuffix(registry, "/")
+		if name == registry || strings.HasPrefix(name, registry+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+func capabilityForbidden(capability string, forbidden []string) bool {
+	capability = strings.TrimPrefix(strings.ToUpper(capability), "CAP_")
+	for _, f := range forbidden {
+		f = strings.TrimPrefix(strings.ToUpper(f), "CAP_")
+		if f == "ALL" || f == capability {
+			return true
+		}
+	}
+	return false
+}
+
+func hasRunArg(runArgs []string, name string) bool {
+	for _, runArg := range runArgs {
+		if runArg == name || strings.HasPrefix(runArg, name+"=") {
+			return true
+		}
+	}
+	return false
+}
+
+// runArgValues returns the values of the flags in runArgs, both in the
+// --flag=value and the --flag value form.
+func runArgValues(runArgs []string, names ...string) []string {
+	values := []string{}
+	for i := 0; i < len(runArgs); i++ {
+		for _, name := range names {
+			if runArgs[i] == name && i+1 < len(runArgs) {
+				values = append(values, runArgs[i+1])
+				i++
+				break
+			} else if strings.HasPrefix(runArgs[i], name+"=") {
+				values = append(values, strings.TrimPrefix(runArgs[i], name+"="))
+				break
+			}
+		}
+	}
+	return values
+}
@@ -0,0 +1,132 @@
+// Package policy validates devcontainer configurations against admission
+// rules before a workspace container is created.
+package policy
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/docker/go-units"
+	"github.com/ghodss/yaml"
+)
+
+type Action string
+
+const (
+	// ActionDeny refuses to create the workspace unless the violation is overridden
+	ActionDeny Action = "deny"
+	// ActionWarn only reports the violation
+	ActionWarn Action = "warn"
+)
+
+// Policy is a list of rules a devcontainer configuration has to satisfy.
+// Policies are written in yaml, for example:
+//
+//	rules:
+//	  - name: no-privileged
+//	    privileged: false
+//	  - name: approved-registries
+//	    allowedRegistries: ["ghcr.io/my-org", "mcr.microsoft.com"]
+//	  - name: resource-caps
+//	    action: warn
+//	    maxCPUs: 8
+//	    maxMemory: 32gb
+type Policy struct {
+	Rules []Rule `json:"rules,omitempty"`
+}
+
+// Rule holds a set of constraints. Every constraint that is set is checked,
+// unset constraints are ignored.
+type Rule struct {
+	// Name identifies the rule in violations and audit entries
+	Name string `json:"name"`
+
+	// Description is shown together with violations of the rule
+	Description string `json:"description,omitempty"`
+
+	// Action is either deny or warn, defaults to deny
+	Action Action `json:"action,omitempty"`
+
+	// NoOverride prevents the rule from being overridden with --policy-override
+	NoOverride bool `json:"noOverride,omitempty"`
+
+	// Privileged set to false forbids privileged containers
+	Privileged *bool `json:"privileged,omitempty"`
+
+	// AllowedRegistries restricts images to the given registries or repository prefixes
+	AllowedRegistries []string `json:"allowedRegistries,omitempty"`
+
+	// ForbiddenCapabilities lists linux capabilities that can't be added. ALL matches any capability.
+	ForbiddenCapabilities []string `json:"forbiddenCapabilities,omitempty"`
+
+	// ForbiddenRunArgs lists docker run flags that can't be used, e.g. --network
+	ForbiddenRunArgs []string `json:"forbiddenRunArgs,omitempty"`
+
+	// MaxCPUs caps the cpus requested through hostRequirements or --cpus
+	MaxCPUs float64 `json:"maxCPUs,omitempty"`
+
+	// MaxMemory caps the memory requested through hostRequirements or --memory. Supports units like gb and mb.
+	MaxMemory string `json:"maxMemory,omitempty"`
+}
+
+func (r Rule) action() Action {
+	if r.Action == "" {
+		return ActionDeny
+	}
+	return r.Action
+}
+
+// Load reads the policy at path, it returns nil if path is empty
+func Load(path string) (*Policy, error) {
+	if path == "" {
+		return nil, nil
+	}
+
+	out, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read devcontainer policy: %w", err)
+	}
+
+	policy, err := Parse(out)
+	if err != nil {
+		return nil, fmt.Errorf("parse devcontainer policy %s: %w", path, err)
+	}
+	return policy, nil
+}
+
+// Parse parses and validates a yaml or json policy
+func Parse(out []byte) (*Policy, error) {
+	policy := &Policy{}
+	err := yaml.Unmarshal(out, policy)
+	if err != nil {
+		return nil, err
+	}
+
+	names := map[string]bool{}
+	for i, rule := range policy.Rules {
+		if rule.Name == "" {
+			return nil, fmt.Errorf("rule %d is missing a name", i)
+		} else if names[rule.Name] {
+			return nil, fmt.Errorf("rule %s is defined twice", rule.Name)
+		}
+		names[rule.Name] = true
+
+		if rule.Action != "" && rule.Action != ActionDeny && rule.Action != ActionWarn {
+			return nil, fmt.Errorf("rule %s: unknown action %q, expected deny or warn", rule.Name, rule.Action)
+		}
+		if rule.MaxMemory != "" {
+			if _, err := units.RAMInBytes(rule.MaxMemory); err != nil {
+				return nil, fmt.Errorf("rule %s: parse maxMemory: %w", rule.Name, err)
+			}
+		}
+		for j, runArg := range rule.ForbiddenRunArgs {
+			if !strings.HasPrefix(runArg, "-") {
+				return nil, fmt.Errorf("rule %s: forbidden run arg %q has to be a flag", rule.Name, runArg)
+			}
+			policy.Rules[i].ForbiddenRunArgs[j] = strings.SplitN(runArg, "=", 2)[0]
+		}
+	}
+
+	return policy, nil
+}
@@ -0,0 +1,86 @@
+package policy
+
+import (
+	"testing"
+
+	"github.com/loft-sh/devpod/pkg/devcontainer/config"
+	"gotest.tools/assert"
+)
+
+const testPolicy = `
+rules:
+  - name: no-privileged
+    privileged: false
+    forbiddenCapabilities: [SYS_ADMIN]
+  - name: approved-registries
+    noOverride: true
+    allowedRegistries: ["ghcr.io/my-org", "mcr.microsoft.com"]
+  - name: resource-caps
+    action: warn
+    maxCPUs: 4
+    maxMemory: 8gb
+    forbiddenRunArgs: ["--network=host"]
+`
+
+func TestEvaluate(t *testing.T) {
+	policy, err := Parse([]byte(testPolicy))
+	assert.NilError(t, err)
+	assert.DeepEqual(t, policy.Rules[2].ForbiddenRunArgs, []string{"--network"})
+
+	privileged := true
+	conf := &config.DevContainerConfig{}
+	conf.Privileged = &privileged
+	conf.RunArgs = []string{"--cap-add", "sys_admin", "--cpus=8", "-m", "4g", "--network", "host"}
+	conf.HostRequirements = &config.HostRequirements{Memory: "16gb"}
+
+	violations := policy.Evaluate(Input{
+		Config: conf,
+		Images: []string{"mcr.microsoft.com/devcontainers/go:1", "ubuntu:22.04"},
+	})
+	messages := []string{}
+	for _, violation := range violations {
+		messages = append(messages, violation.String())
+	}
+	assert.DeepEqual(t, messages, []string{
+		"no-privileged: privileged containers are not allowed",
+		"no-privileged: capability sys_admin is not allowed",
+		"approved-registries: image ubuntu:22.04 is not from an approved registry (ghcr.io/my-org, mcr.microsoft.com)",
+		"resource-caps: run arg --network is not allowed",
+		"resource-caps: 8 cpus requested, at most 4 are allowed",
+		"resource-caps: 16gb memory requested, at most 8gb is allowed",
+	})
+	assert.Equal(t, len(Denied(violations)), 3)
+}
+
+func TestEnforce(t *testing.T) {
+	violations := []Violation{
+		{Rule: "no-privileged", Action: ActionDeny, Message: "privileged containers are not allowed", Overridable: true},
+		{Rule: "resource-caps", Action: ActionWarn, Message: "8 cpus requested, at most 4 are allowed", Overridable: true},
+	}
+
+	_, err := Enforce(violations, Override{})
+	assert.ErrorContains(t, err, "no-privileged: privileged containers are not allowed")
+
+	overridden, err := Enforce(violations, Override{Reason: "debugging", User: "alice"})
+	assert.NilError(t, err)
+	assert.Equal(t, len(overridden), 1)
+
+	violations[0].Overridable = false
+	_, err = Enforce(violations, Override{Reason: "debugging"})
+	assert.ErrorContains(t, err, "cannot be overridden")
+
+	overridden, err = Enforce(violations[1:], Override{})
+	assert.NilError(t, err)
+	assert.Assert(t, overridden == nil)
+}
+
+func TestParse(t *testing.T) {
+	_, err := Parse([]byte("rules:\n  - action: deny\n"))
+	assert.ErrorContains(t, err, "missing a name")
+
+	_, err = Parse([]byte("rules:\n  - name: a\n    action: block\n"))
+	assert.ErrorContains(t, err, "unknown action")
+
+	_, err = Parse([]byte("rules:\n  - name: a\n    maxMemory: lots\n"))
+	assert.ErrorContains(t, err, "maxMemory")
+}
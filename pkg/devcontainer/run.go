@@ -11,9 +11,11 @@ import (
 	"time"
 
 	"github.com/loft-sh/devpod/pkg/devcontainer/config"
+	"github.com/loft-sh/devpod/pkg/devcontainer/policy"
 	"github.com/loft-sh/devpod/pkg/driver"
 	"github.com/loft-sh/devpod/pkg/driver/drivercreate"
 	"github.com/loft-sh/devpod/pkg/encoding"
+	"github.com/loft-sh/devpod/pkg/imagescan"
 	"github.com/loft-sh/devpod/pkg/language"
 	provider2 "github.com/loft-sh/devpod/pkg/provider"
 	"github.com/loft-sh/log"
@@ -87,6 +89,8 @@ type UpOptions struct {
 	NoBuild       bool
 	ForceBuild    bool
 	RegistryCache string
+	ImageScan     imagescan.Options
+	Policy        *policy.Policy
 }
 
 func (r *runner) Up(ctx context.Context, options UpOptions, timeout time.Duration) (*config.Result, error) {
@@ -98,6 +102,12 @@ func (r *runner) Up(ctx context.Context, options UpOptions, timeout time.Duratio
 	}
 	defer cleanupBuildInformation(substitutedConfig.Config)
 
+	// validate the config against the workspace policy
+	err = r.enforcePolicy(substitutedConfig.Config, options)
+	if err != nil {
+		return nil, err
+	}
+
 	// do not run initialize command in platform mode
 	if !options.CLIOptions.Platform.Enabled {
 		if err := runInitializeCommand(r.LocalWorkspaceFolder, substitutedConfig.Config, options.InitEnv, r.Log); err != nil {
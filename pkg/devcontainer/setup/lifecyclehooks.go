@@ -3,15 +3,20 @@ package setup
 import (
 	"bufio"
 	"context"
+	"encoding/json"
 	"fmt"
 	"io"
 	"os"
 	"os/exec"
 	"os/user"
+	"path/filepath"
 	"regexp"
 	"slices"
+	"sort"
+	"strconv"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/loft-sh/devpod/pkg/command"
 	"github.com/loft-sh/devpod/pkg/devcontainer/config"
@@ -20,6 +25,37 @@ import (
 	"github.com/sirupsen/logrus"
 )
 
+const (
+	// lifecycleHooksFile in the marker dir keeps the results of earlier runs,
+	// so hooks that only run once per container are still reported afterwards.
+	lifecycleHooksFile = "lifecycle-hooks.json"
+
+	// lifecycleHookAttemptsEnv can be set in remoteEnv or containerEnv to
+	// retry failing lifecycle commands before they are marked as failed.
+	lifecycleHookAttemptsEnv = "KLED_LIFECYCLE_HOOK_ATTEMPTS"
+)
+
+var (
+	lifecycleHookRetryDelay = 5 * time.Second
+
+	// runLifecycleCommand runs a lifecycle command, replaced in tests
+	runLifecycleCommand = runCommand
+)
+
+type lifecycleHook struct {
+	// name is the devcontainer.json property
+	name string
+	// marker is the name of the marker file
+	marker   string
+	commands []types.LifecycleHook
+	// content of the marker, hooks with empty content run every time
+	content string
+}
+
+// RunLifecycleHooks runs the lifecycle commands in the order of the spec. A
+// failing command marks its hook as failed and skips all later hooks, but
+// does not fail the setup, so the workspace stays accessible. Failed hooks
+// are run again on the next start. The results are stored in setupInfo.
 func RunLifecycleHooks(ctx context.Context, setupInfo *config.Result, log log.Logger) error {
 	mergedConfig := setupInfo.MergedConfig
 	remoteUser := config.GetRemoteUser(setupInfo)
@@ -32,75 +68,109 @@ func RunLifecycleHooks(ctx context.Context, setupInfo *config.Result, log log.Lo
 	workspaceFolder := setupInfo.SubstitutionContext.ContainerWorkspaceFolder
 	containerDetails := setupInfo.ContainerDetails
 
-	// only run once per container run
-	err = run(mergedConfig.OnCreateCommands, remoteUser, workspaceFolder, remoteEnv,
-		"onCreateCommands", containerDetails.Created, log)
-	if err != nil {
-		return err
+	hooks := []lifecycleHook{
+		// only run once per container run
+		{name: "onCreateCommand", marker: "onCreateCommands", commands: mergedConfig.OnCreateCommands, content: containerDetails.Created},
+		// TODO: rerun when contents changed
+		{name: "updateContentCommand", marker: "updateContentCommands", commands: mergedConfig.UpdateContentCommands, content: containerDetails.Created},
+		// only run once per container run
+		{name: "postCreateCommand", marker: "postCreateCommands", commands: mergedConfig.PostCreateCommands, content: containerDetails.Created},
+		// run when the container was restarted
+		{name: "postStartCommand", marker: "postStartCommands", commands: mergedConfig.PostStartCommands, content: containerDetails.State.StartedAt},
+		// run always when attaching to the container
+		{name: "postAttachCommand", marker: "postAttachCommands", commands: mergedConfig.PostAttachCommands},
 	}
 
-	// TODO: rerun when contents changed
-	err = run(mergedConfig.UpdateContentCommands, remoteUser, workspaceFolder, remoteEnv,
-		"updateContentCommands", containerDetails.Created, log)
+	attempts, err := lifecycleHookAttempts(remoteEnv)
 	if err != nil {
 		return err
 	}
 
-	// only run once per container run
-	err = run(mergedConfig.PostCreateCommands, remoteUser, workspaceFolder, remoteEnv,
-		"postCreateCommands", containerDetails.Created, log)
-	if err != nil {
-		return err
-	}
+	previous := loadLifecycleHookResults()
+	results := []config.LifecycleHookResult{}
+	failed := false
+	for _, hook := range hooks {
+		if len(hook.commands) == 0 {
+			continue
+		}
 
-	// run when the container was restarted
-	err = run(mergedConfig.PostStartCommands, remoteUser, workspaceFolder, remoteEnv,
-		"postStartCommands", containerDetails.State.StartedAt, log)
-	if err != nil {
-		return err
-	}
+		if failed {
+			results = append(results, hookResults(hook, config.LifecycleHookStateSkipped)...)
+			continue
+		}
 
-	// run always when attaching to the container
-	err = run(mergedConfig.PostAttachCommands, remoteUser, workspaceFolder, remoteEnv,
-		"postAttachCommands", "", log)
-	if err != nil {
-		return err
+		if hook.content != "" {
+			done, err := markerMatches(hook.marker, hook.content)
+			if err != nil {
+				return err
+			} else if done {
+				results = append(results, previousResults(previous, hook)...)
+				continue
+			}
+		}
+
+		hookResults, err := run(ctx, hook, remoteUser, workspaceFolder, remoteEnv, attempts, log)
+		if err != nil {
+			return err
+		}
+		results = append(results, hookResults...)
+
+		if failedHook := failedResult(hookResults); failedHook != nil {
+			log.Errorf("Lifecycle hook %s failed, skipping the remaining hooks. It will run again on the next start, see 'kled workspace status' for details: %s", hook.name, failedHook.Error)
+			failed = true
+			continue
+		}
+
+		if hook.content != "" {
+			err = writeMarker(hook.marker, hook.content)
+			if err != nil {
+				return err
+			}
+		}
 	}
 
+	setupInfo.LifecycleHooks = results
+	saveLifecycleHookResults(results, log)
 	return nil
 }
 
-func run(commands []types.LifecycleHook, remoteUser, dir string, remoteEnv map[string]string, name, content string, log log.Logger) error {
-	if len(commands) == 0 {
-		return nil
+// lifecycleHookAttempts returns how often a failing lifecycle command is run
+// before it is marked as failed.
+func lifecycleHookAttempts(remoteEnv map[string]string) (int, error) {
+	value, ok := remoteEnv[lifecycleHookAttemptsEnv]
+	if !ok {
+		return 1, nil
 	}
 
-	// check marker file
-	if content != "" {
-		exists, err := markerFileExists(name, content)
-		if err != nil {
-			return err
-		} else if exists {
-			return nil
-		}
+	attempts, err := strconv.Atoi(value)
+	if err != nil || attempts < 1 {
+		return 0, fmt.Errorf("%s must be a positive number, got %q", lifecycleHookAttemptsEnv, value)
 	}
+	return attempts, nil
+}
 
+func run(ctx context.Context, hook lifecycleHook, remoteUser, dir string, remoteEnv map[string]string, attempts int, log log.Logger) ([]config.LifecycleHookResult, error) {
 	remoteEnvArr := []string{}
 	for k, v := range remoteEnv {
 		remoteEnvArr = append(remoteEnvArr, k+"="+v)
 	}
 
-	for _, cmd := range commands {
-		if len(cmd) == 0 {
-			continue
-		}
+	currentUser, err := user.Current()
+	if err != nil {
+		return nil, err
+	}
 
-		for k, c := range cmd {
-			log.Infof("Run command %s: %s...", k, strings.Join(c, " "))
-			currentUser, err := user.Current()
-			if err != nil {
-				return err
+	results := []config.LifecycleHookResult{}
+	for _, cmd := range hook.commands {
+		for _, k := range sortedCommandNames(cmd) {
+			c := cmd[k]
+			if failedResult(results) != nil {
+				result := newHookResult(hook.name, k, c)
+				result.State = config.LifecycleHookStateSkipped
+				results = append(results, result)
+				continue
 			}
+
 			args := []string{}
 			if remoteUser != currentUser.Username {
 				args = append(args, "su", remoteUser, "-c", command.Quote(c))
@@ -108,54 +178,162 @@ func run(commands []types.LifecycleHook, remoteUser, dir string, remoteEnv map[s
 				args = append(args, "sh", "-c", command.Quote(c))
 			}
 
-			// create command
-			cmd := exec.Command(args[0], args[1:]...)
-			cmd.Dir = dir
-			cmd.Env = os.Environ()
-			cmd.Env = append(cmd.Env, remoteEnvArr...)
+			result := newHookResult(hook.name, k, c)
+			startedAt := time.Now()
+			result.StartedAt = &startedAt
+			for attempt := 1; attempt <= attempts; attempt++ {
+				if attempt > 1 {
+					log.Infof("Retrying command %s of %s in %s (attempt %d/%d)...", k, hook.name, lifecycleHookRetryDelay, attempt, attempts)
+					select {
+					case <-ctx.Done():
+						return nil, ctx.Err()
+					case <-time.After(lifecycleHookRetryDelay):
+					}
+				}
 
-			// Create pipes for stdout and stderr
-			stdoutPipe, err := cmd.StdoutPipe()
-			if err != nil {
-				return fmt.Errorf("failed to get stdout pipe: %w", err)
+				result.Attempts = attempt
+				log.Infof("Run %s %s: %s...", hook.name, k, strings.Join(c, " "))
+				err = runLifecycleCommand(args, dir, remoteEnvArr, log)
+				if err == nil {
+					break
+				}
+				log.Debugf("Failed running %s lifecycle script %s: %v", hook.name, args, err)
 			}
-			stderrPipe, err := cmd.StderrPipe()
+
+			finishedAt := time.Now()
+			result.FinishedAt = &finishedAt
 			if err != nil {
-				return fmt.Errorf("failed to get stderr pipe: %w", err)
+				result.State = config.LifecycleHookStateFailed
+				result.Error = fmt.Sprintf("failed to run: %s, error: %v", strings.Join(c, " "), err)
+			} else {
+				result.State = config.LifecycleHookStateSucceeded
+				log.Donef("Successfully ran %s %s: %s", hook.name, k, strings.Join(c, " "))
 			}
+			results = append(results, result)
+		}
+	}
 
-			// Start the command
-			if err := cmd.Start(); err != nil {
-				return fmt.Errorf("failed to start command: %w", err)
-			}
+	return results, nil
+}
+
+func runCommand(args []string, dir string, env []string, log log.Logger) error {
+	// create command
+	cmd := exec.Command(args[0], args[1:]...)
+	cmd.Dir = dir
+	cmd.Env = os.Environ()
+	cmd.Env = append(cmd.Env, env...)
+
+	// Create pipes for stdout and stderr
+	stdoutPipe, err := cmd.StdoutPipe()
+	if err != nil {
+		return fmt.Errorf("failed to get stdout pipe: %w", err)
+	}
+	stderrPipe, err := cmd.StderrPipe()
+	if err != nil {
+		return fmt.Errorf("failed to get stderr pipe: %w", err)
+	}
 
-			// Use WaitGroup to wait for both stdout and stderr processing
-			var wg sync.WaitGroup
-			wg.Add(2)
+	// Start the command
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("failed to start command: %w", err)
+	}
 
-			go func() {
-				defer wg.Done()
-				logPipeOutput(log, stdoutPipe, logrus.InfoLevel)
-			}()
+	// Use WaitGroup to wait for both stdout and stderr processing
+	var wg sync.WaitGroup
+	wg.Add(2)
 
-			go func() {
-				defer wg.Done()
-				logPipeOutput(log, stderrPipe, logrus.ErrorLevel)
-			}()
+	go func() {
+		defer wg.Done()
+		logPipeOutput(log, stdoutPipe, logrus.InfoLevel)
+	}()
 
-			// Wait for command to finish
-			wg.Wait()
-			err = cmd.Wait()
-			if err != nil {
-				log.Debugf("Failed running postCreateCommand lifecycle script %s: %v", cmd.Args, err)
-				return fmt.Errorf("failed to run: %s, error: %w", strings.Join(c, " "), err)
-			}
+	go func() {
+		defer wg.Done()
+		logPipeOutput(log, stderrPipe, logrus.ErrorLevel)
+	}()
+
+	// Wait for command to finish
+	wg.Wait()
+	return cmd.Wait()
+}
 
-			log.Donef("Successfully ran command %s: %s", k, strings.Join(c, " "))
+// sortedCommandNames returns the names of the commands of a hook in a stable
+// order, the anonymous command comes first.
+func sortedCommandNames(cmd types.LifecycleHook) []string {
+	names := []string{}
+	for k, c := range cmd {
+		if len(c) > 0 {
+			names = append(names, k)
 		}
 	}
+	sort.Strings(names)
+	return names
+}
 
-	return nil
+func newHookResult(hook, name string, c []string) config.LifecycleHookResult {
+	return config.LifecycleHookResult{
+		Hook:    hook,
+		Name:    name,
+		Command: strings.Join(c, " "),
+	}
+}
+
+func hookResults(hook lifecycleHook, state config.LifecycleHookState) []config.LifecycleHookResult {
+	results := []config.LifecycleHookResult{}
+	for _, cmd := range hook.commands {
+		for _, k := range sortedCommandNames(cmd) {
+			result := newHookResult(hook.name, k, cmd[k])
+			result.State = state
+			results = append(results, result)
+		}
+	}
+	return results
+}
+
+func failedResult(results []config.LifecycleHookResult) *config.LifecycleHookResult {
+	return config.FailedLifecycleHook(&config.Result{LifecycleHooks: results})
+}
+
+// previousResults returns the results of a hook that already ran for this
+// container. Hooks from before results were recorded are reported as succeeded.
+func previousResults(previous []config.LifecycleHookResult, hook lifecycleHook) []config.LifecycleHookResult {
+	results := []config.LifecycleHookResult{}
+	for _, result := range previous {
+		if result.Hook == hook.name {
+			results = append(results, result)
+		}
+	}
+	if len(results) > 0 {
+		return results
+	}
+
+	return hookResults(hook, config.LifecycleHookStateSucceeded)
+}
+
+func loadLifecycleHookResults() []config.LifecycleHookResult {
+	results := []config.LifecycleHookResult{}
+	out, err := os.ReadFile(filepath.Join(markerDir, lifecycleHooksFile))
+	if err != nil {
+		return results
+	}
+
+	_ = json.Unmarshal(out, &results)
+	return results
+}
+
+func saveLifecycleHookResults(results []config.LifecycleHookResult, log log.Logger) {
+	out, err := json.Marshal(results)
+	if err != nil {
+		log.Warnf("Error marshal lifecycle hook results: %v", err)
+		return
+	}
+
+	location := filepath.Join(markerDir, lifecycleHooksFile)
+	_ = os.MkdirAll(markerDir, 0777)
+	err = os.WriteFile(location, out, 0644)
+	if err != nil {
+		log.Warnf("Error write lifecycle hook results to %s: %v", location, err)
+	}
 }
 
 func logPipeOutput(log log.Logger, pipe io.ReadCloser, level logrus.Level) {
@@ -0,0 +1,211 @@
+package setup
+
+import (
+	"context"
+	"errors"
+	"os/user"
+	"reflect"
+	"testing"
+
+	"github.com/loft-sh/devpod/pkg/devcontainer/config"
+	"github.com/loft-sh/devpod/pkg/types"
+	"github.com/loft-sh/log"
+)
+
+// fakeCommands replaces the lifecycle commands run by the hooks. Each command
+// fails as often as failures says, -1 meaning always.
+type fakeCommands struct {
+	failures map[string]int
+	runs     []string
+}
+
+func (f *fakeCommands) run(args []string, dir string, env []string, log log.Logger) error {
+	command := args[len(args)-1]
+	f.runs = append(f.runs, command)
+	switch f.failures[command] {
+	case 0:
+		return nil
+	case -1:
+	default:
+		f.failures[command]--
+	}
+	return errors.New("exit status 1")
+}
+
+func fakeLifecycleHooks(t *testing.T, failures map[string]int) *fakeCommands {
+	commands := &fakeCommands{failures: failures}
+	runCommand, retryDelay, dir := runLifecycleCommand, lifecycleHookRetryDelay, markerDir
+	runLifecycleCommand, lifecycleHookRetryDelay, markerDir = commands.run, 0, t.TempDir()
+	t.Cleanup(func() {
+		runLifecycleCommand, lifecycleHookRetryDelay, markerDir = runCommand, retryDelay, dir
+	})
+	return commands
+}
+
+func newLifecycleSetup(t *testing.T, remoteEnv map[string]string) *config.Result {
+	currentUser, err := user.Current()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	merged := &config.MergedDevContainerConfig{}
+	merged.RemoteUser = currentUser.Username
+	merged.UserEnvProbe = "none"
+	merged.RemoteEnv = remoteEnv
+	merged.OnCreateCommands = []types.LifecycleHook{{"": {"install"}}}
+	merged.PostCreateCommands = []types.LifecycleHook{{"build": {"make build"}, "test": {"make test"}}}
+	merged.PostStartCommands = []types.LifecycleHook{{"": {"serve"}}}
+	return &config.Result{
+		MergedConfig:        merged,
+		SubstitutionContext: &config.SubstitutionContext{ContainerWorkspaceFolder: t.TempDir()},
+		ContainerDetails: &config.ContainerDetails{
+			Created: "2026-10-16T08:00:00Z",
+			State:   config.ContainerDetailsState{StartedAt: "2026-10-16T08:00:05Z"},
+		},
+	}
+}
+
+type hookState struct {
+	Hook     string
+	Name     string
+	State    config.LifecycleHookState
+	Attempts int
+}
+
+func hookStates(results []config.LifecycleHookResult) []hookState {
+	states := []hookState{}
+	for _, result := range results {
+		states = append(states, hookState{Hook: result.Hook, Name: result.Name, State: result.State, Attempts: result.Attempts})
+	}
+	return states
+}
+
+func TestLifecycleHookAttempts(t *testing.T) {
+	tests := []struct {
+		name    string
+		env     map[string]string
+		want    int
+		wantErr bool
+	}{
+		{name: "unset", env: map[string]string{}, want: 1},
+		{name: "set", env: map[string]string{lifecycleHookAttemptsEnv: "3"}, want: 3},
+		{name: "zero", env: map[string]string{lifecycleHookAttemptsEnv: "0"}, wantErr: true},
+		{name: "not a number", env: map[string]string{lifecycleHookAttemptsEnv: "twice"}, wantErr: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			attempts, err := lifecycleHookAttempts(test.env)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("got error %v, want error %v", err, test.wantErr)
+			}
+			if !test.wantErr && attempts != test.want {
+				t.Fatalf("got %d attempts, want %d", attempts, test.want)
+			}
+		})
+	}
+}
+
+func TestInvalidLifecycleHookAttemptsFailSetup(t *testing.T) {
+	commands := fakeLifecycleHooks(t, map[string]int{})
+	setupInfo := newLifecycleSetup(t, map[string]string{lifecycleHookAttemptsEnv: "-1"})
+
+	if err := RunLifecycleHooks(context.Background(), setupInfo, log.Discard); err == nil {
+		t.Fatal("expected an error for the invalid number of attempts")
+	}
+	if len(commands.runs) != 0 {
+		t.Fatalf("expected no commands to run, ran %q", commands.runs)
+	}
+}
+
+func TestLifecycleHookRetriedUntilItSucceeds(t *testing.T) {
+	commands := fakeLifecycleHooks(t, map[string]int{"make build": 2})
+	setupInfo := newLifecycleSetup(t, map[string]string{lifecycleHookAttemptsEnv: "3"})
+
+	if err := RunLifecycleHooks(context.Background(), setupInfo, log.Discard); err != nil {
+		t.Fatal(err)
+	}
+	want := []hookState{
+		{Hook: "onCreateCommand", State: config.LifecycleHookStateSucceeded, Attempts: 1},
+		{Hook: "postCreateCommand", Name: "build", State: config.LifecycleHookStateSucceeded, Attempts: 3},
+		{Hook: "postCreateCommand", Name: "test", State: config.LifecycleHookStateSucceeded, Attempts: 1},
+		{Hook: "postStartCommand", State: config.LifecycleHookStateSucceeded, Attempts: 1},
+	}
+	if got := hookStates(setupInfo.LifecycleHooks); !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %+v, want %+v", got, want)
+	}
+	wantRuns := []string{"install", "make build", "make build", "make build", "make test", "serve"}
+	if !reflect.DeepEqual(commands.runs, wantRuns) {
+		t.Fatalf("ran %q, want %q", commands.runs, wantRuns)
+	}
+}
+
+func TestLifecycleHookFailureSkipsLaterHooks(t *testing.T) {
+	commands := fakeLifecycleHooks(t, map[string]int{"make build": -1})
+	setupInfo := newLifecycleSetup(t, map[string]string{lifecycleHookAttemptsEnv: "2"})
+
+	// a failing hook doesn't fail the setup, so the workspace stays accessible
+	if err := RunLifecycleHooks(context.Background(), setupInfo, log.Discard); err != nil {
+		t.Fatal(err)
+	}
+	want := []hookState{
+		{Hook: "onCreateCommand", State: config.LifecycleHookStateSucceeded, Attempts: 1},
+		{Hook: "postCreateCommand", Name: "build", State: config.LifecycleHookStateFailed, Attempts: 2},
+		{Hook: "postCreateCommand", Name: "test", State: config.LifecycleHookStateSkipped},
+		{Hook: "postStartCommand", State: config.LifecycleHookStateSkipped},
+	}
+	if got := hookStates(setupInfo.LifecycleHooks); !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %+v, want %+v", got, want)
+	}
+	if failed := config.FailedLifecycleHook(setupInfo); failed == nil || failed.Error == "" {
+		t.Fatalf("expected the failed hook to carry its error, got %+v", failed)
+	}
+	wantRuns := []string{"install", "make build", "make build"}
+	if !reflect.DeepEqual(commands.runs, wantRuns) {
+		t.Fatalf("ran %q, want %q", commands.runs, wantRuns)
+	}
+}
+
+func TestLifecycleHookResultsReusedForUnchangedMarkers(t *testing.T) {
+	commands := fakeLifecycleHooks(t, map[string]int{"make build": 1})
+	setupInfo := newLifecycleSetup(t, map[string]string{lifecycleHookAttemptsEnv: "2"})
+	if err := RunLifecycleHooks(context.Background(), setupInfo, log.Discard); err != nil {
+		t.Fatal(err)
+	}
+	first := hookStates(setupInfo.LifecycleHooks)
+
+	// the same container started again only reruns postStartCommand
+	commands.runs = nil
+	setupInfo.ContainerDetails.State.StartedAt = "2026-10-16T09:00:00Z"
+	setupInfo.LifecycleHooks = nil
+	if err := RunLifecycleHooks(context.Background(), setupInfo, log.Discard); err != nil {
+		t.Fatal(err)
+	}
+	if got := hookStates(setupInfo.LifecycleHooks); !reflect.DeepEqual(got, first) {
+		t.Fatalf("got %+v, want the results of the first run %+v", got, first)
+	}
+	if want := []string{"serve"}; !reflect.DeepEqual(commands.runs, want) {
+		t.Fatalf("ran %q, want %q", commands.runs, want)
+	}
+}
+
+func TestFailedLifecycleHookRunsAgainOnNextStart(t *testing.T) {
+	commands := fakeLifecycleHooks(t, map[string]int{"make build": 1})
+	setupInfo := newLifecycleSetup(t, nil)
+	if err := RunLifecycleHooks(context.Background(), setupInfo, log.Discard); err != nil {
+		t.Fatal(err)
+	}
+	if config.FailedLifecycleHook(setupInfo) == nil {
+		t.Fatal("expected postCreateCommand to fail")
+	}
+
+	commands.runs = nil
+	if err := RunLifecycleHooks(context.Background(), setupInfo, log.Discard); err != nil {
+		t.Fatal(err)
+	}
+	if failed := config.FailedLifecycleHook(setupInfo); failed != nil {
+		t.Fatalf("expected every hook to succeed, %s failed", failed.Hook)
+	}
+	if want := []string{"make build", "make test", "serve"}; !reflect.DeepEqual(commands.runs, want) {
+		t.Fatalf("ran %q, want %q", commands.runs, want)
+	}
+}
@@ -329,22 +329,37 @@ func SetupKubeConfig(ctx context.Context, setupInfo *config.Result, tunnelClient
 }
 
 func markerFileExists(markerName string, markerContent string) (bool, error) {
-	markerName = filepath.Join("/var/devpod", markerName+".marker")
+	exists, err := markerMatches(markerName, markerContent)
+	if err != nil || exists {
+		return exists, err
+	}
+
+	return false, writeMarker(markerName, markerContent)
+}
+
+// markerDir holds the markers of the setup steps and lifecycle hooks that
+// already ran in the container
+var markerDir = "/var/devpod"
+
+func markerMatches(markerName string, markerContent string) (bool, error) {
+	markerName = filepath.Join(markerDir, markerName+".marker")
 	t, err := os.ReadFile(markerName)
 	if err != nil && !os.IsNotExist(err) {
 		return false, err
-	} else if err == nil && (markerContent == "" || string(t) == markerContent) {
-		return true, nil
 	}
 
-	// write marker
+	return err == nil && (markerContent == "" || string(t) == markerContent), nil
+}
+
+func writeMarker(markerName string, markerContent string) error {
+	markerName = filepath.Join(markerDir, markerName+".marker")
 	_ = os.MkdirAll(filepath.Dir(markerName), 0777)
-	err = os.WriteFile(markerName, []byte(markerContent), 0644)
+	err := os.WriteFile(markerName, []byte(markerContent), 0644)
 	if err != nil {
-		return false, errors.Wrap(err, "write marker")
+		return errors.Wrap(err, "write marker")
 	}
 
-	return false, nil
+	return nil
 }
 
 func setupPlatformGitCredentials(userName string, platformOptions *devpod.PlatformOptions, log log.Logger) error {
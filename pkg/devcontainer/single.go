@@ -107,6 +107,14 @@ func (r *runner) runSingleContainer(
 			return nil, errors.Wrap(err, "build image")
 		}
 
+		// scan the image before an existing container is replaced
+		if buildInfo.Dockerless == nil {
+			err = r.scanImage(ctx, buildInfo.ImageName, options.ImageScan)
+			if err != nil {
+				return nil, err
+			}
+		}
+
 		// delete container on recreation
 		if options.Recreate {
 			if _, ok := r.Driver.(driver.DockerDriver); ok {
@@ -271,10 +279,10 @@ func (r *runner) getDockerlessRunOptions(
 		},
 		Env:    env,
 		CapAdd: mergedConfig.CapAdd,
-		Labels: []string{
+		Labels: append([]string{
 			metadata.ImageMetadataLabel + "=" + string(marshalled),
 			config.UserLabel + "=" + buildInfo.Dockerless.User,
-		},
+		}, r.workspaceLabels()...),
 		Privileged:     mergedConfig.Privileged,
 		WorkspaceMount: &workspaceMountParsed,
 		Mounts:         mounts,
@@ -301,6 +309,7 @@ func (r *runner) getRunOptions(
 		metadata.ImageMetadataLabel + "=" + string(marshalled),
 		config.UserLabel + "=" + buildInfo.ImageDetails.Config.User,
 	}
+	labels = append(labels, r.workspaceLabels()...)
 
 	user := buildInfo.ImageDetails.Config.User
 	if mergedConfig.ContainerUser != "" {
@@ -328,6 +337,20 @@ func (r *runner) getRunOptions(
 	}, nil
 }
 
+// workspaceLabels are the labels of the workspace passed on to its
+// container
+func (r *runner) workspaceLabels() []string {
+	if r.WorkspaceConfig == nil || r.WorkspaceConfig.Workspace == nil {
+		return nil
+	}
+
+	expiresAt := r.WorkspaceConfig.Workspace.Labels[provider2.ExpiresAtLabel]
+	if expiresAt == "" {
+		return nil
+	}
+	return []string{provider2.ExpiresAtLabel + "=" + expiresAt}
+}
+
 // add environment variables that signals that we are in a remote container
 // (vscode compatibility) and specifically that we are using devpod.
 func (r *runner) addExtraEnvVars(env map[string]string) map[string]string {
@@ -1,6 +1,7 @@
 package dockercredentials
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"path/filepath"
@@ -12,6 +13,7 @@ import (
 	"github.com/loft-sh/devpod/pkg/docker"
 	"github.com/loft-sh/devpod/pkg/file"
 	"github.com/loft-sh/devpod/pkg/random"
+	"github.com/loft-sh/devpod/pkg/registry"
 	"github.com/loft-sh/log"
 	"github.com/pkg/errors"
 
@@ -171,10 +173,31 @@ func ListCredentials() (*ListResponse, error) {
 		retList.Registries[registryHostname] = auth.Username
 	}
 
+	// registries logged in with kled registry login take precedence
+	kledRegistries, err := registry.List()
+	if err != nil {
+		return nil, err
+	}
+	for _, kledRegistry := range kledRegistries {
+		retList.Registries[kledRegistry.Server] = kledRegistry.Username
+	}
+
 	return retList, nil
 }
 
 func GetAuthConfig(host string) (*Credentials, error) {
+	// check the registries logged in with kled registry login first
+	kledCredentials, err := registry.Resolve(context.Background(), host)
+	if err != nil {
+		return nil, err
+	} else if kledCredentials != nil {
+		return &Credentials{
+			ServerURL: host,
+			Username:  kledCredentials.Username,
+			Secret:    kledCredentials.Secret,
+		}, nil
+	}
+
 	dockerConfig, err := docker.LoadDockerConfig()
 	if err != nil {
 		return nil, err
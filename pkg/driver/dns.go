@@ -0,0 +1,48 @@
+package driver
+
+import (
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/loft-sh/devpod/pkg/provider"
+)
+
+// SplitExtraHost splits an extra hosts entry HOST:IP, the IP may be IPv6
+func SplitExtraHost(entry string) (string, string, error) {
+	host, ip, ok := strings.Cut(entry, ":")
+	if !ok || host == "" {
+		return "", "", fmt.Errorf("invalid extra host %s, expected HOST:IP", entry)
+	}
+	ip = strings.Trim(ip, "[]")
+	if net.ParseIP(ip) == nil {
+		return "", "", fmt.Errorf("invalid IP address %s of extra host %s", ip, host)
+	}
+
+	return host, ip, nil
+}
+
+// DNSArgs returns the docker run flags of the DNS configuration of a
+// workspace, nerdctl and podman understand them as well
+func DNSArgs(dns *provider.WorkspaceDNSConfig) []string {
+	if dns == nil {
+		return nil
+	}
+
+	args := []string{}
+	for _, extraHost := range dns.ExtraHosts {
+		host, ip, err := SplitExtraHost(extraHost)
+		if err != nil {
+			continue
+		}
+		args = append(args, "--add-host", host+":"+ip)
+	}
+	for _, server := range dns.Servers {
+		args = append(args, "--dns", server)
+	}
+	for _, search := range dns.Search {
+		args = append(args, "--dns-search", search)
+	}
+
+	return args
+}
@@ -7,11 +7,14 @@ import (
 	"io"
 	"strings"
 
+	"github.com/loft-sh/devpod/pkg/contentstore"
 	"github.com/loft-sh/devpod/pkg/devcontainer/build"
 	"github.com/loft-sh/devpod/pkg/devcontainer/buildkit"
 	"github.com/loft-sh/devpod/pkg/devcontainer/config"
 	"github.com/loft-sh/devpod/pkg/devcontainer/feature"
 	"github.com/loft-sh/devpod/pkg/docker"
+	"github.com/loft-sh/devpod/pkg/dockerfile"
+	"github.com/loft-sh/devpod/pkg/kerrors"
 	"github.com/loft-sh/devpod/pkg/provider"
 	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
@@ -52,6 +55,15 @@ func (d *dockerDriver) BuildDevContainer(
 		return nil, fmt.Errorf("you cannot build in this mode. Please run 'kled up' to rebuild the container")
 	}
 
+	// in offline mode the base image has to be loaded before building, as
+	// the builder would otherwise try to pull it
+	if contentstore.Offline() {
+		err := d.loadBaseImage(ctx, dockerfileContent, parsedConfig)
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	// get build options
 	buildOptions, err := build.NewOptions(dockerfilePath, dockerfileContent, parsedConfig, extendedBuildInfo, imageName, options, prebuildHash)
 	if err != nil {
@@ -85,7 +97,7 @@ func (d *dockerDriver) BuildDevContainer(
 				return nil, errors.Wrap(err, "buildx build")
 			}
 		} else {
-			return nil, fmt.Errorf("buildx is not available on your host. Use buildkit builder")
+			return nil, kerrors.New(kerrors.ProviderUnavailable, "buildx is not available on your host. Use buildkit builder").WithRemediation("Install the docker buildx plugin, or set agent.docker.builder to buildkit in the provider.")
 		}
 	case docker.DockerBuilderBuildKit:
 		d.Log.Info("Build with internal buildkit...")
@@ -202,3 +214,21 @@ func (d *dockerDriver) buildxBuild(ctx context.Context, writer io.Writer, platfo
 
 	return nil
 }
+
+func (d *dockerDriver) loadBaseImage(ctx context.Context, dockerfileContent string, parsedConfig *config.SubstitutedConfig) error {
+	parsedDockerfile, err := dockerfile.Parse(dockerfileContent)
+	if err != nil {
+		return errors.Wrap(err, "parse dockerfile")
+	}
+
+	baseImage := parsedDockerfile.FindBaseImage(parsedConfig.Config.GetArgs(), parsedConfig.Config.GetTarget())
+	if baseImage == "" {
+		return nil
+	}
+	_, err = d.Docker.InspectImage(ctx, baseImage, false)
+	if err == nil {
+		return nil
+	}
+
+	return d.loadFromContentStore(ctx, baseImage)
+}
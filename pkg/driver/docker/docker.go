@@ -13,13 +13,20 @@ import (
 	"strconv"
 	"strings"
 
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/v1/tarball"
 	"github.com/loft-sh/devpod/pkg/compose"
 	config2 "github.com/loft-sh/devpod/pkg/config"
+	"github.com/loft-sh/devpod/pkg/contentstore"
 	"github.com/loft-sh/devpod/pkg/devcontainer/config"
 	"github.com/loft-sh/devpod/pkg/docker"
 	"github.com/loft-sh/devpod/pkg/driver"
 	"github.com/loft-sh/devpod/pkg/ide/jetbrains"
+	"github.com/loft-sh/devpod/pkg/image"
+	"github.com/loft-sh/devpod/pkg/netpolicy"
+	"github.com/loft-sh/devpod/pkg/outbound"
 	provider2 "github.com/loft-sh/devpod/pkg/provider"
+	"github.com/loft-sh/devpod/pkg/registry"
 	"github.com/loft-sh/log"
 	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
@@ -51,6 +58,11 @@ func NewDockerDriver(workspaceInfo *provider2.AgentWorkspaceInfo, log log.Logger
 		return nil, err
 	}
 
+	volumes, err := newEncryptedVolumes(workspaceInfo, log)
+	if err != nil {
+		return nil, err
+	}
+
 	log.Debugf("Using docker command '%s'", dockerCommand)
 	return &dockerDriver{
 		Docker: &docker.DockerHelper{
@@ -60,7 +72,10 @@ func NewDockerDriver(workspaceInfo *provider2.AgentWorkspaceInfo, log log.Logger
 			Builder:       builder,
 			Log:           log,
 		},
-		Log: log,
+		Log:           log,
+		volumes:       volumes,
+		networkPolicy: workspaceInfo.Workspace.Network,
+		dns:           workspaceInfo.Workspace.DNS,
 	}, nil
 }
 
@@ -69,6 +84,15 @@ type dockerDriver struct {
 	Compose *compose.ComposeHelper
 
 	Log log.Logger
+
+	// volumes is set if volumes are encrypted
+	volumes *encryptedVolumes
+
+	// networkPolicy isolates the network of the workspace
+	networkPolicy *netpolicy.Policy
+
+	// dns holds custom hosts entries and name resolution of the workspace
+	dns *provider2.WorkspaceDNSConfig
 }
 
 func (d *dockerDriver) TargetArchitecture(ctx context.Context, workspaceId string) (string, error) {
@@ -80,7 +104,7 @@ func (d *dockerDriver) CommandDevContainer(ctx context.Context, workspaceId, use
 	if err != nil {
 		return err
 	} else if container == nil {
-		return fmt.Errorf("container not found")
+		return driver.ErrContainerNotFound
 	}
 
 	args := []string{"exec"}
@@ -102,9 +126,13 @@ func (d *dockerDriver) PushDevContainer(ctx context.Context, image string) error
 		image,
 	}
 
+	// inject registry credentials
+	dockerHelper, cleanup := d.withRegistryCredentials(ctx, image)
+	defer cleanup()
+
 	// run command
 	d.Log.Debugf("Running docker command: %s %s", d.Docker.DockerCommand, strings.Join(args, " "))
-	err := d.Docker.Run(ctx, args, nil, writer, writer)
+	err := dockerHelper.Run(ctx, args, nil, writer, writer)
 	if err != nil {
 		return errors.Wrap(err, "push image")
 	}
@@ -138,16 +166,19 @@ func (d *dockerDriver) DeleteDevContainer(ctx context.Context, workspaceId strin
 	container, err := d.FindDevContainer(ctx, workspaceId)
 	if err != nil {
 		return err
-	} else if container == nil {
-		return nil
+	} else if container != nil {
+		err = d.Docker.Remove(ctx, container.ID)
+		if err != nil {
+			return err
+		}
 	}
 
-	err = d.Docker.Remove(ctx, container.ID)
+	err = d.removeNetwork(ctx, workspaceId)
 	if err != nil {
 		return err
 	}
 
-	return nil
+	return d.removeEncryptedVolumes(ctx)
 }
 
 func (d *dockerDriver) StartDevContainer(ctx context.Context, workspaceId string) error {
@@ -155,7 +186,17 @@ func (d *dockerDriver) StartDevContainer(ctx context.Context, workspaceId string
 	if err != nil {
 		return err
 	} else if container == nil {
-		return fmt.Errorf("container not found")
+		return driver.ErrContainerNotFound
+	}
+
+	err = d.openEncryptedVolumes(ctx)
+	if err != nil {
+		return err
+	}
+
+	err = d.enforceNetwork(ctx, workspaceId)
+	if err != nil {
+		return err
 	}
 
 	return d.Docker.StartContainer(ctx, container.ID)
@@ -166,10 +207,15 @@ func (d *dockerDriver) StopDevContainer(ctx context.Context, workspaceId string)
 	if err != nil {
 		return err
 	} else if container == nil {
-		return fmt.Errorf("container not found")
+		return driver.ErrContainerNotFound
 	}
 
-	return d.Docker.Stop(ctx, container.ID)
+	err = d.Docker.Stop(ctx, container.ID)
+	if err != nil {
+		return err
+	}
+
+	return d.closeEncryptedVolumes(ctx)
 }
 
 func (d *dockerDriver) InspectImage(ctx context.Context, imageName string) (*config.ImageDetails, error) {
@@ -265,6 +311,20 @@ func (d *dockerDriver) RunDockerDevContainer(
 		}
 	}
 
+	// isolated network
+	network, err := d.ensureNetwork(ctx, workspaceId, parsedConfig.RunArgs)
+	if err != nil {
+		return err
+	} else if network != "" {
+		if len(parsedConfig.AppPort) > 0 && len(d.networkPolicy.Egress) == 0 {
+			d.Log.Warnf("The network of the workspace has no egress, appPort will not be published")
+		}
+		args = append(args, "--network", network)
+	}
+
+	// hosts and name resolution
+	args = append(args, driver.DNSArgs(d.dns)...)
+
 	// workspace mount
 	if options.WorkspaceMount != nil {
 		workspacePath := d.EnsurePath(options.WorkspaceMount)
@@ -307,6 +367,10 @@ func (d *dockerDriver) RunDockerDevContainer(
 	}
 
 	// mounts
+	err = d.ensureEncryptedVolumes(ctx, options)
+	if err != nil {
+		return err
+	}
 	for _, mount := range options.Mounts {
 		args = append(args, "--mount", mount.String())
 	}
@@ -575,15 +639,88 @@ func (d *dockerDriver) EnsureImage(
 	_, err := d.Docker.InspectImage(ctx, options.Image, false)
 	if err != nil {
 		d.Log.Infof("Image %s not found", options.Image)
+		if contentstore.Offline() {
+			return d.loadFromContentStore(ctx, options.Image)
+		} else if !outbound.Current().Empty() {
+			return d.pullThroughProxy(ctx, options.Image)
+		}
+
 		d.Log.Infof("Pulling image %s", options.Image)
 		writer := d.Log.Writer(logrus.DebugLevel, false)
 		defer writer.Close()
 
-		return d.Docker.Pull(ctx, options.Image, nil, writer, writer)
+		dockerHelper, cleanup := d.withRegistryCredentials(ctx, options.Image)
+		defer cleanup()
+
+		return dockerHelper.Pull(ctx, options.Image, nil, writer, writer)
 	}
 	return nil
 }
 
+// loadFromContentStore loads image from the offline content store into docker
+func (d *dockerDriver) loadFromContentStore(ctx context.Context, image string) error {
+	store, err := contentstore.Default()
+	if err != nil {
+		return err
+	}
+
+	archive, err := store.DockerArchive(image)
+	if err != nil {
+		return fmt.Errorf("offline mode: %w", err)
+	}
+	defer archive.Close()
+
+	d.Log.Infof("Loading image %s from content store", image)
+	writer := d.Log.Writer(logrus.DebugLevel, false)
+	defer writer.Close()
+
+	return d.Docker.Run(ctx, []string{"load"}, archive, writer, writer)
+}
+
+// pullThroughProxy pulls image with kled and loads it into docker. The docker
+// daemon doesn't use the proxy and CA bundle of the kled context, so pulling
+// with docker pull would fail behind a proxy the daemon doesn't know about.
+func (d *dockerDriver) pullThroughProxy(ctx context.Context, imageName string) error {
+	ref, err := name.ParseReference(imageName)
+	if err != nil {
+		return err
+	}
+
+	d.Log.Infof("Pulling image %s through proxy", imageName)
+	img, err := image.GetImageForArch(ctx, imageName, runtime.GOARCH)
+	if err != nil {
+		return err
+	}
+
+	reader, writer := io.Pipe()
+	go func() {
+		_ = writer.CloseWithError(tarball.Write(ref, img, writer))
+	}()
+	defer reader.Close()
+
+	logWriter := d.Log.Writer(logrus.DebugLevel, false)
+	defer logWriter.Close()
+
+	return d.Docker.Run(ctx, []string{"load"}, reader, logWriter, logWriter)
+}
+
+// withRegistryCredentials returns a docker helper that uses the credentials
+// from kled registry login for the registry of image, if there are any.
+func (d *dockerDriver) withRegistryCredentials(ctx context.Context, image string) (*docker.DockerHelper, func()) {
+	env, cleanup, err := registry.DockerConfigEnv(ctx, image)
+	if err != nil {
+		d.Log.Warnf("Error resolving registry credentials for image %s: %v", image, err)
+		return d.Docker, cleanup
+	} else if len(env) == 0 {
+		return d.Docker, cleanup
+	}
+
+	d.Log.Debugf("Using kled registry credentials for image %s", image)
+	dockerHelper := *d.Docker
+	dockerHelper.Environment = append(append([]string{}, d.Docker.Environment...), env...)
+	return &dockerHelper, cleanup
+}
+
 func (d *dockerDriver) EnsurePath(path *config.Mount) *config.Mount {
 	// in case of local windows and remote linux tcp, we need to manually do the path conversion
 	if runtime.GOOS == "windows" {
@@ -610,7 +747,7 @@ func (d *dockerDriver) GetDevContainerLogs(ctx context.Context, workspaceId stri
 	if err != nil {
 		return err
 	} else if container == nil {
-		return fmt.Errorf("container not found")
+		return driver.ErrContainerNotFound
 	}
 
 	return d.Docker.GetContainerLogs(ctx, container.ID, stdout, stderr)
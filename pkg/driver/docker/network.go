@@ -0,0 +1,80 @@
+package docker
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/loft-sh/devpod/pkg/netpolicy"
+)
+
+// ensureNetwork creates the network of an isolated workspace and returns its
+// name, or an empty name if the workspace isn't isolated
+func (d *dockerDriver) ensureNetwork(ctx context.Context, workspaceId string, runArgs []string) (string, error) {
+	if !d.networkPolicy.Enabled() {
+		return "", nil
+	}
+	for _, arg := range runArgs {
+		if arg == "--network" || arg == "--net" || strings.HasPrefix(arg, "--network=") || strings.HasPrefix(arg, "--net=") {
+			return "", fmt.Errorf("the runArgs of an isolated workspace can't set the network")
+		}
+	}
+
+	network := netpolicy.NewNetwork(workspaceId, d.networkPolicy, d.Log)
+	if !d.networkExists(ctx, network.Name) {
+		d.Log.Infof("Create isolated network %s", network.Name)
+		err := d.Docker.Run(ctx, network.CreateArgs(workspaceId), nil, nil, nil)
+		if err != nil {
+			return "", fmt.Errorf("create network %s: %w", network.Name, err)
+		}
+	}
+
+	stdout := &bytes.Buffer{}
+	err := d.Docker.Run(ctx, []string{"network", "inspect", "--format", "{{.EnableIPv6}}", network.Name}, nil, stdout, nil)
+	if err != nil {
+		return "", fmt.Errorf("inspect network %s: %w", network.Name, err)
+	}
+	err = network.CheckIPv6(strings.TrimSpace(stdout.String()) == "true")
+	if err != nil {
+		return "", err
+	}
+
+	return network.Name, network.Enforce(ctx)
+}
+
+// enforceNetwork updates the egress rules of an isolated workspace with the
+// current addresses of its allowlist
+func (d *dockerDriver) enforceNetwork(ctx context.Context, workspaceId string) error {
+	if !d.networkPolicy.Enabled() {
+		return nil
+	}
+
+	return netpolicy.NewNetwork(workspaceId, d.networkPolicy, d.Log).Enforce(ctx)
+}
+
+// removeNetwork removes the network of an isolated workspace and its egress
+// rules
+func (d *dockerDriver) removeNetwork(ctx context.Context, workspaceId string) error {
+	if !d.networkPolicy.Enabled() {
+		return nil
+	}
+
+	network := netpolicy.NewNetwork(workspaceId, d.networkPolicy, d.Log)
+	err := network.Cleanup(ctx)
+	if err != nil {
+		return err
+	}
+	if d.networkExists(ctx, network.Name) {
+		err = d.Docker.Run(ctx, []string{"network", "rm", network.Name}, nil, nil, nil)
+		if err != nil {
+			return fmt.Errorf("remove network %s: %w", network.Name, err)
+		}
+	}
+
+	return nil
+}
+
+func (d *dockerDriver) networkExists(ctx context.Context, name string) bool {
+	return d.Docker.Run(ctx, []string{"network", "inspect", name}, nil, nil, nil) == nil
+}
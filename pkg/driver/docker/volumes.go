@@ -0,0 +1,171 @@
+package docker
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+
+	"github.com/docker/go-units"
+	"github.com/loft-sh/devpod/pkg/driver"
+	provider2 "github.com/loft-sh/devpod/pkg/provider"
+	"github.com/loft-sh/devpod/pkg/volumecrypt"
+	"github.com/loft-sh/log"
+)
+
+// DefaultVolumeSize is the size of an encrypted volume if the provider
+// doesn't set one
+const DefaultVolumeSize = "20Gi"
+
+// EncryptedVolumeLabel marks the docker volumes backed by encrypted images
+const EncryptedVolumeLabel = "kled.sh/encrypted"
+
+// encryptedVolumes holds the encrypted images of the volumes of a workspace.
+// Only volume mounts are encrypted: the workspace content is a bind mount of
+// a folder on the machine and is not encrypted, nor are other bind mounts
+type encryptedVolumes struct {
+	manager *volumecrypt.Manager
+	size    int64
+}
+
+// NewVolumeManager returns the manager of the encrypted volumes of a
+// workspace, kept in its folder on the machine, or nil if the provider
+// doesn't encrypt volumes
+func NewVolumeManager(workspaceInfo *provider2.AgentWorkspaceInfo, log log.Logger) (*volumecrypt.Manager, error) {
+	encrypt, err := workspaceInfo.Agent.Docker.EncryptVolumes.Bool()
+	if err != nil || !encrypt {
+		return nil, nil
+	}
+	keys, err := volumecrypt.NewVaultTransit(workspaceInfo.Agent.Docker.VolumeKey)
+	if err != nil {
+		return nil, err
+	}
+	return volumecrypt.NewManager(filepath.Join(workspaceInfo.Origin, "volumes"), keys, log), nil
+}
+
+func newEncryptedVolumes(workspaceInfo *provider2.AgentWorkspaceInfo, log log.Logger) (*encryptedVolumes, error) {
+	manager, err := NewVolumeManager(workspaceInfo, log)
+	if err != nil || manager == nil {
+		return nil, err
+	}
+
+	size := workspaceInfo.Agent.Docker.VolumeSize
+	if size == "" {
+		size = DefaultVolumeSize
+	}
+	sizeBytes, err := units.RAMInBytes(size)
+	if err != nil {
+		return nil, fmt.Errorf("parse volume size %s: %w", size, err)
+	}
+	return &encryptedVolumes{manager: manager, size: sizeBytes}, nil
+}
+
+// ensureEncryptedVolumes creates or opens the encrypted images of the
+// volume mounts and the docker volumes bound to them
+func (d *dockerDriver) ensureEncryptedVolumes(ctx context.Context, options *driver.RunOptions) error {
+	if d.volumes == nil {
+		return nil
+	}
+
+	for _, mount := range options.Mounts {
+		if mount.Type != "volume" || mount.Source == "" {
+			continue
+		}
+
+		var (
+			mountPath string
+			err       error
+		)
+		if d.volumes.manager.Exists(mount.Source) {
+			mountPath, err = d.volumes.manager.Open(ctx, mount.Source)
+		} else {
+			if d.volumeExists(ctx, mount.Source) {
+				d.Log.Warnf("Volume %s already exists unencrypted, it will not be encrypted", mount.Source)
+				continue
+			}
+			mountPath, err = d.volumes.manager.Create(ctx, mount.Source, d.volumes.size)
+		}
+		if err != nil {
+			return fmt.Errorf("encrypted volume %s: %w", mount.Source, err)
+		}
+
+		if d.volumeExists(ctx, mount.Source) {
+			continue
+		}
+		args := []string{
+			"volume", "create",
+			"--driver", "local",
+			"--opt", "type=none",
+			"--opt", "o=bind",
+			"--opt", "device=" + mountPath,
+			"--label", EncryptedVolumeLabel + "=true",
+			mount.Source,
+		}
+		if err := d.Docker.Run(ctx, args, nil, nil, nil); err != nil {
+			return fmt.Errorf("create docker volume %s: %w", mount.Source, err)
+		}
+	}
+	return nil
+}
+
+// openEncryptedVolumes unlocks the encrypted volumes, which are locked while
+// the workspace is stopped and after the machine restarted
+func (d *dockerDriver) openEncryptedVolumes(ctx context.Context) error {
+	if d.volumes == nil {
+		return nil
+	}
+	names, err := d.volumes.manager.Volumes()
+	if err != nil {
+		return err
+	}
+	for _, name := range names {
+		if _, err := d.volumes.manager.Open(ctx, name); err != nil {
+			return fmt.Errorf("encrypted volume %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// closeEncryptedVolumes locks the encrypted volumes of a stopped workspace,
+// so their contents aren't readable on the machine until it starts again
+func (d *dockerDriver) closeEncryptedVolumes(ctx context.Context) error {
+	if d.volumes == nil {
+		return nil
+	}
+	names, err := d.volumes.manager.Volumes()
+	if err != nil {
+		return err
+	}
+	for _, name := range names {
+		if err := d.volumes.manager.Close(ctx, name); err != nil {
+			return fmt.Errorf("encrypted volume %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// removeEncryptedVolumes removes the encrypted volumes with their docker
+// volumes, as their images are deleted with the workspace folder
+func (d *dockerDriver) removeEncryptedVolumes(ctx context.Context) error {
+	if d.volumes == nil {
+		return nil
+	}
+	names, err := d.volumes.manager.Volumes()
+	if err != nil {
+		return err
+	}
+	for _, name := range names {
+		if d.volumeExists(ctx, name) {
+			if err := d.Docker.Run(ctx, []string{"volume", "rm", name}, nil, nil, nil); err != nil {
+				return fmt.Errorf("remove docker volume %s: %w", name, err)
+			}
+		}
+		if err := d.volumes.manager.Remove(ctx, name); err != nil {
+			return fmt.Errorf("encrypted volume %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+func (d *dockerDriver) volumeExists(ctx context.Context, name string) bool {
+	return d.Docker.Run(ctx, []string{"volume", "inspect", name}, nil, nil, nil) == nil
+}
@@ -0,0 +1,133 @@
+package kata
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const (
+	// checkpointName is the name of the hibernation checkpoint of a container
+	// within its checkpoint folder
+	checkpointName = "hibernate"
+
+	// checkpointMetadataFile records which container the checkpoint belongs to
+	checkpointMetadataFile = "hibernate.json"
+)
+
+type checkpointMetadata struct {
+	ContainerID string    `json:"containerId"`
+	Checkpoint  string    `json:"checkpoint"`
+	CreatedAt   time.Time `json:"createdAt"`
+}
+
+// hibernate checkpoints the memory of the container to disk, which also stops
+// it. It returns false if hibernation is disabled or the checkpoint failed, in
+// which case the container is still running and needs a regular stop.
+func (d *kataDriver) hibernate(ctx context.Context, containerID string) bool {
+	if d.checkpointDir == "" {
+		return false
+	}
+
+	d.discardCheckpoint(containerID)
+	dir := d.containerCheckpointDir(containerID)
+	err := os.MkdirAll(dir, 0o700)
+	if err != nil {
+		d.Log.Warnf("Error creating checkpoint folder, stopping without hibernation: %v", err)
+		return false
+	}
+
+	d.Log.Infof("Hibernate workspace container %s", containerID)
+	stderr := &bytes.Buffer{}
+	args := []string{"checkpoint", "create", "--checkpoint-dir", dir, containerID, checkpointName}
+	err = d.runContainerdCommand(ctx, args, nil, nil, stderr)
+	if err != nil {
+		d.Log.Warnf("Error checkpointing container, stopping without hibernation: %v: %s", err, stderr.String())
+		d.discardCheckpoint(containerID)
+		return false
+	}
+
+	out, err := json.Marshal(&checkpointMetadata{
+		ContainerID: containerID,
+		Checkpoint:  checkpointName,
+		CreatedAt:   time.Now(),
+	})
+	if err == nil {
+		err = os.WriteFile(filepath.Join(dir, checkpointMetadataFile), out, 0o600)
+	}
+	if err != nil {
+		// the container is stopped already, the next start is a cold one
+		d.Log.Warnf("Error saving checkpoint metadata: %v", err)
+		d.discardCheckpoint(containerID)
+	}
+
+	return true
+}
+
+// resume restores the container from its hibernation checkpoint. It returns
+// false if there is no checkpoint of the container or restoring it failed, in
+// which case the container needs a regular start. The checkpoint is removed
+// either way so that a broken checkpoint can't block later starts.
+func (d *kataDriver) resume(ctx context.Context, containerID string) bool {
+	if d.checkpointDir == "" {
+		return false
+	}
+
+	metadata := d.checkpoint(containerID)
+	if metadata == nil {
+		return false
+	}
+	defer d.discardCheckpoint(containerID)
+	if metadata.ContainerID != containerID {
+		d.Log.Debugf("Discard checkpoint of container %s", metadata.ContainerID)
+		return false
+	}
+
+	d.Log.Infof("Resume workspace container %s from checkpoint of %s", containerID, metadata.CreatedAt.Format(time.RFC3339))
+	stderr := &bytes.Buffer{}
+	args := []string{"start", "--checkpoint", metadata.Checkpoint, "--checkpoint-dir", d.containerCheckpointDir(containerID), containerID}
+	err := d.runContainerdCommand(ctx, args, nil, nil, stderr)
+	if err != nil {
+		d.Log.Warnf("Error restoring checkpoint, starting workspace container without it: %v: %s", err, stderr.String())
+		return false
+	}
+
+	return true
+}
+
+// containerCheckpointDir returns the folder holding the hibernation
+// checkpoint of a container. The checkpoint dir may be shared by all
+// workspaces of a provider, so every container gets a folder of its own.
+func (d *kataDriver) containerCheckpointDir(containerID string) string {
+	return filepath.Join(d.checkpointDir, filepath.Base(containerID))
+}
+
+// checkpoint returns the metadata of the hibernation checkpoint of a
+// container or nil if there is none
+func (d *kataDriver) checkpoint(containerID string) *checkpointMetadata {
+	out, err := os.ReadFile(filepath.Join(d.containerCheckpointDir(containerID), checkpointMetadataFile))
+	if err != nil {
+		return nil
+	}
+
+	metadata := &checkpointMetadata{}
+	err = json.Unmarshal(out, metadata)
+	if err != nil || metadata.ContainerID == "" || metadata.Checkpoint == "" {
+		return nil
+	}
+
+	return metadata
+}
+
+// discardCheckpoint removes the hibernation checkpoint of a container and
+// its metadata
+func (d *kataDriver) discardCheckpoint(containerID string) {
+	if d.checkpointDir == "" || containerID == "" {
+		return
+	}
+
+	_ = os.RemoveAll(d.containerCheckpointDir(containerID))
+}
@@ -0,0 +1,144 @@
+package kata
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/loft-sh/log"
+)
+
+// fakeContainerd records the commands of a driver and writes checkpoints like
+// containerd does
+type fakeContainerd struct {
+	commands [][]string
+
+	// failRestore fails starts from a checkpoint
+	failRestore bool
+}
+
+func (f *fakeContainerd) run(ctx context.Context, env []string, args []string, stdin io.Reader, stdout io.Writer, stderr io.Writer) error {
+	f.commands = append(f.commands, args)
+	switch {
+	case slices.Equal(args[:2], []string{"checkpoint", "create"}):
+		// checkpoint create --checkpoint-dir <dir> <container> <name>
+		checkpoint := filepath.Join(args[3], args[5])
+		if err := os.MkdirAll(checkpoint, 0o700); err != nil {
+			return err
+		}
+		return os.WriteFile(filepath.Join(checkpoint, "pages.img"), []byte(args[4]), 0o600)
+	case args[0] == "start" && f.failRestore:
+		return errors.New("restore failed")
+	}
+	return nil
+}
+
+func newHibernatingDriver(checkpointDir string, containerd *fakeContainerd) *kataDriver {
+	return &kataDriver{
+		Log:           log.Discard,
+		checkpointDir: checkpointDir,
+		runContainerd: containerd.run,
+	}
+}
+
+func TestHibernateSharedCheckpointDir(t *testing.T) {
+	dir := t.TempDir()
+	containerd := &fakeContainerd{}
+	workspaceA := newHibernatingDriver(dir, containerd)
+	workspaceB := newHibernatingDriver(dir, containerd)
+
+	if !workspaceA.hibernate(context.Background(), "container-a") || !workspaceB.hibernate(context.Background(), "container-b") {
+		t.Fatal("expected both containers to hibernate")
+	}
+	for _, containerID := range []string{"container-a", "container-b"} {
+		pages, err := os.ReadFile(filepath.Join(dir, containerID, checkpointName, "pages.img"))
+		if err != nil || string(pages) != containerID {
+			t.Fatalf("checkpoint of %s was overwritten: %q, %v", containerID, pages, err)
+		}
+	}
+
+	if !workspaceB.resume(context.Background(), "container-b") {
+		t.Fatal("expected container-b to resume from its checkpoint")
+	}
+	want := []string{"start", "--checkpoint", checkpointName, "--checkpoint-dir", filepath.Join(dir, "container-b"), "container-b"}
+	if last := containerd.commands[len(containerd.commands)-1]; !slices.Equal(last, want) {
+		t.Fatalf("resumed with %q, want %q", last, want)
+	}
+	if workspaceB.checkpoint("container-b") != nil {
+		t.Fatal("expected the checkpoint of container-b to be removed after resuming")
+	}
+
+	if workspaceA.checkpoint("container-a") == nil {
+		t.Fatal("resuming container-b removed the checkpoint of container-a")
+	}
+	if !workspaceA.resume(context.Background(), "container-a") {
+		t.Fatal("expected container-a to resume from its checkpoint")
+	}
+}
+
+func TestResumeDiscardsCheckpointOfAnotherContainer(t *testing.T) {
+	dir := t.TempDir()
+	containerd := &fakeContainerd{}
+	driver := newHibernatingDriver(dir, containerd)
+	if !driver.hibernate(context.Background(), "container-a") || !driver.hibernate(context.Background(), "container-b") {
+		t.Fatal("expected both containers to hibernate")
+	}
+
+	// the metadata of container-a claims the checkpoint of another container
+	out, err := json.Marshal(&checkpointMetadata{ContainerID: "container-c", Checkpoint: checkpointName})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "container-a", checkpointMetadataFile), out, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	commands := len(containerd.commands)
+	if driver.resume(context.Background(), "container-a") {
+		t.Fatal("expected container-a not to resume from the checkpoint of another container")
+	}
+	if len(containerd.commands) != commands {
+		t.Fatalf("expected no restore, ran %q", containerd.commands[commands:])
+	}
+	if _, err := os.Stat(filepath.Join(dir, "container-a")); !os.IsNotExist(err) {
+		t.Fatalf("expected the mismatched checkpoint to be removed: %v", err)
+	}
+	if driver.checkpoint("container-b") == nil {
+		t.Fatal("the mismatch removed the checkpoint of container-b")
+	}
+}
+
+func TestResumeFailedRestore(t *testing.T) {
+	dir := t.TempDir()
+	containerd := &fakeContainerd{failRestore: true}
+	driver := newHibernatingDriver(dir, containerd)
+	if !driver.hibernate(context.Background(), "container-a") {
+		t.Fatal("expected the container to hibernate")
+	}
+
+	if driver.resume(context.Background(), "container-a") {
+		t.Fatal("expected the failed restore to need a regular start")
+	}
+	if _, err := os.Stat(filepath.Join(dir, "container-a")); !os.IsNotExist(err) {
+		t.Fatalf("expected the broken checkpoint to be removed: %v", err)
+	}
+	if driver.resume(context.Background(), "container-a") {
+		t.Fatal("expected no checkpoint to resume from after the failed restore")
+	}
+}
+
+func TestHibernateDisabled(t *testing.T) {
+	containerd := &fakeContainerd{}
+	driver := newHibernatingDriver("", containerd)
+	if driver.hibernate(context.Background(), "container-a") || driver.resume(context.Background(), "container-a") {
+		t.Fatal("expected hibernation to be disabled without a checkpoint dir")
+	}
+	if len(containerd.commands) != 0 {
+		t.Fatalf("expected no containerd commands, ran %q", containerd.commands)
+	}
+}
@@ -9,6 +9,7 @@ import (
 	"os"
 	"os/exec"
 	"os/user"
+	"path/filepath"
 	"regexp"
 	"runtime"
 	"slices"
@@ -17,10 +18,13 @@ import (
 
 	"github.com/loft-sh/devpod/pkg/compose"
 	config2 "github.com/loft-sh/devpod/pkg/config"
+	"github.com/loft-sh/devpod/pkg/contentstore"
 	"github.com/loft-sh/devpod/pkg/devcontainer/config"
 	"github.com/loft-sh/devpod/pkg/driver"
 	"github.com/loft-sh/devpod/pkg/ide/jetbrains"
+	"github.com/loft-sh/devpod/pkg/netpolicy"
 	provider2 "github.com/loft-sh/devpod/pkg/provider"
+	"github.com/loft-sh/devpod/pkg/registry"
 	"github.com/loft-sh/log"
 	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
@@ -50,12 +54,23 @@ func NewKataDriver(workspaceInfo *provider2.AgentWorkspaceInfo, log log.Logger)
 		containerdCommand = workspaceInfo.Agent.Kata.ContainerdPath
 	}
 
+	checkpointDir := ""
+	if workspaceInfo.Agent.Kata.Hibernate == "true" {
+		checkpointDir = workspaceInfo.Agent.Kata.CheckpointDir
+		if checkpointDir == "" {
+			checkpointDir = filepath.Join(workspaceInfo.Origin, "checkpoints")
+		}
+	}
+
 	log.Debugf("Using kata command '%s' and containerd command '%s'", kataCommand, containerdCommand)
 	return &kataDriver{
 		KataCommand:      kataCommand,
 		ContainerdCommand: containerdCommand,
 		ContainerID:      workspaceInfo.Workspace.Source.Container,
 		Log:              log,
+		networkPolicy:    workspaceInfo.Workspace.Network,
+		dns:              workspaceInfo.Workspace.DNS,
+		checkpointDir:    checkpointDir,
 	}, nil
 }
 
@@ -66,6 +81,20 @@ type kataDriver struct {
 	Compose          *compose.ComposeHelper
 
 	Log log.Logger
+
+	// networkPolicy isolates the network of the workspace
+	networkPolicy *netpolicy.Policy
+
+	// dns holds custom hosts entries and name resolution of the workspace
+	dns *provider2.WorkspaceDNSConfig
+
+	// checkpointDir holds the hibernation checkpoints of the workspace, empty
+	// if hibernation is disabled
+	checkpointDir string
+
+	// runContainerd runs containerd commands instead of ContainerdCommand,
+	// for tests
+	runContainerd func(ctx context.Context, env []string, args []string, stdin io.Reader, stdout io.Writer, stderr io.Writer) error
 }
 
 func (d *kataDriver) TargetArchitecture(ctx context.Context, workspaceId string) (string, error) {
@@ -77,7 +106,7 @@ func (d *kataDriver) CommandDevContainer(ctx context.Context, workspaceId, user,
 	if err != nil {
 		return err
 	} else if container == nil {
-		return fmt.Errorf("container not found")
+		return driver.ErrContainerNotFound
 	}
 
 	args := []string{"exec"}
@@ -97,8 +126,11 @@ func (d *kataDriver) PushDevContainer(ctx context.Context, image string) error {
 		image,
 	}
 
+	env, cleanup := d.registryCredentialsEnv(ctx, image)
+	defer cleanup()
+
 	d.Log.Debugf("Running containerd command: %s %s", d.ContainerdCommand, strings.Join(args, " "))
-	err := d.runContainerdCommand(ctx, args, nil, writer, writer)
+	err := d.runContainerdCommandWithEnv(ctx, env, args, nil, writer, writer)
 	if err != nil {
 		return errors.Wrap(err, "push image")
 	}
@@ -129,12 +161,17 @@ func (d *kataDriver) DeleteDevContainer(ctx context.Context, workspaceId string)
 	container, err := d.FindDevContainer(ctx, workspaceId)
 	if err != nil {
 		return err
-	} else if container == nil {
-		return nil
+	} else if container != nil {
+		args := []string{"rm", "-f", container.ID}
+		err = d.runContainerdCommand(ctx, args, nil, nil, nil)
+		if err != nil {
+			return err
+		}
+
+		d.discardCheckpoint(container.ID)
 	}
 
-	args := []string{"rm", "-f", container.ID}
-	return d.runContainerdCommand(ctx, args, nil, nil, nil)
+	return d.removeNetwork(ctx, workspaceId)
 }
 
 func (d *kataDriver) StartDevContainer(ctx context.Context, workspaceId string) error {
@@ -142,7 +179,16 @@ func (d *kataDriver) StartDevContainer(ctx context.Context, workspaceId string)
 	if err != nil {
 		return err
 	} else if container == nil {
-		return fmt.Errorf("container not found")
+		return driver.ErrContainerNotFound
+	}
+
+	err = d.enforceNetwork(ctx, workspaceId)
+	if err != nil {
+		return err
+	}
+
+	if d.resume(ctx, container.ID) {
+		return nil
 	}
 
 	args := []string{"start", container.ID}
@@ -154,7 +200,11 @@ func (d *kataDriver) StopDevContainer(ctx context.Context, workspaceId string) e
 	if err != nil {
 		return err
 	} else if container == nil {
-		return fmt.Errorf("container not found")
+		return driver.ErrContainerNotFound
+	}
+
+	if d.hibernate(ctx, container.ID) {
+		return nil
 	}
 
 	args := []string{"stop", container.ID}
@@ -265,6 +315,14 @@ func (d *kataDriver) RunKataDevContainer(
 	args := []string{"run"}
 	args = append(args, "--runtime=kata-runtime")
 
+	network, err := d.ensureNetwork(ctx, workspaceId, parsedConfig.RunArgs)
+	if err != nil {
+		return err
+	} else if network != "" {
+		args = append(args, "--network", network)
+	}
+	args = append(args, driver.DNSArgs(d.dns)...)
+
 	for _, appPort := range parsedConfig.AppPort {
 		intPort, err := strconv.Atoi(appPort)
 		if err != nil {
@@ -371,13 +429,35 @@ func (d *kataDriver) EnsureImage(ctx context.Context, options *driver.RunOptions
 		return err
 	}
 
-	if strings.TrimSpace(stdout.String()) == "" {
+	if strings.TrimSpace(stdout.String()) == "" && contentstore.Offline() {
+		store, err := contentstore.Default()
+		if err != nil {
+			return err
+		}
+		archive, err := store.DockerArchive(options.Image)
+		if err != nil {
+			return fmt.Errorf("offline mode: %w", err)
+		}
+		defer archive.Close()
+
+		writer := d.Log.Writer(logrus.InfoLevel, false)
+		defer writer.Close()
+
+		d.Log.Infof("Loading image %s from content store...", options.Image)
+		err = d.runContainerdCommand(ctx, []string{"load"}, archive, writer, writer)
+		if err != nil {
+			return errors.Wrap(err, "load image")
+		}
+	} else if strings.TrimSpace(stdout.String()) == "" {
 		args = []string{"pull", options.Image}
 		writer := d.Log.Writer(logrus.InfoLevel, false)
 		defer writer.Close()
 		
+		env, cleanup := d.registryCredentialsEnv(ctx, options.Image)
+		defer cleanup()
+
 		d.Log.Infof("Pulling image %s...", options.Image)
-		err = d.runContainerdCommand(ctx, args, nil, writer, writer)
+		err = d.runContainerdCommandWithEnv(ctx, env, args, nil, writer, writer)
 		if err != nil {
 			return errors.Wrap(err, "pull image")
 		}
@@ -386,6 +466,17 @@ func (d *kataDriver) EnsureImage(ctx context.Context, options *driver.RunOptions
 	return nil
 }
 
+// registryCredentialsEnv points the containerd client to a docker config with
+// the credentials from kled registry login for the registry of image.
+func (d *kataDriver) registryCredentialsEnv(ctx context.Context, image string) ([]string, func()) {
+	env, cleanup, err := registry.DockerConfigEnv(ctx, image)
+	if err != nil {
+		d.Log.Warnf("Error resolving registry credentials for image %s: %v", image, err)
+		return nil, cleanup
+	}
+	return env, cleanup
+}
+
 func (d *kataDriver) EnsurePath(mount *driver.Mount) *driver.Mount {
 	if mount == nil {
 		return nil
@@ -399,7 +490,7 @@ func (d *kataDriver) GetDevContainerLogs(ctx context.Context, workspaceId string
 	if err != nil {
 		return err
 	} else if container == nil {
-		return fmt.Errorf("container not found")
+		return driver.ErrContainerNotFound
 	}
 
 	args := []string{"logs", container.ID}
@@ -407,7 +498,18 @@ func (d *kataDriver) GetDevContainerLogs(ctx context.Context, workspaceId string
 }
 
 func (d *kataDriver) runContainerdCommand(ctx context.Context, args []string, stdin io.Reader, stdout io.Writer, stderr io.Writer) error {
+	return d.runContainerdCommandWithEnv(ctx, nil, args, stdin, stdout, stderr)
+}
+
+func (d *kataDriver) runContainerdCommandWithEnv(ctx context.Context, env []string, args []string, stdin io.Reader, stdout io.Writer, stderr io.Writer) error {
+	if d.runContainerd != nil {
+		return d.runContainerd(ctx, env, args, stdin, stdout, stderr)
+	}
+
 	cmd := exec.CommandContext(ctx, d.ContainerdCommand, args...)
+	if len(env) > 0 {
+		cmd.Env = append(os.Environ(), env...)
+	}
 	cmd.Stdin = stdin
 	cmd.Stdout = stdout
 	cmd.Stderr = stderr
@@ -0,0 +1,71 @@
+package kata
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/loft-sh/devpod/pkg/netpolicy"
+)
+
+// ensureNetwork creates the network of an isolated workspace and returns its
+// name, or an empty name if the workspace isn't isolated. nerdctl doesn't
+// report whether IPv6 is enabled on a network, so unlike with docker a
+// network with IPv6 created by hand under the same name isn't rejected
+func (d *kataDriver) ensureNetwork(ctx context.Context, workspaceId string, runArgs []string) (string, error) {
+	if !d.networkPolicy.Enabled() {
+		return "", nil
+	}
+	for _, arg := range runArgs {
+		if arg == "--network" || arg == "--net" || strings.HasPrefix(arg, "--network=") || strings.HasPrefix(arg, "--net=") {
+			return "", fmt.Errorf("the runArgs of an isolated workspace can't set the network")
+		}
+	}
+
+	network := netpolicy.NewNetwork(workspaceId, d.networkPolicy, d.Log)
+	if !d.networkExists(ctx, network.Name) {
+		d.Log.Infof("Create isolated network %s", network.Name)
+		err := d.runContainerdCommand(ctx, network.CreateArgs(workspaceId), nil, nil, nil)
+		if err != nil {
+			return "", fmt.Errorf("create network %s: %w", network.Name, err)
+		}
+	}
+
+	return network.Name, network.Enforce(ctx)
+}
+
+// enforceNetwork updates the egress rules of an isolated workspace with the
+// current addresses of its allowlist
+func (d *kataDriver) enforceNetwork(ctx context.Context, workspaceId string) error {
+	if !d.networkPolicy.Enabled() {
+		return nil
+	}
+
+	return netpolicy.NewNetwork(workspaceId, d.networkPolicy, d.Log).Enforce(ctx)
+}
+
+// removeNetwork removes the network of an isolated workspace and its egress
+// rules
+func (d *kataDriver) removeNetwork(ctx context.Context, workspaceId string) error {
+	if !d.networkPolicy.Enabled() {
+		return nil
+	}
+
+	network := netpolicy.NewNetwork(workspaceId, d.networkPolicy, d.Log)
+	err := network.Cleanup(ctx)
+	if err != nil {
+		return err
+	}
+	if d.networkExists(ctx, network.Name) {
+		err = d.runContainerdCommand(ctx, []string{"network", "rm", network.Name}, nil, nil, nil)
+		if err != nil {
+			return fmt.Errorf("remove network %s: %w", network.Name, err)
+		}
+	}
+
+	return nil
+}
+
+func (d *kataDriver) networkExists(ctx context.Context, name string) bool {
+	return d.runContainerdCommand(ctx, []string{"network", "inspect", name}, nil, nil, nil) == nil
+}
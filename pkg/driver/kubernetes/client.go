@@ -6,6 +6,7 @@ import (
 	"io"
 	"os"
 
+	"github.com/loft-sh/devpod/pkg/kerrors"
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/kubernetes/scheme"
@@ -42,7 +43,7 @@ func NewClient(kubeConfig, kubeContext string) (*Client, string, error) {
 
 	clientConfig, err := config.ClientConfig()
 	if err != nil {
-		return nil, "", fmt.Errorf("failed to load kubernetes config: %w", err)
+		return nil, "", kerrors.Errorf(kerrors.ProviderUnavailable, "failed to load kubernetes config: %w", err).WithRemediation("Check your kubeconfig and the kubernetes context of the provider, e.g. with 'kubectl config current-context'.")
 	}
 
 	namespace, _, err := config.Namespace()
@@ -0,0 +1,46 @@
+package kubernetes
+
+import (
+	"github.com/loft-sh/devpod/pkg/driver"
+	provider2 "github.com/loft-sh/devpod/pkg/provider"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// setDNS adds the extra hosts of a workspace as host aliases and its DNS
+// servers and search domains to the pod config. Custom DNS servers replace
+// the cluster DNS, search domains alone are added to the ones of the cluster
+func setDNS(pod *corev1.Pod, dns *provider2.WorkspaceDNSConfig) {
+	if dns == nil {
+		return
+	}
+
+	for _, extraHost := range dns.ExtraHosts {
+		host, ip, err := driver.SplitExtraHost(extraHost)
+		if err != nil {
+			continue
+		}
+		found := false
+		for i := range pod.Spec.HostAliases {
+			if pod.Spec.HostAliases[i].IP == ip {
+				pod.Spec.HostAliases[i].Hostnames = append(pod.Spec.HostAliases[i].Hostnames, host)
+				found = true
+				break
+			}
+		}
+		if !found {
+			pod.Spec.HostAliases = append(pod.Spec.HostAliases, corev1.HostAlias{IP: ip, Hostnames: []string{host}})
+		}
+	}
+
+	if len(dns.Servers) == 0 && len(dns.Search) == 0 {
+		return
+	}
+	if pod.Spec.DNSConfig == nil {
+		pod.Spec.DNSConfig = &corev1.PodDNSConfig{}
+	}
+	if len(dns.Servers) > 0 {
+		pod.Spec.DNSPolicy = corev1.DNSNone
+		pod.Spec.DNSConfig.Nameservers = append(pod.Spec.DNSConfig.Nameservers, dns.Servers...)
+	}
+	pod.Spec.DNSConfig.Searches = append(pod.Spec.DNSConfig.Searches, dns.Search...)
+}
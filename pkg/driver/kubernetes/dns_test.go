@@ -0,0 +1,34 @@
+package kubernetes
+
+import (
+	"reflect"
+	"testing"
+
+	provider2 "github.com/loft-sh/devpod/pkg/provider"
+	corev1 "k8s.io/api/core/v1"
+)
+
+func TestSetDNS(t *testing.T) {
+	pod := &corev1.Pod{}
+	setDNS(pod, &provider2.WorkspaceDNSConfig{
+		ExtraHosts: []string{"git.corp.example.com:10.0.0.5", "registry.corp.example.com:10.0.0.5", "wiki.corp.example.com:10.0.0.6"},
+		Search:     []string{"corp.example.com"},
+	})
+
+	wantAliases := []corev1.HostAlias{
+		{IP: "10.0.0.5", Hostnames: []string{"git.corp.example.com", "registry.corp.example.com"}},
+		{IP: "10.0.0.6", Hostnames: []string{"wiki.corp.example.com"}},
+	}
+	if !reflect.DeepEqual(pod.Spec.HostAliases, wantAliases) {
+		t.Fatalf("expected host aliases %+v, got %+v", wantAliases, pod.Spec.HostAliases)
+	}
+	if pod.Spec.DNSPolicy != "" || !reflect.DeepEqual(pod.Spec.DNSConfig.Searches, []string{"corp.example.com"}) {
+		t.Fatalf("expected search domains on top of the cluster DNS, got %s %+v", pod.Spec.DNSPolicy, pod.Spec.DNSConfig)
+	}
+
+	pod = &corev1.Pod{}
+	setDNS(pod, &provider2.WorkspaceDNSConfig{Servers: []string{"10.0.0.53"}})
+	if pod.Spec.DNSPolicy != corev1.DNSNone || !reflect.DeepEqual(pod.Spec.DNSConfig.Nameservers, []string{"10.0.0.53"}) {
+		t.Fatalf("expected the DNS servers to replace the cluster DNS, got %s %+v", pod.Spec.DNSPolicy, pod.Spec.DNSConfig)
+	}
+}
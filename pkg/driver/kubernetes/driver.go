@@ -7,6 +7,7 @@ import (
 	"io"
 
 	"github.com/loft-sh/devpod/pkg/driver"
+	"github.com/loft-sh/devpod/pkg/netpolicy"
 	provider2 "github.com/loft-sh/devpod/pkg/provider"
 	"github.com/loft-sh/log"
 	perrors "github.com/pkg/errors"
@@ -39,8 +40,10 @@ func NewKubernetesDriver(workspaceInfo *provider2.AgentWorkspaceInfo, log log.Lo
 		client:    client,
 		namespace: namespace,
 
-		options: &options,
-		Log:     log,
+		options:       &options,
+		networkPolicy: workspaceInfo.Workspace.Network,
+		dns:           workspaceInfo.Workspace.DNS,
+		Log:           log,
 	}, nil
 }
 
@@ -51,6 +54,12 @@ type KubernetesDriver struct {
 
 	options *provider2.ProviderKubernetesDriverConfig
 	Log     log.Logger
+
+	// networkPolicy isolates the network of the workspace
+	networkPolicy *netpolicy.Policy
+
+	// dns holds custom hosts entries and name resolution of the workspace
+	dns *provider2.WorkspaceDNSConfig
 }
 
 func (k *KubernetesDriver) CanReprovision() bool {
@@ -108,6 +117,15 @@ func (k *KubernetesDriver) DeleteDevContainer(ctx context.Context, workspaceId s
 		return err
 	}
 
+	// delete network policy
+	if k.networkPolicy.Enabled() {
+		k.Log.Infof("Delete network policy '%s'...", workspaceId)
+		err = k.deleteNetworkPolicy(ctx, workspaceId)
+		if err != nil {
+			return err
+		}
+	}
+
 	// delete pvc
 	k.Log.Infof("Delete persistent volume claim '%s'...", workspaceId)
 	err = k.client.Client().CoreV1().PersistentVolumeClaims(k.namespace).Delete(ctx, workspaceId, metav1.DeleteOptions{
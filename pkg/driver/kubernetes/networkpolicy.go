@@ -0,0 +1,118 @@
+package kubernetes
+
+import (
+	"context"
+	"fmt"
+	"net"
+
+	"github.com/loft-sh/devpod/pkg/netpolicy"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/utils/ptr"
+)
+
+// ensureNetworkPolicy creates or updates the NetworkPolicy of an isolated
+// workspace with the current addresses of its allowlist, or deletes it if
+// the workspace isn't isolated anymore
+func (k *KubernetesDriver) ensureNetworkPolicy(ctx context.Context, id, uid string) error {
+	if !k.networkPolicy.Enabled() {
+		return k.deleteNetworkPolicy(ctx, id)
+	}
+
+	rules, err := k.networkPolicy.Resolve(ctx, net.DefaultResolver)
+	if err != nil {
+		return err
+	}
+	networkPolicy := buildNetworkPolicy(id, uid, rules)
+
+	existing, err := k.client.Client().NetworkingV1().NetworkPolicies(k.namespace).Get(ctx, id, metav1.GetOptions{})
+	if err != nil && !kerrors.IsNotFound(err) {
+		return fmt.Errorf("get network policy: %w", err)
+	} else if kerrors.IsNotFound(err) {
+		k.Log.Infof("Create Network Policy '%s'", id)
+		_, err = k.client.Client().NetworkingV1().NetworkPolicies(k.namespace).Create(ctx, networkPolicy, metav1.CreateOptions{})
+		if err != nil {
+			return fmt.Errorf("create network policy: %w", err)
+		}
+
+		return nil
+	}
+
+	existing.Labels = networkPolicy.Labels
+	existing.Spec = networkPolicy.Spec
+	_, err = k.client.Client().NetworkingV1().NetworkPolicies(k.namespace).Update(ctx, existing, metav1.UpdateOptions{})
+	if err != nil {
+		return fmt.Errorf("update network policy: %w", err)
+	}
+
+	return nil
+}
+
+// deleteNetworkPolicy deletes the NetworkPolicy of a workspace. Missing
+// permissions are ignored, as workspaces that were never isolated don't have
+// one
+func (k *KubernetesDriver) deleteNetworkPolicy(ctx context.Context, id string) error {
+	err := k.client.Client().NetworkingV1().NetworkPolicies(k.namespace).Delete(ctx, id, metav1.DeleteOptions{})
+	if err != nil && !kerrors.IsNotFound(err) && !kerrors.IsForbidden(err) {
+		return fmt.Errorf("delete network policy: %w", err)
+	}
+
+	return nil
+}
+
+// buildNetworkPolicy denies all ingress to the workspace pod and allows
+// egress only to the cluster DNS and the rules. kled itself reaches the pod
+// through the API server, which isn't affected by the policy
+func buildNetworkPolicy(id, uid string, rules []netpolicy.Rule) *networkingv1.NetworkPolicy {
+	labels := map[string]string{
+		KledWorkspaceUIDLabel: uid,
+	}
+	for k, v := range ExtraKledLabels {
+		labels[k] = v
+	}
+
+	// host names of the allowlist are resolved in the pod as well, by the
+	// cluster DNS only, so DNS can't be used to reach other destinations
+	egress := []networkingv1.NetworkPolicyEgressRule{{
+		To: []networkingv1.NetworkPolicyPeer{{
+			NamespaceSelector: &metav1.LabelSelector{
+				MatchLabels: map[string]string{"kubernetes.io/metadata.name": "kube-system"},
+			},
+			PodSelector: &metav1.LabelSelector{
+				MatchLabels: map[string]string{"k8s-app": "kube-dns"},
+			},
+		}},
+		Ports: []networkingv1.NetworkPolicyPort{
+			{Protocol: ptr.To(corev1.ProtocolUDP), Port: ptr.To(intstr.FromInt32(53))},
+			{Protocol: ptr.To(corev1.ProtocolTCP), Port: ptr.To(intstr.FromInt32(53))},
+		},
+	}}
+	for _, rule := range rules {
+		egressRule := networkingv1.NetworkPolicyEgressRule{
+			To: []networkingv1.NetworkPolicyPeer{{IPBlock: &networkingv1.IPBlock{CIDR: rule.CIDR}}},
+		}
+		if rule.Port != 0 {
+			egressRule.Ports = []networkingv1.NetworkPolicyPort{
+				{Protocol: ptr.To(corev1.ProtocolTCP), Port: ptr.To(intstr.FromInt32(int32(rule.Port)))},
+			}
+		}
+		egress = append(egress, egressRule)
+	}
+
+	return &networkingv1.NetworkPolicy{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   id,
+			Labels: labels,
+		},
+		Spec: networkingv1.NetworkPolicySpec{
+			PodSelector: metav1.LabelSelector{
+				MatchLabels: map[string]string{KledWorkspaceUIDLabel: uid},
+			},
+			PolicyTypes: []networkingv1.PolicyType{networkingv1.PolicyTypeIngress, networkingv1.PolicyTypeEgress},
+			Egress:      egress,
+		},
+	}
+}
@@ -0,0 +1,49 @@
+package kubernetes
+
+import (
+	"testing"
+
+	"github.com/loft-sh/devpod/pkg/netpolicy"
+	networkingv1 "k8s.io/api/networking/v1"
+)
+
+func TestBuildNetworkPolicy(t *testing.T) {
+	policy := buildNetworkPolicy("kled-my-workspace", "my-uid", []netpolicy.Rule{
+		{CIDR: "10.0.0.0/8"},
+		{CIDR: "203.0.113.10/32", Port: 443},
+	})
+
+	if policy.Name != "kled-my-workspace" || policy.Spec.PodSelector.MatchLabels[KledWorkspaceUIDLabel] != "my-uid" {
+		t.Fatalf("unexpected policy metadata: %+v", policy.ObjectMeta)
+	}
+	if len(policy.Spec.PolicyTypes) != 2 || len(policy.Spec.Ingress) != 0 {
+		t.Fatalf("expected ingress to be denied, got %+v", policy.Spec)
+	}
+
+	egress := policy.Spec.Egress
+	if len(egress) != 3 {
+		t.Fatalf("expected a DNS rule and 2 egress rules, got %d", len(egress))
+	}
+	if egress[0].Ports[0].Port.IntValue() != 53 {
+		t.Fatalf("expected DNS to be allowed, got %+v", egress[0])
+	}
+	if len(egress[0].To) != 1 || egress[0].To[0].IPBlock != nil ||
+		egress[0].To[0].NamespaceSelector.MatchLabels["kubernetes.io/metadata.name"] != "kube-system" ||
+		egress[0].To[0].PodSelector.MatchLabels["k8s-app"] != "kube-dns" {
+		t.Fatalf("expected DNS to be allowed to the cluster DNS only, got %+v", egress[0].To)
+	}
+	assertEgress(t, egress[1], "10.0.0.0/8", 0)
+	assertEgress(t, egress[2], "203.0.113.10/32", 443)
+}
+
+func assertEgress(t *testing.T, rule networkingv1.NetworkPolicyEgressRule, cidr string, port int) {
+	t.Helper()
+	if len(rule.To) != 1 || rule.To[0].IPBlock == nil || rule.To[0].IPBlock.CIDR != cidr {
+		t.Fatalf("expected egress to %s, got %+v", cidr, rule.To)
+	}
+	if port == 0 && len(rule.Ports) != 0 {
+		t.Fatalf("expected all ports to %s, got %+v", cidr, rule.Ports)
+	} else if port != 0 && (len(rule.Ports) != 1 || rule.Ports[0].Port.IntValue() != port) {
+		t.Fatalf("expected port %d to %s, got %+v", port, cidr, rule.Ports)
+	}
+}
@@ -50,6 +50,9 @@ func (k *KubernetesDriver) buildPersistentVolumeClaim(
 	if k.options.StorageClass != "" {
 		storageClassName = &k.options.StorageClass
 	}
+	if k.options.EncryptedStorageClass != "" {
+		storageClassName = &k.options.EncryptedStorageClass
+	}
 	accessMode := []corev1.PersistentVolumeAccessMode{corev1.ReadWriteOnce}
 	if k.options.PvcAccessMode != "" {
 		switch k.options.PvcAccessMode {
@@ -71,6 +74,9 @@ func (k *KubernetesDriver) buildPersistentVolumeClaim(
 	for k, v := range ExtraKledLabels {
 		labels[k] = v
 	}
+	if k.options.EncryptedStorageClass != "" {
+		labels[KledEncryptedLabel] = "true"
+	}
 
 	annotations := map[string]string{}
 	annotations[KledInfoAnnotation] = containerInfo
@@ -25,6 +25,7 @@ const (
 	KledCreatedLabel      = "kled.sh/created"
 	KledWorkspaceLabel    = "kled.sh/workspace"
 	KledWorkspaceUIDLabel = "kled.sh/workspace-uid"
+	KledEncryptedLabel    = "kled.sh/encrypted"
 
 	KledInfoAnnotation                   = "kled.sh/info"
 	KledLastAppliedAnnotation            = "kled.sh/last-applied-configuration"
@@ -180,6 +181,9 @@ func (k *KubernetesDriver) runContainer(
 		return err
 	}
 	labels[KledWorkspaceUIDLabel] = options.UID
+	if expiresAt, ok := config.ListToObject(options.Labels)[provider2.ExpiresAtLabel]; ok {
+		labels[provider2.ExpiresAtLabel] = expiresAt
+	}
 
 	// node selector
 	nodeSelector, err := getNodeSelector(pod, k.options.NodeSelector)
@@ -205,6 +209,12 @@ func (k *KubernetesDriver) runContainer(
 		}
 	}
 
+	// isolate the network
+	err = k.ensureNetworkPolicy(ctx, id, options.UID)
+	if err != nil {
+		return err
+	}
+
 	// create the pod manifest
 	pod.ObjectMeta.Name = id
 	pod.ObjectMeta.Labels = labels
@@ -214,6 +224,7 @@ func (k *KubernetesDriver) runContainer(
 	pod.Spec.InitContainers = initContainers
 	pod.Spec.Containers = getContainers(pod, options.Image, options.Entrypoint, options.Cmd, envVars, volumeMounts, capabilities, resources, options.Privileged, k.options.StrictSecurity)
 	pod.Spec.Volumes = getVolumes(pod, id)
+	setDNS(pod, k.dns)
 	// avoids a problem where attaching volumes with large repositories would cause an extremely long pod startup time
 	// because changing the ownership of all files takes longer than the kubelet expects it to
 	if pod.Spec.SecurityContext == nil {
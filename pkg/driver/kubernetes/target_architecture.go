@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 
+	klederrors "github.com/loft-sh/devpod/pkg/kerrors"
 	kerrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
@@ -20,7 +21,7 @@ func (k *KubernetesDriver) TargetArchitecture(ctx context.Context, workspaceId s
 	nodes, err := k.client.Client().CoreV1().Nodes().List(ctx, metav1.ListOptions{})
 	if err != nil {
 		if kerrors.IsForbidden(err) {
-			return "", fmt.Errorf("you don't have permission to list nodes in the Kubernetes cluster, please set the cluster architecture manually via provider options")
+			return "", klederrors.New(klederrors.PermissionDenied, "you don't have permission to list nodes in the Kubernetes cluster, please set the cluster architecture manually via provider options").WithRemediation("Set agent.kubernetes.architecture in the provider, e.g. to amd64.")
 		}
 
 		return "", fmt.Errorf("list nodes: %w", err)
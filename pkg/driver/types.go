@@ -5,8 +5,13 @@ import (
 	"io"
 
 	"github.com/loft-sh/devpod/pkg/devcontainer/config"
+	"github.com/loft-sh/devpod/pkg/kerrors"
 )
 
+// ErrContainerNotFound is returned by drivers for workspaces without a
+// devcontainer
+var ErrContainerNotFound = kerrors.New(kerrors.NotFound, "container not found")
+
 type Driver interface {
 	// FindDevContainer returns a running devcontainer details
 	FindDevContainer(ctx context.Context, workspaceID string) (*config.ContainerDetails, error)
@@ -0,0 +1,207 @@
+package filesync
+
+import (
+	"archive/tar"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// WriteArchive writes the given paths below root as a tar stream.
+// Directories are written without their contents. Paths that vanished
+// since the scan are skipped, the next sync picks up the deletion.
+func WriteArchive(w io.Writer, root string, paths []string) error {
+	tw := tar.NewWriter(w)
+	for _, name := range paths {
+		fullPath, err := securePath(root, name)
+		if err != nil {
+			return err
+		}
+
+		info, err := os.Lstat(fullPath)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		} else if err != nil {
+			return err
+		}
+
+		link := ""
+		if info.Mode()&fs.ModeSymlink != 0 {
+			if link, err = os.Readlink(fullPath); err != nil {
+				return err
+			}
+		}
+		header, err := tar.FileInfoHeader(info, link)
+		if err != nil {
+			return err
+		}
+		header.Name = name
+		header.Uname, header.Gname, header.Uid, header.Gid = "", "", 0, 0
+		if err := tw.WriteHeader(header); err != nil {
+			return err
+		}
+
+		if info.Mode().IsRegular() {
+			if err := copyFile(tw, fullPath, header.Size); err != nil {
+				return fmt.Errorf("write %s: %w", name, err)
+			}
+		}
+	}
+
+	return tw.Close()
+}
+
+func copyFile(w io.Writer, fullPath string, size int64) error {
+	f, err := os.Open(fullPath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	// the header is written already, pad or cut a file that changed size
+	n, err := io.Copy(w, io.LimitReader(f, size))
+	if err != nil {
+		return err
+	}
+	if n < size {
+		_, err = w.Write(make([]byte, size-n))
+	}
+	return err
+}
+
+// ExtractArchive applies a tar stream written by WriteArchive to root. An
+// existing entry of a different type is replaced.
+func ExtractArchive(r io.Reader, root string) error {
+	tr := tar.NewReader(r)
+	dirTimes := map[string]time.Time{}
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return err
+		}
+
+		fullPath, err := securePath(root, header.Name)
+		if err != nil {
+			return err
+		}
+		if err := os.MkdirAll(filepath.Dir(fullPath), 0o755); err != nil {
+			return err
+		}
+		if existing, err := os.Lstat(fullPath); err == nil && (existing.IsDir() != (header.Typeflag == tar.TypeDir) || existing.Mode()&fs.ModeSymlink != 0) {
+			if err := os.RemoveAll(fullPath); err != nil {
+				return err
+			}
+		}
+
+		mode := fs.FileMode(header.Mode).Perm()
+		switch header.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(fullPath, mode); err != nil {
+				return err
+			}
+			if err := os.Chmod(fullPath, mode); err != nil {
+				return err
+			}
+			dirTimes[fullPath] = header.ModTime
+			continue
+		case tar.TypeSymlink:
+			if err := os.Symlink(header.Linkname, fullPath); err != nil {
+				return err
+			}
+			continue
+		case tar.TypeReg:
+			if err := writeFile(tr, fullPath, mode); err != nil {
+				return fmt.Errorf("extract %s: %w", header.Name, err)
+			}
+		default:
+			continue
+		}
+
+		if err := os.Chtimes(fullPath, header.ModTime, header.ModTime); err != nil {
+			return err
+		}
+	}
+
+	// directory times change while their contents are written
+	for dir, modTime := range dirTimes {
+		_ = os.Chtimes(dir, modTime, modTime)
+	}
+	return nil
+}
+
+// writeFile replaces the file atomically, so editors and watchers never see
+// a partial file.
+func writeFile(r io.Reader, fullPath string, mode fs.FileMode) error {
+	tmp, err := os.CreateTemp(filepath.Dir(fullPath), ".kled-sync-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := io.Copy(tmp, r); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), mode); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), fullPath)
+}
+
+// DeletePaths removes the given paths below root. Directories are only
+// removed when empty, they may still hold ignored files.
+func DeletePaths(root string, paths []string) error {
+	for _, name := range paths {
+		fullPath, err := securePath(root, name)
+		if err != nil {
+			return err
+		}
+
+		info, err := os.Lstat(fullPath)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		} else if err != nil {
+			return err
+		}
+		if err := os.Remove(fullPath); err != nil && !info.IsDir() {
+			return err
+		}
+	}
+	return nil
+}
+
+// securePath resolves a slash separated relative path below root. It
+// rejects paths that leave root, also through symlinked parents.
+func securePath(root, name string) (string, error) {
+	cleaned := path.Clean("/" + name)[1:]
+	if cleaned == "" || cleaned != name {
+		return "", fmt.Errorf("invalid path %q", name)
+	}
+
+	parent := root
+	parts := strings.Split(cleaned, "/")
+	for _, part := range parts[:len(parts)-1] {
+		parent = filepath.Join(parent, part)
+		info, err := os.Lstat(parent)
+		if errors.Is(err, fs.ErrNotExist) {
+			break
+		} else if err != nil {
+			return "", err
+		} else if info.Mode()&fs.ModeSymlink != 0 {
+			return "", fmt.Errorf("invalid path %q: parent %s is a symlink", name, part)
+		}
+	}
+
+	return filepath.Join(root, filepath.FromSlash(cleaned)), nil
+}
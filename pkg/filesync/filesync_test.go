@@ -0,0 +1,177 @@
+package filesync
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/loft-sh/log"
+	"gotest.tools/assert"
+)
+
+type testSync struct {
+	local, remote string
+	session       *Session
+}
+
+func newTestSync(t *testing.T, strategy Strategy, ignore []string) *testSync {
+	t.Helper()
+	s := &testSync{local: t.TempDir(), remote: t.TempDir()}
+	session, err := NewSession(
+		&LocalReplica{Root: s.local},
+		&LocalReplica{Root: s.remote},
+		Options{Strategy: strategy, Ignore: ignore, StatePath: filepath.Join(t.TempDir(), "state.json")},
+		log.Discard,
+	)
+	assert.NilError(t, err)
+	s.session = session
+	return s
+}
+
+func (s *testSync) sync(t *testing.T) *Result {
+	t.Helper()
+	result, err := s.session.Sync(context.Background())
+	assert.NilError(t, err)
+	return result
+}
+
+func writeTestFile(t *testing.T, root, name, content string, modTime time.Time) {
+	t.Helper()
+	fullPath := filepath.Join(root, filepath.FromSlash(name))
+	assert.NilError(t, os.MkdirAll(filepath.Dir(fullPath), 0o755))
+	assert.NilError(t, os.WriteFile(fullPath, []byte(content), 0o644))
+	assert.NilError(t, os.Chtimes(fullPath, modTime, modTime))
+}
+
+func readTestFile(t *testing.T, root, name string) string {
+	t.Helper()
+	out, err := os.ReadFile(filepath.Join(root, filepath.FromSlash(name)))
+	assert.NilError(t, err)
+	return string(out)
+}
+
+func exists(root, name string) bool {
+	_, err := os.Lstat(filepath.Join(root, filepath.FromSlash(name)))
+	return err == nil
+}
+
+func TestSyncBothDirections(t *testing.T) {
+	s := newTestSync(t, StrategyManual, nil)
+	now := time.Now()
+	writeTestFile(t, s.local, "src/main.go", "package main", now)
+	writeTestFile(t, s.remote, "build/out.txt", "output", now)
+	assert.NilError(t, os.Symlink("main.go", filepath.Join(s.local, "src", "link.go")))
+
+	result := s.sync(t)
+	assert.Equal(t, result.Pushed, 3)
+	assert.Equal(t, result.Pulled, 2)
+	assert.Equal(t, readTestFile(t, s.remote, "src/main.go"), "package main")
+	assert.Equal(t, readTestFile(t, s.local, "build/out.txt"), "output")
+	target, err := os.Readlink(filepath.Join(s.remote, "src", "link.go"))
+	assert.NilError(t, err)
+	assert.Equal(t, target, "main.go")
+
+	result = s.sync(t)
+	assert.Assert(t, !result.Changed())
+
+	// edits and deletions are synced in both directions
+	writeTestFile(t, s.local, "src/main.go", "package main // edited", now.Add(time.Minute))
+	assert.NilError(t, os.RemoveAll(filepath.Join(s.remote, "build")))
+	result = s.sync(t)
+	assert.Equal(t, result.Pushed, 1)
+	assert.Equal(t, result.DeletedLocal, 2)
+	assert.Equal(t, readTestFile(t, s.remote, "src/main.go"), "package main // edited")
+	assert.Assert(t, !exists(s.local, "build"))
+}
+
+func TestSyncConflicts(t *testing.T) {
+	for _, tc := range []struct {
+		strategy Strategy
+		expected string
+		conflict bool
+	}{
+		{strategy: StrategyManual, conflict: true},
+		{strategy: StrategyLocal, expected: "local"},
+		{strategy: StrategyRemote, expected: "remote"},
+		{strategy: StrategyNewer, expected: "remote"},
+	} {
+		t.Run(string(tc.strategy), func(t *testing.T) {
+			s := newTestSync(t, tc.strategy, nil)
+			now := time.Now()
+			writeTestFile(t, s.local, "file.txt", "base", now)
+			s.sync(t)
+
+			writeTestFile(t, s.local, "file.txt", "local", now.Add(time.Minute))
+			writeTestFile(t, s.remote, "file.txt", "remote", now.Add(2*time.Minute))
+			result := s.sync(t)
+			if tc.conflict {
+				assert.Equal(t, len(result.Conflicts), 1)
+				assert.Equal(t, readTestFile(t, s.local, "file.txt"), "local")
+				assert.Equal(t, readTestFile(t, s.remote, "file.txt"), "remote")
+
+				// the conflict stays until one side is changed to match
+				assert.Equal(t, len(s.sync(t).Conflicts), 1)
+				return
+			}
+
+			assert.Equal(t, len(result.Conflicts), 0)
+			assert.Equal(t, readTestFile(t, s.local, "file.txt"), tc.expected)
+			assert.Equal(t, readTestFile(t, s.remote, "file.txt"), tc.expected)
+		})
+	}
+}
+
+func TestSyncFirstRunConflicts(t *testing.T) {
+	s := newTestSync(t, StrategyManual, nil)
+	now := time.Now()
+	writeTestFile(t, s.local, "same.txt", "same", now)
+	writeTestFile(t, s.remote, "same.txt", "same", now.Add(time.Hour))
+	writeTestFile(t, s.local, "different.txt", "local", now)
+	writeTestFile(t, s.remote, "different.txt", "remote", now)
+
+	result := s.sync(t)
+	assert.Equal(t, len(result.Conflicts), 1)
+	assert.Equal(t, result.Conflicts[0].Path, "different.txt")
+	assert.Assert(t, !result.Changed())
+}
+
+func TestSyncIgnore(t *testing.T) {
+	s := newTestSync(t, StrategyManual, []string{"node_modules", "*.log", "!keep.log"})
+	now := time.Now()
+	writeTestFile(t, s.local, "node_modules/dep/index.js", "dep", now)
+	writeTestFile(t, s.local, "debug.log", "log", now)
+	writeTestFile(t, s.local, "keep.log", "keep", now)
+	writeTestFile(t, s.remote, "node_modules/other/index.js", "other", now)
+
+	s.sync(t)
+	assert.Assert(t, !exists(s.remote, "node_modules/dep"))
+	assert.Assert(t, !exists(s.remote, "debug.log"))
+	assert.Assert(t, exists(s.remote, "keep.log"))
+	assert.Assert(t, !exists(s.local, "node_modules/other"))
+}
+
+func TestLoadIgnorePatterns(t *testing.T) {
+	root := t.TempDir()
+	writeTestFile(t, root, IgnoreFile, "# comment\n.git\n/dist\n", time.Now())
+
+	patterns, err := LoadIgnorePatterns(root, []string{"*.tmp"})
+	assert.NilError(t, err)
+	assert.DeepEqual(t, patterns, []string{".git", "dist", "*.tmp"})
+}
+
+func TestSecurePath(t *testing.T) {
+	root := t.TempDir()
+	outside := t.TempDir()
+	assert.NilError(t, os.Symlink(outside, filepath.Join(root, "escape")))
+
+	for _, name := range []string{"", "/etc/passwd", "../outside", "a/../../b", "a//b", "escape/file"} {
+		_, err := securePath(root, name)
+		assert.Assert(t, err != nil, "expected %q to be rejected", name)
+	}
+
+	fullPath, err := securePath(root, "a/b")
+	assert.NilError(t, err)
+	assert.Equal(t, fullPath, filepath.Join(root, "a", "b"))
+}
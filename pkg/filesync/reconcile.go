@@ -0,0 +1,209 @@
+package filesync
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Strategy decides which side wins when a path changed on both sides
+// since the last sync.
+type Strategy string
+
+const (
+	// StrategyManual reports conflicts and leaves both sides untouched.
+	StrategyManual Strategy = "manual"
+	StrategyLocal  Strategy = "local"
+	StrategyRemote Strategy = "remote"
+	// StrategyNewer keeps the side that was modified last. A deletion loses
+	// against a modification.
+	StrategyNewer Strategy = "newer"
+)
+
+var Strategies = []Strategy{StrategyManual, StrategyLocal, StrategyRemote, StrategyNewer}
+
+func ParseStrategy(value string) (Strategy, error) {
+	for _, strategy := range Strategies {
+		if string(strategy) == value {
+			return strategy, nil
+		}
+	}
+	return "", fmt.Errorf("unknown conflict strategy %q, choose one of %v", value, Strategies)
+}
+
+type Action string
+
+const (
+	ActionPush         Action = "push"
+	ActionPull         Action = "pull"
+	ActionDeleteLocal  Action = "delete-local"
+	ActionDeleteRemote Action = "delete-remote"
+)
+
+type Change struct {
+	Path   string `json:"path"`
+	Action Action `json:"action"`
+	// Entry is the entry being transferred, empty for deletions.
+	Entry Entry `json:"entry"`
+}
+
+// Conflict is a path that changed on both sides and was not resolved.
+type Conflict struct {
+	Path   string `json:"path"`
+	Local  *Entry `json:"local,omitempty"`
+	Remote *Entry `json:"remote,omitempty"`
+}
+
+type Plan struct {
+	Changes   []Change
+	Conflicts []Conflict
+}
+
+func (p Plan) Paths(action Action) []string {
+	paths := []string{}
+	for _, change := range p.Changes {
+		if change.Action == action {
+			paths = append(paths, change.Path)
+		}
+	}
+	return paths
+}
+
+func lookup(snapshot Snapshot, path string) *Entry {
+	if entry, ok := snapshot[path]; ok {
+		return &entry
+	}
+	return nil
+}
+
+func sameEntry(a, b *Entry) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	return a.Equal(*b)
+}
+
+// Reconcile compares both sides against the snapshot of the last sync and
+// returns the changes that bring them in sync. Without a base every path
+// that differs is a conflict.
+func Reconcile(base, local, remote Snapshot, strategy Strategy) Plan {
+	paths := map[string]bool{}
+	for _, snapshot := range []Snapshot{base, local, remote} {
+		for path := range snapshot {
+			paths[path] = true
+		}
+	}
+
+	plan := Plan{}
+	for path := range paths {
+		b, l, r := lookup(base, path), lookup(local, path), lookup(remote, path)
+		localChanged, remoteChanged := !sameEntry(b, l), !sameEntry(b, r)
+
+		switch {
+		case !localChanged && !remoteChanged, sameEntry(l, r):
+			continue
+		case localChanged && !remoteChanged:
+			plan.Changes = append(plan.Changes, takeLocal(path, l))
+		case remoteChanged && !localChanged:
+			plan.Changes = append(plan.Changes, takeRemote(path, r))
+		default:
+			// the contents of directories are reconciled separately
+			if l != nil && r != nil && l.IsDir() && r.IsDir() {
+				plan.Changes = append(plan.Changes, takeLocal(path, l))
+				continue
+			}
+
+			switch resolve(l, r, strategy) {
+			case StrategyLocal:
+				plan.Changes = append(plan.Changes, takeLocal(path, l))
+			case StrategyRemote:
+				plan.Changes = append(plan.Changes, takeRemote(path, r))
+			default:
+				plan.Conflicts = append(plan.Conflicts, Conflict{Path: path, Local: l, Remote: r})
+			}
+		}
+	}
+
+	sortChanges(plan.Changes)
+	sort.Slice(plan.Conflicts, func(i, j int) bool { return plan.Conflicts[i].Path < plan.Conflicts[j].Path })
+	return plan
+}
+
+func takeLocal(path string, local *Entry) Change {
+	if local == nil {
+		return Change{Path: path, Action: ActionDeleteRemote}
+	}
+	return Change{Path: path, Action: ActionPush, Entry: *local}
+}
+
+func takeRemote(path string, remote *Entry) Change {
+	if remote == nil {
+		return Change{Path: path, Action: ActionDeleteLocal}
+	}
+	return Change{Path: path, Action: ActionPull, Entry: *remote}
+}
+
+// resolve returns StrategyLocal or StrategyRemote for the winning side, or
+// StrategyManual if the conflict stays.
+func resolve(local, remote *Entry, strategy Strategy) Strategy {
+	switch strategy {
+	case StrategyLocal, StrategyRemote:
+		return strategy
+	case StrategyNewer:
+		switch {
+		case remote == nil:
+			return StrategyLocal
+		case local == nil:
+			return StrategyRemote
+		case local.ModTime.After(remote.ModTime):
+			return StrategyLocal
+		case remote.ModTime.After(local.ModTime):
+			return StrategyRemote
+		}
+	}
+	return StrategyManual
+}
+
+// sortChanges orders transfers parents first and deletions children first.
+func sortChanges(changes []Change) {
+	sort.SliceStable(changes, func(i, j int) bool {
+		di := changes[i].Action == ActionDeleteLocal || changes[i].Action == ActionDeleteRemote
+		dj := changes[j].Action == ActionDeleteLocal || changes[j].Action == ActionDeleteRemote
+		if di != dj {
+			return di
+		}
+		if di {
+			return strings.Count(changes[i].Path, "/") > strings.Count(changes[j].Path, "/") ||
+				(strings.Count(changes[i].Path, "/") == strings.Count(changes[j].Path, "/") && changes[i].Path > changes[j].Path)
+		}
+		return changes[i].Path < changes[j].Path
+	})
+}
+
+// NextBase returns the snapshot of the paths that are in sync after plan
+// was applied. Conflicting paths keep their previous base so they stay
+// conflicts until resolved.
+func NextBase(base, local, remote Snapshot, plan Plan) Snapshot {
+	next := Snapshot{}
+	for path, entry := range local {
+		if other, ok := remote[path]; ok && entry.Equal(other) {
+			next[path] = entry
+		}
+	}
+	for _, change := range plan.Changes {
+		switch change.Action {
+		case ActionPush, ActionPull:
+			next[change.Path] = change.Entry
+		case ActionDeleteLocal, ActionDeleteRemote:
+			delete(next, change.Path)
+		}
+	}
+	for _, conflict := range plan.Conflicts {
+		if entry, ok := base[conflict.Path]; ok {
+			next[conflict.Path] = entry
+		} else {
+			delete(next, conflict.Path)
+		}
+	}
+	return next
+}
@@ -0,0 +1,113 @@
+package filesync
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os/exec"
+	"strings"
+)
+
+// Replica is one side of a sync session.
+type Replica interface {
+	Scan(ctx context.Context, ignore []string, previous Snapshot) (Snapshot, error)
+	// Export writes the paths as a tar stream to w.
+	Export(ctx context.Context, paths []string, w io.Writer) error
+	// Import applies a tar stream written by Export.
+	Import(ctx context.Context, r io.Reader) error
+	Delete(ctx context.Context, paths []string) error
+}
+
+// LocalReplica is a folder on this machine.
+type LocalReplica struct {
+	Root string
+}
+
+func (l *LocalReplica) Scan(ctx context.Context, ignore []string, previous Snapshot) (Snapshot, error) {
+	return Scan(l.Root, ignore, previous)
+}
+
+func (l *LocalReplica) Export(ctx context.Context, paths []string, w io.Writer) error {
+	return WriteArchive(w, l.Root, paths)
+}
+
+func (l *LocalReplica) Import(ctx context.Context, r io.Reader) error {
+	return ExtractArchive(r, l.Root)
+}
+
+func (l *LocalReplica) Delete(ctx context.Context, paths []string) error {
+	return DeletePaths(l.Root, paths)
+}
+
+// CommandFunc returns a command that runs the kled filesync helper with args
+// in the workspace.
+type CommandFunc func(ctx context.Context, args []string) (*exec.Cmd, error)
+
+// RemoteReplica is a folder in a workspace, accessed through the filesync
+// helper of the kled agent.
+type RemoteReplica struct {
+	Root    string
+	Command CommandFunc
+}
+
+func (r *RemoteReplica) run(ctx context.Context, args []string, stdin io.Reader, stdout io.Writer) error {
+	cmd, err := r.Command(ctx, append(args, "--path", r.Root))
+	if err != nil {
+		return err
+	}
+
+	stderr := &bytes.Buffer{}
+	cmd.Stdin = stdin
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("%s in workspace: %w: %s", args[0], err, strings.TrimSpace(stderr.String()))
+	}
+	return nil
+}
+
+func (r *RemoteReplica) Scan(ctx context.Context, ignore []string, previous Snapshot) (Snapshot, error) {
+	args := []string{"scan"}
+	for _, pattern := range ignore {
+		args = append(args, "--ignore", pattern)
+	}
+
+	// previous hashes are not sent, the helper keeps its own cache
+	stdout := &bytes.Buffer{}
+	if err := r.run(ctx, args, nil, stdout); err != nil {
+		return nil, err
+	}
+
+	snapshot := Snapshot{}
+	if err := json.Unmarshal(stdout.Bytes(), &snapshot); err != nil {
+		return nil, fmt.Errorf("parse workspace snapshot: %w", err)
+	}
+	return snapshot, nil
+}
+
+func (r *RemoteReplica) Export(ctx context.Context, paths []string, w io.Writer) error {
+	return r.run(ctx, []string{"export"}, strings.NewReader(strings.Join(paths, "\n")), w)
+}
+
+func (r *RemoteReplica) Import(ctx context.Context, reader io.Reader) error {
+	return r.run(ctx, []string{"import"}, reader, io.Discard)
+}
+
+func (r *RemoteReplica) Delete(ctx context.Context, paths []string) error {
+	return r.run(ctx, []string{"delete"}, strings.NewReader(strings.Join(paths, "\n")), io.Discard)
+}
+
+// ReadPaths reads the newline separated paths sent to the helper.
+func ReadPaths(r io.Reader) ([]string, error) {
+	paths := []string{}
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		if line := scanner.Text(); line != "" {
+			paths = append(paths, line)
+		}
+	}
+	return paths, scanner.Err()
+}
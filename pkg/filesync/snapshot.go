@@ -0,0 +1,142 @@
+package filesync
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/moby/patternmatcher"
+	"github.com/moby/patternmatcher/ignorefile"
+)
+
+// IgnoreFile is read from the root of the local folder, it uses the
+// .dockerignore syntax.
+const IgnoreFile = ".kledignore"
+
+// Entry describes a file, directory or symlink in a replica.
+type Entry struct {
+	Mode    fs.FileMode `json:"mode"`
+	Size    int64       `json:"size,omitempty"`
+	ModTime time.Time   `json:"modTime"`
+	// Hash is the sha256 of a regular file.
+	Hash string `json:"hash,omitempty"`
+	// Target is the target of a symlink.
+	Target string `json:"target,omitempty"`
+}
+
+func (e Entry) IsDir() bool {
+	return e.Mode.IsDir()
+}
+
+// Equal compares the type, permissions and content of two entries.
+// Modification times are ignored, they differ between replicas.
+func (e Entry) Equal(other Entry) bool {
+	if e.Mode.Type() != other.Mode.Type() || e.Mode.Perm() != other.Mode.Perm() {
+		return false
+	}
+	return e.Hash == other.Hash && e.Target == other.Target
+}
+
+// Snapshot maps slash separated paths relative to the root to entries.
+type Snapshot map[string]Entry
+
+// LoadIgnorePatterns returns the patterns of the ignore file in root
+// followed by extra.
+func LoadIgnorePatterns(root string, extra []string) ([]string, error) {
+	patterns := []string{}
+	f, err := os.Open(filepath.Join(root, IgnoreFile))
+	if err == nil {
+		defer f.Close()
+		patterns, err = ignorefile.ReadAll(f)
+		if err != nil {
+			return nil, fmt.Errorf("read %s: %w", IgnoreFile, err)
+		}
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+
+	return append(patterns, extra...), nil
+}
+
+// Scan walks root and returns its snapshot. Files whose size and
+// modification time match the previous snapshot are not hashed again.
+func Scan(root string, ignore []string, previous Snapshot) (Snapshot, error) {
+	matcher, err := patternmatcher.New(ignore)
+	if err != nil {
+		return nil, fmt.Errorf("parse ignore patterns: %w", err)
+	}
+
+	snapshot := Snapshot{}
+	err = filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		} else if rel == "." {
+			return nil
+		}
+		rel = filepath.ToSlash(rel)
+
+		ignored, err := matcher.MatchesOrParentMatches(rel)
+		if err != nil {
+			return err
+		} else if ignored {
+			if d.IsDir() && !matcher.Exclusions() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		entry := Entry{Mode: info.Mode(), ModTime: info.ModTime().UTC().Truncate(time.Second)}
+		switch {
+		case info.Mode().IsRegular():
+			entry.Size = info.Size()
+			if old, ok := previous[rel]; ok && old.Mode.IsRegular() && old.Size == entry.Size && old.ModTime.Equal(entry.ModTime) {
+				entry.Hash = old.Hash
+			} else if entry.Hash, err = hashFile(path); err != nil {
+				return err
+			}
+		case info.Mode()&fs.ModeSymlink != 0:
+			if entry.Target, err = os.Readlink(path); err != nil {
+				return err
+			}
+		case info.IsDir():
+		default:
+			// sockets, devices and pipes are not synced
+			return nil
+		}
+
+		snapshot[rel] = entry
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return snapshot, nil
+}
+
+func hashFile(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
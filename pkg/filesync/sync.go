@@ -0,0 +1,205 @@
+package filesync
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/docker/go-units"
+	"github.com/loft-sh/log"
+)
+
+// Options configure a sync session.
+type Options struct {
+	Strategy Strategy
+	Ignore   []string
+	// StatePath stores the snapshot of the last sync, which tells changes
+	// apart from deletions.
+	StatePath string
+}
+
+// Result summarizes one sync.
+type Result struct {
+	Pushed        int        `json:"pushed"`
+	Pulled        int        `json:"pulled"`
+	DeletedLocal  int        `json:"deletedLocal"`
+	DeletedRemote int        `json:"deletedRemote"`
+	Bytes         int64      `json:"bytes"`
+	Conflicts     []Conflict `json:"conflicts,omitempty"`
+}
+
+func (r *Result) Changed() bool {
+	return r.Pushed+r.Pulled+r.DeletedLocal+r.DeletedRemote > 0
+}
+
+// Session syncs a local and a remote replica.
+type Session struct {
+	local   Replica
+	remote  Replica
+	options Options
+	log     log.Logger
+
+	base Snapshot
+	// localCache keeps the hashes of the last local scan
+	localCache Snapshot
+}
+
+func NewSession(local, remote Replica, options Options, log log.Logger) (*Session, error) {
+	if options.Strategy == "" {
+		options.Strategy = StrategyManual
+	}
+
+	base, err := loadState(options.StatePath)
+	if err != nil {
+		return nil, err
+	}
+	return &Session{local: local, remote: remote, options: options, log: log, base: base, localCache: base}, nil
+}
+
+func loadState(path string) (Snapshot, error) {
+	if path == "" {
+		return Snapshot{}, nil
+	}
+
+	out, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return Snapshot{}, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	snapshot := Snapshot{}
+	if err := json.Unmarshal(out, &snapshot); err != nil {
+		return nil, fmt.Errorf("parse sync state %s: %w", path, err)
+	}
+	return snapshot, nil
+}
+
+func (s *Session) saveState() error {
+	if s.options.StatePath == "" {
+		return nil
+	}
+
+	out, err := json.Marshal(s.base)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(s.options.StatePath), 0o755); err != nil {
+		return err
+	}
+	return os.WriteFile(s.options.StatePath, out, 0o600)
+}
+
+// Sync scans both sides once and applies the changes.
+func (s *Session) Sync(ctx context.Context) (*Result, error) {
+	local, err := s.local.Scan(ctx, s.options.Ignore, s.localCache)
+	if err != nil {
+		return nil, fmt.Errorf("scan local folder: %w", err)
+	}
+	s.localCache = local
+
+	remote, err := s.remote.Scan(ctx, s.options.Ignore, nil)
+	if err != nil {
+		return nil, fmt.Errorf("scan workspace folder: %w", err)
+	}
+
+	plan := Reconcile(s.base, local, remote, s.options.Strategy)
+	result := &Result{Conflicts: plan.Conflicts}
+	total := len(plan.Changes)
+	done := 0
+	progress := func(change Change) {
+		done++
+		s.log.Infof("[%d/%d] %s %s", done, total, change.Action, change.Path)
+		if change.Action == ActionPush || change.Action == ActionPull {
+			result.Bytes += change.Entry.Size
+		}
+	}
+
+	// deletions first, a path might change its type
+	if err := s.delete(ctx, s.remote, plan, ActionDeleteRemote, progress); err != nil {
+		return nil, err
+	}
+	result.DeletedRemote = len(plan.Paths(ActionDeleteRemote))
+	if err := s.delete(ctx, s.local, plan, ActionDeleteLocal, progress); err != nil {
+		return nil, err
+	}
+	result.DeletedLocal = len(plan.Paths(ActionDeleteLocal))
+
+	if err := s.transfer(ctx, s.local, s.remote, plan, ActionPush, progress); err != nil {
+		return nil, fmt.Errorf("push: %w", err)
+	}
+	result.Pushed = len(plan.Paths(ActionPush))
+	if err := s.transfer(ctx, s.remote, s.local, plan, ActionPull, progress); err != nil {
+		return nil, fmt.Errorf("pull: %w", err)
+	}
+	result.Pulled = len(plan.Paths(ActionPull))
+
+	for _, conflict := range plan.Conflicts {
+		s.log.Warnf("Conflict: %s changed locally and in the workspace", conflict.Path)
+	}
+
+	s.base = NextBase(s.base, local, remote, plan)
+	if err := s.saveState(); err != nil {
+		return nil, fmt.Errorf("save sync state: %w", err)
+	}
+	return result, nil
+}
+
+func (s *Session) delete(ctx context.Context, replica Replica, plan Plan, action Action, progress func(Change)) error {
+	paths := plan.Paths(action)
+	if len(paths) == 0 {
+		return nil
+	}
+	if err := replica.Delete(ctx, paths); err != nil {
+		return fmt.Errorf("%s: %w", action, err)
+	}
+	for _, change := range plan.Changes {
+		if change.Action == action {
+			progress(change)
+		}
+	}
+	return nil
+}
+
+func (s *Session) transfer(ctx context.Context, from, to Replica, plan Plan, action Action, progress func(Change)) error {
+	paths := plan.Paths(action)
+	if len(paths) == 0 {
+		return nil
+	}
+
+	size := int64(0)
+	for _, change := range plan.Changes {
+		if change.Action == action {
+			size += change.Entry.Size
+		}
+	}
+	s.log.Infof("%s %d path(s), %s", map[Action]string{ActionPush: "Pushing", ActionPull: "Pulling"}[action], len(paths), units.HumanSize(float64(size)))
+
+	reader, writer := io.Pipe()
+	exportErr := make(chan error, 1)
+	go func() {
+		err := from.Export(ctx, paths, writer)
+		_ = writer.CloseWithError(err)
+		exportErr <- err
+	}()
+
+	importErr := to.Import(ctx, reader)
+	_ = reader.CloseWithError(io.ErrClosedPipe)
+	if err := <-exportErr; err != nil {
+		return err
+	} else if importErr != nil {
+		return importErr
+	}
+
+	for _, change := range plan.Changes {
+		if change.Action == action {
+			progress(change)
+		}
+	}
+	return nil
+}
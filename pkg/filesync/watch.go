@@ -0,0 +1,98 @@
+package filesync
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"time"
+
+	"github.com/docker/go-units"
+	"github.com/fsnotify/fsnotify"
+	"github.com/moby/patternmatcher"
+)
+
+// debounce collects bursts of local events, e.g. a git checkout, into one sync.
+const debounce = 500 * time.Millisecond
+
+// Watch syncs once and then again whenever the local folder changes. The
+// workspace is polled every interval, changes there do not raise events on
+// this machine. Watch returns when ctx is done or a sync fails.
+func (s *Session) Watch(ctx context.Context, localRoot string, interval time.Duration) error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	defer watcher.Close()
+
+	matcher, err := patternmatcher.New(s.options.Ignore)
+	if err != nil {
+		return fmt.Errorf("parse ignore patterns: %w", err)
+	}
+	if err := watchTree(watcher, matcher, localRoot, localRoot); err != nil {
+		return err
+	}
+	if err := s.syncAndReport(ctx); err != nil {
+		return err
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	timer := time.NewTimer(debounce)
+	timer.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return nil
+			}
+			if event.Has(fsnotify.Create) {
+				// new directories are not watched recursively
+				_ = watchTree(watcher, matcher, localRoot, event.Name)
+			}
+			timer.Reset(debounce)
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return nil
+			}
+			s.log.Debugf("Error watching %s: %v", localRoot, err)
+		case <-timer.C:
+			if err := s.syncAndReport(ctx); err != nil {
+				return err
+			}
+		case <-ticker.C:
+			if err := s.syncAndReport(ctx); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// watchTree adds dir and all directories below it to the watcher. Ignored
+// directories are skipped, they often hold a lot of generated files.
+func watchTree(watcher *fsnotify.Watcher, matcher *patternmatcher.PatternMatcher, root, dir string) error {
+	return filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || !d.IsDir() {
+			return nil
+		}
+		if rel, err := filepath.Rel(root, path); err == nil && rel != "." {
+			if ignored, _ := matcher.MatchesOrParentMatches(filepath.ToSlash(rel)); ignored && !matcher.Exclusions() {
+				return filepath.SkipDir
+			}
+		}
+		return watcher.Add(path)
+	})
+}
+
+func (s *Session) syncAndReport(ctx context.Context) error {
+	result, err := s.Sync(ctx)
+	if err != nil {
+		return err
+	}
+	if result.Changed() {
+		s.log.Donef("Synced %d pushed, %d pulled, %d deleted (%s)", result.Pushed, result.Pulled, result.DeletedLocal+result.DeletedRemote, units.HumanSize(float64(result.Bytes)))
+	}
+	return nil
+}
@@ -85,6 +85,13 @@ func (o *GenericJetBrainsServer) OpenGateway(workspaceFolder, workspaceID string
 	return nil
 }
 
+// ReadyCommand returns a shell command that succeeds as the user once the
+// backend is extracted and its launcher can be run. Gateway starts the
+// backend through the launcher when it connects.
+func (o *GenericJetBrainsServer) ReadyCommand() string {
+	return fmt.Sprintf(`test -x "%s/bin/remote-dev-server.sh"`, o.getDirectory("$HOME"))
+}
+
 func (o *GenericJetBrainsServer) GetVolume() string {
 	return fmt.Sprintf("type=volume,src=kled-%s,dst=%s", o.options.ID, o.getDownloadFolder())
 }
@@ -113,8 +120,19 @@ func (o *GenericJetBrainsServer) Install() error {
 		return err
 	}
 
+	// extract next to the target, so that a partial backend is never taken
+	// for an installed one
 	o.log.Infof("Extract %s...", o.options.DisplayName)
-	err = o.extractArchive(archivePath, targetLocation)
+	partialLocation := targetLocation + ".partial"
+	err = os.RemoveAll(partialLocation)
+	if err != nil {
+		return err
+	}
+	err = o.extractArchive(archivePath, partialLocation)
+	if err != nil {
+		return err
+	}
+	err = os.Rename(partialLocation, targetLocation)
 	if err != nil {
 		return err
 	}
@@ -444,21 +444,7 @@ func prepareServerLocation(userName string, create bool, flavor Flavor) (string,
 		return "", err
 	}
 
-	folderName := ".vscode-server"
-	switch flavor {
-	case FlavorStable:
-		folderName = ".vscode-server"
-	case FlavorInsiders:
-		folderName = ".vscode-server-insiders"
-	case FlavorCursor:
-		folderName = ".cursor-server"
-	case FlavorPositron:
-		folderName = ".positron-server"
-	case FlavorCodium:
-		folderName = ".vscodium-server"
-	}
-
-	folder := filepath.Join(homeFolder, folderName)
+	folder := filepath.Join(homeFolder, serverFolder(flavor))
 	if create {
 		err = os.MkdirAll(folder, 0755)
 		if err != nil {
@@ -468,3 +454,27 @@ func prepareServerLocation(userName string, create bool, flavor Flavor) (string,
 
 	return folder, nil
 }
+
+// serverFolder returns the folder in the home of the user that holds the
+// server of the flavor
+func serverFolder(flavor Flavor) string {
+	switch flavor {
+	case FlavorInsiders:
+		return ".vscode-server-insiders"
+	case FlavorCursor:
+		return ".cursor-server"
+	case FlavorPositron:
+		return ".positron-server"
+	case FlavorCodium:
+		return ".vscodium-server"
+	default:
+		return ".vscode-server"
+	}
+}
+
+// ReadyCommand returns a shell command that succeeds as the user once the
+// agent has prepared the server location of the flavor with its settings.
+// The server itself is installed by the local client when it connects.
+func ReadyCommand(flavor Flavor) string {
+	return `test -f "$HOME/` + serverFolder(flavor) + `/data/Machine/settings.json"`
+}
@@ -20,6 +20,13 @@ var (
 	azureKeychain  authn.Keychain = authn.NewKeychainFromHelper(credhelper.NewACRCredentialsHelper())
 )
 
+// HelperKeychains resolve short lived tokens for the registries of the cloud providers
+var HelperKeychains = map[string]authn.Keychain{
+	"ecr": amazonKeychain,
+	"gcr": google.Keychain,
+	"acr": azureKeychain,
+}
+
 const tokenFileLocation = "/var/run/secrets/kubernetes.io/serviceaccount/token"
 
 // See https://github.com/kubernetes/kubernetes/blob/30ae12d018697d3c5f04e225b11f242f5310e097/pkg/serviceaccount/claims.go#L55
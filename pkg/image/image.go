@@ -10,6 +10,7 @@ import (
 	"github.com/google/go-containerregistry/pkg/name"
 	v1 "github.com/google/go-containerregistry/pkg/v1"
 	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/loft-sh/devpod/pkg/contentstore"
 	"github.com/loft-sh/log"
 	"github.com/pkg/errors"
 )
@@ -20,6 +21,10 @@ var (
 )
 
 func GetImage(ctx context.Context, image string) (v1.Image, error) {
+	if contentstore.Offline() {
+		return getOfflineImage(image)
+	}
+
 	ref, err := name.ParseReference(image)
 	if err != nil {
 		return nil, err
@@ -39,6 +44,10 @@ func GetImage(ctx context.Context, image string) (v1.Image, error) {
 }
 
 func GetImageForArch(ctx context.Context, image, arch string) (v1.Image, error) {
+	if contentstore.Offline() {
+		return getOfflineImage(image)
+	}
+
 	ref, err := name.ParseReference(image)
 	if err != nil {
 		return nil, err
@@ -61,6 +70,23 @@ func GetImageForArch(ctx context.Context, image, arch string) (v1.Image, error)
 
 	return img, err
 }
+
+// getOfflineImage resolves image from the content store, which only holds a
+// single platform per image
+func getOfflineImage(image string) (v1.Image, error) {
+	store, err := contentstore.Default()
+	if err != nil {
+		return nil, err
+	}
+
+	img, err := store.Image(image)
+	if err != nil {
+		return nil, fmt.Errorf("offline mode: %w, add it with kled bundle import", err)
+	}
+
+	return img, nil
+}
+
 func CheckPushPermissions(image string) error {
 	ref, err := name.ParseReference(image)
 	if err != nil {
@@ -0,0 +1,172 @@
+// Package imagescan scans workspace images for known vulnerabilities before
+// the workspace container starts.
+package imagescan
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ReportFile is the file in the workspace folder that holds the last report
+const ReportFile = "image-scan.json"
+
+type Mode string
+
+const (
+	// ModeOff disables scanning
+	ModeOff Mode = "off"
+	// ModeWarn scans the image and warns about findings at or above the threshold
+	ModeWarn Mode = "warn"
+	// ModeBlock refuses to start workspaces with findings at or above the threshold
+	ModeBlock Mode = "block"
+)
+
+type Severity string
+
+const (
+	SeverityUnknown  Severity = "UNKNOWN"
+	SeverityLow      Severity = "LOW"
+	SeverityMedium   Severity = "MEDIUM"
+	SeverityHigh     Severity = "HIGH"
+	SeverityCritical Severity = "CRITICAL"
+)
+
+// Severities are ordered from lowest to highest
+var Severities = []Severity{SeverityUnknown, SeverityLow, SeverityMedium, SeverityHigh, SeverityCritical}
+
+func (s Severity) rank() int {
+	for i, severity := range Severities {
+		if severity == s {
+			return i
+		}
+	}
+	return 0
+}
+
+// AtLeast returns true if s is as severe as threshold or more
+func (s Severity) AtLeast(threshold Severity) bool {
+	return s.rank() >= threshold.rank()
+}
+
+func ParseSeverity(severity string) (Severity, error) {
+	for _, s := range Severities {
+		if strings.EqualFold(string(s), severity) {
+			return s, nil
+		}
+	}
+	return "", fmt.Errorf("unknown severity %q, expected one of %v", severity, Severities)
+}
+
+// Options configure scanning of a workspace image
+type Options struct {
+	Mode Mode `json:"mode,omitempty"`
+	// Severity is the threshold findings are reported from
+	Severity Severity `json:"severity,omitempty"`
+	// Server is the address of a Trivy server, the local database is used
+	// if empty
+	Server string `json:"server,omitempty"`
+}
+
+func (o Options) Enabled() bool {
+	return o.Mode == ModeWarn || o.Mode == ModeBlock
+}
+
+// Threshold returns the configured severity or CRITICAL
+func (o Options) Threshold() Severity {
+	if o.Severity == "" {
+		return SeverityCritical
+	}
+	return o.Severity
+}
+
+type Vulnerability struct {
+	ID               string   `json:"id"`
+	Package          string   `json:"package"`
+	InstalledVersion string   `json:"installedVersion,omitempty"`
+	FixedVersion     string   `json:"fixedVersion,omitempty"`
+	Severity         Severity `json:"severity"`
+	Title            string   `json:"title,omitempty"`
+	Target           string   `json:"target,omitempty"`
+}
+
+type Report struct {
+	Image           string          `json:"image"`
+	Scanner         string          `json:"scanner"`
+	ScannedAt       time.Time       `json:"scannedAt"`
+	Threshold       Severity        `json:"threshold"`
+	Blocked         bool            `json:"blocked,omitempty"`
+	Vulnerabilities []Vulnerability `json:"vulnerabilities"`
+}
+
+// Counts returns the number of findings per severity
+func (r *Report) Counts() map[Severity]int {
+	counts := map[Severity]int{}
+	for _, vulnerability := range r.Vulnerabilities {
+		counts[vulnerability.Severity]++
+	}
+	return counts
+}
+
+// Findings returns the vulnerabilities at or above threshold, most severe first
+func (r *Report) Findings(threshold Severity) []Vulnerability {
+	findings := []Vulnerability{}
+	for _, vulnerability := range r.Vulnerabilities {
+		if vulnerability.Severity.AtLeast(threshold) {
+			findings = append(findings, vulnerability)
+		}
+	}
+	sort.SliceStable(findings, func(i, j int) bool {
+		return findings[i].Severity.rank() > findings[j].Severity.rank()
+	})
+	return findings
+}
+
+// Summary describes the findings at or above the threshold of the report
+func (r *Report) Summary() string {
+	counts := r.Counts()
+	parts := []string{}
+	for i := len(Severities) - 1; i >= 0; i-- {
+		severity := Severities[i]
+		if counts[severity] > 0 && severity.AtLeast(r.Threshold) {
+			parts = append(parts, fmt.Sprintf("%d %s", counts[severity], strings.ToLower(string(severity))))
+		}
+	}
+	if len(parts) == 0 {
+		return fmt.Sprintf("no vulnerabilities of severity %s or higher", r.Threshold)
+	}
+	return strings.Join(parts, ", ")
+}
+
+// SaveReport writes the report to the workspace folder
+func SaveReport(workspaceDir string, report *Report) error {
+	out, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(filepath.Join(workspaceDir, ReportFile), out, 0600)
+}
+
+// LoadReport reads the last report from the workspace folder, it returns
+// nil if the image wasn't scanned yet.
+func LoadReport(workspaceDir string) (*Report, error) {
+	out, err := os.ReadFile(filepath.Join(workspaceDir, ReportFile))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	report := &Report{}
+	err = json.Unmarshal(out, report)
+	if err != nil {
+		return nil, fmt.Errorf("parse scan report: %w", err)
+	}
+	return report, nil
+}
@@ -0,0 +1,68 @@
+package imagescan
+
+import (
+	"testing"
+
+	"gotest.tools/assert"
+)
+
+const trivyOutput = `{
+  "ArtifactName": "alpine:3.14",
+  "Results": [
+    {
+      "Target": "alpine:3.14 (alpine 3.14.0)",
+      "Vulnerabilities": [
+        {"VulnerabilityID": "CVE-2021-0001", "PkgName": "busybox", "InstalledVersion": "1.33.1-r2", "FixedVersion": "1.33.1-r3", "Severity": "MEDIUM"},
+        {"VulnerabilityID": "CVE-2021-0002", "PkgName": "openssl", "InstalledVersion": "1.1.1k-r0", "FixedVersion": "1.1.1l-r0", "Severity": "CRITICAL", "Title": "openssl: overflow"}
+      ]
+    },
+    {"Target": "app/go.sum"}
+  ]
+}`
+
+func TestParseTrivyReport(t *testing.T) {
+	report, err := parseTrivyReport([]byte(trivyOutput))
+	assert.NilError(t, err)
+	report.Threshold = SeverityHigh
+
+	assert.Equal(t, len(report.Vulnerabilities), 2)
+	assert.Equal(t, report.Vulnerabilities[1].Target, "alpine:3.14 (alpine 3.14.0)")
+
+	findings := report.Findings(SeverityHigh)
+	assert.Equal(t, len(findings), 1)
+	assert.Equal(t, findings[0].ID, "CVE-2021-0002")
+	assert.Equal(t, report.Summary(), "1 critical")
+
+	findings = report.Findings(SeverityLow)
+	assert.Equal(t, len(findings), 2)
+	assert.Equal(t, findings[0].Severity, SeverityCritical)
+
+	report.Threshold = SeverityCritical
+	report.Vulnerabilities = report.Vulnerabilities[:1]
+	assert.Equal(t, report.Summary(), "no vulnerabilities of severity CRITICAL or higher")
+}
+
+func TestReportFile(t *testing.T) {
+	dir := t.TempDir()
+	report, err := LoadReport(dir)
+	assert.NilError(t, err)
+	assert.Assert(t, report == nil)
+
+	err = SaveReport(dir, &Report{Image: "alpine", Threshold: SeverityHigh, Vulnerabilities: []Vulnerability{{ID: "CVE-1", Severity: SeverityHigh}}})
+	assert.NilError(t, err)
+	report, err = LoadReport(dir)
+	assert.NilError(t, err)
+	assert.Equal(t, report.Image, "alpine")
+	assert.Equal(t, report.Vulnerabilities[0].ID, "CVE-1")
+}
+
+func TestParseSeverity(t *testing.T) {
+	severity, err := ParseSeverity("high")
+	assert.NilError(t, err)
+	assert.Equal(t, severity, SeverityHigh)
+	assert.Assert(t, severity.AtLeast(SeverityMedium))
+	assert.Assert(t, !severity.AtLeast(SeverityCritical))
+
+	_, err = ParseSeverity("severe")
+	assert.ErrorContains(t, err, "unknown severity")
+}
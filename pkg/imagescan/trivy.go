@@ -0,0 +1,92 @@
+package imagescan
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// TrivyBinary is the trivy executable used for scanning
+var TrivyBinary = "trivy"
+
+type trivyReport struct {
+	Results []struct {
+		Target          string `json:"Target"`
+		Vulnerabilities []struct {
+			VulnerabilityID  string `json:"VulnerabilityID"`
+			PkgName          string `json:"PkgName"`
+			InstalledVersion string `json:"InstalledVersion"`
+			FixedVersion     string `json:"FixedVersion"`
+			Severity         string `json:"Severity"`
+			Title            string `json:"Title"`
+		} `json:"Vulnerabilities"`
+	} `json:"Results"`
+}
+
+// Scan scans image with trivy. If options.Server is set, trivy runs in client
+// mode against that server and doesn't need a local vulnerability database.
+func Scan(ctx context.Context, image string, options Options) (*Report, error) {
+	if _, err := exec.LookPath(TrivyBinary); err != nil {
+		return nil, fmt.Errorf("image scanning needs %s in the PATH: %w", TrivyBinary, err)
+	}
+
+	args := []string{"image", "--format", "json", "--quiet", "--scanners", "vuln"}
+	if options.Server != "" {
+		args = append(args, "--server", options.Server)
+	}
+	args = append(args, image)
+
+	stdout := &bytes.Buffer{}
+	stderr := &bytes.Buffer{}
+	cmd := exec.CommandContext(ctx, TrivyBinary, args...)
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("scan image %s: %w: %s", image, err, strings.TrimSpace(stderr.String()))
+	}
+
+	report, err := parseTrivyReport(stdout.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("parse trivy report: %w", err)
+	}
+	report.Image = image
+	report.Threshold = options.Threshold()
+	return report, nil
+}
+
+func parseTrivyReport(out []byte) (*Report, error) {
+	trivy := &trivyReport{}
+	err := json.Unmarshal(out, trivy)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &Report{
+		Scanner:         "trivy",
+		ScannedAt:       time.Now().UTC(),
+		Vulnerabilities: []Vulnerability{},
+	}
+	for _, result := range trivy.Results {
+		for _, vulnerability := range result.Vulnerabilities {
+			severity, err := ParseSeverity(vulnerability.Severity)
+			if err != nil {
+				severity = SeverityUnknown
+			}
+
+			report.Vulnerabilities = append(report.Vulnerabilities, Vulnerability{
+				ID:               vulnerability.VulnerabilityID,
+				Package:          vulnerability.PkgName,
+				InstalledVersion: vulnerability.InstalledVersion,
+				FixedVersion:     vulnerability.FixedVersion,
+				Severity:         severity,
+				Title:            vulnerability.Title,
+				Target:           result.Target,
+			})
+		}
+	}
+	return report, nil
+}
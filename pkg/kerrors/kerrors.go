@@ -0,0 +1,202 @@
+// Package kerrors has the error codes the kled backend answers with and
+// the fixes the CLI suggests for them.
+//
+// Errors carry a code and optionally a remediation overriding the default
+// fix of the code. They are wrapped with %w like any other error; errors.Is
+// matches them against the Err value of their code, and Render formats them
+// for the terminal.
+package kerrors
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// Code is the machine-readable code of an error. The backend returns it in
+// the code field of error responses.
+type Code string
+
+const (
+	NotAuthenticated    Code = "not_authenticated"
+	PermissionDenied    Code = "permission_denied"
+	NotFound            Code = "not_found"
+	InvalidArgument     Code = "invalid_argument"
+	Conflict            Code = "conflict"
+	QuotaExceeded       Code = "quota_exceeded"
+	RateLimited         Code = "rate_limited"
+	BackendUnavailable  Code = "backend_unavailable"
+	ProviderUnavailable Code = "provider_unavailable"
+	Timeout             Code = "timeout"
+	Internal            Code = "internal"
+)
+
+// The errors of each code. They match every error with their code.
+var (
+	ErrNotAuthenticated    = class(NotAuthenticated, "not authenticated")
+	ErrPermissionDenied    = class(PermissionDenied, "permission denied")
+	ErrNotFound            = class(NotFound, "not found")
+	ErrInvalidArgument     = class(InvalidArgument, "invalid argument")
+	ErrConflict            = class(Conflict, "conflict")
+	ErrQuotaExceeded       = class(QuotaExceeded, "quota exceeded")
+	ErrRateLimited         = class(RateLimited, "rate limited")
+	ErrBackendUnavailable  = class(BackendUnavailable, "backend unavailable")
+	ErrProviderUnavailable = class(ProviderUnavailable, "provider unavailable")
+	ErrTimeout             = class(Timeout, "timed out")
+)
+
+var remediations = map[Code]string{
+	NotAuthenticated:    "Pass an API key with --api-key or set KLED_API_KEY.",
+	PermissionDenied:    "Ask a project admin to grant your role access, or use --project to pick another project.",
+	QuotaExceeded:       "Check your usage with 'kled quota show' and stop or delete workspaces you don't need.",
+	RateLimited:         "Wait a minute and try again.",
+	BackendUnavailable:  "Try again later; if it persists, check the server status and your --server URL.",
+	ProviderUnavailable: "Check that the provider is installed and reachable, e.g. with 'kled provider list'.",
+	Timeout:             "Try again, or raise the timeout if the operation is expected to take longer.",
+}
+
+// Coded is implemented by errors carrying a code, like Error and the API
+// errors of the SDK.
+type Coded interface {
+	ErrorCode() Code
+	// ErrorRemediation returns the fix suggested for the error, or "" for
+	// the default of its code.
+	ErrorRemediation() string
+}
+
+// Error is an error with a code.
+type Error struct {
+	Code    Code
+	Message string
+	// Remediation overrides the default remediation of the code.
+	Remediation string
+	Err         error
+
+	// class is set for the Err values matching every error of their code.
+	class bool
+}
+
+func class(code Code, message string) *Error {
+	return &Error{Code: code, Message: message, class: true}
+}
+
+// New returns an error with a code and a message.
+func New(code Code, message string) *Error {
+	return &Error{Code: code, Message: message}
+}
+
+// Errorf returns an error with a code and a message formatted like
+// fmt.Errorf, including wrapping with %w.
+func Errorf(code Code, format string, args ...interface{}) *Error {
+	err := fmt.Errorf(format, args...)
+	return &Error{Code: code, Message: err.Error(), Err: errors.Unwrap(err)}
+}
+
+// Wrap returns err with a code, keeping its message. Wrapping nil returns
+// nil.
+func Wrap(code Code, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &Error{Code: code, Err: err}
+}
+
+func (e *Error) Error() string {
+	if e.Message == "" && e.Err != nil {
+		return e.Err.Error()
+	}
+	return e.Message
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Is matches the Err value of the code.
+func (e *Error) Is(target error) bool {
+	return IsCode(target, e.Code)
+}
+
+func (e *Error) ErrorCode() Code {
+	return e.Code
+}
+
+func (e *Error) ErrorRemediation() string {
+	return e.Remediation
+}
+
+// WithRemediation returns a copy of the error suggesting fix.
+func (e *Error) WithRemediation(fix string) *Error {
+	copied := *e
+	copied.Remediation = fix
+	copied.class = false
+	return &copied
+}
+
+// IsCode reports whether target is the Err value of code. Coded errors
+// outside this package use it to implement Is.
+func IsCode(target error, code Code) bool {
+	t, ok := target.(*Error)
+	return ok && t.class && t.Code == code
+}
+
+// CodeOf returns the code of err: the code of the first Coded error it
+// wraps, Timeout for deadlines, or Internal.
+func CodeOf(err error) Code {
+	var coded Coded
+	switch {
+	case errors.As(err, &coded):
+		return coded.ErrorCode()
+	case errors.Is(err, context.DeadlineExceeded):
+		return Timeout
+	default:
+		return Internal
+	}
+}
+
+// RemediationOf returns the fix suggested for err, or "" if there is none.
+func RemediationOf(err error) string {
+	var coded Coded
+	if errors.As(err, &coded) && coded.ErrorRemediation() != "" {
+		return coded.ErrorRemediation()
+	}
+	return remediations[CodeOf(err)]
+}
+
+// Render returns the message of err followed by the fix suggested for it,
+// for printing on the terminal.
+func Render(err error) string {
+	if err == nil {
+		return ""
+	}
+	if fix := RemediationOf(err); fix != "" {
+		return err.Error() + "\nSuggested fix: " + fix
+	}
+	return err.Error()
+}
+
+// FromHTTPStatus returns the code of responses with status, for responses
+// that don't carry one.
+func FromHTTPStatus(status int) Code {
+	switch status {
+	case http.StatusUnauthorized:
+		return NotAuthenticated
+	case http.StatusForbidden:
+		return PermissionDenied
+	case http.StatusNotFound:
+		return NotFound
+	case http.StatusBadRequest, http.StatusUnprocessableEntity:
+		return InvalidArgument
+	case http.StatusConflict:
+		return Conflict
+	case http.StatusTooManyRequests:
+		return RateLimited
+	case http.StatusBadGateway, http.StatusServiceUnavailable:
+		return BackendUnavailable
+	case http.StatusGatewayTimeout:
+		return Timeout
+	default:
+		return Internal
+	}
+}
@@ -0,0 +1,35 @@
+package kerrors
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"gotest.tools/assert"
+)
+
+func TestIs(t *testing.T) {
+	errMissing := New(NotFound, "container not found")
+	err := fmt.Errorf("find container: %w", errMissing)
+
+	assert.Assert(t, errors.Is(err, ErrNotFound))
+	assert.Assert(t, errors.Is(err, errMissing))
+	assert.Assert(t, !errors.Is(err, ErrConflict))
+	assert.Assert(t, !errors.Is(New(NotFound, "other"), errMissing))
+}
+
+func TestCodeOf(t *testing.T) {
+	assert.Equal(t, CodeOf(Errorf(ProviderUnavailable, "load config: %w", errors.New("no such file"))), ProviderUnavailable)
+	assert.Equal(t, CodeOf(fmt.Errorf("wait: %w", context.DeadlineExceeded)), Timeout)
+	assert.Equal(t, CodeOf(errors.New("plain")), Internal)
+	assert.Equal(t, FromHTTPStatus(401), NotAuthenticated)
+}
+
+func TestRender(t *testing.T) {
+	assert.Equal(t, Render(errors.New("plain")), "plain")
+	assert.Equal(t, Render(Wrap(QuotaExceeded, errors.New("quota exceeded for user"))), "quota exceeded for user\nSuggested fix: "+remediations[QuotaExceeded])
+
+	err := fmt.Errorf("build: %w", New(ProviderUnavailable, "buildx is not available").WithRemediation("Install docker buildx."))
+	assert.Equal(t, Render(err), "build: buildx is not available\nSuggested fix: Install docker buildx.")
+}
@@ -0,0 +1,187 @@
+// Package netpolicy isolates the network of workspaces.
+//
+// An isolated workspace runs in a network of its own and may only connect to
+// the destinations of its egress allowlist. On Kubernetes the policy becomes
+// a NetworkPolicy, on docker and kata a bridge network per workspace with
+// iptables rules on the machine. Host names in the allowlist are resolved
+// whenever the workspace starts, since neither of them can match names.
+package netpolicy
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	// ModeIsolated runs the workspace in a network of its own
+	ModeIsolated = "isolated"
+	// ModeOpen runs the workspace in the default network of the provider
+	ModeOpen = "open"
+)
+
+// RegistriesAlias in an allowlist stands for the DefaultRegistries
+const RegistriesAlias = "registries"
+
+// DefaultRegistries are the package registries of common languages
+var DefaultRegistries = []string{
+	"registry.npmjs.org:443",
+	"registry.yarnpkg.com:443",
+	"pypi.org:443",
+	"files.pythonhosted.org:443",
+	"proxy.golang.org:443",
+	"sum.golang.org:443",
+	"index.crates.io:443",
+	"static.crates.io:443",
+	"rubygems.org:443",
+	"repo.maven.apache.org:443",
+	"repo1.maven.org:443",
+}
+
+// Policy is the network policy of a workspace
+type Policy struct {
+	// Isolated runs the workspace in a network of its own
+	Isolated bool `json:"isolated,omitempty"`
+
+	// Egress are the destinations an isolated workspace may connect to, as
+	// host, IP or CIDR with an optional port, e.g. pypi.org:443 or
+	// 10.0.0.0/8. Nothing is allowed if it is empty
+	Egress []string `json:"egress,omitempty"`
+}
+
+// Rule allows connections to a CIDR, on a TCP port if Port is set
+type Rule struct {
+	CIDR string
+	Port int
+}
+
+// Resolver looks up the addresses of a host, net.DefaultResolver implements
+// it
+type Resolver interface {
+	LookupIPAddr(ctx context.Context, host string) ([]net.IPAddr, error)
+}
+
+// Parse returns the policy of a network mode and an egress allowlist, nil if
+// both are empty. An allowlist without a mode isolates the workspace
+func Parse(mode string, egress []string) (*Policy, error) {
+	switch mode {
+	case "":
+		if len(egress) == 0 {
+			return nil, nil
+		}
+	case ModeIsolated:
+	case ModeOpen:
+		if len(egress) > 0 {
+			return nil, fmt.Errorf("an egress allowlist needs the %s network mode", ModeIsolated)
+		}
+		return &Policy{}, nil
+	default:
+		return nil, fmt.Errorf("unknown network mode %s, choose either %s or %s", mode, ModeIsolated, ModeOpen)
+	}
+
+	policy := &Policy{Isolated: true}
+	for _, entry := range egress {
+		for _, destination := range strings.Split(entry, ",") {
+			destination = strings.TrimSpace(destination)
+			if destination == "" {
+				continue
+			} else if destination != RegistriesAlias {
+				if _, _, err := parseDestination(destination); err != nil {
+					return nil, err
+				}
+			}
+			policy.Egress = append(policy.Egress, destination)
+		}
+	}
+	return policy, nil
+}
+
+// Enabled returns true if the policy isolates the workspace
+func (p *Policy) Enabled() bool {
+	return p != nil && p.Isolated
+}
+
+// Destinations returns the allowlist with the aliases expanded
+func (p *Policy) Destinations() []string {
+	destinations := []string{}
+	for _, destination := range p.Egress {
+		if destination == RegistriesAlias {
+			destinations = append(destinations, DefaultRegistries...)
+		} else {
+			destinations = append(destinations, destination)
+		}
+	}
+	return destinations
+}
+
+// Resolve returns the rules of the allowlist, with host names resolved to
+// their current IPv4 addresses
+func (p *Policy) Resolve(ctx context.Context, resolver Resolver) ([]Rule, error) {
+	seen := map[Rule]bool{}
+	rules := []Rule{}
+	add := func(rule Rule) {
+		if !seen[rule] {
+			seen[rule] = true
+			rules = append(rules, rule)
+		}
+	}
+
+	for _, destination := range p.Destinations() {
+		host, port, err := parseDestination(destination)
+		if err != nil {
+			return nil, err
+		}
+		if _, ipNet, err := net.ParseCIDR(host); err == nil {
+			add(Rule{CIDR: ipNet.String(), Port: port})
+			continue
+		} else if ip := net.ParseIP(host); ip != nil {
+			if ip.To4() != nil {
+				add(Rule{CIDR: ip.String() + "/32", Port: port})
+			}
+			continue
+		}
+
+		addrs, err := resolver.LookupIPAddr(ctx, host)
+		if err != nil {
+			return nil, fmt.Errorf("resolve egress host %s: %w", host, err)
+		}
+		for _, addr := range addrs {
+			if ip := addr.IP.To4(); ip != nil {
+				add(Rule{CIDR: ip.String() + "/32", Port: port})
+			}
+		}
+	}
+
+	sort.Slice(rules, func(i, j int) bool {
+		if rules[i].CIDR != rules[j].CIDR {
+			return rules[i].CIDR < rules[j].CIDR
+		}
+		return rules[i].Port < rules[j].Port
+	})
+	return rules, nil
+}
+
+// parseDestination splits a destination into host and port, 0 if it has
+// none
+func parseDestination(destination string) (string, int, error) {
+	host, rawPort := destination, ""
+	if h, p, err := net.SplitHostPort(destination); err == nil {
+		host, rawPort = h, p
+	}
+	if host == "" {
+		return "", 0, fmt.Errorf("invalid egress destination %q", destination)
+	}
+
+	port := 0
+	if rawPort != "" {
+		var err error
+		port, err = strconv.Atoi(rawPort)
+		if err != nil || port < 1 || port > 65535 {
+			return "", 0, fmt.Errorf("invalid port in egress destination %q", destination)
+		}
+	}
+	return host, port, nil
+}
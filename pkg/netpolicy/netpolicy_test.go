@@ -0,0 +1,118 @@
+package netpolicy
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os/exec"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/loft-sh/log"
+	"gotest.tools/assert"
+)
+
+type fakeResolver map[string][]string
+
+func (r fakeResolver) LookupIPAddr(ctx context.Context, host string) ([]net.IPAddr, error) {
+	ips, ok := r[host]
+	if !ok {
+		return nil, fmt.Errorf("no such host")
+	}
+	addrs := []net.IPAddr{}
+	for _, ip := range ips {
+		addrs = append(addrs, net.IPAddr{IP: net.ParseIP(ip)})
+	}
+	return addrs, nil
+}
+
+func TestParse(t *testing.T) {
+	policy, err := Parse("", nil)
+	assert.NilError(t, err)
+	assert.Assert(t, policy == nil)
+
+	policy, err = Parse("", []string{"registries,llm.example.com:443", "10.0.0.0/8"})
+	assert.NilError(t, err)
+	assert.DeepEqual(t, policy, &Policy{Isolated: true, Egress: []string{"registries", "llm.example.com:443", "10.0.0.0/8"}})
+
+	policy, err = Parse(ModeOpen, nil)
+	assert.NilError(t, err)
+	assert.Assert(t, !policy.Enabled())
+
+	_, err = Parse(ModeOpen, []string{"pypi.org"})
+	assert.ErrorContains(t, err, "needs the isolated network mode")
+	_, err = Parse("private", nil)
+	assert.ErrorContains(t, err, "unknown network mode")
+	_, err = Parse(ModeIsolated, []string{"pypi.org:https"})
+	assert.ErrorContains(t, err, "invalid port")
+}
+
+func TestResolve(t *testing.T) {
+	policy := &Policy{Isolated: true, Egress: []string{"llm.example.com:443", "10.0.0.0/8", "192.168.1.5", "::1", "mirror.example.com"}}
+	rules, err := policy.Resolve(context.Background(), fakeResolver{
+		"llm.example.com":    {"203.0.113.10", "2001:db8::1"},
+		"mirror.example.com": {"203.0.113.20", "203.0.113.20"},
+	})
+	assert.NilError(t, err)
+	assert.DeepEqual(t, rules, []Rule{
+		{CIDR: "10.0.0.0/8"},
+		{CIDR: "192.168.1.5/32"},
+		{CIDR: "203.0.113.10/32", Port: 443},
+		{CIDR: "203.0.113.20/32"},
+	})
+
+	policy.Egress = []string{"unknown.example.com"}
+	_, err = policy.Resolve(context.Background(), fakeResolver{})
+	assert.ErrorContains(t, err, "resolve egress host unknown.example.com")
+
+	policy.Egress = []string{RegistriesAlias}
+	assert.DeepEqual(t, policy.Destinations(), DefaultRegistries)
+}
+
+func TestNetwork(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("egress rules need Linux")
+	}
+
+	commands := []string{}
+	network := NewNetwork("my-workspace", &Policy{Isolated: true, Egress: []string{"llm.example.com:443"}}, log.Discard)
+	network.resolver = fakeResolver{"llm.example.com": {"203.0.113.10"}}
+	network.exec = func(cmd *exec.Cmd) ([]byte, error) {
+		line := strings.Join(cmd.Args[2:], " ")
+		if strings.HasPrefix(line, "-D ") || line == "-L DOCKER-USER -n" {
+			return nil, fmt.Errorf("exit status 1")
+		}
+		commands = append(commands, line)
+		return nil, nil
+	}
+	assert.Equal(t, len(network.Bridge), 15)
+	assert.Assert(t, !network.Internal())
+
+	assert.NilError(t, network.Enforce(context.Background()))
+	chain, bridge := network.chain, network.Bridge
+	assert.DeepEqual(t, commands, []string{
+		"-N " + chain,
+		"-F " + chain,
+		"-A " + chain + " -m conntrack --ctstate ESTABLISHED,RELATED -j RETURN",
+		"-A " + chain + " -d 203.0.113.10/32 -p tcp --dport 443 -j RETURN",
+		"-A " + chain + " -j REJECT",
+		"-I FORWARD -i " + bridge + " -j " + chain,
+	})
+
+	ipv6 := NewNetwork("my-workspace", &Policy{Isolated: true, Egress: []string{"2001:db8::/32"}}, log.Discard)
+	ipv6.exec = network.exec
+	assert.ErrorContains(t, ipv6.Enforce(context.Background()), "only filter IPv4")
+	assert.ErrorContains(t, ipv6.CheckIPv6(true), "has IPv6 enabled")
+
+	internal := NewNetwork("my-workspace", &Policy{Isolated: true}, log.Discard)
+	assert.DeepEqual(t, internal.CreateArgs("my-workspace"), []string{
+		"network", "create",
+		"--driver", "bridge",
+		"--opt", "com.docker.network.bridge.name=" + bridge,
+		"--label", "kled.sh/workspace=my-workspace",
+		"--ipv6=false",
+		"--internal",
+		"kled-my-workspace",
+	})
+}
@@ -0,0 +1,184 @@
+package netpolicy
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"os/exec"
+	"runtime"
+	"strconv"
+	"strings"
+
+	"github.com/loft-sh/log"
+)
+
+// WorkspaceLabel is set on the network of a workspace
+const WorkspaceLabel = "kled.sh/workspace"
+
+// Network is the bridge network of an isolated workspace on docker or kata.
+// Without an allowlist the network is internal and has no egress at all,
+// otherwise egress is filtered by iptables rules in a chain of its own, which
+// only needs the machine to be a Linux host. The rules only filter IPv4, so
+// the network is created without IPv6 and IPv6 destinations are rejected
+type Network struct {
+	Policy *Policy
+	Log    log.Logger
+
+	// Name is the name of the container network
+	Name string
+	// Bridge is the name of the bridge interface, at most 15 characters
+	Bridge string
+
+	chain    string
+	resolver Resolver
+
+	// exec runs a command and returns its combined output
+	exec func(cmd *exec.Cmd) ([]byte, error)
+}
+
+// NewNetwork returns the network of a workspace
+func NewNetwork(workspaceID string, policy *Policy, log log.Logger) *Network {
+	sum := sha256.Sum256([]byte(workspaceID))
+	suffix := hex.EncodeToString(sum[:5])
+	return &Network{
+		Policy:   policy,
+		Log:      log,
+		Name:     "kled-" + workspaceID,
+		Bridge:   "kled-" + suffix,
+		chain:    "KLED-" + strings.ToUpper(suffix),
+		resolver: net.DefaultResolver,
+		exec: func(cmd *exec.Cmd) ([]byte, error) {
+			return cmd.CombinedOutput()
+		},
+	}
+}
+
+// Internal returns true if the network has no egress
+func (n *Network) Internal() bool {
+	return len(n.Policy.Egress) == 0
+}
+
+// CreateArgs are the arguments of docker or nerdctl to create the network
+func (n *Network) CreateArgs(workspaceID string) []string {
+	args := []string{
+		"network", "create",
+		"--driver", "bridge",
+		"--opt", "com.docker.network.bridge.name=" + n.Bridge,
+		"--label", WorkspaceLabel + "=" + workspaceID,
+		"--ipv6=false",
+	}
+	if n.Internal() {
+		args = append(args, "--internal")
+	}
+	return append(args, n.Name)
+}
+
+// Enforce replaces the egress rules of the network with the current
+// addresses of the allowlist
+func (n *Network) Enforce(ctx context.Context) error {
+	if n.Internal() {
+		return nil
+	} else if runtime.GOOS != "linux" {
+		return fmt.Errorf("an egress allowlist needs a Linux host, got %s", runtime.GOOS)
+	}
+
+	rules, err := n.Policy.Resolve(ctx, n.resolver)
+	if err != nil {
+		return err
+	}
+	for _, rule := range rules {
+		if strings.Contains(rule.CIDR, ":") {
+			return fmt.Errorf("egress destination %s is IPv6, isolated networks only filter IPv4", rule.CIDR)
+		}
+	}
+
+	// the chain might exist from a previous start
+	_ = n.iptables(ctx, "-N", n.chain)
+	err = n.iptables(ctx, "-F", n.chain)
+	if err != nil {
+		return err
+	}
+	err = n.iptables(ctx, "-A", n.chain, "-m", "conntrack", "--ctstate", "ESTABLISHED,RELATED", "-j", "RETURN")
+	if err != nil {
+		return err
+	}
+	for _, rule := range rules {
+		args := []string{"-A", n.chain, "-d", rule.CIDR}
+		if rule.Port != 0 {
+			args = append(args, "-p", "tcp", "--dport", strconv.Itoa(rule.Port))
+		}
+		err = n.iptables(ctx, append(args, "-j", "RETURN")...)
+		if err != nil {
+			return err
+		}
+	}
+	err = n.iptables(ctx, "-A", n.chain, "-j", "REJECT")
+	if err != nil {
+		return err
+	}
+
+	// the jump is moved to the top on every start, in case the runtime
+	// inserted rules of its own before it
+	parent := n.parentChain(ctx)
+	n.unlink(ctx, parent)
+	err = n.iptables(ctx, "-I", parent, "-i", n.Bridge, "-j", n.chain)
+	if err != nil {
+		return err
+	}
+
+	n.Log.Debugf("Allow egress of network %s to %d destinations", n.Name, len(rules))
+	return nil
+}
+
+// CheckIPv6 fails if IPv6 is enabled on the network, e.g. on a network
+// created by hand, as its IPv6 traffic would bypass the egress rules
+func (n *Network) CheckIPv6(enabled bool) error {
+	if enabled {
+		return fmt.Errorf("network %s has IPv6 enabled, isolated networks only filter IPv4", n.Name)
+	}
+	return nil
+}
+
+// Cleanup removes the egress rules of the network
+func (n *Network) Cleanup(ctx context.Context) error {
+	if n.Internal() || runtime.GOOS != "linux" {
+		return nil
+	}
+
+	n.unlink(ctx, n.parentChain(ctx))
+	if n.iptables(ctx, "-F", n.chain) != nil {
+		// the chain doesn't exist
+		return nil
+	}
+	return n.iptables(ctx, "-X", n.chain)
+}
+
+// parentChain returns the chain docker reserves for user rules, which it
+// evaluates before its own, or FORWARD if there is none, e.g. with nerdctl
+func (n *Network) parentChain(ctx context.Context) string {
+	if n.iptables(ctx, "-L", "DOCKER-USER", "-n") == nil {
+		return "DOCKER-USER"
+	}
+	return "FORWARD"
+}
+
+// unlink removes the jumps to the chain of the network, an interrupted start
+// might have inserted more than one
+func (n *Network) unlink(ctx context.Context, parent string) {
+	for {
+		if err := n.iptables(ctx, "-D", parent, "-i", n.Bridge, "-j", n.chain); err != nil {
+			return
+		}
+	}
+}
+
+func (n *Network) iptables(ctx context.Context, args ...string) error {
+	cmd := exec.CommandContext(ctx, "iptables", append([]string{"-w"}, args...)...)
+	out, err := n.exec(cmd)
+	if err != nil {
+		return fmt.Errorf("iptables %s: %w: %s", strings.Join(args, " "), err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
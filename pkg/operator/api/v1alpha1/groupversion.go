@@ -0,0 +1,23 @@
+// Package v1alpha1 holds the Workspace custom resource the kled operator
+// manages workspaces from.
+package v1alpha1
+
+import (
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-runtime/pkg/scheme"
+)
+
+var (
+	// GroupVersion is the group and version of the kled resources.
+	GroupVersion = schema.GroupVersion{Group: "kled.sh", Version: "v1alpha1"}
+
+	// SchemeBuilder registers the kled resources with a scheme.
+	SchemeBuilder = &scheme.Builder{GroupVersion: GroupVersion}
+
+	// AddToScheme adds the kled resources to a scheme.
+	AddToScheme = SchemeBuilder.AddToScheme
+)
+
+func init() {
+	SchemeBuilder.Register(&Workspace{}, &WorkspaceList{})
+}
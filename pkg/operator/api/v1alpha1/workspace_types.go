@@ -0,0 +1,100 @@
+package v1alpha1
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// Workspace is a kled workspace declared on the cluster. The operator
+// creates, starts, stops and deletes it the way kled up, stop and delete do.
+type Workspace struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   WorkspaceSpec   `json:"spec,omitempty"`
+	Status WorkspaceStatus `json:"status,omitempty"`
+}
+
+type WorkspaceSpec struct {
+	// Repository is the source of the workspace as passed to kled up, e.g.
+	// github.com/my-org/my-repo@main.
+	Repository string `json:"repository"`
+
+	// DevContainerPath is the path to the devcontainer.json relative to the
+	// repository.
+	DevContainerPath string `json:"devContainerPath,omitempty"`
+
+	// Provider is the provider to create the workspace with. If empty the
+	// default provider of the operator is used.
+	Provider string `json:"provider,omitempty"`
+
+	// ProviderOptions are the options of the provider, see kled provider
+	// options.
+	ProviderOptions map[string]string `json:"providerOptions,omitempty"`
+
+	// Resources of the workspace container. They are passed to the provider
+	// as the RESOURCES option, which the kubernetes provider understands.
+	Resources corev1.ResourceRequirements `json:"resources,omitempty"`
+
+	// Network isolates the network of the workspace, see kled up --network.
+	Network *WorkspaceNetwork `json:"network,omitempty"`
+
+	// DNS adds hosts entries and custom name resolution to the workspace,
+	// see kled up --add-host, --dns and --dns-search.
+	DNS *WorkspaceDNS `json:"dns,omitempty"`
+
+	// Stopped stops the workspace but keeps it, so it can be started again.
+	Stopped bool `json:"stopped,omitempty"`
+}
+
+type WorkspaceNetwork struct {
+	// Mode is isolated, to run the workspace in a network of its own, or
+	// open.
+	Mode string `json:"mode,omitempty"`
+
+	// AllowEgress are the hosts, IPs or CIDRs with an optional port an
+	// isolated workspace may connect to, e.g. pypi.org:443.
+	AllowEgress []string `json:"allowEgress,omitempty"`
+}
+
+type WorkspaceDNS struct {
+	// ExtraHosts are added to /etc/hosts of the workspace, as HOST:IP.
+	ExtraHosts []string `json:"extraHosts,omitempty"`
+
+	// Servers are the IPs of the DNS servers of the workspace.
+	Servers []string `json:"servers,omitempty"`
+
+	// Search are the DNS search domains of the workspace.
+	Search []string `json:"search,omitempty"`
+}
+
+type WorkspaceStatus struct {
+	// Phase is the phase of the workspace as shown by kled status, e.g.
+	// Building, Running or Error.
+	Phase string `json:"phase,omitempty"`
+
+	// WorkspaceID is the id of the workspace, to use it with the kled cli.
+	WorkspaceID string `json:"workspaceID,omitempty"`
+
+	// URL is where the running workspace can be reached.
+	URL string `json:"url,omitempty"`
+
+	// SpecHash is the hash of the spec the workspace was last started with.
+	// The workspace is recreated when it changes.
+	SpecHash string `json:"specHash,omitempty"`
+
+	// ObservedGeneration is the generation of the spec last reconciled.
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+
+	// Conditions are Ready, if the workspace is running, and Synced, if the
+	// spec was applied.
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+}
+
+// WorkspaceList is a list of workspaces.
+type WorkspaceList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+
+	Items []Workspace `json:"items"`
+}
@@ -0,0 +1,170 @@
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// DeepCopyInto copies the receiver into out.
+func (in *Workspace) DeepCopyInto(out *Workspace) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+	in.Status.DeepCopyInto(&out.Status)
+}
+
+// DeepCopy copies the receiver into a new Workspace.
+func (in *Workspace) DeepCopy() *Workspace {
+	if in == nil {
+		return nil
+	}
+	out := new(Workspace)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject copies the receiver into a new runtime.Object.
+func (in *Workspace) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto copies the receiver into out.
+func (in *WorkspaceList) DeepCopyInto(out *WorkspaceList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]Workspace, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy copies the receiver into a new WorkspaceList.
+func (in *WorkspaceList) DeepCopy() *WorkspaceList {
+	if in == nil {
+		return nil
+	}
+	out := new(WorkspaceList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject copies the receiver into a new runtime.Object.
+func (in *WorkspaceList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto copies the receiver into out.
+func (in *WorkspaceSpec) DeepCopyInto(out *WorkspaceSpec) {
+	*out = *in
+	if in.ProviderOptions != nil {
+		in, out := &in.ProviderOptions, &out.ProviderOptions
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	in.Resources.DeepCopyInto(&out.Resources)
+	if in.Network != nil {
+		in, out := &in.Network, &out.Network
+		*out = new(WorkspaceNetwork)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.DNS != nil {
+		in, out := &in.DNS, &out.DNS
+		*out = new(WorkspaceDNS)
+		(*in).DeepCopyInto(*out)
+	}
+}
+
+// DeepCopy copies the receiver into a new WorkspaceSpec.
+func (in *WorkspaceSpec) DeepCopy() *WorkspaceSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(WorkspaceSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto copies the receiver into out.
+func (in *WorkspaceDNS) DeepCopyInto(out *WorkspaceDNS) {
+	*out = *in
+	if in.ExtraHosts != nil {
+		in, out := &in.ExtraHosts, &out.ExtraHosts
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.Servers != nil {
+		in, out := &in.Servers, &out.Servers
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.Search != nil {
+		in, out := &in.Search, &out.Search
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy copies the receiver into a new WorkspaceDNS.
+func (in *WorkspaceDNS) DeepCopy() *WorkspaceDNS {
+	if in == nil {
+		return nil
+	}
+	out := new(WorkspaceDNS)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto copies the receiver into out.
+func (in *WorkspaceNetwork) DeepCopyInto(out *WorkspaceNetwork) {
+	*out = *in
+	if in.AllowEgress != nil {
+		in, out := &in.AllowEgress, &out.AllowEgress
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy copies the receiver into a new WorkspaceNetwork.
+func (in *WorkspaceNetwork) DeepCopy() *WorkspaceNetwork {
+	if in == nil {
+		return nil
+	}
+	out := new(WorkspaceNetwork)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto copies the receiver into out.
+func (in *WorkspaceStatus) DeepCopyInto(out *WorkspaceStatus) {
+	*out = *in
+	if in.Conditions != nil {
+		in, out := &in.Conditions, &out.Conditions
+		*out = make([]metav1.Condition, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy copies the receiver into a new WorkspaceStatus.
+func (in *WorkspaceStatus) DeepCopy() *WorkspaceStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(WorkspaceStatus)
+	in.DeepCopyInto(out)
+	return out
+}
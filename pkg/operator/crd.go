@@ -0,0 +1,8 @@
+package operator
+
+import _ "embed"
+
+// CRD is the CustomResourceDefinition of the Workspace resource.
+//
+//go:embed crd/kled.sh_workspaces.yaml
+var CRD []byte
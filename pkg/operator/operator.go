@@ -0,0 +1,271 @@
+// Package operator manages kled workspaces declared as Workspace resources.
+//
+// The operator doesn't create workspaces itself. It calls Workspaces, which
+// the kled cli implements with the same code as kled up, stop and delete,
+// so a workspace behaves the same whichever frontend created it and both
+// report its phase from the same workspace state. A changed spec deletes
+// the workspace and creates it again, as most of the spec only applies to
+// new workspaces.
+package operator
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/loft-sh/devpod/pkg/operator/api/v1alpha1"
+	"github.com/loft-sh/devpod/pkg/workspace"
+	"github.com/loft-sh/devpod/pkg/workspacestate"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// Finalizer keeps a Workspace resource until its workspace is deleted.
+const Finalizer = "kled.sh/workspace"
+
+// The condition types of a Workspace.
+const (
+	ConditionReady  = "Ready"
+	ConditionSynced = "Synced"
+)
+
+// ResourcesOption is the provider option the resources of a workspace are
+// passed as.
+const ResourcesOption = "RESOURCES"
+
+// Workspaces creates and changes workspaces the way the kled cli does.
+type Workspaces interface {
+	// Up creates the workspace or starts it.
+	Up(ctx context.Context, id string, spec v1alpha1.WorkspaceSpec) error
+	Stop(ctx context.Context, id string) error
+	Delete(ctx context.Context, id string) error
+	// State returns the state of the workspace, nil if it doesn't exist.
+	State(ctx context.Context, id string) (*workspacestate.State, error)
+}
+
+// Reconciler makes the workspace of every Workspace resource match its spec.
+type Reconciler struct {
+	client.Client
+	Workspaces Workspaces
+
+	// ResyncPeriod is how often a workspace is checked for drift, e.g. a
+	// workspace stopped with the cli while its resource wants it running.
+	ResyncPeriod time.Duration
+	// URLTemplate is the URL of running workspaces with {id} replaced by
+	// the workspace id. If empty no URL is reported.
+	URLTemplate string
+	// MaxConcurrentReconciles is how many workspaces are changed at the
+	// same time.
+	MaxConcurrentReconciles int
+}
+
+// SetupWithManager registers the reconciler with a manager.
+func (r *Reconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&v1alpha1.Workspace{}).
+		WithOptions(controller.Options{MaxConcurrentReconciles: r.MaxConcurrentReconciles}).
+		Complete(r)
+}
+
+// WorkspaceID returns the id of the workspace of a Workspace resource, unique
+// per namespace and name.
+func WorkspaceID(resource *v1alpha1.Workspace) string {
+	if resource.Status.WorkspaceID != "" {
+		return resource.Status.WorkspaceID
+	}
+
+	return workspace.ToID(resource.Namespace + "-" + resource.Name)
+}
+
+// ProviderOptions returns the provider options of a spec in the KEY=VALUE
+// form of kled up --provider-option, including the resources.
+func ProviderOptions(spec v1alpha1.WorkspaceSpec) []string {
+	options := []string{}
+	for key, value := range spec.ProviderOptions {
+		options = append(options, key+"="+value)
+	}
+	if resources := formatResources(spec.Resources); resources != "" {
+		options = append(options, ResourcesOption+"="+resources)
+	}
+	sort.Strings(options)
+
+	return options
+}
+
+// formatResources formats resources like requests.cpu=1,limits.memory=2Gi,
+// the form of the RESOURCES option of the kubernetes provider.
+func formatResources(resources corev1.ResourceRequirements) string {
+	formatted := []string{}
+	for prefix, list := range map[string]corev1.ResourceList{"requests.": resources.Requests, "limits.": resources.Limits} {
+		for name, quantity := range list {
+			formatted = append(formatted, prefix+string(name)+"="+quantity.String())
+		}
+	}
+	sort.Strings(formatted)
+
+	return strings.Join(formatted, ",")
+}
+
+// specHash hashes everything of a spec that needs a new workspace to change.
+func specHash(spec v1alpha1.WorkspaceSpec) string {
+	spec.Stopped = false
+	out, _ := json.Marshal(spec)
+	hash := sha256.Sum256(out)
+
+	return hex.EncodeToString(hash[:])[:16]
+}
+
+// Reconcile creates, starts, stops, recreates or deletes the workspace of a
+// Workspace resource and reports its phase.
+func (r *Reconciler) Reconcile(ctx context.Context, request ctrl.Request) (ctrl.Result, error) {
+	resource := &v1alpha1.Workspace{}
+	if err := r.Get(ctx, request.NamespacedName, resource); err != nil {
+		return ctrl.Result{}, client.IgnoreNotFound(err)
+	}
+
+	id := WorkspaceID(resource)
+	logger := log.FromContext(ctx).WithValues("workspace", id)
+
+	if !resource.DeletionTimestamp.IsZero() {
+		if !controllerutil.ContainsFinalizer(resource, Finalizer) {
+			return ctrl.Result{}, nil
+		}
+
+		logger.Info("Deleting workspace")
+		if err := r.Workspaces.Delete(ctx, id); err != nil {
+			return ctrl.Result{}, fmt.Errorf("delete workspace %s: %w", id, err)
+		}
+		controllerutil.RemoveFinalizer(resource, Finalizer)
+		return ctrl.Result{}, r.Update(ctx, resource)
+	}
+	if controllerutil.AddFinalizer(resource, Finalizer) {
+		if err := r.Update(ctx, resource); err != nil {
+			return ctrl.Result{}, err
+		}
+	}
+
+	state, err := r.Workspaces.State(ctx, id)
+	if err != nil {
+		return ctrl.Result{}, fmt.Errorf("get state of workspace %s: %w", id, err)
+	}
+
+	status := resource.Status.DeepCopy()
+	status.WorkspaceID = id
+	status.ObservedGeneration = resource.Generation
+	hash := specHash(resource.Spec)
+
+	var applyErr error
+	switch {
+	case resource.Spec.Stopped:
+		if state != nil && state.Phase != workspacestate.PhaseStopped {
+			logger.Info("Stopping workspace")
+			applyErr = r.Workspaces.Stop(ctx, id)
+		}
+	case state == nil || state.Phase != workspacestate.PhaseRunning || status.SpecHash != hash:
+		recreate := state != nil && status.SpecHash != "" && status.SpecHash != hash
+
+		// up can take minutes, so show that it started
+		status.Phase = string(workspacestate.PhaseStarting)
+		if state == nil || recreate {
+			status.Phase = string(workspacestate.PhaseBuilding)
+		}
+		if err := r.updateStatus(ctx, resource, status); err != nil {
+			return ctrl.Result{}, err
+		}
+
+		if recreate {
+			logger.Info("Deleting workspace to apply the changed spec")
+			applyErr = r.Workspaces.Delete(ctx, id)
+		}
+		if applyErr == nil {
+			logger.Info("Starting workspace")
+			applyErr = r.Workspaces.Up(ctx, id, resource.Spec)
+		}
+		if applyErr == nil {
+			status.SpecHash = hash
+		}
+	}
+
+	state, err = r.Workspaces.State(ctx, id)
+	if err != nil {
+		return ctrl.Result{}, fmt.Errorf("get state of workspace %s: %w", id, err)
+	}
+	r.setStatus(resource, status, state, applyErr)
+	if err := r.updateStatus(ctx, resource, status); err != nil {
+		return ctrl.Result{}, err
+	}
+	if applyErr != nil {
+		return ctrl.Result{}, applyErr
+	}
+
+	return ctrl.Result{RequeueAfter: r.ResyncPeriod}, nil
+}
+
+// setStatus sets the phase, URL and conditions of status from the state of
+// the workspace and the error applying the spec.
+func (r *Reconciler) setStatus(resource *v1alpha1.Workspace, status *v1alpha1.WorkspaceStatus, state *workspacestate.State, applyErr error) {
+	phase := workspacestate.PhasePending
+	if state != nil && state.Phase != "" {
+		phase = state.Phase
+	} else if resource.Spec.Stopped {
+		phase = workspacestate.PhaseStopped
+	}
+	status.Phase = string(phase)
+
+	status.URL = ""
+	if phase == workspacestate.PhaseRunning && r.URLTemplate != "" {
+		status.URL = strings.ReplaceAll(r.URLTemplate, "{id}", status.WorkspaceID)
+	}
+
+	ready := metav1.Condition{
+		Type:               ConditionReady,
+		Status:             metav1.ConditionFalse,
+		ObservedGeneration: resource.Generation,
+		Reason:             string(phase),
+		Message:            fmt.Sprintf("The workspace is %s", strings.ToLower(string(phase))),
+	}
+	if phase == workspacestate.PhaseRunning {
+		ready.Status = metav1.ConditionTrue
+	} else if phase == workspacestate.PhaseError && state.Message != "" {
+		ready.Message = state.Message
+	}
+	meta.SetStatusCondition(&status.Conditions, ready)
+
+	synced := metav1.Condition{
+		Type:               ConditionSynced,
+		Status:             metav1.ConditionTrue,
+		ObservedGeneration: resource.Generation,
+		Reason:             "Applied",
+		Message:            "The workspace matches the spec",
+	}
+	if applyErr != nil {
+		synced.Status = metav1.ConditionFalse
+		synced.Reason = "ApplyFailed"
+		if state != nil && state.Phase == workspacestate.PhaseError && state.Reason != "" {
+			synced.Reason = state.Reason
+		}
+		synced.Message = applyErr.Error()
+	}
+	meta.SetStatusCondition(&status.Conditions, synced)
+}
+
+func (r *Reconciler) updateStatus(ctx context.Context, resource *v1alpha1.Workspace, status *v1alpha1.WorkspaceStatus) error {
+	if equality.Semantic.DeepEqual(&resource.Status, status) {
+		return nil
+	}
+
+	resource.Status = *status.DeepCopy()
+	return r.Status().Update(ctx, resource)
+}
@@ -0,0 +1,168 @@
+package operator
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/loft-sh/devpod/pkg/operator/api/v1alpha1"
+	"github.com/loft-sh/devpod/pkg/workspacestate"
+	"gotest.tools/assert"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+// fakeWorkspaces records the calls of the reconciler and keeps the phase of
+// every workspace.
+type fakeWorkspaces struct {
+	phases map[string]workspacestate.Phase
+	calls  []string
+	upErr  error
+}
+
+func (w *fakeWorkspaces) Up(ctx context.Context, id string, spec v1alpha1.WorkspaceSpec) error {
+	w.calls = append(w.calls, "up "+id)
+	if w.upErr != nil {
+		w.phases[id] = workspacestate.PhaseError
+		return w.upErr
+	}
+	w.phases[id] = workspacestate.PhaseRunning
+	return nil
+}
+
+func (w *fakeWorkspaces) Stop(ctx context.Context, id string) error {
+	w.calls = append(w.calls, "stop "+id)
+	w.phases[id] = workspacestate.PhaseStopped
+	return nil
+}
+
+func (w *fakeWorkspaces) Delete(ctx context.Context, id string) error {
+	w.calls = append(w.calls, "delete "+id)
+	delete(w.phases, id)
+	return nil
+}
+
+func (w *fakeWorkspaces) State(ctx context.Context, id string) (*workspacestate.State, error) {
+	phase, ok := w.phases[id]
+	if !ok {
+		return nil, nil
+	}
+	state := &workspacestate.State{Phase: phase}
+	if phase == workspacestate.PhaseError {
+		state.Reason = "BuildFailed"
+	}
+	return state, nil
+}
+
+func newTestReconciler(t *testing.T, objects ...client.Object) (*Reconciler, *fakeWorkspaces) {
+	t.Helper()
+	scheme := runtime.NewScheme()
+	assert.NilError(t, v1alpha1.AddToScheme(scheme))
+
+	workspaces := &fakeWorkspaces{phases: map[string]workspacestate.Phase{}}
+	return &Reconciler{
+		Client: fake.NewClientBuilder().
+			WithScheme(scheme).
+			WithObjects(objects...).
+			WithStatusSubresource(&v1alpha1.Workspace{}).
+			Build(),
+		Workspaces:   workspaces,
+		ResyncPeriod: time.Minute,
+		URLTemplate:  "https://{id}.example.com",
+	}, workspaces
+}
+
+var request = ctrl.Request{NamespacedName: types.NamespacedName{Namespace: "team", Name: "api"}}
+
+func testWorkspace() *v1alpha1.Workspace {
+	return &v1alpha1.Workspace{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "team", Name: "api"},
+		Spec:       v1alpha1.WorkspaceSpec{Repository: "github.com/acme/api"},
+	}
+}
+
+func (r *Reconciler) get(t *testing.T) *v1alpha1.Workspace {
+	t.Helper()
+	workspace := &v1alpha1.Workspace{}
+	assert.NilError(t, r.Get(context.Background(), request.NamespacedName, workspace))
+	return workspace
+}
+
+func TestReconcileFollowsSpec(t *testing.T) {
+	ctx := context.Background()
+	reconciler, workspaces := newTestReconciler(t, testWorkspace())
+
+	result, err := reconciler.Reconcile(ctx, request)
+	assert.NilError(t, err)
+	assert.Equal(t, result.RequeueAfter, time.Minute)
+
+	workspace := reconciler.get(t)
+	assert.DeepEqual(t, workspace.Finalizers, []string{Finalizer})
+	assert.Equal(t, workspace.Status.WorkspaceID, "team-api")
+	assert.Equal(t, workspace.Status.Phase, "Running")
+	assert.Equal(t, workspace.Status.URL, "https://team-api.example.com")
+	assert.Assert(t, meta.IsStatusConditionTrue(workspace.Status.Conditions, ConditionReady))
+
+	// a running workspace with an unchanged spec is left alone
+	_, err = reconciler.Reconcile(ctx, request)
+	assert.NilError(t, err)
+	assert.DeepEqual(t, workspaces.calls, []string{"up team-api"})
+
+	workspace.Spec.Stopped = true
+	assert.NilError(t, reconciler.Update(ctx, workspace))
+	_, err = reconciler.Reconcile(ctx, request)
+	assert.NilError(t, err)
+	workspace = reconciler.get(t)
+	assert.Equal(t, workspace.Status.Phase, "Stopped")
+	assert.Equal(t, workspace.Status.URL, "")
+	assert.Assert(t, meta.IsStatusConditionFalse(workspace.Status.Conditions, ConditionReady))
+
+	// a changed spec recreates the workspace once it runs again
+	workspace.Spec.Stopped = false
+	workspace.Spec.DevContainerPath = ".devcontainer/gpu/devcontainer.json"
+	assert.NilError(t, reconciler.Update(ctx, workspace))
+	_, err = reconciler.Reconcile(ctx, request)
+	assert.NilError(t, err)
+	assert.DeepEqual(t, workspaces.calls, []string{"up team-api", "stop team-api", "delete team-api", "up team-api"})
+
+	assert.NilError(t, reconciler.Delete(ctx, reconciler.get(t)))
+	_, err = reconciler.Reconcile(ctx, request)
+	assert.NilError(t, err)
+	assert.Equal(t, workspaces.calls[len(workspaces.calls)-1], "delete team-api")
+	assert.ErrorContains(t, reconciler.Get(ctx, request.NamespacedName, &v1alpha1.Workspace{}), "not found")
+}
+
+func TestReconcileReportsFailures(t *testing.T) {
+	reconciler, workspaces := newTestReconciler(t, testWorkspace())
+	workspaces.upErr = errors.New("build failed")
+
+	_, err := reconciler.Reconcile(context.Background(), request)
+	assert.ErrorContains(t, err, "build failed")
+
+	workspace := reconciler.get(t)
+	assert.Equal(t, workspace.Status.Phase, "Error")
+	assert.Equal(t, workspace.Status.SpecHash, "")
+	synced := meta.FindStatusCondition(workspace.Status.Conditions, ConditionSynced)
+	assert.Equal(t, synced.Status, metav1.ConditionFalse)
+	assert.Equal(t, synced.Reason, "BuildFailed")
+	assert.Equal(t, synced.Message, "build failed")
+}
+
+func TestProviderOptions(t *testing.T) {
+	options := ProviderOptions(v1alpha1.WorkspaceSpec{
+		ProviderOptions: map[string]string{"KUBERNETES_NAMESPACE": "workspaces"},
+		Resources: corev1.ResourceRequirements{
+			Requests: corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("500m")},
+			Limits:   corev1.ResourceList{corev1.ResourceMemory: resource.MustParse("2Gi")},
+		},
+	})
+	assert.DeepEqual(t, options, []string{"KUBERNETES_NAMESPACE=workspaces", "RESOURCES=limits.memory=2Gi,requests.cpu=500m"})
+}
@@ -234,6 +234,17 @@ func ResolveAgentConfig(devConfig *config.Config, provider *provider2.ProviderCo
 	agentConfig.Docker.Builder = resolver.ResolveDefaultValue(agentConfig.Docker.Builder, options)
 	agentConfig.Docker.Install = types.StrBool(resolver.ResolveDefaultValue(string(agentConfig.Docker.Install), options))
 	agentConfig.Docker.Env = resolver.ResolveDefaultValues(agentConfig.Docker.Env, options)
+	agentConfig.Docker.EncryptVolumes = types.StrBool(resolver.ResolveDefaultValue(string(agentConfig.Docker.EncryptVolumes), options))
+	agentConfig.Docker.VolumeKey = resolver.ResolveDefaultValue(agentConfig.Docker.VolumeKey, options)
+	agentConfig.Docker.VolumeSize = resolver.ResolveDefaultValue(agentConfig.Docker.VolumeSize, options)
+
+	// kata driver
+	agentConfig.Kata.Path = resolver.ResolveDefaultValue(agentConfig.Kata.Path, options)
+	agentConfig.Kata.ContainerdPath = resolver.ResolveDefaultValue(agentConfig.Kata.ContainerdPath, options)
+	agentConfig.Kata.Install = types.StrBool(resolver.ResolveDefaultValue(string(agentConfig.Kata.Install), options))
+	agentConfig.Kata.Env = resolver.ResolveDefaultValues(agentConfig.Kata.Env, options)
+	agentConfig.Kata.Hibernate = types.StrBool(resolver.ResolveDefaultValue(string(agentConfig.Kata.Hibernate), options))
+	agentConfig.Kata.CheckpointDir = resolver.ResolveDefaultValue(agentConfig.Kata.CheckpointDir, options)
 
 	// kubernetes driver
 	agentConfig.Kubernetes.KubernetesContext = resolver.ResolveDefaultValue(agentConfig.Kubernetes.KubernetesContext, options)
@@ -242,6 +253,7 @@ func ResolveAgentConfig(devConfig *config.Config, provider *provider2.ProviderCo
 	agentConfig.Kubernetes.Architecture = resolver.ResolveDefaultValue(agentConfig.Kubernetes.Architecture, options)
 	agentConfig.Kubernetes.InactivityTimeout = resolver.ResolveDefaultValue(agentConfig.Kubernetes.InactivityTimeout, options)
 	agentConfig.Kubernetes.StorageClass = resolver.ResolveDefaultValue(agentConfig.Kubernetes.StorageClass, options)
+	agentConfig.Kubernetes.EncryptedStorageClass = resolver.ResolveDefaultValue(agentConfig.Kubernetes.EncryptedStorageClass, options)
 	agentConfig.Kubernetes.PvcAccessMode = resolver.ResolveDefaultValue(agentConfig.Kubernetes.PvcAccessMode, options)
 	agentConfig.Kubernetes.PvcAnnotations = resolver.ResolveDefaultValue(agentConfig.Kubernetes.PvcAnnotations, options)
 	agentConfig.Kubernetes.NodeSelector = resolver.ResolveDefaultValue(agentConfig.Kubernetes.NodeSelector, options)
@@ -1,8 +1,10 @@
 package resolver
 
 import (
+	"errors"
 	"fmt"
 	"regexp"
+	"sort"
 	"strconv"
 	"time"
 
@@ -24,6 +26,53 @@ func printUnusedUserValues(userValues map[string]string, options config.OptionDe
 	}
 }
 
+// ValidateUserValues checks user values against the option definitions
+// without running any option commands and returns all problems at once.
+// Unknown options are only rejected if the definitions are complete, options
+// with a sub options command define further options when resolved.
+func ValidateUserValues(options config.OptionDefinitions, userValues map[string]string) error {
+	complete := true
+	allowedOptions := []string{}
+	for name, option := range options {
+		if option.SubOptionsCommand != "" {
+			complete = false
+		}
+		if !option.Hidden {
+			allowedOptions = append(allowedOptions, name)
+		}
+	}
+	sort.Strings(allowedOptions)
+
+	names := make([]string, 0, len(userValues))
+	for name := range userValues {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	errs := []error{}
+	for _, name := range names {
+		option := options[name]
+		if option == nil {
+			if complete {
+				errs = append(errs, fmt.Errorf("unknown option '%s', allowed options are %v", name, allowedOptions))
+			}
+			continue
+		}
+
+		if userValues[name] == "" {
+			if option.Required {
+				errs = append(errs, fmt.Errorf("option '%s' is required and cannot be empty", name))
+			}
+			continue
+		}
+		if err := validateUserValue(name, userValues[name], option); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
 func validateUserValue(optionName, userValue string, option *types.Option) error {
 	if option.ValidationPattern != "" {
 		matcher, err := regexp.Compile(option.ValidationPattern)
@@ -49,7 +98,7 @@ func validateUserValue(optionName, userValue string, option *types.Option) error
 			}
 		}
 		if !found {
-			return fmt.Errorf("invalid value '%s' for option '%s', has to match one of the following values: %v", userValue, optionName, option.Enum)
+			return fmt.Errorf("invalid value '%s' for option '%s', has to match one of the following values: %v", userValue, optionName, EnumValues(option.Enum))
 		}
 	}
 
@@ -74,3 +123,12 @@ func validateUserValue(optionName, userValue string, option *types.Option) error
 
 	return nil
 }
+
+// EnumValues returns the allowed values of an option.
+func EnumValues(enum types.OptionEnumArray) []string {
+	values := make([]string, 0, len(enum))
+	for _, e := range enum {
+		values = append(values, e.Value)
+	}
+	return values
+}
@@ -0,0 +1,32 @@
+package resolver
+
+import (
+	"testing"
+
+	"github.com/loft-sh/devpod/pkg/config"
+	"github.com/loft-sh/devpod/pkg/types"
+	"gotest.tools/assert"
+)
+
+func TestValidateUserValues(t *testing.T) {
+	options := config.OptionDefinitions{
+		"REGION":    {Required: true, Enum: types.OptionEnumArray{{Value: "eu"}, {Value: "us"}}},
+		"DISK_SIZE": {Type: "number", Default: "40"},
+		"TIMEOUT":   {Type: "duration"},
+		"TOKEN":     {Password: true},
+	}
+
+	assert.NilError(t, ValidateUserValues(options, map[string]string{"REGION": "eu", "DISK_SIZE": "100", "TIMEOUT": "5m", "TOKEN": "secret"}))
+
+	err := ValidateUserValues(options, map[string]string{"REGION": "asia", "DISK_SIZE": "big", "REGOIN": "eu"})
+	assert.ErrorContains(t, err, "invalid value 'big' for option 'DISK_SIZE', must be a number")
+	assert.ErrorContains(t, err, "invalid value 'asia' for option 'REGION', has to match one of the following values: [eu us]")
+	assert.ErrorContains(t, err, "unknown option 'REGOIN', allowed options are [DISK_SIZE REGION TIMEOUT TOKEN]")
+
+	err = ValidateUserValues(options, map[string]string{"REGION": ""})
+	assert.ErrorContains(t, err, "option 'REGION' is required")
+
+	// sub options define further options, unknown ones are resolved later
+	options["CLUSTER"] = &types.Option{SubOptionsCommand: "list-cluster-options"}
+	assert.NilError(t, ValidateUserValues(options, map[string]string{"NODE_POOL": "default"}))
+}
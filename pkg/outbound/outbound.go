@@ -0,0 +1,161 @@
+package outbound
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/loft-sh/devpod/pkg/config"
+	"golang.org/x/net/http/httpproxy"
+)
+
+// Options configure the proxy and additional trusted CAs for outbound
+// connections of kled and the agent
+type Options struct {
+	HTTPProxy  string `json:"httpProxy,omitempty"`
+	HTTPSProxy string `json:"httpsProxy,omitempty"`
+	NoProxy    string `json:"noProxy,omitempty"`
+
+	// CAData holds the PEM encoded CA bundle, it's passed by value so the
+	// agent can use it on remote machines
+	CAData string `json:"caData,omitempty"`
+}
+
+var (
+	current   Options
+	currentMu sync.Mutex
+)
+
+// certDirectories are the default directories go and most other tools read
+// system roots from on linux
+var certDirectories = []string{"/etc/ssl/certs", "/etc/pki/tls/certs"}
+
+// FromContext reads the options from the current context
+func FromContext(kledConfig *config.Config) (Options, error) {
+	options := Options{
+		HTTPProxy:  kledConfig.ContextOption(config.ContextOptionHTTPProxy),
+		HTTPSProxy: kledConfig.ContextOption(config.ContextOptionHTTPSProxy),
+		NoProxy:    kledConfig.ContextOption(config.ContextOptionNoProxy),
+	}
+
+	caBundle := kledConfig.ContextOption(config.ContextOptionCABundle)
+	if caBundle != "" {
+		out, err := os.ReadFile(caBundle)
+		if err != nil {
+			return Options{}, fmt.Errorf("read CA bundle: %w", err)
+		} else if !x509.NewCertPool().AppendCertsFromPEM(out) {
+			return Options{}, fmt.Errorf("CA bundle %s contains no certificates", caBundle)
+		}
+
+		options.CAData = string(out)
+	}
+
+	return options, nil
+}
+
+// Empty returns true if no proxy or CA bundle is configured
+func (o Options) Empty() bool {
+	return o == Options{}
+}
+
+// Current returns the options applied to this process
+func Current() Options {
+	currentMu.Lock()
+	defer currentMu.Unlock()
+
+	return current
+}
+
+// Apply configures the default http transport and the environment of this
+// process, so in-process clients as well as child processes like docker,
+// nerdctl and git use the proxy and trust the CA bundle.
+func (o Options) Apply() error {
+	if o.Empty() {
+		return nil
+	}
+
+	currentMu.Lock()
+	defer currentMu.Unlock()
+
+	for _, env := range o.proxyEnv() {
+		key, value, _ := strings.Cut(env, "=")
+		_ = os.Setenv(key, value)
+	}
+
+	transport, ok := http.DefaultTransport.(*http.Transport)
+	if ok {
+		proxyFunc := (&httpproxy.Config{
+			HTTPProxy:  o.HTTPProxy,
+			HTTPSProxy: o.HTTPSProxy,
+			NoProxy:    o.NoProxy,
+		}).ProxyFunc()
+		transport.Proxy = func(req *http.Request) (*url.URL, error) {
+			return proxyFunc(req.URL)
+		}
+	}
+
+	if o.CAData != "" {
+		rootCAs, err := x509.SystemCertPool()
+		if err != nil || rootCAs == nil {
+			rootCAs = x509.NewCertPool()
+		}
+		if !rootCAs.AppendCertsFromPEM([]byte(o.CAData)) {
+			return fmt.Errorf("CA bundle contains no certificates")
+		}
+		if ok {
+			if transport.TLSClientConfig == nil {
+				transport.TLSClientConfig = &tls.Config{}
+			}
+			transport.TLSClientConfig.RootCAs = rootCAs
+		}
+
+		certDir, err := writeCertDir(o.CAData)
+		if err != nil {
+			return err
+		}
+		_ = os.Setenv("SSL_CERT_DIR", strings.Join(append(certDirectories, certDir), string(os.PathListSeparator)))
+	}
+
+	current = o
+	return nil
+}
+
+func (o Options) proxyEnv() []string {
+	env := []string{}
+	if o.HTTPProxy != "" {
+		env = append(env, "HTTP_PROXY="+o.HTTPProxy, "http_proxy="+o.HTTPProxy)
+	}
+	if o.HTTPSProxy != "" {
+		env = append(env, "HTTPS_PROXY="+o.HTTPSProxy, "https_proxy="+o.HTTPSProxy)
+	}
+	if o.NoProxy != "" {
+		env = append(env, "NO_PROXY="+o.NoProxy, "no_proxy="+o.NoProxy)
+	}
+	return env
+}
+
+// writeCertDir writes the CA bundle into a directory that is added to
+// SSL_CERT_DIR. Other than SSL_CERT_FILE this keeps the system roots.
+func writeCertDir(caData string) (string, error) {
+	hash := sha256.Sum256([]byte(caData))
+	certDir := filepath.Join(os.TempDir(), "kled-ca-"+hex.EncodeToString(hash[:])[:12])
+	err := os.MkdirAll(certDir, 0755)
+	if err != nil {
+		return "", err
+	}
+
+	err = os.WriteFile(filepath.Join(certDir, "kled-ca-bundle.pem"), []byte(caData), 0644)
+	if err != nil {
+		return "", fmt.Errorf("write CA bundle: %w", err)
+	}
+
+	return certDir, nil
+}
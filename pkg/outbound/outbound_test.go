@@ -0,0 +1,84 @@
+package outbound
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/loft-sh/devpod/pkg/config"
+	"gotest.tools/assert"
+)
+
+func contextConfig(options map[string]string) *config.Config {
+	contextOptions := map[string]config.OptionValue{}
+	for key, value := range options {
+		contextOptions[key] = config.OptionValue{Value: value}
+	}
+
+	return &config.Config{
+		DefaultContext: "default",
+		Contexts: map[string]*config.ContextConfig{
+			"default": {Options: contextOptions},
+		},
+	}
+}
+
+func TestFromContext(t *testing.T) {
+	options, err := FromContext(contextConfig(nil))
+	assert.NilError(t, err)
+	assert.Assert(t, options.Empty())
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NilError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "kled test CA"},
+		NotBefore:    time.Now(),
+		NotAfter:     time.Now().Add(time.Hour),
+		IsCA:         true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	assert.NilError(t, err)
+	caBundle := filepath.Join(t.TempDir(), "ca.pem")
+	caData := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	assert.NilError(t, os.WriteFile(caBundle, caData, 0600))
+
+	options, err = FromContext(contextConfig(map[string]string{
+		config.ContextOptionHTTPSProxy: "http://proxy.corp:3128",
+		config.ContextOptionNoProxy:    "localhost,.corp",
+		config.ContextOptionCABundle:   caBundle,
+	}))
+	assert.NilError(t, err)
+	assert.DeepEqual(t, options, Options{
+		HTTPSProxy: "http://proxy.corp:3128",
+		NoProxy:    "localhost,.corp",
+		CAData:     string(caData),
+	})
+
+	invalid := filepath.Join(t.TempDir(), "invalid.pem")
+	assert.NilError(t, os.WriteFile(invalid, []byte("not a certificate"), 0600))
+	_, err = FromContext(contextConfig(map[string]string{config.ContextOptionCABundle: invalid}))
+	assert.ErrorContains(t, err, "contains no certificates")
+}
+
+func TestWriteCertDir(t *testing.T) {
+	certDir, err := writeCertDir("ca data")
+	assert.NilError(t, err)
+	defer os.RemoveAll(certDir)
+
+	out, err := os.ReadFile(filepath.Join(certDir, "kled-ca-bundle.pem"))
+	assert.NilError(t, err)
+	assert.Equal(t, string(out), "ca data")
+
+	again, err := writeCertDir("ca data")
+	assert.NilError(t, err)
+	assert.Equal(t, again, certDir)
+}
@@ -22,6 +22,23 @@ func FindAvailablePort(start int) (int, error) {
 	return 0, fmt.Errorf("couldn't find an available port")
 }
 
+// FindAvailablePortOn returns the first port from start on that can be bound
+// on the given host, skipping the ports in exclude.
+func FindAvailablePortOn(host string, start int, exclude map[int]bool) (int, error) {
+	for i := start; i < start+1000 && i <= 65535; i++ {
+		if exclude[i] {
+			continue
+		}
+
+		available, _ := IsAvailable(net.JoinHostPort(host, strconv.Itoa(i)))
+		if available {
+			return i, nil
+		}
+	}
+
+	return 0, fmt.Errorf("couldn't find an available port on %s from %d", host, start)
+}
+
 func IsAvailable(addr string) (bool, error) {
 	timeout := time.Millisecond * 500
 	conn, err := net.DialTimeout("tcp", addr, timeout)
@@ -0,0 +1,307 @@
+package portmanager
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/loft-sh/devpod/pkg/port"
+	"github.com/loft-sh/devpod/pkg/provider"
+	"github.com/loft-sh/log"
+)
+
+// PortsDir holds one file per kled process that forwards ports of the
+// workspace, so concurrent ssh sessions never write the same file.
+const PortsDir = "ports"
+
+// staleAfter is how long a ports file without any listening port is kept,
+// as the forwards of a process might not be bound yet.
+const staleAfter = time.Minute
+
+// Source is where a forwarded port comes from.
+type Source string
+
+const (
+	SourceAppPort      Source = "appPort"
+	SourceForwardPorts Source = "forwardPorts"
+	SourceDetected     Source = "detected"
+	SourceExtra        Source = "extra"
+)
+
+// Forward is a port of the workspace that is forwarded to the local machine.
+type Forward struct {
+	Source Source `json:"source"`
+
+	// Remote is the address in the container, e.g. localhost:3000 or db:5432
+	Remote string `json:"remote"`
+
+	// Local is the address kled listens on, e.g. localhost:3000
+	Local string `json:"local"`
+
+	// RequestedPort is the local port that was configured, if it was taken and
+	// a different port had to be allocated
+	RequestedPort string `json:"requestedPort,omitempty"`
+
+	PID       int       `json:"pid"`
+	StartedAt time.Time `json:"startedAt"`
+}
+
+// Public returns if the port is reachable from other machines.
+func (f Forward) Public() bool {
+	host, _, err := net.SplitHostPort(f.Local)
+	if err != nil {
+		return false
+	}
+
+	return host != "localhost" && !net.ParseIP(host).IsLoopback()
+}
+
+// BindHost returns the host local ports are bound to.
+func BindHost(public bool) string {
+	if public {
+		return "0.0.0.0"
+	}
+
+	return "localhost"
+}
+
+// Manager allocates the local ports of a workspace and records them, so they
+// can be listed with kled workspace ports.
+type Manager struct {
+	m sync.Mutex
+
+	context     string
+	workspaceID string
+	public      bool
+	forwards    map[string]Forward
+	log         log.Logger
+}
+
+// NewManager creates a manager for the ports of a workspace. If workspaceID
+// is empty, ports are allocated but not recorded.
+func NewManager(context, workspaceID string, public bool, log log.Logger) *Manager {
+	return &Manager{
+		context:     context,
+		workspaceID: workspaceID,
+		public:      public,
+		forwards:    map[string]Forward{},
+		log:         log,
+	}
+}
+
+// Allocate returns the local address to forward the requested port to. An
+// explicit host is kept, otherwise the port is bound on localhost or on all
+// interfaces if ports are public. If the port is already forwarded for this
+// workspace by another kled process, ok is false and the port should not be
+// forwarded again. If something else uses the port, the next free port is
+// allocated.
+func (m *Manager) Allocate(host, requestedPort string) (local string, ok bool, err error) {
+	m.m.Lock()
+	defer m.m.Unlock()
+
+	if host == "" || host == "localhost" {
+		host = BindHost(m.public)
+	}
+
+	portNumber, err := strconv.Atoi(requestedPort)
+	if err != nil {
+		return "", false, fmt.Errorf("parse port %s: %w", requestedPort, err)
+	}
+
+	local = net.JoinHostPort(host, requestedPort)
+	for _, forward := range m.forwards {
+		if forward.Local == local || forward.RequestedPort == requestedPort {
+			return "", false, nil
+		}
+	}
+	if available, _ := port.IsAvailable(local); available {
+		return local, true, nil
+	}
+
+	if m.forwardedByOtherProcess(requestedPort) {
+		m.log.Debugf("Port %s is already forwarded for workspace %s", requestedPort, m.workspaceID)
+		return "", false, nil
+	}
+
+	exclude := map[int]bool{}
+	for _, forward := range m.forwards {
+		_, usedPort, _ := net.SplitHostPort(forward.Local)
+		usedPortNumber, _ := strconv.Atoi(usedPort)
+		exclude[usedPortNumber] = true
+	}
+
+	allocated, err := port.FindAvailablePortOn(host, portNumber+1, exclude)
+	if err != nil {
+		return "", false, err
+	}
+
+	local = net.JoinHostPort(host, strconv.Itoa(allocated))
+	m.log.Warnf("Local port %s is already in use, forwarding to %s instead", requestedPort, local)
+	return local, true, nil
+}
+
+// Add records a forward that was started.
+func (m *Manager) Add(source Source, remote, local, requestedPort string) {
+	m.m.Lock()
+	defer m.m.Unlock()
+
+	forward := Forward{
+		Source:    source,
+		Remote:    remote,
+		Local:     local,
+		PID:       os.Getpid(),
+		StartedAt: time.Now(),
+	}
+	if _, localPort, _ := net.SplitHostPort(local); localPort != requestedPort {
+		forward.RequestedPort = requestedPort
+	}
+
+	m.forwards[local] = forward
+	m.save()
+}
+
+// Remove removes a forward that was stopped.
+func (m *Manager) Remove(local string) {
+	m.m.Lock()
+	defer m.m.Unlock()
+
+	delete(m.forwards, local)
+	m.save()
+}
+
+// Close removes all forwards of this process.
+func (m *Manager) Close() {
+	m.m.Lock()
+	defer m.m.Unlock()
+
+	m.forwards = map[string]Forward{}
+	m.save()
+}
+
+func (m *Manager) forwardedByOtherProcess(requestedPort string) bool {
+	if m.workspaceID == "" {
+		return false
+	}
+
+	forwards, err := List(m.context, m.workspaceID)
+	if err != nil {
+		m.log.Debugf("Error listing forwarded ports: %v", err)
+		return false
+	}
+
+	for _, forward := range forwards {
+		_, localPort, _ := net.SplitHostPort(forward.Local)
+		if forward.PID != os.Getpid() && (localPort == requestedPort || forward.RequestedPort == requestedPort) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (m *Manager) save() {
+	if m.workspaceID == "" {
+		return
+	}
+
+	portsFile, err := m.portsFile()
+	if err != nil {
+		m.log.Debugf("Error saving forwarded ports: %v", err)
+		return
+	}
+
+	if len(m.forwards) == 0 {
+		_ = os.Remove(portsFile)
+		return
+	}
+
+	forwards := make([]Forward, 0, len(m.forwards))
+	for _, forward := range m.forwards {
+		forwards = append(forwards, forward)
+	}
+
+	out, err := json.Marshal(forwards)
+	if err == nil {
+		err = os.MkdirAll(filepath.Dir(portsFile), 0755)
+	}
+	if err == nil {
+		err = os.WriteFile(portsFile, out, 0666)
+	}
+	if err != nil {
+		m.log.Debugf("Error saving forwarded ports: %v", err)
+	}
+}
+
+func (m *Manager) portsFile() (string, error) {
+	workspaceDir, err := provider.GetWorkspaceDir(m.context, m.workspaceID)
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(workspaceDir, PortsDir, strconv.Itoa(os.Getpid())+".json"), nil
+}
+
+// List returns the forwarded ports of a workspace that are currently
+// listening, sorted by local address. Files of exited processes are removed.
+func List(context, workspaceID string) ([]Forward, error) {
+	workspaceDir, err := provider.GetWorkspaceDir(context, workspaceID)
+	if err != nil {
+		return nil, err
+	}
+
+	portsDir := filepath.Join(workspaceDir, PortsDir)
+	entries, err := os.ReadDir(portsDir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	forwards := []Forward{}
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".json") {
+			continue
+		}
+
+		portsFile := filepath.Join(portsDir, entry.Name())
+		data, err := os.ReadFile(portsFile)
+		if err != nil {
+			continue
+		}
+
+		fileForwards := []Forward{}
+		if json.Unmarshal(data, &fileForwards) != nil {
+			continue
+		}
+
+		listening := 0
+		for _, forward := range fileForwards {
+			if available, _ := port.IsAvailable(forward.Local); available {
+				continue
+			}
+
+			forwards = append(forwards, forward)
+			listening++
+		}
+
+		if listening == 0 {
+			info, err := entry.Info()
+			if err == nil && time.Since(info.ModTime()) > staleAfter {
+				_ = os.Remove(portsFile)
+			}
+		}
+	}
+
+	sort.Slice(forwards, func(i, j int) bool {
+		return forwards[i].Local < forwards[j].Local
+	})
+	return forwards, nil
+}
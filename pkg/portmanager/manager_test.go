@@ -0,0 +1,56 @@
+package portmanager
+
+import (
+	"net"
+	"strconv"
+	"testing"
+
+	"github.com/loft-sh/log"
+	"gotest.tools/assert"
+)
+
+func TestAllocate(t *testing.T) {
+	t.Setenv("KLED_HOME", t.TempDir())
+
+	// occupy a port that is not forwarded by kled
+	listener, err := net.Listen("tcp", "localhost:0")
+	assert.NilError(t, err)
+	defer listener.Close()
+	taken := strconv.Itoa(listener.Addr().(*net.TCPAddr).Port)
+
+	manager := NewManager("default", "my-workspace", false, log.Discard)
+	local, ok, err := manager.Allocate("", taken)
+	assert.NilError(t, err)
+	assert.Assert(t, ok)
+	assert.Assert(t, local != "localhost:"+taken)
+
+	// bind the allocated port like the port forward would
+	forwardListener, err := net.Listen("tcp", local)
+	assert.NilError(t, err)
+	defer forwardListener.Close()
+	manager.Add(SourceAppPort, "localhost:"+taken, local, taken)
+
+	// the same port is not forwarded twice
+	_, ok, err = manager.Allocate("", taken)
+	assert.NilError(t, err)
+	assert.Assert(t, !ok)
+
+	forwards, err := List("default", "my-workspace")
+	assert.NilError(t, err)
+	assert.Equal(t, len(forwards), 1)
+	assert.Equal(t, forwards[0].Local, local)
+	assert.Equal(t, forwards[0].RequestedPort, taken)
+	assert.Assert(t, !forwards[0].Public())
+
+	manager.Close()
+	forwards, err = List("default", "my-workspace")
+	assert.NilError(t, err)
+	assert.Equal(t, len(forwards), 0)
+}
+
+func TestPublic(t *testing.T) {
+	assert.Assert(t, Forward{Local: "0.0.0.0:3000"}.Public())
+	assert.Assert(t, !Forward{Local: "localhost:3000"}.Public())
+	assert.Assert(t, !Forward{Local: "127.0.0.1:3000"}.Public())
+	assert.Equal(t, BindHost(true), "0.0.0.0")
+}
@@ -0,0 +1,217 @@
+package probe
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxBenchmarkHistory is the number of benchmarks kept per provider.
+const maxBenchmarkHistory = 50
+
+// Measurement is one result of a benchmark.
+type Measurement struct {
+	Name  string  `json:"name"`
+	Value float64 `json:"value"`
+	Unit  string  `json:"unit"`
+	// HigherIsBetter is set for throughputs.
+	HigherIsBetter bool `json:"higherIsBetter,omitempty"`
+	// Skipped is why the measurement wasn't taken.
+	Skipped string `json:"skipped,omitempty"`
+}
+
+// Benchmark are the measurements of a run against a provider.
+type Benchmark struct {
+	Provider     string        `json:"provider"`
+	Source       string        `json:"source"`
+	Time         time.Time     `json:"time"`
+	Measurements []Measurement `json:"measurements"`
+}
+
+// Get returns the measurement with the name, or nil if it wasn't taken.
+func (b *Benchmark) Get(name string) *Measurement {
+	for i := range b.Measurements {
+		if b.Measurements[i].Name == name && b.Measurements[i].Skipped == "" {
+			return &b.Measurements[i]
+		}
+	}
+	return nil
+}
+
+// Add records a duration in the unit.
+func (b *Benchmark) Add(name string, duration time.Duration, unit time.Duration, unitName string) {
+	b.Measurements = append(b.Measurements, Measurement{Name: name, Value: round(float64(duration) / float64(unit)), Unit: unitName})
+}
+
+// Skip records that a measurement wasn't taken.
+func (b *Benchmark) Skip(name, reason string) {
+	b.Measurements = append(b.Measurements, Measurement{Name: name, Skipped: reason})
+}
+
+// BenchmarkStore keeps the benchmarks of each provider in a file, so runs
+// can be compared across providers and over time.
+type BenchmarkStore struct {
+	Dir string
+}
+
+func (s *BenchmarkStore) path(provider string) string {
+	return filepath.Join(s.Dir, provider+".json")
+}
+
+// Load returns the benchmarks of a provider, oldest first.
+func (s *BenchmarkStore) Load(provider string) ([]Benchmark, error) {
+	out, err := os.ReadFile(s.path(provider))
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	benchmarks := []Benchmark{}
+	if err := json.Unmarshal(out, &benchmarks); err != nil {
+		return nil, fmt.Errorf("parse benchmarks of %s: %w", provider, err)
+	}
+	return benchmarks, nil
+}
+
+// Save appends a benchmark to the history of its provider.
+func (s *BenchmarkStore) Save(benchmark Benchmark) error {
+	benchmarks, err := s.Load(benchmark.Provider)
+	if err != nil {
+		return err
+	}
+	benchmarks = append(benchmarks, benchmark)
+	if len(benchmarks) > maxBenchmarkHistory {
+		benchmarks = benchmarks[len(benchmarks)-maxBenchmarkHistory:]
+	}
+
+	out, err := json.MarshalIndent(benchmarks, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(s.Dir, 0o755); err != nil {
+		return err
+	}
+	return os.WriteFile(s.path(benchmark.Provider), out, 0o600)
+}
+
+// Latest returns the last benchmark of every provider.
+func (s *BenchmarkStore) Latest() ([]Benchmark, error) {
+	entries, err := os.ReadDir(s.Dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	latest := []Benchmark{}
+	for _, entry := range entries {
+		provider, ok := strings.CutSuffix(entry.Name(), ".json")
+		if !ok || entry.IsDir() {
+			continue
+		}
+		benchmarks, err := s.Load(provider)
+		if err != nil {
+			return nil, err
+		}
+		if len(benchmarks) > 0 {
+			latest = append(latest, benchmarks[len(benchmarks)-1])
+		}
+	}
+	sort.Slice(latest, func(i, j int) bool { return latest[i].Provider < latest[j].Provider })
+	return latest, nil
+}
+
+// Comparison is a measurement compared to the previous run.
+type Comparison struct {
+	Measurement
+	Previous *float64 `json:"previous,omitempty"`
+	// Change is the relative change to the previous run, positive when
+	// the measurement got worse.
+	Change     float64 `json:"change,omitempty"`
+	Regression bool    `json:"regression,omitempty"`
+}
+
+// Compare compares a benchmark to the previous one of its provider. A
+// measurement regressed if it got worse by more than the threshold, e.g.
+// 0.2 for 20%.
+func Compare(previous *Benchmark, current Benchmark, threshold float64) []Comparison {
+	comparisons := []Comparison{}
+	for _, measurement := range current.Measurements {
+		comparison := Comparison{Measurement: measurement}
+		if previous != nil && measurement.Skipped == "" {
+			if before := previous.Get(measurement.Name); before != nil && before.Value > 0 {
+				value := before.Value
+				comparison.Previous = &value
+				comparison.Change = round((measurement.Value - before.Value) / before.Value)
+				if measurement.HigherIsBetter {
+					comparison.Change = -comparison.Change
+				}
+				comparison.Regression = threshold > 0 && comparison.Change > threshold
+			}
+		}
+		comparisons = append(comparisons, comparison)
+	}
+	return comparisons
+}
+
+// BenchmarkScript returns the shell script that measures file I/O in the
+// working directory and the latency of starting interpreters. It prints
+// "<name> <nanoseconds>" or "<name> skip <reason>" lines.
+func BenchmarkScript(sizeMiB, iterations int) string {
+	return fmt.Sprintf(`now() { date +%%s%%N; }
+case "$(now)" in *N) echo "file-write skip date has no nanoseconds"; exit 0;; esac
+f=.kled-benchmark-$$
+s=$(now); dd if=/dev/zero of=$f bs=1M count=%[1]d conv=fsync 2>/dev/null || { rm -f $f; echo "file-write skip dd failed"; exit 0; }; e=$(now); echo "file-write $((e-s))"
+s=$(now); dd if=$f of=/dev/null bs=1M 2>/dev/null; e=$(now); echo "file-read $((e-s))"
+rm -f $f
+bench() {
+  name=$1; shift
+  if ! command -v "$1" >/dev/null 2>&1; then echo "$name skip $1 not installed"; return; fi
+  s=$(now); i=0; while [ $i -lt %[2]d ]; do "$@" >/dev/null 2>&1; i=$((i+1)); done; e=$(now)
+  echo "$name $(((e-s)/%[2]d))"
+}
+bench exec-sh sh -c :
+bench exec-python3 python3 -c pass
+bench exec-node node -e 0
+`, sizeMiB, iterations)
+}
+
+// ParseBenchmarkScript adds the measurements printed by BenchmarkScript.
+func ParseBenchmarkScript(output []byte, sizeMiB int, benchmark *Benchmark) error {
+	scanner := bufio.NewScanner(bytes.NewReader(output))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 || (fields[0] != "file-write" && fields[0] != "file-read" && !strings.HasPrefix(fields[0], "exec-")) {
+			continue
+		}
+		name := fields[0]
+		if fields[1] == "skip" {
+			benchmark.Skip(name, strings.Join(fields[2:], " "))
+			continue
+		}
+
+		nanos, err := strconv.ParseInt(fields[1], 10, 64)
+		if err != nil || nanos <= 0 {
+			return fmt.Errorf("unexpected benchmark output %q", scanner.Text())
+		}
+		if strings.HasPrefix(name, "exec-") {
+			benchmark.Add(name, time.Duration(nanos), time.Millisecond, "ms")
+		} else {
+			seconds := float64(nanos) / float64(time.Second)
+			benchmark.Measurements = append(benchmark.Measurements, Measurement{Name: name, Value: round(float64(sizeMiB) / seconds), Unit: "MiB/s", HigherIsBetter: true})
+		}
+	}
+	return scanner.Err()
+}
+
+func round(value float64) float64 {
+	rounded, _ := strconv.ParseFloat(strconv.FormatFloat(value, 'f', 2, 64), 64)
+	return rounded
+}
@@ -0,0 +1,74 @@
+package probe
+
+import (
+	"testing"
+	"time"
+
+	"gotest.tools/assert"
+)
+
+func TestParseBenchmarkScript(t *testing.T) {
+	output := "Welcome\nfile-write 2000000000\nfile-read 500000000\nexec-sh 1500000\nexec-python3 25000000\nexec-node skip node not installed\n"
+	benchmark := &Benchmark{}
+	assert.NilError(t, ParseBenchmarkScript([]byte(output), 256, benchmark))
+	assert.DeepEqual(t, benchmark.Measurements, []Measurement{
+		{Name: "file-write", Value: 128, Unit: "MiB/s", HigherIsBetter: true},
+		{Name: "file-read", Value: 512, Unit: "MiB/s", HigherIsBetter: true},
+		{Name: "exec-sh", Value: 1.5, Unit: "ms"},
+		{Name: "exec-python3", Value: 25, Unit: "ms"},
+		{Name: "exec-node", Skipped: "node not installed"},
+	})
+
+	err := ParseBenchmarkScript([]byte("file-write abc\n"), 256, &Benchmark{})
+	assert.ErrorContains(t, err, "unexpected benchmark output")
+}
+
+func TestCompare(t *testing.T) {
+	previous := &Benchmark{Measurements: []Measurement{
+		{Name: "cold-start", Value: 10, Unit: "s"},
+		{Name: "file-write", Value: 200, Unit: "MiB/s", HigherIsBetter: true},
+	}}
+	current := Benchmark{Measurements: []Measurement{
+		{Name: "cold-start", Value: 11, Unit: "s"},
+		{Name: "file-write", Value: 100, Unit: "MiB/s", HigherIsBetter: true},
+		{Name: "exec-sh", Value: 2, Unit: "ms"},
+	}}
+
+	comparisons := Compare(previous, current, 0.2)
+	assert.Equal(t, len(comparisons), 3)
+	assert.Equal(t, *comparisons[0].Previous, 10.0)
+	assert.Equal(t, comparisons[0].Change, 0.1)
+	assert.Assert(t, !comparisons[0].Regression)
+	assert.Equal(t, comparisons[1].Change, 0.5)
+	assert.Assert(t, comparisons[1].Regression)
+	assert.Assert(t, comparisons[2].Previous == nil)
+
+	comparisons = Compare(nil, current, 0.2)
+	assert.Assert(t, comparisons[0].Previous == nil)
+}
+
+func TestBenchmarkStore(t *testing.T) {
+	store := &BenchmarkStore{Dir: t.TempDir()}
+	benchmarks, err := store.Load("docker")
+	assert.NilError(t, err)
+	assert.Equal(t, len(benchmarks), 0)
+
+	for i := 0; i < maxBenchmarkHistory+2; i++ {
+		benchmark := Benchmark{Provider: "docker", Time: time.Unix(int64(i), 0)}
+		benchmark.Add("cold-start", time.Duration(i)*time.Second, time.Second, "s")
+		assert.NilError(t, store.Save(benchmark))
+	}
+	assert.NilError(t, store.Save(Benchmark{Provider: "kubernetes"}))
+
+	benchmarks, err = store.Load("docker")
+	assert.NilError(t, err)
+	assert.Equal(t, len(benchmarks), maxBenchmarkHistory)
+	assert.Equal(t, benchmarks[0].Get("cold-start").Value, 2.0)
+
+	latest, err := store.Latest()
+	assert.NilError(t, err)
+	assert.Equal(t, len(latest), 2)
+	assert.Equal(t, latest[0].Provider, "docker")
+	assert.Equal(t, latest[0].Get("cold-start").Value, float64(maxBenchmarkHistory+1))
+	assert.Equal(t, latest[1].Provider, "kubernetes")
+}
@@ -0,0 +1,231 @@
+package probe
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// GPU is an NVIDIA GPU as reported by nvidia-smi.
+type GPU struct {
+	Index             int     `json:"index"`
+	Name              string  `json:"name"`
+	UUID              string  `json:"uuid"`
+	DriverVersion     string  `json:"driverVersion"`
+	MemoryTotalMiB    float64 `json:"memoryTotalMiB"`
+	ComputeCapability string  `json:"computeCapability,omitempty"`
+}
+
+// CUDA are the CUDA versions of the environment.
+type CUDA struct {
+	// DriverVersion is the newest CUDA version the driver supports.
+	DriverVersion string `json:"driverVersion,omitempty"`
+	// ToolkitVersion is the version of nvcc, if the toolkit is installed.
+	ToolkitVersion string `json:"toolkitVersion,omitempty"`
+	// Devices are the NVIDIA device nodes, which containers only have if the
+	// GPUs were passed through.
+	Devices []string `json:"devices,omitempty"`
+}
+
+const nvidiaSMIQuery = "index,name,uuid,driver_version,memory.total,compute_cap"
+
+// ProbeGPUs lists the GPUs with nvidia-smi, which ships with the driver and
+// avoids linking against NVML with cgo.
+func ProbeGPUs(ctx context.Context) ([]GPU, error) {
+	out, err := runNVIDIASMI(ctx, "--query-gpu="+nvidiaSMIQuery, "--format=csv,noheader,nounits")
+	if err != nil {
+		return nil, err
+	}
+	return ParseGPUs(out)
+}
+
+// ParseGPUs parses `nvidia-smi --format=csv,noheader,nounits` output for the
+// nvidiaSMIQuery fields. Drivers too old to know compute_cap leave it out.
+func ParseGPUs(output []byte) ([]GPU, error) {
+	gpus := []GPU{}
+
+	scanner := bufio.NewScanner(bytes.NewReader(output))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+
+		fields := strings.Split(line, ",")
+		if len(fields) != 5 && len(fields) != 6 {
+			return nil, fmt.Errorf("unexpected nvidia-smi line %q", line)
+		}
+		for i := range fields {
+			fields[i] = strings.TrimSpace(fields[i])
+		}
+
+		index, err := strconv.Atoi(fields[0])
+		if err != nil {
+			return nil, fmt.Errorf("invalid GPU index %q", fields[0])
+		}
+		gpu := GPU{Index: index, Name: fields[1], UUID: fields[2], DriverVersion: fields[3]}
+		// Unsupported fields are reported as "[N/A]"; leave them empty.
+		if memory, err := strconv.ParseFloat(fields[4], 64); err == nil {
+			gpu.MemoryTotalMiB = memory
+		}
+		if len(fields) == 6 && !strings.HasPrefix(fields[5], "[") {
+			gpu.ComputeCapability = fields[5]
+		}
+		gpus = append(gpus, gpu)
+	}
+	return gpus, scanner.Err()
+}
+
+var (
+	cudaVersionPattern = regexp.MustCompile(`CUDA Version:\s*([0-9.]+)`)
+	nvccVersionPattern = regexp.MustCompile(`release ([0-9.]+)`)
+)
+
+// ParseCUDAVersion returns the CUDA version in the header of nvidia-smi.
+func ParseCUDAVersion(output []byte) string {
+	if match := cudaVersionPattern.FindSubmatch(output); match != nil {
+		return string(match[1])
+	}
+	return ""
+}
+
+// ParseNVCCVersion returns the release of `nvcc --version`.
+func ParseNVCCVersion(output []byte) string {
+	if match := nvccVersionPattern.FindSubmatch(output); match != nil {
+		return string(match[1])
+	}
+	return ""
+}
+
+// ProbeCUDA returns the CUDA versions of the driver and toolkit.
+func ProbeCUDA(ctx context.Context) (*CUDA, error) {
+	cuda := &CUDA{}
+	cuda.Devices, _ = filepath.Glob("/dev/nvidia[0-9]*")
+
+	out, err := runNVIDIASMI(ctx)
+	if err != nil {
+		return cuda, err
+	}
+	cuda.DriverVersion = ParseCUDAVersion(out)
+
+	nvcc, err := exec.LookPath("nvcc")
+	if err != nil {
+		nvcc = "/usr/local/cuda/bin/nvcc"
+	}
+	if out, err := exec.CommandContext(ctx, nvcc, "--version").Output(); err == nil {
+		cuda.ToolkitVersion = ParseNVCCVersion(out)
+	}
+	return cuda, nil
+}
+
+func runNVIDIASMI(ctx context.Context, args ...string) ([]byte, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, "nvidia-smi", args...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if errors.Is(err, exec.ErrNotFound) {
+			return nil, fmt.Errorf("nvidia-smi not found, the NVIDIA driver is not installed or not mounted into the container")
+		}
+		return nil, fmt.Errorf("error running nvidia-smi: %v: %s", err, strings.TrimSpace(stdout.String()+stderr.String()))
+	}
+	return stdout.Bytes(), nil
+}
+
+// CompareVersions compares dotted versions like 12.2 and 11.8.89 by their
+// numeric parts, returning -1, 0 or 1.
+func CompareVersions(a, b string) int {
+	partsA, partsB := strings.Split(a, "."), strings.Split(b, ".")
+	for i := 0; i < max(len(partsA), len(partsB)); i++ {
+		var x, y int
+		if i < len(partsA) {
+			x, _ = strconv.Atoi(partsA[i])
+		}
+		if i < len(partsB) {
+			y, _ = strconv.Atoi(partsB[i])
+		}
+		if x != y {
+			if x < y {
+				return -1
+			}
+			return 1
+		}
+	}
+	return 0
+}
+
+// CUDAOptions are the requirements checked by GPUs.
+type CUDAOptions struct {
+	MinGPUs int
+	// MinVersion is the CUDA version the driver has to support.
+	MinVersion string
+	// MinMemoryMiB is the memory each GPU needs.
+	MinMemoryMiB float64
+}
+
+// GPUs probes the GPUs and CUDA versions and checks them against the
+// options. A missing driver only fails if GPUs are required.
+func GPUs(ctx context.Context, options CUDAOptions) *Report {
+	report := &Report{}
+
+	cuda, err := ProbeCUDA(ctx)
+	report.CUDA = cuda
+	if err != nil {
+		if len(cuda.Devices) > 0 {
+			err = fmt.Errorf("%w, although %s exists. Set NVIDIA_DRIVER_CAPABILITIES=compute,utility", err, cuda.Devices[0])
+		}
+		status := StatusFail
+		if options.MinGPUs <= 0 {
+			status = StatusSkip
+		}
+		report.add("driver", status, "%v", err)
+		return report
+	}
+
+	gpus, err := ProbeGPUs(ctx)
+	if err != nil {
+		report.add("gpus", StatusFail, "%v", err)
+		return report
+	}
+	report.GPUs = gpus
+	report.add("driver", StatusPass, "driver %s", driverVersion(gpus))
+
+	if options.MinGPUs > 0 && len(gpus) < options.MinGPUs {
+		report.add("gpus", StatusFail, "%d GPU(s) found, %d required", len(gpus), options.MinGPUs)
+	} else {
+		report.add("gpus", StatusPass, "%d GPU(s) found", len(gpus))
+	}
+
+	switch {
+	case cuda.DriverVersion == "":
+		report.add("cuda", StatusWarn, "nvidia-smi didn't report a CUDA version")
+	case options.MinVersion != "" && CompareVersions(cuda.DriverVersion, options.MinVersion) < 0:
+		report.add("cuda", StatusFail, "driver supports CUDA %s, %s required", cuda.DriverVersion, options.MinVersion)
+	default:
+		report.add("cuda", StatusPass, "driver supports CUDA %s", cuda.DriverVersion)
+	}
+	if cuda.ToolkitVersion != "" && cuda.DriverVersion != "" && CompareVersions(cuda.ToolkitVersion, cuda.DriverVersion) > 0 {
+		report.add("toolkit", StatusWarn, "CUDA toolkit %s is newer than the driver supports (%s)", cuda.ToolkitVersion, cuda.DriverVersion)
+	}
+
+	for _, gpu := range gpus {
+		if options.MinMemoryMiB > 0 && gpu.MemoryTotalMiB < options.MinMemoryMiB {
+			report.add(fmt.Sprintf("gpu %d", gpu.Index), StatusFail, "%s has %.0f MiB memory, %.0f MiB required", gpu.Name, gpu.MemoryTotalMiB, options.MinMemoryMiB)
+		}
+	}
+	return report
+}
+
+func driverVersion(gpus []GPU) string {
+	if len(gpus) == 0 {
+		return "loaded"
+	}
+	return gpus[0].DriverVersion
+}
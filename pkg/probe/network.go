@@ -0,0 +1,68 @@
+package probe
+
+import (
+	"context"
+	"net"
+	"sync"
+	"time"
+)
+
+// DefaultEndpoints are checked if no endpoints are given, the registries and
+// forges workspaces are usually built from.
+var DefaultEndpoints = []string{"github.com:443", "registry-1.docker.io:443"}
+
+// Endpoint is the reachability of a host:port address.
+type Endpoint struct {
+	Address   string   `json:"address"`
+	Addresses []string `json:"addresses,omitempty"`
+	LatencyMs int64    `json:"latencyMs,omitempty"`
+	Error     string   `json:"error,omitempty"`
+}
+
+// ProbeNetwork resolves each address and opens a TCP connection to it. The
+// timeout applies to each address.
+func ProbeNetwork(ctx context.Context, addresses []string, timeout time.Duration) []Endpoint {
+	if timeout <= 0 {
+		timeout = 5 * time.Second
+	}
+
+	endpoints := make([]Endpoint, len(addresses))
+	wg := sync.WaitGroup{}
+	for i, address := range addresses {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			endpoints[i] = probeEndpoint(ctx, address, timeout)
+		}()
+	}
+	wg.Wait()
+	return endpoints
+}
+
+func probeEndpoint(ctx context.Context, address string, timeout time.Duration) Endpoint {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	endpoint := Endpoint{Address: address}
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		endpoint.Error = err.Error()
+		return endpoint
+	}
+	endpoint.Addresses, err = net.DefaultResolver.LookupHost(ctx, host)
+	if err != nil {
+		endpoint.Error = "resolve: " + err.Error()
+		return endpoint
+	}
+
+	start := time.Now()
+	dialer := &net.Dialer{}
+	conn, err := dialer.DialContext(ctx, "tcp", net.JoinHostPort(endpoint.Addresses[0], port))
+	if err != nil {
+		endpoint.Error = "connect: " + err.Error()
+		return endpoint
+	}
+	_ = conn.Close()
+	endpoint.LatencyMs = time.Since(start).Milliseconds()
+	return endpoint
+}
@@ -0,0 +1,69 @@
+// Package probe checks the resources of the machine or container kled runs
+// in: CPU, memory and disk including cgroup limits, network reachability and
+// NVIDIA GPUs with their CUDA versions.
+//
+// Everything is read from /proc, /sys/fs/cgroup and nvidia-smi, so probing
+// works in minimal containers without cgo. Benchmarks of workspaces are
+// recorded per provider to compare backends and find regressions.
+package probe
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Status is the outcome of a check.
+type Status string
+
+const (
+	StatusPass Status = "pass"
+	StatusWarn Status = "warn"
+	StatusFail Status = "fail"
+	StatusSkip Status = "skip"
+)
+
+// Check is a single requirement and its outcome.
+type Check struct {
+	Name    string `json:"name"`
+	Status  Status `json:"status"`
+	Message string `json:"message"`
+}
+
+// Report is the result of probing.
+type Report struct {
+	CPU     *CPU       `json:"cpu,omitempty"`
+	Memory  *Memory    `json:"memory,omitempty"`
+	Disks   []Disk     `json:"disks,omitempty"`
+	Network []Endpoint `json:"network,omitempty"`
+	GPUs    []GPU      `json:"gpus,omitempty"`
+	CUDA    *CUDA      `json:"cuda,omitempty"`
+	Checks  []Check    `json:"checks"`
+}
+
+func (r *Report) add(name string, status Status, format string, args ...interface{}) {
+	r.Checks = append(r.Checks, Check{Name: name, Status: status, Message: fmt.Sprintf(format, args...)})
+}
+
+// Failed returns the checks that failed.
+func (r *Report) Failed() []Check {
+	failed := []Check{}
+	for _, check := range r.Checks {
+		if check.Status == StatusFail {
+			failed = append(failed, check)
+		}
+	}
+	return failed
+}
+
+// FailedError summarizes the failed checks, or returns nil if all passed.
+func (r *Report) FailedError() error {
+	failed := r.Failed()
+	if len(failed) == 0 {
+		return nil
+	}
+	names := make([]string, 0, len(failed))
+	for _, check := range failed {
+		names = append(names, check.Name)
+	}
+	return fmt.Errorf("%d check(s) failed: %s", len(failed), strings.Join(names, ", "))
+}
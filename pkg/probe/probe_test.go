@@ -0,0 +1,92 @@
+package probe
+
+import (
+	"testing"
+
+	"gotest.tools/assert"
+)
+
+func TestParseMeminfo(t *testing.T) {
+	total, available, err := ParseMeminfo([]byte("MemTotal:       16318540 kB\nMemFree:         1083012 kB\nMemAvailable:    9482116 kB\n"))
+	assert.NilError(t, err)
+	assert.Equal(t, total, uint64(16318540*1024))
+	assert.Equal(t, available, uint64(9482116*1024))
+
+	_, _, err = ParseMeminfo([]byte("MemFree: 1 kB\n"))
+	assert.ErrorContains(t, err, "MemTotal")
+}
+
+func TestParseCPUModel(t *testing.T) {
+	cpuinfo := "processor\t: 0\nvendor_id\t: GenuineIntel\nmodel name\t: Intel(R) Xeon(R) CPU @ 2.20GHz\n"
+	assert.Equal(t, ParseCPUModel([]byte(cpuinfo)), "Intel(R) Xeon(R) CPU @ 2.20GHz")
+	assert.Equal(t, ParseCPUModel(nil), "")
+}
+
+func TestCgroupLimits(t *testing.T) {
+	cores, err := ParseCPUMax("max 100000\n")
+	assert.NilError(t, err)
+	assert.Equal(t, cores, 0.0)
+
+	cores, err = ParseCPUMax("150000 100000\n")
+	assert.NilError(t, err)
+	assert.Equal(t, cores, 1.5)
+
+	cores, err = parseQuota("-1\n", "100000\n")
+	assert.NilError(t, err)
+	assert.Equal(t, cores, 0.0)
+
+	_, err = ParseCPUMax("")
+	assert.ErrorContains(t, err, "unexpected cpu.max")
+
+	limit, err := ParseMemoryMax("max\n")
+	assert.NilError(t, err)
+	assert.Equal(t, limit, uint64(0))
+
+	limit, err = ParseMemoryMax("9223372036854771712\n")
+	assert.NilError(t, err)
+	assert.Equal(t, limit, uint64(0))
+
+	limit, err = ParseMemoryMax("4294967296\n")
+	assert.NilError(t, err)
+	assert.Equal(t, limit, uint64(4294967296))
+}
+
+func TestEffectiveLimits(t *testing.T) {
+	cpu := &CPU{Cores: 8, Limit: 2}
+	assert.Equal(t, cpu.Effective(), 2.0)
+	cpu.Limit = 16
+	assert.Equal(t, cpu.Effective(), 8.0)
+
+	memory := &Memory{TotalBytes: 16 << 30, AvailableBytes: 10 << 30, LimitBytes: 4 << 30, UsedBytes: 1 << 30}
+	assert.Equal(t, memory.Effective(), uint64(4<<30))
+	assert.Equal(t, memory.EffectiveAvailable(), uint64(3<<30))
+}
+
+func TestParseGPUs(t *testing.T) {
+	output := "0, NVIDIA A100-SXM4-40GB, GPU-5fd3c9b8, 535.104.05, 40960, 8.0\n1, Tesla T4, GPU-1a2b, 535.104.05, [N/A], [N/A]\n"
+	gpus, err := ParseGPUs([]byte(output))
+	assert.NilError(t, err)
+	assert.DeepEqual(t, gpus, []GPU{
+		{Index: 0, Name: "NVIDIA A100-SXM4-40GB", UUID: "GPU-5fd3c9b8", DriverVersion: "535.104.05", MemoryTotalMiB: 40960, ComputeCapability: "8.0"},
+		{Index: 1, Name: "Tesla T4", UUID: "GPU-1a2b", DriverVersion: "535.104.05"},
+	})
+
+	_, err = ParseGPUs([]byte("0, broken\n"))
+	assert.ErrorContains(t, err, "unexpected nvidia-smi line")
+}
+
+func TestParseCUDAVersions(t *testing.T) {
+	header := "| NVIDIA-SMI 535.104.05             Driver Version: 535.104.05   CUDA Version: 12.2     |\n"
+	assert.Equal(t, ParseCUDAVersion([]byte(header)), "12.2")
+	assert.Equal(t, ParseCUDAVersion([]byte("No devices were found\n")), "")
+
+	nvcc := "nvcc: NVIDIA (R) Cuda compiler driver\nCuda compilation tools, release 12.1, V12.1.105\n"
+	assert.Equal(t, ParseNVCCVersion([]byte(nvcc)), "12.1")
+}
+
+func TestCompareVersions(t *testing.T) {
+	assert.Equal(t, CompareVersions("12.2", "11.8"), 1)
+	assert.Equal(t, CompareVersions("11.8", "12"), -1)
+	assert.Equal(t, CompareVersions("12.0", "12"), 0)
+	assert.Equal(t, CompareVersions("12.10", "12.9"), 1)
+}
@@ -0,0 +1,244 @@
+package probe
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/docker/go-units"
+)
+
+// CPU describes the processors available.
+type CPU struct {
+	Model string `json:"model,omitempty"`
+	Cores int    `json:"cores"`
+	// Limit is the CPU quota of the cgroup in cores, 0 if there is none.
+	Limit float64 `json:"limit,omitempty"`
+}
+
+// Effective is the number of cores processes can use.
+func (c *CPU) Effective() float64 {
+	if c.Limit > 0 && c.Limit < float64(c.Cores) {
+		return c.Limit
+	}
+	return float64(c.Cores)
+}
+
+// Memory describes the memory available.
+type Memory struct {
+	TotalBytes     uint64 `json:"totalBytes"`
+	AvailableBytes uint64 `json:"availableBytes"`
+	// LimitBytes is the memory limit of the cgroup, 0 if there is none.
+	LimitBytes uint64 `json:"limitBytes,omitempty"`
+	// UsedBytes is the memory used by the cgroup, if it has a limit.
+	UsedBytes uint64 `json:"usedBytes,omitempty"`
+}
+
+// Effective is the memory processes can use in total.
+func (m *Memory) Effective() uint64 {
+	if m.LimitBytes > 0 && m.LimitBytes < m.TotalBytes {
+		return m.LimitBytes
+	}
+	return m.TotalBytes
+}
+
+// EffectiveAvailable is the memory that is still free for processes.
+func (m *Memory) EffectiveAvailable() uint64 {
+	if m.LimitBytes > 0 && m.LimitBytes < m.TotalBytes {
+		if m.UsedBytes >= m.LimitBytes {
+			return 0
+		}
+		return min(m.LimitBytes-m.UsedBytes, m.AvailableBytes)
+	}
+	return m.AvailableBytes
+}
+
+// Disk describes the file system of a path.
+type Disk struct {
+	Path           string `json:"path"`
+	TotalBytes     uint64 `json:"totalBytes"`
+	AvailableBytes uint64 `json:"availableBytes"`
+}
+
+// ResourceOptions are the requirements checked by Resources. Zero values
+// are not checked.
+type ResourceOptions struct {
+	MinCPUs   float64
+	MinMemory uint64
+	MinDisk   uint64
+	// Paths are the directories whose file systems are checked.
+	Paths []string
+	// Endpoints are host:port addresses that have to be reachable.
+	Endpoints []string
+	Timeout   time.Duration
+}
+
+// Resources probes CPU, memory, disks and network and checks them against
+// the options.
+func Resources(ctx context.Context, options ResourceOptions) *Report {
+	report := &Report{}
+
+	cpu, err := ProbeCPU()
+	if err != nil {
+		report.add("cpu", StatusFail, "probe CPU: %v", err)
+	} else {
+		report.CPU = cpu
+		effective := formatCores(cpu.Effective())
+		switch {
+		case options.MinCPUs > 0 && cpu.Effective() < options.MinCPUs:
+			report.add("cpu", StatusFail, "%s cores available, %s required", effective, formatCores(options.MinCPUs))
+		case cpu.Limit > 0 && cpu.Limit < float64(cpu.Cores):
+			report.add("cpu", StatusPass, "%s cores available, limited from %d by cgroup", effective, cpu.Cores)
+		default:
+			report.add("cpu", StatusPass, "%s cores available", effective)
+		}
+	}
+
+	memory, err := ProbeMemory()
+	if err != nil {
+		report.add("memory", StatusFail, "probe memory: %v", err)
+	} else {
+		report.Memory = memory
+		total, available := units.BytesSize(float64(memory.Effective())), units.BytesSize(float64(memory.EffectiveAvailable()))
+		switch {
+		case options.MinMemory > 0 && memory.Effective() < options.MinMemory:
+			report.add("memory", StatusFail, "%s total, %s required", total, units.BytesSize(float64(options.MinMemory)))
+		case options.MinMemory > 0 && memory.EffectiveAvailable() < options.MinMemory:
+			report.add("memory", StatusWarn, "%s of %s available, %s required", available, total, units.BytesSize(float64(options.MinMemory)))
+		default:
+			report.add("memory", StatusPass, "%s of %s available", available, total)
+		}
+	}
+
+	for _, path := range options.Paths {
+		name := "disk " + path
+		disk, err := ProbeDisk(path)
+		if err != nil {
+			report.add(name, StatusFail, "probe disk: %v", err)
+			continue
+		}
+		report.Disks = append(report.Disks, *disk)
+		available, total := units.BytesSize(float64(disk.AvailableBytes)), units.BytesSize(float64(disk.TotalBytes))
+		if options.MinDisk > 0 && disk.AvailableBytes < options.MinDisk {
+			report.add(name, StatusFail, "%s of %s free, %s required", available, total, units.BytesSize(float64(options.MinDisk)))
+		} else {
+			report.add(name, StatusPass, "%s of %s free", available, total)
+		}
+	}
+
+	if len(options.Endpoints) > 0 {
+		report.Network = ProbeNetwork(ctx, options.Endpoints, options.Timeout)
+		for _, endpoint := range report.Network {
+			name := "network " + endpoint.Address
+			if endpoint.Error != "" {
+				report.add(name, StatusFail, "%s", endpoint.Error)
+			} else {
+				report.add(name, StatusPass, "reachable in %dms", endpoint.LatencyMs)
+			}
+		}
+	}
+
+	return report
+}
+
+func formatCores(cores float64) string {
+	return strconv.FormatFloat(math.Round(cores*100)/100, 'f', -1, 64)
+}
+
+// ParseMeminfo returns MemTotal and MemAvailable of /proc/meminfo in bytes.
+func ParseMeminfo(meminfo []byte) (total, available uint64, err error) {
+	scanner := bufio.NewScanner(bytes.NewReader(meminfo))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 {
+			continue
+		}
+
+		kb, err := strconv.ParseUint(fields[1], 10, 64)
+		if err != nil {
+			continue
+		}
+		switch fields[0] {
+		case "MemTotal:":
+			total = kb * 1024
+		case "MemAvailable:":
+			available = kb * 1024
+		}
+	}
+	if total == 0 {
+		return 0, 0, fmt.Errorf("no MemTotal in meminfo")
+	}
+	return total, available, nil
+}
+
+// ParseCPUModel returns the first model name of /proc/cpuinfo.
+func ParseCPUModel(cpuinfo []byte) string {
+	scanner := bufio.NewScanner(bytes.NewReader(cpuinfo))
+	for scanner.Scan() {
+		key, value, ok := strings.Cut(scanner.Text(), ":")
+		if ok && strings.TrimSpace(key) == "model name" {
+			return strings.TrimSpace(value)
+		}
+	}
+	return ""
+}
+
+// ParseCPUMax parses the cgroup v2 cpu.max file, "<quota> <period>" or
+// "max <period>", into cores. No limit is returned as 0.
+func ParseCPUMax(cpuMax string) (float64, error) {
+	fields := strings.Fields(cpuMax)
+	if len(fields) == 0 || len(fields) > 2 {
+		return 0, fmt.Errorf("unexpected cpu.max %q", cpuMax)
+	}
+	if fields[0] == "max" {
+		return 0, nil
+	}
+	period := "100000"
+	if len(fields) == 2 {
+		period = fields[1]
+	}
+	return parseQuota(fields[0], period)
+}
+
+// parseQuota divides a CFS quota by its period. A negative quota, which
+// cgroup v1 uses for no limit, is returned as 0.
+func parseQuota(quota, period string) (float64, error) {
+	q, err := strconv.ParseInt(strings.TrimSpace(quota), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid CPU quota %q", quota)
+	}
+	p, err := strconv.ParseInt(strings.TrimSpace(period), 10, 64)
+	if err != nil || p <= 0 {
+		return 0, fmt.Errorf("invalid CPU period %q", period)
+	}
+	if q < 0 {
+		return 0, nil
+	}
+	return float64(q) / float64(p), nil
+}
+
+// unlimitedMemory is where cgroup v1 memory limits count as no limit; the
+// kernel reports an unset limit as the largest page aligned int64.
+const unlimitedMemory = 1 << 62
+
+// ParseMemoryMax parses a cgroup memory limit, "max" for cgroup v2 or a
+// huge number for cgroup v1 meaning no limit, which is returned as 0.
+func ParseMemoryMax(memoryMax string) (uint64, error) {
+	memoryMax = strings.TrimSpace(memoryMax)
+	if memoryMax == "max" {
+		return 0, nil
+	}
+	limit, err := strconv.ParseUint(memoryMax, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid memory limit %q", memoryMax)
+	}
+	if limit >= unlimitedMemory {
+		return 0, nil
+	}
+	return limit, nil
+}
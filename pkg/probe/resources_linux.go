@@ -0,0 +1,82 @@
+//go:build linux
+// +build linux
+
+package probe
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"syscall"
+)
+
+// cgroupRoot is where the cgroup of the process is mounted. In containers
+// this is the container's own cgroup.
+const cgroupRoot = "/sys/fs/cgroup"
+
+func ProbeCPU() (*CPU, error) {
+	cpu := &CPU{Cores: runtime.NumCPU()}
+	if cpuinfo, err := os.ReadFile("/proc/cpuinfo"); err == nil {
+		cpu.Model = ParseCPUModel(cpuinfo)
+	}
+
+	if cpuMax, err := os.ReadFile(filepath.Join(cgroupRoot, "cpu.max")); err == nil {
+		limit, err := ParseCPUMax(string(cpuMax))
+		if err != nil {
+			return nil, err
+		}
+		cpu.Limit = limit
+	} else if quota, err := os.ReadFile(filepath.Join(cgroupRoot, "cpu", "cpu.cfs_quota_us")); err == nil {
+		period, err := os.ReadFile(filepath.Join(cgroupRoot, "cpu", "cpu.cfs_period_us"))
+		if err != nil {
+			return nil, err
+		}
+		limit, err := parseQuota(string(quota), string(period))
+		if err != nil {
+			return nil, err
+		}
+		cpu.Limit = limit
+	}
+	return cpu, nil
+}
+
+func ProbeMemory() (*Memory, error) {
+	meminfo, err := os.ReadFile("/proc/meminfo")
+	if err != nil {
+		return nil, err
+	}
+	memory := &Memory{}
+	memory.TotalBytes, memory.AvailableBytes, err = ParseMeminfo(meminfo)
+	if err != nil {
+		return nil, err
+	}
+
+	limitFile, usageFile := filepath.Join(cgroupRoot, "memory.max"), filepath.Join(cgroupRoot, "memory.current")
+	if _, err := os.Stat(limitFile); err != nil {
+		limitFile, usageFile = filepath.Join(cgroupRoot, "memory", "memory.limit_in_bytes"), filepath.Join(cgroupRoot, "memory", "memory.usage_in_bytes")
+	}
+	if limit, err := os.ReadFile(limitFile); err == nil {
+		memory.LimitBytes, err = ParseMemoryMax(string(limit))
+		if err != nil {
+			return nil, err
+		}
+		if memory.LimitBytes > 0 {
+			if usage, err := os.ReadFile(usageFile); err == nil {
+				memory.UsedBytes, _ = ParseMemoryMax(string(usage))
+			}
+		}
+	}
+	return memory, nil
+}
+
+func ProbeDisk(path string) (*Disk, error) {
+	stat := &syscall.Statfs_t{}
+	if err := syscall.Statfs(path, stat); err != nil {
+		return nil, err
+	}
+	return &Disk{
+		Path:           path,
+		TotalBytes:     stat.Blocks * uint64(stat.Bsize),
+		AvailableBytes: stat.Bavail * uint64(stat.Bsize),
+	}, nil
+}
@@ -0,0 +1,21 @@
+//go:build !linux
+// +build !linux
+
+package probe
+
+import (
+	"fmt"
+	"runtime"
+)
+
+func ProbeCPU() (*CPU, error) {
+	return &CPU{Cores: runtime.NumCPU()}, nil
+}
+
+func ProbeMemory() (*Memory, error) {
+	return nil, fmt.Errorf("probing memory is not supported on %s", runtime.GOOS)
+}
+
+func ProbeDisk(path string) (*Disk, error) {
+	return nil, fmt.Errorf("probing disks is not supported on %s", runtime.GOOS)
+}
@@ -12,4 +12,11 @@ type ProviderKataDriverConfig struct {
 	Install types.StrBool `json:"install,omitempty"`
 
 	Env map[string]string `json:"env,omitempty"`
+
+	// Hibernate checkpoints the memory of the workspace container on stop and
+	// restores it on start
+	Hibernate types.StrBool `json:"hibernate,omitempty"`
+
+	// CheckpointDir is the folder hibernation checkpoints are written to
+	CheckpointDir string `json:"checkpointDir,omitempty"`
 }
@@ -15,6 +15,15 @@ type Machine struct {
 	// CreationTimestamp is the timestamp when this workspace was created
 	CreationTimestamp types.Time `json:"creationTimestamp,omitempty"`
 
+	// MaxWorkspaces is the number of workspaces this machine can host. New
+	// workspaces of the same provider are packed onto machines with free
+	// capacity. Zero means the machine is only used when requested explicitly.
+	MaxWorkspaces int `json:"maxWorkspaces,omitempty"`
+
+	// AutoDelete specifies if the machine should get destroyed when its
+	// last workspace is deleted
+	AutoDelete bool `json:"autoDelete,omitempty"`
+
 	// Context is the context where this config file was loaded from
 	Context string `json:"context,omitempty"`
 
@@ -44,6 +44,10 @@ type ProviderConfig struct {
 
 	// Binaries is an optional field to specify a binary to execute the commands
 	Binaries map[string][]*ProviderBinary `json:"binaries,omitempty"`
+
+	// WorkspaceEnv are env variables every workspace of the provider gets,
+	// overridden by the env of the workspace itself
+	WorkspaceEnv map[string]string `json:"workspaceEnv,omitempty"`
 }
 
 type ProviderOptionGroup struct {
@@ -200,6 +204,19 @@ type ProviderDockerDriverConfig struct {
 
 	// Environment variables to set when running docker commands
 	Env map[string]string `json:"env,omitempty"`
+
+	// EncryptVolumes backs the volumes of the devcontainer with LUKS
+	// encrypted images on the machine, which are locked while the workspace
+	// is stopped. Bind mounts, including the workspace content folder, are
+	// not encrypted. Linux only
+	EncryptVolumes types.StrBool `json:"encryptVolumes,omitempty"`
+
+	// VolumeKey is the Vault transit key, as <mount>/<key>, the keys of
+	// encrypted volumes are wrapped with
+	VolumeKey string `json:"volumeKey,omitempty"`
+
+	// VolumeSize is the size of an encrypted volume, e.g. 20Gi
+	VolumeSize string `json:"volumeSize,omitempty"`
 }
 
 type ProviderKubernetesDriverConfig struct {
@@ -217,6 +234,11 @@ type ProviderKubernetesDriverConfig struct {
 	InactivityTimeout string `json:"inactivityTimeout,omitempty"`
 	StorageClass      string `json:"storageClass,omitempty"`
 
+	// EncryptedStorageClass replaces StorageClass with a storage class that
+	// encrypts its volumes. The key is chosen by the storage class, e.g. the
+	// KMS settings in the parameters of its CSI driver, not by kled
+	EncryptedStorageClass string `json:"encryptedStorageClass,omitempty"`
+
 	DiskSize             string `json:"diskSize,omitempty"`
 	PvcAccessMode        string `json:"pvcAccessMode,omitempty"`
 	PvcAnnotations       string `json:"pvcAnnotations,omitempty"`
@@ -7,10 +7,19 @@ import (
 	"github.com/loft-sh/api/v4/pkg/devpod"
 	"github.com/loft-sh/devpod/pkg/config"
 	devcontainerconfig "github.com/loft-sh/devpod/pkg/devcontainer/config"
+	"github.com/loft-sh/devpod/pkg/devcontainer/policy"
 	"github.com/loft-sh/devpod/pkg/git"
+	"github.com/loft-sh/devpod/pkg/imagescan"
+	"github.com/loft-sh/devpod/pkg/netpolicy"
+	"github.com/loft-sh/devpod/pkg/outbound"
 	"github.com/loft-sh/devpod/pkg/types"
 )
 
+// ExpiresAtLabel is a workspace label holding the unix time after which the
+// workspace may be deleted, e.g. by the reconciler of the kled server. It is
+// passed on to the workspace container
+const ExpiresAtLabel = "kled.sh/expires-at"
+
 var (
 	WorkspaceSourceGit       = "git:"
 	WorkspaceSourceLocal     = "local:"
@@ -70,6 +79,50 @@ type Workspace struct {
 
 	// Path to the file where the SSH config to access the workspace is stored
 	SSHConfigPath string `json:"sshConfigPath,omitempty"`
+
+	// Labels are user defined key value pairs used to select workspaces, e.g.
+	// with kled workspace stop -l team=ml
+	Labels map[string]string `json:"labels,omitempty"`
+
+	// Network isolates the network of the workspace and restricts its egress
+	Network *netpolicy.Policy `json:"network,omitempty"`
+
+	// DNS holds custom hosts entries and name resolution of the workspace
+	DNS *WorkspaceDNSConfig `json:"dns,omitempty"`
+
+	// Env holds the env variables of the workspace that were passed when it
+	// was created or started
+	Env *WorkspaceEnvConfig `json:"env,omitempty"`
+
+	// SkipPersonalization opts the workspace out of the dotfiles of the user
+	// and the timezone and locale of the host
+	SkipPersonalization bool `json:"skipPersonalization,omitempty"`
+}
+
+type WorkspaceEnvConfig struct {
+	// Template are the env variables of the template the workspace was
+	// created from
+	Template map[string]string `json:"template,omitempty"`
+
+	// CLI are the env variables passed with --workspace-env
+	CLI map[string]string `json:"cli,omitempty"`
+
+	// Secrets are the Vault secrets injected as env variables, as
+	// NAME: PATH#FIELD. Only the references are stored, the values are read
+	// whenever the workspace starts
+	Secrets map[string]string `json:"secrets,omitempty"`
+}
+
+type WorkspaceDNSConfig struct {
+	// ExtraHosts are added to /etc/hosts of the workspace, as HOST:IP
+	ExtraHosts []string `json:"extraHosts,omitempty"`
+
+	// Servers are the DNS servers the workspace uses instead of the default
+	// ones of the provider
+	Servers []string `json:"servers,omitempty"`
+
+	// Search are the DNS search domains of the workspace
+	Search []string `json:"search,omitempty"`
 }
 
 type ProMetadata struct {
@@ -195,6 +248,18 @@ type AgentWorkspaceInfo struct {
 
 	// RegistryCache defines the registry to use for caching builds
 	RegistryCache string `json:"registryCache,omitempty"`
+
+	// ImageScan configures scanning of the workspace image before it starts
+	ImageScan imagescan.Options `json:"imageScan,omitempty"`
+
+	// DevContainerPolicy is validated against the devcontainer configuration before the workspace is created
+	DevContainerPolicy *policy.Policy `json:"devContainerPolicy,omitempty"`
+
+	// Offline resolves images, features and templates only from the content store of the machine
+	Offline bool `json:"offline,omitempty"`
+
+	// Outbound configures the proxy and trusted CAs of the agent
+	Outbound outbound.Options `json:"outbound,omitempty"`
 }
 
 type CLIOptions struct {
@@ -211,6 +276,7 @@ type CLIOptions struct {
 	DevContainerPath            string            `json:"devContainerPath,omitempty"`
 	WorkspaceEnv                []string          `json:"workspaceEnv,omitempty"`
 	WorkspaceEnvFile            []string          `json:"workspaceEnvFile,omitempty"`
+	WorkspaceEnvDefaults        []string          `json:"workspaceEnvDefaults,omitempty"` // overridden by the project .env, unlike WorkspaceEnv
 	InitEnv                     []string          `json:"initEnv,omitempty"`
 	Recreate                    bool              `json:"recreate,omitempty"`
 	Reset                       bool              `json:"reset,omitempty"`
@@ -222,12 +288,16 @@ type CLIOptions struct {
 	GitSSHSigningKey            string            `json:"gitSshSigningKey,omitempty"`
 	SSHAuthSockID               string            `json:"sshAuthSockID,omitempty"` // ID to use when looking for SSH_AUTH_SOCK, defaults to a new random ID if not set (only used for browser IDEs)
 	StrictHostKeyChecking       bool              `json:"strictHostKeyChecking,omitempty"`
+	PolicyOverride              string            `json:"policyOverride,omitempty"`
+	PolicyOverrideUser          string            `json:"policyOverrideUser,omitempty"`
 
 	// build options
 	Repository string   `json:"repository,omitempty"`
 	SkipPush   bool     `json:"skipPush,omitempty"`
 	Platforms  []string `json:"platform,omitempty"`
 	Tag        []string `json:"tag,omitempty"`
+	CacheFrom  []string `json:"cacheFrom,omitempty"`
+	CacheTo    []string `json:"cacheTo,omitempty"`
 
 	ForceBuild            bool `json:"forceBuild,omitempty"`
 	ForceDockerless       bool `json:"forceDockerless,omitempty"`
@@ -0,0 +1,188 @@
+package providerplugin
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os/exec"
+	"strconv"
+	"time"
+)
+
+// Client is a running plugin process.
+type Client struct {
+	cmd    *exec.Cmd
+	stdin  io.WriteCloser
+	conn   *conn
+	nextID int
+
+	manifest *Manifest
+}
+
+// Start runs the plugin and initializes the session.
+func Start(ctx context.Context, path string, env []string, stderr io.Writer, kledVersion string) (*Client, error) {
+	cmd := exec.CommandContext(ctx, path)
+	cmd.Env = env
+	cmd.Stderr = stderr
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("start plugin %s: %w", path, err)
+	}
+
+	client := &Client{cmd: cmd, stdin: stdin, conn: newConn(stdout, stdin)}
+	err = client.initialize(kledVersion)
+	if err != nil {
+		_ = client.Close()
+		return nil, fmt.Errorf("initialize plugin %s: %w", path, err)
+	}
+
+	return client, nil
+}
+
+func (c *Client) initialize(kledVersion string) error {
+	manifest := &Manifest{}
+	err := c.Call(MethodInitialize, &InitializeParams{ProtocolVersion: ProtocolVersion, KledVersion: kledVersion}, manifest)
+	if err != nil {
+		return err
+	} else if manifest.ProtocolVersion != ProtocolVersion {
+		return fmt.Errorf("plugin speaks protocol version %d, kled supports version %d", manifest.ProtocolVersion, ProtocolVersion)
+	}
+
+	c.manifest = manifest
+	return nil
+}
+
+// Describe returns the manifest of the plugin at path.
+func Describe(ctx context.Context, path string, kledVersion string) (*Manifest, error) {
+	client, err := Start(ctx, path, nil, io.Discard, kledVersion)
+	if err != nil {
+		return nil, err
+	}
+	defer client.Close()
+
+	return client.Manifest(), nil
+}
+
+func (c *Client) Manifest() *Manifest {
+	return c.manifest
+}
+
+// Close closes stdin and waits for the plugin to exit. A plugin that keeps
+// running is killed after a grace period.
+func (c *Client) Close() error {
+	_ = c.stdin.Close()
+
+	done := make(chan error, 1)
+	go func() {
+		done <- c.cmd.Wait()
+	}()
+
+	select {
+	case err := <-done:
+		return err
+	case <-time.After(5 * time.Second):
+		_ = c.cmd.Process.Kill()
+		return <-done
+	}
+}
+
+// Call sends a request and decodes the result into result.
+func (c *Client) Call(method string, params interface{}, result interface{}) error {
+	return c.call(method, params, result, nil)
+}
+
+// Exec runs command through the plugin and returns its exit code. Reading
+// stdin stops once the command exits, a blocked read of stdin is not
+// interrupted.
+func (c *Client) Exec(ctx context.Context, params *ExecParams, stdin io.Reader, stdout, stderr io.Writer) (int, error) {
+	go func() {
+		if stdin != nil {
+			buf := make([]byte, 32*1024)
+			for ctx.Err() == nil {
+				n, err := stdin.Read(buf)
+				if n > 0 {
+					if c.conn.notify(NotificationStdin, &StreamData{Data: buf[:n]}) != nil {
+						return
+					}
+				}
+				if err != nil {
+					break
+				}
+			}
+		}
+		_ = c.conn.notify(NotificationStdin, &StreamData{EOF: true})
+	}()
+
+	result := &ExecResult{}
+	err := c.call(MethodExec, params, result, func(msg *message) error {
+		data := &StreamData{}
+		if err := json.Unmarshal(msg.Params, data); err != nil {
+			return err
+		}
+
+		switch msg.Method {
+		case NotificationStdout:
+			_, err := stdout.Write(data.Data)
+			return err
+		case NotificationStderr:
+			_, err := stderr.Write(data.Data)
+			return err
+		}
+		return nil
+	})
+	if err != nil {
+		return 1, err
+	}
+	return result.ExitCode, nil
+}
+
+func (c *Client) call(method string, params interface{}, result interface{}, onNotification func(*message) error) error {
+	rawParams, err := json.Marshal(params)
+	if err != nil {
+		return err
+	}
+
+	c.nextID++
+	id := json.RawMessage(strconv.Itoa(c.nextID))
+	err = c.conn.write(&message{ID: id, Method: method, Params: rawParams})
+	if err != nil {
+		return fmt.Errorf("send %s: %w", method, err)
+	}
+
+	for {
+		msg, err := c.conn.read()
+		if errors.Is(err, io.EOF) {
+			return fmt.Errorf("plugin exited before answering %s", method)
+		} else if err != nil {
+			return err
+		}
+
+		if msg.isNotification() {
+			if onNotification != nil {
+				if err := onNotification(msg); err != nil {
+					return err
+				}
+			}
+			continue
+		} else if string(msg.ID) != string(id) {
+			continue
+		}
+
+		if msg.Error != nil {
+			return msg.Error
+		}
+		if result != nil && len(msg.Result) > 0 && string(msg.Result) != "null" {
+			return json.Unmarshal(msg.Result, result)
+		}
+		return nil
+	}
+}
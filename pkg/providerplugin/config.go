@@ -0,0 +1,180 @@
+package providerplugin
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"github.com/loft-sh/devpod/pkg/provider"
+	"github.com/loft-sh/devpod/pkg/types"
+)
+
+const (
+	// BinaryName is the provider binary that points to the plugin
+	BinaryName = "KLED_PROVIDER_PLUGIN"
+
+	// Prefix is the name prefix of plugins on PATH
+	Prefix = "kled-provider-"
+)
+
+// ProviderConfig returns the provider config that runs every command
+// through the plugin binary.
+func ProviderConfig(manifest *Manifest, binary *provider.ProviderBinary) *provider.ProviderConfig {
+	config := &provider.ProviderConfig{
+		Name:         manifest.Name,
+		Version:      manifest.Version,
+		Description:  manifest.Description,
+		Icon:         manifest.Icon,
+		Home:         manifest.Home,
+		Options:      manifest.Options,
+		OptionGroups: manifest.OptionGroups,
+		Agent:        manifest.Agent,
+		Binaries: map[string][]*provider.ProviderBinary{
+			BinaryName: {binary},
+		},
+	}
+
+	config.Exec.Command = helperCommand(MethodExec)
+	if manifest.Supports(MethodInit) {
+		config.Exec.Init = helperCommand(MethodInit)
+	}
+	if manifest.Supports(MethodCreate) {
+		config.Exec.Create = helperCommand(MethodCreate)
+	}
+	if manifest.Supports(MethodDelete) {
+		config.Exec.Delete = helperCommand(MethodDelete)
+	}
+	if manifest.Supports(MethodStart) {
+		config.Exec.Start = helperCommand(MethodStart)
+	}
+	if manifest.Supports(MethodStop) {
+		config.Exec.Stop = helperCommand(MethodStop)
+	}
+	if manifest.Supports(MethodStatus) {
+		config.Exec.Status = helperCommand(MethodStatus)
+	}
+
+	return config
+}
+
+func helperCommand(method string) types.StrArray {
+	return types.StrArray{fmt.Sprintf(`"${%s}" helper provider-plugin %s --plugin "${%s}"`, provider.KLED, method, BinaryName)}
+}
+
+// LocalBinary returns the provider binary for a plugin on this machine.
+func LocalBinary(path string) *provider.ProviderBinary {
+	return &provider.ProviderBinary{
+		OS:   runtime.GOOS,
+		Arch: runtime.GOARCH,
+		Path: path,
+	}
+}
+
+// Find returns the absolute path of the plugin referenced by source, which is
+// either the path to an executable or the name of a plugin on PATH. It
+// returns an empty string if source is not a plugin.
+func Find(source string) string {
+	if strings.HasSuffix(source, ".yaml") || strings.HasSuffix(source, ".yml") {
+		return ""
+	} else if strings.Contains(source, "/") || strings.Contains(source, string(filepath.Separator)) {
+		if !isExecutable(source) {
+			return ""
+		}
+
+		absPath, err := filepath.Abs(source)
+		if err != nil {
+			return ""
+		}
+		return absPath
+	}
+
+	for _, dir := range filepath.SplitList(os.Getenv("PATH")) {
+		if dir == "" {
+			continue
+		}
+
+		for _, name := range binaryNames(Prefix + source) {
+			path := filepath.Join(dir, name)
+			if isExecutable(path) {
+				absPath, err := filepath.Abs(path)
+				if err != nil {
+					continue
+				}
+				return absPath
+			}
+		}
+	}
+
+	return ""
+}
+
+// Discover returns the names of the plugins found on PATH.
+func Discover() []string {
+	seen := map[string]bool{}
+	names := []string{}
+	for _, dir := range filepath.SplitList(os.Getenv("PATH")) {
+		if dir == "" {
+			continue
+		}
+
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			continue
+		}
+		for _, entry := range entries {
+			name := strings.TrimSuffix(entry.Name(), ".exe")
+			if !strings.HasPrefix(name, Prefix) || name == Prefix || seen[name] {
+				continue
+			} else if !isExecutable(filepath.Join(dir, entry.Name())) {
+				continue
+			}
+
+			seen[name] = true
+			names = append(names, strings.TrimPrefix(name, Prefix))
+		}
+	}
+
+	return names
+}
+
+// IsBinary returns true if raw looks like an executable instead of a
+// provider.yaml.
+func IsBinary(raw []byte) bool {
+	for _, magic := range [][]byte{
+		{0x7f, 'E', 'L', 'F'},    // ELF
+		{0xfe, 0xed, 0xfa, 0xce}, // Mach-O 32 bit
+		{0xfe, 0xed, 0xfa, 0xcf}, // Mach-O 64 bit
+		{0xce, 0xfa, 0xed, 0xfe}, // Mach-O 32 bit little endian
+		{0xcf, 0xfa, 0xed, 0xfe}, // Mach-O 64 bit little endian
+		{0xca, 0xfe, 0xba, 0xbe}, // Mach-O universal
+		{'M', 'Z'},               // PE
+		{'#', '!'},               // script
+	} {
+		if bytes.HasPrefix(raw, magic) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func binaryNames(name string) []string {
+	if runtime.GOOS == "windows" {
+		return []string{name + ".exe", name}
+	}
+	return []string{name}
+}
+
+func isExecutable(path string) bool {
+	stat, err := os.Stat(path)
+	if err != nil || stat.IsDir() {
+		return false
+	}
+	if runtime.GOOS == "windows" {
+		return strings.HasSuffix(strings.ToLower(path), ".exe")
+	}
+	return stat.Mode().Perm()&0111 != 0
+}
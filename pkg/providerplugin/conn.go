@@ -0,0 +1,67 @@
+package providerplugin
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// maxMessageSize limits a single message, exec output is sent in chunks
+// well below it.
+const maxMessageSize = 16 * 1024 * 1024
+
+// conn reads and writes newline delimited JSON-RPC messages.
+type conn struct {
+	scanner *bufio.Scanner
+
+	m sync.Mutex
+	w io.Writer
+}
+
+func newConn(r io.Reader, w io.Writer) *conn {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), maxMessageSize)
+	return &conn{scanner: scanner, w: w}
+}
+
+func (c *conn) read() (*message, error) {
+	for c.scanner.Scan() {
+		line := c.scanner.Bytes()
+		if len(line) == 0 {
+			continue
+		}
+
+		msg := &message{}
+		if err := json.Unmarshal(line, msg); err != nil {
+			return nil, fmt.Errorf("parse message: %w", err)
+		}
+		return msg, nil
+	}
+	if err := c.scanner.Err(); err != nil {
+		return nil, err
+	}
+	return nil, io.EOF
+}
+
+func (c *conn) write(msg *message) error {
+	msg.JSONRPC = "2.0"
+	out, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+
+	c.m.Lock()
+	defer c.m.Unlock()
+	_, err = c.w.Write(append(out, '\n'))
+	return err
+}
+
+func (c *conn) notify(method string, params interface{}) error {
+	raw, err := json.Marshal(params)
+	if err != nil {
+		return err
+	}
+	return c.write(&message{Method: method, Params: raw})
+}
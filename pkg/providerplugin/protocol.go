@@ -0,0 +1,157 @@
+// Package providerplugin implements the provider plugin protocol. A plugin
+// is an executable that implements a provider without a provider.yaml. Kled
+// starts the plugin for every provider command and talks JSON-RPC 2.0 to it,
+// one JSON message per line on stdin and stdout. Stderr is shown to the user.
+//
+// Every session starts with an initialize request that returns the plugin's
+// Manifest. After that kled sends a single request and closes stdin, the
+// plugin should exit once stdin is closed:
+//
+//	initialize  InitializeParams -> Manifest
+//	init        Context          -> null          (validates the options)
+//	create      Context          -> null
+//	delete      Context          -> null
+//	start       Context          -> null
+//	stop        Context          -> null
+//	status      Context          -> StatusResult
+//	exec        ExecParams       -> ExecResult
+//
+// Only initialize and exec are required. A plugin without create, delete,
+// start, stop and status runs commands on a target that already exists, like
+// the ssh provider. The rules of provider.yaml apply: create requires delete,
+// start requires stop and status, and both require create.
+//
+// While exec runs, kled sends the command's stdin as exec/stdin notifications
+// and the plugin sends its output as exec/stdout and exec/stderr
+// notifications, all carrying a StreamData.
+//
+// Plugins are discovered on PATH by their name kled-provider-NAME or
+// installed from a local path or URL with kled provider add.
+package providerplugin
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/loft-sh/devpod/pkg/provider"
+	"github.com/loft-sh/devpod/pkg/types"
+)
+
+// ProtocolVersion is the version of the protocol spoken by this kled.
+const ProtocolVersion = 1
+
+const (
+	MethodInitialize = "initialize"
+	MethodInit       = "init"
+	MethodCreate     = "create"
+	MethodDelete     = "delete"
+	MethodStart      = "start"
+	MethodStop       = "stop"
+	MethodStatus     = "status"
+	MethodExec       = "exec"
+
+	NotificationStdin  = "exec/stdin"
+	NotificationStdout = "exec/stdout"
+	NotificationStderr = "exec/stderr"
+)
+
+// Methods lists the methods that are dispatched to the plugin by the
+// provider plugin helper.
+var Methods = []string{MethodInit, MethodCreate, MethodDelete, MethodStart, MethodStop, MethodStatus, MethodExec}
+
+// JSON-RPC error codes
+const (
+	CodeParseError     = -32700
+	CodeInvalidRequest = -32600
+	CodeMethodNotFound = -32601
+	CodeInvalidParams  = -32602
+	CodeInternalError  = -32603
+)
+
+type InitializeParams struct {
+	ProtocolVersion int    `json:"protocolVersion"`
+	KledVersion     string `json:"kledVersion,omitempty"`
+}
+
+// Manifest describes a plugin, it is turned into the provider config.
+type Manifest struct {
+	ProtocolVersion int    `json:"protocolVersion"`
+	Name            string `json:"name"`
+	Version         string `json:"version,omitempty"`
+	Description     string `json:"description,omitempty"`
+	Icon            string `json:"icon,omitempty"`
+	Home            string `json:"home,omitempty"`
+
+	// Options is the options schema of the provider, see provider.yaml
+	Options      map[string]*types.Option       `json:"options,omitempty"`
+	OptionGroups []provider.ProviderOptionGroup `json:"optionGroups,omitempty"`
+	Agent        provider.ProviderAgentConfig   `json:"agent,omitempty"`
+
+	// Capabilities lists the optional methods the plugin implements
+	Capabilities []string `json:"capabilities,omitempty"`
+}
+
+func (m *Manifest) Supports(method string) bool {
+	if method == MethodExec {
+		return true
+	}
+	for _, capability := range m.Capabilities {
+		if capability == method {
+			return true
+		}
+	}
+	return false
+}
+
+// Context identifies the machine or workspace a request is for.
+type Context struct {
+	MachineID       string            `json:"machineId,omitempty"`
+	MachineFolder   string            `json:"machineFolder,omitempty"`
+	WorkspaceID     string            `json:"workspaceId,omitempty"`
+	WorkspaceFolder string            `json:"workspaceFolder,omitempty"`
+	ProviderFolder  string            `json:"providerFolder,omitempty"`
+	Options         map[string]string `json:"options,omitempty"`
+}
+
+type StatusResult struct {
+	// Status is one of Running, Busy, Stopped or NotFound
+	Status string `json:"status"`
+}
+
+type ExecParams struct {
+	Context `json:",inline"`
+
+	Command string `json:"command"`
+}
+
+type ExecResult struct {
+	ExitCode int `json:"exitCode"`
+}
+
+type StreamData struct {
+	Data []byte `json:"data,omitempty"`
+	EOF  bool   `json:"eof,omitempty"`
+}
+
+// Error is a JSON-RPC error returned by the plugin.
+type Error struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("plugin error %d: %s", e.Code, e.Message)
+}
+
+type message struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id,omitempty"`
+	Method  string          `json:"method,omitempty"`
+	Params  json.RawMessage `json:"params,omitempty"`
+	Result  json.RawMessage `json:"result,omitempty"`
+	Error   *Error          `json:"error,omitempty"`
+}
+
+func (m *message) isNotification() bool {
+	return m.Method != "" && len(m.ID) == 0
+}
@@ -0,0 +1,136 @@
+package providerplugin
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/loft-sh/devpod/pkg/provider"
+	"github.com/loft-sh/devpod/pkg/types"
+	"gotest.tools/assert"
+)
+
+func testPlugin() *Plugin {
+	return &Plugin{
+		Manifest: Manifest{
+			Name:    "test",
+			Version: "v0.0.1",
+			Options: map[string]*types.Option{
+				"REGION": {Description: "The region", Default: "eu"},
+			},
+		},
+		Create: func(ctx context.Context, c *Context) error {
+			if c.Options["REGION"] == "" {
+				return errors.New("region is missing")
+			}
+			return nil
+		},
+		Delete: func(ctx context.Context, c *Context) error {
+			return nil
+		},
+		Status: func(ctx context.Context, c *Context) (string, error) {
+			return "Running", nil
+		},
+		Exec: func(ctx context.Context, c *Context, command string, stdin io.Reader, stdout, stderr io.Writer) (int, error) {
+			in, err := io.ReadAll(stdin)
+			if err != nil {
+				return 0, err
+			}
+
+			_, _ = fmt.Fprintf(stdout, "%s on %s: %s", command, c.MachineID, in)
+			_, _ = fmt.Fprint(stderr, "done")
+			return 3, nil
+		},
+	}
+}
+
+// startTestClient connects a client to plugin served in process.
+func startTestClient(t *testing.T, plugin *Plugin) *Client {
+	clientReader, serverWriter := io.Pipe()
+	serverReader, clientWriter := io.Pipe()
+	done := make(chan error, 1)
+	go func() {
+		done <- Serve(context.Background(), plugin, serverReader, serverWriter)
+		_ = serverWriter.Close()
+	}()
+	t.Cleanup(func() {
+		_ = clientWriter.Close()
+		assert.NilError(t, <-done)
+	})
+
+	client := &Client{stdin: clientWriter, conn: newConn(clientReader, clientWriter)}
+	assert.NilError(t, client.initialize("v0.1.0"))
+	return client
+}
+
+func TestInitialize(t *testing.T) {
+	client := startTestClient(t, testPlugin())
+
+	manifest := client.Manifest()
+	assert.Equal(t, manifest.ProtocolVersion, ProtocolVersion)
+	assert.Equal(t, manifest.Name, "test")
+	assert.Assert(t, manifest.Supports(MethodCreate))
+	assert.Assert(t, manifest.Supports(MethodStatus))
+	assert.Assert(t, manifest.Supports(MethodExec))
+	assert.Assert(t, manifest.Supports(MethodDelete))
+	assert.Assert(t, !manifest.Supports(MethodStart))
+}
+
+func TestCall(t *testing.T) {
+	client := startTestClient(t, testPlugin())
+
+	assert.NilError(t, client.Call(MethodCreate, &Context{Options: map[string]string{"REGION": "us"}}, nil))
+	err := client.Call(MethodCreate, &Context{}, nil)
+	assert.ErrorContains(t, err, "region is missing")
+
+	result := &StatusResult{}
+	assert.NilError(t, client.Call(MethodStatus, &Context{}, result))
+	assert.Equal(t, result.Status, "Running")
+
+	rpcErr := &Error{}
+	err = client.Call(MethodStart, &Context{}, nil)
+	assert.Assert(t, errors.As(err, &rpcErr))
+	assert.Equal(t, rpcErr.Code, CodeMethodNotFound)
+}
+
+func TestExec(t *testing.T) {
+	client := startTestClient(t, testPlugin())
+
+	stdout := &bytes.Buffer{}
+	stderr := &bytes.Buffer{}
+	exitCode, err := client.Exec(context.Background(), &ExecParams{
+		Context: Context{MachineID: "my-machine"},
+		Command: "cat",
+	}, strings.NewReader("hello"), stdout, stderr)
+	assert.NilError(t, err)
+	assert.Equal(t, exitCode, 3)
+	assert.Equal(t, stdout.String(), "cat on my-machine: hello")
+	assert.Equal(t, stderr.String(), "done")
+}
+
+func TestProviderConfig(t *testing.T) {
+	manifest := testPlugin().Manifest
+	manifest.Capabilities = []string{MethodCreate, MethodDelete, MethodStatus}
+	config := ProviderConfig(&manifest, LocalBinary("/usr/local/bin/kled-provider-test"))
+
+	raw, err := json.Marshal(config)
+	assert.NilError(t, err)
+	parsed, err := provider.ParseProvider(bytes.NewReader(raw))
+	assert.NilError(t, err)
+	assert.Equal(t, parsed.Name, "test")
+	assert.Equal(t, parsed.Exec.Command[0], `"${KLED}" helper provider-plugin exec --plugin "${KLED_PROVIDER_PLUGIN}"`)
+	assert.Equal(t, len(parsed.Exec.Create), 1)
+	assert.Equal(t, len(parsed.Exec.Start), 0)
+	assert.Equal(t, parsed.Binaries[BinaryName][0].Path, "/usr/local/bin/kled-provider-test")
+}
+
+func TestIsBinary(t *testing.T) {
+	assert.Assert(t, IsBinary([]byte("\x7fELF\x02\x01")))
+	assert.Assert(t, IsBinary([]byte("#!/bin/sh\n")))
+	assert.Assert(t, !IsBinary([]byte("name: test\nversion: v0.0.1\n")))
+}
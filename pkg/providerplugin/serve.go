@@ -0,0 +1,216 @@
+package providerplugin
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// Plugin implements a provider in Go. Methods that are nil are not
+// advertised to kled.
+type Plugin struct {
+	Manifest Manifest
+
+	Init   func(ctx context.Context, c *Context) error
+	Create func(ctx context.Context, c *Context) error
+	Delete func(ctx context.Context, c *Context) error
+	Start  func(ctx context.Context, c *Context) error
+	Stop   func(ctx context.Context, c *Context) error
+	Status func(ctx context.Context, c *Context) (string, error)
+	Exec   func(ctx context.Context, c *Context, command string, stdin io.Reader, stdout, stderr io.Writer) (int, error)
+}
+
+// Serve answers requests read from r until r is closed. Plugin binaries call
+// it with os.Stdin and os.Stdout.
+func Serve(ctx context.Context, plugin *Plugin, r io.Reader, w io.Writer) error {
+	if plugin.Exec == nil {
+		return fmt.Errorf("plugin %s doesn't implement exec", plugin.Manifest.Name)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	s := &server{plugin: plugin, conn: newConn(r, w)}
+	defer s.wg.Wait()
+	for {
+		msg, err := s.conn.read()
+		if errors.Is(err, io.EOF) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		switch {
+		case msg.Method == NotificationStdin:
+			s.stdin(msg)
+		case msg.isNotification():
+		case msg.Method != "":
+			// the stdin of exec has to be in place before the next
+			// notification is read
+			var stdin *io.PipeReader
+			if msg.Method == MethodExec {
+				stdin = s.openStdin()
+			}
+
+			s.wg.Add(1)
+			go func() {
+				defer s.wg.Done()
+				s.handle(ctx, msg, stdin)
+			}()
+		}
+	}
+}
+
+type server struct {
+	plugin *Plugin
+	conn   *conn
+	wg     sync.WaitGroup
+
+	m sync.Mutex
+	// execStdin receives the stdin of the running exec
+	execStdin *io.PipeWriter
+}
+
+func (s *server) stdin(msg *message) {
+	data := &StreamData{}
+	if err := json.Unmarshal(msg.Params, data); err != nil {
+		return
+	}
+
+	s.m.Lock()
+	writer := s.execStdin
+	s.m.Unlock()
+	if writer == nil {
+		return
+	}
+	if len(data.Data) > 0 {
+		_, _ = writer.Write(data.Data)
+	}
+	if data.EOF {
+		_ = writer.Close()
+	}
+}
+
+func (s *server) openStdin() *io.PipeReader {
+	s.m.Lock()
+	defer s.m.Unlock()
+	if s.execStdin != nil {
+		return nil
+	}
+
+	reader, writer := io.Pipe()
+	s.execStdin = writer
+	return reader
+}
+
+func (s *server) closeStdin(reader *io.PipeReader) {
+	s.m.Lock()
+	s.execStdin = nil
+	s.m.Unlock()
+	_ = reader.Close()
+}
+
+func (s *server) handle(ctx context.Context, msg *message, stdin *io.PipeReader) {
+	result, err := s.dispatch(ctx, msg, stdin)
+	response := &message{ID: msg.ID}
+	if err != nil {
+		rpcErr := &Error{}
+		if !errors.As(err, &rpcErr) {
+			rpcErr = &Error{Code: CodeInternalError, Message: err.Error()}
+		}
+		response.Error = rpcErr
+	} else if response.Result, err = json.Marshal(result); err != nil {
+		response.Error = &Error{Code: CodeInternalError, Message: err.Error()}
+	}
+
+	_ = s.conn.write(response)
+}
+
+func (s *server) dispatch(ctx context.Context, msg *message, stdin *io.PipeReader) (interface{}, error) {
+	if msg.Method == MethodInitialize {
+		manifest := s.plugin.Manifest
+		manifest.ProtocolVersion = ProtocolVersion
+		manifest.Capabilities = s.capabilities()
+		return manifest, nil
+	}
+
+	if msg.Method == MethodExec {
+		params := &ExecParams{}
+		if err := json.Unmarshal(msg.Params, params); err != nil {
+			return nil, &Error{Code: CodeInvalidParams, Message: err.Error()}
+		}
+		return s.exec(ctx, params, stdin)
+	}
+
+	c := &Context{}
+	if err := json.Unmarshal(msg.Params, c); err != nil {
+		return nil, &Error{Code: CodeInvalidParams, Message: err.Error()}
+	}
+
+	handlers := map[string]func(context.Context, *Context) error{
+		MethodInit:   s.plugin.Init,
+		MethodCreate: s.plugin.Create,
+		MethodDelete: s.plugin.Delete,
+		MethodStart:  s.plugin.Start,
+		MethodStop:   s.plugin.Stop,
+	}
+	if handler := handlers[msg.Method]; handler != nil {
+		return nil, handler(ctx, c)
+	} else if msg.Method == MethodStatus && s.plugin.Status != nil {
+		status, err := s.plugin.Status(ctx, c)
+		if err != nil {
+			return nil, err
+		}
+		return &StatusResult{Status: status}, nil
+	}
+
+	return nil, &Error{Code: CodeMethodNotFound, Message: fmt.Sprintf("method %s is not supported", msg.Method)}
+}
+
+func (s *server) exec(ctx context.Context, params *ExecParams, stdin *io.PipeReader) (*ExecResult, error) {
+	if stdin == nil {
+		return nil, &Error{Code: CodeInvalidRequest, Message: "a command is running already"}
+	}
+	defer s.closeStdin(stdin)
+
+	stdout := &streamWriter{conn: s.conn, method: NotificationStdout}
+	stderr := &streamWriter{conn: s.conn, method: NotificationStderr}
+	exitCode, err := s.plugin.Exec(ctx, &params.Context, params.Command, stdin, stdout, stderr)
+	if err != nil {
+		return nil, err
+	}
+	return &ExecResult{ExitCode: exitCode}, nil
+}
+
+func (s *server) capabilities() []string {
+	capabilities := []string{}
+	for method, implemented := range map[string]bool{
+		MethodInit:   s.plugin.Init != nil,
+		MethodCreate: s.plugin.Create != nil,
+		MethodDelete: s.plugin.Delete != nil,
+		MethodStart:  s.plugin.Start != nil,
+		MethodStop:   s.plugin.Stop != nil,
+		MethodStatus: s.plugin.Status != nil,
+	} {
+		if implemented {
+			capabilities = append(capabilities, method)
+		}
+	}
+	return capabilities
+}
+
+// streamWriter sends written bytes as notifications.
+type streamWriter struct {
+	conn   *conn
+	method string
+}
+
+func (w *streamWriter) Write(p []byte) (int, error) {
+	if err := w.conn.notify(w.method, &StreamData{Data: p}); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
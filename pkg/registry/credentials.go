@@ -0,0 +1,206 @@
+package registry
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/loft-sh/devpod/pkg/image"
+)
+
+type LoginOptions struct {
+	Server   string
+	Username string
+	Secret   string
+
+	// Store is keychain or vault, ignored if Helper is set
+	Store     StoreType
+	VaultPath string
+
+	// Helper is one of ecr, gcr or acr
+	Helper string
+}
+
+// Credentials are resolved from the store or helper of a registry
+type Credentials struct {
+	Server   string
+	Username string
+	Secret   string
+}
+
+// Login stores the credentials of a registry, registries with a helper only
+// check that the helper is able to issue a token.
+func Login(ctx context.Context, options LoginOptions) (*Registry, error) {
+	registry := &Registry{
+		Server:    NormalizeServer(options.Server),
+		Username:  options.Username,
+		Store:     options.Store,
+		Helper:    options.Helper,
+		CreatedAt: time.Now().UTC(),
+	}
+	if registry.Server == "" {
+		return nil, fmt.Errorf("registry server is empty")
+	}
+
+	if registry.Helper != "" {
+		registry.Store = StoreNone
+		registry.Username = ""
+		_, err := resolveHelper(ctx, registry)
+		if err != nil {
+			return nil, err
+		}
+
+		return registry, upsert(registry)
+	}
+
+	if options.Username == "" || options.Secret == "" {
+		return nil, fmt.Errorf("username and password are required for registry %s", registry.Server)
+	}
+	if registry.Store == StoreVault {
+		registry.VaultPath = options.VaultPath
+	}
+	store, err := storeFor(registry)
+	if err != nil {
+		return nil, err
+	}
+	err = store.Store(ctx, registry, options.Secret)
+	if err != nil {
+		return nil, err
+	}
+
+	return registry, upsert(registry)
+}
+
+// Logout removes the credentials of server
+func Logout(ctx context.Context, server string) error {
+	registry, err := Find(server)
+	if err != nil {
+		return err
+	} else if registry == nil {
+		return fmt.Errorf("not logged in to registry %s", NormalizeServer(server))
+	}
+
+	if registry.Store != StoreNone {
+		store, err := storeFor(registry)
+		if err != nil {
+			return err
+		}
+
+		err = store.Erase(ctx, registry)
+		if err != nil {
+			return err
+		}
+	}
+
+	return remove(registry.Server)
+}
+
+// Resolve returns the credentials kled has for server or nil if there are none
+func Resolve(ctx context.Context, server string) (*Credentials, error) {
+	registry, err := Find(server)
+	if err != nil || registry == nil {
+		return nil, err
+	}
+
+	if registry.Helper != "" {
+		return resolveHelper(ctx, registry)
+	}
+
+	store, err := storeFor(registry)
+	if err != nil {
+		return nil, err
+	}
+	secret, err := store.Get(ctx, registry)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Credentials{
+		Server:   registry.Server,
+		Username: registry.Username,
+		Secret:   secret,
+	}, nil
+}
+
+// resolveHelper gets a fresh token from the cloud provider of the registry
+func resolveHelper(ctx context.Context, registry *Registry) (*Credentials, error) {
+	keychain, ok := image.HelperKeychains[registry.Helper]
+	if !ok {
+		return nil, fmt.Errorf("unknown registry helper %q, expected one of ecr, gcr or acr", registry.Helper)
+	}
+
+	resource, err := name.NewRegistry(registry.Server)
+	if err != nil {
+		return nil, err
+	}
+	authenticator, err := authn.Resolve(ctx, keychain, resource)
+	if err != nil {
+		return nil, fmt.Errorf("resolve %s token for %s: %w", registry.Helper, registry.Server, err)
+	}
+	authConfig, err := authenticator.Authorization()
+	if err != nil {
+		return nil, fmt.Errorf("resolve %s token for %s: %w", registry.Helper, registry.Server, err)
+	}
+
+	credentials := &Credentials{
+		Server:   registry.Server,
+		Username: authConfig.Username,
+		Secret:   authConfig.Password,
+	}
+	if authConfig.IdentityToken != "" {
+		credentials.Secret = authConfig.IdentityToken
+	}
+	if credentials.Secret == "" {
+		return nil, fmt.Errorf("%s helper returned no credentials for %s", registry.Helper, registry.Server)
+	}
+	return credentials, nil
+}
+
+// DockerConfigEnv writes a temporary docker config with the credentials kled
+// has for the registry of imageName and returns the environment to use it.
+// The environment is empty if kled has no credentials for the registry.
+func DockerConfigEnv(ctx context.Context, imageName string) ([]string, func(), error) {
+	noop := func() {}
+	ref, err := name.ParseReference(imageName)
+	if err != nil {
+		return nil, noop, nil
+	}
+
+	credentials, err := Resolve(ctx, ref.Context().RegistryStr())
+	if err != nil {
+		return nil, noop, err
+	} else if credentials == nil {
+		return nil, noop, nil
+	}
+
+	configDir, err := os.MkdirTemp("", "kled-docker-config-")
+	if err != nil {
+		return nil, noop, err
+	}
+	cleanup := func() { _ = os.RemoveAll(configDir) }
+
+	out, err := json.Marshal(map[string]interface{}{
+		"auths": map[string]interface{}{
+			keychainServerURL(credentials.Server): map[string]string{
+				"auth": base64.StdEncoding.EncodeToString([]byte(credentials.Username + ":" + credentials.Secret)),
+			},
+		},
+	})
+	if err != nil {
+		cleanup()
+		return nil, noop, err
+	}
+	err = os.WriteFile(filepath.Join(configDir, "config.json"), out, 0600)
+	if err != nil {
+		cleanup()
+		return nil, noop, err
+	}
+
+	return []string{"DOCKER_CONFIG=" + configDir}, cleanup, nil
+}
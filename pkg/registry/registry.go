@@ -0,0 +1,169 @@
+// Package registry manages the container registry credentials kled injects
+// into image pulls and pushes. Only metadata is kept in the config folder,
+// secrets live in the OS keychain or in Vault.
+package registry
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/loft-sh/devpod/pkg/config"
+)
+
+// RegistriesFile holds the metadata of all logged in registries
+const RegistriesFile = "registries.json"
+
+type StoreType string
+
+const (
+	// StoreKeychain keeps secrets in the OS keychain through the docker credential helpers
+	StoreKeychain StoreType = "keychain"
+	// StoreVault keeps secrets in a Vault KV v2 secrets engine
+	StoreVault StoreType = "vault"
+	// StoreNone is used for registries that get their tokens from a helper
+	StoreNone StoreType = "none"
+)
+
+type Registry struct {
+	// Server is the normalized registry host, e.g. ghcr.io or docker.io
+	Server string `json:"server"`
+
+	Username string `json:"username,omitempty"`
+
+	// Store is where the secret of the registry is kept
+	Store StoreType `json:"store"`
+
+	// Helper is one of ecr, gcr or acr if tokens are refreshed through the cloud provider
+	Helper string `json:"helper,omitempty"`
+
+	// VaultPath is the KV v2 path the secret is stored at if Store is vault
+	VaultPath string `json:"vaultPath,omitempty"`
+
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+type registries struct {
+	Registries []*Registry `json:"registries"`
+}
+
+// NormalizeServer turns server addresses like https://index.docker.io/v1/
+// into the registry host kled uses as key.
+func NormalizeServer(server string) string {
+	server = strings.TrimPrefix(strings.TrimPrefix(server, "https://"), "http://")
+	server = strings.SplitN(server, "/", 2)[0]
+	server = strings.ToLower(server)
+	switch server {
+	case "index.docker.io", "registry-1.docker.io", "registry.hub.docker.com":
+		return "docker.io"
+	}
+	return server
+}
+
+func registriesPath() (string, error) {
+	configDir, err := config.GetConfigDir()
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(configDir, RegistriesFile), nil
+}
+
+// List returns all logged in registries sorted by server
+func List() ([]*Registry, error) {
+	path, err := registriesPath()
+	if err != nil {
+		return nil, err
+	}
+
+	out, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return []*Registry{}, nil
+		}
+		return nil, err
+	}
+
+	list := &registries{}
+	err = json.Unmarshal(out, list)
+	if err != nil {
+		return nil, fmt.Errorf("parse %s: %w", path, err)
+	}
+
+	sort.Slice(list.Registries, func(i, j int) bool {
+		return list.Registries[i].Server < list.Registries[j].Server
+	})
+	return list.Registries, nil
+}
+
+// Find returns the registry for server or nil if kled has no credentials for it
+func Find(server string) (*Registry, error) {
+	list, err := List()
+	if err != nil {
+		return nil, err
+	}
+
+	server = NormalizeServer(server)
+	for _, registry := range list {
+		if registry.Server == server {
+			return registry, nil
+		}
+	}
+
+	return nil, nil
+}
+
+func save(list []*Registry) error {
+	path, err := registriesPath()
+	if err != nil {
+		return err
+	}
+
+	out, err := json.MarshalIndent(&registries{Registries: list}, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	err = os.MkdirAll(filepath.Dir(path), 0755)
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(path, out, 0600)
+}
+
+func upsert(registry *Registry) error {
+	list, err := List()
+	if err != nil {
+		return err
+	}
+
+	updated := []*Registry{registry}
+	for _, existing := range list {
+		if existing.Server != registry.Server {
+			updated = append(updated, existing)
+		}
+	}
+
+	return save(updated)
+}
+
+func remove(server string) error {
+	list, err := List()
+	if err != nil {
+		return err
+	}
+
+	updated := []*Registry{}
+	for _, existing := range list {
+		if existing.Server != server {
+			updated = append(updated, existing)
+		}
+	}
+
+	return save(updated)
+}
@@ -0,0 +1,65 @@
+package registry
+
+import (
+	"context"
+	"testing"
+
+	"github.com/loft-sh/devpod/pkg/config"
+	"gotest.tools/assert"
+)
+
+func TestNormalizeServer(t *testing.T) {
+	assert.Equal(t, NormalizeServer("https://index.docker.io/v1/"), "docker.io")
+	assert.Equal(t, NormalizeServer("registry-1.docker.io"), "docker.io")
+	assert.Equal(t, NormalizeServer("GHCR.io/my-org"), "ghcr.io")
+	assert.Equal(t, NormalizeServer("http://localhost:5000"), "localhost:5000")
+}
+
+func TestRegistries(t *testing.T) {
+	t.Setenv(config.KLED_HOME, t.TempDir())
+
+	registries, err := List()
+	assert.NilError(t, err)
+	assert.Equal(t, len(registries), 0)
+
+	assert.NilError(t, upsert(&Registry{Server: "ghcr.io", Username: "alice", Store: StoreKeychain}))
+	assert.NilError(t, upsert(&Registry{Server: "docker.io", Username: "bob", Store: StoreVault}))
+	assert.NilError(t, upsert(&Registry{Server: "ghcr.io", Username: "carol", Store: StoreKeychain}))
+
+	registries, err = List()
+	assert.NilError(t, err)
+	assert.Equal(t, len(registries), 2)
+	assert.Equal(t, registries[0].Server, "docker.io")
+	assert.Equal(t, registries[1].Username, "carol")
+
+	registry, err := Find("https://index.docker.io/v1/")
+	assert.NilError(t, err)
+	assert.Equal(t, registry.Username, "bob")
+
+	assert.NilError(t, remove("docker.io"))
+	registry, err = Find("docker.io")
+	assert.NilError(t, err)
+	assert.Assert(t, registry == nil)
+
+	credentials, err := Resolve(context.Background(), "quay.io")
+	assert.NilError(t, err)
+	assert.Assert(t, credentials == nil)
+
+	env, cleanup, err := DockerConfigEnv(context.Background(), "quay.io/org/image:latest")
+	assert.NilError(t, err)
+	defer cleanup()
+	assert.Equal(t, len(env), 0)
+
+	err = Logout(context.Background(), "quay.io")
+	assert.ErrorContains(t, err, "not logged in")
+}
+
+func TestLoginValidation(t *testing.T) {
+	t.Setenv(config.KLED_HOME, t.TempDir())
+
+	_, err := Login(context.Background(), LoginOptions{Server: "ghcr.io", Store: StoreKeychain})
+	assert.ErrorContains(t, err, "username and password are required")
+
+	_, err = Login(context.Background(), LoginOptions{Server: "ghcr.io", Helper: "quay"})
+	assert.ErrorContains(t, err, "unknown registry helper")
+}
@@ -0,0 +1,161 @@
+package registry
+
+import (
+	"context"
+	"fmt"
+	"runtime"
+	"strings"
+
+	"github.com/docker/cli/cli/config"
+	"github.com/docker/docker-credential-helpers/client"
+	"github.com/docker/docker-credential-helpers/credentials"
+	vault "github.com/hashicorp/vault/api"
+)
+
+// DefaultVaultPath is the KV v2 path registry secrets are written below
+const DefaultVaultPath = "secret/kled/registries"
+
+type secretStore interface {
+	Store(ctx context.Context, registry *Registry, secret string) error
+	Get(ctx context.Context, registry *Registry) (string, error)
+	Erase(ctx context.Context, registry *Registry) error
+}
+
+func storeFor(registry *Registry) (secretStore, error) {
+	switch registry.Store {
+	case StoreKeychain:
+		return &keychainStore{}, nil
+	case StoreVault:
+		return &vaultStore{}, nil
+	default:
+		return nil, fmt.Errorf("registry %s has no secret store", registry.Server)
+	}
+}
+
+// keychainStore uses the docker credential helper of the OS keychain. The
+// entries are shared with docker login.
+type keychainStore struct{}
+
+func (k *keychainStore) program() client.ProgramFunc {
+	helper := ""
+	dockerConfig, err := config.Load(config.Dir())
+	if err == nil {
+		helper = dockerConfig.CredentialsStore
+	}
+	if helper == "" {
+		switch runtime.GOOS {
+		case "darwin":
+			helper = "osxkeychain"
+		case "windows":
+			helper = "wincred"
+		default:
+			helper = "secretservice"
+		}
+	}
+
+	return client.NewShellProgramFunc("docker-credential-" + helper)
+}
+
+func keychainServerURL(server string) string {
+	if server == "docker.io" {
+		return "https://index.docker.io/v1/"
+	}
+	return "https://" + server
+}
+
+func (k *keychainStore) Store(ctx context.Context, registry *Registry, secret string) error {
+	err := client.Store(k.program(), &credentials.Credentials{
+		ServerURL: keychainServerURL(registry.Server),
+		Username:  registry.Username,
+		Secret:    secret,
+	})
+	if err != nil {
+		return fmt.Errorf("store credentials in keychain: %w", err)
+	}
+	return nil
+}
+
+func (k *keychainStore) Get(ctx context.Context, registry *Registry) (string, error) {
+	creds, err := client.Get(k.program(), keychainServerURL(registry.Server))
+	if err != nil {
+		return "", fmt.Errorf("get credentials from keychain: %w", err)
+	}
+	return creds.Secret, nil
+}
+
+func (k *keychainStore) Erase(ctx context.Context, registry *Registry) error {
+	err := client.Erase(k.program(), keychainServerURL(registry.Server))
+	if err != nil && !credentials.IsErrCredentialsNotFound(err) {
+		return fmt.Errorf("erase credentials from keychain: %w", err)
+	}
+	return nil
+}
+
+// vaultStore keeps secrets in a KV v2 engine. Address and token are read from
+// VAULT_ADDR and VAULT_TOKEN.
+type vaultStore struct{}
+
+func (v *vaultStore) kv(registry *Registry) (*vault.KVv2, string, error) {
+	vaultClient, err := vault.NewClient(vault.DefaultConfig())
+	if err != nil {
+		return nil, "", fmt.Errorf("create vault client: %w", err)
+	}
+
+	path := registry.VaultPath
+	if path == "" {
+		path = DefaultVaultPath
+	}
+	mount, secretPath, ok := strings.Cut(strings.Trim(path, "/"), "/")
+	if !ok {
+		return nil, "", fmt.Errorf("vault path %s needs to include the mount, e.g. %s", path, DefaultVaultPath)
+	}
+
+	return vaultClient.KVv2(mount), secretPath + "/" + registry.Server, nil
+}
+
+func (v *vaultStore) Store(ctx context.Context, registry *Registry, secret string) error {
+	kv, path, err := v.kv(registry)
+	if err != nil {
+		return err
+	}
+
+	_, err = kv.Put(ctx, path, map[string]interface{}{
+		"username": registry.Username,
+		"secret":   secret,
+	})
+	if err != nil {
+		return fmt.Errorf("write credentials to vault: %w", err)
+	}
+	return nil
+}
+
+func (v *vaultStore) Get(ctx context.Context, registry *Registry) (string, error) {
+	kv, path, err := v.kv(registry)
+	if err != nil {
+		return "", err
+	}
+
+	secret, err := kv.Get(ctx, path)
+	if err != nil {
+		return "", fmt.Errorf("read credentials from vault: %w", err)
+	}
+
+	value, _ := secret.Data["secret"].(string)
+	if value == "" {
+		return "", fmt.Errorf("vault secret %s has no secret", path)
+	}
+	return value, nil
+}
+
+func (v *vaultStore) Erase(ctx context.Context, registry *Registry) error {
+	kv, path, err := v.kv(registry)
+	if err != nil {
+		return err
+	}
+
+	err = kv.DeleteMetadata(ctx, path)
+	if err != nil {
+		return fmt.Errorf("delete credentials from vault: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,92 @@
+package sdk
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// Artifact is a file produced by a run, kept in storage with its hash
+type Artifact struct {
+	ID          string            `json:"id"`
+	RunID       string            `json:"run_id"`
+	WorkspaceID string            `json:"workspace_id,omitempty"`
+	Name        string            `json:"name"`
+	ContentType string            `json:"content_type"`
+	Size        int64             `json:"size"`
+	SHA256      string            `json:"sha256"`
+	Metadata    map[string]string `json:"metadata,omitempty"`
+	CreatedBy   string            `json:"created_by,omitempty"`
+	CreatedAt   time.Time         `json:"created_at"`
+	ExpiresAt   *time.Time        `json:"expires_at,omitempty"`
+	// DownloadURL downloads the content without an API key until
+	// DownloadURLExpiresAt
+	DownloadURL          string    `json:"download_url"`
+	DownloadURLExpiresAt time.Time `json:"download_url_expires_at"`
+}
+
+// UploadOptions describe an artifact to register
+type UploadOptions struct {
+	// ContentType is detected by the backend if empty
+	ContentType string
+	Metadata    map[string]string
+	// RetentionDays removes the artifact earlier than the retention of the
+	// organization, if set
+	RetentionDays int
+}
+
+// ArtifactsClient registers and lists the artifacts of runs
+type ArtifactsClient struct {
+	http *httpClient
+}
+
+// List returns the artifacts of a run in the order they were registered
+func (c *ArtifactsClient) List(ctx context.Context, runID string) ([]*Artifact, error) {
+	response := &struct {
+		Artifacts []*Artifact `json:"artifacts"`
+	}{}
+	if err := c.http.do(ctx, http.MethodGet, "/api/runs/"+url.PathEscape(runID)+"/artifacts/", nil, nil, response); err != nil {
+		return nil, err
+	}
+	for _, artifact := range response.Artifacts {
+		c.resolve(artifact)
+	}
+	return response.Artifacts, nil
+}
+
+// Upload registers content as the artifact name of a run
+func (c *ArtifactsClient) Upload(ctx context.Context, runID, name string, content io.Reader, options UploadOptions) (*Artifact, error) {
+	payload, err := io.ReadAll(content)
+	if err != nil {
+		return nil, err
+	}
+	query := url.Values{"name": {name}}
+	for key, value := range options.Metadata {
+		query.Add("metadata", key+"="+value)
+	}
+	if options.RetentionDays > 0 {
+		query.Set("retention_days", strconv.Itoa(options.RetentionDays))
+	}
+
+	response := &struct {
+		Artifact *Artifact `json:"artifact"`
+	}{}
+	if err := c.http.doRaw(ctx, http.MethodPost, "/api/runs/"+url.PathEscape(runID)+"/artifacts/", query, payload, options.ContentType, response); err != nil {
+		return nil, err
+	}
+	c.resolve(response.Artifact)
+	return response.Artifact, nil
+}
+
+// resolve makes the download URL of an artifact absolute
+func (c *ArtifactsClient) resolve(artifact *Artifact) {
+	if artifact == nil || artifact.DownloadURL == "" {
+		return
+	}
+	if ref, err := url.Parse(artifact.DownloadURL); err == nil {
+		artifact.DownloadURL = c.http.server.ResolveReference(ref).String()
+	}
+}
@@ -0,0 +1,200 @@
+package sdk
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// Lock is a held lock of a scratchpad entry
+type Lock struct {
+	Key    string `json:"key"`
+	Holder string `json:"holder"`
+	// Token proves holding the lock when writing the entry and unlocking
+	Token     string    `json:"token"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// QueuedTask is a unit of work queued for the agents of a workspace
+type QueuedTask struct {
+	ID         string            `json:"id,omitempty"`
+	Type       string            `json:"type"`
+	Payload    map[string]string `json:"payload,omitempty"`
+	EnqueuedBy string            `json:"enqueued_by,omitempty"`
+}
+
+// ClaimedTask is a task claimed by an agent and not acknowledged yet
+type ClaimedTask struct {
+	ID          string `json:"id"`
+	Agent       string `json:"agent"`
+	IdleSeconds int64  `json:"idle_seconds"`
+	Deliveries  int64  `json:"deliveries"`
+}
+
+// Edit is a write of a file by an agent. BaseHash is the hash of the content
+// the agent read before editing, empty for files it created
+type Edit struct {
+	Path     string `json:"path"`
+	Agent    string `json:"agent"`
+	BaseHash string `json:"base_hash"`
+	Hash     string `json:"hash"`
+}
+
+// FileVersion is the last recorded edit of a file
+type FileVersion struct {
+	Hash     string    `json:"hash"`
+	Agent    string    `json:"agent"`
+	EditedAt time.Time `json:"edited_at"`
+}
+
+// LockedError is returned when locking a scratchpad entry another agent holds
+type LockedError struct {
+	*APIError
+	Holder string
+}
+
+func (e *LockedError) Unwrap() error {
+	return e.APIError
+}
+
+// ConflictError is returned when recording an edit based on an outdated
+// version of a file
+type ConflictError struct {
+	*APIError
+	// Current is the version the edit should have been based on
+	Current FileVersion
+}
+
+func (e *ConflictError) Unwrap() error {
+	return e.APIError
+}
+
+// CoordinationClient lets several agents work on one workspace: a scratchpad
+// whose entries are written under a lock, a task queue with claim and ack,
+// and conflict detection of concurrent file edits
+type CoordinationClient struct {
+	http *httpClient
+}
+
+func (c *CoordinationClient) path(workspaceID string, parts ...string) string {
+	path := "/api/workspaces/" + url.PathEscape(workspaceID) + "/"
+	for _, part := range parts {
+		path += url.PathEscape(part) + "/"
+	}
+	return path
+}
+
+// Scratchpad returns the entries of the scratchpad of a workspace
+func (c *CoordinationClient) Scratchpad(ctx context.Context, workspaceID string) (map[string]string, error) {
+	response := &struct {
+		Entries map[string]string `json:"entries"`
+	}{}
+	if err := c.http.do(ctx, http.MethodGet, c.path(workspaceID, "scratchpad"), nil, nil, response); err != nil {
+		return nil, err
+	}
+	return response.Entries, nil
+}
+
+// Lock locks a scratchpad entry for holder, until ttl passes or it is
+// unlocked. It returns a LockedError naming the holder if another agent holds
+// the lock
+func (c *CoordinationClient) Lock(ctx context.Context, workspaceID, key, holder string, ttl time.Duration) (*Lock, error) {
+	request := map[string]interface{}{"holder": holder, "ttl_seconds": int(ttl.Seconds())}
+	response := &struct {
+		Lock *Lock `json:"lock"`
+	}{}
+	err := c.http.do(ctx, http.MethodPost, c.path(workspaceID, "scratchpad", key, "lock"), nil, request, response)
+	var apiErr *APIError
+	if errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusConflict {
+		locked := &LockedError{APIError: apiErr}
+		apiErr.decode("holder", &locked.Holder)
+		return nil, locked
+	} else if err != nil {
+		return nil, err
+	}
+	return response.Lock, nil
+}
+
+// Unlock releases a lock of a scratchpad entry
+func (c *CoordinationClient) Unlock(ctx context.Context, workspaceID string, lock *Lock) error {
+	request := map[string]string{"token": lock.Token}
+	return c.http.do(ctx, http.MethodPost, c.path(workspaceID, "scratchpad", lock.Key, "unlock"), nil, request, nil)
+}
+
+// Set writes a scratchpad entry under its lock
+func (c *CoordinationClient) Set(ctx context.Context, workspaceID string, lock *Lock, value string) error {
+	request := map[string]string{"value": value, "token": lock.Token}
+	return c.http.do(ctx, http.MethodPut, c.path(workspaceID, "scratchpad", lock.Key), nil, request, nil)
+}
+
+// Enqueue queues a task and returns its ID
+func (c *CoordinationClient) Enqueue(ctx context.Context, workspaceID string, task QueuedTask) (string, error) {
+	response := &struct {
+		Task QueuedTask `json:"task"`
+	}{}
+	if err := c.http.do(ctx, http.MethodPost, c.path(workspaceID, "tasks", "enqueue"), nil, task, response); err != nil {
+		return "", err
+	}
+	return response.Task.ID, nil
+}
+
+// Claim returns the next task for agent, waiting up to wait for one, or nil
+// if none arrived. Tasks must be acknowledged with Ack within the visibility
+// timeout of the backend, otherwise they are handed to the next agent
+func (c *CoordinationClient) Claim(ctx context.Context, workspaceID, agent string, wait time.Duration) (*QueuedTask, error) {
+	request := map[string]interface{}{"agent": agent, "wait_seconds": int(wait.Seconds())}
+	response := &struct {
+		Task *QueuedTask `json:"task"`
+	}{}
+	if err := c.http.do(ctx, http.MethodPost, c.path(workspaceID, "tasks", "claim"), nil, request, response); err != nil {
+		return nil, err
+	}
+	return response.Task, nil
+}
+
+// Ack marks a claimed task as done
+func (c *CoordinationClient) Ack(ctx context.Context, workspaceID, taskID string) error {
+	return c.http.do(ctx, http.MethodPost, c.path(workspaceID, "tasks", taskID, "ack"), nil, nil, nil)
+}
+
+// Claimed returns the tasks claimed and not acknowledged yet
+func (c *CoordinationClient) Claimed(ctx context.Context, workspaceID string) ([]ClaimedTask, error) {
+	response := &struct {
+		Tasks []ClaimedTask `json:"tasks"`
+	}{}
+	if err := c.http.do(ctx, http.MethodGet, c.path(workspaceID, "tasks"), nil, nil, response); err != nil {
+		return nil, err
+	}
+	return response.Tasks, nil
+}
+
+// RecordEdit records a write of a file. It returns a ConflictError with the
+// current version if the file changed since edit.BaseHash
+func (c *CoordinationClient) RecordEdit(ctx context.Context, workspaceID string, edit Edit) (*FileVersion, error) {
+	response := &struct {
+		Version *FileVersion `json:"version"`
+	}{}
+	err := c.http.do(ctx, http.MethodPost, c.path(workspaceID, "edits"), nil, edit, response)
+	var apiErr *APIError
+	if errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusConflict {
+		conflict := &ConflictError{APIError: apiErr}
+		apiErr.decode("current", &conflict.Current)
+		return nil, conflict
+	} else if err != nil {
+		return nil, err
+	}
+	return response.Version, nil
+}
+
+// Files returns the recorded version of every file of a workspace
+func (c *CoordinationClient) Files(ctx context.Context, workspaceID string) (map[string]FileVersion, error) {
+	response := &struct {
+		Files map[string]FileVersion `json:"files"`
+	}{}
+	if err := c.http.do(ctx, http.MethodGet, c.path(workspaceID, "edits"), nil, nil, response); err != nil {
+		return nil, err
+	}
+	return response.Files, nil
+}
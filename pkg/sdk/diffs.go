@@ -0,0 +1,129 @@
+package sdk
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+)
+
+// DiffOptions select what the working tree of a workspace is compared with.
+// Base is a git revision, HEAD if both Base and Snapshot are empty
+type DiffOptions struct {
+	Base     string
+	Snapshot string
+	// Paths limit the diff to some files or directories
+	Paths []string
+}
+
+// FileChange is a file changed in a workspace
+type FileChange struct {
+	Path string `json:"path"`
+	// OldPath is the path before a rename or copy
+	OldPath   string `json:"old_path,omitempty"`
+	Status    string `json:"status"`
+	Binary    bool   `json:"binary,omitempty"`
+	Additions int    `json:"additions"`
+	Deletions int    `json:"deletions"`
+	Hunks     []Hunk `json:"hunks,omitempty"`
+}
+
+// Hunk is a changed region of a text file. Lines keep their leading ' ', '-'
+// or '+'
+type Hunk struct {
+	OldStart int      `json:"old_start"`
+	OldLines int      `json:"old_lines"`
+	NewStart int      `json:"new_start"`
+	NewLines int      `json:"new_lines"`
+	Section  string   `json:"section,omitempty"`
+	Lines    []string `json:"lines"`
+}
+
+// WorkspaceDiff is the difference of the working tree of a workspace to its
+// base, as a unified diff and as a change list
+type WorkspaceDiff struct {
+	Base       string       `json:"base"`
+	BaseCommit string       `json:"base_commit"`
+	Patch      string       `json:"patch"`
+	Changes    []FileChange `json:"changes"`
+}
+
+// Snapshot is the working tree of a workspace recorded as a commit
+type Snapshot struct {
+	Name   string `json:"name"`
+	Ref    string `json:"ref"`
+	Commit string `json:"commit"`
+}
+
+// PatchResult lists the files a patch touches
+type PatchResult struct {
+	Applied bool     `json:"applied"`
+	Files   []string `json:"files,omitempty"`
+}
+
+// PatchRejectedError is returned for patches that don't apply to the working
+// tree, which was left unchanged
+type PatchRejectedError struct {
+	*APIError
+	Files []string
+}
+
+func (e *PatchRejectedError) Unwrap() error {
+	return e.APIError
+}
+
+// Diff returns the diff of the working tree of a workspace, untracked files
+// included
+func (c *WorkspacesClient) Diff(ctx context.Context, id string, options DiffOptions) (*WorkspaceDiff, error) {
+	query := url.Values{}
+	if options.Base != "" {
+		query.Set("base", options.Base)
+	}
+	if options.Snapshot != "" {
+		query.Set("snapshot", options.Snapshot)
+	}
+	for _, path := range options.Paths {
+		query.Add("path", path)
+	}
+
+	response := &struct {
+		Diff *WorkspaceDiff `json:"diff"`
+	}{}
+	if err := c.http.do(ctx, http.MethodGet, "/api/workspaces/"+url.PathEscape(id)+"/diff/", query, nil, response); err != nil {
+		return nil, err
+	}
+	return response.Diff, nil
+}
+
+// Snapshot records the working tree of a workspace under name, to diff
+// against it with DiffOptions.Snapshot later
+func (c *WorkspacesClient) Snapshot(ctx context.Context, id, name string) (*Snapshot, error) {
+	response := &struct {
+		Snapshot *Snapshot `json:"snapshot"`
+	}{}
+	request := map[string]string{"name": name}
+	if err := c.http.do(ctx, http.MethodPost, "/api/workspaces/"+url.PathEscape(id)+"/snapshots/", nil, request, response); err != nil {
+		return nil, err
+	}
+	return response.Snapshot, nil
+}
+
+// ApplyPatch applies a reviewed patch to the working tree of a workspace, or
+// only checks that it applies if check is set. It returns a
+// PatchRejectedError if the patch doesn't apply
+func (c *WorkspacesClient) ApplyPatch(ctx context.Context, id, patch string, check bool) (*PatchResult, error) {
+	response := &struct {
+		Result *PatchResult `json:"result"`
+	}{}
+	request := map[string]interface{}{"patch": patch, "check": check}
+	err := c.http.do(ctx, http.MethodPost, "/api/workspaces/"+url.PathEscape(id)+"/patch/", nil, request, response)
+	var apiErr *APIError
+	if errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusConflict {
+		rejected := &PatchRejectedError{APIError: apiErr}
+		apiErr.decode("files", &rejected.Files)
+		return nil, rejected
+	} else if err != nil {
+		return nil, err
+	}
+	return response.Result, nil
+}
@@ -0,0 +1,169 @@
+package sdk
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/websocket"
+)
+
+// Event is an event sent to, or received from, the backend's event bus
+type Event struct {
+	EventType string                 `json:"event_type"`
+	Data      map[string]interface{} `json:"data,omitempty"`
+	Timestamp interface{}            `json:"timestamp,omitempty"`
+}
+
+// EventsClient sends events and subscribes to them
+type EventsClient struct {
+	http *httpClient
+}
+
+// Send publishes an event to every subscriber of its type
+func (c *EventsClient) Send(ctx context.Context, event Event) error {
+	return c.http.do(ctx, http.MethodPost, "/api/events/send/", nil, event, nil)
+}
+
+// List returns the events of a conversation
+func (c *EventsClient) List(ctx context.Context, conversationID string) ([]Event, error) {
+	response := &struct {
+		Events []Event `json:"events"`
+	}{}
+	if err := c.http.do(ctx, http.MethodGet, "/api/events/"+url.PathEscape(conversationID)+"/", nil, nil, response); err != nil {
+		return nil, err
+	}
+	return response.Events, nil
+}
+
+// Create adds an event to a conversation
+func (c *EventsClient) Create(ctx context.Context, conversationID string, event Event) error {
+	return c.http.do(ctx, http.MethodPost, "/api/events/"+url.PathEscape(conversationID)+"/create/", nil, event, nil)
+}
+
+// Subscribe calls handler with every event of the given types until ctx is
+// done or handler fails. The subscription is renewed when the WebSocket
+// breaks; events sent while it is down are missed.
+//
+// Subscribe returns the error of handler, or ctx.Err() once ctx is done
+func (c *EventsClient) Subscribe(ctx context.Context, eventTypes []string, handler func(Event) error) error {
+	if len(eventTypes) == 0 {
+		return fmt.Errorf("at least one event type is required")
+	}
+
+	clientID := uuid.New().String()
+	for failures := 0; ; {
+		received, err := c.subscribe(ctx, clientID, eventTypes, handler)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		var handlerErr *handlerError
+		if errors.As(err, &handlerErr) {
+			return handlerErr.err
+		}
+		var apiErr *APIError
+		if errors.As(err, &apiErr) && apiErr.StatusCode < http.StatusInternalServerError && apiErr.StatusCode != http.StatusTooManyRequests {
+			return err
+		}
+
+		if received {
+			failures = 0
+		}
+		failures++
+		timer := time.NewTimer(c.http.retry.backoff(failures))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// frame holds the fields of the server's WebSocket messages read by
+// subscribe
+type frame struct {
+	Type    string `json:"type"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+	Event
+}
+
+// subscribe reads one WebSocket connection. It reports whether the
+// subscription was confirmed
+func (c *EventsClient) subscribe(ctx context.Context, clientID string, eventTypes []string, handler func(Event) error) (bool, error) {
+	endpoint := *c.http.server
+	endpoint.Scheme = "ws"
+	if c.http.server.Scheme == "https" {
+		endpoint.Scheme = "wss"
+	}
+	endpoint.Path += "/ws/agent/" + url.PathEscape(clientID) + "/"
+
+	header := http.Header{}
+	c.http.header(header)
+	conn, res, err := websocket.DefaultDialer.DialContext(ctx, endpoint.String(), header)
+	if err != nil {
+		if res != nil {
+			raw, _ := io.ReadAll(res.Body)
+			res.Body.Close()
+			return false, &APIError{StatusCode: res.StatusCode, Message: string(bytes.TrimSpace(raw))}
+		}
+		return false, err
+	}
+	defer conn.Close()
+
+	// unblock the read below once ctx is done
+	stop := context.AfterFunc(ctx, func() {
+		_ = conn.SetReadDeadline(time.Now())
+	})
+	defer stop()
+
+	err = conn.WriteJSON(map[string]interface{}{
+		"type":        "subscribe",
+		"id":          "subscribe",
+		"event_types": eventTypes,
+	})
+	if err != nil {
+		return false, err
+	}
+
+	subscribed := false
+	for {
+		_, message, err := conn.ReadMessage()
+		if err != nil {
+			return subscribed, err
+		}
+
+		// the server may batch several messages into one, separated by
+		// newlines
+		decoder := json.NewDecoder(bytes.NewReader(message))
+		for {
+			f := frame{}
+			if err := decoder.Decode(&f); errors.Is(err, io.EOF) {
+				break
+			} else if err != nil {
+				return subscribed, fmt.Errorf("decode message: %w", err)
+			}
+
+			switch f.Type {
+			case "subscribed":
+				subscribed = true
+			case "error":
+				if !subscribed {
+					return false, &APIError{StatusCode: http.StatusBadRequest, Message: f.Code + ": " + f.Message}
+				}
+			case "event":
+				if err := handler(f.Event); err != nil {
+					return subscribed, &handlerError{err: err}
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,232 @@
+package sdk
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/loft-sh/devpod/pkg/kerrors"
+)
+
+// APIError is returned for responses with an error status
+type APIError struct {
+	StatusCode int
+	// Message is the message the backend returned, or the response body if
+	// it didn't return one
+	Message string
+	// RequestID is the ID the request was sent with, pass it to kled trace
+	// to see what happened
+	RequestID string
+	// Code is the error code the backend returned, or the code of the status
+	// if it didn't return one
+	Code kerrors.Code
+	// Remediation is the fix the backend suggested, if any
+	Remediation string
+
+	body []byte
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("%d: %s", e.StatusCode, e.Message)
+}
+
+func (e *APIError) ErrorCode() kerrors.Code {
+	return e.Code
+}
+
+func (e *APIError) ErrorRemediation() string {
+	return e.Remediation
+}
+
+// Is matches the kerrors value of the error's code, e.g.
+// errors.Is(err, kerrors.ErrQuotaExceeded)
+func (e *APIError) Is(target error) bool {
+	return kerrors.IsCode(target, e.Code)
+}
+
+// IsNotFound reports whether err is an APIError for a missing resource
+func IsNotFound(err error) bool {
+	var apiErr *APIError
+	return errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusNotFound
+}
+
+// decode decodes the field key of the error response into out
+func (e *APIError) decode(key string, out interface{}) bool {
+	fields := map[string]json.RawMessage{}
+	if json.Unmarshal(e.body, &fields) != nil || fields[key] == nil {
+		return false
+	}
+	return json.Unmarshal(fields[key], out) == nil
+}
+
+// errorResponse holds the fields of the backend's error responses
+type errorResponse struct {
+	Status      string       `json:"status"`
+	Code        kerrors.Code `json:"code"`
+	Message     string       `json:"message"`
+	Remediation string       `json:"remediation"`
+	Error       string       `json:"error"`
+	Detail      string       `json:"detail"`
+}
+
+type httpClient struct {
+	server    *url.URL
+	client    *http.Client
+	apiKey    string
+	project   string
+	userAgent string
+	retry     RetryPolicy
+}
+
+// url returns the url of path, which is relative to the server
+func (c *httpClient) url(path string, query url.Values) string {
+	u := *c.server
+	u.Path = strings.TrimSuffix(u.Path, "/") + path
+	if len(query) > 0 {
+		u.RawQuery = query.Encode()
+	}
+	return u.String()
+}
+
+func (c *httpClient) header(header http.Header) {
+	if c.apiKey != "" {
+		header.Set("X-API-Key", c.apiKey)
+	}
+	if c.project != "" {
+		header.Set("X-Kled-Project", c.project)
+	}
+	if c.userAgent != "" {
+		header.Set("User-Agent", c.userAgent)
+	}
+}
+
+// do sends a request with body encoded as JSON and decodes the response into
+// out, retrying as the retry policy allows
+func (c *httpClient) do(ctx context.Context, method, path string, query url.Values, body, out interface{}) error {
+	var payload []byte
+	if body != nil {
+		var err error
+		payload, err = json.Marshal(body)
+		if err != nil {
+			return fmt.Errorf("encode request: %w", err)
+		}
+	}
+	return c.doRaw(ctx, method, path, query, payload, "application/json", out)
+}
+
+// doRaw sends payload as is with contentType and decodes the response into
+// out, retrying as the retry policy allows
+func (c *httpClient) doRaw(ctx context.Context, method, path string, query url.Values, payload []byte, contentType string, out interface{}) error {
+	requestID := RequestID(ctx)
+	if requestID == "" {
+		requestID = NewRequestID()
+	}
+
+	for attempt := 1; ; attempt++ {
+		retry, wait, err := c.send(ctx, method, path, query, payload, contentType, requestID, out)
+		if err == nil || !retry || attempt >= c.retry.MaxAttempts {
+			return err
+		}
+
+		if wait <= 0 {
+			wait = c.retry.backoff(attempt)
+		}
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+	}
+}
+
+// send sends a single request. It reports whether the request may be retried
+// and how long the server asked to wait before that
+func (c *httpClient) send(ctx context.Context, method, path string, query url.Values, payload []byte, contentType, requestID string, out interface{}) (bool, time.Duration, error) {
+	var body io.Reader
+	if payload != nil {
+		body = bytes.NewReader(payload)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, c.url(path, query), body)
+	if err != nil {
+		return false, 0, err
+	}
+	c.header(req.Header)
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set(RequestIDHeader, requestID)
+	if payload != nil && contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+
+	res, err := c.client.Do(req)
+	if err != nil {
+		// a cancelled request isn't worth retrying, anything else may not
+		// have reached the server
+		return ctx.Err() == nil, 0, fmt.Errorf("%s %s: %w", method, path, err)
+	}
+	defer res.Body.Close()
+
+	raw, err := io.ReadAll(res.Body)
+	if err != nil {
+		return idempotent(method), 0, fmt.Errorf("read response of %s %s: %w", method, path, err)
+	}
+
+	if res.StatusCode >= http.StatusBadRequest {
+		apiErr := &APIError{StatusCode: res.StatusCode, Message: strings.TrimSpace(string(raw)), RequestID: requestID, Code: kerrors.FromHTTPStatus(res.StatusCode), body: raw}
+		response := &errorResponse{}
+		if json.Unmarshal(raw, response) == nil {
+			for _, message := range []string{response.Message, response.Error, response.Detail} {
+				if message != "" {
+					apiErr.Message = message
+					break
+				}
+			}
+			if response.Code != "" {
+				apiErr.Code = response.Code
+			}
+			apiErr.Remediation = response.Remediation
+		}
+
+		switch {
+		case res.StatusCode == http.StatusTooManyRequests:
+			return true, retryAfter(res.Header), apiErr
+		case res.StatusCode >= http.StatusInternalServerError:
+			return idempotent(method), retryAfter(res.Header), apiErr
+		default:
+			return false, 0, apiErr
+		}
+	}
+
+	if out != nil && len(raw) > 0 {
+		if err := json.Unmarshal(raw, out); err != nil {
+			return false, 0, fmt.Errorf("unexpected response of %s %s (%d): %s", method, path, res.StatusCode, strings.TrimSpace(string(raw)))
+		}
+	}
+	return false, 0, nil
+}
+
+func idempotent(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodPut, http.MethodDelete, http.MethodOptions:
+		return true
+	}
+	return false
+}
+
+// retryAfter parses a Retry-After header given in seconds
+func retryAfter(header http.Header) time.Duration {
+	seconds, err := strconv.Atoi(header.Get("Retry-After"))
+	if err != nil || seconds <= 0 {
+		return 0
+	}
+	return time.Duration(seconds) * time.Second
+}
@@ -0,0 +1,161 @@
+package sdk
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/loft-sh/devpod/pkg/sdk/agentpb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// TaskRequest describes a task for the interpreter
+type TaskRequest struct {
+	Prompt  string
+	Context map[string]string
+	// Tools limits the tools the agent may use
+	Tools []string
+}
+
+// Task is a submitted, or cancelled, interpreter task
+type Task struct {
+	ID      string
+	Status  string
+	Message string
+}
+
+// TaskStatus is the progress of an interpreter task
+type TaskStatus struct {
+	ID     string
+	Status string
+	Result string
+	Events []string
+}
+
+// InterpreterClient runs tasks on the agent runtime over gRPC
+type InterpreterClient struct {
+	address     string
+	dialOptions []grpc.DialOption
+	apiKey      string
+	retry       RetryPolicy
+
+	mu     sync.Mutex
+	conn   *grpc.ClientConn
+	client agentpb.AgentServiceClient
+}
+
+func (c *InterpreterClient) service() (agentpb.AgentServiceClient, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.client != nil {
+		return c.client, nil
+	}
+	if c.address == "" {
+		return nil, fmt.Errorf("the interpreter requires a gRPC address")
+	}
+
+	dialOptions := c.dialOptions
+	if len(dialOptions) == 0 {
+		dialOptions = []grpc.DialOption{grpc.WithTransportCredentials(insecure.NewCredentials())}
+	}
+	conn, err := grpc.NewClient(c.address, dialOptions...)
+	if err != nil {
+		return nil, fmt.Errorf("connect to %s: %w", c.address, err)
+	}
+	c.conn = conn
+	c.client = agentpb.NewAgentServiceClient(conn)
+	return c.client, nil
+}
+
+func (c *InterpreterClient) close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.conn == nil {
+		return nil
+	}
+
+	err := c.conn.Close()
+	c.conn, c.client = nil, nil
+	return err
+}
+
+func (c *InterpreterClient) context(ctx context.Context) context.Context {
+	if c.apiKey == "" {
+		return ctx
+	}
+	return metadata.AppendToOutgoingContext(ctx, "x-api-key", c.apiKey)
+}
+
+// call runs fn, retrying while the server is unavailable if idempotent is
+// set. Submitting a task isn't retried, it might run twice
+func (c *InterpreterClient) call(ctx context.Context, idempotent bool, fn func(context.Context, agentpb.AgentServiceClient) error) error {
+	client, err := c.service()
+	if err != nil {
+		return err
+	}
+
+	ctx = c.context(ctx)
+	for attempt := 1; ; attempt++ {
+		err := fn(ctx, client)
+		if err == nil || !idempotent || status.Code(err) != codes.Unavailable || attempt >= c.retry.MaxAttempts {
+			return err
+		}
+
+		timer := time.NewTimer(c.retry.backoff(attempt))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+	}
+}
+
+// Execute submits a task, it runs in the background
+func (c *InterpreterClient) Execute(ctx context.Context, request TaskRequest) (*Task, error) {
+	var response *agentpb.ExecuteTaskResponse
+	err := c.call(ctx, false, func(ctx context.Context, client agentpb.AgentServiceClient) error {
+		var err error
+		response, err = client.ExecuteTask(ctx, &agentpb.ExecuteTaskRequest{
+			Prompt:  request.Prompt,
+			Context: request.Context,
+			Tools:   request.Tools,
+		})
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("execute task: %w", err)
+	}
+	return &Task{ID: response.TaskId, Status: response.Status, Message: response.Message}, nil
+}
+
+func (c *InterpreterClient) Status(ctx context.Context, taskID string) (*TaskStatus, error) {
+	var response *agentpb.GetTaskStatusResponse
+	err := c.call(ctx, true, func(ctx context.Context, client agentpb.AgentServiceClient) error {
+		var err error
+		response, err = client.GetTaskStatus(ctx, &agentpb.GetTaskStatusRequest{TaskId: taskID})
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("get status of task %s: %w", taskID, err)
+	}
+	return &TaskStatus{ID: response.TaskId, Status: response.Status, Result: response.Result, Events: response.Events}, nil
+}
+
+func (c *InterpreterClient) Cancel(ctx context.Context, taskID string) (*Task, error) {
+	var response *agentpb.CancelTaskResponse
+	err := c.call(ctx, true, func(ctx context.Context, client agentpb.AgentServiceClient) error {
+		var err error
+		response, err = client.CancelTask(ctx, &agentpb.CancelTaskRequest{TaskId: taskID})
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("cancel task %s: %w", taskID, err)
+	}
+	return &Task{ID: response.TaskId, Status: response.Status, Message: response.Message}, nil
+}
@@ -0,0 +1,63 @@
+package sdk
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+)
+
+// PublishRequest describes the branch and pull request to publish the
+// changes of a workspace as
+type PublishRequest struct {
+	Branch string `json:"branch"`
+	// Base is the target of the pull request, by default the branch checked
+	// out in the workspace or the remote's default branch
+	Base    string `json:"base,omitempty"`
+	Title   string `json:"title"`
+	Message string `json:"message,omitempty"`
+	Remote  string `json:"remote,omitempty"`
+	Draft   bool   `json:"draft,omitempty"`
+	// Forge is github or gitlab, guessed from the remote's host if empty
+	Forge string `json:"forge,omitempty"`
+	// Token is a forge token forwarded to push the branch and open the pull
+	// request. The server doesn't store it
+	Token        string `json:"token"`
+	Username     string `json:"username,omitempty"`
+	Summary      string `json:"summary,omitempty"`
+	TrajectoryID string `json:"trajectory_id,omitempty"`
+	// Template is a Go text/template for the description of the pull request
+	Template    string `json:"template,omitempty"`
+	AuthorName  string `json:"author_name,omitempty"`
+	AuthorEmail string `json:"author_email,omitempty"`
+}
+
+// PullRequest is a GitHub pull request or GitLab merge request
+type PullRequest struct {
+	Number int    `json:"number"`
+	URL    string `json:"url"`
+	// Existing is set if it was already open for the branch
+	Existing bool `json:"existing,omitempty"`
+}
+
+// PublishResult is a pushed branch and its pull request
+type PublishResult struct {
+	Branch      string       `json:"branch"`
+	Base        string       `json:"base"`
+	Commit      string       `json:"commit"`
+	Committed   bool         `json:"committed"`
+	RemoteURL   string       `json:"remote_url"`
+	Files       []string     `json:"files,omitempty"`
+	PullRequest *PullRequest `json:"pull_request"`
+}
+
+// Publish commits the changes of a workspace to a branch, pushes it and
+// opens a pull request for it, or returns the one already open
+func (c *WorkspacesClient) Publish(ctx context.Context, id string, request PublishRequest) (*PublishResult, error) {
+	response := &struct {
+		Result *PublishResult `json:"result"`
+	}{}
+	if err := c.http.do(ctx, http.MethodPost, "/api/workspaces/"+url.PathEscape(id)+"/publish/", nil, request, response); err != nil {
+		return nil, err
+	}
+	return response.Result, nil
+}
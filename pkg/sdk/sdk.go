@@ -0,0 +1,158 @@
+// Package sdk is a typed Go client for the kled backend API.
+//
+// A Client bundles the clients for workspaces, shared state, the interpreter,
+// events and multi-agent coordination behind one facade. Requests go over
+// HTTP, interpreter tasks over gRPC and subscriptions over Server-Sent Events
+// or a WebSocket, but callers only deal with typed requests, responses and
+// context cancellation:
+//
+//	client, err := sdk.New(sdk.Options{Server: "https://kled.example.com", APIKey: key})
+//	if err != nil {
+//		return err
+//	}
+//	defer client.Close()
+//
+//	workspaces, err := client.Workspaces.List(ctx)
+//
+// Failed requests are retried with exponential backoff when that is safe:
+// requests that didn't reach the server, requests the server rejected with
+// 429 Too Many Requests, and idempotent requests failing with a 5xx status.
+//
+// Every call sends an X-Request-ID, the ID set with WithRequestID or a new
+// one, which Traces.Get turns into a timeline of what the backend did for it.
+package sdk
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc"
+)
+
+// Options configure a Client
+type Options struct {
+	// Server is the base URL of the backend, such as https://kled.example.com
+	Server string
+	// GRPCAddress is the host:port of the backend's gRPC server. The
+	// interpreter client is unavailable without it
+	GRPCAddress string
+	// APIKey authenticates every request, sent as X-API-Key
+	APIKey string
+	// Project scopes requests to a project, sent as X-Kled-Project
+	Project string
+
+	// HTTPClient sends the HTTP requests, http.DefaultClient if nil
+	HTTPClient *http.Client
+	// GRPCDialOptions are passed to grpc.NewClient, the connection is
+	// insecure if empty
+	GRPCDialOptions []grpc.DialOption
+
+	// Retry configures retries of failed requests
+	Retry RetryPolicy
+	// UserAgent is sent with every HTTP request
+	UserAgent string
+}
+
+// RetryPolicy configures the retries of failed requests. Zero values use the
+// defaults
+type RetryPolicy struct {
+	// MaxAttempts limits how often a request is sent, 1 disables retries
+	MaxAttempts int
+	// InitialBackoff is the wait before the first retry, it doubles with
+	// every further retry
+	InitialBackoff time.Duration
+	// MaxBackoff caps the wait between retries
+	MaxBackoff time.Duration
+}
+
+const (
+	DefaultMaxAttempts    = 3
+	DefaultInitialBackoff = 200 * time.Millisecond
+	DefaultMaxBackoff     = 5 * time.Second
+)
+
+func (p RetryPolicy) withDefaults() RetryPolicy {
+	if p.MaxAttempts <= 0 {
+		p.MaxAttempts = DefaultMaxAttempts
+	}
+	if p.InitialBackoff <= 0 {
+		p.InitialBackoff = DefaultInitialBackoff
+	}
+	if p.MaxBackoff <= 0 {
+		p.MaxBackoff = DefaultMaxBackoff
+	}
+	return p
+}
+
+// backoff returns the wait before the given retry, starting at 1
+func (p RetryPolicy) backoff(retry int) time.Duration {
+	wait := p.InitialBackoff
+	for i := 1; i < retry && wait < p.MaxBackoff; i++ {
+		wait *= 2
+	}
+	if wait > p.MaxBackoff {
+		wait = p.MaxBackoff
+	}
+	return wait
+}
+
+// Client is the facade over the typed clients of the backend API
+type Client struct {
+	Workspaces  *WorkspacesClient
+	State       *StateClient
+	Interpreter *InterpreterClient
+	Events      *EventsClient
+	// Coordination is shared by the agents working on one workspace
+	Coordination *CoordinationClient
+	Traces       *TracesClient
+	Artifacts    *ArtifactsClient
+
+	http *httpClient
+}
+
+// New creates a client for the backend at options.Server
+func New(options Options) (*Client, error) {
+	server, err := url.Parse(strings.TrimSuffix(options.Server, "/"))
+	if err != nil {
+		return nil, fmt.Errorf("parse server url: %w", err)
+	} else if server.Scheme != "http" && server.Scheme != "https" {
+		return nil, fmt.Errorf("server url %q must start with http:// or https://", options.Server)
+	}
+
+	hc := options.HTTPClient
+	if hc == nil {
+		hc = http.DefaultClient
+	}
+
+	client := &Client{
+		http: &httpClient{
+			server:    server,
+			client:    hc,
+			apiKey:    options.APIKey,
+			project:   options.Project,
+			userAgent: options.UserAgent,
+			retry:     options.Retry.withDefaults(),
+		},
+	}
+	client.Workspaces = &WorkspacesClient{http: client.http}
+	client.State = &StateClient{http: client.http}
+	client.Interpreter = &InterpreterClient{
+		address:     options.GRPCAddress,
+		dialOptions: options.GRPCDialOptions,
+		apiKey:      options.APIKey,
+		retry:       client.http.retry,
+	}
+	client.Events = &EventsClient{http: client.http}
+	client.Coordination = &CoordinationClient{http: client.http}
+	client.Traces = &TracesClient{http: client.http}
+	client.Artifacts = &ArtifactsClient{http: client.http}
+	return client, nil
+}
+
+// Close releases the gRPC connection, if one was opened
+func (c *Client) Close() error {
+	return c.Interpreter.close()
+}
@@ -0,0 +1,351 @@
+package sdk
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/loft-sh/devpod/pkg/kerrors"
+	"github.com/loft-sh/devpod/pkg/sdk/agentpb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"gotest.tools/assert"
+)
+
+func newTestClient(t *testing.T, handler http.Handler) *Client {
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+
+	client, err := New(Options{
+		Server:  server.URL,
+		APIKey:  "my-key",
+		Project: "my-project",
+		Retry:   RetryPolicy{InitialBackoff: time.Millisecond, MaxBackoff: 10 * time.Millisecond},
+	})
+	assert.NilError(t, err)
+	return client
+}
+
+func TestRetries(t *testing.T) {
+	var requests atomic.Int32
+	client := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, r.Header.Get("X-API-Key"), "my-key")
+		assert.Equal(t, r.Header.Get("X-Kled-Project"), "my-project")
+		if requests.Add(1) < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		fmt.Fprint(w, `{"heartbeats": [{"workspace_id": "ws-1", "state": "reachable"}]}`)
+	}))
+
+	heartbeats, err := client.Workspaces.Heartbeats(context.Background(), "ws-1")
+	assert.NilError(t, err)
+	assert.Equal(t, heartbeats["ws-1"].State, "reachable")
+	assert.Equal(t, requests.Load(), int32(3))
+
+	// creating isn't idempotent, it isn't retried after a server error
+	requests.Store(0)
+	client = newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprint(w, `{"status": "error", "message": "database unavailable"}`)
+	}))
+	_, err = client.Workspaces.Create(context.Background(), CreateWorkspaceRequest{Name: "my-workspace"})
+	assert.Error(t, err, "500: database unavailable")
+	assert.Equal(t, requests.Load(), int32(1))
+}
+
+func TestRequestIDs(t *testing.T) {
+	var requestIDs []string
+	client := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestIDs = append(requestIDs, r.Header.Get(RequestIDHeader))
+		if len(requestIDs) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		if r.URL.Path == "/api/traces/request-1/" {
+			fmt.Fprint(w, `{"id": "request-1", "entries": [{"source": "api", "name": "GET /api/workspaces/ws-1/"}]}`)
+			return
+		}
+		w.WriteHeader(http.StatusNotFound)
+	}))
+
+	// retries keep the ID of the call, the next call gets a new one
+	_, err := client.Workspaces.Get(context.Background(), "ws-1")
+	var apiErr *APIError
+	assert.Assert(t, errors.As(err, &apiErr))
+	assert.Equal(t, len(requestIDs), 2)
+	assert.Assert(t, requestIDs[0] != "")
+	assert.Equal(t, requestIDs[1], requestIDs[0])
+	assert.Equal(t, apiErr.RequestID, requestIDs[0])
+
+	trace, err := client.Traces.Get(WithRequestID(context.Background(), "request-2"), "request-1")
+	assert.NilError(t, err)
+	assert.Equal(t, requestIDs[2], "request-2")
+	assert.Equal(t, trace.Entries[0].Name, "GET /api/workspaces/ws-1/")
+}
+
+func TestErrorCodes(t *testing.T) {
+	client := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/api/workspaces/ws-1/" {
+			w.WriteHeader(http.StatusTooManyRequests)
+			fmt.Fprint(w, `{"status": "error", "code": "quota_exceeded", "message": "quota exceeded for user", "remediation": "Stop a workspace."}`)
+			return
+		}
+		w.WriteHeader(http.StatusForbidden)
+	}))
+
+	_, err := client.Workspaces.Get(context.Background(), "ws-1")
+	assert.Assert(t, errors.Is(err, kerrors.ErrQuotaExceeded))
+	assert.Equal(t, kerrors.RemediationOf(err), "Stop a workspace.")
+
+	// responses without a code get the code of their status
+	_, err = client.Workspaces.Get(context.Background(), "ws-2")
+	assert.Assert(t, errors.Is(err, kerrors.ErrPermissionDenied))
+	assert.Assert(t, !errors.Is(err, kerrors.ErrNotFound))
+}
+
+func TestListWorkspacesFollowsPages(t *testing.T) {
+	client := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/workspaces/" {
+			http.NotFound(w, r)
+			return
+		}
+		switch r.URL.Query().Get("page") {
+		case "1":
+			fmt.Fprint(w, `{"count": 2, "next": "/api/workspaces/?page=2", "results": [{"id": "ws-1"}]}`)
+		case "2":
+			fmt.Fprint(w, `{"count": 2, "next": "", "results": [{"id": "ws-2"}]}`)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+
+	workspaces, err := client.Workspaces.List(context.Background())
+	assert.NilError(t, err)
+	assert.Equal(t, len(workspaces), 2)
+	assert.Equal(t, workspaces[1].ID, "ws-2")
+
+	_, err = client.Workspaces.Get(context.Background(), "missing")
+	assert.Assert(t, IsNotFound(err))
+}
+
+func TestSubscribeStateResumes(t *testing.T) {
+	var connections atomic.Int32
+	client := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, r.URL.Path, "/api/sse/state/shared/my-state/")
+		w.Header().Set("Content-Type", "text/event-stream")
+		if connections.Add(1) == 1 {
+			// the stream breaks after the first update
+			fmt.Fprint(w, "retry: 1\n\nid: e1\nevent: state_update\ndata: {\"type\": \"state_update\", \"event_id\": \"e1\", \"data\": {\"count\": 1}}\n\n")
+			return
+		}
+		assert.Equal(t, r.Header.Get("Last-Event-ID"), "e1")
+		fmt.Fprint(w, ": keep-alive\n\nid: e2\nevent: state_update\ndata: {\"type\": \"state_update\", \"event_id\": \"e2\", \"data\": {\"count\": 2}}\n\n")
+	}))
+
+	var counts []float64
+	done := fmt.Errorf("done")
+	err := client.State.Subscribe(context.Background(), StateTypeShared, "my-state", func(update StateUpdate) error {
+		counts = append(counts, update.Data["count"].(float64))
+		if len(counts) == 2 {
+			return done
+		}
+		return nil
+	})
+	assert.Equal(t, err, done)
+	assert.DeepEqual(t, counts, []float64{1, 2})
+}
+
+func TestSubscribeEvents(t *testing.T) {
+	upgrader := websocket.Upgrader{}
+	client := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, r.Header.Get("X-API-Key"), "my-key")
+		conn, err := upgrader.Upgrade(w, r, nil)
+		assert.NilError(t, err)
+		defer conn.Close()
+
+		subscribe := map[string]interface{}{}
+		assert.NilError(t, conn.ReadJSON(&subscribe))
+		assert.Equal(t, subscribe["type"], "subscribe")
+
+		// messages are batched like the backend does
+		err = conn.WriteMessage(websocket.TextMessage, []byte(
+			`{"type": "subscribed", "event_types": ["build"]}`+"\n"+
+				`{"type": "event", "event_type": "build", "data": {"step": 1}}`,
+		))
+		assert.NilError(t, err)
+		_, _, _ = conn.ReadMessage()
+	}))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	var received Event
+	done := fmt.Errorf("done")
+	err := client.Events.Subscribe(ctx, []string{"build"}, func(event Event) error {
+		received = event
+		return done
+	})
+	assert.Equal(t, err, done)
+	assert.Equal(t, received.EventType, "build")
+	assert.Equal(t, received.Data["step"], float64(1))
+}
+
+type fakeAgentService struct {
+	agentpb.UnimplementedAgentServiceServer
+}
+
+func (fakeAgentService) ExecuteTask(ctx context.Context, req *agentpb.ExecuteTaskRequest) (*agentpb.ExecuteTaskResponse, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	if keys := md.Get("x-api-key"); len(keys) != 1 || keys[0] != "my-key" {
+		return nil, fmt.Errorf("missing api key")
+	}
+	context, _ := json.Marshal(req.Context)
+	return &agentpb.ExecuteTaskResponse{TaskId: "task-1", Status: "accepted", Message: req.Prompt + " " + string(context)}, nil
+}
+
+func TestInterpreter(t *testing.T) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NilError(t, err)
+	server := grpc.NewServer()
+	agentpb.RegisterAgentServiceServer(server, fakeAgentService{})
+	go func() {
+		_ = server.Serve(lis)
+	}()
+	defer server.Stop()
+
+	client, err := New(Options{Server: "http://localhost", GRPCAddress: lis.Addr().String(), APIKey: "my-key"})
+	assert.NilError(t, err)
+	defer client.Close()
+
+	task, err := client.Interpreter.Execute(context.Background(), TaskRequest{Prompt: "build", Context: map[string]string{"a": "b"}})
+	assert.NilError(t, err)
+	assert.Equal(t, task.ID, "task-1")
+	assert.Equal(t, task.Message, `build {"a":"b"}`)
+
+	_, err = client.Interpreter.Status(context.Background(), "task-1")
+	assert.ErrorContains(t, err, "not implemented")
+}
+
+func TestCoordinationConflicts(t *testing.T) {
+	client := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/api/workspaces/ws-1/scratchpad/plan/lock/":
+			w.WriteHeader(http.StatusConflict)
+			fmt.Fprint(w, `{"status": "error", "message": "plan is locked by planner", "holder": "planner"}`)
+		case "/api/workspaces/ws-1/edits/":
+			w.WriteHeader(http.StatusConflict)
+			fmt.Fprint(w, `{"status": "error", "message": "main.go was changed", "current": {"hash": "b", "agent": "coder-1"}}`)
+		case "/api/workspaces/ws-1/tasks/claim/":
+			var request map[string]interface{}
+			_ = json.NewDecoder(r.Body).Decode(&request)
+			assert.Equal(t, request["agent"], "coder-2")
+			fmt.Fprint(w, `{"status": "success", "task": {"id": "1-0", "type": "test", "payload": {"package": "./api"}}}`)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	ctx := context.Background()
+
+	_, err := client.Coordination.Lock(ctx, "ws-1", "plan", "coder-2", time.Minute)
+	var locked *LockedError
+	assert.Assert(t, errors.As(err, &locked))
+	assert.Equal(t, locked.Holder, "planner")
+
+	_, err = client.Coordination.RecordEdit(ctx, "ws-1", Edit{Path: "main.go", Agent: "coder-2", BaseHash: "a", Hash: "c"})
+	var conflict *ConflictError
+	assert.Assert(t, errors.As(err, &conflict))
+	assert.Equal(t, conflict.Current.Agent, "coder-1")
+	assert.Equal(t, conflict.StatusCode, http.StatusConflict)
+
+	task, err := client.Coordination.Claim(ctx, "ws-1", "coder-2", 10*time.Second)
+	assert.NilError(t, err)
+	assert.Equal(t, task.Payload["package"], "./api")
+}
+
+func TestWorkspaceDiffAndPatch(t *testing.T) {
+	client := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/api/workspaces/ws-1/diff/":
+			assert.Equal(t, r.URL.Query().Get("snapshot"), "before")
+			assert.DeepEqual(t, r.URL.Query()["path"], []string{"api", "go.mod"})
+			fmt.Fprint(w, `{"status": "success", "diff": {"base": "refs/kled/snapshots/before", "base_commit": "abc", "patch": "diff --git a/go.mod b/go.mod\n", "changes": [{"path": "go.mod", "status": "modified", "additions": 1, "deletions": 1}]}}`)
+		case "/api/workspaces/ws-1/patch/":
+			w.WriteHeader(http.StatusConflict)
+			fmt.Fprint(w, `{"status": "error", "message": "patch does not apply: git apply: error: go.mod: patch does not apply", "files": ["go.mod"]}`)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	ctx := context.Background()
+
+	diff, err := client.Workspaces.Diff(ctx, "ws-1", DiffOptions{Snapshot: "before", Paths: []string{"api", "go.mod"}})
+	assert.NilError(t, err)
+	assert.Equal(t, diff.BaseCommit, "abc")
+	assert.Equal(t, diff.Changes[0].Path, "go.mod")
+
+	_, err = client.Workspaces.ApplyPatch(ctx, "ws-1", diff.Patch, false)
+	var rejected *PatchRejectedError
+	assert.Assert(t, errors.As(err, &rejected))
+	assert.DeepEqual(t, rejected.Files, []string{"go.mod"})
+}
+
+func TestWorkspacePublish(t *testing.T) {
+	client := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var request PublishRequest
+		assert.NilError(t, json.NewDecoder(r.Body).Decode(&request))
+		assert.Equal(t, r.URL.Path, "/api/workspaces/ws-1/publish/")
+		assert.Equal(t, request.Token, "ghp_secret")
+		assert.Equal(t, request.TrajectoryID, "t-1")
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		fmt.Fprint(w, `{"status": "success", "result": {"branch": "kled/fix", "base": "main", "commit": "abc", "committed": true, "files": ["go.mod"], "pull_request": {"number": 7, "url": "https://github.com/acme/api/pull/7"}}}`)
+	}))
+
+	result, err := client.Workspaces.Publish(context.Background(), "ws-1", PublishRequest{Branch: "kled/fix", Title: "Fix", Token: "ghp_secret", TrajectoryID: "t-1"})
+	assert.NilError(t, err)
+	assert.Equal(t, result.Base, "main")
+	assert.Equal(t, result.PullRequest.URL, "https://github.com/acme/api/pull/7")
+}
+
+func TestArtifacts(t *testing.T) {
+	client := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, r.URL.Path, "/api/runs/run-1/artifacts/")
+		w.Header().Set("Content-Type", "application/json")
+		if r.Method == http.MethodPost {
+			body, err := io.ReadAll(r.Body)
+			assert.NilError(t, err)
+			assert.Equal(t, string(body), "hello")
+			assert.Equal(t, r.Header.Get("Content-Type"), "text/plain")
+			assert.Equal(t, r.URL.Query().Get("name"), "report.txt")
+			assert.DeepEqual(t, r.URL.Query()["metadata"], []string{"step=3"})
+			w.WriteHeader(http.StatusCreated)
+			fmt.Fprint(w, `{"status": "success", "artifact": {"id": "a-1", "name": "report.txt", "size": 5, "download_url": "/api/artifacts/a-1/download/?expires=1&signature=abc"}}`)
+			return
+		}
+		fmt.Fprint(w, `{"status": "success", "artifacts": [{"id": "a-1", "name": "report.txt", "size": 5, "download_url": "/api/artifacts/a-1/download/?expires=1&signature=abc"}]}`)
+	}))
+	ctx := context.Background()
+
+	artifact, err := client.Artifacts.Upload(ctx, "run-1", "report.txt", strings.NewReader("hello"), UploadOptions{ContentType: "text/plain", Metadata: map[string]string{"step": "3"}})
+	assert.NilError(t, err)
+	assert.Equal(t, artifact.Size, int64(5))
+
+	artifacts, err := client.Artifacts.List(ctx, "run-1")
+	assert.NilError(t, err)
+	assert.Equal(t, len(artifacts), 1)
+	assert.Assert(t, strings.HasPrefix(artifacts[0].DownloadURL, "http://"))
+	assert.Assert(t, strings.HasSuffix(artifacts[0].DownloadURL, "/api/artifacts/a-1/download/?expires=1&signature=abc"))
+}
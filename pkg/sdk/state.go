@@ -0,0 +1,181 @@
+package sdk
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// State types accepted by Subscribe
+const (
+	StateTypeTask      = "task"
+	StateTypeAgent     = "agent"
+	StateTypeLifecycle = "lifecycle"
+	StateTypeShared    = "shared"
+)
+
+// StateUpdate is a change of a state, or its full content when a
+// subscription starts
+type StateUpdate struct {
+	Type      string                 `json:"type"`
+	StateType string                 `json:"state_type"`
+	StateID   string                 `json:"state_id"`
+	EventID   string                 `json:"event_id,omitempty"`
+	Data      map[string]interface{} `json:"data"`
+}
+
+// StateClient reads, updates and subscribes to shared state
+type StateClient struct {
+	http *httpClient
+}
+
+// Get returns the shared state with the given ID
+func (c *StateClient) Get(ctx context.Context, id string) (map[string]interface{}, error) {
+	state := map[string]interface{}{}
+	if err := c.http.do(ctx, http.MethodGet, "/api/state/shared/"+url.PathEscape(id)+"/", nil, nil, &state); err != nil {
+		return nil, err
+	}
+	return state, nil
+}
+
+// Update merges data into the shared state with the given ID
+func (c *StateClient) Update(ctx context.Context, id string, data map[string]interface{}) error {
+	return c.http.do(ctx, http.MethodPost, "/api/state/shared/"+url.PathEscape(id)+"/", nil, data, nil)
+}
+
+// Subscribe calls handler with the current state and every later update
+// until ctx is done or handler fails. Broken streams are resumed from the
+// last received update, so no update is missed while reconnecting.
+//
+// Subscribe returns the error of handler, or ctx.Err() once ctx is done
+func (c *StateClient) Subscribe(ctx context.Context, stateType, stateID string, handler func(StateUpdate) error) error {
+	path := "/api/sse/state/" + url.PathEscape(stateType) + "/" + url.PathEscape(stateID) + "/"
+	stream := &eventStream{}
+
+	for failures := 0; ; {
+		received, err := c.stream(ctx, path, stream, handler)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		var handlerErr *handlerError
+		if errors.As(err, &handlerErr) {
+			return handlerErr.err
+		}
+		var apiErr *APIError
+		if errors.As(err, &apiErr) && apiErr.StatusCode < http.StatusInternalServerError && apiErr.StatusCode != http.StatusTooManyRequests {
+			return err
+		}
+
+		if received {
+			failures = 0
+		}
+		failures++
+		// the server's retry hint is the least to wait
+		wait := c.http.retry.backoff(failures)
+		if stream.retry > wait {
+			wait = stream.retry
+		}
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// handlerError marks errors returned by a subscriber's handler
+type handlerError struct {
+	err error
+}
+
+func (e *handlerError) Error() string { return e.err.Error() }
+
+// eventStream is the state of a Server-Sent Events stream kept across
+// reconnects
+type eventStream struct {
+	lastEventID string
+	retry       time.Duration
+}
+
+// stream reads one connection of the stream at path. It reports whether any
+// update was received
+func (c *StateClient) stream(ctx context.Context, path string, stream *eventStream, handler func(StateUpdate) error) (bool, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.http.url(path, nil), nil)
+	if err != nil {
+		return false, err
+	}
+	c.http.header(req.Header)
+	req.Header.Set("Accept", "text/event-stream")
+	if stream.lastEventID != "" {
+		req.Header.Set("Last-Event-ID", stream.lastEventID)
+	}
+
+	res, err := c.http.client.Do(req)
+	if err != nil {
+		return false, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		raw, _ := io.ReadAll(res.Body)
+		return false, &APIError{StatusCode: res.StatusCode, Message: strings.TrimSpace(string(raw))}
+	}
+
+	received := false
+	var id, event string
+	var data strings.Builder
+	scanner := bufio.NewScanner(res.Body)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" {
+			if data.Len() > 0 && (event == "" || event == "state_update") {
+				update := StateUpdate{}
+				if err := json.Unmarshal([]byte(data.String()), &update); err != nil {
+					return received, fmt.Errorf("decode state update: %w", err)
+				}
+				if err := handler(update); err != nil {
+					return received, &handlerError{err: err}
+				}
+				received = true
+				if id != "" {
+					stream.lastEventID = id
+				}
+			}
+			id, event = "", ""
+			data.Reset()
+			continue
+		}
+
+		field, value, _ := strings.Cut(line, ":")
+		value = strings.TrimPrefix(value, " ")
+		switch field {
+		case "id":
+			id = value
+		case "event":
+			event = value
+		case "data":
+			if data.Len() > 0 {
+				data.WriteByte('\n')
+			}
+			data.WriteString(value)
+		case "retry":
+			if millis, err := strconv.Atoi(value); err == nil {
+				stream.retry = time.Duration(millis) * time.Millisecond
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return received, err
+	}
+	return received, io.ErrUnexpectedEOF
+}
@@ -0,0 +1,69 @@
+package sdk
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// RequestIDHeader carries the correlation ID of a request. The backend
+// passes it on to the events, agent commands and runs the request causes,
+// and returns it in every response
+const RequestIDHeader = "X-Request-ID"
+
+type requestIDKey struct{}
+
+// WithRequestID makes every request sent with ctx carry id, so they share
+// one trace. Without it each call gets a new ID, kept across its retries
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// RequestID returns the request ID set with WithRequestID
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// NewRequestID returns a new request ID
+func NewRequestID() string {
+	return uuid.New().String()
+}
+
+// TraceEntry is something that happened for a request
+type TraceEntry struct {
+	ID string `json:"id"`
+	// Time is when it happened, or started for entries with a duration
+	Time time.Time `json:"time"`
+	// Source is one of api, events, agent, run or audit
+	Source     string            `json:"source"`
+	Name       string            `json:"name"`
+	Message    string            `json:"message,omitempty"`
+	DurationMs int64             `json:"duration_ms,omitempty"`
+	Error      string            `json:"error,omitempty"`
+	Attributes map[string]string `json:"attributes,omitempty"`
+}
+
+// Trace is the timeline of a request ID
+type Trace struct {
+	ID      string       `json:"id"`
+	Entries []TraceEntry `json:"entries"`
+}
+
+// TracesClient reads the timelines of requests. Reading them requires an
+// admin API key
+type TracesClient struct {
+	http *httpClient
+}
+
+// Get returns the timeline of the request id, ordered by time
+func (c *TracesClient) Get(ctx context.Context, id string) (*Trace, error) {
+	trace := &Trace{}
+	if err := c.http.do(ctx, http.MethodGet, "/api/traces/"+url.PathEscape(id)+"/", nil, nil, trace); err != nil {
+		return nil, err
+	}
+	return trace, nil
+}
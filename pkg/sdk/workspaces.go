@@ -0,0 +1,122 @@
+package sdk
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// Workspace is a workspace as stored by the backend
+type Workspace struct {
+	ID             string    `json:"id"`
+	Name           string    `json:"name"`
+	Slug           string    `json:"slug"`
+	Description    string    `json:"description,omitempty"`
+	OrganizationID string    `json:"organization_id"`
+	ProjectID      string    `json:"project_id,omitempty"`
+	CreatedByID    string    `json:"created_by_id,omitempty"`
+	CreatedAt      time.Time `json:"created_at"`
+	UpdatedAt      time.Time `json:"updated_at"`
+}
+
+// CreateWorkspaceRequest holds the fields of a new workspace
+type CreateWorkspaceRequest struct {
+	Name        string `json:"name"`
+	Slug        string `json:"slug,omitempty"`
+	Description string `json:"description,omitempty"`
+	ProjectID   string `json:"project_id,omitempty"`
+}
+
+// Heartbeat is the liveness of a workspace agent as last reported
+type Heartbeat struct {
+	WorkspaceID   string    `json:"workspace_id"`
+	WorkspaceUID  string    `json:"workspace_uid,omitempty"`
+	State         string    `json:"state"`
+	LastSeen      time.Time `json:"last_seen"`
+	Version       string    `json:"version,omitempty"`
+	Hostname      string    `json:"hostname,omitempty"`
+	UptimeSeconds int64     `json:"uptime_seconds,omitempty"`
+}
+
+// page is a page of a paginated list
+type page[T any] struct {
+	Count   int    `json:"count"`
+	Next    string `json:"next"`
+	Results []T    `json:"results"`
+}
+
+// WorkspacesClient manages workspaces
+type WorkspacesClient struct {
+	http *httpClient
+}
+
+// List returns every workspace visible to the caller, following the pages
+// of the list
+func (c *WorkspacesClient) List(ctx context.Context) ([]Workspace, error) {
+	var workspaces []Workspace
+	for number := 1; ; number++ {
+		response := &page[Workspace]{}
+		err := c.http.do(ctx, http.MethodGet, "/api/workspaces/", url.Values{"page": {strconv.Itoa(number)}}, nil, response)
+		if err != nil {
+			return nil, err
+		}
+
+		workspaces = append(workspaces, response.Results...)
+		if response.Next == "" || len(response.Results) == 0 {
+			return workspaces, nil
+		}
+	}
+}
+
+func (c *WorkspacesClient) Get(ctx context.Context, id string) (*Workspace, error) {
+	workspace := &Workspace{}
+	if err := c.http.do(ctx, http.MethodGet, "/api/workspaces/"+url.PathEscape(id)+"/", nil, nil, workspace); err != nil {
+		return nil, err
+	}
+	return workspace, nil
+}
+
+func (c *WorkspacesClient) Create(ctx context.Context, request CreateWorkspaceRequest) (*Workspace, error) {
+	workspace := &Workspace{}
+	if err := c.http.do(ctx, http.MethodPost, "/api/workspaces/", nil, request, workspace); err != nil {
+		return nil, err
+	}
+	return workspace, nil
+}
+
+func (c *WorkspacesClient) Start(ctx context.Context, id string) error {
+	return c.http.do(ctx, http.MethodPost, "/api/workspaces/"+url.PathEscape(id)+"/start/", nil, nil, nil)
+}
+
+func (c *WorkspacesClient) Stop(ctx context.Context, id string) error {
+	return c.http.do(ctx, http.MethodPost, "/api/workspaces/"+url.PathEscape(id)+"/stop/", nil, nil, nil)
+}
+
+func (c *WorkspacesClient) Delete(ctx context.Context, id string) error {
+	return c.http.do(ctx, http.MethodDelete, "/api/workspaces/"+url.PathEscape(id)+"/", nil, nil, nil)
+}
+
+// Heartbeats returns the last heartbeats of the agents of the given
+// workspaces, keyed by workspace ID. Workspaces whose agent never reported
+// are missing from the result
+func (c *WorkspacesClient) Heartbeats(ctx context.Context, ids ...string) (map[string]Heartbeat, error) {
+	query := url.Values{}
+	for _, id := range ids {
+		query.Add("workspace_id", id)
+	}
+
+	response := &struct {
+		Heartbeats []Heartbeat `json:"heartbeats"`
+	}{}
+	if err := c.http.do(ctx, http.MethodGet, "/api/workspaces/heartbeats/", query, nil, response); err != nil {
+		return nil, err
+	}
+
+	heartbeats := make(map[string]Heartbeat, len(response.Heartbeats))
+	for _, beat := range response.Heartbeats {
+		heartbeats[beat.WorkspaceID] = beat
+	}
+	return heartbeats, nil
+}
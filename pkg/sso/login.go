@@ -0,0 +1,184 @@
+package sso
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/loft-sh/devpod/pkg/kerrors"
+)
+
+// RefreshLeeway refreshes access tokens this long before they expire, so
+// they don't expire in flight
+const RefreshLeeway = time.Minute
+
+type LoginOptions struct {
+	Server   string
+	Issuer   string
+	ClientID string
+	Scopes   []string
+	Audience string
+
+	// HTTPClient talks to the OIDC provider, http.DefaultClient if nil
+	HTTPClient *http.Client
+}
+
+// DeviceLogin runs the device authorization flow. prompt is called with the code
+// the user has to approve, the tokens are stored once they did
+func DeviceLogin(ctx context.Context, options LoginOptions, prompt func(*DeviceAuthorization)) (*Login, error) {
+	login := &Login{
+		Server:    NormalizeServer(options.Server),
+		Issuer:    options.Issuer,
+		ClientID:  options.ClientID,
+		Scopes:    options.Scopes,
+		Audience:  options.Audience,
+		CreatedAt: time.Now().UTC(),
+	}
+	if login.Server == "" {
+		return nil, fmt.Errorf("server is empty")
+	}
+	if login.Issuer == "" || login.ClientID == "" {
+		return nil, fmt.Errorf("the OIDC issuer and client ID are required to log in to %s", login.Server)
+	}
+	if len(login.Scopes) == 0 {
+		login.Scopes = DefaultScopes
+	}
+
+	provider, err := Discover(ctx, login.Issuer, options.HTTPClient)
+	if err != nil {
+		return nil, err
+	}
+	authorization, err := provider.Authorize(ctx, login.ClientID, login.Scopes, login.Audience)
+	if err != nil {
+		return nil, err
+	}
+	prompt(authorization)
+
+	tokens, err := provider.Poll(ctx, login.ClientID, authorization)
+	if err != nil {
+		return nil, err
+	}
+	if tokens.IDToken != "" {
+		claims, err := ParseIDToken(tokens.IDToken)
+		if err == nil {
+			login.Subject = claims.Subject
+			login.Email = claims.Email
+		}
+	}
+
+	err = tokenStore.Store(login.Server, tokens)
+	if err != nil {
+		return nil, err
+	}
+	return login, upsert(login)
+}
+
+// Logout removes the login for server and its tokens
+func Logout(server string) error {
+	server = NormalizeServer(server)
+	login, err := Find(server)
+	if err != nil {
+		return err
+	} else if login == nil {
+		return fmt.Errorf("not logged in to %s", server)
+	}
+
+	err = tokenStore.Erase(server)
+	if err != nil {
+		return err
+	}
+	return remove(server)
+}
+
+// Transport attaches the access token of the login for Server to requests
+// that don't authenticate otherwise, and refreshes it when it is about to
+// expire. Requests are sent unchanged if the CLI isn't logged in
+type Transport struct {
+	Server string
+	// Base sends the requests, http.DefaultTransport if nil
+	Base http.RoundTripper
+
+	mu       sync.Mutex
+	loaded   bool
+	login    *Login
+	tokens   *Tokens
+	provider *Provider
+}
+
+// HTTPClient returns a client authenticating requests to server with its
+// login
+func HTTPClient(server string) *http.Client {
+	return &http.Client{Transport: &Transport{Server: server}}
+}
+
+func (t *Transport) base() http.RoundTripper {
+	if t.Base == nil {
+		return http.DefaultTransport
+	}
+	return t.Base
+}
+
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Header.Get("Authorization") != "" || req.Header.Get("X-API-Key") != "" {
+		return t.base().RoundTrip(req)
+	}
+
+	token, err := t.Token(req.Context())
+	if err != nil {
+		return nil, err
+	} else if token == "" {
+		return t.base().RoundTrip(req)
+	}
+
+	authenticated := req.Clone(req.Context())
+	authenticated.Header.Set("Authorization", "Bearer "+token)
+	return t.base().RoundTrip(authenticated)
+}
+
+// Token returns the access token of the login, refreshed if it is about to
+// expire, or "" if there is no login for the server
+func (t *Transport) Token(ctx context.Context) (string, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if !t.loaded {
+		login, err := Find(t.Server)
+		if err != nil {
+			return "", err
+		}
+		if login != nil {
+			tokens, err := tokenStore.Get(login.Server)
+			if err != nil {
+				return "", kerrors.Errorf(kerrors.NotAuthenticated, "%w", err).WithRemediation("run kled login to log in again")
+			}
+			t.login, t.tokens = login, tokens
+		}
+		t.loaded = true
+	}
+	if t.login == nil {
+		return "", nil
+	}
+	if !t.tokens.Expired(time.Now(), RefreshLeeway) {
+		return t.tokens.AccessToken, nil
+	}
+
+	if t.provider == nil {
+		provider, err := Discover(ctx, t.login.Issuer, &http.Client{Transport: t.base()})
+		if err != nil {
+			return "", err
+		}
+		t.provider = provider
+	}
+	tokens, err := t.provider.Refresh(ctx, t.login.ClientID, t.tokens)
+	if err != nil {
+		return "", err
+	}
+	err = tokenStore.Store(t.login.Server, tokens)
+	if err != nil {
+		return "", err
+	}
+	t.tokens = tokens
+	return tokens.AccessToken, nil
+}
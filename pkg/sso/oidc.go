@@ -0,0 +1,275 @@
+package sso
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/loft-sh/devpod/pkg/kerrors"
+)
+
+var (
+	// ErrAccessDenied is returned when the user declined the login
+	ErrAccessDenied = kerrors.New(kerrors.PermissionDenied, "the login was denied").WithRemediation("run kled login again and approve the request in the browser")
+	// ErrExpiredCode is returned when the user didn't approve the login in time
+	ErrExpiredCode = kerrors.New(kerrors.Timeout, "the login code expired").WithRemediation("run kled login again and enter the code before it expires")
+	// ErrRefreshFailed is returned when the refresh token was rejected
+	ErrRefreshFailed = kerrors.New(kerrors.NotAuthenticated, "the login expired").WithRemediation("run kled login to log in again")
+)
+
+// Provider holds the endpoints of an OIDC provider
+type Provider struct {
+	Issuer                      string `json:"issuer"`
+	DeviceAuthorizationEndpoint string `json:"device_authorization_endpoint"`
+	TokenEndpoint               string `json:"token_endpoint"`
+
+	client *http.Client
+}
+
+// Discover reads the OIDC configuration of the issuer. client may be nil
+func Discover(ctx context.Context, issuer string, client *http.Client) (*Provider, error) {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	configURL := strings.TrimSuffix(issuer, "/") + "/.well-known/openid-configuration"
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, configURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	res, err := client.Do(req)
+	if err != nil {
+		return nil, kerrors.Errorf(kerrors.BackendUnavailable, "discover OIDC provider %s: %w", issuer, err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return nil, kerrors.Errorf(kerrors.BackendUnavailable, "discover OIDC provider %s: status %d", issuer, res.StatusCode)
+	}
+
+	provider := &Provider{client: client}
+	err = json.NewDecoder(res.Body).Decode(provider)
+	if err != nil {
+		return nil, fmt.Errorf("parse OIDC configuration of %s: %w", issuer, err)
+	}
+	if provider.DeviceAuthorizationEndpoint == "" {
+		return nil, kerrors.Errorf(kerrors.InvalidArgument, "OIDC provider %s doesn't support the device authorization flow", issuer)
+	}
+	return provider, nil
+}
+
+// pollUnit is the unit of the polling intervals of the provider, tests
+// shorten it
+var pollUnit = time.Second
+
+// DeviceAuthorization is the code the user approves the login with
+type DeviceAuthorization struct {
+	DeviceCode              string `json:"device_code"`
+	UserCode                string `json:"user_code"`
+	VerificationURI         string `json:"verification_uri"`
+	VerificationURIComplete string `json:"verification_uri_complete"`
+	ExpiresIn               int    `json:"expires_in"`
+	Interval                int    `json:"interval"`
+}
+
+// Tokens are the tokens issued by the provider
+type Tokens struct {
+	AccessToken  string    `json:"accessToken"`
+	RefreshToken string    `json:"refreshToken,omitempty"`
+	IDToken      string    `json:"idToken,omitempty"`
+	Expiry       time.Time `json:"expiry"`
+}
+
+// Expired reports whether the access token expires within leeway
+func (t *Tokens) Expired(now time.Time, leeway time.Duration) bool {
+	return !t.Expiry.IsZero() && !now.Add(leeway).Before(t.Expiry)
+}
+
+type tokenResponse struct {
+	AccessToken      string `json:"access_token"`
+	RefreshToken     string `json:"refresh_token"`
+	IDToken          string `json:"id_token"`
+	ExpiresIn        int    `json:"expires_in"`
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description"`
+}
+
+// post sends an OAuth form request and decodes the response into out. OAuth
+// errors are decoded too, their status is returned with them
+func (p *Provider) post(ctx context.Context, endpoint string, form url.Values, out interface{}) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+
+	res, err := p.client.Do(req)
+	if err != nil {
+		return 0, kerrors.Errorf(kerrors.BackendUnavailable, "POST %s: %w", endpoint, err)
+	}
+	defer res.Body.Close()
+
+	raw, err := io.ReadAll(res.Body)
+	if err != nil {
+		return res.StatusCode, err
+	}
+	if err := json.Unmarshal(raw, out); err != nil {
+		return res.StatusCode, fmt.Errorf("unexpected response of %s (%d): %s", endpoint, res.StatusCode, strings.TrimSpace(string(raw)))
+	}
+	return res.StatusCode, nil
+}
+
+// Authorize starts the device authorization flow
+func (p *Provider) Authorize(ctx context.Context, clientID string, scopes []string, audience string) (*DeviceAuthorization, error) {
+	form := url.Values{"client_id": {clientID}, "scope": {strings.Join(scopes, " ")}}
+	if audience != "" {
+		form.Set("audience", audience)
+	}
+
+	authorization := &DeviceAuthorization{}
+	response := &struct {
+		*DeviceAuthorization
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}{DeviceAuthorization: authorization}
+	status, err := p.post(ctx, p.DeviceAuthorizationEndpoint, form, response)
+	if err != nil {
+		return nil, err
+	}
+	if status != http.StatusOK || authorization.DeviceCode == "" {
+		return nil, kerrors.Errorf(kerrors.FromHTTPStatus(status), "start device authorization: %s", oauthError(response.Error, response.ErrorDescription, status))
+	}
+	if authorization.Interval <= 0 {
+		authorization.Interval = 5
+	}
+	return authorization, nil
+}
+
+// Poll waits until the user approved or declined the device authorization
+// and returns the tokens
+func (p *Provider) Poll(ctx context.Context, clientID string, authorization *DeviceAuthorization) (*Tokens, error) {
+	interval := time.Duration(authorization.Interval) * pollUnit
+	deadline := time.Now().Add(time.Duration(authorization.ExpiresIn) * time.Second)
+	form := url.Values{
+		"grant_type":  {"urn:ietf:params:oauth:grant-type:device_code"},
+		"device_code": {authorization.DeviceCode},
+		"client_id":   {clientID},
+	}
+
+	for {
+		timer := time.NewTimer(interval)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		case <-timer.C:
+		}
+
+		response := &tokenResponse{}
+		status, err := p.post(ctx, p.TokenEndpoint, form, response)
+		if err != nil {
+			return nil, err
+		}
+		switch response.Error {
+		case "":
+			if status == http.StatusOK {
+				return response.tokens(time.Now()), nil
+			}
+		case "authorization_pending":
+			if authorization.ExpiresIn > 0 && time.Now().After(deadline) {
+				return nil, ErrExpiredCode
+			}
+			continue
+		case "slow_down":
+			interval += 5 * pollUnit
+			continue
+		case "access_denied":
+			return nil, ErrAccessDenied
+		case "expired_token":
+			return nil, ErrExpiredCode
+		}
+		return nil, kerrors.Errorf(kerrors.FromHTTPStatus(status), "poll device authorization: %s", oauthError(response.Error, response.ErrorDescription, status))
+	}
+}
+
+// Refresh exchanges the refresh token for new tokens. Providers that don't
+// rotate refresh tokens keep the previous one
+func (p *Provider) Refresh(ctx context.Context, clientID string, tokens *Tokens) (*Tokens, error) {
+	if tokens.RefreshToken == "" {
+		return nil, ErrRefreshFailed
+	}
+	form := url.Values{
+		"grant_type":    {"refresh_token"},
+		"refresh_token": {tokens.RefreshToken},
+		"client_id":     {clientID},
+	}
+
+	response := &tokenResponse{}
+	status, err := p.post(ctx, p.TokenEndpoint, form, response)
+	if err != nil {
+		return nil, err
+	}
+	if status == http.StatusBadRequest || status == http.StatusUnauthorized {
+		return nil, fmt.Errorf("%w: %s", ErrRefreshFailed, oauthError(response.Error, response.ErrorDescription, status))
+	} else if status != http.StatusOK || response.AccessToken == "" {
+		return nil, kerrors.Errorf(kerrors.FromHTTPStatus(status), "refresh token: %s", oauthError(response.Error, response.ErrorDescription, status))
+	}
+
+	refreshed := response.tokens(time.Now())
+	if refreshed.RefreshToken == "" {
+		refreshed.RefreshToken = tokens.RefreshToken
+	}
+	if refreshed.IDToken == "" {
+		refreshed.IDToken = tokens.IDToken
+	}
+	return refreshed, nil
+}
+
+func (r *tokenResponse) tokens(now time.Time) *Tokens {
+	tokens := &Tokens{AccessToken: r.AccessToken, RefreshToken: r.RefreshToken, IDToken: r.IDToken}
+	if r.ExpiresIn > 0 {
+		tokens.Expiry = now.Add(time.Duration(r.ExpiresIn) * time.Second)
+	}
+	return tokens
+}
+
+func oauthError(code, description string, status int) string {
+	switch {
+	case code != "" && description != "":
+		return code + ": " + description
+	case code != "":
+		return code
+	default:
+		return fmt.Sprintf("status %d", status)
+	}
+}
+
+// IdentityClaims are the claims of an ID token shown to the user
+type IdentityClaims struct {
+	Subject string `json:"sub"`
+	Email   string `json:"email"`
+}
+
+// ParseIDToken returns the claims of an ID token without verifying it. It
+// was received from the token endpoint directly, so it only names the user
+func ParseIDToken(idToken string) (*IdentityClaims, error) {
+	parts := strings.Split(idToken, ".")
+	if len(parts) != 3 {
+		return nil, errors.New("malformed ID token")
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, fmt.Errorf("decode ID token: %w", err)
+	}
+	claims := &IdentityClaims{}
+	if err := json.Unmarshal(payload, claims); err != nil {
+		return nil, fmt.Errorf("parse ID token: %w", err)
+	}
+	return claims, nil
+}
@@ -0,0 +1,161 @@
+// Package sso logs the CLI in to a kled server through the OAuth device
+// authorization flow of an OIDC provider. The tokens are kept in the OS
+// keychain, only the metadata of the logins is kept in the config folder.
+// HTTPClient attaches the access token of a login to backend requests and
+// refreshes it before it expires.
+package sso
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/loft-sh/devpod/pkg/config"
+)
+
+// LoginsFile holds the metadata of all logins
+const LoginsFile = "logins.json"
+
+// DefaultScopes are requested if a login doesn't specify any. offline_access
+// asks for a refresh token
+var DefaultScopes = []string{"openid", "profile", "email", "offline_access"}
+
+type Login struct {
+	// Server is the normalized URL of the kled server
+	Server string `json:"server"`
+
+	// Issuer is the URL of the OIDC provider
+	Issuer   string   `json:"issuer"`
+	ClientID string   `json:"clientId"`
+	Scopes   []string `json:"scopes,omitempty"`
+	// Audience is requested for the access token by providers that need it
+	Audience string `json:"audience,omitempty"`
+
+	// Subject is the user the provider logged in
+	Subject string `json:"subject,omitempty"`
+	Email   string `json:"email,omitempty"`
+
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+type logins struct {
+	Logins []*Login `json:"logins"`
+}
+
+// NormalizeServer turns server URLs into the key of their login
+func NormalizeServer(server string) string {
+	parsed, err := url.Parse(strings.TrimSpace(server))
+	if err != nil || parsed.Host == "" {
+		return strings.TrimSuffix(strings.ToLower(server), "/")
+	}
+	return strings.ToLower(parsed.Scheme) + "://" + strings.ToLower(parsed.Host) + strings.TrimSuffix(parsed.Path, "/")
+}
+
+func loginsPath() (string, error) {
+	configDir, err := config.GetConfigDir()
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(configDir, LoginsFile), nil
+}
+
+// List returns all logins sorted by server
+func List() ([]*Login, error) {
+	path, err := loginsPath()
+	if err != nil {
+		return nil, err
+	}
+
+	out, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return []*Login{}, nil
+		}
+		return nil, err
+	}
+
+	list := &logins{}
+	err = json.Unmarshal(out, list)
+	if err != nil {
+		return nil, fmt.Errorf("parse %s: %w", path, err)
+	}
+
+	sort.Slice(list.Logins, func(i, j int) bool {
+		return list.Logins[i].Server < list.Logins[j].Server
+	})
+	return list.Logins, nil
+}
+
+// Find returns the login for server or nil if the CLI isn't logged in to it
+func Find(server string) (*Login, error) {
+	list, err := List()
+	if err != nil {
+		return nil, err
+	}
+
+	server = NormalizeServer(server)
+	for _, login := range list {
+		if login.Server == server {
+			return login, nil
+		}
+	}
+
+	return nil, nil
+}
+
+func save(list []*Login) error {
+	path, err := loginsPath()
+	if err != nil {
+		return err
+	}
+
+	out, err := json.MarshalIndent(&logins{Logins: list}, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	err = os.MkdirAll(filepath.Dir(path), 0755)
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(path, out, 0600)
+}
+
+func upsert(login *Login) error {
+	list, err := List()
+	if err != nil {
+		return err
+	}
+
+	updated := []*Login{login}
+	for _, existing := range list {
+		if existing.Server != login.Server {
+			updated = append(updated, existing)
+		}
+	}
+
+	return save(updated)
+}
+
+func remove(server string) error {
+	list, err := List()
+	if err != nil {
+		return err
+	}
+
+	updated := []*Login{}
+	for _, existing := range list {
+		if existing.Server != server {
+			updated = append(updated, existing)
+		}
+	}
+
+	return save(updated)
+}
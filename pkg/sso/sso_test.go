@@ -0,0 +1,182 @@
+package sso
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/loft-sh/devpod/pkg/config"
+	"github.com/loft-sh/devpod/pkg/kerrors"
+	"gotest.tools/assert"
+)
+
+type memoryTokenStore map[string]*Tokens
+
+func (m memoryTokenStore) Store(server string, tokens *Tokens) error {
+	m[server] = tokens
+	return nil
+}
+
+func (m memoryTokenStore) Get(server string) (*Tokens, error) {
+	tokens, ok := m[server]
+	if !ok {
+		return nil, errors.New("credentials not found in native keychain")
+	}
+	return tokens, nil
+}
+
+func (m memoryTokenStore) Erase(server string) error {
+	delete(m, server)
+	return nil
+}
+
+func useMemoryTokenStore(t *testing.T) memoryTokenStore {
+	store := memoryTokenStore{}
+	previous := tokenStore
+	tokenStore = store
+	t.Cleanup(func() { tokenStore = previous })
+	return store
+}
+
+// fakeProvider answers the first polls with the given errors, then issues
+// tokens. Refreshes issue access-2 and rotate the refresh token
+func fakeProvider(t *testing.T, pollErrors []string) *httptest.Server {
+	idToken := "e30." + base64.RawURLEncoding.EncodeToString([]byte(`{"sub":"user-1","email":"a@kled.io"}`)) + ".sig"
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = r.ParseForm()
+		switch r.URL.Path {
+		case "/.well-known/openid-configuration":
+			_ = json.NewEncoder(w).Encode(map[string]string{
+				"issuer":                        server.URL,
+				"device_authorization_endpoint": server.URL + "/device",
+				"token_endpoint":                server.URL + "/token",
+			})
+		case "/device":
+			assert.Equal(t, r.Form.Get("client_id"), "kled-cli")
+			_ = json.NewEncoder(w).Encode(map[string]interface{}{
+				"device_code": "device-1", "user_code": "ABCD-EFGH", "verification_uri": server.URL + "/activate",
+				"expires_in": 600, "interval": 1,
+			})
+		case "/token":
+			switch r.Form.Get("grant_type") {
+			case "urn:ietf:params:oauth:grant-type:device_code":
+				if len(pollErrors) > 0 {
+					w.WriteHeader(http.StatusBadRequest)
+					_ = json.NewEncoder(w).Encode(map[string]string{"error": pollErrors[0]})
+					pollErrors = pollErrors[1:]
+					return
+				}
+				_ = json.NewEncoder(w).Encode(map[string]interface{}{
+					"access_token": "access-1", "refresh_token": "refresh-1", "id_token": idToken, "expires_in": 30,
+				})
+			case "refresh_token":
+				if r.Form.Get("refresh_token") != "refresh-1" {
+					w.WriteHeader(http.StatusBadRequest)
+					_ = json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant"})
+					return
+				}
+				_ = json.NewEncoder(w).Encode(map[string]interface{}{"access_token": "access-2", "refresh_token": "refresh-2", "expires_in": 3600})
+			}
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestNormalizeServer(t *testing.T) {
+	assert.Equal(t, NormalizeServer("https://Kled.Example.com/"), "https://kled.example.com")
+	assert.Equal(t, NormalizeServer("http://localhost:8000/api/"), "http://localhost:8000/api")
+}
+
+func TestDeviceLogin(t *testing.T) {
+	t.Setenv(config.KLED_HOME, t.TempDir())
+	store := useMemoryTokenStore(t)
+	pollUnit = time.Millisecond
+	provider := fakeProvider(t, []string{"authorization_pending", "slow_down", "authorization_pending"})
+
+	var prompted *DeviceAuthorization
+	login, err := DeviceLogin(context.Background(), LoginOptions{
+		Server:   "https://kled.example.com/",
+		Issuer:   provider.URL,
+		ClientID: "kled-cli",
+	}, func(authorization *DeviceAuthorization) { prompted = authorization })
+	assert.NilError(t, err)
+	assert.Equal(t, prompted.UserCode, "ABCD-EFGH")
+	assert.Equal(t, login.Subject, "user-1")
+	assert.Equal(t, login.Email, "a@kled.io")
+	assert.Equal(t, store["https://kled.example.com"].RefreshToken, "refresh-1")
+
+	found, err := Find("https://kled.example.com")
+	assert.NilError(t, err)
+	assert.Equal(t, found.ClientID, "kled-cli")
+
+	assert.NilError(t, Logout("https://kled.example.com"))
+	assert.Equal(t, len(store), 0)
+	assert.ErrorContains(t, Logout("https://kled.example.com"), "not logged in")
+}
+
+func TestDeviceLoginDenied(t *testing.T) {
+	t.Setenv(config.KLED_HOME, t.TempDir())
+	useMemoryTokenStore(t)
+	pollUnit = time.Millisecond
+	provider := fakeProvider(t, []string{"authorization_pending", "access_denied"})
+
+	_, err := DeviceLogin(context.Background(), LoginOptions{Server: "https://kled.example.com", Issuer: provider.URL, ClientID: "kled-cli"}, func(*DeviceAuthorization) {})
+	assert.Assert(t, errors.Is(err, ErrAccessDenied))
+	assert.Equal(t, kerrors.CodeOf(err), kerrors.PermissionDenied)
+
+	logins, err := List()
+	assert.NilError(t, err)
+	assert.Equal(t, len(logins), 0)
+}
+
+func TestTransport(t *testing.T) {
+	t.Setenv(config.KLED_HOME, t.TempDir())
+	store := useMemoryTokenStore(t)
+	provider := fakeProvider(t, nil)
+
+	var authorization []string
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		authorization = append(authorization, r.Header.Get("Authorization"))
+	}))
+	defer backend.Close()
+
+	// requests are sent unchanged without a login
+	client := HTTPClient(backend.URL)
+	_, err := client.Get(backend.URL)
+	assert.NilError(t, err)
+
+	assert.NilError(t, upsert(&Login{Server: NormalizeServer(backend.URL), Issuer: provider.URL, ClientID: "kled-cli"}))
+	store[NormalizeServer(backend.URL)] = &Tokens{AccessToken: "access-1", RefreshToken: "refresh-1", Expiry: time.Now().Add(time.Hour)}
+	client = HTTPClient(backend.URL)
+	_, err = client.Get(backend.URL)
+	assert.NilError(t, err)
+
+	// tokens about to expire are refreshed and stored
+	client = HTTPClient(backend.URL)
+	store[NormalizeServer(backend.URL)].Expiry = time.Now().Add(RefreshLeeway / 2)
+	_, err = client.Get(backend.URL)
+	assert.NilError(t, err)
+	assert.Equal(t, store[NormalizeServer(backend.URL)].RefreshToken, "refresh-2")
+
+	// API keys take precedence
+	req, _ := http.NewRequest(http.MethodGet, backend.URL, nil)
+	req.Header.Set("X-API-Key", "key")
+	_, err = client.Do(req)
+	assert.NilError(t, err)
+
+	assert.DeepEqual(t, authorization, []string{"", "Bearer access-1", "Bearer access-2", ""})
+
+	// a rejected refresh token asks to log in again
+	client = HTTPClient(backend.URL)
+	store[NormalizeServer(backend.URL)].Expiry = time.Now()
+	_, err = client.Get(backend.URL)
+	assert.Assert(t, errors.Is(err, ErrRefreshFailed))
+	assert.Equal(t, kerrors.RemediationOf(err), "run kled login to log in again")
+}
@@ -0,0 +1,83 @@
+package sso
+
+import (
+	"encoding/json"
+	"fmt"
+	"runtime"
+
+	"github.com/docker/cli/cli/config"
+	"github.com/docker/docker-credential-helpers/client"
+	"github.com/docker/docker-credential-helpers/credentials"
+)
+
+// tokenStore keeps the tokens of logins, tests replace it
+var tokenStore interface {
+	Store(server string, tokens *Tokens) error
+	Get(server string) (*Tokens, error)
+	Erase(server string) error
+} = &keychainStore{}
+
+// keychainStore uses the docker credential helper of the OS keychain like
+// registry logins, under a kled-sso:// URL so docker ignores the entries
+type keychainStore struct{}
+
+func (k *keychainStore) program() client.ProgramFunc {
+	helper := ""
+	dockerConfig, err := config.Load(config.Dir())
+	if err == nil {
+		helper = dockerConfig.CredentialsStore
+	}
+	if helper == "" {
+		switch runtime.GOOS {
+		case "darwin":
+			helper = "osxkeychain"
+		case "windows":
+			helper = "wincred"
+		default:
+			helper = "secretservice"
+		}
+	}
+
+	return client.NewShellProgramFunc("docker-credential-" + helper)
+}
+
+func keychainServerURL(server string) string {
+	return "kled-sso://" + server
+}
+
+func (k *keychainStore) Store(server string, tokens *Tokens) error {
+	secret, err := json.Marshal(tokens)
+	if err != nil {
+		return err
+	}
+	err = client.Store(k.program(), &credentials.Credentials{
+		ServerURL: keychainServerURL(server),
+		Username:  "kled",
+		Secret:    string(secret),
+	})
+	if err != nil {
+		return fmt.Errorf("store tokens in keychain: %w", err)
+	}
+	return nil
+}
+
+func (k *keychainStore) Get(server string) (*Tokens, error) {
+	creds, err := client.Get(k.program(), keychainServerURL(server))
+	if err != nil {
+		return nil, fmt.Errorf("get tokens from keychain: %w", err)
+	}
+	tokens := &Tokens{}
+	err = json.Unmarshal([]byte(creds.Secret), tokens)
+	if err != nil {
+		return nil, fmt.Errorf("parse tokens from keychain: %w", err)
+	}
+	return tokens, nil
+}
+
+func (k *keychainStore) Erase(server string) error {
+	err := client.Erase(k.program(), keychainServerURL(server))
+	if err != nil && !credentials.IsErrCredentialsNotFound(err) {
+		return fmt.Errorf("erase tokens from keychain: %w", err)
+	}
+	return nil
+}
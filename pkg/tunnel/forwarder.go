@@ -5,6 +5,7 @@ import (
 	"sync"
 
 	"github.com/loft-sh/devpod/pkg/netstat"
+	"github.com/loft-sh/devpod/pkg/portmanager"
 	devssh "github.com/loft-sh/devpod/pkg/ssh"
 	"github.com/loft-sh/log"
 	"golang.org/x/crypto/ssh"
@@ -12,11 +13,13 @@ import (
 
 // newForwarder returns a new forwarder using an SSH client and list of ports to forward,
 // for each port a new go routine is used to manage the SSH channel
-func newForwarder(sshClient *ssh.Client, forwardedPorts []string, log log.Logger) netstat.Forwarder {
+func newForwarder(sshClient *ssh.Client, forwardedPorts []string, ports *portmanager.Manager, log log.Logger) netstat.Forwarder {
 	return &forwarder{
 		sshClient:      sshClient,
 		forwardedPorts: forwardedPorts,
+		ports:          ports,
 		portMap:        map[string]context.CancelFunc{},
+		localMap:       map[string]string{},
 		log:            log,
 	}
 }
@@ -27,9 +30,11 @@ type forwarder struct {
 
 	sshClient      *ssh.Client
 	forwardedPorts []string
+	ports          *portmanager.Manager
 
-	portMap map[string]context.CancelFunc
-	log     log.Logger
+	portMap  map[string]context.CancelFunc
+	localMap map[string]string
+	log      log.Logger
 }
 
 // Forward opens an SSH channel in the existing connection with channel type "direct-tcpip" to forward the local port
@@ -41,13 +46,23 @@ func (f *forwarder) Forward(port string) error {
 		return nil
 	}
 
+	// allocate a free local port if the port is taken
+	local, ok, err := f.ports.Allocate("", port)
+	if err != nil {
+		return err
+	} else if !ok {
+		return nil
+	}
+	f.ports.Add(portmanager.SourceDetected, "localhost:"+port, local, port)
+
 	cancelCtx, cancel := context.WithCancel(context.Background())
 	f.portMap[port] = cancel
+	f.localMap[port] = local
 	f.log.Infof("Start port-forwarding on port %s", port)
 
 	go func(port string) {
 		// do the forward
-		err := devssh.PortForward(cancelCtx, f.sshClient, "tcp", "localhost:"+port, "tcp", "localhost:"+port, 0, f.log)
+		err := devssh.PortForward(cancelCtx, f.sshClient, "tcp", local, "tcp", "localhost:"+port, 0, f.log)
 		if err != nil {
 			f.log.Errorf("Error port forwarding %s: %v", port, err)
 		}
@@ -67,7 +82,9 @@ func (f *forwarder) StopForward(port string) error {
 
 	f.log.Infof("Stop port-forwarding on port %s", port)
 	f.portMap[port]()
+	f.ports.Remove(f.localMap[port])
 	delete(f.portMap, port)
+	delete(f.localMap, port)
 
 	return nil
 }
@@ -0,0 +1,212 @@
+package tunnel
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/loft-sh/log"
+)
+
+const relayPingInterval = 30 * time.Second
+
+// the TTLs the kled server accepts for a tunnel
+const (
+	MinTTL = time.Minute
+	MaxTTL = 24 * time.Hour
+)
+
+// ValidateTTL returns an error if the server would reject a tunnel living
+// for ttl
+func ValidateTTL(ttl time.Duration) error {
+	if ttl < MinTTL || ttl > MaxTTL {
+		return fmt.Errorf("invalid ttl %s, must be between %s and %s", ttl, MinTTL, MaxTTL)
+	}
+	return nil
+}
+
+type relayMessage struct {
+	Type   string `json:"type"`
+	Stream string `json:"stream,omitempty"`
+}
+
+// ServeRelay serves a public tunnel created on the kled server. tunnelURL is
+// the API URL of the tunnel, e.g. https://kled.example.com/api/tunnels/<id>/.
+// Every connection of a visitor arrives as a stream that is connected to
+// target. The control connection is re-established until ctx is done or the
+// server rejects the tunnel because it expired or was revoked.
+func ServeRelay(ctx context.Context, tunnelURL, connectToken, target string, log log.Logger) error {
+	baseURL := strings.TrimSuffix(tunnelURL, "/") + "/"
+	if strings.HasPrefix(baseURL, "http") {
+		baseURL = "ws" + strings.TrimPrefix(baseURL, "http")
+	}
+	header := http.Header{"Authorization": []string{"Bearer " + connectToken}}
+
+	backoff := time.Second
+	for {
+		connected, err := serveRelayOnce(ctx, baseURL, header, target, log)
+		if ctx.Err() != nil {
+			return nil
+		} else if _, ok := err.(*relayRejectedError); ok {
+			return err
+		}
+		if connected {
+			backoff = time.Second
+		}
+
+		log.Debugf("Tunnel connection lost, reconnecting in %s: %v", backoff, err)
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(backoff):
+		}
+		if backoff < 30*time.Second {
+			backoff *= 2
+		}
+	}
+}
+
+type relayRejectedError struct {
+	statusCode int
+	message    string
+}
+
+func (e *relayRejectedError) Error() string {
+	return fmt.Sprintf("tunnel rejected by server (%d): %s", e.statusCode, e.message)
+}
+
+func serveRelayOnce(ctx context.Context, baseURL string, header http.Header, target string, log log.Logger) (bool, error) {
+	control, res, err := websocket.DefaultDialer.DialContext(ctx, baseURL+"connect/", header)
+	if err != nil {
+		if res != nil {
+			switch res.StatusCode {
+			case http.StatusUnauthorized, http.StatusNotFound, http.StatusGone:
+				body, _ := io.ReadAll(io.LimitReader(res.Body, 1024))
+				return false, &relayRejectedError{statusCode: res.StatusCode, message: strings.TrimSpace(string(body))}
+			}
+		}
+		return false, err
+	}
+	defer control.Close()
+	log.Debugf("Connected tunnel to %s", baseURL)
+
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		ticker := time.NewTicker(relayPingInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				_ = control.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""), time.Now().Add(time.Second))
+				_ = control.Close()
+				return
+			case <-done:
+				return
+			case <-ticker.C:
+				_ = control.WriteControl(websocket.PingMessage, nil, time.Now().Add(10*time.Second))
+			}
+		}
+	}()
+
+	for {
+		message := relayMessage{}
+		if err := control.ReadJSON(&message); err != nil {
+			return true, err
+		}
+		if message.Type != "open" || message.Stream == "" {
+			continue
+		}
+
+		go func(stream string) {
+			if err := serveRelayStream(ctx, baseURL+"streams/"+stream+"/", header, target); err != nil {
+				log.Debugf("Error serving tunnel stream: %v", err)
+			}
+		}(message.Stream)
+	}
+}
+
+func serveRelayStream(ctx context.Context, streamURL string, header http.Header, target string) error {
+	ws, _, err := websocket.DefaultDialer.DialContext(ctx, streamURL, header)
+	if err != nil {
+		return fmt.Errorf("open stream: %w", err)
+	}
+	remote := &relayConn{ws: ws}
+	defer remote.Close()
+
+	local, err := (&net.Dialer{}).DialContext(ctx, "tcp", target)
+	if err != nil {
+		return fmt.Errorf("dial %s: %w", target, err)
+	}
+	defer local.Close()
+
+	errChan := make(chan error, 2)
+	go func() {
+		_, err := io.Copy(local, remote)
+		errChan <- err
+	}()
+	go func() {
+		_, err := io.Copy(remote, local)
+		errChan <- err
+	}()
+	return <-errChan
+}
+
+// relayConn reads and writes the binary messages of a stream WebSocket as a
+// byte stream.
+type relayConn struct {
+	ws      *websocket.Conn
+	reader  io.Reader
+	writeMu sync.Mutex
+}
+
+func (c *relayConn) Read(p []byte) (int, error) {
+	for {
+		if c.reader == nil {
+			messageType, reader, err := c.ws.NextReader()
+			if err != nil {
+				if websocket.IsCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway) {
+					return 0, io.EOF
+				}
+				return 0, err
+			}
+			if messageType != websocket.BinaryMessage {
+				continue
+			}
+			c.reader = reader
+		}
+
+		n, err := c.reader.Read(p)
+		if err == io.EOF {
+			c.reader = nil
+			if n > 0 {
+				return n, nil
+			}
+			continue
+		}
+		return n, err
+	}
+}
+
+func (c *relayConn) Write(p []byte) (int, error) {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+
+	if err := c.ws.WriteMessage(websocket.BinaryMessage, p); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+func (c *relayConn) Close() error {
+	c.writeMu.Lock()
+	_ = c.ws.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""), time.Now().Add(time.Second))
+	c.writeMu.Unlock()
+	return c.ws.Close()
+}
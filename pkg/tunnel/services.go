@@ -22,6 +22,7 @@ import (
 	"github.com/loft-sh/devpod/pkg/gitsshsigning"
 	"github.com/loft-sh/devpod/pkg/ide/openvscode"
 	"github.com/loft-sh/devpod/pkg/netstat"
+	"github.com/loft-sh/devpod/pkg/portmanager"
 	"github.com/loft-sh/devpod/pkg/provider"
 	devssh "github.com/loft-sh/devpod/pkg/ssh"
 	"github.com/loft-sh/log"
@@ -51,8 +52,16 @@ func RunServices(
 		exitAfterTimeout = 0
 	}
 
+	// record the forwarded ports, so they can be listed with kled workspace ports
+	workspaceContext, workspaceID := "", ""
+	if workspace != nil {
+		workspaceContext, workspaceID = workspace.Context, workspace.ID
+	}
+	ports := portmanager.NewManager(workspaceContext, workspaceID, devPodConfig.ContextOption(config.ContextOptionPublicPorts) == "true", log)
+	defer ports.Close()
+
 	// forward ports
-	forwardedPorts, err := forwardDevContainerPorts(ctx, containerClient, extraPorts, exitAfterTimeout, log)
+	forwardedPorts, err := forwardDevContainerPorts(ctx, containerClient, extraPorts, exitAfterTimeout, ports, log)
 	if err != nil {
 		return errors.Wrap(err, "forward ports")
 	}
@@ -84,7 +93,7 @@ func RunServices(
 		// create a port forwarder
 		var forwarder netstat.Forwarder
 		if forwardPorts {
-			forwarder = newForwarder(containerClient, append(forwardedPorts, fmt.Sprintf("%d", openvscode.DefaultVSCodePort)), log)
+			forwarder = newForwarder(containerClient, append(forwardedPorts, fmt.Sprintf("%d", openvscode.DefaultVSCodePort)), ports, log)
 		}
 
 		errChan := make(chan error, 1)
@@ -148,7 +157,7 @@ func RunServices(
 }
 
 // forwardDevContainerPorts forwards all the ports defined in the devcontainer.json
-func forwardDevContainerPorts(ctx context.Context, containerClient *ssh.Client, extraPorts []string, exitAfterTimeout time.Duration, log log.Logger) ([]string, error) {
+func forwardDevContainerPorts(ctx context.Context, containerClient *ssh.Client, extraPorts []string, exitAfterTimeout time.Duration, ports *portmanager.Manager, log log.Logger) ([]string, error) {
 	stdout := &bytes.Buffer{}
 	stderr := &bytes.Buffer{}
 	err := devssh.Run(ctx, containerClient, "cat "+setup.ResultLocation, nil, stdout, stderr, nil)
@@ -169,12 +178,12 @@ func forwardDevContainerPorts(ctx context.Context, containerClient *ssh.Client,
 
 	// extra ports
 	for _, port := range extraPorts {
-		forwardedPorts = append(forwardedPorts, forwardPort(ctx, containerClient, port, exitAfterTimeout, log)...)
+		forwardedPorts = append(forwardedPorts, forwardPort(ctx, containerClient, port, portmanager.SourceExtra, exitAfterTimeout, ports, log)...)
 	}
 
 	// app ports
 	for _, port := range result.MergedConfig.AppPort {
-		forwardedPorts = append(forwardedPorts, forwardPort(ctx, containerClient, port, 0, log)...)
+		forwardedPorts = append(forwardedPorts, forwardPort(ctx, containerClient, port, portmanager.SourceAppPort, 0, ports, log)...)
 	}
 
 	// forward ports
@@ -183,18 +192,33 @@ func forwardDevContainerPorts(ctx context.Context, containerClient *ssh.Client,
 		host, portNumber, err := parseForwardPort(port)
 		if err != nil {
 			log.Debugf("Error parsing forwardPort %s: %v", port, err)
+			continue
+		}
+
+		// allocate a free local port if the port is taken
+		requestedPort := strconv.FormatInt(portNumber, 10)
+		local, ok, err := ports.Allocate("", requestedPort)
+		if err != nil {
+			log.Errorf("Error allocating local port for %s: %v", port, err)
+			continue
+		} else if !ok {
+			continue
 		}
+		remote := fmt.Sprintf("%s:%d", host, portNumber)
+		ports.Add(portmanager.SourceForwardPorts, remote, local, requestedPort)
 
 		// try to forward
 		go func(port string) {
+			defer ports.Remove(local)
+
 			log.Debugf("Forward port %s", port)
-			err = devssh.PortForward(
+			err := devssh.PortForward(
 				ctx,
 				containerClient,
 				"tcp",
-				fmt.Sprintf("localhost:%d", portNumber),
+				local,
 				"tcp",
-				fmt.Sprintf("%s:%d", host, portNumber),
+				remote,
 				0,
 				log,
 			)
@@ -209,7 +233,7 @@ func forwardDevContainerPorts(ctx context.Context, containerClient *ssh.Client,
 	return forwardedPorts, nil
 }
 
-func forwardPort(ctx context.Context, containerClient *ssh.Client, port string, exitAfterTimeout time.Duration, log log.Logger) []string {
+func forwardPort(ctx context.Context, containerClient *ssh.Client, port string, source portmanager.Source, exitAfterTimeout time.Duration, ports *portmanager.Manager, log log.Logger) []string {
 	parsed, err := nat.ParsePortSpec(port)
 	if err != nil {
 		log.Debugf("Error parsing appPort %s: %v", port, err)
@@ -225,10 +249,24 @@ func forwardPort(ctx context.Context, containerClient *ssh.Client, port string,
 		if parsedPort.Binding.HostPort == "" {
 			parsedPort.Binding.HostPort = parsedPort.Port.Port()
 		}
+
+		// allocate a free local port if the port is taken
+		local, ok, err := ports.Allocate(parsedPort.Binding.HostIP, parsedPort.Binding.HostPort)
+		if err != nil {
+			log.Errorf("Error allocating local port for %s: %v", port, err)
+			continue
+		} else if !ok {
+			continue
+		}
+		remote := "localhost:" + parsedPort.Port.Port()
+		ports.Add(source, remote, local, parsedPort.Binding.HostPort)
+
 		go func(parsedPort nat.PortMapping) {
+			defer ports.Remove(local)
+
 			// do the forward
-			log.Debugf("Forward port %s:%s", parsedPort.Binding.HostIP+":"+parsedPort.Binding.HostPort, "localhost:"+parsedPort.Port.Port())
-			err = devssh.PortForward(ctx, containerClient, "tcp", parsedPort.Binding.HostIP+":"+parsedPort.Binding.HostPort, "tcp", "localhost:"+parsedPort.Port.Port(), exitAfterTimeout, log)
+			log.Debugf("Forward port %s:%s", local, remote)
+			err := devssh.PortForward(ctx, containerClient, "tcp", local, "tcp", remote, exitAfterTimeout, log)
 			if err != nil {
 				log.Errorf("Error port forwarding %s:%s:%s: %v", parsedPort.Binding.HostIP, parsedPort.Binding.HostPort, parsedPort.Port.Port(), err)
 			}
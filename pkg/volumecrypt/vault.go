@@ -0,0 +1,93 @@
+package volumecrypt
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"strings"
+
+	vault "github.com/hashicorp/vault/api"
+)
+
+// DefaultVaultKey is the transit key volume keys are wrapped with, as
+// <mount>/<key>
+const DefaultVaultKey = "transit/kled-volumes"
+
+// VaultTransit wraps volume keys with a key of a Vault transit engine, which
+// never leaves Vault. Address and token are read from VAULT_ADDR and
+// VAULT_TOKEN
+type VaultTransit struct {
+	client *vault.Client
+	mount  string
+	key    string
+}
+
+// NewVaultTransit returns the keys of the transit key at path, DefaultVaultKey
+// if empty
+func NewVaultTransit(path string) (*VaultTransit, error) {
+	if path == "" {
+		path = DefaultVaultKey
+	}
+	mount, key, ok := strings.Cut(strings.Trim(path, "/"), "/")
+	if !ok || mount == "" || key == "" {
+		return nil, fmt.Errorf("vault transit key %s needs to include the mount, e.g. %s", path, DefaultVaultKey)
+	}
+
+	client, err := vault.NewClient(vault.DefaultConfig())
+	if err != nil {
+		return nil, fmt.Errorf("create vault client: %w", err)
+	}
+	return &VaultTransit{client: client, mount: mount, key: key}, nil
+}
+
+func (v *VaultTransit) NewKey(ctx context.Context) ([]byte, string, error) {
+	secret, err := v.write(ctx, "datakey/plaintext", map[string]interface{}{"bits": 256})
+	if err != nil {
+		return nil, "", fmt.Errorf("generate volume key: %w", err)
+	}
+	key, err := base64.StdEncoding.DecodeString(fmt.Sprint(secret["plaintext"]))
+	if err != nil {
+		return nil, "", fmt.Errorf("decode volume key: %w", err)
+	}
+	return key, fmt.Sprint(secret["ciphertext"]), nil
+}
+
+func (v *VaultTransit) Unwrap(ctx context.Context, wrapped string) ([]byte, error) {
+	secret, err := v.write(ctx, "decrypt", map[string]interface{}{"ciphertext": wrapped})
+	if err != nil {
+		return nil, fmt.Errorf("unwrap volume key: %w", err)
+	}
+	key, err := base64.StdEncoding.DecodeString(fmt.Sprint(secret["plaintext"]))
+	if err != nil {
+		return nil, fmt.Errorf("decode volume key: %w", err)
+	}
+	return key, nil
+}
+
+func (v *VaultTransit) Rewrap(ctx context.Context, wrapped string) (string, error) {
+	secret, err := v.write(ctx, "rewrap", map[string]interface{}{"ciphertext": wrapped})
+	if err != nil {
+		return "", fmt.Errorf("rewrap volume key: %w", err)
+	}
+	return fmt.Sprint(secret["ciphertext"]), nil
+}
+
+// RotateKey creates a new version of the transit key. Volume keys wrapped
+// with older versions keep working until they are rewrapped
+func (v *VaultTransit) RotateKey(ctx context.Context) error {
+	_, err := v.client.Logical().WriteWithContext(ctx, v.mount+"/keys/"+v.key+"/rotate", nil)
+	if err != nil {
+		return fmt.Errorf("rotate vault transit key %s/%s: %w", v.mount, v.key, err)
+	}
+	return nil
+}
+
+func (v *VaultTransit) write(ctx context.Context, operation string, data map[string]interface{}) (map[string]interface{}, error) {
+	secret, err := v.client.Logical().WriteWithContext(ctx, v.mount+"/"+operation+"/"+v.key, data)
+	if err != nil {
+		return nil, err
+	} else if secret == nil || secret.Data == nil {
+		return nil, fmt.Errorf("vault returned no data for %s/%s/%s", v.mount, operation, v.key)
+	}
+	return secret.Data, nil
+}
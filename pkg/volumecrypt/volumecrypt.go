@@ -0,0 +1,360 @@
+// Package volumecrypt keeps workspace volumes on LUKS encrypted images.
+//
+// Every volume is an image file formatted with LUKS2 and ext4, unlocked with
+// dm-crypt and mounted next to it. The key of a volume is a random data key,
+// stored only wrapped by a key encryption key, e.g. a Vault transit key, so
+// the images and key files at rest reveal nothing without it. Rotating a
+// volume adds a new data key in a new key slot before removing the old one;
+// rotating the key encryption key only rewraps the stored data keys.
+//
+// The package needs Linux with cryptsetup, mkfs.ext4 and mount, and root.
+package volumecrypt
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/loft-sh/log"
+)
+
+// Keys creates and wraps the data keys of volumes
+type Keys interface {
+	// NewKey returns a new data key and the key wrapped
+	NewKey(ctx context.Context) ([]byte, string, error)
+	// Unwrap returns the data key of a wrapped key
+	Unwrap(ctx context.Context, wrapped string) ([]byte, error)
+	// Rewrap wraps a wrapped key with the latest key encryption key
+	Rewrap(ctx context.Context, wrapped string) (string, error)
+}
+
+var volumeName = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9_.-]*$`)
+
+// keyFile is stored as <volume>.key next to the image
+type keyFile struct {
+	Key     string    `json:"key"`
+	Created time.Time `json:"created"`
+	Rotated time.Time `json:"rotated,omitempty"`
+}
+
+// Manager keeps the encrypted volumes in a directory
+type Manager struct {
+	Dir  string
+	Keys Keys
+	Log  log.Logger
+
+	// exec runs a command and returns its combined output
+	exec func(cmd *exec.Cmd) ([]byte, error)
+}
+
+func NewManager(dir string, keys Keys, log log.Logger) *Manager {
+	return &Manager{
+		Dir:  dir,
+		Keys: keys,
+		Log:  log,
+		exec: func(cmd *exec.Cmd) ([]byte, error) {
+			return cmd.CombinedOutput()
+		},
+	}
+}
+
+// Exists reports whether the volume was created
+func (m *Manager) Exists(name string) bool {
+	_, err := os.Stat(m.keyPath(name))
+	return err == nil
+}
+
+// Volumes returns the names of the volumes, sorted
+func (m *Manager) Volumes() ([]string, error) {
+	entries, err := os.ReadDir(m.Dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	names := []string{}
+	for _, entry := range entries {
+		if name, ok := strings.CutSuffix(entry.Name(), ".key"); ok && !entry.IsDir() {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// Create formats a new volume of size bytes, opens it and returns where it
+// is mounted
+func (m *Manager) Create(ctx context.Context, name string, size int64) (string, error) {
+	if err := m.check(name); err != nil {
+		return "", err
+	} else if m.Exists(name) {
+		return "", fmt.Errorf("encrypted volume %s already exists", name)
+	}
+	if err := os.MkdirAll(m.Dir, 0700); err != nil {
+		return "", err
+	}
+
+	key, wrapped, err := m.Keys.NewKey(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	m.Log.Infof("Create encrypted volume %s", name)
+	image, err := os.OpenFile(m.imagePath(name), os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+	if err != nil {
+		return "", fmt.Errorf("create volume image: %w", err)
+	}
+	err = image.Truncate(size)
+	image.Close()
+	if err != nil {
+		os.Remove(m.imagePath(name))
+		return "", fmt.Errorf("allocate volume image: %w", err)
+	}
+
+	err = m.run(ctx, key, nil, "cryptsetup", "luksFormat", "--type", "luks2", "--batch-mode", "--key-file=-", m.imagePath(name))
+	if err == nil {
+		err = m.run(ctx, key, nil, "cryptsetup", "open", "--type", "luks", "--key-file=-", m.imagePath(name), m.mapperName(name))
+	}
+	if err == nil {
+		err = m.run(ctx, nil, nil, "mkfs.ext4", "-q", m.devicePath(name))
+	}
+	if err != nil {
+		_ = m.run(ctx, nil, nil, "cryptsetup", "close", m.mapperName(name))
+		os.Remove(m.imagePath(name))
+		return "", err
+	}
+
+	// the key file marks the volume as created, so it is written last
+	if err := m.writeKey(name, &keyFile{Key: wrapped, Created: time.Now().UTC()}); err != nil {
+		return "", err
+	}
+	return m.mount(ctx, name)
+}
+
+// Open unlocks and mounts a volume unless it already is, and returns where
+// it is mounted
+func (m *Manager) Open(ctx context.Context, name string) (string, error) {
+	if err := m.check(name); err != nil {
+		return "", err
+	}
+	if !m.active(ctx, name) {
+		stored, err := m.readKey(name)
+		if err != nil {
+			return "", err
+		}
+		key, err := m.Keys.Unwrap(ctx, stored.Key)
+		if err != nil {
+			return "", err
+		}
+
+		m.Log.Debugf("Unlock encrypted volume %s", name)
+		if err := m.run(ctx, key, nil, "cryptsetup", "open", "--type", "luks", "--key-file=-", m.imagePath(name), m.mapperName(name)); err != nil {
+			return "", err
+		}
+	}
+	return m.mount(ctx, name)
+}
+
+// Close unmounts and locks a volume
+func (m *Manager) Close(ctx context.Context, name string) error {
+	if err := m.check(name); err != nil {
+		return err
+	}
+	if m.mounted(ctx, name) {
+		if err := m.run(ctx, nil, nil, "umount", m.MountPath(name)); err != nil {
+			return err
+		}
+	}
+	if m.active(ctx, name) {
+		return m.run(ctx, nil, nil, "cryptsetup", "close", m.mapperName(name))
+	}
+	return nil
+}
+
+// Remove closes a volume and deletes its image and key
+func (m *Manager) Remove(ctx context.Context, name string) error {
+	if err := m.Close(ctx, name); err != nil {
+		return err
+	}
+	for _, path := range []string{m.keyPath(name), m.imagePath(name), m.MountPath(name)} {
+		if err := os.RemoveAll(path); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Rotate replaces the data key of a volume. The new key is added to a free
+// key slot and stored before the old key is removed, so the volume stays
+// accessible if the rotation is interrupted
+func (m *Manager) Rotate(ctx context.Context, name string) error {
+	if err := m.check(name); err != nil {
+		return err
+	}
+	stored, err := m.readKey(name)
+	if err != nil {
+		return err
+	}
+	oldKey, err := m.Keys.Unwrap(ctx, stored.Key)
+	if err != nil {
+		return err
+	}
+	newKey, wrapped, err := m.Keys.NewKey(ctx)
+	if err != nil {
+		return err
+	}
+
+	m.Log.Infof("Rotate the key of encrypted volume %s", name)
+	if err := m.run(ctx, oldKey, newKey, "cryptsetup", "luksAddKey", "--key-file=-", m.imagePath(name), "/dev/fd/3"); err != nil {
+		return err
+	}
+	stored.Key, stored.Rotated = wrapped, time.Now().UTC()
+	if err := m.writeKey(name, stored); err != nil {
+		return err
+	}
+	return m.run(ctx, oldKey, nil, "cryptsetup", "luksRemoveKey", m.imagePath(name), "-")
+}
+
+// Rewrap wraps the stored key of a volume with the latest version of the key
+// encryption key. The volume itself doesn't change
+func (m *Manager) Rewrap(ctx context.Context, name string) error {
+	if err := m.check(name); err != nil {
+		return err
+	}
+	stored, err := m.readKey(name)
+	if err != nil {
+		return err
+	}
+	wrapped, err := m.Keys.Rewrap(ctx, stored.Key)
+	if err != nil {
+		return err
+	}
+	stored.Key = wrapped
+	return m.writeKey(name, stored)
+}
+
+// MountPath is where a volume is mounted when it is open
+func (m *Manager) MountPath(name string) string {
+	return filepath.Join(m.Dir, name+".mnt")
+}
+
+func (m *Manager) mount(ctx context.Context, name string) (string, error) {
+	if err := os.MkdirAll(m.MountPath(name), 0755); err != nil {
+		return "", err
+	}
+	if !m.mounted(ctx, name) {
+		if err := m.run(ctx, nil, nil, "mount", m.devicePath(name), m.MountPath(name)); err != nil {
+			return "", err
+		}
+	}
+	return m.MountPath(name), nil
+}
+
+func (m *Manager) check(name string) error {
+	if runtime.GOOS != "linux" {
+		return fmt.Errorf("encrypted volumes need a Linux host, got %s", runtime.GOOS)
+	} else if !volumeName.MatchString(name) {
+		return fmt.Errorf("invalid volume name %q", name)
+	}
+	return nil
+}
+
+func (m *Manager) active(ctx context.Context, name string) bool {
+	return m.run(ctx, nil, nil, "cryptsetup", "status", m.mapperName(name)) == nil
+}
+
+func (m *Manager) mounted(ctx context.Context, name string) bool {
+	return m.run(ctx, nil, nil, "mountpoint", "-q", m.MountPath(name)) == nil
+}
+
+// run runs a command with key on its stdin and extraKey readable from
+// /dev/fd/3
+func (m *Manager) run(ctx context.Context, key, extraKey []byte, name string, args ...string) error {
+	cmd := exec.CommandContext(ctx, name, args...)
+	if key != nil {
+		cmd.Stdin = bytes.NewReader(key)
+	}
+	if extraKey != nil {
+		reader, writer, err := os.Pipe()
+		if err != nil {
+			return err
+		}
+		defer reader.Close()
+		go func() {
+			_, _ = writer.Write(extraKey)
+			writer.Close()
+		}()
+		cmd.ExtraFiles = []*os.File{reader}
+	}
+
+	out, err := m.exec(cmd)
+	if err != nil {
+		return fmt.Errorf("%s %s: %w: %s", name, args[0], err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+func (m *Manager) readKey(name string) (*keyFile, error) {
+	data, err := os.ReadFile(m.keyPath(name))
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("encrypted volume %s not found", name)
+	} else if err != nil {
+		return nil, err
+	}
+	stored := &keyFile{}
+	if err := json.Unmarshal(data, stored); err != nil {
+		return nil, fmt.Errorf("parse key of volume %s: %w", name, err)
+	}
+	return stored, nil
+}
+
+func (m *Manager) writeKey(name string, stored *keyFile) error {
+	data, err := json.Marshal(stored)
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(m.Dir, name+".key.*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), m.keyPath(name))
+}
+
+func (m *Manager) imagePath(name string) string {
+	return filepath.Join(m.Dir, name+".img")
+}
+
+func (m *Manager) keyPath(name string) string {
+	return filepath.Join(m.Dir, name+".key")
+}
+
+// mapperName is unique per image, so volumes of the same name in different
+// directories don't collide
+func (m *Manager) mapperName(name string) string {
+	sum := sha256.Sum256([]byte(m.imagePath(name)))
+	return "kled-" + hex.EncodeToString(sum[:8])
+}
+
+func (m *Manager) devicePath(name string) string {
+	return "/dev/mapper/" + m.mapperName(name)
+}
@@ -0,0 +1,168 @@
+package volumecrypt
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/loft-sh/log"
+	"gotest.tools/assert"
+)
+
+// fakeKeys wraps keys by prefixing them with the version of the key
+// encryption key
+type fakeKeys struct {
+	version int
+	next    int
+}
+
+func (k *fakeKeys) NewKey(ctx context.Context) ([]byte, string, error) {
+	k.next++
+	key := fmt.Sprintf("key-%d", k.next)
+	return []byte(key), fmt.Sprintf("v%d:%s", k.version, key), nil
+}
+
+func (k *fakeKeys) Unwrap(ctx context.Context, wrapped string) ([]byte, error) {
+	_, key, _ := strings.Cut(wrapped, ":")
+	return []byte(key), nil
+}
+
+func (k *fakeKeys) Rewrap(ctx context.Context, wrapped string) (string, error) {
+	_, key, _ := strings.Cut(wrapped, ":")
+	return fmt.Sprintf("v%d:%s", k.version, key), nil
+}
+
+// fakeHost records the commands run and tracks open and mounted devices
+type fakeHost struct {
+	commands []string
+	active   map[string]bool
+	mounted  map[string]bool
+}
+
+func (h *fakeHost) exec(cmd *exec.Cmd) ([]byte, error) {
+	line := strings.Join(cmd.Args, " ")
+	if cmd.Stdin != nil {
+		key, _ := io.ReadAll(cmd.Stdin)
+		line += " <" + string(key)
+	}
+	if len(cmd.ExtraFiles) > 0 {
+		key, _ := io.ReadAll(cmd.ExtraFiles[0])
+		line += " 3<" + string(key)
+	}
+
+	args := cmd.Args
+	switch {
+	case args[0] == "cryptsetup" && args[1] == "status":
+		if !h.active[args[2]] {
+			return nil, errors.New("exit status 4")
+		}
+		return nil, nil
+	case args[0] == "mountpoint":
+		if !h.mounted[args[2]] {
+			return nil, errors.New("exit status 32")
+		}
+		return nil, nil
+	case args[0] == "cryptsetup" && args[1] == "open":
+		h.active[args[len(args)-1]] = true
+	case args[0] == "cryptsetup" && args[1] == "close":
+		delete(h.active, args[2])
+	case args[0] == "mount":
+		h.mounted[args[2]] = true
+	case args[0] == "umount":
+		delete(h.mounted, args[1])
+	}
+	h.commands = append(h.commands, line)
+	return nil, nil
+}
+
+func newTestManager(t *testing.T) (*Manager, *fakeHost, *fakeKeys) {
+	if runtime.GOOS != "linux" {
+		t.Skip("encrypted volumes need Linux")
+	}
+	host := &fakeHost{active: map[string]bool{}, mounted: map[string]bool{}}
+	keys := &fakeKeys{version: 1}
+	manager := NewManager(t.TempDir(), keys, log.Discard)
+	manager.exec = host.exec
+	return manager, host, keys
+}
+
+func TestCreateAndOpen(t *testing.T) {
+	manager, host, _ := newTestManager(t)
+	ctx := context.Background()
+
+	mountPath, err := manager.Create(ctx, "cache", 1<<20)
+	assert.NilError(t, err)
+	assert.Equal(t, mountPath, manager.MountPath("cache"))
+	image, mapper := manager.imagePath("cache"), manager.mapperName("cache")
+	assert.DeepEqual(t, host.commands, []string{
+		"cryptsetup luksFormat --type luks2 --batch-mode --key-file=- " + image + " <key-1",
+		"cryptsetup open --type luks --key-file=- " + image + " " + mapper + " <key-1",
+		"mkfs.ext4 -q /dev/mapper/" + mapper,
+		"mount /dev/mapper/" + mapper + " " + mountPath,
+	})
+
+	stored, err := os.ReadFile(manager.keyPath("cache"))
+	assert.NilError(t, err)
+	assert.Assert(t, strings.Contains(string(stored), `"key":"v1:key-1"`))
+	info, err := os.Stat(image)
+	assert.NilError(t, err)
+	assert.Equal(t, info.Size(), int64(1<<20))
+
+	_, err = manager.Create(ctx, "cache", 1<<20)
+	assert.ErrorContains(t, err, "already exists")
+	_, err = manager.Create(ctx, "../etc", 1<<20)
+	assert.ErrorContains(t, err, "invalid volume name")
+
+	// after a reboot the volume is unlocked with the stored key
+	assert.NilError(t, manager.Close(ctx, "cache"))
+	host.commands = nil
+	_, err = manager.Open(ctx, "cache")
+	assert.NilError(t, err)
+	assert.DeepEqual(t, host.commands, []string{
+		"cryptsetup open --type luks --key-file=- " + image + " " + mapper + " <key-1",
+		"mount /dev/mapper/" + mapper + " " + mountPath,
+	})
+
+	host.commands = nil
+	_, err = manager.Open(ctx, "cache")
+	assert.NilError(t, err)
+	assert.Equal(t, len(host.commands), 0)
+
+	volumes, err := manager.Volumes()
+	assert.NilError(t, err)
+	assert.DeepEqual(t, volumes, []string{"cache"})
+}
+
+func TestRotate(t *testing.T) {
+	manager, host, keys := newTestManager(t)
+	ctx := context.Background()
+
+	_, err := manager.Create(ctx, "cache", 1<<20)
+	assert.NilError(t, err)
+	host.commands = nil
+
+	assert.NilError(t, manager.Rotate(ctx, "cache"))
+	image := manager.imagePath("cache")
+	assert.DeepEqual(t, host.commands, []string{
+		"cryptsetup luksAddKey --key-file=- " + image + " /dev/fd/3 <key-1 3<key-2",
+		"cryptsetup luksRemoveKey " + image + " - <key-1",
+	})
+	stored, err := manager.readKey("cache")
+	assert.NilError(t, err)
+	assert.Equal(t, stored.Key, "v1:key-2")
+	assert.Assert(t, !stored.Rotated.IsZero())
+
+	keys.version = 2
+	host.commands = nil
+	assert.NilError(t, manager.Rewrap(ctx, "cache"))
+	stored, err = manager.readKey("cache")
+	assert.NilError(t, err)
+	assert.Equal(t, stored.Key, "v2:key-2")
+	assert.Equal(t, len(host.commands), 0)
+}
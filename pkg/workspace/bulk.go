@@ -0,0 +1,151 @@
+package workspace
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	providerpkg "github.com/loft-sh/devpod/pkg/provider"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+// ParseLabels parses labels in the form KEY=VALUE. Keys and values follow the
+// kubernetes label syntax, so they can be used in selectors.
+func ParseLabels(rawLabels []string) (map[string]string, error) {
+	parsed := map[string]string{}
+	for _, rawLabel := range rawLabels {
+		key, value, ok := strings.Cut(rawLabel, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid label %s, expected KEY=VALUE", rawLabel)
+		}
+		if errs := validation.IsQualifiedName(key); len(errs) > 0 {
+			return nil, fmt.Errorf("invalid label key %s: %s", key, strings.Join(errs, ", "))
+		}
+		if errs := validation.IsValidLabelValue(value); len(errs) > 0 {
+			return nil, fmt.Errorf("invalid label value %s: %s", value, strings.Join(errs, ", "))
+		}
+
+		parsed[key] = value
+	}
+
+	return parsed, nil
+}
+
+// Select returns the workspaces with the given ids, or all workspaces if all
+// is set. Both are narrowed down by the label selector, e.g. team=ml,env!=prod.
+// A selector without ids selects from all workspaces.
+func Select(workspaces []*providerpkg.Workspace, ids []string, all bool, selector string) ([]*providerpkg.Workspace, error) {
+	if all && len(ids) > 0 {
+		return nil, fmt.Errorf("cannot use --all together with workspace names")
+	} else if !all && len(ids) == 0 && selector == "" {
+		return nil, fmt.Errorf("please specify the workspaces, --all or a label selector")
+	}
+
+	parsedSelector := labels.Everything()
+	if selector != "" {
+		var err error
+		parsedSelector, err = labels.Parse(selector)
+		if err != nil {
+			return nil, fmt.Errorf("parse label selector: %w", err)
+		}
+	}
+
+	candidates := workspaces
+	if len(ids) > 0 {
+		candidates = []*providerpkg.Workspace{}
+		for _, id := range ids {
+			found := false
+			for _, workspace := range workspaces {
+				if workspace.ID == id {
+					candidates = append(candidates, workspace)
+					found = true
+					break
+				}
+			}
+			if !found {
+				return nil, fmt.Errorf("workspace %s doesn't exist", id)
+			}
+		}
+	}
+
+	selected := []*providerpkg.Workspace{}
+	for _, workspace := range candidates {
+		if parsedSelector.Matches(labels.Set(workspace.Labels)) {
+			selected = append(selected, workspace)
+		}
+	}
+
+	return selected, nil
+}
+
+// BulkResult is the outcome of an operation on a single workspace.
+type BulkResult struct {
+	Workspace *providerpkg.Workspace
+	Err       error
+	Duration  time.Duration
+}
+
+// RunParallel runs fn for every workspace with at most parallelism operations
+// at the same time. progress is called after each workspace finished and is
+// never called concurrently. The results are in the order of workspaces.
+func RunParallel(
+	ctx context.Context,
+	workspaces []*providerpkg.Workspace,
+	parallelism int,
+	fn func(ctx context.Context, workspace *providerpkg.Workspace) error,
+	progress func(result BulkResult, done, total int),
+) []BulkResult {
+	if parallelism < 1 {
+		parallelism = 1
+	}
+
+	results := make([]BulkResult, len(workspaces))
+	semaphore := make(chan struct{}, parallelism)
+	progressLock := sync.Mutex{}
+	done := 0
+
+	waitGroup := sync.WaitGroup{}
+	for i, workspace := range workspaces {
+		waitGroup.Add(1)
+		go func(i int, workspace *providerpkg.Workspace) {
+			defer waitGroup.Done()
+
+			result := BulkResult{Workspace: workspace}
+			select {
+			case semaphore <- struct{}{}:
+				start := time.Now()
+				result.Err = fn(ctx, workspace)
+				result.Duration = time.Since(start)
+				<-semaphore
+			case <-ctx.Done():
+				result.Err = ctx.Err()
+			}
+			results[i] = result
+
+			if progress != nil {
+				progressLock.Lock()
+				done++
+				progress(result, done, len(workspaces))
+				progressLock.Unlock()
+			}
+		}(i, workspace)
+	}
+	waitGroup.Wait()
+
+	return results
+}
+
+// FailedResults returns the results that have an error.
+func FailedResults(results []BulkResult) []BulkResult {
+	failed := []BulkResult{}
+	for _, result := range results {
+		if result.Err != nil {
+			failed = append(failed, result)
+		}
+	}
+
+	return failed
+}
@@ -0,0 +1,92 @@
+package workspace
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	providerpkg "github.com/loft-sh/devpod/pkg/provider"
+	"gotest.tools/assert"
+)
+
+func TestSelect(t *testing.T) {
+	workspaces := []*providerpkg.Workspace{
+		{ID: "a", Labels: map[string]string{"team": "ml", "env": "dev"}},
+		{ID: "b", Labels: map[string]string{"team": "ml", "env": "prod"}},
+		{ID: "c", Labels: map[string]string{"team": "web"}},
+		{ID: "d"},
+	}
+	ids := func(workspaces []*providerpkg.Workspace) []string {
+		out := []string{}
+		for _, workspace := range workspaces {
+			out = append(out, workspace.ID)
+		}
+		return out
+	}
+
+	selected, err := Select(workspaces, nil, true, "")
+	assert.NilError(t, err)
+	assert.DeepEqual(t, ids(selected), []string{"a", "b", "c", "d"})
+
+	selected, err = Select(workspaces, nil, false, "team=ml,env!=prod")
+	assert.NilError(t, err)
+	assert.DeepEqual(t, ids(selected), []string{"a"})
+
+	selected, err = Select(workspaces, []string{"c", "b"}, false, "team=ml")
+	assert.NilError(t, err)
+	assert.DeepEqual(t, ids(selected), []string{"b"})
+
+	_, err = Select(workspaces, []string{"x"}, false, "")
+	assert.ErrorContains(t, err, "workspace x doesn't exist")
+	_, err = Select(workspaces, []string{"a"}, true, "")
+	assert.ErrorContains(t, err, "cannot use --all")
+	_, err = Select(workspaces, nil, false, "")
+	assert.ErrorContains(t, err, "please specify")
+}
+
+func TestParseLabels(t *testing.T) {
+	parsed, err := ParseLabels([]string{"team=ml", "example.com/owner=jane", "empty="})
+	assert.NilError(t, err)
+	assert.DeepEqual(t, parsed, map[string]string{"team": "ml", "example.com/owner": "jane", "empty": ""})
+
+	_, err = ParseLabels([]string{"team"})
+	assert.ErrorContains(t, err, "expected KEY=VALUE")
+	_, err = ParseLabels([]string{"team=not valid"})
+	assert.ErrorContains(t, err, "invalid label value")
+}
+
+func TestRunParallel(t *testing.T) {
+	workspaces := []*providerpkg.Workspace{{ID: "a"}, {ID: "b"}, {ID: "c"}, {ID: "d"}, {ID: "e"}}
+
+	var running, maxRunning int32
+	progressCalls := 0
+	results := RunParallel(context.Background(), workspaces, 2, func(ctx context.Context, workspace *providerpkg.Workspace) error {
+		current := atomic.AddInt32(&running, 1)
+		defer atomic.AddInt32(&running, -1)
+		for {
+			seen := atomic.LoadInt32(&maxRunning)
+			if current <= seen || atomic.CompareAndSwapInt32(&maxRunning, seen, current) {
+				break
+			}
+		}
+
+		time.Sleep(10 * time.Millisecond)
+		if workspace.ID == "c" {
+			return errors.New("failed")
+		}
+		return nil
+	}, func(result BulkResult, done, total int) {
+		progressCalls++
+		assert.Equal(t, total, 5)
+	})
+
+	assert.Equal(t, progressCalls, 5)
+	assert.Assert(t, maxRunning <= 2)
+	assert.Equal(t, results[2].Workspace.ID, "c")
+
+	failed := FailedResults(results)
+	assert.Equal(t, len(failed), 1)
+	assert.Equal(t, failed[0].Workspace.ID, "c")
+}
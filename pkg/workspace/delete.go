@@ -92,6 +92,14 @@ func Delete(ctx context.Context, devPodConfig *config.Config, args []string, ign
 		return "", err
 	}
 
+	// delete a shared machine with its last workspace
+	if !workspaceConfig.Machine.AutoDelete {
+		err = deleteUnusedMachine(ctx, devPodConfig, workspaceConfig.Machine.ID, deleteOptions, log)
+		if err != nil {
+			log.Warnf("Error deleting machine '%s': %v", workspaceConfig.Machine.ID, err)
+		}
+	}
+
 	return client.Workspace(), nil
 }
 
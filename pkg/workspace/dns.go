@@ -0,0 +1,43 @@
+package workspace
+
+import (
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/loft-sh/devpod/pkg/driver"
+	providerpkg "github.com/loft-sh/devpod/pkg/provider"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+// ParseDNS parses extra hosts in the form HOST:IP, DNS server IPs and search
+// domains. It returns nil if all of them are empty
+func ParseDNS(extraHosts, servers, search []string) (*providerpkg.WorkspaceDNSConfig, error) {
+	if len(extraHosts) == 0 && len(servers) == 0 && len(search) == 0 {
+		return nil, nil
+	}
+
+	dns := &providerpkg.WorkspaceDNSConfig{}
+	for _, extraHost := range extraHosts {
+		host, ip, err := driver.SplitExtraHost(extraHost)
+		if err != nil {
+			return nil, err
+		}
+		dns.ExtraHosts = append(dns.ExtraHosts, host+":"+ip)
+	}
+	for _, server := range servers {
+		if net.ParseIP(server) == nil {
+			return nil, fmt.Errorf("invalid DNS server %s, expected an IP address", server)
+		}
+		dns.Servers = append(dns.Servers, server)
+	}
+	for _, domain := range search {
+		domain = strings.TrimSuffix(domain, ".")
+		if errs := validation.IsDNS1123Subdomain(domain); len(errs) > 0 {
+			return nil, fmt.Errorf("invalid DNS search domain %s: %s", domain, strings.Join(errs, ", "))
+		}
+		dns.Search = append(dns.Search, domain)
+	}
+
+	return dns, nil
+}
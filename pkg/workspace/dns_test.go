@@ -0,0 +1,38 @@
+package workspace
+
+import (
+	"testing"
+
+	"github.com/loft-sh/devpod/pkg/driver"
+	providerpkg "github.com/loft-sh/devpod/pkg/provider"
+	"gotest.tools/assert"
+)
+
+func TestParseDNS(t *testing.T) {
+	dns, err := ParseDNS(nil, nil, nil)
+	assert.NilError(t, err)
+	assert.Assert(t, dns == nil)
+
+	dns, err = ParseDNS([]string{"git.corp.example.com:10.0.0.5", "ipv6.corp.example.com:[fd00::5]"}, []string{"10.0.0.53"}, []string{"corp.example.com."})
+	assert.NilError(t, err)
+	assert.DeepEqual(t, dns, &providerpkg.WorkspaceDNSConfig{
+		ExtraHosts: []string{"git.corp.example.com:10.0.0.5", "ipv6.corp.example.com:fd00::5"},
+		Servers:    []string{"10.0.0.53"},
+		Search:     []string{"corp.example.com"},
+	})
+	assert.DeepEqual(t, driver.DNSArgs(dns), []string{
+		"--add-host", "git.corp.example.com:10.0.0.5",
+		"--add-host", "ipv6.corp.example.com:fd00::5",
+		"--dns", "10.0.0.53",
+		"--dns-search", "corp.example.com",
+	})
+
+	_, err = ParseDNS([]string{"git.corp.example.com"}, nil, nil)
+	assert.ErrorContains(t, err, "expected HOST:IP")
+	_, err = ParseDNS([]string{"git.corp.example.com:10.0.0"}, nil, nil)
+	assert.ErrorContains(t, err, "invalid IP address")
+	_, err = ParseDNS(nil, []string{"dns.corp.example.com"}, nil)
+	assert.ErrorContains(t, err, "expected an IP address")
+	_, err = ParseDNS(nil, nil, []string{"Corp_Example"})
+	assert.ErrorContains(t, err, "invalid DNS search domain")
+}
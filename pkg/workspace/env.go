@@ -0,0 +1,103 @@
+package workspace
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/loft-sh/devpod/pkg/config"
+	providerpkg "github.com/loft-sh/devpod/pkg/provider"
+	"github.com/loft-sh/devpod/pkg/workspaceenv"
+	"github.com/loft-sh/log"
+)
+
+// UpdateEnv merges the template variables, --workspace-env variables and
+// Vault secret references of NAME=PATH#FIELD into the env of the workspace.
+// Given variables replace the saved ones of the same name. It returns if the
+// env changed
+func UpdateEnv(workspace *providerpkg.Workspace, templateEnv, cliEnv, secretRefs []string) (bool, error) {
+	if len(templateEnv) == 0 && len(cliEnv) == 0 && len(secretRefs) == 0 {
+		return false, nil
+	}
+
+	secrets := map[string]string{}
+	for _, entry := range secretRefs {
+		name, ref, err := workspaceenv.ParseSecretRef(entry)
+		if err != nil {
+			return false, err
+		}
+		secrets[name] = ref
+	}
+
+	if workspace.Env == nil {
+		workspace.Env = &providerpkg.WorkspaceEnvConfig{}
+	}
+	workspace.Env.Template = mergeEnv(workspace.Env.Template, workspaceenv.FromList(templateEnv))
+	workspace.Env.CLI = mergeEnv(workspace.Env.CLI, workspaceenv.FromList(cliEnv))
+	workspace.Env.Secrets = mergeEnv(workspace.Env.Secrets, secrets)
+	return true, nil
+}
+
+// EnvLayers returns the env layers of a workspace except for the project
+// .env, which lives in the workspace folder. The lower layers are
+// overridden by the project .env, the upper layers override it. The
+// timezone and locale of the host are left out if the workspace or context
+// opted out of them. Vault secrets are read if readSecrets is true,
+// otherwise their values are empty
+func EnvLayers(ctx context.Context, kledConfig *config.Config, workspace *providerpkg.Workspace, readSecrets bool, log log.Logger) ([]workspaceenv.Layer, []workspaceenv.Layer, error) {
+	providerEnv := map[string]string{}
+	if workspace.Provider.Name != "" {
+		provider, err := FindProvider(kledConfig, workspace.Provider.Name, log)
+		if err != nil {
+			log.Debugf("Skip env of provider %s: %v", workspace.Provider.Name, err)
+		} else if provider.Config != nil {
+			providerEnv = provider.Config.WorkspaceEnv
+		}
+	}
+
+	env := workspace.Env
+	if env == nil {
+		env = &providerpkg.WorkspaceEnvConfig{}
+	}
+
+	secrets := map[string]string{}
+	if readSecrets {
+		var err error
+		secrets, err = workspaceenv.ReadVaultSecrets(ctx, env.Secrets)
+		if err != nil {
+			return nil, nil, fmt.Errorf("read workspace secrets: %w", err)
+		}
+	} else {
+		for name := range env.Secrets {
+			secrets[name] = ""
+		}
+	}
+
+	hostEnv := map[string]string{}
+	if !workspace.SkipPersonalization && kledConfig.ContextOption(config.ContextOptionHostTimezoneLocale) != "false" {
+		hostEnv = workspaceenv.HostEnv()
+	}
+
+	lower := []workspaceenv.Layer{
+		{Source: workspaceenv.SourceHost, Env: hostEnv},
+		{Source: workspaceenv.SourceProvider, Env: providerEnv},
+		{Source: workspaceenv.SourceTemplate, Env: env.Template},
+	}
+	upper := []workspaceenv.Layer{
+		{Source: workspaceenv.SourceCLI, Env: env.CLI},
+		{Source: workspaceenv.SourceVault, Env: secrets, Secret: true},
+	}
+	return lower, upper, nil
+}
+
+func mergeEnv(saved, env map[string]string) map[string]string {
+	if len(env) == 0 {
+		return saved
+	} else if saved == nil {
+		saved = map[string]string{}
+	}
+
+	for name, value := range env {
+		saved[name] = value
+	}
+	return saved
+}
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"strconv"
 
 	"github.com/loft-sh/devpod/pkg/client"
 	"github.com/loft-sh/devpod/pkg/client/clientimplementation"
@@ -43,7 +44,18 @@ func listMachines(devPodConfig *config.Config, log log.Logger) ([]*providerpkg.M
 	return retMachines, nil
 }
 
-func ResolveMachine(devPodConfig *config.Config, args []string, userOptions []string, log log.Logger) (client.Client, error) {
+func ResolveMachine(devPodConfig *config.Config, args []string, userOptions []string, log log.Logger) (client.MachineClient, error) {
+	if len(userOptions) > 0 {
+		defaultProvider, _, err := LoadProviders(devPodConfig, log)
+		if err != nil {
+			return nil, err
+		}
+		err = ValidateProviderOptions(devPodConfig, defaultProvider.Config, userOptions)
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	machineClient, err := resolveMachine(devPodConfig, args, log)
 	if err != nil {
 		return nil, err
@@ -58,7 +70,7 @@ func ResolveMachine(devPodConfig *config.Config, args []string, userOptions []st
 	return machineClient, nil
 }
 
-func resolveMachine(devPodConfig *config.Config, args []string, log log.Logger) (client.Client, error) {
+func resolveMachine(devPodConfig *config.Config, args []string, log log.Logger) (client.MachineClient, error) {
 	// check if we have no args
 	if len(args) == 0 {
 		return nil, fmt.Errorf("please specify the machine name")
@@ -230,3 +242,99 @@ func SingleMachineName(devPodConfig *config.Config, provider string, log log.Log
 
 	return encoding.SafeConcatNameMax([]string{"kled-shared", provider, encoding.GetMachineUIDShort(log)}, encoding.MachineUIDLength)
 }
+
+// MachineUsage returns the number of workspaces on each machine.
+func MachineUsage(contextName string, log log.Logger) (map[string]int, error) {
+	workspaces, err := ListLocalWorkspaces(contextName, true, log)
+	if err != nil {
+		return nil, err
+	}
+
+	usage := map[string]int{}
+	for _, workspace := range workspaces {
+		if workspace.Machine.ID != "" {
+			usage[workspace.Machine.ID]++
+		}
+	}
+	return usage, nil
+}
+
+// CheckMachineUnused returns an error if MachineUsage reports workspaces on
+// the machine, which would be deleted along with it.
+func CheckMachineUnused(contextName, machineID string, log log.Logger) error {
+	usage, err := MachineUsage(contextName, log)
+	if err != nil {
+		return err
+	} else if usage[machineID] > 0 {
+		return fmt.Errorf("cannot delete machine '%s', because %d workspace(s) still use it. Please delete them first or use --force", machineID, usage[machineID])
+	}
+	return nil
+}
+
+// MachineMaxWorkspaces returns how many workspaces a newly created machine
+// hosts.
+func MachineMaxWorkspaces(devPodConfig *config.Config) int {
+	maxWorkspaces, err := strconv.Atoi(devPodConfig.ContextOption(config.ContextOptionMachineMaxWorkspaces))
+	if err != nil || maxWorkspaces < 1 {
+		return 1
+	}
+	return maxWorkspaces
+}
+
+// findMachineWithCapacity returns the machine of the provider that hosts the
+// most workspaces while still having room for another one, which packs
+// workspaces onto as few machines as possible.
+func findMachineWithCapacity(devPodConfig *config.Config, providerName string, log log.Logger) *providerpkg.Machine {
+	machines, err := listMachines(devPodConfig, log)
+	if err != nil {
+		log.Debugf("Error listing machines: %v", err)
+		return nil
+	}
+	usage, err := MachineUsage(devPodConfig.DefaultContext, log)
+	if err != nil {
+		log.Debugf("Error listing workspaces: %v", err)
+		return nil
+	}
+
+	var best *providerpkg.Machine
+	for _, machine := range machines {
+		if machine.Provider.Name != providerName || machine.MaxWorkspaces == 0 || usage[machine.ID] >= machine.MaxWorkspaces {
+			continue
+		}
+		if best == nil || usage[machine.ID] > usage[best.ID] || (usage[machine.ID] == usage[best.ID] && machine.ID < best.ID) {
+			best = machine
+		}
+	}
+	return best
+}
+
+// deleteUnusedMachine deletes an auto delete machine once no workspace uses
+// it anymore.
+func deleteUnusedMachine(ctx context.Context, devPodConfig *config.Config, machineID string, deleteOptions client.DeleteOptions, log log.Logger) error {
+	if machineID == "" || !providerpkg.MachineExists(devPodConfig.DefaultContext, machineID) {
+		return nil
+	}
+
+	machineConfig, err := providerpkg.LoadMachineConfig(devPodConfig.DefaultContext, machineID)
+	if err != nil {
+		return err
+	} else if !machineConfig.AutoDelete {
+		return nil
+	}
+
+	usage, err := MachineUsage(devPodConfig.DefaultContext, log)
+	if err != nil {
+		return err
+	} else if usage[machineID] > 0 {
+		log.Debugf("Machine '%s' still hosts %d workspace(s)", machineID, usage[machineID])
+		return nil
+	}
+
+	machineClient, err := loadExistingMachine(machineID, devPodConfig, log)
+	if err != nil {
+		return err
+	}
+
+	log.Infof("Deleting machine '%s', its last workspace was deleted", machineID)
+	return machineClient.Delete(ctx, deleteOptions)
+}
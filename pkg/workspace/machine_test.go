@@ -0,0 +1,82 @@
+package workspace
+
+import (
+	"testing"
+
+	"github.com/loft-sh/devpod/pkg/config"
+	providerpkg "github.com/loft-sh/devpod/pkg/provider"
+	"github.com/loft-sh/log"
+	"gotest.tools/assert"
+)
+
+func TestFindMachineWithCapacity(t *testing.T) {
+	t.Setenv(config.KLED_HOME, t.TempDir())
+	devPodConfig := &config.Config{DefaultContext: "default"}
+
+	for _, machine := range []*providerpkg.Machine{
+		{ID: "dedicated", Provider: providerpkg.MachineProviderConfig{Name: "aws"}},
+		{ID: "full", MaxWorkspaces: 1, Provider: providerpkg.MachineProviderConfig{Name: "aws"}},
+		{ID: "empty", MaxWorkspaces: 4, Provider: providerpkg.MachineProviderConfig{Name: "aws"}},
+		{ID: "busy", MaxWorkspaces: 4, Provider: providerpkg.MachineProviderConfig{Name: "aws"}},
+		{ID: "other", MaxWorkspaces: 4, Provider: providerpkg.MachineProviderConfig{Name: "gcloud"}},
+	} {
+		machine.Context = devPodConfig.DefaultContext
+		assert.NilError(t, providerpkg.SaveMachineConfig(machine))
+	}
+	for id, machineID := range map[string]string{"a": "full", "b": "busy", "c": "busy", "d": ""} {
+		assert.NilError(t, providerpkg.SaveWorkspaceConfig(&providerpkg.Workspace{
+			ID:      id,
+			Context: devPodConfig.DefaultContext,
+			Machine: providerpkg.WorkspaceMachineConfig{ID: machineID},
+		}))
+	}
+
+	usage, err := MachineUsage(devPodConfig.DefaultContext, log.Discard)
+	assert.NilError(t, err)
+	assert.DeepEqual(t, usage, map[string]int{"full": 1, "busy": 2})
+
+	// the fullest machine with capacity is used first
+	machine := findMachineWithCapacity(devPodConfig, "aws", log.Discard)
+	assert.Assert(t, machine != nil)
+	assert.Equal(t, machine.ID, "busy")
+
+	assert.NilError(t, providerpkg.SaveWorkspaceConfig(&providerpkg.Workspace{
+		ID:      "e",
+		Context: devPodConfig.DefaultContext,
+		Machine: providerpkg.WorkspaceMachineConfig{ID: "busy"},
+	}))
+	assert.NilError(t, providerpkg.SaveWorkspaceConfig(&providerpkg.Workspace{
+		ID:      "f",
+		Context: devPodConfig.DefaultContext,
+		Machine: providerpkg.WorkspaceMachineConfig{ID: "busy"},
+	}))
+	machine = findMachineWithCapacity(devPodConfig, "aws", log.Discard)
+	assert.Assert(t, machine != nil)
+	assert.Equal(t, machine.ID, "empty")
+
+	assert.Assert(t, findMachineWithCapacity(devPodConfig, "docker", log.Discard) == nil)
+}
+
+func TestCheckMachineUnused(t *testing.T) {
+	t.Setenv(config.KLED_HOME, t.TempDir())
+	contextName := "default"
+
+	for _, machine := range []*providerpkg.Machine{
+		{ID: "busy", MaxWorkspaces: 4, Provider: providerpkg.MachineProviderConfig{Name: "aws"}},
+		{ID: "idle", MaxWorkspaces: 4, Provider: providerpkg.MachineProviderConfig{Name: "aws"}},
+	} {
+		machine.Context = contextName
+		assert.NilError(t, providerpkg.SaveMachineConfig(machine))
+	}
+	for _, id := range []string{"a", "b"} {
+		assert.NilError(t, providerpkg.SaveWorkspaceConfig(&providerpkg.Workspace{
+			ID:      id,
+			Context: contextName,
+			Machine: providerpkg.WorkspaceMachineConfig{ID: "busy"},
+		}))
+	}
+
+	assert.ErrorContains(t, CheckMachineUnused(contextName, "busy", log.Discard), "2 workspace(s) still use it")
+	assert.NilError(t, CheckMachineUnused(contextName, "idle", log.Discard))
+	assert.NilError(t, CheckMachineUnused(contextName, "unknown", log.Discard))
+}
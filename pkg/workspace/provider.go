@@ -3,15 +3,22 @@ package workspace
 import (
 	"bytes"
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
 	"fmt"
 	"io"
 	"os"
 	"path/filepath"
+	"runtime"
 	"strings"
 
 	devpodhttp "github.com/loft-sh/devpod/pkg/http"
+	"github.com/loft-sh/devpod/pkg/options/resolver"
 	providerpkg "github.com/loft-sh/devpod/pkg/provider"
+	"github.com/loft-sh/devpod/pkg/providerplugin"
 	"github.com/loft-sh/devpod/pkg/types"
+	"github.com/loft-sh/devpod/pkg/version"
 	"github.com/loft-sh/devpod/providers"
 
 	"github.com/loft-sh/devpod/pkg/binaries"
@@ -153,6 +160,17 @@ func ResolveProvider(providerSource string, log log.Logger) ([]byte, *providerpk
 		return []byte(internalProviders[providerSource]), retSource, nil
 	}
 
+	// plugin on PATH or local plugin binary?
+	if pluginPath := providerplugin.Find(providerSource); pluginPath != "" {
+		out, err := resolvePlugin(pluginPath, providerplugin.LocalBinary(pluginPath))
+		if err != nil {
+			return nil, nil, err
+		}
+		retSource.File = pluginPath
+
+		return out, retSource, nil
+	}
+
 	// url?
 	if strings.HasPrefix(providerSource, "http://") || strings.HasPrefix(providerSource, "https://") {
 		log.Infof("Download provider %s...", providerSource)
@@ -162,6 +180,14 @@ func ResolveProvider(providerSource string, log log.Logger) ([]byte, *providerpk
 		}
 		retSource.URL = providerSource
 
+		// plugin binary?
+		if providerplugin.IsBinary(out) {
+			out, err = resolveDownloadedPlugin(providerSource, out)
+			if err != nil {
+				return nil, nil, err
+			}
+		}
+
 		return out, retSource, nil
 	}
 
@@ -250,6 +276,39 @@ func downloadProvider(url string) ([]byte, error) {
 	return io.ReadAll(resp.Body)
 }
 
+// resolvePlugin asks the plugin at pluginPath for its manifest and returns
+// the provider config that runs the plugin from binary.
+func resolvePlugin(pluginPath string, binary *providerpkg.ProviderBinary) ([]byte, error) {
+	manifest, err := providerplugin.Describe(context.Background(), pluginPath, version.GetVersion())
+	if err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(providerplugin.ProviderConfig(manifest, binary))
+}
+
+func resolveDownloadedPlugin(url string, raw []byte) ([]byte, error) {
+	tempDir, err := os.MkdirTemp("", "kled-provider-plugin-*")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(tempDir)
+
+	pluginPath := filepath.Join(tempDir, "plugin")
+	if runtime.GOOS == "windows" {
+		pluginPath += ".exe"
+	}
+	err = os.WriteFile(pluginPath, raw, 0755)
+	if err != nil {
+		return nil, err
+	}
+
+	checksum := sha256.Sum256(raw)
+	binary := providerplugin.LocalBinary(url)
+	binary.Checksum = hex.EncodeToString(checksum[:])
+	return resolvePlugin(pluginPath, binary)
+}
+
 func updateProvider(devPodConfig *config.Config, providerName string, raw []byte, source *providerpkg.ProviderSource, log log.Logger) (*providerpkg.ProviderConfig, error) {
 	providerConfig, err := providerpkg.ParseProvider(bytes.NewReader(raw))
 	if err != nil {
@@ -418,3 +477,32 @@ func ProviderFromHost(ctx context.Context, devPodConfig *config.Config, proHost
 
 	return provider.Config, nil
 }
+
+// ValidateProviderOptions checks the options given by the user in the form
+// KEY=VALUE against the option schema of the provider. It runs before
+// anything is created, so a typo doesn't leave a half created workspace.
+func ValidateProviderOptions(devPodConfig *config.Config, provider *providerpkg.ProviderConfig, userOptions []string) error {
+	if len(userOptions) == 0 {
+		return nil
+	}
+
+	values, err := providerpkg.ParseOptions(userOptions)
+	if err != nil {
+		return err
+	}
+
+	definitions := config.OptionDefinitions{}
+	for name, option := range provider.Options {
+		definitions[name] = option
+	}
+	for name, option := range devPodConfig.DynamicProviderOptionDefinitions(provider.Name) {
+		definitions[name] = option
+	}
+
+	err = resolver.ValidateUserValues(definitions, values)
+	if err != nil {
+		return fmt.Errorf("invalid options for provider %s:\n%w\nRun 'kled provider options %s' to see the available options", provider.Name, err, provider.Name)
+	}
+
+	return nil
+}
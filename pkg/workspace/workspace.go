@@ -265,6 +265,10 @@ func createWorkspace(
 	} else if provider.State == nil || !provider.State.Initialized {
 		return nil, nil, nil, fmt.Errorf("provider '%s' is not initialized, please make sure to run 'kled provider use %s' at least once before using this provider", provider.Config.Name, provider.Config.Name)
 	}
+	err = ValidateProviderOptions(devPodConfig, provider.Config, providerUserOptions)
+	if err != nil {
+		return nil, nil, nil, err
+	}
 
 	// resolve workspace
 	workspace, err := resolveWorkspaceConfig(ctx, provider, devPodConfig, name, workspaceID, source, isLocalPath, sshConfigPath, uid)
@@ -293,8 +297,14 @@ func createWorkspace(
 	var machineConfig *providerpkg.Machine
 	if provider.Config.IsMachineProvider() && workspace.Machine.ID == "" {
 		// create a new machine
+		maxWorkspaces := 0
 		if provider.State != nil && provider.State.SingleMachine {
 			workspace.Machine.ID = SingleMachineName(devPodConfig, provider.Config.Name, log)
+		} else if machine := findMachineWithCapacity(devPodConfig, provider.Config.Name, log); machine != nil {
+			workspace.Machine.ID = machine.ID
+		} else if maxWorkspaces = MachineMaxWorkspaces(devPodConfig); maxWorkspaces > 1 {
+			// the machine is shared, it is deleted with its last workspace
+			workspace.Machine.ID = encoding.CreateNewUIDShort(workspace.ID)
 		} else {
 			workspace.Machine.ID = encoding.CreateNewUIDShort(workspace.ID)
 			workspace.Machine.AutoDelete = true
@@ -313,6 +323,15 @@ func createWorkspace(
 			if err != nil {
 				return nil, nil, nil, err
 			}
+			if maxWorkspaces > 1 {
+				machineConfig.MaxWorkspaces = maxWorkspaces
+				machineConfig.AutoDelete = true
+				err = providerpkg.SaveMachineConfig(machineConfig)
+				if err != nil {
+					_ = clientimplementation.DeleteMachineFolder(machineConfig.Context, machineConfig.ID)
+					return nil, nil, nil, err
+				}
+			}
 
 			// create machine
 			machineClient, err := clientimplementation.NewMachineClient(devPodConfig, provider.Config, machineConfig, log)
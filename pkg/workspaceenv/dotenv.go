@@ -0,0 +1,81 @@
+package workspaceenv
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+var nameRegEx = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// ParseDotEnv parses a .env file. Lines are NAME=VALUE and may start with
+// export, values may be single or double quoted and unquoted values end at
+// a # comment. Double quoted values understand \n, \t, \" and \\
+func ParseDotEnv(data []byte) (map[string]string, error) {
+	env := map[string]string{}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for lineNum := 1; scanner.Scan(); lineNum++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		line = strings.TrimSpace(strings.TrimPrefix(line, "export "))
+
+		name, value, ok := strings.Cut(line, "=")
+		name = strings.TrimSpace(name)
+		if !ok || !nameRegEx.MatchString(name) {
+			return nil, fmt.Errorf("line %d: expected NAME=VALUE, got %s", lineNum, line)
+		}
+
+		value, err := parseValue(strings.TrimSpace(value))
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %s: %w", lineNum, name, err)
+		}
+		env[name] = value
+	}
+
+	return env, scanner.Err()
+}
+
+func parseValue(value string) (string, error) {
+	if value == "" {
+		return "", nil
+	}
+
+	switch quote := value[0]; quote {
+	case '\'':
+		end := strings.IndexByte(value[1:], '\'')
+		if end < 0 {
+			return "", fmt.Errorf("missing closing quote")
+		}
+		return value[1 : end+1], nil
+	case '"':
+		unquoted := strings.Builder{}
+		for i := 1; i < len(value); i++ {
+			switch c := value[i]; {
+			case c == '"':
+				return unquoted.String(), nil
+			case c == '\\' && i+1 < len(value):
+				i++
+				switch value[i] {
+				case 'n':
+					unquoted.WriteByte('\n')
+				case 't':
+					unquoted.WriteByte('\t')
+				default:
+					unquoted.WriteByte(value[i])
+				}
+			default:
+				unquoted.WriteByte(c)
+			}
+		}
+		return "", fmt.Errorf("missing closing quote")
+	}
+
+	if comment := strings.Index(value, " #"); comment >= 0 {
+		value = value[:comment]
+	}
+	return strings.TrimSpace(value), nil
+}
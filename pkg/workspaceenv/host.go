@@ -0,0 +1,78 @@
+package workspaceenv
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// localtimePath is the zoneinfo link of the host timezone on Linux and macOS
+var localtimePath = "/etc/localtime"
+
+// HostEnv returns the timezone and locale of the host as TZ and LANG
+func HostEnv() map[string]string {
+	env := map[string]string{}
+	if tz := hostTimezone(); tz != "" {
+		env["TZ"] = tz
+	}
+	if lang := hostLocale(); lang != "" {
+		env["LANG"] = lang
+	}
+
+	return env
+}
+
+func hostTimezone() string {
+	if tz := strings.TrimPrefix(os.Getenv("TZ"), ":"); tz != "" && !filepath.IsAbs(tz) {
+		return tz
+	}
+
+	target, err := os.Readlink(localtimePath)
+	if err != nil {
+		return ""
+	}
+	_, name, ok := strings.Cut(filepath.ToSlash(target), "zoneinfo/")
+	if !ok {
+		return ""
+	}
+
+	return name
+}
+
+func hostLocale() string {
+	for _, name := range []string{"LC_ALL", "LANG"} {
+		if locale := os.Getenv(name); locale != "" && locale != "C" && locale != "POSIX" {
+			return locale
+		}
+	}
+
+	return ""
+}
+
+// SupportedLocale returns locale if it's one of the available locales of
+// locale -a, otherwise C.UTF-8. Names are compared like glibc does, e.g.
+// en_US.UTF-8 matches en_US.utf8
+func SupportedLocale(locale string, available []string) string {
+	normalized := normalizeLocale(locale)
+	for _, candidate := range available {
+		if normalizeLocale(candidate) == normalized {
+			return locale
+		}
+	}
+
+	return "C.UTF-8"
+}
+
+func normalizeLocale(locale string) string {
+	name, codeset, ok := strings.Cut(locale, ".")
+	if !ok {
+		return name
+	}
+
+	modifier := ""
+	if i := strings.IndexByte(codeset, '@'); i >= 0 {
+		codeset, modifier = codeset[:i], codeset[i:]
+	}
+	codeset = strings.ToLower(strings.ReplaceAll(codeset, "-", ""))
+	return name + "." + codeset + modifier
+}
@@ -0,0 +1,71 @@
+package workspaceenv
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	vault "github.com/hashicorp/vault/api"
+)
+
+// ParseSecretRef parses a secret reference NAME=PATH#FIELD, e.g.
+// OPENAI_API_KEY=secret/data/team/openai#key. Without a field the field is
+// named like the variable
+func ParseSecretRef(entry string) (string, string, error) {
+	name, ref, ok := strings.Cut(entry, "=")
+	if !ok || !nameRegEx.MatchString(name) || ref == "" {
+		return "", "", fmt.Errorf("invalid secret %s, expected NAME=PATH#FIELD", entry)
+	}
+
+	return name, ref, nil
+}
+
+// ReadVaultSecrets reads the secrets referenced as PATH#FIELD from Vault.
+// Address and token are read from VAULT_ADDR and VAULT_TOKEN. Both KV
+// version 1 and 2 paths are supported
+func ReadVaultSecrets(ctx context.Context, refs map[string]string) (map[string]string, error) {
+	if len(refs) == 0 {
+		return nil, nil
+	}
+
+	client, err := vault.NewClient(vault.DefaultConfig())
+	if err != nil {
+		return nil, fmt.Errorf("create vault client: %w", err)
+	}
+
+	// several variables may be read from the same secret
+	secrets := map[string]map[string]interface{}{}
+	env := map[string]string{}
+	for name, ref := range refs {
+		path, field, ok := strings.Cut(ref, "#")
+		if !ok || field == "" {
+			field = name
+		}
+		path = strings.Trim(path, "/")
+
+		data, ok := secrets[path]
+		if !ok {
+			secret, err := client.Logical().ReadWithContext(ctx, path)
+			if err != nil {
+				return nil, fmt.Errorf("read vault secret %s: %w", path, err)
+			} else if secret == nil || secret.Data == nil {
+				return nil, fmt.Errorf("vault secret %s doesn't exist", path)
+			}
+
+			data = secret.Data
+			if nested, ok := data["data"].(map[string]interface{}); ok {
+				// KV version 2 wraps the fields together with their metadata
+				data = nested
+			}
+			secrets[path] = data
+		}
+
+		value, ok := data[field]
+		if !ok {
+			return nil, fmt.Errorf("vault secret %s has no field %s", path, field)
+		}
+		env[name] = fmt.Sprint(value)
+	}
+
+	return env, nil
+}
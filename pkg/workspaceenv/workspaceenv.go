@@ -0,0 +1,131 @@
+package workspaceenv
+
+import (
+	"sort"
+	"strings"
+)
+
+// Source is where the value of a workspace env variable comes from
+type Source string
+
+// The sources in the order they override each other, later ones win
+const (
+	SourceHost     Source = "host"
+	SourceProvider Source = "provider"
+	SourceTemplate Source = "template"
+	SourceProject  Source = "project"
+	SourceCLI      Source = "cli"
+	SourceVault    Source = "vault"
+)
+
+// DotEnvFile is the env file of the project at the root of the workspace
+// folder
+const DotEnvFile = ".env"
+
+// Layer holds the variables of a source
+type Layer struct {
+	Source Source
+	Env    map[string]string
+
+	// Secret layers have their values masked when they are shown
+	Secret bool
+}
+
+// secretNameParts mark variables as secret whatever their source is, e.g.
+// template secrets passed with --workspace-env
+var secretNameParts = []string{"TOKEN", "SECRET", "PASSWORD", "PASSWD", "API_KEY", "PRIVATE_KEY", "CREDENTIAL"}
+
+// Variable is a resolved workspace env variable
+type Variable struct {
+	Name   string
+	Value  string
+	Source Source
+	Secret bool
+
+	// Overrides are the sources of lower layers that set the variable as well
+	Overrides []Source
+}
+
+// DisplayValue returns the value to show to users, secrets are masked
+func (v Variable) DisplayValue() string {
+	if v.Secret {
+		return Mask(v.Value)
+	}
+
+	return v.Value
+}
+
+// Resolve merges the layers, variables of later layers override the ones of
+// earlier layers. The variables are sorted by name
+func Resolve(layers ...Layer) []Variable {
+	variables := map[string]*Variable{}
+	for _, layer := range layers {
+		for name, value := range layer.Env {
+			variable, ok := variables[name]
+			if !ok {
+				variables[name] = &Variable{Name: name, Value: value, Source: layer.Source, Secret: layer.Secret || LooksSecret(name)}
+				continue
+			}
+
+			variable.Overrides = append(variable.Overrides, variable.Source)
+			variable.Value, variable.Source, variable.Secret = value, layer.Source, layer.Secret || LooksSecret(name)
+		}
+	}
+
+	resolved := make([]Variable, 0, len(variables))
+	for _, variable := range variables {
+		resolved = append(resolved, *variable)
+	}
+	sort.Slice(resolved, func(i, j int) bool {
+		return resolved[i].Name < resolved[j].Name
+	})
+
+	return resolved
+}
+
+// ToList returns the variables as NAME=VALUE
+func ToList(variables []Variable) []string {
+	list := make([]string, 0, len(variables))
+	for _, variable := range variables {
+		list = append(list, variable.Name+"="+variable.Value)
+	}
+
+	return list
+}
+
+// FromList parses NAME=VALUE entries, entries without a = are ignored
+func FromList(list []string) map[string]string {
+	env := map[string]string{}
+	for _, entry := range list {
+		name, value, ok := strings.Cut(entry, "=")
+		if !ok || name == "" {
+			continue
+		}
+
+		env[name] = value
+	}
+
+	return env
+}
+
+// LooksSecret returns if the name of a variable suggests it holds a secret
+func LooksSecret(name string) bool {
+	name = strings.ToUpper(name)
+	for _, part := range secretNameParts {
+		if strings.Contains(name, part) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Mask hides a secret value, empty values stay empty so missing secrets
+// can be told apart
+func Mask(value string) string {
+	if value == "" {
+		return ""
+	}
+
+	return "********"
+}
@@ -0,0 +1,89 @@
+package workspaceenv
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"gotest.tools/assert"
+)
+
+func TestResolve(t *testing.T) {
+	variables := Resolve(
+		Layer{Source: SourceProvider, Env: map[string]string{"REGION": "eu", "LOG_LEVEL": "info"}},
+		Layer{Source: SourceTemplate, Env: map[string]string{"LOG_LEVEL": "debug"}},
+		Layer{Source: SourceProject, Env: map[string]string{"LOG_LEVEL": "trace", "GITHUB_TOKEN": "ghp_project"}},
+		Layer{Source: SourceCLI, Env: map[string]string{"REGION": "us"}},
+		Layer{Source: SourceVault, Env: map[string]string{"DB_URL": "postgres://secret"}, Secret: true},
+	)
+
+	assert.DeepEqual(t, variables, []Variable{
+		{Name: "DB_URL", Value: "postgres://secret", Source: SourceVault, Secret: true},
+		{Name: "GITHUB_TOKEN", Value: "ghp_project", Source: SourceProject, Secret: true},
+		{Name: "LOG_LEVEL", Value: "trace", Source: SourceProject, Overrides: []Source{SourceProvider, SourceTemplate}},
+		{Name: "REGION", Value: "us", Source: SourceCLI, Overrides: []Source{SourceProvider}},
+	})
+	assert.Equal(t, variables[0].DisplayValue(), "********")
+	assert.Equal(t, variables[2].DisplayValue(), "trace")
+	assert.DeepEqual(t, ToList(variables[2:]), []string{"LOG_LEVEL=trace", "REGION=us"})
+}
+
+func TestParseDotEnv(t *testing.T) {
+	env, err := ParseDotEnv([]byte(`
+# comment
+export NAME=value # trailing comment
+EMPTY=
+SINGLE='kept # not a comment'
+DOUBLE="line\nbreak \"quoted\""
+URL=https://example.com/#anchor
+`))
+	assert.NilError(t, err)
+	assert.DeepEqual(t, env, map[string]string{
+		"NAME":   "value",
+		"EMPTY":  "",
+		"SINGLE": "kept # not a comment",
+		"DOUBLE": "line\nbreak \"quoted\"",
+		"URL":    "https://example.com/#anchor",
+	})
+
+	_, err = ParseDotEnv([]byte("NOT VALID=1"))
+	assert.ErrorContains(t, err, "line 1")
+	_, err = ParseDotEnv([]byte(`OPEN="missing`))
+	assert.ErrorContains(t, err, "missing closing quote")
+}
+
+func TestParseSecretRef(t *testing.T) {
+	name, ref, err := ParseSecretRef("API_KEY=secret/data/team/api#key")
+	assert.NilError(t, err)
+	assert.Equal(t, name, "API_KEY")
+	assert.Equal(t, ref, "secret/data/team/api#key")
+
+	_, _, err = ParseSecretRef("API_KEY")
+	assert.ErrorContains(t, err, "expected NAME=PATH#FIELD")
+}
+
+func TestHostEnv(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("needs symlinks")
+	}
+	t.Setenv("TZ", "")
+	t.Setenv("LC_ALL", "")
+	t.Setenv("LANG", "de_DE.UTF-8")
+	localtime := filepath.Join(t.TempDir(), "localtime")
+	assert.NilError(t, os.Symlink("/usr/share/zoneinfo/Europe/Berlin", localtime))
+	defer func(path string) { localtimePath = path }(localtimePath)
+	localtimePath = localtime
+
+	assert.DeepEqual(t, HostEnv(), map[string]string{"TZ": "Europe/Berlin", "LANG": "de_DE.UTF-8"})
+
+	t.Setenv("TZ", ":America/New_York")
+	t.Setenv("LANG", "C")
+	assert.DeepEqual(t, HostEnv(), map[string]string{"TZ": "America/New_York"})
+}
+
+func TestSupportedLocale(t *testing.T) {
+	available := []string{"C", "C.utf8", "POSIX", "en_US.utf8"}
+	assert.Equal(t, SupportedLocale("en_US.UTF-8", available), "en_US.UTF-8")
+	assert.Equal(t, SupportedLocale("de_DE.UTF-8", available), "C.UTF-8")
+}
@@ -0,0 +1,174 @@
+package workspacestate
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/loft-sh/devpod/pkg/provider"
+)
+
+// StateFile is kept next to the workspace.json of every workspace.
+const StateFile = "workspace_state.json"
+
+// maxHistory is the number of transitions kept per workspace.
+const maxHistory = 20
+
+type Phase string
+
+const (
+	PhasePending  Phase = "Pending"
+	PhaseBuilding Phase = "Building"
+	PhaseStarting Phase = "Starting"
+	PhaseRunning  Phase = "Running"
+	PhaseStopping Phase = "Stopping"
+	PhaseStopped  Phase = "Stopped"
+	PhaseError    Phase = "Error"
+)
+
+// transitions are the phases each phase may move to. The empty phase is a
+// workspace without recorded state, which may be observed in any phase.
+var transitions = map[Phase][]Phase{
+	"":            {PhasePending, PhaseBuilding, PhaseStarting, PhaseRunning, PhaseStopping, PhaseStopped, PhaseError},
+	PhasePending:  {PhaseBuilding, PhaseStarting, PhaseStopped, PhaseError},
+	PhaseBuilding: {PhaseStarting, PhaseRunning, PhaseError},
+	PhaseStarting: {PhaseRunning, PhaseStopping, PhaseError},
+	PhaseRunning:  {PhaseBuilding, PhaseStarting, PhaseStopping, PhaseStopped, PhaseError},
+	PhaseStopping: {PhaseStopped, PhaseRunning, PhaseError},
+	PhaseStopped:  {PhaseBuilding, PhaseStarting, PhaseRunning, PhaseError},
+	PhaseError:    {PhasePending, PhaseBuilding, PhaseStarting, PhaseRunning, PhaseStopping, PhaseStopped},
+}
+
+// CanTransition returns if a workspace may move from one phase to another.
+func CanTransition(from, to Phase) bool {
+	for _, allowed := range transitions[from] {
+		if allowed == to {
+			return true
+		}
+	}
+
+	return false
+}
+
+type Transition struct {
+	From      Phase     `json:"from,omitempty"`
+	To        Phase     `json:"to"`
+	Reason    string    `json:"reason,omitempty"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// State is the persisted lifecycle state of a workspace.
+type State struct {
+	Phase Phase `json:"phase,omitempty"`
+
+	// Reason is a short CamelCase reason for the last transition, e.g.
+	// BuildFailed when in Error
+	Reason string `json:"reason,omitempty"`
+
+	// Message describes the error when in Error
+	Message string `json:"message,omitempty"`
+
+	// FailedStep is the step that failed when in Error, e.g. build or a
+	// lifecycle hook
+	FailedStep string `json:"failedStep,omitempty"`
+
+	// LogExcerpt are the last log lines of the failed step
+	LogExcerpt []string `json:"logExcerpt,omitempty"`
+
+	LastTransitionTime time.Time `json:"lastTransitionTime,omitempty"`
+
+	// LastTransitions holds when each phase was last entered
+	LastTransitions map[Phase]time.Time `json:"lastTransitions,omitempty"`
+
+	History []Transition `json:"history,omitempty"`
+}
+
+// Transition moves the state to the given phase. Transitions the state
+// machine does not allow are rejected.
+func (s *State) Transition(to Phase, reason string, now time.Time) error {
+	if !CanTransition(s.Phase, to) {
+		return fmt.Errorf("invalid transition from %s to %s", s.Phase, to)
+	}
+
+	s.force(to, reason, now)
+	return nil
+}
+
+// Fail moves the state to Error and records the failed step.
+func (s *State) Fail(step, reason, message string, logExcerpt []string, now time.Time) {
+	s.force(PhaseError, reason, now)
+	s.FailedStep = step
+	s.Message = message
+	s.LogExcerpt = logExcerpt
+}
+
+func (s *State) force(to Phase, reason string, now time.Time) {
+	s.History = append(s.History, Transition{
+		From:      s.Phase,
+		To:        to,
+		Reason:    reason,
+		Timestamp: now,
+	})
+	if len(s.History) > maxHistory {
+		s.History = s.History[len(s.History)-maxHistory:]
+	}
+
+	if s.LastTransitions == nil {
+		s.LastTransitions = map[Phase]time.Time{}
+	}
+	s.LastTransitions[to] = now
+
+	s.Phase = to
+	s.Reason = reason
+	s.LastTransitionTime = now
+	s.Message = ""
+	s.FailedStep = ""
+	s.LogExcerpt = nil
+}
+
+// Load returns the state of a workspace, or an empty state if none was
+// recorded yet.
+func Load(context, workspaceID string) (*State, error) {
+	workspaceDir, err := provider.GetWorkspaceDir(context, workspaceID)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := os.ReadFile(filepath.Join(workspaceDir, StateFile))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return &State{}, nil
+		}
+		return nil, err
+	}
+
+	state := &State{}
+	err = json.Unmarshal(data, state)
+	if err != nil {
+		return nil, fmt.Errorf("parse workspace state: %w", err)
+	}
+
+	return state, nil
+}
+
+// Save persists the state of a workspace.
+func Save(context, workspaceID string, state *State) error {
+	workspaceDir, err := provider.GetWorkspaceDir(context, workspaceID)
+	if err != nil {
+		return err
+	}
+
+	err = os.MkdirAll(workspaceDir, 0755)
+	if err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(filepath.Join(workspaceDir, StateFile), data, 0666)
+}
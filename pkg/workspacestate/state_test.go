@@ -0,0 +1,67 @@
+package workspacestate
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/loft-sh/log"
+	"gotest.tools/assert"
+)
+
+func TestTransition(t *testing.T) {
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	state := &State{}
+
+	assert.NilError(t, state.Transition(PhasePending, "", now))
+	assert.NilError(t, state.Transition(PhaseBuilding, "", now.Add(time.Second)))
+	assert.ErrorContains(t, state.Transition(PhaseStopped, "", now), "invalid transition from Building to Stopped")
+
+	state.Fail("build", "BuildFailed", "exit status 1", []string{"step 3/5 failed"}, now.Add(2*time.Second))
+	assert.Equal(t, state.Phase, PhaseError)
+	assert.Equal(t, state.FailedStep, "build")
+	assert.Equal(t, state.LastTransitions[PhaseBuilding], now.Add(time.Second))
+
+	// recovering clears the error details
+	assert.NilError(t, state.Transition(PhaseBuilding, "", now.Add(3*time.Second)))
+	assert.Equal(t, state.FailedStep, "")
+	assert.Assert(t, state.LogExcerpt == nil)
+	assert.Equal(t, len(state.History), 4)
+}
+
+func TestHistoryIsBounded(t *testing.T) {
+	state := &State{}
+	for i := 0; i < maxHistory+5; i++ {
+		state.force(PhaseRunning, fmt.Sprint(i), time.Now())
+	}
+
+	assert.Equal(t, len(state.History), maxHistory)
+	assert.Equal(t, state.History[maxHistory-1].Reason, fmt.Sprint(maxHistory+4))
+}
+
+func TestTracker(t *testing.T) {
+	t.Setenv("KLED_HOME", t.TempDir())
+
+	tracker := NewTracker("default", "my-workspace", log.Discard)
+	tracker.Set(PhaseRunning, "")
+	// stale state: a running workspace cannot start building without stopping,
+	// but the tracker accepts what was observed
+	tracker.Set(PhaseStopping, "")
+	tracker.Set(PhaseBuilding, "")
+	tracker.Fail("build", "BuildFailed", errors.New("exit status 1"), []string{"error: no space left on device"})
+
+	state, err := Load("default", "my-workspace")
+	assert.NilError(t, err)
+	assert.Equal(t, state.Phase, PhaseError)
+	assert.Equal(t, state.Message, "exit status 1")
+	assert.DeepEqual(t, state.LogExcerpt, []string{"error: no space left on device"})
+}
+
+func TestLogBuffer(t *testing.T) {
+	buffer := NewLogBuffer(2)
+	_, _ = buffer.Write([]byte("one\ntwo\nthr"))
+	_, _ = buffer.Write([]byte("ee\nfour"))
+
+	assert.DeepEqual(t, buffer.Lines(), []string{"three", "four"})
+}
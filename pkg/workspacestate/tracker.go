@@ -0,0 +1,135 @@
+package workspacestate
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	devpodlog "github.com/loft-sh/devpod/pkg/log"
+	"github.com/loft-sh/log"
+	"github.com/sirupsen/logrus"
+)
+
+// DefaultExcerptLines is the number of log lines kept for a failed step.
+const DefaultExcerptLines = 30
+
+// Tracker records the transitions of a workspace while a command runs. It
+// never fails the command, errors are only logged.
+type Tracker struct {
+	context     string
+	workspaceID string
+	log         log.Logger
+	now         func() time.Time
+}
+
+func NewTracker(context, workspaceID string, log log.Logger) *Tracker {
+	return &Tracker{
+		context:     context,
+		workspaceID: workspaceID,
+		log:         log,
+		now:         time.Now,
+	}
+}
+
+// State returns the current state, or an empty state if it cannot be read.
+func (t *Tracker) State() *State {
+	state, err := Load(t.context, t.workspaceID)
+	if err != nil {
+		t.log.Debugf("Error loading workspace state: %v", err)
+		return &State{}
+	}
+
+	return state
+}
+
+// Set moves the workspace to the given phase. If the recorded phase does not
+// allow the transition, the recorded state was stale and is overwritten.
+func (t *Tracker) Set(phase Phase, reason string) {
+	t.update(func(state *State) {
+		if state.Phase == phase {
+			return
+		}
+
+		err := state.Transition(phase, reason, t.now())
+		if err != nil {
+			t.log.Debugf("Workspace state was out of date: %v", err)
+			state.force(phase, reason, t.now())
+		}
+	})
+}
+
+// Fail moves the workspace to Error.
+func (t *Tracker) Fail(step, reason string, err error, logExcerpt []string) {
+	t.update(func(state *State) {
+		state.Fail(step, reason, err.Error(), logExcerpt, t.now())
+	})
+}
+
+func (t *Tracker) update(fn func(state *State)) {
+	state, err := Load(t.context, t.workspaceID)
+	if err != nil {
+		t.log.Debugf("Error loading workspace state: %v", err)
+		state = &State{}
+	}
+
+	fn(state)
+	err = Save(t.context, t.workspaceID, state)
+	if err != nil {
+		t.log.Debugf("Error saving workspace state: %v", err)
+	}
+}
+
+// LogBuffer is a writer that keeps the last lines written to it, used to
+// capture the log excerpt of a failing step.
+type LogBuffer struct {
+	m       sync.Mutex
+	max     int
+	lines   []string
+	partial string
+}
+
+func NewLogBuffer(maxLines int) *LogBuffer {
+	return &LogBuffer{max: maxLines}
+}
+
+func (b *LogBuffer) Write(p []byte) (int, error) {
+	b.m.Lock()
+	defer b.m.Unlock()
+
+	lines := strings.Split(b.partial+string(p), "\n")
+	b.partial = lines[len(lines)-1]
+	for _, line := range lines[:len(lines)-1] {
+		line = strings.TrimRight(line, "\r")
+		if line == "" {
+			continue
+		}
+
+		b.lines = append(b.lines, line)
+	}
+	if len(b.lines) > b.max {
+		b.lines = b.lines[len(b.lines)-b.max:]
+	}
+
+	return len(p), nil
+}
+
+// Tee returns a logger that logs to logger and keeps the info and higher
+// lines in the buffer.
+func (b *LogBuffer) Tee(logger log.Logger) log.Logger {
+	return devpodlog.NewCombinedLogger(logger.GetLevel(), logger, log.NewStreamLogger(b, b, logrus.InfoLevel))
+}
+
+// Lines returns the last lines written.
+func (b *LogBuffer) Lines() []string {
+	b.m.Lock()
+	defer b.m.Unlock()
+
+	lines := append([]string{}, b.lines...)
+	if b.partial != "" {
+		lines = append(lines, b.partial)
+	}
+	if len(lines) > b.max {
+		lines = lines[len(lines)-b.max:]
+	}
+	return lines
+}
@@ -0,0 +1,175 @@
+package workspacetemplate
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/loft-sh/devpod/pkg/contentstore"
+	"github.com/loft-sh/devpod/pkg/extract"
+	"github.com/loft-sh/devpod/pkg/git"
+	"github.com/loft-sh/devpod/pkg/image"
+	"github.com/loft-sh/log"
+)
+
+// OCIPrefix marks a template source as an OCI artifact, e.g.
+// oci://ghcr.io/my-org/templates/pytorch-cuda12:1.0.
+const OCIPrefix = "oci://"
+
+// Add fetches the template from source and installs it. Source may be a
+// local folder, a git repository (optionally with @branch and subpath like
+// kled up) or an OCI reference prefixed with oci://.
+func Add(ctx context.Context, source string, log log.Logger) (*Template, error) {
+	if fileInfo, err := os.Stat(source); err == nil && fileInfo.IsDir() {
+		absPath, err := filepath.Abs(source)
+		if err != nil {
+			return nil, err
+		}
+
+		return Install(absPath, absPath)
+	}
+
+	tempDir, err := os.MkdirTemp("", "kled-template-*")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(tempDir)
+
+	dir, err := fetch(ctx, source, tempDir, log)
+	if err != nil {
+		return nil, err
+	}
+
+	return Install(dir, source)
+}
+
+// Export fetches the template from source and adds it to store, so it can be
+// added in offline mode.
+func Export(ctx context.Context, source string, store *contentstore.Store, log log.Logger) error {
+	tempDir, err := os.MkdirTemp("", "kled-template-*")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tempDir)
+
+	dir, err := fetch(ctx, source, tempDir, log)
+	if err != nil {
+		return err
+	}
+
+	reader, writer := io.Pipe()
+	go func() {
+		_ = writer.CloseWithError(extract.WriteTar(writer, dir, true))
+	}()
+	defer reader.Close()
+
+	return store.AddFile(source, reader)
+}
+
+// fetch downloads the template into targetDir and returns the template folder
+func fetch(ctx context.Context, source, targetDir string, log log.Logger) (string, error) {
+	if contentstore.Offline() {
+		return extractFromStore(source, targetDir)
+	}
+
+	if strings.HasPrefix(source, OCIPrefix) {
+		err := pullOCI(ctx, strings.TrimPrefix(source, OCIPrefix), targetDir)
+		if err != nil {
+			return "", err
+		}
+
+		return targetDir, nil
+	}
+
+	return cloneGit(ctx, source, targetDir, log)
+}
+
+func extractFromStore(source, targetDir string) (string, error) {
+	store, err := contentstore.Default()
+	if err != nil {
+		return "", err
+	}
+
+	reader, err := store.File(source)
+	if err != nil {
+		return "", fmt.Errorf("offline mode: template %w", err)
+	}
+	defer reader.Close()
+
+	err = extract.Extract(reader, targetDir)
+	if err != nil {
+		return "", fmt.Errorf("extract template %s: %w", source, err)
+	}
+
+	return targetDir, nil
+}
+
+// pullOCI extracts the flattened filesystem of the referenced image, so a
+// template can be published with any tool that pushes images.
+func pullOCI(ctx context.Context, ref, targetDir string) error {
+	img, err := image.GetImage(ctx, ref)
+	if err != nil {
+		return err
+	}
+
+	reader := mutate.Extract(img)
+	defer reader.Close()
+
+	err = extract.Extract(reader, targetDir)
+	if err != nil {
+		return fmt.Errorf("extract template %s: %w", ref, err)
+	}
+
+	return nil
+}
+
+func cloneGit(ctx context.Context, source, targetDir string, log log.Logger) (string, error) {
+	gitInfo := git.NormalizeRepositoryGitInfo(source)
+	if gitInfo.Repository == "" {
+		return "", fmt.Errorf("unrecognized template source %s, expected a folder, git repository or %s reference", source, OCIPrefix)
+	}
+
+	if gitInfo.SubPath != "" && !filepath.IsLocal(gitInfo.SubPath) {
+		return "", fmt.Errorf("subpath %s of template %s must be relative to the repository root", gitInfo.SubPath, source)
+	}
+
+	cloneOptions := []git.Option{}
+	if gitInfo.Commit == "" && gitInfo.PR == "" {
+		cloneOptions = append(cloneOptions, git.WithCloneStrategy(git.ShallowCloneStrategy))
+	}
+
+	err := git.CloneRepository(ctx, gitInfo, targetDir, "", false, log, cloneOptions...)
+	if err != nil {
+		return "", fmt.Errorf("clone template %s: %w", source, err)
+	}
+
+	if gitInfo.SubPath != "" {
+		return subPathDir(targetDir, gitInfo.SubPath)
+	}
+
+	return targetDir, nil
+}
+
+// subPathDir resolves subPath below dir and fails if a symlink of the
+// repository points it outside of dir.
+func subPathDir(dir, subPath string) (string, error) {
+	root, err := filepath.EvalSymlinks(dir)
+	if err != nil {
+		return "", err
+	}
+	resolved, err := filepath.EvalSymlinks(filepath.Join(dir, subPath))
+	if err != nil {
+		return "", fmt.Errorf("resolve subpath %s: %w", subPath, err)
+	}
+
+	rel, err := filepath.Rel(root, resolved)
+	if err != nil || !filepath.IsLocal(rel) {
+		return "", fmt.Errorf("subpath %s is outside of the repository", subPath)
+	}
+
+	return resolved, nil
+}
@@ -0,0 +1,227 @@
+package workspacetemplate
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/alessio/shellescape"
+	"github.com/loft-sh/devpod/pkg/copy"
+	"github.com/tailscale/hujson"
+	"github.com/tidwall/jsonc"
+)
+
+// Scaffold copies the files of an installed template into targetDir and
+// hooks its post create scripts into the devcontainer.json. Existing files
+// are never overwritten. It returns the created files relative to targetDir.
+func Scaffold(template *Template, targetDir string) ([]string, error) {
+	templateDir, err := GetTemplateDir(template.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	return scaffold(template, templateDir, targetDir)
+}
+
+func scaffold(template *Template, templateDir, targetDir string) ([]string, error) {
+	files := []string{}
+	err := filepath.WalkDir(templateDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		relPath, err := filepath.Rel(templateDir, path)
+		if err != nil {
+			return err
+		}
+
+		if d.IsDir() {
+			if d.Name() == ".git" {
+				return filepath.SkipDir
+			}
+			return nil
+		} else if relPath == ConfigFile {
+			return nil
+		}
+
+		_, err = os.Lstat(filepath.Join(targetDir, relPath))
+		if err == nil {
+			return fmt.Errorf("%s already exists in %s", relPath, targetDir)
+		} else if !os.IsNotExist(err) {
+			return err
+		}
+
+		files = append(files, relPath)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, file := range files {
+		srcPath := filepath.Join(templateDir, file)
+		destPath := filepath.Join(targetDir, file)
+
+		fileInfo, err := os.Stat(srcPath)
+		if err != nil {
+			return nil, err
+		}
+
+		err = copy.CreateIfNotExists(filepath.Dir(destPath), 0755)
+		if err != nil {
+			return nil, err
+		}
+
+		err = copy.File(srcPath, destPath, fileInfo.Mode().Perm())
+		if err != nil {
+			return nil, fmt.Errorf("copy %s: %w", file, err)
+		}
+	}
+
+	if len(template.PostCreate) > 0 {
+		err = addPostCreateCommand(targetDir, template.PostCreate)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return files, nil
+}
+
+// addPostCreateCommand runs the scripts as postCreateCommand, after the
+// command the devcontainer.json already has. The file is patched in place to
+// keep its comments and order.
+func addPostCreateCommand(targetDir string, scripts []string) error {
+	path := ""
+	for _, candidate := range []string{filepath.Join(".devcontainer", "devcontainer.json"), ".devcontainer.json"} {
+		if _, err := os.Stat(filepath.Join(targetDir, candidate)); err == nil {
+			path = filepath.Join(targetDir, candidate)
+			break
+		}
+	}
+	if path == "" {
+		return fmt.Errorf("template has post create scripts, but no devcontainer.json")
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	devContainer := map[string]interface{}{}
+	err = json.Unmarshal(jsonc.ToJSON(data), &devContainer)
+	if err != nil {
+		return fmt.Errorf("parse %s: %w", path, err)
+	}
+
+	commands, err := shellCommands(devContainer["postCreateCommand"])
+	if err != nil {
+		return fmt.Errorf("parse postCreateCommand of %s: %w", path, err)
+	}
+	for _, script := range scripts {
+		commands = append(commands, shellescape.QuoteCommand([]string{"bash", filepath.ToSlash(script)}))
+	}
+
+	// don't escape the && of the command
+	patch := &bytes.Buffer{}
+	encoder := json.NewEncoder(patch)
+	encoder.SetEscapeHTML(false)
+	err = encoder.Encode([]map[string]interface{}{{
+		"op":    "add",
+		"path":  "/postCreateCommand",
+		"value": strings.Join(commands, " && "),
+	}})
+	if err != nil {
+		return err
+	}
+
+	value, err := hujson.Parse(data)
+	if err != nil {
+		return fmt.Errorf("parse %s: %w", path, err)
+	}
+	err = value.Patch(patch.Bytes())
+	if err != nil {
+		return fmt.Errorf("patch %s: %w", path, err)
+	}
+	if _, ok := devContainer["postCreateCommand"]; !ok {
+		if obj, ok := value.Value.(*hujson.Object); ok {
+			indentLastMember(obj)
+		}
+	}
+
+	return os.WriteFile(path, value.Pack(), 0644)
+}
+
+// indentLastMember formats a member added by a patch, which has no
+// whitespace, like the member before it.
+func indentLastMember(obj *hujson.Object) {
+	if len(obj.Members) < 2 {
+		return
+	}
+	prev, last := obj.Members[len(obj.Members)-2], &obj.Members[len(obj.Members)-1]
+
+	indent := prev.Name.BeforeExtra
+	if i := bytes.LastIndexByte(indent, '\n'); i >= 0 {
+		indent = indent[i+1:]
+		if len(last.Name.BeforeExtra) == 0 {
+			last.Name.BeforeExtra = hujson.Extra("\n")
+		}
+	}
+	if len(last.Name.BeforeExtra) == 0 || bytes.HasSuffix(last.Name.BeforeExtra, []byte("\n")) {
+		last.Name.BeforeExtra = append(last.Name.BeforeExtra, indent...)
+	}
+	if len(last.Value.BeforeExtra) == 0 {
+		last.Value.BeforeExtra = append(hujson.Extra{}, prev.Value.BeforeExtra...)
+	}
+}
+
+// shellCommands converts a lifecycle command to shell commands that run one
+// after another. The commands of the object form, which would run in
+// parallel, run in the order of their names.
+func shellCommands(lifecycleCommand interface{}) ([]string, error) {
+	switch value := lifecycleCommand.(type) {
+	case nil:
+		return nil, nil
+	case string:
+		if value == "" {
+			return nil, nil
+		}
+		return []string{value}, nil
+	case []interface{}:
+		args := []string{}
+		for _, arg := range value {
+			str, ok := arg.(string)
+			if !ok {
+				return nil, fmt.Errorf("unexpected argument %v", arg)
+			}
+			args = append(args, str)
+		}
+		if len(args) == 0 {
+			return nil, nil
+		}
+		return []string{shellescape.QuoteCommand(args)}, nil
+	case map[string]interface{}:
+		names := make([]string, 0, len(value))
+		for name := range value {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		commands := []string{}
+		for _, name := range names {
+			named, err := shellCommands(value[name])
+			if err != nil {
+				return nil, err
+			}
+			commands = append(commands, named...)
+		}
+		return commands, nil
+	default:
+		return nil, fmt.Errorf("unexpected command %v", value)
+	}
+}
@@ -0,0 +1,146 @@
+package workspacetemplate
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/ghodss/yaml"
+	"github.com/loft-sh/devpod/pkg/config"
+	"github.com/loft-sh/devpod/pkg/copy"
+)
+
+// GetTemplatesDir returns the folder installed templates are kept in. They
+// are shared between contexts.
+func GetTemplatesDir() (string, error) {
+	configDir, err := config.GetConfigDir()
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(configDir, "templates"), nil
+}
+
+// GetTemplateDir returns the folder of an installed template.
+func GetTemplateDir(name string) (string, error) {
+	if name == "" {
+		return "", fmt.Errorf("template name is empty")
+	}
+
+	templatesDir, err := GetTemplatesDir()
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(templatesDir, name), nil
+}
+
+// Get loads an installed template.
+func Get(name string) (*Template, error) {
+	dir, err := GetTemplateDir(name)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = os.Stat(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("template %s not found, add it via 'kled template add'", name)
+		}
+		return nil, err
+	}
+
+	return ParseDir(dir)
+}
+
+// List returns all installed templates sorted by name.
+func List() ([]*Template, error) {
+	templatesDir, err := GetTemplatesDir()
+	if err != nil {
+		return nil, err
+	}
+
+	entries, err := os.ReadDir(templatesDir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return []*Template{}, nil
+		}
+		return nil, err
+	}
+
+	templates := []*Template{}
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+
+		template, err := ParseDir(filepath.Join(templatesDir, entry.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("load template %s: %w", entry.Name(), err)
+		}
+		templates = append(templates, template)
+	}
+
+	sort.SliceStable(templates, func(i, j int) bool {
+		return templates[i].Name < templates[j].Name
+	})
+	return templates, nil
+}
+
+// Install copies the template in srcDir into the templates folder, replacing
+// an installed template of the same name.
+func Install(srcDir, source string) (*Template, error) {
+	template, err := ParseDir(srcDir)
+	if err != nil {
+		return nil, err
+	}
+	template.Source = source
+
+	dir, err := GetTemplateDir(template.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	err = os.RemoveAll(dir)
+	if err != nil {
+		return nil, fmt.Errorf("remove old template: %w", err)
+	}
+
+	err = copy.Directory(srcDir, dir)
+	if err != nil {
+		return nil, fmt.Errorf("copy template: %w", err)
+	}
+	_ = os.RemoveAll(filepath.Join(dir, ".git"))
+
+	// remember where the template came from
+	out, err := yaml.Marshal(template)
+	if err != nil {
+		return nil, err
+	}
+
+	err = os.WriteFile(filepath.Join(dir, ConfigFile), out, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	return template, nil
+}
+
+// Remove deletes an installed template.
+func Remove(name string) error {
+	dir, err := GetTemplateDir(name)
+	if err != nil {
+		return err
+	}
+
+	_, err = os.Stat(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return fmt.Errorf("template %s not found", name)
+		}
+		return err
+	}
+
+	return os.RemoveAll(dir)
+}
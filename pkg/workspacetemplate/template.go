@@ -0,0 +1,145 @@
+package workspacetemplate
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+
+	"github.com/ghodss/yaml"
+	"github.com/pkg/errors"
+)
+
+// ConfigFile is the file at the root of a template that describes it. Every
+// other file is copied into the workspace when the template is used.
+const ConfigFile = "template.yaml"
+
+var nameRegEx = regexp.MustCompile(`^[a-z0-9][a-z0-9\-]*$`)
+
+var secretNameRegEx = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// Template bundles everything needed to start a workspace of a kind, e.g.
+// pytorch-cuda12.
+type Template struct {
+	// Name of the template, used by kled template use and --template.
+	Name string `json:"name"`
+
+	// Description is shown by kled template list.
+	Description string `json:"description,omitempty"`
+
+	// Version of the template.
+	Version string `json:"version,omitempty"`
+
+	// Provider holds provider defaults used when none are given.
+	Provider *ProviderDefaults `json:"provider,omitempty"`
+
+	// Secrets the workspace needs. They are read from the environment or
+	// asked for and passed to the workspace as environment variables.
+	Secrets []Secret `json:"secrets,omitempty"`
+
+	// Env are env variables set in the workspace, the project .env and
+	// --workspace-env override them.
+	Env map[string]string `json:"env,omitempty"`
+
+	// PostCreate are scripts, relative to the template root, that run after
+	// the workspace container was created.
+	PostCreate []string `json:"postCreate,omitempty"`
+
+	// Source the template was added from.
+	Source string `json:"source,omitempty"`
+}
+
+// ProviderDefaults are the provider and provider options a template suggests.
+type ProviderDefaults struct {
+	Name    string            `json:"name,omitempty"`
+	Options map[string]string `json:"options,omitempty"`
+}
+
+// Secret is a value the workspace needs that must not be part of the template.
+type Secret struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	Required    bool   `json:"required,omitempty"`
+}
+
+// Parse reads a template.yaml.
+func Parse(reader io.Reader) (*Template, error) {
+	payload, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, err
+	}
+
+	template := &Template{}
+	err = yaml.Unmarshal(payload, template)
+	if err != nil {
+		return nil, errors.Wrap(err, "parse template config")
+	}
+
+	err = template.Validate()
+	if err != nil {
+		return nil, errors.Wrap(err, "validate")
+	}
+
+	return template, nil
+}
+
+// ParseDir reads the template.yaml in the given template folder.
+func ParseDir(dir string) (*Template, error) {
+	f, err := os.Open(filepath.Join(dir, ConfigFile))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("%s is missing, not a template", ConfigFile)
+		}
+		return nil, err
+	}
+	defer f.Close()
+
+	return Parse(f)
+}
+
+func (t *Template) Validate() error {
+	if t.Name == "" {
+		return fmt.Errorf("name is missing in %s", ConfigFile)
+	} else if !nameRegEx.MatchString(t.Name) {
+		return fmt.Errorf("template name can only include lowercase letters, numbers or dashes")
+	} else if len(t.Name) > 64 {
+		return fmt.Errorf("template name cannot be longer than 64 characters")
+	}
+
+	for _, secret := range t.Secrets {
+		if !secretNameRegEx.MatchString(secret.Name) {
+			return fmt.Errorf("secret name %q is not a valid environment variable name", secret.Name)
+		}
+	}
+
+	for name := range t.Env {
+		if !secretNameRegEx.MatchString(name) {
+			return fmt.Errorf("env name %q is not a valid environment variable name", name)
+		}
+	}
+
+	for _, script := range t.PostCreate {
+		if filepath.IsAbs(script) || !filepath.IsLocal(script) {
+			return fmt.Errorf("post create script %s must be relative to the template root", script)
+		}
+	}
+
+	return nil
+}
+
+// MissingSecrets returns the required secrets lookup has no value for.
+func (t *Template) MissingSecrets(lookup func(string) (string, bool)) []Secret {
+	missing := []Secret{}
+	for _, secret := range t.Secrets {
+		if !secret.Required {
+			continue
+		}
+
+		if value, ok := lookup(secret.Name); !ok || value == "" {
+			missing = append(missing, secret)
+		}
+	}
+
+	return missing
+}
@@ -0,0 +1,117 @@
+package workspacetemplate
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"gotest.tools/assert"
+)
+
+const pytorchTemplate = `name: pytorch-cuda12
+description: PyTorch with CUDA 12
+provider:
+  name: kubernetes
+  options:
+    KUBERNETES_NAMESPACE: ml
+secrets:
+  - name: HF_TOKEN
+    required: true
+  - name: WANDB_API_KEY
+postCreate:
+  - scripts/setup.sh
+`
+
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		assert.NilError(t, os.MkdirAll(filepath.Dir(path), 0755))
+		assert.NilError(t, os.WriteFile(path, []byte(content), 0644))
+	}
+}
+
+func TestParse(t *testing.T) {
+	template, err := Parse(strings.NewReader(pytorchTemplate))
+	assert.NilError(t, err)
+	assert.Equal(t, template.Name, "pytorch-cuda12")
+	assert.Equal(t, template.Provider.Options["KUBERNETES_NAMESPACE"], "ml")
+
+	missing := template.MissingSecrets(func(string) (string, bool) { return "", false })
+	assert.Equal(t, len(missing), 1)
+	assert.Equal(t, missing[0].Name, "HF_TOKEN")
+
+	_, err = Parse(strings.NewReader("name: Bad_Name\n"))
+	assert.ErrorContains(t, err, "lowercase")
+
+	_, err = Parse(strings.NewReader("name: escape\npostCreate: [../run.sh]\n"))
+	assert.ErrorContains(t, err, "relative to the template root")
+}
+
+func TestScaffold(t *testing.T) {
+	templateDir := t.TempDir()
+	writeFiles(t, templateDir, map[string]string{
+		ConfigFile: pytorchTemplate,
+		".devcontainer/devcontainer.json": `{
+  // comments are allowed
+  "image": "pytorch/pytorch",
+  "postCreateCommand": "pip install -r requirements.txt"
+}`,
+		"scripts/setup.sh": "#!/bin/bash\n",
+	})
+
+	template, err := ParseDir(templateDir)
+	assert.NilError(t, err)
+
+	targetDir := t.TempDir()
+	files, err := scaffold(template, templateDir, targetDir)
+	assert.NilError(t, err)
+	assert.Equal(t, len(files), 2)
+
+	data, err := os.ReadFile(filepath.Join(targetDir, ".devcontainer", "devcontainer.json"))
+	assert.NilError(t, err)
+
+	assert.Equal(t, string(data), `{
+  // comments are allowed
+  "image": "pytorch/pytorch",
+  "postCreateCommand": "pip install -r requirements.txt && bash scripts/setup.sh"
+}`)
+
+	// scaffolding again must not overwrite the now existing files
+	_, err = scaffold(template, templateDir, targetDir)
+	assert.ErrorContains(t, err, "already exists")
+}
+
+func TestShellCommands(t *testing.T) {
+	commands, err := shellCommands(map[string]interface{}{
+		"server": []interface{}{"npm", "run", "dev server"},
+		"deps":   "npm install",
+	})
+	assert.NilError(t, err)
+	assert.DeepEqual(t, commands, []string{"npm install", "npm run 'dev server'"})
+}
+
+func TestSubPathDir(t *testing.T) {
+	repoDir := t.TempDir()
+	writeFiles(t, repoDir, map[string]string{"templates/pytorch/" + ConfigFile: pytorchTemplate})
+	assert.NilError(t, os.Symlink(t.TempDir(), filepath.Join(repoDir, "escape")))
+
+	dir, err := subPathDir(repoDir, "templates/pytorch")
+	assert.NilError(t, err)
+	assert.Equal(t, filepath.Base(dir), "pytorch")
+
+	_, err = subPathDir(repoDir, "escape")
+	assert.ErrorContains(t, err, "outside of the repository")
+}
+
+func TestAddPostCreateCommand(t *testing.T) {
+	targetDir := t.TempDir()
+	writeFiles(t, targetDir, map[string]string{
+		".devcontainer.json": "{\n  // keep me\n  \"image\": \"python\",\n}\n",
+	})
+
+	assert.NilError(t, addPostCreateCommand(targetDir, []string{"scripts/set up.sh"}))
+	data, err := os.ReadFile(filepath.Join(targetDir, ".devcontainer.json"))
+	assert.NilError(t, err)
+	assert.Equal(t, string(data), "{\n  // keep me\n  \"image\": \"python\",\n  \"postCreateCommand\": \"bash 'scripts/set up.sh'\"\n}\n")
+}